@@ -3,26 +3,38 @@ package compliance
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/llm"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/trend"
 )
 
 // Agent performs compliance checks on IaC resources.
 type Agent struct {
-	rules     []analyzer.Rule
-	llmClient *llm.Client
-	enableLLM bool
+	index *analyzer.RuleIndex
+	// controls indexes the rules framework controls map to.
+	controls *analyzer.RuleIndex
+	// frameworks are assessed when a request selects none; all when empty.
+	frameworks []string
+	llmClient  *llm.Client
+	enableLLM  bool
+	// trends records the scores of audits of named repositories.
+	trends trend.Store
+	now    func() time.Time
 }
 
 // New creates a new compliance Agent.
 func New(opts ...Option) *Agent {
 	a := &Agent{
-		rules: analyzer.RulesByCategory("Compliance"),
+		index:    analyzer.NewRuleIndex(analyzer.RulesByCategory("Compliance")),
+		controls: frameworkIndex(),
+		now:      time.Now,
 	}
 	for _, o := range opts {
 		o(a)
@@ -41,62 +53,142 @@ func WithLLM(client *llm.Client) Option {
 	}
 }
 
+// WithFrameworks sets the frameworks assessed when a request does not
+// select any, as IDs from FrameworkIDs; all of them by default.
+func WithFrameworks(ids ...string) Option {
+	return func(a *Agent) {
+		a.frameworks = ids
+	}
+}
+
+// WithTrends records the framework scores of every audit of a named
+// repository (protocol.MetaRepository) in store, for GET /trends.
+func WithTrends(store trend.Store) Option {
+	return func(a *Agent) {
+		a.trends = store
+	}
+}
+
 func (a *Agent) ID() string { return "compliance" }
 
 func (a *Agent) Metadata() protocol.AgentMetadata {
 	return protocol.AgentMetadata{
 		ID:          "compliance",
 		Name:        "Compliance Checker",
-		Description: "Validates IaC against compliance frameworks (NIST, SOC2, CIS)",
+		Description: "Validates IaC against compliance frameworks (NIST 800-53, HIPAA, PCI DSS 4.0, ISO 27001)",
 		Version:     "1.0.0",
 	}
 }
 
 func (a *Agent) Capabilities() protocol.AgentCapabilities {
 	return protocol.AgentCapabilities{
-		Formats:       []protocol.SourceFormat{protocol.FormatTerraform, protocol.FormatBicep},
+		Formats:       []protocol.SourceFormat{protocol.FormatTerraform, protocol.FormatBicep, protocol.FormatARM, protocol.FormatPulumi, protocol.FormatCloudFormation},
 		NeedsIaCInput: true,
 	}
 }
 
+// WarmUp runs the compliance rules and the rules framework controls map
+// to over a sample configuration.
+func (a *Agent) WarmUp(ctx context.Context) error {
+	a.index.WarmUp()
+	a.controls.WarmUp()
+	return nil
+}
+
+// selectFrameworks returns the frameworks a request asks for, in its
+// metadata (protocol.MetaFrameworks) or its prompt, else the agent's.
+func (a *Agent) selectFrameworks(req protocol.AgentRequest) ([]string, error) {
+	if v := req.Metadata[protocol.MetaFrameworks]; v != "" {
+		return ParseFrameworks(strings.Split(v, ","))
+	}
+	if ids := frameworksIn(protocol.PromptText(req)); len(ids) > 0 {
+		return ids, nil
+	}
+	if len(a.frameworks) > 0 {
+		return a.frameworks, nil
+	}
+	return FrameworkIDs(), nil
+}
+
 // Handle runs compliance rules against parsed IaC resources.
 func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
 	if !protocol.RequireIaC(req, emit, "compliance") {
 		return nil
 	}
 
+	selected, err := a.selectFrameworks(req)
+	if err != nil {
+		emit.SendMessage(fmt.Sprintf("Cannot run the compliance audit: %v.\n", err))
+		return nil
+	}
+	nist := containsString(selected, NISTFramework)
+	var rules []analyzer.Rule
 	var findings []protocol.Finding
-	for _, res := range req.IaC.Resources {
-		for _, rule := range a.rules {
-			if !rule.Applies(res.Type) {
-				continue
-			}
-			if msg := rule.Check(res.Properties); msg != "" {
-				findings = append(findings, protocol.Finding{
-					RuleID:       rule.ID,
-					Severity:     rule.Severity,
-					Resource:     res.Name,
-					ResourceType: res.Type,
-					Message:      msg,
-					Remediation:  rule.Remediation,
-				})
-			}
-		}
+	if nist {
+		rules = a.index.Rules()
+		findings = a.index.Run(req.IaC.Resources)
+	}
+	var frameworkResults []FrameworkResult
+	if fws := selectedFrameworks(selected); len(fws) > 0 {
+		frameworkResults = assessFrameworks(fws, a.controls.Run(req.IaC.Resources), req.IaC)
 	}
+	scores := auditScores(req.IaC, rules, findings, frameworkResults)
+	a.record(req, scores)
 
-	if len(findings) == 0 {
+	findings, skipped := analyzer.FilterSkipped(findings, req.IaC.Resources, req.IaC.RawCode)
+	protocol.ReportFindings(emit, a.ID(), findings)
+	if scores != nil {
+		protocol.ReportScores(emit, a.ID(), scores)
+	}
+	refs := analyzer.References(findings)
+	for _, fw := range frameworkResults {
+		refs = append(refs, fw.Reference)
+	}
+	if len(refs) > 0 {
+		emit.SendReferences(refs)
+	}
+
+	switch {
+	case !nist:
+	case len(findings) == 0:
 		emit.SendMessage("### Compliance Analysis\n\nAll compliance checks passed.\n")
-	} else {
+	default:
 		emit.SendMessage("### Compliance Analysis\n\n")
 		emit.SendMessage("| Rule | Severity | Resource | Issue | Fix |\n")
 		emit.SendMessage("|------|----------|----------|-------|-----|\n")
 		for _, f := range findings {
 			emit.SendMessage(fmt.Sprintf("| %s | %s | %s.%s | %s | %s |\n",
 				f.RuleID, f.Severity, parser.ShortType(f.ResourceType), f.Resource,
-				f.Message, f.Remediation))
+				f.Message+f.Confidence.Note(), f.Remediation))
 		}
 		emit.SendMessage("\n")
 	}
+	if skipped > 0 {
+		emit.SendMessage(fmt.Sprintf("_%d finding(s) suppressed by inline skip comments._\n\n", skipped))
+	}
+	emitFrameworks(emit, frameworkResults)
+
+	// JSON export, e.g. "export compliance as json with evidence", or
+	// OSCAL for GRC tooling, e.g. "export compliance as oscal".
+	prompt := strings.ToLower(protocol.PromptText(req))
+	switch {
+	case strings.Contains(prompt, "oscal"):
+		report := buildReport(rules, req.IaC.Resources, findings, strings.Contains(prompt, "evidence"))
+		report.Frameworks = frameworkResults
+		now := a.now()
+		if err := emitJSON(emit, "OSCAL Catalog", buildOSCALCatalog(rules, selectedFrameworks(selected), now)); err != nil {
+			return err
+		}
+		if err := emitJSON(emit, "OSCAL Assessment Results", buildOSCALResults(report, now)); err != nil {
+			return err
+		}
+	case protocol.MatchesAny(prompt, "json", "export"):
+		report := buildReport(rules, req.IaC.Resources, findings, strings.Contains(prompt, "evidence"))
+		report.Frameworks = frameworkResults
+		if err := emitJSON(emit, "Compliance Export", report); err != nil {
+			return err
+		}
+	}
 
 	// LLM-enhanced summary
 	if a.enableLLM && a.llmClient != nil && req.Token != "" {
@@ -106,7 +198,17 @@ func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit prot
 	return nil
 }
 
-const compliancePrompt = `You are a senior compliance engineer specializing in NIST, SOC2, and CIS benchmarks. Given the IaC code and deterministic compliance findings below, provide:
+// emitJSON sends v as an indented JSON block under a heading.
+func emitJSON(emit protocol.Emitter, title string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", strings.ToLower(title), err)
+	}
+	emit.SendMessage("### " + title + "\n\n```json\n" + string(data) + "\n```\n\n")
+	return nil
+}
+
+const compliancePrompt = `You are a senior compliance engineer specializing in NIST, SOC2, HIPAA, PCI DSS, ISO 27001 and CIS benchmarks. Given the IaC code and deterministic compliance findings below, provide:
 1. A compliance posture summary (2-3 sentences)
 2. Mapping to specific framework controls (e.g., NIST SC-7, SOC2 CC6.1)
 3. Remediation steps prioritized by compliance impact
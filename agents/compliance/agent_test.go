@@ -2,8 +2,11 @@ package compliance
 
 import (
 	"context"
+	"encoding/json"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
@@ -46,6 +49,174 @@ func TestAgent_StorageNoNetworkRules(t *testing.T) {
 	}
 }
 
+func TestAgent_PulumiYAML(t *testing.T) {
+	prog, err := os.ReadFile("../../internal/testkit/scenarios/insecure-storage.pulumi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := protocol.AgentRequest{Prompt: "audit this Pulumi program:\n```yaml\n" + string(prog) + "```"}
+	host.ParseAndEnrich(&req)
+	if req.IaC == nil || req.IaC.Format != protocol.FormatPulumi {
+		t.Fatalf("IaC = %+v", req.IaC)
+	}
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{"NIST-SC7", "NIST-SC28", "appstore"} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("missing %q:\n%s", want, combined)
+		}
+	}
+}
+
+func TestAgent_ExportWithEvidence(t *testing.T) {
+	tfCode := `resource "azurerm_storage_account" "locked" {
+  name                              = "locked"
+  infrastructure_encryption_enabled = true
+  network_rules {
+    default_action = "Allow"
+  }
+}`
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{
+			{Role: "user", Content: "export compliance json with evidence:\n```hcl\n" + tfCode + "\n```"},
+		},
+	}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	start := strings.Index(combined, "```json\n")
+	end := strings.LastIndex(combined, "\n```")
+	if start < 0 || end < start {
+		t.Fatalf("expected JSON export block, got:\n%s", combined)
+	}
+	var report Report
+	if err := json.Unmarshal([]byte(combined[start+len("```json\n"):end]), &report); err != nil {
+		t.Fatalf("invalid export JSON: %v", err)
+	}
+	if report.Summary.Passed != 1 || report.Summary.Failed != 1 {
+		t.Errorf("summary = %+v, want 1 passed / 1 failed", report.Summary)
+	}
+	for _, c := range report.Controls {
+		switch c.Status {
+		case StatusPass:
+			if len(c.Evidence) != 1 || c.Evidence[0].Property != "infrastructure_encryption_enabled" || c.Evidence[0].Line != 3 {
+				t.Errorf("pass evidence = %+v", c.Evidence)
+			}
+		case StatusFail:
+			if len(c.Evidence) != 0 {
+				t.Errorf("failing control %s should carry no evidence", c.RuleID)
+			}
+		}
+	}
+}
+
+// jsonBlock returns the JSON code block following heading.
+func jsonBlock(t *testing.T, out, heading string) []byte {
+	t.Helper()
+	i := strings.Index(out, "### "+heading)
+	if i < 0 {
+		t.Fatalf("missing %s in:\n%s", heading, out)
+	}
+	rest := out[i:]
+	start := strings.Index(rest, "```json\n") + len("```json\n")
+	end := strings.Index(rest[start:], "\n```")
+	return []byte(rest[start : start+end])
+}
+
+func TestAgent_ExportOSCAL(t *testing.T) {
+	tfCode := `resource "azurerm_storage_account" "locked" {
+  name                              = "locked"
+  infrastructure_encryption_enabled = true
+  network_rules {
+    default_action = "Allow"
+  }
+}`
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{
+			{Role: "user", Content: "export compliance as oscal against NIST with evidence:\n```hcl\n" + tfCode + "\n```"},
+		},
+	}
+	host.ParseAndEnrich(&req)
+	a := New()
+	a.now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := strings.Join(rec.Messages, "")
+	if strings.Contains(out, "### Compliance Export") {
+		t.Error("OSCAL export should replace the plain JSON export")
+	}
+
+	var catalog OSCALCatalogDocument
+	if err := json.Unmarshal(jsonBlock(t, out, "OSCAL Catalog"), &catalog); err != nil {
+		t.Fatalf("invalid catalog JSON: %v", err)
+	}
+	if len(catalog.Catalog.Groups) != 1 || catalog.Catalog.Groups[0].ID != "nist-800-53" || len(catalog.Catalog.Groups[0].Controls) != 2 {
+		t.Fatalf("catalog groups = %+v", catalog.Catalog.Groups)
+	}
+	if c := catalog.Catalog.Groups[0].Controls[0]; c.ID != "sc-7" || c.Props[1].Value != "NIST-SC7" || c.Parts[0].ID != "sc-7_smt" {
+		t.Errorf("control = %+v", c)
+	}
+
+	var doc OSCALResultsDocument
+	if err := json.Unmarshal(jsonBlock(t, out, "OSCAL Assessment Results"), &doc); err != nil {
+		t.Fatalf("invalid assessment results JSON: %v", err)
+	}
+	ar := doc.AssessmentResults
+	if ar.Metadata.OSCALVersion != OSCALVersion || ar.Metadata.LastModified != "2026-03-01T12:00:00Z" {
+		t.Errorf("metadata = %+v", ar.Metadata)
+	}
+	if ar.ImportAP.Href != "#"+ar.BackMatter.Resources[0].UUID {
+		t.Errorf("import-ap %s does not reference back-matter", ar.ImportAP.Href)
+	}
+	res := ar.Results[0]
+	if len(res.LocalDefinitions.InventoryItems) != 1 || len(res.Observations) != 2 || len(res.Findings) != 2 {
+		t.Fatalf("result = %+v", res)
+	}
+	states := map[string]string{}
+	for _, f := range res.Findings {
+		states[f.Target.TargetID] = f.Target.Status.State
+		if f.RelatedObservations[0].ObservationUUID == "" {
+			t.Errorf("finding %s has no observation", f.Title)
+		}
+	}
+	if states["sc-7_smt"] != "not-satisfied" || states["sc-28_smt"] != "satisfied" {
+		t.Errorf("finding states = %v", states)
+	}
+	for _, o := range res.Observations {
+		if o.Subjects[0].SubjectUUID != res.LocalDefinitions.InventoryItems[0].UUID {
+			t.Errorf("observation %s subject = %s", o.Title, o.Subjects[0].SubjectUUID)
+		}
+		if strings.HasPrefix(o.Title, "NIST-SC28") && (len(o.RelevantEvidence) != 1 || o.RelevantEvidence[0].Description != "infrastructure_encryption_enabled = true (line 3)") {
+			t.Errorf("evidence = %+v", o.RelevantEvidence)
+		}
+	}
+
+	// The same scan at the same time exports the same document.
+	rec2 := &prototest.Recorder{}
+	_ = a.Handle(context.Background(), req, rec2)
+	if strings.Join(rec2.Messages, "") != out {
+		t.Error("OSCAL export is not reproducible")
+	}
+}
+
+func TestOSCALUUID(t *testing.T) {
+	id := oscalUUID("finding", "x")
+	if len(id) != 36 || id[14] != '5' || !strings.ContainsAny(id[19:20], "89ab") {
+		t.Errorf("oscalUUID = %s, want an RFC 4122 version 5 UUID", id)
+	}
+	if id == oscalUUID("finding", "y") {
+		t.Error("different names produced the same UUID")
+	}
+}
+
 func TestAgent_NoIaC(t *testing.T) {
 	a := New()
 	rec := &prototest.Recorder{}
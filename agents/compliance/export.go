@@ -0,0 +1,81 @@
+package compliance
+
+import (
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Control statuses in the JSON export.
+const (
+	StatusPass    = "pass"
+	StatusFail    = "fail"
+	StatusSkipped = "skipped" // suppressed by an inline skip comment
+)
+
+// Report is the machine-readable compliance export.
+type Report struct {
+	Summary  Summary   `json:"summary"`
+	Controls []Control `json:"controls"`
+	// Frameworks are the control results of the selected frameworks.
+	Frameworks []FrameworkResult `json:"frameworks,omitempty"`
+}
+
+// Summary counts control results by status.
+type Summary struct {
+	Total   int `json:"total"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+// Control is one rule evaluated against one resource. Evidence is only
+// populated for passing controls when requested.
+type Control struct {
+	RuleID       string              `json:"rule_id"`
+	Title        string              `json:"title"`
+	Severity     protocol.Severity   `json:"severity"`
+	Resource     string              `json:"resource"`
+	ResourceType string              `json:"resource_type"`
+	Status       string              `json:"status"`
+	Messages     []string            `json:"messages,omitempty"`
+	Evidence     []analyzer.Evidence `json:"evidence,omitempty"`
+}
+
+// buildReport evaluates rules and classifies each control. failing holds
+// the findings left after inline skips, so failures missing from it were
+// suppressed.
+func buildReport(rules []analyzer.Rule, resources []protocol.Resource, failing []protocol.Finding, withEvidence bool) Report {
+	open := make(map[string]bool, len(failing))
+	for _, f := range failing {
+		open[f.RuleID+"|"+f.ResourceType+"|"+f.Resource] = true
+	}
+
+	var r Report
+	for _, c := range analyzer.Controls(rules, resources) {
+		ctl := Control{
+			RuleID:       c.Rule.ID,
+			Title:        c.Rule.Title,
+			Severity:     c.Rule.Severity,
+			Resource:     c.Resource.Name,
+			ResourceType: c.Resource.Type,
+			Messages:     c.Messages,
+		}
+		switch {
+		case c.Passed:
+			ctl.Status = StatusPass
+			r.Summary.Passed++
+			if withEvidence {
+				ctl.Evidence = c.Evidence()
+			}
+		case open[c.Rule.ID+"|"+c.Resource.Type+"|"+c.Resource.Name]:
+			ctl.Status = StatusFail
+			r.Summary.Failed++
+		default:
+			ctl.Status = StatusSkipped
+			r.Summary.Skipped++
+		}
+		r.Controls = append(r.Controls, ctl)
+	}
+	r.Summary.Total = len(r.Controls)
+	return r
+}
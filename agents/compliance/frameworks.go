@@ -0,0 +1,316 @@
+package compliance
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// NISTFramework selects the built-in NIST SP 800-53 rules, which report
+// findings of their own rather than control results.
+const NISTFramework = "nist-800-53"
+
+// nistAliases name NISTFramework in prompts and requests.
+var nistAliases = []string{"nist", "800-53", "nist 800-53"}
+
+// StatusNotApplicable marks a framework control no scanned resource falls
+// under.
+const StatusNotApplicable = "not_applicable"
+
+// frameworkFiles holds the control sets of the frameworks assessed through
+// the analyzer rules, one file per framework.
+//
+//go:embed frameworks/*.json
+var frameworkFiles embed.FS
+
+// Framework is the control set of a compliance framework, each control
+// mapped to the rules that assess it and the resource types it covers.
+type Framework struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// Aliases name the framework in prompts, e.g. "pci".
+	Aliases   []string           `json:"aliases"`
+	Reference protocol.Reference `json:"reference"`
+	Controls  []FrameworkControl `json:"controls"`
+}
+
+// FrameworkControl is a control of a framework, such as PCI DSS 4.2.1.
+type FrameworkControl struct {
+	ID          string   `json:"id"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Rules       []string `json:"rules"`
+	// ResourceTypes are the resources the control covers; "*" covers all.
+	ResourceTypes []string `json:"resource_types"`
+}
+
+// covers reports whether the control covers resType.
+func (c FrameworkControl) covers(resType string) bool {
+	for _, t := range c.ResourceTypes {
+		if t == resType || t == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// frameworks are the control sets shipped with the agent, by ID.
+var frameworks = mustLoadFrameworks()
+
+func mustLoadFrameworks() []Framework {
+	names, err := frameworkFiles.ReadDir("frameworks")
+	if err != nil {
+		panic(err)
+	}
+	var fws []Framework
+	for _, e := range names {
+		data, err := frameworkFiles.ReadFile(path.Join("frameworks", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var fw Framework
+		if err := json.Unmarshal(data, &fw); err != nil {
+			panic(fmt.Sprintf("%s: %v", e.Name(), err))
+		}
+		fws = append(fws, fw)
+	}
+	sort.Slice(fws, func(i, j int) bool { return fws[i].ID < fws[j].ID })
+	return fws
+}
+
+// FrameworkIDs returns the frameworks a request can select: NISTFramework
+// and the shipped control sets.
+func FrameworkIDs() []string {
+	ids := []string{NISTFramework}
+	for _, fw := range frameworks {
+		ids = append(ids, fw.ID)
+	}
+	return ids
+}
+
+// ParseFrameworks resolves framework IDs or aliases, such as "pci" or
+// "ISO 27001", to IDs, dropping duplicates. An unknown name is an error.
+func ParseFrameworks(names []string) ([]string, error) {
+	var ids []string
+	for _, name := range names {
+		id, ok := frameworkID(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown compliance framework %q (want one of %s)", strings.TrimSpace(name), strings.Join(FrameworkIDs(), ", "))
+		}
+		if !containsString(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func frameworkID(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == NISTFramework || containsString(nistAliases, name) {
+		return NISTFramework, true
+	}
+	for _, fw := range frameworks {
+		if name == fw.ID || containsString(fw.Aliases, name) {
+			return fw.ID, true
+		}
+	}
+	return "", false
+}
+
+// selectedFrameworks returns the shipped frameworks among ids.
+func selectedFrameworks(ids []string) []Framework {
+	var fws []Framework
+	for _, fw := range frameworks {
+		if containsString(ids, fw.ID) {
+			fws = append(fws, fw)
+		}
+	}
+	return fws
+}
+
+// frameworksIn returns the frameworks a prompt names, e.g. "audit against
+// PCI only", in FrameworkIDs order.
+func frameworksIn(prompt string) []string {
+	prompt = strings.ToLower(prompt)
+	var ids []string
+	if mentionsAny(prompt, append([]string{NISTFramework}, nistAliases...)) {
+		ids = append(ids, NISTFramework)
+	}
+	for _, fw := range frameworks {
+		if mentionsAny(prompt, append([]string{fw.ID}, fw.Aliases...)) {
+			ids = append(ids, fw.ID)
+		}
+	}
+	return ids
+}
+
+// mentionsAny reports whether text contains one of words as a whole word.
+func mentionsAny(text string, words []string) bool {
+	for _, w := range words {
+		for i := 0; ; {
+			j := strings.Index(text[i:], w)
+			if j < 0 {
+				break
+			}
+			start, end := i+j, i+j+len(w)
+			if (start == 0 || !isWordByte(text[start-1])) && (end == len(text) || !isWordByte(text[end])) {
+				return true
+			}
+			i = start + 1
+		}
+	}
+	return false
+}
+
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '_'
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// FrameworkResult is the assessment of one framework's controls.
+type FrameworkResult struct {
+	ID        string                   `json:"id"`
+	Title     string                   `json:"title"`
+	Reference protocol.Reference       `json:"reference"`
+	Summary   FrameworkSummary         `json:"summary"`
+	Controls  []FrameworkControlResult `json:"controls"`
+}
+
+// FrameworkSummary counts a framework's controls by status.
+type FrameworkSummary struct {
+	Total         int `json:"total"`
+	Passed        int `json:"passed"`
+	Failed        int `json:"failed"`
+	Skipped       int `json:"skipped"`
+	NotApplicable int `json:"not_applicable"`
+}
+
+// FrameworkControlResult is the status of one framework control: it fails
+// when a resource it covers fails one of its rules, and is skipped when
+// every such failure is suppressed by an inline skip comment.
+type FrameworkControlResult struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Status    string `json:"status"`
+	Resources int    `json:"resources"`
+	// Failures are the failed checks, as "RULE type.name: message".
+	Failures []string `json:"failures,omitempty"`
+}
+
+// frameworkIndex indexes the rules the shipped frameworks map their
+// controls to.
+func frameworkIndex() *analyzer.RuleIndex {
+	byID := make(map[string]analyzer.Rule)
+	for _, r := range analyzer.AllRules() {
+		byID[r.ID] = r
+	}
+	var rules []analyzer.Rule
+	seen := make(map[string]bool)
+	for _, fw := range frameworks {
+		for _, c := range fw.Controls {
+			for _, id := range c.Rules {
+				if r, ok := byID[id]; ok && !seen[id] {
+					seen[id] = true
+					rules = append(rules, r)
+				}
+			}
+		}
+	}
+	return analyzer.NewRuleIndex(rules)
+}
+
+// assessFrameworks evaluates the controls of fws against the scanned
+// resources, given the failures of the rules they map to before inline
+// skips are applied.
+func assessFrameworks(fws []Framework, all []protocol.Finding, iac *protocol.IaCInput) []FrameworkResult {
+	open, _ := analyzer.FilterSkipped(all, iac.Resources, iac.RawCode)
+	isOpen := make(map[string]bool, len(open))
+	for _, f := range open {
+		isOpen[f.RuleID+"|"+f.ResourceType+"|"+f.Resource] = true
+	}
+
+	var results []FrameworkResult
+	for _, fw := range fws {
+		res := FrameworkResult{ID: fw.ID, Title: fw.Title, Reference: fw.Reference}
+		for _, c := range fw.Controls {
+			cr := FrameworkControlResult{ID: c.ID, Title: c.Title}
+			for _, r := range iac.Resources {
+				if c.covers(r.Type) && !r.Deleted() {
+					cr.Resources++
+				}
+			}
+			suppressed := false
+			for _, f := range all {
+				if !containsString(c.Rules, f.RuleID) || !c.covers(f.ResourceType) {
+					continue
+				}
+				if !isOpen[f.RuleID+"|"+f.ResourceType+"|"+f.Resource] {
+					suppressed = true
+					continue
+				}
+				cr.Failures = append(cr.Failures, fmt.Sprintf("%s %s.%s: %s", f.RuleID, f.ResourceType, f.Resource, f.Message))
+			}
+			switch {
+			case len(cr.Failures) > 0:
+				cr.Status = StatusFail
+				res.Summary.Failed++
+			case suppressed:
+				cr.Status = StatusSkipped
+				res.Summary.Skipped++
+			case cr.Resources == 0:
+				cr.Status = StatusNotApplicable
+				res.Summary.NotApplicable++
+			default:
+				cr.Status = StatusPass
+				res.Summary.Passed++
+			}
+			res.Controls = append(res.Controls, cr)
+		}
+		res.Summary.Total = len(res.Controls)
+		results = append(results, res)
+	}
+	return results
+}
+
+// emitFrameworks renders each framework's control results, leaving out
+// controls that cover none of the scanned resources.
+func emitFrameworks(emit protocol.Emitter, results []FrameworkResult) {
+	for _, fw := range results {
+		s := fw.Summary
+		applicable := s.Total - s.NotApplicable
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "### %s\n\n", fw.Title)
+		if applicable == 0 {
+			sb.WriteString("No control applies to the scanned resources.\n\n")
+			emit.SendMessage(sb.String())
+			continue
+		}
+		fmt.Fprintf(&sb, "%d of %d applicable control(s) met", s.Passed, applicable)
+		if s.NotApplicable > 0 {
+			fmt.Fprintf(&sb, "; %d not applicable to this configuration", s.NotApplicable)
+		}
+		sb.WriteString(".\n\n| Control | Title | Status | Failing checks |\n|---------|-------|--------|----------------|\n")
+		for _, c := range fw.Controls {
+			if c.Status == StatusNotApplicable {
+				continue
+			}
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s |\n", c.ID, c.Title, c.Status, strings.Join(c.Failures, "; "))
+		}
+		sb.WriteString("\n")
+		emit.SendMessage(sb.String())
+	}
+}
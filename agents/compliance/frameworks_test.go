@@ -0,0 +1,143 @@
+package compliance
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+)
+
+func TestFrameworks_MapKnownRules(t *testing.T) {
+	rules := make(map[string]analyzer.Rule)
+	for _, r := range analyzer.AllRules() {
+		rules[r.ID] = r
+	}
+	if len(frameworks) != 3 {
+		t.Fatalf("frameworks = %d, want 3", len(frameworks))
+	}
+	for _, fw := range frameworks {
+		if fw.Title == "" || fw.Reference.URL == "" || len(fw.Controls) == 0 {
+			t.Errorf("%s: incomplete framework %+v", fw.ID, fw)
+		}
+		for _, c := range fw.Controls {
+			if len(c.Rules) == 0 || len(c.ResourceTypes) == 0 {
+				t.Errorf("%s %s: no rules or resource types", fw.ID, c.ID)
+			}
+			for _, id := range c.Rules {
+				r, ok := rules[id]
+				if !ok {
+					t.Errorf("%s %s: unknown rule %s", fw.ID, c.ID, id)
+					continue
+				}
+				for _, typ := range r.ResourceTypes {
+					if !c.covers(typ) {
+						t.Errorf("%s %s: rule %s checks %s, which the control does not cover", fw.ID, c.ID, id, typ)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestParseFrameworks(t *testing.T) {
+	ids, err := ParseFrameworks([]string{"PCI", " hipaa", "ISO 27001", "pci-dss", "nist"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(ids, ","); got != "pci-dss,hipaa,iso-27001,nist-800-53" {
+		t.Errorf("ParseFrameworks = %s", got)
+	}
+	if _, err := ParseFrameworks([]string{"sox"}); err == nil || !strings.Contains(err.Error(), "sox") {
+		t.Errorf("err = %v, want unknown framework", err)
+	}
+}
+
+func TestFrameworksIn(t *testing.T) {
+	tests := map[string]string{
+		"audit against PCI only":           "pci-dss",
+		"check HIPAA and ISO 27001":        "hipaa,iso-27001",
+		"NIST 800-53 audit":                "nist-800-53",
+		"audit this configuration":         "",
+		"check the spcial capacity option": "",
+	}
+	for prompt, want := range tests {
+		if got := strings.Join(frameworksIn(prompt), ","); got != want {
+			t.Errorf("frameworksIn(%q) = %q, want %q", prompt, got, want)
+		}
+	}
+}
+
+const frameworkConfig = `resource "azurerm_storage_account" "data" {
+  name                      = "data"
+  enable_https_traffic_only = false
+  min_tls_version           = "TLS1_2"
+}`
+
+func TestAgent_FrameworkFromPrompt(t *testing.T) {
+	req := protocol.AgentRequest{Prompt: "audit against PCI only:\n```hcl\n" + frameworkConfig + "\n```"}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Join(rec.Messages, "")
+	if strings.Contains(out, "### Compliance Analysis") || strings.Contains(out, "HIPAA") {
+		t.Errorf("PCI-only audit reported other frameworks:\n%s", out)
+	}
+	if !strings.Contains(out, "### PCI DSS v4.0") || !strings.Contains(out, "| 4.2.1 | Strong Cryptography in Transmission | fail | POL-001") {
+		t.Errorf("missing failing PCI 4.2.1 control:\n%s", out)
+	}
+	if strings.Contains(out, "| 6.4.1 |") {
+		t.Errorf("control with no applicable resource was listed:\n%s", out)
+	}
+}
+
+func TestAgent_FrameworkMetadata(t *testing.T) {
+	req := protocol.AgentRequest{
+		Prompt:   "audit:\n```hcl\n" + frameworkConfig + "\n```",
+		Metadata: map[string]string{protocol.MetaFrameworks: "hipaa"},
+	}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New(WithFrameworks("pci-dss")).Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Join(rec.Messages, "")
+	if !strings.Contains(out, "### HIPAA Security Rule") || strings.Contains(out, "PCI DSS") {
+		t.Errorf("metadata should override the agent default:\n%s", out)
+	}
+
+	req.Metadata[protocol.MetaFrameworks] = "sox"
+	rec = &prototest.Recorder{}
+	_ = New().Handle(context.Background(), req, rec)
+	if out := strings.Join(rec.Messages, ""); !strings.Contains(out, `unknown compliance framework "sox"`) {
+		t.Errorf("unknown framework not reported:\n%s", out)
+	}
+}
+
+func TestAssessFrameworks_Skipped(t *testing.T) {
+	code := `resource "azurerm_storage_account" "data" {
+  # security-ignore:POL-001 TLS terminates at the gateway
+  name                      = "data"
+  enable_https_traffic_only = false
+  min_tls_version           = "TLS1_2"
+}`
+	req := protocol.AgentRequest{Prompt: "```hcl\n" + code + "\n```"}
+	host.ParseAndEnrich(&req)
+	results := assessFrameworks(selectedFrameworks([]string{"pci-dss"}), frameworkIndex().Run(req.IaC.Resources), req.IaC)
+	if len(results) != 1 {
+		t.Fatalf("results = %+v", results)
+	}
+	for _, c := range results[0].Controls {
+		if c.ID == "4.2.1" && c.Status != StatusSkipped {
+			t.Errorf("4.2.1 = %+v, want skipped", c)
+		}
+	}
+	if s := results[0].Summary; s.Total != len(results[0].Controls) || s.Skipped == 0 || s.NotApplicable == 0 {
+		t.Errorf("summary = %+v", s)
+	}
+}
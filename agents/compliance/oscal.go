@@ -0,0 +1,419 @@
+package compliance
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+)
+
+// OSCALVersion is the OSCAL schema version of the exports.
+const OSCALVersion = "1.1.2"
+
+// oscalNS qualifies the properties OSCAL does not define itself.
+const oscalNS = "https://github.com/ghcp-iac/ghcp-iac-workflow/ns/oscal"
+
+// framework is a control catalog rules are mapped to.
+type framework struct {
+	id    string
+	title string
+}
+
+var (
+	nist80053 = framework{"nist-800-53", "NIST SP 800-53 Rev. 5"}
+	// rules without a framework mapping are exported as their own controls.
+	internalRules = framework{"ghcp-iac", "GHCP IaC Rules"}
+)
+
+// frameworkControl is the control a rule assesses.
+type frameworkControl struct {
+	framework framework
+	id        string // OSCAL control ID, e.g. "sc-7"
+	title     string
+}
+
+var ruleControls = map[string]frameworkControl{
+	"NIST-SC7":  {nist80053, "sc-7", "Boundary Protection"},
+	"NIST-SC28": {nist80053, "sc-28", "Protection of Information at Rest"},
+}
+
+// oscalControlID turns a framework's control ID, such as "164.312(a)(1)"
+// or "A.8.24", into an OSCAL token qualified by the framework:
+// "hipaa-164.312-a-1", "iso-27001-a.8.24".
+func oscalControlID(framework, control string) string {
+	var sb strings.Builder
+	sb.WriteString(framework)
+	sb.WriteByte('-')
+	dash := false
+	for _, r := range strings.ToLower(control) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' {
+			sb.WriteRune(r)
+			dash = false
+		} else if !dash {
+			sb.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimRight(sb.String(), "-")
+}
+
+func controlFor(rule analyzer.Rule) frameworkControl {
+	if c, ok := ruleControls[rule.ID]; ok {
+		return c
+	}
+	return frameworkControl{internalRules, strings.ToLower(rule.ID), rule.Title}
+}
+
+// oscalUUID derives a name-based (version 5 style) UUID, so that exports of
+// the same scan are reproducible.
+func oscalUUID(parts ...string) string {
+	h := sha1.Sum([]byte(oscalNS + "\x00" + strings.Join(parts, "\x00")))
+	h[6] = (h[6] & 0x0f) | 0x50
+	h[8] = (h[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+// OSCAL document types, limited to the fields the exports populate.
+type (
+	OSCALMetadata struct {
+		Title        string `json:"title"`
+		LastModified string `json:"last-modified"`
+		Version      string `json:"version"`
+		OSCALVersion string `json:"oscal-version"`
+	}
+
+	OSCALProperty struct {
+		Name  string `json:"name"`
+		NS    string `json:"ns,omitempty"`
+		Value string `json:"value"`
+	}
+
+	OSCALPart struct {
+		ID    string `json:"id"`
+		Name  string `json:"name"`
+		Prose string `json:"prose"`
+	}
+
+	// OSCALCatalogDocument is an OSCAL catalog of the frameworks and
+	// controls the rules assess.
+	OSCALCatalogDocument struct {
+		Catalog OSCALCatalog `json:"catalog"`
+	}
+
+	OSCALCatalog struct {
+		UUID     string        `json:"uuid"`
+		Metadata OSCALMetadata `json:"metadata"`
+		Groups   []OSCALGroup  `json:"groups"`
+	}
+
+	OSCALGroup struct {
+		ID       string         `json:"id"`
+		Title    string         `json:"title"`
+		Controls []OSCALControl `json:"controls"`
+	}
+
+	OSCALControl struct {
+		ID    string          `json:"id"`
+		Title string          `json:"title"`
+		Props []OSCALProperty `json:"props,omitempty"`
+		Parts []OSCALPart     `json:"parts,omitempty"`
+	}
+
+	// OSCALResultsDocument is OSCAL assessment results for one scan.
+	OSCALResultsDocument struct {
+		AssessmentResults OSCALAssessmentResults `json:"assessment-results"`
+	}
+
+	OSCALAssessmentResults struct {
+		UUID     string        `json:"uuid"`
+		Metadata OSCALMetadata `json:"metadata"`
+		ImportAP struct {
+			Href string `json:"href"`
+		} `json:"import-ap"`
+		Results    []OSCALResult   `json:"results"`
+		BackMatter OSCALBackMatter `json:"back-matter"`
+	}
+
+	OSCALBackMatter struct {
+		Resources []OSCALResource `json:"resources"`
+	}
+
+	OSCALResource struct {
+		UUID        string `json:"uuid"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+
+	OSCALResult struct {
+		UUID             string                `json:"uuid"`
+		Title            string                `json:"title"`
+		Description      string                `json:"description"`
+		Start            string                `json:"start"`
+		LocalDefinitions OSCALLocalDefinitions `json:"local-definitions"`
+		ReviewedControls OSCALReviewedControls `json:"reviewed-controls"`
+		Observations     []OSCALObservation    `json:"observations,omitempty"`
+		Findings         []OSCALFinding        `json:"findings,omitempty"`
+	}
+
+	OSCALLocalDefinitions struct {
+		InventoryItems []OSCALInventoryItem `json:"inventory-items,omitempty"`
+	}
+
+	// OSCALInventoryItem is a scanned IaC resource.
+	OSCALInventoryItem struct {
+		UUID        string          `json:"uuid"`
+		Description string          `json:"description"`
+		Props       []OSCALProperty `json:"props"`
+	}
+
+	OSCALReviewedControls struct {
+		ControlSelections []OSCALControlSelection `json:"control-selections"`
+	}
+
+	OSCALControlSelection struct {
+		IncludeControls []OSCALControlRef `json:"include-controls"`
+	}
+
+	OSCALControlRef struct {
+		ControlID string `json:"control-id"`
+	}
+
+	OSCALObservation struct {
+		UUID             string          `json:"uuid"`
+		Title            string          `json:"title"`
+		Description      string          `json:"description"`
+		Methods          []string        `json:"methods"`
+		Subjects         []OSCALSubject  `json:"subjects"`
+		RelevantEvidence []OSCALEvidence `json:"relevant-evidence,omitempty"`
+		Collected        string          `json:"collected"`
+	}
+
+	OSCALSubject struct {
+		SubjectUUID string `json:"subject-uuid"`
+		Type        string `json:"type"`
+	}
+
+	OSCALEvidence struct {
+		Description string `json:"description"`
+	}
+
+	OSCALFinding struct {
+		UUID                string               `json:"uuid"`
+		Title               string               `json:"title"`
+		Description         string               `json:"description"`
+		Props               []OSCALProperty      `json:"props,omitempty"`
+		Target              OSCALTarget          `json:"target"`
+		RelatedObservations []OSCALRelatedObsRef `json:"related-observations,omitempty"`
+		Remarks             string               `json:"remarks,omitempty"`
+	}
+
+	OSCALTarget struct {
+		Type     string            `json:"type"`
+		TargetID string            `json:"target-id"`
+		Status   OSCALTargetStatus `json:"status"`
+	}
+
+	OSCALTargetStatus struct {
+		State  string `json:"state"`
+		Reason string `json:"reason,omitempty"`
+	}
+
+	OSCALRelatedObsRef struct {
+		ObservationUUID string `json:"observation-uuid"`
+	}
+)
+
+func oscalMetadata(title string, now time.Time) OSCALMetadata {
+	return OSCALMetadata{Title: title, LastModified: now.UTC().Format(time.RFC3339), Version: "1.0.0", OSCALVersion: OSCALVersion}
+}
+
+// buildOSCALCatalog exports the frameworks and controls rules assess, each
+// control carrying the IDs of the rules that check it, followed by the
+// controls of fws.
+func buildOSCALCatalog(rules []analyzer.Rule, fws []Framework, now time.Time) OSCALCatalogDocument {
+	var groups []OSCALGroup
+	index := make(map[string]int)
+	for _, r := range rules {
+		c := controlFor(r)
+		gi, ok := index[c.framework.id]
+		if !ok {
+			gi = len(groups)
+			index[c.framework.id] = gi
+			groups = append(groups, OSCALGroup{ID: c.framework.id, Title: c.framework.title})
+		}
+		g := &groups[gi]
+		if i := controlIndex(g.Controls, c.id); i >= 0 {
+			g.Controls[i].Props = append(g.Controls[i].Props, OSCALProperty{Name: "rule-id", NS: oscalNS, Value: r.ID})
+			continue
+		}
+		ctl := OSCALControl{
+			ID:    c.id,
+			Title: c.title,
+			Props: []OSCALProperty{{Name: "label", Value: strings.ToUpper(c.id)}, {Name: "rule-id", NS: oscalNS, Value: r.ID}},
+			Parts: []OSCALPart{{ID: c.id + "_smt", Name: "statement", Prose: r.Description}},
+		}
+		if r.Remediation != "" {
+			ctl.Parts = append(ctl.Parts, OSCALPart{ID: c.id + "_gdn", Name: "guidance", Prose: r.Remediation})
+		}
+		g.Controls = append(g.Controls, ctl)
+	}
+	for _, fw := range fws {
+		g := OSCALGroup{ID: fw.ID, Title: fw.Title}
+		for _, c := range fw.Controls {
+			id := oscalControlID(fw.ID, c.ID)
+			ctl := OSCALControl{
+				ID:    id,
+				Title: c.Title,
+				Props: []OSCALProperty{{Name: "label", Value: c.ID}},
+				Parts: []OSCALPart{{ID: id + "_smt", Name: "statement", Prose: c.Description}},
+			}
+			for _, r := range c.Rules {
+				ctl.Props = append(ctl.Props, OSCALProperty{Name: "rule-id", NS: oscalNS, Value: r})
+			}
+			g.Controls = append(g.Controls, ctl)
+		}
+		groups = append(groups, g)
+	}
+	return OSCALCatalogDocument{Catalog: OSCALCatalog{
+		UUID:     oscalUUID("catalog", now.UTC().Format(time.RFC3339)),
+		Metadata: oscalMetadata("GHCP IaC Compliance Controls", now),
+		Groups:   groups,
+	}}
+}
+
+func controlIndex(controls []OSCALControl, id string) int {
+	for i, c := range controls {
+		if c.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// buildOSCALResults exports a compliance report as OSCAL assessment
+// results: each scanned resource is an inventory item, and each control
+// result an observation and a finding whose target is the control
+// statement. Skipped controls are reported as not satisfied, with the
+// suppression noted in remarks. Each applicable framework control adds a
+// finding on its own statement.
+func buildOSCALResults(report Report, now time.Time) OSCALResultsDocument {
+	stamp := now.UTC().Format(time.RFC3339)
+
+	result := OSCALResult{
+		UUID:  oscalUUID("result", stamp),
+		Title: "IaC compliance scan",
+		Description: fmt.Sprintf("%d control(s) evaluated: %d passed, %d failed, %d skipped.",
+			report.Summary.Total, report.Summary.Passed, report.Summary.Failed, report.Summary.Skipped),
+		Start: stamp,
+	}
+	items := make(map[string]string)
+	reviewed := make(map[string]bool)
+	var selected []OSCALControlRef
+	for _, c := range report.Controls {
+		ctl := controlFor(analyzer.Rule{ID: c.RuleID, Title: c.Title})
+		if !reviewed[ctl.id] {
+			reviewed[ctl.id] = true
+			selected = append(selected, OSCALControlRef{ControlID: ctl.id})
+		}
+
+		address := c.ResourceType + "." + c.Resource
+		itemUUID, ok := items[address]
+		if !ok {
+			itemUUID = oscalUUID("resource", stamp, address)
+			items[address] = itemUUID
+			result.LocalDefinitions.InventoryItems = append(result.LocalDefinitions.InventoryItems, OSCALInventoryItem{
+				UUID:        itemUUID,
+				Description: address,
+				Props: []OSCALProperty{
+					{Name: "resource-type", NS: oscalNS, Value: c.ResourceType},
+					{Name: "resource-name", NS: oscalNS, Value: c.Resource},
+				},
+			})
+		}
+
+		obs := OSCALObservation{
+			UUID:      oscalUUID("observation", stamp, c.RuleID, address),
+			Title:     fmt.Sprintf("%s on %s", c.RuleID, address),
+			Methods:   []string{"TEST"},
+			Subjects:  []OSCALSubject{{SubjectUUID: itemUUID, Type: "inventory-item"}},
+			Collected: stamp,
+		}
+		finding := OSCALFinding{
+			UUID:  oscalUUID("finding", stamp, c.RuleID, address),
+			Title: c.Title,
+			Props: []OSCALProperty{
+				{Name: "rule-id", NS: oscalNS, Value: c.RuleID},
+				{Name: "severity", NS: oscalNS, Value: string(c.Severity)},
+			},
+			Target:              OSCALTarget{Type: "statement-id", TargetID: ctl.id + "_smt"},
+			RelatedObservations: []OSCALRelatedObsRef{{ObservationUUID: obs.UUID}},
+		}
+		switch c.Status {
+		case StatusPass:
+			obs.Description = "Control satisfied."
+			finding.Target.Status = OSCALTargetStatus{State: "satisfied", Reason: "pass"}
+		case StatusFail:
+			obs.Description = strings.Join(c.Messages, "; ")
+			finding.Target.Status = OSCALTargetStatus{State: "not-satisfied", Reason: "fail"}
+		default:
+			obs.Description = strings.Join(c.Messages, "; ")
+			finding.Target.Status = OSCALTargetStatus{State: "not-satisfied", Reason: "other"}
+			finding.Remarks = "Suppressed by an inline skip comment."
+		}
+		finding.Description = obs.Description
+		for _, e := range c.Evidence {
+			desc := fmt.Sprintf("%s = %v", e.Property, e.Value)
+			if e.Line > 0 {
+				desc += fmt.Sprintf(" (line %d)", e.Line)
+			}
+			obs.RelevantEvidence = append(obs.RelevantEvidence, OSCALEvidence{Description: desc})
+		}
+		result.Observations = append(result.Observations, obs)
+		result.Findings = append(result.Findings, finding)
+	}
+	for _, fw := range report.Frameworks {
+		for _, c := range fw.Controls {
+			if c.Status == StatusNotApplicable {
+				continue
+			}
+			id := oscalControlID(fw.ID, c.ID)
+			selected = append(selected, OSCALControlRef{ControlID: id})
+			finding := OSCALFinding{
+				UUID:        oscalUUID("framework-finding", stamp, id),
+				Title:       fmt.Sprintf("%s %s: %s", fw.Title, c.ID, c.Title),
+				Description: fmt.Sprintf("%d resource(s) covered.", c.Resources),
+				Target:      OSCALTarget{Type: "statement-id", TargetID: id + "_smt"},
+			}
+			switch c.Status {
+			case StatusPass:
+				finding.Target.Status = OSCALTargetStatus{State: "satisfied", Reason: "pass"}
+			case StatusFail:
+				finding.Description += " " + strings.Join(c.Failures, "; ")
+				finding.Target.Status = OSCALTargetStatus{State: "not-satisfied", Reason: "fail"}
+			default:
+				finding.Target.Status = OSCALTargetStatus{State: "not-satisfied", Reason: "other"}
+				finding.Remarks = "Suppressed by an inline skip comment."
+			}
+			result.Findings = append(result.Findings, finding)
+		}
+	}
+	result.ReviewedControls.ControlSelections = []OSCALControlSelection{{IncludeControls: selected}}
+
+	doc := OSCALResultsDocument{AssessmentResults: OSCALAssessmentResults{
+		UUID:     oscalUUID("assessment-results", stamp),
+		Metadata: oscalMetadata("GHCP IaC Compliance Assessment Results", now),
+		Results:  []OSCALResult{result},
+	}}
+	// No separate assessment plan exists: the plan is the rule set, recorded
+	// in back-matter for import-ap to reference.
+	plan := OSCALResource{
+		UUID:        oscalUUID("assessment-plan", stamp),
+		Title:       "IaC compliance rules",
+		Description: "Compliance rules evaluated against every applicable resource in the scanned IaC.",
+	}
+	doc.AssessmentResults.ImportAP.Href = "#" + plan.UUID
+	doc.AssessmentResults.BackMatter.Resources = []OSCALResource{plan}
+	return doc
+}
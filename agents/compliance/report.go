@@ -0,0 +1,274 @@
+package compliance
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Evidence report formats.
+const (
+	ReportHTML = "html"
+	ReportCSV  = "csv"
+	ReportJSON = "json"
+)
+
+// ReportFormats lists the formats an EvidenceReport can be written in.
+var ReportFormats = []string{ReportHTML, ReportCSV, ReportJSON}
+
+// DefaultReportTitle titles evidence reports that are not given one.
+const DefaultReportTitle = "Infrastructure Compliance Report"
+
+// ReportOptions are what an auditor adds to an evidence report.
+type ReportOptions struct {
+	Title   string
+	Auditor string
+	// Notes are auditor notes by control ID, e.g. "4.2.1" or "SC-7", or by
+	// framework and control ID, e.g. "pci-dss 4.2.1".
+	Notes map[string]string
+	// Findings are failures found elsewhere, such as the findings of
+	// POST /check. Those naming a rule a control maps to fail the control
+	// as the agent's own findings do.
+	Findings []protocol.Finding
+}
+
+// EvidenceReport is the control-by-control compliance report auditors
+// download, with the hashes of the code it was generated from.
+type EvidenceReport struct {
+	Title     string    `json:"title"`
+	Generated time.Time `json:"generated"`
+	Auditor   string    `json:"auditor,omitempty"`
+	// Format is the IaC format scanned; CodeSHA256 hashes the scanned code.
+	Format     protocol.SourceFormat `json:"format"`
+	CodeSHA256 string                `json:"code_sha256"`
+	Resources  []EvidenceResource    `json:"resources"`
+	Frameworks []EvidenceFramework   `json:"frameworks"`
+	Controls   []EvidenceControl     `json:"controls"`
+}
+
+// EvidenceResource is a scanned resource and the hash of its block, so an
+// auditor can tell whether it changed since the report.
+type EvidenceResource struct {
+	Address string `json:"address"`
+	Line    int    `json:"line,omitempty"`
+	SHA256  string `json:"sha256"`
+}
+
+// EvidenceFramework is an assessed framework and its control counts.
+type EvidenceFramework struct {
+	ID        string             `json:"id"`
+	Title     string             `json:"title"`
+	Reference protocol.Reference `json:"reference"`
+	Summary   FrameworkSummary   `json:"summary"`
+}
+
+// EvidenceControl is the status of one framework control.
+type EvidenceControl struct {
+	Framework string `json:"framework"`
+	ControlID string `json:"control_id"`
+	Title     string `json:"title"`
+	Status    string `json:"status"`
+	// Resources are the addresses of the resources the control covers.
+	Resources []string  `json:"resources,omitempty"`
+	Failures  []string  `json:"failures,omitempty"`
+	Assessed  time.Time `json:"assessed"`
+	Notes     string    `json:"notes,omitempty"`
+}
+
+// nistFramework presents the built-in NIST rules as a framework, one
+// control per rule.
+func nistFramework(rules []analyzer.Rule) Framework {
+	fw := Framework{ID: NISTFramework, Title: nist80053.title}
+	for _, r := range rules {
+		c := controlFor(r)
+		fw.Reference = r.Reference
+		fw.Controls = append(fw.Controls, FrameworkControl{
+			ID:            strings.ToUpper(c.id),
+			Title:         c.title,
+			Description:   r.Description,
+			Rules:         []string{r.ID},
+			ResourceTypes: r.ResourceTypes,
+		})
+	}
+	return fw
+}
+
+// Report builds the evidence report of req's code for the frameworks the
+// request selects, as Handle would audit them. It fails when the request
+// has no code or names an unknown framework.
+func (a *Agent) Report(req protocol.AgentRequest, opts ReportOptions) (EvidenceReport, error) {
+	if req.IaC == nil || len(req.IaC.Resources) == 0 {
+		return EvidenceReport{}, errors.New("no infrastructure code found in the request")
+	}
+	selected, err := a.selectFrameworks(req)
+	if err != nil {
+		return EvidenceReport{}, err
+	}
+	fws := selectedFrameworks(selected)
+	all := a.controls.Run(req.IaC.Resources)
+	if containsString(selected, NISTFramework) {
+		fws = append([]Framework{nistFramework(a.index.Rules())}, fws...)
+		all = append(all, a.index.Run(req.IaC.Resources)...)
+	}
+	all = append(all, opts.Findings...)
+
+	rep := EvidenceReport{
+		Title:      opts.Title,
+		Generated:  a.now().UTC(),
+		Auditor:    opts.Auditor,
+		Format:     req.IaC.Format,
+		CodeSHA256: sha256Hex(req.IaC.RawCode),
+	}
+	if rep.Title == "" {
+		rep.Title = DefaultReportTitle
+	}
+	for _, r := range req.IaC.Resources {
+		if r.Deleted() {
+			continue
+		}
+		rep.Resources = append(rep.Resources, EvidenceResource{Address: r.Type + "." + r.Name, Line: r.Line, SHA256: sha256Hex(r.RawBlock)})
+	}
+	for i, res := range assessFrameworks(fws, all, req.IaC) {
+		rep.Frameworks = append(rep.Frameworks, EvidenceFramework{ID: res.ID, Title: res.Title, Reference: res.Reference, Summary: res.Summary})
+		for j, c := range res.Controls {
+			ec := EvidenceControl{
+				Framework: res.ID,
+				ControlID: c.ID,
+				Title:     c.Title,
+				Status:    c.Status,
+				Failures:  c.Failures,
+				Assessed:  rep.Generated,
+				Notes:     noteFor(opts.Notes, res.ID, c.ID),
+			}
+			for _, r := range req.IaC.Resources {
+				if fws[i].Controls[j].covers(r.Type) && !r.Deleted() {
+					ec.Resources = append(ec.Resources, r.Type+"."+r.Name)
+				}
+			}
+			rep.Controls = append(rep.Controls, ec)
+		}
+	}
+	return rep, nil
+}
+
+// Score is the percentage of the report's applicable controls that pass,
+// rounded down. Skipped controls, whose failures were accepted in the
+// code, count neither way. ok is false when no control applies.
+func (r EvidenceReport) Score() (score int, ok bool) {
+	var total FrameworkSummary
+	for _, fw := range r.Frameworks {
+		total.add(fw.Summary)
+	}
+	return total.score()
+}
+
+// noteFor returns the auditor note for a control, preferring one keyed by
+// framework and control ID.
+func noteFor(notes map[string]string, framework, control string) string {
+	if n, ok := notes[framework+" "+control]; ok {
+		return n
+	}
+	return notes[control]
+}
+
+func sha256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// reportColumns are the CSV report's columns.
+var reportColumns = []string{"framework", "control_id", "title", "status", "resources", "failures", "assessed_at", "code_sha256", "auditor", "auditor_notes"}
+
+// WriteCSV writes the report as CSV, one row per control. Resources and
+// failures are separated by newlines within their cells; the
+// auditor_notes column is left for the auditor to fill in when empty.
+func (r EvidenceReport) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(reportColumns)
+	for _, c := range r.Controls {
+		cw.Write([]string{
+			c.Framework, c.ControlID, c.Title, c.Status,
+			strings.Join(c.Resources, "\n"), strings.Join(c.Failures, "\n"),
+			c.Assessed.Format(time.RFC3339), r.CodeSHA256, r.Auditor, c.Notes,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// reportTemplate renders an evidence report as a page auditors can file or
+// print to PDF; html/template escapes everything.
+var reportTemplate = template.Must(template.New("evidence").Funcs(template.FuncMap{
+	"controlsOf": func(r EvidenceReport, framework string) []EvidenceControl {
+		var cs []EvidenceControl
+		for _, c := range r.Controls {
+			if c.Framework == framework {
+				cs = append(cs, c)
+			}
+		}
+		return cs
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", sans-serif; max-width: 72rem; margin: 2rem auto; padding: 0 1rem; color: #1f2328; }
+.meta { color: #656d76; }
+table { border-collapse: collapse; width: 100%; margin: 1rem 0; }
+th, td { border: 1px solid #d0d7de; padding: .4rem .6rem; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+td.notes { min-width: 12rem; }
+.pass { color: #1a7f37; } .fail { color: #cf222e; font-weight: 600; } .skipped, .not_applicable { color: #656d76; }
+code { font-size: .85em; word-break: break-all; }
+@media print { body { max-width: none; margin: 0; } h2 { break-before: page; } h2:first-of-type { break-before: auto; } tr { break-inside: avoid; } }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p class="meta">Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}{{with .Auditor}} for {{.}}{{end}} from {{.Format}} code with SHA-256 <code>{{.CodeSHA256}}</code>.</p>
+<table>
+<tr><th>Framework</th><th>Controls</th><th>Passed</th><th>Failed</th><th>Skipped</th><th>Not applicable</th></tr>
+{{- range .Frameworks}}
+<tr><td><a href="{{.Reference.URL}}">{{.Title}}</a></td><td>{{.Summary.Total}}</td><td>{{.Summary.Passed}}</td><td>{{.Summary.Failed}}</td><td>{{.Summary.Skipped}}</td><td>{{.Summary.NotApplicable}}</td></tr>
+{{- end}}
+</table>
+{{- $r := .}}
+{{- range .Frameworks}}
+<h2>{{.Title}}</h2>
+<table>
+<tr><th>Control</th><th>Title</th><th>Status</th><th>Resources</th><th>Failing checks</th><th>Assessed</th><th>Auditor notes</th></tr>
+{{- range controlsOf $r .ID}}
+<tr><td>{{.ControlID}}</td><td>{{.Title}}</td><td class="{{.Status}}">{{.Status}}</td><td>{{range .Resources}}<code>{{.}}</code><br>{{end}}</td><td>{{range .Failures}}{{.}}<br>{{end}}</td><td>{{.Assessed.Format "2006-01-02 15:04:05 MST"}}</td><td class="notes">{{.Notes}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<h2>Scanned resources</h2>
+<table>
+<tr><th>Resource</th><th>Line</th><th>SHA-256 of block</th></tr>
+{{- range .Resources}}
+<tr><td><code>{{.Address}}</code></td><td>{{if .Line}}{{.Line}}{{end}}</td><td><code>{{.SHA256}}</code></td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// WriteHTML writes the report as a standalone HTML page, styled to print
+// to PDF. Each control has a notes cell for the auditor.
+func (r EvidenceReport) WriteHTML(w io.Writer) error {
+	if err := reportTemplate.Execute(w, r); err != nil {
+		return fmt.Errorf("render report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package compliance
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+func reportRequest(t *testing.T, frameworks string) protocol.AgentRequest {
+	t.Helper()
+	req := protocol.AgentRequest{
+		Prompt:   "```hcl\n" + frameworkConfig + "\n\nresource \"azurerm_key_vault\" \"kv\" {\n  name = \"kv\"\n}\n```",
+		Metadata: map[string]string{protocol.MetaFrameworks: frameworks},
+	}
+	host.ParseAndEnrich(&req)
+	return req
+}
+
+func TestAgent_Report(t *testing.T) {
+	a := New()
+	a.now = func() time.Time { return time.Date(2026, 10, 1, 9, 30, 0, 0, time.UTC) }
+	rep, err := a.Report(reportRequest(t, "nist,pci-dss"), ReportOptions{
+		Auditor: "A. Auditor",
+		Notes:   map[string]string{"4.2.1": "Accepted until Q4", "nist-800-53 SC-7": "Tracked in GRC-12"},
+		Findings: []protocol.Finding{
+			{RuleID: "SEC-001", ResourceType: "azurerm_key_vault", Resource: "kv", Message: "secret in pipeline variables"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Title != DefaultReportTitle || len(rep.CodeSHA256) != 64 || len(rep.Resources) != 2 {
+		t.Errorf("report = %+v", rep)
+	}
+	if len(rep.Frameworks) != 2 || rep.Frameworks[0].ID != NISTFramework || rep.Frameworks[1].ID != "pci-dss" {
+		t.Fatalf("frameworks = %+v", rep.Frameworks)
+	}
+
+	controls := make(map[string]EvidenceControl)
+	for _, c := range rep.Controls {
+		controls[c.Framework+" "+c.ControlID] = c
+		if !c.Assessed.Equal(rep.Generated) {
+			t.Errorf("%s assessed at %v", c.ControlID, c.Assessed)
+		}
+	}
+	if c := controls["nist-800-53 SC-7"]; c.Status != StatusFail || c.Notes != "Tracked in GRC-12" || len(c.Resources) != 1 {
+		t.Errorf("SC-7 = %+v", c)
+	}
+	if c := controls["pci-dss 4.2.1"]; c.Status != StatusFail || c.Notes != "Accepted until Q4" {
+		t.Errorf("4.2.1 = %+v", c)
+	}
+	// The supplied finding fails a control the code alone passes.
+	if c := controls["pci-dss 8.6.2"]; c.Status != StatusFail || len(c.Failures) != 1 || !strings.Contains(c.Failures[0], "secret in pipeline variables") {
+		t.Errorf("8.6.2 = %+v", c)
+	}
+
+	var passed, failed int
+	for _, c := range rep.Controls {
+		switch c.Status {
+		case StatusPass:
+			passed++
+		case StatusFail:
+			failed++
+		}
+	}
+	if score, ok := rep.Score(); !ok || score != passed*100/(passed+failed) || score == 100 {
+		t.Errorf("Score = %d, %v; %d passed, %d failed", score, ok, passed, failed)
+	}
+	if _, ok := (EvidenceReport{}).Score(); ok {
+		t.Error("empty report should have no score")
+	}
+
+	if _, err := a.Report(protocol.AgentRequest{}, ReportOptions{}); err == nil {
+		t.Error("report without code should fail")
+	}
+	if _, err := a.Report(reportRequest(t, "sox"), ReportOptions{}); err == nil {
+		t.Error("unknown framework should fail")
+	}
+}
+
+func TestEvidenceReport_Write(t *testing.T) {
+	a := New()
+	rep, err := a.Report(reportRequest(t, "pci-dss"), ReportOptions{Title: "Q3 <audit>", Notes: map[string]string{"4.2.1": "see ticket"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := rep.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(rep.Controls)+1 || strings.Join(rows[0], ",") != strings.Join(reportColumns, ",") {
+		t.Fatalf("csv header = %v, %d rows", rows[0], len(rows))
+	}
+	for _, row := range rows[1:] {
+		if row[1] == "4.2.1" && (row[3] != StatusFail || row[7] != rep.CodeSHA256 || row[9] != "see ticket") {
+			t.Errorf("4.2.1 row = %q", row)
+		}
+	}
+
+	buf.Reset()
+	if err := rep.WriteHTML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	page := buf.String()
+	for _, want := range []string{"<title>Q3 &lt;audit&gt;</title>", "<h2>PCI DSS v4.0</h2>", `<td class="fail">fail</td>`, "see ticket", rep.CodeSHA256, "azurerm_key_vault.kv"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("HTML missing %q", want)
+		}
+	}
+}
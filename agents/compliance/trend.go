@@ -0,0 +1,68 @@
+package compliance
+
+import (
+	"log"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/trend"
+)
+
+// score is the percentage of applicable controls that pass, rounded down.
+// Skipped controls count neither way. ok is false when none applies.
+func (s FrameworkSummary) score() (score int, ok bool) {
+	if s.Passed+s.Failed == 0 {
+		return 0, false
+	}
+	return s.Passed * 100 / (s.Passed + s.Failed), true
+}
+
+func (s *FrameworkSummary) add(o FrameworkSummary) {
+	s.Total += o.Total
+	s.Passed += o.Passed
+	s.Failed += o.Failed
+	s.Skipped += o.Skipped
+	s.NotApplicable += o.NotApplicable
+}
+
+// auditScores scores an audit per framework, with the overall score under
+// trend.Overall. NIST is scored as in evidence reports, one control per
+// rule, from its rules and their findings before skip comments apply. It
+// returns nil when no control applies.
+func auditScores(iac *protocol.IaCInput, nistRules []analyzer.Rule, nistFindings []protocol.Finding, results []FrameworkResult) map[string]int {
+	if len(nistRules) > 0 {
+		results = append(assessFrameworks([]Framework{nistFramework(nistRules)}, nistFindings, iac), results...)
+	}
+	scores := make(map[string]int)
+	var total FrameworkSummary
+	for _, r := range results {
+		if score, ok := r.Summary.score(); ok {
+			scores[r.ID] = score
+		}
+		total.add(r.Summary)
+	}
+	overall, ok := total.score()
+	if !ok {
+		return nil
+	}
+	scores[trend.Overall] = overall
+	return scores
+}
+
+// record adds an audit's scores to the trend store when the request names
+// its repository.
+func (a *Agent) record(req protocol.AgentRequest, scores map[string]int) {
+	repository := req.Metadata[protocol.MetaRepository]
+	if a.trends == nil || repository == "" || req.Metadata[protocol.MetaProbe] != "" || scores == nil {
+		return
+	}
+	audit := trend.Audit{
+		Repository: repository,
+		Commit:     req.Metadata[protocol.MetaCommit],
+		Time:       a.now().UTC(),
+		Scores:     scores,
+	}
+	if err := a.trends.Add(audit); err != nil {
+		log.Printf("Compliance trend for %s: %v", repository, err)
+	}
+}
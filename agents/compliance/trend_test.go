@@ -0,0 +1,61 @@
+package compliance
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/trend"
+)
+
+func TestAgent_RecordsTrend(t *testing.T) {
+	store, _ := trend.NewFileStore("")
+	a := New(WithTrends(store))
+	a.now = func() time.Time { return time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC) }
+	var reported map[string]int
+	run := func(meta map[string]string) {
+		t.Helper()
+		req := protocol.AgentRequest{Prompt: "audit:\n```hcl\n" + frameworkConfig + "\n```", Metadata: meta}
+		host.ParseAndEnrich(&req)
+		rec := &scoreRecorder{}
+		if err := a.Handle(context.Background(), req, rec); err != nil {
+			t.Fatal(err)
+		}
+		reported = rec.scores
+	}
+
+	run(map[string]string{protocol.MetaFrameworks: "nist,pci-dss"})
+	run(map[string]string{protocol.MetaFrameworks: "nist,pci-dss", protocol.MetaRepository: "org/app", protocol.MetaCommit: "9f2c1e0"})
+	audits, _ := store.Audits(trend.Query{})
+	if len(audits) != 1 {
+		t.Fatalf("audits = %+v, want only the one naming a repository", audits)
+	}
+	au := audits[0]
+	if au.Repository != "org/app" || au.Commit != "9f2c1e0" || !au.Time.Equal(a.now()) {
+		t.Errorf("audit = %+v", au)
+	}
+	pci, okPCI := au.Scores["pci-dss"]
+	_, okNIST := au.Scores[NISTFramework]
+	overall, okAll := au.Scores[trend.Overall]
+	if !okPCI || !okNIST || !okAll || pci == 100 || overall == 100 {
+		t.Errorf("scores = %v", au.Scores)
+	}
+	if _, ok := au.Scores["hipaa"]; ok {
+		t.Errorf("unselected framework scored: %v", au.Scores)
+	}
+	if !reflect.DeepEqual(reported, au.Scores) {
+		t.Errorf("reported scores %v, recorded %v", reported, au.Scores)
+	}
+}
+
+// scoreRecorder keeps the scores an agent reports.
+type scoreRecorder struct {
+	prototest.Recorder
+	scores map[string]int
+}
+
+func (r *scoreRecorder) ReportScores(_ string, scores map[string]int) { r.scores = scores }
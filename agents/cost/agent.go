@@ -4,6 +4,7 @@ package cost
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strings"
 
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/llm"
@@ -15,11 +16,17 @@ import (
 type Agent struct {
 	llmClient *llm.Client
 	enableLLM bool
+	prices    *PriceCache
+	currency  string
+	locale    string
+	budget    float64
+	// reservations is capacity purchased outside the IaC.
+	reservations []Reservation
 }
 
 // New creates a new cost Agent.
 func New(opts ...Option) *Agent {
-	a := &Agent{}
+	a := &Agent{currency: CurrencyUSD, locale: DefaultLocale}
 	for _, o := range opts {
 		o(a)
 	}
@@ -37,20 +44,50 @@ func WithLLM(client *llm.Client) Option {
 	}
 }
 
+// WithPriceCache looks up VM sizes missing from the static price tables in
+// the cache (and through it the Azure Retail Prices API).
+func WithPriceCache(c *PriceCache) Option {
+	return func(a *Agent) {
+		a.prices = c
+	}
+}
+
+// WithCurrency sets the currency estimates are reported in when a request
+// does not ask for one. code must be valid for ParseCurrency. Amounts are
+// converted from USD at the Retail Prices API's rate, which needs
+// WithPriceCache.
+func WithCurrency(code string) Option {
+	return func(a *Agent) {
+		if c, err := ParseCurrency(code); err == nil {
+			a.currency = c
+		}
+	}
+}
+
+// WithLocale sets the locale amounts are written in when a request does not
+// ask for one, e.g. "de-DE". tag must be valid for ParseLocale.
+func WithLocale(tag string) Option {
+	return func(a *Agent) {
+		if l, err := ParseLocale(tag); err == nil {
+			a.locale = l
+		}
+	}
+}
+
 func (a *Agent) ID() string { return "cost" }
 
 func (a *Agent) Metadata() protocol.AgentMetadata {
 	return protocol.AgentMetadata{
 		ID:          "cost",
 		Name:        "Cost Estimator",
-		Description: "Estimates monthly Azure costs for declared IaC resources using static pricing tables",
+		Description: "Estimates monthly Azure costs for declared IaC resources using static pricing tables and the Azure Retail Prices API",
 		Version:     "1.0.0",
 	}
 }
 
 func (a *Agent) Capabilities() protocol.AgentCapabilities {
 	return protocol.AgentCapabilities{
-		Formats:       []protocol.SourceFormat{protocol.FormatTerraform, protocol.FormatBicep},
+		Formats:       []protocol.SourceFormat{protocol.FormatTerraform, protocol.FormatBicep, protocol.FormatARM, protocol.FormatTerraformPlan},
 		NeedsIaCInput: true,
 	}
 }
@@ -61,38 +98,178 @@ func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit prot
 		return nil
 	}
 
-	var total float64
-	var items []costItem
-
-	for _, res := range req.IaC.Resources {
-		est := estimateResource(res)
-		items = append(items, costItem{
-			Name:    parser.ShortType(res.Type) + "." + res.Name,
-			SKU:     est.sku,
-			Monthly: est.monthly,
-		})
-		total += est.monthly
+	r, m, err := a.estimate(ctx, req)
+	if err != nil {
+		emit.SendError(err.Error())
+		return nil
 	}
 
-	emit.SendMessage(fmt.Sprintf("## Estimated Monthly Cost: **$%.2f**\n\n", total))
-	emit.SendMessage("| Resource | SKU | Monthly |\n|----------|-----|---------|\n")
-	for _, it := range items {
-		emit.SendMessage(fmt.Sprintf("| %s | %s | $%.2f |\n", it.Name, it.SKU, it.Monthly))
+	emit.SendMessage(fmt.Sprintf("## Estimated Monthly Cost: **%s**\n\n", m.format(r.TotalMonthly)))
+	if r.ReservedMonthly > 0 {
+		emit.SendMessage(fmt.Sprintf("_Net of %s per month covered by reserved capacity; the reservations themselves are prepaid._\n\n", m.format(r.ReservedMonthly)))
+	}
+	if r.Environment != "" || r.Version != "" {
+		emit.SendMessage(fmt.Sprintf("Environment: `%s` · Version: `%s`\n\n", orUnset(r.Environment), orUnset(r.Version)))
+	}
+	if r.RequestedCurrency != "" {
+		emit.SendMessage(fmt.Sprintf("_%s exchange rate unavailable; amounts are in USD._\n\n", r.RequestedCurrency))
+	}
+	emit.SendMessage(fmt.Sprintf("| Resource | SKU | Monthly (%s) | Confidence |\n|----------|-----|---------|------------|\n", m.currency))
+	for _, it := range r.Items {
+		emit.SendMessage(fmt.Sprintf("| %s | %s | %s | %s |\n", it.Name, it.SKU, m.format(it.Monthly), it.Confidence))
 	}
 	emit.SendMessage("\n")
+	if r.CurrentMonthly != nil {
+		current := *r.CurrentMonthly
+		emit.SendMessage(fmt.Sprintf("**Change vs current state: %s per month** (currently %s)\n\n", formatDelta(r.TotalMonthly-current, current, m), m.format(current)))
+	}
+	reportCosts(emit, a.ID(), r.Items, m.currency, r.Environment, r.Version)
+	if r.CurrentMonthly != nil {
+		protocol.ReportCostBaseline(emit, a.ID(), *r.CurrentMonthly, m.currency)
+	}
+	if r.LowConfidence > 0 {
+		emit.SendMessage(fmt.Sprintf("_%d line item(s) rest on assumed defaults or unresolved values; set the SKU explicitly for a firmer estimate._\n\n", r.LowConfidence))
+	}
+	if r.Budget != nil {
+		budgetCheck(emit, a.ID(), r.TotalMonthly, r.Budget.Monthly, m, r.LowConfidence > 0)
+	}
 
 	// LLM-enhanced cost optimization tips
 	if a.enableLLM && a.llmClient != nil && req.Token != "" {
-		a.enhanceWithLLM(ctx, req, items, total, emit)
+		a.enhanceWithLLM(ctx, req, r.Items, r.TotalMonthly, m, emit)
 	}
 
 	return nil
 }
 
-type costItem struct {
-	Name    string
-	SKU     string
-	Monthly float64
+var (
+	stageEnvRe     = regexp.MustCompile(`(?i)\b(?:for|in|to|into)\s+(dev|staging|test|prod|production)\b`)
+	stageVersionRe = regexp.MustCompile(`\bv\d+\.\d+\.\d+\b`)
+)
+
+// deploymentStage returns the environment and version the estimate is for,
+// from the request metadata set by the promotion workflow or, failing that,
+// from the prompt ("estimate v1.3.0 for prod").
+func deploymentStage(req protocol.AgentRequest) (env, version string) {
+	env, version = req.Metadata[protocol.MetaEnvironment], req.Metadata[protocol.MetaVersion]
+	prompt := protocol.PromptText(req)
+	if env == "" {
+		if m := stageEnvRe.FindStringSubmatch(prompt); m != nil {
+			env = strings.ToLower(m[1])
+			if env == "production" {
+				env = "prod"
+			}
+		}
+	}
+	if version == "" {
+		version = stageVersionRe.FindString(prompt)
+	}
+	return env, version
+}
+
+func orUnset(s string) string {
+	if s == "" {
+		return "unset"
+	}
+	return s
+}
+
+// reportCosts hands the line items, tagged with their currency and the
+// deployment stage, to emitters that keep them so cost changes can be
+// compared across releases.
+func reportCosts(emit protocol.Emitter, agentID string, items []Item, currency, env, version string) {
+	out := make([]protocol.CostItem, len(items))
+	for i, it := range items {
+		out[i] = protocol.CostItem{Name: it.Name, SKU: it.SKU, Monthly: it.Monthly, Currency: currency, Confidence: it.Confidence, Source: string(it.Source), Environment: env, Version: version}
+	}
+	protocol.ReportCosts(emit, agentID, out)
+}
+
+// Item is one line item of an estimate.
+type Item struct {
+	Name       string              `json:"name"`
+	SKU        string              `json:"sku"`
+	Monthly    float64             `json:"monthly"`
+	Confidence protocol.Confidence `json:"confidence"`
+	Source     PriceSource         `json:"source"`
+	// capacity is what the item consumes of reservable capacity.
+	capacity capacityUsage
+}
+
+// PriceSource is where a line item's price came from.
+type PriceSource string
+
+const (
+	// SourceTable prices come from the built-in list price tables.
+	SourceTable PriceSource = "table"
+	// SourceCache prices were served from the price cache.
+	SourceCache PriceSource = "cache"
+	// SourceAPI prices were fetched from the Azure Retail Prices API for
+	// this estimate.
+	SourceAPI PriceSource = "api"
+	// SourceHeuristic prices rest on fallback rates, assumed defaults or
+	// unresolved values: every low-confidence item.
+	SourceHeuristic PriceSource = "heuristic"
+	// SourceReservation items credit the on-demand price of capacity
+	// covered by a reservation.
+	SourceReservation PriceSource = "reservation"
+)
+
+// itemSource returns the source of a line item priced from src ("" for the
+// price tables) at confidence conf.
+func itemSource(src PriceSource, conf protocol.Confidence) PriceSource {
+	switch {
+	case conf == protocol.ConfidenceLow:
+		return SourceHeuristic
+	case src == "":
+		return SourceTable
+	}
+	return src
+}
+
+// estimateAll estimates each resource and returns the line items and total.
+// Resources a plan destroys cost nothing.
+func estimateAll(resources []protocol.Resource, price vmPricer) ([]Item, float64) {
+	var total float64
+	items := make([]Item, 0, len(resources))
+	for _, res := range resources {
+		if res.Deleted() {
+			continue
+		}
+		est := estimateResource(res, price)
+		name := parser.ShortType(res.Type) + "." + res.Name
+		items = append(items, Item{Name: name, SKU: est.sku, Monthly: est.monthly, Confidence: est.confidence, Source: itemSource(est.source, est.confidence), capacity: est.capacity})
+		total += est.monthly
+		for _, extra := range est.extras {
+			conf := est.confidence
+			if extra.confidence != "" {
+				conf = extra.confidence
+			}
+			items = append(items, Item{Name: name + " (" + extra.label + ")", SKU: extra.sku, Monthly: extra.monthly, Confidence: conf, Source: itemSource("", conf)})
+			total += extra.monthly
+		}
+	}
+	return items, total
+}
+
+// currentCost estimates resources as they are before a Terraform plan
+// applies, net of reserved capacity. ok is false for input that is not a
+// plan.
+func currentCost(resources []protocol.Resource, price vmPricer, reserved []Reservation) (float64, bool) {
+	var before []protocol.Resource
+	planned := false
+	for _, res := range resources {
+		if res.Change == nil {
+			continue
+		}
+		planned = true
+		if res.Change.Before != nil {
+			before = append(before, protocol.Resource{Type: res.Type, Name: res.Name, Properties: res.Change.Before})
+		}
+	}
+	items, total := estimateAll(before, price)
+	_, credited := applyReservations(items, reserved)
+	return total - credited, planned
 }
 
 const costPrompt = `You are a senior Azure FinOps engineer. Given the IaC code and cost estimates below, provide:
@@ -102,16 +279,16 @@ const costPrompt = `You are a senior Azure FinOps engineer. Given the IaC code a
 
 Be specific. Reference actual resource names and SKUs. Use markdown. Keep it under 200 words.`
 
-func (a *Agent) enhanceWithLLM(ctx context.Context, req protocol.AgentRequest, items []costItem, total float64, emit protocol.Emitter) {
+func (a *Agent) enhanceWithLLM(ctx context.Context, req protocol.AgentRequest, items []Item, total float64, m money, emit protocol.Emitter) {
 	var sb strings.Builder
 	sb.WriteString("## IaC Code\n```\n")
 	if req.IaC != nil {
 		sb.WriteString(req.IaC.RawCode)
 	}
 	sb.WriteString("\n```\n\n## Cost Estimates\n")
-	sb.WriteString(fmt.Sprintf("Total: $%.2f/month\n", total))
+	sb.WriteString(fmt.Sprintf("Total: %s/month\n", m.format(total)))
 	for _, it := range items {
-		sb.WriteString(fmt.Sprintf("- %s (%s): $%.2f/month\n", it.Name, it.SKU, it.Monthly))
+		sb.WriteString(fmt.Sprintf("- %s (%s): %s/month\n", it.Name, it.SKU, m.format(it.Monthly)))
 	}
 
 	emit.SendMessage("\n#### AI Cost Optimization\n\n")
@@ -129,20 +306,70 @@ func (a *Agent) enhanceWithLLM(ctx context.Context, req protocol.AgentRequest, i
 type estimate struct {
 	sku     string
 	monthly float64
+	// confidence rates the properties the estimate was priced from; extras
+	// share it unless they set their own.
+	confidence protocol.Confidence
+	// extras are charges billed separately from the resource itself and
+	// listed as their own line items.
+	extras []extraCost
+	// source is where a VM price came from; other prices come from the
+	// price tables.
+	source PriceSource
+	// capacity is the reservable capacity the resource itself consumes.
+	capacity capacityUsage
 }
 
-func estimateResource(res protocol.Resource) estimate {
+// estimateConfidence rates an estimate by the properties it read (see
+// protocol.ValueConfidence). A SKU missing from the price tables was priced
+// at a fallback rate and is low.
+func estimateConfidence(res protocol.Resource, priced bool, paths ...string) protocol.Confidence {
+	if !priced {
+		return protocol.ConfidenceLow
+	}
+	levels := make([]protocol.Confidence, 0, len(paths))
+	for _, path := range paths {
+		levels = append(levels, protocol.ValueConfidence(res, path))
+	}
+	return protocol.LeastConfident(levels...)
+}
+
+type extraCost struct {
+	label      string
+	sku        string
+	monthly    float64
+	confidence protocol.Confidence
+}
+
+func estimateResource(res protocol.Resource, price vmPricer) estimate {
 	region := "eastus"
-	if loc, ok := res.Properties["location"].(string); ok && loc != "" {
-		region = loc
+	if loc, ok := res.Properties["location"].(string); ok {
+		if r := armRegion(loc); r != "" {
+			region = r
+		}
+	}
+	var source PriceSource
+	vm := func(size string) (float64, bool) {
+		hourly, src := price(size, region)
+		source = src
+		return hourly, src != SourceHeuristic
 	}
-	_ = region // region for future API lookups
+	est := estimateByType(res, vm)
+	est.source = source
+	est.capacity.region = region
+	return est
+}
+
+func estimateByType(res protocol.Resource, vm func(size string) (float64, bool)) estimate {
 
 	switch res.Type {
 	case "azurerm_kubernetes_cluster":
-		return estimateAKS(res)
+		return estimateAKS(res, vm)
+	case "azurerm_kubernetes_cluster_node_pool":
+		return estimateNodePool(res, vm)
 	case "azurerm_virtual_machine", "azurerm_linux_virtual_machine", "azurerm_windows_virtual_machine":
-		return estimateVM(res)
+		return estimateVM(res, vm)
+	case "azurerm_managed_disk":
+		return estimateManagedDisk(res)
 	case "azurerm_storage_account":
 		return estimateStorage(res)
 	case "azurerm_app_service_plan", "azurerm_service_plan":
@@ -150,17 +377,42 @@ func estimateResource(res protocol.Resource) estimate {
 	case "azurerm_container_registry":
 		return estimateACR(res)
 	case "azurerm_key_vault":
-		return estimate{sku: "Standard", monthly: 3.00}
-	case "azurerm_virtual_network", "azurerm_subnet", "azurerm_network_security_group":
-		return estimate{sku: "N/A", monthly: 0}
+		return estimate{sku: "Standard", monthly: 3.00, confidence: protocol.ConfidenceHigh}
+	case "azurerm_mssql_database":
+		return estimateSQLDatabase(res)
+	case "azurerm_cosmosdb_account":
+		return estimateCosmosDB(res)
+	case "azurerm_postgresql_flexible_server":
+		return estimatePostgres(res)
+	case "azurerm_application_gateway":
+		return estimateAppGateway(res)
+	case "azurerm_firewall":
+		return estimateFirewall(res)
+	case reservationOrderType:
+		// Netted against the resources it covers; the purchase itself is
+		// a commitment, not a marginal cost.
+		return estimate{sku: "Reserved capacity (prepaid)", monthly: 0, confidence: protocol.ConfidenceHigh}
+	case "azurerm_nat_gateway":
+		return estimate{sku: "Standard", monthly: natGatewayHourly * hoursPerMonth, confidence: protocol.ConfidenceHigh}
+	case "azurerm_public_ip":
+		return estimatePublicIP(res)
+	case "azurerm_function_app", "azurerm_linux_function_app", "azurerm_windows_function_app":
+		// The plan is priced as a service plan; consumption executions are
+		// assumed to stay within the monthly free grant.
+		return estimate{sku: "Consumption (free grant)", monthly: 0, confidence: protocol.ConfidenceMedium}
+	case "azurerm_log_analytics_workspace":
+		return estimateLogAnalytics(res)
+	case "azurerm_virtual_network", "azurerm_subnet", "azurerm_network_security_group",
+		"azurerm_virtual_machine_data_disk_attachment":
+		return estimate{sku: "N/A", monthly: 0, confidence: protocol.ConfidenceHigh}
 	default:
-		return estimate{sku: "Unknown", monthly: 0}
+		return estimate{sku: "Unknown", monthly: 0, confidence: protocol.ConfidenceLow}
 	}
 }
 
 const hoursPerMonth = 730
 
-func estimateAKS(res protocol.Resource) estimate {
+func estimateAKS(res protocol.Resource, vm func(size string) (float64, bool)) estimate {
 	vmSize := "Standard_D2s_v3"
 	nodeCount := 3
 	if pool, ok := res.Properties["default_node_pool"].(map[string]interface{}); ok {
@@ -171,26 +423,106 @@ func estimateAKS(res protocol.Resource) estimate {
 			nodeCount = c
 		}
 	}
-	hourly := vmPrice(vmSize)
+	hourly, priced := vm(vmSize)
 	monthly := hourly*hoursPerMonth*float64(nodeCount) + 18.25
 	return estimate{
-		sku:     fmt.Sprintf("%dx %s", nodeCount, vmSize),
-		monthly: monthly,
+		sku:        fmt.Sprintf("%dx %s", nodeCount, vmSize),
+		monthly:    monthly,
+		confidence: estimateConfidence(res, priced, "default_node_pool.vm_size", "default_node_pool.node_count"),
+		extras:     aksExtras(res, nodeCount),
+		capacity:   capacityUsage{kind: ReservedVM, sku: vmSize, quantity: float64(nodeCount), unit: hourly * hoursPerMonth},
 	}
 }
 
-func estimateVM(res protocol.Resource) estimate {
+// AKS charges outside node compute.
+const (
+	// Uptime SLA per cluster-hour by tier ("Paid" is the legacy name for Standard).
+	aksStandardTierHourly = 0.10
+	aksPremiumTierHourly  = 0.60
+	// Container insights ingestion assumes ~0.5 GB/node/day into Log Analytics.
+	containerInsightsGBPerNodeDay = 0.5
+	logAnalyticsPerGB             = 2.30
+)
+
+func aksExtras(res protocol.Resource, nodeCount int) []extraCost {
+	var extras []extraCost
+
+	tier, _ := res.Properties["sku_tier"].(string)
+	if sku, ok := res.Properties["sku"].(map[string]interface{}); ok && tier == "" {
+		tier, _ = sku["tier"].(string) // Bicep: sku: { tier: 'Standard' }
+	}
+	switch strings.ToLower(tier) {
+	case "standard", "paid":
+		extras = append(extras, extraCost{label: "uptime SLA", sku: "Standard tier", monthly: aksStandardTierHourly * hoursPerMonth})
+	case "premium":
+		extras = append(extras, extraCost{label: "uptime SLA", sku: "Premium tier", monthly: aksPremiumTierHourly * hoursPerMonth})
+	}
+
+	if aksAddonEnabled(res, "oms_agent", "omsagent") {
+		gb := containerInsightsGBPerNodeDay * 30 * float64(nodeCount)
+		extras = append(extras, extraCost{label: "container insights", sku: fmt.Sprintf("~%.0f GB ingested", gb), monthly: gb * logAnalyticsPerGB})
+	}
+
+	// The Azure Policy add-on has no AKS charge; list it so it is not
+	// mistaken for an omission.
+	if b, ok := res.Properties["azure_policy_enabled"].(bool); (ok && b) || aksAddonEnabled(res, "", "azurepolicy") {
+		extras = append(extras, extraCost{label: "Azure Policy add-on", sku: "Included", monthly: 0})
+	}
+	return extras
+}
+
+// aksAddonEnabled reports whether an add-on is configured, either as a
+// Terraform block (tfBlock) or as a Bicep addonProfiles entry (bicepName).
+func aksAddonEnabled(res protocol.Resource, tfBlock, bicepName string) bool {
+	if tfBlock != "" {
+		if _, ok := res.Properties[tfBlock].(map[string]interface{}); ok {
+			return true
+		}
+	}
+	profiles, _ := res.Properties["addonProfiles"].(map[string]interface{})
+	addon, _ := profiles[bicepName].(map[string]interface{})
+	enabled, _ := addon["enabled"].(bool)
+	return enabled
+}
+
+// estimateNodePool prices an additional AKS node pool. Windows pools carry
+// the same license surcharge as Windows VMs, listed separately.
+func estimateNodePool(res protocol.Resource, vm func(size string) (float64, bool)) estimate {
 	vmSize := "Standard_D2s_v3"
 	if s, ok := res.Properties["vm_size"].(string); ok {
 		vmSize = s
-	} else if s, ok := res.Properties["size"].(string); ok {
+	}
+	nodeCount := 1
+	if c, ok := res.Properties["node_count"].(int); ok {
+		nodeCount = c
+	}
+	hourly, priced := vm(vmSize)
+	est := estimate{
+		sku:        fmt.Sprintf("%dx %s", nodeCount, vmSize),
+		monthly:    hourly * hoursPerMonth * float64(nodeCount),
+		confidence: estimateConfidence(res, priced, "vm_size", "node_count"),
+		capacity:   capacityUsage{kind: ReservedVM, sku: vmSize, quantity: float64(nodeCount), unit: hourly * hoursPerMonth},
+	}
+	if os, _ := res.Properties["os_type"].(string); strings.EqualFold(os, "Windows") {
+		est.extras = append(est.extras, extraCost{label: "Windows surcharge", sku: fmt.Sprintf("%dx Windows license", nodeCount), monthly: hourly * 0.5 * hoursPerMonth * float64(nodeCount)})
+	}
+	return est
+}
+
+func estimateVM(res protocol.Resource, vm func(size string) (float64, bool)) estimate {
+	vmSize, sizeProp := "Standard_D2s_v3", "vm_size"
+	if s, ok := res.Properties["vm_size"].(string); ok {
 		vmSize = s
+	} else if s, ok := res.Properties["size"].(string); ok {
+		vmSize, sizeProp = s, "size"
 	}
-	hourly := vmPrice(vmSize)
+	hourly, priced := vm(vmSize)
+	// Reservations cover compute, not the Windows license.
+	capacity := capacityUsage{kind: ReservedVM, sku: vmSize, quantity: 1, unit: hourly * hoursPerMonth}
 	if res.Type == "azurerm_windows_virtual_machine" {
 		hourly *= 1.5
 	}
-	return estimate{sku: vmSize, monthly: hourly * hoursPerMonth}
+	return estimate{sku: vmSize, monthly: hourly * hoursPerMonth, confidence: estimateConfidence(res, priced, sizeProp), extras: diskExtras(res), capacity: capacity}
 }
 
 func estimateStorage(res protocol.Resource) estimate {
@@ -199,10 +531,13 @@ func estimateStorage(res protocol.Resource) estimate {
 		sku = "Standard_" + rep
 	}
 	pricePerGB := storagePrices[sku]
+	// Capacity isn't declared in IaC, so 100 GB is always assumed and the
+	// estimate is at best medium.
+	conf := protocol.LeastConfident(protocol.ConfidenceMedium, estimateConfidence(res, pricePerGB != 0, "account_replication_type"))
 	if pricePerGB == 0 {
 		pricePerGB = 0.0184
 	}
-	return estimate{sku: sku, monthly: pricePerGB * 100}
+	return estimate{sku: sku, monthly: pricePerGB * 100, confidence: conf}
 }
 
 func estimateAppService(res protocol.Resource) estimate {
@@ -210,11 +545,12 @@ func estimateAppService(res protocol.Resource) estimate {
 	if s, ok := res.Properties["sku_name"].(string); ok {
 		sku = s
 	}
-	monthly := appServicePrices[sku]
-	if monthly == 0 {
+	monthly, priced := appServicePrices[sku]
+	conf := estimateConfidence(res, priced, "sku_name")
+	if !priced {
 		monthly = 13.14
 	}
-	return estimate{sku: sku, monthly: monthly}
+	return estimate{sku: sku, monthly: monthly, confidence: conf}
 }
 
 func estimateACR(res protocol.Resource) estimate {
@@ -223,17 +559,58 @@ func estimateACR(res protocol.Resource) estimate {
 		sku = s
 	}
 	monthly := acrPrices[sku]
+	conf := estimateConfidence(res, monthly != 0, "sku")
 	if monthly == 0 {
 		monthly = 5.00
 	}
-	return estimate{sku: sku, monthly: monthly}
+	return estimate{sku: sku, monthly: monthly, confidence: conf}
 }
 
-func vmPrice(sku string) float64 {
-	if p, ok := vmSkuPrices[sku]; ok {
-		return p
+// vmPricer returns the hourly price of a VM size in an ARM region and where
+// it came from; the source is SourceHeuristic for the fallback rate of a
+// size nobody has a price for.
+type vmPricer func(size, region string) (hourly float64, src PriceSource)
+
+// fallbackVMHourly prices VM sizes without a known price, as a D2s_v3.
+const fallbackVMHourly = 0.096
+
+// tablePrice prices VM sizes from the static table alone.
+func tablePrice(size, _ string) (float64, PriceSource) {
+	if p, ok := vmSkuPrices[size]; ok {
+		return p, SourceTable
+	}
+	return fallbackVMHourly, SourceHeuristic
+}
+
+// vmPricer prices VM sizes from the static table, then from the price cache.
+func (a *Agent) vmPricer(ctx context.Context) vmPricer {
+	if a.prices == nil {
+		return tablePrice
+	}
+	return func(size, region string) (float64, PriceSource) {
+		if p, ok := vmSkuPrices[size]; ok {
+			return p, SourceTable
+		}
+		if p, fetched, ok := a.prices.lookup(ctx, PriceKey{SKU: size, Region: region, PriceType: PriceTypeConsumption}); ok {
+			if fetched {
+				return p, SourceAPI
+			}
+			return p, SourceCache
+		}
+		return fallbackVMHourly, SourceHeuristic
+	}
+}
+
+var armRegionRe = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// armRegion normalizes a location ("East US") to its ARM name ("eastus"),
+// or returns "" for an expression such as var.location.
+func armRegion(loc string) string {
+	r := strings.ToLower(strings.ReplaceAll(loc, " ", ""))
+	if !armRegionRe.MatchString(r) {
+		return ""
 	}
-	return 0.096
+	return r
 }
 
 var vmSkuPrices = map[string]float64{
@@ -256,6 +633,9 @@ var appServicePrices = map[string]float64{
 	"S1": 69.35, "S2": 138.70, "S3": 277.40,
 	"P1v2": 73.00, "P2v2": 146.00, "P3v2": 292.00,
 	"P1v3": 95.63, "P2v3": 191.25, "P3v3": 382.50,
+	// Functions: consumption bills per execution; Elastic Premium per
+	// always-ready instance.
+	"Y1": 0, "FC1": 0, "EP1": 142.35, "EP2": 284.70, "EP3": 569.40,
 }
 
 var acrPrices = map[string]float64{
@@ -2,12 +2,15 @@ package cost
 
 import (
 	"context"
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/report"
 )
 
 func TestAgent_ID(t *testing.T) {
@@ -76,6 +79,54 @@ func TestAgent_AKSCost(t *testing.T) {
 	}
 }
 
+func TestAgent_AKSExtrasAsLineItems(t *testing.T) {
+	tfCode := `resource "azurerm_kubernetes_cluster" "aks" {
+  sku_tier             = "Standard"
+  azure_policy_enabled = true
+  default_node_pool {
+    node_count = 2
+    vm_size    = "Standard_D2s_v3"
+  }
+  oms_agent {
+    log_analytics_workspace_id = "ws"
+  }
+}
+
+resource "azurerm_kubernetes_cluster_node_pool" "win" {
+  vm_size    = "Standard_D4s_v3"
+  node_count = 2
+  os_type    = "Windows"
+}`
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "estimate cost:\n```hcl\n" + tfCode + "\n```"}},
+	}
+	host.ParseAndEnrich(&req)
+
+	items, total := estimateAll(req.IaC.Resources, tablePrice)
+	want := map[string]float64{
+		"kubernetes_cluster.aks (uptime SLA)":                  73.00,
+		"kubernetes_cluster.aks (container insights)":          69.00,
+		"kubernetes_cluster.aks (Azure Policy add-on)":         0,
+		"kubernetes_cluster_node_pool.win (Windows surcharge)": 140.16,
+	}
+	var sum float64
+	for _, it := range items {
+		sum += it.Monthly
+		if w, ok := want[it.Name]; ok {
+			if diff := it.Monthly - w; diff > 0.01 || diff < -0.01 {
+				t.Errorf("%s = $%.2f, want $%.2f", it.Name, it.Monthly, w)
+			}
+			delete(want, it.Name)
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("missing line items: %v", want)
+	}
+	if diff := sum - total; diff > 0.01 || diff < -0.01 {
+		t.Errorf("total $%.2f does not match line items $%.2f", total, sum)
+	}
+}
+
 func TestAgent_NoIaC(t *testing.T) {
 	a := New()
 	rec := &prototest.Recorder{}
@@ -92,3 +143,170 @@ func TestAgent_NoIaC(t *testing.T) {
 func TestAgent_ImplementsAgent(t *testing.T) {
 	var _ protocol.Agent = (*Agent)(nil)
 }
+
+func TestEstimateAll_Confidence(t *testing.T) {
+	tfCode := `resource "azurerm_linux_virtual_machine" "literal" {
+  size = "Standard_D4s_v3"
+}
+
+resource "azurerm_linux_virtual_machine" "variable" {
+  size = var.vm_size
+}
+
+resource "azurerm_linux_virtual_machine" "defaulted" {
+  name = "vm"
+}`
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "estimate cost:\n```hcl\n" + tfCode + "\n```"}},
+	}
+	host.ParseAndEnrich(&req)
+	req.IaC.Resources = parser.ApplyParams(req.IaC.Resources, map[string]interface{}{"vm_size": "Standard_D2s_v3"}, protocol.FormatTerraform)
+
+	items, _ := estimateAll(req.IaC.Resources, tablePrice)
+	want := map[string]protocol.Confidence{
+		"linux_virtual_machine.literal":   protocol.ConfidenceHigh,
+		"linux_virtual_machine.variable":  protocol.ConfidenceMedium,
+		"linux_virtual_machine.defaulted": protocol.ConfidenceLow,
+	}
+	for _, it := range items {
+		if w, ok := want[it.Name]; ok && it.Confidence != w {
+			t.Errorf("%s confidence = %s, want %s", it.Name, it.Confidence, w)
+		}
+	}
+
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if combined := strings.Join(rec.Messages, ""); !strings.Contains(combined, "| Confidence |") || !strings.Contains(combined, "1 line item(s) rest on assumed defaults") {
+		t.Errorf("expected confidence column and note, got:\n%s", combined)
+	}
+}
+
+// baselineRecorder also keeps the reported cost baseline.
+type baselineRecorder struct {
+	prototest.Recorder
+	baseline *float64
+}
+
+func (r *baselineRecorder) ReportCostBaseline(_ string, monthly float64, _ string) {
+	r.baseline = &monthly
+}
+
+func TestAgent_TerraformPlan(t *testing.T) {
+	plan, err := os.ReadFile("../../internal/testkit/scenarios/storage-plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := protocol.AgentRequest{Prompt: "review this plan:\n```json\n" + string(plan) + "```"}
+	host.ParseAndEnrich(&req)
+	if req.IaC == nil || req.IaC.Format != protocol.FormatTerraformPlan {
+		t.Fatalf("IaC = %+v", req.IaC)
+	}
+	rec := &baselineRecorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if rec.baseline == nil || *rec.baseline <= 0 {
+		t.Error("expected the current state's cost to be reported as the baseline")
+	}
+	if strings.Contains(combined, "kubernetes_cluster.old") {
+		t.Error("destroyed resource should not be costed")
+	}
+	if !strings.Contains(combined, "Change vs current state: -$433.89") {
+		t.Errorf("expected cost change vs current state:\n%s", combined)
+	}
+}
+
+func TestAgent_DeploymentStageCosts(t *testing.T) {
+	a := New()
+	store := report.NewStore(0)
+	run := func(jobID, prompt string, meta map[string]string, code string) string {
+		t.Helper()
+		if meta == nil {
+			meta = map[string]string{}
+		}
+		meta[protocol.MetaJobID] = jobID
+		req := protocol.AgentRequest{
+			Messages: []protocol.Message{{Role: "user", Content: prompt + "\n```hcl\n" + code + "\n```"}},
+			Metadata: meta,
+		}
+		host.ParseAndEnrich(&req)
+		rec := &prototest.Recorder{}
+		emit, finish := store.Observe(a.ID(), req, rec)
+		err := a.Handle(context.Background(), req, emit)
+		finish(err)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(rec.Messages, "")
+	}
+
+	storage := `resource "azurerm_storage_account" "sa" {
+  account_replication_type = "%s"
+}`
+	run("job-1", "Estimate the monthly cost", map[string]string{protocol.MetaEnvironment: "prod", protocol.MetaVersion: "v1.2.0"},
+		strings.Replace(storage, "%s", "LRS", 1))
+	out := run("job-2", "Estimate v1.3.0 for production", nil,
+		strings.Replace(storage, "%s", "GRS", 1)+"\nresource \"azurerm_key_vault\" \"kv\" {\n}")
+	if !strings.Contains(out, "Environment: `prod` · Version: `v1.3.0`") {
+		t.Errorf("stage missing from header:\n%s", out)
+	}
+
+	change, err := store.CostChange("prod", "v1.3.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.PreviousVersion != "v1.2.0" || change.ReportID != "job-2" {
+		t.Errorf("compared against %s (%s), want v1.2.0", change.PreviousVersion, change.PreviousReportID)
+	}
+	// The key vault is new and GRS doubles the LRS storage estimate.
+	if len(change.Items) != 2 || change.Items[0].Name != "key_vault.kv" || change.Items[1].Delta < 1.83 || change.Items[1].Delta > 1.85 {
+		t.Errorf("items = %+v", change.Items)
+	}
+}
+
+func TestAgent_ModulesAndTFVars(t *testing.T) {
+	root := `variable "vm_size" {
+  default = "Standard_B1s"
+}
+
+module "app" {
+  source     = "./modules/app"
+  vm_size    = var.vm_size
+  node_count = 4
+}`
+	module := `variable "vm_size" {}
+variable "node_count" {
+  default = 1
+}
+
+resource "azurerm_kubernetes_cluster_node_pool" "pool" {
+  vm_size    = var.vm_size
+  node_count = var.node_count
+}`
+	file := func(id, content string) protocol.MessageReference {
+		ref := protocol.MessageReference{Type: "client.file", ID: id}
+		ref.Data.Content = content
+		return ref
+	}
+	req := protocol.AgentRequest{Messages: []protocol.Message{{
+		Role:    "user",
+		Content: "estimate cost:\n```hcl\n" + root + "\n```",
+		References: []protocol.MessageReference{
+			file("infra/prod.tfvars", `vm_size = "Standard_D8s_v3"`),
+			file("infra/modules/app/main.tf", module),
+		},
+	}}}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	// 4x Standard_D8s_v3 at $0.384/hour.
+	if !strings.Contains(combined, "kubernetes_cluster_node_pool.app.pool | 4x Standard_D8s_v3 | $1,121.28") {
+		t.Errorf("module inputs and tfvars not reflected:\n%s", combined)
+	}
+}
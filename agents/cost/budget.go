@@ -0,0 +1,88 @@
+package cost
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// BudgetRuleID is the finding reported when an estimate exceeds its
+// budget. Verdict policies map its severity (high) to an action, so the
+// orchestrator's verdict treats an overrun like any other blocking finding.
+const BudgetRuleID = "COST-001"
+
+var budgetPromptRe = regexp.MustCompile(`(?i)\bbudget\s*(?:of|is|:|=)?\s*[$€£¥]?\s*(\d[\d,]*(?:\.\d+)?)\s*(k)?\b`)
+
+// ParseBudget parses a monthly budget such as "500", "1,250.50" or "2k".
+// It must be positive.
+func ParseBudget(s string) (float64, error) {
+	num := strings.TrimSpace(strings.ReplaceAll(s, ",", ""))
+	mult := 1.0
+	if strings.HasSuffix(strings.ToLower(num), "k") {
+		num, mult = num[:len(num)-1], 1000
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid budget %q (want a positive monthly amount)", s)
+	}
+	return v * mult, nil
+}
+
+// WithBudget sets the monthly budget, in USD, estimates are checked
+// against when a request does not set one. Zero disables the check.
+func WithBudget(usd float64) Option {
+	return func(a *Agent) {
+		a.budget = usd
+	}
+}
+
+// requestBudget returns the budget for a request in the report currency m:
+// from its metadata (protocol.MetaBudget) or the prompt ("budget $500"),
+// both already in that currency, or else the agent's USD budget converted.
+// ok is false when no budget applies; an invalid metadata budget is an
+// error.
+func (a *Agent) requestBudget(req protocol.AgentRequest, m money) (budget float64, ok bool, err error) {
+	if s := req.Metadata[protocol.MetaBudget]; s != "" {
+		b, err := ParseBudget(s)
+		return b, err == nil, err
+	}
+	if match := budgetPromptRe.FindStringSubmatch(protocol.PromptText(req)); match != nil {
+		if b, err := ParseBudget(match[1] + match[2]); err == nil {
+			return b, true, nil
+		}
+	}
+	if a.budget > 0 {
+		return m.convert(a.budget), true, nil
+	}
+	return 0, false, nil
+}
+
+// budgetCheck renders the pass/fail verdict for total against budget and
+// reports it as findings: none when within budget, a BudgetRuleID finding
+// when over. Estimates resting on assumed defaults yield a low-confidence
+// finding, which verdict policies may treat more leniently.
+func budgetCheck(emit protocol.Emitter, agentID string, total, budget float64, m money, lowConfidence bool) {
+	emit.SendMessage("### Budget\n\n")
+	if total <= budget {
+		emit.SendMessage(fmt.Sprintf("✅ **Pass** — estimate %s is within budget %s (%s used).\n\n", m.format(total), m.format(budget), m.percent(total/budget*100, 0)))
+		protocol.ReportFindings(emit, agentID, nil)
+		return
+	}
+	f := protocol.Finding{
+		RuleID:       BudgetRuleID,
+		Category:     "Cost",
+		Severity:     protocol.SeverityHigh,
+		Resource:     "total",
+		ResourceType: "budget",
+		Message:      fmt.Sprintf("estimate %s exceeds budget %s", m.format(total), m.format(budget)),
+		Remediation:  fmt.Sprintf("Reduce the monthly cost by %s or raise the budget", m.format(total-budget)),
+	}
+	if lowConfidence {
+		f.Confidence = protocol.ConfidenceLow
+	}
+	emit.SendMessage(fmt.Sprintf("❌ **Fail** — %s (over by %s).\n\n", f.Message, m.format(total-budget)))
+	protocol.ReportFindings(emit, agentID, []protocol.Finding{f})
+}
@@ -0,0 +1,88 @@
+package cost
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+)
+
+// findingRecorder also keeps reported findings.
+type findingRecorder struct {
+	prototest.Recorder
+	reported bool
+	findings []protocol.Finding
+}
+
+func (r *findingRecorder) ReportFindings(_ string, findings []protocol.Finding) {
+	r.reported = true
+	r.findings = append(r.findings, findings...)
+}
+
+func TestParseBudget(t *testing.T) {
+	for in, want := range map[string]float64{"500": 500, "1,250.50": 1250.5, "2k": 2000, " 3K ": 3000} {
+		if got, err := ParseBudget(in); err != nil || got != want {
+			t.Errorf("ParseBudget(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "0", "-5", "lots"} {
+		if _, err := ParseBudget(bad); err == nil {
+			t.Errorf("ParseBudget(%q) should fail", bad)
+		}
+	}
+}
+
+func TestAgent_Budget(t *testing.T) {
+	code := `resource "azurerm_linux_virtual_machine" "app" {
+  name     = "vm-app"
+  location = "eastus"
+  size     = "Standard_D2s_v3"
+}`
+	run := func(a *Agent, prompt string, meta map[string]string) (string, *findingRecorder) {
+		t.Helper()
+		req := protocol.AgentRequest{
+			Messages: []protocol.Message{{Role: "user", Content: prompt + "\n```hcl\n" + code + "\n```"}},
+			Metadata: meta,
+		}
+		host.ParseAndEnrich(&req)
+		rec := &findingRecorder{}
+		if err := a.Handle(context.Background(), req, rec); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(rec.Messages, ""), rec
+	}
+
+	out, rec := run(New(), "estimate cost", nil)
+	if strings.Contains(out, "### Budget") || rec.reported {
+		t.Errorf("no budget should mean no verdict:\n%s", out)
+	}
+
+	out, rec = run(New(WithBudget(500)), "estimate cost", nil)
+	if !strings.Contains(out, "✅ **Pass** — estimate $70.08 is within budget $500.00 (14% used).") {
+		t.Errorf("expected a pass against the configured budget:\n%s", out)
+	}
+	if !rec.reported || len(rec.findings) != 0 {
+		t.Errorf("a pass should report no findings, got reported=%v %+v", rec.reported, rec.findings)
+	}
+
+	out, rec = run(New(WithBudget(500)), "estimate cost", map[string]string{protocol.MetaBudget: "50"})
+	if !strings.Contains(out, "❌ **Fail** — estimate $70.08 exceeds budget $50.00 (over by $20.08).") {
+		t.Errorf("expected the request budget to override:\n%s", out)
+	}
+	if len(rec.findings) != 1 || rec.findings[0].RuleID != BudgetRuleID || rec.findings[0].Severity != protocol.SeverityHigh {
+		t.Errorf("findings = %+v", rec.findings)
+	}
+
+	out, _ = run(New(), "estimate cost with a budget of $60", nil)
+	if !strings.Contains(out, "exceeds budget $60.00") {
+		t.Errorf("expected the budget from the prompt:\n%s", out)
+	}
+
+	out, _ = run(New(), "estimate cost", map[string]string{protocol.MetaBudget: "plenty"})
+	if !strings.Contains(out, `invalid budget "plenty"`) || strings.Contains(out, "Estimated Monthly Cost") {
+		t.Errorf("expected an error for an invalid budget:\n%s", out)
+	}
+}
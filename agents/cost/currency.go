@@ -0,0 +1,144 @@
+package cost
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// CurrencyUSD is the currency of the static price tables.
+const CurrencyUSD = "USD"
+
+// currencySymbols lists the currencies the Retail Prices API quotes, with
+// the symbol amounts are written with ("" writes the code).
+var currencySymbols = map[string]string{
+	"USD": "$", "EUR": "€", "GBP": "£", "JPY": "¥", "INR": "₹", "KRW": "₩",
+	"AUD": "A$", "CAD": "C$", "NZD": "NZ$", "BRL": "R$", "TWD": "NT$",
+	"CHF": "", "CNY": "", "DKK": "", "NOK": "", "SEK": "", "RUB": "",
+}
+
+// zeroDecimalCurrencies have no minor unit.
+var zeroDecimalCurrencies = map[string]bool{"JPY": true, "KRW": true}
+
+// rateReferenceKey is the meter whose price in USD and in another currency
+// gives the exchange rate the API applies.
+var rateReferenceKey = PriceKey{SKU: "Standard_D2s_v3", Region: "eastus", PriceType: PriceTypeConsumption}
+
+var currencyPromptRe = regexp.MustCompile(`(?i)\b(?:in|to)\s+([a-z]{3})\b`)
+
+// supportedCurrencies returns the codes ParseCurrency accepts, sorted.
+func supportedCurrencies() []string {
+	codes := make([]string, 0, len(currencySymbols))
+	for c := range currencySymbols {
+		codes = append(codes, c)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// ParseCurrency validates an ISO 4217 code the Retail Prices API supports,
+// returning it upper-cased. An empty code is USD.
+func ParseCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return CurrencyUSD, nil
+	}
+	if _, ok := currencySymbols[code]; !ok {
+		return "", fmt.Errorf("unsupported currency %q", code)
+	}
+	return code, nil
+}
+
+// money converts USD amounts into a currency and formats them in a locale
+// (DefaultLocale when empty).
+type money struct {
+	currency string
+	rate     float64
+	locale   string
+}
+
+var usd = money{currency: CurrencyUSD, rate: 1}
+
+func (m money) convert(amount float64) float64 { return amount * m.rate }
+
+// format writes an amount already in m's currency, with the currency's
+// minor unit and the locale's separators and symbol placement: "$1,234.50",
+// "¥1,500", "CHF 12.00", "-$80.00" in en-US; "1.234,50 €" in de-DE.
+func (m money) format(amount float64) string {
+	if amount < 0 {
+		return "-" + m.format(-amount)
+	}
+	decimals := 2
+	if zeroDecimalCurrencies[m.currency] {
+		decimals = 0
+	}
+	f := formatFor(m.locale)
+	s := f.number(amount, decimals)
+	sym := currencySymbols[m.currency]
+	switch {
+	case sym == "" && f.symbolAfter:
+		return s + " " + m.currency
+	case sym == "":
+		return m.currency + " " + s
+	case f.symbolAfter:
+		return s + " " + sym
+	case f.spaced:
+		return sym + " " + s
+	}
+	return sym + s
+}
+
+// FormatAmount writes an amount in currency the way estimates do, in
+// DefaultLocale: "$1,234.50", "¥1,500", "CHF 12.00".
+func FormatAmount(amount float64, currency string) string {
+	return money{currency: currency}.format(amount)
+}
+
+// percent writes a percentage with the locale's decimal separator.
+func (m money) percent(p float64, decimals int) string {
+	return formatFor(m.locale).number(p, decimals) + "%"
+}
+
+// requestCurrency returns the currency a request asks for, from its
+// metadata (protocol.MetaCurrency) or the prompt ("estimate in EUR"),
+// defaulting to the agent's. A code in the metadata that is not supported
+// is returned as an error.
+func (a *Agent) requestCurrency(req protocol.AgentRequest) (string, error) {
+	if code := req.Metadata[protocol.MetaCurrency]; code != "" {
+		return ParseCurrency(code)
+	}
+	for _, m := range currencyPromptRe.FindAllStringSubmatch(protocol.PromptText(req), -1) {
+		if code, err := ParseCurrency(m[1]); err == nil {
+			return code, nil
+		}
+	}
+	return a.currency, nil
+}
+
+// money returns how to report amounts in currency and locale: at the rate the Retail
+// Prices API applies to it, through the price cache. ok is false when the
+// rate is unavailable, and amounts stay in USD.
+func (a *Agent) money(ctx context.Context, currency, locale string) (m money, ok bool) {
+	fallback := money{currency: CurrencyUSD, rate: 1, locale: locale}
+	if currency == CurrencyUSD {
+		return fallback, true
+	}
+	if a.prices == nil {
+		return fallback, false
+	}
+	base, ok := a.prices.Lookup(ctx, rateReferenceKey)
+	if !ok || base == 0 {
+		return fallback, false
+	}
+	key := rateReferenceKey
+	key.Currency = currency
+	local, ok := a.prices.Lookup(ctx, key)
+	if !ok {
+		return fallback, false
+	}
+	return money{currency: currency, rate: local / base, locale: locale}, true
+}
@@ -0,0 +1,122 @@
+package cost
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+)
+
+func TestParseCurrency(t *testing.T) {
+	for in, want := range map[string]string{"": "USD", "eur": "EUR", " GBP ": "GBP", "JPY": "JPY"} {
+		if got, err := ParseCurrency(in); err != nil || got != want {
+			t.Errorf("ParseCurrency(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseCurrency("XYZ"); err == nil {
+		t.Error("expected an error for an unsupported currency")
+	}
+}
+
+func TestParseLocale(t *testing.T) {
+	for in, want := range map[string]string{"": "en-US", "de_de": "de-DE", "FR": "fr", "en-gb": "en-GB", "pt-BR": "pt-BR"} {
+		if got, err := ParseLocale(in); err != nil || got != want {
+			t.Errorf("ParseLocale(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseLocale("xx-YY"); err == nil {
+		t.Error("expected an error for an unsupported locale")
+	}
+}
+
+func TestMoney_Format(t *testing.T) {
+	tests := []struct {
+		m      money
+		amount float64
+		want   string
+	}{
+		{usd, 1121.28, "$1,121.28"},
+		{usd, -1234567.891, "-$1,234,567.89"},
+		{money{currency: "EUR"}, 12, "€12.00"},
+		{money{currency: "JPY"}, 1499.6, "¥1,500"},
+		{money{currency: "CHF"}, 3.5, "CHF 3.50"},
+		{money{currency: "EUR", locale: "de-DE"}, 1234.5, "1.234,50 €"},
+		{money{currency: "CHF", locale: "de-CH"}, 1234.5, "CHF 1’234.50"},
+		{money{currency: "SEK", locale: "sv-SE"}, 1234.5, "1\u00a0234,50 SEK"},
+		{money{currency: "BRL", locale: "pt-BR"}, 999.999, "R$ 1.000,00"},
+		{money{currency: "USD", locale: "fr"}, 80, "80,00 $"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.format(tt.amount); got != tt.want {
+			t.Errorf("format(%v) in %s = %q, want %q", tt.amount, tt.m.currency, got, tt.want)
+		}
+	}
+	if got := FormatAmount(1499.6, "JPY"); got != "¥1,500" {
+		t.Errorf("FormatAmount = %q", got)
+	}
+}
+
+func TestAgent_Currency(t *testing.T) {
+	rates := map[string]float64{"": 0.096, "EUR": 0.0864, "JPY": 14.4}
+	prices, err := NewPriceCache(func(_ context.Context, key PriceKey) (float64, error) {
+		if key.SKU != rateReferenceKey.SKU {
+			return 0, ErrPriceNotFound
+		}
+		return rates[key.Currency], nil
+	}, time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := `resource "azurerm_container_registry" "acr" {
+  sku = "Premium"
+}`
+	run := func(a *Agent, prompt string, meta map[string]string) string {
+		t.Helper()
+		req := protocol.AgentRequest{
+			Messages: []protocol.Message{{Role: "user", Content: prompt + "\n```hcl\n" + code + "\n```"}},
+			Metadata: meta,
+		}
+		host.ParseAndEnrich(&req)
+		rec := &prototest.Recorder{}
+		if err := a.Handle(context.Background(), req, rec); err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(rec.Messages, "")
+	}
+
+	out := run(New(WithPriceCache(prices)), "estimate", map[string]string{protocol.MetaCurrency: "eur"})
+	for _, want := range []string{"**€45.00**", "| Resource | SKU | Monthly (EUR) | Confidence |", "| container_registry.acr | Premium | €45.00 | high |"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("EUR output missing %q:\n%s", want, out)
+		}
+	}
+
+	out = run(New(WithPriceCache(prices), WithCurrency("EUR")), "estimate this in JPY", nil)
+	if !strings.Contains(out, "| container_registry.acr | Premium | ¥7,500 | high |") {
+		t.Errorf("prompt currency should override the default:\n%s", out)
+	}
+
+	out = run(New(WithPriceCache(prices), WithLocale("fr-FR")), "estimate", map[string]string{protocol.MetaCurrency: "EUR", protocol.MetaLocale: "de-DE"})
+	if !strings.Contains(out, "| container_registry.acr | Premium | 45,00 € | high |") {
+		t.Errorf("request locale should format amounts:\n%s", out)
+	}
+
+	out = run(New(), "estimate in GBP", nil)
+	if !strings.Contains(out, "GBP exchange rate unavailable; amounts are in USD") || !strings.Contains(out, "| $50.00 |") {
+		t.Errorf("without rates amounts should stay in USD:\n%s", out)
+	}
+
+	out = run(New(WithPriceCache(prices)), "estimate", map[string]string{protocol.MetaCurrency: "XYZ"})
+	if !strings.Contains(out, `unsupported currency "XYZ"`) {
+		t.Errorf("expected an unsupported currency error:\n%s", out)
+	}
+
+	out = run(New(), "estimate", map[string]string{protocol.MetaLocale: "xx"})
+	if !strings.Contains(out, `unsupported locale "xx"`) {
+		t.Errorf("expected an unsupported locale error:\n%s", out)
+	}
+}
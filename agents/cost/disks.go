@@ -0,0 +1,232 @@
+package cost
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// diskTier is a managed disk size tier: disks are billed at the smallest
+// tier they fit in, whatever size they are provisioned at.
+type diskTier struct {
+	name    string
+	maxGB   float64
+	monthly float64
+}
+
+// Managed disk tiers per month (USD, East US) by storage_account_type.
+var diskTiers = map[string][]diskTier{
+	"Premium_LRS": {
+		{"P1", 4, 0.60}, {"P2", 8, 1.20}, {"P3", 16, 2.40}, {"P4", 32, 5.28},
+		{"P6", 64, 10.21}, {"P10", 128, 19.71}, {"P15", 256, 38.01}, {"P20", 512, 73.22},
+		{"P30", 1024, 135.17}, {"P40", 2048, 259.05}, {"P50", 4096, 495.57},
+		{"P60", 8192, 946.08}, {"P70", 16384, 1802.12}, {"P80", 32767, 3604.25},
+	},
+	"StandardSSD_LRS": {
+		{"E1", 4, 0.30}, {"E2", 8, 0.60}, {"E3", 16, 1.20}, {"E4", 32, 2.40},
+		{"E6", 64, 4.80}, {"E10", 128, 9.60}, {"E15", 256, 19.20}, {"E20", 512, 38.40},
+		{"E30", 1024, 76.80}, {"E40", 2048, 153.60}, {"E50", 4096, 307.20},
+		{"E60", 8192, 614.40}, {"E70", 16384, 1228.80}, {"E80", 32767, 2457.60},
+	},
+	"Standard_LRS": {
+		{"S4", 32, 1.54}, {"S6", 64, 3.01}, {"S10", 128, 5.89}, {"S15", 256, 11.33},
+		{"S20", 512, 21.76}, {"S30", 1024, 40.96}, {"S40", 2048, 77.83},
+		{"S50", 4096, 147.46}, {"S60", 8192, 294.91}, {"S70", 16384, 589.82},
+		{"S80", 32767, 1179.65},
+	},
+}
+
+// Zone-redundant disks cost a fixed premium over the same LRS tier.
+var diskZRSPremium = map[string]struct {
+	lrs        string
+	multiplier float64
+}{
+	"Premium_ZRS":     {"Premium_LRS", 1.5},
+	"StandardSSD_ZRS": {"StandardSSD_LRS", 1.25},
+}
+
+// Disks billed per provisioned GB-month. Only capacity is priced: IOPS and
+// throughput above the included baseline are not modeled, which caps these
+// estimates at medium confidence.
+var diskPerGBPrices = map[string]float64{
+	"PremiumV2_LRS": 0.0812,
+	"UltraSSD_LRS":  0.1200,
+}
+
+const (
+	// OS disks without disk_size_gb take the size of the image: 30 GB for
+	// marketplace Linux images, 127 GB for Windows.
+	linuxOSDiskGB   = 30
+	windowsOSDiskGB = 127
+	// Disk size assumed when none is declared on a data disk.
+	defaultDataDiskGB = 32
+	// Disks with an unknown storage type are priced as Premium SSD.
+	fallbackDiskType = "Premium_LRS"
+)
+
+// priceDisk returns the billed SKU and monthly price of a managed disk;
+// priced is false when the storage type is unknown and the fallback was used.
+func priceDisk(storageType string, sizeGB float64) (sku string, monthly float64, priced bool) {
+	if perGB, ok := diskPerGBPrices[storageType]; ok {
+		return fmt.Sprintf("%s %.0f GB", storageType, sizeGB), perGB * sizeGB, true
+	}
+	lrs, multiplier, priced := storageType, 1.0, true
+	if zrs, ok := diskZRSPremium[storageType]; ok {
+		lrs, multiplier = zrs.lrs, zrs.multiplier
+	}
+	tiers, ok := diskTiers[lrs]
+	if !ok {
+		storageType, tiers, priced = fallbackDiskType, diskTiers[fallbackDiskType], false
+	}
+	tier := tiers[len(tiers)-1]
+	for _, t := range tiers {
+		if sizeGB <= t.maxGB {
+			tier = t
+			break
+		}
+	}
+	return fmt.Sprintf("%s %s", storageType, tier.name), tier.monthly * multiplier, priced
+}
+
+// diskSpec is a managed disk declared on a VM or on its own.
+type diskSpec struct {
+	label   string
+	block   map[string]interface{}
+	typeKey string
+	sizeKey string
+	// src and prefix locate the block's values for protocol.ValueConfidence:
+	// the resource itself for blocks at a fixed path, so that values
+	// resolved from variables count as medium, or the block alone for
+	// list entries.
+	src    protocol.Resource
+	prefix string
+	// defaultGB is assumed when no size is declared. OS disks default to
+	// their image size, a well-known value, so a missing size lowers their
+	// confidence only to medium.
+	defaultGB float64
+	os        bool
+}
+
+// estimate prices the disk. Confidence comes from the disk's own values.
+func (d diskSpec) estimate() (string, float64, protocol.Confidence) {
+	storageType, _ := d.block[d.typeKey].(string)
+	sizeGB, hasSize := numberProp(d.block, d.sizeKey)
+	if !hasSize || sizeGB <= 0 {
+		sizeGB = d.defaultGB
+	}
+	sku, monthly, priced := priceDisk(storageType, sizeGB)
+
+	sizeConf := protocol.ValueConfidence(d.src, d.prefix+d.sizeKey)
+	if !hasSize && d.os {
+		sizeConf = protocol.ConfidenceMedium
+	}
+	conf := protocol.LeastConfident(protocol.ValueConfidence(d.src, d.prefix+d.typeKey), sizeConf)
+	switch {
+	case !priced:
+		conf = protocol.ConfidenceLow
+	case diskPerGBPrices[storageType] != 0:
+		conf = protocol.LeastConfident(conf, protocol.ConfidenceMedium)
+	}
+	return sku, monthly, conf
+}
+
+// blockDisk is a disk read from a nested block of res at key.
+func blockDisk(res protocol.Resource, label, key, typeKey string, defaultGB float64) (diskSpec, bool) {
+	b, ok := res.Properties[key].(map[string]interface{})
+	return diskSpec{label: label, block: b, typeKey: typeKey, sizeKey: "disk_size_gb", src: res, prefix: key + ".", defaultGB: defaultGB, os: true}, ok
+}
+
+// listDisk is a disk read from a block on its own, such as one entry of a
+// list of blocks.
+func listDisk(label string, b map[string]interface{}, typeKey, sizeKey string, defaultGB float64, os bool) diskSpec {
+	return diskSpec{label: label, block: b, typeKey: typeKey, sizeKey: sizeKey, src: protocol.Resource{Properties: b}, defaultGB: defaultGB, os: os}
+}
+
+// vmDisks returns the managed disks declared on a VM: os_disk on the
+// azurerm_linux/windows_virtual_machine resources, storage_os_disk and
+// storage_data_disk on the legacy azurerm_virtual_machine, and
+// storageProfile on Bicep VMs. Disks attached as separate
+// azurerm_managed_disk resources are priced with those resources.
+func vmDisks(res protocol.Resource) []diskSpec {
+	osGB := float64(linuxOSDiskGB)
+	if vmIsWindows(res) {
+		osGB = windowsOSDiskGB
+	}
+
+	var disks []diskSpec
+	if d, ok := blockDisk(res, "OS disk", "os_disk", "storage_account_type", osGB); ok {
+		disks = append(disks, d)
+	}
+	if d, ok := blockDisk(res, "OS disk", "storage_os_disk", "managed_disk_type", osGB); ok {
+		disks = append(disks, d)
+	}
+	for i, b := range blocks(res.Properties, "storage_data_disk") {
+		disks = append(disks, listDisk(fmt.Sprintf("data disk %d", i+1), b, "managed_disk_type", "disk_size_gb", defaultDataDiskGB, false))
+	}
+
+	profile, _ := res.Properties["storageProfile"].(map[string]interface{})
+	if b, ok := profile["osDisk"].(map[string]interface{}); ok {
+		disks = append(disks, listDisk("OS disk", bicepDisk(b), "storageAccountType", "diskSizeGB", osGB, true))
+	}
+	for i, b := range blocks(profile, "dataDisks") {
+		disks = append(disks, listDisk(fmt.Sprintf("data disk %d", i+1), bicepDisk(b), "storageAccountType", "diskSizeGB", defaultDataDiskGB, false))
+	}
+	return disks
+}
+
+// bicepDisk flattens a Bicep disk, whose storage type is nested in
+// managedDisk.
+func bicepDisk(b map[string]interface{}) map[string]interface{} {
+	flat := map[string]interface{}{}
+	if size, ok := b["diskSizeGB"]; ok {
+		flat["diskSizeGB"] = size
+	}
+	if md, ok := b["managedDisk"].(map[string]interface{}); ok {
+		if t, ok := md["storageAccountType"]; ok {
+			flat["storageAccountType"] = t
+		}
+	}
+	return flat
+}
+
+func vmIsWindows(res protocol.Resource) bool {
+	if res.Type == "azurerm_windows_virtual_machine" {
+		return true
+	}
+	if _, ok := res.Properties["os_profile_windows_config"]; ok {
+		return true
+	}
+	profile, _ := res.Properties["storageProfile"].(map[string]interface{})
+	osDisk, _ := profile["osDisk"].(map[string]interface{})
+	osType, _ := osDisk["osType"].(string)
+	return strings.EqualFold(osType, "Windows")
+}
+
+// diskExtras lists each disk of a VM as its own line item.
+func diskExtras(res protocol.Resource) []extraCost {
+	var extras []extraCost
+	for _, d := range vmDisks(res) {
+		sku, monthly, conf := d.estimate()
+		extras = append(extras, extraCost{label: d.label, sku: sku, monthly: monthly, confidence: conf})
+	}
+	return extras
+}
+
+// estimateManagedDisk prices an azurerm_managed_disk, or a Bicep
+// Microsoft.Compute/disks whose storage type is sku.name.
+func estimateManagedDisk(res protocol.Resource) estimate {
+	d := diskSpec{block: res.Properties, typeKey: "storage_account_type", sizeKey: "disk_size_gb", src: res, defaultGB: defaultDataDiskGB}
+	if sku, ok := res.Properties["sku"].(map[string]interface{}); ok {
+		flat := map[string]interface{}{}
+		if size, ok := res.Properties["diskSizeGB"]; ok {
+			flat["diskSizeGB"] = size
+		}
+		if t, ok := sku["name"]; ok {
+			flat["storageAccountType"] = t
+		}
+		d = listDisk("", flat, "storageAccountType", "diskSizeGB", defaultDataDiskGB, false)
+	}
+	sku, monthly, conf := d.estimate()
+	return estimate{sku: sku, monthly: monthly, confidence: conf}
+}
@@ -0,0 +1,162 @@
+package cost
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+)
+
+func TestPriceDisk(t *testing.T) {
+	tests := []struct {
+		storageType string
+		sizeGB      float64
+		sku         string
+		monthly     float64
+		priced      bool
+	}{
+		{"Premium_LRS", 30, "Premium_LRS P4", 5.28, true},
+		{"Premium_LRS", 100, "Premium_LRS P10", 19.71, true},
+		{"StandardSSD_LRS", 127, "StandardSSD_LRS E10", 9.60, true},
+		{"Standard_LRS", 1024, "Standard_LRS S30", 40.96, true},
+		{"Premium_ZRS", 128, "Premium_ZRS P10", 29.565, true},
+		{"PremiumV2_LRS", 100, "PremiumV2_LRS 100 GB", 8.12, true},
+		{"var.disk_type", 64, "Premium_LRS P6", 10.21, false},
+	}
+	for _, tt := range tests {
+		sku, monthly, priced := priceDisk(tt.storageType, tt.sizeGB)
+		if sku != tt.sku || math.Abs(monthly-tt.monthly) > 0.001 || priced != tt.priced {
+			t.Errorf("priceDisk(%s, %.0f) = %q $%.3f %v, want %q $%.3f %v", tt.storageType, tt.sizeGB, sku, monthly, priced, tt.sku, tt.monthly, tt.priced)
+		}
+	}
+}
+
+func TestEstimateAll_Disks(t *testing.T) {
+	tfCode := `resource "azurerm_linux_virtual_machine" "app" {
+  size = "Standard_D2s_v3"
+  os_disk {
+    caching              = "ReadWrite"
+    storage_account_type = "Premium_LRS"
+  }
+}
+
+resource "azurerm_windows_virtual_machine" "win" {
+  size = "Standard_D2s_v3"
+  os_disk {
+    storage_account_type = "StandardSSD_LRS"
+    disk_size_gb         = 256
+  }
+}
+
+resource "azurerm_virtual_machine" "legacy" {
+  vm_size = "Standard_D2s_v3"
+  storage_os_disk {
+    managed_disk_type = "Standard_LRS"
+  }
+  storage_data_disk {
+    managed_disk_type = "Premium_LRS"
+    disk_size_gb      = 512
+  }
+  storage_data_disk {
+    managed_disk_type = "Premium_LRS"
+    disk_size_gb      = 1024
+  }
+}
+
+resource "azurerm_managed_disk" "data" {
+  storage_account_type = "StandardSSD_LRS"
+  disk_size_gb         = var.data_disk_gb
+}`
+	resources := parser.ParseResources(tfCode)
+	resources = parser.ApplyParams(resources, map[string]interface{}{"data_disk_gb": 64}, protocol.FormatTerraform)
+
+	items, _ := estimateAll(resources, tablePrice)
+	type line struct {
+		sku        string
+		monthly    float64
+		confidence protocol.Confidence
+	}
+	want := map[string]line{
+		"linux_virtual_machine.app (OS disk)":   {"Premium_LRS P4", 5.28, protocol.ConfidenceMedium},
+		"windows_virtual_machine.win (OS disk)": {"StandardSSD_LRS E15", 19.20, protocol.ConfidenceHigh},
+		"virtual_machine.legacy (OS disk)":      {"Standard_LRS S4", 1.54, protocol.ConfidenceMedium},
+		"virtual_machine.legacy (data disk 1)":  {"Premium_LRS P20", 73.22, protocol.ConfidenceHigh},
+		"virtual_machine.legacy (data disk 2)":  {"Premium_LRS P30", 135.17, protocol.ConfidenceHigh},
+		"managed_disk.data":                     {"StandardSSD_LRS E6", 4.80, protocol.ConfidenceMedium},
+		"linux_virtual_machine.app":             {"Standard_D2s_v3", 70.08, protocol.ConfidenceHigh},
+		"virtual_machine.legacy":                {"Standard_D2s_v3", 70.08, protocol.ConfidenceHigh},
+		"windows_virtual_machine.win":           {"Standard_D2s_v3", 105.12, protocol.ConfidenceHigh},
+	}
+	got := make(map[string]line, len(items))
+	for _, it := range items {
+		got[it.Name] = line{it.SKU, it.Monthly, it.Confidence}
+	}
+	for name, w := range want {
+		g, ok := got[name]
+		if !ok {
+			t.Errorf("missing line item %s", name)
+			continue
+		}
+		if g.sku != w.sku || math.Abs(g.monthly-w.monthly) > 0.01 || g.confidence != w.confidence {
+			t.Errorf("%s = %q $%.2f (%s), want %q $%.2f (%s)", name, g.sku, g.monthly, g.confidence, w.sku, w.monthly, w.confidence)
+		}
+	}
+	if len(items) != len(want) {
+		t.Errorf("got %d line items, want %d: %+v", len(items), len(want), items)
+	}
+}
+
+func TestAgent_BicepDisks(t *testing.T) {
+	code := `resource vm 'Microsoft.Compute/virtualMachines@2023-03-01' = {
+  name: 'vm'
+  properties: {
+    storageProfile: {
+      osDisk: {
+        osType: 'Windows'
+        managedDisk: {
+          storageAccountType: 'Premium_LRS'
+        }
+      }
+      dataDisks: [
+        {
+          diskSizeGB: 256
+          managedDisk: {
+            storageAccountType: 'StandardSSD_LRS'
+          }
+        }
+      ]
+    }
+  }
+}
+
+resource disk 'Microsoft.Compute/disks@2023-01-02' = {
+  name: 'logs'
+  sku: {
+    name: 'Standard_LRS'
+  }
+  properties: {
+    diskSizeGB: 1024
+  }
+}`
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "estimate cost:\n```bicep\n" + code + "\n```"}}}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"| virtual_machine.vm (OS disk) | Premium_LRS P10 | $19.71 | medium |",
+		"| virtual_machine.vm (data disk 1) | StandardSSD_LRS E15 | $19.20 | high |",
+		"| managed_disk.disk | Standard_LRS S30 | $40.96 | high |",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
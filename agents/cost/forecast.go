@@ -0,0 +1,184 @@
+package cost
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/repo"
+)
+
+// FetchFunc downloads the IaC files for a repository branch.
+type FetchFunc func(ctx context.Context, ref repo.Ref) ([]protocol.SourceFile, error)
+
+// NotifyFunc delivers a digest with the given title and markdown body.
+type NotifyFunc func(ctx context.Context, title, text string) error
+
+// Forecaster produces a periodic cost digest for a set of repositories.
+// It keeps the totals from its previous run so each digest can show the
+// week-over-week change.
+type Forecaster struct {
+	refs      []repo.Ref
+	fetch     FetchFunc
+	notify    NotifyFunc
+	reportURL string
+	locale    string
+	now       func() time.Time
+
+	mu       sync.Mutex
+	previous map[string]float64
+}
+
+// ForecastOption configures a Forecaster.
+type ForecastOption func(*Forecaster)
+
+// WithForecastLocale sets the locale the digest writes amounts in, e.g.
+// "de-DE". tag must be valid for ParseLocale.
+func WithForecastLocale(tag string) ForecastOption {
+	return func(f *Forecaster) {
+		if l, err := ParseLocale(tag); err == nil {
+			f.locale = l
+		}
+	}
+}
+
+// NewForecaster creates a Forecaster. reportURL, when set, is used to link
+// each repository row to its full cost report.
+func NewForecaster(refs []repo.Ref, fetch FetchFunc, notify NotifyFunc, reportURL string, opts ...ForecastOption) *Forecaster {
+	f := &Forecaster{
+		refs:      refs,
+		fetch:     fetch,
+		notify:    notify,
+		reportURL: strings.TrimSuffix(reportURL, "/"),
+		locale:    DefaultLocale,
+		now:       time.Now,
+		previous:  make(map[string]float64),
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// RepoForecast is the estimate for one repository branch.
+type RepoForecast struct {
+	Ref       repo.Ref
+	Resources int
+	Monthly   float64
+	Previous  float64
+	HasPrior  bool
+	Err       error
+}
+
+// Delta returns the change since the previous run.
+func (f RepoForecast) Delta() float64 {
+	return f.Monthly - f.Previous
+}
+
+// Run estimates every configured repository, sends the digest, and records
+// the totals for the next run. It is suitable as a scheduler job.
+func (f *Forecaster) Run(ctx context.Context) {
+	results := f.Estimate(ctx)
+	title := fmt.Sprintf("Weekly IaC cost forecast — %s", f.now().UTC().Format("2006-01-02"))
+	if err := f.notify(ctx, title, f.Digest(results)); err != nil {
+		log.Printf("cost forecast: send digest: %v", err)
+	}
+}
+
+// Estimate fetches and prices each repository, comparing against the
+// previous run. Successful totals replace the stored baseline.
+func (f *Forecaster) Estimate(ctx context.Context) []RepoForecast {
+	results := make([]RepoForecast, 0, len(f.refs))
+	for _, ref := range f.refs {
+		r := RepoForecast{Ref: ref}
+		files, err := f.fetch(ctx, ref)
+		if err != nil {
+			r.Err = err
+			results = append(results, r)
+			continue
+		}
+		var resources []protocol.Resource
+		for _, file := range files {
+			resources = append(resources, parser.ParseResources(file.Content)...)
+		}
+		_, r.Monthly = estimateAll(resources, tablePrice)
+		r.Resources = len(resources)
+		results = append(results, r)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range results {
+		key := results[i].Ref.String()
+		results[i].Previous, results[i].HasPrior = f.previous[key]
+		if results[i].Err == nil {
+			f.previous[key] = results[i].Monthly
+		}
+	}
+	return results
+}
+
+// Digest renders the results as a markdown table. Amounts are in USD, so
+// exchange rate moves don't show up as cost changes.
+func (f *Forecaster) Digest(results []RepoForecast) string {
+	m := money{currency: CurrencyUSD, rate: 1, locale: f.locale}
+	var sb strings.Builder
+	var total, prior float64
+	sb.WriteString("| Repository | Resources | This Week | Last Week | Change |")
+	if f.reportURL != "" {
+		sb.WriteString(" Report |")
+	}
+	sb.WriteString("\n|------------|-----------|-----------|-----------|--------|")
+	if f.reportURL != "" {
+		sb.WriteString("--------|")
+	}
+	sb.WriteString("\n")
+
+	for _, r := range results {
+		if r.Err != nil {
+			sb.WriteString(fmt.Sprintf("| %s | — | _error: %v_ | — | — |", r.Ref, r.Err))
+		} else {
+			last, change := "—", "new"
+			if r.HasPrior {
+				last = m.format(r.Previous)
+				change = formatDelta(r.Delta(), r.Previous, m)
+				prior += r.Previous
+			}
+			total += r.Monthly
+			sb.WriteString(fmt.Sprintf("| %s | %d | %s | %s | %s |", r.Ref, r.Resources, m.format(r.Monthly), last, change))
+		}
+		if f.reportURL != "" {
+			sb.WriteString(fmt.Sprintf(" [view](%s) |", f.reportLink(r.Ref)))
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString(fmt.Sprintf("\n**Total estimated monthly cost: %s**", m.format(total)))
+	if prior > 0 {
+		sb.WriteString(fmt.Sprintf(" (%s vs last week)", formatDelta(total-prior, prior, m)))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+func (f *Forecaster) reportLink(ref repo.Ref) string {
+	return f.reportURL + "?repo=" + url.QueryEscape(ref.String())
+}
+
+func formatDelta(delta, base float64, m money) string {
+	sign := "+"
+	if delta < 0 {
+		sign = "-"
+		delta = -delta
+	}
+	if base == 0 {
+		return sign + m.format(delta)
+	}
+	return fmt.Sprintf("%s%s (%s%s)", sign, m.format(delta), sign, m.percent(delta/base*100, 1))
+}
@@ -0,0 +1,76 @@
+package cost
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/repo"
+)
+
+func TestForecaster_WeekOverWeek(t *testing.T) {
+	acr := `resource "azurerm_container_registry" "acr" {
+  sku = "Basic"
+}`
+	files := map[string]string{"org/infra@main": acr}
+	fetch := func(_ context.Context, ref repo.Ref) ([]protocol.SourceFile, error) {
+		if ref.Name == "broken" {
+			return nil, errors.New("404")
+		}
+		return []protocol.SourceFile{{Path: "main.tf", Content: files[ref.String()]}}, nil
+	}
+	var sent []string
+	notify := func(_ context.Context, title, text string) error {
+		sent = append(sent, title+"\n"+text)
+		return nil
+	}
+	refs := []repo.Ref{
+		{Owner: "org", Name: "infra", Branch: "main"},
+		{Owner: "org", Name: "broken", Branch: "main"},
+	}
+	f := NewForecaster(refs, fetch, notify, "https://reports.example.com/cost/")
+
+	f.Run(context.Background())
+	if len(sent) != 1 {
+		t.Fatalf("sent = %d digests, want 1", len(sent))
+	}
+	first := sent[0]
+	if !strings.Contains(first, "| org/infra@main | 1 | $5.00 | — | new |") {
+		t.Errorf("first digest missing new row:\n%s", first)
+	}
+	if !strings.Contains(first, "_error: 404_") {
+		t.Errorf("first digest missing error row:\n%s", first)
+	}
+	if !strings.Contains(first, "https://reports.example.com/cost?repo=org%2Finfra%40main") {
+		t.Errorf("first digest missing report link:\n%s", first)
+	}
+
+	files["org/infra@main"] = strings.Replace(acr, "Basic", "Premium", 1)
+	f.Run(context.Background())
+	second := sent[1]
+	if !strings.Contains(second, "| $50.00 | $5.00 | +$45.00 (+900.0%) |") {
+		t.Errorf("second digest missing delta:\n%s", second)
+	}
+}
+
+func TestFormatDelta(t *testing.T) {
+	tests := []struct {
+		delta, base float64
+		want        string
+	}{
+		{10, 100, "+$10.00 (+10.0%)"},
+		{-25, 100, "-$25.00 (-25.0%)"},
+		{5, 0, "+$5.00"},
+	}
+	for _, tt := range tests {
+		if got := formatDelta(tt.delta, tt.base, usd); got != tt.want {
+			t.Errorf("formatDelta(%v, %v) = %q, want %q", tt.delta, tt.base, got, tt.want)
+		}
+	}
+	de := money{currency: CurrencyUSD, rate: 1, locale: "de-DE"}
+	if got := formatDelta(1250, 10000, de); got != "+1.250,00 $ (+12,5%)" {
+		t.Errorf("formatDelta in de-DE = %q", got)
+	}
+}
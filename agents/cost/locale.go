@@ -0,0 +1,116 @@
+package cost
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// DefaultLocale is the locale amounts are written in when none is set.
+const DefaultLocale = "en-US"
+
+// numberFormat is how a locale writes amounts: its digit group and decimal
+// separators, and where the currency symbol goes. A symbol after the
+// number is always separated by a space; one before it only when spaced.
+type numberFormat struct {
+	group, decimal string
+	symbolAfter    bool
+	spaced         bool
+}
+
+// localeFormats are the supported locales, by BCP 47 tag or by language
+// for locales that write amounts the same in every region.
+var localeFormats = map[string]numberFormat{
+	"en":    {group: ",", decimal: "."},
+	"ja":    {group: ",", decimal: "."},
+	"ko":    {group: ",", decimal: "."},
+	"zh":    {group: ",", decimal: "."},
+	"de":    {group: ".", decimal: ",", symbolAfter: true},
+	"de-CH": {group: "’", decimal: ".", spaced: true},
+	"es":    {group: ".", decimal: ",", symbolAfter: true},
+	"it":    {group: ".", decimal: ",", symbolAfter: true},
+	"pt":    {group: ".", decimal: ",", symbolAfter: true},
+	"pt-BR": {group: ".", decimal: ",", spaced: true},
+	"nl":    {group: ".", decimal: ",", spaced: true},
+	"da":    {group: ".", decimal: ",", symbolAfter: true},
+	"fr":    {group: " ", decimal: ",", symbolAfter: true},
+	"nb":    {group: " ", decimal: ",", symbolAfter: true},
+	"sv":    {group: " ", decimal: ",", symbolAfter: true},
+	"pl":    {group: " ", decimal: ",", symbolAfter: true},
+}
+
+// supportedLocales returns the tags ParseLocale accepts, sorted.
+func supportedLocales() []string {
+	tags := make([]string, 0, len(localeFormats))
+	for t := range localeFormats {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// ParseLocale validates a locale tag such as "de-DE", "de_DE" or "fr",
+// returning it in canonical form ("de-DE"). A region is accepted when its
+// language is supported. An empty tag is DefaultLocale.
+func ParseLocale(tag string) (string, error) {
+	tag = strings.ReplaceAll(strings.TrimSpace(tag), "_", "-")
+	if tag == "" {
+		return DefaultLocale, nil
+	}
+	lang, region, _ := strings.Cut(tag, "-")
+	tag = strings.ToLower(lang)
+	if region != "" {
+		tag += "-" + strings.ToUpper(region)
+	}
+	if _, ok := localeFormats[tag]; ok {
+		return tag, nil
+	}
+	if _, ok := localeFormats[strings.ToLower(lang)]; ok && region != "" {
+		return tag, nil
+	}
+	return "", fmt.Errorf("unsupported locale %q", tag)
+}
+
+// formatFor returns the number format of a tag ParseLocale accepted, or
+// DefaultLocale's for "".
+func formatFor(tag string) numberFormat {
+	if f, ok := localeFormats[tag]; ok {
+		return f
+	}
+	lang, _, _ := strings.Cut(tag, "-")
+	if f, ok := localeFormats[lang]; ok {
+		return f
+	}
+	return localeFormats["en"]
+}
+
+// number writes a non-negative amount with decimals digits after the
+// separator, grouping the integer digits in threes.
+func (f numberFormat) number(amount float64, decimals int) string {
+	s := fmt.Sprintf("%.*f", decimals, amount)
+	whole, frac, _ := strings.Cut(s, ".")
+	var sb strings.Builder
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			sb.WriteString(f.group)
+		}
+		sb.WriteRune(d)
+	}
+	if frac != "" {
+		sb.WriteString(f.decimal)
+		sb.WriteString(frac)
+	}
+	return sb.String()
+}
+
+// requestLocale returns the locale a request asks for in its metadata
+// (protocol.MetaLocale), defaulting to the agent's. An unsupported tag is
+// returned as an error.
+func (a *Agent) requestLocale(req protocol.AgentRequest) (string, error) {
+	if tag := req.Metadata[protocol.MetaLocale]; tag != "" {
+		return ParseLocale(tag)
+	}
+	return a.locale, nil
+}
@@ -0,0 +1,247 @@
+package cost
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/pricing"
+)
+
+// DefaultRetailPricesURL is the public Azure Retail Prices API.
+const DefaultRetailPricesURL = pricing.DefaultURL
+
+// PriceTypeConsumption is the pay-as-you-go price type.
+const PriceTypeConsumption = "Consumption"
+
+// ErrPriceNotFound is returned when the price list has no price for a key.
+var ErrPriceNotFound = errors.New("price not found")
+
+// priceRetryDelay is how long lookups of uncached keys skip the API after
+// a fetch fails, so an outage does not slow every estimate down.
+const priceRetryDelay = time.Minute
+
+// PriceKey identifies a unit price: a VM size ("Standard_D2s_v3") in an ARM
+// region ("eastus") under a price type, in a currency (USD when empty).
+type PriceKey struct {
+	SKU       string `json:"sku"`
+	Region    string `json:"region"`
+	PriceType string `json:"price_type"`
+	Currency  string `json:"currency,omitempty"`
+}
+
+func (k PriceKey) String() string {
+	s := k.SKU + "/" + k.Region + "/" + k.PriceType
+	if k.Currency != "" {
+		s += "/" + k.Currency
+	}
+	return s
+}
+
+// PriceFetcher returns the hourly price for a key, or ErrPriceNotFound.
+type PriceFetcher func(ctx context.Context, key PriceKey) (float64, error)
+
+// RetailPrices looks up Linux VM prices in the Azure Retail Prices API.
+type RetailPrices struct {
+	client *pricing.Client
+}
+
+// NewRetailPrices creates a RetailPrices client. An empty apiURL uses
+// DefaultRetailPricesURL.
+func NewRetailPrices(apiURL string, opts ...pricing.Option) *RetailPrices {
+	return &RetailPrices{client: pricing.New(apiURL, opts...)}
+}
+
+// Fetch returns the hourly Linux price of a VM size. Windows, Spot and Low
+// Priority meters are skipped; of the rest the lowest price wins.
+func (p *RetailPrices) Fetch(ctx context.Context, key PriceKey) (float64, error) {
+	filter := fmt.Sprintf("serviceName eq 'Virtual Machines' and armSkuName eq '%s' and armRegionName eq '%s' and priceType eq '%s'",
+		key.SKU, key.Region, key.PriceType)
+	items, err := p.client.Query(ctx, filter, key.Currency)
+	if err != nil {
+		return 0, err
+	}
+	price, found := 0.0, false
+	for _, it := range items {
+		if it.UnitOfMeasure != "1 Hour" || strings.Contains(it.ProductName, "Windows") ||
+			strings.Contains(it.SkuName, "Spot") || strings.Contains(it.SkuName, "Low Priority") {
+			continue
+		}
+		if !found || it.RetailPrice < price {
+			price, found = it.RetailPrice, true
+		}
+	}
+	if !found {
+		return 0, fmt.Errorf("%s: %w", key, ErrPriceNotFound)
+	}
+	return price, nil
+}
+
+// PriceCache keeps fetched prices for a TTL, in memory and, when it has a
+// path, in a JSON file that survives restarts. An expired price is fetched
+// again on lookup but still served if the fetch fails, so estimates keep
+// working through API outages. Keys the price list lacks are cached too.
+// Refresh, run as a background job, keeps prices from expiring. It is safe
+// for concurrent use.
+type PriceCache struct {
+	fetch PriceFetcher
+	ttl   time.Duration
+	path  string
+	now   func() time.Time
+
+	mu      sync.Mutex
+	entries map[PriceKey]priceEntry
+	// retryAt is when fetching resumes after a failure.
+	retryAt time.Time
+	saveMu  sync.Mutex
+}
+
+type priceEntry struct {
+	PriceKey
+	Price     float64   `json:"price"`
+	Missing   bool      `json:"missing,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// NewPriceCache creates a cache over fetch, loading the file at path if it
+// exists. An empty path keeps prices in memory only.
+func NewPriceCache(fetch PriceFetcher, ttl time.Duration, path string) (*PriceCache, error) {
+	c := &PriceCache{
+		fetch:   fetch,
+		ttl:     ttl,
+		path:    path,
+		now:     time.Now,
+		entries: make(map[PriceKey]priceEntry),
+	}
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read price cache: %w", err)
+	}
+	var entries []priceEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse price cache %s: %w", path, err)
+	}
+	for _, e := range entries {
+		c.entries[e.PriceKey] = e
+	}
+	return c, nil
+}
+
+// Lookup returns the hourly price for key. ok is false when the price list
+// has none or it could not be fetched and was never cached.
+func (c *PriceCache) Lookup(ctx context.Context, key PriceKey) (price float64, ok bool) {
+	price, _, ok = c.lookup(ctx, key)
+	return price, ok
+}
+
+// lookup is Lookup, also telling whether the price was fetched from the
+// API rather than served from the cache.
+func (c *PriceCache) lookup(ctx context.Context, key PriceKey) (price float64, fetched, ok bool) {
+	c.mu.Lock()
+	e, cached := c.entries[key]
+	backoff := c.now().Before(c.retryAt)
+	c.mu.Unlock()
+	if cached && (backoff || c.now().Sub(e.FetchedAt) < c.ttl) {
+		return e.Price, false, !e.Missing
+	}
+	if backoff {
+		return 0, false, false
+	}
+	fresh, err := c.update(ctx, key)
+	if err != nil {
+		return e.Price, false, cached && !e.Missing
+	}
+	c.save()
+	return fresh.Price, true, !fresh.Missing
+}
+
+// Refresh refetches every price older than half the TTL, so that a refresh
+// interval under half the TTL keeps lookups from ever waiting on the API.
+// Prices that fail to refresh are kept. It returns the failures.
+func (c *PriceCache) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	var due []PriceKey
+	for key, e := range c.entries {
+		if c.now().Sub(e.FetchedAt) >= c.ttl/2 {
+			due = append(due, key)
+		}
+	}
+	c.mu.Unlock()
+	if len(due) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, key := range due {
+		if _, err := c.update(ctx, key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	c.save()
+	return errors.Join(errs...)
+}
+
+// Len returns the number of cached keys.
+func (c *PriceCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// update fetches key and stores the result. A key the price list lacks is
+// stored as missing; other errors leave the entry as it was and pause
+// lookups' fetches for priceRetryDelay.
+func (c *PriceCache) update(ctx context.Context, key PriceKey) (priceEntry, error) {
+	price, err := c.fetch(ctx, key)
+	if err != nil && !errors.Is(err, ErrPriceNotFound) {
+		c.mu.Lock()
+		c.retryAt = c.now().Add(priceRetryDelay)
+		c.mu.Unlock()
+		return priceEntry{}, err
+	}
+	e := priceEntry{PriceKey: key, Price: price, Missing: err != nil, FetchedAt: c.now()}
+	c.mu.Lock()
+	c.entries[key] = e
+	c.mu.Unlock()
+	return e, nil
+}
+
+// save writes the entries to the cache file, replacing it atomically.
+// Failures only cost the next restart a refetch, so they are logged.
+func (c *PriceCache) save() {
+	if c.path == "" {
+		return
+	}
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+	c.mu.Lock()
+	entries := make([]priceEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		entries = append(entries, e)
+	}
+	c.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].String() < entries[j].String() })
+	data, _ := json.MarshalIndent(entries, "", "  ")
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("price cache: save %s: %v", c.path, err)
+		return
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		log.Printf("price cache: save %s: %v", c.path, err)
+		os.Remove(tmp)
+	}
+}
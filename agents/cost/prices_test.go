@@ -0,0 +1,167 @@
+package cost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+)
+
+func TestRetailPrices_Fetch(t *testing.T) {
+	var filter string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filter = r.URL.Query().Get("$filter")
+		if strings.Contains(filter, "Standard_Nope") {
+			fmt.Fprint(w, `{"Items": []}`)
+			return
+		}
+		fmt.Fprint(w, `{"Items": [
+			{"retailPrice": 1.248, "unitOfMeasure": "1 Hour", "productName": "Virtual Machines Lsv3 Series Windows", "skuName": "L8s v3"},
+			{"retailPrice": 0.125, "unitOfMeasure": "1 Hour", "productName": "Virtual Machines Lsv3 Series", "skuName": "L8s v3 Spot"},
+			{"retailPrice": 0.624, "unitOfMeasure": "1 Hour", "productName": "Virtual Machines Lsv3 Series", "skuName": "L8s v3"}
+		]}`)
+	}))
+	defer srv.Close()
+
+	p := NewRetailPrices(srv.URL)
+	price, err := p.Fetch(context.Background(), PriceKey{SKU: "Standard_L8s_v3", Region: "westeurope", PriceType: PriceTypeConsumption})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price != 0.624 {
+		t.Errorf("price = %v, want the Linux pay-as-you-go 0.624", price)
+	}
+	for _, want := range []string{"armSkuName eq 'Standard_L8s_v3'", "armRegionName eq 'westeurope'", "priceType eq 'Consumption'"} {
+		if !strings.Contains(filter, want) {
+			t.Errorf("filter %q missing %q", filter, want)
+		}
+	}
+
+	_, err = p.Fetch(context.Background(), PriceKey{SKU: "Standard_Nope", Region: "eastus", PriceType: PriceTypeConsumption})
+	if !errors.Is(err, ErrPriceNotFound) {
+		t.Errorf("err = %v, want ErrPriceNotFound", err)
+	}
+}
+
+func TestPriceCache(t *testing.T) {
+	prices := map[string]float64{"Standard_L8s_v3": 0.624}
+	var calls int
+	var down bool
+	fetch := func(_ context.Context, key PriceKey) (float64, error) {
+		calls++
+		if down {
+			return 0, errors.New("503")
+		}
+		if p, ok := prices[key.SKU]; ok {
+			return p, nil
+		}
+		return 0, ErrPriceNotFound
+	}
+	path := filepath.Join(t.TempDir(), "prices.json")
+	c, err := NewPriceCache(fetch, time.Hour, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	ctx := context.Background()
+	l8 := PriceKey{SKU: "Standard_L8s_v3", Region: "eastus", PriceType: PriceTypeConsumption}
+	nope := PriceKey{SKU: "Standard_Nope", Region: "eastus", PriceType: PriceTypeConsumption}
+
+	if p, ok := c.Lookup(ctx, l8); !ok || p != 0.624 {
+		t.Fatalf("Lookup = %v, %v", p, ok)
+	}
+	if _, ok := c.Lookup(ctx, nope); ok {
+		t.Error("unknown SKU should not be priced")
+	}
+	c.Lookup(ctx, l8)
+	c.Lookup(ctx, nope)
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2 (hits and misses are cached)", calls)
+	}
+
+	// Expired prices are refetched, and served stale while the API is down.
+	now = now.Add(2 * time.Hour)
+	down = true
+	if p, ok := c.Lookup(ctx, l8); !ok || p != 0.624 {
+		t.Errorf("stale Lookup = %v, %v", p, ok)
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+	m8 := PriceKey{SKU: "Standard_M8ms", Region: "eastus", PriceType: PriceTypeConsumption}
+	if _, ok := c.Lookup(ctx, m8); ok || calls != 3 {
+		t.Errorf("lookups should skip the API right after a failure (calls = %d)", calls)
+	}
+	if err := c.Refresh(ctx); err == nil {
+		t.Error("Refresh should report failures")
+	}
+
+	down = false
+	prices["Standard_L8s_v3"] = 0.7
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	calls = 0
+	if p, _ := c.Lookup(ctx, l8); p != 0.7 || calls != 0 {
+		t.Errorf("after Refresh: price = %v, calls = %d", p, calls)
+	}
+
+	// A new cache starts from the file.
+	reloaded, err := NewPriceCache(fetch, time.Hour, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded.now = c.now
+	if reloaded.Len() != 2 {
+		t.Fatalf("reloaded %d prices, want 2", reloaded.Len())
+	}
+	if p, ok := reloaded.Lookup(ctx, l8); !ok || p != 0.7 || calls != 0 {
+		t.Errorf("reloaded Lookup = %v, %v (calls %d)", p, ok, calls)
+	}
+}
+
+func TestAgent_PriceCache(t *testing.T) {
+	var keys []PriceKey
+	c, err := NewPriceCache(func(_ context.Context, key PriceKey) (float64, error) {
+		keys = append(keys, key)
+		return 0.624, nil
+	}, time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := `resource "azurerm_linux_virtual_machine" "db" {
+  name     = "vm-db"
+  location = "West Europe"
+  size     = "Standard_L8s_v3"
+}
+
+resource "azurerm_linux_virtual_machine" "app" {
+  name     = "vm-app"
+  location = "westeurope"
+  size     = "Standard_D2s_v3"
+}`
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "```hcl\n" + code + "\n```"}}}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New(WithPriceCache(c)).Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Join(rec.Messages, "")
+	if !strings.Contains(out, "| linux_virtual_machine.db | Standard_L8s_v3 | $455.52 | high |") {
+		t.Errorf("expected the looked-up price:\n%s", out)
+	}
+	want := []PriceKey{{SKU: "Standard_L8s_v3", Region: "westeurope", PriceType: PriceTypeConsumption}}
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("looked up %v, want %v (sizes in the tables are not looked up)", keys, want)
+	}
+}
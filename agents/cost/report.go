@@ -0,0 +1,95 @@
+package cost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// ErrNoResources is returned by Estimate for requests without IaC resources.
+var ErrNoResources = errors.New("no IaC resources provided for cost estimation")
+
+// Report is a cost estimate in machine-readable form, as served by
+// POST /estimate. Amounts are monthly, in Currency.
+type Report struct {
+	Currency string `json:"currency"`
+	// RequestedCurrency is set when the requested currency's exchange rate
+	// was unavailable and amounts fell back to USD.
+	RequestedCurrency string  `json:"requested_currency,omitempty"`
+	TotalMonthly      float64 `json:"total_monthly"`
+	// CurrentMonthly is the cost before a Terraform plan applies; nil for
+	// input that is not a plan.
+	CurrentMonthly *float64 `json:"current_monthly,omitempty"`
+	Environment    string   `json:"environment,omitempty"`
+	Version        string   `json:"version,omitempty"`
+	Items          []Item   `json:"items"`
+	// LowConfidence counts the items resting on assumed defaults or
+	// unresolved values.
+	LowConfidence int `json:"low_confidence_items"`
+	// ReservedMonthly is the on-demand price of capacity covered by
+	// reservations, already deducted from TotalMonthly.
+	ReservedMonthly float64       `json:"reserved_monthly,omitempty"`
+	Budget          *BudgetResult `json:"budget,omitempty"`
+}
+
+// BudgetResult is an estimate checked against its monthly budget.
+type BudgetResult struct {
+	Monthly     float64 `json:"monthly"`
+	Within      bool    `json:"within"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// Estimate prices a request's resources. The request is read like one sent
+// to the agent: currency, budget and deployment stage come from its
+// metadata or prompt. Errors are caused by the request.
+func (a *Agent) Estimate(ctx context.Context, req protocol.AgentRequest) (Report, error) {
+	r, _, err := a.estimate(ctx, req)
+	return r, err
+}
+
+// estimate builds the report and the money its amounts are in.
+func (a *Agent) estimate(ctx context.Context, req protocol.AgentRequest) (Report, money, error) {
+	if req.IaC == nil || len(req.IaC.Resources) == 0 {
+		return Report{}, usd, ErrNoResources
+	}
+	currency, err := a.requestCurrency(req)
+	if err != nil {
+		return Report{}, usd, fmt.Errorf("%w; supported currencies: %s", err, strings.Join(supportedCurrencies(), ", "))
+	}
+	locale, err := a.requestLocale(req)
+	if err != nil {
+		return Report{}, usd, fmt.Errorf("%w; supported locales: %s", err, strings.Join(supportedLocales(), ", "))
+	}
+	m, converted := a.money(ctx, currency, locale)
+	budget, hasBudget, err := a.requestBudget(req, m)
+	if err != nil {
+		return Report{}, usd, err
+	}
+
+	price := a.vmPricer(ctx)
+	reserved := append(declaredReservations(req.IaC.Resources), a.reservations...)
+	items, total := estimateAll(req.IaC.Resources, price)
+	items, credited := applyReservations(items, reserved)
+	r := Report{Currency: m.currency, Items: items, TotalMonthly: m.convert(total - credited), ReservedMonthly: m.convert(credited)}
+	if !converted {
+		r.RequestedCurrency = currency
+	}
+	for i := range r.Items {
+		r.Items[i].Monthly = m.convert(r.Items[i].Monthly)
+		if r.Items[i].Confidence == protocol.ConfidenceLow {
+			r.LowConfidence++
+		}
+	}
+	if current, ok := currentCost(req.IaC.Resources, price, reserved); ok {
+		current = m.convert(current)
+		r.CurrentMonthly = &current
+	}
+	r.Environment, r.Version = deploymentStage(req)
+	if hasBudget {
+		r.Budget = &BudgetResult{Monthly: budget, Within: r.TotalMonthly <= budget, UsedPercent: r.TotalMonthly / budget * 100}
+	}
+	return r, m, nil
+}
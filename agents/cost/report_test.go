@@ -0,0 +1,91 @@
+package cost
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+func TestAgent_Estimate(t *testing.T) {
+	fetch := func(_ context.Context, key PriceKey) (float64, error) {
+		if key.SKU == "Standard_L8s_v3" {
+			return 0.624, nil
+		}
+		return 0, ErrPriceNotFound
+	}
+	cache, err := NewPriceCache(fetch, time.Hour, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := `resource "azurerm_key_vault" "kv" {}
+
+resource "azurerm_linux_virtual_machine" "big" {
+  size = "Standard_L8s_v3"
+  os_disk {
+    storage_account_type = "Premium_LRS"
+    disk_size_gb         = 64
+  }
+}
+
+resource "azurerm_linux_virtual_machine" "odd" {
+  size = "Standard_Nope"
+  os_disk {
+    storage_account_type = "Premium_LRS"
+    disk_size_gb         = 64
+  }
+}`
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "estimate for prod with a budget of 1000:\n```hcl\n" + code + "\n```"}},
+	}
+	host.ParseAndEnrich(&req)
+	a := New(WithPriceCache(cache))
+
+	sources := func(r Report) map[string]PriceSource {
+		out := make(map[string]PriceSource, len(r.Items))
+		for _, it := range r.Items {
+			out[it.Name] = it.Source
+		}
+		return out
+	}
+	r, err := a.Estimate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]PriceSource{
+		"key_vault.kv":                        SourceTable,
+		"linux_virtual_machine.big":           SourceAPI,
+		"linux_virtual_machine.big (OS disk)": SourceTable,
+		"linux_virtual_machine.odd":           SourceHeuristic,
+		"linux_virtual_machine.odd (OS disk)": SourceTable,
+	}
+	got := sources(r)
+	for name, src := range want {
+		if got[name] != src {
+			t.Errorf("%s source = %q, want %q", name, got[name], src)
+		}
+	}
+	if r.Currency != CurrencyUSD || r.Environment != "prod" || r.LowConfidence != 1 || r.CurrentMonthly != nil {
+		t.Errorf("report = %+v", r)
+	}
+	if r.Budget == nil || r.Budget.Monthly != 1000 || !r.Budget.Within {
+		t.Errorf("budget = %+v", r.Budget)
+	}
+
+	// The second estimate is served from the cache.
+	r, _ = a.Estimate(context.Background(), req)
+	if src := sources(r)["linux_virtual_machine.big"]; src != SourceCache {
+		t.Errorf("cached source = %q, want %q", src, SourceCache)
+	}
+
+	if _, err := a.Estimate(context.Background(), protocol.AgentRequest{}); !errors.Is(err, ErrNoResources) {
+		t.Errorf("no resources: err = %v", err)
+	}
+	req.Metadata = map[string]string{protocol.MetaCurrency: "XYZ"}
+	if _, err := a.Estimate(context.Background(), req); err == nil {
+		t.Error("expected error for unsupported currency")
+	}
+}
@@ -0,0 +1,225 @@
+package cost
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// ReservationKind is the capacity a reservation prepays.
+type ReservationKind string
+
+const (
+	// ReservedVM covers instances of one VM size, including AKS nodes.
+	// Only compute is covered; Windows license surcharges are not.
+	ReservedVM ReservationKind = "vm"
+	// ReservedSQLVCore covers provisioned SQL Database vCores, optionally of
+	// one service tier (GP, BC or HS). Serverless databases are not covered.
+	ReservedSQLVCore ReservationKind = "sql_vcore"
+	// ReservedCosmosRU covers provisioned Cosmos DB throughput in RU/s.
+	ReservedCosmosRU ReservationKind = "cosmos_ru"
+)
+
+// reservationOrderType is the ARM type of a reservation purchase, as
+// declared in Bicep or through azapi_resource.
+const reservationOrderType = "Microsoft.Capacity/reservationOrders"
+
+// Reservation is prepaid capacity that on-demand estimates are netted
+// against: what it covers is already paid for, so only the remainder is a
+// marginal cost.
+type Reservation struct {
+	Kind ReservationKind `json:"kind"`
+	// SKU is the VM size, or the SQL service tier; empty covers any tier.
+	SKU string `json:"sku,omitempty"`
+	// Region is the ARM region covered; empty covers every region (a
+	// shared scope with instance flexibility is not modeled).
+	Region string `json:"region,omitempty"`
+	// Quantity is in instances, vCores or RU/s by Kind.
+	Quantity float64 `json:"quantity"`
+}
+
+func (r Reservation) String() string {
+	s := string(r.Kind)
+	if r.SKU != "" {
+		s += ":" + r.SKU
+	}
+	if r.Region != "" {
+		s += "@" + r.Region
+	}
+	return s + "=" + strconv.FormatFloat(r.Quantity, 'g', -1, 64)
+}
+
+// unit names Quantity for each kind.
+var reservationUnits = map[ReservationKind]string{
+	ReservedVM:       "instance(s)",
+	ReservedSQLVCore: "vCore(s)",
+	ReservedCosmosRU: "RU/s",
+}
+
+// ParseReservations parses comma-separated kind[:sku][@region]=quantity
+// entries, e.g. "vm:Standard_D4s_v3@eastus=2,sql_vcore:GP=8,cosmos_ru=10000".
+func ParseReservations(s string) ([]Reservation, error) {
+	var out []Reservation
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		spec, qty, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid reservation %q (want kind[:sku][@region]=quantity)", entry)
+		}
+		var r Reservation
+		spec, r.Region, _ = strings.Cut(strings.TrimSpace(spec), "@")
+		kind, sku, _ := strings.Cut(spec, ":")
+		r.Kind, r.SKU = ReservationKind(strings.ToLower(kind)), sku
+		if r.Region != "" {
+			if r.Region = armRegion(r.Region); r.Region == "" {
+				return nil, fmt.Errorf("reservation %q: invalid region", entry)
+			}
+		}
+		switch r.Kind {
+		case ReservedVM:
+			if r.SKU == "" {
+				return nil, fmt.Errorf("reservation %q: a VM reservation needs a size", entry)
+			}
+		case ReservedSQLVCore:
+			r.SKU = strings.ToUpper(r.SKU)
+			if r.SKU != "" && r.SKU != "GP" && r.SKU != "BC" && r.SKU != "HS" {
+				return nil, fmt.Errorf("reservation %q: SQL tier must be GP, BC or HS", entry)
+			}
+		case ReservedCosmosRU:
+			if r.SKU != "" {
+				return nil, fmt.Errorf("reservation %q: Cosmos DB reservations take no SKU", entry)
+			}
+		default:
+			return nil, fmt.Errorf("reservation %q: unknown kind %q (want vm, sql_vcore or cosmos_ru)", entry, kind)
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(qty), 64)
+		if err != nil || q <= 0 {
+			return nil, fmt.Errorf("reservation %q: quantity must be positive", entry)
+		}
+		r.Quantity = q
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// WithReservations nets estimates against reserved capacity the
+// organization has already purchased, in addition to reservations declared
+// in the IaC itself.
+func WithReservations(rs []Reservation) Option {
+	return func(a *Agent) {
+		a.reservations = rs
+	}
+}
+
+// declaredReservations returns the reservation orders among resources.
+// Cosmos DB reservations are bought in units of 100 RU/s.
+func declaredReservations(resources []protocol.Resource) []Reservation {
+	var out []Reservation
+	for _, res := range resources {
+		if !strings.EqualFold(res.Type, reservationOrderType) || res.Deleted() {
+			continue
+		}
+		qty, ok := numberProp(res.Properties, "quantity")
+		if !ok || qty <= 0 {
+			continue
+		}
+		var sku string
+		if s, ok := res.Properties["sku"].(map[string]interface{}); ok {
+			sku, _ = s["name"].(string)
+		}
+		region := ""
+		if loc, ok := res.Properties["location"].(string); ok {
+			region = armRegion(loc)
+		}
+		kind, _ := res.Properties["reservedResourceType"].(string)
+		switch strings.ToLower(kind) {
+		case "virtualmachines":
+			if sku != "" {
+				out = append(out, Reservation{Kind: ReservedVM, SKU: sku, Region: region, Quantity: qty})
+			}
+		case "sqldatabases":
+			out = append(out, Reservation{Kind: ReservedSQLVCore, SKU: sqlReservationTier(sku), Region: region, Quantity: qty})
+		case "cosmosdb":
+			out = append(out, Reservation{Kind: ReservedCosmosRU, Region: region, Quantity: qty * 100})
+		}
+	}
+	return out
+}
+
+// sqlReservationTier reads the service tier from a reservation SKU such as
+// "SQLDB_GP_Compute_Gen5"; "" covers any tier.
+func sqlReservationTier(sku string) string {
+	for _, tier := range []string{"GP", "BC", "HS"} {
+		if strings.Contains(strings.ToUpper(sku), "_"+tier+"_") {
+			return tier
+		}
+	}
+	return ""
+}
+
+// capacityUsage is the reservable capacity a line item consumes, priced per
+// unit at the on-demand monthly rate.
+type capacityUsage struct {
+	kind     ReservationKind
+	sku      string
+	region   string
+	quantity float64
+	unit     float64
+}
+
+// covers reports whether r applies to u.
+func (r Reservation) covers(u capacityUsage) bool {
+	return r.Kind == u.kind &&
+		(r.Region == "" || r.Region == u.region) &&
+		(r.SKU == "" || strings.EqualFold(r.SKU, u.sku))
+}
+
+// applyReservations follows each line item that consumes reserved capacity
+// with a credit for the part covered, drawing down reservations in item
+// order, and returns the items and the credited total (positive).
+func applyReservations(items []Item, reserved []Reservation) ([]Item, float64) {
+	if len(reserved) == 0 {
+		return items, 0
+	}
+	left := make([]float64, len(reserved))
+	for i, r := range reserved {
+		left[i] = r.Quantity
+	}
+	var credited float64
+	out := make([]Item, 0, len(items))
+	for _, it := range items {
+		out = append(out, it)
+		u := it.capacity
+		if u.quantity <= 0 {
+			continue
+		}
+		need, covered := u.quantity, 0.0
+		for i, r := range reserved {
+			if need == 0 || left[i] == 0 || !r.covers(u) {
+				continue
+			}
+			n := min(need, left[i])
+			left[i] -= n
+			need -= n
+			covered += n
+		}
+		if covered == 0 {
+			continue
+		}
+		credit := covered * u.unit
+		credited += credit
+		out = append(out, Item{
+			Name:       it.Name + " (reserved capacity)",
+			SKU:        fmt.Sprintf("%g %s reserved", covered, reservationUnits[u.kind]),
+			Monthly:    -credit,
+			Confidence: protocol.ConfidenceHigh,
+			Source:     SourceReservation,
+		})
+	}
+	return out, credited
+}
@@ -0,0 +1,146 @@
+package cost
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+)
+
+func TestParseReservations(t *testing.T) {
+	rs, err := ParseReservations("vm:Standard_D4s_v3@East US=2, sql_vcore:gp=8,cosmos_ru=10000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Reservation{
+		{Kind: ReservedVM, SKU: "Standard_D4s_v3", Region: "eastus", Quantity: 2},
+		{Kind: ReservedSQLVCore, SKU: "GP", Quantity: 8},
+		{Kind: ReservedCosmosRU, Quantity: 10000},
+	}
+	if len(rs) != len(want) {
+		t.Fatalf("got %v", rs)
+	}
+	for i := range want {
+		if rs[i] != want[i] {
+			t.Errorf("reservation %d = %v, want %v", i, rs[i], want[i])
+		}
+	}
+	if s := rs[0].String(); s != "vm:Standard_D4s_v3@eastus=2" {
+		t.Errorf("String() = %q", s)
+	}
+
+	for _, bad := range []string{"vm=2", "sql_vcore:XX=4", "cosmos_ru:S1=100", "redis=1", "cosmos_ru=0", "cosmos_ru", "vm:D2@var.location=1"} {
+		if _, err := ParseReservations(bad); err == nil {
+			t.Errorf("ParseReservations(%q): expected error", bad)
+		}
+	}
+}
+
+func TestAgent_NetsReservations(t *testing.T) {
+	code := `resource "azurerm_linux_virtual_machine" "web" {
+  size     = "Standard_D4s_v3"
+  location = "eastus"
+}
+
+resource "azurerm_windows_virtual_machine" "app" {
+  size     = "Standard_D4s_v3"
+  location = "westeurope"
+}
+
+resource "azurerm_mssql_database" "db" {
+  sku_name = "GP_Gen5_4"
+}
+
+resource "azurerm_mssql_database" "burst" {
+  sku_name = "GP_S_Gen5_2"
+}`
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "estimate:\n```hcl\n" + code + "\n```"}}}
+	host.ParseAndEnrich(&req)
+
+	reserved, err := ParseReservations("vm:Standard_D4s_v3@eastus=5,sql_vcore:GP=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(WithReservations(reserved))
+	r, err := a.Estimate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credits := map[string]float64{}
+	for _, it := range r.Items {
+		if it.Source == SourceReservation {
+			credits[it.Name] = it.Monthly
+		}
+	}
+	vmCredit := -vmSkuPrices["Standard_D4s_v3"] * hoursPerMonth
+	sqlCredit := -2 * sqlGeneralPurposeVCoreHourly * hoursPerMonth
+	if len(credits) != 2 || !near(credits["linux_virtual_machine.web (reserved capacity)"], vmCredit) || !near(credits["mssql_database.db (reserved capacity)"], sqlCredit) {
+		t.Errorf("credits = %v, want the eastus VM and 2 GP vCores", credits)
+	}
+	if !near(r.ReservedMonthly, -(vmCredit + sqlCredit)) {
+		t.Errorf("reserved = %.2f", r.ReservedMonthly)
+	}
+
+	unreserved, _ := New().Estimate(context.Background(), req)
+	if !near(unreserved.TotalMonthly-r.TotalMonthly, r.ReservedMonthly) {
+		t.Errorf("total %.2f, want %.2f less than %.2f", r.TotalMonthly, r.ReservedMonthly, unreserved.TotalMonthly)
+	}
+
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	if out := strings.Join(rec.Messages, ""); !strings.Contains(out, "| -$") || !strings.Contains(out, "covered by reserved capacity") {
+		t.Errorf("output does not show the credits:\n%s", out)
+	}
+}
+
+func TestDeclaredReservations(t *testing.T) {
+	code := `resource cosmos 'Microsoft.DocumentDB/databaseAccounts@2023-04-15' = {
+  name: 'orders'
+  location: 'eastus'
+}
+
+resource ru 'Microsoft.Capacity/reservationOrders@2022-11-01' = {
+  name: 'cosmos-ru'
+  location: 'eastus'
+  sku: {
+    name: 'Cosmos_DB_100_RU'
+  }
+  properties: {
+    reservedResourceType: 'CosmosDb'
+    quantity: 3
+    term: 'P1Y'
+  }
+}`
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "estimate:\n```bicep\n" + code + "\n```"}}}
+	host.ParseAndEnrich(&req)
+
+	rs := declaredReservations(req.IaC.Resources)
+	if len(rs) != 1 || rs[0] != (Reservation{Kind: ReservedCosmosRU, Region: "eastus", Quantity: 300}) {
+		t.Fatalf("declared = %v", rs)
+	}
+	r, err := New().Estimate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The account's 400 RU/s are 3/4 covered.
+	want := 300 * cosmosPer100RUHourly / 100 * hoursPerMonth
+	if !near(r.ReservedMonthly, want) || !near(r.TotalMonthly, cosmosDefaultRU/100*cosmosPer100RUHourly*hoursPerMonth-want) {
+		t.Errorf("report = %+v, want %.2f reserved", r, want)
+	}
+}
+
+func TestSQLReservationTier(t *testing.T) {
+	for sku, want := range map[string]string{"SQLDB_GP_Compute_Gen5": "GP", "SQLDB_BC_Compute_Gen5": "BC", "SQLDB_HS_Compute_Gen5": "HS", "": ""} {
+		if got := sqlReservationTier(sku); got != want {
+			t.Errorf("sqlReservationTier(%q) = %q, want %q", sku, got, want)
+		}
+	}
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 0.01 }
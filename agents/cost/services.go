@@ -0,0 +1,338 @@
+package cost
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Pay-as-you-go list prices (USD, East US) for databases, networking and
+// serverless resources. Usage-based charges the IaC cannot know (data
+// processed, requests, ingestion) are assumed at the noted volumes, which
+// caps those estimates at medium confidence.
+const (
+	// SQL Database vCore compute per vCore-hour, and storage per GB-month.
+	sqlGeneralPurposeVCoreHourly   = 0.2522
+	sqlBusinessCriticalVCoreHourly = 0.6796
+	sqlHyperscaleVCoreHourly       = 0.2796
+	sqlServerlessVCoreHourly       = 0.5218
+	sqlStoragePerGB                = 0.115
+
+	// Cosmos DB provisioned throughput per 100 RU/s-hour; accounts without
+	// database-level throughput are assumed at the 400 RU/s minimum.
+	cosmosPer100RUHourly = 0.008
+	cosmosDefaultRU      = 400
+
+	// PostgreSQL flexible server compute per vCore-hour and storage per
+	// GB-month; storage_mb defaults to 32 GiB.
+	postgresGPVCoreHourly = 0.0890
+	postgresMOVCoreHourly = 0.1230
+	postgresStoragePerGB  = 0.115
+	postgresDefaultMB     = 32768
+
+	// Application Gateway v2 fixed price per gateway-hour and capacity
+	// units per CU-hour; one instance is about 10 capacity units.
+	appGatewayStandardV2Hourly = 0.246
+	appGatewayWAFV2Hourly      = 0.443
+	appGatewayStandardCUHourly = 0.008
+	appGatewayWAFCUHourly      = 0.0144
+	appGatewayCUPerInstance    = 10
+
+	natGatewayHourly       = 0.045
+	publicIPStandardHourly = 0.005
+	publicIPBasicHourly    = 0.0036
+
+	// Log Analytics pay-as-you-go ingestion is assumed at 1 GB/day;
+	// retention beyond the included 31 days is per GB-month.
+	logAnalyticsAssumedGBPerDay = 1.0
+	logAnalyticsRetentionPerGB  = 0.10
+	logAnalyticsFreeRetention   = 31
+)
+
+// Application Gateway v1 per instance-hour.
+var appGatewayV1Prices = map[string]float64{
+	"Standard_Small": 0.025, "Standard_Medium": 0.07, "Standard_Large": 0.32,
+	"WAF_Medium": 0.126, "WAF_Large": 0.448,
+}
+
+// Azure Firewall deployment per hour by sku_tier.
+var firewallPrices = map[string]float64{
+	"Basic": 0.395, "Standard": 1.25, "Premium": 1.75,
+}
+
+// SQL Database DTU tiers per month, storage included.
+var sqlDTUPrices = map[string]float64{
+	"Basic": 4.90, "S0": 14.72, "S1": 29.43, "S2": 73.58, "S3": 147.17,
+	"S4": 294.34, "P1": 456.25, "P2": 912.50, "P4": 1825.00,
+}
+
+// PostgreSQL burstable compute per hour; burstable sizes don't scale
+// linearly with vCores.
+var postgresBurstablePrices = map[string]float64{
+	"B_Standard_B1ms": 0.017, "B_Standard_B2s": 0.068, "B_Standard_B2ms": 0.084,
+	"B_Standard_B4ms": 0.169, "B_Standard_B8ms": 0.338,
+}
+
+// Log Analytics commitment tiers per day, by GB/day reserved.
+var logAnalyticsCommitmentPrices = map[int]float64{
+	100: 196, 200: 368, 300: 540, 400: 704, 500: 865,
+	1000: 1700, 2000: 3320, 5000: 8050,
+}
+
+var (
+	sqlVCoreSKURe = regexp.MustCompile(`^(GP|BC|HS)(_S)?_[A-Za-z0-9]+_(\d+)$`)
+	postgresSKURe = regexp.MustCompile(`^(GP|MO)_Standard_[A-Z]+(\d+)`)
+)
+
+// numberProp reads a numeric property, which parsers return as int or
+// float64.
+func numberProp(props map[string]interface{}, key string) (float64, bool) {
+	switch v := props[key].(type) {
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// blocks returns the nested blocks named key: one block parses as a map,
+// repeated blocks as a list.
+func blocks(props map[string]interface{}, key string) []map[string]interface{} {
+	switch v := props[key].(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}
+	case []interface{}:
+		var out []map[string]interface{}
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok {
+				out = append(out, m)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// estimateSQLDatabase prices DTU tiers from a table and vCore SKUs
+// ("GP_Gen5_2", "GP_S_Gen5_2" serverless, "BC_Gen5_4", "HS_Gen5_2") per
+// vCore. Databases in an elastic pool are billed through the pool.
+func estimateSQLDatabase(res protocol.Resource) estimate {
+	if id, _ := res.Properties["elastic_pool_id"].(string); id != "" {
+		return estimate{sku: "Elastic pool", monthly: 0, confidence: protocol.ConfidenceHigh}
+	}
+	sku := "GP_Gen5_2"
+	if s, ok := res.Properties["sku_name"].(string); ok {
+		sku = s
+	}
+	conf := estimateConfidence(res, true, "sku_name")
+	if monthly, ok := sqlDTUPrices[sku]; ok {
+		return estimate{sku: sku, monthly: monthly, confidence: conf}
+	}
+	m := sqlVCoreSKURe.FindStringSubmatch(sku)
+	if m == nil {
+		return estimate{sku: sku, monthly: 2 * sqlGeneralPurposeVCoreHourly * hoursPerMonth, confidence: protocol.ConfidenceLow}
+	}
+	vcores, _ := strconv.Atoi(m[3])
+	est := estimate{sku: sku, confidence: conf}
+	switch {
+	case m[2] != "":
+		// Serverless bills per vCore-second used; assume min_capacity
+		// (0.5 vCore by default) around the clock.
+		minCap, ok := numberProp(res.Properties, "min_capacity")
+		if !ok {
+			minCap = 0.5
+		}
+		est.monthly = minCap * sqlServerlessVCoreHourly * hoursPerMonth
+		est.sku = fmt.Sprintf("%s (serverless, %g vCore min)", sku, minCap)
+		est.confidence = protocol.LeastConfident(protocol.ConfidenceMedium, conf)
+	default:
+		rate := sqlGeneralPurposeVCoreHourly
+		switch m[1] {
+		case "BC":
+			rate = sqlBusinessCriticalVCoreHourly
+		case "HS":
+			rate = sqlHyperscaleVCoreHourly
+		}
+		est.monthly = float64(vcores) * rate * hoursPerMonth
+		est.capacity = capacityUsage{kind: ReservedSQLVCore, sku: m[1], quantity: float64(vcores), unit: rate * hoursPerMonth}
+	}
+	if gb, ok := numberProp(res.Properties, "max_size_gb"); ok && gb > 0 {
+		est.extras = append(est.extras, extraCost{label: "storage", sku: fmt.Sprintf("%g GB", gb), monthly: gb * sqlStoragePerGB})
+	}
+	return est
+}
+
+// estimateCosmosDB prices an account's provisioned throughput in every
+// region it replicates to. Serverless accounts bill per request and are
+// listed at no fixed cost.
+func estimateCosmosDB(res protocol.Resource) estimate {
+	for _, c := range blocks(res.Properties, "capabilities") {
+		if name, _ := c["name"].(string); name == "EnableServerless" {
+			return estimate{sku: "Serverless", monthly: 0, confidence: protocol.ConfidenceMedium}
+		}
+	}
+	regions := len(blocks(res.Properties, "geo_location"))
+	if regions == 0 {
+		regions = 1
+	}
+	est := estimate{
+		sku:        fmt.Sprintf("%d RU/s x %d region(s)", cosmosDefaultRU, regions),
+		monthly:    cosmosDefaultRU / 100 * cosmosPer100RUHourly * hoursPerMonth * float64(regions),
+		confidence: protocol.ConfidenceMedium,
+	}
+	ru := float64(cosmosDefaultRU * regions)
+	if multi, _ := res.Properties["multiple_write_locations_enabled"].(bool); multi && regions > 1 {
+		// Multi-region writes bill throughput at twice the rate, and
+		// consume reservations at twice the RU/s.
+		est.monthly *= 2
+		est.sku += ", multi-region writes"
+		ru *= 2
+	}
+	est.capacity = capacityUsage{kind: ReservedCosmosRU, quantity: ru, unit: cosmosPer100RUHourly / 100 * hoursPerMonth}
+	return est
+}
+
+// estimatePostgres prices a flexible server's compute from its sku_name
+// ("B_Standard_B1ms", "GP_Standard_D2s_v3", "MO_Standard_E4ds_v4") plus
+// storage, and a standby for zone-redundant or same-zone HA.
+func estimatePostgres(res protocol.Resource) estimate {
+	sku := "GP_Standard_D2s_v3"
+	if s, ok := res.Properties["sku_name"].(string); ok {
+		sku = s
+	}
+	hourly, priced := postgresBurstablePrices[sku]
+	if m := postgresSKURe.FindStringSubmatch(sku); !priced && m != nil {
+		vcores, _ := strconv.Atoi(m[2])
+		rate := postgresGPVCoreHourly
+		if m[1] == "MO" {
+			rate = postgresMOVCoreHourly
+		}
+		hourly, priced = float64(vcores)*rate, true
+	}
+	if !priced {
+		hourly = 2 * postgresGPVCoreHourly
+	}
+	est := estimate{sku: sku, monthly: hourly * hoursPerMonth, confidence: estimateConfidence(res, priced, "sku_name")}
+
+	mb, ok := numberProp(res.Properties, "storage_mb")
+	if !ok {
+		mb = postgresDefaultMB
+	}
+	est.extras = append(est.extras, extraCost{label: "storage", sku: fmt.Sprintf("%.0f GB", mb/1024), monthly: mb / 1024 * postgresStoragePerGB})
+	for _, ha := range blocks(res.Properties, "high_availability") {
+		mode, _ := ha["mode"].(string)
+		est.extras = append(est.extras, extraCost{label: "HA standby", sku: mode, monthly: est.monthly})
+	}
+	return est
+}
+
+// estimateAppGateway prices v2 gateways as a fixed hourly charge plus
+// capacity units for the configured (or minimum autoscale) instances, and
+// v1 gateways per instance.
+func estimateAppGateway(res protocol.Resource) estimate {
+	sku := map[string]interface{}{}
+	if b := blocks(res.Properties, "sku"); len(b) > 0 {
+		sku = b[0]
+	}
+	name, _ := sku["name"].(string)
+	if name == "" {
+		name = "Standard_v2"
+	}
+	instances, ok := numberProp(sku, "capacity")
+	if as := blocks(res.Properties, "autoscale_configuration"); len(as) > 0 {
+		instances, ok = numberProp(as[0], "min_capacity")
+	}
+	if !ok {
+		instances = 1
+	}
+	conf := estimateConfidence(res, true, "sku.name")
+
+	if hourly, v1 := appGatewayV1Prices[name]; v1 {
+		return estimate{sku: fmt.Sprintf("%gx %s", instances, name), monthly: hourly * hoursPerMonth * instances, confidence: conf}
+	}
+	fixed, cu := appGatewayStandardV2Hourly, appGatewayStandardCUHourly
+	switch name {
+	case "WAF_v2":
+		fixed, cu = appGatewayWAFV2Hourly, appGatewayWAFCUHourly
+	case "Standard_v2":
+	default:
+		conf = protocol.ConfidenceLow
+	}
+	units := instances * appGatewayCUPerInstance
+	return estimate{
+		sku:        name,
+		monthly:    fixed * hoursPerMonth,
+		confidence: conf,
+		extras:     []extraCost{{label: "capacity units", sku: fmt.Sprintf("~%g CU", units), monthly: units * cu * hoursPerMonth}},
+	}
+}
+
+// estimateFirewall prices the deployment by sku_tier; data processing is
+// billed per GB on top.
+func estimateFirewall(res protocol.Resource) estimate {
+	tier := "Standard"
+	if s, ok := res.Properties["sku_tier"].(string); ok {
+		tier = s
+	}
+	hourly, priced := firewallPrices[tier]
+	if !priced {
+		hourly = firewallPrices["Standard"]
+	}
+	return estimate{sku: tier, monthly: hourly * hoursPerMonth, confidence: estimateConfidence(res, priced, "sku_tier")}
+}
+
+// estimatePublicIP prices a public IP address; Standard is the provider's
+// default SKU.
+func estimatePublicIP(res protocol.Resource) estimate {
+	if sku, _ := res.Properties["sku"].(string); strings.EqualFold(sku, "Basic") {
+		return estimate{sku: "Basic", monthly: publicIPBasicHourly * hoursPerMonth, confidence: estimateConfidence(res, true, "sku")}
+	}
+	return estimate{sku: "Standard", monthly: publicIPStandardHourly * hoursPerMonth, confidence: protocol.ConfidenceHigh}
+}
+
+// estimateLogAnalytics prices ingestion for the pay-as-you-go SKU at the
+// assumed daily volume (or daily_quota_gb when lower), commitment tiers at
+// their reserved capacity, and retention beyond the included 31 days.
+func estimateLogAnalytics(res protocol.Resource) estimate {
+	sku := "PerGB2018"
+	if s, ok := res.Properties["sku"].(string); ok {
+		sku = s
+	}
+	gbPerDay := logAnalyticsAssumedGBPerDay
+	if quota, ok := numberProp(res.Properties, "daily_quota_gb"); ok && quota > 0 && quota < gbPerDay {
+		gbPerDay = quota
+	}
+
+	var est estimate
+	if reserved, ok := numberProp(res.Properties, "reservation_capacity_in_gb_per_day"); ok && sku == "CapacityReservation" {
+		daily, priced := logAnalyticsCommitmentPrices[int(reserved)]
+		if !priced {
+			daily = reserved * logAnalyticsPerGB
+		}
+		gbPerDay = reserved
+		est = estimate{
+			sku:        fmt.Sprintf("Commitment %.0f GB/day", reserved),
+			monthly:    daily * 30,
+			confidence: estimateConfidence(res, priced, "reservation_capacity_in_gb_per_day"),
+		}
+	} else {
+		est = estimate{
+			sku:        fmt.Sprintf("%s (~%g GB/day)", sku, gbPerDay),
+			monthly:    gbPerDay * 30 * logAnalyticsPerGB,
+			confidence: protocol.ConfidenceMedium,
+		}
+	}
+
+	if days, ok := numberProp(res.Properties, "retention_in_days"); ok && days > logAnalyticsFreeRetention {
+		stored := gbPerDay * (days - logAnalyticsFreeRetention)
+		est.extras = append(est.extras, extraCost{label: "retention", sku: fmt.Sprintf("%.0f days", days), monthly: stored * logAnalyticsRetentionPerGB})
+	}
+	return est
+}
@@ -0,0 +1,143 @@
+package cost
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+)
+
+func TestEstimateResource_Services(t *testing.T) {
+	tests := []struct {
+		name       string
+		hcl        string
+		sku        string
+		monthly    float64
+		extras     float64
+		confidence protocol.Confidence
+	}{
+		{"sql dtu", `resource "azurerm_mssql_database" "db" {
+  sku_name = "S1"
+}`, "S1", 29.43, 0, protocol.ConfidenceHigh},
+		{"sql vcore", `resource "azurerm_mssql_database" "db" {
+  sku_name    = "GP_Gen5_4"
+  max_size_gb = 32
+}`, "GP_Gen5_4", 736.42, 3.68, protocol.ConfidenceHigh},
+		{"sql serverless", `resource "azurerm_mssql_database" "db" {
+  sku_name     = "GP_S_Gen5_2"
+  min_capacity = 1
+}`, "GP_S_Gen5_2 (serverless, 1 vCore min)", 380.91, 0, protocol.ConfidenceMedium},
+		{"sql elastic pool", `resource "azurerm_mssql_database" "db" {
+  elastic_pool_id = azurerm_mssql_elastic_pool.pool.id
+}`, "Elastic pool", 0, 0, protocol.ConfidenceHigh},
+		{"cosmos two regions", `resource "azurerm_cosmosdb_account" "db" {
+  geo_location {
+    location = "eastus"
+  }
+  geo_location {
+    location = "westus"
+  }
+}`, "400 RU/s x 2 region(s)", 46.72, 0, protocol.ConfidenceMedium},
+		{"cosmos serverless", `resource "azurerm_cosmosdb_account" "db" {
+  capabilities {
+    name = "EnableServerless"
+  }
+}`, "Serverless", 0, 0, protocol.ConfidenceMedium},
+		{"postgres general purpose with HA", `resource "azurerm_postgresql_flexible_server" "pg" {
+  sku_name = "GP_Standard_D4s_v3"
+  high_availability {
+    mode = "ZoneRedundant"
+  }
+}`, "GP_Standard_D4s_v3", 259.88, 3.68 + 259.88, protocol.ConfidenceHigh},
+		{"postgres burstable", `resource "azurerm_postgresql_flexible_server" "pg" {
+  sku_name   = "B_Standard_B1ms"
+  storage_mb = 65536
+}`, "B_Standard_B1ms", 12.41, 7.36, protocol.ConfidenceHigh},
+		{"app gateway waf v2", `resource "azurerm_application_gateway" "agw" {
+  sku {
+    name     = "WAF_v2"
+    tier     = "WAF_v2"
+    capacity = 2
+  }
+}`, "WAF_v2", 323.39, 210.24, protocol.ConfidenceHigh},
+		{"app gateway v1", `resource "azurerm_application_gateway" "agw" {
+  sku {
+    name     = "Standard_Medium"
+    capacity = 2
+  }
+}`, "2x Standard_Medium", 102.20, 0, protocol.ConfidenceHigh},
+		{"firewall", `resource "azurerm_firewall" "fw" {
+  sku_tier = "Premium"
+}`, "Premium", 1277.50, 0, protocol.ConfidenceHigh},
+		{"nat gateway", `resource "azurerm_nat_gateway" "nat" {
+  name = "nat"
+}`, "Standard", 32.85, 0, protocol.ConfidenceHigh},
+		{"public ip", `resource "azurerm_public_ip" "pip" {
+  allocation_method = "Static"
+}`, "Standard", 3.65, 0, protocol.ConfidenceHigh},
+		{"function app", `resource "azurerm_linux_function_app" "fn" {
+  service_plan_id = azurerm_service_plan.plan.id
+}`, "Consumption (free grant)", 0, 0, protocol.ConfidenceMedium},
+		{"consumption plan", `resource "azurerm_service_plan" "plan" {
+  sku_name = "Y1"
+}`, "Y1", 0, 0, protocol.ConfidenceHigh},
+		{"log analytics with retention", `resource "azurerm_log_analytics_workspace" "log" {
+  sku               = "PerGB2018"
+  retention_in_days = 90
+}`, "PerGB2018 (~1 GB/day)", 69, 5.90, protocol.ConfidenceMedium},
+		{"log analytics quota", `resource "azurerm_log_analytics_workspace" "log" {
+  daily_quota_gb = 0.5
+}`, "PerGB2018 (~0.5 GB/day)", 34.50, 0, protocol.ConfidenceMedium},
+		{"log analytics commitment", `resource "azurerm_log_analytics_workspace" "log" {
+  sku                                = "CapacityReservation"
+  reservation_capacity_in_gb_per_day = 100
+}`, "Commitment 100 GB/day", 5880, 0, protocol.ConfidenceHigh},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources := parser.ParseResources(tt.hcl)
+			if len(resources) != 1 {
+				t.Fatalf("parsed %d resources", len(resources))
+			}
+			est := estimateResource(resources[0], tablePrice)
+			var extras float64
+			for _, x := range est.extras {
+				extras += x.monthly
+			}
+			if est.sku != tt.sku || math.Abs(est.monthly-tt.monthly) > 0.01 || math.Abs(extras-tt.extras) > 0.01 || est.confidence != tt.confidence {
+				t.Errorf("estimate = %q $%.2f + $%.2f extras (%s), want %q $%.2f + $%.2f (%s)",
+					est.sku, est.monthly, extras, est.confidence, tt.sku, tt.monthly, tt.extras, tt.confidence)
+			}
+		})
+	}
+}
+
+func TestAgent_ServiceCosts(t *testing.T) {
+	tfCode := `resource "azurerm_postgresql_flexible_server" "pg" {
+  sku_name = "GP_Standard_D2s_v3"
+}
+
+resource "azurerm_firewall" "fw" {
+  sku_tier = "Standard"
+}`
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "estimate cost:\n```hcl\n" + tfCode + "\n```"}}}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{"GP_Standard_D2s_v3", "storage", "$129.94", "$912.50"} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("missing %q in:\n%s", want, combined)
+		}
+	}
+	if strings.Contains(combined, "Unknown") {
+		t.Errorf("expected every resource to be priced:\n%s", combined)
+	}
+}
@@ -4,11 +4,16 @@ package deploy
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/approval"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/graph"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/verdict"
 )
 
 // EnvironmentState tracks the deployed version per environment.
@@ -16,22 +21,100 @@ type EnvironmentState struct {
 	Version    string    `json:"version"`
 	DeployedAt time.Time `json:"deployed_at"`
 	Status     string    `json:"status"`
+	// Gates are the promotion gates the version passed, and MonthlyCost
+	// its estimate in Currency when a cost gate ran; later cost gates
+	// compare against it.
+	Gates       []approval.GateResult `json:"gates,omitempty"`
+	MonthlyCost float64               `json:"monthly_cost,omitempty"`
+	Currency    string                `json:"currency,omitempty"`
 }
 
+var versionRe = regexp.MustCompile(`\bv\d+\.\d+\.\d+\b`)
+
 // Agent manages environment promotions and deployments.
 type Agent struct {
-	mu    sync.Mutex
-	state map[string]*EnvironmentState
+	mu       sync.Mutex
+	state    map[string]*EnvironmentState
+	verdicts verdict.Policy
+	checker  *EndpointChecker
+	quotas   *QuotaChecker
+	lock     *DriftLock
+	freezes  []FreezeWindow
+	windows  []ChangeWindow
+	timings  graph.TimingFunc
+	now      func() time.Time
+
+	approvals *approval.Store
+	approvers approval.Approvers
+	notify    NotifyFunc
+	identify  IdentityFunc
+
+	agents AgentLookup
+	gates  []Gate
+
+	// topology is the promotion pipeline, guarded by mu, and topologyFile
+	// where changes to it are saved.
+	topology     Topology
+	topologyFile string
 }
 
 // New creates a new deploy Agent with default environment state.
-func New() *Agent {
-	return &Agent{
+func New(opts ...Option) *Agent {
+	a := &Agent{
 		state: map[string]*EnvironmentState{
 			"dev":     {Version: "v1.0.0", DeployedAt: time.Now().Add(-48 * time.Hour), Status: "deployed"},
 			"staging": {Version: "v0.9.0", DeployedAt: time.Now().Add(-72 * time.Hour), Status: "deployed"},
 			"prod":    {Version: "v0.8.0", DeployedAt: time.Now().Add(-168 * time.Hour), Status: "deployed"},
 		},
+		verdicts: verdict.DefaultPolicy(),
+		now:      time.Now,
+		topology: DefaultTopology(),
+	}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// Option configures a deploy Agent.
+type Option func(*Agent)
+
+// WithVerdictPolicy sets the severity-to-action mapping used to gate
+// promotions when code is attached to the request.
+func WithVerdictPolicy(p verdict.Policy) Option {
+	return func(a *Agent) {
+		a.verdicts = p
+	}
+}
+
+// WithEndpointChecks enables live DNS and certificate checks for custom
+// domains declared in attached code.
+func WithEndpointChecks(c *EndpointChecker) Option {
+	return func(a *Agent) {
+		a.checker = c
+	}
+}
+
+// WithQuotaChecks blocks promotions whose attached code needs more vCPUs
+// than the subscription's compute quota has left.
+func WithQuotaChecks(c *QuotaChecker) Option {
+	return func(a *Agent) {
+		a.quotas = c
+	}
+}
+
+// WithDriftLock re-scans the stack for drift after production promotions.
+func WithDriftLock(l *DriftLock) Option {
+	return func(a *Agent) {
+		a.lock = l
+	}
+}
+
+// WithFreezeWindows blocks promotions into an environment while one of
+// windows covers it.
+func WithFreezeWindows(windows []FreezeWindow) Option {
+	return func(a *Agent) {
+		a.freezes = windows
 	}
 }
 
@@ -41,7 +124,7 @@ func (a *Agent) Metadata() protocol.AgentMetadata {
 	return protocol.AgentMetadata{
 		ID:          "deploy",
 		Name:        "Deployment Manager",
-		Description: "Manages environment promotions (dev -> staging -> prod)",
+		Description: "Manages environment promotions (dev -> staging -> prod by default)",
 		Version:     "1.0.0",
 	}
 }
@@ -52,62 +135,336 @@ func (a *Agent) Capabilities() protocol.AgentCapabilities {
 	}
 }
 
+// Mutates reports whether req promotes, records a promotion or decides on
+// one rather than simulating one, asking for status or listing approvals.
+func (a *Agent) Mutates(req protocol.AgentRequest) bool {
+	msg := strings.ToLower(protocol.PromptText(req))
+	if decisionRe.MatchString(msg) {
+		return true
+	}
+	return !protocol.MatchesAny(msg, "simulate", "simulation", "dry run", "dry-run", "dryrun", "status", "environments", "versions", "approvals")
+}
+
 // Handle processes deployment/promotion requests based on prompt keywords.
-func (a *Agent) Handle(_ context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
+func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
 	msg := strings.ToLower(protocol.PromptText(req))
 
+	// "approve APR-001" and "reject APR-001 because ..." decide on a held
+	// promotion; "pending approvals" lists them.
+	if a.approvals != nil {
+		if m := decisionRe.FindStringSubmatch(protocol.PromptText(req)); m != nil {
+			a.handleDecision(ctx, req, m, emit)
+			return nil
+		}
+		if strings.Contains(msg, "approvals") {
+			a.handleApprovals(emit)
+			return nil
+		}
+	}
+
+	// "simulate promotion to prod" and "dry run" evaluate every gate
+	// without changing environment state.
+	if protocol.MatchesAny(msg, "simulate", "simulation", "dry run", "dry-run", "dryrun") {
+		a.handleSimulate(ctx, req, msg, emit)
+		return nil
+	}
+
 	if protocol.MatchesAny(msg, "status", "environments", "versions") {
 		a.handleStatus(emit)
 		return nil
 	}
 
-	a.handleDeploy(msg, emit)
+	// The approval-gated prod workflow reports completed promotions back,
+	// e.g. "@deploy record promoted to prod".
+	if protocol.MatchesAny(msg, "record", "promoted") {
+		a.handleRecord(msg, req.IaC, emit)
+		return nil
+	}
+
+	if r := a.handleDeploy(ctx, req, msg, emit); r != nil {
+		a.announce(ctx, *r, emit)
+	}
 	return nil
 }
 
-func (a *Agent) handleDeploy(msg string, emit protocol.Emitter) {
+// handleDeploy promotes into the environment named in msg, or returns the
+// approval request it was held as.
+func (a *Agent) handleDeploy(ctx context.Context, req protocol.AgentRequest, msg string, emit protocol.Emitter) *approval.Request {
 	emit.SendMessage("## Deployment Manager\n\n")
+	iac := req.IaC
 
-	target := "dev"
-	if protocol.MatchesAny(msg, "staging", "stage", "test") {
-		target = "staging"
-	} else if protocol.MatchesAny(msg, "prod", "production") {
-		target = "prod"
+	topo := a.Topology()
+	target := topo.target(msg, topo.Environments[0].Name)
+	source, err := topo.source(msg, target)
+	if err != nil {
+		emit.SendMessage(fmt.Sprintf("Promotion refused: %v.\n", err))
+		return nil
 	}
+	env, _ := topo.Get(target)
 
-	source := "dev"
-	if target == "prod" {
-		source = "staging"
+	// Live checks run before taking the lock; they may wait on the network.
+	var endpoints []Endpoint
+	var opsFindings []protocol.Finding
+	if a.checker != nil && iac != nil {
+		endpoints = DeclaredEndpoints(iac.Resources)
+		opsFindings = a.checker.Check(ctx, endpoints)
+	}
+	quota := a.checkQuota(ctx, iac)
+	gates := a.gatesFor(target)
+	runs := a.runGates(ctx, req, target, gates)
+	var requester string
+	if a.approvals != nil && a.identify != nil && req.Token != "" {
+		// An unknown requester only loses the self-approval check.
+		requester, _ = a.identify(ctx, req.Token)
 	}
 
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	sourceState := a.state[source]
+	sourceState := a.stateOf(source)
 
 	emit.SendMessage("### Environment Status\n\n")
 	emit.SendMessage("| Environment | Version | Status |\n")
 	emit.SendMessage("|-------------|---------|--------|\n")
-	for _, env := range []string{"dev", "staging", "prod"} {
-		s := a.state[env]
-		emit.SendMessage(fmt.Sprintf("| %s | %s | %s |\n", env, s.Version, s.Status))
+	for _, name := range topo.Names() {
+		s := a.stateOf(name)
+		emit.SendMessage(fmt.Sprintf("| %s | %s | %s |\n", name, s.Version, s.Status))
 	}
 	emit.SendMessage("\n")
 
-	if target == "prod" {
-		emit.SendMessage("**Production deployment requires manual approval.**\n\n")
+	if sourceState.Version == "" {
+		emit.SendMessage(fmt.Sprintf("Promotion `%s` -> `%s` is **blocked**: nothing is deployed to `%s` yet.\n", source, target, source))
+		return nil
+	}
+
+	if len(endpoints) > 0 {
+		a.emitEndpointChecks(endpoints, opsFindings, emit)
+	}
+
+	if w := a.activeFreeze(target); w != nil {
+		emit.SendMessage(fmt.Sprintf("Promotion `%s` -> `%s` is **blocked** by the change freeze `%s`.\n", source, target, w))
+		return nil
+	}
+
+	if quota.Checked {
+		emit.SendMessage("### Compute Quota\n\n" + quota.Table() + "\n")
+		if quota.Err != nil {
+			emit.SendMessage(fmt.Sprintf("_%v_\n\n", quota.Err))
+		}
+		if quota.Exceeded() {
+			emit.SendMessage(fmt.Sprintf("Promotion `%s` -> `%s` is **blocked**: the deployment needs more vCPUs than the subscription's quota has left. Request a quota increase or reduce the sizes or counts above.\n", source, target))
+			return nil
+		}
+	}
+
+	var checks gateOutcome
+	if len(gates) > 0 {
+		checks = evaluateGates(gates, runs, target, *a.stateOf(target))
+		emit.SendMessage("### Promotion Gates\n\n" + checks.table() + "\n")
+		if failed := checks.failed(); len(failed) > 0 {
+			emit.SendMessage(fmt.Sprintf("Promotion `%s` -> `%s` is **blocked** by its promotion gates: `%s`.\n", source, target, strings.Join(failed, "`, `")))
+			return nil
+		}
+	}
+
+	// Gate the promotion on findings for attached code.
+	gate, analyzed := a.evaluate(iac)
+	if analyzed {
+		emit.SendMessage("### Deployment Gate\n\n" + gate.Summary() + "\n\n")
+	}
+	if gate.Action == verdict.ActionBlock {
+		emit.SendMessage(fmt.Sprintf("Promotion `%s` -> `%s` is **blocked**. Resolve the findings above and retry.\n", source, target))
+		return nil
+	}
+
+	window := a.checkChangeWindow(target, iac)
+	if window.Checked {
+		emit.SendMessage("### Change Window\n\n" + window.Detail + "\n\n")
+	}
+	tooLong := window.Checked && !window.Fits
+
+	if env.Approval || gate.Action == verdict.ActionRequireApproval || tooLong {
+		switch {
+		case env.Approval:
+			emit.SendMessage(fmt.Sprintf("**Promotion to %s always requires manual approval.**\n\n", target))
+		case tooLong:
+			emit.SendMessage(fmt.Sprintf("**Promotion to %s requires manual approval: the change does not fit its change windows.**\n\n", target))
+		default:
+			emit.SendMessage(fmt.Sprintf("**Promotion to %s requires manual approval due to the findings above.**\n\n", target))
+		}
 		emit.SendMessage(fmt.Sprintf("Promotion: `%s` (%s) -> `%s`\n\n", source, sourceState.Version, target))
-		emit.SendMessage("Use the GitHub Actions workflow `deploy-prod.yml` with approval gate.\n")
-		return
+		if a.approvals == nil {
+			emit.SendMessage("Use the GitHub Actions workflow `deploy-prod.yml` with approval gate.\n")
+			return nil
+		}
+		var reasons []string
+		if env.Approval {
+			reasons = append(reasons, "environment")
+		}
+		if gate.Action == verdict.ActionRequireApproval {
+			reasons = append(reasons, "findings")
+		}
+		if tooLong {
+			reasons = append(reasons, "change window")
+		}
+		return a.requestApproval(req, requester, source, target, reasons, checks, emit)
 	}
 
 	emit.SendMessage(fmt.Sprintf("Promoting **%s** -> **%s** (version %s)\n\n", source, target, sourceState.Version))
 	a.state[target] = &EnvironmentState{
-		Version:    sourceState.Version,
-		DeployedAt: time.Now(),
-		Status:     "deployed",
+		Version:     sourceState.Version,
+		DeployedAt:  time.Now(),
+		Status:      "deployed",
+		Gates:       checks.results,
+		MonthlyCost: checks.monthly,
+		Currency:    checks.currency,
 	}
 	emit.SendMessage(fmt.Sprintf("Successfully promoted to **%s** (version %s)\n", target, sourceState.Version))
+	return nil
+}
+
+// handleSimulate runs every promotion gate for the target environment and
+// reports a checklist of what would block or hold the real promotion. It
+// reads environment state but never changes it.
+func (a *Agent) handleSimulate(ctx context.Context, req protocol.AgentRequest, msg string, emit protocol.Emitter) {
+	iac := req.IaC
+	topo := a.Topology()
+	target := topo.target(msg, topo.Last())
+	env, _ := topo.Get(target)
+	source, err := topo.source(msg, target)
+	if err != nil {
+		emit.SendMessage("## Promotion Simulation\n\n")
+		emit.SendMessage(fmt.Sprintf("Promotion refused: %v.\n", err))
+		return
+	}
+	gates := a.gatesFor(target)
+	runs := a.runGates(ctx, req, target, gates)
+
+	a.mu.Lock()
+	from, to := *a.stateOf(source), *a.stateOf(target)
+	signers := a.approversFor(target)
+	a.mu.Unlock()
+
+	emit.SendMessage("## Promotion Simulation\n\n")
+	emit.SendMessage(fmt.Sprintf("Dry run of `%s` (%s) -> `%s` (%s). Nothing was deployed.\n\n", source, from.Version, target, to.Version))
+	emit.SendMessage("| Gate | Result | Details |\n")
+	emit.SendMessage("|------|--------|---------|\n")
+
+	var blockers, approvals []string
+
+	if from.Version == "" {
+		emit.SendMessage(fmt.Sprintf("| Source | ❌ Blocks | Nothing is deployed to `%s` yet |\n", source))
+		blockers = append(blockers, "source")
+	}
+
+	if w := a.activeFreeze(target); w != nil {
+		emit.SendMessage(fmt.Sprintf("| Freeze window | ❌ Blocks | `%s` is frozen (`%s`) |\n", target, w))
+		blockers = append(blockers, "freeze window")
+	} else {
+		emit.SendMessage(fmt.Sprintf("| Freeze window | ✅ Pass | No active freeze for `%s` |\n", target))
+	}
+
+	if a.quotas != nil {
+		switch quota := a.checkQuota(ctx, iac); {
+		case !quota.Checked:
+			emit.SendMessage("| Compute quota | ⚪ Skipped | No virtual machines, scale sets or node pools in attached code |\n")
+		case quota.Exceeded():
+			emit.SendMessage("| Compute quota | ❌ Blocks | " + quota.Summary() + " |\n")
+			blockers = append(blockers, "compute quota")
+		case quota.Err != nil:
+			emit.SendMessage(fmt.Sprintf("| Compute quota | ⚠️ Unknown | %v |\n", quota.Err))
+		default:
+			emit.SendMessage("| Compute quota | ✅ Pass | " + quota.Summary() + " |\n")
+		}
+	}
+
+	gate, analyzed := a.evaluate(iac)
+	switch {
+	case !analyzed:
+		emit.SendMessage("| Analysis verdict | ⚪ Skipped | No code attached; attach the stack to evaluate findings |\n")
+	case gate.Action == verdict.ActionBlock:
+		emit.SendMessage("| Analysis verdict | ❌ Blocks | " + gate.Summary() + " |\n")
+		blockers = append(blockers, "analysis verdict")
+	case gate.Action == verdict.ActionRequireApproval:
+		emit.SendMessage("| Analysis verdict | ⚠️ Approval | " + gate.Summary() + " |\n")
+		approvals = append(approvals, "findings")
+	default:
+		emit.SendMessage("| Analysis verdict | ✅ Pass | " + gate.Summary() + " |\n")
+	}
+
+	for _, r := range evaluateGates(gates, runs, target, to).results {
+		if r.Passed {
+			emit.SendMessage(fmt.Sprintf("| Gate `%s` | ✅ Pass | %s |\n", r.Gate, r.Detail))
+		} else {
+			emit.SendMessage(fmt.Sprintf("| Gate `%s` | ❌ Blocks | %s |\n", r.Gate, r.Detail))
+			blockers = append(blockers, "gate `"+r.Gate+"`")
+		}
+	}
+
+	if len(a.windows) > 0 {
+		switch window := a.checkChangeWindow(target, iac); {
+		case !window.Checked:
+			emit.SendMessage("| Change window | ⚪ Skipped | " + window.Detail + " |\n")
+		case window.Fits:
+			emit.SendMessage("| Change window | ✅ Pass | " + window.Detail + " |\n")
+		default:
+			emit.SendMessage("| Change window | ⚠️ Approval | " + window.Detail + " |\n")
+			approvals = append(approvals, "change window")
+		}
+	}
+
+	signOff := ""
+	if a.approvals != nil {
+		signOff = "; sign-off from " + waitingFor(approval.Request{Approvers: signers})
+	}
+	if env.Approval {
+		if a.approvals != nil {
+			emit.SendMessage(fmt.Sprintf("| Approvals | ⚠️ Required | `%s` always requires manual approval%s |\n", target, signOff))
+		} else {
+			emit.SendMessage(fmt.Sprintf("| Approvals | ⚠️ Required | `%s` always requires manual approval via `deploy-prod.yml` |\n", target))
+		}
+		approvals = append(approvals, "environment")
+	} else if gate.Action == verdict.ActionRequireApproval {
+		emit.SendMessage(fmt.Sprintf("| Approvals | ⚠️ Required | Findings require approval before promoting to `%s`%s |\n", target, signOff))
+	} else {
+		emit.SendMessage("| Approvals | ✅ Pass | No approval required |\n")
+	}
+
+	if from.Version == to.Version {
+		emit.SendMessage(fmt.Sprintf("| Environment diff | ⚠️ No change | `%s` already runs %s |\n", target, to.Version))
+	} else {
+		emit.SendMessage(fmt.Sprintf("| Environment diff | ✅ Pass | %s -> %s |\n", to.Version, from.Version))
+	}
+	emit.SendMessage("\n")
+
+	switch {
+	case len(blockers) > 0:
+		emit.SendMessage(fmt.Sprintf("**Result:** the promotion would be **blocked** by: %s.\n", strings.Join(blockers, ", ")))
+	case len(approvals) > 0:
+		emit.SendMessage("**Result:** the promotion would wait for **manual approval**.\n")
+	default:
+		emit.SendMessage("**Result:** the promotion would **proceed**.\n")
+	}
+}
+
+// evaluate applies the verdict policy to findings for attached code. The
+// second result is false when no code is attached.
+func (a *Agent) evaluate(iac *protocol.IaCInput) (verdict.Verdict, bool) {
+	if iac == nil || len(iac.Resources) == 0 {
+		return verdict.Verdict{Action: verdict.ActionNone}, false
+	}
+	return a.verdicts.Evaluate(analyzer.Run(analyzer.AllRules(), iac.Resources)), true
+}
+
+// activeFreeze returns the freeze window covering env now, or nil.
+func (a *Agent) activeFreeze(env string) *FreezeWindow {
+	now := a.now()
+	for i := range a.freezes {
+		if a.freezes[i].Covers(env, now) {
+			return &a.freezes[i]
+		}
+	}
+	return nil
 }
 
 func (a *Agent) handleStatus(emit protocol.Emitter) {
@@ -118,9 +475,68 @@ func (a *Agent) handleStatus(emit protocol.Emitter) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-	for _, env := range []string{"dev", "staging", "prod"} {
-		s := a.state[env]
+	for _, env := range a.topology.Names() {
+		s := a.stateOf(env)
 		emit.SendMessage(fmt.Sprintf("| %s | %s | %s | %s |\n",
 			env, s.Version, s.DeployedAt.Format("2006-01-02 15:04"), s.Status))
 	}
+
+	// The promotion record: gates each version passed on its way in.
+	heading := "\n### Promotion Gates Passed\n\n"
+	for _, env := range a.topology.Names() {
+		s := a.stateOf(env)
+		if len(s.Gates) == 0 {
+			continue
+		}
+		names := make([]string, len(s.Gates))
+		for i, g := range s.Gates {
+			names[i] = g.Gate
+		}
+		cost := ""
+		if s.Currency != "" {
+			cost = fmt.Sprintf(", estimated at %.2f %s/month", s.MonthlyCost, s.Currency)
+		}
+		emit.SendMessage(fmt.Sprintf("%s- **%s** %s: `%s`%s\n", heading, env, s.Version, strings.Join(names, "`, `"), cost))
+		heading = ""
+	}
+}
+
+func (a *Agent) emitEndpointChecks(endpoints []Endpoint, findings []protocol.Finding, emit protocol.Emitter) {
+	emit.SendMessage("### Endpoint Checks\n\n")
+	if len(findings) == 0 {
+		emit.SendMessage(fmt.Sprintf("All %d custom domain(s) resolve and serve certificates valid beyond the expiry window.\n\n", len(endpoints)))
+		return
+	}
+	emit.SendMessage("| Rule | Severity | Resource | Issue |\n")
+	emit.SendMessage("|------|----------|----------|-------|\n")
+	for _, f := range findings {
+		emit.SendMessage(fmt.Sprintf("| %s | %s | %s | %s |\n", f.RuleID, f.Severity, f.Resource, f.Message))
+	}
+	emit.SendMessage("\n")
+	protocol.ReportFindings(emit, a.ID(), findings)
+}
+
+func (a *Agent) handleRecord(msg string, iac *protocol.IaCInput, emit protocol.Emitter) {
+	emit.SendMessage("## Deployment Manager\n\n")
+
+	a.mu.Lock()
+	last := a.topology.Last()
+	target := a.topology.target(msg, last)
+	version := versionRe.FindString(msg)
+	if version == "" {
+		version = a.stateOf(a.topology.Sources(target)[0]).Version
+	}
+	a.state[target] = &EnvironmentState{Version: version, DeployedAt: time.Now(), Status: "deployed"}
+	a.mu.Unlock()
+
+	emit.SendMessage(fmt.Sprintf("Recorded **%s** at version %s.\n\n", target, version))
+	if target != last || a.lock == nil {
+		return
+	}
+	if iac == nil || len(iac.Resources) == 0 {
+		emit.SendMessage("_Attach the stack's code to arm the post-promotion drift lock._\n")
+		return
+	}
+	a.lock.Arm(target, version, iac)
+	emit.SendMessage(fmt.Sprintf("Drift lock armed: %d resource(s) will be re-scanned at %s; early drift raises an alert.\n", len(iac.Resources), a.lock.Describe()))
 }
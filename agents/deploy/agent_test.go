@@ -2,11 +2,24 @@ package deploy
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/ghcp-iac/ghcp-iac-workflow/agents/compliance"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/approval"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/trend"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/verdict"
 )
 
 func TestAgent_ID(t *testing.T) {
@@ -72,6 +85,846 @@ func TestAgent_Status(t *testing.T) {
 	}
 }
 
+func TestAgent_Mutates(t *testing.T) {
+	a := New()
+	tests := map[string]bool{
+		"promote to staging":             true,
+		"record promoted to prod v1.2.3": true,
+		"simulate promotion to prod":     false,
+		"environment status":             false,
+		"pending approvals":              false,
+		"approve APR-001":                true,
+	}
+	for prompt, want := range tests {
+		if got := a.Mutates(protocol.AgentRequest{Prompt: prompt}); got != want {
+			t.Errorf("Mutates(%q) = %v, want %v", prompt, got, want)
+		}
+	}
+}
+
+func TestAgent_ApprovalWorkflow(t *testing.T) {
+	store, _ := approval.NewStore("")
+	approvers, _ := approval.ParseApprovers("prod:alice,prod:bob")
+	var notes []string
+	logins := map[string]string{"t-dave": "dave", "t-alice": "alice", "t-bob": "bob", "t-carol": "carol"}
+	a := New(WithApprovals(store, approvers),
+		WithApprovalNotifier(func(_ context.Context, title, _ string) error {
+			notes = append(notes, title)
+			return nil
+		}),
+		WithIdentity(func(_ context.Context, token string) (string, error) {
+			if login, ok := logins[token]; ok {
+				return login, nil
+			}
+			return "", errors.New("bad credentials")
+		}))
+	say := func(token, prompt string) string {
+		rec := &prototest.Recorder{}
+		req := protocol.AgentRequest{Token: token, Messages: []protocol.Message{{Role: "user", Content: prompt}}}
+		if err := a.Handle(context.Background(), req, rec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return strings.Join(rec.Messages, "")
+	}
+
+	out := say("t-dave", "deploy to production")
+	if !strings.Contains(out, "Approval request **APR-001** is waiting for @alice, @bob") || strings.Contains(out, "deploy-prod.yml") {
+		t.Fatalf("expected an approval request:\n%s", out)
+	}
+	if r, ok := store.Get("APR-001"); !ok || r.Requester != "dave" || r.Version != "v0.9.0" || len(r.Reasons) != 1 || r.Reasons[0] != "environment" {
+		t.Errorf("request = %+v", r)
+	}
+	if len(notes) != 1 || notes[0] != "Promotion APR-001 to prod awaits approval" {
+		t.Errorf("notifications = %v", notes)
+	}
+	if out := say("", "pending approvals"); !strings.Contains(out, "| APR-001 | staging -> prod | v0.9.0 | environment | @alice, @bob |") {
+		t.Errorf("expected APR-001 pending:\n%s", out)
+	}
+
+	for token, want := range map[string]string{
+		"":        "Use `POST /approvals` instead",
+		"t-bad":   "bad credentials",
+		"t-carol": "not an approver",
+		"t-dave":  "not an approver",
+	} {
+		if out := say(token, "approve APR-001"); !strings.Contains(out, want) {
+			t.Errorf("approve as %q: expected %q:\n%s", token, want, out)
+		}
+	}
+	// POST /approvals: the approver is the token's owner, so a caller
+	// cannot forge a required approver's name.
+	for token, want := range map[string]error{"": ErrUnidentified, "alice": ErrUnidentified, "t-carol": approval.ErrNotApprover} {
+		if _, err := a.DecideAs(context.Background(), "APR-001", token, true, ""); !errors.Is(err, want) {
+			t.Errorf("DecideAs(%q) = %v, want %v", token, err, want)
+		}
+	}
+	if out := say("t-alice", "approve apr-001"); !strings.Contains(out, "still waiting for @bob") {
+		t.Errorf("expected partial approval:\n%s", out)
+	}
+	if a.state["prod"].Version != "v0.8.0" {
+		t.Error("promoted before every approver signed off")
+	}
+	if out := say("t-bob", "Approve APR-001 looks good"); !strings.Contains(out, "promoted **staging** -> **prod** (version v0.9.0)") {
+		t.Errorf("expected promotion:\n%s", out)
+	}
+	if r, _ := store.Get("APR-001"); a.state["prod"].Version != "v0.9.0" || r.Status != approval.StatusApproved || r.Decisions[1].Comment != "looks good" {
+		t.Errorf("prod = %+v, request = %+v", a.state["prod"], r)
+	}
+	if len(notes) != 2 || notes[1] != "Promotion APR-001 approved" {
+		t.Errorf("notifications = %v", notes)
+	}
+
+	say("t-dave", "deploy to production")
+	if _, err := a.Decide(context.Background(), "APR-002", "alice", false, "bad timing"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Decide(context.Background(), "APR-002", "bob", true, ""); !errors.Is(err, approval.ErrNotPending) {
+		t.Errorf("decision on rejected request: %v", err)
+	}
+	if _, err := a.Decide(context.Background(), "APR-404", "bob", true, ""); !errors.Is(err, approval.ErrNotFound) {
+		t.Errorf("decision on missing request: %v", err)
+	}
+}
+
+func TestAgent_ApprovalNotSaved(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	os.Mkdir(dir, 0o755)
+	store, err := approval.NewStore(filepath.Join(dir, "approvals.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	approvers, _ := approval.ParseApprovers("prod:alice")
+	a := New(WithApprovals(store, approvers))
+	r, _ := store.Submit(approval.Request{Source: "staging", Target: "prod", Version: "v0.9.0", Approvers: []string{"alice"}})
+
+	os.RemoveAll(dir)
+	if _, err := a.Decide(context.Background(), r.ID, "alice", true, ""); err == nil {
+		t.Fatal("approval succeeded without being saved")
+	}
+	if got, _ := store.Get(r.ID); got.Status != approval.StatusPending || a.state["prod"].Version != "v0.8.0" {
+		t.Errorf("after a failed save: request %s, prod at %s", got.Status, a.state["prod"].Version)
+	}
+
+	os.Mkdir(dir, 0o755)
+	if got, err := a.Decide(context.Background(), r.ID, "alice", true, ""); err != nil || got.Status != approval.StatusApproved || a.state["prod"].Version != "v0.9.0" {
+		t.Errorf("retried approval = %+v, %v; prod at %s", got, err, a.state["prod"].Version)
+	}
+}
+
+func TestAgent_ApprovalHonoursFreeze(t *testing.T) {
+	freezes, _ := ParseFreezeWindows("staging:2027-01-01..2027-01-02")
+	store, _ := approval.NewStore("")
+	a := New(WithApprovals(store, nil), WithFreezeWindows(freezes),
+		WithVerdictPolicy(verdict.Policy{Actions: map[protocol.Severity]verdict.Action{protocol.SeverityHigh: verdict.ActionRequireApproval}}))
+	a.now = func() time.Time { return time.Date(2026, 12, 31, 12, 0, 0, 0, time.UTC) }
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "deploy to staging"}},
+		IaC: &protocol.IaCInput{Resources: []protocol.Resource{{
+			Type: "azurerm_storage_account", Name: "sa",
+			Properties: map[string]interface{}{"enable_https_traffic_only": false},
+		}}},
+	}
+	if err := a.Handle(context.Background(), req, &prototest.Recorder{}); err != nil {
+		t.Fatal(err)
+	}
+	r, ok := store.Get("APR-001")
+	if !ok || len(r.Reasons) != 1 || r.Reasons[0] != "findings" {
+		t.Fatalf("request = %+v", r)
+	}
+
+	a.now = func() time.Time { return time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC) }
+	if _, err := a.Decide(context.Background(), "APR-001", "alice", true, ""); !errors.Is(err, ErrFrozen) {
+		t.Errorf("approval during freeze: %v", err)
+	}
+	a.now = func() time.Time { return time.Date(2027, 1, 3, 0, 0, 0, 0, time.UTC) }
+	if r, err := a.Decide(context.Background(), "APR-001", "alice", true, ""); err != nil || r.Status != approval.StatusApproved || a.state["staging"].Version != r.Version {
+		t.Errorf("approval after freeze = %+v, %v", r, err)
+	}
+}
+
 func TestAgent_ImplementsAgent(t *testing.T) {
 	var _ protocol.Agent = (*Agent)(nil)
 }
+
+func TestAgent_PromotionGatedByFindings(t *testing.T) {
+	iac := &protocol.IaCInput{
+		Format: protocol.FormatTerraform,
+		Resources: []protocol.Resource{{
+			Type: "azurerm_storage_account", Name: "sa",
+			Properties: map[string]interface{}{"enable_https_traffic_only": false},
+		}},
+	}
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "deploy to staging"}},
+		IaC:      iac,
+	}
+
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if !strings.Contains(combined, "**blocked**") || strings.Contains(combined, "Successfully") {
+		t.Errorf("expected blocked promotion, got:\n%s", combined)
+	}
+
+	lenient := verdict.Policy{Actions: map[protocol.Severity]verdict.Action{"critical": verdict.ActionNotify, "high": verdict.ActionNotify, "medium": verdict.ActionNotify}}
+	rec = &prototest.Recorder{}
+	if err := New(WithVerdictPolicy(lenient)).Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(strings.Join(rec.Messages, ""), "Successfully") {
+		t.Error("expected promotion to proceed under a notify-only policy")
+	}
+}
+
+func TestDeclaredEndpoints(t *testing.T) {
+	resources := []protocol.Resource{
+		{Type: "azurerm_app_service_custom_hostname_binding", Name: "www", Properties: map[string]interface{}{"hostname": "www.contoso.com"}},
+		{Type: "azurerm_app_service_custom_hostname_binding", Name: "bicep", Properties: map[string]interface{}{"name": "app/API.contoso.com"}},
+		{Type: "azurerm_cdn_frontdoor_custom_domain", Name: "fd", Properties: map[string]interface{}{"host_name": "var.domain"}},
+		{Type: "azurerm_storage_account", Name: "sa"},
+	}
+	endpoints := DeclaredEndpoints(resources)
+	if len(endpoints) != 2 {
+		t.Fatalf("endpoints = %+v, want 2 (unresolved reference skipped)", endpoints)
+	}
+	if endpoints[1].Host != "api.contoso.com" {
+		t.Errorf("bicep host = %q", endpoints[1].Host)
+	}
+}
+
+func TestAgent_EndpointChecks(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	checker := NewEndpointChecker(0)
+	checker.now = func() time.Time { return now }
+	checker.lookupHost = func(_ context.Context, host string) ([]string, error) {
+		if host == "missing.contoso.com" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"203.0.113.10"}, nil
+	}
+	checker.certExpiry = func(_ context.Context, host string) (time.Time, error) {
+		if host == "soon.contoso.com" {
+			return now.Add(10 * 24 * time.Hour), nil
+		}
+		return now.Add(200 * 24 * time.Hour), nil
+	}
+
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "deploy to staging"}},
+		IaC: &protocol.IaCInput{Resources: []protocol.Resource{
+			{Type: "azurerm_cdn_frontdoor_custom_domain", Name: "ok", Properties: map[string]interface{}{"host_name": "ok.contoso.com"}},
+			{Type: "azurerm_cdn_frontdoor_custom_domain", Name: "soon", Properties: map[string]interface{}{"host_name": "soon.contoso.com"}},
+			{Type: "azurerm_cdn_frontdoor_custom_domain", Name: "missing", Properties: map[string]interface{}{"host_name": "missing.contoso.com"}},
+		}},
+	}
+	rec := &prototest.Recorder{}
+	if err := New(WithEndpointChecks(checker)).Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{"### Endpoint Checks", "OPS-001", "expires in 10 day(s)"} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("expected %q in output:\n%s", want, combined)
+		}
+	}
+	if strings.Contains(combined, "ok.contoso.com") {
+		t.Error("healthy endpoint should not be reported")
+	}
+}
+
+func TestAgent_RecordProdArmsDriftLock(t *testing.T) {
+	type scheduled struct {
+		d  time.Duration
+		fn func(context.Context)
+	}
+	var jobs []scheduled
+	schedule := func(_ string, d time.Duration, fn func(context.Context)) {
+		jobs = append(jobs, scheduled{d, fn})
+	}
+	scans := 0
+	scan := func(_ context.Context, iac *protocol.IaCInput) ([]protocol.Finding, error) {
+		scans++
+		if scans == 1 {
+			return nil, nil
+		}
+		return []protocol.Finding{{Resource: "sa", ResourceType: "azurerm_storage_account", Message: "min_tls_version is TLS1_0, expected TLS1_2", Severity: "high"}}, nil
+	}
+	var alerts []string
+	alert := func(_ context.Context, title, text string) error {
+		alerts = append(alerts, title+"\n"+text)
+		return nil
+	}
+
+	a := New(WithDriftLock(NewDriftLock(schedule, scan, alert, nil)))
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "record promoted to prod v0.9.1"}},
+		IaC:      &protocol.IaCInput{Resources: []protocol.Resource{{Type: "azurerm_storage_account", Name: "sa"}}},
+	}
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if !strings.Contains(combined, "Recorded **prod** at version v0.9.1") || !strings.Contains(combined, "T+1h, T+24h") {
+		t.Errorf("unexpected output:\n%s", combined)
+	}
+	if len(jobs) != 2 || jobs[0].d != time.Hour || jobs[1].d != 24*time.Hour {
+		t.Fatalf("scheduled = %+v, want checks at 1h and 24h", jobs)
+	}
+
+	jobs[0].fn(context.Background())
+	if len(alerts) != 0 {
+		t.Error("clean scan should not alert")
+	}
+	jobs[1].fn(context.Background())
+	if len(alerts) != 1 || !strings.Contains(alerts[0], "Early drift on prod (v0.9.1)") || !strings.Contains(alerts[0], "24h after promoting") {
+		t.Errorf("alerts = %q", alerts)
+	}
+}
+
+func TestAgent_SimulatePromotion(t *testing.T) {
+	freezes, err := ParseFreezeWindows("prod:2026-12-20..2027-01-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(WithFreezeWindows(freezes))
+	a.now = func() time.Time { return time.Date(2027, 1, 2, 18, 0, 0, 0, time.UTC) }
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "simulate promotion to prod"}},
+		IaC: &protocol.IaCInput{Resources: []protocol.Resource{{
+			Type: "azurerm_storage_account", Name: "sa",
+			Properties: map[string]interface{}{"enable_https_traffic_only": false},
+		}}},
+	}
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{"Nothing was deployed", "| Freeze window | ❌ Blocks", "| Analysis verdict | ❌ Blocks", "| Approvals | ⚠️ Required", "v0.8.0 -> v0.9.0", "blocked** by: freeze window, analysis verdict"} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("expected %q in output:\n%s", want, combined)
+		}
+	}
+	if got := a.state["prod"].Version; got != "v0.8.0" {
+		t.Errorf("simulation changed prod to %s", got)
+	}
+
+	// The real promotion honours the same freeze.
+	rec = &prototest.Recorder{}
+	req = protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "deploy to production"}}}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(strings.Join(rec.Messages, ""), "change freeze `prod:2026-12-20..2027-01-02`") {
+		t.Errorf("expected freeze block, got:\n%s", strings.Join(rec.Messages, ""))
+	}
+
+	a.now = func() time.Time { return time.Date(2027, 1, 3, 0, 0, 0, 0, time.UTC) }
+	rec = &prototest.Recorder{}
+	req = protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "dry run promotion to staging"}}}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined = strings.Join(rec.Messages, "")
+	if !strings.Contains(combined, "would **proceed**") || !strings.Contains(combined, "| Analysis verdict | ⚪ Skipped") {
+		t.Errorf("expected staging dry run to proceed:\n%s", combined)
+	}
+}
+
+func TestAgent_ChangeWindows(t *testing.T) {
+	windows, err := ParseChangeWindows("staging:sat 02:00-03:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "deploy to staging"}},
+		IaC:      &protocol.IaCInput{Resources: []protocol.Resource{{Type: "azurerm_kubernetes_cluster", Name: "aks"}}},
+	}
+	lenient := verdict.Policy{Actions: map[protocol.Severity]verdict.Action{}}
+	run := func(opts ...Option) string {
+		rec := &prototest.Recorder{}
+		if err := New(append(opts, WithVerdictPolicy(lenient), WithChangeWindows(windows))...).Handle(context.Background(), req, rec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return strings.Join(rec.Messages, "")
+	}
+
+	out := run()
+	if !strings.Contains(out, "Needs 30m (~10m apply); fits `staging:sat 02:00-03:00` (1h)") || !strings.Contains(out, "Successfully") {
+		t.Errorf("expected the change to fit the window:\n%s", out)
+	}
+
+	slow := func(string, string) (time.Duration, int) { return 40 * time.Minute, 5 }
+	out = run(WithApplyTimings(slow))
+	if !strings.Contains(out, "Needs 1h15m (~40m apply) but the longest `staging` window is 1h") ||
+		!strings.Contains(out, "does not fit its change windows") || strings.Contains(out, "Successfully") {
+		t.Errorf("expected approval for a change longer than the window:\n%s", out)
+	}
+
+	req.Messages[0].Content = "simulate promotion to staging"
+	out = run(WithApplyTimings(slow))
+	if !strings.Contains(out, "| Change window | ⚠️ Approval |") || !strings.Contains(out, "wait for **manual approval**") {
+		t.Errorf("expected the simulation to flag the window:\n%s", out)
+	}
+}
+
+func TestParseChangeWindows(t *testing.T) {
+	windows, err := ParseChangeWindows("prod:sat 22:00-04:00, mon-fri 09:00-17:30")
+	if err != nil || len(windows) != 2 {
+		t.Fatalf("windows = %v, %v", windows, err)
+	}
+	if windows[0].Length != 6*time.Hour || windows[0].From != time.Saturday || windows[0].String() != "prod:sat 22:00-04:00" {
+		t.Errorf("overnight window = %+v", windows[0])
+	}
+	if windows[1].Env != "" || windows[1].From != time.Monday || windows[1].To != time.Friday || windows[1].Length != 8*time.Hour+30*time.Minute {
+		t.Errorf("weekday window = %+v", windows[1])
+	}
+	for _, bad := range []string{"q_a:sat 01:00-02:00", "someday 01:00-02:00", "sat", "sat 25:00-02:00"} {
+		if _, err := ParseChangeWindows(bad); err == nil {
+			t.Errorf("ParseChangeWindows(%q) should fail", bad)
+		}
+	}
+}
+
+func TestParseFreezeWindows(t *testing.T) {
+	windows, err := ParseFreezeWindows("prod:2026-12-20..2027-01-02, 2026-11-26..2026-11-26")
+	if err != nil || len(windows) != 2 {
+		t.Fatalf("windows = %v, %v", windows, err)
+	}
+	if windows[1].Env != "" || !windows[1].Covers("dev", time.Date(2026, 11, 26, 23, 0, 0, 0, time.UTC)) {
+		t.Errorf("all-environment window = %+v", windows[1])
+	}
+	for _, bad := range []string{"q_a:2026-01-01..2026-01-02", "2026-01-02..2026-01-01", "2026-01-01"} {
+		if _, err := ParseFreezeWindows(bad); err == nil {
+			t.Errorf("ParseFreezeWindows(%q) should fail", bad)
+		}
+	}
+}
+
+func TestVMSize(t *testing.T) {
+	for size, want := range map[string]struct {
+		vcpus  int
+		family string
+	}{
+		"Standard_D8s_v5":    {8, "standardDSv5Family"},
+		"Standard_D16ads_v5": {16, "standardDADSv5Family"},
+		"Standard_E8-4s_v5":  {8, "standardESv5Family"},
+		"Standard_DS2_v2":    {2, "standardDSv2Family"},
+		"Standard_B2ms":      {2, "standardBSFamily"},
+		"Standard_NC6s_v3":   {6, "standardNCSv3Family"},
+	} {
+		vcpus, family, ok := VMSize(size)
+		if !ok || vcpus != want.vcpus || family != want.family {
+			t.Errorf("VMSize(%s) = %d, %s, %v; want %d, %s", size, vcpus, family, ok, want.vcpus, want.family)
+		}
+	}
+	if _, _, ok := VMSize("${var.size}"); ok {
+		t.Error("expression parsed as a size")
+	}
+}
+
+func TestComputeDemands(t *testing.T) {
+	resources := []protocol.Resource{
+		{Type: "azurerm_linux_virtual_machine", Name: "app", Properties: map[string]interface{}{"size": "Standard_D8s_v5", "location": "East US"}},
+		{Type: "azurerm_linux_virtual_machine_scale_set", Name: "web", Properties: map[string]interface{}{"sku": "Standard_D4s_v5", "instances": 4, "location": "eastus"}},
+		{Type: "azurerm_kubernetes_cluster", Name: "aks", Properties: map[string]interface{}{
+			"location":          "westeurope",
+			"default_node_pool": map[string]interface{}{"vm_size": "Standard_D4s_v5", "node_count": 3},
+		}},
+		{Type: "azurerm_kubernetes_cluster_node_pool", Name: "gpu", Properties: map[string]interface{}{
+			"kubernetes_cluster_id": "azurerm_kubernetes_cluster.aks.id", "vm_size": "Standard_NC6s_v3", "node_count": 1, "max_count": 2,
+		}},
+		{Type: "azurerm_windows_virtual_machine", Name: "jump", Properties: map[string]interface{}{"size": "Standard_B2ms", "location": "${var.location}"}},
+		// Unchanged in the plan: already counted in current usage.
+		{Type: "azurerm_linux_virtual_machine", Name: "old", Properties: map[string]interface{}{"size": "Standard_D8s_v5", "location": "eastus"},
+			Change: &protocol.Change{Action: protocol.ActionNoOp}},
+		// Scale-up from 2 to 5 instances adds 3.
+		{Type: "azurerm_linux_virtual_machine_scale_set", Name: "api", Properties: map[string]interface{}{"sku": "Standard_D2s_v5", "instances": 5, "location": "eastus"},
+			Change: &protocol.Change{Action: protocol.ActionUpdate, Before: map[string]interface{}{"sku": "Standard_D2s_v5", "instances": 2}}},
+	}
+	got := ComputeDemands(resources, "")
+	want := []QuotaDemand{
+		{Location: "eastus", Family: "standardDSv5Family", VCPUs: 8 + 16 + 6, Resources: []string{"app", "web", "api"}},
+		{Location: "westeurope", Family: "standardDSv5Family", VCPUs: 12, Resources: []string{"aks"}},
+		{Location: "westeurope", Family: "standardNCSv3Family", VCPUs: 12, Resources: []string{"gpu"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ComputeDemands = %+v\nwant %+v", got, want)
+	}
+	if got := ComputeDemands(resources, "northeurope"); len(got) != 4 || got[1].Location != "northeurope" || got[1].Family != "standardBSFamily" {
+		t.Errorf("with default location = %+v", got)
+	}
+}
+
+func TestAgent_QuotaGate(t *testing.T) {
+	var lookups []string
+	fetch := func(_ context.Context, location string) ([]Usage, error) {
+		lookups = append(lookups, location)
+		if location == "westus" {
+			return nil, errors.New("forbidden")
+		}
+		return []Usage{
+			{Name: "cores", Current: 60, Limit: 100},
+			{Name: "standardDSv5Family", Current: 84, Limit: 100},
+		}, nil
+	}
+	a := New(WithQuotaChecks(NewQuotaChecker(fetch, "eastus")))
+	iac := &protocol.IaCInput{Resources: []protocol.Resource{{
+		Type: "azurerm_linux_virtual_machine_scale_set", Name: "web",
+		Properties: map[string]interface{}{"sku": "Standard_D8s_v5", "instances": 5, "encryption_at_host_enabled": true},
+	}}}
+
+	rec := &prototest.Recorder{}
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "deploy to staging"}}, IaC: iac}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{"### Compute Quota", "| eastus | standardDSv5Family | 40 vCPUs (web) | 16 | ❌ short by 24 |", "| eastus | Total regional vCPUs | 40 vCPUs (web) | 40 | ✅ |", "is **blocked**"} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("expected %q in output:\n%s", want, combined)
+		}
+	}
+	if got := a.state["staging"].Version; got == a.state["dev"].Version {
+		t.Error("blocked promotion was applied")
+	}
+
+	rec = &prototest.Recorder{}
+	req.Messages[0].Content = "simulate promotion to staging"
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if combined := strings.Join(rec.Messages, ""); !strings.Contains(combined, "| Compute quota | ❌ Blocks | Needs 40 vCPUs of standardDSv5Family in eastus; only 16 remain |") {
+		t.Errorf("expected quota blocker in simulation:\n%s", combined)
+	}
+
+	// A region whose quota cannot be read is noted but does not block.
+	iac.Resources[0].Properties["location"] = "westus"
+	rec = &prototest.Recorder{}
+	req.Messages[0].Content = "deploy to staging"
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined = strings.Join(rec.Messages, "")
+	if !strings.Contains(combined, "quota lookup failed for westus: forbidden") || strings.Contains(combined, "is **blocked**") {
+		t.Errorf("expected lookup failure note without block:\n%s", combined)
+	}
+}
+
+type staticToken string
+
+func (s staticToken) Token(context.Context, string) (string, error) { return string(s), nil }
+
+func TestComputeUsages_Fetch(t *testing.T) {
+	calls := 0
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			t.Errorf("authorization = %q", r.Header.Get("Authorization"))
+		}
+		if r.URL.Query().Get("page") == "2" {
+			fmt.Fprint(w, `{"value": [{"name": {"value": "standardDSv5Family"}, "currentValue": 84, "limit": 100}]}`)
+			return
+		}
+		if r.URL.Path != "/subscriptions/sub-1/providers/Microsoft.Compute/locations/eastus/usages" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		fmt.Fprintf(w, `{"value": [{"name": {"value": "cores"}, "currentValue": 60, "limit": 100}], "nextLink": "%s/next?page=2"}`, srv.URL)
+	}))
+	defer srv.Close()
+
+	u := NewComputeUsages(staticToken("tok"), "sub-1", srv.URL)
+	got, err := u.Fetch(context.Background(), "eastus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Usage{{Name: "cores", Current: 60, Limit: 100}, {Name: "standardDSv5Family", Current: 84, Limit: 100}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("usages = %+v", got)
+	}
+	if _, err := u.Fetch(context.Background(), "eastus"); err != nil || calls != 2 {
+		t.Errorf("cached fetch made %d calls: %v", calls, err)
+	}
+}
+
+func TestParseGates(t *testing.T) {
+	gates, err := ParseGates("security=critical, policy=HIGH, compliance=80, prod:compliance=90%, cost_delta=10%, staging:cost_delta=250")
+	if err != nil || len(gates) != 6 {
+		t.Fatalf("gates = %v, %v", gates, err)
+	}
+	if gates[1].Severity != protocol.SeverityHigh || gates[3].Env != "prod" || gates[3].MinScore != 90 || !gates[4].Percent || gates[5].MaxDelta != 250 {
+		t.Errorf("gates = %+v", gates)
+	}
+	a := New(WithPromotionGates(nil, gates))
+	var got []string
+	for _, g := range a.gatesFor("prod") {
+		got = append(got, g.String())
+	}
+	if want := []string{"security=critical", "policy=HIGH", "prod:compliance=90%", "cost_delta=10%"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("prod gates = %v, want %v", got, want)
+	}
+	for _, bad := range []string{"security", "q_a:security=high", "security=severe", "compliance=120", "cost_delta=-5", "latency=1s", "compliance=80,compliance=90"} {
+		if _, err := ParseGates(bad); err == nil {
+			t.Errorf("ParseGates(%q) should fail", bad)
+		}
+	}
+}
+
+// stubAgent reports fixed results the way the agents promotion gates run
+// do.
+type stubAgent struct {
+	id       string
+	findings []protocol.Finding
+	costs    []protocol.CostItem
+	scores   map[string]int
+	env      string
+}
+
+func (s *stubAgent) ID() string                               { return s.id }
+func (s *stubAgent) Metadata() protocol.AgentMetadata         { return protocol.AgentMetadata{ID: s.id} }
+func (s *stubAgent) Capabilities() protocol.AgentCapabilities { return protocol.AgentCapabilities{} }
+func (s *stubAgent) Handle(_ context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
+	s.env = req.Metadata[protocol.MetaEnvironment]
+	protocol.ReportFindings(emit, s.id, s.findings)
+	protocol.ReportCosts(emit, s.id, s.costs)
+	protocol.ReportScores(emit, s.id, s.scores)
+	return nil
+}
+
+func TestAgent_PromotionGates(t *testing.T) {
+	security := &stubAgent{id: "security", findings: []protocol.Finding{{RuleID: "SEC-002", Severity: protocol.SeverityHigh}}}
+	compliance := &stubAgent{id: "compliance", scores: map[string]int{"overall": 85}}
+	cost := &stubAgent{id: "cost", costs: []protocol.CostItem{{Name: "aks", Monthly: 80, Currency: "USD"}, {Name: "sa", Monthly: 20, Currency: "USD"}}}
+	agents := map[string]protocol.Agent{"security": security, "compliance": compliance, "cost": cost}
+	gates, err := ParseGates("security=critical,compliance=80,cost_delta=10%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(WithVerdictPolicy(verdict.Policy{Actions: map[protocol.Severity]verdict.Action{}}),
+		WithPromotionGates(func(id string) (protocol.Agent, bool) {
+			agent, ok := agents[id]
+			return agent, ok
+		}, gates))
+	iac := &protocol.IaCInput{Resources: []protocol.Resource{{Type: "azurerm_kubernetes_cluster", Name: "aks"}}}
+	run := func(prompt string, iac *protocol.IaCInput) string {
+		rec := &prototest.Recorder{}
+		req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: prompt}}, IaC: iac}
+		if err := a.Handle(context.Background(), req, rec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return strings.Join(rec.Messages, "")
+	}
+
+	out := run("deploy to staging", iac)
+	for _, want := range []string{
+		"| `security=critical` | ✅ Pass | No security finding at critical or above |",
+		"| `compliance=80` | ✅ Pass | Score 85% (minimum 80%) |",
+		"| `cost_delta=10%` | ✅ Pass | 100.00 USD/month; `staging` has no earlier gated estimate to compare with |",
+		"Successfully promoted to **staging**",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if s := a.state["staging"]; len(s.Gates) != 3 || s.MonthlyCost != 100 || s.Currency != "USD" || cost.env != "staging" {
+		t.Errorf("staging = %+v, cost estimated for %q", s, cost.env)
+	}
+	if out := run("environment status", nil); !strings.Contains(out, "- **staging** v1.0.0: `security=critical`, `compliance=80`, `cost_delta=10%`, estimated at 100.00 USD/month") {
+		t.Errorf("expected the promotion record in status:\n%s", out)
+	}
+
+	// 120 a month is 20% over what staging runs now.
+	cost.costs[1].Monthly = 40
+	out = run("deploy to staging", iac)
+	if !strings.Contains(out, "| `cost_delta=10%` | ❌ Fail | 120.00 USD/month, +20.00 USD (+20%) over `staging` (limit +10%) |") ||
+		!strings.Contains(out, "is **blocked** by its promotion gates: `cost_delta=10%`") || strings.Contains(out, "Successfully") {
+		t.Errorf("expected the cost gate to block:\n%s", out)
+	}
+
+	cost.costs[1].Monthly = 20
+	security.findings = append(security.findings, protocol.Finding{RuleID: "SEC-001", Severity: protocol.SeverityCritical})
+	compliance.scores = map[string]int{"overall": 70}
+	out = run("simulate promotion to staging", iac)
+	for _, want := range []string{
+		"| Gate `security=critical` | ❌ Blocks | 1 security finding(s) at critical or above: SEC-001 |",
+		"| Gate `compliance=80` | ❌ Blocks | Score 70% (minimum 80%) |",
+		"blocked** by: gate `security=critical`, gate `compliance=80`",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+
+	if out := run("deploy to staging", nil); !strings.Contains(out, "No code attached") || strings.Contains(out, "Successfully") {
+		t.Errorf("expected gates to block a promotion without code:\n%s", out)
+	}
+	delete(agents, "compliance")
+	if out := run("deploy to staging", iac); !strings.Contains(out, "Could not run: the compliance agent is not registered") {
+		t.Errorf("expected a missing agent to fail its gate:\n%s", out)
+	}
+}
+
+func TestAgent_ApprovalRecordsGates(t *testing.T) {
+	store, _ := approval.NewStore("")
+	cost := &stubAgent{id: "cost", costs: []protocol.CostItem{{Monthly: 50, Currency: "EUR"}}}
+	gates, _ := ParseGates("prod:cost_delta=100")
+	a := New(WithApprovals(store, nil), WithPromotionGates(func(id string) (protocol.Agent, bool) { return cost, id == "cost" }, gates))
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "deploy to production"}},
+		IaC:      &protocol.IaCInput{Resources: []protocol.Resource{{Type: "azurerm_resource_group", Name: "rg"}}},
+	}
+	if err := a.Handle(context.Background(), req, &prototest.Recorder{}); err != nil {
+		t.Fatal(err)
+	}
+	r, ok := store.Get("APR-001")
+	if !ok || len(r.Gates) != 1 || !r.Gates[0].Passed || r.MonthlyCost != 50 || r.Currency != "EUR" {
+		t.Fatalf("request = %+v", r)
+	}
+	if _, err := a.Decide(context.Background(), "APR-001", "alice", true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if s := a.state["prod"]; len(s.Gates) != 1 || s.Gates[0].Gate != "prod:cost_delta=100" || s.MonthlyCost != 50 || s.Currency != "EUR" {
+		t.Errorf("prod = %+v", s)
+	}
+}
+
+func TestAgent_GateRunsAddNoTrend(t *testing.T) {
+	trends, _ := trend.NewFileStore("")
+	audits := compliance.New(compliance.WithTrends(trends))
+	gates, _ := ParseGates("compliance=0")
+	a := New(WithPromotionGates(func(id string) (protocol.Agent, bool) { return audits, id == "compliance" }, gates))
+	req := protocol.AgentRequest{
+		Prompt:   "deploy to staging:\n```hcl\nresource \"azurerm_storage_account\" \"sa\" {\n  name = \"sa\"\n  min_tls_version = \"TLS1_2\"\n}\n```",
+		Metadata: map[string]string{protocol.MetaRepository: "org/app"},
+	}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	if out := strings.Join(rec.Messages, ""); !strings.Contains(out, "| `compliance=0` | ✅ Pass |") {
+		t.Fatalf("expected the compliance gate to run:\n%s", out)
+	}
+	if got, _ := trends.Audits(trend.Query{}); len(got) != 0 {
+		t.Errorf("gate run recorded trend points: %+v", got)
+	}
+}
+
+func TestParseTopology(t *testing.T) {
+	topo, err := ParseTopology([]byte(`{"environments":[
+		{"name":"dev"},
+		{"name":"QA"},
+		{"name":"preprod","aliases":["pre"],"from":["qa","dev"]},
+		{"name":"prod","from":["preprod"],"approval":true,"approvers":["@carol"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(topo.Names(), ","); got != "dev,qa,preprod,prod" || topo.Last() != "prod" {
+		t.Errorf("names = %s", got)
+	}
+	if src := topo.Sources("qa"); len(src) != 1 || src[0] != "dev" {
+		t.Errorf("qa sources = %v", src)
+	}
+	if src := topo.Sources("dev"); len(src) != 1 || src[0] != "dev" {
+		t.Errorf("dev sources = %v", src)
+	}
+	for msg, want := range map[string]string{
+		"deploy to pre":                "preprod",
+		"promote qa into prod":         "prod",
+		"promote from dev to preprod":  "preprod",
+		"promote qa":                   "qa",
+		"deploy the latest build":      "dev",
+		"promote from qa":              "dev",
+		"deploy to production, please": "dev",
+	} {
+		if got := topo.target(msg, "dev"); got != want {
+			t.Errorf("target(%q) = %s, want %s", msg, got, want)
+		}
+	}
+	if src, err := topo.source("promote from dev to preprod", "preprod"); err != nil || src != "dev" {
+		t.Errorf("source = %s, %v", src, err)
+	}
+	if _, err := topo.source("promote from dev to prod", "prod"); err == nil || !strings.Contains(err.Error(), "promoted from `preprod`") {
+		t.Errorf("expected a refused path: %v", err)
+	}
+
+	for _, bad := range []string{
+		`{"environments":[]}`,
+		`{"environments":[{"name":"dev"},{"name":"dev"}]}`,
+		`{"environments":[{"name":"dev"},{"name":"prod","aliases":["dev"]}]}`,
+		`{"environments":[{"name":"q_a"}]}`,
+		`{"environments":[{"name":"dev","from":["prod"]},{"name":"prod"}]}`,
+		`{"environments":[{"name":"dev"},{"name":"prod","from":["prod"]}]}`,
+		`{"environments":[{"name":"dev","approvals":true}]}`,
+	} {
+		if _, err := ParseTopology([]byte(bad)); !errors.Is(err, ErrInvalidTopology) {
+			t.Errorf("ParseTopology(%s) = %v, want invalid", bad, err)
+		}
+	}
+}
+
+func TestAgent_Topology(t *testing.T) {
+	topo, err := ParseTopology([]byte(`{"environments":[
+		{"name":"dev"},{"name":"qa"},{"name":"preprod"},
+		{"name":"prod","approval":true,"approvers":["carol"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "environments.json")
+	store, _ := approval.NewStore("")
+	approvers, _ := approval.ParseApprovers("prod:dave")
+	a := New(WithTopology(topo, path), WithApprovals(store, approvers))
+	say := func(prompt string) string {
+		rec := &prototest.Recorder{}
+		req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: prompt}}}
+		if err := a.Handle(context.Background(), req, rec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return strings.Join(rec.Messages, "")
+	}
+
+	if out := say("deploy to preprod"); !strings.Contains(out, "nothing is deployed to `qa` yet") {
+		t.Errorf("expected an empty source to block:\n%s", out)
+	}
+	if out := say("deploy to qa"); !strings.Contains(out, "Successfully promoted to **qa** (version v1.0.0)") {
+		t.Errorf("expected a promotion from dev:\n%s", out)
+	}
+	if out := say("promote from dev to preprod"); !strings.Contains(out, "`preprod` cannot be promoted from `dev`") {
+		t.Errorf("expected a refused path:\n%s", out)
+	}
+	say("deploy to preprod")
+	say("deploy to prod")
+	if r, ok := store.Get("APR-001"); !ok || r.Source != "preprod" || len(r.Approvers) != 2 || r.Approvers[0] != "carol" || r.Approvers[1] != "dave" {
+		t.Errorf("request = %+v", r)
+	}
+	if out := say("environment status"); !strings.Contains(out, "| qa | v1.0.0 |") || strings.Contains(out, "| staging |") {
+		t.Errorf("expected the topology's environments:\n%s", out)
+	}
+
+	if _, err := a.AddEnvironment(Environment{Name: "qa"}, ""); !errors.Is(err, ErrEnvironmentExists) {
+		t.Errorf("duplicate add: %v", err)
+	}
+	if _, err := a.AddEnvironment(Environment{Name: "canary", From: []string{"preprod"}}, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.DeleteEnvironment("qa"); !errors.Is(err, ErrEnvironmentInUse) {
+		t.Errorf("delete of a promotion source: %v", err)
+	}
+	if _, err := a.PutEnvironment(Environment{Name: "prod", From: []string{"canary", "preprod"}, Approval: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.PutEnvironment(Environment{Name: "dev", From: []string{"prod"}}); !errors.Is(err, ErrInvalidTopology) {
+		t.Errorf("backward promotion path: %v", err)
+	}
+	saved, err := ReadTopology(path)
+	if err != nil || strings.Join(saved.Names(), ",") != "dev,qa,preprod,canary,prod" || saved.Sources("prod")[0] != "canary" {
+		t.Errorf("saved topology = %+v, %v", saved, err)
+	}
+	if envs := a.Environments(); len(envs) != 5 || envs[3].State.Status != "not deployed" {
+		t.Errorf("environments = %+v", envs)
+	}
+}
@@ -0,0 +1,236 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/approval"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// NotifyFunc sends a message to the people who approve promotions.
+type NotifyFunc func(ctx context.Context, title, text string) error
+
+// IdentityFunc returns the GitHub login of a caller's token.
+type IdentityFunc func(ctx context.Context, token string) (string, error)
+
+// WithApprovals holds promotions that need approval as requests in store
+// until the approvers of their target environment have signed off; an
+// environment without approvers needs any one approval.
+func WithApprovals(store *approval.Store, approvers approval.Approvers) Option {
+	return func(a *Agent) {
+		a.approvals = store
+		a.approvers = approvers
+	}
+}
+
+// WithApprovalNotifier tells approvers about new requests and their
+// outcome.
+func WithApprovalNotifier(notify NotifyFunc) Option {
+	return func(a *Agent) {
+		a.notify = notify
+	}
+}
+
+// WithIdentity resolves the caller of a chat request, who is recorded as a
+// promotion's requester and who approves or rejects in chat.
+func WithIdentity(identify IdentityFunc) Option {
+	return func(a *Agent) {
+		a.identify = identify
+	}
+}
+
+// decisionRe matches "approve APR-001" and "reject APR-001 because ...".
+var decisionRe = regexp.MustCompile(`(?i)\b(approve|reject)\s+(APR-\d+)\b[\s:,.-]*(?:because\s+)?(.*)`)
+
+// requestApproval records a promotion held for approval. It is called
+// with a.mu held; announce tells the approvers once it is released.
+func (a *Agent) requestApproval(req protocol.AgentRequest, requester, source, target string, reasons []string, checks gateOutcome, emit protocol.Emitter) *approval.Request {
+	r, err := a.approvals.Submit(approval.Request{
+		Source: source, Target: target, Version: a.stateOf(source).Version,
+		Reasons:     reasons,
+		Repository:  req.Metadata[protocol.MetaRepository],
+		Requester:   requester,
+		Approvers:   a.approversFor(target),
+		Gates:       checks.results,
+		MonthlyCost: checks.monthly,
+		Currency:    checks.currency,
+	})
+	if err != nil {
+		emit.SendMessage(fmt.Sprintf("_The approval request could not be saved: %v_\n", err))
+		return nil
+	}
+	emit.SendMessage(fmt.Sprintf("Approval request **%s** is waiting for %s. Approve with `@deploy approve %s` or `POST /approvals`; the promotion proceeds once every required approver has signed off.\n",
+		r.ID, waitingFor(r), r.ID))
+	return &r
+}
+
+// announce tells the approvers about a new request.
+func (a *Agent) announce(ctx context.Context, r approval.Request, emit protocol.Emitter) {
+	if a.notify == nil {
+		return
+	}
+	text := fmt.Sprintf("`%s` (%s) -> `%s` needs approval (%s) from %s. Reply `@deploy approve %s` or `@deploy reject %s`.",
+		r.Source, r.Version, r.Target, strings.Join(r.Reasons, ", "), waitingFor(r), r.ID, r.ID)
+	if r.Repository != "" {
+		text = fmt.Sprintf("`%s`: %s", r.Repository, text)
+	}
+	if err := a.notify(ctx, fmt.Sprintf("Promotion %s to %s awaits approval", r.ID, r.Target), text); err != nil {
+		emit.SendMessage(fmt.Sprintf("_Approvers could not be notified: %v_\n", err))
+	}
+}
+
+// waitingFor names the approvers a pending request waits for.
+func waitingFor(r approval.Request) string {
+	waiting := r.Waiting()
+	if len(waiting) == 0 {
+		return "any approver"
+	}
+	return "@" + strings.Join(waiting, ", @")
+}
+
+// ErrUnidentified is returned by DecideAs when the caller's GitHub login
+// cannot be resolved from their token.
+var ErrUnidentified = errors.New("caller's GitHub identity is unknown")
+
+// DecideAs records the decision of the caller whose GitHub token is token,
+// as a chat decision does. Callers cannot name the approver they decide as.
+func (a *Agent) DecideAs(ctx context.Context, id, token string, approve bool, comment string) (approval.Request, error) {
+	if a.identify == nil || token == "" {
+		return approval.Request{}, ErrUnidentified
+	}
+	login, err := a.identify(ctx, token)
+	if err != nil {
+		return approval.Request{}, fmt.Errorf("%w: %v", ErrUnidentified, err)
+	}
+	return a.Decide(ctx, id, login, approve, comment)
+}
+
+// ErrFrozen is returned by Decide for an approval that would complete a
+// promotion into an environment under a change freeze.
+var ErrFrozen = errors.New("environment is frozen")
+
+// Decide records an approver's decision on a promotion request. The
+// approval that completes a request promotes its version into the target
+// environment.
+func (a *Agent) Decide(ctx context.Context, id, approver string, approve bool, comment string) (approval.Request, error) {
+	if a.approvals == nil {
+		return approval.Request{}, fmt.Errorf("%s: %w", id, approval.ErrNotFound)
+	}
+	r, err := a.decide(id, approval.Decision{Approver: approver, Approved: approve, Comment: comment})
+	if err != nil {
+		return r, err
+	}
+	switch r.Status {
+	case approval.StatusApproved:
+		a.tellOutcome(ctx, r, fmt.Sprintf("Promotion %s approved", r.ID),
+			fmt.Sprintf("`%s` is now at %s: approved by @%s.", r.Target, r.Version, approverList(r)))
+	case approval.StatusRejected:
+		reason := ""
+		if comment != "" {
+			reason = ": " + comment
+		}
+		a.tellOutcome(ctx, r, fmt.Sprintf("Promotion %s rejected", r.ID),
+			fmt.Sprintf("@%s rejected promoting %s to `%s`%s", approver, r.Version, r.Target, reason))
+	}
+	return r, nil
+}
+
+// decide records d and, when it completes the request, promotes.
+func (a *Agent) decide(id string, d approval.Decision) (approval.Request, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	r, ok := a.approvals.Get(id)
+	if !ok {
+		return approval.Request{}, fmt.Errorf("%s: %w", id, approval.ErrNotFound)
+	}
+	next, err := approval.Apply(r, d)
+	if err != nil {
+		return r, err
+	}
+	if next.Status == approval.StatusApproved {
+		if w := a.activeFreeze(r.Target); w != nil {
+			return r, fmt.Errorf("%s: %w by `%s`; approve again once it ends", r.Target, ErrFrozen, w)
+		}
+	}
+	if r, err = a.approvals.Decide(id, d); err != nil {
+		return r, err
+	}
+	if r.Status == approval.StatusApproved {
+		a.state[r.Target] = &EnvironmentState{
+			Version: r.Version, DeployedAt: a.now(), Status: "deployed",
+			Gates: r.Gates, MonthlyCost: r.MonthlyCost, Currency: r.Currency,
+		}
+	}
+	return r, nil
+}
+
+func approverList(r approval.Request) string {
+	var names []string
+	for _, d := range r.Decisions {
+		if d.Approved {
+			names = append(names, d.Approver)
+		}
+	}
+	return strings.Join(names, ", @")
+}
+
+// tellOutcome notifies approvers of a resolved request. Decisions made
+// through the API have no chat to report a failure in, so it is dropped.
+func (a *Agent) tellOutcome(ctx context.Context, r approval.Request, title, text string) {
+	if a.notify == nil {
+		return
+	}
+	if r.Repository != "" {
+		text = fmt.Sprintf("`%s`: %s", r.Repository, text)
+	}
+	_ = a.notify(ctx, title, text)
+}
+
+// handleDecision approves or rejects a request in chat, as the caller.
+func (a *Agent) handleDecision(ctx context.Context, req protocol.AgentRequest, m []string, emit protocol.Emitter) {
+	emit.SendMessage("## Deployment Manager\n\n")
+	id, approve, comment := strings.ToUpper(m[2]), strings.EqualFold(m[1], "approve"), strings.TrimSpace(m[3])
+	if a.identify == nil || req.Token == "" {
+		emit.SendMessage(fmt.Sprintf("Deciding on **%s** in chat needs your GitHub identity, which this request does not carry. Use `POST /approvals` instead.\n", id))
+		return
+	}
+	login, err := a.identify(ctx, req.Token)
+	if err != nil {
+		emit.SendMessage(fmt.Sprintf("Could not identify you to record the decision on **%s**: %v\n", id, err))
+		return
+	}
+	r, err := a.Decide(ctx, id, login, approve, comment)
+	if err != nil {
+		emit.SendMessage(fmt.Sprintf("Could not record the decision on **%s**: %v\n", id, err))
+		return
+	}
+	switch r.Status {
+	case approval.StatusApproved:
+		emit.SendMessage(fmt.Sprintf("Approved **%s**. Every required approver has signed off: promoted **%s** -> **%s** (version %s).\n", r.ID, r.Source, r.Target, r.Version))
+	case approval.StatusRejected:
+		emit.SendMessage(fmt.Sprintf("Rejected **%s**: the promotion to %s will not proceed.\n", r.ID, r.Target))
+	default:
+		emit.SendMessage(fmt.Sprintf("Approved **%s**; still waiting for %s.\n", r.ID, waitingFor(r)))
+	}
+}
+
+// handleApprovals lists the pending approval requests.
+func (a *Agent) handleApprovals(emit protocol.Emitter) {
+	emit.SendMessage("## Pending Approvals\n\n")
+	pending := a.approvals.List(approval.StatusPending)
+	if len(pending) == 0 {
+		emit.SendMessage("No promotions are waiting for approval.\n")
+		return
+	}
+	emit.SendMessage("| Request | Promotion | Version | Reasons | Waiting for | Requested |\n")
+	emit.SendMessage("|---------|-----------|---------|---------|-------------|-----------|\n")
+	for _, r := range pending {
+		emit.SendMessage(fmt.Sprintf("| %s | %s -> %s | %s | %s | %s | %s |\n",
+			r.ID, r.Source, r.Target, r.Version, strings.Join(r.Reasons, ", "), waitingFor(r), r.Created.Format(time.RFC3339)))
+	}
+}
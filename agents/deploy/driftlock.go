@@ -0,0 +1,95 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// DefaultDriftLockChecks are the delays after a production promotion at
+// which the promoted stack is re-scanned for drift.
+var DefaultDriftLockChecks = []time.Duration{time.Hour, 24 * time.Hour}
+
+// DriftScanFunc scans a stack for drift.
+type DriftScanFunc func(ctx context.Context, iac *protocol.IaCInput) ([]protocol.Finding, error)
+
+// AlertFunc delivers an alert with the given title and markdown body.
+type AlertFunc func(ctx context.Context, title, text string) error
+
+// ScheduleFunc runs fn once after d. *scheduler.Scheduler's After method
+// satisfies it.
+type ScheduleFunc func(name string, d time.Duration, fn func(ctx context.Context))
+
+// DriftLock re-scans a stack shortly after it is promoted to production and
+// alerts when drift appears, which usually means a manual hotfix was made
+// outside the pipeline.
+type DriftLock struct {
+	schedule ScheduleFunc
+	scan     DriftScanFunc
+	alert    AlertFunc
+	checks   []time.Duration
+}
+
+// NewDriftLock creates a DriftLock. Nil or empty checks use
+// DefaultDriftLockChecks.
+func NewDriftLock(schedule ScheduleFunc, scan DriftScanFunc, alert AlertFunc, checks []time.Duration) *DriftLock {
+	if len(checks) == 0 {
+		checks = DefaultDriftLockChecks
+	}
+	return &DriftLock{schedule: schedule, scan: scan, alert: alert, checks: checks}
+}
+
+// Arm schedules the drift checks for a promotion of version to env.
+func (l *DriftLock) Arm(env, version string, iac *protocol.IaCInput) {
+	for _, d := range l.checks {
+		l.schedule(fmt.Sprintf("drift-lock-%s-%s-%s", env, version, shortDuration(d)), d, func(ctx context.Context) {
+			l.check(ctx, env, version, d, iac)
+		})
+	}
+}
+
+// Describe returns the check delays, e.g. "T+1h, T+24h".
+func (l *DriftLock) Describe() string {
+	parts := make([]string, len(l.checks))
+	for i, d := range l.checks {
+		parts[i] = "T+" + shortDuration(d)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func shortDuration(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	if d%time.Minute == 0 {
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return d.String()
+}
+
+func (l *DriftLock) check(ctx context.Context, env, version string, after time.Duration, iac *protocol.IaCInput) {
+	findings, err := l.scan(ctx, iac)
+	if err != nil {
+		log.Printf("drift lock: %s %s scan at T+%s failed: %v", env, version, shortDuration(after), err)
+		return
+	}
+	if len(findings) == 0 {
+		log.Printf("drift lock: %s %s clean at T+%s", env, version, shortDuration(after))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%d drift(s) detected on **%s** %s after promoting %s. Check for manual hotfixes made outside the pipeline.\n\n", len(findings), env, shortDuration(after), version))
+	sb.WriteString("| Resource | Issue | Severity |\n|----------|-------|----------|\n")
+	for _, f := range findings {
+		sb.WriteString(fmt.Sprintf("| %s.%s | %s | %s |\n", f.ResourceType, f.Resource, f.Message, f.Severity))
+	}
+	title := fmt.Sprintf("Early drift on %s (%s)", env, version)
+	if err := l.alert(ctx, title, sb.String()); err != nil {
+		log.Printf("drift lock: alert for %s %s failed: %v", env, version, err)
+	}
+}
@@ -0,0 +1,142 @@
+package deploy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// DefaultCertExpiryWindow is how far ahead certificate expiry is flagged.
+const DefaultCertExpiryWindow = 30 * 24 * time.Hour
+
+const endpointCheckTimeout = 5 * time.Second
+
+// Endpoint is a custom domain declared by a resource.
+type Endpoint struct {
+	Host         string
+	Resource     string
+	ResourceType string
+}
+
+// DeclaredEndpoints returns the custom domains bound by App Service hostname
+// bindings and Front Door custom domains. Hostnames that are still variable
+// references or interpolations are skipped.
+func DeclaredEndpoints(resources []protocol.Resource) []Endpoint {
+	var endpoints []Endpoint
+	for _, res := range resources {
+		var host string
+		switch res.Type {
+		case "azurerm_app_service_custom_hostname_binding":
+			host, _ = res.Properties["hostname"].(string)
+			if host == "" {
+				// Bicep: name: 'site/www.contoso.com' or name: 'www.contoso.com'
+				name, _ := res.Properties["name"].(string)
+				host = name[strings.LastIndex(name, "/")+1:]
+			}
+		case "azurerm_cdn_frontdoor_custom_domain":
+			host, _ = res.Properties["host_name"].(string)
+		default:
+			continue
+		}
+		if !isLiteralHost(host) {
+			continue
+		}
+		endpoints = append(endpoints, Endpoint{Host: strings.ToLower(host), Resource: res.Name, ResourceType: res.Type})
+	}
+	return endpoints
+}
+
+func isLiteralHost(h string) bool {
+	return strings.Contains(h, ".") && !strings.HasPrefix(h, "var.") && !strings.ContainsAny(h, "${}() ")
+}
+
+// EndpointChecker performs live DNS and TLS certificate checks.
+type EndpointChecker struct {
+	window     time.Duration
+	now        func() time.Time
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+	certExpiry func(ctx context.Context, host string) (time.Time, error)
+}
+
+// NewEndpointChecker creates a checker that flags certificates expiring
+// within window. A non-positive window uses DefaultCertExpiryWindow.
+func NewEndpointChecker(window time.Duration) *EndpointChecker {
+	if window <= 0 {
+		window = DefaultCertExpiryWindow
+	}
+	return &EndpointChecker{
+		window:     window,
+		now:        time.Now,
+		lookupHost: net.DefaultResolver.LookupHost,
+		certExpiry: leafCertExpiry,
+	}
+}
+
+// leafCertExpiry returns the NotAfter of the certificate served on port 443.
+// Verification is left to the handshake so an invalid chain is reported as
+// a failure rather than silently accepted.
+func leafCertExpiry(ctx context.Context, host string) (time.Time, error) {
+	d := &tls.Dialer{Config: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, "443"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer conn.Close()
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return time.Time{}, errors.New("no peer certificate")
+	}
+	return certs[0].NotAfter, nil
+}
+
+// Check resolves each endpoint and inspects its certificate, returning
+// operational findings. Endpoints that pass produce no finding.
+func (c *EndpointChecker) Check(ctx context.Context, endpoints []Endpoint) []protocol.Finding {
+	var findings []protocol.Finding
+	for _, ep := range endpoints {
+		f := protocol.Finding{Category: "Operational", Resource: ep.Resource, ResourceType: ep.ResourceType}
+
+		lctx, cancel := context.WithTimeout(ctx, endpointCheckTimeout)
+		_, err := c.lookupHost(lctx, ep.Host)
+		cancel()
+		if err != nil {
+			f.RuleID, f.Severity = "OPS-001", protocol.SeverityMedium
+			f.Message = fmt.Sprintf("DNS for `%s` does not resolve", ep.Host)
+			f.Remediation = "Create the CNAME or A record (and asuid/_dnsauth TXT validation record) before binding the domain"
+			findings = append(findings, f)
+			continue
+		}
+
+		cctx, cancel := context.WithTimeout(ctx, endpointCheckTimeout)
+		notAfter, err := c.certExpiry(cctx, ep.Host)
+		cancel()
+		if err != nil {
+			f.RuleID, f.Severity = "OPS-003", protocol.SeverityMedium
+			f.Message = fmt.Sprintf("TLS handshake with `%s` failed: %v", ep.Host, err)
+			f.Remediation = "Bind a valid certificate for the hostname or enable a managed certificate"
+			findings = append(findings, f)
+			continue
+		}
+
+		remaining := notAfter.Sub(c.now())
+		switch {
+		case remaining <= 0:
+			f.RuleID, f.Severity = "OPS-002", protocol.SeverityHigh
+			f.Message = fmt.Sprintf("Certificate for `%s` expired on %s", ep.Host, notAfter.Format("2006-01-02"))
+		case remaining < c.window:
+			f.RuleID, f.Severity = "OPS-002", protocol.SeverityMedium
+			f.Message = fmt.Sprintf("Certificate for `%s` expires in %d day(s) on %s", ep.Host, int(remaining.Hours()/24), notAfter.Format("2006-01-02"))
+		default:
+			continue
+		}
+		f.Remediation = "Renew or rotate the certificate, or switch to a managed certificate with auto-renewal"
+		findings = append(findings, f)
+	}
+	return findings
+}
@@ -0,0 +1,73 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FreezeWindow is a period during which promotions into an environment are
+// blocked, e.g. over a holiday change freeze.
+type FreezeWindow struct {
+	// Env is the frozen environment; empty freezes every environment.
+	Env   string
+	Start time.Time
+	// End is exclusive.
+	End time.Time
+}
+
+// Covers reports whether the window freezes env at t.
+func (w FreezeWindow) Covers(env string, t time.Time) bool {
+	if w.Env != "" && w.Env != env {
+		return false
+	}
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// String formats the window the way ParseFreezeWindows reads it.
+func (w FreezeWindow) String() string {
+	s := w.Start.Format("2006-01-02") + ".." + w.End.AddDate(0, 0, -1).Format("2006-01-02")
+	if w.Env != "" {
+		s = w.Env + ":" + s
+	}
+	return s
+}
+
+// ParseFreezeWindows parses a comma-separated list of windows in the form
+// "[env:]YYYY-MM-DD..YYYY-MM-DD", e.g. "prod:2026-12-20..2027-01-02". Both
+// days are inclusive and interpreted in UTC.
+func ParseFreezeWindows(s string) ([]FreezeWindow, error) {
+	var windows []FreezeWindow
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var w FreezeWindow
+		span := entry
+		if env, rest, ok := strings.Cut(entry, ":"); ok {
+			w.Env, span = strings.ToLower(strings.TrimSpace(env)), rest
+			if !validEnvName(w.Env) {
+				return nil, fmt.Errorf("freeze window %q: invalid environment %q", entry, w.Env)
+			}
+		}
+		from, to, ok := strings.Cut(span, "..")
+		if !ok {
+			return nil, fmt.Errorf("freeze window %q: expected [env:]YYYY-MM-DD..YYYY-MM-DD", entry)
+		}
+		start, err := time.Parse("2006-01-02", strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("freeze window %q: invalid start date", entry)
+		}
+		end, err := time.Parse("2006-01-02", strings.TrimSpace(to))
+		if err != nil {
+			return nil, fmt.Errorf("freeze window %q: invalid end date", entry)
+		}
+		if end.Before(start) {
+			return nil, fmt.Errorf("freeze window %q: end is before start", entry)
+		}
+		w.Start, w.End = start, end.AddDate(0, 0, 1)
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
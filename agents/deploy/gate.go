@@ -0,0 +1,325 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/approval"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/trend"
+)
+
+// AgentLookup resolves the agents promotion gates run, by ID.
+type AgentLookup func(id string) (protocol.Agent, bool)
+
+// WithPromotionGates runs other agents on the release's code before each
+// promotion and blocks it unless every gate for the target environment
+// passes. Results are recorded with the environment once it is promoted.
+func WithPromotionGates(lookup AgentLookup, gates []Gate) Option {
+	return func(a *Agent) {
+		a.agents = lookup
+		a.gates = gates
+	}
+}
+
+// gateKinds lists the gates in the order they run, with the agent each
+// asks.
+var gateKinds = []struct{ kind, agent string }{
+	{"security", "security"},
+	{"policy", "policy"},
+	{"compliance", "compliance"},
+	{"cost_delta", "cost"},
+}
+
+func gateAgent(kind string) string {
+	for _, k := range gateKinds {
+		if k.kind == kind {
+			return k.agent
+		}
+	}
+	return ""
+}
+
+// Gate is a pre-promotion check another agent runs on the release's code,
+// e.g. "security=critical" or "prod:compliance=90".
+type Gate struct {
+	// Env is the environment; empty applies to every environment without
+	// a gate of the same kind of its own.
+	Env  string
+	Kind string
+	// Severity fails security and policy gates on a finding this severe
+	// or worse.
+	Severity protocol.Severity
+	// MinScore is the lowest overall compliance score that passes.
+	MinScore int
+	// MaxDelta is the largest growth of the monthly cost estimate over the
+	// target environment's that passes; a percentage when Percent is set.
+	MaxDelta float64
+	Percent  bool
+	spec     string
+}
+
+// String formats the gate the way ParseGates reads it.
+func (g Gate) String() string { return g.spec }
+
+// ParseGates parses a comma-separated list of gates in the form
+// "[env:]gate=value". "security=critical" and "policy=high" fail on a
+// finding at or above the severity, "compliance=80" below that overall
+// compliance score, and "cost_delta=200" or "cost_delta=10%" when the
+// monthly estimate grows by more than that over the target environment's.
+func ParseGates(s string) ([]Gate, error) {
+	var gates []Gate
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		g := Gate{spec: entry}
+		rule := entry
+		if env, rest, ok := strings.Cut(entry, ":"); ok {
+			g.Env, rule = strings.ToLower(strings.TrimSpace(env)), rest
+			if !validEnvName(g.Env) {
+				return nil, fmt.Errorf("gate %q: invalid environment %q", entry, g.Env)
+			}
+		}
+		kind, value, ok := strings.Cut(rule, "=")
+		g.Kind, value = strings.ToLower(strings.TrimSpace(kind)), strings.TrimSpace(value)
+		if !ok || value == "" {
+			return nil, fmt.Errorf("gate %q: expected [env:]gate=value", entry)
+		}
+		switch g.Kind {
+		case "security", "policy":
+			sev, ok := protocol.ParseSeverity(value)
+			if !ok {
+				return nil, fmt.Errorf("gate %q: unknown severity %q", entry, value)
+			}
+			g.Severity = sev
+		case "compliance":
+			n, err := strconv.Atoi(strings.TrimSuffix(value, "%"))
+			if err != nil || n < 0 || n > 100 {
+				return nil, fmt.Errorf("gate %q: compliance score must be 0-100", entry)
+			}
+			g.MinScore = n
+		case "cost_delta":
+			g.Percent = strings.HasSuffix(value, "%")
+			n, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("gate %q: cost delta must be a non-negative amount or percentage", entry)
+			}
+			g.MaxDelta = n
+		default:
+			return nil, fmt.Errorf("gate %q: unknown gate %q (want security, policy, compliance or cost_delta)", entry, g.Kind)
+		}
+		key := g.Env + ":" + g.Kind
+		if seen[key] {
+			return nil, fmt.Errorf("gate %q: %s is already gated", entry, strings.TrimPrefix(key, ":"))
+		}
+		seen[key] = true
+		gates = append(gates, g)
+	}
+	return gates, nil
+}
+
+// gatesFor returns the gates of env: its own of each kind, or else the
+// one for every environment.
+func (a *Agent) gatesFor(env string) []Gate {
+	var out []Gate
+	for _, k := range gateKinds {
+		var pick *Gate
+		for i := range a.gates {
+			g := &a.gates[i]
+			if g.Kind != k.kind {
+				continue
+			}
+			if g.Env == env {
+				pick = g
+				break
+			}
+			if g.Env == "" {
+				pick = g
+			}
+		}
+		if pick != nil {
+			out = append(out, *pick)
+		}
+	}
+	return out
+}
+
+// gateRecorder keeps what an agent run by a gate reports, dropping its
+// chat text.
+type gateRecorder struct {
+	err      error
+	findings []protocol.Finding
+	costs    []protocol.CostItem
+	scores   map[string]int
+}
+
+func (r *gateRecorder) SendMessage(string)                      {}
+func (r *gateRecorder) SendReferences([]protocol.Reference)     {}
+func (r *gateRecorder) SendConfirmation(protocol.Confirmation)  {}
+func (r *gateRecorder) SendError(string)                        {}
+func (r *gateRecorder) SendDone()                               {}
+func (r *gateRecorder) ReportScores(_ string, s map[string]int) { r.scores = s }
+func (r *gateRecorder) ReportCosts(_ string, i []protocol.CostItem) {
+	r.costs = append(r.costs, i...)
+}
+func (r *gateRecorder) ReportFindings(_ string, f []protocol.Finding) {
+	r.findings = append(r.findings, f...)
+}
+
+// runGates runs the agents gates need on the request's code, each once,
+// keyed by agent ID. It returns nil when no code is attached. The agents
+// estimate for the target environment and do not get the caller's token,
+// so they skip their LLM summaries. Runs are marked as probes, so they add
+// no compliance trend points.
+func (a *Agent) runGates(ctx context.Context, req protocol.AgentRequest, target string, gates []Gate) map[string]*gateRecorder {
+	if len(gates) == 0 || req.IaC == nil || len(req.IaC.Resources) == 0 {
+		return nil
+	}
+	sub := req
+	sub.Token = ""
+	sub.Metadata = make(map[string]string, len(req.Metadata)+2)
+	for k, v := range req.Metadata {
+		sub.Metadata[k] = v
+	}
+	sub.Metadata[protocol.MetaEnvironment] = target
+	sub.Metadata[protocol.MetaProbe] = "gate"
+	runs := make(map[string]*gateRecorder)
+	for _, g := range gates {
+		id := gateAgent(g.Kind)
+		if runs[id] != nil {
+			continue
+		}
+		rec := &gateRecorder{}
+		runs[id] = rec
+		agent, ok := a.agents(id)
+		if !ok {
+			rec.err = fmt.Errorf("the %s agent is not registered", id)
+			continue
+		}
+		rec.err = agent.Handle(ctx, sub, rec)
+	}
+	return runs
+}
+
+// gateOutcome is the result of a promotion's gates, with the release's
+// monthly cost estimate when a cost gate ran.
+type gateOutcome struct {
+	results  []approval.GateResult
+	monthly  float64
+	currency string
+}
+
+// failed returns the gates that did not pass.
+func (o gateOutcome) failed() []string {
+	var out []string
+	for _, r := range o.results {
+		if !r.Passed {
+			out = append(out, r.Gate)
+		}
+	}
+	return out
+}
+
+func (o gateOutcome) table() string {
+	var sb strings.Builder
+	sb.WriteString("| Gate | Result | Details |\n")
+	sb.WriteString("|------|--------|---------|\n")
+	for _, r := range o.results {
+		result := "✅ Pass"
+		if !r.Passed {
+			result = "❌ Fail"
+		}
+		sb.WriteString(fmt.Sprintf("| `%s` | %s | %s |\n", r.Gate, result, r.Detail))
+	}
+	return sb.String()
+}
+
+// evaluateGates judges gates on the agents' runs. Cost deltas are measured
+// against the estimate recorded when current, the target environment,
+// was last promoted through a cost gate.
+func evaluateGates(gates []Gate, runs map[string]*gateRecorder, target string, current EnvironmentState) gateOutcome {
+	var out gateOutcome
+	for _, g := range gates {
+		res := approval.GateResult{Gate: g.String()}
+		run := runs[gateAgent(g.Kind)]
+		switch {
+		case run == nil:
+			res.Detail = "No code attached; attach the release's code to run the gate"
+		case run.err != nil:
+			res.Detail = fmt.Sprintf("Could not run: %v", run.err)
+		case g.Kind == "compliance":
+			score, ok := run.scores[trend.Overall]
+			if !ok {
+				res.Passed, res.Detail = true, "No applicable controls to score"
+				break
+			}
+			res.Passed = score >= g.MinScore
+			res.Detail = fmt.Sprintf("Score %d%% (minimum %d%%)", score, g.MinScore)
+		case g.Kind == "cost_delta":
+			out.monthly, out.currency = 0, "USD"
+			for _, it := range run.costs {
+				out.monthly += it.Monthly
+				if it.Currency != "" {
+					out.currency = it.Currency
+				}
+			}
+			res.Passed, res.Detail = costGate(g, out.monthly, out.currency, target, current)
+		default:
+			var n int
+			var rules []string
+			for _, f := range run.findings {
+				if protocol.NormalizeSeverity(string(f.Severity)).AtLeast(g.Severity) {
+					n++
+					if !containsString(rules, f.RuleID) {
+						rules = append(rules, f.RuleID)
+					}
+				}
+			}
+			res.Passed = n == 0
+			res.Detail = fmt.Sprintf("No %s finding at %s or above", g.Kind, g.Severity)
+			if n > 0 {
+				res.Detail = fmt.Sprintf("%d %s finding(s) at %s or above: %s", n, g.Kind, g.Severity, strings.Join(rules, ", "))
+			}
+		}
+		out.results = append(out.results, res)
+	}
+	return out
+}
+
+// costGate compares a release's monthly estimate with the one recorded for
+// the target environment. Without an earlier estimate in the same
+// currency there is nothing to compare, and the gate passes.
+func costGate(g Gate, monthly float64, currency, target string, current EnvironmentState) (bool, string) {
+	estimate := fmt.Sprintf("%.2f %s/month", monthly, currency)
+	switch current.Currency {
+	case "":
+		return true, fmt.Sprintf("%s; `%s` has no earlier gated estimate to compare with", estimate, target)
+	case currency:
+	default:
+		return true, fmt.Sprintf("%s; `%s` was estimated in %s, so they are not compared", estimate, target, current.Currency)
+	}
+	delta := monthly - current.MonthlyCost
+	limit, limitText := g.MaxDelta, fmt.Sprintf("+%.2f %s", g.MaxDelta, currency)
+	if g.Percent {
+		limit, limitText = current.MonthlyCost*g.MaxDelta/100, fmt.Sprintf("+%g%%", g.MaxDelta)
+	}
+	change := fmt.Sprintf("%+.2f %s", delta, currency)
+	if current.MonthlyCost > 0 {
+		change += fmt.Sprintf(" (%+.0f%%)", delta*100/current.MonthlyCost)
+	}
+	return delta <= limit, fmt.Sprintf("%s, %s over `%s` (limit %s)", estimate, change, target, limitText)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,419 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/azauth"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// RegionalVCPUs is the quota name of a region's total vCPUs across
+// families.
+const RegionalVCPUs = "cores"
+
+// usageCacheTTL is how long a region's usages are reused, so the gate and
+// a simulation moments apart do not both wait on the API.
+const usageCacheTTL = 5 * time.Minute
+
+// QuotaDemand is the vCPUs a deployment adds in one region and VM family.
+type QuotaDemand struct {
+	Location string
+	// Family is the Microsoft.Compute quota name, e.g. "standardDSv5Family".
+	Family    string
+	VCPUs     int
+	Resources []string
+}
+
+// vmSizeRe splits "Standard_D16ads_v5" into series, vCPUs, features and
+// version; constrained sizes ("E8-4s_v5") count their full vCPUs.
+var vmSizeRe = regexp.MustCompile(`^(?i:standard_)?([A-Za-z]+?)(\d+)(?:-\d+)?([a-z]*)(?:_([vV]\d+))?$`)
+
+// VMSize returns a VM size's vCPUs and the quota family it draws from. The
+// family is derived from the size name, which matches Azure's family names
+// for current series; B-series sizes share "standardBSFamily".
+func VMSize(size string) (vcpus int, family string, ok bool) {
+	m := vmSizeRe.FindStringSubmatch(strings.TrimSpace(size))
+	if m == nil {
+		return 0, "", false
+	}
+	vcpus, _ = strconv.Atoi(m[2])
+	series := strings.ToUpper(m[1])
+	if series == "B" && m[4] == "" {
+		return vcpus, "standardBSFamily", true
+	}
+	return vcpus, "standard" + series + strings.ToUpper(m[3]) + strings.ToLower(m[4]) + "Family", true
+}
+
+// ComputeDemands totals the vCPUs that virtual machines, scale sets and AKS
+// node pools add, by region and family. For plan input only creates,
+// replacements and scale-ups count; otherwise every resource is assumed
+// new. Resources without a literal location use defaultLocation, or are
+// skipped when it is empty. AKS autoscaling pools count at max_count.
+func ComputeDemands(resources []protocol.Resource, defaultLocation string) []QuotaDemand {
+	byKey := make(map[[2]string]*QuotaDemand)
+	clusterLocation := make(map[string]string)
+	for _, res := range resources {
+		if res.Type == "azurerm_kubernetes_cluster" {
+			clusterLocation[res.Name] = literalLocation(res.Properties)
+		}
+	}
+	for _, res := range resources {
+		size, count := computeSize(res.Type, res.Properties)
+		if size == "" {
+			continue
+		}
+		vcpus, family, ok := VMSize(size)
+		if !ok {
+			continue
+		}
+		added := vcpus * count
+		if c := res.Change; c != nil {
+			if c.Importing {
+				// Adopted resources already count against usage.
+				continue
+			}
+			switch c.Action {
+			case protocol.ActionCreate, protocol.ActionReplace:
+			case protocol.ActionUpdate:
+				beforeSize, beforeCount := computeSize(res.Type, c.Before)
+				if beforeVCPUs, beforeFamily, ok := VMSize(beforeSize); ok && beforeFamily == family {
+					added -= beforeVCPUs * beforeCount
+				}
+			default:
+				continue
+			}
+		}
+		if added <= 0 {
+			continue
+		}
+		location := literalLocation(res.Properties)
+		if location == "" && res.Type == "azurerm_kubernetes_cluster_node_pool" {
+			location = clusterLocation[clusterName(res.Properties)]
+		}
+		if location == "" {
+			location = defaultLocation
+		}
+		if location == "" {
+			continue
+		}
+		key := [2]string{location, family}
+		d, ok := byKey[key]
+		if !ok {
+			d = &QuotaDemand{Location: location, Family: family}
+			byKey[key] = d
+		}
+		d.VCPUs += added
+		d.Resources = append(d.Resources, res.Name)
+	}
+	demands := make([]QuotaDemand, 0, len(byKey))
+	for _, d := range byKey {
+		demands = append(demands, *d)
+	}
+	sort.Slice(demands, func(i, j int) bool {
+		if demands[i].Location != demands[j].Location {
+			return demands[i].Location < demands[j].Location
+		}
+		return demands[i].Family < demands[j].Family
+	})
+	return demands
+}
+
+// computeSize returns the VM size and instance count a resource runs.
+func computeSize(resType string, props map[string]interface{}) (string, int) {
+	str := func(m map[string]interface{}, key string) string {
+		s, _ := m[key].(string)
+		return s
+	}
+	num := func(m map[string]interface{}, key string, def int) int {
+		switch n := m[key].(type) {
+		case int:
+			return n
+		case float64:
+			return int(n)
+		}
+		return def
+	}
+	pool := func(m map[string]interface{}) int {
+		if max := num(m, "max_count", 0); max > 0 {
+			return max
+		}
+		return num(m, "node_count", 1)
+	}
+	switch resType {
+	case "azurerm_linux_virtual_machine", "azurerm_windows_virtual_machine":
+		return str(props, "size"), 1
+	case "azurerm_virtual_machine":
+		return str(props, "vm_size"), 1
+	case "azurerm_linux_virtual_machine_scale_set", "azurerm_windows_virtual_machine_scale_set", "azurerm_orchestrated_virtual_machine_scale_set":
+		return str(props, "sku"), num(props, "instances", 0)
+	case "azurerm_kubernetes_cluster":
+		p, _ := props["default_node_pool"].(map[string]interface{})
+		return str(p, "vm_size"), pool(p)
+	case "azurerm_kubernetes_cluster_node_pool":
+		return str(props, "vm_size"), pool(props)
+	}
+	return "", 0
+}
+
+// literalLocation returns a resource's location when it is written out,
+// normalized to the ARM name ("East US" -> "eastus").
+func literalLocation(props map[string]interface{}) string {
+	loc, _ := props["location"].(string)
+	if loc == "" || strings.ContainsAny(loc, ".()${}") {
+		return ""
+	}
+	return strings.ToLower(strings.ReplaceAll(loc, " ", ""))
+}
+
+// clusterName extracts the cluster a node pool references, from
+// "azurerm_kubernetes_cluster.<name>.id".
+func clusterName(props map[string]interface{}) string {
+	ref, _ := props["kubernetes_cluster_id"].(string)
+	parts := strings.Split(ref, ".")
+	if len(parts) == 3 && parts[0] == "azurerm_kubernetes_cluster" {
+		return parts[1]
+	}
+	return ""
+}
+
+// Usage is one compute quota in a region.
+type Usage struct {
+	Name    string
+	Current int
+	Limit   int
+}
+
+// UsageFetcher returns the compute quotas of a region.
+type UsageFetcher func(ctx context.Context, location string) ([]Usage, error)
+
+// QuotaResult compares a demand with the quota that remains.
+type QuotaResult struct {
+	QuotaDemand
+	Remaining int
+	// Regional is true when the family has no quota of its own in the
+	// response and the region's total was checked instead.
+	Regional bool
+}
+
+// Exceeds reports whether the demand is more than remains.
+func (r QuotaResult) Exceeds() bool { return r.VCPUs > r.Remaining }
+
+// QuotaChecker compares the vCPUs a deployment adds with the subscription's
+// remaining compute quota.
+type QuotaChecker struct {
+	fetch           UsageFetcher
+	defaultLocation string
+}
+
+// NewQuotaChecker creates a checker. Resources without a literal location
+// are checked in defaultLocation.
+func NewQuotaChecker(fetch UsageFetcher, defaultLocation string) *QuotaChecker {
+	return &QuotaChecker{fetch: fetch, defaultLocation: strings.ToLower(defaultLocation)}
+}
+
+// Check returns a result per family and region the resources need, plus
+// each region's total, and the regions whose quotas could not be read.
+func (c *QuotaChecker) Check(ctx context.Context, resources []protocol.Resource) ([]QuotaResult, error) {
+	demands := ComputeDemands(resources, c.defaultLocation)
+	var results []QuotaResult
+	var errs []string
+	usages := make(map[string]map[string]Usage)
+	totals := make(map[string]*QuotaDemand)
+	var locations []string
+	for _, d := range demands {
+		u, ok := usages[d.Location]
+		if !ok {
+			list, err := c.fetch(ctx, d.Location)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", d.Location, err))
+			}
+			u = make(map[string]Usage, len(list))
+			for _, x := range list {
+				u[strings.ToLower(x.Name)] = x
+			}
+			usages[d.Location] = u
+		}
+		if len(u) == 0 {
+			continue
+		}
+		if t, ok := totals[d.Location]; ok {
+			t.VCPUs += d.VCPUs
+			t.Resources = append(t.Resources, d.Resources...)
+		} else {
+			totals[d.Location] = &QuotaDemand{Location: d.Location, Family: RegionalVCPUs, VCPUs: d.VCPUs, Resources: append([]string(nil), d.Resources...)}
+			locations = append(locations, d.Location)
+		}
+		if q, ok := u[strings.ToLower(d.Family)]; ok {
+			results = append(results, QuotaResult{QuotaDemand: d, Remaining: q.Limit - q.Current})
+		}
+	}
+	for _, loc := range locations {
+		if q, ok := usages[loc][RegionalVCPUs]; ok {
+			results = append(results, QuotaResult{QuotaDemand: *totals[loc], Remaining: q.Limit - q.Current, Regional: true})
+		}
+	}
+	if len(errs) > 0 {
+		return results, fmt.Errorf("quota lookup failed for %s", strings.Join(errs, "; "))
+	}
+	return results, nil
+}
+
+// ComputeUsages reads Microsoft.Compute usages (quotas) of a subscription
+// from Resource Manager, caching each region's for a few minutes.
+type ComputeUsages struct {
+	creds        azauth.TokenSource
+	subscription string
+	baseURL      string
+	client       *http.Client
+	now          func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedUsages
+}
+
+type cachedUsages struct {
+	usages  []Usage
+	fetched time.Time
+}
+
+// NewComputeUsages creates a reader for subscription. An empty baseURL
+// uses the public cloud's https://management.azure.com.
+func NewComputeUsages(creds azauth.TokenSource, subscription, baseURL string) *ComputeUsages {
+	if baseURL == "" {
+		baseURL = "https://management.azure.com"
+	}
+	return &ComputeUsages{
+		creds: creds, subscription: subscription, baseURL: strings.TrimRight(baseURL, "/"),
+		client: &http.Client{Timeout: 15 * time.Second}, now: time.Now, cache: make(map[string]cachedUsages),
+	}
+}
+
+// Fetch returns the region's compute usages. It is a UsageFetcher.
+func (u *ComputeUsages) Fetch(ctx context.Context, location string) ([]Usage, error) {
+	u.mu.Lock()
+	c, ok := u.cache[location]
+	u.mu.Unlock()
+	if ok && u.now().Sub(c.fetched) < usageCacheTTL {
+		return c.usages, nil
+	}
+	token, err := u.creds.Token(ctx, u.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	var usages []Usage
+	next := fmt.Sprintf("%s/subscriptions/%s/providers/Microsoft.Compute/locations/%s/usages?api-version=2023-07-01",
+		u.baseURL, url.PathEscape(u.subscription), url.PathEscape(location))
+	for next != "" {
+		if !strings.HasPrefix(next, u.baseURL+"/") {
+			return nil, fmt.Errorf("unexpected next page link %s", next)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := u.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Value []struct {
+				Name struct {
+					Value string `json:"value"`
+				} `json:"name"`
+				CurrentValue int `json:"currentValue"`
+				Limit        int `json:"limit"`
+			} `json:"value"`
+			NextLink string `json:"nextLink"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+			return nil, fmt.Errorf("compute usages: status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		err = json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("compute usages: %w", err)
+		}
+		for _, v := range page.Value {
+			usages = append(usages, Usage{Name: v.Name.Value, Current: v.CurrentValue, Limit: v.Limit})
+		}
+		next = page.NextLink
+	}
+	u.mu.Lock()
+	u.cache[location] = cachedUsages{usages: usages, fetched: u.now()}
+	u.mu.Unlock()
+	return usages, nil
+}
+
+// quotaCheck is the outcome of the quota gate for a promotion.
+type quotaCheck struct {
+	Checked bool
+	Results []QuotaResult
+	Err     error
+}
+
+// checkQuota runs the quota gate when it is enabled and code is attached.
+// Lookup failures do not block: the results that could be read still do.
+func (a *Agent) checkQuota(ctx context.Context, iac *protocol.IaCInput) quotaCheck {
+	if a.quotas == nil || iac == nil || len(iac.Resources) == 0 {
+		return quotaCheck{}
+	}
+	results, err := a.quotas.Check(ctx, iac.Resources)
+	return quotaCheck{Checked: len(results) > 0 || err != nil, Results: results, Err: err}
+}
+
+// Exceeded reports whether any quota is short.
+func (q quotaCheck) Exceeded() bool {
+	for _, r := range q.Results {
+		if r.Exceeds() {
+			return true
+		}
+	}
+	return false
+}
+
+// Table renders the results as a markdown table.
+func (q quotaCheck) Table() string {
+	var sb strings.Builder
+	sb.WriteString("| Region | Quota | Needed | Remaining | Result |\n")
+	sb.WriteString("|--------|-------|--------|-----------|--------|\n")
+	for _, r := range q.Results {
+		result := "✅"
+		if r.Exceeds() {
+			result = fmt.Sprintf("❌ short by %d", r.VCPUs-r.Remaining)
+		}
+		name := r.Family
+		if r.Regional {
+			name = "Total regional vCPUs"
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %d vCPUs (%s) | %d | %s |\n", r.Location, name, r.VCPUs, strings.Join(r.Resources, ", "), r.Remaining, result)
+	}
+	return sb.String()
+}
+
+// Summary describes the first shortfall, or the quotas checked.
+func (q quotaCheck) Summary() string {
+	for _, r := range q.Results {
+		if r.Exceeds() {
+			name := r.Family
+			if r.Regional {
+				name = "total regional vCPUs"
+			}
+			return fmt.Sprintf("Needs %d vCPUs of %s in %s; only %d remain", r.VCPUs, name, r.Location, r.Remaining)
+		}
+	}
+	return fmt.Sprintf("%d quota(s) have room for the deployment", len(q.Results))
+}
@@ -0,0 +1,402 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Environment is one stage of the promotion pipeline.
+type Environment struct {
+	Name string `json:"name"`
+	// Aliases are other words that name the environment in chat, e.g.
+	// "production".
+	Aliases []string `json:"aliases,omitempty"`
+	// From lists the environments it may be promoted from, the first being
+	// the default. Empty means the environment before it; the first
+	// environment is deployed to from its own version.
+	From []string `json:"from,omitempty"`
+	// Approval holds every promotion into the environment for approval,
+	// not only those whose findings or change window require it.
+	Approval bool `json:"approval,omitempty"`
+	// Approvers must all approve promotions into the environment, on top
+	// of any DEPLOY_APPROVERS lists for it.
+	Approvers []string `json:"approvers,omitempty"`
+}
+
+// Topology is the promotion pipeline: its environments in order, from
+// first to last. The last environment is production, whose recorded
+// promotions arm the drift lock and which dry runs default to.
+type Topology struct {
+	Environments []Environment `json:"environments"`
+}
+
+// Errors returned when changing the topology.
+var (
+	ErrEnvironmentExists   = errors.New("environment already exists")
+	ErrEnvironmentNotFound = errors.New("environment not found")
+	ErrEnvironmentInUse    = errors.New("environment is promoted from")
+	ErrInvalidTopology     = errors.New("invalid topology")
+)
+
+// DefaultTopology returns the dev -> staging -> prod pipeline, in which
+// every promotion to prod needs approval.
+func DefaultTopology() Topology {
+	return Topology{Environments: []Environment{
+		{Name: "dev"},
+		{Name: "staging", Aliases: []string{"stage", "test"}, From: []string{"dev"}},
+		{Name: "prod", Aliases: []string{"production"}, From: []string{"staging"}, Approval: true},
+	}}
+}
+
+var envNameRe = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// validEnvName reports whether name can name an environment: lowercase
+// letters, digits and dashes, starting with a letter.
+func validEnvName(name string) bool { return envNameRe.MatchString(name) }
+
+// ParseTopology parses and validates a topology document. Unknown fields
+// are rejected, so a misspelt key does not silently drop a setting.
+func ParseTopology(data []byte) (Topology, error) {
+	var t Topology
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&t); err != nil {
+		return Topology{}, fmt.Errorf("%w: %v", ErrInvalidTopology, err)
+	}
+	t.normalize()
+	if err := t.validate(); err != nil {
+		return Topology{}, err
+	}
+	return t, nil
+}
+
+// normalize lowercases names and fills in the default promotion sources.
+func (t *Topology) normalize() {
+	for i := range t.Environments {
+		e := &t.Environments[i]
+		e.Name = strings.ToLower(strings.TrimSpace(e.Name))
+		for j, s := range e.Aliases {
+			e.Aliases[j] = strings.ToLower(strings.TrimSpace(s))
+		}
+		for j, s := range e.From {
+			e.From[j] = strings.ToLower(strings.TrimSpace(s))
+		}
+		for j, s := range e.Approvers {
+			e.Approvers[j] = strings.TrimPrefix(strings.TrimSpace(s), "@")
+		}
+		if len(e.From) == 0 && i > 0 {
+			e.From = []string{t.Environments[i-1].Name}
+		}
+	}
+}
+
+// validate checks that names are unique and well formed, and that every
+// environment is promoted from environments before it, so promotions
+// always move forward through the pipeline.
+func (t Topology) validate() error {
+	if len(t.Environments) == 0 {
+		return fmt.Errorf("%w: no environments", ErrInvalidTopology)
+	}
+	seen := make(map[string]bool)
+	for i, e := range t.Environments {
+		for _, name := range append([]string{e.Name}, e.Aliases...) {
+			if !validEnvName(name) {
+				return fmt.Errorf("%w: %q is not a valid environment name (lowercase letters, digits and dashes)", ErrInvalidTopology, name)
+			}
+			if seen[name] {
+				return fmt.Errorf("%w: %q names two environments", ErrInvalidTopology, name)
+			}
+			seen[name] = true
+		}
+		if i == 0 && len(e.From) > 0 {
+			return fmt.Errorf("%w: %s is the first environment and cannot be promoted from another", ErrInvalidTopology, e.Name)
+		}
+		for _, from := range e.From {
+			if j := t.index(from); j < 0 || j >= i {
+				return fmt.Errorf("%w: %s is promoted from %q, which is not an environment before it", ErrInvalidTopology, e.Name, from)
+			}
+		}
+		for _, login := range e.Approvers {
+			if login == "" {
+				return fmt.Errorf("%w: %s has an empty approver", ErrInvalidTopology, e.Name)
+			}
+		}
+	}
+	return nil
+}
+
+func (t Topology) index(name string) int {
+	for i, e := range t.Environments {
+		if e.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns the environment named name.
+func (t Topology) Get(name string) (Environment, bool) {
+	if i := t.index(name); i >= 0 {
+		return t.Environments[i], true
+	}
+	return Environment{}, false
+}
+
+// Names returns the environment names in pipeline order.
+func (t Topology) Names() []string {
+	out := make([]string, len(t.Environments))
+	for i, e := range t.Environments {
+		out[i] = e.Name
+	}
+	return out
+}
+
+// Last returns the production environment, the last in the pipeline.
+func (t Topology) Last() string { return t.Environments[len(t.Environments)-1].Name }
+
+// Sources returns the environments env may be promoted from; the first
+// environment's only source is itself.
+func (t Topology) Sources(env string) []string {
+	if e, ok := t.Get(env); ok && len(e.From) > 0 {
+		return e.From
+	}
+	return []string{env}
+}
+
+// resolve returns the environment word names, by name or alias.
+func (t Topology) resolve(word string) (string, bool) {
+	word = strings.ToLower(word)
+	for _, e := range t.Environments {
+		if e.Name == word || containsString(e.Aliases, word) {
+			return e.Name, true
+		}
+	}
+	return "", false
+}
+
+var (
+	envWordRe = regexp.MustCompile(`[a-z][a-z0-9-]*`)
+	toEnvRe   = regexp.MustCompile(`\b(?:to|into)\s+([a-z][a-z0-9-]*)`)
+	fromEnvRe = regexp.MustCompile(`\bfrom\s+([a-z][a-z0-9-]*)`)
+)
+
+// target returns the environment msg promotes into: the one after "to"
+// or "into", else the first one it names other than after "from", else
+// fallback.
+func (t Topology) target(msg, fallback string) string {
+	msg = strings.ToLower(msg)
+	for _, m := range toEnvRe.FindAllStringSubmatch(msg, -1) {
+		if env, ok := t.resolve(m[1]); ok {
+			return env
+		}
+	}
+	from := ""
+	if m := fromEnvRe.FindStringSubmatch(msg); m != nil {
+		from = m[1]
+	}
+	for _, word := range envWordRe.FindAllString(msg, -1) {
+		if env, ok := t.resolve(word); ok && word != from {
+			return env
+		}
+	}
+	return fallback
+}
+
+// source returns the environment msg promotes target from: the one after
+// "from", which must be one of its sources, else its default source.
+func (t Topology) source(msg, target string) (string, error) {
+	sources := t.Sources(target)
+	m := fromEnvRe.FindStringSubmatch(strings.ToLower(msg))
+	if m == nil {
+		return sources[0], nil
+	}
+	env, ok := t.resolve(m[1])
+	if !ok {
+		return sources[0], nil
+	}
+	if !containsString(sources, env) {
+		return "", fmt.Errorf("`%s` cannot be promoted from `%s`; it is promoted from `%s`", target, env, strings.Join(sources, "`, `"))
+	}
+	return env, nil
+}
+
+// clone returns a deep copy of t, for changes that may fail validation.
+func (t Topology) clone() Topology {
+	data, _ := json.Marshal(t)
+	var c Topology
+	json.Unmarshal(data, &c)
+	return c
+}
+
+// ReadTopology loads the topology in path. A missing file is the default
+// topology, so the first change through the API can create it.
+func ReadTopology(path string) (Topology, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultTopology(), nil
+	}
+	if err != nil {
+		return Topology{}, err
+	}
+	t, err := ParseTopology(data)
+	if err != nil {
+		return Topology{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Save writes the topology to path, replacing it atomically.
+func (t Topology) Save(path string) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// WithTopology replaces the default dev -> staging -> prod pipeline.
+// Changes made through AddEnvironment, PutEnvironment and
+// DeleteEnvironment are saved to path when it is set.
+func WithTopology(t Topology, path string) Option {
+	return func(a *Agent) {
+		a.topology = t
+		a.topologyFile = path
+	}
+}
+
+// EnvironmentStatus is an environment with what is deployed to it.
+type EnvironmentStatus struct {
+	Environment
+	State EnvironmentState `json:"state"`
+}
+
+// Topology returns the promotion pipeline.
+func (a *Agent) Topology() Topology {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.topology.clone()
+}
+
+// Environments returns every environment in pipeline order with its state.
+func (a *Agent) Environments() []EnvironmentStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]EnvironmentStatus, 0, len(a.topology.Environments))
+	for _, e := range a.topology.clone().Environments {
+		out = append(out, EnvironmentStatus{Environment: e, State: *a.stateOf(e.Name)})
+	}
+	return out
+}
+
+// AddEnvironment appends e to the end of the pipeline, or before the
+// environment named before when it is set.
+func (a *Agent) AddEnvironment(e Environment, before string) (Topology, error) {
+	return a.changeTopology(func(t *Topology) error {
+		e.Name = strings.ToLower(strings.TrimSpace(e.Name))
+		if t.index(e.Name) >= 0 {
+			return fmt.Errorf("%s: %w", e.Name, ErrEnvironmentExists)
+		}
+		i := len(t.Environments)
+		if before != "" {
+			if i = t.index(strings.ToLower(before)); i < 0 {
+				return fmt.Errorf("%s: %w", before, ErrEnvironmentNotFound)
+			}
+		}
+		t.Environments = append(t.Environments[:i], append([]Environment{e}, t.Environments[i:]...)...)
+		return nil
+	})
+}
+
+// PutEnvironment replaces the environment named e.Name in place.
+func (a *Agent) PutEnvironment(e Environment) (Topology, error) {
+	return a.changeTopology(func(t *Topology) error {
+		e.Name = strings.ToLower(strings.TrimSpace(e.Name))
+		i := t.index(e.Name)
+		if i < 0 {
+			return fmt.Errorf("%s: %w", e.Name, ErrEnvironmentNotFound)
+		}
+		t.Environments[i] = e
+		return nil
+	})
+}
+
+// DeleteEnvironment removes an environment no other is promoted from.
+func (a *Agent) DeleteEnvironment(name string) (Topology, error) {
+	return a.changeTopology(func(t *Topology) error {
+		name = strings.ToLower(name)
+		i := t.index(name)
+		if i < 0 {
+			return fmt.Errorf("%s: %w", name, ErrEnvironmentNotFound)
+		}
+		for _, e := range t.Environments {
+			if e.Name != name && containsString(e.From, name) {
+				return fmt.Errorf("%s: %w %s", name, ErrEnvironmentInUse, e.Name)
+			}
+		}
+		t.Environments = append(t.Environments[:i], t.Environments[i+1:]...)
+		return nil
+	})
+}
+
+// changeTopology applies change to a copy of the topology and, when it is
+// still valid and has been saved, installs it.
+func (a *Agent) changeTopology(change func(*Topology) error) (Topology, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t := a.topology.clone()
+	if err := change(&t); err != nil {
+		return Topology{}, err
+	}
+	t.normalize()
+	if err := t.validate(); err != nil {
+		return Topology{}, err
+	}
+	if a.topologyFile != "" {
+		if err := t.Save(a.topologyFile); err != nil {
+			return Topology{}, err
+		}
+	}
+	a.topology = t
+	return t.clone(), nil
+}
+
+// stateOf returns what is deployed to env; an environment nothing has been
+// promoted to yet has no version. Callers hold a.mu.
+func (a *Agent) stateOf(env string) *EnvironmentState {
+	s, ok := a.state[env]
+	if !ok {
+		s = &EnvironmentState{Status: "not deployed"}
+		a.state[env] = s
+	}
+	return s
+}
+
+// approversFor returns the logins that must approve promotions into env.
+// Callers hold a.mu.
+func (a *Agent) approversFor(env string) []string {
+	var out []string
+	e, _ := a.topology.Get(env)
+	for _, login := range append(append([]string(nil), e.Approvers...), a.approvers[env]...) {
+		dup := false
+		for _, have := range out {
+			dup = dup || strings.EqualFold(have, login)
+		}
+		if !dup {
+			out = append(out, login)
+		}
+	}
+	return out
+}
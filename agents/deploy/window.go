@@ -0,0 +1,132 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/graph"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// ChangeWindow is a recurring weekly period in which changes to an
+// environment may be applied, e.g. Saturday nights for prod.
+type ChangeWindow struct {
+	// Env is the environment; empty applies to every environment.
+	Env string
+	// From and To are the first and last weekdays the window opens on.
+	From, To time.Weekday
+	// Start is the opening time after midnight UTC; the window may run
+	// past midnight.
+	Start  time.Duration
+	Length time.Duration
+	spec   string
+}
+
+// String formats the window the way ParseChangeWindows reads it.
+func (w ChangeWindow) String() string { return w.spec }
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseChangeWindows parses a comma-separated list of windows in the form
+// "[env:]day[-day] HH:MM-HH:MM", e.g. "prod:sat 22:00-04:00" or
+// "staging:mon-fri 09:00-17:00". Times are UTC; an end before the start
+// runs past midnight.
+func ParseChangeWindows(s string) ([]ChangeWindow, error) {
+	var windows []ChangeWindow
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		w := ChangeWindow{spec: entry}
+		span := entry
+		if env, rest, ok := strings.Cut(entry, ":"); ok && !strings.Contains(env, " ") {
+			w.Env, span = strings.ToLower(strings.TrimSpace(env)), rest
+			if !validEnvName(w.Env) {
+				return nil, fmt.Errorf("change window %q: invalid environment %q", entry, w.Env)
+			}
+		}
+		days, hours, ok := strings.Cut(strings.TrimSpace(span), " ")
+		if !ok {
+			return nil, fmt.Errorf("change window %q: expected [env:]day[-day] HH:MM-HH:MM", entry)
+		}
+		first, last, _ := strings.Cut(strings.ToLower(days), "-")
+		if last == "" {
+			last = first
+		}
+		var known bool
+		if w.From, known = weekdays[first]; !known {
+			return nil, fmt.Errorf("change window %q: unknown day %q", entry, first)
+		}
+		if w.To, known = weekdays[last]; !known {
+			return nil, fmt.Errorf("change window %q: unknown day %q", entry, last)
+		}
+		from, to, ok := strings.Cut(strings.TrimSpace(hours), "-")
+		start, err1 := time.Parse("15:04", strings.TrimSpace(from))
+		end, err2 := time.Parse("15:04", strings.TrimSpace(to))
+		if !ok || err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("change window %q: invalid hours (want HH:MM-HH:MM)", entry)
+		}
+		w.Start = time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute
+		w.Length = end.Sub(start)
+		if w.Length <= 0 {
+			w.Length += 24 * time.Hour
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// WithChangeWindows checks that the maintenance window a change needs fits
+// the change windows of the target environment; changes that do not fit
+// need approval.
+func WithChangeWindows(windows []ChangeWindow) Option {
+	return func(a *Agent) {
+		a.windows = windows
+	}
+}
+
+// WithApplyTimings estimates apply durations from recorded applies.
+func WithApplyTimings(history graph.TimingFunc) Option {
+	return func(a *Agent) {
+		a.timings = history
+	}
+}
+
+// windowCheck is the outcome of fitting a change into the change windows
+// of an environment.
+type windowCheck struct {
+	// Checked is false when no code is attached or the environment has no
+	// change windows.
+	Checked bool
+	Fits    bool
+	Detail  string
+}
+
+// checkChangeWindow compares the maintenance window the attached change
+// needs with the longest change window configured for env.
+func (a *Agent) checkChangeWindow(env string, iac *protocol.IaCInput) windowCheck {
+	var longest *ChangeWindow
+	for i := range a.windows {
+		if w := &a.windows[i]; (w.Env == "" || w.Env == env) && (longest == nil || w.Length > longest.Length) {
+			longest = w
+		}
+	}
+	switch {
+	case longest == nil:
+		return windowCheck{Detail: fmt.Sprintf("No change windows configured for `%s`", env)}
+	case iac == nil || len(iac.Resources) == 0:
+		return windowCheck{Detail: "No code attached; attach the stack to estimate its apply duration"}
+	}
+	est := graph.EstimateApply(iac.Resources, a.timings)
+	if est.Window <= longest.Length {
+		return windowCheck{Checked: true, Fits: true, Detail: fmt.Sprintf("Needs %s (~%s apply); fits `%s` (%s)",
+			graph.FormatDuration(est.Window), graph.FormatDuration(est.Total), longest, graph.FormatDuration(longest.Length))}
+	}
+	return windowCheck{Checked: true, Detail: fmt.Sprintf("Needs %s (~%s apply) but the longest `%s` window is %s (`%s`)",
+		graph.FormatDuration(est.Window), graph.FormatDuration(est.Total), env, graph.FormatDuration(longest.Length), longest)}
+}
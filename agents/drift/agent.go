@@ -4,15 +4,55 @@ package drift
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 )
 
 // Agent detects configuration drift in IaC resources.
-type Agent struct{}
+type Agent struct {
+	ignore     []string
+	severities []SeverityRule
+	// notify publishes drift at or above threshold.
+	notify    Notifier
+	threshold protocol.Severity
+	// inventory lists deployed resources, when configured.
+	inventory InventoryFunc
+	now       func() time.Time
+}
 
 // New creates a new drift Agent.
-func New() *Agent { return &Agent{} }
+func New(opts ...Option) *Agent {
+	a := &Agent{
+		ignore:     append([]string{}, DefaultIgnore...),
+		severities: append([]SeverityRule{}, DefaultSeverities...),
+		now:        time.Now,
+	}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// Option configures a drift Agent.
+type Option func(*Agent)
+
+// WithIgnore adds properties, by name, path or path.Match pattern, that
+// are never compared, to DefaultIgnore.
+func WithIgnore(paths ...string) Option {
+	return func(a *Agent) {
+		a.ignore = append(a.ignore, paths...)
+	}
+}
+
+// WithSeverities classifies drift by property before DefaultSeverities;
+// the first matching rule wins.
+func WithSeverities(rules ...SeverityRule) Option {
+	return func(a *Agent) {
+		a.severities = append(rules[:len(rules):len(rules)], a.severities...)
+	}
+}
 
 func (a *Agent) ID() string { return "drift" }
 
@@ -27,13 +67,13 @@ func (a *Agent) Metadata() protocol.AgentMetadata {
 
 func (a *Agent) Capabilities() protocol.AgentCapabilities {
 	return protocol.AgentCapabilities{
-		Formats:       []protocol.SourceFormat{protocol.FormatTerraform, protocol.FormatBicep},
+		Formats:       []protocol.SourceFormat{protocol.FormatTerraform, protocol.FormatBicep, protocol.FormatTerraformPlan},
 		NeedsIaCInput: true,
 	}
 }
 
 // Handle checks for configuration drift in parsed resources.
-func (a *Agent) Handle(_ context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
+func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
 	if !protocol.RequireIaC(req, emit, "drift detection") {
 		return nil
 	}
@@ -41,9 +81,41 @@ func (a *Agent) Handle(_ context.Context, req protocol.AgentRequest, emit protoc
 	emit.SendMessage("## Drift Detection\n\n")
 	emit.SendMessage(fmt.Sprintf("Comparing **%d** declared resource(s) against expected state...\n\n", len(req.IaC.Resources)))
 
-	var drifts []driftResult
+	scope := ScopeFromIaC(req.IaC)
+	if scope.IsEmpty() {
+		emit.SendMessage("_No subscription or resource group hints found; live queries would scan the whole subscription._\n\n")
+	} else {
+		emit.SendMessage("### Query Scope\n\n")
+		if len(scope.SubscriptionIDs) > 0 {
+			emit.SendMessage(fmt.Sprintf("- Subscriptions: `%s`\n", strings.Join(scope.SubscriptionIDs, "`, `")))
+		}
+		if len(scope.ResourceGroups) > 0 {
+			emit.SendMessage(fmt.Sprintf("- Resource groups: `%s`\n", strings.Join(scope.ResourceGroups, "`, `")))
+		}
+		emit.SendMessage("\nLive resources outside this scope are not reported as missing from IaC.\n\n")
+		emit.SendMessage("```kusto\n" + scope.ResourceGraphQuery() + "\n```\n\n")
+	}
+	a.reportUnmanaged(ctx, scope, req.IaC.Resources, emit)
+
+	var (
+		drifts   []driftResult
+		excluded []string
+		ignored  int
+	)
 	for _, res := range req.IaC.Resources {
-		drifts = append(drifts, detectDrift(res)...)
+		d, ex, n := a.resourceDrift(res)
+		drifts = append(drifts, d...)
+		if ex.reason == "" {
+			ignored += n
+		} else {
+			excluded = append(excluded, fmt.Sprintf("- `%s.%s`: %s\n", res.Type, res.Name, ex.reason))
+		}
+	}
+	if len(excluded) > 0 {
+		emit.SendMessage(fmt.Sprintf("### Excluded\n\n%d resource(s) are not evaluated:\n\n%s\n", len(excluded), strings.Join(excluded, "")))
+	}
+	if ignored > 0 {
+		emit.SendMessage(fmt.Sprintf("_%d drifted propert(y/ies) skipped by `drift_ignore` annotations or `lifecycle.ignore_changes`._\n\n", ignored))
 	}
 
 	if len(drifts) == 0 {
@@ -51,6 +123,7 @@ func (a *Agent) Handle(_ context.Context, req protocol.AgentRequest, emit protoc
 		return nil
 	}
 
+	a.publish(ctx, req, drifts)
 	emit.SendMessage(fmt.Sprintf("**%d drift(s) detected**\n\n", len(drifts)))
 	emit.SendMessage("| Resource | Property | Expected | Actual | Severity |\n")
 	emit.SendMessage("|----------|----------|----------|--------|----------|\n")
@@ -62,47 +135,91 @@ func (a *Agent) Handle(_ context.Context, req protocol.AgentRequest, emit protoc
 	return nil
 }
 
+// reportUnmanaged lists the deployed resources in scope that the IaC does
+// not declare. Without an inventory it does nothing.
+func (a *Agent) reportUnmanaged(ctx context.Context, scope Scope, resources []protocol.Resource, emit protocol.Emitter) {
+	if a.inventory == nil {
+		return
+	}
+	live, err := a.inventory(ctx, scope)
+	if err != nil {
+		emit.SendMessage(fmt.Sprintf("_Live inventory unavailable: %v_\n\n", err))
+		return
+	}
+	missing, outside := unmanaged(live, scope, resources)
+	if len(missing) > 0 {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "### Missing in IaC\n\n%d deployed resource(s) in scope are not declared:\n\n", len(missing))
+		for _, r := range missing {
+			fmt.Fprintf(&sb, "- `%s` (%s)\n", r.ID, r.Type)
+		}
+		emit.SendMessage(sb.String() + "\n")
+	}
+	if outside > 0 {
+		emit.SendMessage(fmt.Sprintf("_%d deployed resource(s) outside the query scope were left out._\n\n", outside))
+	}
+}
+
 type driftResult struct {
 	ResourceType string
 	ResourceName string
 	Property     string
 	Expected     string
 	Actual       string
-	Severity     string
+	Severity     protocol.Severity
 }
 
-func detectDrift(res protocol.Resource) []driftResult {
-	var drifts []driftResult
-	switch res.Type {
-	case "azurerm_storage_account":
-		if v, ok := res.Properties["min_tls_version"]; ok {
-			if fmt.Sprintf("%v", v) != "TLS1_2" {
-				drifts = append(drifts, driftResult{
-					ResourceType: res.Type, ResourceName: res.Name,
-					Property: "min_tls_version", Expected: "TLS1_2",
-					Actual: fmt.Sprintf("%v", v), Severity: "high",
-				})
-			}
+// Findings returns the drift detected across resources as findings, for
+// callers such as the deploy agent's post-promotion drift lock. Excluded
+// resources and properties are skipped.
+func (a *Agent) Findings(resources []protocol.Resource) []protocol.Finding {
+	var findings []protocol.Finding
+	for _, res := range resources {
+		drifts, _, _ := a.resourceDrift(res)
+		for _, d := range drifts {
+			findings = append(findings, protocol.Finding{
+				RuleID:       "DRIFT-" + d.Property,
+				Category:     "Drift",
+				Severity:     d.Severity,
+				Resource:     d.ResourceName,
+				ResourceType: d.ResourceType,
+				Message:      fmt.Sprintf("%s is %s, expected %s", d.Property, d.Actual, d.Expected),
+			})
 		}
-		if v, ok := res.Properties["enable_https_traffic_only"]; ok {
-			if v != true {
-				drifts = append(drifts, driftResult{
-					ResourceType: res.Type, ResourceName: res.Name,
-					Property: "enable_https_traffic_only", Expected: "true",
-					Actual: fmt.Sprintf("%v", v), Severity: "high",
-				})
-			}
+	}
+	return findings
+}
+
+// resourceDrift returns the drift detected in res that its exclusions do not
+// skip, the exclusions, and how many drifts they skipped.
+func (a *Agent) resourceDrift(res protocol.Resource) ([]driftResult, exclusion, int) {
+	ex := exclusionFor(res)
+	drifts, skipped := ex.filter(a.detectDrift(res))
+	return drifts, ex, skipped
+}
+
+// detectDrift compares every property of a planned update with the state
+// it replaces, and the properties baseline covers that the plan does not
+// already report. Ignored properties are left out and the rest classified
+// by severity.
+func (a *Agent) detectDrift(res protocol.Resource) []driftResult {
+	drifts := planDrift(res)
+	seen := make(map[string]bool, len(drifts))
+	for _, d := range drifts {
+		seen[d.Property] = true
+	}
+	for _, d := range baselineDrift(res) {
+		if !seen[d.Property] {
+			drifts = append(drifts, d)
 		}
-	case "azurerm_key_vault":
-		if v, ok := res.Properties["soft_delete_enabled"]; ok {
-			if v != true {
-				drifts = append(drifts, driftResult{
-					ResourceType: res.Type, ResourceName: res.Name,
-					Property: "soft_delete_enabled", Expected: "true",
-					Actual: fmt.Sprintf("%v", v), Severity: "high",
-				})
-			}
+	}
+	kept := drifts[:0]
+	for _, d := range drifts {
+		if a.ignored(d.Property) {
+			continue
 		}
+		d.Severity = a.classify(d.Property)
+		kept = append(kept, d)
 	}
-	return drifts
+	return kept
 }
@@ -2,8 +2,13 @@ package drift
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
@@ -91,3 +96,371 @@ func TestAgent_NoIaC(t *testing.T) {
 func TestAgent_ImplementsAgent(t *testing.T) {
 	var _ protocol.Agent = (*Agent)(nil)
 }
+
+func TestScopeFromIaC(t *testing.T) {
+	tfCode := `provider "azurerm" {
+  features {}
+  subscription_id = "00000000-1111-2222-3333-444444444444"
+}
+
+resource "azurerm_resource_group" "main" {
+  name     = "rg-app-prod"
+  location = "westeurope"
+}
+
+resource "azurerm_storage_account" "sa" {
+  name                = "sa"
+  resource_group_name = azurerm_resource_group.main.name
+}
+
+resource "azurerm_key_vault" "kv" {
+  name                = "kv"
+  resource_group_name = "rg-shared-prod"
+}
+
+resource "azurerm_role_assignment" "ra" {
+  scope = "/subscriptions/00000000-1111-2222-3333-444444444444/resourceGroups/rg-network-prod"
+}
+
+resource "azurerm_app_service" "app" {
+  resource_group_name = var.rg_name
+}`
+	req := protocol.AgentRequest{Prompt: "drift:\n```hcl\n" + tfCode + "\n```"}
+	host.ParseAndEnrich(&req)
+
+	scope := ScopeFromIaC(req.IaC)
+	if len(scope.SubscriptionIDs) != 1 || scope.SubscriptionIDs[0] != "00000000-1111-2222-3333-444444444444" {
+		t.Errorf("SubscriptionIDs = %v", scope.SubscriptionIDs)
+	}
+	want := []string{"rg-app-prod", "rg-network-prod", "rg-shared-prod"}
+	if strings.Join(scope.ResourceGroups, ",") != strings.Join(want, ",") {
+		t.Errorf("ResourceGroups = %v, want %v", scope.ResourceGroups, want)
+	}
+
+	q := scope.ResourceGraphQuery()
+	if !strings.Contains(q, "resourceGroup in~ ('rg-app-prod'") || !strings.Contains(q, "subscriptionId in~") {
+		t.Errorf("unexpected query:\n%s", q)
+	}
+}
+
+func TestScope_InScope(t *testing.T) {
+	scope := Scope{
+		SubscriptionIDs: []string{"00000000-1111-2222-3333-444444444444"},
+		ResourceGroups:  []string{"rg-app-prod"},
+	}
+	in := "/subscriptions/00000000-1111-2222-3333-444444444444/resourceGroups/RG-APP-PROD/providers/Microsoft.Storage/storageAccounts/sa"
+	other := "/subscriptions/00000000-1111-2222-3333-444444444444/resourceGroups/rg-app-dev/providers/Microsoft.Storage/storageAccounts/sa"
+	if !scope.InScope(in) {
+		t.Error("expected resource in prod RG to be in scope")
+	}
+	if scope.InScope(other) {
+		t.Error("expected dev RG resource to be out of scope")
+	}
+	if !(Scope{}).InScope(other) {
+		t.Error("empty scope should match everything")
+	}
+}
+
+func TestAgent_ReportsScope(t *testing.T) {
+	a := New()
+	tfCode := `resource "azurerm_storage_account" "sa" {
+  name                = "sa"
+  resource_group_name = "rg-scoped"
+}`
+	req := protocol.AgentRequest{Prompt: "drift:\n```hcl\n" + tfCode + "\n```"}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if !strings.Contains(combined, "Query Scope") || !strings.Contains(combined, "rg-scoped") {
+		t.Errorf("expected query scope in output:\n%s", combined)
+	}
+}
+
+func TestScope_QueryEscapesQuotes(t *testing.T) {
+	q := Scope{ResourceGroups: []string{`rg-o'brien`, `rg\x`}}.ResourceGraphQuery()
+	if want := `resourceGroup in~ ('rg-o\'brien', 'rg\\x')`; !strings.Contains(q, want) {
+		t.Errorf("query missing %s:\n%s", want, q)
+	}
+}
+
+func TestAgent_LiveInventory(t *testing.T) {
+	const sub = "/subscriptions/00000000-1111-2222-3333-444444444444"
+	var got Scope
+	a := New(WithInventory(func(_ context.Context, scope Scope) ([]LiveResource, error) {
+		got = scope
+		return []LiveResource{
+			{ID: sub + "/resourceGroups/rg-scoped/providers/Microsoft.Storage/storageAccounts/sa", Name: "sa", Type: "microsoft.storage/storageaccounts"},
+			{ID: sub + "/resourceGroups/rg-scoped/providers/Microsoft.KeyVault/vaults/kv-manual", Name: "kv-manual", Type: "microsoft.keyvault/vaults"},
+			{ID: sub + "/resourceGroups/rg-other/providers/Microsoft.KeyVault/vaults/kv-other", Name: "kv-other", Type: "microsoft.keyvault/vaults"},
+		}, nil
+	}))
+	tfCode := `resource "azurerm_storage_account" "sa" {
+  name                = "sa"
+  resource_group_name = "rg-scoped"
+}`
+	req := protocol.AgentRequest{Prompt: "drift:\n```hcl\n" + tfCode + "\n```"}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.ResourceGroups) != 1 || got.ResourceGroups[0] != "rg-scoped" {
+		t.Errorf("inventory scope = %+v", got)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if !strings.Contains(combined, "### Missing in IaC") || !strings.Contains(combined, "kv-manual") {
+		t.Errorf("expected the undeclared vault in output:\n%s", combined)
+	}
+	if strings.Contains(combined, "storageAccounts/sa`") || strings.Contains(combined, "kv-other") {
+		t.Errorf("declared or out-of-scope resources reported as missing:\n%s", combined)
+	}
+	if !strings.Contains(combined, "1 deployed resource(s) outside the query scope") {
+		t.Errorf("expected the out-of-scope count:\n%s", combined)
+	}
+}
+
+type staticToken string
+
+func (s staticToken) Token(context.Context, string) (string, error) { return string(s), nil }
+
+func TestResourceGraph_Inventory(t *testing.T) {
+	var body struct {
+		Subscriptions []string `json:"subscriptions"`
+		Query         string   `json:"query"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/providers/Microsoft.ResourceGraph/resources" || r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"totalRecords":1,"data":[{"id":"/s/kv","name":"kv","type":"microsoft.keyvault/vaults","resourceGroup":"rg","properties":{}}]}`))
+	}))
+	defer srv.Close()
+
+	g := NewResourceGraph(staticToken("tok"), []string{"sub-1"}, srv.URL)
+	live, err := g.Inventory(context.Background(), Scope{ResourceGroups: []string{"rg"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(live) != 1 || live[0].Name != "kv" || live[0].ResourceGroup != "rg" {
+		t.Errorf("live = %+v", live)
+	}
+	if len(body.Subscriptions) != 1 || body.Subscriptions[0] != "sub-1" {
+		t.Errorf("subscriptions = %v", body.Subscriptions)
+	}
+	if !strings.Contains(body.Query, "resourceGroup in~ ('rg')") {
+		t.Errorf("query = %s", body.Query)
+	}
+}
+
+func TestFindings(t *testing.T) {
+	resources := []protocol.Resource{{
+		Type: "azurerm_storage_account", Name: "sa",
+		Properties: map[string]interface{}{"min_tls_version": "TLS1_0"},
+	}}
+	findings := New().Findings(resources)
+	if len(findings) != 1 || findings[0].Category != "Drift" || !strings.Contains(findings[0].Message, "expected TLS1_2") {
+		t.Errorf("findings = %+v", findings)
+	}
+}
+
+func TestAgent_TerraformPlan(t *testing.T) {
+	plan, err := os.ReadFile("../../internal/testkit/scenarios/storage-plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := protocol.AgentRequest{Prompt: "review this plan:\n```json\n" + string(plan) + "```"}
+	host.ParseAndEnrich(&req)
+	if req.IaC == nil || req.IaC.Format != protocol.FormatTerraformPlan {
+		t.Fatalf("IaC = %+v", req.IaC)
+	}
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{"| azurerm_storage_account.sa | min_tls_version | TLS1_2 | TLS1_0 |", "network_rules.default_action | Deny | Allow"} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("missing %q:\n%s", want, combined)
+		}
+	}
+	if strings.Contains(combined, "resource_group.rg") {
+		t.Error("unchanged resource reported as drift")
+	}
+}
+
+func TestAgent_Exclusions(t *testing.T) {
+	tfCode := `# iac-gov: managed_by=network-team
+resource "azurerm_storage_account" "shared" {
+  min_tls_version = "TLS1_0"
+}
+
+resource "azurerm_storage_account" "tagged" {
+  min_tls_version = "TLS1_0"
+  tags = {
+    "Managed-By" = "data-platform"
+  }
+}
+
+resource "azurerm_storage_account" "ours" {
+  min_tls_version           = "TLS1_0"
+  enable_https_traffic_only = false
+  tags = {
+    managed-by = "terraform"
+  }
+  # iac-gov: drift_ignore=min_tls_version
+}
+
+resource "azurerm_key_vault" "kv" {
+  soft_delete_enabled = false
+  lifecycle {
+    ignore_changes = all
+  }
+}`
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "check drift:\n```hcl\n" + tfCode + "\n```"}}}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"3 resource(s) are not evaluated",
+		"`azurerm_storage_account.shared`: managed by `network-team` (annotation)",
+		"`azurerm_storage_account.tagged`: managed by `data-platform` (tag)",
+		"`azurerm_key_vault.kv`: all properties ignored",
+		"1 drifted propert(y/ies) skipped",
+		"**1 drift(s) detected**",
+		"| azurerm_storage_account.ours | enable_https_traffic_only |",
+	} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("missing %q:\n%s", want, combined)
+		}
+	}
+	if findings := New().Findings(req.IaC.Resources); len(findings) != 1 || findings[0].Resource != "ours" {
+		t.Errorf("findings = %+v, want only the unexcluded drift", findings)
+	}
+}
+
+func TestExclusion_Ignores(t *testing.T) {
+	ex := exclusion{paths: []string{"network_rules.ip_rules", "tags"}}
+	for path, want := range map[string]bool{
+		"tags":                         true,
+		"tags.env":                     true,
+		"network_rules.ip_rules":       true,
+		"network_rules[0].ip_rules":    true,
+		"network_rules.default_action": false,
+		"tagsx":                        false,
+	} {
+		if got := ex.ignores(path); got != want {
+			t.Errorf("ignores(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestAgent_DeepCompare(t *testing.T) {
+	res := protocol.Resource{
+		Type: "azurerm_linux_web_app", Name: "app",
+		Change: &protocol.Change{Action: protocol.ActionUpdate, Before: map[string]interface{}{
+			"etag": "W/1",
+			"site_config": map[string]interface{}{
+				"minimum_tls_version": "1.0",
+				"ip_restriction": []interface{}{
+					map[string]interface{}{"name": "office", "ip_address": "10.0.0.0/8"},
+				},
+			},
+			"tags":     map[string]interface{}{"env": "prod", "owner": "ops"},
+			"sku_name": "P1v3",
+			"identity": map[string]interface{}{"principal_id": "p-1", "type": "SystemAssigned"},
+		}},
+		Properties: map[string]interface{}{
+			"etag": "W/2",
+			"site_config": map[string]interface{}{
+				"minimum_tls_version": "1.2",
+				"ip_restriction": []interface{}{
+					map[string]interface{}{"name": "office", "ip_address": "10.1.0.0/16"},
+				},
+			},
+			"tags":     map[string]interface{}{"env": "prod", "owner": "platform"},
+			"sku_name": "P2v3",
+			"identity": map[string]interface{}{"type": "SystemAssigned"},
+		},
+	}
+	a := New(WithIgnore("sku_name"), WithSeverities(SeverityRule{"site_config.ip_restriction*", protocol.SeverityCritical}))
+	got := map[string]protocol.Severity{}
+	for _, f := range a.Findings([]protocol.Resource{res}) {
+		got[strings.TrimPrefix(f.RuleID, "DRIFT-")] = f.Severity
+	}
+	want := map[string]protocol.Severity{
+		"site_config.minimum_tls_version":          protocol.SeverityHigh,
+		"site_config.ip_restriction[0].ip_address": protocol.SeverityCritical,
+		"tags.owner": protocol.SeverityLow,
+	}
+	if len(got) != len(want) {
+		t.Errorf("drift = %v, want %v", got, want)
+	}
+	for p, sev := range want {
+		if got[p] != sev {
+			t.Errorf("drift in %s = %q, want %q (all: %v)", p, got[p], sev, got)
+		}
+	}
+}
+
+func TestParseSeverities(t *testing.T) {
+	rules, err := ParseSeverities("tags.*=info, sku_name=HIGH")
+	if err != nil || len(rules) != 2 || rules[0].Severity != protocol.SeverityInfo || rules[1].Severity != protocol.SeverityHigh {
+		t.Errorf("ParseSeverities = %+v, %v", rules, err)
+	}
+	for _, bad := range []string{"sku_name", "sku_name=urgent", "[=high"} {
+		if _, err := ParseSeverities(bad); err == nil {
+			t.Errorf("ParseSeverities(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestAgent_Notifies(t *testing.T) {
+	tfCode := `resource "azurerm_storage_account" "bad" {
+  name                      = "badstorage"
+  enable_https_traffic_only = false
+  min_tls_version           = "TLS1_0"
+}`
+	scan := func(threshold protocol.Severity, meta map[string]string) (Event, bool) {
+		events := make(chan Event, 1)
+		a := New(WithNotifier(threshold, func(_ context.Context, e Event) { events <- e }))
+		req := protocol.AgentRequest{
+			Messages: []protocol.Message{{Role: "user", Content: "check drift:\n```hcl\n" + tfCode + "\n```"}},
+			Metadata: meta,
+		}
+		host.ParseAndEnrich(&req)
+		if err := a.Handle(context.Background(), req, &prototest.Recorder{}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case e := <-events:
+			return e, true
+		case <-time.After(100 * time.Millisecond):
+			return Event{}, false
+		}
+	}
+
+	e, ok := scan(protocol.SeverityHigh, map[string]string{protocol.MetaRepository: "org/app", protocol.MetaEnvironment: "prod"})
+	if !ok {
+		t.Fatal("expected a drift event")
+	}
+	if e.Type != EventDetected || e.Severity != protocol.SeverityHigh || len(e.Drifts) != 2 || e.Counts[protocol.SeverityHigh] != 2 || e.Repo != "org/app" || e.Environment != "prod" {
+		t.Errorf("event = %+v", e)
+	}
+	if got := e.Summary(); got != "2 drifted properties in 1 resource(s) (2 high)" {
+		t.Errorf("summary = %q", got)
+	}
+	if _, ok := scan(protocol.SeverityCritical, nil); ok {
+		t.Error("drift below the threshold should not notify")
+	}
+	if _, ok := scan(protocol.SeverityHigh, map[string]string{protocol.MetaProbe: "true"}); ok {
+		t.Error("probes should not notify")
+	}
+}
@@ -0,0 +1,156 @@
+package drift
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// DefaultIgnore are properties the platform computes, which differ between
+// configuration and state without anyone changing the resource. A name
+// without a dot matches the property at any depth.
+var DefaultIgnore = []string{"etag", "provisioning_state", "provisioningState", "resource_guid", "timeouts"}
+
+// SeverityRule classifies drift in the properties whose path, with list
+// indexes removed, matches Pattern (path.Match syntax; "*" also matches
+// dots, so "*tls*" matches nested properties too).
+type SeverityRule struct {
+	Pattern  string
+	Severity protocol.Severity
+}
+
+// DefaultSeverities classify drift that weakens security as high and tag
+// drift as low. Drift no rule matches is medium.
+var DefaultSeverities = []SeverityRule{
+	{"*tls*", protocol.SeverityHigh},
+	{"*https*", protocol.SeverityHigh},
+	{"*public_network_access*", protocol.SeverityHigh},
+	{"*public_access*", protocol.SeverityHigh},
+	{"*firewall*", protocol.SeverityHigh},
+	{"network_rules*", protocol.SeverityHigh},
+	{"*soft_delete*", protocol.SeverityHigh},
+	{"*purge_protection*", protocol.SeverityHigh},
+	{"*encryption*", protocol.SeverityHigh},
+	{"*access_polic*", protocol.SeverityHigh},
+	{"*rbac*", protocol.SeverityHigh},
+	{"identity*", protocol.SeverityHigh},
+	{"tags", protocol.SeverityLow},
+	{"tags.*", protocol.SeverityLow},
+}
+
+// ParseSeverities parses "pattern=severity" pairs separated by commas, e.g.
+// "tags.*=info,sku_name=high".
+func ParseSeverities(s string) ([]SeverityRule, error) {
+	var rules []SeverityRule
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pattern, name, ok := strings.Cut(part, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("%q: want pattern=severity", part)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%q: invalid pattern", part)
+		}
+		sev, ok := protocol.ParseSeverity(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("%q: unknown severity %q", part, name)
+		}
+		rules = append(rules, SeverityRule{Pattern: pattern, Severity: sev})
+	}
+	return rules, nil
+}
+
+// classify returns the severity of drift in the property at p.
+func (a *Agent) classify(p string) protocol.Severity {
+	p = indexRe.ReplaceAllString(p, "")
+	for _, r := range a.severities {
+		if ok, _ := path.Match(r.Pattern, p); ok {
+			return r.Severity
+		}
+	}
+	return protocol.SeverityMedium
+}
+
+// ignored reports whether the property at p is one the agent never
+// compares: it, a parent, or (for names without a dot) its last segment is
+// on the ignore list.
+func (a *Agent) ignored(p string) bool {
+	p = indexRe.ReplaceAllString(p, "")
+	last := p[strings.LastIndex(p, ".")+1:]
+	for _, ig := range a.ignore {
+		if p == ig || strings.HasPrefix(p, ig+".") || (!strings.Contains(ig, ".") && last == ig) {
+			return true
+		}
+		if ok, _ := path.Match(ig, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// diffProperties calls diff for each property in expected whose value
+// differs from actual, descending into nested blocks, tags and lists of the
+// same length. Properties only in actual are not compared: they are
+// computed, or known only after apply.
+func diffProperties(expected, actual map[string]interface{}, prefix string, diff func(path string, expected, actual interface{})) {
+	for k, e := range expected {
+		diffValue(prefix+k, e, actual[k], diff)
+	}
+}
+
+func diffValue(p string, expected, actual interface{}, diff func(path string, expected, actual interface{})) {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		if a, ok := actual.(map[string]interface{}); ok {
+			diffProperties(e, a, p+".", diff)
+			return
+		}
+	case []interface{}:
+		if a, ok := actual.([]interface{}); ok && len(a) == len(e) {
+			for i := range e {
+				diffValue(fmt.Sprintf("%s[%d]", p, i), e[i], a[i], diff)
+			}
+			return
+		}
+	}
+	if fmt.Sprintf("%v", expected) != fmt.Sprintf("%v", actual) {
+		diff(p, expected, actual)
+	}
+}
+
+// expectation is a value a property must keep whatever the configuration
+// declares.
+type expectation struct {
+	property string
+	value    interface{}
+}
+
+// baseline is the state a few security-critical properties are expected to
+// have, whether or not there is a plan to compare against.
+var baseline = map[string][]expectation{
+	"azurerm_storage_account": {{"min_tls_version", "TLS1_2"}, {"enable_https_traffic_only", true}},
+	"azurerm_key_vault":       {{"soft_delete_enabled", true}},
+}
+
+// baselineDrift compares the properties of res that baseline covers.
+func baselineDrift(res protocol.Resource) []driftResult {
+	var drifts []driftResult
+	for _, exp := range baseline[res.Type] {
+		v, ok := res.Properties[exp.property]
+		if !ok || fmt.Sprintf("%v", v) == fmt.Sprintf("%v", exp.value) {
+			continue
+		}
+		drifts = append(drifts, driftResult{
+			ResourceType: res.Type, ResourceName: res.Name,
+			Property: exp.property, Expected: fmt.Sprintf("%v", exp.value),
+			Actual: fmt.Sprintf("%v", v),
+		})
+	}
+	return drifts
+}
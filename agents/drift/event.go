@@ -0,0 +1,121 @@
+package drift
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// EventDetected is the type of the event published when a scan finds drift.
+const EventDetected = "drift.detected"
+
+// notifyTimeout bounds a drift notification, which outlives the request it
+// reports on.
+const notifyTimeout = 30 * time.Second
+
+// Drift is one drifted property in an Event.
+type Drift struct {
+	ResourceType string            `json:"resource_type"`
+	Resource     string            `json:"resource"`
+	Property     string            `json:"property"`
+	Expected     string            `json:"expected"`
+	Actual       string            `json:"actual"`
+	Severity     protocol.Severity `json:"severity"`
+}
+
+// Event describes the drift a scan found at or above the notification
+// threshold.
+type Event struct {
+	Type string `json:"type"`
+	// Severity is the highest severity among Drifts.
+	Severity    protocol.Severity         `json:"severity"`
+	Counts      map[protocol.Severity]int `json:"counts"`
+	Drifts      []Drift                   `json:"drifts"`
+	Repo        string                    `json:"repo,omitempty"`
+	Environment string                    `json:"environment,omitempty"`
+	JobID       string                    `json:"job_id,omitempty"`
+	Time        time.Time                 `json:"time"`
+}
+
+// Summary is a one-line description of the event, e.g. "3 drifted
+// properties in 2 resources (1 high, 2 medium)".
+func (e Event) Summary() string {
+	resources := make(map[string]bool)
+	for _, d := range e.Drifts {
+		resources[d.ResourceType+"."+d.Resource] = true
+	}
+	s := fmt.Sprintf("%d drifted propert%s in %d resource(s)", len(e.Drifts), plural(len(e.Drifts), "y", "ies"), len(resources))
+	var counts string
+	for _, sev := range protocol.Severities {
+		if n := e.Counts[sev]; n > 0 {
+			if counts != "" {
+				counts += ", "
+			}
+			counts += fmt.Sprintf("%d %s", n, sev)
+		}
+	}
+	if counts != "" {
+		s += " (" + counts + ")"
+	}
+	return s
+}
+
+func plural(n int, one, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+// Notifier publishes drift events. It is called in its own goroutine once
+// the scan has run, so slow channels do not hold up the response.
+type Notifier func(ctx context.Context, e Event)
+
+// WithNotifier publishes an Event whenever a scan finds drift at or above
+// threshold, so alerts fire without anyone reading the chat. Probes do not
+// notify.
+func WithNotifier(threshold protocol.Severity, notify Notifier) Option {
+	return func(a *Agent) {
+		a.notify = notify
+		a.threshold = threshold
+	}
+}
+
+// publish sends the event for the drifts of a scan at or above the
+// threshold, if there are any.
+func (a *Agent) publish(ctx context.Context, req protocol.AgentRequest, drifts []driftResult) {
+	if a.notify == nil || req.Metadata[protocol.MetaProbe] != "" {
+		return
+	}
+	e := Event{
+		Type:        EventDetected,
+		Counts:      make(map[protocol.Severity]int),
+		Repo:        req.Metadata[protocol.MetaRepository],
+		Environment: req.Metadata[protocol.MetaEnvironment],
+		JobID:       req.Metadata[protocol.MetaJobID],
+		Time:        a.now(),
+	}
+	for _, d := range drifts {
+		if !d.Severity.AtLeast(a.threshold) {
+			continue
+		}
+		e.Drifts = append(e.Drifts, Drift{
+			ResourceType: d.ResourceType, Resource: d.ResourceName,
+			Property: d.Property, Expected: d.Expected, Actual: d.Actual, Severity: d.Severity,
+		})
+		e.Counts[d.Severity]++
+		if d.Severity.AtLeast(e.Severity) {
+			e.Severity = d.Severity
+		}
+	}
+	if len(e.Drifts) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+	go func() {
+		defer cancel()
+		a.notify(ctx, e)
+	}()
+}
@@ -0,0 +1,98 @@
+package drift
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// managedByTags are the tag keys, compared case-insensitively, naming who
+// manages a resource.
+var managedByTags = []string{"managed-by", "managed_by", "managedby"}
+
+// selfManaged are managed-by tag values meaning this IaC; any other value
+// excludes the resource from drift detection.
+var selfManaged = map[string]bool{"terraform": true, "bicep": true, "iac": true, "ghcp-iac": true}
+
+var indexRe = regexp.MustCompile(`\[\d+\]`)
+
+// exclusion is what drift detection skips for a resource.
+type exclusion struct {
+	// reason is set when the whole resource is skipped.
+	reason string
+	// paths are property paths skipped, with list indexes removed.
+	paths []string
+}
+
+// exclusionFor collects a resource's exclusions from its managed_by and
+// drift_ignore annotations, its managed-by tag, and Terraform's
+// lifecycle.ignore_changes.
+func exclusionFor(res protocol.Resource) exclusion {
+	var ex exclusion
+	if a := res.Annotations; a != nil {
+		if a.ManagedBy != "" {
+			ex.reason = fmt.Sprintf("managed by `%s` (annotation)", a.ManagedBy)
+		}
+		ex.paths = append(ex.paths, a.DriftIgnore...)
+	}
+	if ex.reason == "" {
+		if tags, ok := res.Properties["tags"].(map[string]interface{}); ok {
+			for k, v := range tags {
+				owner, _ := v.(string)
+				if containsFold(managedByTags, k) && owner != "" && !selfManaged[strings.ToLower(owner)] {
+					ex.reason = fmt.Sprintf("managed by `%s` (tag)", owner)
+					break
+				}
+			}
+		}
+	}
+	if lc, ok := res.Properties["lifecycle"].(map[string]interface{}); ok {
+		switch v := lc["ignore_changes"].(type) {
+		case string:
+			if v == "all" {
+				ex.paths = append(ex.paths, "*")
+			}
+		case []interface{}:
+			for _, p := range v {
+				if s, ok := p.(string); ok {
+					ex.paths = append(ex.paths, s)
+				}
+			}
+		}
+	}
+	for i, p := range ex.paths {
+		ex.paths[i] = indexRe.ReplaceAllString(p, "")
+	}
+	if ex.reason == "" && containsFold(ex.paths, "*") {
+		ex.reason = "all properties ignored"
+	}
+	return ex
+}
+
+// ignores reports whether drift in the property at path is skipped: the
+// path or one of its parents is excluded.
+func (ex exclusion) ignores(path string) bool {
+	path = indexRe.ReplaceAllString(path, "")
+	for _, p := range ex.paths {
+		if path == p || strings.HasPrefix(path, p+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// filter drops the drifts ex skips and returns how many it dropped.
+func (ex exclusion) filter(drifts []driftResult) ([]driftResult, int) {
+	if ex.reason != "" {
+		return nil, len(drifts)
+	}
+	kept := drifts[:0]
+	for _, d := range drifts {
+		if !ex.ignores(d.Property) {
+			kept = append(kept, d)
+		}
+	}
+	return kept, len(drifts) - len(kept)
+}
@@ -0,0 +1,129 @@
+package drift
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/azauth"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// LiveResource is a deployed Azure resource.
+type LiveResource struct {
+	// ID is the Azure resource ID.
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	ResourceGroup string `json:"resourceGroup"`
+}
+
+// InventoryFunc lists the deployed resources within scope.
+type InventoryFunc func(ctx context.Context, scope Scope) ([]LiveResource, error)
+
+// WithInventory compares the IaC against the deployed resources: those in
+// the scope the IaC targets but not declared in it are reported as missing
+// from IaC.
+func WithInventory(list InventoryFunc) Option {
+	return func(a *Agent) {
+		a.inventory = list
+	}
+}
+
+// ResourceGraph lists deployed resources with Azure Resource Graph.
+type ResourceGraph struct {
+	creds         azauth.TokenSource
+	subscriptions []string
+	baseURL       string
+	client        *http.Client
+}
+
+// NewResourceGraph creates an inventory over subscriptions, used when the
+// IaC names none. An empty baseURL uses the public cloud's
+// https://management.azure.com.
+func NewResourceGraph(creds azauth.TokenSource, subscriptions []string, baseURL string) *ResourceGraph {
+	if baseURL == "" {
+		baseURL = "https://management.azure.com"
+	}
+	return &ResourceGraph{
+		creds: creds, subscriptions: subscriptions, baseURL: strings.TrimRight(baseURL, "/"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Inventory runs the scope's query. It is an InventoryFunc.
+func (g *ResourceGraph) Inventory(ctx context.Context, scope Scope) ([]LiveResource, error) {
+	subs := scope.SubscriptionIDs
+	if len(subs) == 0 {
+		subs = g.subscriptions
+	}
+	token, err := g.creds.Token(ctx, g.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"subscriptions": subs,
+		"query":         scope.ResourceGraphQuery(),
+		"options":       map[string]string{"resultFormat": "objectArray"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL+"/providers/Microsoft.ResourceGraph/resources?api-version=2022-10-01", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return nil, fmt.Errorf("resource graph: status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var result struct {
+		Data []LiveResource `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 32<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("resource graph: %w", err)
+	}
+	return result.Data, nil
+}
+
+// unmanaged returns the live resources within scope that resources do not
+// declare, sorted by ID, and how many were left out as out of scope. The
+// query is already scoped; filtering again guards inventories that are not.
+func unmanaged(live []LiveResource, scope Scope, resources []protocol.Resource) ([]LiveResource, int) {
+	declared := make(map[string]bool)
+	for _, res := range resources {
+		name, ok := literalString(res.Properties["name"])
+		if !ok {
+			continue
+		}
+		// Without a known ARM type, a declared name matches any type.
+		declared[strings.ToLower(parser.ARMType(res.Type)+"/"+name)] = true
+	}
+	var out []LiveResource
+	outside := 0
+	for _, r := range live {
+		switch {
+		case !scope.InScope(r.ID):
+			outside++
+		case declared[strings.ToLower(r.Type+"/"+r.Name)], declared["/"+strings.ToLower(r.Name)]:
+		default:
+			out = append(out, r)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, outside
+}
@@ -0,0 +1,35 @@
+package drift
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// planDrift reports the properties a Terraform plan updates in place: state
+// (Actual) no longer matches the configuration (Expected), either because
+// the configuration changed or because someone changed the resource outside
+// Terraform. Values known only after apply are not compared.
+func planDrift(res protocol.Resource) []driftResult {
+	if res.Change == nil || res.Change.Action != protocol.ActionUpdate {
+		return nil
+	}
+	var drifts []driftResult
+	diffProperties(res.Properties, res.Change.Before, "", func(path string, expected, actual interface{}) {
+		drifts = append(drifts, driftResult{
+			ResourceType: res.Type, ResourceName: res.Name,
+			Property: path, Expected: planValue(expected),
+			Actual: planValue(actual),
+		})
+	})
+	sort.Slice(drifts, func(i, j int) bool { return drifts[i].Property < drifts[j].Property })
+	return drifts
+}
+
+func planValue(v interface{}) string {
+	if v == nil {
+		return "(unset)"
+	}
+	return fmt.Sprintf("%v", v)
+}
@@ -0,0 +1,153 @@
+package drift
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/kql"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+var (
+	providerBlockRe = regexp.MustCompile(`(?s)provider\s+"azurerm"\s*\{(.*?)\n\}`)
+	subscriptionRe  = regexp.MustCompile(`subscription_id\s*=\s*"([0-9a-fA-F-]{36})"`)
+	azureIDRe       = regexp.MustCompile(`(?i)/subscriptions/([0-9a-f-]{36})(?:/resourceGroups/([^/"'\s]+))?`)
+	bicepRGScopeRe  = regexp.MustCompile(`resourceGroup\('([^']+)'\)`)
+	tfRGRefRe       = regexp.MustCompile(`^azurerm_resource_group\.(\w+)\.name$`)
+)
+
+// Scope narrows live Azure queries to the subscriptions and resource groups
+// the IaC actually targets, so drift scans don't sweep the whole subscription
+// and flag other environments' resources as "missing in IaC".
+type Scope struct {
+	SubscriptionIDs []string `json:"subscription_ids,omitempty"`
+	ResourceGroups  []string `json:"resource_groups,omitempty"`
+}
+
+// ScopeFromIaC derives scoping hints from azurerm provider blocks, resource
+// group resources, resource_group_name arguments, and explicit Azure IDs.
+func ScopeFromIaC(iac *protocol.IaCInput) Scope {
+	subs := make(map[string]bool)
+	rgs := make(map[string]bool)
+	if iac == nil {
+		return Scope{}
+	}
+
+	for _, block := range providerBlockRe.FindAllStringSubmatch(iac.RawCode, -1) {
+		for _, m := range subscriptionRe.FindAllStringSubmatch(block[1], -1) {
+			subs[strings.ToLower(m[1])] = true
+		}
+	}
+	for _, m := range azureIDRe.FindAllStringSubmatch(iac.RawCode, -1) {
+		subs[strings.ToLower(m[1])] = true
+		if m[2] != "" {
+			rgs[m[2]] = true
+		}
+	}
+	for _, m := range bicepRGScopeRe.FindAllStringSubmatch(iac.RawCode, -1) {
+		rgs[m[1]] = true
+	}
+
+	// Resource group resources declared in the IaC, keyed by their local name
+	// so references like azurerm_resource_group.main.name can be resolved.
+	rgByRef := make(map[string]string)
+	for _, res := range iac.Resources {
+		if res.Type != "azurerm_resource_group" {
+			continue
+		}
+		if name, ok := literalString(res.Properties["name"]); ok {
+			rgs[name] = true
+			rgByRef[res.Name] = name
+		}
+	}
+	for _, res := range iac.Resources {
+		raw, ok := res.Properties["resource_group_name"].(string)
+		if !ok {
+			continue
+		}
+		if m := tfRGRefRe.FindStringSubmatch(raw); m != nil {
+			if name, ok := rgByRef[m[1]]; ok {
+				rgs[name] = true
+			}
+			continue
+		}
+		if name, ok := literalString(raw); ok {
+			rgs[name] = true
+		}
+	}
+
+	return Scope{SubscriptionIDs: sortedKeys(subs), ResourceGroups: sortedKeys(rgs)}
+}
+
+// IsEmpty reports whether no scoping hints were found.
+func (s Scope) IsEmpty() bool {
+	return len(s.SubscriptionIDs) == 0 && len(s.ResourceGroups) == 0
+}
+
+// InScope reports whether a live Azure resource ID falls within the scope.
+// An empty scope matches everything.
+func (s Scope) InScope(azureID string) bool {
+	if s.IsEmpty() {
+		return true
+	}
+	m := azureIDRe.FindStringSubmatch(azureID)
+	if m == nil {
+		return false
+	}
+	if len(s.SubscriptionIDs) > 0 && !containsFold(s.SubscriptionIDs, m[1]) {
+		return false
+	}
+	if len(s.ResourceGroups) > 0 && !containsFold(s.ResourceGroups, m[2]) {
+		return false
+	}
+	return true
+}
+
+// ResourceGraphQuery renders an Azure Resource Graph (KQL) query restricted
+// to the scope.
+func (s Scope) ResourceGraphQuery() string {
+	var sb strings.Builder
+	sb.WriteString("Resources")
+	if len(s.SubscriptionIDs) > 0 {
+		sb.WriteString(fmt.Sprintf("\n| where subscriptionId in~ (%s)", kql.QuoteList(s.SubscriptionIDs)))
+	}
+	if len(s.ResourceGroups) > 0 {
+		sb.WriteString(fmt.Sprintf("\n| where resourceGroup in~ (%s)", kql.QuoteList(s.ResourceGroups)))
+	}
+	sb.WriteString("\n| project id, name, type, resourceGroup, location, properties")
+	return sb.String()
+}
+
+// literalString returns v when it is a plain string literal rather than an
+// expression (variable, reference, or interpolation).
+func literalString(v interface{}) (string, bool) {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return "", false
+	}
+	if strings.Contains(s, "${") || strings.HasPrefix(s, "var.") || strings.HasPrefix(s, "local.") ||
+		strings.Count(s, ".") >= 2 || strings.ContainsAny(s, "() ") {
+		return "", false
+	}
+	return s, true
+}
+
+func containsFold(list []string, v string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/graph"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/llm"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
@@ -16,8 +17,14 @@ import (
 type Agent struct {
 	llmClient *llm.Client
 	enableLLM bool
+	baselines BaselineFunc
+	timings   graph.TimingFunc
+	live      DependentsFunc
 }
 
+// BaselineFunc looks up the dependency graph of an earlier analysis by ID.
+type BaselineFunc func(id string) (graph.Graph, bool)
+
 // New creates a new impact Agent.
 func New(opts ...Option) *Agent {
 	a := &Agent{}
@@ -38,20 +45,36 @@ func WithLLM(client *llm.Client) Option {
 	}
 }
 
+// WithBaselines lets requests carrying protocol.MetaBaseline be scored
+// against the graph of that earlier analysis.
+func WithBaselines(lookup BaselineFunc) Option {
+	return func(a *Agent) {
+		a.baselines = lookup
+	}
+}
+
+// WithTimings estimates apply durations from recorded applies where there
+// are enough of them, instead of the per-type heuristics.
+func WithTimings(history graph.TimingFunc) Option {
+	return func(a *Agent) {
+		a.timings = history
+	}
+}
+
 func (a *Agent) ID() string { return "impact" }
 
 func (a *Agent) Metadata() protocol.AgentMetadata {
 	return protocol.AgentMetadata{
 		ID:          "impact",
 		Name:        "Impact Analyzer",
-		Description: "Calculates blast radius and risk-weighted impact scores for IaC resources",
+		Description: "Calculates blast radius, risk-weighted impact scores and estimated apply duration for IaC resources",
 		Version:     "1.0.0",
 	}
 }
 
 func (a *Agent) Capabilities() protocol.AgentCapabilities {
 	return protocol.AgentCapabilities{
-		Formats:       []protocol.SourceFormat{protocol.FormatTerraform, protocol.FormatBicep},
+		Formats:       []protocol.SourceFormat{protocol.FormatTerraform, protocol.FormatBicep, protocol.FormatTerraformPlan},
 		NeedsIaCInput: true,
 	}
 }
@@ -64,26 +87,105 @@ func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit prot
 
 	emit.SendMessage("## Blast Radius\n\n")
 
-	total := 0
+	// moved/import blocks re-address or adopt resources without creating
+	// or destroying anything, so they don't add to the blast radius.
+	refactor := terraformRefactor(req.IaC)
+
+	// Weights and change risks come from the installed risk profile, with
+	// the overrides of the environment the request is run for.
+	profile, env := analyzer.ActiveRiskProfile(), req.Metadata[protocol.MetaEnvironment]
+
+	total, unchanged := 0, 0
 	var summary strings.Builder
+	var changed []string
+	risks := changeRisks{counts: make(map[string]int)}
 	for _, res := range req.IaC.Resources {
-		weight := analyzer.ResourceRiskWeight(res.Type)
-		total += weight
-		line := fmt.Sprintf("- **%s.%s** — risk weight: %d\n", parser.ShortType(res.Type), res.Name, weight)
+		id := res.Type + "." + res.Name
+		label := parser.ShortType(res.Type) + "." + res.Name
+		var line string
+		switch {
+		case res.Change != nil && res.Change.Action == protocol.ActionNoOp && !refactor.Imported[id] && movedFrom(refactor, id) == "":
+			unchanged++
+			continue
+		case refactor.Imported[id]:
+			line = fmt.Sprintf("- **%s** — imported (adopts existing infrastructure; review the plan for in-place updates)\n", label)
+		case movedFrom(refactor, id) != "":
+			line = fmt.Sprintf("- **%s** — moved from `%s` (address rename, no infrastructure change)\n", label, movedFrom(refactor, id))
+		case res.Change != nil:
+			weight := profile.Weight(res.Type, env)
+			if destructive(res.Change.Action) {
+				weight *= 2
+			}
+			total += weight
+			changed = append(changed, id)
+			cr := profile.ChangeRisk(res.Type, env, *res.Change)
+			risks.add(label, *res.Change, cr)
+			line = fmt.Sprintf("- **%s** — %s, risk weight: %d%s\n", label, changeLabel(*res.Change), weight, riskNote(cr))
+		default:
+			weight := profile.Weight(res.Type, env)
+			total += weight
+			changed = append(changed, id)
+			line = fmt.Sprintf("- **%s** — risk weight: %d\n", label, weight)
+		}
 		emit.SendMessage(line)
 		summary.WriteString(line)
 	}
 
-	level := "Low"
-	if total > 20 {
-		level = "Critical"
-	} else if total > 10 {
-		level = "High"
-	} else if total > 5 {
-		level = "Medium"
+	liveCount := 0
+	live, err := a.liveDependents(ctx, req.IaC.Resources, changed)
+	switch {
+	case err != nil:
+		emit.SendMessage(fmt.Sprintf("\n_Live dependents unavailable: %v_\n", err))
+	case len(live) > 0:
+		lines := liveSummary(live, req.IaC.Resources, profile, env)
+		emit.SendMessage("\n### Live Dependents\n\n" + lines)
+		summary.WriteString("\nDeployed dependents outside the IaC:\n" + lines)
+		seen := make(map[string]bool)
+		for _, d := range live {
+			if !seen[strings.ToLower(d.ID)] {
+				seen[strings.ToLower(d.ID)] = true
+				total += liveWeight(profile, env, d)
+			}
+		}
+		liveCount = len(seen)
 	}
 
+	level := blastSeverity(total).Label()
 	emit.SendMessage(fmt.Sprintf("\n**Total blast radius: %d (%s)**\n", total, level))
+	if n := len(refactor.Moved) + len(refactor.Imported); n > 0 {
+		emit.SendMessage(fmt.Sprintf("\n_%d moved and %d imported resource(s) are excluded: they change Terraform addresses or state, not infrastructure._\n",
+			len(refactor.Moved), len(refactor.Imported)))
+	}
+	if e, ok := profile.Environment(env); ok && e.Multiplier > 0 && e.Multiplier != 1 {
+		emit.SendMessage(fmt.Sprintf("\n_Weights use the %s risk profile, which scales them by %g._\n", env, e.Multiplier))
+	}
+	if liveCount > 0 {
+		emit.SendMessage(fmt.Sprintf("\n_The total includes %d deployed dependent(s) outside this code._\n", liveCount))
+	}
+	if unchanged > 0 {
+		emit.SendMessage(fmt.Sprintf("\n_%d resource(s) the plan leaves unchanged are excluded. Replacements and deletions count double._\n", unchanged))
+	}
+
+	if risks.planned() {
+		emit.SendMessage("\n### Change Risk\n\n" + risks.String())
+		summary.WriteString("\nChange risk:\n" + risks.String())
+	}
+
+	if deps := dependents(graph.Build(req.IaC.Resources), changed); deps != "" {
+		emit.SendMessage("\n### Dependents\n\n" + deps)
+		summary.WriteString("\nDependents:\n" + deps)
+	}
+
+	est := a.estimateApply(req.IaC.Resources, refactor)
+	if len(est.Items) > 0 {
+		emitApplyEstimate(est, emit)
+		summary.WriteString("\nApply estimate: " + est.Summary() + "\n")
+	}
+
+	if diff, ok := a.baselineDiff(req, refactor); ok {
+		emitBaselineDiff(diff, emit)
+		summary.WriteString(fmt.Sprintf("\nChange vs baseline: %s\n", diff.Summary()))
+	}
 
 	// LLM-enhanced blast radius explanation
 	if a.enableLLM && a.llmClient != nil && req.Token != "" {
@@ -93,6 +195,219 @@ func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit prot
 	return nil
 }
 
+// dependents lists, for each changed resource, the resources that refer to
+// it directly or through others, which a change to it can break.
+func dependents(g graph.Graph, changed []string) string {
+	label := make(map[string]string, len(g.Nodes))
+	for _, n := range g.Nodes {
+		label[n.ID] = n.Label()
+	}
+	var sb strings.Builder
+	for _, id := range changed {
+		deps := g.Dependents(id)
+		if len(deps) == 0 {
+			continue
+		}
+		labels := make([]string, len(deps))
+		for i, d := range deps {
+			labels[i] = label[d]
+		}
+		sb.WriteString(fmt.Sprintf("- **%s** ← %s\n", label[id], strings.Join(labels, ", ")))
+	}
+	return sb.String()
+}
+
+// estimateApply estimates how long the change takes to apply. Moved and
+// imported resources change nothing in Azure, so they take no time.
+func (a *Agent) estimateApply(resources []protocol.Resource, refactor graph.Refactor) graph.ApplyEstimate {
+	changing := make([]protocol.Resource, 0, len(resources))
+	for _, res := range resources {
+		id := res.Type + "." + res.Name
+		if refactor.Imported[id] || movedFrom(refactor, id) != "" {
+			continue
+		}
+		changing = append(changing, res)
+	}
+	return graph.EstimateApply(changing, a.timings)
+}
+
+func emitApplyEstimate(est graph.ApplyEstimate, emit protocol.Emitter) {
+	emit.SendMessage("\n### Estimated Apply Duration\n\n")
+	emit.SendMessage("| Resource | Action | Estimate | Basis |\n|----------|--------|----------|-------|\n")
+	for _, it := range est.Items {
+		basis := "type heuristic"
+		if it.Samples > 0 {
+			basis = fmt.Sprintf("median of %d recorded applies", it.Samples)
+		}
+		typ, name, _ := strings.Cut(it.ID, ".")
+		emit.SendMessage(fmt.Sprintf("| %s.%s | %s | %s | %s |\n", parser.ShortType(typ), name, it.Action, graph.FormatDuration(it.Duration), basis))
+	}
+	emit.SendMessage(fmt.Sprintf("\n**%s**\n\n", est.Summary()))
+	emit.SendMessage("_Independent resources apply in parallel, so the total follows the longest dependency chain. The window adds half again plus 15 minutes for validation and rollback._\n")
+}
+
+// baselineDiff compares the request's graph with the baseline analysis it
+// names, if any.
+func (a *Agent) baselineDiff(req protocol.AgentRequest, refactor graph.Refactor) (graph.Diff, bool) {
+	id := req.Metadata[protocol.MetaBaseline]
+	if id == "" || a.baselines == nil {
+		return graph.Diff{}, false
+	}
+	base, ok := a.baselines(id)
+	if !ok {
+		return graph.Diff{}, false
+	}
+	return graph.CompareRefactored(base, graph.Build(req.IaC.Resources), refactor), true
+}
+
+// terraformRefactor collects the moved and import blocks in Terraform
+// input, or the moves and imports a plan records.
+func terraformRefactor(iac *protocol.IaCInput) graph.Refactor {
+	r := graph.Refactor{Moved: make(map[string]string), Imported: make(map[string]bool)}
+	if iac.Format == protocol.FormatTerraformPlan {
+		for _, res := range iac.Resources {
+			id := res.Type + "." + res.Name
+			if res.Change.PreviousAddress != "" && res.Change.PreviousAddress != id {
+				r.Moved[res.Change.PreviousAddress] = id
+			}
+			if res.Change.Importing {
+				r.Imported[id] = true
+			}
+		}
+		return r
+	}
+	if iac.Format != protocol.FormatTerraform {
+		return r
+	}
+	code := iac.RawCode
+	for _, f := range iac.Files {
+		code += "\n" + f.Content
+	}
+	for _, m := range parser.ParseTerraformMoves(code) {
+		r.Moved[m.From] = m.To
+	}
+	for _, im := range parser.ParseTerraformImports(code) {
+		r.Imported[im.To] = true
+	}
+	return r
+}
+
+// movedFrom returns the old address of a moved resource, or "".
+func movedFrom(r graph.Refactor, id string) string {
+	for from, to := range r.Moved {
+		if to == id {
+			return from
+		}
+	}
+	return ""
+}
+
+// emitBaselineDiff scores the change by the weight of the resources it
+// touches rather than the whole graph, so a small edit to a large estate
+// isn't rated by the estate's size.
+func emitBaselineDiff(diff graph.Diff, emit protocol.Emitter) {
+	emit.SendMessage("\n### Change vs Baseline\n\n")
+	if diff.Empty() {
+		emit.SendMessage("No resources or dependencies changed.\n")
+		return
+	}
+	emit.SendMessage(diff.Summary() + "\n\n")
+	emit.SendMessage(fmt.Sprintf("**Change risk: %d (%s)**\n\n", diff.ChangedWeight, blastSeverity(diff.ChangedWeight).Label()))
+	emit.SendMessage("```mermaid\n" + diff.Mermaid() + "```\n")
+}
+
+// destructive reports whether a planned action destroys the resource.
+func destructive(action string) bool {
+	return action == protocol.ActionReplace || action == protocol.ActionDelete
+}
+
+// changeLabel describes a planned change in the words of a review: a
+// replace says in which order it happens and which attributes force it.
+func changeLabel(c protocol.Change) string {
+	switch c.Action {
+	case protocol.ActionUpdate:
+		return "update in place"
+	case protocol.ActionDelete:
+		return "destroy"
+	case protocol.ActionReplace:
+		s := "replace (destroy then create)"
+		if c.CreateBeforeDestroy {
+			s = "replace (create before destroy)"
+		}
+		if len(c.ReplacePaths) > 0 {
+			s += ", forced by `" + strings.Join(c.ReplacePaths, "`, `") + "`"
+		}
+		return s
+	}
+	return c.Action
+}
+
+func riskNote(r analyzer.ChangeRisk) string {
+	var risks []string
+	if r.Downtime {
+		risks = append(risks, "downtime")
+	}
+	if r.DataLoss {
+		risks = append(risks, "data loss")
+	}
+	if len(risks) == 0 {
+		return ""
+	}
+	return " — ⚠️ " + strings.Join(risks, ", ")
+}
+
+// changeRisks tallies the planned changes of a request by action and the
+// resources whose change risks downtime or data loss.
+type changeRisks struct {
+	counts             map[string]int
+	downtime, dataLoss []string
+}
+
+func (c *changeRisks) add(label string, change protocol.Change, r analyzer.ChangeRisk) {
+	c.counts[change.Action]++
+	if r.Downtime {
+		c.downtime = append(c.downtime, label)
+	}
+	if r.DataLoss {
+		c.dataLoss = append(c.dataLoss, label)
+	}
+}
+
+// planned reports whether the request was a plan with changes.
+func (c changeRisks) planned() bool {
+	return len(c.counts) > 0
+}
+
+func (c changeRisks) String() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%d to create, %d to update in place, %d to replace, %d to destroy.\n",
+		c.counts[protocol.ActionCreate], c.counts[protocol.ActionUpdate], c.counts[protocol.ActionReplace], c.counts[protocol.ActionDelete]))
+	if len(c.dataLoss) > 0 {
+		sb.WriteString("\n- ⚠️ **Data loss:** " + strings.Join(c.dataLoss, ", ") + " (back up or snapshot first)\n")
+	}
+	if len(c.downtime) > 0 {
+		if len(c.dataLoss) == 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("- ⚠️ **Downtime:** " + strings.Join(c.downtime, ", ") + " (apply in a maintenance window, or use create_before_destroy)\n")
+	}
+	return sb.String()
+}
+
+// blastSeverity maps a total risk weight onto the shared severity scale.
+func blastSeverity(total int) protocol.Severity {
+	switch {
+	case total > 20:
+		return protocol.SeverityCritical
+	case total > 10:
+		return protocol.SeverityHigh
+	case total > 5:
+		return protocol.SeverityMedium
+	default:
+		return protocol.SeverityLow
+	}
+}
+
 const impactPrompt = `You are a senior cloud architect assessing infrastructure change risk. Given the IaC code and blast radius analysis below, provide:
 1. A risk assessment explaining what could go wrong if these resources are modified or deleted
 2. Dependency chain analysis — which resources depend on others
@@ -2,10 +2,19 @@ package impact
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/graph"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
 )
@@ -56,6 +65,258 @@ resource "azurerm_storage_account" "store" {
 	}
 }
 
+func TestAgent_ApplyDuration(t *testing.T) {
+	tfCode := `resource "azurerm_kubernetes_cluster" "aks" {
+  name = "myaks"
+}
+
+resource "azurerm_storage_account" "store" {
+  name = "mystore"
+}`
+	run := func(a *Agent) string {
+		req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "impact:\n```hcl\n" + tfCode + "\n```"}}}
+		host.ParseAndEnrich(&req)
+		rec := &prototest.Recorder{}
+		if err := a.Handle(context.Background(), req, rec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return strings.Join(rec.Messages, "")
+	}
+
+	out := run(New())
+	for _, want := range []string{
+		"### Estimated Apply Duration",
+		"| kubernetes_cluster.aks | create | 10m | type heuristic |",
+		"| storage_account.store | create | 1m | type heuristic |",
+		"**~10m to apply; suggested maintenance window 30m**",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+
+	history := func(resourceType, _ string) (time.Duration, int) {
+		if resourceType == "azurerm_kubernetes_cluster" {
+			return 25 * time.Minute, 4
+		}
+		return 0, 0
+	}
+	out = run(New(WithTimings(history)))
+	if !strings.Contains(out, "| kubernetes_cluster.aks | create | 25m | median of 4 recorded applies |") ||
+		!strings.Contains(out, "suggested maintenance window 1h") {
+		t.Errorf("expected recorded timings to drive the estimate:\n%s", out)
+	}
+}
+
+func TestAgent_Dependents(t *testing.T) {
+	tfCode := `resource "azurerm_virtual_network" "main" {
+  name = "vnet"
+}
+
+resource "azurerm_subnet" "app" {
+  virtual_network_name = azurerm_virtual_network.main.name
+}
+
+resource "azurerm_kubernetes_cluster" "aks" {
+  # Not in azurerm_virtual_network.main directly.
+  vnet_subnet_id = azurerm_subnet.app.id
+}`
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "impact:\n```hcl\n" + tfCode + "\n```"}}}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"### Dependents",
+		"- **virtual_network.main** ← kubernetes_cluster.aks, subnet.app\n",
+		"- **subnet.app** ← kubernetes_cluster.aks\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "**kubernetes_cluster.aks** ←") {
+		t.Error("nothing depends on the cluster")
+	}
+}
+
+func TestAgent_LiveDependents(t *testing.T) {
+	tfCode := `resource "azurerm_virtual_network" "main" {
+  name = "vnet-prod"
+}
+
+resource "azurerm_subnet" "app" {
+  name                 = "snet-app"
+  virtual_network_name = azurerm_virtual_network.main.name
+}
+
+resource "azurerm_key_vault" "kv" {
+  name = "kv-prod"
+}
+
+resource "azurerm_linux_virtual_machine" "jump" {
+  name = "vm-jump"
+}`
+	var got []Target
+	lookup := func(_ context.Context, targets []Target) ([]LiveDependent, error) {
+		got = targets
+		vm := "/subscriptions/s/resourceGroups/rg-app/providers/Microsoft.Compute/virtualMachines/"
+		return []LiveDependent{
+			{ID: vm + "vm-1", Name: "vm-1", Type: "Microsoft.Compute/virtualMachines", ResourceGroup: "rg-app", Target: "azurerm_subnet.app"},
+			{ID: vm + "vm-1", Name: "vm-1", Type: "Microsoft.Compute/virtualMachines", ResourceGroup: "rg-app", Target: "azurerm_key_vault.kv"},
+			// The network lists its own subnets.
+			{ID: "/x/virtualNetworks/vnet-prod", Name: "vnet-prod", Type: "Microsoft.Network/virtualNetworks", Target: "azurerm_subnet.app"},
+			// Declared in the code, so already counted.
+			{ID: vm + "vm-jump", Name: "vm-jump", Type: "Microsoft.Compute/virtualMachines", Target: "azurerm_subnet.app"},
+			{ID: "/x/sites/web", Name: "web", Type: "Microsoft.Web/sites", ResourceGroup: "rg-web", Target: "azurerm_key_vault.kv"},
+		}, nil
+	}
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "impact:\n```hcl\n" + tfCode + "\n```"}}}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New(WithLiveDependents(lookup)).Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var subnet *Target
+	for i := range got {
+		if got[i].ID == "azurerm_subnet.app" {
+			subnet = &got[i]
+		}
+	}
+	if subnet == nil || subnet.Parent != "vnet-prod" || subnet.ARMType != "Microsoft.Network/virtualNetworks/subnets" {
+		t.Fatalf("targets = %+v, want the subnet in vnet-prod", got)
+	}
+	out := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"### Live Dependents",
+		"- **subnet.app** is used by deployed resources outside this code:\n  - `vm-1` (Microsoft.Compute/virtualMachines, resource group rg-app), risk weight: 5\n",
+		"- **key_vault.kv** is used by",
+		"`web` (Microsoft.Web/sites, resource group rg-web), risk weight: 2",
+		// vnet(3) + subnet(2) + key vault(6) + VM(5), plus vm-1(5) once and web(2).
+		"**Total blast radius: 23 (Critical)**",
+		"includes 2 deployed dependent(s)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "`vnet-prod`") || strings.Contains(out, "`vm-jump`") {
+		t.Errorf("the subnet's network and declared resources are not live dependents:\n%s", out)
+	}
+}
+
+func TestAgent_LiveDependentsUnavailable(t *testing.T) {
+	lookup := func(context.Context, []Target) ([]LiveDependent, error) {
+		return nil, errors.New("forbidden")
+	}
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "impact:\n```hcl\nresource \"azurerm_key_vault\" \"kv\" {\n  name = \"kv-prod\"\n}\n```"}}}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New(WithLiveDependents(lookup)).Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := strings.Join(rec.Messages, "")
+	if !strings.Contains(out, "_Live dependents unavailable: forbidden_") || !strings.Contains(out, "Total blast radius: 6") {
+		t.Errorf("got:\n%s", out)
+	}
+}
+
+type staticToken string
+
+func (s staticToken) Token(context.Context, string) (string, error) { return string(s), nil }
+
+func TestResourceGraph_Dependents(t *testing.T) {
+	var body struct {
+		Subscriptions []string `json:"subscriptions"`
+		Query         string   `json:"query"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/providers/Microsoft.ResourceGraph/resources" || r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"totalRecords":1,"data":[{"id":"/s/vm-1","name":"vm-1","type":"microsoft.compute/virtualmachines","resourceGroup":"rg","target":"azurerm_subnet.app"}]}`))
+	}))
+	defer srv.Close()
+
+	g := NewResourceGraph(staticToken("tok"), []string{"sub-1"}, srv.URL)
+	deps, err := g.Dependents(context.Background(), []Target{
+		{ID: "azurerm_subnet.app", ARMType: "Microsoft.Network/virtualNetworks/subnets", Name: "snet-app", Parent: "vnet-prod"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deps) != 1 || deps[0].Name != "vm-1" || deps[0].Target != "azurerm_subnet.app" {
+		t.Errorf("deps = %+v", deps)
+	}
+	if len(body.Subscriptions) != 1 || body.Subscriptions[0] != "sub-1" {
+		t.Errorf("subscriptions = %v", body.Subscriptions)
+	}
+	if want := "p contains '/providers/microsoft.network/virtualnetworks/vnet-prod/subnets/snet-app\"'"; !strings.Contains(body.Query, want) {
+		t.Errorf("query missing %q:\n%s", want, body.Query)
+	}
+}
+
+func TestDependentsQuery_EscapesNames(t *testing.T) {
+	resources := []protocol.Resource{{
+		Type: "azurerm_key_vault", Name: `kv') | union (Resources`,
+		Properties: map[string]interface{}{"name": "kv-prod"},
+	}}
+	targets := liveTargets(resources, []string{`azurerm_key_vault.kv') | union (Resources`})
+	if len(targets) != 1 {
+		t.Fatalf("targets = %+v", targets)
+	}
+	q := DependentsQuery(targets)
+	if want := `'azurerm_key_vault.kv\') | union (Resources'`; !strings.Contains(q, want) {
+		t.Errorf("query missing %s:\n%s", want, q)
+	}
+	if strings.Contains(q, `kv') |`) {
+		t.Errorf("resource name escaped the string literal:\n%s", q)
+	}
+}
+
+func TestAgent_RiskProfileEnvironment(t *testing.T) {
+	profile, err := analyzer.ParseRiskProfile([]byte(`{
+		"default_weight": 2,
+		"types": {"azurerm_storage_account": {"weight": 4}},
+		"environments": {"prod": {"multiplier": 2, "types": {"azurerm_storage_account": {"data_loss": true}}}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzer.InstallRiskProfile(profile)
+	defer analyzer.InstallRiskProfile(nil)
+
+	plan := `{"format_version":"1.2","resource_changes":[{"address":"azurerm_storage_account.sa","mode":"managed","type":"azurerm_storage_account","name":"sa","change":{"actions":["delete"],"before":{"name":"sa"},"after":null}}]}`
+	run := func(env string) string {
+		req := protocol.AgentRequest{Prompt: "```json\n" + plan + "\n```", Metadata: map[string]string{protocol.MetaEnvironment: env}}
+		host.ParseAndEnrich(&req)
+		rec := &prototest.Recorder{}
+		if err := New().Handle(context.Background(), req, rec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return strings.Join(rec.Messages, "")
+	}
+
+	dev := run("dev")
+	if !strings.Contains(dev, "destroy, risk weight: 8 — ⚠️ downtime\n") || strings.Contains(dev, "data loss") {
+		t.Errorf("dev:\n%s", dev)
+	}
+	prod := run("prod")
+	for _, want := range []string{
+		"destroy, risk weight: 16 — ⚠️ downtime, data loss\n",
+		"**Total blast radius: 16 (High)**",
+		"_Weights use the prod risk profile, which scales them by 2._",
+	} {
+		if !strings.Contains(prod, want) {
+			t.Errorf("missing %q in:\n%s", want, prod)
+		}
+	}
+}
+
 func TestAgent_NoIaC(t *testing.T) {
 	a := New()
 	rec := &prototest.Recorder{}
@@ -72,3 +333,140 @@ func TestAgent_NoIaC(t *testing.T) {
 func TestAgent_ImplementsAgent(t *testing.T) {
 	var _ protocol.Agent = (*Agent)(nil)
 }
+
+func TestAgent_BaselineDiff(t *testing.T) {
+	base := graph.Build(parser.ParseResources(`resource "azurerm_storage_account" "store" {
+  name = "mystore"
+}`))
+	a := New(WithBaselines(func(id string) (graph.Graph, bool) {
+		return base, id == "job-1"
+	}))
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "impact:\n```hcl\n" + `resource "azurerm_storage_account" "store" {
+  name = "mystore"
+}
+
+resource "azurerm_kubernetes_cluster" "aks" {
+  name = "myaks"
+}` + "\n```"}},
+		Metadata: map[string]string{protocol.MetaBaseline: "job-1"},
+	}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{"Change vs Baseline", "+1 / -0 resources", "blast radius 4 → 12 (+8)", "**Change risk: 8 (Medium)**", "```mermaid"} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("output missing %q:\n%s", want, combined)
+		}
+	}
+}
+
+func TestAgent_MovedAndImportedResources(t *testing.T) {
+	base := graph.Build(parser.ParseResources(`resource "azurerm_kubernetes_cluster" "main" {
+  name = "aks"
+}`))
+	a := New(WithBaselines(func(id string) (graph.Graph, bool) {
+		return base, id == "job-1"
+	}))
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "impact:\n```hcl\n" + `moved {
+  from = azurerm_kubernetes_cluster.main
+  to   = azurerm_kubernetes_cluster.primary
+}
+
+import {
+  to = azurerm_key_vault.shared
+  id = "/subscriptions/000/resourceGroups/rg/providers/Microsoft.KeyVault/vaults/kv"
+}
+
+resource "azurerm_kubernetes_cluster" "primary" {
+  name = "aks"
+}
+
+resource "azurerm_key_vault" "shared" {
+  name = "kv"
+}` + "\n```"}},
+		Metadata: map[string]string{protocol.MetaBaseline: "job-1"},
+	}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"**kubernetes_cluster.primary** — moved from `azurerm_kubernetes_cluster.main`",
+		"**key_vault.shared** — imported",
+		"**Total blast radius: 0 (Low)**",
+		"1 moved and 1 imported resource(s) are excluded",
+		"+1 / -0 resources",
+		"**Change risk: 0 (Low)**",
+	} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("output missing %q:\n%s", want, combined)
+		}
+	}
+}
+
+func TestAgent_TerraformPlan(t *testing.T) {
+	plan, err := os.ReadFile("../../internal/testkit/scenarios/storage-plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := protocol.AgentRequest{Prompt: "review this plan:\n```json\n" + string(plan) + "```"}
+	host.ParseAndEnrich(&req)
+	if req.IaC == nil || req.IaC.Format != protocol.FormatTerraformPlan {
+		t.Fatalf("IaC = %+v", req.IaC)
+	}
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"kubernetes_cluster.old** — destroy, risk weight: 16 — ⚠️ downtime\n",
+		"storage_account.sa** — update in place, risk weight: 4\n",
+		"resource_group.rg** — moved from `azurerm_resource_group.main`",
+		"1 to create, 1 to update in place, 0 to replace, 1 to destroy.",
+		"- ⚠️ **Downtime:** kubernetes_cluster.old",
+	} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("missing %q:\n%s", want, combined)
+		}
+	}
+}
+
+func TestAgent_PlanReplacements(t *testing.T) {
+	plan := `{"format_version": "1.2", "resource_changes": [
+  {"address": "azurerm_storage_account.data", "mode": "managed", "type": "azurerm_storage_account", "name": "data",
+   "change": {"actions": ["delete", "create"], "before": {"name": "stdata", "location": "eastus"}, "after": {"name": "stdata", "location": "westus"},
+              "replace_paths": [["location"]]}},
+  {"address": "azurerm_linux_web_app.api", "mode": "managed", "type": "azurerm_linux_web_app", "name": "api",
+   "change": {"actions": ["create", "delete"], "before": {"name": "api"}, "after": {"name": "api"},
+              "replace_paths": [["site_config", 0, "application_stack"]]}},
+  {"address": "azurerm_subnet.app", "mode": "managed", "type": "azurerm_subnet", "name": "app",
+   "change": {"actions": ["update"], "before": {"name": "app"}, "after": {"name": "app"}}}
+]}`
+	req := protocol.AgentRequest{Prompt: "```json\n" + plan + "\n```"}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"**storage_account.data** — replace (destroy then create), forced by `location`, risk weight: 8 — ⚠️ downtime, data loss\n",
+		"**linux_web_app.api** — replace (create before destroy), forced by `site_config[0].application_stack`, risk weight: 4\n",
+		"**subnet.app** — update in place, risk weight: 2\n",
+		"0 to create, 1 to update in place, 2 to replace, 0 to destroy.",
+		"- ⚠️ **Data loss:** storage_account.data",
+		"- ⚠️ **Downtime:** storage_account.data (",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package impact
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/azauth"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/kql"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Target is a changed resource whose deployed dependents are looked up.
+type Target struct {
+	// ID is the resource's node ID, e.g. "azurerm_subnet.app".
+	ID string
+	// ARMType and Name identify the resource in Azure. Parent is the name
+	// of the resource a child type belongs to, such as a subnet's network.
+	ARMType string
+	Name    string
+	Parent  string
+}
+
+// LiveDependent is a deployed resource that refers to a changed one but
+// is not in the analyzed IaC.
+type LiveDependent struct {
+	// ID is the Azure resource ID.
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Type          string `json:"type"`
+	ResourceGroup string `json:"resourceGroup"`
+	// Target is the node ID of the changed resource it refers to.
+	Target string `json:"target"`
+}
+
+// DependentsFunc finds the deployed resources that refer to targets.
+type DependentsFunc func(ctx context.Context, targets []Target) ([]LiveDependent, error)
+
+// WithLiveDependents adds the deployed resources that depend on the
+// changed ones, but are not in the request's IaC, to the blast radius: VMs
+// in a subnet being modified, apps reading from a key vault.
+func WithLiveDependents(lookup DependentsFunc) Option {
+	return func(a *Agent) {
+		a.live = lookup
+	}
+}
+
+// childTypes are the ARM types of child resources parser.ARMType does
+// not map, with the property naming their parent.
+var childTypes = map[string]struct{ armType, parentProp string }{
+	"azurerm_subnet": {"Microsoft.Network/virtualNetworks/subnets", "virtual_network_name"},
+}
+
+// extraARMTypes maps network and identity types parser.ARMType does not,
+// which other resources commonly refer to.
+var extraARMTypes = map[string]string{
+	"azurerm_network_interface":          "Microsoft.Network/networkInterfaces",
+	"azurerm_public_ip":                  "Microsoft.Network/publicIPAddresses",
+	"azurerm_route_table":                "Microsoft.Network/routeTables",
+	"azurerm_private_dns_zone":           "Microsoft.Network/privateDnsZones",
+	"azurerm_application_gateway":        "Microsoft.Network/applicationGateways",
+	"azurerm_lb":                         "Microsoft.Network/loadBalancers",
+	"azurerm_user_assigned_identity":     "Microsoft.ManagedIdentity/userAssignedIdentities",
+	"azurerm_log_analytics_workspace":    "Microsoft.OperationalInsights/workspaces",
+	"azurerm_linux_virtual_machine":      "Microsoft.Compute/virtualMachines",
+	"azurerm_windows_virtual_machine":    "Microsoft.Compute/virtualMachines",
+	"azurerm_postgresql_flexible_server": "Microsoft.DBforPostgreSQL/flexibleServers",
+}
+
+var (
+	azureNameRe = regexp.MustCompile(`^[A-Za-z0-9][\w.-]*$`)
+	tfNameRefRe = regexp.MustCompile(`^(azurerm_\w+)\.([\w-]+)\.name$`)
+)
+
+// liveTargets returns the changed resources that can be found in Azure:
+// those of a known ARM type with a literal name. Planned creates have no
+// deployed dependents yet.
+func liveTargets(resources []protocol.Resource, changed []string) []Target {
+	isChanged := make(map[string]bool, len(changed))
+	for _, id := range changed {
+		isChanged[id] = true
+	}
+	names := make(map[string]string, len(resources))
+	for _, res := range resources {
+		if name, ok := literalName(res.Properties["name"]); ok {
+			names[res.Type+"."+res.Name] = name
+		}
+	}
+	var targets []Target
+	for _, res := range resources {
+		id := res.Type + "." + res.Name
+		name, ok := names[id]
+		if !isChanged[id] || !ok || (res.Change != nil && res.Change.Action == protocol.ActionCreate) {
+			continue
+		}
+		t := Target{ID: id, Name: name, ARMType: armType(res.Type)}
+		if child, ok := childTypes[res.Type]; ok {
+			parent, ok := literalName(res.Properties[child.parentProp])
+			if m := tfNameRefRe.FindStringSubmatch(fmt.Sprint(res.Properties[child.parentProp])); m != nil {
+				parent, ok = names[m[1]+"."+m[2]]
+			}
+			if !ok {
+				continue
+			}
+			t.Parent = parent
+		}
+		if t.ARMType != "" {
+			targets = append(targets, t)
+		}
+	}
+	return targets
+}
+
+// armType returns the ARM type of a parsed resource type, or "".
+func armType(resType string) string {
+	if child, ok := childTypes[resType]; ok {
+		return child.armType
+	}
+	if t, ok := extraARMTypes[resType]; ok {
+		return t
+	}
+	return parser.ARMType(resType)
+}
+
+// literalName returns v when it is a plain Azure resource name rather than
+// an expression.
+func literalName(v interface{}) (string, bool) {
+	s, ok := v.(string)
+	if !ok || strings.Count(s, ".") >= 2 || !azureNameRe.MatchString(s) {
+		return "", false
+	}
+	return s, true
+}
+
+// needles are the lowercase strings a resource's properties contain when
+// they refer to t: its resource ID, and for key vaults its URI, which
+// secret and certificate references use.
+func (t Target) needles() []string {
+	path := "/providers/" + t.ARMType + "/" + t.Name
+	if t.Parent != "" {
+		i := strings.LastIndex(t.ARMType, "/")
+		path = "/providers/" + t.ARMType[:i] + "/" + t.Parent + "/" + t.ARMType[i+1:] + "/" + t.Name
+	}
+	path = strings.ToLower(path)
+	out := []string{path + `"`, path + "/"}
+	if strings.EqualFold(t.ARMType, "Microsoft.KeyVault/vaults") {
+		out = append(out, "https://"+strings.ToLower(t.Name)+".vault.azure.net")
+	}
+	return out
+}
+
+// self reports whether a live resource is t, or the parent t belongs to,
+// whose properties list their own children.
+func (t Target) self(d LiveDependent) bool {
+	if strings.EqualFold(d.Type, t.ARMType) && strings.EqualFold(d.Name, t.Name) {
+		return true
+	}
+	if t.Parent == "" {
+		return false
+	}
+	i := strings.LastIndex(t.ARMType, "/")
+	return strings.EqualFold(d.Type, t.ARMType[:i]) && strings.EqualFold(d.Name, t.Parent)
+}
+
+// DependentsQuery renders the Azure Resource Graph (KQL) query for the
+// resources whose properties refer to any of targets, tagging each with
+// the target it refers to.
+func DependentsQuery(targets []Target) string {
+	var cases []string
+	for _, t := range targets {
+		var conds []string
+		for _, n := range t.needles() {
+			conds = append(conds, "p contains "+kql.Quote(n))
+		}
+		cases = append(cases, strings.Join(conds, " or "), kql.Quote(t.ID))
+	}
+	return "Resources\n" +
+		"| extend p = tolower(tostring(properties))\n" +
+		"| extend target = case(" + strings.Join(cases, ", ") + ", '')\n" +
+		"| where target != ''\n" +
+		"| project id, name, type, resourceGroup, target\n" +
+		"| limit 1000"
+}
+
+// ResourceGraph finds live dependents with Azure Resource Graph.
+type ResourceGraph struct {
+	creds         azauth.TokenSource
+	subscriptions []string
+	baseURL       string
+	client        *http.Client
+}
+
+// NewResourceGraph creates a lookup over subscriptions. An empty baseURL
+// uses the public cloud's https://management.azure.com.
+func NewResourceGraph(creds azauth.TokenSource, subscriptions []string, baseURL string) *ResourceGraph {
+	if baseURL == "" {
+		baseURL = "https://management.azure.com"
+	}
+	return &ResourceGraph{
+		creds: creds, subscriptions: subscriptions, baseURL: strings.TrimRight(baseURL, "/"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Dependents queries the deployed resources that refer to targets. It is
+// a DependentsFunc.
+func (g *ResourceGraph) Dependents(ctx context.Context, targets []Target) ([]LiveDependent, error) {
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	token, err := g.creds.Token(ctx, g.baseURL)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"subscriptions": g.subscriptions,
+		"query":         DependentsQuery(targets),
+		"options":       map[string]string{"resultFormat": "objectArray"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, g.baseURL+"/providers/Microsoft.ResourceGraph/resources?api-version=2022-10-01", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return nil, fmt.Errorf("resource graph: status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var result struct {
+		Data []LiveDependent `json:"data"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 8<<20)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("resource graph: %w", err)
+	}
+	return result.Data, nil
+}
+
+// liveDependents looks up the deployed dependents of the changed resources,
+// leaving out the targets themselves and resources the IaC declares, which
+// the analysis already covers.
+func (a *Agent) liveDependents(ctx context.Context, resources []protocol.Resource, changed []string) ([]LiveDependent, error) {
+	targets := liveTargets(resources, changed)
+	if a.live == nil || len(targets) == 0 {
+		return nil, nil
+	}
+	found, err := a.live(ctx, targets)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]Target, len(targets))
+	for _, t := range targets {
+		byID[t.ID] = t
+	}
+	declared := make(map[string]bool)
+	for _, res := range resources {
+		if name, ok := literalName(res.Properties["name"]); ok {
+			declared[strings.ToLower(armType(res.Type)+"/"+name)] = true
+		}
+	}
+	var out []LiveDependent
+	for _, d := range found {
+		t, ok := byID[d.Target]
+		if !ok || t.self(d) || declared[strings.ToLower(d.Type+"/"+d.Name)] {
+			continue
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Target != out[j].Target {
+			return out[i].Target < out[j].Target
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+// liveWeight is the risk weight of a deployed resource in env, by the
+// Terraform type its ARM type maps to.
+func liveWeight(profile *analyzer.RiskProfile, env string, d LiveDependent) int {
+	return profile.Weight(parser.ParseARM(map[string]interface{}{"type": d.Type, "name": d.Name}).Type, env)
+}
+
+// liveSummary lists the deployed dependents under the changed resource
+// they refer to.
+func liveSummary(live []LiveDependent, resources []protocol.Resource, profile *analyzer.RiskProfile, env string) string {
+	label := make(map[string]string, len(resources))
+	for _, res := range resources {
+		label[res.Type+"."+res.Name] = parser.ShortType(res.Type) + "." + res.Name
+	}
+	var sb strings.Builder
+	for i, d := range live {
+		if i == 0 || live[i-1].Target != d.Target {
+			sb.WriteString(fmt.Sprintf("- **%s** is used by deployed resources outside this code:\n", label[d.Target]))
+		}
+		sb.WriteString(fmt.Sprintf("  - `%s` (%s, resource group %s), risk weight: %d\n", d.Name, d.Type, d.ResourceGroup, liveWeight(profile, env, d)))
+	}
+	return sb.String()
+}
@@ -1,17 +1,68 @@
-// Package module provides a placeholder Module Validator agent.
+// Package module provides the Module agent: validation of module version
+// constraints, and module scaffolds and golden stacks composed from the
+// approved module catalog.
 package module
 
 import (
 	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
 
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/repo"
 )
 
-// Agent validates Terraform/Bicep module sources and structure.
-type Agent struct{}
+// DefaultStackName names a golden stack when the prompt does not.
+const DefaultStackName = "app"
 
-// New creates a new module Agent.
-func New() *Agent { return &Agent{} }
+var (
+	goldenStackRe = regexp.MustCompile(`(?i)\b(golden[\s-]+stack|starter\s+(stack|config\w*)|scaffold\w*|generate\s+(a\s+)?stack)\b`)
+	stackNamedRe  = regexp.MustCompile(`(?i)\b(?:named|called)\s+["'` + "`" + `]?([a-z][a-z0-9]*)`)
+	pushTargetRe  = regexp.MustCompile(`(?i)\b(?:push|publish)\b.*?\b(?:to|as)\s+(?:a\s+)?(?:new\s+)?(?:repo(?:sitory)?\s+)?([\w.-]+/[\w.-]+)`)
+)
+
+// PublishFunc creates ref as a new repository holding files and returns
+// its URL. token is the caller's GitHub token, if any.
+type PublishFunc func(ctx context.Context, token string, ref repo.Ref, files []protocol.SourceFile) (string, error)
+
+// Agent validates Terraform/Bicep module sources and structure, and
+// composes golden stacks from the approved module catalog.
+type Agent struct {
+	catalog Catalog
+	publish PublishFunc
+	verify  VerifyFunc
+}
+
+// New creates a new module Agent with the DefaultCatalog.
+func New(opts ...Option) *Agent {
+	a := &Agent{catalog: DefaultCatalog()}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// Option configures a module Agent.
+type Option func(*Agent)
+
+// WithCatalog sets the approved modules golden stacks are composed from.
+func WithCatalog(c Catalog) Option {
+	return func(a *Agent) {
+		a.catalog = c
+	}
+}
+
+// WithPublisher lets prompts such as "push to org/payments-stack" create
+// the generated stack as a new repository.
+func WithPublisher(publish PublishFunc) Option {
+	return func(a *Agent) {
+		a.publish = publish
+	}
+}
 
 func (a *Agent) ID() string { return "module" }
 
@@ -19,24 +70,239 @@ func (a *Agent) Metadata() protocol.AgentMetadata {
 	return protocol.AgentMetadata{
 		ID:          "module",
 		Name:        "Module Validator",
-		Description: "Validates module sources, registry references, and module structure (placeholder)",
-		Version:     "0.1.0",
+		Description: "Validates module version constraints against the approved catalog and generates golden stacks from it",
+		Version:     "0.3.0",
 	}
 }
 
 func (a *Agent) Capabilities() protocol.AgentCapabilities {
 	return protocol.AgentCapabilities{
 		Formats:       []protocol.SourceFormat{protocol.FormatTerraform, protocol.FormatBicep},
-		NeedsIaCInput: true,
+		NeedsIaCInput: false,
 	}
 }
 
-// Handle is a placeholder that reports module validation is not yet implemented.
-func (a *Agent) Handle(_ context.Context, _ protocol.AgentRequest, emit protocol.Emitter) error {
+// Mutates reports whether req asks to publish a golden stack as a new
+// repository.
+func (a *Agent) Mutates(req protocol.AgentRequest) bool {
+	prompt := protocol.PromptText(req)
+	return goldenStackRe.MatchString(prompt) && pushTargetRe.MatchString(prompt)
+}
+
+// Handle scaffolds a catalog module or generates a golden stack when asked
+// for one and otherwise validates the module calls in the request.
+func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
+	prompt := protocol.PromptText(req)
+	if m, env, location, ok := a.catalog.parseScaffold(prompt); ok {
+		return a.handleScaffold(prompt, m, env, location, emit)
+	}
+	if goldenStackRe.MatchString(prompt) {
+		return a.handleGoldenStack(ctx, req, prompt, emit)
+	}
+	return a.handleValidate(ctx, req, emit)
+}
+
+// handleValidate checks the versions of the module calls in the request's
+// Terraform against the catalog.
+func (a *Agent) handleValidate(ctx context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
 	emit.SendMessage("## Module Validator\n\n")
-	emit.SendMessage("Module validation is not yet implemented. Future capabilities:\n")
-	emit.SendMessage("- Validate module sources against approved registries\n")
-	emit.SendMessage("- Check module version pinning\n")
-	emit.SendMessage("- Scan module contents for policy violations\n")
+	var checks []Check
+	if req.IaC != nil && req.IaC.Format == protocol.FormatTerraform {
+		checks = a.catalog.CheckModules(parser.ParseTerraformDependencies(req.IaC.RawCode))
+		a.verifyPins(ctx, req.Token, checks)
+	}
+	if len(checks) == 0 {
+		emit.SendMessage("No registry or remote module calls found. Share Terraform that calls modules to check their version constraints against the approved catalog.\n\n")
+		emit.SendMessage("Ask for a **golden stack** (e.g. \"golden stack for a web app with a database and key vault\") to compose one from the module catalog, or **scaffold** a single module (e.g. \"scaffold storage-account for prod in westeurope\").\n")
+		return nil
+	}
+
+	var findings []protocol.Finding
+	emit.SendMessage("| Module | Source | Version | Catalog | Status |\n")
+	emit.SendMessage("|--------|--------|---------|---------|--------|\n")
+	for _, c := range checks {
+		dep := c.Dependency
+		approved, status := "—", "✅"
+		switch {
+		case c.Approved == nil:
+		case c.Approved.Version != "":
+			approved = "`" + c.Approved.Version + "`"
+		default:
+			approved = "`" + strings.Join(c.Approved.refs(), "`, `") + "`"
+		}
+		if len(c.Findings) > 0 {
+			status = "❌ " + c.Findings[0].RuleID
+		}
+		version := "—"
+		if dep.Version != "" {
+			version = "`" + dep.Version + "`"
+		}
+		emit.SendMessage(fmt.Sprintf("| %s | `%s` | %s | %s | %s |\n", dep.Name, dep.Source, version, approved, status))
+		findings = append(findings, c.Findings...)
+	}
+	emit.SendMessage("\n")
+	emitVerification(checks, emit)
+	if len(findings) == 0 {
+		emit.SendMessage(fmt.Sprintf("✅ All %d module call(s) pin valid versions within the approved catalog ranges.\n", len(checks)))
+	} else {
+		for _, f := range findings {
+			emit.SendMessage(fmt.Sprintf("- %s **%s** `%s`: %s. %s\n", f.Severity.Label(), f.RuleID, f.Resource, f.Message, f.Remediation))
+		}
+	}
+	protocol.ReportFindings(emit, a.ID(), findings)
 	return nil
 }
+
+func (a *Agent) handleGoldenStack(ctx context.Context, req protocol.AgentRequest, prompt string, emit protocol.Emitter) error {
+	emit.SendMessage("## Golden Stack\n\n")
+
+	var target *repo.Ref
+	if m := pushTargetRe.FindStringSubmatch(prompt); m != nil {
+		ref, err := repo.ParseRef(strings.TrimRight(m[1], ".,;:"))
+		if err != nil {
+			emit.SendError(err.Error())
+			return nil
+		}
+		target = &ref
+	}
+	name := DefaultStackName
+	if m := stackNamedRe.FindStringSubmatch(prompt); m != nil {
+		name = strings.ToLower(m[1])
+	} else if target != nil && ValidStackName(strings.ToLower(target.Name)) {
+		name = strings.ToLower(target.Name)
+	}
+
+	modules := a.catalog.SelectModules(prompt)
+	if len(modules) == 0 {
+		var components []string
+		for _, m := range a.catalog.Modules {
+			components = append(components, fmt.Sprintf("%s (%s)", m.Component, strings.Join(m.Keywords, ", ")))
+		}
+		emit.SendMessage("No approved catalog module matches the use case. Describe it with any of: " + strings.Join(components, "; ") + ".\n")
+		return nil
+	}
+	stack, err := ComposeStack(name, modules, analyzer.AllRules())
+	if err != nil {
+		emit.SendError(err.Error())
+		return nil
+	}
+
+	emit.SendMessage(fmt.Sprintf("Composed **%s** from %d approved module(s), scaffolded for %s.\n\n", stack.Name, len(stack.Modules), strings.Join(Environments, ", ")))
+	emit.SendMessage("| Module | Component | Source | Version |\n")
+	emit.SendMessage("|--------|-----------|--------|---------|\n")
+	for _, m := range stack.Modules {
+		emit.SendMessage(fmt.Sprintf("| %s | %s | `%s` | `%s` |\n", m.Name, m.Component, m.Source, m.Version))
+	}
+
+	emit.SendMessage("\n### Files\n\n")
+	for i, f := range stack.Files {
+		protocol.ReportProgress(emit, "file "+f.Path, i, len(stack.Files))
+		emit.SendMessage(fileBlock(f))
+	}
+	protocol.ReportProgress(emit, "files", len(stack.Files), len(stack.Files))
+
+	emitPolicyCheck(stack.Checked, stack.Findings, emit)
+	protocol.ReportFindings(emit, a.ID(), stack.Findings)
+
+	if target == nil {
+		return nil
+	}
+	emit.SendMessage("### Repository\n\n")
+	switch {
+	case a.publish == nil:
+		emit.SendMessage("_Pushing to GitHub is not configured on this host._\n")
+	case len(stack.Findings) > 0:
+		emit.SendMessage(fmt.Sprintf("Not pushed to `%s/%s`: resolve the policy findings first.\n", target.Owner, target.Name))
+	default:
+		u, err := a.publish(ctx, req.Token, *target, stack.Files)
+		if err != nil {
+			emit.SendMessage(fmt.Sprintf("_Push to `%s/%s` failed: %v_\n", target.Owner, target.Name, err))
+			return nil
+		}
+		emit.SendMessage(fmt.Sprintf("Created private repository [%s/%s](%s) with %d file(s).\n", target.Owner, target.Name, u, len(stack.Files)))
+	}
+	return nil
+}
+
+func (a *Agent) handleScaffold(prompt string, m CatalogModule, env, location string, emit protocol.Emitter) error {
+	emit.SendMessage("## Module Scaffold\n\n")
+	name := DefaultStackName
+	if n := stackNamedRe.FindStringSubmatch(prompt); n != nil {
+		name = strings.ToLower(n[1])
+	}
+	s, err := a.catalog.ScaffoldModule(m.Name, name, env, location, analyzer.AllRules())
+	if err != nil {
+		emit.SendError(err.Error())
+		return nil
+	}
+	pin := m.Version
+	if pin == "" {
+		pin = strings.Join(m.refs(), ", ")
+	}
+	emit.SendMessage(fmt.Sprintf("Scaffolded **%s** (`%s`, `%s`) for **%s** in **%s**, named `%s`.", m.Name, m.Source, pin, s.Environment, s.Location, s.Name))
+	if len(s.Modules) > 1 {
+		var required []string
+		for _, r := range s.Modules[:len(s.Modules)-1] {
+			required = append(required, r.Name)
+		}
+		emit.SendMessage(fmt.Sprintf(" It includes the module(s) it requires: %s.", strings.Join(required, ", ")))
+	}
+	emit.SendMessage("\n\n```hcl\n" + s.Code + "```\n\n")
+	emitPolicyCheck(s.Checked, s.Findings, emit)
+	protocol.ReportFindings(emit, a.ID(), s.Findings)
+	return nil
+}
+
+// emitPolicyCheck reports the rule checks run on generated code. Failures
+// mean a catalog module's defaults break policy.
+func emitPolicyCheck(checked int, findings []protocol.Finding, emit protocol.Emitter) {
+	emit.SendMessage("### Policy Check\n\n")
+	if len(findings) == 0 {
+		emit.SendMessage(fmt.Sprintf("✅ All %d rule checks on the generated resources and module inputs pass.\n\n", checked))
+		return
+	}
+	emit.SendMessage(fmt.Sprintf("❌ %d of %d rule checks fail; the catalog needs fixing:\n\n", len(findings), checked))
+	for _, f := range findings {
+		emit.SendMessage(fmt.Sprintf("- %s **%s** `%s`: %s\n", f.Severity.Label(), f.RuleID, f.Resource, f.Message))
+	}
+	emit.SendMessage("\n")
+}
+
+// emitVerification lists the approved git refs that were resolved, with
+// the commit and checksum found, so they can be recorded in the catalog.
+func emitVerification(checks []Check, emit protocol.Emitter) {
+	var lines []string
+	for _, c := range checks {
+		dep := c.Dependency
+		switch {
+		case c.VerifyErr != nil:
+			lines = append(lines, fmt.Sprintf("- ⚠️ %s@%s could not be verified: %v\n", dep.Name, dep.Version, c.VerifyErr))
+		case c.Resolved != nil:
+			status := "✅"
+			for _, f := range c.Findings {
+				if f.RuleID == RuleTamperedSource {
+					status = "❌"
+				}
+			}
+			lines = append(lines, fmt.Sprintf("- %s %s@%s: commit `%s`, sha256 `%s`\n", status, dep.Name, dep.Version, c.Resolved.Commit, c.Resolved.SHA256))
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	emit.SendMessage("### Pin Verification\n\n")
+	for _, l := range lines {
+		emit.SendMessage(l)
+	}
+	emit.SendMessage("\n")
+}
+
+// fileBlock renders a generated file as a heading and fenced block. The
+// README has fences of its own, so it gets a longer one.
+func fileBlock(f protocol.SourceFile) string {
+	lang, fence := "hcl", "```"
+	if path.Ext(f.Path) == ".md" {
+		lang, fence = "markdown", "````"
+	}
+	return fmt.Sprintf("#### `%s`\n\n%s%s\n%s%s\n\n", f.Path, fence, lang, f.Content, fence)
+}
@@ -2,11 +2,18 @@ package module
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/repo"
 )
 
 func TestAgent_ID(t *testing.T) {
@@ -15,7 +22,7 @@ func TestAgent_ID(t *testing.T) {
 	}
 }
 
-func TestAgent_Placeholder(t *testing.T) {
+func TestAgent_NoModules(t *testing.T) {
 	a := New()
 	rec := &prototest.Recorder{}
 	err := a.Handle(context.Background(), protocol.AgentRequest{}, rec)
@@ -23,11 +30,366 @@ func TestAgent_Placeholder(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	combined := strings.Join(rec.Messages, "")
-	if !strings.Contains(combined, "not yet implemented") {
-		t.Error("expected placeholder message")
+	if !strings.Contains(combined, "No registry or remote module calls found") {
+		t.Error("expected a hint when there is nothing to validate")
+	}
+}
+
+func TestAgent_ValidatesVersions(t *testing.T) {
+	code := `module "key_vault" {
+  source  = "Azure/avm-res-keyvault-vault/azurerm"
+  version = "~> 0.10.1"
+}
+
+module "network" {
+  source  = "registry.terraform.io/Azure/avm-res-network-virtualnetwork/azurerm"
+  version = ">= 0.5"
+}
+
+module "postgres" {
+  source  = "Azure/avm-res-dbforpostgresql-flexibleserver/azurerm"
+  version = "10.0.0"
+}
+
+module "legacy" {
+  source  = "contoso/legacy/azurerm"
+  version = ">= 3.0, < 2.0"
+}
+
+module "unpinned" {
+  source = "contoso/unpinned/azurerm"
+}
+
+module "git" {
+  source = "git::https://github.com/contoso/mod.git?ref=v1.2.0"
+}
+
+module "local" {
+  source = "./modules/local"
+}`
+	req := protocol.AgentRequest{IaC: &protocol.IaCInput{Format: protocol.FormatTerraform, RawCode: code}}
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"| key_vault | `Azure/avm-res-keyvault-vault/azurerm` | `~> 0.10.1` | `~> 0.10` | ✅ |",
+		"| network | `Azure/avm-res-network-virtualnetwork/azurerm` | `>= 0.5` | `~> 0.7` | ❌ MOD-004 |",
+		"allows >= 0.5.0, beyond the catalog's approved >= 0.7.0, < 1.0.0",
+		"| postgres | `Azure/avm-res-dbforpostgresql-flexibleserver/azurerm` | `10.0.0` | `~> 0.1` | ❌ MOD-003 |",
+		"| legacy | `contoso/legacy/azurerm` | `>= 3.0, < 2.0` | — | ❌ MOD-002 |",
+		"| unpinned | `contoso/unpinned/azurerm` | — | — | ❌ MOD-001 |",
+		"| git | `git::https://github.com/contoso/mod.git` | `v1.2.0` | — | ✅ |",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "modules/local") {
+		t.Error("local modules have no version to check")
+	}
+	var findings int
+	for _, c := range DefaultCatalog().CheckModules(parser.ParseTerraformDependencies(code)) {
+		findings += len(c.Findings)
+	}
+	if findings != 4 {
+		t.Errorf("findings = %d, want 4", findings)
+	}
+}
+
+func TestLoadCatalog_InvalidVersion(t *testing.T) {
+	for version, want := range map[string]string{
+		"~> banana":     "invalid version constraint",
+		">= 2.0, < 1.0": "no version satisfies",
+	} {
+		path := filepath.Join(t.TempDir(), "catalog.json")
+		os.WriteFile(path, []byte(`{"modules": [{"name": "kv", "component": "secrets", "source": "Azure/avm-res-keyvault-vault/azurerm", "version": "`+version+`"}]}`), 0o644)
+		if _, err := LoadCatalog(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: err = %v, want %q", version, err, want)
+		}
+	}
+}
+
+func stackRequest(prompt string) protocol.AgentRequest {
+	return protocol.AgentRequest{Token: "user-tok", Messages: []protocol.Message{{Role: "user", Content: prompt}}}
+}
+
+func TestAgent_GoldenStack(t *testing.T) {
+	rec := &prototest.Recorder{}
+	err := New().Handle(context.Background(), stackRequest("Generate a golden stack named payments for a web app + postgres database + key vault"), rec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"Composed **payments** from 4 approved module(s)",
+		"| postgresql | database | `Azure/avm-res-dbforpostgresql-flexibleserver/azurerm` |",
+		"#### `main.tf`",
+		"#### `environments/prod.tfvars`",
+		"#### `environments/staging.backend.hcl`",
+		"purge_protection_enabled      = true",
+		`data "azurerm_client_config" "current" {}`,
+		"service_plan_resource_id = module.app_service_plan.resource_id",
+		`postgresql_sku_name       = "GP_Standard_D4s_v3"`,
+		"✅ All",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "sql_server") {
+		t.Error("postgres should take the database component from the generic SQL module")
+	}
+	if strings.Index(out, `module "app_service_plan"`) > strings.Index(out, `module "web_app"`) {
+		t.Error("the plan the web app requires should be declared first")
+	}
+	if strings.Contains(out, "### Repository") {
+		t.Error("nothing should be pushed without a target")
+	}
+}
+
+func TestAgent_GoldenStackNoMatch(t *testing.T) {
+	rec := &prototest.Recorder{}
+	New().Handle(context.Background(), stackRequest("golden stack for a mainframe"), rec)
+	if out := strings.Join(rec.Messages, ""); !strings.Contains(out, "No approved catalog module matches") {
+		t.Errorf("expected the catalog components to be listed:\n%s", out)
+	}
+}
+
+func TestAgent_GoldenStackPush(t *testing.T) {
+	var gotRef repo.Ref
+	var gotToken string
+	var gotFiles []protocol.SourceFile
+	a := New(WithPublisher(func(_ context.Context, token string, ref repo.Ref, files []protocol.SourceFile) (string, error) {
+		gotRef, gotToken, gotFiles = ref, token, files
+		return "https://github.com/contoso/shop", nil
+	}))
+	rec := &prototest.Recorder{}
+	a.Handle(context.Background(), stackRequest("golden stack for a web app with storage, push to a new repo contoso/shop"), rec)
+	out := strings.Join(rec.Messages, "")
+	if gotRef.Owner != "contoso" || gotRef.Name != "shop" || gotToken != "user-tok" {
+		t.Errorf("published %+v with token %q", gotRef, gotToken)
+	}
+	if len(gotFiles) != 11 || !strings.Contains(out, "[contoso/shop](https://github.com/contoso/shop) with 11 file(s)") {
+		t.Errorf("pushed %d files:\n%s", len(gotFiles), out)
+	}
+	if !strings.Contains(out, "Composed **shop**") {
+		t.Error("the stack should be named after the new repository")
+	}
+}
+
+func TestAgent_GoldenStackPolicyViolation(t *testing.T) {
+	catalog := Catalog{Modules: []CatalogModule{{
+		Name: "storage", Component: "storage", Keywords: []string{"storage"},
+		Source: "app.terraform.io/contoso/storage/azurerm", Version: "1.2.0", Abbreviation: "st",
+		ResourceType: "azurerm_storage_account",
+		EnvInputs:    map[string]map[string]interface{}{"min_tls_version": {"dev": "TLS1_0", "staging": "TLS1_2", "prod": "TLS1_2"}},
+	}}}
+	pushed := false
+	a := New(WithCatalog(catalog), WithPublisher(func(context.Context, string, repo.Ref, []protocol.SourceFile) (string, error) {
+		pushed = true
+		return "", nil
+	}))
+	rec := &prototest.Recorder{}
+	a.Handle(context.Background(), stackRequest("scaffold storage and push to contoso/data"), rec)
+	out := strings.Join(rec.Messages, "")
+	if !strings.Contains(out, "**POL-003** `module.storage`: min_tls_version = TLS1_0 (expected: TLS1_2) (dev)") {
+		t.Errorf("expected the dev input to fail POL-003:\n%s", out)
+	}
+	if pushed || !strings.Contains(out, "Not pushed to `contoso/data`") {
+		t.Error("a stack with findings must not be pushed")
+	}
+}
+
+func TestAgent_Scaffold(t *testing.T) {
+	rec := &prototest.Recorder{}
+	New().Handle(context.Background(), stackRequest("scaffold storage-account for prod in westeurope"), rec)
+	out := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"## Module Scaffold",
+		"Scaffolded **storage_account** (`Azure/avm-res-storage-storageaccount/azurerm`, `~> 0.5`) for **prod** in **westeurope**",
+		`provider "azurerm" {`,
+		`location = "westeurope"`,
+		`version = "~> 0.5"`,
+		`name                            = "stappprod"`,
+		`account_replication_type        = "ZRS"`,
+		`environment = "prod"`,
+		"✅ All",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "var.") || strings.Contains(out, "<value>") || strings.Contains(out, "backend") {
+		t.Errorf("a scaffold should leave nothing to fill in:\n%s", out)
+	}
+
+	rec = &prototest.Recorder{}
+	New().Handle(context.Background(), stackRequest("scaffold the web app module named shop"), rec)
+	out = strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"for **dev** in **" + DefaultLocation + "**, named `shop`",
+		"requires: app_service_plan",
+		`sku_name            = "B1"`,
+		`name                     = "shop-dev-app"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestCatalog_Find(t *testing.T) {
+	c := DefaultCatalog()
+	for term, want := range map[string]string{
+		"storage-account": "storage_account",
+		"Key Vault":       "key_vault",
+		"kv":              "key_vault",
+		"service_plan":    "app_service_plan",
+		"postgres":        "postgresql",
+		"database":        "postgresql",
+	} {
+		if m, ok := c.Find(term); !ok || m.Name != want {
+			t.Errorf("Find(%q) = %q, %v; want %q", term, m.Name, ok, want)
+		}
+	}
+	if _, ok := c.Find("mainframe"); ok {
+		t.Error("an unknown term should not match")
+	}
+}
+
+func TestComposeStack_InvalidName(t *testing.T) {
+	if _, err := ComposeStack("Payments-API", DefaultCatalog().SelectModules("web app"), analyzer.AllRules()); err == nil {
+		t.Error("expected an invalid stack name to be rejected")
+	}
+}
+
+func TestLoadCatalog(t *testing.T) {
+	c, err := LoadCatalog("")
+	if err != nil || len(c.Modules) != len(DefaultCatalog().Modules) {
+		t.Fatalf("empty path should load the default catalog, got %d modules, %v", len(c.Modules), err)
+	}
+	dir := t.TempDir()
+	write := func(body string) string {
+		p := filepath.Join(dir, "catalog.json")
+		if err := os.WriteFile(p, []byte(body), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	t.Setenv("CATALOG_REGISTRY", "app.terraform.io/contoso")
+	c, err = LoadCatalog(write(`{"modules": [{"name": "kv", "component": "secrets", "keywords": ["vault"], "source": "${CATALOG_REGISTRY}/kv/azurerm", "version": "2.0.1"}]}`))
+	if err != nil || c.Modules[0].Source != "app.terraform.io/contoso/kv/azurerm" {
+		t.Errorf("catalog = %+v, %v", c, err)
+	}
+	for _, bad := range []string{
+		`{"modules": [{"name": "kv", "component": "secrets", "source": "contoso/kv/azurerm"}]}`,
+		`{"modules": [{"name": "app", "component": "web", "source": "contoso/app/azurerm", "version": "1.0.0", "requires": ["plan"]}]}`,
+		`{"modules": [`,
+	} {
+		if _, err := LoadCatalog(write(bad)); err == nil {
+			t.Errorf("LoadCatalog(%s) should fail", bad)
+		}
 	}
 }
 
 func TestAgent_ImplementsAgent(t *testing.T) {
 	var _ protocol.Agent = (*Agent)(nil)
 }
+
+func TestAgent_GitPins(t *testing.T) {
+	const (
+		approved = "3f2a9c1d4e5b6a7f8091a2b3c4d5e6f708192a3b"
+		moved    = "0000000000000000000000000000000000000001"
+		sum      = "9b2f4d1c0e7a6b5d3c2f1e0a9b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3f2a1b0c"
+	)
+	catalog := Catalog{Modules: []CatalogModule{{
+		Name: "storage", Component: "storage",
+		Source: "git::https://github.com/contoso/tf-storage.git?ref=v1.2.0",
+		Pins: map[string]Pin{
+			"v1.2.0": {Commit: approved, SHA256: sum},
+			"v1.3.0": {Commit: approved},
+		},
+	}}}
+	var verified []string
+	verify := func(_ context.Context, token, source, ref string) (Pin, error) {
+		verified = append(verified, ref)
+		if ref == "v1.3.0" {
+			return Pin{Commit: moved, SHA256: sum}, nil
+		}
+		return Pin{Commit: approved, SHA256: sum}, nil
+	}
+	code := `module "ok" {
+  source = "git::https://github.com/contoso/tf-storage.git?ref=v1.2.0"
+}
+
+module "moved" {
+  source = "git::https://github.com/contoso/tf-storage.git?ref=v1.3.0"
+}
+
+module "unapproved" {
+  source = "git::https://github.com/contoso/tf-storage.git?ref=v2.0.0"
+}
+
+module "unpinned" {
+  source = "github.com/contoso/tf-network"
+}
+
+module "branch" {
+  source = "github.com/contoso/tf-dns?ref=main"
+}`
+	req := protocol.AgentRequest{IaC: &protocol.IaCInput{Format: protocol.FormatTerraform, RawCode: code}}
+	rec := &prototest.Recorder{}
+	if err := New(WithCatalog(catalog), WithVerifier(verify)).Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	out := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"| ok | `git::https://github.com/contoso/tf-storage.git` | `v1.2.0` | `v1.2.0`, `v1.3.0` | ✅ |",
+		"| moved | `git::https://github.com/contoso/tf-storage.git` | `v1.3.0` | `v1.2.0`, `v1.3.0` | ❌ MOD-007 |",
+		"resolves to commit " + moved + ", not the approved " + approved,
+		"| unapproved | `git::https://github.com/contoso/tf-storage.git` | `v2.0.0` | `v1.2.0`, `v1.3.0` | ❌ MOD-006 |",
+		"(approved: v1.2.0, v1.3.0)",
+		"| unpinned | `github.com/contoso/tf-network` | — | — | ❌ MOD-001 |",
+		"| branch | `github.com/contoso/tf-dns` | `main` | — | ❌ MOD-005 |",
+		"- ✅ ok@v1.2.0: commit `" + approved + "`",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Join(verified, ",") != "v1.2.0,v1.3.0" {
+		t.Errorf("verified = %v, want only the approved pins", verified)
+	}
+}
+
+func TestGitHubVerifier(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/contoso/tf-modules/commits/v1.0.0":
+			w.Write([]byte("3f2a9c1d4e5b6a7f8091a2b3c4d5e6f708192a3b"))
+		case "/repos/contoso/tf-modules/git/trees/3f2a9c1d4e5b6a7f8091a2b3c4d5e6f708192a3b":
+			w.Write([]byte(`{"tree":[{"path":"storage/main.tf","type":"blob","size":9},{"path":"network/main.tf","type":"blob","size":9}]}`))
+		case "/repos/contoso/tf-modules/contents/storage/main.tf":
+			w.Write([]byte("# storage"))
+		case "/repos/contoso/tf-modules/contents/network/main.tf":
+			w.Write([]byte("# network"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	pin, err := GitHubVerifier(srv.URL, "")(context.Background(), "", "git::https://github.com/contoso/tf-modules.git//storage", "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Checksum([]protocol.SourceFile{{Path: "main.tf", Content: "# storage"}}, "")
+	if pin.Commit != "3f2a9c1d4e5b6a7f8091a2b3c4d5e6f708192a3b" || pin.SHA256 != want {
+		t.Errorf("pin = %+v, want checksum %s", pin, want)
+	}
+	if _, err := GitHubVerifier(srv.URL, "")(context.Background(), "", "git::https://gitlab.com/contoso/mod.git", "v1.0.0"); err == nil {
+		t.Error("non-GitHub sources cannot be verified")
+	}
+}
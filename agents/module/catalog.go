@@ -0,0 +1,224 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/config"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/semver"
+)
+
+// Environments are the environments a golden stack is scaffolded for.
+var Environments = []string{"dev", "staging", "prod"}
+
+// CatalogModule is an approved module that golden stacks are composed from.
+type CatalogModule struct {
+	// Name is the module block label, e.g. "key_vault".
+	Name string `json:"name"`
+	// Component is what the module provides to a stack ("web", "database",
+	// "secrets"). A stack gets at most one module per component.
+	Component string `json:"component"`
+	// Keywords select the module from a use case description.
+	Keywords []string `json:"keywords"`
+	Source   string   `json:"source"`
+	Version  string   `json:"version"`
+	// Abbreviation names the resource, "<name>-<environment>-<abbreviation>",
+	// unless Inputs set a name.
+	Abbreviation string `json:"abbreviation"`
+	// ResourceType is the resource the module manages. Inputs named after
+	// a rule's property are checked against that rule.
+	ResourceType string `json:"resource_type,omitempty"`
+	// Requires lists modules, by Name, the module needs in the stack.
+	Requires []string `json:"requires,omitempty"`
+	// Inputs are the module's policy-compliant settings. Strings starting
+	// with var., local., module. or data. are references.
+	Inputs map[string]interface{} `json:"inputs,omitempty"`
+	// EnvInputs are settings that differ per environment, by input then
+	// environment. They become variables set in environments/<env>.tfvars.
+	EnvInputs map[string]map[string]interface{} `json:"env_inputs,omitempty"`
+	// Pins approve the refs (tags or commits) a git-sourced module may be
+	// called at, each with the commit and checksum it must still have.
+	Pins map[string]Pin `json:"pins,omitempty"`
+}
+
+// Catalog is the set of modules approved for golden stacks.
+type Catalog struct {
+	Modules []CatalogModule `json:"modules"`
+}
+
+// DefaultCatalog returns a catalog of Azure Verified Modules with hardened
+// defaults, used when no MODULE_CATALOG is configured.
+func DefaultCatalog() Catalog {
+	envSKU := func(dev, staging, prod interface{}) map[string]interface{} {
+		return map[string]interface{}{"dev": dev, "staging": staging, "prod": prod}
+	}
+	return Catalog{Modules: []CatalogModule{
+		{
+			Name: "virtual_network", Component: "network", Abbreviation: "vnet",
+			Keywords:     []string{"network", "vnet", "private endpoint"},
+			Source:       "Azure/avm-res-network-virtualnetwork/azurerm",
+			Version:      "~> 0.7",
+			ResourceType: "azurerm_virtual_network",
+			Inputs:       map[string]interface{}{"address_space": []interface{}{"10.0.0.0/16"}},
+		},
+		{
+			Name: "log_analytics", Component: "monitoring", Abbreviation: "log",
+			Keywords:     []string{"monitoring", "logging", "log analytics", "observability"},
+			Source:       "Azure/avm-res-operationalinsights-workspace/azurerm",
+			Version:      "~> 0.4",
+			ResourceType: "azurerm_log_analytics_workspace",
+			Inputs:       map[string]interface{}{"log_analytics_workspace_sku": "PerGB2018"},
+			EnvInputs:    map[string]map[string]interface{}{"log_analytics_workspace_retention_in_days": envSKU(30, 30, 90)},
+		},
+		{
+			Name: "key_vault", Component: "secrets", Abbreviation: "kv",
+			Keywords:     []string{"key vault", "keyvault", "secret"},
+			Source:       "Azure/avm-res-keyvault-vault/azurerm",
+			Version:      "~> 0.10",
+			ResourceType: "azurerm_key_vault",
+			Inputs: map[string]interface{}{
+				"tenant_id":                     "data.azurerm_client_config.current.tenant_id",
+				"sku_name":                      "standard",
+				"purge_protection_enabled":      true,
+				"soft_delete_retention_days":    90,
+				"public_network_access_enabled": false,
+			},
+		},
+		{
+			Name: "storage_account", Component: "storage", Abbreviation: "st",
+			Keywords:     []string{"storage", "blob", "files"},
+			Source:       "Azure/avm-res-storage-storageaccount/azurerm",
+			Version:      "~> 0.5",
+			ResourceType: "azurerm_storage_account",
+			Inputs: map[string]interface{}{
+				// Storage account names allow lowercase letters and digits only.
+				"name":                            "st${var.name}${var.environment}",
+				"min_tls_version":                 "TLS1_2",
+				"https_traffic_only_enabled":      true,
+				"allow_nested_items_to_be_public": false,
+				"shared_access_key_enabled":       false,
+				"public_network_access_enabled":   false,
+			},
+			EnvInputs: map[string]map[string]interface{}{"account_replication_type": envSKU("LRS", "LRS", "ZRS")},
+		},
+		{
+			Name: "postgresql", Component: "database", Abbreviation: "psql",
+			Keywords:     []string{"postgres"},
+			Source:       "Azure/avm-res-dbforpostgresql-flexibleserver/azurerm",
+			Version:      "~> 0.1",
+			ResourceType: "azurerm_postgresql_flexible_server",
+			Inputs: map[string]interface{}{
+				"server_version":                "16",
+				"public_network_access_enabled": false,
+			},
+			EnvInputs: map[string]map[string]interface{}{"sku_name": envSKU("B_Standard_B1ms", "GP_Standard_D2s_v3", "GP_Standard_D4s_v3")},
+		},
+		{
+			Name: "sql_server", Component: "database", Abbreviation: "sql",
+			Keywords:     []string{"database", "sql", "db"},
+			Source:       "Azure/avm-res-sql-server/azurerm",
+			Version:      "~> 0.1",
+			ResourceType: "azurerm_mssql_server",
+			Inputs: map[string]interface{}{
+				"server_version":                "12.0",
+				"public_network_access_enabled": false,
+			},
+		},
+		{
+			Name: "app_service_plan", Component: "compute", Abbreviation: "asp",
+			Keywords:     []string{"app service plan"},
+			Source:       "Azure/avm-res-web-serverfarm/azurerm",
+			Version:      "~> 0.4",
+			ResourceType: "azurerm_service_plan",
+			Inputs:       map[string]interface{}{"os_type": "Linux"},
+			EnvInputs:    map[string]map[string]interface{}{"sku_name": envSKU("B1", "S1", "P1v3")},
+		},
+		{
+			Name: "web_app", Component: "web", Abbreviation: "app",
+			Keywords:     []string{"web app", "webapp", "app service", "website", "api"},
+			Source:       "Azure/avm-res-web-site/azurerm",
+			Version:      "~> 0.16",
+			ResourceType: "azurerm_linux_web_app",
+			Requires:     []string{"app_service_plan"},
+			Inputs: map[string]interface{}{
+				"kind":                     "webapp",
+				"os_type":                  "Linux",
+				"service_plan_resource_id": "module.app_service_plan.resource_id",
+				"https_only":               true,
+				"managed_identities":       map[string]interface{}{"system_assigned": true},
+			},
+		},
+	}}
+}
+
+// LoadCatalog reads an approved module catalog from a JSON file in the form
+// of Catalog. ${VAR} references are expanded from the environment. An
+// empty path returns DefaultCatalog.
+func LoadCatalog(path string) (Catalog, error) {
+	if path == "" {
+		return DefaultCatalog(), nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Catalog{}, fmt.Errorf("read module catalog: %w", err)
+	}
+	var c Catalog
+	if err := json.Unmarshal(config.ExpandEnv(data), &c); err != nil {
+		return Catalog{}, fmt.Errorf("parse module catalog: %w", err)
+	}
+	return c, c.validate()
+}
+
+// validate checks that every module is pinned to a satisfiable constraint
+// and its requirements are in the catalog.
+func (c Catalog) validate() error {
+	names := make(map[string]bool, len(c.Modules))
+	for _, m := range c.Modules {
+		switch {
+		case m.Name == "" || m.Source == "" || m.Component == "":
+			return fmt.Errorf("module catalog: every module needs a name, source and component")
+		case names[m.Name]:
+			return fmt.Errorf("module catalog: duplicate module %q", m.Name)
+		case m.Version == "" && !strings.Contains(m.Source, "?ref="):
+			return fmt.Errorf("module catalog: %s must pin a version", m.Name)
+		}
+		for ref, p := range m.Pins {
+			if p.Commit != "" && !commitRe.MatchString(p.Commit) {
+				return fmt.Errorf("module catalog: %s pin %q: commit must be a full lowercase SHA", m.Name, ref)
+			}
+			if p.SHA256 != "" && !sha256Re.MatchString(p.SHA256) {
+				return fmt.Errorf("module catalog: %s pin %q: sha256 must be 64 lowercase hex digits", m.Name, ref)
+			}
+		}
+		if m.Version != "" && registrySource(m.Source) {
+			c, err := semver.ParseConstraint(m.Version)
+			if err != nil {
+				return fmt.Errorf("module catalog: %s: %w", m.Name, err)
+			}
+			if c.Range().Empty() {
+				return fmt.Errorf("module catalog: no version satisfies %s's constraint %q", m.Name, m.Version)
+			}
+		}
+		names[m.Name] = true
+	}
+	for _, m := range c.Modules {
+		for _, req := range m.Requires {
+			if !names[req] {
+				return fmt.Errorf("module catalog: %s requires unknown module %q", m.Name, req)
+			}
+		}
+	}
+	return nil
+}
+
+// module returns the catalog module named name.
+func (c Catalog) module(name string) (CatalogModule, bool) {
+	for _, m := range c.Modules {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return CatalogModule{}, false
+}
@@ -0,0 +1,193 @@
+package module
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/repo"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/semver"
+)
+
+// Pin is what an approved ref of a git-sourced module must contain. Empty
+// fields are not verified.
+type Pin struct {
+	// Commit is the full SHA the ref resolves to; a tag moved to another
+	// commit no longer matches.
+	Commit string `json:"commit,omitempty"`
+	// SHA256 is the Checksum of the module's Terraform files at the ref.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// VerifyFunc resolves a git module source at ref to the commit and
+// checksum it has now. token is the caller's GitHub token, if any.
+type VerifyFunc func(ctx context.Context, token, source, ref string) (Pin, error)
+
+// WithVerifier checks calls of approved git module refs against the commit
+// and checksum the catalog records for them, to detect tampered sources.
+func WithVerifier(verify VerifyFunc) Option {
+	return func(a *Agent) {
+		a.verify = verify
+	}
+}
+
+var (
+	commitRe       = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	sha256Re       = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	githubSourceRe = regexp.MustCompile(`^(?:git::)?(?:https://|ssh://git@|git@)?github\.com[/:]([\w.-]+)/([\w.-]+?)(?:\.git)?(?://(.*))?$`)
+)
+
+// gitSource reports whether source is fetched with git, where a ?ref=
+// rather than a version constraint pins it.
+func gitSource(source string) bool {
+	return strings.HasPrefix(source, "git::") || strings.HasPrefix(source, "git@") ||
+		strings.HasPrefix(source, "github.com/") || strings.HasPrefix(source, "bitbucket.org/") ||
+		strings.HasSuffix(source, ".git") || strings.Contains(source, ".git//")
+}
+
+// immutableRef reports whether ref names a commit or a release tag, rather
+// than a branch that moves with every push.
+func immutableRef(ref string) bool {
+	if commitRe.MatchString(ref) {
+		return true
+	}
+	_, err := semver.Parse(ref)
+	return err == nil
+}
+
+// refs returns the refs the catalog approves for m: its pins and the
+// ?ref= of its source.
+func (m CatalogModule) refs() []string {
+	var refs []string
+	for ref := range m.Pins {
+		refs = append(refs, ref)
+	}
+	if _, ref, ok := strings.Cut(m.Source, "?ref="); ok {
+		if _, pinned := m.Pins[ref]; !pinned {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// pin returns the approved pin for ref, which is either a pinned ref or
+// the commit one resolves to.
+func (m CatalogModule) pin(ref string) (Pin, bool) {
+	if p, ok := m.Pins[ref]; ok {
+		return p, true
+	}
+	for _, p := range m.Pins {
+		if p.Commit != "" && p.Commit == ref {
+			return p, true
+		}
+	}
+	return Pin{}, false
+}
+
+// GitHubSource parses a GitHub module source ("github.com/org/mod",
+// "git::https://github.com/org/mod.git//modules/x") into its repository
+// and the module's directory within it.
+func GitHubSource(source string) (repo.Ref, string, bool) {
+	m := githubSourceRe.FindStringSubmatch(source)
+	if m == nil {
+		return repo.Ref{}, "", false
+	}
+	return repo.Ref{Owner: m[1], Name: m[2]}, strings.Trim(m[3], "/"), true
+}
+
+// Checksum is the SHA256 of the files under dir ("" for all), over their
+// paths relative to dir and contents in path order, so it does not depend
+// on how the files were fetched.
+func Checksum(files []protocol.SourceFile, dir string) string {
+	byPath := make(map[string]string)
+	for _, f := range files {
+		p := f.Path
+		if dir != "" {
+			if !strings.HasPrefix(p, dir+"/") {
+				continue
+			}
+			p = strings.TrimPrefix(p, dir+"/")
+		}
+		byPath[path.Clean(p)] = f.Content
+	}
+	paths := make([]string, 0, len(byPath))
+	for p := range byPath {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	h := sha256.New()
+	for _, p := range paths {
+		fmt.Fprintf(h, "%s\x00%s\x00", p, byPath[p])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// GitHubVerifier resolves GitHub module sources through the REST API at
+// apiURL, with the caller's token or else token.
+func GitHubVerifier(apiURL, token string) VerifyFunc {
+	return func(ctx context.Context, callerToken, source, ref string) (Pin, error) {
+		r, dir, ok := GitHubSource(source)
+		if !ok {
+			return Pin{}, fmt.Errorf("only GitHub sources can be verified")
+		}
+		if callerToken != "" {
+			token = callerToken
+		}
+		f := repo.NewFetcher(apiURL, token)
+		r.Branch = ref
+		commit, err := f.Commit(ctx, r)
+		if err != nil {
+			return Pin{}, err
+		}
+		r.Branch = commit
+		files, err := f.Fetch(ctx, r)
+		if err != nil {
+			return Pin{}, err
+		}
+		return Pin{Commit: commit, SHA256: Checksum(files, dir)}, nil
+	}
+}
+
+// verifyPins resolves the calls of approved pins that record a commit or
+// checksum, reporting those that no longer match as RuleTamperedSource.
+func (a *Agent) verifyPins(ctx context.Context, token string, checks []Check) {
+	if a.verify == nil {
+		return
+	}
+	for i := range checks {
+		c := &checks[i]
+		if c.Pin == nil || (c.Pin.Commit == "" && c.Pin.SHA256 == "") {
+			continue
+		}
+		dep := c.Dependency
+		got, err := a.verify(ctx, token, dep.Source, dep.Version)
+		if err != nil {
+			c.VerifyErr = err
+			continue
+		}
+		c.Resolved = &got
+		var mismatch []string
+		if c.Pin.Commit != "" && got.Commit != c.Pin.Commit {
+			mismatch = append(mismatch, fmt.Sprintf("resolves to commit %s, not the approved %s", got.Commit, c.Pin.Commit))
+		}
+		if c.Pin.SHA256 != "" && got.SHA256 != c.Pin.SHA256 {
+			mismatch = append(mismatch, fmt.Sprintf("has checksum %s, not the approved %s", got.SHA256, c.Pin.SHA256))
+		}
+		if len(mismatch) == 0 {
+			continue
+		}
+		c.Findings = append(c.Findings, protocol.Finding{
+			RuleID: RuleTamperedSource, Category: "Modules", Severity: protocol.SeverityCritical,
+			Resource: dep.Name, ResourceType: dep.Kind,
+			Message:     fmt.Sprintf("Module %s at %s %s: the source may have been tampered with", dep.Name, dep.Version, strings.Join(mismatch, " and ")),
+			Remediation: "Do not apply; check the module repository's history and re-approve the ref in the catalog",
+		})
+	}
+}
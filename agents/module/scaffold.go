@@ -0,0 +1,175 @@
+package module
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+var (
+	// scaffoldRe matches "scaffold <module>" followed by the end of the
+	// sentence or its options, so "scaffold a web app with a database" is
+	// left to golden stacks.
+	scaffoldRe    = regexp.MustCompile(`(?i)\bscaffold\s+(?:an?\s+|the\s+)?([a-z][\w-]*(?:\s+[a-z][\w-]*){0,2}?)(?:\s+module)?(?:\s*$|\s*[.,;!?]|\s+(?:for|in|named|called)\b)`)
+	scaffoldEnvRe = regexp.MustCompile(`(?i)\bfor\s+(?:the\s+)?(dev|development|staging|stage|prod|production)\b`)
+	regionRe      = regexp.MustCompile(`(?i)\b(?:in|region)\s+([a-z]{4,}[0-9]?)\b`)
+)
+
+// envAliases maps the ways prompts name an environment to Environments.
+var envAliases = map[string]string{"development": "dev", "stage": "staging", "production": "prod"}
+
+// Scaffold is a self-contained Terraform configuration calling one catalog
+// module, with every input set for one environment, ready to paste into a
+// root module.
+type Scaffold struct {
+	Name        string
+	Environment string
+	Location    string
+	// Module is the module asked for; Modules adds the modules it requires,
+	// requirements first.
+	Module  CatalogModule
+	Modules []CatalogModule
+	Code    string
+	// Checked counts the rule evaluations the scaffold passed or failed;
+	// Findings are the failures.
+	Checked  int
+	Findings []protocol.Finding
+}
+
+// Find returns the catalog module term refers to: its name, with hyphens
+// or spaces for underscores ("storage-account"), its resource type without
+// the provider prefix, its abbreviation, component or one of its keywords.
+// Names win over the other matches.
+func (c Catalog) Find(term string) (CatalogModule, bool) {
+	t := strings.ToLower(strings.TrimSpace(term))
+	key := strings.NewReplacer("-", "_", " ", "_").Replace(t)
+	if m, ok := c.module(key); ok {
+		return m, true
+	}
+	for _, m := range c.Modules {
+		_, short, _ := strings.Cut(m.ResourceType, "_")
+		if key == short || t == strings.ToLower(m.Abbreviation) || t == strings.ToLower(m.Component) {
+			return m, true
+		}
+	}
+	for _, m := range c.Modules {
+		for _, kw := range m.Keywords {
+			if t == strings.ToLower(kw) || key == strings.ReplaceAll(strings.ToLower(kw), " ", "_") {
+				return m, true
+			}
+		}
+	}
+	return CatalogModule{}, false
+}
+
+// ScaffoldModule renders the catalog module named module, and the modules
+// it requires, for env in location: the provider block, a resource group
+// and module blocks pinned to the approved version with every catalog
+// input resolved to a literal, so nothing is left to fill in. The inputs
+// for env and the generated resources are checked against rules.
+func (c Catalog) ScaffoldModule(module, name, env, location string, rules []analyzer.Rule) (Scaffold, error) {
+	m, ok := c.module(module)
+	if !ok {
+		return Scaffold{}, fmt.Errorf("module %q is not in the catalog", module)
+	}
+	if !ValidStackName(name) {
+		return Scaffold{}, fmt.Errorf("invalid name %q (want 3-11 lowercase letters and digits, starting with a letter)", name)
+	}
+	if !contains(Environments, env) {
+		return Scaffold{}, fmt.Errorf("unknown environment %q (want %s)", env, strings.Join(Environments, ", "))
+	}
+	s := Scaffold{
+		Name: name, Environment: env, Location: location,
+		Module: m, Modules: c.withRequirements([]string{m.Name}),
+	}
+	s.Code = s.render()
+	stack := Stack{Modules: s.Modules}
+	stack.check(rules, s.Code, []string{env})
+	s.Checked, s.Findings = stack.Checked, stack.Findings
+	return s, nil
+}
+
+func (s Scaffold) render() string {
+	vars := strings.NewReplacer("${var.name}", s.Name, "${var.environment}", s.Environment)
+	var sb strings.Builder
+	sb.WriteString("terraform {\n" + requiredProviders + "}\n" + providerBlock)
+	sb.WriteString(fmt.Sprintf("\nlocals {\n  tags = {\n    environment = %q\n    managed_by  = \"terraform\"\n  }\n}\n\n", s.Environment))
+	if (Stack{Modules: s.Modules}).references("data.azurerm_client_config.current") {
+		sb.WriteString("data \"azurerm_client_config\" \"current\" {}\n\n")
+	}
+	sb.WriteString("resource \"azurerm_resource_group\" \"this\" {\n")
+	sb.WriteString(fmt.Sprintf("  name     = %q\n", "rg-"+s.Name+"-"+s.Environment))
+	sb.WriteString(fmt.Sprintf("  location = %q\n", s.Location))
+	sb.WriteString("  tags     = local.tags\n")
+	sb.WriteString("}\n")
+
+	for _, m := range s.Modules {
+		inputs := map[string]string{
+			"name":                hclValue(fmt.Sprintf("%s-%s-%s", s.Name, s.Environment, m.Abbreviation)),
+			"resource_group_name": "azurerm_resource_group.this.name",
+			"location":            "azurerm_resource_group.this.location",
+			"tags":                "local.tags",
+		}
+		for k, v := range m.Inputs {
+			inputs[k] = hclValue(resolve(v, vars))
+		}
+		for k, byEnv := range m.EnvInputs {
+			inputs[k] = hclValue(byEnv[s.Environment])
+		}
+		writeModule(&sb, m, inputs)
+	}
+	return sb.String()
+}
+
+// resolve replaces the stack variables in the strings of a catalog value
+// with the scaffold's literals.
+func resolve(v interface{}, vars *strings.Replacer) interface{} {
+	switch v := v.(type) {
+	case string:
+		return vars.Replace(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = resolve(item, vars)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			out[k] = resolve(item, vars)
+		}
+		return out
+	}
+	return v
+}
+
+// parseScaffold reads the module, environment and region a scaffold prompt
+// asks for. ok is false when the prompt does not name a catalog module.
+func (c Catalog) parseScaffold(prompt string) (m CatalogModule, env, location string, ok bool) {
+	match := scaffoldRe.FindStringSubmatch(prompt)
+	if match == nil {
+		return CatalogModule{}, "", "", false
+	}
+	if m, ok = c.Find(match[1]); !ok {
+		return CatalogModule{}, "", "", false
+	}
+	env = Environments[0]
+	if e := scaffoldEnvRe.FindStringSubmatch(prompt); e != nil {
+		env = strings.ToLower(e[1])
+		if alias, ok := envAliases[env]; ok {
+			env = alias
+		}
+	}
+	location = DefaultLocation
+	for _, r := range regionRe.FindAllStringSubmatch(prompt, -1) {
+		region := strings.ToLower(r[1])
+		if _, alias := envAliases[region]; !alias && !contains(Environments, region) {
+			location = region
+			break
+		}
+	}
+	return m, env, location, true
+}
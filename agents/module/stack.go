@@ -0,0 +1,403 @@
+package module
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// DefaultLocation is the Azure region golden stacks default to.
+const DefaultLocation = "eastus"
+
+var (
+	refRe       = regexp.MustCompile(`^(var|local|module|data)\.[\w.\[\]"-]+$`)
+	stackNameRe = regexp.MustCompile(`^[a-z][a-z0-9]{2,10}$`)
+)
+
+// Stack is a starter Terraform configuration composed from catalog modules.
+type Stack struct {
+	Name    string
+	Modules []CatalogModule
+	Files   []protocol.SourceFile
+	// Checked counts the rule evaluations the stack passed or failed;
+	// Findings are the failures.
+	Checked  int
+	Findings []protocol.Finding
+}
+
+// ValidStackName reports whether name can prefix every resource name in a
+// stack: 3-11 lowercase letters and digits, so storage accounts and key
+// vaults stay within Azure's 24 character limit.
+func ValidStackName(name string) bool {
+	return stackNameRe.MatchString(name)
+}
+
+// SelectModules picks the catalog modules a use case description calls
+// for, one per component, plus the modules they require, ordered so that
+// requirements come first. Earlier catalog entries win a component, so
+// specific modules ("postgres") should precede generic ones ("database").
+func (c Catalog) SelectModules(useCase string) []CatalogModule {
+	text := strings.ToLower(useCase)
+	taken := make(map[string]bool)
+	var picked []string
+	for _, m := range c.Modules {
+		if taken[m.Component] || !matchesKeyword(text, m.Keywords) {
+			continue
+		}
+		taken[m.Component] = true
+		picked = append(picked, m.Name)
+	}
+	return c.withRequirements(picked)
+}
+
+// withRequirements returns the named modules and the modules they require,
+// ordered so that requirements come first.
+func (c Catalog) withRequirements(names []string) []CatalogModule {
+	var ordered []CatalogModule
+	seen := make(map[string]bool)
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		m, ok := c.module(name)
+		if !ok {
+			return
+		}
+		for _, req := range m.Requires {
+			visit(req)
+		}
+		ordered = append(ordered, m)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return ordered
+}
+
+// keywordRes caches the expression matching each catalog keyword, which
+// every stack request checks.
+var keywordRes sync.Map
+
+func matchesKeyword(text string, keywords []string) bool {
+	for _, kw := range keywords {
+		re, ok := keywordRes.Load(kw)
+		if !ok {
+			re = regexp.MustCompile(`\b` + regexp.QuoteMeta(strings.ToLower(kw)) + `(s|es)?\b`)
+			keywordRes.Store(kw, re)
+		}
+		if re.(*regexp.Regexp).MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// ComposeStack renders modules as a Terraform configuration with a tfvars
+// and backend file per environment, and checks the module inputs and
+// generated resources against rules.
+func ComposeStack(name string, modules []CatalogModule, rules []analyzer.Rule) (Stack, error) {
+	if !ValidStackName(name) {
+		return Stack{}, fmt.Errorf("invalid stack name %q (want 3-11 lowercase letters and digits, starting with a letter)", name)
+	}
+	if len(modules) == 0 {
+		return Stack{}, fmt.Errorf("no catalog modules match the use case")
+	}
+	s := Stack{Name: name, Modules: modules}
+	main := s.mainTF()
+	s.Files = []protocol.SourceFile{
+		{Path: "versions.tf", Content: versionsTF},
+		{Path: "main.tf", Content: main},
+		{Path: "variables.tf", Content: s.variablesTF()},
+		{Path: "outputs.tf", Content: s.outputsTF()},
+	}
+	for _, env := range Environments {
+		s.Files = append(s.Files,
+			protocol.SourceFile{Path: "environments/" + env + ".tfvars", Content: s.tfvars(env)},
+			protocol.SourceFile{Path: "environments/" + env + ".backend.hcl", Content: fmt.Sprintf("key = %q\n", name+"/"+env+".tfstate")},
+		)
+	}
+	s.Files = append(s.Files, protocol.SourceFile{Path: "README.md", Content: s.readme()})
+	s.check(rules, main, Environments)
+	return s, nil
+}
+
+const (
+	requiredProviders = `  required_version = ">= 1.6"
+
+  required_providers {
+    azurerm = {
+      source  = "hashicorp/azurerm"
+      version = "~> 4.0"
+    }
+  }
+`
+	providerBlock = `
+provider "azurerm" {
+  features {}
+}
+`
+	versionsTF = "terraform {\n" + requiredProviders + `
+  # Storage settings come from environments/<env>.backend.hcl and the
+  # state storage account passed at init.
+  backend "azurerm" {}
+}
+` + providerBlock
+)
+
+func (s Stack) mainTF() string {
+	var sb strings.Builder
+	sb.WriteString("locals {\n  tags = merge(var.tags, {\n    environment = var.environment\n    managed_by  = \"terraform\"\n  })\n}\n\n")
+	if s.references("data.azurerm_client_config.current") {
+		sb.WriteString("data \"azurerm_client_config\" \"current\" {}\n\n")
+	}
+	sb.WriteString("resource \"azurerm_resource_group\" \"this\" {\n")
+	sb.WriteString("  name     = \"rg-${var.name}-${var.environment}\"\n")
+	sb.WriteString("  location = var.location\n")
+	sb.WriteString("  tags     = local.tags\n")
+	sb.WriteString("}\n")
+
+	for _, m := range s.Modules {
+		inputs := map[string]string{
+			"name":                hclValue(fmt.Sprintf("${var.name}-${var.environment}-%s", m.Abbreviation)),
+			"resource_group_name": "azurerm_resource_group.this.name",
+			"location":            "azurerm_resource_group.this.location",
+			"tags":                "local.tags",
+		}
+		for k, v := range m.Inputs {
+			inputs[k] = hclValue(v)
+		}
+		for k := range m.EnvInputs {
+			inputs[k] = "var." + m.Name + "_" + k
+		}
+		writeModule(&sb, m, inputs)
+	}
+	return sb.String()
+}
+
+// writeModule writes a module block calling m at its approved version with
+// inputs, which are HCL expressions.
+func writeModule(sb *strings.Builder, m CatalogModule, inputs map[string]string) {
+	sb.WriteString(fmt.Sprintf("\nmodule %q {\n", m.Name))
+	sb.WriteString(fmt.Sprintf("  source  = %q\n", m.Source))
+	if m.Version != "" {
+		sb.WriteString(fmt.Sprintf("  version = %q\n", m.Version))
+	}
+	sb.WriteString("\n")
+	writeAttrs(sb, inputs, "  ")
+	sb.WriteString("}\n")
+}
+
+// references reports whether any module input refers to expr.
+func (s Stack) references(expr string) bool {
+	for _, m := range s.Modules {
+		for _, v := range m.Inputs {
+			if s, ok := v.(string); ok && strings.HasPrefix(s, expr) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s Stack) variablesTF() string {
+	var sb strings.Builder
+	sb.WriteString(`variable "name" {
+  description = "Prefix of every resource name; 3-11 lowercase letters and digits."
+  type        = string
+
+  validation {
+    condition     = can(regex("^[a-z][a-z0-9]{2,10}$", var.name))
+    error_message = "name must be 3-11 lowercase letters and digits, starting with a letter."
+  }
+}
+
+variable "environment" {
+  description = "Deployment environment."
+  type        = string
+
+  validation {
+    condition     = contains(["dev", "staging", "prod"], var.environment)
+    error_message = "environment must be dev, staging or prod."
+  }
+}
+
+variable "location" {
+  description = "Azure region."
+  type        = string
+  default     = "` + DefaultLocation + `"
+}
+
+variable "tags" {
+  description = "Tags applied to every resource."
+  type        = map(string)
+  default     = {}
+}
+`)
+	for _, m := range s.Modules {
+		for _, k := range sortedKeys(m.EnvInputs) {
+			sb.WriteString(fmt.Sprintf("\nvariable %q {\n", m.Name+"_"+k))
+			sb.WriteString(fmt.Sprintf("  description = %q\n", fmt.Sprintf("%s for the %s module; set per environment.", k, m.Name)))
+			sb.WriteString(fmt.Sprintf("  type        = %s\n", hclType(m.EnvInputs[k]["prod"])))
+			sb.WriteString("}\n")
+		}
+	}
+	return sb.String()
+}
+
+func (s Stack) outputsTF() string {
+	var sb strings.Builder
+	sb.WriteString("output \"resource_group_name\" {\n  value = azurerm_resource_group.this.name\n}\n")
+	for _, m := range s.Modules {
+		sb.WriteString(fmt.Sprintf("\noutput %q {\n  value = module.%s.resource_id\n}\n", m.Name+"_id", m.Name))
+	}
+	return sb.String()
+}
+
+func (s Stack) tfvars(env string) string {
+	attrs := map[string]string{
+		"name":        hclValue(s.Name),
+		"environment": hclValue(env),
+	}
+	for _, m := range s.Modules {
+		for k, byEnv := range m.EnvInputs {
+			attrs[m.Name+"_"+k] = hclValue(byEnv[env])
+		}
+	}
+	var sb strings.Builder
+	writeAttrs(&sb, attrs, "")
+	return sb.String()
+}
+
+func (s Stack) readme() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# %s\n\n", s.Name))
+	sb.WriteString("Golden stack composed from the approved module catalog.\n\n")
+	sb.WriteString("| Module | Source | Version |\n|--------|--------|---------|\n")
+	for _, m := range s.Modules {
+		sb.WriteString(fmt.Sprintf("| %s | `%s` | `%s` |\n", m.Name, m.Source, m.Version))
+	}
+	sb.WriteString("\n## Usage\n\n```sh\n")
+	sb.WriteString("terraform init -backend-config=environments/dev.backend.hcl \\\n")
+	sb.WriteString("  -backend-config=\"resource_group_name=<state rg>\" -backend-config=\"storage_account_name=<state account>\" \\\n")
+	sb.WriteString("  -backend-config=\"container_name=tfstate\"\n")
+	sb.WriteString("terraform plan -var-file=environments/dev.tfvars\n```\n\n")
+	sb.WriteString("Repeat with `staging` and `prod`; environment-specific sizing lives in `environments/<env>.tfvars`.\n")
+	return sb.String()
+}
+
+// check evaluates rules against the generated resources, and each module's
+// inputs in envs against rules for its resource type whose property it
+// sets. Inputs the module leaves to its own defaults are not checked.
+func (s *Stack) check(rules []analyzer.Rule, mainTF string, envs []string) {
+	resources := parser.ParseResources(mainTF)
+	for _, c := range analyzer.Controls(rules, resources) {
+		s.Checked++
+		if !c.Passed {
+			s.Findings = append(s.Findings, analyzer.Run([]analyzer.Rule{c.Rule}, []protocol.Resource{c.Resource})...)
+		}
+	}
+	for _, m := range s.Modules {
+		if m.ResourceType == "" {
+			continue
+		}
+		for _, env := range envs {
+			props := make(map[string]interface{}, len(m.Inputs)+len(m.EnvInputs))
+			for k, v := range m.Inputs {
+				props[k] = v
+			}
+			for k, byEnv := range m.EnvInputs {
+				props[k] = byEnv[env]
+			}
+			for _, r := range rules {
+				if r.Property == "" || r.CheckFn != nil || !r.Applies(m.ResourceType) {
+					continue
+				}
+				if _, set := props[r.Property]; !set {
+					continue
+				}
+				s.Checked++
+				if msg := r.Check(props); msg != "" {
+					s.Findings = append(s.Findings, protocol.Finding{
+						RuleID:       r.ID,
+						Category:     r.Category,
+						Severity:     r.Severity,
+						Resource:     "module." + m.Name,
+						ResourceType: m.ResourceType,
+						Message:      fmt.Sprintf("%s (%s)", msg, env),
+						Remediation:  r.Remediation,
+					})
+				}
+			}
+		}
+	}
+}
+
+// writeAttrs writes attrs sorted by name with their equals signs aligned,
+// as terraform fmt does.
+func writeAttrs(sb *strings.Builder, attrs map[string]string, indent string) {
+	width := 0
+	for k := range attrs {
+		width = max(width, len(k))
+	}
+	for _, k := range sortedKeys(attrs) {
+		sb.WriteString(fmt.Sprintf("%s%-*s = %s\n", indent, width, k, attrs[k]))
+	}
+}
+
+// hclValue renders a catalog value as an HCL expression. Strings that look
+// like references are written bare.
+func hclValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		if refRe.MatchString(v) {
+			return v
+		}
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = hclValue(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		items := make([]string, 0, len(v))
+		for _, k := range sortedKeys(v) {
+			items = append(items, k+" = "+hclValue(v[k]))
+		}
+		return "{ " + strings.Join(items, ", ") + " }"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func hclType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int, float64:
+		return "number"
+	default:
+		return "any"
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,301 @@
+package module
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Call is a module call seen in scanned code.
+type Call struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	// Version is the call's version constraint or git ref.
+	Version string `json:"version,omitempty"`
+}
+
+// Scan is the module calls of one request.
+type Scan struct {
+	Repository string    `json:"repository,omitempty"`
+	JobID      string    `json:"job_id,omitempty"`
+	Time       time.Time `json:"time"`
+	Calls      []Call    `json:"calls"`
+}
+
+// UsageQuery selects scans. Empty fields select everything.
+type UsageQuery struct {
+	Repository string
+	Since      time.Time
+}
+
+func (q UsageQuery) matches(s Scan) bool {
+	return (q.Repository == "" || s.Repository == q.Repository) && !s.Time.Before(q.Since)
+}
+
+// UsageStore records the module calls in every scanned Terraform request
+// and, with a path, appends each scan to a JSON Lines file read back on
+// start.
+type UsageStore struct {
+	path string
+	now  func() time.Time
+
+	mu    sync.Mutex
+	scans []Scan
+}
+
+// NewUsageStore creates a store, loading the scans in path when it exists.
+// An empty path keeps scans in memory only.
+func NewUsageStore(path string) (*UsageStore, error) {
+	s := &UsageStore{path: path, now: time.Now}
+	if path == "" {
+		return s, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var scan Scan
+		if err := json.Unmarshal(sc.Bytes(), &scan); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		s.scans = append(s.scans, scan)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	sort.SliceStable(s.scans, func(i, j int) bool { return s.scans[i].Time.Before(s.scans[j].Time) })
+	return s, nil
+}
+
+// Add records a scan, appending it to the file first.
+func (s *UsageStore) Add(scan Scan) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.path != "" {
+		data, err := json.Marshal(scan)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(append(data, '\n'))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	i := sort.Search(len(s.scans), func(i int) bool { return s.scans[i].Time.After(scan.Time) })
+	s.scans = append(s.scans, Scan{})
+	copy(s.scans[i+1:], s.scans[i:])
+	s.scans[i] = scan
+	return nil
+}
+
+// Scans returns the scans q selects, oldest first.
+func (s *UsageStore) Scans(q UsageQuery) []Scan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Scan
+	for _, scan := range s.scans {
+		if q.matches(scan) {
+			out = append(out, scan)
+		}
+	}
+	return out
+}
+
+// Observe is a host.Observer that records the registry and remote module
+// calls of every Terraform request. Probes are not recorded.
+func (s *UsageStore) Observe(_ string, req protocol.AgentRequest, _ protocol.Emitter) (protocol.Emitter, func(error)) {
+	if req.IaC == nil || req.IaC.Format != protocol.FormatTerraform || req.Metadata[protocol.MetaProbe] != "" {
+		return nil, nil
+	}
+	var calls []Call
+	for _, dep := range parser.ParseTerraformDependencies(req.IaC.RawCode) {
+		if dep.Kind == parser.DependencyModule {
+			calls = append(calls, Call{Name: dep.Name, Source: dep.Source, Version: dep.Version})
+		}
+	}
+	if len(calls) == 0 {
+		return nil, nil
+	}
+	scan := Scan{
+		Repository: req.Metadata[protocol.MetaRepository],
+		JobID:      req.Metadata[protocol.MetaJobID],
+		Time:       s.now().UTC(),
+		Calls:      calls,
+	}
+	if err := s.Add(scan); err != nil {
+		log.Printf("Module usage: %v", err)
+	}
+	return nil, nil
+}
+
+// ModuleUsage is how scanned code uses one catalog module.
+type ModuleUsage struct {
+	Module string `json:"module"`
+	Source string `json:"source"`
+	// Approved is the catalog's version constraint, or its approved refs.
+	Approved string `json:"approved"`
+	// Repositories count repositories whose latest scan calls the module,
+	// and Requests every scan that did.
+	Repositories         int            `json:"repositories"`
+	Requests             int            `json:"requests"`
+	OutdatedRepositories int            `json:"outdated_repositories"`
+	OutdatedRequests     int            `json:"outdated_requests"`
+	Versions             []VersionUsage `json:"versions"`
+}
+
+// VersionUsage is how often a module is called with one version
+// constraint or ref.
+type VersionUsage struct {
+	Version string `json:"version"`
+	// Outdated is set for versions outside what the catalog approves now
+	// (MOD-003, MOD-004 or MOD-006) and for unpinned calls.
+	Outdated     bool     `json:"outdated"`
+	Repositories []string `json:"repositories"`
+	Requests     int      `json:"requests"`
+}
+
+// outdatedRules are the findings that mark a call's version as one the
+// catalog no longer approves.
+var outdatedRules = map[string]bool{RuleUnpinned: true, RuleUnapprovedVersion: true, RuleLooseVersion: true, RuleUnapprovedRef: true}
+
+// Usage aggregates scans by catalog module, classifying versions against
+// the catalog as it is now. Modules with the most outdated repositories,
+// then requests, come first: they are the deprecations that matter most.
+// Calls of modules outside the catalog are left out.
+func (c Catalog) Usage(scans []Scan) []ModuleUsage {
+	latest := make(map[string]int)
+	for i, s := range scans {
+		if s.Repository != "" {
+			latest[s.Repository] = i
+		}
+	}
+	type tally struct {
+		usage                    ModuleUsage
+		versions                 map[string]*VersionUsage
+		repos, outdatedRepos     map[string]bool
+		requests, outdatedByScan map[int]bool
+	}
+	byModule := make(map[string]*tally)
+	for i, s := range scans {
+		current := s.Repository != "" && latest[s.Repository] == i
+		seen := make(map[[2]string]bool)
+		for _, call := range s.Calls {
+			m, ok := c.bySource(call.Source)
+			if !ok || seen[[2]string{m.Name, call.Version}] {
+				continue
+			}
+			seen[[2]string{m.Name, call.Version}] = true
+			t := byModule[m.Name]
+			if t == nil {
+				approved := m.Version
+				if approved == "" {
+					approved = strings.Join(m.refs(), ", ")
+				}
+				t = &tally{
+					usage:    ModuleUsage{Module: m.Name, Source: m.Source, Approved: approved},
+					versions: make(map[string]*VersionUsage),
+					repos:    make(map[string]bool), outdatedRepos: make(map[string]bool),
+					requests: make(map[int]bool), outdatedByScan: make(map[int]bool),
+				}
+				byModule[m.Name] = t
+			}
+			v := t.versions[call.Version]
+			if v == nil {
+				v = &VersionUsage{Version: call.Version, Outdated: outdated(m, call), Repositories: []string{}}
+				t.versions[call.Version] = v
+			}
+			v.Requests++
+			t.requests[i] = true
+			if v.Outdated {
+				t.outdatedByScan[i] = true
+			}
+			if current {
+				v.Repositories = append(v.Repositories, s.Repository)
+				t.repos[s.Repository] = true
+				if v.Outdated {
+					t.outdatedRepos[s.Repository] = true
+				}
+			}
+		}
+	}
+	out := make([]ModuleUsage, 0, len(byModule))
+	for _, t := range byModule {
+		u := t.usage
+		u.Repositories, u.OutdatedRepositories = len(t.repos), len(t.outdatedRepos)
+		u.Requests, u.OutdatedRequests = len(t.requests), len(t.outdatedByScan)
+		for _, v := range t.versions {
+			sort.Strings(v.Repositories)
+			u.Versions = append(u.Versions, *v)
+		}
+		sort.Slice(u.Versions, func(i, j int) bool {
+			a, b := u.Versions[i], u.Versions[j]
+			if a.Outdated != b.Outdated {
+				return a.Outdated
+			}
+			if len(a.Repositories) != len(b.Repositories) {
+				return len(a.Repositories) > len(b.Repositories)
+			}
+			if a.Requests != b.Requests {
+				return a.Requests > b.Requests
+			}
+			return a.Version < b.Version
+		})
+		out = append(out, u)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if a.OutdatedRepositories != b.OutdatedRepositories {
+			return a.OutdatedRepositories > b.OutdatedRepositories
+		}
+		if a.OutdatedRequests != b.OutdatedRequests {
+			return a.OutdatedRequests > b.OutdatedRequests
+		}
+		return a.Module < b.Module
+	})
+	return out
+}
+
+// outdated reports whether call's version is one the catalog module m
+// does not approve now.
+func outdated(m CatalogModule, call Call) bool {
+	check := Check{
+		Dependency: parser.Dependency{Kind: parser.DependencyModule, Name: call.Name, Source: call.Source, Version: call.Version},
+		Approved:   &m,
+	}
+	if p, ok := m.pin(call.Version); ok {
+		check.Pin = &p
+	}
+	for _, f := range check.validate() {
+		if outdatedRules[f.RuleID] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,74 @@
+package module
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+func TestUsageStore_Observe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	s, err := NewUsageStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC) }
+	code := `module "kv" {
+  source  = "Azure/avm-res-keyvault-vault/azurerm"
+  version = "~> 0.9"
+}
+
+module "local" {
+  source = "./modules/local"
+}`
+	req := protocol.AgentRequest{
+		IaC:      &protocol.IaCInput{Format: protocol.FormatTerraform, RawCode: code},
+		Metadata: map[string]string{protocol.MetaRepository: "org/app", protocol.MetaJobID: "job-1"},
+	}
+	s.Observe("security", req, nil)
+	req.Metadata = map[string]string{protocol.MetaProbe: "true"}
+	s.Observe("security", req, nil)
+	s.Observe("security", protocol.AgentRequest{IaC: &protocol.IaCInput{Format: protocol.FormatTerraform, RawCode: `resource "x" "y" {}`}}, nil)
+
+	reopened, err := NewUsageStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scans := reopened.Scans(UsageQuery{Repository: "org/app"})
+	if len(scans) != 1 || scans[0].JobID != "job-1" || len(scans[0].Calls) != 1 || scans[0].Calls[0].Version != "~> 0.9" {
+		t.Errorf("scans = %+v", scans)
+	}
+}
+
+func TestCatalog_Usage(t *testing.T) {
+	at := func(day int) time.Time { return time.Date(2026, 10, day, 9, 0, 0, 0, time.UTC) }
+	kv := func(version string) Call {
+		return Call{Name: "kv", Source: "Azure/avm-res-keyvault-vault/azurerm", Version: version}
+	}
+	pg := Call{Name: "db", Source: "registry.terraform.io/Azure/avm-res-dbforpostgresql-flexibleserver/azurerm", Version: "~> 0.1"}
+	scans := []Scan{
+		{Repository: "org/app", Time: at(1), Calls: []Call{kv("~> 0.9"), pg}},
+		// org/app upgraded: its old version no longer counts as a repository.
+		{Repository: "org/app", Time: at(2), Calls: []Call{kv("~> 0.10"), pg}},
+		{Repository: "org/web", Time: at(3), Calls: []Call{kv("~> 0.9"), kv("~> 0.9")}},
+		{Repository: "org/api", Time: at(3), Calls: []Call{kv("")}},
+		{Time: at(4), Calls: []Call{pg, {Name: "other", Source: "contoso/other/azurerm", Version: "1.0.0"}}},
+	}
+	usage := DefaultCatalog().Usage(scans)
+	if len(usage) != 2 {
+		t.Fatalf("usage = %+v", usage)
+	}
+	k := usage[0]
+	if k.Module != "key_vault" || k.Approved != "~> 0.10" || k.Repositories != 3 || k.Requests != 4 || k.OutdatedRepositories != 2 || k.OutdatedRequests != 3 {
+		t.Errorf("key_vault = %+v", k)
+	}
+	if len(k.Versions) != 3 || k.Versions[0].Version != "~> 0.9" || !k.Versions[0].Outdated || k.Versions[0].Requests != 2 ||
+		len(k.Versions[0].Repositories) != 1 || k.Versions[0].Repositories[0] != "org/web" || k.Versions[2].Version != "~> 0.10" || k.Versions[2].Outdated {
+		t.Errorf("key_vault versions = %+v", k.Versions)
+	}
+	if p := usage[1]; p.Module != "postgresql" || p.Repositories != 1 || p.Requests != 3 || p.OutdatedRequests != 0 {
+		t.Errorf("postgresql = %+v", p)
+	}
+}
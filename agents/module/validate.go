@@ -0,0 +1,189 @@
+package module
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/semver"
+)
+
+// Module validation rules.
+const (
+	// RuleUnpinned flags a module call without a version constraint.
+	RuleUnpinned = "MOD-001"
+	// RuleInvalidVersion flags a constraint that does not parse or that
+	// no version satisfies, such as ">= 3.0, < 2.0".
+	RuleInvalidVersion = "MOD-002"
+	// RuleUnapprovedVersion flags a catalog module whose constraint allows
+	// no version the catalog approves.
+	RuleUnapprovedVersion = "MOD-003"
+	// RuleLooseVersion flags a catalog module whose constraint also allows
+	// versions the catalog does not approve.
+	RuleLooseVersion = "MOD-004"
+	// RuleMutableRef flags a git module pinned to a ref that looks like a
+	// branch rather than a tag or commit.
+	RuleMutableRef = "MOD-005"
+	// RuleUnapprovedRef flags a catalog git module called at a ref the
+	// catalog does not approve.
+	RuleUnapprovedRef = "MOD-006"
+	// RuleTamperedSource flags an approved ref that no longer resolves to
+	// the commit or checksum the catalog records.
+	RuleTamperedSource = "MOD-007"
+)
+
+// Check is the validation of one module call.
+type Check struct {
+	Dependency parser.Dependency
+	// Approved is the catalog module with the same source, if any.
+	Approved *CatalogModule
+	// Pin is the approved pin of a git module's ref, if the catalog has
+	// one; Resolved is what the ref has now, once verified.
+	Pin       *Pin
+	Resolved  *Pin
+	VerifyErr error
+	Findings  []protocol.Finding
+}
+
+// CheckModules validates the registry and remote module calls in deps
+// against the catalog: every call must pin a version with a valid
+// constraint, and calls of catalog modules must stay within the versions
+// the catalog approves. Providers are left out.
+func (c Catalog) CheckModules(deps []parser.Dependency) []Check {
+	var checks []Check
+	for _, dep := range deps {
+		if dep.Kind != parser.DependencyModule {
+			continue
+		}
+		check := Check{Dependency: dep}
+		if m, ok := c.bySource(dep.Source); ok {
+			check.Approved = &m
+			if p, ok := m.pin(dep.Version); ok {
+				check.Pin = &p
+			}
+		}
+		check.Findings = check.validate()
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+func (ch Check) validate() []protocol.Finding {
+	dep := ch.Dependency
+	finding := func(rule string, sev protocol.Severity, msg, fix string) []protocol.Finding {
+		return []protocol.Finding{{
+			RuleID: rule, Category: "Modules", Severity: sev,
+			Resource: dep.Name, ResourceType: dep.Kind,
+			Message: msg, Remediation: fix,
+		}}
+	}
+	if dep.Version == "" && gitSource(dep.Source) {
+		return finding(RuleUnpinned, protocol.SeverityMedium, fmt.Sprintf("Git module %s (%s) has no ?ref= pin, so it follows the default branch", dep.Name, dep.Source),
+			"Append ?ref=<tag or commit SHA> to the source, e.g. ?ref=v1.2.3")
+	}
+	if dep.Version == "" {
+		fix := "Add a version constraint, e.g. version = \"~> 1.0\""
+		if ch.Approved != nil {
+			fix = fmt.Sprintf("Add version = %q, the catalog's approved versions", ch.Approved.Version)
+		}
+		return finding(RuleUnpinned, protocol.SeverityMedium, fmt.Sprintf("Module %s (%s) does not pin a version", dep.Name, dep.Source), fix)
+	}
+	if gitSource(dep.Source) {
+		return ch.validateRef(finding)
+	}
+	if !registrySource(dep.Source) {
+		// Archive and bucket sources pin nothing Terraform can check.
+		return nil
+	}
+	constraint, err := semver.ParseConstraint(dep.Version)
+	if err != nil {
+		return finding(RuleInvalidVersion, protocol.SeverityHigh, fmt.Sprintf("Module %s has an invalid version constraint: %v", dep.Name, err),
+			"Use Terraform constraint syntax, e.g. \"~> 3.0\" or \">= 2.1, < 3.0\"")
+	}
+	r := constraint.Range()
+	if r.Empty() {
+		return finding(RuleInvalidVersion, protocol.SeverityHigh, fmt.Sprintf("No version satisfies module %s's constraint %q", dep.Name, dep.Version),
+			"Fix the bounds so the minimum is below the maximum")
+	}
+	if ch.Approved == nil || ch.Approved.Version == "" {
+		return nil
+	}
+	approved, err := semver.ParseConstraint(ch.Approved.Version)
+	if err != nil {
+		return nil
+	}
+	ar := approved.Range()
+	switch {
+	case !r.Overlaps(ar):
+		return finding(RuleUnapprovedVersion, protocol.SeverityHigh,
+			fmt.Sprintf("Module %s allows %s, none of which the catalog approves (%s)", dep.Name, r, ar),
+			fmt.Sprintf("Use version = %q", ch.Approved.Version))
+	case !r.Within(ar):
+		return finding(RuleLooseVersion, protocol.SeverityMedium,
+			fmt.Sprintf("Module %s allows %s, beyond the catalog's approved %s", dep.Name, r, ar),
+			fmt.Sprintf("Narrow the constraint to %q", ch.Approved.Version))
+	}
+	return nil
+}
+
+// validateRef checks a git module's ref against the refs the catalog
+// approves or, for modules without approved refs, that it is not a branch.
+func (ch Check) validateRef(finding func(rule string, sev protocol.Severity, msg, fix string) []protocol.Finding) []protocol.Finding {
+	dep := ch.Dependency
+	if ch.Approved != nil {
+		if refs := ch.Approved.refs(); len(refs) > 0 {
+			if ch.Pin != nil || contains(refs, dep.Version) {
+				return nil
+			}
+			return finding(RuleUnapprovedRef, protocol.SeverityHigh,
+				fmt.Sprintf("Module %s is called at ref %s, which the catalog does not approve (approved: %s)", dep.Name, dep.Version, strings.Join(refs, ", ")),
+				"Use an approved ref, or have it added to the catalog's pins")
+		}
+	}
+	if !immutableRef(dep.Version) {
+		return finding(RuleMutableRef, protocol.SeverityMedium,
+			fmt.Sprintf("Module %s is pinned to %s, which looks like a branch and can change without the call changing", dep.Name, dep.Version),
+			"Pin a release tag (?ref=v1.2.3) or a full commit SHA")
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// registrySource reports whether source is a Terraform registry address
+// ("namespace/name/provider", optionally behind a registry host), the
+// only sources that take a version constraint.
+func registrySource(source string) bool {
+	if strings.Contains(source, "::") || strings.Contains(source, "?") {
+		return false
+	}
+	parts := strings.Split(source, "/")
+	if len(parts) == 4 && strings.Contains(parts[0], ".") && !strings.HasPrefix(parts[0], "github.com") && !strings.HasPrefix(parts[0], "bitbucket.org") {
+		parts = parts[1:]
+	}
+	return len(parts) == 3 && !strings.Contains(parts[0], ".")
+}
+
+// bySource returns the catalog module with the given source, ignoring
+// case, the public registry host and a ?ref= pin.
+func (c Catalog) bySource(source string) (CatalogModule, bool) {
+	for _, m := range c.Modules {
+		if normalizeSource(m.Source) == normalizeSource(source) {
+			return m, true
+		}
+	}
+	return CatalogModule{}, false
+}
+
+func normalizeSource(source string) string {
+	source, _, _ = strings.Cut(source, "?")
+	return strings.ToLower(strings.TrimPrefix(source, "registry.terraform.io/"))
+}
@@ -4,7 +4,9 @@ package notification
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 )
@@ -12,11 +14,26 @@ import (
 // Agent sends notifications to Teams/Slack channels.
 type Agent struct {
 	enableNotify bool
+	sender       *Sender
 }
 
 // New creates a new notification Agent.
-func New(enableNotify bool) *Agent {
-	return &Agent{enableNotify: enableNotify}
+func New(enableNotify bool, opts ...Option) *Agent {
+	a := &Agent{enableNotify: enableNotify}
+	for _, o := range opts {
+		o(a)
+	}
+	return a
+}
+
+// Option configures a notification Agent.
+type Option func(*Agent)
+
+// WithSender sets the webhook sender used to deliver notifications.
+func WithSender(s *Sender) Option {
+	return func(a *Agent) {
+		a.sender = s
+	}
 }
 
 func (a *Agent) ID() string { return "notification" }
@@ -36,15 +53,41 @@ func (a *Agent) Capabilities() protocol.AgentCapabilities {
 	}
 }
 
+// Mutates reports true: every request sends a notification.
+func (a *Agent) Mutates(protocol.AgentRequest) bool { return true }
+
 // Handle processes notification requests.
-func (a *Agent) Handle(_ context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
+func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
 	emit.SendMessage("## Notification Manager\n\n")
 
 	msg := strings.ToLower(protocol.PromptText(req))
 
-	channel := "teams"
-	if strings.Contains(msg, "slack") {
-		channel = "slack"
+	// Match channel names against the instructions, not the pasted code.
+	instructions := msg
+	if req.IaC != nil && req.IaC.RawCode != "" {
+		instructions = strings.Replace(msg, strings.ToLower(req.IaC.RawCode), "", 1)
+	}
+	channel, named := "teams", false
+	if strings.Contains(instructions, "slack") {
+		channel, named = "slack", true
+	}
+	// Named channels (e.g. "finance") take precedence when mentioned.
+	for _, name := range a.sender.Names() {
+		if strings.Contains(instructions, strings.ToLower(name)) {
+			channel, named = name, true
+			break
+		}
+	}
+	// Without an explicit channel, route to the owners annotated on the code.
+	targets := []string{channel}
+	if !named {
+		owned, unrouted := a.ownerChannels(req)
+		if len(owned) > 0 {
+			targets = owned
+		}
+		if len(unrouted) > 0 {
+			emit.SendMessage(fmt.Sprintf("_No channel is configured for owner(s) %s._\n\n", strings.Join(unrouted, ", ")))
+		}
 	}
 
 	message := "Infrastructure update notification"
@@ -52,13 +95,58 @@ func (a *Agent) Handle(_ context.Context, req protocol.AgentRequest, emit protoc
 		message = strings.TrimSpace(msg[idx+8:])
 	}
 
-	emit.SendMessage(fmt.Sprintf("Sending notification to **%s**:\n> %s\n\n", channel, message))
+	for _, channel := range targets {
+		emit.SendMessage(fmt.Sprintf("Sending notification to **%s**:\n> %s\n\n", channel, message))
+		if !a.enableNotify {
+			emit.SendMessage("Notifications are disabled. Set `ENABLE_NOTIFICATIONS=true` to enable.\n")
+			return nil
+		}
+		a.send(ctx, channel, message, emit)
+	}
+	return nil
+}
 
-	if !a.enableNotify {
-		emit.SendMessage("Notifications are disabled. Set `ENABLE_NOTIFICATIONS=true` to enable.\n")
-		return nil
+// send delivers message to channel and reports the outcome.
+func (a *Agent) send(ctx context.Context, channel, message string, emit protocol.Emitter) {
+	if _, ok := a.sender.Channel(channel); !ok {
+		emit.SendMessage(fmt.Sprintf("Channel `%s` is not configured. Set a webhook URL for it to enable delivery.\n", channel))
+		return
+	}
+
+	if err := a.sender.Send(ctx, channel, Message{
+		Title:    "Infrastructure notification",
+		Template: TemplateInfraNotification,
+		Text:     message,
+		Time:     time.Now(),
+	}); err != nil {
+		emit.SendMessage(fmt.Sprintf("Notification failed: %v\n", err))
+		return
 	}
 
 	emit.SendMessage("Notification sent successfully.\n")
-	return nil
+}
+
+// ownerChannels returns the configured channels named after the owners in
+// the "iac-gov:" annotations of the request's resources, and the owners
+// with no channel of their own.
+func (a *Agent) ownerChannels(req protocol.AgentRequest) (channels, unrouted []string) {
+	if req.IaC == nil {
+		return nil, nil
+	}
+	seen := make(map[string]bool)
+	for _, res := range req.IaC.Resources {
+		if res.Annotations == nil || res.Annotations.Owner == "" || seen[res.Annotations.Owner] {
+			continue
+		}
+		owner := res.Annotations.Owner
+		seen[owner] = true
+		if _, ok := a.sender.Channel(owner); ok {
+			channels = append(channels, owner)
+		} else {
+			unrouted = append(unrouted, owner)
+		}
+	}
+	sort.Strings(channels)
+	sort.Strings(unrouted)
+	return channels, unrouted
 }
@@ -2,9 +2,21 @@ package notification
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/azauth"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/config"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
 )
@@ -57,3 +69,478 @@ func TestAgent_NotifySlack(t *testing.T) {
 func TestAgent_ImplementsAgent(t *testing.T) {
 	var _ protocol.Agent = (*Agent)(nil)
 }
+
+func TestAgent_NotifySendsToChannel(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	sender := NewSender([]Channel{{Name: "finance", Kind: KindSlack, URL: srv.URL}})
+	a := New(true, WithSender(sender))
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{
+			{Role: "user", Content: "notify finance message: budget review"},
+		},
+	}
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if !strings.Contains(combined, "sent successfully") {
+		t.Errorf("expected success message, got:\n%s", combined)
+	}
+	if text, _ := got["text"].(string); !strings.Contains(text, "budget review") {
+		t.Errorf("webhook payload = %v", got)
+	}
+}
+
+func TestAgent_NotifyUnconfiguredChannel(t *testing.T) {
+	a := New(true)
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "notify teams message: hi"}},
+	}
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(strings.Join(rec.Messages, ""), "not configured") {
+		t.Error("expected not configured message")
+	}
+}
+
+func TestParseChannels(t *testing.T) {
+	channels, err := ParseChannels("finance=slack:https://hooks.slack.com/x, ops=teams:https://outlook.office.com/y,audit=https://siem.example.com/hook")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(channels) != 3 {
+		t.Fatalf("channels = %d, want 3", len(channels))
+	}
+	if channels[0].Kind != KindSlack || channels[0].URL != "https://hooks.slack.com/x" {
+		t.Errorf("finance = %+v", channels[0])
+	}
+	if channels[2].Kind != KindWebhook || channels[2].URL != "https://siem.example.com/hook" {
+		t.Errorf("audit = %+v", channels[2])
+	}
+	pd, err := ParseChannels("oncall=pagerduty:R0UT1NGKEY")
+	if err != nil || len(pd) != 1 || pd[0].Kind != KindPagerDuty || pd[0].RoutingKey != "R0UT1NGKEY" || pd[0].URL != DefaultPagerDutyURL {
+		t.Errorf("pagerduty channel = %+v, %v", pd, err)
+	}
+	email, err := ParseChannels("cab=email:cab@contoso.com; ops@contoso.com")
+	if err != nil || len(email) != 1 || email[0].Kind != KindEmail || len(email[0].To) != 2 || email[0].To[1] != "ops@contoso.com" {
+		t.Errorf("email channel = %+v, %v", email, err)
+	}
+	for _, bad := range []string{"finance", "x=pager:https://a", "x=slack:notaurl", "x=email:", "x=email:not-an-address", "x=pagerduty:"} {
+		if _, err := ParseChannels(bad); err == nil {
+			t.Errorf("ParseChannels(%q) should fail", bad)
+		}
+	}
+}
+
+func TestAgent_RoutesToAnnotatedOwners(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	sender := NewSender([]Channel{
+		{Name: "teams", Kind: KindWebhook, URL: srv.URL + "/teams"},
+		{Name: "payments", Kind: KindWebhook, URL: srv.URL + "/payments"},
+	})
+	a := New(true, WithSender(sender))
+	req := protocol.AgentRequest{
+		Prompt: "notify the owners message: rotating keys",
+		IaC: &protocol.IaCInput{Resources: []protocol.Resource{
+			{Type: "azurerm_storage_account", Name: "sa", Annotations: &protocol.Annotations{Owner: "payments"}},
+			{Type: "azurerm_key_vault", Name: "kv", Annotations: &protocol.Annotations{Owner: "identity"}},
+		}},
+	}
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if len(paths) != 1 || paths[0] != "/payments" {
+		t.Errorf("deliveries = %v, want only the payments channel", paths)
+	}
+	if !strings.Contains(combined, "No channel is configured for owner(s) identity") {
+		t.Errorf("expected unrouted owner note, got:\n%s", combined)
+	}
+
+	// An explicitly named channel wins over ownership.
+	paths = nil
+	req.Prompt = "notify teams message: rotating keys"
+	if err := a.Handle(context.Background(), req, &prototest.Recorder{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 1 || paths[0] != "/teams" {
+		t.Errorf("deliveries = %v, want the named channel", paths)
+	}
+}
+
+func TestSender_TeamsPayload(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	s := NewSender([]Channel{{Name: "ops", Kind: KindTeams, URL: srv.URL}})
+	if err := s.Send(context.Background(), "ops", Message{Title: "Deploy", Text: "done"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got["@type"] != "MessageCard" || got["title"] != "Deploy" {
+		t.Errorf("teams payload = %v", got)
+	}
+}
+
+func TestSender_EventPayload(t *testing.T) {
+	var got map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	s := NewSender([]Channel{{Name: "ops", Kind: KindTeams, URL: srv.URL}, {Name: "siem", Kind: KindWebhook, URL: srv.URL}})
+	msg := Message{Title: "Scan", Text: "Blocked", Event: "workflow.analyze.succeeded", Severity: SeverityCritical, Data: map[string]int{"high": 1}}
+	if err := s.Send(context.Background(), "ops", msg); err != nil {
+		t.Fatal(err)
+	}
+	if got["themeColor"] != severityColors[SeverityCritical] {
+		t.Errorf("teams payload = %v, want critical color", got)
+	}
+	if err := s.Send(context.Background(), "siem", msg); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := got["data"].(map[string]interface{})
+	if got["event"] != "workflow.analyze.succeeded" || got["severity"] != "critical" || data["high"] != 1.0 {
+		t.Errorf("webhook payload = %v", got)
+	}
+}
+
+func TestSender_PagerDutySeverities(t *testing.T) {
+	var got struct {
+		RoutingKey  string `json:"routing_key"`
+		EventAction string `json:"event_action"`
+		Payload     struct {
+			Summary  string `json:"summary"`
+			Severity string `json:"severity"`
+		} `json:"payload"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	t.Setenv("PAGERDUTY_SEVERITIES", "medium=critical")
+	mapping, err := config.Load().PagerDutyMapping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	channels, err := ParseChannels("oncall=pagerduty:R0UT1NGKEY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	channels[0].URL = srv.URL
+	s := NewSender(channels, WithPagerDuty(mapping))
+	for _, tc := range []struct {
+		msg  Message
+		want string
+	}{
+		{Message{Title: "IaC drift detected: 1 change(s)", Severity: SeverityWarning, Level: protocol.SeverityMedium}, "critical"},
+		{Message{Title: "IaC drift detected: 2 change(s)", Severity: SeverityCritical, Level: protocol.SeverityHigh}, "error"},
+		{Message{Title: "IaC analyze workflow completed", Severity: SeverityWarning}, "warning"},
+	} {
+		if err := s.Send(context.Background(), "oncall", tc.msg); err != nil {
+			t.Fatal(err)
+		}
+		if got.RoutingKey != "R0UT1NGKEY" || got.EventAction != "trigger" || got.Payload.Summary != tc.msg.Title || got.Payload.Severity != tc.want {
+			t.Errorf("%s: event = %+v, want severity %s", tc.msg.Title, got, tc.want)
+		}
+	}
+}
+
+func TestSender_RateLimitCoalesces(t *testing.T) {
+	var mu sync.Mutex
+	var posts []map[string]interface{}
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&got)
+		mu.Lock()
+		posts = append(posts, got)
+		first := len(posts) == 1
+		mu.Unlock()
+		if first {
+			close(started)
+			<-release
+		}
+	}))
+	defer srv.Close()
+
+	s := NewSender([]Channel{{Name: "siem", Kind: KindWebhook, URL: srv.URL}}, WithRateLimit(100, 10))
+	pending := func() int {
+		s.queueMu.Lock()
+		q := s.queues["siem"]
+		s.queueMu.Unlock()
+		if q == nil {
+			return 0
+		}
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return len(q.pending)
+	}
+
+	var wg sync.WaitGroup
+	send := func(title, severity string) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Send(context.Background(), "siem", Message{Title: title, Text: "details", Severity: severity}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	// The first message is sent at once and held by the server; the rest
+	// queue behind it in order.
+	send("first", SeverityInfo)
+	<-started
+	for i, title := range []string{"b", "c", "d"} {
+		send(title, map[string]string{"c": SeverityCritical}[title])
+		for pending() != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	if len(posts) != 2 {
+		t.Fatalf("posts = %d, want the burst coalesced into a second", len(posts))
+	}
+	batch := posts[1]
+	data, _ := batch["data"].([]interface{})
+	if batch["title"] != "3 notifications" || batch["event"] != EventBatch || batch["severity"] != SeverityCritical || len(data) != 3 {
+		t.Fatalf("batch = %v", batch)
+	}
+	text, _ := batch["text"].(string)
+	if !strings.Contains(text, "1. b\ndetails") || strings.Index(text, "2. c") > strings.Index(text, "3. d") || !strings.Contains(text, "3 messages were combined") {
+		t.Errorf("batch text = %q", text)
+	}
+	if ds := s.Deliveries("siem", "", time.Time{}); len(ds) != 2 || ds[0].Events != 0 || ds[1].Events != 3 {
+		t.Errorf("deliveries = %+v", ds)
+	}
+}
+
+func TestSender_Error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "throttled", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	s := NewSender([]Channel{{Name: "ops", Kind: KindWebhook, URL: srv.URL}})
+	if err := s.Send(context.Background(), "ops", Message{Text: "x"}); err == nil {
+		t.Error("expected error for 429 response")
+	}
+	if err := s.Send(context.Background(), "missing", Message{}); err == nil {
+		t.Error("expected error for unknown channel")
+	}
+}
+
+func TestSender_LocalizesPerChannel(t *testing.T) {
+	var got Message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer srv.Close()
+
+	locales, err := ParseLocales("berlin=de-DE@Europe/Berlin,tokyo=@Asia/Tokyo", DefaultLocalization)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	s := NewSender([]Channel{
+		{Name: "berlin", Kind: KindWebhook, URL: srv.URL},
+		{Name: "tokyo", Kind: KindWebhook, URL: srv.URL},
+		{Name: "other", Kind: KindWebhook, URL: srv.URL},
+	}, WithLocales(locales, DefaultLocalization))
+
+	sent := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	msg := Message{Title: "fallback", Template: TemplateCostForecast, Args: []interface{}{sent}, Text: "body", Time: sent}
+
+	cases := []struct {
+		channel, title, stamp string
+	}{
+		{"berlin", "Wöchentliche IaC-Kostenprognose — 02.03.2026", "Gesendet am 02.03.2026 09:00 CET"},
+		{"tokyo", "Weekly IaC cost forecast — Mar 2, 2026", "Sent Mar 2, 2026 5:00 PM JST"},
+		{"other", "Weekly IaC cost forecast — Mar 2, 2026", "Sent Mar 2, 2026 8:00 AM UTC"},
+	}
+	for _, c := range cases {
+		if err := s.Send(context.Background(), c.channel, msg); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.channel, err)
+		}
+		if got.Title != c.title || !strings.Contains(got.Text, c.stamp) {
+			t.Errorf("%s: got %q / %q", c.channel, got.Title, got.Text)
+		}
+	}
+
+	if _, err := ParseLocales("x=en@Mars/Base", DefaultLocalization); err == nil {
+		t.Error("expected error for unknown time zone")
+	}
+}
+
+func TestSender_SignedWebhookWithRetryAndReplay(t *testing.T) {
+	var calls int
+	var deliveries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := io.ReadAll(r.Body)
+		if !VerifyWebhook(body, r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), "s3cret") {
+			t.Errorf("call %d: invalid signature", calls)
+		}
+		if r.Header.Get("X-Tenant") != "acme" {
+			t.Errorf("call %d: custom header missing", calls)
+		}
+		deliveries = append(deliveries, r.Header.Get(HeaderDelivery)+"/"+r.Header.Get(HeaderReplay))
+		if calls <= 3 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	t.Setenv("AUDIT_WEBHOOK_SECRET", "s3cret")
+	os.WriteFile(path, []byte(`{"audit": {"secret": "${AUDIT_WEBHOOK_SECRET}", "headers": {"X-Tenant": "${TENANT:-acme}"}, "backoff": "1ms"}}`), 0o600)
+	webhooks, err := LoadWebhookConfigs(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if webhooks["audit"].Secret != "s3cret" {
+		t.Errorf("secret = %q, want it expanded from the environment", webhooks["audit"].Secret)
+	}
+	if webhooks["audit"].MaxAttempts != DefaultMaxAttempts {
+		t.Errorf("max_attempts = %d, want default %d", webhooks["audit"].MaxAttempts, DefaultMaxAttempts)
+	}
+
+	s := NewSender([]Channel{{Name: "audit", Kind: KindWebhook, URL: srv.URL}}, WithWebhooks(webhooks))
+	if err := s.Send(context.Background(), "audit", Message{Title: "t", Text: "x"}); err == nil {
+		t.Fatal("expected failure after exhausting retries")
+	}
+	failed := s.Deliveries("audit", DeliveryFailed, time.Time{})
+	if calls != 3 || len(failed) != 1 || failed[0].Attempts != 3 {
+		t.Fatalf("calls = %d, failed = %+v", calls, failed)
+	}
+
+	d, err := s.Replay(context.Background(), failed[0].ID)
+	if err != nil || d.Status != DeliveryDelivered || d.Replays != 1 {
+		t.Fatalf("replay = %+v, %v", d, err)
+	}
+	if last := deliveries[len(deliveries)-1]; last != failed[0].ID+"/true" {
+		t.Errorf("replay headers = %q, want same delivery ID with replay flag", last)
+	}
+	if _, err := s.Replay(context.Background(), "nope"); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Errorf("err = %v, want ErrDeliveryNotFound", err)
+	}
+}
+
+func TestLoadWebhookConfigs_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "webhooks.json")
+	for _, bad := range []string{`{"a": {"backoff": 5}}`, `{"a": {"max_attempts": -1}}`, `[]`} {
+		os.WriteFile(path, []byte(bad), 0o600)
+		if _, err := LoadWebhookConfigs(path); err == nil {
+			t.Errorf("LoadWebhookConfigs(%s) should fail", bad)
+		}
+	}
+}
+
+func TestGraphMailer(t *testing.T) {
+	var tokens, sends int
+	var mails []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/tenant-1/oauth2/v2.0/token":
+			tokens++
+			r.ParseForm()
+			if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("client_secret") != "shh" {
+				t.Errorf("token form = %v", r.Form)
+			}
+			fmt.Fprint(w, `{"access_token": "tok", "expires_in": 3600}`)
+		case "/v1.0/users/alerts@contoso.com/sendMail":
+			sends++
+			if r.Header.Get("Authorization") != "Bearer tok" {
+				t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+			}
+			if sends == 1 {
+				http.Error(w, "throttled", http.StatusTooManyRequests)
+				return
+			}
+			var m map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&m)
+			mails = append(mails, m)
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	tmpl := filepath.Join(t.TempDir(), "email.html")
+	os.WriteFile(tmpl, []byte(`<b>{{.Title}}</b> for {{.Channel}}: {{.Text}}`), 0o600)
+	creds, _ := azauth.New(azauth.Config{TenantID: "tenant-1", ClientID: "app", ClientSecret: "shh", AuthorityHost: srv.URL})
+	mailer, err := NewGraphMailer(GraphMailConfig{
+		Sender: "alerts@contoso.com", Credentials: creds, GraphURL: srv.URL, TemplatePath: tmpl,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSender([]Channel{{Name: "cab", Kind: KindEmail, To: []string{"cab@contoso.com"}}},
+		WithMailer(mailer), WithWebhooks(map[string]WebhookConfig{"cab": {MaxAttempts: 2, Backoff: Duration(time.Millisecond)}}))
+	ctx := context.Background()
+	if err := s.Send(ctx, "cab", Message{Title: "Deploy <prod>", Text: "a & b"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := s.Send(ctx, "cab", Message{Title: "Second", Text: "x"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if tokens != 1 || sends != 3 {
+		t.Errorf("tokens = %d, sends = %d; want the token cached and the 429 retried", tokens, sends)
+	}
+	msg := mails[0]["message"].(map[string]interface{})
+	body := msg["body"].(map[string]interface{})["content"]
+	if msg["subject"] != "Deploy <prod>" || body != "<b>Deploy &lt;prod&gt;</b> for cab: a &amp; b" {
+		t.Errorf("message = %v", msg)
+	}
+	if to := fmt.Sprint(msg["toRecipients"]); !strings.Contains(to, "cab@contoso.com") {
+		t.Errorf("toRecipients = %s", to)
+	}
+
+	if _, err := NewGraphMailer(GraphMailConfig{Credentials: creds}); err == nil {
+		t.Error("a sender mailbox should be required")
+	}
+	if _, err := NewGraphMailer(GraphMailConfig{Sender: "alerts@contoso.com"}); err == nil {
+		t.Error("credentials should be required")
+	}
+	if err := NewSender([]Channel{{Name: "cab", Kind: KindEmail, To: []string{"a@b.c"}}}).Send(ctx, "cab", Message{Title: "x"}); err == nil {
+		t.Error("email without a mailer should fail")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for header, want := range map[string]time.Duration{
+		"":                              0,
+		"30":                            30 * time.Second,
+		"Thu, 01 Oct 2026 12:00:10 GMT": 10 * time.Second,
+		"soon":                          0,
+	} {
+		resp := &http.Response{Header: http.Header{"Retry-After": {header}}}
+		if got := retryAfter(resp, now); got != want {
+			t.Errorf("retryAfter(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/azauth"
+)
+
+// DefaultGraphURL is the public cloud's Microsoft Graph endpoint.
+// Sovereign clouds override it.
+const DefaultGraphURL = "https://graph.microsoft.com"
+
+// DefaultEmailTemplate renders a message as a minimal HTML email. Custom
+// templates get the same fields: .Title, .Text, .Lines (Text split into
+// lines) and .Channel.
+const DefaultEmailTemplate = `<html><body style="font-family:Segoe UI,Helvetica,Arial,sans-serif">
+<h2>{{.Title}}</h2>
+<p>{{range $i, $l := .Lines}}{{if $i}}<br>{{end}}{{$l}}{{end}}</p>
+</body></html>`
+
+// GraphMailConfig configures the Microsoft Graph sendMail driver.
+type GraphMailConfig struct {
+	// Sender is the mailbox (UPN or object ID) mail is sent as. The app
+	// needs the Mail.Send application permission, ideally scoped to it
+	// with an application access policy.
+	Sender string
+	// Credentials acquire the app-only Graph token.
+	Credentials azauth.TokenSource
+	// GraphURL defaults to the public cloud.
+	GraphURL string
+	// TemplatePath is an html/template file for the body; empty uses
+	// DefaultEmailTemplate.
+	TemplatePath string
+}
+
+// GraphMailer sends notification email through Microsoft Graph with
+// app-only auth, for tenants where SMTP is blocked. It is safe for
+// concurrent use.
+type GraphMailer struct {
+	cfg  GraphMailConfig
+	tmpl *template.Template
+}
+
+// NewGraphMailer validates cfg and parses its template.
+func NewGraphMailer(cfg GraphMailConfig) (*GraphMailer, error) {
+	if cfg.Sender == "" {
+		return nil, fmt.Errorf("graph mail: sender mailbox is required")
+	}
+	if cfg.Credentials == nil {
+		return nil, fmt.Errorf("graph mail: credentials are required")
+	}
+	if cfg.GraphURL == "" {
+		cfg.GraphURL = DefaultGraphURL
+	}
+	cfg.GraphURL = strings.TrimRight(cfg.GraphURL, "/")
+
+	text := DefaultEmailTemplate
+	if cfg.TemplatePath != "" {
+		data, err := os.ReadFile(cfg.TemplatePath)
+		if err != nil {
+			return nil, fmt.Errorf("read email template: %w", err)
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("email").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse email template: %w", err)
+	}
+	return &GraphMailer{cfg: cfg, tmpl: tmpl}, nil
+}
+
+// WithMailer sets the driver for email channels.
+func WithMailer(m *GraphMailer) SenderOption {
+	return func(s *Sender) {
+		s.mailer = m
+	}
+}
+
+// endpoint is the sendMail URL for the sender mailbox.
+func (m *GraphMailer) endpoint() string {
+	return m.cfg.GraphURL + "/v1.0/users/" + url.PathEscape(m.cfg.Sender) + "/sendMail"
+}
+
+// payload renders msg as a Graph sendMail request to the channel's
+// recipients.
+func (m *GraphMailer) payload(c Channel, msg Message) (interface{}, error) {
+	var body bytes.Buffer
+	err := m.tmpl.Execute(&body, struct {
+		Title, Text, Channel string
+		Lines                []string
+	}{msg.Title, msg.Text, c.Name, strings.Split(msg.Text, "\n")})
+	if err != nil {
+		return nil, fmt.Errorf("render email: %w", err)
+	}
+	to := make([]map[string]interface{}, len(c.To))
+	for i, addr := range c.To {
+		to[i] = map[string]interface{}{"emailAddress": map[string]string{"address": addr}}
+	}
+	return map[string]interface{}{
+		"message": map[string]interface{}{
+			"subject":      msg.Title,
+			"body":         map[string]string{"contentType": "HTML", "content": body.String()},
+			"toRecipients": to,
+		},
+		"saveToSentItems": false,
+	}, nil
+}
+
+// accessToken returns a Graph token.
+func (m *GraphMailer) accessToken(ctx context.Context) (string, error) {
+	tok, err := m.cfg.Credentials.Token(ctx, m.cfg.GraphURL)
+	if err != nil {
+		return "", fmt.Errorf("acquire graph token: %w", err)
+	}
+	return tok, nil
+}
+
+// ParseRecipients splits a ;-separated list of email addresses.
+func ParseRecipients(s string) ([]string, error) {
+	var out []string
+	for _, addr := range strings.Split(s, ";") {
+		addr = strings.TrimSpace(addr)
+		if addr == "" {
+			continue
+		}
+		if at := strings.Index(addr, "@"); at < 1 || at == len(addr)-1 || strings.ContainsAny(addr, " <>") {
+			return nil, fmt.Errorf("invalid email address %q", addr)
+		}
+		out = append(out, addr)
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no recipients")
+	}
+	return out, nil
+}
@@ -0,0 +1,177 @@
+package notification
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Message templates with translations in the catalog below.
+const (
+	TemplateInfraNotification = "infra.notification"
+	TemplateCostForecast      = "cost.forecast"
+	TemplateWorkflowCompleted = "workflow.completed"
+	TemplateDriftDetected     = "drift.detected"
+	TemplateBatched           = "notification.batched"
+)
+
+// Localization is the language and time zone a channel's messages render in.
+type Localization struct {
+	Locale   string // BCP 47 tag, e.g. "de-DE"
+	Location *time.Location
+}
+
+// DefaultLocalization is the platform fallback: US English in UTC.
+var DefaultLocalization = Localization{Locale: "en-US", Location: time.UTC}
+
+// With returns l with the given locale tag and IANA time zone name applied.
+// Empty values keep l's settings.
+func (l Localization) With(locale, timeZone string) (Localization, error) {
+	if locale = strings.TrimSpace(locale); locale != "" {
+		l.Locale = locale
+	}
+	if timeZone = strings.TrimSpace(timeZone); timeZone != "" {
+		loc, err := time.LoadLocation(timeZone)
+		if err != nil {
+			return Localization{}, fmt.Errorf("time zone %q: %w", timeZone, err)
+		}
+		l.Location = loc
+	}
+	return l, nil
+}
+
+// ParseLocales parses comma-separated name=locale@timezone entries, e.g.
+// "finance=de-DE@Europe/Berlin,apac=@Asia/Tokyo". Either part may be empty;
+// missing parts fall back to def.
+func ParseLocales(s string, def Localization) (map[string]Localization, error) {
+	out := make(map[string]Localization)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid locale entry %q (want name=locale@timezone)", entry)
+		}
+		locale, zone, _ := strings.Cut(spec, "@")
+		l, err := def.With(locale, zone)
+		if err != nil {
+			return nil, fmt.Errorf("channel %q: %w", name, err)
+		}
+		out[name] = l
+	}
+	return out, nil
+}
+
+// catalog holds message templates per language. Title templates may take
+// arguments; time.Time arguments render as dates in the channel's zone.
+var catalog = map[string]map[string]string{
+	"en": {
+		TemplateInfraNotification: "Infrastructure notification",
+		TemplateCostForecast:      "Weekly IaC cost forecast — %s",
+		TemplateWorkflowCompleted: "IaC %s workflow completed",
+		TemplateDriftDetected:     "IaC drift detected: %d change(s)",
+		TemplateBatched:           "%d notifications",
+		"coalesced":               "%d messages were combined because the channel is rate limited.",
+		"sent_at":                 "Sent %s",
+	},
+	"de": {
+		TemplateInfraNotification: "Infrastruktur-Benachrichtigung",
+		TemplateCostForecast:      "Wöchentliche IaC-Kostenprognose — %s",
+		TemplateWorkflowCompleted: "IaC-Workflow %s abgeschlossen",
+		TemplateDriftDetected:     "IaC-Drift erkannt: %d Änderung(en)",
+		TemplateBatched:           "%d Benachrichtigungen",
+		"coalesced":               "%d Nachrichten wurden zusammengefasst, da der Kanal ratenbegrenzt ist.",
+		"sent_at":                 "Gesendet am %s",
+	},
+	"fr": {
+		TemplateInfraNotification: "Notification d'infrastructure",
+		TemplateCostForecast:      "Prévision hebdomadaire des coûts IaC — %s",
+		TemplateWorkflowCompleted: "Workflow IaC %s terminé",
+		TemplateDriftDetected:     "Dérive IaC détectée : %d modification(s)",
+		TemplateBatched:           "%d notifications",
+		"coalesced":               "%d messages ont été regroupés car le canal est limité en débit.",
+		"sent_at":                 "Envoyé le %s",
+	},
+	"es": {
+		TemplateInfraNotification: "Notificación de infraestructura",
+		TemplateCostForecast:      "Previsión semanal de costes de IaC — %s",
+		TemplateWorkflowCompleted: "Flujo de trabajo de IaC %s completado",
+		TemplateDriftDetected:     "Deriva de IaC detectada: %d cambio(s)",
+		TemplateBatched:           "%d notificaciones",
+		"coalesced":               "Se combinaron %d mensajes porque el canal tiene un límite de velocidad.",
+		"sent_at":                 "Enviado el %s",
+	},
+	"ja": {
+		TemplateInfraNotification: "インフラストラクチャ通知",
+		TemplateCostForecast:      "週次 IaC コスト予測 — %s",
+		TemplateWorkflowCompleted: "IaC %s ワークフロー完了",
+		TemplateDriftDetected:     "IaC ドリフトを検出: %d 件の変更",
+		TemplateBatched:           "%d 件の通知",
+		"coalesced":               "チャネルのレート制限により %d 件のメッセージをまとめました。",
+		"sent_at":                 "送信日時 %s",
+	},
+}
+
+// Date and timestamp layouts by locale, then by language.
+var (
+	dateLayouts = map[string]string{
+		"en-US": "Jan 2, 2006", "en": "2 Jan 2006",
+		"de": "02.01.2006", "fr": "02/01/2006", "es": "02/01/2006", "ja": "2006/01/02",
+	}
+	timestampLayouts = map[string]string{
+		"en-US": "Jan 2, 2006 3:04 PM MST", "en": "2 Jan 2006 15:04 MST",
+		"de": "02.01.2006 15:04 MST", "fr": "02/01/2006 15:04 MST", "es": "02/01/2006 15:04 MST", "ja": "2006/01/02 15:04 MST",
+	}
+)
+
+// lookup returns the entry for locale, trying the full tag, then its
+// language, then English.
+func lookup(m map[string]string, locale string) string {
+	lang, _, _ := strings.Cut(locale, "-")
+	for _, k := range []string{locale, strings.ToLower(lang), "en"} {
+		if v, ok := m[k]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// translate returns the template for key in the locale's language, falling
+// back to English, and false when the key is unknown.
+func translate(locale, key string) (string, bool) {
+	lang, _, _ := strings.Cut(locale, "-")
+	if t, ok := catalog[strings.ToLower(lang)][key]; ok {
+		return t, true
+	}
+	t, ok := catalog["en"][key]
+	return t, ok
+}
+
+// localize renders msg for l: a known Template replaces Title, and a
+// non-zero Time is appended as a timestamp in the channel's zone.
+func (l Localization) localize(msg Message) Message {
+	loc := l.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	if tmpl, ok := translate(l.Locale, msg.Template); ok && msg.Template != "" {
+		dateLayout := lookup(dateLayouts, l.Locale)
+		args := make([]interface{}, len(msg.Args))
+		for i, a := range msg.Args {
+			if t, ok := a.(time.Time); ok {
+				a = t.In(loc).Format(dateLayout)
+			}
+			args[i] = a
+		}
+		msg.Title = fmt.Sprintf(tmpl, args...)
+	}
+	if !msg.Time.IsZero() {
+		layout := lookup(timestampLayouts, l.Locale)
+		sentAt, _ := translate(l.Locale, "sent_at")
+		msg.Text += "\n\n_" + fmt.Sprintf(sentAt, msg.Time.In(loc).Format(layout)) + "_"
+	}
+	return msg
+}
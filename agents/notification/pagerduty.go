@@ -0,0 +1,75 @@
+package notification
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// DefaultPagerDutyURL is the PagerDuty Events API v2 endpoint.
+const DefaultPagerDutyURL = "https://events.pagerduty.com/v2/enqueue"
+
+// maxPagerDutySummary is the longest summary PagerDuty accepts.
+const maxPagerDutySummary = 1024
+
+// WithPagerDuty sets how messages' shared severities map to PagerDuty
+// event severities, e.g. from PAGERDUTY_SEVERITIES. Without it,
+// protocol.DefaultPagerDutySeverities applies.
+func WithPagerDuty(severities protocol.SeverityMapping) SenderOption {
+	return func(s *Sender) {
+		s.pagerDuty = severities
+	}
+}
+
+// pagerDutySeverity is the PagerDuty severity of msg: its shared Level
+// through the mapping, or else its event severity, which PagerDuty's
+// vocabulary also has.
+func (s *Sender) pagerDutySeverity(msg Message) string {
+	mapping := s.pagerDuty
+	if mapping == nil {
+		mapping = protocol.DefaultPagerDutySeverities()
+	}
+	if level := mapping.Map(msg.Level); level != "" {
+		return level
+	}
+	if _, ok := severityRank[msg.Severity]; ok {
+		return msg.Severity
+	}
+	return SeverityInfo
+}
+
+// pagerDutyPayload renders msg as an Events API v2 trigger for the
+// channel's routing key.
+func (s *Sender) pagerDutyPayload(c Channel, msg Message) interface{} {
+	summary := msg.Title
+	if len(summary) > maxPagerDutySummary {
+		summary = summary[:maxPagerDutySummary]
+	}
+	details := map[string]interface{}{"text": msg.Text}
+	if msg.Event != "" {
+		details["event"] = msg.Event
+	}
+	if msg.Data != nil {
+		details["data"] = msg.Data
+	}
+	return map[string]interface{}{
+		"routing_key":  c.RoutingKey,
+		"event_action": "trigger",
+		"payload": map[string]interface{}{
+			"summary":        summary,
+			"source":         "ghcp-iac",
+			"severity":       s.pagerDutySeverity(msg),
+			"custom_details": details,
+		},
+	}
+}
+
+// parseRoutingKey checks a PagerDuty channel's integration key.
+func parseRoutingKey(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	if key == "" || strings.ContainsAny(key, " /;") {
+		return "", fmt.Errorf("invalid PagerDuty routing key")
+	}
+	return key, nil
+}
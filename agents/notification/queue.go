@@ -0,0 +1,151 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rate limit defaults. Teams and Slack webhooks throttle at about one
+// message per second per webhook.
+const (
+	DefaultRateLimit = 1.0
+	DefaultMaxBatch  = 20
+)
+
+// EventBatch is the Event of a message coalescing several; its Data holds
+// the original messages in order.
+const EventBatch = "notification.batch"
+
+// WithRateLimit queues messages per channel and sends at most perSecond
+// messages a second to each. Messages that queue up while a channel waits
+// are coalesced, up to maxBatch at a time, into one message that notes how
+// many were combined. perSecond <= 0 sends immediately.
+func WithRateLimit(perSecond float64, maxBatch int) SenderOption {
+	return func(s *Sender) {
+		s.interval = 0
+		if perSecond > 0 {
+			s.interval = time.Duration(float64(time.Second) / perSecond)
+		}
+		s.maxBatch = max(maxBatch, 1)
+	}
+}
+
+// queued is a localized message waiting for its channel.
+type queued struct {
+	ctx  context.Context
+	msg  Message
+	done chan error
+}
+
+// channelQueue holds a channel's pending messages in send order. A worker
+// drains it while it is non-empty.
+type channelQueue struct {
+	mu      sync.Mutex
+	pending []*queued
+	running bool
+	last    time.Time
+}
+
+// enqueue adds msg to the channel's queue and waits until it is sent, or
+// ctx is done. A message whose caller has gone is dropped unsent.
+func (s *Sender) enqueue(ctx context.Context, c Channel, msg Message) error {
+	s.queueMu.Lock()
+	if s.queues == nil {
+		s.queues = make(map[string]*channelQueue)
+	}
+	q, ok := s.queues[c.Name]
+	if !ok {
+		q = &channelQueue{}
+		s.queues[c.Name] = q
+	}
+	s.queueMu.Unlock()
+
+	item := &queued{ctx: ctx, msg: msg, done: make(chan error, 1)}
+	q.mu.Lock()
+	q.pending = append(q.pending, item)
+	if !q.running {
+		q.running = true
+		go s.drain(c, q)
+	}
+	q.mu.Unlock()
+
+	select {
+	case err := <-item.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drain sends q's messages, one send per interval, until it is empty.
+func (s *Sender) drain(c Channel, q *channelQueue) {
+	for {
+		q.mu.Lock()
+		wait := q.last.Add(s.interval).Sub(s.now())
+		q.mu.Unlock()
+		if wait > 0 {
+			time.Sleep(wait)
+		}
+
+		q.mu.Lock()
+		var batch []*queued
+		for len(q.pending) > 0 && len(batch) < s.maxBatch {
+			item := q.pending[0]
+			q.pending = q.pending[1:]
+			if err := item.ctx.Err(); err != nil {
+				item.done <- err
+				continue
+			}
+			batch = append(batch, item)
+		}
+		if len(batch) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		q.last = s.now()
+		q.mu.Unlock()
+
+		msgs := make([]Message, len(batch))
+		for i, item := range batch {
+			msgs[i] = item.msg
+		}
+		err := s.send(context.WithoutCancel(batch[0].ctx), c, coalesce(msgs, s.Localization(c.Name).Locale), len(msgs))
+		for _, item := range batch {
+			item.done <- err
+		}
+	}
+}
+
+// severityRank orders event severities for picking a batch's highest.
+var severityRank = map[string]int{SeverityInfo: 1, SeverityWarning: 2, SeverityCritical: 3}
+
+// coalesce combines localized messages, in order, into one. A single
+// message is returned as is.
+func coalesce(msgs []Message, locale string) Message {
+	if len(msgs) == 1 {
+		return msgs[0]
+	}
+	title, _ := translate(locale, TemplateBatched)
+	note, _ := translate(locale, "coalesced")
+	out := Message{
+		Title: fmt.Sprintf(title, len(msgs)),
+		Event: EventBatch,
+		Data:  msgs,
+	}
+	parts := make([]string, len(msgs))
+	for i, m := range msgs {
+		parts[i] = fmt.Sprintf("%d. %s\n%s", i+1, m.Title, m.Text)
+		if severityRank[m.Severity] > severityRank[out.Severity] {
+			out.Severity = m.Severity
+		}
+		if m.Level.Rank() > out.Level.Rank() {
+			out.Level = m.Level
+		}
+	}
+	out.Text = strings.Join(parts, "\n\n") + "\n\n_" + fmt.Sprintf(note, len(msgs)) + "_"
+	return out
+}
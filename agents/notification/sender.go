@@ -0,0 +1,378 @@
+package notification
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Channel kinds supported by the Sender.
+const (
+	KindTeams     = "teams"
+	KindSlack     = "slack"
+	KindWebhook   = "webhook"
+	KindEmail     = "email"
+	KindPagerDuty = "pagerduty"
+)
+
+// Channel is a named notification destination.
+type Channel struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	URL  string `json:"-"` // webhook URLs embed credentials; never serialize
+	// To lists the recipients of an email channel.
+	To []string `json:"-"`
+	// RoutingKey is a PagerDuty channel's integration key.
+	RoutingKey string `json:"-"`
+}
+
+// Message is a notification to deliver.
+type Message struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+	// Template, when set, replaces Title with the catalog entry in the
+	// channel's language, formatted with Args. Title remains the fallback
+	// for unknown templates.
+	Template string        `json:"-"`
+	Args     []interface{} `json:"-"`
+	// Time, when set, is appended as a timestamp in the channel's zone.
+	Time time.Time `json:"-"`
+	// Event, Severity and Data describe machine-readable events, such as
+	// workflow completions, for generic webhook consumers to route on.
+	// Severity also colors Teams cards.
+	Event    string      `json:"event,omitempty"`
+	Severity string      `json:"severity,omitempty"`
+	Data     interface{} `json:"data,omitempty"`
+	// Level is the shared severity the message is about, such as the
+	// highest drift found. PagerDuty channels map it with their severity
+	// mapping, and fall back to Severity without it.
+	Level protocol.Severity `json:"-"`
+}
+
+// Event severities and the Teams card colors they render with.
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+var severityColors = map[string]string{
+	SeverityCritical: "D13438",
+	SeverityWarning:  "FFB900",
+	SeverityInfo:     "0078D4",
+}
+
+// ParseChannels parses a comma-separated list of name=kind:url entries,
+// e.g. "finance=slack:https://hooks.slack.com/...,ops=teams:https://...".
+// A bare name=url entry is treated as a generic JSON webhook. Email
+// channels list ;-separated recipients instead of a URL, e.g.
+// "cab=email:cab@contoso.com;ops@contoso.com", and PagerDuty channels their
+// Events API v2 routing key, e.g. "oncall=pagerduty:R0UT1NGKEY".
+func ParseChannels(s string) ([]Channel, error) {
+	var channels []Channel
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, rest, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid channel %q (want name=kind:url)", entry)
+		}
+		kind, u := KindWebhook, rest
+		if k, after, ok := strings.Cut(rest, ":"); ok && !strings.HasPrefix(after, "//") {
+			kind, u = strings.ToLower(k), after
+		}
+		switch kind {
+		case KindTeams, KindSlack, KindWebhook:
+		case KindEmail:
+			to, err := ParseRecipients(u)
+			if err != nil {
+				return nil, fmt.Errorf("channel %q: %w", name, err)
+			}
+			channels = append(channels, Channel{Name: name, Kind: kind, To: to})
+			continue
+		case KindPagerDuty:
+			key, err := parseRoutingKey(u)
+			if err != nil {
+				return nil, fmt.Errorf("channel %q: %w", name, err)
+			}
+			channels = append(channels, Channel{Name: name, Kind: kind, URL: DefaultPagerDutyURL, RoutingKey: key})
+			continue
+		default:
+			return nil, fmt.Errorf("channel %q: unknown kind %q", name, kind)
+		}
+		if !strings.HasPrefix(u, "https://") && !strings.HasPrefix(u, "http://") {
+			return nil, fmt.Errorf("channel %q: invalid URL", name)
+		}
+		channels = append(channels, Channel{Name: name, Kind: kind, URL: u})
+	}
+	return channels, nil
+}
+
+// Sender posts messages to configured webhook and PagerDuty channels and,
+// through a GraphMailer, email channels.
+type Sender struct {
+	channels  map[string]Channel
+	client    *http.Client
+	locales   map[string]Localization
+	fallback  Localization
+	webhooks  map[string]WebhookConfig
+	mailer    *GraphMailer
+	pagerDuty protocol.SeverityMapping
+	log       *deliveryLog
+	now       func() time.Time
+
+	interval time.Duration
+	maxBatch int
+	queueMu  sync.Mutex
+	queues   map[string]*channelQueue
+}
+
+// SenderOption configures a Sender.
+type SenderOption func(*Sender)
+
+// WithLocales sets per-channel localization and the platform default used
+// for channels without one.
+func WithLocales(perChannel map[string]Localization, fallback Localization) SenderOption {
+	return func(s *Sender) {
+		s.locales = perChannel
+		s.fallback = fallback
+	}
+}
+
+// NewSender creates a Sender for the given channels.
+func NewSender(channels []Channel, opts ...SenderOption) *Sender {
+	s := &Sender{
+		channels: make(map[string]Channel, len(channels)),
+		client:   &http.Client{Timeout: 10 * time.Second},
+		fallback: DefaultLocalization,
+		log:      newDeliveryLog(DefaultDeliveryLogSize),
+		now:      time.Now,
+	}
+	for _, c := range channels {
+		s.channels[c.Name] = c
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Localization returns the language and time zone for a channel.
+func (s *Sender) Localization(channel string) Localization {
+	if s == nil {
+		return DefaultLocalization
+	}
+	if l, ok := s.locales[channel]; ok {
+		return l
+	}
+	return s.fallback
+}
+
+// Channel returns the channel with the given name.
+func (s *Sender) Channel(name string) (Channel, bool) {
+	if s == nil {
+		return Channel{}, false
+	}
+	c, ok := s.channels[name]
+	return c, ok
+}
+
+// Names returns the configured channel names in sorted order.
+func (s *Sender) Names() []string {
+	if s == nil {
+		return nil
+	}
+	names := make([]string, 0, len(s.channels))
+	for n := range s.channels {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Send delivers msg to the named channel, retrying and signing per the
+// channel's WebhookConfig. With a rate limit it waits its turn in the
+// channel's queue and may go out coalesced with others. Every delivery is
+// recorded for replay.
+func (s *Sender) Send(ctx context.Context, channel string, msg Message) error {
+	c, ok := s.Channel(channel)
+	if !ok {
+		return fmt.Errorf("channel %q is not configured", channel)
+	}
+	msg = s.Localization(channel).localize(msg)
+	if s.interval > 0 {
+		return s.enqueue(ctx, c, msg)
+	}
+	return s.send(ctx, c, msg, 1)
+}
+
+// send delivers a localized message carrying events notifications.
+func (s *Sender) send(ctx context.Context, c Channel, msg Message, events int) error {
+	payload, err := s.payload(c, msg)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal payload: %w", err)
+	}
+	d := &Delivery{ID: newDeliveryID(), Channel: c.Name, Created: s.now(), Payload: body}
+	if events > 1 {
+		d.Events = events
+	}
+	d.Attempts, err = s.deliver(ctx, c, d.ID, body, false)
+	d.Status, d.Error = deliveryStatus(err)
+	s.log.add(d)
+	return err
+}
+
+// deliver posts body to c, retrying per its WebhookConfig, and returns the
+// number of attempts made. Email channels retry with the defaults when not
+// configured, since Graph throttles bursts. A Retry-After on 429 or 503 is
+// honoured when longer than the backoff.
+func (s *Sender) deliver(ctx context.Context, c Channel, id string, body []byte, replay bool) (int, error) {
+	cfg, configured := s.webhooks[c.Name]
+	attempts, backoff := 1, time.Duration(0)
+	switch {
+	case configured:
+		attempts, backoff = cfg.MaxAttempts, time.Duration(cfg.Backoff)
+	case c.Kind == KindEmail:
+		attempts, backoff = DefaultMaxAttempts, DefaultBackoff
+	}
+
+	var err error
+	for i := 1; i <= attempts; i++ {
+		var retry bool
+		var wait time.Duration
+		retry, wait, err = s.post(ctx, c, cfg, id, body, replay)
+		if err == nil || !retry || i == attempts {
+			return i, err
+		}
+		if werr := sleepCtx(ctx, max(backoff<<(i-1), wait)); werr != nil {
+			return i, err
+		}
+	}
+	return attempts, err
+}
+
+// post makes one delivery attempt. retry reports whether the failure is
+// worth retrying (network errors, 429 and 5xx), and wait how long the
+// server asked to be left alone.
+func (s *Sender) post(ctx context.Context, c Channel, cfg WebhookConfig, id string, body []byte, replay bool) (retry bool, wait time.Duration, err error) {
+	target := c.URL
+	if c.Kind == KindEmail {
+		if s.mailer == nil {
+			return false, 0, fmt.Errorf("email channel %q: no mail driver configured", c.Name)
+		}
+		target = s.mailer.endpoint()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set(HeaderDelivery, id)
+	if c.Kind == KindEmail {
+		token, err := s.mailer.accessToken(ctx)
+		if err != nil {
+			return ctx.Err() == nil, 0, fmt.Errorf("%s: %w", c.Name, err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else {
+		for k, v := range cfg.sign(body, s.now()) {
+			req.Header.Set(k, v)
+		}
+	}
+	if replay {
+		req.Header.Set(HeaderReplay, "true")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, 0, fmt.Errorf("post to %s: %w", c.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		api := "webhook"
+		switch c.Kind {
+		case KindEmail:
+			api = "sendMail"
+		case KindPagerDuty:
+			api = "events"
+		}
+		return retry, retryAfter(resp, s.now()), fmt.Errorf("%s %s error %d: %s", c.Name, api, resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return false, 0, nil
+}
+
+// retryAfter parses a Retry-After header given in seconds or as a date.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// payload renders msg for the channel: a Graph sendMail request for email,
+// an Events API trigger for PagerDuty, the webhook format otherwise.
+func (s *Sender) payload(c Channel, msg Message) (interface{}, error) {
+	if c.Kind == KindPagerDuty {
+		return s.pagerDutyPayload(c, msg), nil
+	}
+	if c.Kind != KindEmail {
+		return payloadFor(c.Kind, msg), nil
+	}
+	if s.mailer == nil {
+		return nil, fmt.Errorf("email channel %q: no mail driver configured", c.Name)
+	}
+	return s.mailer.payload(c, msg)
+}
+
+// payloadFor renders msg in the webhook format expected by the channel kind.
+func payloadFor(kind string, msg Message) interface{} {
+	switch kind {
+	case KindTeams:
+		card := map[string]interface{}{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  msg.Title,
+			"title":    msg.Title,
+			"text":     msg.Text,
+		}
+		if color, ok := severityColors[msg.Severity]; ok {
+			card["themeColor"] = color
+		}
+		return card
+	case KindSlack:
+		return map[string]interface{}{
+			"text": fmt.Sprintf("*%s*\n%s", msg.Title, msg.Text),
+		}
+	default:
+		return msg
+	}
+}
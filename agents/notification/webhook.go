@@ -0,0 +1,267 @@
+package notification
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/auth"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/config"
+)
+
+// Headers set on signed webhook deliveries. The signature is an HMAC-SHA256
+// over "<timestamp>.<body>" in the same "sha256=<hex>" form GitHub uses, so
+// consumers can reject tampered or replayed-out-of-window requests.
+const (
+	HeaderSignature = "X-IaC-Signature-256"
+	HeaderTimestamp = "X-IaC-Timestamp"
+	HeaderDelivery  = "X-IaC-Delivery"
+	HeaderReplay    = "X-IaC-Replay"
+)
+
+// Retry defaults for channels with a WebhookConfig.
+const (
+	DefaultMaxAttempts = 3
+	DefaultBackoff     = time.Second
+)
+
+// DefaultDeliveryLogSize is how many deliveries a Sender keeps for replay.
+const DefaultDeliveryLogSize = 500
+
+// WebhookConfig is per-channel egress configuration for enterprise
+// consumers such as SIEM or audit pipelines.
+type WebhookConfig struct {
+	// Secret, when set, signs every delivery.
+	Secret string `json:"secret"`
+	// Headers are added to every delivery, e.g. a tenant or routing key.
+	Headers map[string]string `json:"headers"`
+	// MaxAttempts bounds delivery attempts; 5xx, 429 and network errors are
+	// retried with exponential Backoff.
+	MaxAttempts int      `json:"max_attempts"`
+	Backoff     Duration `json:"backoff"`
+}
+
+// Duration is a time.Duration that unmarshals from strings like "2s".
+type Duration time.Duration
+
+// UnmarshalJSON parses a Go duration string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"2s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LoadWebhookConfigs reads per-channel webhook configuration from a JSON
+// file mapping channel names to WebhookConfig, e.g.
+//
+//	{"audit": {"secret": "...", "headers": {"X-Tenant": "acme"}, "max_attempts": 5, "backoff": "2s"}}
+//
+// ${VAR} references are expanded from the environment before parsing, so
+// secrets can stay out of the file. An empty path returns no configuration.
+func LoadWebhookConfigs(path string) (map[string]WebhookConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read webhook config: %w", err)
+	}
+	var configs map[string]WebhookConfig
+	if err := json.Unmarshal(config.ExpandEnv(data), &configs); err != nil {
+		return nil, fmt.Errorf("parse webhook config: %w", err)
+	}
+	for name, c := range configs {
+		if c.MaxAttempts < 0 || c.Backoff < 0 {
+			return nil, fmt.Errorf("webhook %q: max_attempts and backoff must not be negative", name)
+		}
+		if c.MaxAttempts == 0 {
+			c.MaxAttempts = DefaultMaxAttempts
+		}
+		if c.Backoff == 0 {
+			c.Backoff = Duration(DefaultBackoff)
+		}
+		configs[name] = c
+	}
+	return configs, nil
+}
+
+// WithWebhooks sets per-channel webhook configuration. Channels without an
+// entry are sent once, unsigned.
+func WithWebhooks(configs map[string]WebhookConfig) SenderOption {
+	return func(s *Sender) {
+		s.webhooks = configs
+	}
+}
+
+// sign returns the signature headers for body.
+func (c WebhookConfig) sign(body []byte, now time.Time) map[string]string {
+	if c.Secret == "" {
+		return nil
+	}
+	ts := strconv.FormatInt(now.Unix(), 10)
+	return map[string]string{
+		HeaderTimestamp: ts,
+		HeaderSignature: auth.SignPayload(append([]byte(ts+"."), body...), c.Secret),
+	}
+}
+
+// VerifyWebhook checks a delivery's signature headers against body, for
+// consumers written in Go and for tests.
+func VerifyWebhook(body []byte, timestamp, signature, secret string) bool {
+	return auth.VerifySignature(append([]byte(timestamp+"."), body...), signature, secret)
+}
+
+// ErrDeliveryNotFound is returned by Replay for unknown or evicted
+// deliveries.
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// Delivery statuses.
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Delivery is one message sent to a channel, kept so it can be replayed.
+type Delivery struct {
+	ID       string    `json:"id"`
+	Channel  string    `json:"channel"`
+	Created  time.Time `json:"created"`
+	Status   string    `json:"status"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error,omitempty"`
+	Replays  int       `json:"replays,omitempty"`
+	// Events is how many messages were coalesced into this one.
+	Events  int             `json:"events,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// deliveryLog is a bounded in-memory record of recent deliveries.
+type deliveryLog struct {
+	mu      sync.Mutex
+	entries map[string]*Delivery
+	order   []string
+	size    int
+}
+
+func newDeliveryLog(size int) *deliveryLog {
+	if size < 1 {
+		size = DefaultDeliveryLogSize
+	}
+	return &deliveryLog{entries: make(map[string]*Delivery), size: size}
+}
+
+func (l *deliveryLog) add(d *Delivery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[d.ID] = d
+	l.order = append(l.order, d.ID)
+	for len(l.order) > l.size {
+		delete(l.entries, l.order[0])
+		l.order = l.order[1:]
+	}
+}
+
+func (l *deliveryLog) get(id string) (Delivery, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	d, ok := l.entries[id]
+	if !ok {
+		return Delivery{}, false
+	}
+	return *d, true
+}
+
+func (l *deliveryLog) update(id string, fn func(*Delivery)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if d, ok := l.entries[id]; ok {
+		fn(d)
+	}
+}
+
+// list returns deliveries oldest first, filtered by channel and status when
+// set.
+func (l *deliveryLog) list(channel, status string, since time.Time) []Delivery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]Delivery, 0, len(l.order))
+	for _, id := range l.order {
+		d := l.entries[id]
+		if (channel == "" || d.Channel == channel) && (status == "" || d.Status == status) && !d.Created.Before(since) {
+			out = append(out, *d)
+		}
+	}
+	return out
+}
+
+// Deliveries returns recent deliveries, oldest first. Empty channel or
+// status match all; since filters by creation time.
+func (s *Sender) Deliveries(channel, status string, since time.Time) []Delivery {
+	if s == nil {
+		return nil
+	}
+	return s.log.list(channel, status, since)
+}
+
+// Replay re-sends a recorded delivery with its original ID and payload, a
+// fresh signature, and the X-IaC-Replay header set.
+func (s *Sender) Replay(ctx context.Context, id string) (Delivery, error) {
+	if s == nil {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	d, ok := s.log.get(id)
+	if !ok {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	c, ok := s.Channel(d.Channel)
+	if !ok {
+		return Delivery{}, fmt.Errorf("channel %q is not configured", d.Channel)
+	}
+	attempts, err := s.deliver(ctx, c, d.ID, d.Payload, true)
+	s.log.update(id, func(rec *Delivery) {
+		rec.Replays++
+		rec.Attempts += attempts
+		rec.Status, rec.Error = deliveryStatus(err)
+	})
+	d, _ = s.log.get(id)
+	return d, err
+}
+
+func deliveryStatus(err error) (string, string) {
+	if err != nil {
+		return DeliveryFailed, err.Error()
+	}
+	return DeliveryDelivered, ""
+}
+
+// sleepCtx waits for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func newDeliveryID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -6,9 +6,15 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/exception"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/llm"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/repo"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/trend"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/triage"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/verdict"
 )
 
 // codeBlockRe strips code blocks before keyword matching.
@@ -21,7 +27,9 @@ const (
 	IntentAnalyze Intent = "analyze"
 	IntentCost    Intent = "cost"
 	IntentOps     Intent = "ops"
-	IntentHelp    Intent = "help"
+	// IntentGenerate composes new code rather than analyzing it.
+	IntentGenerate Intent = "generate"
+	IntentHelp     Intent = "help"
 )
 
 // AgentLookup returns a registered agent by ID.
@@ -30,13 +38,35 @@ type AgentLookup func(id string) (protocol.Agent, bool)
 // Agent coordinates multi-agent workflows using the registry.
 type Agent struct {
 	lookup    AgentLookup
+	sessions  *sessionStore
+	fetchRepo RepoFetchFunc
+	verdicts  verdict.Policy
 	llmClient *llm.Client
 	enableLLM bool
+	// extra holds agents added to a workflow, such as plugins.
+	extra map[Intent][]string
+	// notify publishes workflow completion events.
+	notify    CompletionNotifier
+	reportURL string
+	// triage hides snoozed and false-positive findings.
+	triage *triage.Store
+	// exceptions receives exception requests for listed findings.
+	exceptions *exception.Store
+	openIssue  IssueFunc
+	now        func() time.Time
+	// minCompliance and maxCostDelta turn a run no-go when set.
+	minCompliance int
+	maxCostDelta  float64
 }
 
 // New creates a new orchestrator Agent that looks up agents via the provided function.
 func New(lookup AgentLookup, opts ...Option) *Agent {
-	a := &Agent{lookup: lookup}
+	a := &Agent{
+		lookup:   lookup,
+		sessions: newSessionStore(defaultSessionTTL),
+		verdicts: verdict.DefaultPolicy(),
+		now:      time.Now,
+	}
 	for _, o := range opts {
 		o(a)
 	}
@@ -46,6 +76,45 @@ func New(lookup AgentLookup, opts ...Option) *Agent {
 // Option configures an orchestrator Agent.
 type Option func(*Agent)
 
+// RepoFetchFunc downloads the IaC and parameter files of a repository
+// branch. token is the caller's GitHub token, if any.
+type RepoFetchFunc func(ctx context.Context, token string, ref repo.Ref) ([]protocol.SourceFile, error)
+
+// WithRepoFetcher enables repo mode: prompts naming "repo owner/name@branch"
+// scan the whole branch, once per parameter set.
+func WithRepoFetcher(fetch RepoFetchFunc) Option {
+	return func(a *Agent) {
+		a.fetchRepo = fetch
+	}
+}
+
+// WithVerdictPolicy sets the organization's severity-to-action mapping used
+// for the overall verdict.
+func WithVerdictPolicy(p verdict.Policy) Option {
+	return func(a *Agent) {
+		a.verdicts = p
+	}
+}
+
+// WithSessionTTL sets how long code from a conversation is remembered for
+// follow-up requests.
+func WithSessionTTL(ttl time.Duration) Option {
+	return func(a *Agent) {
+		a.sessions.ttl = ttl
+	}
+}
+
+// WithWorkflowAgents adds agents to the workflow of an intent. They run
+// after the built-in agents, in the order added.
+func WithWorkflowAgents(intent Intent, ids ...string) Option {
+	return func(a *Agent) {
+		if a.extra == nil {
+			a.extra = make(map[Intent][]string)
+		}
+		a.extra[intent] = append(a.extra[intent], ids...)
+	}
+}
+
 // WithLLM enables LLM-enhanced orchestration (executive summaries).
 func WithLLM(client *llm.Client) Option {
 	return func(a *Agent) {
@@ -54,6 +123,30 @@ func WithLLM(client *llm.Client) Option {
 	}
 }
 
+// WithTriage enables triage commands ("snooze finding 3 for 14 days") and
+// applies their state to every workflow's findings.
+func WithTriage(s *triage.Store) Option {
+	return func(a *Agent) {
+		a.triage = s
+	}
+}
+
+// IssueFunc opens an issue for reviewers of an exception request in
+// repository ("owner/name", empty when the request names none) and returns
+// its URL. token is the caller's GitHub token, if any.
+type IssueFunc func(ctx context.Context, token, repository, title, body string) (string, error)
+
+// WithExceptions enables exception requests ("request exception for
+// finding 2 until 2026-12-31 because ...") that compile a listed finding,
+// its rule and the conversation into a request in s, and open an issue for
+// it with openIssue when asked to. openIssue may be nil.
+func WithExceptions(s *exception.Store, openIssue IssueFunc) Option {
+	return func(a *Agent) {
+		a.exceptions = s
+		a.openIssue = openIssue
+	}
+}
+
 func (a *Agent) ID() string { return "orchestrator" }
 
 func (a *Agent) Metadata() protocol.AgentMetadata {
@@ -75,79 +168,285 @@ func (a *Agent) Capabilities() protocol.AgentCapabilities {
 // Handle classifies intent, selects agents, and runs them in sequence.
 func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
 	prompt := protocol.PromptText(req)
+	if a.exceptions != nil && req.IaC == nil {
+		if cmd, ok := exception.ParseCommand(codeBlockRe.ReplaceAllString(prompt, "")); ok {
+			a.handleException(ctx, req, cmd, emit)
+			return nil
+		}
+	}
+	if a.triage != nil && req.IaC == nil {
+		if cmd, ok := triage.ParseCommand(codeBlockRe.ReplaceAllString(prompt, "")); ok {
+			a.handleTriage(req, cmd, emit)
+			return nil
+		}
+	}
 	intent := classifyKeywords(prompt)
-	agentIDs := agentsForIntent(intent)
+	agentIDs := a.workflow(intent)
 
 	if len(agentIDs) == 0 {
 		a.handleHelp(emit)
 		return nil
 	}
 
+	// "push to a new repo org/name" names a repository to create, not scan.
+	if ref, ok := repoRefFromPrompt(prompt); ok && a.fetchRepo != nil && req.IaC == nil && intent != IntentGenerate {
+		return a.handleRepo(ctx, req, intent, ref, agentIDs, emit)
+	}
+
+	// Carry code across turns: remember it when present, reuse it when a
+	// follow-up ("now estimate its cost") arrives without any.
+	sessionID := req.Metadata[protocol.MetaSessionID]
+	if req.IaC != nil && len(req.IaC.Resources) > 0 {
+		a.sessions.Put(sessionID, req.IaC)
+	} else if prev, ok := a.sessions.Get(sessionID); ok {
+		req.IaC = prev
+		emit.SendMessage(fmt.Sprintf("_Using the %d resource(s) from earlier in this conversation._\n\n", len(prev.Resources)))
+	}
+
+	if len(agentIDs) > 1 {
+		emit.SendMessage(fmt.Sprintf("_Running %d agents: %s_\n\n", len(agentIDs), strings.Join(agentIDs, " → ")))
+	}
+
 	// Tee emitter to capture output for executive summary
-	tee := &teeEmitter{inner: emit}
+	tee := a.newTee(emit)
+	err := a.runAgents(ctx, req, agentIDs, tee, "", 0, len(agentIDs))
+	a.publish(ctx, req, intent, "", agentIDs, tee, err)
+	if err != nil {
+		return err
+	}
+
+	protocol.ReportProgress(emit, "complete", len(agentIDs), len(agentIDs))
+	a.emitTriage(sessionID, tee, emit)
+	sum, ok := a.emitSummary(agentIDs, tee, emit)
+	refs := a.emitReferences(tee, emit)
+
+	// LLM executive summary after all agents complete
+	if a.enableLLM && a.llmClient != nil && req.Token != "" && intent == IntentAnalyze && ok {
+		a.executiveSummary(ctx, req, executiveInput(sum, tee), refs, emit)
+	}
+
+	return nil
+}
+
+// Mutates reports whether req would change state: a triage command, an
+// exception request, or a workflow one of whose agents mutates (a
+// promotion, an alert, a published repository).
+func (a *Agent) Mutates(req protocol.AgentRequest) bool {
+	prompt := protocol.PromptText(req)
+	if a.exceptions != nil && req.IaC == nil {
+		if _, ok := exception.ParseCommand(codeBlockRe.ReplaceAllString(prompt, "")); ok {
+			return true
+		}
+	}
+	if a.triage != nil && req.IaC == nil {
+		if _, ok := triage.ParseCommand(codeBlockRe.ReplaceAllString(prompt, "")); ok {
+			return true
+		}
+	}
+	for _, id := range a.workflow(classifyKeywords(prompt)) {
+		if agent, ok := a.lookup(id); ok {
+			if m, ok := agent.(protocol.Mutator); ok && m.Mutates(req) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runAgents invokes agents in order through tee. Progress is reported as
+// steps offset+i of total so callers can run several batches.
+func (a *Agent) runAgents(ctx context.Context, req protocol.AgentRequest, agentIDs []string, tee *teeEmitter, stage string, offset, total int) error {
+	emit := tee.inner
+	for i, id := range agentIDs {
+		protocol.ReportProgress(emit, stage+id, offset+i, total)
 
-	for _, id := range agentIDs {
 		// Check context before invoking each agent
 		select {
 		case <-ctx.Done():
-			emit.SendMessage(fmt.Sprintf("\n_Analysis interrupted: %v_\n", ctx.Err()))
+			emit.SendMessage(fmt.Sprintf("\n_Analysis interrupted: %v_\n", context.Cause(ctx)))
 			return ctx.Err()
 		default:
 		}
 
+		tee.agent = id
 		agent, ok := a.lookup(id)
 		if !ok {
 			msg := fmt.Sprintf("Agent `%s` is not registered.\n\n", id)
+			tee.fail(id)
 			emit.SendMessage(msg)
 			tee.captured.WriteString(msg)
 			continue
 		}
 		if err := agent.Handle(ctx, req, tee); err != nil {
 			msg := fmt.Sprintf("Agent `%s` failed: %v\n\n", id, err)
+			tee.fail(id)
 			emit.SendMessage(msg)
 			tee.captured.WriteString(msg)
 		}
 	}
+	return nil
+}
 
-	// LLM executive summary after all agents complete
-	if a.enableLLM && a.llmClient != nil && req.Token != "" && intent == IntentAnalyze {
-		a.executiveSummary(ctx, req, tee.captured.String(), emit)
+// repoRefRe matches "repo owner/name[@branch]" in a prompt.
+var repoRefRe = regexp.MustCompile(`(?i)\brepo(?:sitory)?\s+([\w.-]+/[\w.-]+(?:@[\w./-]+)?)`)
+
+func repoRefFromPrompt(prompt string) (repo.Ref, bool) {
+	m := repoRefRe.FindStringSubmatch(codeBlockRe.ReplaceAllString(prompt, ""))
+	if m == nil {
+		return repo.Ref{}, false
 	}
+	ref, err := repo.ParseRef(strings.TrimRight(m[1], ".,;:"))
+	return ref, err == nil
+}
 
+// handleRepo scans a repository branch, running the agents once for each
+// parameter set (e.g. dev.tfvars and prod.tfvars) since posture often
+// differs only in parameter values.
+func (a *Agent) handleRepo(ctx context.Context, req protocol.AgentRequest, intent Intent, ref repo.Ref, agentIDs []string, emit protocol.Emitter) error {
+	emit.SendMessage(fmt.Sprintf("## Repository Scan: `%s`\n\n", ref))
+	files, err := a.fetchRepo(ctx, req.Token, ref)
+	if err != nil {
+		emit.SendMessage(fmt.Sprintf("Could not fetch `%s`: %v\n", ref, err))
+		return nil
+	}
+	sets := repo.ParamSets(files)
+	if len(sets) == 0 {
+		emit.SendMessage("No Terraform or Bicep templates found in this branch.\n")
+		return nil
+	}
+	emit.SendMessage(fmt.Sprintf("Found %d file(s); evaluating %d parameter set(s).\n\n", len(files), len(sets)))
+
+	tee := a.newTee(emit)
+	total := len(sets) * len(agentIDs)
+	for i, set := range sets {
+		header := fmt.Sprintf("---\n\n## `%s` with `%s`\n\n", set.Template, set.Name)
+		emit.SendMessage(header)
+		tee.captured.WriteString(header)
+
+		setReq := req
+		setReq.IaC = set.Input()
+		if err := a.runAgents(ctx, setReq, agentIDs, tee, set.Name+": ", i*len(agentIDs), total); err != nil {
+			a.publish(ctx, req, intent, ref.String(), agentIDs, tee, err)
+			return err
+		}
+	}
+	a.publish(ctx, req, intent, ref.String(), agentIDs, tee, nil)
+	protocol.ReportProgress(emit, "complete", total, total)
+	a.emitTriage(req.Metadata[protocol.MetaSessionID], tee, emit)
+	sum, ok := a.emitSummary(agentIDs, tee, emit)
+	refs := a.emitReferences(tee, emit)
+
+	if a.enableLLM && a.llmClient != nil && req.Token != "" && intent == IntentAnalyze && ok {
+		a.executiveSummary(ctx, req, executiveInput(sum, tee), refs, emit)
+	}
 	return nil
 }
 
-// teeEmitter forwards all messages to the inner emitter while capturing text.
+func (a *Agent) newTee(emit protocol.Emitter) *teeEmitter {
+	return &teeEmitter{inner: emit, triage: a.triage, now: a.now()}
+}
+
+// teeEmitter forwards all messages to the inner emitter while capturing text
+// and reported findings, costs and scores. Findings hidden by triage are
+// dropped before they are forwarded or captured. References are held back so
+// the orchestrator sends one merged list instead of one per agent.
 type teeEmitter struct {
 	inner    protocol.Emitter
 	captured strings.Builder
+	findings []protocol.Finding
+	reported bool
+	// failed counts agents that failed or were not registered.
+	failed int
+	triage *triage.Store
+	now    time.Time
+	// hidden counts findings left out as snoozed or false positive.
+	hidden     int
+	references []protocol.Reference
+
+	// agent is the agent running now; runs holds what each agent reported
+	// and the chat text of those that reported nothing structured.
+	agent string
+	runs  map[string]*agentRun
+	costs []protocol.CostItem
+	// baseline is the cost before the change, when an agent reported it,
+	// and baselineCurrencies the currencies it was reported in.
+	baseline           *float64
+	baselineCurrencies map[string]bool
+	// compliance is the lowest overall compliance score reported.
+	compliance *int
 }
 
 func (t *teeEmitter) SendMessage(content string) {
 	t.inner.SendMessage(content)
 	t.captured.WriteString(content)
+	if t.agent != "" {
+		t.run(t.agent).text.WriteString(content)
+	}
+}
+func (t *teeEmitter) SendReferences(refs []protocol.Reference) {
+	t.references = append(t.references, refs...)
 }
-func (t *teeEmitter) SendReferences(refs []protocol.Reference)    { t.inner.SendReferences(refs) }
 func (t *teeEmitter) SendConfirmation(conf protocol.Confirmation) { t.inner.SendConfirmation(conf) }
 func (t *teeEmitter) SendError(msg string)                        { t.inner.SendError(msg) }
 func (t *teeEmitter) SendDone()                                   { t.inner.SendDone() }
+func (t *teeEmitter) ReportFindings(agentID string, findings []protocol.Finding) {
+	t.reported = true
+	if t.triage != nil {
+		var hidden int
+		findings, hidden = t.triage.Apply(findings, t.now)
+		t.hidden += hidden
+	}
+	t.findings = append(t.findings, findings...)
+	r := t.run(agentID)
+	r.structured = true
+	r.findings += len(findings)
+	protocol.ReportFindings(t.inner, agentID, findings)
+}
+func (t *teeEmitter) ReportCosts(agentID string, items []protocol.CostItem) {
+	t.run(agentID).structured = true
+	t.costs = append(t.costs, items...)
+	protocol.ReportCosts(t.inner, agentID, items)
+}
+func (t *teeEmitter) ReportCostBaseline(agentID string, monthly float64, currency string) {
+	if t.baseline == nil {
+		t.baseline = new(float64)
+		t.baselineCurrencies = make(map[string]bool)
+	}
+	*t.baseline += monthly
+	t.baselineCurrencies[costCurrency(currency)] = true
+	protocol.ReportCostBaseline(t.inner, agentID, monthly, currency)
+}
+func (t *teeEmitter) ReportScores(agentID string, scores map[string]int) {
+	t.run(agentID).structured = true
+	if score, ok := scores[trend.Overall]; ok && (t.compliance == nil || score < *t.compliance) {
+		t.compliance = &score
+	}
+	protocol.ReportScores(t.inner, agentID, scores)
+}
+func (t *teeEmitter) ReportProgress(p protocol.Progress) {
+	if r, ok := t.inner.(protocol.ProgressReporter); ok {
+		r.ReportProgress(p)
+	}
+}
 
-const executivePrompt = `You are a senior cloud architect reviewing a comprehensive IaC governance report. Given the combined output from policy, security, compliance, and impact analysis agents below, provide a concise executive summary:
+const executivePrompt = `You are a senior cloud architect reviewing a comprehensive IaC governance report. Given the aggregated results, findings and other output of the policy, security, compliance, and impact analysis agents below, provide a concise executive summary:
 1. Overall risk rating (Critical/High/Medium/Low) with justification
 2. Top 3 issues that need immediate attention
 3. A recommended action plan (3-5 bullet points)
 
+When a numbered References list is given, cite it inline with its numbers, e.g. [2], and do not add other links.
+
 Be decisive. Use markdown. Keep it under 150 words.`
 
-func (a *Agent) executiveSummary(ctx context.Context, req protocol.AgentRequest, agentOutput string, emit protocol.Emitter) {
+// executiveSummary streams the LLM summary of results, as rendered by
+// executiveInput, citing refs, the numbered reference list emitReferences
+// sent.
+func (a *Agent) executiveSummary(ctx context.Context, req protocol.AgentRequest, results, refs string, emit protocol.Emitter) {
 	var sb strings.Builder
-	sb.WriteString("## Agent Analysis Output\n\n")
-	// Truncate to avoid exceeding token limits
-	if len(agentOutput) > 4000 {
-		sb.WriteString(agentOutput[:4000])
-		sb.WriteString("\n... (truncated)\n")
-	} else {
-		sb.WriteString(agentOutput)
+	sb.WriteString(results)
+	if refs != "" {
+		sb.WriteString("\n## References\n\n")
+		sb.WriteString(refs)
 	}
 
 	emit.SendMessage("\n---\n\n## Executive Summary\n\n")
@@ -167,7 +466,8 @@ func (a *Agent) handleHelp(emit protocol.Emitter) {
 	emit.SendMessage("Available commands:\n\n")
 	emit.SendMessage("- **Analyze** — `analyze`, `scan`, `review`, `audit` — Runs policy, security, compliance, and impact analysis\n")
 	emit.SendMessage("- **Cost** — `cost`, `estimate`, `pricing` — Estimates monthly Azure costs\n")
-	emit.SendMessage("- **Ops** — `deploy`, `drift`, `notify` — Infrastructure operations\n\n")
+	emit.SendMessage("- **Ops** — `deploy`, `drift`, `notify` — Infrastructure operations\n")
+	emit.SendMessage("- **Generate** — `golden stack`, `scaffold` — Composes a starter Terraform stack from the approved module catalog\n\n")
 	emit.SendMessage("Include Terraform or Bicep code in a fenced block for analysis.\n")
 }
 
@@ -180,11 +480,23 @@ func agentsForIntent(intent Intent) []string {
 		return []string{"cost"}
 	case IntentOps:
 		return []string{"deploy", "drift", "notification"}
+	case IntentGenerate:
+		return []string{"module"}
 	default:
 		return nil
 	}
 }
 
+// workflow returns the agents to invoke for an intent: the built-in ones
+// followed by any added with WithWorkflowAgents.
+func (a *Agent) workflow(intent Intent) []string {
+	ids := agentsForIntent(intent)
+	if len(ids) == 0 {
+		return nil
+	}
+	return append(ids, a.extra[intent]...)
+}
+
 // classifyKeywords determines intent from prompt keywords.
 func classifyKeywords(message string) Intent {
 	msg := strings.ToLower(message)
@@ -201,7 +513,8 @@ func classifyKeywords(message string) Intent {
 	}{
 		{IntentAnalyze, []string{"scan", "audit", "review", "analyze", "security", "policy", "compliance", "vulnerability", "check", "full"}},
 		{IntentCost, []string{"cost", "price", "pricing", "estimate", "budget", "expensive", "spending"}},
-		{IntentOps, []string{"deploy", "promote", "drift", "release", "rollback", "environment", "staging", "production", "notify", "notification"}},
+		{IntentOps, []string{"deploy", "promote", "promotion", "drift", "release", "rollback", "environment", "staging", "production", "notify", "notification"}},
+		{IntentGenerate, []string{"golden stack", "scaffold", "starter", "generate"}},
 		{IntentHelp, []string{"help", "how to", "what can", "usage", "guide", "capabilities", "status", "health"}},
 	}
 
@@ -218,7 +531,7 @@ func classifyKeywords(message string) Intent {
 		}
 	}
 
-	if strings.Contains(msg, "terraform") || strings.Contains(msg, "bicep") {
+	if best.intent != IntentGenerate && (strings.Contains(msg, "terraform") || strings.Contains(msg, "bicep")) {
 		best = scored{IntentAnalyze, best.score + 2}
 	}
 
@@ -2,11 +2,23 @@ package orchestrator
 
 import (
 	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/auth"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/exception"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/repo"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/triage"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/verdict"
 )
 
 // stubAgent implements protocol.Agent for testing.
@@ -167,6 +179,7 @@ func TestClassifyKeywords(t *testing.T) {
 		{"detect drift in my environment", IntentOps},
 		{"agent status", IntentHelp},
 		{"help me", IntentHelp},
+		{"generate a terraform golden stack for a web app", IntentGenerate},
 		{"```hcl\nresource \"x\" \"y\" {}\n```", IntentAnalyze},
 	}
 	for _, tt := range tests {
@@ -177,6 +190,790 @@ func TestClassifyKeywords(t *testing.T) {
 	}
 }
 
+// iacRecorder records the IaC input it receives.
+type iacRecorder struct {
+	id  string
+	got *protocol.IaCInput
+}
+
+func (r *iacRecorder) ID() string                               { return r.id }
+func (r *iacRecorder) Metadata() protocol.AgentMetadata         { return protocol.AgentMetadata{ID: r.id} }
+func (r *iacRecorder) Capabilities() protocol.AgentCapabilities { return protocol.AgentCapabilities{} }
+func (r *iacRecorder) Handle(_ context.Context, req protocol.AgentRequest, _ protocol.Emitter) error {
+	r.got = req.IaC
+	return nil
+}
+
+func TestAgent_FollowUpReusesSessionCode(t *testing.T) {
+	cost := &iacRecorder{id: "cost"}
+	a := New(stubLookup(
+		&stubAgent{id: "policy"}, &stubAgent{id: "security"},
+		&stubAgent{id: "compliance"}, &stubAgent{id: "impact"}, cost,
+	))
+	iac := &protocol.IaCInput{
+		Format:    protocol.FormatTerraform,
+		Resources: []protocol.Resource{{Type: "azurerm_storage_account", Name: "sa"}},
+	}
+	meta := map[string]string{protocol.MetaSessionID: "thread-1"}
+
+	first := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "security scan this"}},
+		IaC:      iac,
+		Metadata: meta,
+	}
+	if err := a.Handle(context.Background(), first, &prototest.Recorder{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	followUp := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "now estimate its cost"}},
+		Metadata: meta,
+	}
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), followUp, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cost.got != iac {
+		t.Fatal("cost agent should receive the code from the previous turn")
+	}
+	if !strings.Contains(strings.Join(rec.Messages, ""), "earlier in this conversation") {
+		t.Error("expected context handoff note")
+	}
+
+	// A different session must not see the code.
+	cost.got = nil
+	other := followUp
+	other.Metadata = map[string]string{protocol.MetaSessionID: "thread-2"}
+	a.Handle(context.Background(), other, &prototest.Recorder{})
+	if cost.got != nil {
+		t.Error("code leaked across sessions")
+	}
+}
+
+func TestSessionStore_Expires(t *testing.T) {
+	s := newSessionStore(time.Minute)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+	s.Put("a", &protocol.IaCInput{})
+	if _, ok := s.Get("a"); !ok {
+		t.Fatal("expected stored session")
+	}
+	now = now.Add(2 * time.Minute)
+	if _, ok := s.Get("a"); ok {
+		t.Error("session should expire after TTL")
+	}
+}
+
+// progressRecorder records structured progress alongside messages.
+type progressRecorder struct {
+	prototest.Recorder
+	progress []protocol.Progress
+}
+
+func (r *progressRecorder) ReportProgress(p protocol.Progress) { r.progress = append(r.progress, p) }
+
+func TestAgent_ReportsProgress(t *testing.T) {
+	a := New(stubLookup(
+		&stubAgent{id: "policy"}, &stubAgent{id: "security"},
+		&stubAgent{id: "compliance"}, &stubAgent{id: "impact"},
+	))
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "analyze this"}},
+	}
+	rec := &progressRecorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rec.progress) != 5 {
+		t.Fatalf("progress events = %d, want 5", len(rec.progress))
+	}
+	if p := rec.progress[2]; p.Stage != "compliance" || p.Percent != 50 {
+		t.Errorf("progress[2] = %+v", p)
+	}
+	if last := rec.progress[4]; last.Percent != 100 {
+		t.Errorf("final progress = %+v, want 100%%", last)
+	}
+	if !strings.Contains(strings.Join(rec.Messages, ""), "Running 4 agents") {
+		t.Error("expected textual progress summary")
+	}
+}
+
+// iacCollector records every IaC input it receives.
+type iacCollector struct {
+	id   string
+	seen []*protocol.IaCInput
+}
+
+func (c *iacCollector) ID() string                               { return c.id }
+func (c *iacCollector) Metadata() protocol.AgentMetadata         { return protocol.AgentMetadata{ID: c.id} }
+func (c *iacCollector) Capabilities() protocol.AgentCapabilities { return protocol.AgentCapabilities{} }
+func (c *iacCollector) Handle(_ context.Context, req protocol.AgentRequest, _ protocol.Emitter) error {
+	c.seen = append(c.seen, req.IaC)
+	return nil
+}
+
+func TestAgent_RepoModePerParameterSet(t *testing.T) {
+	cost := &iacCollector{id: "cost"}
+	var gotRef repo.Ref
+	fetch := func(_ context.Context, token string, ref repo.Ref) ([]protocol.SourceFile, error) {
+		gotRef = ref
+		if token != "user-token" {
+			t.Errorf("token = %q, want caller token", token)
+		}
+		return []protocol.SourceFile{
+			{Path: "main.tf", Content: "resource \"azurerm_kubernetes_cluster\" \"aks\" {\n  sku_tier = var.tier\n}"},
+			{Path: "dev.tfvars", Content: `tier = "Free"`},
+			{Path: "prod.tfvars", Content: `tier = "Standard"`},
+		}, nil
+	}
+	a := New(stubLookup(cost), WithRepoFetcher(fetch))
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "estimate cost for repo org/infra@release"}},
+		Token:    "user-token",
+	}
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotRef.String() != "org/infra@release" {
+		t.Errorf("ref = %s", gotRef)
+	}
+	if len(cost.seen) != 2 {
+		t.Fatalf("cost agent runs = %d, want 2 (one per tfvars)", len(cost.seen))
+	}
+	if tier := cost.seen[1].Resources[0].Properties["sku_tier"]; tier != "Standard" {
+		t.Errorf("prod sku_tier = %v, want Standard", tier)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if !strings.Contains(combined, "with `prod.tfvars`") {
+		t.Errorf("expected per-set header, got:\n%s", combined)
+	}
+}
+
+// findingAgent reports fixed findings through the emitter.
+type findingAgent struct {
+	id       string
+	findings []protocol.Finding
+	refs     []protocol.Reference
+}
+
+func (f *findingAgent) ID() string                               { return f.id }
+func (f *findingAgent) Metadata() protocol.AgentMetadata         { return protocol.AgentMetadata{ID: f.id} }
+func (f *findingAgent) Capabilities() protocol.AgentCapabilities { return protocol.AgentCapabilities{} }
+func (f *findingAgent) Handle(_ context.Context, _ protocol.AgentRequest, emit protocol.Emitter) error {
+	protocol.ReportFindings(emit, f.id, f.findings)
+	if len(f.refs) > 0 {
+		emit.SendReferences(f.refs)
+	}
+	return nil
+}
+
+func TestAgent_MergesReferences(t *testing.T) {
+	softDelete := "https://learn.microsoft.com/azure/key-vault/general/soft-delete-overview"
+	runbook := protocol.Reference{Title: "Team runbook", URL: "https://wiki.example.com/runbook"}
+	lookup := stubLookup(
+		&findingAgent{id: "policy",
+			findings: []protocol.Finding{{RuleID: "POL-005", Severity: "high"}, {RuleID: "POL-005", Severity: "high"}},
+			refs:     []protocol.Reference{{Title: "Soft delete", URL: softDelete}, runbook}},
+		&findingAgent{id: "security",
+			findings: []protocol.Finding{{RuleID: "SEC-REC-001", Severity: "high"}, {RuleID: "SEC-005", Severity: "critical"}},
+			refs:     []protocol.Reference{{URL: strings.ToUpper(softDelete[:8]) + softDelete[8:] + "/"}, runbook}},
+		&stubAgent{id: "compliance"}, &stubAgent{id: "impact"},
+	)
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "analyze this"}}}
+
+	rec := &prototest.Recorder{}
+	if err := New(lookup).Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rec.References) != 1 {
+		t.Fatalf("expected one merged references event, got %d", len(rec.References))
+	}
+	refs := rec.References[0]
+	if len(refs) != 3 {
+		t.Fatalf("expected 3 deduplicated references, got %+v", refs)
+	}
+	if !strings.Contains(refs[0].URL, "network-security-groups") || refs[1].URL != softDelete || refs[2] != runbook {
+		t.Errorf("references out of citation order: %+v", refs)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"- `SEC-005` Overly Permissive NSG: 1 finding(s) [1]",
+		"- `POL-005` Key Vault Soft Delete: 2 finding(s) [2]",
+		"- `SEC-REC-001` Key Vault Purge Protection: 1 finding(s) [2]",
+		"2. [Azure Key Vault soft-delete overview](" + softDelete + ")",
+		"3. [Team runbook](https://wiki.example.com/runbook)",
+	} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("missing %q in:\n%s", want, combined)
+		}
+	}
+	if strings.Index(combined, "### References") < strings.Index(combined, "### Verdict") {
+		t.Error("references should follow the verdict")
+	}
+}
+
+func TestAgent_NoReferencesWithoutCitations(t *testing.T) {
+	lookup := stubLookup(
+		&findingAgent{id: "policy", findings: []protocol.Finding{{RuleID: "AZP-custom", Severity: "low"}}},
+		&stubAgent{id: "security"}, &stubAgent{id: "compliance"}, &stubAgent{id: "impact"},
+	)
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "analyze this"}}}
+	rec := &prototest.Recorder{}
+	if err := New(lookup).Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rec.References) != 0 || strings.Contains(strings.Join(rec.Messages, ""), "### References") {
+		t.Errorf("expected no references, got %+v", rec.References)
+	}
+}
+
+func TestAgent_VerdictFollowsPolicy(t *testing.T) {
+	lookup := stubLookup(
+		&findingAgent{id: "policy", findings: []protocol.Finding{{RuleID: "POL-001", Severity: "high"}}},
+		&findingAgent{id: "security", findings: []protocol.Finding{{RuleID: "SEC-003", Severity: "medium"}}},
+		&stubAgent{id: "compliance"}, &stubAgent{id: "impact"},
+	)
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "analyze this"}},
+	}
+
+	rec := &prototest.Recorder{}
+	if err := New(lookup).Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if combined := strings.Join(rec.Messages, ""); !strings.Contains(combined, "**Blocked** — 1 high finding(s).") {
+		t.Errorf("expected default block verdict, got:\n%s", combined)
+	}
+
+	relaxed, err := verdict.ParsePolicy("high=require_approval,medium=require_approval")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = &prototest.Recorder{}
+	if err := New(lookup, WithVerdictPolicy(relaxed)).Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if combined := strings.Join(rec.Messages, ""); !strings.Contains(combined, "**Approval required** — 1 high, 1 medium finding(s).") {
+		t.Errorf("expected approval verdict, got:\n%s", combined)
+	}
+}
+
+func TestAgent_WorkflowAgents(t *testing.T) {
+	lookup := stubLookup(
+		&stubAgent{id: "policy"}, &stubAgent{id: "security"},
+		&stubAgent{id: "compliance"}, &stubAgent{id: "impact"},
+		&stubAgent{id: "cost", output: "[cost-output]"},
+		&findingAgent{id: "cmdb", findings: []protocol.Finding{{RuleID: "CMDB-001", Severity: "critical"}}},
+	)
+	a := New(lookup, WithWorkflowAgents(IntentAnalyze, "cmdb"))
+
+	rec := &prototest.Recorder{}
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "analyze this"}}}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if combined := strings.Join(rec.Messages, ""); !strings.Contains(combined, "**Blocked** — 1 critical finding(s).") {
+		t.Errorf("expected plugin finding in verdict, got:\n%s", combined)
+	}
+
+	if got := a.workflow(IntentCost); len(got) != 1 || got[0] != "cost" {
+		t.Errorf("cost workflow = %v, want [cost]", got)
+	}
+	if got := a.workflow(IntentHelp); got != nil {
+		t.Errorf("help workflow = %v, want none", got)
+	}
+}
+
+func TestAgent_CompletionEvents(t *testing.T) {
+	lookup := stubLookup(
+		&findingAgent{id: "policy", findings: []protocol.Finding{{RuleID: "POL-001", Severity: "high"}}},
+		&stubAgent{id: "security"}, &stubAgent{id: "compliance"},
+		&stubAgent{id: "cost", output: "[cost-output]"},
+	)
+	events := make(chan Event, 1)
+	a := New(lookup, WithCompletionNotifier(func(_ context.Context, e Event) { events <- e }, "https://portal.example.com/reports/"))
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	run := func(prompt string) Event {
+		t.Helper()
+		req := protocol.AgentRequest{
+			Messages: []protocol.Message{{Role: "user", Content: prompt}},
+			Metadata: map[string]string{protocol.MetaJobID: "job 42"},
+		}
+		if err := a.Handle(context.Background(), req, &prototest.Recorder{}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("no completion event")
+			return Event{}
+		}
+	}
+
+	// impact is not registered, so the analysis fails but still has a verdict.
+	e := run("analyze this")
+	if e.Type != "workflow.analyze.failed" || e.Status != StatusFailed || e.Failed != 1 {
+		t.Errorf("analyze event = %+v", e)
+	}
+	if e.Verdict != verdict.ActionBlock || e.Severity != SeverityCritical || e.Counts["high"] != 1 || e.Summary != "Blocked — 1 high finding(s)." {
+		t.Errorf("analyze verdict = %+v", e)
+	}
+	if e.ReportURL != "https://portal.example.com/reports?job=job+42" || !e.Time.Equal(now) || len(e.Agents) != 4 {
+		t.Errorf("analyze event = %+v", e)
+	}
+
+	e = run("estimate the cost")
+	if e.Type != "workflow.cost.succeeded" || e.Verdict != "" || e.Severity != SeverityInfo {
+		t.Errorf("cost event = %+v", e)
+	}
+
+	// Help is not a workflow.
+	if err := a.Handle(context.Background(), protocol.AgentRequest{}, &prototest.Recorder{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event for help: %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSeverityFor(t *testing.T) {
+	tests := []struct {
+		action verdict.Action
+		status string
+		want   string
+	}{
+		{verdict.ActionBlock, StatusInterrupted, SeverityCritical},
+		{verdict.ActionRequireApproval, StatusSucceeded, SeverityWarning},
+		{verdict.ActionNotify, StatusFailed, SeverityWarning},
+		{verdict.ActionNotify, StatusSucceeded, SeverityInfo},
+		{"", StatusSucceeded, SeverityInfo},
+	}
+	for _, tt := range tests {
+		if got := severityFor(tt.action, tt.status); got != tt.want {
+			t.Errorf("severityFor(%q, %q) = %q, want %q", tt.action, tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestAgent_CostBudgetVerdict(t *testing.T) {
+	over := protocol.Finding{RuleID: "COST-001", Severity: "high", Message: "estimate $812.00 exceeds budget $500.00"}
+	lookup := stubLookup(&findingAgent{id: "cost", findings: []protocol.Finding{over}})
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "check the cost against the budget"}},
+	}
+	rec := &prototest.Recorder{}
+	if err := New(lookup).Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if combined := strings.Join(rec.Messages, ""); !strings.Contains(combined, "### Verdict\n\n**Blocked** — 1 high finding(s).") {
+		t.Errorf("expected the budget overrun to gate the verdict, got:\n%s", combined)
+	}
+}
+
 func TestAgent_ImplementsAgent(t *testing.T) {
 	var _ protocol.Agent = (*Agent)(nil)
 }
+
+// packHost is a fake agent host serving /rules/pack. corrupt makes it report
+// the wrong digest after an install.
+func packHost(t *testing.T, corrupt bool) (*httptest.Server, *[]byte) {
+	var installed []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodGet && !auth.VerifySignature(body, r.Header.Get("X-Hub-Signature-256"), "s3cret") {
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			installed = body
+		case http.MethodDelete:
+			installed = nil
+		}
+		state := analyzer.RulePackState{Version: analyzer.BuiltinPackVersion}
+		if installed != nil {
+			p, err := analyzer.LoadRulePack(installed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			state = analyzer.RulePackState{Version: p.Version, Digest: p.Digest, Pack: installed}
+			if corrupt {
+				state.Digest = "sha256:stale"
+			}
+		}
+		json.NewEncoder(w).Encode(state)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &installed
+}
+
+func TestRolloutRulePack(t *testing.T) {
+	defer analyzer.InstallRulePack(nil)
+	v1 := []byte(`{"version": "1", "disabled": ["POL-005"]}`)
+	v2 := []byte(`{"version": "2", "severities": {"POL-001": "critical"}}`)
+
+	good, goodPack := packHost(t, false)
+	targets := []PackTarget{LocalPackTarget(), HTTPPackTarget(good.URL, "s3cret", nil)}
+	res, err := RolloutRulePack(context.Background(), targets, v1)
+	if err != nil || res.Status != RolloutCompleted {
+		t.Fatalf("v1 rollout = %+v, %v", res, err)
+	}
+	if analyzer.PackDigest(*goodPack) != analyzer.PackDigest(v1) || analyzer.CurrentRulePack().Digest != analyzer.PackDigest(v1) {
+		t.Fatal("v1 not installed on every host")
+	}
+
+	bad, badPack := packHost(t, true)
+	targets = append(targets, HTTPPackTarget(bad.URL, "s3cret", nil), HTTPPackTarget("http://127.0.0.1:1", "s3cret", nil))
+	res, err = RolloutRulePack(context.Background(), targets[:3], v2)
+	if err != nil || res.Status != RolloutRolledBack {
+		t.Fatalf("v2 rollout = %+v, %v", res, err)
+	}
+	if res.Targets[0].Status != TargetRolledBack || res.Targets[1].Status != TargetRolledBack || res.Targets[2].Status != TargetFailed {
+		t.Errorf("targets = %+v", res.Targets)
+	}
+	if !strings.Contains(res.Targets[2].Error, "sha256:stale") {
+		t.Errorf("error = %q", res.Targets[2].Error)
+	}
+	if analyzer.PackDigest(*goodPack) != analyzer.PackDigest(v1) || *badPack != nil || analyzer.CurrentRulePack().Digest != analyzer.PackDigest(v1) {
+		t.Errorf("fleet not restored: local=%s good=%s bad=%s", analyzer.CurrentRulePack().Version, *goodPack, *badPack)
+	}
+
+	// An unreachable host aborts before anything changes.
+	res, _ = RolloutRulePack(context.Background(), []PackTarget{LocalPackTarget(), targets[3]}, v2)
+	if res.Status != RolloutAborted || res.Targets[0].Status != TargetSkipped || analyzer.CurrentRulePack().Version != "1" {
+		t.Errorf("aborted rollout = %+v", res)
+	}
+
+	if _, err := RolloutRulePack(context.Background(), targets, []byte(`{"version": ""}`)); err == nil {
+		t.Error("invalid pack should be rejected before rollout")
+	}
+}
+
+// mutatingAgent changes state for every request.
+type mutatingAgent struct{ stubAgent }
+
+func (m *mutatingAgent) Mutates(protocol.AgentRequest) bool { return true }
+
+func TestAgent_Mutates(t *testing.T) {
+	lookup := stubLookup(&stubAgent{id: "policy"}, &mutatingAgent{stubAgent{id: "deploy"}}, &stubAgent{id: "drift"})
+	store, err := triage.NewStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(lookup, WithTriage(store))
+	tests := map[string]bool{
+		"analyze this terraform":       false,
+		"promote to production":        true,
+		"snooze finding 1 for 14 days": true,
+		"help":                         false,
+	}
+	for prompt, want := range tests {
+		if got := a.Mutates(protocol.AgentRequest{Prompt: prompt}); got != want {
+			t.Errorf("Mutates(%q) = %v, want %v", prompt, got, want)
+		}
+	}
+}
+
+func TestAgent_TriageCommands(t *testing.T) {
+	lookup := stubLookup(
+		&findingAgent{id: "policy", findings: []protocol.Finding{
+			{RuleID: "POL-001", Severity: "high", ResourceType: "azurerm_storage_account", Resource: "sa"},
+			{RuleID: "POL-003", Severity: "medium", ResourceType: "azurerm_storage_account", Resource: "sa"},
+		}},
+		&stubAgent{id: "security"}, &stubAgent{id: "compliance"}, &stubAgent{id: "impact"},
+	)
+	store, err := triage.NewStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan Event, 10)
+	a := New(lookup, WithTriage(store), WithCompletionNotifier(func(_ context.Context, e Event) { events <- e }, ""))
+	run := func(prompt string) string {
+		t.Helper()
+		req := protocol.AgentRequest{
+			Messages: []protocol.Message{{Role: "user", Content: prompt}},
+			Metadata: map[string]string{protocol.MetaSessionID: "thread-1"},
+		}
+		rec := &prototest.Recorder{}
+		if err := a.Handle(context.Background(), req, rec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return strings.Join(rec.Messages, "")
+	}
+
+	out := run("analyze this")
+	for _, want := range []string{"| 1 | POL-001 | high | sa |", "| 2 | POL-003 | medium | sa |", "snooze finding 2 for 14 days", "**Blocked** — 1 high"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+
+	if out := run("snooze finding 1 for 14 days"); !strings.Contains(out, "Finding 1 (POL-001 on `sa`) is now snoozed until") {
+		t.Errorf("snooze reply:\n%s", out)
+	}
+	if out := run("assign finding 2 to @storage-team"); !strings.Contains(out, "is now assigned to @storage-team") {
+		t.Errorf("assign reply:\n%s", out)
+	}
+	if out := run("mark finding 7 false positive"); !strings.Contains(out, "There is no finding 7") {
+		t.Errorf("out of range reply:\n%s", out)
+	}
+
+	out = run("analyze this")
+	for _, want := range []string{"| 1 | POL-003 | medium | sa (@storage-team) |", "1 finding(s) hidden", "**Approval required** — 1 medium"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "| POL-001 |") {
+		t.Errorf("snoozed finding listed:\n%s", out)
+	}
+	// Events are published concurrently, so the two runs' may arrive in
+	// either order.
+	e := <-events
+	if e.Hidden == 0 {
+		e = <-events
+	}
+	if e.Hidden != 1 || len(e.Assignees) != 1 || e.Assignees[0] != "@storage-team" || e.Counts[protocol.SeverityHigh] != 0 {
+		t.Errorf("event after triage = %+v", e)
+	}
+
+	// Without a conversation there is nothing to refer to.
+	rec := &prototest.Recorder{}
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "snooze finding 1"}}}
+	if err := a.Handle(context.Background(), req, rec); err != nil || !strings.Contains(strings.Join(rec.Messages, ""), "No findings have been listed") {
+		t.Errorf("triage without session: %v\n%s", err, strings.Join(rec.Messages, ""))
+	}
+}
+
+func TestAgent_ExceptionRequests(t *testing.T) {
+	lookup := stubLookup(
+		&findingAgent{id: "policy", findings: []protocol.Finding{
+			{RuleID: "POL-001", Severity: "high", ResourceType: "azurerm_storage_account", Resource: "sa", Message: "HTTPS not enforced"},
+		}},
+		&stubAgent{id: "security"}, &stubAgent{id: "compliance"}, &stubAgent{id: "impact"},
+	)
+	store, _ := exception.NewStore("")
+	var issueRepo, issueBody string
+	a := New(lookup, WithExceptions(store, func(_ context.Context, _, repository, _, body string) (string, error) {
+		issueRepo, issueBody = repository, body
+		return "https://github.com/org/app/issues/9", nil
+	}))
+	a.now = func() time.Time { return time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC) }
+	run := func(messages ...string) string {
+		t.Helper()
+		req := protocol.AgentRequest{Metadata: map[string]string{protocol.MetaSessionID: "thread-1", protocol.MetaRepository: "org/app"}}
+		for i, m := range messages {
+			role := "user"
+			if i%2 == 1 {
+				role = "assistant"
+			}
+			req.Messages = append(req.Messages, protocol.Message{Role: role, Content: m})
+		}
+		rec := &prototest.Recorder{}
+		if err := a.Handle(context.Background(), req, rec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return strings.Join(rec.Messages, "")
+	}
+
+	if out := run("analyze this"); !strings.Contains(out, "| 1 | POL-001 | high | sa |") || !strings.Contains(out, "request exception for finding 2") {
+		t.Fatalf("analysis output:\n%s", out)
+	}
+	if out := run("request exception for finding 1"); !strings.Contains(out, "Say why finding 1") {
+		t.Errorf("missing justification reply:\n%s", out)
+	}
+	if out := run("request exception for finding 1 until 2025-01-01 because legacy"); !strings.Contains(out, "in the past") {
+		t.Errorf("past expiry reply:\n%s", out)
+	}
+
+	out := run("analyze this", "POL-001 flags `sa`: ```hcl\nhttps_only = false\n```", "request an exception for finding 1 for 30 days because the legacy client only speaks HTTP, and open an issue")
+	for _, want := range []string{"Exception Request EXC-001", "| Justification | the legacy client only speaks HTTP |", "| Expires | 2026-10-31 |", "issues/9"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+	r, ok := store.Get("EXC-001")
+	if !ok || r.Status != exception.StatusPending || r.Repository != "org/app" || r.Issue == "" || len(r.Conversation) != 3 || strings.Contains(r.Conversation[1].Content, "https_only") {
+		t.Errorf("request = %+v", r)
+	}
+	if issueRepo != "org/app" || !strings.Contains(issueBody, `"rule": "POL-001"`) {
+		t.Errorf("issue in %q:\n%s", issueRepo, issueBody)
+	}
+	if !a.Mutates(protocol.AgentRequest{Prompt: "request exception for finding 1 because x"}) {
+		t.Error("exception requests mutate")
+	}
+}
+
+// resultAgent reports a compliance score or a cost estimate with its
+// baseline, as the compliance and cost agents do.
+type resultAgent struct {
+	id       string
+	score    int
+	costs    []protocol.CostItem
+	baseline float64
+}
+
+func (r *resultAgent) ID() string                               { return r.id }
+func (r *resultAgent) Metadata() protocol.AgentMetadata         { return protocol.AgentMetadata{ID: r.id} }
+func (r *resultAgent) Capabilities() protocol.AgentCapabilities { return protocol.AgentCapabilities{} }
+func (r *resultAgent) Handle(_ context.Context, _ protocol.AgentRequest, emit protocol.Emitter) error {
+	if r.costs != nil {
+		protocol.ReportCosts(emit, r.id, r.costs)
+		protocol.ReportCostBaseline(emit, r.id, r.baseline, "USD")
+		return nil
+	}
+	protocol.ReportScores(emit, r.id, map[string]int{"cis": r.score + 5, "overall": r.score})
+	return nil
+}
+
+type summaryRecorder struct {
+	prototest.Recorder
+	summaries []protocol.RunSummary
+}
+
+func (r *summaryRecorder) ReportSummary(s protocol.RunSummary) { r.summaries = append(r.summaries, s) }
+
+func TestAgent_AggregatesSummary(t *testing.T) {
+	lookup := stubLookup(
+		&findingAgent{id: "policy", findings: []protocol.Finding{{RuleID: "POL-001", Severity: "medium"}, {RuleID: "POL-002", Severity: "low"}}},
+		&stubAgent{id: "security", output: "No security issues.\n"},
+		&resultAgent{id: "compliance", score: 72},
+		&resultAgent{id: "impact", costs: []protocol.CostItem{{Name: "vm", Monthly: 300}, {Name: "sa", Monthly: 50}}, baseline: 100},
+	)
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "analyze this"}}}
+
+	rec := &summaryRecorder{}
+	if err := New(lookup, WithDecisionLimits(80, 200)).Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rec.summaries) != 1 {
+		t.Fatalf("expected one summary, got %d", len(rec.summaries))
+	}
+	s := rec.summaries[0]
+	if s.Decision != protocol.DecisionNoGo || s.Action != "require_approval" || s.Total != 2 || s.Counts[protocol.SeverityMedium] != 1 {
+		t.Errorf("summary = %+v", s)
+	}
+	if s.Compliance == nil || *s.Compliance != 72 {
+		t.Errorf("compliance = %v, want 72", s.Compliance)
+	}
+	if c := s.Cost; c == nil || c.Monthly != 350 || c.Delta == nil || *c.Delta != 250 || c.Currency != "USD" {
+		t.Errorf("cost = %+v", s.Cost)
+	}
+	if len(s.Reasons) != 3 || len(s.Agents) != 4 || s.Agents[0].Findings != 2 {
+		t.Errorf("reasons = %q, agents = %+v", s.Reasons, s.Agents)
+	}
+
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"### Verdict\n\n**Approval required** — 1 medium finding(s).",
+		"| Decision | ❌ No-go — Approval required — 1 medium finding(s). Compliance score 72% is below the minimum of 80%. Monthly cost grows by 250.00 USD, over the limit of 200.00 USD. |",
+		"| Findings | 2 (1 medium, 1 low) |",
+		"| Compliance score | 72% |",
+		"| Monthly cost | 350.00 USD (+250.00 vs 100.00 current) |",
+		"| Agents | policy, security, compliance, impact |",
+	} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("missing %q in:\n%s", want, combined)
+		}
+	}
+}
+
+func TestAgent_SummaryMixedCurrencies(t *testing.T) {
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "analyze this"}}}
+	run := func(costs []protocol.CostItem) (protocol.RunSummary, string) {
+		t.Helper()
+		rec := &summaryRecorder{}
+		lookup := stubLookup(&stubAgent{id: "policy"}, &stubAgent{id: "security"}, &stubAgent{id: "compliance"},
+			&resultAgent{id: "impact", costs: costs, baseline: 100})
+		if err := New(lookup, WithDecisionLimits(0, 200)).Handle(context.Background(), req, rec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rec.summaries) != 1 {
+			t.Fatalf("expected one summary, got %d", len(rec.summaries))
+		}
+		return rec.summaries[0], strings.Join(rec.Messages, "")
+	}
+
+	// 300 USD and 50 EUR are not 350 of anything, nor 250 over the limit,
+	// so the limit is reported as not evaluated.
+	s, out := run([]protocol.CostItem{{Name: "vm", Monthly: 300}, {Name: "sa", Monthly: 50, Currency: "EUR"}})
+	if c := s.Cost; c == nil || c.Monthly != 0 || c.Currency != "" || c.Delta != nil ||
+		!reflect.DeepEqual(c.ByCurrency, map[string]float64{"USD": 300, "EUR": 50}) {
+		t.Errorf("cost = %+v", s.Cost)
+	}
+	if s.Decision != protocol.DecisionNoGo || len(s.Reasons) != 1 || s.Reasons[0] != "Cost limit not evaluated: the estimates are in mixed currencies." {
+		t.Errorf("a mixed-currency total should be flagged rather than compared, got %+v", s)
+	}
+	if want := "| Monthly cost | 50.00 EUR + 300.00 USD (mixed currencies, not summed) |"; !strings.Contains(out, want) {
+		t.Errorf("missing %q in:\n%s", want, out)
+	}
+
+	// The baseline is in USD, so a EUR estimate is not compared with it.
+	s, _ = run([]protocol.CostItem{{Name: "vm", Monthly: 300, Currency: "EUR"}, {Name: "sa", Monthly: 50, Currency: "EUR"}})
+	if c := s.Cost; c == nil || c.Monthly != 350 || c.Currency != "EUR" || c.Delta != nil || c.Current != nil {
+		t.Errorf("cost = %+v", s.Cost)
+	}
+	if s.Decision != protocol.DecisionNoGo || len(s.Reasons) != 1 || s.Reasons[0] != "Cost limit not evaluated: the current cost is not in EUR." {
+		t.Errorf("a baseline in another currency should be flagged rather than compared, got %+v", s)
+	}
+}
+
+func TestAgent_SummaryDecision(t *testing.T) {
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "analyze this"}}}
+	run := func(lookup AgentLookup) protocol.RunSummary {
+		t.Helper()
+		rec := &summaryRecorder{}
+		if err := New(lookup).Handle(context.Background(), req, rec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rec.summaries) != 1 {
+			t.Fatalf("expected one summary, got %d", len(rec.summaries))
+		}
+		return rec.summaries[0]
+	}
+
+	passing := run(stubLookup(
+		&findingAgent{id: "policy", findings: []protocol.Finding{{RuleID: "POL-001", Severity: "low"}}},
+		&stubAgent{id: "security"}, &resultAgent{id: "compliance", score: 60}, &stubAgent{id: "impact"},
+	))
+	if passing.Decision != protocol.DecisionGo || len(passing.Reasons) != 0 {
+		t.Errorf("limits are off by default, got %+v", passing)
+	}
+
+	failed := run(stubLookup(&findingAgent{id: "policy"}, &stubAgent{id: "security"}, &stubAgent{id: "compliance"}))
+	if failed.Decision != protocol.DecisionNoGo || !failed.Agents[3].Failed ||
+		len(failed.Reasons) != 1 || failed.Reasons[0] != "Agent(s) did not complete: impact." {
+		t.Errorf("an unregistered agent should make the run no-go, got %+v", failed)
+	}
+}
+
+func TestExecutiveInput(t *testing.T) {
+	tee := &teeEmitter{inner: &prototest.Recorder{}}
+	tee.agent = "security"
+	tee.SendMessage(strings.Repeat("x", maxUnstructuredText+100))
+	tee.agent = "policy"
+	tee.SendMessage("### Policy\n\nlong markdown")
+	var findings []protocol.Finding
+	for i := 0; i < maxSummaryFindings+5; i++ {
+		findings = append(findings, protocol.Finding{RuleID: "POL-001", Severity: "low", Resource: "sa"})
+	}
+	findings = append(findings, protocol.Finding{RuleID: "SEC-005", Severity: "critical", Resource: "nsg", Message: "open to the internet"})
+	tee.ReportFindings("policy", findings)
+
+	s := protocol.RunSummary{Decision: protocol.DecisionNoGo, Agents: []protocol.AgentRun{{ID: "policy"}, {ID: "security"}}}
+	got := executiveInput(s, tee)
+	for _, want := range []string{"## Aggregated Results", "## Findings\n\n- [critical] SEC-005 on nsg: open to the internet", "... and 6 more", "## security Output", "... (truncated)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "long markdown") {
+		t.Error("text of agents with structured results should be left out")
+	}
+}
@@ -0,0 +1,149 @@
+package orchestrator
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/verdict"
+)
+
+// Workflow completion statuses.
+const (
+	StatusSucceeded = "succeeded"
+	// StatusFailed means at least one agent failed or was not registered.
+	StatusFailed      = "failed"
+	StatusInterrupted = "interrupted"
+)
+
+// Event severities, derived from the verdict.
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+// notifyTimeout bounds a completion notification, which outlives the
+// request it reports on.
+const notifyTimeout = 30 * time.Second
+
+// Event describes a completed workflow.
+type Event struct {
+	// Type is "workflow.<intent>.<status>", e.g. "workflow.analyze.succeeded".
+	Type     string `json:"type"`
+	Workflow Intent `json:"workflow"`
+	Status   string `json:"status"`
+	Severity string `json:"severity"`
+	// Verdict is empty for workflows whose agents report no findings.
+	Verdict verdict.Action `json:"verdict,omitempty"`
+	// Decision is "go" or "no-go" for workflows whose agents reported
+	// structured results.
+	Decision string                    `json:"decision,omitempty"`
+	Summary  string                    `json:"summary"`
+	Counts   map[protocol.Severity]int `json:"counts"`
+	// Assignees are the owners of findings assigned through triage.
+	Assignees []string `json:"assignees,omitempty"`
+	// Hidden counts findings left out as snoozed or false positive.
+	Hidden    int       `json:"hidden,omitempty"`
+	Agents    []string  `json:"agents"`
+	Failed    int       `json:"failed_agents,omitempty"`
+	Repo      string    `json:"repo,omitempty"`
+	JobID     string    `json:"job_id,omitempty"`
+	ReportURL string    `json:"report_url,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// CompletionNotifier publishes workflow completion events. It is called in
+// its own goroutine once the agents have run, so slow channels do not hold
+// up the response.
+type CompletionNotifier func(ctx context.Context, e Event)
+
+// WithCompletionNotifier publishes an Event whenever a workflow completes.
+// reportURL, when set, links each event to the job's report as
+// <reportURL>?job=<id>.
+func WithCompletionNotifier(notify CompletionNotifier, reportURL string) Option {
+	return func(a *Agent) {
+		a.notify = notify
+		a.reportURL = strings.TrimSuffix(reportURL, "/")
+	}
+}
+
+// severityFor maps a verdict to an event severity. Failed workflows are
+// at least warnings, since their verdict may be missing findings.
+func severityFor(action verdict.Action, status string) string {
+	switch {
+	case action == verdict.ActionBlock:
+		return SeverityCritical
+	case action == verdict.ActionRequireApproval, status != StatusSucceeded:
+		return SeverityWarning
+	default:
+		return SeverityInfo
+	}
+}
+
+// publish sends the completion event for a workflow run through tee.
+// runErr is the error that ended the run early, if any.
+func (a *Agent) publish(ctx context.Context, req protocol.AgentRequest, intent Intent, repoRef string, agentIDs []string, tee *teeEmitter, runErr error) {
+	if a.notify == nil {
+		return
+	}
+	status := StatusSucceeded
+	switch {
+	case runErr != nil && (errors.Is(runErr, context.Canceled) || errors.Is(runErr, context.DeadlineExceeded)):
+		status = StatusInterrupted
+	case runErr != nil || tee.failed > 0:
+		status = StatusFailed
+	}
+	v := a.verdicts.Evaluate(tee.findings)
+	e := Event{
+		Type:     "workflow." + string(intent) + "." + status,
+		Workflow: intent,
+		Status:   status,
+		Summary:  strings.ReplaceAll(v.Summary(), "**", ""),
+		Counts:   v.Counts,
+		Agents:   agentIDs,
+		Failed:   tee.failed,
+		Repo:     repoRef,
+		JobID:    req.Metadata[protocol.MetaJobID],
+		Time:     a.now(),
+	}
+	e.Assignees = a.assignees(tee.findings)
+	e.Hidden = tee.hidden
+	if tee.reported {
+		e.Verdict = v.Action
+	} else {
+		e.Summary = "Completed without findings."
+	}
+	if sum, _, ok := a.summarize(agentIDs, tee); ok {
+		e.Decision = sum.Decision
+	}
+	e.Severity = severityFor(e.Verdict, status)
+	if a.reportURL != "" && e.JobID != "" {
+		e.ReportURL = a.reportURL + "?job=" + url.QueryEscape(e.JobID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notifyTimeout)
+	go func() {
+		defer cancel()
+		a.notify(ctx, e)
+	}()
+}
+
+// assignees returns the distinct assignees of findings, in order.
+func (a *Agent) assignees(findings []protocol.Finding) []string {
+	if a.triage == nil {
+		return nil
+	}
+	var out []string
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		if e, ok := a.triage.Get(f); ok && e.Assignee != "" && !seen[e.Assignee] {
+			seen[e.Assignee] = true
+			out = append(out, e.Assignee)
+		}
+	}
+	return out
+}
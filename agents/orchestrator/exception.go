@@ -0,0 +1,61 @@
+package orchestrator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/exception"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// handleException compiles a finding listed earlier in the conversation,
+// its rule and the conversation itself into an exception request, and
+// opens an issue for it when the command asks to.
+func (a *Agent) handleException(ctx context.Context, req protocol.AgentRequest, cmd exception.Command, emit protocol.Emitter) {
+	findings, ok := a.sessions.Findings(req.Metadata[protocol.MetaSessionID])
+	if !ok {
+		emit.SendMessage("No findings have been listed in this conversation yet. Run an analysis first, then refer to findings by their number.\n")
+		return
+	}
+	if cmd.Finding < 1 || cmd.Finding > len(findings) {
+		emit.SendMessage(fmt.Sprintf("There is no finding %d; the last analysis listed %d.\n", cmd.Finding, len(findings)))
+		return
+	}
+	if cmd.Justification == "" {
+		emit.SendMessage(fmt.Sprintf("Say why finding %d should be accepted, e.g. `request exception for finding %d for 90 days because the vendor appliance needs it`.\n", cmd.Finding, cmd.Finding))
+		return
+	}
+	expires, err := cmd.Expiry(a.now())
+	if err != nil {
+		emit.SendMessage(fmt.Sprintf("Cannot request that expiry: %v.\n", err))
+		return
+	}
+	f := findings[cmd.Finding-1]
+	r := exception.NewRequest(f, cmd, expires, req.Messages)
+	r.Repository = req.Metadata[protocol.MetaRepository]
+	r, err = a.exceptions.Submit(r)
+	if err != nil {
+		emit.SendMessage(fmt.Sprintf("The exception request for finding %d (%s on `%s`) could not be saved: %v\n", cmd.Finding, f.RuleID, f.Resource, err))
+		return
+	}
+	emit.SendMessage(fmt.Sprintf("### Exception Request %s\n\n%s\n", r.ID, r.Table()))
+	emit.SendMessage(fmt.Sprintf("_Submitted for review with %d message(s) of this conversation. Until it is approved and added to the waivers file, the finding is still reported._\n", len(r.Conversation)))
+
+	if !cmd.Issue {
+		return
+	}
+	if a.openIssue == nil {
+		emit.SendMessage("\nIssues cannot be opened from this host; share the request ID with reviewers instead.\n")
+		return
+	}
+	issue, err := a.openIssue(ctx, req.Token, r.Repository, r.Title(), r.Markdown())
+	if err != nil {
+		emit.SendMessage(fmt.Sprintf("\nThe issue could not be opened: %v\n", err))
+		return
+	}
+	if err := a.exceptions.SetIssue(r.ID, issue); err != nil {
+		emit.SendMessage(fmt.Sprintf("\nOpened %s, but it could not be recorded with the request: %v\n", issue, err))
+		return
+	}
+	emit.SendMessage(fmt.Sprintf("\nOpened an issue for reviewers: %s\n", issue))
+}
@@ -0,0 +1,76 @@
+package orchestrator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// emitReferences merges the references every agent sent with the
+// documentation of the rules behind their findings, and sends them as one
+// deduplicated copilot_references event. The streamed section lists the
+// rules with inline citation markers, so rules sharing a page share a
+// number. It returns the numbered list for the executive summary to cite,
+// or "" when there is nothing to cite.
+func (a *Agent) emitReferences(tee *teeEmitter, emit protocol.Emitter) string {
+	var cites protocol.Citations
+	var lines []string
+	for _, c := range citedRules(tee.findings) {
+		rule, ok := analyzer.LookupRule(c.id)
+		if !ok || rule.Reference.URL == "" {
+			continue
+		}
+		n := cites.Cite(rule.Reference)
+		lines = append(lines, fmt.Sprintf("- `%s` %s: %d finding(s)%s\n", c.id, rule.Title, c.count, protocol.Marker(n)))
+	}
+	cites.Add(tee.references...)
+	if cites.Len() == 0 {
+		return ""
+	}
+
+	list := cites.Markdown()
+	var sb strings.Builder
+	sb.WriteString("### References\n\n")
+	if len(lines) > 0 {
+		sb.WriteString(strings.Join(lines, ""))
+		sb.WriteString("\n")
+	}
+	sb.WriteString(list)
+	sb.WriteString("\n")
+	emit.SendMessage(sb.String())
+	emit.SendReferences(cites.References())
+	return list
+}
+
+// ruleCount is how many findings a rule produced.
+type ruleCount struct {
+	id       string
+	severity protocol.Severity
+	count    int
+}
+
+// citedRules groups findings by rule, most severe first and otherwise in
+// the order reported.
+func citedRules(findings []protocol.Finding) []ruleCount {
+	var rules []ruleCount
+	index := make(map[string]int)
+	for _, f := range findings {
+		i, ok := index[f.RuleID]
+		if !ok {
+			i = len(rules)
+			index[f.RuleID] = i
+			rules = append(rules, ruleCount{id: f.RuleID})
+		}
+		rules[i].count++
+		if f.Severity.Rank() > rules[i].severity.Rank() {
+			rules[i].severity = f.Severity
+		}
+	}
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].severity.Rank() > rules[j].severity.Rank()
+	})
+	return rules
+}
@@ -0,0 +1,203 @@
+package orchestrator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/auth"
+)
+
+// Rollout target statuses.
+const (
+	TargetInstalled      = "installed"
+	TargetFailed         = "failed"
+	TargetRolledBack     = "rolled_back"
+	TargetRollbackFailed = "rollback_failed"
+	TargetSkipped        = "skipped"
+)
+
+// Rollout outcomes.
+const (
+	RolloutCompleted  = "completed"
+	RolloutRolledBack = "rolled_back"
+	RolloutAborted    = "aborted"
+)
+
+// PackTarget is an agent host that installs rule packs.
+type PackTarget interface {
+	Name() string
+	Current(ctx context.Context) (analyzer.RulePackState, error)
+	// Install loads pack; a nil pack restores the built-in rules.
+	Install(ctx context.Context, pack []byte) error
+}
+
+// LocalPackTarget installs packs into this process.
+func LocalPackTarget() PackTarget { return localTarget{} }
+
+type localTarget struct{}
+
+func (localTarget) Name() string { return "local" }
+
+func (localTarget) Current(context.Context) (analyzer.RulePackState, error) {
+	return analyzer.CurrentRulePack(), nil
+}
+
+func (localTarget) Install(_ context.Context, pack []byte) error {
+	if pack == nil {
+		analyzer.InstallRulePack(nil)
+		return nil
+	}
+	p, err := analyzer.LoadRulePack(pack)
+	if err != nil {
+		return err
+	}
+	analyzer.InstallRulePack(p)
+	return nil
+}
+
+// HTTPPackTarget installs packs on a remote agent host through its
+// /rules/pack endpoint. Requests are signed with secret when it is set.
+func HTTPPackTarget(baseURL, secret string, client *http.Client) PackTarget {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpTarget{url: strings.TrimSuffix(baseURL, "/") + "/rules/pack", base: baseURL, secret: secret, client: client}
+}
+
+type httpTarget struct {
+	url, base, secret string
+	client            *http.Client
+}
+
+func (t *httpTarget) Name() string { return t.base }
+
+func (t *httpTarget) Current(ctx context.Context) (analyzer.RulePackState, error) {
+	var state analyzer.RulePackState
+	body, err := t.do(ctx, http.MethodGet, nil)
+	if err == nil {
+		err = json.Unmarshal(body, &state)
+	}
+	return state, err
+}
+
+func (t *httpTarget) Install(ctx context.Context, pack []byte) error {
+	method := http.MethodPut
+	if pack == nil {
+		method = http.MethodDelete
+	}
+	_, err := t.do(ctx, method, pack)
+	return err
+}
+
+func (t *httpTarget) do(ctx context.Context, method string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if method != http.MethodGet && t.secret != "" {
+		req.Header.Set("X-Hub-Signature-256", auth.SignPayload(body, t.secret))
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s %s: %s: %s", method, t.url, resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// TargetResult is one host's part in a rollout.
+type TargetResult struct {
+	Target   string `json:"target"`
+	Previous string `json:"previous_version,omitempty"`
+	Digest   string `json:"digest,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// RolloutResult is the outcome of pushing a pack to the fleet.
+type RolloutResult struct {
+	Version string         `json:"version"`
+	Digest  string         `json:"digest"`
+	Status  string         `json:"status"`
+	Targets []TargetResult `json:"targets"`
+}
+
+// RolloutRulePack pushes a rule pack to every target in order and checks
+// that each reports the pack's digest afterwards. If any target fails to
+// load it, every target already attempted is restored to its previous pack
+// and the remaining ones are skipped, so the fleet never runs mixed rules.
+// Targets whose current pack cannot be read abort the rollout before any
+// change. The error is non-nil only when the pack itself is invalid.
+func RolloutRulePack(ctx context.Context, targets []PackTarget, data []byte) (RolloutResult, error) {
+	pack, err := analyzer.LoadRulePack(data)
+	if err != nil {
+		return RolloutResult{}, err
+	}
+	res := RolloutResult{Version: pack.Version, Digest: pack.Digest, Status: RolloutCompleted}
+
+	previous := make([]analyzer.RulePackState, len(targets))
+	for i, t := range targets {
+		res.Targets = append(res.Targets, TargetResult{Target: t.Name(), Status: TargetSkipped})
+		state, err := t.Current(ctx)
+		if err != nil {
+			res.Status = RolloutAborted
+			res.Targets[i].Status, res.Targets[i].Error = TargetFailed, err.Error()
+			continue
+		}
+		previous[i] = state
+		res.Targets[i].Previous = state.Version
+	}
+	if res.Status == RolloutAborted {
+		return res, nil
+	}
+
+	for i, t := range targets {
+		err := t.Install(ctx, data)
+		if err == nil {
+			var state analyzer.RulePackState
+			state, err = t.Current(ctx)
+			res.Targets[i].Digest = state.Digest
+			if err == nil && state.Digest != pack.Digest {
+				err = fmt.Errorf("reports digest %q after install, want %q", state.Digest, pack.Digest)
+			}
+		}
+		if err == nil {
+			res.Targets[i].Status = TargetInstalled
+			continue
+		}
+		res.Status = RolloutRolledBack
+		res.Targets[i].Status, res.Targets[i].Error = TargetFailed, err.Error()
+		for j := i; j >= 0; j-- {
+			restore := []byte(previous[j].Pack)
+			if len(restore) == 0 {
+				restore = nil
+			}
+			if err := targets[j].Install(ctx, restore); err != nil {
+				res.Targets[j].Status = TargetRollbackFailed
+				res.Targets[j].Error = strings.TrimPrefix(res.Targets[j].Error+"; ", "; ") + "rollback: " + err.Error()
+				continue
+			}
+			if j < i {
+				res.Targets[j].Status = TargetRolledBack
+			}
+		}
+		break
+	}
+	return res, nil
+}
@@ -0,0 +1,122 @@
+package orchestrator
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+const (
+	defaultSessionTTL = 30 * time.Minute
+	maxSessions       = 1000
+)
+
+// sessionStore remembers the most recent IaC input per conversation so a
+// follow-up such as "now estimate its cost" can reuse it, and the findings
+// last listed so triage commands can refer to them by number.
+type sessionStore struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]sessionEntry
+}
+
+type sessionEntry struct {
+	iac      *protocol.IaCInput
+	findings []protocol.Finding
+	updated  time.Time
+}
+
+func newSessionStore(ttl time.Duration) *sessionStore {
+	return &sessionStore{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]sessionEntry),
+	}
+}
+
+// Get returns the stored IaC input for a session if it has not expired.
+func (s *sessionStore) Get(id string) (*protocol.IaCInput, bool) {
+	if id == "" {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.getLocked(id)
+	if !ok || e.iac == nil {
+		return nil, false
+	}
+	return e.iac, true
+}
+
+// Findings returns the findings last listed in a session.
+func (s *sessionStore) Findings(id string) ([]protocol.Finding, bool) {
+	if id == "" {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.getLocked(id)
+	if !ok || e.findings == nil {
+		return nil, false
+	}
+	return e.findings, true
+}
+
+func (s *sessionStore) getLocked(id string) (sessionEntry, bool) {
+	e, ok := s.entries[id]
+	if !ok || s.now().Sub(e.updated) > s.ttl {
+		delete(s.entries, id)
+		return sessionEntry{}, false
+	}
+	return e, true
+}
+
+// Put records the IaC input for a session.
+func (s *sessionStore) Put(id string, iac *protocol.IaCInput) {
+	if id == "" || iac == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, _ := s.getLocked(id)
+	e.iac = iac
+	s.putLocked(id, e)
+}
+
+// PutFindings records the findings listed in a session.
+func (s *sessionStore) PutFindings(id string, findings []protocol.Finding) {
+	if id == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, _ := s.getLocked(id)
+	e.findings = append([]protocol.Finding{}, findings...)
+	s.putLocked(id, e)
+}
+
+// putLocked stores an entry, evicting expired entries and, when full, the
+// least recently updated one.
+func (s *sessionStore) putLocked(id string, e sessionEntry) {
+	now := s.now()
+	e.updated = now
+	s.entries[id] = e
+	if len(s.entries) <= maxSessions {
+		return
+	}
+	oldestID, oldest := "", now
+	for k, e := range s.entries {
+		if now.Sub(e.updated) > s.ttl {
+			delete(s.entries, k)
+			continue
+		}
+		if e.updated.Before(oldest) {
+			oldestID, oldest = k, e.updated
+		}
+	}
+	if len(s.entries) > maxSessions && oldestID != "" {
+		delete(s.entries, oldestID)
+	}
+}
@@ -0,0 +1,256 @@
+package orchestrator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/verdict"
+)
+
+// maxSummaryFindings caps the findings the executive summary is given.
+const maxSummaryFindings = 30
+
+// maxUnstructuredText caps the chat text of each agent that reported no
+// structured results, for the executive summary.
+const maxUnstructuredText = 1500
+
+// WithDecisionLimits makes a run no-go when its overall compliance score is
+// below minCompliance or its monthly cost grows by more than maxCostDelta,
+// in addition to the verdict policy. Zero disables a limit.
+func WithDecisionLimits(minCompliance int, maxCostDelta float64) Option {
+	return func(a *Agent) {
+		a.minCompliance = minCompliance
+		a.maxCostDelta = maxCostDelta
+	}
+}
+
+// agentRun is what the tee recorded for one agent of a workflow.
+type agentRun struct {
+	findings int
+	failed   bool
+	// structured is set once the agent reports findings, costs or scores.
+	structured bool
+	text       strings.Builder
+}
+
+func (t *teeEmitter) run(id string) *agentRun {
+	if t.runs == nil {
+		t.runs = make(map[string]*agentRun)
+	}
+	r, ok := t.runs[id]
+	if !ok {
+		r = &agentRun{}
+		t.runs[id] = r
+	}
+	return r
+}
+
+func (t *teeEmitter) fail(id string) {
+	t.failed++
+	t.run(id).failed = true
+}
+
+// summarize aggregates what agentIDs reported into one result. reported is
+// false when no agent reported anything structured and none failed, as for
+// chat-only intents.
+func (a *Agent) summarize(agentIDs []string, tee *teeEmitter) (s protocol.RunSummary, v verdict.Verdict, reported bool) {
+	v = a.verdicts.Evaluate(tee.findings)
+	r := v.Report()
+	s = protocol.RunSummary{Counts: r.Counts, Total: r.Total, Compliance: tee.compliance}
+	if tee.reported {
+		s.Action = string(v.Action)
+	}
+	for _, id := range agentIDs {
+		run := tee.run(id)
+		s.Agents = append(s.Agents, protocol.AgentRun{ID: id, Findings: run.findings, Failed: run.failed})
+		reported = reported || run.structured || run.failed
+	}
+	if len(tee.costs) > 0 {
+		s.Cost = costSummary(tee)
+	}
+
+	if tee.reported && !v.Passed() {
+		s.Reasons = append(s.Reasons, strings.ReplaceAll(v.Summary(), "**", ""))
+	}
+	if tee.failed > 0 {
+		var failed []string
+		for _, run := range s.Agents {
+			if run.Failed {
+				failed = append(failed, run.ID)
+			}
+		}
+		s.Reasons = append(s.Reasons, fmt.Sprintf("Agent(s) did not complete: %s.", strings.Join(failed, ", ")))
+	}
+	if a.minCompliance > 0 && s.Compliance != nil && *s.Compliance < a.minCompliance {
+		s.Reasons = append(s.Reasons, fmt.Sprintf("Compliance score %d%% is below the minimum of %d%%.", *s.Compliance, a.minCompliance))
+	}
+	if a.maxCostDelta > 0 && s.Cost != nil {
+		switch {
+		case len(s.Cost.ByCurrency) > 0:
+			s.Reasons = append(s.Reasons, "Cost limit not evaluated: the estimates are in mixed currencies.")
+		case s.Cost.Delta == nil && tee.baseline != nil:
+			s.Reasons = append(s.Reasons, fmt.Sprintf("Cost limit not evaluated: the current cost is not in %s.", s.Cost.Currency))
+		case s.Cost.Delta != nil && *s.Cost.Delta > a.maxCostDelta:
+			s.Reasons = append(s.Reasons, fmt.Sprintf("Monthly cost grows by %.2f %s, over the limit of %.2f %s.",
+				*s.Cost.Delta, s.Cost.Currency, a.maxCostDelta, s.Cost.Currency))
+		}
+	}
+	s.Decision = protocol.DecisionGo
+	if len(s.Reasons) > 0 {
+		s.Decision = protocol.DecisionNoGo
+	}
+	return s, v, reported
+}
+
+// costCurrency returns the currency of an estimate; agents report none for
+// US dollars.
+func costCurrency(currency string) string {
+	if currency == "" {
+		return "USD"
+	}
+	return currency
+}
+
+// costSummary totals the reported costs. Costs in different currencies are
+// totalled per currency and never summed, and the baseline is compared only
+// when it is in the costs' one currency.
+func costSummary(tee *teeEmitter) *protocol.CostSummary {
+	totals := make(map[string]float64)
+	for _, item := range tee.costs {
+		totals[costCurrency(item.Currency)] += item.Monthly
+	}
+	if len(totals) > 1 {
+		return &protocol.CostSummary{ByCurrency: totals}
+	}
+	cost := &protocol.CostSummary{}
+	for currency, monthly := range totals {
+		cost.Monthly, cost.Currency = monthly, currency
+	}
+	if tee.baseline != nil && len(tee.baselineCurrencies) == 1 && tee.baselineCurrencies[cost.Currency] {
+		current, delta := *tee.baseline, cost.Monthly-*tee.baseline
+		cost.Current, cost.Delta = &current, &delta
+	}
+	return cost
+}
+
+// emitSummary renders the aggregated result of agentIDs: the verdict of
+// their findings and a table of the decision, severities, compliance score,
+// cost and agents. Intents whose agents reported nothing structured emit
+// nothing and return false.
+func (a *Agent) emitSummary(agentIDs []string, tee *teeEmitter, emit protocol.Emitter) (protocol.RunSummary, bool) {
+	s, v, ok := a.summarize(agentIDs, tee)
+	if !ok {
+		return s, false
+	}
+	var sb strings.Builder
+	if tee.reported {
+		sb.WriteString("### Verdict\n\n" + v.Summary() + "\n\n")
+	} else {
+		sb.WriteString("### Summary\n\n")
+	}
+	sb.WriteString(summaryTable(s))
+	msg := sb.String()
+	emit.SendMessage(msg)
+	tee.captured.WriteString(msg)
+	protocol.ReportSummary(emit, s)
+	return s, true
+}
+
+// summaryTable renders s as a markdown table.
+func summaryTable(s protocol.RunSummary) string {
+	var sb strings.Builder
+	sb.WriteString("| | |\n|---|---|\n")
+	decision := "✅ Go"
+	if s.Decision == protocol.DecisionNoGo {
+		decision = "❌ No-go — " + strings.Join(s.Reasons, " ")
+	}
+	fmt.Fprintf(&sb, "| Decision | %s |\n", decision)
+
+	var counts []string
+	for _, sev := range protocol.Severities {
+		if n := s.Counts[sev]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, sev))
+		}
+	}
+	findings := fmt.Sprintf("%d", s.Total)
+	if len(counts) > 0 {
+		findings += " (" + strings.Join(counts, ", ") + ")"
+	}
+	fmt.Fprintf(&sb, "| Findings | %s |\n", findings)
+
+	if s.Compliance != nil {
+		fmt.Fprintf(&sb, "| Compliance score | %d%% |\n", *s.Compliance)
+	}
+	if c := s.Cost; c != nil {
+		cost := fmt.Sprintf("%.2f %s", c.Monthly, c.Currency)
+		if c.Delta != nil {
+			cost += fmt.Sprintf(" (%+.2f vs %.2f current)", *c.Delta, *c.Current)
+		}
+		if len(c.ByCurrency) > 0 {
+			currencies := make([]string, 0, len(c.ByCurrency))
+			for currency := range c.ByCurrency {
+				currencies = append(currencies, currency)
+			}
+			sort.Strings(currencies)
+			totals := make([]string, len(currencies))
+			for i, currency := range currencies {
+				totals[i] = fmt.Sprintf("%.2f %s", c.ByCurrency[currency], currency)
+			}
+			cost = strings.Join(totals, " + ") + " (mixed currencies, not summed)"
+		}
+		fmt.Fprintf(&sb, "| Monthly cost | %s |\n", cost)
+	}
+
+	agents := make([]string, 0, len(s.Agents))
+	for _, run := range s.Agents {
+		if run.Failed {
+			agents = append(agents, run.ID+" (failed)")
+		} else {
+			agents = append(agents, run.ID)
+		}
+	}
+	fmt.Fprintf(&sb, "| Agents | %s |\n\n", strings.Join(agents, ", "))
+	return sb.String()
+}
+
+// executiveInput renders the aggregated result for the executive summary:
+// the summary table, the top findings and the chat text of agents that
+// reported nothing structured, each truncated.
+func executiveInput(s protocol.RunSummary, tee *teeEmitter) string {
+	var sb strings.Builder
+	sb.WriteString("## Aggregated Results\n\n")
+	sb.WriteString(summaryTable(s))
+
+	if len(tee.findings) > 0 {
+		sb.WriteString("## Findings\n\n")
+		findings := append([]protocol.Finding(nil), tee.findings...)
+		sort.SliceStable(findings, func(i, j int) bool {
+			return protocol.NormalizeSeverity(string(findings[i].Severity)).Rank() >
+				protocol.NormalizeSeverity(string(findings[j].Severity)).Rank()
+		})
+		for i, f := range findings {
+			if i == maxSummaryFindings {
+				fmt.Fprintf(&sb, "... and %d more\n", len(tee.findings)-maxSummaryFindings)
+				break
+			}
+			fmt.Fprintf(&sb, "- [%s] %s on %s: %s\n", f.Severity, f.RuleID, f.Resource, f.Message)
+		}
+		sb.WriteString("\n")
+	}
+
+	for _, run := range s.Agents {
+		r := tee.run(run.ID)
+		text := strings.TrimSpace(r.text.String())
+		if r.structured || text == "" {
+			continue
+		}
+		fmt.Fprintf(&sb, "## %s Output\n\n", run.ID)
+		if len(text) > maxUnstructuredText {
+			text = text[:maxUnstructuredText] + "\n... (truncated)"
+		}
+		sb.WriteString(text + "\n\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,64 @@
+package orchestrator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/triage"
+)
+
+// emitTriage numbers the run's findings, so triage commands and exception
+// requests can refer to them, and remembers them for the session.
+func (a *Agent) emitTriage(sessionID string, tee *teeEmitter, emit protocol.Emitter) {
+	if (a.triage == nil && a.exceptions == nil) || !tee.reported {
+		return
+	}
+	var sb strings.Builder
+	if len(tee.findings) > 0 {
+		sb.WriteString("### Findings\n\n| # | Rule | Severity | Resource |\n|---|------|----------|----------|\n")
+		for i, f := range tee.findings {
+			resource := f.Resource
+			if a.triage != nil {
+				if e, ok := a.triage.Get(f); ok && e.Assignee != "" {
+					resource += " (" + e.Assignee + ")"
+				}
+			}
+			fmt.Fprintf(&sb, "| %d | %s | %s | %s |\n", i+1, f.RuleID, f.Severity, resource)
+		}
+		sb.WriteString("\n")
+		if sessionID != "" && a.triage != nil {
+			sb.WriteString("_Triage by number: `snooze finding 2 for 14 days`, `assign finding 2 to @team`, `mark finding 2 false positive`, `reopen finding 2`._\n\n")
+		}
+		if sessionID != "" && a.exceptions != nil {
+			sb.WriteString("_Request an exception: `request exception for finding 2 for 90 days because <reason>`, adding `and open an issue` to notify reviewers._\n\n")
+		}
+	}
+	if tee.hidden > 0 {
+		fmt.Fprintf(&sb, "_%d finding(s) hidden: snoozed or marked false positive._\n\n", tee.hidden)
+	}
+	a.sessions.PutFindings(sessionID, tee.findings)
+	emit.SendMessage(sb.String())
+	tee.captured.WriteString(sb.String())
+}
+
+// handleTriage applies a triage command to a finding listed earlier in the
+// conversation.
+func (a *Agent) handleTriage(req protocol.AgentRequest, cmd triage.Command, emit protocol.Emitter) {
+	findings, ok := a.sessions.Findings(req.Metadata[protocol.MetaSessionID])
+	if !ok {
+		emit.SendMessage("No findings have been listed in this conversation yet. Run an analysis first, then refer to findings by their number.\n")
+		return
+	}
+	if cmd.Finding < 1 || cmd.Finding > len(findings) {
+		emit.SendMessage(fmt.Sprintf("There is no finding %d; the last analysis listed %d.\n", cmd.Finding, len(findings)))
+		return
+	}
+	f := findings[cmd.Finding-1]
+	e, err := a.triage.Update(f, cmd)
+	if err != nil {
+		emit.SendMessage(fmt.Sprintf("Finding %d (%s on `%s`) was updated but could not be saved: %v\n", cmd.Finding, f.RuleID, f.Resource, err))
+		return
+	}
+	emit.SendMessage(fmt.Sprintf("Finding %d (%s on `%s`) is now %s. Later reports and notifications reflect this.\n", cmd.Finding, f.RuleID, f.Resource, e.Describe()))
+}
@@ -4,7 +4,9 @@ package policy
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/llm"
@@ -15,6 +17,9 @@ import (
 // Agent performs policy analysis on IaC resources.
 type Agent struct {
 	rules     []analyzer.Rule
+	index     *analyzer.RuleIndex
+	source    RuleSource
+	waivers   *analyzer.Waivers
 	llmClient *llm.Client
 	enableLLM bool
 }
@@ -27,6 +32,7 @@ func New(opts ...Option) *Agent {
 	for _, o := range opts {
 		o(a)
 	}
+	a.index = analyzer.NewRuleIndex(a.rules)
 	return a
 }
 
@@ -41,6 +47,35 @@ func WithLLM(client *llm.Client) Option {
 	}
 }
 
+// WithAzurePolicies adds rules translated from Azure Policy definitions
+// (see package azpolicy) to the built-in ones.
+func WithAzurePolicies(rules []analyzer.Rule) Option {
+	return func(a *Agent) {
+		a.rules = append(a.rules, rules...)
+	}
+}
+
+// RuleSource supplies rules fetched at request time, such as the Azure
+// Policy assignments of a subscription.
+type RuleSource interface {
+	Rules(ctx context.Context) ([]analyzer.Rule, error)
+}
+
+// WithRuleSource evaluates the rules src returns alongside the others.
+func WithRuleSource(src RuleSource) Option {
+	return func(a *Agent) {
+		a.source = src
+	}
+}
+
+// WithWaivers suppresses the findings waived in a waivers file and flags
+// its expired waivers.
+func WithWaivers(w *analyzer.Waivers) Option {
+	return func(a *Agent) {
+		a.waivers = w
+	}
+}
+
 func (a *Agent) ID() string { return "policy" }
 
 func (a *Agent) Metadata() protocol.AgentMetadata {
@@ -54,34 +89,57 @@ func (a *Agent) Metadata() protocol.AgentMetadata {
 
 func (a *Agent) Capabilities() protocol.AgentCapabilities {
 	return protocol.AgentCapabilities{
-		Formats:       []protocol.SourceFormat{protocol.FormatTerraform, protocol.FormatBicep},
+		Formats:       []protocol.SourceFormat{protocol.FormatTerraform, protocol.FormatBicep, protocol.FormatARM, protocol.FormatTerraformPlan},
 		NeedsIaCInput: true,
 	}
 }
 
+// WarmUp runs the policy rules over a sample configuration. Rules a
+// RuleSource supplies are fetched per request and not warmed.
+func (a *Agent) WarmUp(ctx context.Context) error {
+	a.index.WarmUp()
+	return nil
+}
+
 // Handle runs policy rules against parsed IaC resources.
 func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
+	// A pasted Checkov/tfsec rule list without code is a bundle import.
+	if req.IaC == nil {
+		if ids := analyzer.ExtractExternalIDs(protocol.PromptText(req)); len(ids) > 0 {
+			emitImportedRules(ids, emit)
+			return nil
+		}
+	}
+	// A compliant and a non-compliant snippet ask for a new rule.
+	if blocks := parser.CodeBlocks(protocol.PromptText(req)); len(blocks) >= 2 && wantsRuleFromExamples(protocol.PromptText(req)) {
+		a.emitRuleFromExamples(protocol.PromptText(req), blocks, emit)
+		return nil
+	}
 	if !protocol.RequireIaC(req, emit, "policy") {
 		return nil
 	}
 
-	var findings []protocol.Finding
-	for _, res := range req.IaC.Resources {
-		for _, rule := range a.rules {
-			if !rule.Applies(res.Type) {
-				continue
-			}
-			if msg := rule.Check(res.Properties); msg != "" {
-				findings = append(findings, protocol.Finding{
-					RuleID:       rule.ID,
-					Severity:     rule.Severity,
-					Resource:     res.Name,
-					ResourceType: res.Type,
-					Message:      msg,
-					Remediation:  rule.Remediation,
-				})
-			}
+	index := a.index
+	if a.source != nil {
+		extra, err := a.source.Rules(ctx)
+		if err != nil {
+			emit.SendMessage(fmt.Sprintf("_Some assigned policies could not be fetched: %v_\n\n", err))
 		}
+		if len(extra) > 0 {
+			index = analyzer.NewRuleIndex(append(a.rules[:len(a.rules):len(a.rules)], extra...))
+		}
+	}
+	resources := req.IaC.Resources
+	if a.waivers != nil {
+		resources = a.waivers.Apply(resources)
+	}
+	findings := index.Run(resources)
+	findings = append(findings, analyzer.AnnotationFindings(resources, time.Now())...)
+
+	findings, skipped := analyzer.FilterSkipped(findings, resources, req.IaC.RawCode)
+	protocol.ReportFindings(emit, a.ID(), findings)
+	if refs := analyzer.References(findings); len(refs) > 0 {
+		emit.SendReferences(refs)
 	}
 
 	if len(findings) == 0 {
@@ -93,10 +151,13 @@ func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit prot
 		for _, f := range findings {
 			emit.SendMessage(fmt.Sprintf("| %s | %s | %s.%s | %s | %s |\n",
 				f.RuleID, f.Severity, parser.ShortType(f.ResourceType), f.Resource,
-				f.Message, f.Remediation))
+				f.Message+f.Confidence.Note(), f.Remediation))
 		}
 		emit.SendMessage("\n")
 	}
+	if skipped > 0 {
+		emit.SendMessage(fmt.Sprintf("_%d finding(s) suppressed by inline skip comments or waivers._\n\n", skipped))
+	}
 
 	// LLM-enhanced summary
 	if a.enableLLM && a.llmClient != nil && req.Token != "" {
@@ -106,6 +167,119 @@ func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit prot
 	return nil
 }
 
+// emitImportedRules renders how external rule IDs map onto native rules.
+func emitImportedRules(ids []string, emit protocol.Emitter) {
+	mappings, stubs := analyzer.ImportExternalRules(ids)
+	emit.SendMessage("### Imported Rule Mapping\n\n")
+	emit.SendMessage("| External ID | Source | Native Rule | Title |\n")
+	emit.SendMessage("|-------------|--------|-------------|-------|\n")
+	titles := make(map[string]string)
+	for _, r := range analyzer.AllRules() {
+		titles[r.ID] = r.Title
+	}
+	for _, m := range mappings {
+		if m.Stub {
+			emit.SendMessage(fmt.Sprintf("| %s | %s | _stub_ | No native equivalent |\n", m.ExternalID, m.Source))
+			continue
+		}
+		emit.SendMessage(fmt.Sprintf("| %s | %s | %s | %s |\n", m.ExternalID, m.Source, m.RuleID, titles[m.RuleID]))
+	}
+	emit.SendMessage(fmt.Sprintf("\n%d of %d rule(s) map to native checks", len(mappings)-len(stubs), len(mappings)))
+	if len(stubs) > 0 {
+		emit.SendMessage(fmt.Sprintf("; %d imported as stubs", len(stubs)))
+	}
+	emit.SendMessage(". Existing `#checkov:skip=` and `#tfsec:ignore:` comments are honored during scans.\n")
+}
+
+var (
+	nonCompliantRe = regexp.MustCompile(`(?i)non-?compliant|\bbad\b|violat|\bfail|\bwrong\b`)
+	severityRe     = regexp.MustCompile(`(?i)severity\s*[:=]?\s*(\w+)`)
+)
+
+func wantsRuleFromExamples(prompt string) bool {
+	return protocol.MatchesAny(strings.ToLower(prompt),
+		"rule from example", "rule from these", "generate rule", "generate a rule", "synthesize", "author a rule", "new rule", "create a rule")
+}
+
+// splitExamples picks the compliant and non-compliant snippets, using the
+// prose before each block and falling back to "compliant first".
+func splitExamples(blocks []parser.CodeBlock) (compliant, nonCompliant string) {
+	compliant, nonCompliant = blocks[0].Code, blocks[1].Code
+	for _, b := range blocks[:2] {
+		if nonCompliantRe.MatchString(b.Context) {
+			nonCompliant = b.Code
+		} else {
+			compliant = b.Code
+		}
+	}
+	if compliant == nonCompliant {
+		compliant, nonCompliant = blocks[0].Code, blocks[1].Code
+	}
+	return compliant, nonCompliant
+}
+
+// emitRuleFromExamples synthesizes a candidate rule from a compliant and a
+// non-compliant snippet, checks it against both, and renders it with a test
+// ready to paste into the analyzer package.
+func (a *Agent) emitRuleFromExamples(prompt string, blocks []parser.CodeBlock, emit protocol.Emitter) {
+	emit.SendMessage("### Generated Rule Candidate\n\n")
+	goodCode, badCode := splitExamples(blocks)
+	good, bad := parser.ParseResources(goodCode), parser.ParseResources(badCode)
+	if len(good) == 0 || len(bad) == 0 {
+		emit.SendMessage("Could not parse a resource from both examples. Paste one Terraform or Bicep resource per code block.\n")
+		return
+	}
+	cand, err := analyzer.SynthesizeRule(good[0], bad[0])
+	if err != nil {
+		emit.SendMessage(fmt.Sprintf("Could not derive a rule: %v.\n", err))
+		return
+	}
+
+	id := fmt.Sprintf("POL-%03d", len(analyzer.RulesByCategory("Policy"))+1)
+	severity := protocol.SeverityMedium
+	if m := severityRe.FindStringSubmatch(prompt); m != nil {
+		if sev, ok := protocol.ParseSeverity(m[1]); ok {
+			severity = sev
+		}
+	}
+
+	emit.SendMessage("| Field | Value |\n|-------|-------|\n")
+	emit.SendMessage(fmt.Sprintf("| Resource type | `%s` |\n", cand.ResourceType))
+	emit.SendMessage(fmt.Sprintf("| Property | `%s` |\n", cand.Property))
+	emit.SendMessage(fmt.Sprintf("| Operator | `%s` |\n", cand.Operator))
+	if cand.Operator != analyzer.OpAbsent {
+		emit.SendMessage(fmt.Sprintf("| Value | `%v` |\n", cand.Value))
+	}
+	emit.SendMessage(fmt.Sprintf("| Severity | %s |\n\n", severity))
+
+	rule := cand.Rule(id, severity)
+	results := analyzer.Controls([]analyzer.Rule{rule}, []protocol.Resource{good[0], bad[0]})
+	if len(results) == 2 && results[0].Passed && !results[1].Passed {
+		emit.SendMessage("Verified: the compliant example passes and the non-compliant example fails.\n\n")
+	} else {
+		emit.SendMessage("**Warning:** the candidate does not separate the examples; review it before use.\n\n")
+	}
+	if len(cand.Differences) > 1 {
+		emit.SendMessage("Other differences between the examples, in case the intended rule is one of these:\n\n")
+		for _, d := range cand.Differences[1:] {
+			emit.SendMessage(fmt.Sprintf("- `%s`: compliant `%v`, non-compliant `%v`\n", d.Property, orUnset(d.Compliant), orUnset(d.NonCompliant)))
+		}
+		emit.SendMessage("\n")
+	}
+
+	emit.SendMessage("Add to `policyRules()` in `internal/analyzer/rules.go`:\n\n")
+	emit.SendMessage("```go\n" + cand.GoSource(id, severity) + "\n```\n\n")
+	emit.SendMessage("Test fixture for `internal/analyzer/analyzer_test.go`:\n\n")
+	emit.SendMessage("```go\n" + cand.GoTest(id) + "\n```\n")
+}
+
+func orUnset(v interface{}) interface{} {
+	if v == nil {
+		return "(unset)"
+	}
+	return v
+}
+
 const policyPrompt = `You are a senior cloud policy engineer. Given the IaC code and deterministic policy findings below, provide:
 1. A 2-3 sentence summary of the policy posture
 2. Any additional policy concerns not caught by rules (naming conventions, tagging gaps, organizational standards)
@@ -2,9 +2,13 @@ package policy
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/azpolicy"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
@@ -23,8 +27,8 @@ func TestAgent_Capabilities(t *testing.T) {
 	if !caps.NeedsIaCInput {
 		t.Error("expected NeedsIaCInput = true")
 	}
-	if len(caps.Formats) != 2 {
-		t.Errorf("expected 2 formats, got %d", len(caps.Formats))
+	if len(caps.Formats) != 4 {
+		t.Errorf("expected 4 formats, got %d", len(caps.Formats))
 	}
 }
 
@@ -102,6 +106,239 @@ func TestAgent_NoIaC(t *testing.T) {
 	}
 }
 
+func TestAgent_CheckovSkip(t *testing.T) {
+	a := New()
+	tfCode := "resource \"azurerm_storage_account\" \"legacy\" {\n" +
+		"  #checkov:skip=CKV_AZURE_3:Legacy client needs HTTP\n" +
+		"  enable_https_traffic_only     = false\n" +
+		"  min_tls_version               = \"TLS1_2\"\n" +
+		"  allow_blob_public_access      = false\n" +
+		"}"
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{
+			{Role: "user", Content: "analyze:\n```hcl\n" + tfCode + "\n```"},
+		},
+	}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if strings.Contains(combined, "POL-001") {
+		t.Error("POL-001 should be suppressed by checkov:skip=CKV_AZURE_3")
+	}
+	if !strings.Contains(combined, "1 finding(s) suppressed") {
+		t.Errorf("expected suppression note, got:\n%s", combined)
+	}
+}
+
+func TestAgent_Annotations(t *testing.T) {
+	a := New()
+	tfCode := "# iac-gov: owner=payments exempt=POL001 until=2099-12-31 reason=\"legacy client\"\n" +
+		"resource \"azurerm_storage_account\" \"legacy\" {\n" +
+		"  # iac-gov: severity=POL-003:low exempt=POL-004 until=2020-01-01 reason=migration\n" +
+		"  # iac-gov: owner=payments until=2099-01-01\n" +
+		"  enable_https_traffic_only     = false\n" +
+		"  min_tls_version               = \"TLS1_0\"\n" +
+		"  allow_blob_public_access      = true\n" +
+		"}"
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{
+			{Role: "user", Content: "analyze:\n```hcl\n" + tfCode + "\n```"},
+		},
+	}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if strings.Contains(combined, "| POL-001 ") {
+		t.Error("POL-001 should be suppressed by its exemption")
+	}
+	if !strings.Contains(combined, "| POL-003 | low |") {
+		t.Errorf("expected POL-003 overridden to low, got:\n%s", combined)
+	}
+	if !strings.Contains(combined, "| POL-004 ") || !strings.Contains(combined, "GOV-002") {
+		t.Errorf("expired exemption should not suppress POL-004 and should be reported, got:\n%s", combined)
+	}
+	if !strings.Contains(combined, "GOV-001") || !strings.Contains(combined, "until applies only to exemptions") {
+		t.Errorf("expected invalid annotation finding, got:\n%s", combined)
+	}
+}
+
+func TestAgent_Waivers(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "waivers.json")
+	if err := os.WriteFile(file, []byte(`[{"rule": "POL-004", "resource": "azurerm_storage_account.legacy", "reason": "static site", "expires": "2020-01-01"}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	waivers, err := analyzer.LoadWaivers(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tfCode := "# policy-ignore: storage-https-required reason=legacy client expires=2099-06-01\n" +
+		"resource \"azurerm_storage_account\" \"legacy\" {\n" +
+		"  enable_https_traffic_only = false\n" +
+		"  allow_blob_public_access  = true\n" +
+		"  tags = {\n" +
+		"    \"policy-ignore\" = \"POL-003 reason=TLS 1.0 client\"\n" +
+		"  }\n" +
+		"}"
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "analyze:\n```hcl\n" + tfCode + "\n```"}},
+	}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New(WithWaivers(waivers)).Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if strings.Contains(combined, "| POL-001 ") || strings.Contains(combined, "| POL-003 ") {
+		t.Errorf("comment and tag waivers should suppress POL-001 and POL-003, got:\n%s", combined)
+	}
+	if !strings.Contains(combined, "| POL-004 ") || !strings.Contains(combined, "Exemption from POL-004 (waivers.json) expired on 2020-01-01") {
+		t.Errorf("expired file waiver should be flagged, got:\n%s", combined)
+	}
+	if !strings.Contains(combined, "2 finding(s) suppressed by inline skip comments or waivers") {
+		t.Errorf("expected suppression count, got:\n%s", combined)
+	}
+}
+
+func TestAgent_AzurePolicies(t *testing.T) {
+	bundle, err := azpolicy.Parse([]byte(`{
+  "name": "kv-purge",
+  "properties": {
+    "displayName": "Key vaults should have purge protection enabled",
+    "policyRule": {
+      "if": {"allOf": [
+        {"field": "type", "equals": "Microsoft.KeyVault/vaults"},
+        {"field": "Microsoft.KeyVault/vaults/enablePurgeProtection", "notEquals": "true"}
+      ]},
+      "then": {"effect": "audit"}
+    }
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, _ := bundle.Rules()
+	a := New(WithAzurePolicies(rules))
+	tfCode := "resource \"azurerm_key_vault\" \"kv\" {\n" +
+		"  purge_protection_enabled = false\n" +
+		"}\n" +
+		"# iac-gov: exempt=AZP-KV-PURGE until=2099-12-31 reason=\"scratch vault\"\n" +
+		"resource \"azurerm_key_vault\" \"scratch\" {\n" +
+		"  purge_protection_enabled = false\n" +
+		"}"
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "analyze:\n```hcl\n" + tfCode + "\n```"}}}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if !strings.Contains(combined, "| AZP-KV-PURGE | medium | key_vault.kv |") || strings.Contains(combined, "| AZP-KV-PURGE | medium | key_vault.scratch |") {
+		t.Errorf("expected an Azure Policy finding for kv only, got:\n%s", combined)
+	}
+}
+
+func TestAgent_ImportBundle(t *testing.T) {
+	a := New()
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{
+			{Role: "user", Content: "import our checkov rules: CKV_AZURE_3, CKV_AZURE_999"},
+		},
+	}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if !strings.Contains(combined, "| CKV_AZURE_3 | checkov | POL-001 |") {
+		t.Errorf("expected CKV_AZURE_3 mapping, got:\n%s", combined)
+	}
+	if !strings.Contains(combined, "1 imported as stubs") {
+		t.Errorf("expected stub count, got:\n%s", combined)
+	}
+}
+
 func TestAgent_ImplementsAgent(t *testing.T) {
 	var _ protocol.Agent = (*Agent)(nil)
 }
+
+func TestAgent_RuleFromExamples(t *testing.T) {
+	prompt := "Generate a rule from these examples, severity high.\n\nNon-compliant:\n```hcl\n" +
+		"resource \"azurerm_redis_cache\" \"bad\" {\n  name = \"bad\"\n  capacity = 1\n  minimum_tls_version = \"1.0\"\n}\n```\n\n" +
+		"Compliant:\n```hcl\n" +
+		"resource \"azurerm_redis_cache\" \"good\" {\n  name = \"good\"\n  capacity = 1\n  minimum_tls_version = \"1.2\"\n}\n```\n"
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: prompt}}}
+	host.ParseAndEnrich(&req)
+
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"Generated Rule Candidate",
+		"| Property | `minimum_tls_version` |",
+		"| Operator | `equals` |",
+		"| Value | `1.2` |",
+		"| Severity | high |",
+		"Verified: the compliant example passes",
+		`ID:            "POL-007"`,
+		`Expected:      "1.2"`,
+		"func TestPolicyRules_POL007(t *testing.T)",
+	} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("missing %q in:\n%s", want, combined)
+		}
+	}
+}
+
+func TestAgent_TerraformPlan(t *testing.T) {
+	plan, err := os.ReadFile("../../internal/testkit/scenarios/storage-plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := protocol.AgentRequest{Prompt: "review this plan:\n```json\n" + string(plan) + "```"}
+	host.ParseAndEnrich(&req)
+	if req.IaC == nil || req.IaC.Format != protocol.FormatTerraformPlan {
+		t.Fatalf("IaC = %+v", req.IaC)
+	}
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if strings.Contains(combined, "kubernetes_cluster") {
+		t.Errorf("destroyed resource should not be checked:\n%s", combined)
+	}
+	if !strings.Contains(combined, "key_vault") {
+		t.Errorf("expected planned resources to be checked:\n%s", combined)
+	}
+}
+
+func TestAgent_ARMTemplate(t *testing.T) {
+	tmpl, err := os.ReadFile("../../internal/testkit/scenarios/insecure-storage.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := protocol.AgentRequest{Prompt: "check this compiled bicep:\n```json\n" + string(tmpl) + "```"}
+	host.ParseAndEnrich(&req)
+	if req.IaC == nil || req.IaC.Format != protocol.FormatARM {
+		t.Fatalf("IaC = %+v", req.IaC)
+	}
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{"POL-001", "storage_account.appstore", "key_vault.app-kv"} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("missing %q:\n%s", want, combined)
+		}
+	}
+}
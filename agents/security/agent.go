@@ -3,18 +3,26 @@ package security
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/advisory"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/llm"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/scanner"
 )
 
 // Agent performs security analysis on IaC resources.
 type Agent struct {
-	rules     []analyzer.Rule
+	index     *analyzer.RuleIndex
+	scanners  []scanner.Scanner
+	feed      *advisory.Feed
+	baseline  *analyzer.Baseline
 	llmClient *llm.Client
 	enableLLM bool
 }
@@ -22,7 +30,7 @@ type Agent struct {
 // New creates a new security Agent.
 func New(opts ...Option) *Agent {
 	a := &Agent{
-		rules: analyzer.RulesByCategory("Security"),
+		index: analyzer.NewRuleIndex(analyzer.RulesByCategory("Security")),
 	}
 	for _, o := range opts {
 		o(a)
@@ -33,6 +41,30 @@ func New(opts ...Option) *Agent {
 // Option configures a security Agent.
 type Option func(*Agent)
 
+// WithScanners adds external scanners (tfsec, Checkov, Trivy) whose
+// findings are merged with the native rules when the tools are installed.
+func WithScanners(scanners ...scanner.Scanner) Option {
+	return func(a *Agent) {
+		a.scanners = append(a.scanners, scanners...)
+	}
+}
+
+// WithAdvisories checks the provider and module versions a Terraform
+// configuration allows against the feed's vulnerability advisories.
+func WithAdvisories(feed *advisory.Feed) Option {
+	return func(a *Agent) {
+		a.feed = feed
+	}
+}
+
+// WithBaseline reports only findings missing from a baseline of accepted
+// existing findings.
+func WithBaseline(b *analyzer.Baseline) Option {
+	return func(a *Agent) {
+		a.baseline = b
+	}
+}
+
 // WithLLM enables LLM-enhanced analysis.
 func WithLLM(client *llm.Client) Option {
 	return func(a *Agent) {
@@ -47,61 +79,70 @@ func (a *Agent) Metadata() protocol.AgentMetadata {
 	return protocol.AgentMetadata{
 		ID:          "security",
 		Name:        "Security Scanner",
-		Description: "Scans IaC for security vulnerabilities including hardcoded secrets, public network access, encryption, and NSG rules",
+		Description: "Scans IaC for security vulnerabilities including hardcoded secrets, exposed outputs and SAS tokens, Key Vault access policies, public network access, encryption, NSG rules, and provider and module versions with known advisories",
 		Version:     "1.0.0",
 	}
 }
 
 func (a *Agent) Capabilities() protocol.AgentCapabilities {
 	return protocol.AgentCapabilities{
-		Formats:       []protocol.SourceFormat{protocol.FormatTerraform, protocol.FormatBicep},
+		Formats:       []protocol.SourceFormat{protocol.FormatTerraform, protocol.FormatBicep, protocol.FormatARM, protocol.FormatPulumi, protocol.FormatCloudFormation},
 		NeedsIaCInput: true,
 		NeedsRawCode:  true,
 	}
 }
 
+// WarmUp runs the security rules over a sample configuration.
+func (a *Agent) WarmUp(ctx context.Context) error {
+	a.index.WarmUp()
+	return nil
+}
+
 // Handle runs security rules against parsed IaC resources.
 func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
 	if !protocol.RequireIaC(req, emit, "security") {
 		return nil
 	}
 
-	var findings []protocol.Finding
-	for _, res := range req.IaC.Resources {
-		for _, rule := range a.rules {
-			if !rule.Applies(res.Type) {
-				continue
-			}
-			// Pattern-based rules scan raw blocks
-			if rule.IsPatternRule() {
-				if violations := rule.CheckPatterns(res.RawBlock); len(violations) > 0 {
-					for _, v := range violations {
-						findings = append(findings, protocol.Finding{
-							RuleID:       rule.ID,
-							Severity:     rule.Severity,
-							Resource:     res.Name,
-							ResourceType: res.Type,
-							Message:      v,
-							Remediation:  rule.Remediation,
-						})
-					}
-				}
-				continue
-			}
-			// Property-based rules
-			if msg := rule.Check(res.Properties); msg != "" {
-				findings = append(findings, protocol.Finding{
-					RuleID:       rule.ID,
-					Severity:     rule.Severity,
-					Resource:     res.Name,
-					ResourceType: res.Type,
-					Message:      msg,
-					Remediation:  rule.Remediation,
-				})
-			}
+	// Outputs and locals are scanned with the resources: they are where
+	// secrets and SAS tokens leave a Terraform configuration.
+	resources := req.IaC.Resources
+	if req.IaC.Format == protocol.FormatTerraform {
+		resources = append(resources[:len(resources):len(resources)], parser.ParseTerraformValues(req.IaC.RawCode)...)
+	}
+	findings := a.index.Run(resources)
+
+	var scanErrs []string
+	for _, r := range scanner.Run(ctx, a.scanners, req.IaC) {
+		if r.Err != nil {
+			scanErrs = append(scanErrs, fmt.Sprintf("%s: %v", r.Scanner, r.Err))
+			continue
+		}
+		findings = scanner.Merge(findings, r.Findings)
+	}
+	if a.feed != nil && req.IaC.Format == protocol.FormatTerraform {
+		matches, err := a.feed.Check(ctx, parser.ParseTerraformDependencies(req.IaC.RawCode))
+		if err != nil {
+			scanErrs = append(scanErrs, fmt.Sprintf("advisories: %v", err))
+		}
+		for _, m := range matches {
+			findings = append(findings, m.Finding())
 		}
 	}
 
+	findings, skipped := analyzer.FilterSkipped(findings, resources, req.IaC.RawCode)
+	scope := ParseScope(req)
+	findings = scope.Filter(findings)
+	if wantsBaseline(protocol.PromptText(req)) {
+		emitBaseline(findings, emit)
+		return nil
+	}
+	findings, known := a.baseline.Filter(findings)
+	protocol.ReportFindings(emit, a.ID(), findings)
+	if refs := analyzer.References(findings); len(refs) > 0 {
+		emit.SendReferences(refs)
+	}
+
 	if len(findings) == 0 {
 		emit.SendMessage("### Security Analysis\n\nAll security checks passed.\n")
 	} else {
@@ -109,12 +150,28 @@ func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit prot
 		emit.SendMessage("| Rule | Severity | Resource | Issue | Fix |\n")
 		emit.SendMessage("|------|----------|----------|-------|-----|\n")
 		for _, f := range findings {
+			ruleID := f.RuleID
+			if f.Source != "" {
+				ruleID += " (" + f.Source + ")"
+			}
 			emit.SendMessage(fmt.Sprintf("| %s | %s | %s.%s | %s | %s |\n",
-				f.RuleID, f.Severity, parser.ShortType(f.ResourceType), f.Resource,
-				f.Message, f.Remediation))
+				ruleID, f.Severity, parser.ShortType(f.ResourceType), f.Resource,
+				f.Message+f.Confidence.Note(), f.Remediation))
 		}
 		emit.SendMessage("\n")
 	}
+	if !scope.Full() {
+		emit.SendMessage(fmt.Sprintf("_Scan scoped to %s._\n\n", scope.Describe()))
+	}
+	if skipped > 0 {
+		emit.SendMessage(fmt.Sprintf("_%d finding(s) suppressed by inline skip comments._\n\n", skipped))
+	}
+	if known > 0 {
+		emit.SendMessage(fmt.Sprintf("_%d existing finding(s) recorded in %s not reported._\n\n", known, a.baseline.Name()))
+	}
+	for _, e := range scanErrs {
+		emit.SendMessage(fmt.Sprintf("_External scanner failed — %s_\n", e))
+	}
 
 	// LLM-enhanced summary
 	if a.enableLLM && a.llmClient != nil && req.Token != "" {
@@ -124,6 +181,24 @@ func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit prot
 	return nil
 }
 
+// baselineRe matches requests to record the current findings as a
+// baseline, e.g. "create a security baseline".
+var baselineRe = regexp.MustCompile(`(?i)\b(create|generate|record|update|write)\s+(a\s+|the\s+)?(new\s+)?(security\s+|findings?\s+)?baseline\b`)
+
+func wantsBaseline(prompt string) bool {
+	return baselineRe.MatchString(prompt)
+}
+
+// emitBaseline streams findings as a baseline file to commit and load with
+// SECURITY_BASELINE_FILE. The findings are not reported: recording them
+// accepts them.
+func emitBaseline(findings []protocol.Finding, emit protocol.Emitter) {
+	data, _ := json.MarshalIndent(analyzer.NewBaseline(findings, time.Now()), "", "  ")
+	emit.SendMessage("### Security Baseline\n\n")
+	emit.SendMessage(fmt.Sprintf("Recorded %d existing finding(s). Save this as `baseline.json` and set `SECURITY_BASELINE_FILE` to report only new findings:\n\n", len(findings)))
+	emit.SendMessage("```json\n" + string(data) + "\n```\n\n")
+}
+
 const securityPrompt = `You are a senior cloud security engineer. Given the IaC code and deterministic security findings below, provide:
 1. A 2-3 sentence security posture assessment
 2. Additional security risks not caught by rules (OWASP, CIS benchmarks, zero-trust gaps)
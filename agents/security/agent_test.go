@@ -2,9 +2,15 @@ package security
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/advisory"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
@@ -73,6 +79,18 @@ func TestAgent_SecureStorage(t *testing.T) {
   account_tier             = "Standard"
   account_replication_type = "LRS"
   customer_managed_key     = {}
+  shared_access_key_enabled = false
+  network_rules {
+    default_action = "Deny"
+  }
+  blob_properties {
+    delete_retention_policy {
+      days = 7
+    }
+    container_delete_retention_policy {
+      days = 7
+    }
+  }
 }`
 	req := protocol.AgentRequest{
 		Messages: []protocol.Message{
@@ -91,6 +109,29 @@ func TestAgent_SecureStorage(t *testing.T) {
 	}
 }
 
+func TestAgent_CloudFormation(t *testing.T) {
+	tmpl, err := os.ReadFile("../../internal/testkit/scenarios/insecure-stack.cfn.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := protocol.AgentRequest{Prompt: "scan this stack:\n```yaml\n" + string(tmpl) + "```"}
+	host.ParseAndEnrich(&req)
+	if req.IaC == nil || req.IaC.Format != protocol.FormatCloudFormation {
+		t.Fatalf("IaC = %+v", req.IaC)
+	}
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if !strings.Contains(combined, "SEC-001") || !strings.Contains(combined, "OrdersDB") {
+		t.Errorf("expected hardcoded password finding on OrdersDB:\n%s", combined)
+	}
+	if strings.Contains(combined, "OrdersBucket") {
+		t.Errorf("unexpected finding on OrdersBucket:\n%s", combined)
+	}
+}
+
 func TestAgent_NoIaC(t *testing.T) {
 	a := New()
 	rec := &prototest.Recorder{}
@@ -104,6 +145,209 @@ func TestAgent_NoIaC(t *testing.T) {
 	}
 }
 
+type stubScanner struct {
+	findings []protocol.Finding
+}
+
+func (s stubScanner) Name() string    { return "tfsec" }
+func (s stubScanner) Available() bool { return true }
+func (s stubScanner) Scan(context.Context, string) ([]protocol.Finding, error) {
+	return s.findings, nil
+}
+
+func TestAgent_ExternalScanner(t *testing.T) {
+	a := New(WithScanners(stubScanner{findings: []protocol.Finding{
+		{RuleID: "azure-storage-queue-services-logging-enabled", Severity: "medium",
+			Resource: "sa", ResourceType: "azurerm_storage_account", Message: "Queue logging disabled"},
+		{RuleID: "azure-keyvault-specify-network-acl", Severity: "high",
+			Resource: "sa", ResourceType: "azurerm_storage_account", Message: "duplicate of SEC-002"},
+	}}))
+	tfCode := `resource "azurerm_storage_account" "sa" {
+  public_network_access_enabled = true
+}`
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{
+			{Role: "user", Content: "scan:\n```hcl\n" + tfCode + "\n```"},
+		},
+	}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	if !strings.Contains(combined, "azure-storage-queue-services-logging-enabled (tfsec)") {
+		t.Errorf("expected attributed external finding, got:\n%s", combined)
+	}
+	if strings.Contains(combined, "duplicate of SEC-002") {
+		t.Error("external finding duplicating SEC-002 should be dropped")
+	}
+}
+
+func TestAgent_ScopedCategories(t *testing.T) {
+	tfCode := `resource "azurerm_storage_account" "sa" {
+  public_network_access_enabled = true
+  password                      = "SuperSecret123!"
+}`
+	run := func(prompt string, meta map[string]string) string {
+		req := protocol.AgentRequest{
+			Messages: []protocol.Message{{Role: "user", Content: prompt + ":\n```hcl\n" + tfCode + "\n```"}},
+			Metadata: meta,
+		}
+		host.ParseAndEnrich(&req)
+		rec := &prototest.Recorder{}
+		if err := New().Handle(context.Background(), req, rec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return strings.Join(rec.Messages, "")
+	}
+
+	full := run("scan this", nil)
+	if !strings.Contains(full, "SEC-001") || !strings.Contains(full, "SEC-002") || strings.Contains(full, "scoped to") {
+		t.Errorf("default scan should cover all categories:\n%s", full)
+	}
+
+	only := run("check only secrets", nil)
+	if !strings.Contains(only, "SEC-001") || strings.Contains(only, "SEC-002") || !strings.Contains(only, "only secrets") {
+		t.Errorf("expected secrets-only scan:\n%s", only)
+	}
+
+	skipped := run("scan this", map[string]string{protocol.MetaSkipCategories: "secrets"})
+	if strings.Contains(skipped, "SEC-001") || !strings.Contains(skipped, "SEC-002") {
+		t.Errorf("expected secrets skipped via metadata:\n%s", skipped)
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "Only secrets and network, skip logging checks"}}}
+	s := ParseScope(req)
+	if !s.Only[CategorySecrets] || !s.Only[CategoryNetwork] || !s.Skip[CategoryLogging] {
+		t.Errorf("scope = %+v", s)
+	}
+	if s.Allows(CategoryLogging) || s.Allows(CategoryEncryption) || !s.Allows(CategoryNetwork) {
+		t.Errorf("Allows mismatch for %+v", s)
+	}
+	if got := categoryOf(protocol.Finding{RuleID: "CKV_AZURE_33", Message: "Ensure Storage logging is enabled for Queue service"}); got != CategoryLogging {
+		t.Errorf("categoryOf(CKV_AZURE_33) = %q, want logging", got)
+	}
+	if got := categoryOf(protocol.Finding{RuleID: "SEC-REC-001", Message: "Purge protection is not enabled"}); got != CategoryRecovery {
+		t.Errorf("categoryOf(SEC-REC-001) = %q, want recovery", got)
+	}
+	if s := ParseScope(protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: "only identity and backups"}}}); !s.Only[CategoryIdentity] || !s.Only[CategoryRecovery] {
+		t.Errorf("scope = %+v", s)
+	}
+}
+
 func TestAgent_ImplementsAgent(t *testing.T) {
 	var _ protocol.Agent = (*Agent)(nil)
 }
+
+func TestAgent_OutputsAndAccessPolicies(t *testing.T) {
+	data, err := os.ReadFile("../../internal/testkit/scenarios/exposed-secrets.tf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{
+			{Role: "user", Content: "scan:\n```hcl\n" + string(data) + "\n```"},
+		},
+	}
+	host.ParseAndEnrich(&req)
+	rec := &prototest.Recorder{}
+	if err := New().Handle(context.Background(), req, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	combined := strings.Join(rec.Messages, "")
+	for _, want := range []string{
+		"| SEC-006 | high | output.storage_connection_string |",
+		"| SEC-007 | high | key_vault.app | Access policy grants all secret permissions to group azuread_group.developers.object_id",
+		"| SEC-008 | high | local.upload_url |",
+	} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("missing %q in:\n%s", want, combined)
+		}
+	}
+	for _, unwanted := range []string{"output.storage_key", "output.storage_id", "local.container_url"} {
+		if strings.Contains(combined, unwanted) {
+			t.Errorf("unexpected finding for %s in:\n%s", unwanted, combined)
+		}
+	}
+}
+
+func TestAgent_Advisories(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "advisories.json")
+	feed := `{"id": "ORG-2026-1", "summary": "Leaks client secrets in plan output",
+  "affected": [{"package": {"ecosystem": "Terraform", "name": "hashicorp/azurerm"},
+    "ranges": [{"type": "SEMVER", "events": [{"introduced": "3.0.0"}, {"fixed": "3.8.0"}]}]}],
+  "database_specific": {"severity": "HIGH"}}`
+	if err := os.WriteFile(path, []byte(feed), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := advisory.LoadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := New(WithAdvisories(advisory.NewFeed(time.Hour, file)))
+	tfCode := `terraform {
+  required_providers {
+    azurerm = {
+      source  = "hashicorp/azurerm"
+      version = "~> 3.2"
+    }
+  }
+}
+
+resource "azurerm_resource_group" "rg" {
+  name     = "rg"
+  location = "eastus"
+}`
+	for prompt, want := range map[string]bool{"scan": true, "scan, skip cves": false} {
+		req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: prompt + ":\n```hcl\n" + tfCode + "\n```"}}}
+		host.ParseAndEnrich(&req)
+		rec := &prototest.Recorder{}
+		if err := a.Handle(context.Background(), req, rec); err != nil {
+			t.Fatal(err)
+		}
+		combined := strings.Join(rec.Messages, "")
+		if got := strings.Contains(combined, "ORG-2026-1") && strings.Contains(combined, "Upgrade to 3.8.0"); got != want {
+			t.Errorf("%q: advisory reported = %v, want %v:\n%s", prompt, got, want, combined)
+		}
+	}
+}
+
+func TestAgent_Baseline(t *testing.T) {
+	code := `resource "azurerm_storage_account" "legacy" {
+  name = "legacy"
+}`
+	scan := func(a *Agent, prompt, code string) string {
+		req := protocol.AgentRequest{Messages: []protocol.Message{{Role: "user", Content: prompt + ":\n```hcl\n" + code + "\n```"}}}
+		host.ParseAndEnrich(&req)
+		rec := &prototest.Recorder{}
+		if err := a.Handle(context.Background(), req, rec); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return strings.Join(rec.Messages, "")
+	}
+
+	out := scan(New(), "create a security baseline", code)
+	start, end := strings.Index(out, "```json\n"), strings.LastIndex(out, "\n```")
+	if start < 0 || end < start || strings.Contains(out, "| Rule |") {
+		t.Fatalf("expected only a baseline file, got:\n%s", out)
+	}
+	baseline, err := analyzer.ParseBaseline([]byte(out[start+len("```json\n") : end]))
+	if err != nil || baseline.Len() == 0 {
+		t.Fatalf("baseline = %+v, %v", baseline, err)
+	}
+
+	a := New(WithBaseline(baseline))
+	out = scan(a, "scan", code)
+	if !strings.Contains(out, "All security checks passed.") || !strings.Contains(out, fmt.Sprintf("_%d existing finding(s) recorded in baseline not reported._", baseline.Len())) {
+		t.Errorf("recorded findings should not be reported:\n%s", out)
+	}
+	out = scan(a, "scan", code+"\n"+`resource "azurerm_storage_account" "added" {
+  name = "added"
+}`)
+	if !strings.Contains(out, "storage_account.added") || strings.Contains(out, "storage_account.legacy") {
+		t.Errorf("only the new resource should be reported:\n%s", out)
+	}
+}
@@ -0,0 +1,170 @@
+package security
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Check categories a scan can be scoped to.
+const (
+	CategorySecrets    = "secrets"
+	CategoryNetwork    = "network"
+	CategoryEncryption = "encryption"
+	CategoryLogging    = "logging"
+	CategoryIdentity   = "identity"
+	// CategoryRecovery holds soft delete, purge protection and backup
+	// checks.
+	CategoryRecovery = "recovery"
+	// CategoryDependencies holds advisories against provider and module
+	// versions.
+	CategoryDependencies = "dependencies"
+	CategoryOther        = "other"
+)
+
+// nativeCategories assigns native security rules written in Go to
+// categories; catalog rules are filed by their group.
+var nativeCategories = map[string]string{
+	"SEC-001": CategorySecrets,
+	"SEC-002": CategoryNetwork,
+	"SEC-004": CategoryEncryption,
+	"SEC-005": CategoryNetwork,
+	"SEC-006": CategorySecrets,
+	"SEC-007": CategorySecrets,
+	"SEC-008": CategorySecrets,
+	"SEC-009": CategorySecrets,
+	"SEC-010": CategorySecrets,
+}
+
+// categoryAliases maps words users type to categories.
+var categoryAliases = map[string]string{
+	"secret": CategorySecrets, "secrets": CategorySecrets, "credential": CategorySecrets, "credentials": CategorySecrets,
+	"network": CategoryNetwork, "networking": CategoryNetwork, "nsg": CategoryNetwork, "firewall": CategoryNetwork,
+	"encryption": CategoryEncryption, "encrypt": CategoryEncryption, "tls": CategoryEncryption, "https": CategoryEncryption,
+	"logging": CategoryLogging, "logs": CategoryLogging, "log": CategoryLogging, "diagnostics": CategoryLogging, "auditing": CategoryLogging,
+	"identity": CategoryIdentity, "iam": CategoryIdentity, "auth": CategoryIdentity, "authentication": CategoryIdentity,
+	"recovery": CategoryRecovery, "backup": CategoryRecovery, "backups": CategoryRecovery, "resilience": CategoryRecovery,
+	"dependencies": CategoryDependencies, "dependency": CategoryDependencies, "cve": CategoryDependencies, "cves": CategoryDependencies, "advisories": CategoryDependencies,
+}
+
+var (
+	onlyRe = regexp.MustCompile(`\b(?:only|just)\s+(?:the\s+)?([a-z]+(?:\s*(?:,|and|&)\s*[a-z]+)*)`)
+	skipRe = regexp.MustCompile(`\b(?:skip|skipping|exclude|excluding|without|ignore|ignoring)\s+(?:the\s+)?([a-z]+(?:\s*(?:,|and|&)\s*[a-z]+)*)`)
+	listRe = regexp.MustCompile(`\s*(?:,|\band\b|&)\s*`)
+)
+
+// Scope limits which check categories are reported. The zero value
+// reports everything.
+type Scope struct {
+	Only map[string]bool
+	Skip map[string]bool
+}
+
+// ParseScope reads category filters from the request metadata
+// (protocol.MetaCategories / MetaSkipCategories) and from phrases such as
+// "only secrets" or "skip logging checks" in the prompt.
+func ParseScope(req protocol.AgentRequest) Scope {
+	s := Scope{Only: map[string]bool{}, Skip: map[string]bool{}}
+	addCategories(s.Only, strings.Split(req.Metadata[protocol.MetaCategories], ","))
+	addCategories(s.Skip, strings.Split(req.Metadata[protocol.MetaSkipCategories], ","))
+
+	prompt := strings.ToLower(protocol.PromptText(req))
+	for _, m := range onlyRe.FindAllStringSubmatch(prompt, -1) {
+		addCategories(s.Only, listRe.Split(m[1], -1))
+	}
+	for _, m := range skipRe.FindAllStringSubmatch(prompt, -1) {
+		addCategories(s.Skip, listRe.Split(m[1], -1))
+	}
+	return s
+}
+
+func addCategories(dst map[string]bool, words []string) {
+	for _, w := range words {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if c, ok := categoryAliases[w]; ok {
+			dst[c] = true
+		} else if w == CategoryOther {
+			dst[w] = true
+		}
+	}
+}
+
+// Full reports whether the scope reports every category.
+func (s Scope) Full() bool {
+	return len(s.Only) == 0 && len(s.Skip) == 0
+}
+
+// Allows reports whether findings in category are in scope.
+func (s Scope) Allows(category string) bool {
+	if s.Skip[category] {
+		return false
+	}
+	return len(s.Only) == 0 || s.Only[category]
+}
+
+// Filter returns the findings in scope.
+func (s Scope) Filter(findings []protocol.Finding) []protocol.Finding {
+	if s.Full() {
+		return findings
+	}
+	var out []protocol.Finding
+	for _, f := range findings {
+		if s.Allows(categoryOf(f)) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// Describe summarizes a partial scope, e.g. "only secrets; skipping logging".
+func (s Scope) Describe() string {
+	var parts []string
+	if len(s.Only) > 0 {
+		parts = append(parts, "only "+strings.Join(sortedSet(s.Only), ", "))
+	}
+	if len(s.Skip) > 0 {
+		parts = append(parts, "skipping "+strings.Join(sortedSet(s.Skip), ", "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// categoryOf classifies a finding: native rules (including external IDs
+// that map onto them) by table, other external findings by keyword.
+func categoryOf(f protocol.Finding) string {
+	if f.ResourceType == parser.DependencyProvider || f.ResourceType == parser.DependencyModule {
+		return CategoryDependencies
+	}
+	if id, ok := analyzer.MapExternalID(f.RuleID); ok {
+		if c, ok := nativeCategories[id]; ok {
+			return c
+		}
+		if g := analyzer.RuleGroup(id); g != "" {
+			return g
+		}
+	}
+	text := strings.ToLower(f.RuleID + " " + f.Message)
+	switch {
+	case strings.Contains(text, "secret") || strings.Contains(text, "password") || strings.Contains(text, "credential"):
+		return CategorySecrets
+	case strings.Contains(text, "logging") || strings.Contains(text, "log ") || strings.Contains(text, "diagnostic"):
+		return CategoryLogging
+	case strings.Contains(text, "encrypt") || strings.Contains(text, "tls") || strings.Contains(text, "https"):
+		return CategoryEncryption
+	case strings.Contains(text, "network") || strings.Contains(text, "public") || strings.Contains(text, "firewall") || strings.Contains(text, "nsg"):
+		return CategoryNetwork
+	}
+	return CategoryOther
+}
+
+func sortedSet(m map[string]bool) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,834 @@
+// Package client is a Go client for the agent-host HTTP API described in
+// docs/openapi.yaml. It runs agents (collecting their Server-Sent Events
+// stream into a Result) and wraps the JSON endpoints for jobs, graph diffs,
+// analytics, SLOs and webhook deliveries.
+//
+//	c := client.New("http://localhost:8080", client.WithSecret(os.Getenv("GITHUB_WEBHOOK_SECRET")))
+//	res, err := c.Cost(ctx, code)
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds each request, including a whole agent run.
+const DefaultTimeout = 2 * time.Minute
+
+// errorPrefix marks error messages in an agent's stream.
+const errorPrefix = "❌ **Error:** "
+
+// Client calls an agent-host.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	secret  string
+	token   string
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient replaces the default HTTP client.
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) {
+		c.http = h
+	}
+}
+
+// WithSecret signs POST requests with the host's GITHUB_WEBHOOK_SECRET, as
+// required outside development.
+func WithSecret(secret string) Option {
+	return func(c *Client) {
+		c.secret = secret
+	}
+}
+
+// WithToken sends a GitHub token so agents can use the model API and
+// repository access on the caller's behalf.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// New creates a Client for the host at baseURL, e.g. "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: DefaultTimeout},
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// APIError is a non-2xx response.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("agent-host: %d %s", e.StatusCode, e.Message)
+}
+
+// Run sends req to the agent with the given ID and waits for it to finish.
+// An empty agentID lets the orchestrator route the request.
+func (c *Client) Run(ctx context.Context, agentID string, req Request) (*Result, error) {
+	body := requestBody(req)
+
+	path := "/agent"
+	if agentID != "" {
+		path += "/" + url.PathEscape(agentID)
+	}
+	headers := map[string]string{"X-Progress-Events": "true"}
+	if req.IdempotencyKey != "" {
+		headers["Idempotency-Key"] = req.IdempotencyKey
+	}
+	resp, err := c.do(ctx, http.MethodPost, path, body, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	res := &Result{JobID: resp.Header.Get("X-Job-ID")}
+	if err := readEvents(resp.Body, res); err != nil {
+		return res, fmt.Errorf("read agent stream: %w", err)
+	}
+	return res, nil
+}
+
+// requestBody is the agent request JSON for req, with its code fenced into
+// the prompt.
+func requestBody(req Request) agentRequest {
+	prompt := req.Prompt
+	if req.Code != "" {
+		lang := req.Language
+		if lang == "" {
+			lang = "hcl"
+		}
+		prompt = strings.TrimSpace(prompt + "\n```" + lang + "\n" + strings.TrimRight(req.Code, "\n") + "\n```")
+	}
+	return agentRequest{
+		Messages:       []map[string]string{{"role": "user", "content": prompt}},
+		ThreadID:       req.SessionID,
+		Categories:     req.Categories,
+		SkipCategories: req.SkipCategories,
+		Baseline:       req.Baseline,
+		Environment:    req.Environment,
+		Version:        req.Version,
+		Currency:       req.Currency,
+		Locale:         req.Locale,
+		Budget:         req.Budget,
+		Repository:     req.Repository,
+		Commit:         req.Commit,
+		Frameworks:     req.Frameworks,
+	}
+}
+
+// agentRequest is the JSON body of an agent run.
+type agentRequest struct {
+	Messages       []map[string]string `json:"messages"`
+	ThreadID       string              `json:"copilot_thread_id,omitempty"`
+	Categories     []string            `json:"categories,omitempty"`
+	SkipCategories []string            `json:"skip_categories,omitempty"`
+	Baseline       string              `json:"baseline,omitempty"`
+	Environment    string              `json:"environment,omitempty"`
+	Version        string              `json:"version,omitempty"`
+	Currency       string              `json:"currency,omitempty"`
+	Locale         string              `json:"locale,omitempty"`
+	Budget         float64             `json:"budget,omitempty"`
+	Repository     string              `json:"repository,omitempty"`
+	Commit         string              `json:"commit,omitempty"`
+	Frameworks     []string            `json:"frameworks,omitempty"`
+}
+
+// Policy runs the policy agent against code.
+func (c *Client) Policy(ctx context.Context, code string) (*Result, error) {
+	return c.Run(ctx, "policy", Request{Prompt: "Check this configuration against policy", Code: code})
+}
+
+// Security runs the security agent against code.
+func (c *Client) Security(ctx context.Context, code string) (*Result, error) {
+	return c.Run(ctx, "security", Request{Prompt: "Scan this configuration for security issues", Code: code})
+}
+
+// Cost runs the cost estimator against code.
+func (c *Client) Cost(ctx context.Context, code string) (*Result, error) {
+	return c.Run(ctx, "cost", Request{Prompt: "Estimate the monthly cost", Code: code})
+}
+
+// Estimate returns the cost estimate of req as JSON rather than a stream.
+// Currency, Locale, Budget, Environment and Version apply as they do for
+// Cost.
+func (c *Client) Estimate(ctx context.Context, req Request) (*CostEstimate, error) {
+	var est CostEstimate
+	if err := c.doJSON(ctx, http.MethodPost, "/estimate", requestBody(req), &est); err != nil {
+		return nil, err
+	}
+	return &est, nil
+}
+
+// Check runs the policy agent, or the given agents, on req and returns the
+// verdict of their findings rather than a stream. Use its ExitCode to gate a
+// CI step.
+func (c *Client) Check(ctx context.Context, req Request, agents ...string) (*CheckResult, error) {
+	var q url.Values
+	if len(agents) > 0 {
+		q = url.Values{"agents": {strings.Join(agents, ",")}}
+	}
+	var res CheckResult
+	if err := c.doJSON(ctx, http.MethodPost, withQuery("/check", q), requestBody(req), &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Scan runs the security agent, or the given agents, on req and returns
+// their findings as a SARIF 2.1.0 log located in path (the repository-
+// relative file the code came from; empty uses main.tf or main.bicep), ready
+// to upload to GitHub code scanning.
+func (c *Client) Scan(ctx context.Context, req Request, path string, agents ...string) (json.RawMessage, error) {
+	q := url.Values{}
+	if len(agents) > 0 {
+		q.Set("agents", strings.Join(agents, ","))
+	}
+	if path != "" {
+		q.Set("path", path)
+	}
+	var log json.RawMessage
+	if err := c.doJSON(ctx, http.MethodPost, withQuery("/scan", q), requestBody(req), &log); err != nil {
+		return nil, err
+	}
+	return log, nil
+}
+
+// ComplianceReport audits req's code against req.Frameworks and returns
+// the evidence report for auditors in opts.Format ("html" when empty,
+// "csv" or "json"; decode JSON into an EvidenceReport).
+func (c *Client) ComplianceReport(ctx context.Context, req Request, opts ReportOptions) ([]byte, error) {
+	var q url.Values
+	if opts.Format != "" {
+		q = url.Values{"format": {opts.Format}}
+	}
+	body := struct {
+		agentRequest
+		Title    string            `json:"title,omitempty"`
+		Auditor  string            `json:"auditor,omitempty"`
+		Notes    map[string]string `json:"notes,omitempty"`
+		Findings []Finding         `json:"findings,omitempty"`
+	}{requestBody(req), opts.Title, opts.Auditor, opts.Notes, opts.Findings}
+	resp, err := c.do(ctx, http.MethodPost, withQuery("/report", q), body, nil)
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read report: %w", err)
+	}
+	return data, nil
+}
+
+// Agents lists the registered agents.
+func (c *Client) Agents(ctx context.Context) ([]Agent, error) {
+	var agents []Agent
+	err := c.getJSON(ctx, "/agents", nil, &agents)
+	return agents, err
+}
+
+// Health returns the host's health.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var h Health
+	if err := c.getJSON(ctx, "/health", nil, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// Version returns the build info of the host, or of the gateway and its
+// upstreams when the client points at a gateway.
+func (c *Client) Version(ctx context.Context) (*BuildInfo, error) {
+	var b BuildInfo
+	if err := c.getJSON(ctx, "/version", nil, &b); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Jobs lists in-flight runs.
+func (c *Client) Jobs(ctx context.Context) ([]Job, error) {
+	var jobs []Job
+	err := c.getJSON(ctx, "/jobs", nil, &jobs)
+	return jobs, err
+}
+
+// CancelJob cancels an in-flight run.
+func (c *Client) CancelJob(ctx context.Context, id string) (*Job, error) {
+	var job Job
+	if err := c.doJSON(ctx, http.MethodDelete, "/jobs/"+url.PathEscape(id), nil, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Graph returns the dependency graph of an earlier run by JobID.
+func (c *Client) Graph(ctx context.Context, id string) (*GraphAnalysis, error) {
+	var g GraphAnalysis
+	if err := c.getJSON(ctx, "/graph/"+url.PathEscape(id), nil, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// GraphDiff compares the dependency graphs of two earlier runs by JobID.
+func (c *Client) GraphDiff(ctx context.Context, before, after string) (*GraphDiff, error) {
+	var d GraphDiff
+	if err := c.getJSON(ctx, "/graph/diff", url.Values{"before": {before}, "after": {after}}, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Analytics returns opt-in usage analytics.
+func (c *Client) Analytics(ctx context.Context) (*Analytics, error) {
+	var a Analytics
+	if err := c.getJSON(ctx, "/analytics", nil, &a); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// SLO returns compliance for every objective and per-agent latency.
+func (c *Client) SLO(ctx context.Context) (*SLOSnapshot, error) {
+	var s SLOSnapshot
+	if err := c.getJSON(ctx, "/slo", nil, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SLOObjective returns one objective's report.
+func (c *Client) SLOObjective(ctx context.Context, name string) (*SLOReport, error) {
+	var r SLOReport
+	if err := c.getJSON(ctx, "/slo/"+url.PathEscape(name), nil, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Deliveries lists recent notification deliveries, oldest first.
+func (c *Client) Deliveries(ctx context.Context, f DeliveryFilter) ([]Delivery, error) {
+	var d []Delivery
+	err := c.getJSON(ctx, "/webhooks/deliveries", f.query(), &d)
+	return d, err
+}
+
+// ReplayDelivery re-sends one delivery. A failed replay returns the updated
+// delivery together with an *APIError.
+func (c *Client) ReplayDelivery(ctx context.Context, id string) (*Delivery, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/webhooks/deliveries/"+url.PathEscape(id)+"/replay", nil, nil)
+	if resp == nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var d Delivery
+	if derr := json.NewDecoder(resp.Body).Decode(&d); derr != nil {
+		return nil, fmt.Errorf("decode delivery: %w", derr)
+	}
+	return &d, err
+}
+
+// ReplayFailed re-sends every failed delivery, optionally only for one
+// channel or since a time.
+func (c *Client) ReplayFailed(ctx context.Context, channel string, since time.Time) ([]Delivery, error) {
+	var d []Delivery
+	q := DeliveryFilter{Channel: channel, Since: since}.query()
+	err := c.doJSON(ctx, http.MethodPost, withQuery("/webhooks/replay", q), nil, &d)
+	return d, err
+}
+
+// CostChange reports what a release added to an environment's monthly
+// cost, from runs made with Request.Environment and Request.Version set.
+func (c *Client) CostChange(ctx context.Context, env, version string) (*CostChange, error) {
+	var change CostChange
+	if err := c.getJSON(ctx, "/reports/costs", url.Values{"environment": {env}, "version": {version}}, &change); err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// CreateShare creates a read-only link to the report of the run with the
+// given job ID. A zero ttl uses the host's default.
+func (c *Client) CreateShare(ctx context.Context, jobID string, ttl time.Duration) (*Share, error) {
+	body := struct {
+		TTL string `json:"ttl,omitempty"`
+	}{}
+	if ttl > 0 {
+		body.TTL = ttl.String()
+	}
+	var sh Share
+	if err := c.doJSON(ctx, http.MethodPost, "/reports/"+url.PathEscape(jobID)+"/shares", body, &sh); err != nil {
+		return nil, err
+	}
+	return &sh, nil
+}
+
+// Shares lists the links to a run's report, without their tokens.
+func (c *Client) Shares(ctx context.Context, jobID string) ([]Share, error) {
+	var shares []Share
+	err := c.getJSON(ctx, "/reports/"+url.PathEscape(jobID)+"/shares", nil, &shares)
+	return shares, err
+}
+
+// RecordTimings records how long resources took to apply for the run with
+// the given job ID, improving later apply-duration estimates.
+func (c *Client) RecordTimings(ctx context.Context, jobID string, timings []ApplyTiming) error {
+	body := struct {
+		Timings []ApplyTiming `json:"timings"`
+	}{timings}
+	resp, err := c.do(ctx, http.MethodPost, "/reports/"+url.PathEscape(jobID)+"/timings", body, nil)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+// RevokeShare disables a share link.
+func (c *Client) RevokeShare(ctx context.Context, id string) (*Share, error) {
+	var sh Share
+	if err := c.doJSON(ctx, http.MethodDelete, "/shares/"+url.PathEscape(id), nil, &sh); err != nil {
+		return nil, err
+	}
+	return &sh, nil
+}
+
+// RetentionStatus returns the host's report retention policy, what it
+// holds and its recent retention runs.
+func (c *Client) RetentionStatus(ctx context.Context) (*RetentionStatus, error) {
+	var st RetentionStatus
+	if err := c.getJSON(ctx, "/reports/retention", nil, &st); err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// RunRetention archives and prunes reports now. When some reports fail to
+// archive both the run and an *APIError (502) are returned.
+func (c *Client) RunRetention(ctx context.Context) (*RetentionRun, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/reports/retention/runs", nil, nil)
+	if resp == nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var run RetentionRun
+	if derr := json.NewDecoder(resp.Body).Decode(&run); derr != nil {
+		return nil, fmt.Errorf("decode retention run: %w", derr)
+	}
+	return &run, err
+}
+
+// VerifyRetentionRun checks that the reports a retention run archived are
+// still in the archive, unchanged. See the run's Verification.
+func (c *Client) VerifyRetentionRun(ctx context.Context, id string) (*RetentionRun, error) {
+	var run RetentionRun
+	if err := c.doJSON(ctx, http.MethodPost, "/reports/retention/runs/"+url.PathEscape(id)+"/verify", nil, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// ReportSummaries lists what is kept of reports past their retention, of
+// agentID when it is set, newest first.
+func (c *Client) ReportSummaries(ctx context.Context, agentID string) ([]ReportSummary, error) {
+	var q url.Values
+	if agentID != "" {
+		q = url.Values{"agent": {agentID}}
+	}
+	var sums []ReportSummary
+	err := c.getJSON(ctx, "/reports/summaries", q, &sums)
+	return sums, err
+}
+
+// Trends returns the compliance score history q selects, one series per
+// repository and framework.
+func (c *Client) Trends(ctx context.Context, q TrendQuery) ([]TrendSeries, error) {
+	var series []TrendSeries
+	err := c.getJSON(ctx, "/trends", q.query(), &series)
+	return series, err
+}
+
+// ModuleUsage returns how scanned code uses each catalog module, the
+// modules with the most repositories on outdated versions first.
+func (c *Client) ModuleUsage(ctx context.Context, q UsageQuery) ([]ModuleUsage, error) {
+	var usage []ModuleUsage
+	err := c.getJSON(ctx, "/modules/usage", q.query(), &usage)
+	return usage, err
+}
+
+// Exceptions lists the exception requests made in chat with status ("pending"),
+// or all of them when it is empty, newest first.
+func (c *Client) Exceptions(ctx context.Context, status string) ([]ExceptionRequest, error) {
+	var q url.Values
+	if status != "" {
+		q = url.Values{"status": {status}}
+	}
+	var reqs []ExceptionRequest
+	err := c.getJSON(ctx, "/exceptions", q, &reqs)
+	return reqs, err
+}
+
+// Exception returns an exception request with the waiver that grants it.
+func (c *Client) Exception(ctx context.Context, id string) (*ExceptionRequest, error) {
+	var req ExceptionRequest
+	if err := c.getJSON(ctx, "/exceptions/"+url.PathEscape(id), nil, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// Approvals lists the deploy agent's promotion approval requests with
+// status ("pending", "approved" or "rejected"), or all of them when it is
+// empty, newest first.
+func (c *Client) Approvals(ctx context.Context, status string) ([]ApprovalRequest, error) {
+	var q url.Values
+	if status != "" {
+		q = url.Values{"status": {status}}
+	}
+	var reqs []ApprovalRequest
+	err := c.getJSON(ctx, "/approvals", q, &reqs)
+	return reqs, err
+}
+
+// Approval returns a promotion approval request.
+func (c *Client) Approval(ctx context.Context, id string) (*ApprovalRequest, error) {
+	var req ApprovalRequest
+	if err := c.getJSON(ctx, "/approvals/"+url.PathEscape(id), nil, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// DecideApproval approves or rejects a promotion request as the owner of the
+// client's GitHub token (WithToken). The approval that completes a request
+// promotes its version.
+func (c *Client) DecideApproval(ctx context.Context, d ApprovalDecision) (*ApprovalRequest, error) {
+	var req ApprovalRequest
+	if err := c.doJSON(ctx, http.MethodPost, "/approvals", d, &req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// Environments returns the deploy agent's promotion pipeline in order,
+// with what each environment runs.
+func (c *Client) Environments(ctx context.Context) ([]EnvironmentStatus, error) {
+	var envs []EnvironmentStatus
+	err := c.getJSON(ctx, "/environments", nil, &envs)
+	return envs, err
+}
+
+// Environment returns one environment of the promotion pipeline.
+func (c *Client) Environment(ctx context.Context, name string) (*EnvironmentStatus, error) {
+	var env EnvironmentStatus
+	if err := c.getJSON(ctx, "/environments/"+url.PathEscape(name), nil, &env); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
+
+// AddEnvironment adds an environment to the promotion pipeline before the
+// one named before, or at its end when before is empty, and returns the
+// new topology.
+func (c *Client) AddEnvironment(ctx context.Context, env Environment, before string) (*Topology, error) {
+	var q url.Values
+	if before != "" {
+		q = url.Values{"before": {before}}
+	}
+	var t Topology
+	if err := c.doJSON(ctx, http.MethodPost, withQuery("/environments", q), env, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// PutEnvironment replaces the environment named env.Name in place and
+// returns the new topology.
+func (c *Client) PutEnvironment(ctx context.Context, env Environment) (*Topology, error) {
+	var t Topology
+	if err := c.doJSON(ctx, http.MethodPut, "/environments/"+url.PathEscape(env.Name), env, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// DeleteEnvironment removes an environment no other is promoted from.
+func (c *Client) DeleteEnvironment(ctx context.Context, name string) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/environments/"+url.PathEscape(name), nil, nil)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+// RulePack returns the rule pack installed on the host.
+func (c *Client) RulePack(ctx context.Context) (*RulePackState, error) {
+	var state RulePackState
+	if err := c.getJSON(ctx, "/rules/pack", nil, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// RiskProfile returns the risk profile the host's impact agent weighs
+// changes with.
+func (c *Client) RiskProfile(ctx context.Context) (*RiskProfile, error) {
+	var p RiskProfile
+	if err := c.getJSON(ctx, "/risk-profile", nil, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// PutRiskProfile validates and installs a risk profile on the host, which
+// saves it when it has a profile file.
+func (c *Client) PutRiskProfile(ctx context.Context, p RiskProfile) (*RiskProfile, error) {
+	var out RiskProfile
+	if err := c.doJSON(ctx, http.MethodPut, "/risk-profile", p, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// RolloutRulePack pushes a rule pack document to the fleet. When any host
+// fails to load it the fleet is rolled back and both the result and an
+// *APIError (502) are returned.
+func (c *Client) RolloutRulePack(ctx context.Context, pack json.RawMessage) (*RolloutResult, error) {
+	resp, err := c.do(ctx, http.MethodPost, "/rules/rollout", pack, nil)
+	if resp == nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var res RolloutResult
+	if derr := json.NewDecoder(resp.Body).Decode(&res); derr != nil {
+		return nil, fmt.Errorf("decode rollout: %w", derr)
+	}
+	return &res, err
+}
+
+// SimulateRule replays a proposed rule declaration, in rule pack form,
+// against the host's last n stored scans (the host default when n is 0).
+func (c *Client) SimulateRule(ctx context.Context, rule json.RawMessage, n int) (*Simulation, error) {
+	q := url.Values{}
+	if n > 0 {
+		q.Set("last", fmt.Sprint(n))
+	}
+	var sim Simulation
+	if err := c.doJSON(ctx, http.MethodPost, withQuery("/rules/simulate", q), rule, &sim); err != nil {
+		return nil, err
+	}
+	return &sim, nil
+}
+
+func (q TrendQuery) query() url.Values {
+	v := url.Values{}
+	if q.Repository != "" {
+		v.Set("repo", q.Repository)
+	}
+	if q.Framework != "" {
+		v.Set("framework", q.Framework)
+	}
+	if !q.Since.IsZero() {
+		v.Set("since", q.Since.Format(time.RFC3339))
+	}
+	if q.Interval != "" {
+		v.Set("interval", q.Interval)
+	}
+	return v
+}
+
+func (q UsageQuery) query() url.Values {
+	v := url.Values{}
+	if q.Repository != "" {
+		v.Set("repo", q.Repository)
+	}
+	if !q.Since.IsZero() {
+		v.Set("since", q.Since.Format(time.RFC3339))
+	}
+	return v
+}
+
+func (f DeliveryFilter) query() url.Values {
+	q := url.Values{}
+	if f.Channel != "" {
+		q.Set("channel", f.Channel)
+	}
+	if f.Status != "" {
+		q.Set("status", f.Status)
+	}
+	if !f.Since.IsZero() {
+		q.Set("since", f.Since.Format(time.RFC3339))
+	}
+	return q
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, q url.Values, out interface{}) error {
+	return c.doJSON(ctx, http.MethodGet, withQuery(path, q), nil, out)
+}
+
+func withQuery(path string, q url.Values) string {
+	if len(q) == 0 {
+		return path
+	}
+	return path + "?" + q.Encode()
+}
+
+func (c *Client) doJSON(ctx context.Context, method, path string, body, out interface{}) error {
+	resp, err := c.do(ctx, method, path, body, nil)
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// do sends a request, signing POST bodies. For error statuses it returns an
+// *APIError; the response is returned as well when its body holds JSON the
+// caller may still want.
+func (c *Client) do(ctx context.Context, method, path string, body interface{}, headers map[string]string) (*http.Response, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("marshal request: %w", err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.secret != "" && method != http.MethodGet {
+		req.Header.Set("X-Hub-Signature-256", sign(data, c.secret))
+	}
+	if c.token != "" {
+		req.Header.Set("X-GitHub-Token", c.token)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", method, path, err)
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return resp, &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	resp.Body.Close()
+	return nil, &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+}
+
+// sign computes the X-Hub-Signature-256 header the host verifies.
+func sign(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// readEvents collects an agent's Server-Sent Events stream into res.
+func readEvents(r io.Reader, res *Result) error {
+	var text strings.Builder
+	defer func() { res.Text = text.String() }()
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	var event string
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data := []byte(strings.TrimPrefix(line, "data: "))
+			switch event {
+			case "copilot_message":
+				var m struct {
+					Choices []struct {
+						Delta struct {
+							Content string `json:"content"`
+						} `json:"delta"`
+					} `json:"choices"`
+				}
+				if err := json.Unmarshal(data, &m); err != nil {
+					return err
+				}
+				for _, ch := range m.Choices {
+					if msg, ok := strings.CutPrefix(ch.Delta.Content, errorPrefix); ok {
+						res.Errors = append(res.Errors, strings.TrimSpace(msg))
+					}
+					text.WriteString(ch.Delta.Content)
+				}
+			case "copilot_references":
+				var refs []Reference
+				if err := json.Unmarshal(data, &refs); err != nil {
+					return err
+				}
+				res.References = append(res.References, refs...)
+			case "copilot_confirmation":
+				var conf Confirmation
+				if err := json.Unmarshal(data, &conf); err != nil {
+					return err
+				}
+				res.Confirmations = append(res.Confirmations, conf)
+			case "job_cancelled":
+				res.Cancelled = true
+			case "verdict":
+				var v Verdict
+				if err := json.Unmarshal(data, &v); err != nil {
+					return err
+				}
+				res.Verdict = &v
+			case "summary":
+				var sum RunSummary
+				if err := json.Unmarshal(data, &sum); err != nil {
+					return err
+				}
+				res.Summary = &sum
+			case "copilot_done":
+				return nil
+			}
+		case line == "":
+			event = ""
+		}
+	}
+	return sc.Err()
+}
@@ -0,0 +1,359 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient_Run(t *testing.T) {
+	var got struct {
+		Messages []struct{ Role, Content string } `json:"messages"`
+		ThreadID string                           `json:"copilot_thread_id"`
+	}
+	var idempotencyKey string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/agent/cost" || r.Header.Get("X-Hub-Signature-256") != sign(body, "s3cret") {
+			http.Error(w, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+		json.Unmarshal(body, &got)
+		idempotencyKey = r.Header.Get("Idempotency-Key")
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("X-Job-ID", "job-1")
+		for _, content := range []string{"### Cost Estimate\n", "❌ **Error:** pricing API unavailable\n"} {
+			data, _ := json.Marshal(map[string]interface{}{
+				"choices": []map[string]interface{}{{"index": 0, "delta": map[string]string{"role": "assistant", "content": content}}},
+			})
+			fmt.Fprintf(w, "event: copilot_message\ndata: %s\n\n", data)
+		}
+		fmt.Fprint(w, "event: progress\ndata: {\"stage\":\"pricing\"}\n\n")
+		fmt.Fprint(w, "event: copilot_references\ndata: [{\"title\":\"Pricing\",\"url\":\"https://example.com\"}]\n\n")
+		fmt.Fprint(w, "event: summary\ndata: {\"decision\":\"no-go\",\"reasons\":[\"Approval required\"],\"counts\":{\"medium\":1},\"total\":1,\"cost\":{\"monthly\":120,\"currency\":\"USD\",\"current\":100,\"delta\":20},\"agents\":[{\"id\":\"cost\",\"findings\":1}]}\n\n")
+		fmt.Fprint(w, "event: verdict\ndata: {\"action\":\"require_approval\",\"passed\":false,\"exit_code\":2,\"counts\":{\"medium\":1},\"total\":1}\n\n")
+		fmt.Fprint(w, "event: copilot_done\ndata: {}\n\n")
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL+"/", WithSecret("s3cret"))
+	res, err := c.Run(context.Background(), "cost", Request{Prompt: "Estimate", Code: "resource \"a\" \"b\" {}\n", SessionID: "t1", IdempotencyKey: "run-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.JobID != "job-1" || !strings.Contains(res.Text, "### Cost Estimate") || len(res.References) != 1 {
+		t.Errorf("result = %+v", res)
+	}
+	if v := res.Verdict; v == nil || v.Action != "require_approval" || v.ExitCode != 2 || v.Counts["medium"] != 1 {
+		t.Errorf("verdict = %+v", res.Verdict)
+	}
+	if sum := res.Summary; sum == nil || sum.Decision != "no-go" || sum.Cost == nil || sum.Cost.Delta == nil || *sum.Cost.Delta != 20 || len(sum.Agents) != 1 {
+		t.Errorf("summary = %+v", res.Summary)
+	}
+	if len(res.Errors) != 1 || res.Errors[0] != "pricing API unavailable" {
+		t.Errorf("errors = %v", res.Errors)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Content != "Estimate\n```hcl\nresource \"a\" \"b\" {}\n```" || got.ThreadID != "t1" || idempotencyKey != "run-1" {
+		t.Errorf("request = %+v", got)
+	}
+
+	if _, err := New(srv.URL).Run(context.Background(), "cost", Request{Prompt: "x"}); err == nil {
+		t.Error("unsigned request should fail")
+	} else {
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Message != "Invalid signature" {
+			t.Errorf("err = %v", err)
+		}
+	}
+}
+
+func TestClient_JSONEndpoints(t *testing.T) {
+	since := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method + " " + r.URL.Path {
+		case "GET /slo/scans":
+			fmt.Fprint(w, `{"name":"scans","agent":"*","latency":30000000000,"target":0.99,"status":"at_risk"}`)
+		case "GET /webhooks/deliveries":
+			if r.URL.Query().Get("since") != since.Format(time.RFC3339) || r.URL.Query().Get("status") != DeliveryFailed {
+				http.Error(w, "bad query", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `[{"id":"d1","channel":"audit","status":"failed","payload":{"text":"hi"}}]`)
+		case "POST /webhooks/deliveries/d1/replay":
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprint(w, `{"id":"d1","status":"failed","replays":1}`)
+		case "POST /reports/job-1/shares":
+			var body struct{ TTL string }
+			if json.NewDecoder(r.Body).Decode(&body); body.TTL != "24h0m0s" {
+				http.Error(w, "bad ttl", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"id":"s1","report_id":"job-1","token":"tok","url":"http://h/shared/tok","expires":"2026-03-02T00:00:00Z"}`)
+		case "POST /estimate":
+			var body struct {
+				Messages []map[string]string `json:"messages"`
+				Currency string              `json:"currency"`
+			}
+			if json.NewDecoder(r.Body).Decode(&body); body.Currency != "EUR" || !strings.Contains(body.Messages[0]["content"], "```hcl\n") {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"currency":"EUR","total_monthly":64.5,"items":[{"name":"key_vault.kv","sku":"Standard","monthly":2.75,"confidence":"high","source":"table"}],"low_confidence_items":0}`)
+		case "POST /check":
+			if r.URL.Query().Get("agents") != "policy,security" {
+				http.Error(w, "bad query", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"action":"block","passed":false,"exit_code":1,"counts":{"high":1},"total":1,"triggers":["high"],"agents":["policy","security"],"findings":[{"rule_id":"SEC-001","severity":"high","resource":"sa","resource_type":"azurerm_storage_account","message":"public"}]}`)
+		case "POST /scan":
+			if r.URL.Query().Get("path") != "infra/main.tf" || r.URL.Query().Get("agents") != "" {
+				http.Error(w, "bad query", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/sarif+json")
+			fmt.Fprint(w, `{"version":"2.1.0","runs":[{"tool":{"driver":{"name":"ghcp-iac","rules":[]}},"results":[]}]}`)
+		case "POST /report":
+			var body struct {
+				Frameworks []string          `json:"frameworks"`
+				Notes      map[string]string `json:"notes"`
+				Findings   []Finding         `json:"findings"`
+			}
+			if json.NewDecoder(r.Body).Decode(&body); r.URL.Query().Get("format") != "csv" || body.Frameworks[0] != "pci-dss" || body.Notes["4.2.1"] == "" || len(body.Findings) != 1 {
+				http.Error(w, "bad request", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			fmt.Fprint(w, "framework,control_id\npci-dss,4.2.1\n")
+		case "POST /reports/retention/runs":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprint(w, `{"id":"r1","trigger":"manual","archived":[{"report_id":"job-1","location":"https://st.blob.core.windows.net/reports/policy/2026/07/04/job-1.json","size":120,"md5":"x"}],"summarized":1,"failed":["job-2: status 403"]}`)
+		case "POST /reports/retention/runs/r1/verify":
+			fmt.Fprint(w, `{"id":"r1","verification":{"ok":true,"verified":1}}`)
+		case "GET /reports/summaries":
+			fmt.Fprintf(w, `[{"id":"job-1","agent_id":"%s","findings":2,"severities":{"high":2}}]`, r.URL.Query().Get("agent"))
+		case "GET /trends":
+			if q := r.URL.Query(); q.Get("repo") != "org/app" || q.Get("interval") != "week" || q.Get("since") != since.Format(time.RFC3339) {
+				http.Error(w, "bad query", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `[{"repository":"org/app","framework":"overall","points":[{"time":"2026-03-02T00:00:00Z","score":60},{"time":"2026-03-09T00:00:00Z","score":75,"commit":"9f2c1e0"}],"latest":75,"change":15}]`)
+		case "GET /modules/usage":
+			if r.URL.Query().Get("repo") != "org/app" {
+				http.Error(w, "bad query", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `[{"module":"key_vault","source":"Azure/avm-res-keyvault-vault/azurerm","approved":"~> 0.10","repositories":1,"requests":3,"outdated_repositories":1,"outdated_requests":2,"versions":[{"version":"~> 0.9","outdated":true,"repositories":["org/app"],"requests":2}]}]`)
+		case "GET /exceptions":
+			fmt.Fprintf(w, `[{"id":"EXC-001","status":"%s","rule_id":"POL-001","resource_type":"azurerm_storage_account","resource":"sa","expires":"2026-12-31"}]`, r.URL.Query().Get("status"))
+		case "GET /exceptions/EXC-001":
+			fmt.Fprint(w, `{"id":"EXC-001","status":"pending","rule_id":"POL-001","conversation":[{"role":"user","content":"why?"}],"waiver":{"rule":"POL-001","resource":"azurerm_storage_account.sa","reason":"legacy (EXC-001)","expires":"2026-12-31"}}`)
+		case "POST /rules/simulate":
+			if r.URL.Query().Get("last") != "20" {
+				http.Error(w, "bad query", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"rule_id":"ORG-001","severity":"high","scans":3,"repos":2,"failing_repos":1,"resources":4,"failing":3,"new_failures":3,"failure_rate":0.75,"suggested_severity":"medium","recommendation":"start at medium","results":[{"scan_id":"job-1","source":"org/app","resources":2,"new_failures":["azurerm_storage_account.a","azurerm_storage_account.b"]}]}`)
+		case "GET /version":
+			fmt.Fprint(w, `{"service":"ghcp-iac-gateway","version":"v1.4.0","platform":"linux/arm64","upstreams":[{"url":"http://cost:8080","agents":["cost"],"error":"status 404"}]}`)
+		case "GET /graph/job-1":
+			fmt.Fprint(w, `{"id":"job-1","created":"2026-10-01T00:00:00Z","graph":{"nodes":[{"id":"azurerm_subnet.app","type":"azurerm_subnet","name":"app","weight":3},{"id":"azurerm_virtual_network.main","type":"azurerm_virtual_network","name":"main","weight":5}],"edges":[{"from":"azurerm_subnet.app","to":"azurerm_virtual_network.main"}]},"blast_radius":8}`)
+		case "GET /approvals":
+			fmt.Fprintf(w, `[{"id":"APR-001","status":"%s","source":"staging","target":"prod","version":"v1.2.0","reasons":["environment"],"approvers":["alice","bob"],"gates":[{"gate":"security=critical","passed":true,"detail":"No security finding at critical or above"}]}]`, r.URL.Query().Get("status"))
+		case "POST /approvals":
+			var d ApprovalDecision
+			if err := json.NewDecoder(r.Body).Decode(&d); err != nil || d.ID != "APR-001" || d.Decision != "approve" || d.Approver != "" {
+				http.Error(w, "bad decision", http.StatusBadRequest)
+				return
+			}
+			if r.Header.Get("X-GitHub-Token") != "t-alice" {
+				http.Error(w, "sign in", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"id":"APR-001","status":"pending","target":"prod","approvers":["alice","bob"],"decisions":[{"approver":"alice","approved":true,"time":"2026-10-01T00:00:00Z"}]}`)
+		case "GET /environments":
+			fmt.Fprint(w, `[{"name":"dev","state":{"version":"v1.0.0","status":"deployed"}},{"name":"qa","from":["dev"],"state":{"version":"","status":"not deployed"}}]`)
+		case "POST /environments":
+			var env Environment
+			if err := json.NewDecoder(r.Body).Decode(&env); err != nil || env.Name != "qa" || r.URL.Query().Get("before") != "staging" {
+				http.Error(w, "bad environment", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprint(w, `{"environments":[{"name":"dev"},{"name":"qa","from":["dev"]},{"name":"staging","from":["qa"]}]}`)
+		case "DELETE /environments/qa":
+			w.WriteHeader(http.StatusNoContent)
+		case "PUT /risk-profile":
+			var p RiskProfile
+			if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p.Environments["prod"].Multiplier != 1.5 {
+				http.Error(w, "bad profile", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(p)
+		case "GET /graph/diff":
+			fmt.Fprintf(w, `{"blast_radius_delta":2,"summary":"%s..%s"}`, r.URL.Query().Get("before"), r.URL.Query().Get("after"))
+		default:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			http.Error(w, "Job not found", http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c := New(srv.URL)
+	ctx := context.Background()
+
+	report, err := c.SLOObjective(ctx, "scans")
+	if err != nil || report.Latency != 30*time.Second || report.Status != SLOAtRisk {
+		t.Errorf("SLOObjective = %+v, %v", report, err)
+	}
+
+	deliveries, err := c.Deliveries(ctx, DeliveryFilter{Status: DeliveryFailed, Since: since})
+	if err != nil || len(deliveries) != 1 || string(deliveries[0].Payload) != `{"text":"hi"}` {
+		t.Errorf("Deliveries = %+v, %v", deliveries, err)
+	}
+
+	d, err := c.ReplayDelivery(ctx, "d1")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || d == nil || d.Replays != 1 {
+		t.Errorf("ReplayDelivery = %+v, %v", d, err)
+	}
+
+	share, err := c.CreateShare(ctx, "job-1", 24*time.Hour)
+	if err != nil || share.URL != "http://h/shared/tok" || !share.Expires.Equal(since.Add(24*time.Hour)) {
+		t.Errorf("CreateShare = %+v, %v", share, err)
+	}
+
+	est, err := c.Estimate(ctx, Request{Code: `resource "azurerm_key_vault" "kv" {}`, Currency: "EUR"})
+	if err != nil || est.TotalMonthly != 64.5 || len(est.Items) != 1 || est.Items[0].Source != "table" || est.Budget != nil {
+		t.Errorf("Estimate = %+v, %v", est, err)
+	}
+
+	check, err := c.Check(ctx, Request{Code: `resource "azurerm_storage_account" "sa" {}`}, "policy", "security")
+	if err != nil || check.ExitCode != 1 || check.Action != "block" || len(check.Findings) != 1 || check.Findings[0].RuleID != "SEC-001" {
+		t.Errorf("Check = %+v, %v", check, err)
+	}
+
+	log, err := c.Scan(ctx, Request{Code: `resource "azurerm_storage_account" "sa" {}`}, "infra/main.tf")
+	if err != nil || !strings.HasPrefix(string(log), `{"version":"2.1.0"`) {
+		t.Errorf("Scan = %s, %v", log, err)
+	}
+
+	csv, err := c.ComplianceReport(ctx, Request{Code: `resource "azurerm_storage_account" "sa" {}`, Frameworks: []string{"pci-dss"}},
+		ReportOptions{Format: "csv", Notes: map[string]string{"4.2.1": "TLS terminates at the gateway"}, Findings: check.Findings})
+	if err != nil || !strings.HasPrefix(string(csv), "framework,control_id\n") {
+		t.Errorf("ComplianceReport = %s, %v", csv, err)
+	}
+
+	run, err := c.RunRetention(ctx)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || run == nil || len(run.Archived) != 1 || len(run.Failed) != 1 {
+		t.Errorf("RunRetention = %+v, %v", run, err)
+	}
+	if run, err := c.VerifyRetentionRun(ctx, "r1"); err != nil || run.Verification == nil || !run.Verification.OK {
+		t.Errorf("VerifyRetentionRun = %+v, %v", run, err)
+	}
+	if sums, err := c.ReportSummaries(ctx, "policy"); err != nil || len(sums) != 1 || sums[0].AgentID != "policy" || sums[0].Severities["high"] != 2 {
+		t.Errorf("ReportSummaries = %+v, %v", sums, err)
+	}
+	if reqs, err := c.Exceptions(ctx, "pending"); err != nil || len(reqs) != 1 || reqs[0].Status != "pending" || reqs[0].Expires != "2026-12-31" {
+		t.Errorf("Exceptions = %+v, %v", reqs, err)
+	}
+	if req, err := c.Exception(ctx, "EXC-001"); err != nil || req.Waiver == nil || req.Waiver.Resource != "azurerm_storage_account.sa" || len(req.Conversation) != 1 {
+		t.Errorf("Exception = %+v, %v", req, err)
+	}
+	if reqs, err := c.Approvals(ctx, "pending"); err != nil || len(reqs) != 1 || reqs[0].Status != "pending" || len(reqs[0].Approvers) != 2 || len(reqs[0].Gates) != 1 || !reqs[0].Gates[0].Passed {
+		t.Errorf("Approvals = %+v, %v", reqs, err)
+	}
+	if req, err := New(srv.URL, WithToken("t-alice")).DecideApproval(ctx, ApprovalDecision{ID: "APR-001", Decision: "approve"}); err != nil || len(req.Decisions) != 1 || !req.Decisions[0].Approved || req.Decisions[0].Approver != "alice" {
+		t.Errorf("DecideApproval = %+v, %v", req, err)
+	}
+	if envs, err := c.Environments(ctx); err != nil || len(envs) != 2 || envs[0].State.Version != "v1.0.0" || envs[1].From[0] != "dev" {
+		t.Errorf("Environments = %+v, %v", envs, err)
+	}
+	if topo, err := c.AddEnvironment(ctx, Environment{Name: "qa"}, "staging"); err != nil || len(topo.Environments) != 3 || topo.Environments[2].From[0] != "qa" {
+		t.Errorf("AddEnvironment = %+v, %v", topo, err)
+	}
+	if err := c.DeleteEnvironment(ctx, "qa"); err != nil {
+		t.Errorf("DeleteEnvironment: %v", err)
+	}
+	series, err := c.Trends(ctx, TrendQuery{Repository: "org/app", Since: since, Interval: "week"})
+	if err != nil || len(series) != 1 || series[0].Change != 15 || series[0].Points[1].Commit != "9f2c1e0" {
+		t.Errorf("Trends = %+v, %v", series, err)
+	}
+
+	usage, err := c.ModuleUsage(ctx, UsageQuery{Repository: "org/app"})
+	if err != nil || len(usage) != 1 || usage[0].OutdatedRepositories != 1 || !usage[0].Versions[0].Outdated || usage[0].Versions[0].Repositories[0] != "org/app" {
+		t.Errorf("ModuleUsage = %+v, %v", usage, err)
+	}
+
+	sim, err := c.SimulateRule(ctx, json.RawMessage(`{"id":"ORG-001"}`), 20)
+	if err != nil || sim.SuggestedSeverity != "medium" || len(sim.Results) != 1 || len(sim.Results[0].NewFailures) != 2 {
+		t.Errorf("SimulateRule = %+v, %v", sim, err)
+	}
+
+	build, err := c.Version(ctx)
+	if err != nil || build.Version != "v1.4.0" || build.Platform != "linux/arm64" || len(build.Upstreams) != 1 || build.Upstreams[0].Error == "" {
+		t.Errorf("Version = %+v, %v", build, err)
+	}
+
+	g, err := c.Graph(ctx, "job-1")
+	if err != nil || len(g.Graph.Nodes) != 2 || len(g.Graph.Edges) != 1 || g.Graph.Edges[0].To != "azurerm_virtual_network.main" || g.BlastRadius != 8 {
+		t.Errorf("Graph = %+v, %v", g, err)
+	}
+
+	diff, err := c.GraphDiff(ctx, "a", "b")
+	if err != nil || diff.Delta != 2 || diff.Summary != "a..b" {
+		t.Errorf("GraphDiff = %+v, %v", diff, err)
+	}
+
+	yes := true
+	profile, err := c.PutRiskProfile(ctx, RiskProfile{
+		DefaultWeight: 2,
+		Types:         map[string]TypeRisk{"azurerm_key_vault": {Weight: 6, DataLoss: &yes}},
+		Environments:  map[string]EnvironmentRisk{"prod": {Multiplier: 1.5}},
+	})
+	if err != nil || profile.Types["azurerm_key_vault"].DataLoss == nil || profile.Environments["prod"].Multiplier != 1.5 {
+		t.Errorf("PutRiskProfile = %+v, %v", profile, err)
+	}
+
+	if job, err := c.CancelJob(ctx, "missing"); job != nil || !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("CancelJob = %+v, %v", job, err)
+	}
+}
+
+// TestSpecCoversRoutes keeps docs/openapi.yaml in step with the routes the
+// agent host registers.
+func TestSpecCoversRoutes(t *testing.T) {
+	main, err := os.ReadFile("../cmd/agent-host/main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec, err := os.ReadFile("../docs/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes := regexp.MustCompile(`mux\.HandleFunc\("(GET|POST|DELETE|PUT|PATCH) ([^"]+)"`).FindAllStringSubmatch(string(main), -1)
+	if len(routes) == 0 {
+		t.Fatal("no routes found in cmd/agent-host/main.go")
+	}
+	paths := regexp.MustCompile(`(?m)^  (/\S*):\n((?:    .*\n|\n)*)`).FindAllStringSubmatch(string(spec), -1)
+	methods := make(map[string]string)
+	for _, p := range paths {
+		methods[p[1]] = p[2]
+	}
+	for _, r := range routes {
+		method, path := strings.ToLower(r[1]), r[2]
+		if !strings.Contains("\n"+methods[path], "\n    "+method+":") {
+			t.Errorf("docs/openapi.yaml does not document %s %s", r[1], path)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/client"
+)
+
+const storage = `resource "azurerm_storage_account" "logs" {
+  name                     = "logs"
+  account_tier             = "Standard"
+  account_replication_type = "GRS"
+}`
+
+func Example() {
+	c := client.New("http://localhost:8080", client.WithSecret(os.Getenv("GITHUB_WEBHOOK_SECRET")))
+	ctx := context.Background()
+
+	cost, err := c.Cost(ctx, storage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(cost.Text)
+
+	policy, err := c.Policy(ctx, storage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(policy.Text)
+}
+
+func ExampleClient_Run() {
+	c := client.New("http://localhost:8080")
+	res, err := c.Run(context.Background(), "security", client.Request{
+		Prompt:     "Scan this configuration",
+		Code:       storage,
+		Categories: []string{"secrets", "network"},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, msg := range res.Errors {
+		log.Printf("agent error: %s", msg)
+	}
+	fmt.Printf("job %s:\n%s", res.JobID, res.Text)
+}
+
+func ExampleClient_GraphDiff() {
+	c := client.New("http://localhost:8080")
+	ctx := context.Background()
+
+	base, err := c.Run(ctx, "impact", client.Request{Prompt: "Analyze impact", Code: storage})
+	if err != nil {
+		log.Fatal(err)
+	}
+	head, err := c.Run(ctx, "impact", client.Request{Prompt: "Analyze impact", Code: storage, Baseline: base.JobID})
+	if err != nil {
+		log.Fatal(err)
+	}
+	diff, err := c.GraphDiff(ctx, base.JobID, head.JobID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(diff.Summary)
+}
+
+func ExampleClient_SLO() {
+	c := client.New("http://localhost:8080")
+	snap, err := c.SLO(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, o := range snap.Objectives {
+		if o.Status == client.SLOAtRisk || o.Status == client.SLOBreached {
+			fmt.Printf("%s is %s: %.2f%% compliant\n", o.Name, o.Status, o.Compliance*100)
+		}
+	}
+}
+
+func ExampleClient_ReplayFailed() {
+	c := client.New("http://localhost:8080", client.WithSecret(os.Getenv("GITHUB_WEBHOOK_SECRET")))
+	replayed, err := c.ReplayFailed(context.Background(), "audit", time.Now().Add(-24*time.Hour))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("replayed %d deliveries\n", len(replayed))
+}
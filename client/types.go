@@ -0,0 +1,797 @@
+package client
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Request is the input to an agent run.
+type Request struct {
+	// Prompt is the instruction, e.g. "Estimate the monthly cost".
+	Prompt string
+	// Code, when set, is appended to the prompt as a fenced block in
+	// Language ("hcl" when empty; "bicep" for Bicep, "yaml" for Pulumi
+	// YAML or CloudFormation).
+	Code     string
+	Language string
+	// SessionID carries conversation context across runs.
+	SessionID string
+	// Categories and SkipCategories scope security scans, e.g. "secrets".
+	Categories     []string
+	SkipCategories []string
+	// Baseline is the JobID of an earlier run to diff against.
+	Baseline string
+	// Environment and Version tag cost estimates with the deployment stage
+	// they are for, for later use with CostChange.
+	Environment string
+	Version     string
+	// Currency is the ISO 4217 code cost estimates are reported in, e.g.
+	// "EUR"; the host's CURRENCY when empty.
+	Currency string
+	// Locale is the locale amounts are written in, e.g. "de-DE"; the
+	// host's LOCALE when empty.
+	Locale string
+	// Budget is the monthly budget, in Currency, the cost agent checks its
+	// estimate against; the host's COST_BUDGET_MONTHLY when zero.
+	Budget float64
+	// Frameworks are the compliance frameworks the compliance agent audits
+	// against, e.g. "pci-dss"; all of them when empty.
+	Frameworks []string
+	// Repository names the repository the code comes from, e.g. "org/app",
+	// so rule simulations can group stored scans by repository.
+	Repository string
+	// Commit is the commit SHA the code was taken from, recorded with the
+	// compliance scores GET /trends charts.
+	Commit string
+	// IdempotencyKey, when set, is sent as the Idempotency-Key header: a
+	// retried Run with the same key and request gets the first run's
+	// output instead of notifying, approving or promoting again.
+	IdempotencyKey string
+}
+
+// Result is the collected output of an agent run.
+type Result struct {
+	// JobID identifies the run; use it as a Baseline or with GraphDiff.
+	JobID string
+	// Text is the agent's markdown output.
+	Text          string
+	References    []Reference
+	Confirmations []Confirmation
+	// Errors lists error messages the agent reported in its output.
+	Errors []string
+	// Cancelled is true when an operator cancelled the run.
+	Cancelled bool
+	// Verdict is the machine-readable verdict of the run's findings; nil
+	// when no agent reported findings.
+	Verdict *Verdict
+	// Summary is the orchestrator's aggregated result of a workflow; nil
+	// for single agents and workflows without structured results.
+	Summary *RunSummary
+}
+
+// Reference is a link returned by an agent.
+type Reference struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// Confirmation is a prompt asking the user to confirm an action.
+type Confirmation struct {
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// Agent describes a registered agent.
+type Agent struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+// Health is the /health response.
+type Health struct {
+	Status      string `json:"status"`
+	Service     string `json:"service"`
+	Version     string `json:"version"`
+	Environment string `json:"environment"`
+	Agents      int    `json:"agents"`
+}
+
+// BuildInfo describes a running binary.
+type BuildInfo struct {
+	Service   string `json:"service"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	// Platform is the binary's OS and architecture, e.g. "linux/arm64".
+	Platform string `json:"platform"`
+	Modified bool   `json:"modified,omitempty"`
+	// Upstreams is set by the gateway: the build of each upstream.
+	Upstreams []UpstreamBuild `json:"upstreams,omitempty"`
+}
+
+// UpstreamBuild is a gateway upstream and the build it reported.
+type UpstreamBuild struct {
+	URL    string     `json:"url"`
+	Agents []string   `json:"agents"`
+	Build  *BuildInfo `json:"build,omitempty"`
+	// Error is why Build is missing, e.g. the upstream was unreachable.
+	Error string `json:"error,omitempty"`
+}
+
+// Job is an in-flight agent run.
+type Job struct {
+	ID      string    `json:"id"`
+	AgentID string    `json:"agent_id"`
+	Started time.Time `json:"started"`
+}
+
+// GraphNode is a resource in a dependency graph.
+type GraphNode struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// GraphEdge is a dependency between two resources.
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Graph is a resource dependency graph. An edge means From references
+// (depends on) To.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphAnalysis is the dependency graph of one run.
+type GraphAnalysis struct {
+	ID          string    `json:"id"`
+	Created     time.Time `json:"created"`
+	Graph       Graph     `json:"graph"`
+	BlastRadius int       `json:"blast_radius"`
+}
+
+// GraphDiff compares the dependency graphs of two runs.
+type GraphDiff struct {
+	AddedNodes    []GraphNode       `json:"added_nodes"`
+	RemovedNodes  []GraphNode       `json:"removed_nodes"`
+	AddedEdges    []GraphEdge       `json:"added_edges"`
+	RemovedEdges  []GraphEdge       `json:"removed_edges"`
+	Before        int               `json:"blast_radius_before"`
+	After         int               `json:"blast_radius_after"`
+	Delta         int               `json:"blast_radius_delta"`
+	ChangedWeight int               `json:"changed_weight"`
+	Moved         map[string]string `json:"moved,omitempty"`
+	Imported      []string          `json:"imported,omitempty"`
+	Summary       string            `json:"summary"`
+	Mermaid       string            `json:"mermaid"`
+}
+
+// Analytics is the opt-in usage analytics snapshot.
+type Analytics struct {
+	Enabled  bool                  `json:"enabled"`
+	Since    time.Time             `json:"since,omitempty"`
+	Agents   map[string]AgentUsage `json:"agents,omitempty"`
+	Commands map[string]int        `json:"commands,omitempty"`
+	Findings FindingStats          `json:"findings"`
+	Daily    []DailyUsage          `json:"daily,omitempty"`
+}
+
+// AgentUsage is per-agent usage in Analytics.
+type AgentUsage struct {
+	Invocations int     `json:"invocations"`
+	Errors      int     `json:"errors"`
+	AvgMillis   float64 `json:"avg_ms"`
+	MaxMillis   int64   `json:"max_ms"`
+}
+
+// FindingStats counts findings across runs.
+type FindingStats struct {
+	Reported int `json:"reported"`
+	Open     int `json:"open"`
+	Resolved int `json:"resolved"`
+}
+
+// DailyUsage is one UTC day of activity.
+type DailyUsage struct {
+	Date             string `json:"date"`
+	Requests         int    `json:"requests"`
+	FindingsReported int    `json:"findings_reported"`
+}
+
+// SLO statuses.
+const (
+	SLONoData   = "no_data"
+	SLOOK       = "ok"
+	SLOAtRisk   = "at_risk"
+	SLOBreached = "breached"
+)
+
+// SLOReport is one objective's compliance over the window.
+type SLOReport struct {
+	Name  string `json:"name"`
+	Agent string `json:"agent"`
+	// Latency is the objective's threshold.
+	Latency         time.Duration `json:"latency"`
+	Target          float64       `json:"target"`
+	Status          string        `json:"status"`
+	Total           int           `json:"total"`
+	Good            int           `json:"good"`
+	Compliance      float64       `json:"compliance"`
+	BudgetRemaining float64       `json:"budget_remaining"`
+}
+
+// SLOAgentStats is an agent's availability and latency over the window.
+type SLOAgentStats struct {
+	Requests     int     `json:"requests"`
+	Probes       int     `json:"probes"`
+	Errors       int     `json:"errors"`
+	Availability float64 `json:"availability"`
+	P50Millis    int64   `json:"p50_ms"`
+	P95Millis    int64   `json:"p95_ms"`
+	P99Millis    int64   `json:"p99_ms"`
+}
+
+// SLOSnapshot is the /slo response.
+type SLOSnapshot struct {
+	Window     string                   `json:"window"`
+	Objectives []SLOReport              `json:"objectives"`
+	Agents     map[string]SLOAgentStats `json:"agents"`
+}
+
+// Delivery statuses.
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Delivery is a recorded notification delivery.
+type Delivery struct {
+	ID       string          `json:"id"`
+	Channel  string          `json:"channel"`
+	Created  time.Time       `json:"created"`
+	Status   string          `json:"status"`
+	Attempts int             `json:"attempts"`
+	Error    string          `json:"error,omitempty"`
+	Replays  int             `json:"replays,omitempty"`
+	Events   int             `json:"events,omitempty"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// DeliveryFilter narrows Deliveries; zero fields match everything.
+type DeliveryFilter struct {
+	Channel string
+	Status  string
+	Since   time.Time
+}
+
+// RulePackState is the rule pack installed on a host.
+type RulePackState struct {
+	// Version is "builtin" when no pack is installed.
+	Version string          `json:"version"`
+	Digest  string          `json:"digest,omitempty"`
+	Rules   int             `json:"rules"`
+	Pack    json.RawMessage `json:"pack,omitempty"`
+}
+
+// RiskProfile is how much changing each resource type weighs in the
+// impact agent's blast radius, and what destroying or updating it risks.
+type RiskProfile struct {
+	DefaultWeight int                        `json:"default_weight"`
+	Types         map[string]TypeRisk        `json:"types"`
+	Environments  map[string]EnvironmentRisk `json:"environments,omitempty"`
+}
+
+// TypeRisk is the risk of changing one resource type. In an environment,
+// unset fields keep the base profile's values.
+type TypeRisk struct {
+	Weight   int   `json:"weight,omitempty"`
+	DataLoss *bool `json:"data_loss,omitempty"`
+	Downtime *bool `json:"downtime,omitempty"`
+}
+
+// EnvironmentRisk scales and overrides the base profile for one
+// environment.
+type EnvironmentRisk struct {
+	Multiplier float64             `json:"multiplier,omitempty"`
+	Types      map[string]TypeRisk `json:"types,omitempty"`
+}
+
+// Simulation is the impact of a proposed rule replayed against the host's
+// stored scans.
+type Simulation struct {
+	RuleID       string  `json:"rule_id"`
+	Severity     string  `json:"severity"`
+	Scans        int     `json:"scans"`
+	Skipped      int     `json:"skipped,omitempty"`
+	Repos        int     `json:"repos"`
+	FailingRepos int     `json:"failing_repos"`
+	Resources    int     `json:"resources"`
+	Failing      int     `json:"failing"`
+	NewFailures  int     `json:"new_failures"`
+	FailureRate  float64 `json:"failure_rate"`
+	// SuggestedSeverity is the severity to roll the rule out at.
+	SuggestedSeverity string             `json:"suggested_severity"`
+	Recommendation    string             `json:"recommendation"`
+	Results           []SimulationResult `json:"results"`
+}
+
+// SimulationResult is the replay of one repository's latest scan.
+type SimulationResult struct {
+	ScanID    string    `json:"scan_id"`
+	Source    string    `json:"source,omitempty"`
+	Created   time.Time `json:"created"`
+	Resources int       `json:"resources"`
+	// NewFailures are the "type.name" addresses that would newly fail.
+	NewFailures []string `json:"new_failures,omitempty"`
+}
+
+// Rollout statuses.
+const (
+	RolloutCompleted  = "completed"
+	RolloutRolledBack = "rolled_back"
+	RolloutAborted    = "aborted"
+)
+
+// RolloutResult is the outcome of a fleet-wide rule pack rollout.
+type RolloutResult struct {
+	Version string          `json:"version"`
+	Digest  string          `json:"digest"`
+	Status  string          `json:"status"`
+	Targets []RolloutTarget `json:"targets"`
+}
+
+// RolloutTarget is one host's part in a rollout.
+type RolloutTarget struct {
+	Target          string `json:"target"`
+	PreviousVersion string `json:"previous_version,omitempty"`
+	Digest          string `json:"digest,omitempty"`
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty"`
+}
+
+// Verdict is the outcome of a run's findings under the host's severity
+// actions and thresholds.
+type Verdict struct {
+	// Action is none, notify, require_approval or block.
+	Action string `json:"action"`
+	Passed bool   `json:"passed"`
+	// ExitCode is 0 when the change passed, 1 when it is blocked and 2
+	// when it needs approval, for use as a CI step's exit status.
+	ExitCode int `json:"exit_code"`
+	// Counts holds the findings per severity, listing every severity.
+	Counts map[string]int `json:"counts"`
+	Total  int            `json:"total"`
+	// Triggers lists the severities that produced Action.
+	Triggers            []string `json:"triggers,omitempty"`
+	LowConfidenceCapped int      `json:"low_confidence_capped,omitempty"`
+	LowConfidenceAction string   `json:"low_confidence_action,omitempty"`
+}
+
+// RunSummary is the aggregated result of an orchestrated workflow.
+type RunSummary struct {
+	// Decision is "go" when the change may proceed and "no-go" otherwise.
+	Decision string `json:"decision"`
+	// Reasons explain a no-go decision.
+	Reasons []string `json:"reasons,omitempty"`
+	// Action is the verdict action of the findings; empty when no agent
+	// reported findings.
+	Action string         `json:"action,omitempty"`
+	Counts map[string]int `json:"counts"`
+	Total  int            `json:"total"`
+	// ComplianceScore is the overall compliance percentage, when scored.
+	ComplianceScore *int         `json:"compliance_score,omitempty"`
+	Cost            *CostSummary `json:"cost,omitempty"`
+	Agents          []AgentRun   `json:"agents"`
+}
+
+// CostSummary is the monthly estimate of a workflow. Current and Delta are
+// set when the cost before the change is known, as for Terraform plans.
+// Estimates in more than one currency are not summed: ByCurrency holds the
+// total of each, and Monthly and Currency are empty.
+type CostSummary struct {
+	Monthly    float64            `json:"monthly"`
+	Currency   string             `json:"currency"`
+	ByCurrency map[string]float64 `json:"by_currency,omitempty"`
+	Current    *float64           `json:"current,omitempty"`
+	Delta      *float64           `json:"delta,omitempty"`
+}
+
+// AgentRun is what one agent of a workflow reported.
+type AgentRun struct {
+	ID       string `json:"id"`
+	Findings int    `json:"findings"`
+	Failed   bool   `json:"failed,omitempty"`
+}
+
+// Finding is a finding as returned by Check.
+type Finding struct {
+	RuleID       string `json:"rule_id"`
+	Severity     string `json:"severity"`
+	Resource     string `json:"resource"`
+	ResourceType string `json:"resource_type"`
+	Message      string `json:"message"`
+	Remediation  string `json:"remediation,omitempty"`
+	// Source names the external scanner behind the finding; empty for
+	// native rules.
+	Source     string `json:"source,omitempty"`
+	Confidence string `json:"confidence,omitempty"`
+}
+
+// CheckResult is the verdict of a Check with the findings behind it.
+type CheckResult struct {
+	Verdict
+	Agents   []string  `json:"agents"`
+	Findings []Finding `json:"findings"`
+	// Errors lists errors the agents reported.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// ReportOptions shape a ComplianceReport.
+type ReportOptions struct {
+	// Format is "html" (the default), "csv" or "json".
+	Format  string
+	Title   string
+	Auditor string
+	// Notes are auditor notes by control ID, e.g. "4.2.1", or by framework
+	// and control ID, e.g. "pci-dss 4.2.1".
+	Notes map[string]string
+	// Findings are findings already reported for the code, such as those
+	// of a Check; ones naming a rule a control maps to fail the control.
+	Findings []Finding
+}
+
+// EvidenceReport is a ComplianceReport in JSON form.
+type EvidenceReport struct {
+	Title      string    `json:"title"`
+	Generated  time.Time `json:"generated"`
+	Auditor    string    `json:"auditor,omitempty"`
+	Format     string    `json:"format"`
+	CodeSHA256 string    `json:"code_sha256"`
+	Resources  []struct {
+		Address string `json:"address"`
+		Line    int    `json:"line,omitempty"`
+		SHA256  string `json:"sha256"`
+	} `json:"resources"`
+	Frameworks []struct {
+		ID        string    `json:"id"`
+		Title     string    `json:"title"`
+		Reference Reference `json:"reference"`
+		Summary   struct {
+			Total         int `json:"total"`
+			Passed        int `json:"passed"`
+			Failed        int `json:"failed"`
+			Skipped       int `json:"skipped"`
+			NotApplicable int `json:"not_applicable"`
+		} `json:"summary"`
+	} `json:"frameworks"`
+	Controls []EvidenceControl `json:"controls"`
+}
+
+// EvidenceControl is the status of one framework control in an
+// EvidenceReport: "pass", "fail", "skipped" or "not_applicable".
+type EvidenceControl struct {
+	Framework string    `json:"framework"`
+	ControlID string    `json:"control_id"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	Resources []string  `json:"resources,omitempty"`
+	Failures  []string  `json:"failures,omitempty"`
+	Assessed  time.Time `json:"assessed"`
+	Notes     string    `json:"notes,omitempty"`
+}
+
+// CostEstimate is a cost estimate as returned by Estimate. Amounts are
+// monthly, in Currency.
+type CostEstimate struct {
+	Currency string `json:"currency"`
+	// RequestedCurrency is set when the requested currency's exchange rate
+	// was unavailable and amounts are in USD.
+	RequestedCurrency string  `json:"requested_currency,omitempty"`
+	TotalMonthly      float64 `json:"total_monthly"`
+	// CurrentMonthly is the cost before a Terraform plan applies; nil for
+	// other input.
+	CurrentMonthly *float64       `json:"current_monthly,omitempty"`
+	Environment    string         `json:"environment,omitempty"`
+	Version        string         `json:"version,omitempty"`
+	Items          []CostLineItem `json:"items"`
+	LowConfidence  int            `json:"low_confidence_items"`
+	// ReservedMonthly is the on-demand price of capacity covered by
+	// reservations, already deducted from TotalMonthly.
+	ReservedMonthly float64 `json:"reserved_monthly,omitempty"`
+	// Budget is nil when no budget applies.
+	Budget *CostBudget `json:"budget,omitempty"`
+}
+
+// CostLineItem is one line item of an estimate. Source is where its price
+// came from: "table", "cache", "api" or "heuristic"; "reservation" items
+// are negative credits for reserved capacity.
+type CostLineItem struct {
+	Name       string  `json:"name"`
+	SKU        string  `json:"sku"`
+	Monthly    float64 `json:"monthly"`
+	Confidence string  `json:"confidence"`
+	Source     string  `json:"source"`
+}
+
+// CostBudget is an estimate checked against its monthly budget.
+type CostBudget struct {
+	Monthly     float64 `json:"monthly"`
+	Within      bool    `json:"within"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// CostChange compares the cost estimate of a release with the one before it
+// in the same environment.
+type CostChange struct {
+	Environment      string           `json:"environment"`
+	Version          string           `json:"version"`
+	ReportID         string           `json:"report_id"`
+	Monthly          float64          `json:"monthly"`
+	Currency         string           `json:"currency"`
+	PreviousVersion  string           `json:"previous_version,omitempty"`
+	PreviousReportID string           `json:"previous_report_id,omitempty"`
+	PreviousMonthly  float64          `json:"previous_monthly"`
+	Delta            float64          `json:"delta"`
+	Items            []CostItemChange `json:"items"`
+}
+
+// CostItemChange is a line item whose monthly cost changed.
+type CostItemChange struct {
+	Name     string  `json:"name"`
+	SKU      string  `json:"sku"`
+	Monthly  float64 `json:"monthly"`
+	Previous float64 `json:"previous"`
+	Delta    float64 `json:"delta"`
+}
+
+// ApplyTiming is how long one resource took to apply.
+type ApplyTiming struct {
+	ResourceType string  `json:"resource_type"`
+	Action       string  `json:"action"`
+	Seconds      float64 `json:"seconds"`
+}
+
+// RetentionStatus describes a host's report retention. Detailed and
+// Summary are Go durations, empty when unlimited or, for summaries, off.
+type RetentionStatus struct {
+	Detailed  string `json:"detailed,omitempty"`
+	Summary   string `json:"summary,omitempty"`
+	Archive   bool   `json:"archive"`
+	Reports   int    `json:"reports"`
+	Summaries int    `json:"summaries"`
+	// Pending counts reports evicted for space that wait to be archived.
+	Pending int            `json:"pending"`
+	Runs    []RetentionRun `json:"runs"`
+}
+
+// RetentionRun is one pass of the report retention policy.
+type RetentionRun struct {
+	ID           string               `json:"id"`
+	Trigger      string               `json:"trigger"`
+	Started      time.Time            `json:"started"`
+	Finished     time.Time            `json:"finished"`
+	Archived     []ArchivedReport     `json:"archived"`
+	Summarized   int                  `json:"summarized"`
+	Expired      int                  `json:"expired"`
+	Failed       []string             `json:"failed,omitempty"`
+	Verification *ArchiveVerification `json:"verification,omitempty"`
+}
+
+// ArchivedReport is a report copied to the archive.
+type ArchivedReport struct {
+	ReportID string `json:"report_id"`
+	Location string `json:"location"`
+	Size     int64  `json:"size"`
+	MD5      string `json:"md5"`
+}
+
+// ArchiveVerification is the result of checking a run's archived reports.
+type ArchiveVerification struct {
+	Checked  time.Time         `json:"checked"`
+	OK       bool              `json:"ok"`
+	Verified int               `json:"verified"`
+	Failed   map[string]string `json:"failed,omitempty"`
+}
+
+// ReportSummary is what is kept of a report past its retention.
+type ReportSummary struct {
+	ID         string         `json:"id"`
+	AgentID    string         `json:"agent_id"`
+	Created    time.Time      `json:"created"`
+	Findings   int            `json:"findings"`
+	Severities map[string]int `json:"severities,omitempty"`
+	Archive    string         `json:"archive,omitempty"`
+}
+
+// Share is a read-only link to a run's report.
+type Share struct {
+	ID       string    `json:"id"`
+	ReportID string    `json:"report_id"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	Revoked  bool      `json:"revoked,omitempty"`
+	// Token and URL are only set by CreateShare.
+	Token string `json:"token,omitempty"`
+	URL   string `json:"url,omitempty"`
+}
+
+// TrendQuery narrows Trends; zero fields match everything.
+type TrendQuery struct {
+	Repository string
+	// Framework is a compliance framework ID, or "overall" for the score
+	// across frameworks.
+	Framework string
+	Since     time.Time
+	// Interval is "day" or "week" to keep one point per interval.
+	Interval string
+}
+
+// TrendSeries is the compliance score history of one repository for one
+// framework.
+type TrendSeries struct {
+	Repository string       `json:"repository"`
+	Framework  string       `json:"framework"`
+	Points     []TrendPoint `json:"points"`
+	Latest     int          `json:"latest"`
+	Change     int          `json:"change"`
+}
+
+// TrendPoint is a compliance score at one audit.
+type TrendPoint struct {
+	Time   time.Time `json:"time"`
+	Score  int       `json:"score"`
+	Commit string    `json:"commit,omitempty"`
+}
+
+// UsageQuery narrows ModuleUsage; zero fields match everything.
+type UsageQuery struct {
+	Repository string
+	Since      time.Time
+}
+
+// ModuleUsage is how scanned code uses one catalog module. Repositories
+// count those whose latest scan calls the module, Requests every scan
+// that did.
+type ModuleUsage struct {
+	Module               string         `json:"module"`
+	Source               string         `json:"source"`
+	Approved             string         `json:"approved"`
+	Repositories         int            `json:"repositories"`
+	Requests             int            `json:"requests"`
+	OutdatedRepositories int            `json:"outdated_repositories"`
+	OutdatedRequests     int            `json:"outdated_requests"`
+	Versions             []VersionUsage `json:"versions"`
+}
+
+// VersionUsage is how often a module is called with one version
+// constraint or ref, and whether the catalog still approves it.
+type VersionUsage struct {
+	Version      string   `json:"version"`
+	Outdated     bool     `json:"outdated"`
+	Repositories []string `json:"repositories"`
+	Requests     int      `json:"requests"`
+}
+
+// ExceptionRequest is a governance exception request made in chat for one
+// finding, awaiting review.
+type ExceptionRequest struct {
+	ID            string             `json:"id"`
+	Status        string             `json:"status"`
+	RuleID        string             `json:"rule_id"`
+	RuleTitle     string             `json:"rule_title,omitempty"`
+	Severity      string             `json:"severity"`
+	ResourceType  string             `json:"resource_type"`
+	Resource      string             `json:"resource"`
+	Message       string             `json:"message"`
+	Remediation   string             `json:"remediation,omitempty"`
+	Reference     string             `json:"reference,omitempty"`
+	Justification string             `json:"justification"`
+	Expires       string             `json:"expires"`
+	Repository    string             `json:"repository,omitempty"`
+	Conversation  []ConversationTurn `json:"conversation,omitempty"`
+	Issue         string             `json:"issue,omitempty"`
+	Created       time.Time          `json:"created"`
+	// Waiver is the waivers file entry that grants the request; only
+	// Exception sets it.
+	Waiver *Waiver `json:"waiver,omitempty"`
+}
+
+// ApprovalRequest is a promotion the deploy agent holds until the
+// approvers of its target environment have signed off.
+type ApprovalRequest struct {
+	ID      string   `json:"id"`
+	Status  string   `json:"status"`
+	Source  string   `json:"source"`
+	Target  string   `json:"target"`
+	Version string   `json:"version"`
+	Reasons []string `json:"reasons"`
+	// Repository and Requester are set when the request knew them.
+	Repository string `json:"repository,omitempty"`
+	Requester  string `json:"requester,omitempty"`
+	// Approvers must all approve; when empty, any one approver will do.
+	Approvers []string           `json:"approvers,omitempty"`
+	Decisions []ApprovalDecision `json:"decisions,omitempty"`
+	// Gates are the DEPLOY_GATES the release passed, and MonthlyCost its
+	// estimate when a cost gate ran.
+	Gates       []GateResult `json:"gates,omitempty"`
+	MonthlyCost float64      `json:"monthly_cost,omitempty"`
+	Currency    string       `json:"currency,omitempty"`
+	Created     time.Time    `json:"created"`
+}
+
+// GateResult is the outcome of one pre-promotion gate.
+type GateResult struct {
+	Gate   string `json:"gate"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// Environment is one stage of the deploy agent's promotion pipeline.
+type Environment struct {
+	Name    string   `json:"name"`
+	Aliases []string `json:"aliases,omitempty"`
+	// From lists the environments it may be promoted from, the first being
+	// the default; empty means the environment before it.
+	From []string `json:"from,omitempty"`
+	// Approval holds every promotion into it for approval by Approvers.
+	Approval  bool     `json:"approval,omitempty"`
+	Approvers []string `json:"approvers,omitempty"`
+}
+
+// EnvironmentStatus is an environment with what is deployed to it.
+type EnvironmentStatus struct {
+	Environment
+	State EnvironmentState `json:"state"`
+}
+
+// EnvironmentState is the version deployed to an environment; Version is
+// empty when nothing has been promoted to it.
+type EnvironmentState struct {
+	Version     string       `json:"version"`
+	DeployedAt  time.Time    `json:"deployed_at"`
+	Status      string       `json:"status"`
+	Gates       []GateResult `json:"gates,omitempty"`
+	MonthlyCost float64      `json:"monthly_cost,omitempty"`
+	Currency    string       `json:"currency,omitempty"`
+}
+
+// Topology is the promotion pipeline, in order; the last environment is
+// production.
+type Topology struct {
+	Environments []Environment `json:"environments"`
+}
+
+// ApprovalDecision is an approver's decision on a promotion request.
+// Decision is "approve" or "reject" when sent; recorded decisions report
+// Approver and Approved instead.
+type ApprovalDecision struct {
+	ID       string    `json:"id,omitempty"`
+	Approver string    `json:"approver,omitempty"`
+	Decision string    `json:"decision,omitempty"`
+	Approved bool      `json:"approved,omitempty"`
+	Comment  string    `json:"comment,omitempty"`
+	Time     time.Time `json:"time,omitempty"`
+}
+
+// ConversationTurn is one message of the conversation behind an exception
+// request, with code left out.
+type ConversationTurn struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Waiver is an entry of the policy agent's waivers file.
+type Waiver struct {
+	Rule       string `json:"rule"`
+	Resource   string `json:"resource"`
+	Reason     string `json:"reason"`
+	Expires    string `json:"expires,omitempty"`
+	ApprovedBy string `json:"approved_by,omitempty"`
+}
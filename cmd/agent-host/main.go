@@ -6,11 +6,17 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -24,27 +30,58 @@ import (
 	"github.com/ghcp-iac/ghcp-iac-workflow/agents/orchestrator"
 	"github.com/ghcp-iac/ghcp-iac-workflow/agents/policy"
 	"github.com/ghcp-iac/ghcp-iac-workflow/agents/security"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/advisory"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/approval"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/auth"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/azauth"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/azpolicy"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/badge"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/buildinfo"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/config"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/exception"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/graph"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/llm"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/plugin"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/redact"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/repo"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/report"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/sarif"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/scanner"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/scheduler"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/server"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/slo"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/telemetry"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/transport/mcpstdio"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/trend"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/triage"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/verdict"
 )
 
-var (
-	version   = "dev"
-	commit    = "unknown"
-	buildTime = "unknown"
-)
+// service names the agent host in build info and health checks.
+const service = "ghcp-iac-agent-host"
 
 func main() {
 	transport := flag.String("transport", "http", "Transport mode: http or stdio")
+	showVersion := flag.Bool("version", false, "Print the build version and exit")
 	flag.Parse()
+	if *showVersion {
+		fmt.Println(buildinfo.Get(service))
+		return
+	}
 
+	if err := config.LoadDotEnv(); err != nil {
+		log.Fatalf("Invalid ENV_FILE: %v", err)
+	}
 	cfg := config.Load()
 
+	// Secrets found in analyzed code are masked in logs, stored reports
+	// and responses. Logs stay on stderr; stdout is for MCP.
+	secrets := redact.New()
+	log.SetOutput(secrets.Writer(os.Stderr))
+
 	// Create LLM client if enabled
 	var llmClient *llm.Client
 	if cfg.EnableLLM {
@@ -52,40 +89,273 @@ func main() {
 		log.Printf("LLM enabled: model=%s endpoint=%s", cfg.ModelName, cfg.ModelEndpoint)
 	}
 
+	if len(cfg.SecurityRuleFiles) > 0 {
+		n, err := analyzer.AddCatalogFiles(cfg.SecurityRuleFiles...)
+		if err != nil {
+			log.Fatalf("Invalid SECURITY_RULE_FILES: %v", err)
+		}
+		log.Printf("Loaded %d security rule(s) from %d catalog file(s)", n, len(cfg.SecurityRuleFiles))
+	}
+
 	// Build registry
 	registry := host.NewRegistry()
 
-	registry.Register(policy.New(policy.WithLLM(llmClient)))
-	registry.Register(security.New(security.WithLLM(llmClient)))
-	registry.Register(compliance.New(compliance.WithLLM(llmClient)))
-	registry.Register(cost.New(cost.WithLLM(llmClient)))
-	registry.Register(drift.New())
-	registry.Register(deploy.New())
-	registry.Register(notification.New(cfg.EnableNotifications))
-	registry.Register(impact.New(impact.WithLLM(llmClient)))
-	registry.Register(module.New())
+	registry.Register(policy.New(policy.WithLLM(llmClient), policy.WithAzurePolicies(azurePolicies(cfg)), azurePolicySource(cfg), policyWaivers(cfg)))
+	scanners, err := scanner.FromNames(cfg.ExternalScanners)
+	if err != nil {
+		log.Fatalf("Invalid EXTERNAL_SCANNERS: %v", err)
+	}
+	for _, s := range scanners {
+		if !s.Available() {
+			log.Printf("External scanner %s not found on PATH; skipping", s.Name())
+		}
+	}
+	advisories := advisoryFeed(cfg)
+	registry.Register(security.New(security.WithLLM(llmClient), security.WithScanners(scanners...), security.WithAdvisories(advisories), securityBaseline(cfg)))
+	frameworks, err := compliance.ParseFrameworks(cfg.ComplianceFrameworks)
+	if err != nil {
+		log.Fatalf("Invalid COMPLIANCE_FRAMEWORKS: %v", err)
+	}
+	trends, err := trend.NewFileStore(cfg.TrendsFile)
+	if err != nil {
+		log.Fatalf("Invalid TRENDS_FILE: %v", err)
+	}
+	registry.Register(compliance.New(compliance.WithLLM(llmClient), compliance.WithFrameworks(frameworks...), compliance.WithTrends(trends)))
+	prices := priceCache(cfg)
+	currency, err := cost.ParseCurrency(cfg.Currency)
+	if err != nil {
+		log.Fatalf("Invalid CURRENCY: %v", err)
+	}
+	if currency != cost.CurrencyUSD && prices == nil {
+		log.Printf("CURRENCY=%s needs ENABLE_COST_API for exchange rates; estimates stay in USD", currency)
+	}
+	locale, err := cost.ParseLocale(cfg.Locale)
+	if err != nil {
+		log.Fatalf("Invalid LOCALE: %v", err)
+	}
+	if cfg.CostBudgetMonthly < 0 {
+		log.Fatalf("Invalid COST_BUDGET_MONTHLY: must not be negative")
+	}
+	reservations, err := cost.ParseReservations(cfg.CostReservations)
+	if err != nil {
+		log.Fatalf("Invalid COST_RESERVATIONS: %v", err)
+	}
+	registry.Register(cost.New(cost.WithLLM(llmClient), cost.WithPriceCache(prices), cost.WithCurrency(currency), cost.WithLocale(locale), cost.WithBudget(cfg.CostBudgetMonthly), cost.WithReservations(reservations)))
+	driftSeverities, err := drift.ParseSeverities(cfg.DriftSeverities)
+	if err != nil {
+		log.Fatalf("Invalid DRIFT_SEVERITIES: %v", err)
+	}
+	sched := scheduler.New()
+	schedulePriceRefresh(sched, cfg, prices)
+	scheduleAdvisoryRefresh(sched, cfg, advisories)
+	pagerDuty, err := cfg.PagerDutyMapping()
+	if err != nil {
+		log.Fatalf("Invalid PAGERDUTY_SEVERITIES: %v", err)
+	}
+	channels := notificationChannels(cfg)
+	sender := notification.NewSender(channels, notificationLocales(cfg), notificationWebhooks(cfg, channels), notificationMailer(cfg, channels), notification.WithPagerDuty(pagerDuty), notification.WithRateLimit(cfg.NotifyRateLimit, cfg.NotifyBatchMax))
+	driftOpts := []drift.Option{drift.WithIgnore(cfg.DriftIgnore...), drift.WithSeverities(driftSeverities...)}
+	if cfg.EnableLiveInventory {
+		driftOpts = append(driftOpts, drift.WithInventory(liveInventory(cfg)))
+	}
+	drifts := drift.New(append(driftOpts, driftNotifier(cfg, sender)...)...)
+	registry.Register(drifts)
+	verdicts, err := verdict.ParsePolicy(cfg.SeverityActions)
+	if err != nil {
+		log.Fatalf("Invalid SEVERITY_ACTIONS: %v", err)
+	}
+	if verdicts.Thresholds, err = verdict.ParseThresholds(cfg.SeverityThresholds); err != nil {
+		log.Fatalf("Invalid SEVERITY_THRESHOLDS: %v", err)
+	}
+	if _, err := cfg.SARIFMapping(); err != nil {
+		log.Fatalf("Invalid SARIF_LEVELS: %v", err)
+	}
+	topology := loadTopology(cfg)
+	freezes, err := deploy.ParseFreezeWindows(cfg.DeployFreezeWindows)
+	if err != nil {
+		log.Fatalf("Invalid DEPLOY_FREEZE_WINDOWS: %v", err)
+	}
+	for _, w := range freezes {
+		requireEnvironment(topology, "DEPLOY_FREEZE_WINDOWS", w.Env)
+	}
+	changeWindows, err := deploy.ParseChangeWindows(cfg.DeployChangeWindows)
+	if err != nil {
+		log.Fatalf("Invalid DEPLOY_CHANGE_WINDOWS: %v", err)
+	}
+	for _, w := range changeWindows {
+		requireEnvironment(topology, "DEPLOY_CHANGE_WINDOWS", w.Env)
+	}
+	gates, err := deploy.ParseGates(cfg.DeployGates)
+	if err != nil {
+		log.Fatalf("Invalid DEPLOY_GATES: %v", err)
+	}
+	for _, g := range gates {
+		requireEnvironment(topology, "DEPLOY_GATES", g.Env)
+	}
+	// Output of recent runs, for read-only share links and the apply
+	// timings recorded against them
+	reports := report.NewStore(report.DefaultStoreSize, reportRetention(cfg)...)
+	scheduleReportRetention(sched, cfg, reports)
+	deployOpts := []deploy.Option{
+		deploy.WithVerdictPolicy(verdicts), deploy.WithFreezeWindows(freezes),
+		deploy.WithChangeWindows(changeWindows), deploy.WithApplyTimings(reports.ApplyDuration),
+		deploy.WithPromotionGates(registry.Get, gates), deploy.WithTopology(topology, cfg.DeployEnvironmentsFile),
+	}
+	if cfg.EnableEndpointCheck {
+		deployOpts = append(deployOpts, deploy.WithEndpointChecks(deploy.NewEndpointChecker(cfg.CertExpiryWindow)))
+	}
+	if cfg.EnableQuotaCheck {
+		deployOpts = append(deployOpts, deploy.WithQuotaChecks(quotaChecker(cfg)))
+	}
+	if lock := driftLock(cfg, sched, sender, drifts); lock != nil {
+		deployOpts = append(deployOpts, deploy.WithDriftLock(lock))
+	}
+	approvers, err := approval.ParseApprovers(cfg.DeployApprovers)
+	if err != nil {
+		log.Fatalf("Invalid DEPLOY_APPROVERS: %v", err)
+	}
+	for env := range approvers {
+		requireEnvironment(topology, "DEPLOY_APPROVERS", env)
+	}
+	approvals, err := approval.NewStore(cfg.ApprovalsFile)
+	if err != nil {
+		log.Fatalf("Invalid APPROVALS_FILE: %v", err)
+	}
+	deployOpts = append(deployOpts, deploy.WithApprovals(approvals, approvers), deploy.WithIdentity(func(ctx context.Context, token string) (string, error) {
+		return repo.NewPublisher(cfg.GitHubAPIURL, token).User(ctx)
+	}))
+	deployOpts = append(deployOpts, approvalNotifier(cfg, sender)...)
+	promotions := deploy.New(deployOpts...)
+	registry.Register(promotions)
+	registry.Register(notification.New(cfg.EnableNotifications, notification.WithSender(sender)))
+	// Dependency graphs of recent analyses, for baseline diffs
+	graphs := graph.NewStore(graph.DefaultStoreSize)
+	loadRiskProfile(cfg)
+	impactOpts := []impact.Option{impact.WithLLM(llmClient), impact.WithTimings(reports.ApplyDuration), impact.WithBaselines(func(id string) (graph.Graph, bool) {
+		a, ok := graphs.Get(id)
+		return a.Graph, ok
+	})}
+	if cfg.EnableLiveDependents {
+		impactOpts = append(impactOpts, impact.WithLiveDependents(liveDependents(cfg)))
+	}
+	registry.Register(impact.New(impactOpts...))
+	catalog, err := module.LoadCatalog(cfg.ModuleCatalog)
+	if err != nil {
+		log.Fatalf("Invalid MODULE_CATALOG: %v", err)
+	}
+	registry.Register(module.New(module.WithCatalog(catalog), module.WithPublisher(
+		func(ctx context.Context, token string, ref repo.Ref, files []protocol.SourceFile) (string, error) {
+			// Repositories are created as the caller, never with the
+			// server's GITHUB_TOKEN, so nobody writes where they could not.
+			if token == "" {
+				return "", errors.New("sign in to GitHub: publishing needs your own GitHub token")
+			}
+			return repo.NewPublisher(cfg.GitHubAPIURL, token).Create(ctx, ref.Owner, ref.Name, "Golden stack generated from the module catalog", files)
+		}), module.WithVerifier(module.GitHubVerifier(cfg.GitHubAPIURL, cfg.GitHubToken))))
+	pluginWorkflows := registerPlugins(cfg, registry)
 
 	// Orchestrator uses registry lookup
+	orchOpts := append([]orchestrator.Option{orchestrator.WithLLM(llmClient), orchestrator.WithVerdictPolicy(verdicts), orchestrator.WithDecisionLimits(cfg.VerdictMinCompliance, cfg.VerdictMaxCostDelta), orchestrator.WithRepoFetcher(
+		func(ctx context.Context, token string, ref repo.Ref) ([]protocol.SourceFile, error) {
+			// Only the caller's own token, so repo access follows their
+			// permissions rather than the server's GITHUB_TOKEN.
+			if token == "" {
+				return nil, errors.New("sign in to GitHub: scanning a repository needs your own GitHub token")
+			}
+			return repo.NewFetcher(cfg.GitHubAPIURL, token).Fetch(ctx, ref)
+		})}, pluginWorkflows...)
+	orchOpts = append(orchOpts, workflowNotifier(cfg, sender)...)
+	triageState, err := triage.NewStore(cfg.TriageStateFile)
+	if err != nil {
+		log.Fatalf("Invalid TRIAGE_STATE_FILE: %v", err)
+	}
+	orchOpts = append(orchOpts, orchestrator.WithTriage(triageState))
+	exceptions, err := exception.NewStore(cfg.ExceptionsFile)
+	if err != nil {
+		log.Fatalf("Invalid EXCEPTIONS_FILE: %v", err)
+	}
+	orchOpts = append(orchOpts, orchestrator.WithExceptions(exceptions, exceptionIssues(cfg)))
 	orch := orchestrator.New(func(id string) (protocol.Agent, bool) {
 		return registry.Get(id)
-	}, orchestrator.WithLLM(llmClient))
+	}, orchOpts...)
 	registry.Register(orch)
 
 	dispatcher := host.NewDispatcher(registry)
 	dispatcher.SetDefault("orchestrator")
+	dispatcher.Observe(graphs.Observe)
+	dispatcher.Observe(reports.Observe)
+	// Catalog module versions found in scanned code, for GET /modules/usage
+	moduleUsage, err := module.NewUsageStore(cfg.ModuleUsageFile)
+	if err != nil {
+		log.Fatalf("Invalid MODULE_USAGE_FILE: %v", err)
+	}
+	dispatcher.Observe(moduleUsage.Observe)
+
+	// Opt-in usage analytics; a disabled recorder is a no-op.
+	tel := telemetry.New(cfg.EnableTelemetry)
+	dispatcher.Observe(tel.Observe)
+	if tel.Enabled() {
+		log.Println("Telemetry enabled: aggregating usage analytics locally (no code content)")
+	}
+
+	// Fleet SLOs, fed by real traffic and synthetic probes
+	objectives, err := slo.ParseObjectives(cfg.SLOObjectives)
+	if err != nil {
+		log.Fatalf("Invalid SLO_OBJECTIVES: %v", err)
+	}
+	slos := slo.NewTracker(objectives, cfg.SLOWindow)
+	dispatcher.Observe(slos.Observe)
+	// Registered last so that it wraps every sink above.
+	dispatcher.Observe(secrets.Observe)
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	scheduleCostReport(sched, cfg, sender)
+	scheduleSLOProbes(sched, cfg, dispatcher, slos, sender)
+	sched.Start(ctx)
 
 	log.Printf("Registered %d agents, transport=%s", len(registry.List()), *transport)
+	if cfg.WarmUp {
+		start := time.Now()
+		n, err := registry.WarmUp(ctx)
+		if err != nil {
+			log.Printf("Warm-up: %v", err)
+		}
+		log.Printf("Warmed up %d agents in %s", n, time.Since(start).Round(time.Millisecond))
+	}
 
 	switch *transport {
 	case "stdio":
 		runStdio(registry, dispatcher)
 	default:
-		runHTTP(cfg, registry, dispatcher)
+		runHTTP(cfg, registry, dispatcher, tel, graphs, reports, sender, slos, verdicts, trends, exceptions, catalog, moduleUsage, promotions, approvals)
 	}
 }
 
-func runHTTP(cfg *config.Config, registry *host.Registry, dispatcher *host.Dispatcher) {
+// registerPlugins registers the plugins in PLUGIN_DIR as agents and returns
+// the orchestrator options adding them to their workflows.
+func registerPlugins(cfg *config.Config, registry *host.Registry) []orchestrator.Option {
+	manifests, err := plugin.Load(cfg.PluginDir)
+	if err != nil {
+		log.Fatalf("Invalid PLUGIN_DIR: %v", err)
+	}
+	var opts []orchestrator.Option
+	for _, m := range manifests {
+		if _, taken := registry.Get(m.ID); taken || m.ID == "orchestrator" {
+			log.Fatalf("Invalid PLUGIN_DIR: plugin %q conflicts with a built-in agent", m.ID)
+		}
+		registry.Register(plugin.New(m))
+		for _, w := range m.Workflows {
+			opts = append(opts, orchestrator.WithWorkflowAgents(orchestrator.Intent(w), m.ID))
+		}
+		log.Printf("Loaded plugin %s %s (workflows: %s)", m.ID, m.Version, strings.Join(m.Workflows, ", "))
+	}
+	return opts
+}
+
+func runHTTP(cfg *config.Config, registry *host.Registry, dispatcher *host.Dispatcher, tel *telemetry.Recorder, graphs *graph.Store, reports *report.Store, sender *notification.Sender, slos *slo.Tracker, verdicts verdict.Policy, trends trend.Store, exceptions *exception.Store, catalog module.Catalog, moduleUsage *module.UsageStore, promotions *deploy.Agent, approvals *approval.Store) {
 	mux := http.NewServeMux()
+	jobs := host.NewJobs()
 
 	// Agent endpoint — uses orchestrator as default
 	mux.HandleFunc("POST /agent", func(w http.ResponseWriter, r *http.Request) {
@@ -101,24 +371,25 @@ func runHTTP(cfg *config.Config, registry *host.Registry, dispatcher *host.Dispa
 			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
 			return
 		}
+		if wantsProgress(r) {
+			sse.EnableProgress()
+		}
 
 		agentReq := protocol.AgentRequest{
 			Messages: make([]protocol.Message, len(req.Messages)),
+			Metadata: requestMetadata(r, req),
 			Token:    r.Header.Get("X-GitHub-Token"),
 		}
 		for i, m := range req.Messages {
 			agentReq.Messages[i] = protocol.Message{Role: m.Role, Content: m.Content}
 		}
 		host.ParseAndEnrich(&agentReq)
-
-		// Add timeout for agent dispatch
-		ctx, cancel := context.WithTimeout(r.Context(), cfg.AgentTimeout)
-		defer cancel()
-
-		if err := dispatcher.Dispatch(ctx, "", agentReq, sse); err != nil {
-			sse.SendError(err.Error())
+		if err := dispatcher.Permit(r.Context(), "", agentReq); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
 		}
-		sse.SendDone()
+
+		dispatchJob(r.Context(), w, cfg, jobs, dispatcher, "", agentReq, sse, verdicts)
 	})
 
 	// Specific agent endpoint
@@ -137,86 +408,1772 @@ func runHTTP(cfg *config.Config, registry *host.Registry, dispatcher *host.Dispa
 			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
 			return
 		}
+		if wantsProgress(r) {
+			sse.EnableProgress()
+		}
 
 		agentReq := protocol.AgentRequest{
 			Messages: make([]protocol.Message, len(req.Messages)),
+			Metadata: requestMetadata(r, req),
 			Token:    r.Header.Get("X-GitHub-Token"),
 		}
 		for i, m := range req.Messages {
 			agentReq.Messages[i] = protocol.Message{Role: m.Role, Content: m.Content}
 		}
 		host.ParseAndEnrich(&agentReq)
+		if err := dispatcher.Permit(r.Context(), agentID, agentReq); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 
-		// Add timeout for agent dispatch
-		ctx, cancel := context.WithTimeout(r.Context(), cfg.AgentTimeout)
-		defer cancel()
+		dispatchJob(r.Context(), w, cfg, jobs, dispatcher, agentID, agentReq, sse, verdicts)
+	})
 
-		if err := dispatcher.Dispatch(ctx, agentID, agentReq, sse); err != nil {
-			sse.SendError(err.Error())
+	// In-flight jobs; DELETE cancels one
+	mux.HandleFunc("GET /jobs", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(jobs.List())
+	})
+	mux.HandleFunc("DELETE /jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := jobs.Cancel(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
 		}
-		sse.SendDone()
+		log.Printf("Job %s (%s) cancelled by %s", job.ID, job.AgentID, server.ClientIP(r))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
 	})
 
-	// Agent listing
-	mux.HandleFunc("GET /agents", func(w http.ResponseWriter, _ *http.Request) {
+	// Dependency graph of a stored analysis (job ID), for UIs
+	mux.HandleFunc("GET /graph/{id}", func(w http.ResponseWriter, r *http.Request) {
+		a, ok := graphs.Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "Unknown analysis", http.StatusNotFound)
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(registry.List())
+		json.NewEncoder(w).Encode(struct {
+			graph.Analysis
+			BlastRadius int `json:"blast_radius"`
+		}{a, a.Graph.BlastRadius()})
 	})
 
-	// Health check
-	mux.HandleFunc("GET /health", func(w http.ResponseWriter, _ *http.Request) {
+	// Dependency graph diff between two stored analyses (job IDs)
+	mux.HandleFunc("GET /graph/diff", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		before, ok := graphs.Get(q.Get("before"))
+		if !ok {
+			http.Error(w, "Unknown before analysis", http.StatusNotFound)
+			return
+		}
+		after, ok := graphs.Get(q.Get("after"))
+		if !ok {
+			http.Error(w, "Unknown after analysis", http.StatusNotFound)
+			return
+		}
+		diff := graph.Compare(before.Graph, after.Graph)
+		if q.Get("format") == "mermaid" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprint(w, diff.Mermaid())
+			return
+		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"status":      "ok",
-			"service":     "ghcp-iac-agent-host",
-			"version":     version,
-			"environment": cfg.Environment,
-			"agents":      len(registry.List()),
-		})
+		json.NewEncoder(w).Encode(struct {
+			graph.Diff
+			Summary string `json:"summary"`
+			Mermaid string `json:"mermaid"`
+		}{diff, diff.Summary(), diff.Mermaid()})
 	})
 
-	port := cfg.Port
-	if port == "" {
-		port = "8080"
-	}
+	// Cost estimate as JSON, for pipelines and UIs
+	mux.HandleFunc("POST /estimate", func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBodySize)
+		var req server.AgentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		agent, ok := registry.Get("cost")
+		estimator, isCost := agent.(*cost.Agent)
+		if !ok || !isCost {
+			http.Error(w, "Cost estimator not available", http.StatusNotFound)
+			return
+		}
 
-	// Wrap with signature verification middleware
-	var handler http.Handler = mux
-	handler = auth.Middleware(cfg.WebhookSecret, cfg.IsDev())(handler)
+		agentReq := protocol.AgentRequest{
+			Messages: make([]protocol.Message, len(req.Messages)),
+			Metadata: requestMetadata(r, req),
+		}
+		for i, m := range req.Messages {
+			agentReq.Messages[i] = protocol.Message{Role: m.Role, Content: m.Content}
+		}
+		host.ParseAndEnrich(&agentReq)
 
-	// Configure server with timeouts
-	srv := &http.Server{
-		Addr:         ":" + port,
-		Handler:      handler,
-		ReadTimeout:  cfg.ReadTimeout,
-		WriteTimeout: cfg.WriteTimeout,
-		IdleTimeout:  cfg.IdleTimeout,
-	}
+		estimate, err := estimator.Estimate(r.Context(), agentReq)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(estimate)
+	})
 
-	// Graceful shutdown
-	go func() {
-		sigCh := make(chan os.Signal, 1)
-		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
-		<-sigCh
-		log.Println("Shutting down server...")
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("Server shutdown error: %v", err)
+	// runChecks dispatches a request body to the agents listed in the
+	// "agents" query parameter (defaultAgent when absent) and gathers their
+	// findings. It writes the error response and returns false when the
+	// request is invalid.
+	runChecks := func(w http.ResponseWriter, r *http.Request, defaultAgent string) (*checkEmitter, *protocol.IaCInput, []string, bool) {
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBodySize)
+		var req server.AgentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return nil, nil, nil, false
+		}
+		agentIDs := []string{defaultAgent}
+		if list := r.URL.Query().Get("agents"); list != "" {
+			agentIDs = strings.Split(list, ",")
+		}
+		for i, id := range agentIDs {
+			agentIDs[i] = strings.TrimSpace(id)
+			if _, ok := registry.Get(agentIDs[i]); !ok {
+				http.Error(w, fmt.Sprintf("Unknown agent %q", agentIDs[i]), http.StatusNotFound)
+				return nil, nil, nil, false
+			}
 		}
-	}()
 
-	log.Printf("agent-host listening on :%s (version=%s commit=%s)", port, version, commit)
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		log.Fatalf("Server error: %v", err)
+		agentReq := protocol.AgentRequest{
+			Messages: make([]protocol.Message, len(req.Messages)),
+			Metadata: requestMetadata(r, req),
+			Token:    r.Header.Get("X-GitHub-Token"),
+		}
+		for i, m := range req.Messages {
+			agentReq.Messages[i] = protocol.Message{Role: m.Role, Content: m.Content}
+		}
+		host.ParseAndEnrich(&agentReq)
+		if agentReq.IaC == nil {
+			http.Error(w, "No infrastructure code found in the request", http.StatusBadRequest)
+			return nil, nil, nil, false
+		}
+		for _, id := range agentIDs {
+			if err := dispatcher.Permit(r.Context(), id, agentReq); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return nil, nil, nil, false
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.AgentTimeout)
+		defer cancel()
+		checks := &checkEmitter{}
+		for _, id := range agentIDs {
+			if err := dispatcher.Dispatch(ctx, id, agentReq, checks); err != nil {
+				checks.SendError(fmt.Sprintf("%s: %v", id, err))
+			}
+		}
+		return checks, agentReq.IaC, agentIDs, true
 	}
-}
 
-func runStdio(registry *host.Registry, dispatcher *host.Dispatcher) {
-	log.SetOutput(os.Stderr) // Keep logs on stderr, stdout is for MCP
-	log.Println("Starting MCP stdio transport")
-	adapter := mcpstdio.NewAdapter(registry, dispatcher, os.Stdin, os.Stdout)
-	if err := adapter.Run(context.Background()); err != nil {
-		log.Fatalf("MCP stdio error: %v", err)
+	// Machine-readable verdict for CI gates
+	mux.HandleFunc("POST /check", func(w http.ResponseWriter, r *http.Request) {
+		checks, _, agentIDs, ok := runChecks(w, r, "policy")
+		if !ok {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(checkResult{
+			Report:   verdicts.Evaluate(checks.findings).Report(),
+			Agents:   agentIDs,
+			Findings: checks.results(),
+			Errors:   checks.errors,
+		})
+	})
+
+	// SARIF for GitHub code scanning uploads. SARIF_LEVELS was validated
+	// at startup.
+	sarifLevels, _ := cfg.SARIFMapping()
+	mux.HandleFunc("POST /scan", func(w http.ResponseWriter, r *http.Request) {
+		checks, iac, _, ok := runChecks(w, r, "security")
+		if !ok {
+			return
+		}
+		if len(checks.errors) > 0 {
+			http.Error(w, strings.Join(checks.errors, "; "), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/sarif+json")
+		json.NewEncoder(w).Encode(sarif.Build(checks.findings, iac, sarif.Options{
+			Path:        r.URL.Query().Get("path"),
+			Levels:      sarifLevels,
+			ToolVersion: buildinfo.Version,
+		}))
+	})
+
+	// Compliance evidence report for auditors, as a download
+	mux.HandleFunc("POST /report", func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = compliance.ReportHTML
+		}
+		if !slices.Contains(compliance.ReportFormats, format) {
+			http.Error(w, fmt.Sprintf("format must be one of %s", strings.Join(compliance.ReportFormats, ", ")), http.StatusBadRequest)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBodySize)
+		var req server.ReportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		agent, ok := registry.Get("compliance")
+		auditor, isCompliance := agent.(*compliance.Agent)
+		if !ok || !isCompliance {
+			http.Error(w, "Compliance auditor not available", http.StatusNotFound)
+			return
+		}
+
+		agentReq := protocol.AgentRequest{
+			Messages: make([]protocol.Message, len(req.Messages)),
+			Metadata: requestMetadata(r, req.AgentRequest),
+		}
+		for i, m := range req.Messages {
+			agentReq.Messages[i] = protocol.Message{Role: m.Role, Content: m.Content}
+		}
+		host.ParseAndEnrich(&agentReq)
+		opts := compliance.ReportOptions{Title: req.Title, Auditor: req.Auditor, Notes: req.Notes}
+		for _, f := range req.Findings {
+			opts.Findings = append(opts.Findings, protocol.Finding{
+				RuleID: f.RuleID, Severity: protocol.NormalizeSeverity(string(f.Severity)), Resource: f.Resource, ResourceType: f.ResourceType,
+				Message: f.Message, Remediation: f.Remediation, Source: f.Source,
+			})
+		}
+		report, err := auditor.Report(agentReq, opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		name := "compliance-report-" + report.Generated.Format("20060102-150405") + "." + format
+		w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+		switch format {
+		case compliance.ReportCSV:
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			err = report.WriteCSV(w)
+		case compliance.ReportJSON:
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(report)
+		default:
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			err = report.WriteHTML(w)
+		}
+		if err != nil {
+			log.Printf("Compliance report: %v", err)
+			return
+		}
+		log.Printf("Compliance report (%s) for %d resource(s) generated by %s", format, len(report.Resources), server.ClientIP(r))
+	})
+
+	// Cost added by a release, from stored estimates tagged with its stage
+	mux.HandleFunc("GET /reports/costs", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		env, version := q.Get("environment"), q.Get("version")
+		if env == "" || version == "" {
+			http.Error(w, "environment and version are required", http.StatusBadRequest)
+			return
+		}
+		change, err := reports.CostChange(env, version)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("No cost estimate for %s %s", env, version), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(change)
+	})
+
+	// Apply durations measured by the pipeline, for impact estimates
+	mux.HandleFunc("POST /reports/{id}/timings", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Timings []report.ApplyTiming `json:"timings"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, cfg.MaxBodySize)).Decode(&body); err != nil || len(body.Timings) == 0 {
+			http.Error(w, "Invalid body: expected {\"timings\": [...]}", http.StatusBadRequest)
+			return
+		}
+		switch err := reports.RecordTimings(r.PathValue("id"), body.Timings); {
+		case errors.Is(err, report.ErrNotFound):
+			http.Error(w, "Report not found", http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+
+	// Read-only share links for stored reports (run outputs by job ID)
+	mux.HandleFunc("POST /reports/{id}/shares", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			TTL string `json:"ttl"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, cfg.MaxBodySize)).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		ttl := cfg.ShareLinkTTL
+		if body.TTL != "" {
+			d, err := time.ParseDuration(body.TTL)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("invalid ttl %q", body.TTL), http.StatusBadRequest)
+				return
+			}
+			ttl = d
+		}
+		share, err := reports.Share(r.PathValue("id"), ttl)
+		if errors.Is(err, report.ErrNotFound) {
+			http.Error(w, "Report not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Share link %s for report %s created by %s, expires %s", share.ID, share.ReportID, server.ClientIP(r), share.Expires.Format(time.RFC3339))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(struct {
+			report.Share
+			URL string `json:"url"`
+		}{share, shareURL(cfg, r, share.Token)})
+	})
+	mux.HandleFunc("GET /reports/{id}/shares", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reports.Shares(r.PathValue("id")))
+	})
+	// Report retention and archival
+	mux.HandleFunc("GET /reports/retention", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reports.RetentionStatus())
+	})
+	mux.HandleFunc("POST /reports/retention/runs", func(w http.ResponseWriter, r *http.Request) {
+		run := reports.ApplyRetention(r.Context(), report.TriggerManual)
+		log.Printf("Report retention run %s by %s: %d archived, %d summarized, %d summaries expired, %d failed",
+			run.ID, server.ClientIP(r), len(run.Archived), run.Summarized, run.Expired, len(run.Failed))
+		w.Header().Set("Content-Type", "application/json")
+		if len(run.Failed) > 0 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		json.NewEncoder(w).Encode(run)
+	})
+	mux.HandleFunc("POST /reports/retention/runs/{id}/verify", func(w http.ResponseWriter, r *http.Request) {
+		run, err := reports.VerifyRun(r.Context(), r.PathValue("id"))
+		switch {
+		case errors.Is(err, report.ErrRunNotFound):
+			http.Error(w, "Retention run not found", http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(run)
+	})
+	mux.HandleFunc("GET /reports/summaries", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reports.Summaries(r.URL.Query().Get("agent")))
+	})
+
+	// Live governance status badges for READMEs and portals
+	mux.HandleFunc("GET /badge/{kind}", func(w http.ResponseWriter, r *http.Request) {
+		kind := r.PathValue("kind")
+		if !slices.Contains(badgeKinds, kind) {
+			http.Error(w, fmt.Sprintf("badge must be one of %s", strings.Join(badgeKinds, ", ")), http.StatusNotFound)
+			return
+		}
+		q := r.URL.Query()
+		repository := q.Get("repo")
+		if repository == "" {
+			http.Error(w, "repo is required", http.StatusBadRequest)
+			return
+		}
+		agent, _ := registry.Get("compliance")
+		auditor, _ := agent.(*compliance.Agent)
+		b := projectBadge(kind, repository, q.Get("environment"), reports, auditor)
+		if label := q.Get("label"); label != "" {
+			b.Label = label
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Cache-Control", "no-cache, max-age=0")
+		if err := b.WriteSVG(w); err != nil {
+			log.Printf("Badge %s for %s: %v", kind, repository, err)
+		}
+	})
+	// Compliance score history by repository and framework, for charts
+	mux.HandleFunc("GET /trends", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		interval := q.Get("interval")
+		if interval != "" && interval != trend.IntervalDay && interval != trend.IntervalWeek {
+			http.Error(w, "interval must be day or week", http.StatusBadRequest)
+			return
+		}
+		since, err := parseSince(q.Get("since"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		audits, err := trends.Audits(trend.Query{Repository: q.Get("repo"), Since: since})
+		if err != nil {
+			log.Printf("Load compliance trends: %v", err)
+			http.Error(w, "Trends unavailable", http.StatusInternalServerError)
+			return
+		}
+		series := trend.Trends(audits, q.Get("framework"), interval)
+		if series == nil {
+			series = []trend.Series{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(series)
+	})
+	// Catalog module adoption and outdated versions across scanned code
+	mux.HandleFunc("GET /modules/usage", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		since, err := parseSince(q.Get("since"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		usage := catalog.Usage(moduleUsage.Scans(module.UsageQuery{Repository: q.Get("repo"), Since: since}))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(usage)
+	})
+	// Governance exception requests made in chat, for reviewers
+	mux.HandleFunc("GET /exceptions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(exceptions.List(r.URL.Query().Get("status")))
+	})
+	mux.HandleFunc("GET /exceptions/{id}", func(w http.ResponseWriter, r *http.Request) {
+		req, ok := exceptions.Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "Exception request not found", http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("format") == "markdown" {
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			io.WriteString(w, "# "+req.Title()+"\n\n"+req.Markdown())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			exception.Request
+			Waiver analyzer.Waiver `json:"waiver"`
+		}{req, req.Waiver()})
+	})
+	// Promotions held for approval, and approvers' decisions on them
+	mux.HandleFunc("GET /approvals", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(approvals.List(r.URL.Query().Get("status")))
+	})
+	mux.HandleFunc("GET /approvals/{id}", func(w http.ResponseWriter, r *http.Request) {
+		req, ok := approvals.Get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, "Approval request not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(req)
+	})
+	mux.HandleFunc("POST /approvals", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ID       string `json:"id"`
+			Decision string `json:"decision"`
+			Comment  string `json:"comment"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, cfg.MaxBodySize)).Decode(&body); err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		if body.ID == "" || (body.Decision != "approve" && body.Decision != "reject") {
+			http.Error(w, `id and decision ("approve" or "reject") are required`, http.StatusBadRequest)
+			return
+		}
+		// The approver is whoever the caller's token belongs to, never a
+		// name from the body.
+		req, err := promotions.DecideAs(r.Context(), body.ID, r.Header.Get("X-GitHub-Token"), body.Decision == "approve", body.Comment)
+		switch {
+		case errors.Is(err, deploy.ErrUnidentified):
+			http.Error(w, "Sign in to GitHub: send the approver's token in X-GitHub-Token", http.StatusUnauthorized)
+			return
+		case errors.Is(err, approval.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, approval.ErrNotApprover), errors.Is(err, approval.ErrSelfApproval):
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		case errors.Is(err, approval.ErrNotPending), errors.Is(err, approval.ErrDecided), errors.Is(err, deploy.ErrFrozen):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			log.Printf("Approval %s: %v", body.ID, err)
+			http.Error(w, "Failed to record decision", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Approval %s: %s by %s from %s, now %s", req.ID, body.Decision, req.Decisions[len(req.Decisions)-1].Approver, server.ClientIP(r), req.Status)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(req)
+	})
+	// The promotion pipeline: environments, their order, promotion paths
+	// and approval rules
+	mux.HandleFunc("GET /environments", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(promotions.Environments())
+	})
+	mux.HandleFunc("GET /environments/{name}", func(w http.ResponseWriter, r *http.Request) {
+		for _, env := range promotions.Environments() {
+			if env.Name == strings.ToLower(r.PathValue("name")) {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(env)
+				return
+			}
+		}
+		http.Error(w, "Environment not found", http.StatusNotFound)
+	})
+	mux.HandleFunc("POST /environments", func(w http.ResponseWriter, r *http.Request) {
+		env, ok := decodeEnvironment(w, r, cfg.MaxBodySize)
+		if !ok {
+			return
+		}
+		topology, err := promotions.AddEnvironment(env, r.URL.Query().Get("before"))
+		if !environmentChanged(w, r, "added", env.Name, topology, err) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(topology)
+	})
+	mux.HandleFunc("PUT /environments/{name}", func(w http.ResponseWriter, r *http.Request) {
+		env, ok := decodeEnvironment(w, r, cfg.MaxBodySize)
+		if !ok {
+			return
+		}
+		if env.Name != "" && !strings.EqualFold(env.Name, r.PathValue("name")) {
+			http.Error(w, "name does not match the environment in the path; rename by adding a new environment", http.StatusBadRequest)
+			return
+		}
+		env.Name = r.PathValue("name")
+		topology, err := promotions.PutEnvironment(env)
+		if !environmentChanged(w, r, "replaced", env.Name, topology, err) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(topology)
+	})
+	mux.HandleFunc("DELETE /environments/{name}", func(w http.ResponseWriter, r *http.Request) {
+		topology, err := promotions.DeleteEnvironment(r.PathValue("name"))
+		if !environmentChanged(w, r, "deleted", r.PathValue("name"), topology, err) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("DELETE /shares/{id}", func(w http.ResponseWriter, r *http.Request) {
+		share, err := reports.Revoke(r.PathValue("id"))
+		if err != nil {
+			http.Error(w, "Share link not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Share link %s for report %s revoked by %s", share.ID, share.ReportID, server.ClientIP(r))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(share)
+	})
+	mux.HandleFunc("GET /shared/{token}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+		rep, share, err := reports.Open(r.PathValue("token"))
+		switch {
+		case errors.Is(err, report.ErrShareNotFound):
+			http.Error(w, "Link not found", http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, "This link has expired or been revoked", http.StatusGone)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+		if err := report.Render(w, rep, share); err != nil {
+			log.Printf("Render shared report %s: %v", rep.ID, err)
+		}
+	})
+
+	// Webhook delivery log; replays re-send with a fresh signature
+	mux.HandleFunc("GET /webhooks/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		since, err := parseSince(q.Get("since"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(sender.Deliveries(q.Get("channel"), q.Get("status"), since))
+	})
+	mux.HandleFunc("POST /webhooks/deliveries/{id}/replay", func(w http.ResponseWriter, r *http.Request) {
+		d, err := sender.Replay(r.Context(), r.PathValue("id"))
+		if errors.Is(err, notification.ErrDeliveryNotFound) {
+			http.Error(w, "Delivery not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		json.NewEncoder(w).Encode(d)
+	})
+	// Bulk replay of failed deliveries so consumers can catch up after an outage
+	mux.HandleFunc("POST /webhooks/replay", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		since, err := parseSince(q.Get("since"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		failed := sender.Deliveries(q.Get("channel"), notification.DeliveryFailed, since)
+		replayed := make([]notification.Delivery, 0, len(failed))
+		for _, d := range failed {
+			d, _ = sender.Replay(r.Context(), d.ID)
+			replayed = append(replayed, d)
+		}
+		log.Printf("Replayed %d failed webhook deliveries for %s", len(replayed), server.ClientIP(r))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(replayed)
+	})
+
+	// Agent listing
+	mux.HandleFunc("GET /agents", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(registry.List())
+	})
+
+	// Usage analytics (opt-in via ENABLE_TELEMETRY)
+	mux.HandleFunc("GET /analytics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tel.Snapshot())
+	})
+
+	// Fleet SLO compliance over the rolling window
+	mux.HandleFunc("GET /slo", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(slos.Snapshot())
+	})
+	mux.HandleFunc("GET /slo/{name}", func(w http.ResponseWriter, r *http.Request) {
+		report, ok := slos.Report(r.PathValue("name"))
+		if !ok {
+			http.Error(w, "unknown objective", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	})
+
+	// Rule packs: this host's installed pack, and fleet-wide rollouts
+	mux.HandleFunc("GET /rules/pack", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(analyzer.CurrentRulePack())
+	})
+	mux.HandleFunc("PUT /rules/pack", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodySize))
+		if err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		pack, err := analyzer.LoadRulePack(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		analyzer.InstallRulePack(pack)
+		log.Printf("Rule pack %s (%s) installed by %s", pack.Version, pack.Digest, server.ClientIP(r))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(analyzer.CurrentRulePack())
+	})
+	mux.HandleFunc("DELETE /rules/pack", func(w http.ResponseWriter, r *http.Request) {
+		analyzer.InstallRulePack(nil)
+		log.Printf("Rule pack removed by %s", server.ClientIP(r))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(analyzer.CurrentRulePack())
+	})
+	mux.HandleFunc("POST /rules/simulate", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodySize))
+		if err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		pr, err := analyzer.ParsePackRule(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		last := defaultSimulateScans
+		if v := r.URL.Query().Get("last"); v != "" {
+			if last, err = strconv.Atoi(v); err != nil || last < 1 {
+				http.Error(w, "last must be a positive integer", http.StatusBadRequest)
+				return
+			}
+		}
+		var scans []analyzer.Scan
+		for _, rep := range reports.Recent(last) {
+			scans = append(scans, analyzer.Scan{ID: rep.ID, Source: rep.Source, Created: rep.Created, Resources: rep.Resources, Findings: rep.Findings})
+		}
+
+		if !wantsProgress(r) {
+			sim, err := analyzer.Simulate(r.Context(), pr.Rule(), scans, nil)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			log.Printf("Rule %s simulated against %d scan(s) by %s: %d new failure(s)", sim.RuleID, sim.Scans, server.ClientIP(r), sim.NewFailures)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(sim)
+			return
+		}
+		sse := server.NewSSEWriter(w)
+		if sse == nil {
+			http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+			return
+		}
+		sse.EnableProgress()
+		sim, err := analyzer.Simulate(r.Context(), pr.Rule(), scans, sse.ReportProgress)
+		if err != nil {
+			sse.SendError(err.Error())
+			return
+		}
+		log.Printf("Rule %s simulated against %d scan(s) by %s: %d new failure(s)", sim.RuleID, sim.Scans, server.ClientIP(r), sim.NewFailures)
+		sse.SendEvent("simulation", sim)
+		sse.SendDone()
+	})
+	packTargets := []orchestrator.PackTarget{orchestrator.LocalPackTarget()}
+	for _, u := range cfg.RulePackTargets {
+		packTargets = append(packTargets, orchestrator.HTTPPackTarget(u, cfg.WebhookSecret, &http.Client{Timeout: 30 * time.Second}))
+	}
+	mux.HandleFunc("POST /rules/rollout", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodySize))
+		if err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		res, err := orchestrator.RolloutRulePack(r.Context(), packTargets, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("Rule pack %s rollout to %d host(s) by %s: %s", res.Version, len(packTargets), server.ClientIP(r), res.Status)
+		w.Header().Set("Content-Type", "application/json")
+		if res.Status != orchestrator.RolloutCompleted {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		json.NewEncoder(w).Encode(res)
+	})
+
+	// Risk profile the impact agent weighs changes with
+	mux.HandleFunc("GET /risk-profile", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(analyzer.ActiveRiskProfile())
+	})
+	mux.HandleFunc("PUT /risk-profile", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, cfg.MaxBodySize))
+		if err != nil {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		profile, err := analyzer.ParseRiskProfile(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if cfg.RiskProfileFile != "" {
+			if err := profile.Save(cfg.RiskProfileFile); err != nil {
+				log.Printf("Risk profile: %v", err)
+				http.Error(w, "Failed to save risk profile", http.StatusInternalServerError)
+				return
+			}
+		}
+		analyzer.InstallRiskProfile(profile)
+		log.Printf("Risk profile with %d type(s) and %d environment(s) installed by %s", len(profile.Types), len(profile.Environments), server.ClientIP(r))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(profile)
+	})
+
+	// Health check
+	mux.HandleFunc("GET /version", buildinfo.Handler(service))
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":      "ok",
+			"service":     service,
+			"version":     buildinfo.Version,
+			"environment": cfg.Environment,
+			"agents":      len(registry.List()),
+		})
+	})
+
+	allowlist, err := server.ParseCIDRs(cfg.IPAllowlist)
+	if err != nil {
+		log.Fatalf("Invalid IP_ALLOWLIST: %v", err)
+	}
+	proxies, err := server.ParseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	// Answer retried side-effecting requests from the first response
+	var idempotency *server.IdempotencyStore
+	if cfg.IdempotencyTTL > 0 {
+		idempotency = server.NewIdempotencyStore(cfg.IdempotencyTTL)
+	}
+
+	// Resolve the client address, restrict to allowed networks, verify
+	// signatures, then deduplicate retries
+	chain := func(h http.Handler) http.Handler {
+		return server.Chain(h,
+			server.ClientAddress(proxies),
+			server.IPAllowlist(allowlist, proxies),
+			auth.Middleware(cfg.WebhookSecret, cfg.IsDev()),
+			server.Idempotency(idempotency, cfg.MaxBodySize),
+		)
+	}
+
+	// Configure servers with timeouts. With ADMIN_ADDR set, the main
+	// listener serves read-only analysis and the admin listener everything.
+	newServer := func(addr string, h http.Handler) *http.Server {
+		return &http.Server{
+			Addr:         addr,
+			Handler:      chain(h),
+			ReadTimeout:  cfg.ReadTimeout,
+			WriteTimeout: cfg.WriteTimeout,
+			IdleTimeout:  cfg.IdleTimeout,
+		}
+	}
+	srv := newServer(cfg.Addr(), mux)
+	var admin *http.Server
+	if cfg.AdminAddr != "" {
+		srv = newServer(cfg.Addr(), readOnlySurface(mux))
+		admin = newServer(cfg.AdminAddr, mux)
+	}
+
+	// Graceful shutdown
+	go func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		<-sigCh
+		log.Println("Shutting down server...")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if admin != nil {
+			if err := admin.Shutdown(ctx); err != nil {
+				log.Printf("Admin server shutdown error: %v", err)
+			}
+		}
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Server shutdown error: %v", err)
+		}
+	}()
+
+	ln, err := server.Listen(srv.Addr)
+	if err != nil {
+		log.Fatalf("Listen on %s: %v", srv.Addr, err)
+	}
+	if admin != nil {
+		adminLn, err := server.Listen(admin.Addr)
+		if err != nil {
+			log.Fatalf("Listen on %s: %v", admin.Addr, err)
+		}
+		go func() {
+			if err := admin.Serve(adminLn); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Admin server error: %v", err)
+			}
+		}()
+		log.Printf("agent-host admin routes listening on %s; %s is read-only", admin.Addr, srv.Addr)
+	}
+	log.Printf("agent-host listening on %s (%s)", srv.Addr, buildinfo.Get(service))
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Server error: %v", err)
+	}
+}
+
+// adminRoutes are the routes that change host state rather than analyze:
+// rule packs, risk profiles, promotion approvals and environments, share
+// links, recorded apply timings, retention runs, notification replays and
+// job cancellation. With ADMIN_ADDR set they are served on the admin
+// listener only.
+var adminRoutes = []string{
+	"DELETE /jobs/{id}",
+	"POST /reports/{id}/shares",
+	"POST /reports/{id}/timings",
+	"DELETE /shares/{id}",
+	"POST /reports/retention/runs",
+	"POST /reports/retention/runs/{id}/verify",
+	"POST /webhooks/deliveries/{id}/replay",
+	"POST /webhooks/replay",
+	"PUT /rules/pack",
+	"DELETE /rules/pack",
+	"POST /rules/rollout",
+	"PUT /risk-profile",
+	"POST /approvals",
+	"POST /environments",
+	"PUT /environments/{name}",
+	"DELETE /environments/{name}",
+}
+
+// readOnlySurface serves mux on the main listener when the admin routes
+// have a listener of their own: those answer 404 as if they did not exist,
+// and agent requests that would change state, such as promotions, are
+// refused (see host.Permit).
+func readOnlySurface(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); slices.Contains(adminRoutes, pattern) {
+			http.NotFound(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r.WithContext(host.WithReadOnly(r.Context())))
+	})
+}
+
+// dispatchJob runs a dispatch as a cancellable job. The job ID is returned
+// in the X-Job-ID header so an operator can DELETE /jobs/{id}; a cancelled
+// job ends its stream with a cancellation event, a completed one with the
+// verdict of its findings.
+func dispatchJob(ctx context.Context, w http.ResponseWriter, cfg *config.Config, jobs *host.Jobs, dispatcher *host.Dispatcher, agentID string, req protocol.AgentRequest, sse *server.SSEWriter, verdicts verdict.Policy) {
+	name := agentID
+	if name == "" {
+		name = dispatcher.DefaultID()
+	}
+	ctx, job, done := jobs.Start(ctx, name)
+	defer done()
+	w.Header().Set("X-Job-ID", job.ID)
+	if req.Metadata == nil {
+		req.Metadata = make(map[string]string)
+	}
+	req.Metadata[protocol.MetaJobID] = job.ID
+
+	// Add timeout for agent dispatch
+	ctx, cancel := context.WithTimeout(ctx, cfg.AgentTimeout)
+	defer cancel()
+
+	err := dispatcher.Dispatch(ctx, agentID, req, sse)
+	switch {
+	case host.Cancelled(ctx):
+		sse.SendCancelled(job.ID)
+	case err != nil:
+		sse.SendError(err.Error())
+	default:
+		sse.SendVerdict(verdicts)
+	}
+	sse.SendDone()
+}
+
+// checkEmitter collects the findings and errors agents report for
+// POST /check and drops their markdown.
+type checkEmitter struct {
+	findings []protocol.Finding
+	errors   []string
+}
+
+func (c *checkEmitter) SendMessage(string)                     {}
+func (c *checkEmitter) SendReferences([]protocol.Reference)    {}
+func (c *checkEmitter) SendConfirmation(protocol.Confirmation) {}
+func (c *checkEmitter) SendError(msg string)                   { c.errors = append(c.errors, msg) }
+func (c *checkEmitter) SendDone()                              {}
+func (c *checkEmitter) ReportFindings(_ string, findings []protocol.Finding) {
+	c.findings = append(c.findings, findings...)
+}
+
+// checkFinding is a finding as POST /check returns it.
+type checkFinding struct {
+	RuleID       string            `json:"rule_id"`
+	Severity     protocol.Severity `json:"severity"`
+	Resource     string            `json:"resource"`
+	ResourceType string            `json:"resource_type"`
+	Message      string            `json:"message"`
+	Remediation  string            `json:"remediation,omitempty"`
+	Source       string            `json:"source,omitempty"`
+	Confidence   string            `json:"confidence,omitempty"`
+}
+
+func (c *checkEmitter) results() []checkFinding {
+	out := make([]checkFinding, 0, len(c.findings))
+	for _, f := range c.findings {
+		out = append(out, checkFinding{
+			RuleID: f.RuleID, Severity: protocol.NormalizeSeverity(string(f.Severity)), Resource: f.Resource, ResourceType: f.ResourceType,
+			Message: f.Message, Remediation: f.Remediation, Source: f.Source, Confidence: string(f.Confidence),
+		})
+	}
+	return out
+}
+
+// checkResult is the POST /check response: the verdict with its exit
+// semantics, and the findings behind it.
+type checkResult struct {
+	verdict.Report
+	Agents   []string       `json:"agents"`
+	Findings []checkFinding `json:"findings"`
+	Errors   []string       `json:"errors,omitempty"`
+}
+
+// defaultSimulateScans is how many stored scans POST /rules/simulate
+// replays when the request does not say.
+const defaultSimulateScans = 50
+
+// wantsProgress reports whether the client opted in to structured progress
+// events via the X-Progress-Events header.
+func wantsProgress(r *http.Request) bool {
+	on, _ := strconv.ParseBool(r.Header.Get("X-Progress-Events"))
+	return on
+}
+
+// requestMetadata carries the conversation ID so agents can resolve
+// follow-up turns, plus any scan category filters, baseline, deployment
+// stage and repository. Non-Copilot clients may
+// send X-Session-ID instead of a thread ID.
+func requestMetadata(r *http.Request, req server.AgentRequest) map[string]string {
+	meta := make(map[string]string)
+	id := req.ThreadID
+	if id == "" {
+		id = r.Header.Get("X-Session-ID")
+	}
+	if id != "" {
+		meta[protocol.MetaSessionID] = id
+	}
+	if len(req.Categories) > 0 {
+		meta[protocol.MetaCategories] = strings.Join(req.Categories, ",")
+	}
+	if len(req.SkipCategories) > 0 {
+		meta[protocol.MetaSkipCategories] = strings.Join(req.SkipCategories, ",")
+	}
+	if req.Baseline != "" {
+		meta[protocol.MetaBaseline] = req.Baseline
+	}
+	if req.Environment != "" {
+		meta[protocol.MetaEnvironment] = req.Environment
+	}
+	if req.Version != "" {
+		meta[protocol.MetaVersion] = req.Version
+	}
+	if req.Currency != "" {
+		meta[protocol.MetaCurrency] = req.Currency
+	}
+	if req.Locale != "" {
+		meta[protocol.MetaLocale] = req.Locale
+	}
+	if req.Budget != 0 {
+		meta[protocol.MetaBudget] = strconv.FormatFloat(req.Budget, 'f', -1, 64)
+	}
+	if req.Repository != "" {
+		meta[protocol.MetaRepository] = req.Repository
+	}
+	if req.Commit != "" {
+		meta[protocol.MetaCommit] = req.Commit
+	}
+	if len(req.Frameworks) > 0 {
+		meta[protocol.MetaFrameworks] = strings.Join(req.Frameworks, ",")
+	}
+	if len(meta) == 0 {
+		return nil
+	}
+	return meta
+}
+
+// notificationChannels combines the legacy Teams/Slack webhooks with any
+// named channels from NOTIFY_CHANNELS.
+func notificationChannels(cfg *config.Config) []notification.Channel {
+	var channels []notification.Channel
+	if cfg.TeamsWebhookURL != "" {
+		channels = append(channels, notification.Channel{Name: "teams", Kind: notification.KindTeams, URL: cfg.TeamsWebhookURL})
+	}
+	if cfg.SlackWebhookURL != "" {
+		channels = append(channels, notification.Channel{Name: "slack", Kind: notification.KindSlack, URL: cfg.SlackWebhookURL})
+	}
+	named, err := notification.ParseChannels(cfg.NotifyChannels)
+	if err != nil {
+		log.Fatalf("Invalid NOTIFY_CHANNELS: %v", err)
+	}
+	return append(channels, named...)
+}
+
+// notificationWebhooks loads per-channel signing, header and retry settings
+// from NOTIFY_WEBHOOK_CONFIG.
+func notificationWebhooks(cfg *config.Config, channels []notification.Channel) notification.SenderOption {
+	webhooks, err := notification.LoadWebhookConfigs(cfg.NotifyWebhookConfig)
+	if err != nil {
+		log.Fatalf("Invalid NOTIFY_WEBHOOK_CONFIG: %v", err)
+	}
+	for name := range webhooks {
+		if !slices.ContainsFunc(channels, func(c notification.Channel) bool { return c.Name == name }) {
+			log.Printf("WARNING: NOTIFY_WEBHOOK_CONFIG configures unknown channel %q", name)
+		}
+	}
+	return notification.WithWebhooks(webhooks)
+}
+
+// Badge kinds served by GET /badge/{kind}.
+var badgeKinds = []string{"compliance", "findings", "cost"}
+
+// projectBadge builds the kind badge of repository from its newest stored
+// report with something to say: the compliance score and the open critical
+// findings of the code it last scanned, or its last monthly cost estimate,
+// for env when given. The badge reads "unknown" until there is one.
+func projectBadge(kind, repository, env string, reports *report.Store, auditor *compliance.Agent) badge.Badge {
+	scanned := func(r report.Report) bool { return len(r.Resources) > 0 }
+	switch kind {
+	case "compliance":
+		rep, ok := reports.Latest(repository, scanned)
+		if !ok || auditor == nil {
+			return badge.Unknown(kind)
+		}
+		evidence, err := auditor.Report(protocol.AgentRequest{IaC: &protocol.IaCInput{Resources: rep.Resources}}, compliance.ReportOptions{Findings: rep.Findings})
+		if err != nil {
+			return badge.Unknown(kind)
+		}
+		score, ok := evidence.Score()
+		if !ok {
+			return badge.Badge{Label: kind, Message: "n/a", Color: badge.ColorGrey}
+		}
+		return badge.Badge{Label: kind, Message: fmt.Sprintf("%d%%", score), Color: badge.ScoreColor(score)}
+	case "findings":
+		const label = "critical findings"
+		rep, ok := reports.Latest(repository, scanned)
+		if !ok {
+			return badge.Unknown(label)
+		}
+		open := make(map[string]bool)
+		for _, f := range rep.Findings {
+			if protocol.NormalizeSeverity(string(f.Severity)) == protocol.SeverityCritical {
+				open[f.RuleID+" "+f.ResourceType+"."+f.Resource] = true
+			}
+		}
+		return badge.Badge{Label: label, Message: strconv.Itoa(len(open)), Color: badge.CountColor(len(open))}
+	case "cost":
+		var items []protocol.CostItem
+		_, ok := reports.Latest(repository, func(r report.Report) bool {
+			items = items[:0]
+			for _, it := range r.Costs {
+				if env == "" || it.Environment == env {
+					items = append(items, it)
+				}
+			}
+			return len(items) > 0
+		})
+		if !ok {
+			return badge.Unknown(kind)
+		}
+		currency := items[0].Currency
+		if currency == "" {
+			currency = cost.CurrencyUSD
+		}
+		var monthly float64
+		for _, it := range items {
+			if it.Currency == items[0].Currency {
+				monthly += it.Monthly
+			}
+		}
+		return badge.Badge{Label: kind, Message: cost.FormatAmount(monthly, currency) + "/month", Color: badge.ColorBlue}
+	}
+	return badge.Unknown(kind)
+}
+
+// parseSince parses an optional RFC 3339 "since" query parameter.
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid since %q (want RFC 3339)", s)
+	}
+	return t, nil
+}
+
+// shareURL builds the public link for a share token, from SHARE_BASE_URL or
+// else the request's host.
+func shareURL(cfg *config.Config, r *http.Request, token string) string {
+	base := strings.TrimSuffix(cfg.ShareBaseURL, "/")
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + "/shared/" + token
+}
+
+// notificationMailer configures the Microsoft Graph driver for email
+// channels from NOTIFY_EMAIL_SENDER and the AZURE_* credentials.
+func notificationMailer(cfg *config.Config, channels []notification.Channel) notification.SenderOption {
+	hasEmail := slices.ContainsFunc(channels, func(c notification.Channel) bool { return c.Kind == notification.KindEmail })
+	if cfg.NotifyEmailSender == "" {
+		if hasEmail {
+			log.Fatalf("Invalid NOTIFY_CHANNELS: email channels need NOTIFY_EMAIL_SENDER")
+		}
+		return notification.WithMailer(nil)
+	}
+	mailer, err := notification.NewGraphMailer(notification.GraphMailConfig{
+		Sender:       cfg.NotifyEmailSender,
+		Credentials:  azureCredential(cfg, "NOTIFY_EMAIL_SENDER"),
+		GraphURL:     cfg.GraphAPIURL,
+		TemplatePath: cfg.NotifyEmailTemplate,
+	})
+	if err != nil {
+		log.Fatalf("Invalid NOTIFY_EMAIL_SENDER: %v", err)
+	}
+	return notification.WithMailer(mailer)
+}
+
+// notificationLocales resolves the platform default and per-channel
+// locale/timezone settings.
+func notificationLocales(cfg *config.Config) notification.SenderOption {
+	def, err := notification.DefaultLocalization.With(cfg.NotifyDefaultLocale, cfg.NotifyDefaultTimeZone)
+	if err != nil {
+		log.Fatalf("Invalid NOTIFY_DEFAULT_TIMEZONE: %v", err)
+	}
+	perChannel, err := notification.ParseLocales(cfg.NotifyLocales, def)
+	if err != nil {
+		log.Fatalf("Invalid NOTIFY_LOCALES: %v", err)
+	}
+	return notification.WithLocales(perChannel, def)
+}
+
+// driftLock returns the post-promotion drift lock, or nil when disabled or
+// when its alert channel cannot deliver.
+func driftLock(cfg *config.Config, sched *scheduler.Scheduler, sender *notification.Sender, drifts *drift.Agent) *deploy.DriftLock {
+	if len(cfg.DriftLockChecks) == 0 {
+		return nil
+	}
+	if !cfg.EnableNotifications {
+		log.Println("Drift lock disabled: ENABLE_NOTIFICATIONS is false")
+		return nil
+	}
+	if _, ok := sender.Channel(cfg.DriftAlertChannel); !ok {
+		log.Printf("Drift lock disabled: channel %q is not configured", cfg.DriftAlertChannel)
+		return nil
+	}
+	scan := func(_ context.Context, iac *protocol.IaCInput) ([]protocol.Finding, error) {
+		return drifts.Findings(iac.Resources), nil
+	}
+	alert := func(ctx context.Context, title, text string) error {
+		return sender.Send(ctx, cfg.DriftAlertChannel, notification.Message{Title: title, Text: text, Time: time.Now()})
+	}
+	return deploy.NewDriftLock(sched.After, scan, alert, cfg.DriftLockChecks)
+}
+
+// azurePolicies translates the Azure Policy definitions in
+// AZURE_POLICY_DEFINITIONS into policy rules, logging the ones that cannot
+// be evaluated against IaC.
+func azurePolicies(cfg *config.Config) []analyzer.Rule {
+	if cfg.AzurePolicyDefinitions == "" {
+		return nil
+	}
+	bundle, err := azpolicy.LoadPath(cfg.AzurePolicyDefinitions)
+	if err != nil {
+		log.Fatalf("Invalid AZURE_POLICY_DEFINITIONS: %v", err)
+	}
+	rules, skipped := bundle.Rules()
+	for _, s := range skipped {
+		log.Printf("Azure Policy %s not evaluated: %s", s.Definition, s.Reason)
+	}
+	log.Printf("Azure Policy: %d definition(s) translated, %d skipped", len(rules), len(skipped))
+	return rules
+}
+
+// exceptionIssues opens exception request issues in EXCEPTIONS_ISSUE_REPO,
+// or the request's repository, with the caller's GitHub token. Without one
+// no issue is opened; GITHUB_TOKEN is never used.
+func exceptionIssues(cfg *config.Config) orchestrator.IssueFunc {
+	if cfg.ExceptionsIssueRepo != "" {
+		if _, err := repo.ParseRef(cfg.ExceptionsIssueRepo); err != nil {
+			log.Fatalf("Invalid EXCEPTIONS_ISSUE_REPO: %v", err)
+		}
+	}
+	return func(ctx context.Context, token, repository, title, body string) (string, error) {
+		if cfg.ExceptionsIssueRepo != "" {
+			repository = cfg.ExceptionsIssueRepo
+		}
+		if repository == "" {
+			return "", fmt.Errorf("no repository to open it in; set EXCEPTIONS_ISSUE_REPO or name the request's repository")
+		}
+		ref, err := repo.ParseRef(repository)
+		if err != nil {
+			return "", err
+		}
+		// Issues are opened as the caller, never with GITHUB_TOKEN.
+		if token == "" {
+			return "", errors.New("sign in to GitHub: opening an issue needs your own GitHub token")
+		}
+		return repo.NewPublisher(cfg.GitHubAPIURL, token).OpenIssue(ctx, ref.Owner, ref.Name, title, body, "governance-exception")
+	}
+}
+
+// policyWaivers loads POLICY_WAIVERS_FILE.
+func policyWaivers(cfg *config.Config) policy.Option {
+	if cfg.PolicyWaiversFile == "" {
+		return policy.WithWaivers(nil)
+	}
+	waivers, err := analyzer.LoadWaivers(cfg.PolicyWaiversFile)
+	if err != nil {
+		log.Fatalf("Invalid POLICY_WAIVERS_FILE: %v", err)
+	}
+	log.Printf("Policy waivers: %d loaded from %s", waivers.Len(), cfg.PolicyWaiversFile)
+	return policy.WithWaivers(waivers)
+}
+
+// loadRiskProfile installs the risk profile in RISK_PROFILE_FILE.
+func loadRiskProfile(cfg *config.Config) {
+	if cfg.RiskProfileFile == "" {
+		return
+	}
+	profile, err := analyzer.ReadRiskProfile(cfg.RiskProfileFile)
+	if err != nil {
+		log.Fatalf("Invalid RISK_PROFILE_FILE: %v", err)
+	}
+	analyzer.InstallRiskProfile(profile)
+	log.Printf("Risk profile: %d type(s) and %d environment(s) loaded from %s", len(profile.Types), len(profile.Environments), cfg.RiskProfileFile)
+}
+
+// loadTopology loads the promotion pipeline in DEPLOY_ENVIRONMENTS_FILE;
+// without one it is dev -> staging -> prod.
+func loadTopology(cfg *config.Config) deploy.Topology {
+	if cfg.DeployEnvironmentsFile == "" {
+		return deploy.DefaultTopology()
+	}
+	topology, err := deploy.ReadTopology(cfg.DeployEnvironmentsFile)
+	if err != nil {
+		log.Fatalf("Invalid DEPLOY_ENVIRONMENTS_FILE: %v", err)
+	}
+	log.Printf("Environments: %s loaded from %s", strings.Join(topology.Names(), " -> "), cfg.DeployEnvironmentsFile)
+	return topology
+}
+
+// requireEnvironment exits when setting names an environment that is not
+// in the topology; an empty env applies to every environment.
+func requireEnvironment(topology deploy.Topology, setting, env string) {
+	if _, ok := topology.Get(env); env != "" && !ok {
+		log.Fatalf("Invalid %s: unknown environment %q (want %s)", setting, env, strings.Join(topology.Names(), ", "))
+	}
+}
+
+// decodeEnvironment reads an environment from a request body, answering
+// 400 when it cannot.
+func decodeEnvironment(w http.ResponseWriter, r *http.Request, limit int64) (deploy.Environment, bool) {
+	var env deploy.Environment
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&env); err != nil {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
+		return env, false
+	}
+	return env, true
+}
+
+// environmentChanged logs a change to the topology, or answers with the
+// status its error maps to and returns false.
+func environmentChanged(w http.ResponseWriter, r *http.Request, verb, name string, topology deploy.Topology, err error) bool {
+	switch {
+	case errors.Is(err, deploy.ErrEnvironmentNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, deploy.ErrEnvironmentExists), errors.Is(err, deploy.ErrEnvironmentInUse):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, deploy.ErrInvalidTopology):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		log.Printf("Environment %s: %v", name, err)
+		http.Error(w, "Failed to save environments", http.StatusInternalServerError)
+	default:
+		log.Printf("Environment %s %s by %s: %s", name, verb, server.ClientIP(r), strings.Join(topology.Names(), " -> "))
+		return true
+	}
+	return false
+}
+
+// securityBaseline loads SECURITY_BASELINE_FILE.
+func securityBaseline(cfg *config.Config) security.Option {
+	if cfg.SecurityBaselineFile == "" {
+		return security.WithBaseline(nil)
+	}
+	baseline, err := analyzer.LoadBaseline(cfg.SecurityBaselineFile)
+	if err != nil {
+		log.Fatalf("Invalid SECURITY_BASELINE_FILE: %v", err)
+	}
+	log.Printf("Security baseline: %d finding(s) loaded from %s", baseline.Len(), cfg.SecurityBaselineFile)
+	return security.WithBaseline(baseline)
+}
+
+// azureCredential returns the AZURE_* credential, exiting when it is
+// invalid for setting, the variable that needs it.
+func azureCredential(cfg *config.Config, setting string) *azauth.Credential {
+	cred, err := azauth.New(azauth.Config{
+		TenantID:           cfg.AzureTenantID,
+		ClientID:           cfg.AzureClientID,
+		ClientSecret:       cfg.AzureClientSecret,
+		FederatedTokenFile: cfg.AzureFederatedTokenFile,
+		AuthorityHost:      cfg.AzureAuthorityHost,
+	})
+	if err != nil {
+		log.Fatalf("Invalid Azure credentials for %s: %v", setting, err)
+	}
+	return cred
+}
+
+// azurePolicySource fetches the policies assigned to
+// AZURE_POLICY_SUBSCRIPTIONS from Resource Manager at request time.
+func azurePolicySource(cfg *config.Config) policy.Option {
+	if len(cfg.AzurePolicySubscriptions) == 0 {
+		return policy.WithRuleSource(nil)
+	}
+	cred := azureCredential(cfg, "AZURE_POLICY_SUBSCRIPTIONS")
+	log.Printf("Azure Policy: assignments of %d subscription(s) fetched with %s, cached for %s", len(cfg.AzurePolicySubscriptions), cred.Kind(), cfg.AzurePolicyCacheTTL)
+	return policy.WithRuleSource(azpolicy.NewClient(cred, cfg.AzurePolicySubscriptions, azpolicy.WithCacheTTL(cfg.AzurePolicyCacheTTL)))
+}
+
+// advisoryFeed returns the security agent's vulnerability advisory feed, or
+// nil when ADVISORY_FEEDS is unset.
+func advisoryFeed(cfg *config.Config) *advisory.Feed {
+	if len(cfg.AdvisoryFeeds) == 0 {
+		return nil
+	}
+	if cfg.AdvisoryCacheTTL <= 0 {
+		log.Fatalf("Invalid ADVISORY_CACHE_TTL: %s", cfg.AdvisoryCacheTTL)
+	}
+	var sources []advisory.Source
+	for _, name := range cfg.AdvisoryFeeds {
+		if strings.EqualFold(name, "osv") {
+			sources = append(sources, advisory.NewOSV(cfg.OSVAPIURL))
+			continue
+		}
+		f, err := advisory.LoadFile(name)
+		if err != nil {
+			log.Fatalf("Invalid ADVISORY_FEEDS: %v", err)
+		}
+		sources = append(sources, f)
+	}
+	log.Printf("Provider and module advisories enabled: %d feed(s), cached for %s", len(sources), cfg.AdvisoryCacheTTL)
+	return advisory.NewFeed(cfg.AdvisoryCacheTTL, sources...)
+}
+
+// reportRetention returns the report store options for REPORT_RETENTION,
+// REPORT_SUMMARY_RETENTION and REPORT_ARCHIVE_URL.
+func reportRetention(cfg *config.Config) []report.Option {
+	if cfg.ReportRetention < 0 || cfg.ReportSummaryRetention < 0 {
+		log.Fatalf("Invalid REPORT_RETENTION / REPORT_SUMMARY_RETENTION: %s / %s", cfg.ReportRetention, cfg.ReportSummaryRetention)
+	}
+	opts := []report.Option{report.WithRetention(report.Retention{Detailed: cfg.ReportRetention, Summary: cfg.ReportSummaryRetention})}
+	if cfg.ReportArchiveURL == "" {
+		return opts
+	}
+	var creds azauth.TokenSource
+	if !strings.Contains(cfg.ReportArchiveURL, "sig=") {
+		creds = azureCredential(cfg, "REPORT_ARCHIVE_URL")
+	}
+	archiver, err := report.NewBlobArchiver(cfg.ReportArchiveURL, creds)
+	if err != nil {
+		log.Fatalf("Invalid REPORT_ARCHIVE_URL: %v", err)
+	}
+	log.Println("Report archive: Azure Blob container configured")
+	return append(opts, report.WithArchiver(archiver))
+}
+
+// scheduleReportRetention applies the report retention policy every
+// REPORT_RETENTION_INTERVAL.
+func scheduleReportRetention(sched *scheduler.Scheduler, cfg *config.Config, reports *report.Store) {
+	if cfg.ReportRetentionInterval <= 0 || (cfg.ReportRetention == 0 && cfg.ReportSummaryRetention == 0 && cfg.ReportArchiveURL == "") {
+		return
+	}
+	sched.Add(scheduler.Job{
+		Name: "report-retention",
+		Next: scheduler.Every(cfg.ReportRetentionInterval),
+		Run: func(ctx context.Context) {
+			run := reports.ApplyRetention(ctx, report.TriggerSchedule)
+			for _, f := range run.Failed {
+				log.Printf("report retention: archive failed: %s", f)
+			}
+		},
+	})
+}
+
+// scheduleAdvisoryRefresh adds the refresh of cached advisories and feed
+// files to sched every ADVISORY_REFRESH_INTERVAL, when feeds are configured.
+func scheduleAdvisoryRefresh(sched *scheduler.Scheduler, cfg *config.Config, feed *advisory.Feed) {
+	if feed == nil || cfg.AdvisoryRefreshInterval <= 0 {
+		return
+	}
+	sched.Add(scheduler.Job{
+		Name: "advisory-refresh",
+		Next: scheduler.Every(cfg.AdvisoryRefreshInterval),
+		Run: func(ctx context.Context) {
+			if err := feed.Refresh(ctx); err != nil {
+				log.Printf("advisory refresh: %v", err)
+			}
+		},
+	})
+}
+
+// priceCache returns the cost agent's cache of retail VM prices, or nil when
+// live price lookups are disabled.
+func priceCache(cfg *config.Config) *cost.PriceCache {
+	if !cfg.EnableCostAPI {
+		return nil
+	}
+	if cfg.PriceCacheTTL <= 0 {
+		log.Fatalf("Invalid PRICE_CACHE_TTL: %s", cfg.PriceCacheTTL)
+	}
+	prices, err := cost.NewPriceCache(cost.NewRetailPrices(cfg.PriceAPIURL).Fetch, cfg.PriceCacheTTL, cfg.PriceCacheFile)
+	if err != nil {
+		log.Fatalf("Invalid PRICE_CACHE_FILE: %v", err)
+	}
+	log.Printf("Retail price lookups enabled: %d cached price(s), TTL %s", prices.Len(), cfg.PriceCacheTTL)
+	return prices
+}
+
+// schedulePriceRefresh adds the refresh of cached retail prices to sched
+// every PRICE_REFRESH_INTERVAL, when live price lookups are enabled.
+func schedulePriceRefresh(sched *scheduler.Scheduler, cfg *config.Config, prices *cost.PriceCache) {
+	if prices == nil || cfg.PriceRefreshInterval <= 0 {
+		return
+	}
+	sched.Add(scheduler.Job{
+		Name: "price-refresh",
+		Next: scheduler.Every(cfg.PriceRefreshInterval),
+		Run: func(ctx context.Context) {
+			if err := prices.Refresh(ctx); err != nil {
+				log.Printf("price refresh: %v", err)
+			}
+		},
+	})
+}
+
+// scheduleCostReport adds the weekly cost forecast digest to sched when
+// repositories are configured.
+func scheduleCostReport(sched *scheduler.Scheduler, cfg *config.Config, sender *notification.Sender) {
+	if len(cfg.CostReportRepos) == 0 {
+		return
+	}
+	refs, err := repo.ParseRefs(strings.Join(cfg.CostReportRepos, ","))
+	if err != nil {
+		log.Fatalf("Invalid COST_REPORT_REPOS: %v", err)
+	}
+	if !cfg.EnableNotifications {
+		log.Println("Cost forecast digest disabled: ENABLE_NOTIFICATIONS is false")
+		return
+	}
+	if _, ok := sender.Channel(cfg.CostReportChannel); !ok {
+		log.Printf("Cost forecast digest disabled: channel %q is not configured", cfg.CostReportChannel)
+		return
+	}
+
+	fetcher := repo.NewFetcher(cfg.GitHubAPIURL, cfg.GitHubToken)
+	notify := func(ctx context.Context, title, text string) error {
+		now := time.Now()
+		return sender.Send(ctx, cfg.CostReportChannel, notification.Message{
+			Title:    title,
+			Template: notification.TemplateCostForecast,
+			Args:     []interface{}{now},
+			Text:     text,
+			Time:     now,
+		})
+	}
+	forecaster := cost.NewForecaster(refs, fetcher.Fetch, notify, cfg.ReportBaseURL, cost.WithForecastLocale(cfg.Locale))
+
+	sched.Add(scheduler.Job{
+		Name: "cost-forecast",
+		Next: scheduler.WeeklyAt(time.Monday, 9, 0),
+		Run:  forecaster.Run,
+	})
+	log.Printf("Cost forecast digest scheduled weekly for %d repos -> %s", len(refs), cfg.CostReportChannel)
+}
+
+// driftNotifier alerts DRIFT_ALERT_CHANNEL when a drift scan finds drift
+// at or above DRIFT_NOTIFY_SEVERITY.
+func driftNotifier(cfg *config.Config, sender *notification.Sender) []drift.Option {
+	if strings.EqualFold(cfg.DriftNotifySeverity, "off") {
+		return nil
+	}
+	threshold, ok := protocol.ParseSeverity(cfg.DriftNotifySeverity)
+	if !ok {
+		log.Fatalf("Invalid DRIFT_NOTIFY_SEVERITY: %q is not a severity", cfg.DriftNotifySeverity)
+	}
+	if _, ok := sender.Channel(cfg.DriftAlertChannel); !ok || !cfg.EnableNotifications {
+		log.Printf("Drift alerts disabled: channel %q is not configured or notifications are off", cfg.DriftAlertChannel)
+		return nil
+	}
+	notify := func(ctx context.Context, e drift.Event) {
+		var sb strings.Builder
+		if e.Repo != "" {
+			fmt.Fprintf(&sb, "`%s`", e.Repo)
+			if e.Environment != "" {
+				fmt.Fprintf(&sb, " (%s)", e.Environment)
+			}
+			sb.WriteString(": ")
+		}
+		sb.WriteString(e.Summary() + ".\n")
+		for i, d := range e.Drifts {
+			if i == 10 {
+				fmt.Fprintf(&sb, "\n…and %d more.", len(e.Drifts)-i)
+				break
+			}
+			fmt.Fprintf(&sb, "\n- **%s** `%s.%s` %s: %s, expected %s", d.Severity, d.ResourceType, d.Resource, d.Property, d.Actual, d.Expected)
+		}
+		severity := notification.SeverityWarning
+		switch {
+		case e.Severity.AtLeast(protocol.SeverityHigh):
+			severity = notification.SeverityCritical
+		case !e.Severity.AtLeast(protocol.SeverityMedium):
+			severity = notification.SeverityInfo
+		}
+		msg := notification.Message{
+			Title:    fmt.Sprintf("IaC drift detected: %d change(s)", len(e.Drifts)),
+			Template: notification.TemplateDriftDetected,
+			Args:     []interface{}{len(e.Drifts)},
+			Text:     sb.String(),
+			Time:     e.Time,
+			Event:    e.Type,
+			Severity: severity,
+			Data:     e,
+			Level:    e.Severity,
+		}
+		if err := sender.Send(ctx, cfg.DriftAlertChannel, msg); err != nil {
+			log.Printf("Drift alert failed: %v", err)
+		}
+	}
+	log.Printf("Drift alerts (%s and above) -> %s", threshold, cfg.DriftAlertChannel)
+	return []drift.Option{drift.WithNotifier(threshold, notify)}
+}
+
+// workflowNotifier returns the orchestrator option publishing workflow
+// completions to WORKFLOW_NOTIFY_CHANNEL, if one is configured.
+func workflowNotifier(cfg *config.Config, sender *notification.Sender) []orchestrator.Option {
+	if cfg.WorkflowNotifyChannel == "" {
+		return nil
+	}
+	if _, ok := sender.Channel(cfg.WorkflowNotifyChannel); !ok || !cfg.EnableNotifications {
+		log.Printf("Workflow events disabled: channel %q is not configured or notifications are off", cfg.WorkflowNotifyChannel)
+		return nil
+	}
+	notify := func(ctx context.Context, e orchestrator.Event) {
+		text := e.Summary
+		if e.Repo != "" {
+			text = fmt.Sprintf("`%s`: %s", e.Repo, text)
+		}
+		if len(e.Assignees) > 0 {
+			text += " Assigned: " + strings.Join(e.Assignees, ", ") + "."
+		}
+		if e.Hidden > 0 {
+			text += fmt.Sprintf(" %d finding(s) hidden by triage.", e.Hidden)
+		}
+		if e.ReportURL != "" {
+			text += fmt.Sprintf("\n\n[View report](%s)", e.ReportURL)
+		}
+		msg := notification.Message{
+			Title:    fmt.Sprintf("IaC %s workflow completed", e.Workflow),
+			Template: notification.TemplateWorkflowCompleted,
+			Args:     []interface{}{string(e.Workflow)},
+			Text:     text,
+			Time:     e.Time,
+			Event:    e.Type,
+			Severity: e.Severity,
+			Data:     e,
+		}
+		if err := sender.Send(ctx, cfg.WorkflowNotifyChannel, msg); err != nil {
+			log.Printf("Workflow event %s failed: %v", e.Type, err)
+		}
+	}
+	log.Printf("Workflow events -> %s", cfg.WorkflowNotifyChannel)
+	return []orchestrator.Option{orchestrator.WithCompletionNotifier(notify, cfg.ReportBaseURL)}
+}
+
+// approvalNotifier tells APPROVAL_NOTIFY_CHANNEL about promotions waiting
+// for approval and their outcome.
+func approvalNotifier(cfg *config.Config, sender *notification.Sender) []deploy.Option {
+	if cfg.ApprovalNotifyChannel == "" {
+		return nil
+	}
+	if _, ok := sender.Channel(cfg.ApprovalNotifyChannel); !ok || !cfg.EnableNotifications {
+		log.Printf("Approval notifications disabled: channel %q is not configured or notifications are off", cfg.ApprovalNotifyChannel)
+		return nil
+	}
+	log.Printf("Approval requests -> %s", cfg.ApprovalNotifyChannel)
+	return []deploy.Option{deploy.WithApprovalNotifier(func(ctx context.Context, title, text string) error {
+		return sender.Send(ctx, cfg.ApprovalNotifyChannel, notification.Message{Title: title, Text: text, Time: time.Now()})
+	})}
+}
+
+// scheduleSLOProbes adds the synthetic health prober to sched and, when
+// notifications can be delivered, alerts when an objective is at risk.
+func scheduleSLOProbes(sched *scheduler.Scheduler, cfg *config.Config, dispatcher *host.Dispatcher, slos *slo.Tracker, sender *notification.Sender) {
+	if cfg.SLOProbeInterval <= 0 {
+		return
+	}
+	prober := slo.NewProber(dispatcher.Dispatch, cfg.SLOProbeAgents)
+	alert := cfg.EnableNotifications
+	if _, ok := sender.Channel(cfg.SLOAlertChannel); alert && !ok {
+		log.Printf("SLO alerts disabled: channel %q is not configured", cfg.SLOAlertChannel)
+		alert = false
+	}
+
+	sched.Add(scheduler.Job{
+		Name: "slo-probe",
+		Next: scheduler.Every(cfg.SLOProbeInterval),
+		Run: func(ctx context.Context) {
+			prober.Run(ctx)
+			if !alert {
+				return
+			}
+			for _, r := range slos.Alerts() {
+				title := "SLO at risk: " + r.Name
+				if r.Status == slo.StatusBreached {
+					title = "SLO breached: " + r.Name
+				}
+				if err := sender.Send(ctx, cfg.SLOAlertChannel, notification.Message{Title: title, Text: r.Summary(), Time: time.Now()}); err != nil {
+					log.Printf("SLO alert for %s failed: %v", r.Name, err)
+				}
+			}
+		},
+	})
+	log.Printf("SLO probes scheduled every %s", cfg.SLOProbeInterval)
+}
+
+func runStdio(registry *host.Registry, dispatcher *host.Dispatcher) {
+	log.Println("Starting MCP stdio transport")
+	adapter := mcpstdio.NewAdapter(registry, dispatcher, os.Stdin, os.Stdout)
+	if err := adapter.Run(context.Background()); err != nil {
+		log.Fatalf("MCP stdio error: %v", err)
+	}
+}
+
+// quotaChecker reads the compute quotas of AZURE_SUBSCRIPTION_ID for the
+// promotion quota gate.
+func quotaChecker(cfg *config.Config) *deploy.QuotaChecker {
+	if cfg.AzureSubscriptionID == "" {
+		log.Fatalf("ENABLE_QUOTA_CHECKS requires AZURE_SUBSCRIPTION_ID")
+	}
+	cred := azureCredential(cfg, "ENABLE_QUOTA_CHECKS")
+	log.Printf("Quota checks: compute usages of subscription %s read with %s", cfg.AzureSubscriptionID, cred.Kind())
+	usages := deploy.NewComputeUsages(cred, cfg.AzureSubscriptionID, "")
+	return deploy.NewQuotaChecker(usages.Fetch, cfg.QuotaDefaultLocation)
+}
+
+// liveDependents looks up deployed dependents of changed resources with
+// Azure Resource Graph, in the configured subscription.
+func liveDependents(cfg *config.Config) impact.DependentsFunc {
+	if cfg.AzureSubscriptionID == "" {
+		log.Fatalf("ENABLE_LIVE_DEPENDENTS requires AZURE_SUBSCRIPTION_ID")
+	}
+	cred := azureCredential(cfg, "ENABLE_LIVE_DEPENDENTS")
+	log.Printf("Live dependents: resources of subscription %s read with %s", cfg.AzureSubscriptionID, cred.Kind())
+	return impact.NewResourceGraph(cred, []string{cfg.AzureSubscriptionID}, "").Dependents
+}
+
+// liveInventory lists deployed resources for drift detection with Azure
+// Resource Graph, in the subscriptions the IaC names or else the
+// configured one.
+func liveInventory(cfg *config.Config) drift.InventoryFunc {
+	if cfg.AzureSubscriptionID == "" {
+		log.Fatalf("ENABLE_LIVE_INVENTORY requires AZURE_SUBSCRIPTION_ID")
 	}
+	cred := azureCredential(cfg, "ENABLE_LIVE_INVENTORY")
+	log.Printf("Live inventory: resources of subscription %s read with %s", cfg.AzureSubscriptionID, cred.Kind())
+	return drift.NewResourceGraph(cred, []string{cfg.AzureSubscriptionID}, "").Inventory
 }
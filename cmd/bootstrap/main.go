@@ -0,0 +1,93 @@
+// Command bootstrap proposes an initial module catalog and policy rule
+// tuning for an existing Azure estate. It reads live resources from an
+// Azure Resource Graph export and the IaC in the given repositories:
+//
+//	az graph query -q "Resources | project id, name, type, resourceGroup, location, sku, kind, properties" \
+//	  --first 1000 -o json > resources.json
+//	go run ./cmd/bootstrap -resources resources.json -repos org/infra@main,org/platform
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/bootstrap"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/config"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/repo"
+)
+
+func main() {
+	resourcesPath := flag.String("resources", "", "Azure Resource Graph export (JSON); - reads stdin")
+	repos := flag.String("repos", "", "Comma-separated repositories (owner/name@branch) to inventory")
+	threshold := flag.Float64("warn-threshold", bootstrap.DefaultWarnThreshold, "Failure rate at which a rule is proposed to start as a warning")
+	format := flag.String("format", "markdown", "Output format: markdown or json")
+	flag.Parse()
+
+	if *resourcesPath == "" && *repos == "" {
+		log.Fatal("Nothing to inventory: pass -resources and/or -repos")
+	}
+	if *format != "markdown" && *format != "json" {
+		log.Fatalf("Invalid -format %q (want markdown or json)", *format)
+	}
+
+	var live []protocol.Resource
+	if *resourcesPath != "" {
+		var err error
+		if live, err = loadResources(*resourcesPath); err != nil {
+			log.Fatalf("Load resources: %v", err)
+		}
+	}
+
+	refs, err := repo.ParseRefs(*repos)
+	if err != nil {
+		log.Fatalf("Invalid -repos: %v", err)
+	}
+	if err := config.LoadDotEnv(); err != nil {
+		log.Fatalf("Invalid ENV_FILE: %v", err)
+	}
+	cfg := config.Load()
+	fetcher := repo.NewFetcher(cfg.GitHubAPIURL, cfg.GitHubToken)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	var inventory []bootstrap.Repo
+	for _, ref := range refs {
+		files, err := fetcher.Fetch(ctx, ref)
+		if err != nil {
+			log.Fatalf("Fetch %s: %v", ref, err)
+		}
+		inventory = append(inventory, bootstrap.Repo{Name: ref.String(), Files: files})
+	}
+
+	proposal := bootstrap.Propose(live, inventory, analyzer.AllRules(), *threshold)
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(proposal); err != nil {
+			log.Fatalf("Encode proposal: %v", err)
+		}
+		return
+	}
+	fmt.Print(proposal.Markdown())
+}
+
+func loadResources(path string) ([]protocol.Resource, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return bootstrap.LoadResourceGraph(r)
+}
@@ -0,0 +1,116 @@
+// Command gateway fronts all agents under a single host (/policy/*, /cost/*,
+// /security/*, ...), handling auth, rate limiting, CORS, and request logging
+// centrally so the platform can be exposed through one ingress or tunnel.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/auth"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/buildinfo"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/config"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/gateway"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/server"
+)
+
+// service names the gateway in build info and health checks.
+const service = "ghcp-iac-gateway"
+
+func main() {
+	showVersion := flag.Bool("version", false, "Print the build version and exit")
+	flag.Parse()
+	if *showVersion {
+		fmt.Println(buildinfo.Get(service))
+		return
+	}
+
+	if err := config.LoadDotEnv(); err != nil {
+		log.Fatalf("Invalid ENV_FILE: %v", err)
+	}
+	cfg := config.Load()
+
+	routes, err := gateway.ParseRoutes(cfg.GatewayUpstream, cfg.GatewayRoutes)
+	if err != nil {
+		log.Fatalf("Gateway config error: %v", err)
+	}
+	gw := gateway.New(routes)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":      "ok",
+			"service":     service,
+			"version":     buildinfo.Version,
+			"environment": cfg.Environment,
+			"routes":      gw.Agents(),
+		})
+	})
+	// The gateway's own build and every upstream's, so one call shows what
+	// runs where
+	versions := &http.Client{Timeout: 5 * time.Second}
+	mux.HandleFunc("GET /version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			buildinfo.Info
+			Upstreams []gateway.UpstreamVersion `json:"upstreams"`
+		}{buildinfo.Get(service), gw.Versions(r.Context(), versions)})
+	})
+	mux.Handle("/", gw)
+
+	allowlist, err := server.ParseCIDRs(cfg.IPAllowlist)
+	if err != nil {
+		log.Fatalf("Invalid IP_ALLOWLIST: %v", err)
+	}
+	proxies, err := server.ParseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
+	handler := server.Chain(mux,
+		server.ClientAddress(proxies),
+		server.RequestLogger(),
+		server.IPAllowlist(allowlist, proxies),
+		server.CORS(cfg.CORSAllowedOrigins),
+		server.RateLimit(cfg.RateLimitRPS, cfg.RateLimitBurst, proxies),
+		auth.Middleware(cfg.WebhookSecret, cfg.IsDev()),
+	)
+
+	srv := &http.Server{
+		Addr:         cfg.Addr(),
+		Handler:      handler,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+
+	go func() {
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		<-sigCh
+		log.Println("Shutting down gateway...")
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Gateway shutdown error: %v", err)
+		}
+	}()
+
+	ln, err := server.Listen(srv.Addr)
+	if err != nil {
+		log.Fatalf("Listen on %s: %v", srv.Addr, err)
+	}
+	log.Printf("gateway listening on %s routing %d agents (%s)", srv.Addr, len(routes), buildinfo.Get(service))
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		log.Fatalf("Gateway error: %v", err)
+	}
+}
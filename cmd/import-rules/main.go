@@ -0,0 +1,56 @@
+// Command import-rules converts Checkov custom policies and tfsec custom
+// checks (JSON or YAML) into a security rule catalog file, which the agent
+// host loads through SECURITY_RULE_FILES:
+//
+//	go run ./cmd/import-rules -category network -o rules/community.json \
+//	  checkov/*.yaml tfsec/_tfchecks.json
+//
+// Rules that cannot be translated are listed on stderr with the reason.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+)
+
+func main() {
+	category := flag.String("category", "other", "Scan category the imported rules are filed under, e.g. network")
+	out := flag.String("o", "", "Output file; stdout when empty")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		log.Fatal("Nothing to import: pass Checkov policy or tfsec check files")
+	}
+	var docs [][]byte
+	for _, name := range flag.Args() {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			log.Fatalf("Read %s: %v", name, err)
+		}
+		docs = append(docs, data)
+	}
+	res, err := analyzer.ImportRules(*category, docs...)
+	if err != nil {
+		log.Fatalf("Import: %v", err)
+	}
+	for _, s := range res.Skipped {
+		fmt.Fprintf(os.Stderr, "skipped %s %s: %s\n", s.Source, s.ID, s.Reason)
+	}
+
+	data, err := json.MarshalIndent(res.Catalog, "", "  ")
+	if err != nil {
+		log.Fatalf("Encode catalog: %v", err)
+	}
+	data = append(data, '\n')
+	if *out == "" {
+		os.Stdout.Write(data)
+	} else if err := os.WriteFile(*out, data, 0o644); err != nil {
+		log.Fatalf("Write %s: %v", *out, err)
+	}
+	fmt.Fprintf(os.Stderr, "imported %d rule(s), skipped %d\n", len(res.Catalog.Rules), len(res.Skipped))
+}
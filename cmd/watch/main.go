@@ -0,0 +1,133 @@
+// Command watch analyzes the Terraform and Bicep files under a directory
+// and re-analyzes them as they are saved, printing only the findings that
+// appeared or were fixed:
+//
+//	go run ./cmd/watch -dir ./infra
+//
+// With -once it analyzes the tree a single time and exits with status 1
+// when there are findings, for use in scripts and pre-commit hooks.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "Directory to analyze")
+	interval := flag.Duration("interval", 300*time.Millisecond, "How often to check files for changes")
+	format := flag.String("format", "text", "Output format: text or json (one delta per line)")
+	once := flag.Bool("once", false, "Analyze once and exit; status 1 when there are findings")
+	flag.Parse()
+
+	if *format != "text" && *format != "json" {
+		log.Fatalf("Invalid -format %q (want text or json)", *format)
+	}
+	if *interval <= 0 {
+		log.Fatalf("Invalid -interval %s", *interval)
+	}
+
+	w := &watcher{root: *dir, inc: analyzer.NewIncremental(analyzer.AllRules()), mtimes: make(map[string]time.Time), json: *format == "json"}
+	total, err := w.scan()
+	if err != nil {
+		log.Fatalf("Scan %s: %v", *dir, err)
+	}
+	if *once {
+		if total > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	log.Printf("Watching %s (%d findings)", *dir, total)
+	for range time.Tick(*interval) {
+		if _, err := w.scan(); err != nil {
+			log.Printf("Scan %s: %v", *dir, err)
+		}
+	}
+}
+
+type watcher struct {
+	root   string
+	inc    *analyzer.Incremental
+	mtimes map[string]time.Time
+	json   bool
+}
+
+// scan re-analyzes files modified since the last scan, reports deleted
+// ones, and returns the number of current findings.
+func (w *watcher) scan() (int, error) {
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(w.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); path != w.root && (name[0] == '.' || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ext := filepath.Ext(path); ext != ".tf" && ext != ".bicep" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		seen[path] = true
+		if w.mtimes[path].Equal(info.ModTime()) {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		w.mtimes[path] = info.ModTime()
+		w.print(w.inc.Update(path, string(content)))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for path := range w.mtimes {
+		if !seen[path] {
+			delete(w.mtimes, path)
+			w.print(w.inc.Remove(path))
+		}
+	}
+	total := 0
+	for _, findings := range w.inc.Findings() {
+		total += len(findings)
+	}
+	return total, nil
+}
+
+func (w *watcher) print(d analyzer.Delta) {
+	if d.Empty() {
+		return
+	}
+	if w.json {
+		if err := json.NewEncoder(os.Stdout).Encode(d); err != nil {
+			log.Printf("Encode delta: %v", err)
+		}
+		return
+	}
+	sort.SliceStable(d.Added, func(i, j int) bool {
+		return d.Added[i].Severity.Rank() > d.Added[j].Severity.Rank()
+	})
+	for _, f := range d.Added {
+		fmt.Printf("+ %s [%s] %s %s.%s: %s\n", d.Path, f.Severity, f.RuleID, f.ResourceType, f.Resource, f.Message)
+	}
+	for _, f := range d.Fixed {
+		fmt.Printf("- %s [fixed] %s %s.%s\n", d.Path, f.RuleID, f.ResourceType, f.Resource)
+	}
+}
@@ -0,0 +1,205 @@
+// Package advisory correlates the Terraform providers and modules a
+// configuration requires with published vulnerability advisories, from the
+// OSV database (which includes the GitHub Advisory Database) and from local
+// feeds in the OSV format.
+package advisory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/semver"
+)
+
+// Ecosystems packages are looked up in.
+const (
+	// EcosystemGo holds providers, which OSV indexes as the Go modules
+	// they are built from.
+	EcosystemGo = "Go"
+	// EcosystemTerraform is used by local feeds for providers
+	// ("hashicorp/azurerm") and modules (their source).
+	EcosystemTerraform = "Terraform"
+)
+
+// Package identifies a package in an ecosystem.
+type Package struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+}
+
+// Vulnerability is an OSV record (https://ossf.github.io/osv-schema/),
+// reduced to the fields used here.
+type Vulnerability struct {
+	ID               string      `json:"id"`
+	Summary          string      `json:"summary,omitempty"`
+	Aliases          []string    `json:"aliases,omitempty"`
+	Affected         []Affected  `json:"affected"`
+	References       []Reference `json:"references,omitempty"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity,omitempty"`
+	} `json:"database_specific"`
+}
+
+// Affected lists the affected versions of one package.
+type Affected struct {
+	Package  Package  `json:"package"`
+	Ranges   []Range  `json:"ranges,omitempty"`
+	Versions []string `json:"versions,omitempty"`
+}
+
+// Range is a sequence of introduced/fixed events.
+type Range struct {
+	Type   string  `json:"type"`
+	Events []Event `json:"events"`
+}
+
+// Event opens or closes an affected range.
+type Event struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+}
+
+// Reference links to an advisory page.
+type Reference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+// Severity maps the GitHub Advisory severity (CRITICAL, HIGH, MODERATE,
+// LOW) to a finding severity; records without one are high.
+func (v Vulnerability) Severity() protocol.Severity {
+	s := strings.ToLower(v.DatabaseSpecific.Severity)
+	if s == "moderate" {
+		return protocol.SeverityMedium
+	}
+	if sev, ok := protocol.ParseSeverity(s); ok {
+		return sev
+	}
+	return protocol.SeverityHigh
+}
+
+// Name is the advisory's CVE when it has one, else its ID.
+func (v Vulnerability) Name() string {
+	for _, a := range v.Aliases {
+		if strings.HasPrefix(a, "CVE-") {
+			return a
+		}
+	}
+	return v.ID
+}
+
+// URL is the advisory page: the first ADVISORY reference, else osv.dev.
+func (v Vulnerability) URL() string {
+	for _, r := range v.References {
+		if r.Type == "ADVISORY" {
+			return r.URL
+		}
+	}
+	return "https://osv.dev/vulnerability/" + v.ID
+}
+
+// Packages returns the identities a dependency is published under.
+func Packages(dep parser.Dependency) []Package {
+	pkgs := []Package{{Ecosystem: EcosystemTerraform, Name: dep.Source}}
+	if dep.Kind == parser.DependencyProvider {
+		if ns, name, ok := strings.Cut(dep.Source, "/"); ok {
+			pkgs = append(pkgs, Package{Ecosystem: EcosystemGo, Name: "github.com/" + ns + "/terraform-provider-" + name})
+		}
+	}
+	return pkgs
+}
+
+// Affects reports whether version of pkg is affected, and the lowest
+// version above it that fixes the vulnerability ("" when none is known).
+func (v Vulnerability) Affects(pkg Package, version string) (bool, string) {
+	affected, fixed := false, ""
+	for _, a := range v.Affected {
+		if a.Package.Ecosystem != pkg.Ecosystem || !strings.EqualFold(a.Package.Name, pkg.Name) {
+			continue
+		}
+		for _, listed := range a.Versions {
+			if semver.Compare(listed, version) == 0 {
+				affected = true
+			}
+		}
+		for _, r := range a.Ranges {
+			if r.Type != "SEMVER" && r.Type != "ECOSYSTEM" {
+				continue
+			}
+			in, fix := r.contains(version)
+			if in {
+				affected = true
+				if fix != "" && (fixed == "" || semver.Compare(fix, fixed) < 0) {
+					fixed = fix
+				}
+			}
+		}
+	}
+	return affected, fixed
+}
+
+// contains evaluates the range's events in version order, returning the
+// fix that closes the interval holding version.
+func (r Range) contains(version string) (bool, string) {
+	events := append([]Event(nil), r.Events...)
+	at := func(e Event) string { return e.Introduced + e.Fixed + e.LastAffected }
+	sort.SliceStable(events, func(i, j int) bool { return semver.Compare(at(events[i]), at(events[j])) < 0 })
+	in := false
+	for _, e := range events {
+		switch {
+		case e.Introduced != "" && semver.Compare(version, e.Introduced) >= 0:
+			in = true
+		case e.Fixed != "" && semver.Compare(version, e.Fixed) >= 0,
+			e.LastAffected != "" && semver.Compare(version, e.LastAffected) > 0:
+			in = false
+		case !in:
+			// Every later event is above version.
+			return false, ""
+		case e.Fixed != "":
+			return true, e.Fixed
+		case e.LastAffected != "":
+			return true, ""
+		}
+	}
+	return in, ""
+}
+
+// Match is a dependency whose allowed version an advisory affects.
+type Match struct {
+	Dependency    parser.Dependency
+	Version       string
+	Vulnerability Vulnerability
+	// Source names the feed that reported the advisory.
+	Source string
+	// Fixed is the lowest version above Version that is not affected.
+	Fixed string
+}
+
+// Finding reports the match as a security finding on the provider or
+// module.
+func (m Match) Finding() protocol.Finding {
+	v := m.Vulnerability
+	msg := fmt.Sprintf("%s %s (version %q) is affected by %s", m.Dependency.Source, m.Version, m.Dependency.Version, v.Name())
+	if v.Summary != "" {
+		msg += ": " + v.Summary
+	}
+	msg += " (" + v.URL() + ")"
+	fix := fmt.Sprintf("No fixed version is published; replace %s or accept the risk", m.Dependency.Source)
+	if m.Fixed != "" {
+		fix = fmt.Sprintf("Upgrade to %s or later (version = \">= %s\")", m.Fixed, m.Fixed)
+	}
+	return protocol.Finding{
+		RuleID:       v.ID,
+		Category:     "Security",
+		Severity:     v.Severity(),
+		Resource:     m.Dependency.Name,
+		ResourceType: m.Dependency.Kind,
+		Message:      msg,
+		Remediation:  fix,
+		Source:       m.Source,
+	}
+}
@@ -0,0 +1,152 @@
+package advisory
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+func TestVulnerability_Affects(t *testing.T) {
+	pkg := Package{Ecosystem: EcosystemGo, Name: "github.com/hashicorp/terraform-provider-azurerm"}
+	v := Vulnerability{Affected: []Affected{{
+		Package: pkg,
+		Ranges: []Range{{Type: "SEMVER", Events: []Event{
+			{Introduced: "0"}, {Fixed: "2.5.0"}, {Introduced: "3.0.0"}, {Fixed: "3.4.1"},
+		}}},
+		Versions: []string{"4.0.0-beta1"},
+	}}}
+	for version, want := range map[string]string{
+		"1.0.0":       "2.5.0",
+		"2.5.0":       "-",
+		"3.1":         "3.4.1",
+		"3.4.1":       "-",
+		"4.0.0-beta1": "",
+	} {
+		affected, fixed := v.Affects(pkg, version)
+		if affected != (want != "-") || (affected && fixed != want) {
+			t.Errorf("Affects(%s) = %v, %q; want %q", version, affected, fixed, want)
+		}
+	}
+	if affected, _ := v.Affects(Package{Ecosystem: EcosystemGo, Name: "github.com/hashicorp/terraform-provider-random"}, "1.0.0"); affected {
+		t.Error("other package reported affected")
+	}
+}
+
+const providerVuln = `{
+  "id": "GHSA-xxxx-0001",
+  "summary": "Secrets written to state in plain text",
+  "aliases": ["CVE-2024-0001"],
+  "affected": [{
+    "package": {"ecosystem": "Go", "name": "github.com/hashicorp/terraform-provider-azurerm"},
+    "ranges": [{"type": "SEMVER", "events": [{"introduced": "3.0.0"}, {"fixed": "3.5.0"}]}]
+  }],
+  "database_specific": {"severity": "MODERATE"}
+}`
+
+func TestFeed_Check(t *testing.T) {
+	var queries atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Package   Package `json:"package"`
+			PageToken string  `json:"page_token"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/v1/query" || body.Package.Ecosystem != EcosystemGo {
+			t.Errorf("unexpected query %s %+v", r.URL.Path, body.Package)
+		}
+		queries.Add(1)
+		switch {
+		case body.Package.Name != "github.com/hashicorp/terraform-provider-azurerm":
+			w.Write([]byte(`{}`))
+		case body.PageToken == "":
+			w.Write([]byte(`{"vulns": [], "next_page_token": "p2"}`))
+		default:
+			w.Write([]byte(`{"vulns": [` + providerVuln + `]}`))
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	feedPath := filepath.Join(dir, "modules.json")
+	moduleVuln := `[{
+  "id": "ORG-2026-7",
+  "summary": "Storage account left public",
+  "affected": [{"package": {"ecosystem": "Terraform", "name": "contoso/storage/azurerm"}, "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"fixed": "2.1.0"}]}]}],
+  "database_specific": {"severity": "CRITICAL"}
+}]`
+	if err := os.WriteFile(feedPath, []byte(moduleVuln), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := LoadFile(feedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed := NewFeed(time.Hour, NewOSV(srv.URL), file)
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	feed.now = func() time.Time { return now }
+
+	deps := parser.ParseTerraformDependencies(`terraform {
+  required_providers {
+    azurerm = {
+      source  = "hashicorp/azurerm"
+      version = "~> 3.1"
+    }
+    random = {
+      source = "hashicorp/random"
+    }
+  }
+}
+
+module "storage" {
+  source  = "contoso/storage/azurerm"
+  version = "2.0.3"
+}`)
+	matches, err := feed.Check(context.Background(), deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("matches = %+v", matches)
+	}
+	f := matches[0].Finding()
+	if f.RuleID != "GHSA-xxxx-0001" || f.Resource != "azurerm" || f.ResourceType != "provider" || f.Severity != protocol.SeverityMedium ||
+		!strings.Contains(f.Message, "CVE-2024-0001") || !strings.Contains(f.Remediation, ">= 3.5.0") || f.Source != "osv" {
+		t.Errorf("provider finding = %+v", f)
+	}
+	if m := matches[1]; m.Vulnerability.ID != "ORG-2026-7" || m.Fixed != "2.1.0" || m.Finding().Severity != protocol.SeverityCritical {
+		t.Errorf("module match = %+v", m)
+	}
+	// Two pages for azurerm; random has no version and is not looked up.
+	if n := queries.Load(); n != 2 {
+		t.Errorf("queries = %d, want 2", n)
+	}
+
+	if _, err := feed.Check(context.Background(), deps); err != nil || queries.Load() != 2 {
+		t.Errorf("cached check queried again (%d): %v", queries.Load(), err)
+	}
+	now = now.Add(45 * time.Minute)
+	if err := feed.Refresh(context.Background()); err != nil || queries.Load() != 4 {
+		t.Errorf("refresh queries = %d: %v", queries.Load(), err)
+	}
+
+	// A fixed module version drops out once the file feed is reloaded.
+	if err := os.WriteFile(feedPath, []byte(strings.Replace(moduleVuln, `"2.1.0"`, `"2.0.0"`, 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := feed.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if matches, _ := feed.Check(context.Background(), deps); len(matches) != 1 {
+		t.Errorf("after reload matches = %+v", matches)
+	}
+}
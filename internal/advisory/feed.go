@@ -0,0 +1,168 @@
+package advisory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/semver"
+)
+
+// Feed correlates dependencies with the advisories of its sources. Each
+// package's advisories from remote sources are cached for a TTL; an expired
+// entry is fetched again on lookup but still served if the fetch fails.
+// File sources are read on every lookup. Refresh, run as a background job,
+// reloads files and keeps cached entries from expiring. It is safe for
+// concurrent use.
+type Feed struct {
+	sources []Source
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	entries map[Package]feedEntry
+}
+
+// reloader is a local source, such as a File, that is cheap to query.
+type reloader interface {
+	Source
+	Reload() error
+}
+
+type feedEntry struct {
+	// vulns holds each source's advisories, by source name.
+	vulns     map[string][]Vulnerability
+	fetchedAt time.Time
+}
+
+// NewFeed creates a feed over sources.
+func NewFeed(ttl time.Duration, sources ...Source) *Feed {
+	return &Feed{sources: sources, ttl: ttl, now: time.Now, entries: make(map[Package]feedEntry)}
+}
+
+// Check returns the advisories affecting the lowest version each
+// dependency's constraint allows. Dependencies without a lower bound are
+// skipped. Lookup failures are returned alongside the matches found.
+func (f *Feed) Check(ctx context.Context, deps []parser.Dependency) ([]Match, error) {
+	var matches []Match
+	var errs []error
+	for _, dep := range deps {
+		c, err := semver.ParseConstraint(dep.Version)
+		if err != nil {
+			continue
+		}
+		lowest, ok := c.Lowest()
+		if !ok {
+			continue
+		}
+		version := lowest.String()
+		seen := make(map[string]bool)
+		for _, pkg := range Packages(dep) {
+			bySource, err := f.lookup(ctx, pkg)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			for _, src := range f.sources {
+				vulns := bySource[src.Name()]
+				if r, ok := src.(reloader); ok {
+					vulns, _ = r.Query(ctx, pkg)
+				}
+				for _, v := range vulns {
+					if seen[v.ID] {
+						continue
+					}
+					if affected, fixed := v.Affects(pkg, version); affected {
+						seen[v.ID] = true
+						matches = append(matches, Match{Dependency: dep, Version: version, Vulnerability: v, Source: src.Name(), Fixed: fixed})
+					}
+				}
+			}
+		}
+	}
+	return matches, errors.Join(errs...)
+}
+
+// lookup returns pkg's advisories by source, fetching them when they are
+// not cached or have expired.
+func (f *Feed) lookup(ctx context.Context, pkg Package) (map[string][]Vulnerability, error) {
+	f.mu.Lock()
+	e, ok := f.entries[pkg]
+	f.mu.Unlock()
+	if ok && f.now().Sub(e.fetchedAt) < f.ttl {
+		return e.vulns, nil
+	}
+	fresh, err := f.update(ctx, pkg)
+	if err != nil && ok {
+		return e.vulns, err
+	}
+	return fresh, err
+}
+
+// update fetches pkg from every source and caches the result. When a
+// source fails its previous advisories are kept and the entry is not
+// marked fresh.
+func (f *Feed) update(ctx context.Context, pkg Package) (map[string][]Vulnerability, error) {
+	f.mu.Lock()
+	prev := f.entries[pkg]
+	f.mu.Unlock()
+	vulns := make(map[string][]Vulnerability, len(f.sources))
+	var errs []error
+	for _, src := range f.sources {
+		if _, ok := src.(reloader); ok {
+			continue
+		}
+		vs, err := src.Query(ctx, pkg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", src.Name(), err))
+			vs = prev.vulns[src.Name()]
+		}
+		vulns[src.Name()] = vs
+	}
+	entry := feedEntry{vulns: vulns, fetchedAt: prev.fetchedAt}
+	if len(errs) == 0 {
+		entry.fetchedAt = f.now()
+	}
+	f.mu.Lock()
+	f.entries[pkg] = entry
+	f.mu.Unlock()
+	return vulns, errors.Join(errs...)
+}
+
+// Refresh reloads file sources and refetches every package looked up
+// before whose advisories are older than half the TTL, so a refresh
+// interval under half the TTL keeps lookups from waiting on the network.
+// It returns the failures.
+func (f *Feed) Refresh(ctx context.Context) error {
+	var errs []error
+	for _, src := range f.sources {
+		if r, ok := src.(reloader); ok {
+			if err := r.Reload(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", src.Name(), err))
+			}
+		}
+	}
+	f.mu.Lock()
+	var due []Package
+	for pkg, e := range f.entries {
+		if f.now().Sub(e.fetchedAt) >= f.ttl/2 {
+			due = append(due, pkg)
+		}
+	}
+	f.mu.Unlock()
+	for _, pkg := range due {
+		if _, err := f.update(ctx, pkg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Len returns the number of cached packages.
+func (f *Feed) Len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.entries)
+}
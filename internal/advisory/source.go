@@ -0,0 +1,177 @@
+package advisory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOSVURL is the public OSV API.
+const DefaultOSVURL = "https://api.osv.dev"
+
+// Source returns the advisories published for a package.
+type Source interface {
+	Name() string
+	Query(ctx context.Context, pkg Package) ([]Vulnerability, error)
+}
+
+// OSV queries the OSV API. It answers for the Go ecosystem only: OSV has no
+// Terraform ecosystem, but providers are published as Go modules.
+type OSV struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewOSV creates an OSV client. An empty baseURL uses DefaultOSVURL.
+func NewOSV(baseURL string) *OSV {
+	if baseURL == "" {
+		baseURL = DefaultOSVURL
+	}
+	return &OSV{baseURL: strings.TrimRight(baseURL, "/"), client: &http.Client{Timeout: 20 * time.Second}}
+}
+
+func (o *OSV) Name() string { return "osv" }
+
+// Query returns every advisory for pkg, following result pages.
+func (o *OSV) Query(ctx context.Context, pkg Package) ([]Vulnerability, error) {
+	if pkg.Ecosystem != EcosystemGo {
+		return nil, nil
+	}
+	var vulns []Vulnerability
+	token := ""
+	for {
+		body, _ := json.Marshal(map[string]interface{}{"package": pkg, "page_token": token})
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.baseURL+"/v1/query", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := o.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("osv query %s: %w", pkg.Name, err)
+		}
+		var page struct {
+			Vulns         []Vulnerability `json:"vulns"`
+			NextPageToken string          `json:"next_page_token"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+			resp.Body.Close()
+			return nil, fmt.Errorf("osv query %s: status %d: %s", pkg.Name, resp.StatusCode, strings.TrimSpace(string(msg)))
+		}
+		err = json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("osv query %s: %w", pkg.Name, err)
+		}
+		vulns = append(vulns, page.Vulns...)
+		if page.NextPageToken == "" {
+			return vulns, nil
+		}
+		token = page.NextPageToken
+	}
+}
+
+// File serves OSV records from a JSON file (one record, an array, or
+// {"vulns": [...]}) or a directory of them, such as a mirror of an OSV
+// export or an organization's advisories for its own modules. Reload
+// re-reads it.
+type File struct {
+	path string
+
+	mu    sync.RWMutex
+	vulns []Vulnerability
+}
+
+// LoadFile reads the feed at path.
+func LoadFile(path string) (*File, error) {
+	f := &File{path: path}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) Name() string { return filepath.Base(f.path) }
+
+// Reload re-reads the feed; on error the previous records are kept.
+func (f *File) Reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	files := []string{f.path}
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(f.path, "*.json")); err != nil {
+			return err
+		}
+		sort.Strings(files)
+	}
+	var vulns []Vulnerability
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		recs, err := parseRecords(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		vulns = append(vulns, recs...)
+	}
+	f.mu.Lock()
+	f.vulns = vulns
+	f.mu.Unlock()
+	return nil
+}
+
+// Query returns the records that list pkg.
+func (f *File) Query(_ context.Context, pkg Package) ([]Vulnerability, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var out []Vulnerability
+	for _, v := range f.vulns {
+		for _, a := range v.Affected {
+			if a.Package.Ecosystem == pkg.Ecosystem && strings.EqualFold(a.Package.Name, pkg.Name) {
+				out = append(out, v)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+func parseRecords(data []byte) ([]Vulnerability, error) {
+	data = bytes.TrimSpace(data)
+	var vulns []Vulnerability
+	if bytes.HasPrefix(data, []byte("[")) {
+		err := json.Unmarshal(data, &vulns)
+		return vulns, err
+	}
+	var wrapped struct {
+		Vulns []Vulnerability `json:"vulns"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, err
+	}
+	if wrapped.Vulns != nil {
+		return wrapped.Vulns, nil
+	}
+	var v Vulnerability
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	if v.ID == "" {
+		return nil, fmt.Errorf("not an OSV record")
+	}
+	return []Vulnerability{v}, nil
+}
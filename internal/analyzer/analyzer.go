@@ -2,11 +2,13 @@
 // security scanning, and compliance auditing.
 package analyzer
 
-// Severity levels for findings.
+import "github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+
+// Severity levels for findings, aliased from the shared protocol scale.
 const (
-	SeverityCritical = "critical"
-	SeverityHigh     = "high"
-	SeverityMedium   = "medium"
-	SeverityLow      = "low"
-	SeverityInfo     = "info"
+	SeverityCritical = protocol.SeverityCritical
+	SeverityHigh     = protocol.SeverityHigh
+	SeverityMedium   = protocol.SeverityMedium
+	SeverityLow      = protocol.SeverityLow
+	SeverityInfo     = protocol.SeverityInfo
 )
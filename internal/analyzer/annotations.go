@@ -0,0 +1,57 @@
+package analyzer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Governance rule IDs reported for the annotations themselves.
+const (
+	RuleInvalidAnnotation = "GOV-001"
+	RuleExpiredExemption  = "GOV-002"
+)
+
+// AnnotationFindings reports malformed "iac-gov:" annotations, which are
+// ignored, and exemptions that expired before now, which no longer suppress
+// their rule.
+func AnnotationFindings(resources []protocol.Resource, now time.Time) []protocol.Finding {
+	var findings []protocol.Finding
+	for _, res := range resources {
+		a := res.Annotations
+		if a == nil {
+			continue
+		}
+		for _, msg := range a.Errors {
+			findings = append(findings, protocol.Finding{
+				RuleID:       RuleInvalidAnnotation,
+				Category:     "Governance",
+				Severity:     protocol.SeverityLow,
+				Resource:     res.Name,
+				ResourceType: res.Type,
+				Message:      "Invalid annotation " + msg,
+				Remediation:  "Use key=value pairs: owner, exempt, until (YYYY-MM-DD), reason, severity (<rule>:<level>)",
+			})
+		}
+		for _, e := range a.Exemptions {
+			if e.Active(now) {
+				continue
+			}
+			from := ""
+			if e.Source != "" {
+				from = " (" + e.Source + ")"
+			}
+			findings = append(findings, protocol.Finding{
+				RuleID:       RuleExpiredExemption,
+				Category:     "Governance",
+				Severity:     protocol.SeverityMedium,
+				Resource:     res.Name,
+				ResourceType: res.Type,
+				Message:      fmt.Sprintf("Exemption from %s%s expired on %s (reason: %s)", e.RuleID, from, e.Until.Format("2006-01-02"), e.Reason),
+				Remediation:  fmt.Sprintf("Fix the %s finding, or renew the exemption with a new expiry date", e.RuleID),
+			})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,140 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// BaselineVersion is the baseline file format NewBaseline writes.
+const BaselineVersion = 1
+
+// Baseline records the findings a codebase already had when it adopted
+// scanning, so later scans report only new ones.
+type Baseline struct {
+	Version   int             `json:"version"`
+	Generated time.Time       `json:"generated"`
+	Findings  []BaselineEntry `json:"findings"`
+
+	name string
+}
+
+// BaselineEntry is one accepted finding: a rule failing on a resource.
+type BaselineEntry struct {
+	RuleID string `json:"rule_id"`
+	// Resource is "type.name".
+	Resource string            `json:"resource"`
+	Severity protocol.Severity `json:"severity,omitempty"`
+	Message  string            `json:"message,omitempty"`
+}
+
+// NewBaseline records findings as a baseline generated at now, sorted so a
+// regenerated file diffs cleanly.
+func NewBaseline(findings []protocol.Finding, now time.Time) *Baseline {
+	b := &Baseline{Version: BaselineVersion, Generated: now.UTC().Truncate(time.Second), Findings: []BaselineEntry{}}
+	for _, f := range findings {
+		b.Findings = append(b.Findings, BaselineEntry{
+			RuleID:   f.RuleID,
+			Resource: f.ResourceType + "." + f.Resource,
+			Severity: f.Severity,
+			Message:  f.Message,
+		})
+	}
+	sort.SliceStable(b.Findings, func(i, j int) bool {
+		x, y := b.Findings[i], b.Findings[j]
+		if x.Resource != y.Resource {
+			return x.Resource < y.Resource
+		}
+		return x.RuleID < y.RuleID
+	})
+	return b
+}
+
+// LoadBaseline reads a baseline file.
+func LoadBaseline(file string) (*Baseline, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ParseBaseline(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	b.name = filepath.Base(file)
+	return b, nil
+}
+
+// ParseBaseline parses and validates a baseline document. Every entry needs
+// a rule ID and a resource.
+func ParseBaseline(data []byte) (*Baseline, error) {
+	var b Baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("invalid baseline: %w", err)
+	}
+	if b.Version > BaselineVersion {
+		return nil, fmt.Errorf("baseline version %d is newer than supported (%d)", b.Version, BaselineVersion)
+	}
+	for i, e := range b.Findings {
+		if strings.TrimSpace(e.RuleID) == "" || strings.TrimSpace(e.Resource) == "" {
+			return nil, fmt.Errorf("baseline finding %d: rule_id and resource are required", i+1)
+		}
+	}
+	b.name = "baseline"
+	return &b, nil
+}
+
+// Name returns the file the baseline was loaded from.
+func (b *Baseline) Name() string { return b.name }
+
+// Len returns the number of recorded findings.
+func (b *Baseline) Len() int { return len(b.Findings) }
+
+// Filter drops findings recorded in the baseline and returns the new ones
+// and the number dropped. Rule IDs match as in skip comments, so an entry
+// written with a Checkov ID covers the native rule. Each entry covers one
+// finding: the same rule failing on the same resource, preferably with the
+// same message, so a second failure of a recorded rule is still new.
+func (b *Baseline) Filter(findings []protocol.Finding) ([]protocol.Finding, int) {
+	if b == nil || len(b.Findings) == 0 {
+		return findings, 0
+	}
+	type key struct{ rule, resource string }
+	open := make(map[key][]string)
+	for _, e := range b.Findings {
+		k := key{skipKey(e.RuleID), e.Resource}
+		open[k] = append(open[k], e.Message)
+	}
+	// Exact messages are matched first so a changed message does not
+	// claim an entry an unchanged finding needs.
+	claimed := make([]bool, len(findings))
+	for pass := 0; pass < 2; pass++ {
+		for i, f := range findings {
+			if claimed[i] {
+				continue
+			}
+			k := key{skipKey(f.RuleID), f.ResourceType + "." + f.Resource}
+			msgs := open[k]
+			for j, m := range msgs {
+				if pass == 0 && m != f.Message {
+					continue
+				}
+				open[k] = append(msgs[:j:j], msgs[j+1:]...)
+				claimed[i] = true
+				break
+			}
+		}
+	}
+	kept := findings[:0:0]
+	for i, f := range findings {
+		if !claimed[i] {
+			kept = append(kept, f)
+		}
+	}
+	return kept, len(findings) - len(kept)
+}
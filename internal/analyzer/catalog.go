@@ -0,0 +1,310 @@
+package analyzer
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// catalogFiles holds the data-driven security rules, one file per category.
+//
+//go:embed rules/*.json
+var catalogFiles embed.FS
+
+// CatalogFile is one data file of the rule catalog: the rules of a
+// category.
+type CatalogFile struct {
+	Category string `json:"category"`
+	// Reference is the documentation cited by rules without their own.
+	Reference *protocol.Reference `json:"reference,omitempty"`
+	Rules     []CatalogRule       `json:"rules"`
+}
+
+// CatalogRule declares a security rule in a catalog file. Resources of
+// ResourceTypes, or each of their Each blocks, that match every When
+// condition must satisfy every Assert condition.
+type CatalogRule struct {
+	ID            string            `json:"id"`
+	Severity      protocol.Severity `json:"severity"`
+	Title         string            `json:"title"`
+	Description   string            `json:"description"`
+	Remediation   string            `json:"remediation"`
+	ResourceTypes []string          `json:"resource_types"`
+	// Each names repeated nested blocks checked one by one, e.g.
+	// security_rule. A resource without them is checked itself, so one
+	// rule covers inline and standalone NSG rules.
+	Each string `json:"each,omitempty"`
+	// When limits the rule; a condition matches when any of its values
+	// satisfies it.
+	When []Condition `json:"when,omitempty"`
+	// Assert conditions must hold for every value.
+	Assert []Condition `json:"assert"`
+	// Message, when set, reports a failed assertion in place of the
+	// property and value.
+	Message string `json:"message,omitempty"`
+	// Reference is the documentation the rule cites.
+	Reference *protocol.Reference `json:"reference,omitempty"`
+}
+
+// Condition applies a rule pack operator to a property: a dotted path, or
+// several joined by "|" whose values are pooled.
+type Condition struct {
+	Property string      `json:"property"`
+	Operator string      `json:"operator"`
+	Value    interface{} `json:"value,omitempty"`
+}
+
+func (c Condition) candidate() RuleCandidate {
+	return RuleCandidate{Property: c.Property, Operator: c.Operator, Value: c.Value}
+}
+
+// matches reports whether any value satisfies the condition. A property
+// that is not set matches only absent and the negative operators.
+func (c Condition) matches(props map[string]interface{}) bool {
+	vals := lookupAlternatives(props, c.Property)
+	switch {
+	case c.Operator == OpAbsent:
+		return len(vals) == 0
+	case c.Operator == OpPresent:
+		return len(vals) > 0
+	case len(vals) == 0:
+		return negativeOperators[c.Operator]
+	}
+	cand := c.candidate()
+	for _, v := range vals {
+		if cand.holds(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check evaluates the rule against resource properties. Failures in
+// several blocks are joined with "; ", each naming its block.
+func (r CatalogRule) Check(props map[string]interface{}) string {
+	targets := []map[string]interface{}{props}
+	inBlocks := false
+	if r.Each != "" {
+		var found []map[string]interface{}
+		for _, v := range lookupValues(props, r.Each) {
+			found = append(found, blocks(v)...)
+		}
+		if len(found) > 0 {
+			targets, inBlocks = found, true
+		}
+	}
+	var issues []string
+	for _, t := range targets {
+		if !r.applies(t) {
+			continue
+		}
+		for _, a := range r.Assert {
+			msg := a.candidate().Check(t)
+			if msg == "" {
+				continue
+			}
+			if r.Message != "" {
+				msg = r.Message
+			}
+			if name, ok := t["name"]; ok && inBlocks {
+				msg = fmt.Sprintf("%s %q: %s", r.Each, fmt.Sprint(name), msg)
+			}
+			issues = append(issues, msg)
+			break
+		}
+	}
+	return strings.Join(issues, "; ")
+}
+
+func (r CatalogRule) applies(props map[string]interface{}) bool {
+	for _, c := range r.When {
+		if !c.matches(props) {
+			return false
+		}
+	}
+	return true
+}
+
+// evidence returns the asserted paths, within Each blocks when the rule
+// has them.
+func (r CatalogRule) evidence() []string {
+	var paths []string
+	for _, a := range r.Assert {
+		for _, p := range strings.Split(a.Property, "|") {
+			if r.Each != "" {
+				p = r.Each + "." + p
+			}
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// Rule builds the declaration as a runnable Security rule filed under
+// group.
+func (r CatalogRule) Rule(group string) Rule {
+	var ref protocol.Reference
+	if r.Reference != nil {
+		ref = *r.Reference
+	}
+	return Rule{
+		ID:            r.ID,
+		Category:      "Security",
+		Group:         group,
+		Severity:      r.Severity,
+		Title:         r.Title,
+		Description:   r.Description,
+		Remediation:   r.Remediation,
+		Reference:     ref,
+		ResourceTypes: r.ResourceTypes,
+		Evidence:      r.evidence(),
+		CheckFn:       r.Check,
+	}
+}
+
+// LoadCatalogFile parses and validates a catalog file. IDs in known are
+// taken; the file's own are added to it.
+func LoadCatalogFile(data []byte, known map[string]bool) (*CatalogFile, error) {
+	var f CatalogFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("invalid catalog file: %w", err)
+	}
+	if strings.TrimSpace(f.Category) == "" {
+		return nil, fmt.Errorf("catalog file needs a category")
+	}
+	if err := validReference(f.Reference); err != nil {
+		return nil, err
+	}
+	for i, r := range f.Rules {
+		switch {
+		case r.ID == "":
+			return nil, fmt.Errorf("rule %d: missing id", i)
+		case known[r.ID]:
+			return nil, fmt.Errorf("rule %s: duplicate id", r.ID)
+		case r.Title == "" || len(r.ResourceTypes) == 0 || len(r.Assert) == 0:
+			return nil, fmt.Errorf("rule %s: title, resource_types and assert are required", r.ID)
+		}
+		sev, ok := protocol.ParseSeverity(string(r.Severity))
+		if !ok {
+			return nil, fmt.Errorf("rule %s: unknown severity %q", r.ID, r.Severity)
+		}
+		f.Rules[i].Severity = sev
+		if err := validReference(r.Reference); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+		if r.Reference == nil {
+			f.Rules[i].Reference = f.Reference
+		}
+		for _, c := range append(append([]Condition(nil), r.When...), r.Assert...) {
+			if c.Property == "" {
+				return nil, fmt.Errorf("rule %s: condition without a property", r.ID)
+			}
+			if err := validateOperator(c.Operator, c.Value); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+			}
+		}
+		known[r.ID] = true
+	}
+	return &f, nil
+}
+
+// validReference checks that a cited reference, if any, links to a web
+// page.
+func validReference(ref *protocol.Reference) error {
+	if ref == nil {
+		return nil
+	}
+	u, err := url.Parse(ref.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("reference %q is not an http(s) URL", ref.URL)
+	}
+	return nil
+}
+
+// catalog is the parsed rule catalog, loaded once; the embedded files are
+// validated by tests, so a bad file fails at startup. AddCatalogFiles
+// extends it.
+var (
+	catalogMu sync.RWMutex
+	catalog   = mustLoadCatalog()
+)
+
+func mustLoadCatalog() []Rule {
+	names, err := catalogFiles.ReadDir("rules")
+	if err != nil {
+		panic(err)
+	}
+	known := make(map[string]bool)
+	for _, r := range append(append(policyRules(), securityRules()...), complianceRules()...) {
+		known[r.ID] = true
+	}
+	var rules []Rule
+	for _, e := range names {
+		data, err := catalogFiles.ReadFile(path.Join("rules", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		f, err := LoadCatalogFile(data, known)
+		if err != nil {
+			panic(fmt.Sprintf("rule catalog %s: %v", e.Name(), err))
+		}
+		for _, r := range f.Rules {
+			rules = append(rules, r.Rule(f.Category))
+		}
+	}
+	return rules
+}
+
+// AddCatalogFiles reads catalog files from disk, such as ones written by
+// cmd/import-rules, and adds their rules to the catalog. IDs must not
+// clash with built-in rules or each other; on any error nothing is added.
+// It returns the number of rules added.
+func AddCatalogFiles(files ...string) (int, error) {
+	known := make(map[string]bool)
+	for _, r := range builtinRules() {
+		known[r.ID] = true
+	}
+	var rules []Rule
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return 0, err
+		}
+		f, err := LoadCatalogFile(data, known)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, r := range f.Rules {
+			rules = append(rules, r.Rule(f.Category))
+		}
+	}
+	catalogMu.Lock()
+	catalog = append(catalog, rules...)
+	catalogMu.Unlock()
+	return len(rules), nil
+}
+
+// catalogRules returns the rules of the catalog, by file name.
+func catalogRules() []Rule {
+	catalogMu.RLock()
+	defer catalogMu.RUnlock()
+	return append([]Rule(nil), catalog...)
+}
+
+// RuleGroup returns the catalog category of a catalog rule, such as
+// "network", or "" for rules written in Go.
+func RuleGroup(id string) string {
+	for _, r := range catalogRules() {
+		if r.ID == id {
+			return r.Group
+		}
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Evidence is a property value and source line that satisfied a rule.
+type Evidence struct {
+	Property string      `json:"property"`
+	Value    interface{} `json:"value"`
+	Line     int         `json:"line,omitempty"`
+	Source   string      `json:"source,omitempty"`
+}
+
+// ControlResult is the outcome of one rule against one resource.
+type ControlResult struct {
+	Rule     Rule
+	Resource protocol.Resource
+	Passed   bool
+	Messages []string
+	// Matches holds what a ScanFn rule found, in the order of Messages.
+	Matches []Match
+}
+
+// Controls evaluates every applicable rule/resource pair, including those
+// that pass, in the same order as Run. Resources a plan destroys are not
+// evaluated.
+func Controls(rules []Rule, resources []protocol.Resource) []ControlResult {
+	return NewRuleIndex(rules).Controls(resources)
+}
+
+// control evaluates one rule against one resource.
+func control(rule Rule, res protocol.Resource) ControlResult {
+	var messages []string
+	var matches []Match
+	switch {
+	case rule.ScanFn != nil:
+		matches = rule.ScanFn(res)
+		for _, m := range matches {
+			messages = append(messages, m.Message)
+		}
+	case rule.IsPatternRule():
+		messages = rule.CheckPatterns(res.RawBlock)
+	default:
+		if msg := rule.CheckResource(res); msg != "" {
+			messages = []string{msg}
+		}
+	}
+	return ControlResult{Rule: rule, Resource: res, Passed: len(messages) == 0, Messages: messages, Matches: matches}
+}
+
+// Evidence returns the property values and source lines behind a passing
+// result. Pattern rules record the patterns that found no match.
+func (c ControlResult) Evidence() []Evidence {
+	if c.Rule.ScanFn != nil {
+		return []Evidence{{Property: "scan", Value: "no " + strings.ToLower(c.Rule.Title) + " found", Line: c.Resource.Line}}
+	}
+	if c.Rule.IsPatternRule() {
+		ev := make([]Evidence, 0, len(c.Rule.Patterns))
+		for _, p := range c.Rule.Patterns {
+			ev = append(ev, Evidence{Property: "pattern", Value: "no match for " + p.String(), Line: c.Resource.Line})
+		}
+		return ev
+	}
+
+	paths := c.Rule.Evidence
+	if c.Rule.Property != "" {
+		paths = []string{c.Rule.Property}
+	}
+	var ev []Evidence
+	for _, path := range paths {
+		val, ok := lookupPath(c.Resource.Properties, path)
+		if !ok {
+			// The path crosses a list of blocks: record every value.
+			vals := lookupValues(c.Resource.Properties, path)
+			if len(vals) == 0 {
+				continue
+			}
+			val = vals
+		}
+		e := Evidence{Property: path, Value: val}
+		if offset, src := findPropertyLine(c.Resource.RawBlock, path); offset >= 0 {
+			e.Line, e.Source = c.Resource.Line+offset, src
+		}
+		ev = append(ev, e)
+	}
+	return ev
+}
+
+// Confidence rates the property values the result rests on. Pattern rules
+// match literal text and are high; property rules take the least confident
+// of their checked paths, so a finding about an unset property (where the
+// provider default is assumed) is low.
+func (c ControlResult) Confidence() protocol.Confidence {
+	if c.Rule.IsPatternRule() {
+		return protocol.ConfidenceHigh
+	}
+	paths := c.Rule.Evidence
+	if c.Rule.Property != "" {
+		paths = []string{c.Rule.Property}
+	}
+	levels := make([]protocol.Confidence, 0, len(paths))
+	for _, path := range paths {
+		levels = append(levels, protocol.ValueConfidence(c.Resource, path))
+	}
+	return protocol.LeastConfident(levels...)
+}
+
+// lookupPath resolves a dotted path through nested property maps.
+func lookupPath(props map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = props
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// findPropertyLine returns the zero-based line offset and trimmed text of a
+// dotted property path in a raw block, matching each segment in order as a
+// Terraform "key =" / "key {" or Bicep "key:" line. Bicep camelCase names
+// are not resolved and yield -1.
+func findPropertyLine(block, path string) (int, string) {
+	lines := strings.Split(block, "\n")
+	start := 0
+	found := -1
+	for _, key := range strings.Split(path, ".") {
+		re, _ := compilePattern(`^\s*` + regexp.QuoteMeta(key) + `\s*(=|:|\{)`)
+		found = -1
+		for i := start; i < len(lines); i++ {
+			if re.MatchString(lines[i]) {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			return -1, ""
+		}
+		start = found + 1
+	}
+	return found, strings.TrimSpace(lines[found])
+}
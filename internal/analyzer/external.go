@@ -0,0 +1,229 @@
+package analyzer
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Sources of external rule identifiers.
+const (
+	SourceCheckov = "checkov"
+	SourceTfsec   = "tfsec"
+)
+
+// externalRules maps Checkov and tfsec rule IDs to their native equivalent.
+// Keys are upper-cased so lookups are case-insensitive.
+var externalRules = map[string]string{
+	// Checkov
+	"CKV_AZURE_3":   "POL-001",  // storage HTTPS only
+	"CKV_AZURE_5":   "POL-002",  // AKS RBAC
+	"CKV_AZURE_44":  "POL-003",  // storage min TLS
+	"CKV_AZURE_52":  "POL-003",  // MSSQL min TLS
+	"CKV_AZURE_148": "POL-003",  // Redis min TLS
+	"CKV_AZURE_190": "POL-004",  // storage public blob access
+	"CKV_AZURE_42":  "POL-005",  // Key Vault recoverable
+	"CKV_AZURE_110": "POL-006",  // Key Vault purge protection
+	"CKV_SECRET_2":  "SEC-001",  // AWS-style access key
+	"CKV_SECRET_6":  "SEC-001",  // base64 high-entropy string
+	"CKV_AZURE_59":  "SEC-002",  // storage public network access
+	"CKV_AZURE_189": "SEC-002",  // Key Vault public network access
+	"CKV_AZURE_113": "SEC-002",  // MSSQL public network access
+	"CKV_AZURE_101": "SEC-002",  // Cosmos DB public network access
+	"CKV2_AZURE_1":  "SEC-004",  // storage CMK encryption
+	"CKV_AZURE_9":   "SEC-005",  // NSG RDP from internet
+	"CKV_AZURE_10":  "SEC-005",  // NSG SSH from internet
+	"CKV_AZURE_35":  "NIST-SC7", // storage default network deny
+	"CKV_AZURE_206": "NIST-SC28",
+
+	// tfsec (legacy and AVD aliases)
+	"AZURE-STORAGE-ENFORCE-HTTPS":             "POL-001",
+	"AZURE-CONTAINER-USE-RBAC-PERMISSIONS":    "POL-002",
+	"AZURE-STORAGE-USE-SECURE-TLS-POLICY":     "POL-003",
+	"AZURE-DATABASE-SECURE-TLS-POLICY":        "POL-003",
+	"AZURE-STORAGE-NO-PUBLIC-ACCESS":          "POL-004",
+	"AZURE-KEYVAULT-NO-PURGE":                 "POL-006",
+	"GENERAL-SECRETS-NO-PLAINTEXT-EXPOSURE":   "SEC-001",
+	"AZURE-KEYVAULT-SPECIFY-NETWORK-ACL":      "SEC-002",
+	"AZURE-DATABASE-NO-PUBLIC-ACCESS":         "SEC-002",
+	"AZURE-NETWORK-NO-PUBLIC-INGRESS":         "SEC-005",
+	"AZURE-NETWORK-SSH-BLOCKED-FROM-INTERNET": "SEC-005",
+	"AZURE-NETWORK-DISABLE-RDP-FROM-INTERNET": "SEC-005",
+	"AZURE-STORAGE-DEFAULT-ACTION-DENY":       "NIST-SC7",
+	"AVD-AZU-0008":                            "POL-001",
+	"AVD-AZU-0042":                            "POL-002",
+	"AVD-AZU-0011":                            "POL-003",
+	"AVD-AZU-0007":                            "POL-004",
+	"AVD-AZU-0016":                            "POL-006",
+	"AVD-AZU-0047":                            "SEC-005",
+	"AVD-AZU-0012":                            "NIST-SC7",
+}
+
+var (
+	externalIDRe  = regexp.MustCompile(`(?i)\b(CKV2?_[A-Z]+_\d+|AVD-[A-Z]+-\d{4}|(?:azure|general)-[a-z0-9]+(?:-[a-z0-9]+)+)\b`)
+	checkovSkipRe = regexp.MustCompile(`(?i)(?:#|//)\s*checkov:skip=([A-Z0-9_]+)`)
+	tfsecIgnoreRe = regexp.MustCompile(`(?i)(?:#|//)\s*(?:tfsec|trivy):ignore:([a-z0-9_-]+)`)
+	// securityIgnoreRe matches "# security-ignore:SEC-004" and lists such
+	// as "// security-ignore: SEC004, SEC-NET-001".
+	securityIgnoreRe = regexp.MustCompile(`(?i)(?:#|//)\s*security-ignore:\s*([a-z0-9_-]+(?:\s*,\s*[a-z0-9_-]+)*)`)
+	// compactIDRe matches rule IDs written without their hyphen, e.g. SEC004.
+	compactIDRe = regexp.MustCompile(`^([A-Z]+)(\d+)$`)
+)
+
+// ExternalMapping describes how an external rule ID maps to native rules.
+type ExternalMapping struct {
+	ExternalID string `json:"external_id"`
+	Source     string `json:"source"`
+	RuleID     string `json:"rule_id"`
+	Stub       bool   `json:"stub,omitempty"`
+}
+
+// ExternalSource guesses whether an ID comes from Checkov or tfsec.
+func ExternalSource(id string) string {
+	if strings.HasPrefix(strings.ToUpper(id), "CKV") {
+		return SourceCheckov
+	}
+	return SourceTfsec
+}
+
+// MapExternalID returns the native rule ID for a Checkov or tfsec rule ID.
+// Native IDs (e.g. "POL-001") map to themselves.
+func MapExternalID(id string) (string, bool) {
+	key := strings.ToUpper(strings.TrimSpace(id))
+	if native, ok := externalRules[key]; ok {
+		return native, true
+	}
+	for _, r := range AllRules() {
+		if r.ID == key {
+			return r.ID, true
+		}
+	}
+	return "", false
+}
+
+// ExtractExternalIDs finds Checkov/tfsec rule identifiers in free text, such
+// as a pasted .checkov.yaml skip list or tfsec config. Duplicates are removed.
+func ExtractExternalIDs(text string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	for _, m := range externalIDRe.FindAllString(text, -1) {
+		key := strings.ToUpper(m)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		ids = append(ids, m)
+	}
+	return ids
+}
+
+// ImportExternalRules maps each external ID to a native rule. IDs without a
+// native equivalent get a stub rule so coverage gaps stay visible; stubs have
+// no check and never produce findings.
+func ImportExternalRules(ids []string) ([]ExternalMapping, []Rule) {
+	var mappings []ExternalMapping
+	var stubs []Rule
+	for _, id := range ids {
+		m := ExternalMapping{ExternalID: id, Source: ExternalSource(id)}
+		if native, ok := MapExternalID(id); ok {
+			m.RuleID = native
+		} else {
+			m.RuleID = strings.ToUpper(id)
+			m.Stub = true
+			stubs = append(stubs, Rule{
+				ID:          m.RuleID,
+				Category:    "External",
+				Severity:    SeverityInfo,
+				Title:       "Imported " + m.Source + " rule " + id,
+				Description: "No native equivalent; imported as a placeholder",
+			})
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, stubs
+}
+
+// SkippedRules returns the native rule IDs suppressed for a resource by
+// Checkov (#checkov:skip=ID), tfsec/Trivy (#tfsec:ignore:id) or native
+// (#security-ignore:SEC-004,SEC-005) comments.
+// Comments are honored inside the resource block and on the comment lines
+// directly above it in rawCode. Exemptions in the resource's "iac-gov:"
+// annotations count too while they are active at now.
+func SkippedRules(res protocol.Resource, rawCode string, now time.Time) map[string]bool {
+	text := res.RawBlock + "\n" + parser.LeadingComments(rawCode, res.Line)
+	skipped := make(map[string]bool)
+	for _, re := range []*regexp.Regexp{checkovSkipRe, tfsecIgnoreRe} {
+		for _, m := range re.FindAllStringSubmatch(text, -1) {
+			skipped[skipKey(m[1])] = true
+		}
+	}
+	for _, m := range securityIgnoreRe.FindAllStringSubmatch(text, -1) {
+		for _, id := range strings.Split(m[1], ",") {
+			skipped[skipKey(id)] = true
+		}
+	}
+	if res.Annotations != nil {
+		for _, e := range res.Annotations.Exemptions {
+			if e.Active(now) {
+				skipped[skipKey(e.RuleID)] = true
+			}
+		}
+	}
+	return skipped
+}
+
+// skipKey normalizes a rule ID to its native equivalent when one exists so
+// that a skip written with any tool's ID, the rule's ID without its hyphen
+// (SEC004), or the rule's hyphenated title, suppresses the same check.
+func skipKey(id string) string {
+	if native, ok := MapExternalID(id); ok {
+		return native
+	}
+	key := strings.ToUpper(strings.TrimSpace(id))
+	if m := compactIDRe.FindStringSubmatch(key); m != nil {
+		if native, ok := MapExternalID(m[1] + "-" + m[2]); ok {
+			return native
+		}
+	}
+	for _, r := range AllRules() {
+		if RuleSlug(r.Title) == key {
+			return r.ID
+		}
+	}
+	return key
+}
+
+var slugSepRe = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// RuleSlug returns a rule title in the upper-case hyphenated form waivers
+// may name it by: "Storage HTTPS Required" is STORAGE-HTTPS-REQUIRED.
+func RuleSlug(title string) string {
+	return strings.Trim(slugSepRe.ReplaceAllString(strings.ToUpper(title), "-"), "-")
+}
+
+// FilterSkipped drops findings whose rule is suppressed by a skip comment or
+// an active exemption on the resource and returns the remaining findings and
+// the number dropped.
+func FilterSkipped(findings []protocol.Finding, resources []protocol.Resource, rawCode string) ([]protocol.Finding, int) {
+	now := time.Now()
+	skips := make(map[string]map[string]bool)
+	for _, res := range resources {
+		if s := SkippedRules(res, rawCode, now); len(s) > 0 {
+			skips[res.Type+"."+res.Name] = s
+		}
+	}
+	if len(skips) == 0 {
+		return findings, 0
+	}
+	kept := findings[:0:0]
+	for _, f := range findings {
+		if skips[f.ResourceType+"."+f.Resource][skipKey(f.RuleID)] {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept, len(findings) - len(kept)
+}
@@ -0,0 +1,466 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// ImportResult is a catalog file converted from external rule definitions,
+// and the rules that could not be converted.
+type ImportResult struct {
+	Catalog CatalogFile  `json:"catalog"`
+	Skipped []ImportSkip `json:"skipped,omitempty"`
+}
+
+// ImportSkip is an external rule left out of an import, and why.
+type ImportSkip struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Reason string `json:"reason"`
+}
+
+// checkovPolicy is a Checkov custom policy. Entries of a check listing
+// carry only metadata and have no Definition.
+type checkovPolicy struct {
+	Metadata   checkovMetadata   `json:"metadata"`
+	Definition *checkovCondition `json:"definition"`
+}
+
+type checkovMetadata struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Category  string `json:"category"`
+	Severity  string `json:"severity"`
+	Guideline string `json:"guideline"`
+}
+
+// checkovCondition is a node of a Checkov policy definition: an attribute
+// or filter condition, or an and/or of further nodes.
+type checkovCondition struct {
+	CondType      string             `json:"cond_type"`
+	ResourceTypes interface{}        `json:"resource_types"`
+	Attribute     string             `json:"attribute"`
+	Operator      string             `json:"operator"`
+	Value         interface{}        `json:"value"`
+	And           []checkovCondition `json:"and"`
+	Or            []checkovCondition `json:"or"`
+}
+
+// tfsecCheck is a tfsec custom check, from a _tfchecks.json or .yaml file.
+type tfsecCheck struct {
+	Code           string     `json:"code"`
+	Description    string     `json:"description"`
+	Impact         string     `json:"impact"`
+	Resolution     string     `json:"resolution"`
+	RequiredTypes  []string   `json:"requiredTypes"`
+	RequiredLabels []string   `json:"requiredLabels"`
+	Severity       string     `json:"severity"`
+	MatchSpec      tfsecMatch `json:"matchSpec"`
+	ErrorMessage   string     `json:"errorMessage"`
+	RelatedLinks   []string   `json:"relatedLinks"`
+}
+
+type tfsecMatch struct {
+	Name               string       `json:"name"`
+	Action             string       `json:"action"`
+	Value              interface{}  `json:"value"`
+	SubMatch           *tfsecMatch  `json:"subMatch"`
+	PredicateMatchSpec []tfsecMatch `json:"predicateMatchSpec"`
+}
+
+// checkovOperators maps Checkov attribute operators to catalog operators.
+// is_true and is_false become equals with a boolean value.
+var checkovOperators = map[string]string{
+	"equals":                OpEquals,
+	"not_equals":            OpNotEquals,
+	"exists":                OpPresent,
+	"not_exists":            OpAbsent,
+	"regex_match":           OpMatches,
+	"within":                OpIn,
+	"starts_with":           OpStartsWith,
+	"ends_with":             OpEndsWith,
+	"greater_than":          OpGreaterThan,
+	"greater_than_or_equal": OpAtLeast,
+	"less_than":             OpLessThan,
+	"less_than_or_equal":    OpAtMost,
+	"is_true":               OpEquals,
+	"is_false":              OpEquals,
+}
+
+// tfsecActions maps tfsec match actions to catalog operators.
+var tfsecActions = map[string]string{
+	"equals":               OpEquals,
+	"notEqual":             OpNotEquals,
+	"isPresent":            OpPresent,
+	"notPresent":           OpAbsent,
+	"regexMatches":         OpMatches,
+	"isAny":                OpIn,
+	"isNone":               OpNotIn,
+	"startsWith":           OpStartsWith,
+	"endsWith":             OpEndsWith,
+	"greaterThan":          OpGreaterThan,
+	"greaterThanOrEqualTo": OpAtLeast,
+	"lessThan":             OpLessThan,
+	"lessThanOrEqualTo":    OpAtMost,
+}
+
+// tfsecSeverities maps tfsec's legacy severities; the current ones
+// (CRITICAL, HIGH, MEDIUM, LOW) are native.
+var tfsecSeverities = map[string]protocol.Severity{
+	"ERROR":   SeverityHigh,
+	"WARNING": SeverityMedium,
+	"INFO":    SeverityLow,
+}
+
+// ImportRules converts Checkov custom policies and tfsec custom checks,
+// each document in JSON or YAML, into a catalog file of category, so
+// community rule catalogs run as security rules without rewriting them.
+// Rule IDs, severities, titles and guideline links carry over. Rules whose
+// logic has no catalog equivalent (or/not, connection and list operators),
+// that only list metadata, or that map to a built-in rule are skipped.
+// A document that is neither format is an error.
+func ImportRules(category string, docs ...[]byte) (*ImportResult, error) {
+	if strings.TrimSpace(category) == "" {
+		return nil, fmt.Errorf("import needs a category")
+	}
+	res := &ImportResult{Catalog: CatalogFile{Category: category, Rules: []CatalogRule{}}}
+	known := make(map[string]bool)
+	for _, r := range builtinRules() {
+		known[r.ID] = true
+	}
+	add := func(source, id string, rule CatalogRule, err error) {
+		if native, ok := MapExternalID(id); ok {
+			err = fmt.Errorf("covered by built-in rule %s", native)
+		} else if err == nil {
+			err = importable(rule, known)
+		}
+		if err != nil {
+			res.Skipped = append(res.Skipped, ImportSkip{ID: id, Source: source, Reason: err.Error()})
+			return
+		}
+		known[rule.ID] = true
+		res.Catalog.Rules = append(res.Catalog.Rules, rule)
+	}
+
+	for i, data := range docs {
+		checkov, tfsec, err := decodeExternalRules(data)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", i+1, err)
+		}
+		for _, p := range checkov {
+			rule, err := p.catalogRule()
+			add(SourceCheckov, p.Metadata.ID, rule, err)
+		}
+		for _, c := range tfsec {
+			rule, err := c.catalogRule()
+			add(SourceTfsec, c.Code, rule, err)
+		}
+	}
+	return res, nil
+}
+
+// importable checks a converted rule the way the catalog loader will, and
+// that it does not duplicate a built-in or earlier rule.
+func importable(rule CatalogRule, known map[string]bool) error {
+	data, err := json.Marshal(CatalogFile{Category: "import", Rules: []CatalogRule{rule}})
+	if err != nil {
+		return err
+	}
+	taken := make(map[string]bool, len(known))
+	for k := range known {
+		taken[k] = true
+	}
+	_, err = LoadCatalogFile(data, taken)
+	return err
+}
+
+// decodeExternalRules reads a JSON or YAML document as Checkov policies (a
+// policy, a list of them, or a check listing) or tfsec checks.
+func decodeExternalRules(data []byte) ([]checkovPolicy, []tfsecCheck, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		if doc, err = parser.ParseYAML(string(data)); err != nil {
+			return nil, nil, fmt.Errorf("neither JSON nor YAML: %w", err)
+		}
+	}
+	var items []interface{}
+	switch d := doc.(type) {
+	case map[string]interface{}:
+		if checks, ok := d["checks"].([]interface{}); ok {
+			items = checks
+		} else {
+			items = []interface{}{d}
+		}
+	case []interface{}:
+		items = d
+	default:
+		return nil, nil, fmt.Errorf("not a Checkov policy or tfsec check file")
+	}
+
+	var checkov []checkovPolicy
+	var tfsec []tfsecCheck
+	for _, item := range items {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, nil, fmt.Errorf("not a Checkov policy or tfsec check file")
+		}
+		switch {
+		case m["code"] != nil:
+			var c tfsecCheck
+			if err := remarshal(m, &c); err != nil {
+				return nil, nil, fmt.Errorf("tfsec check: %w", err)
+			}
+			tfsec = append(tfsec, c)
+		case m["metadata"] != nil:
+			var p checkovPolicy
+			if err := remarshal(m, &p); err != nil {
+				return nil, nil, fmt.Errorf("checkov policy: %w", err)
+			}
+			checkov = append(checkov, p)
+		case m["id"] != nil:
+			var p checkovPolicy
+			if err := remarshal(m, &p.Metadata); err != nil {
+				return nil, nil, fmt.Errorf("checkov check: %w", err)
+			}
+			checkov = append(checkov, p)
+		default:
+			return nil, nil, fmt.Errorf("not a Checkov policy or tfsec check file")
+		}
+	}
+	return checkov, tfsec, nil
+}
+
+// remarshal decodes a generic value, as parsed from YAML, into out.
+func remarshal(v interface{}, out interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+func (p checkovPolicy) catalogRule() (CatalogRule, error) {
+	md := p.Metadata
+	rule := CatalogRule{
+		ID:          md.ID,
+		Severity:    importSeverity(md.Severity),
+		Title:       md.Name,
+		Description: md.Name,
+		Reference:   importReference(md.Name, md.Guideline),
+	}
+	if md.Guideline != "" {
+		rule.Remediation = "See the guideline at " + md.Guideline
+	}
+	if p.Definition == nil {
+		return rule, fmt.Errorf("metadata only; there is no definition to translate")
+	}
+	var types []string
+	var conds []checkovCondition
+	if err := p.Definition.flatten(&conds); err != nil {
+		return rule, err
+	}
+	for _, c := range conds {
+		ct, err := c.resourceTypes()
+		if err != nil {
+			return rule, err
+		}
+		if c.CondType == "filter" {
+			types = ct
+			continue
+		}
+		if types == nil {
+			types = ct
+		} else if c.ResourceTypes != nil && strings.Join(ct, ",") != strings.Join(types, ",") {
+			return rule, fmt.Errorf("conditions target different resource types")
+		}
+		cond, err := c.condition()
+		if err != nil {
+			return rule, err
+		}
+		rule.Assert = append(rule.Assert, cond)
+	}
+	rule.ResourceTypes = types
+	return rule, nil
+}
+
+// flatten collects the leaf conditions of a definition joined by and.
+func (c checkovCondition) flatten(out *[]checkovCondition) error {
+	switch {
+	case len(c.Or) > 0:
+		return fmt.Errorf("or conditions have no catalog equivalent")
+	case len(c.And) > 0:
+		for _, sub := range c.And {
+			if err := sub.flatten(out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	switch c.CondType {
+	case "attribute":
+		*out = append(*out, c)
+	case "filter":
+		if c.Attribute != "resource_type" {
+			return fmt.Errorf("filter on %q is not supported", c.Attribute)
+		}
+		*out = append(*out, c)
+	default:
+		return fmt.Errorf("cond_type %q is not supported", c.CondType)
+	}
+	return nil
+}
+
+// resourceTypes returns the types a condition names: a filter's value or
+// an attribute condition's resource_types.
+func (c checkovCondition) resourceTypes() ([]string, error) {
+	v := c.ResourceTypes
+	if c.CondType == "filter" {
+		v = c.Value
+	}
+	var types []string
+	switch v := v.(type) {
+	case nil:
+	case string:
+		if v == "all" {
+			return nil, fmt.Errorf("conditions on all resource types are not supported")
+		}
+		types = []string{v}
+	case []interface{}:
+		for _, t := range v {
+			types = append(types, fmt.Sprint(t))
+		}
+	}
+	return types, nil
+}
+
+func (c checkovCondition) condition() (Condition, error) {
+	op, ok := checkovOperators[c.Operator]
+	if !ok {
+		return Condition{}, fmt.Errorf("operator %q is not supported", c.Operator)
+	}
+	cond := Condition{Property: importPath(c.Attribute), Operator: op, Value: importValue(op, c.Value)}
+	switch c.Operator {
+	case "is_true":
+		cond.Value = true
+	case "is_false":
+		cond.Value = false
+	case "exists", "not_exists":
+		cond.Value = nil
+	}
+	return cond, nil
+}
+
+func (c tfsecCheck) catalogRule() (CatalogRule, error) {
+	rule := CatalogRule{
+		ID:            c.Code,
+		Severity:      importSeverity(c.Severity),
+		Title:         c.Description,
+		Description:   c.Impact,
+		Remediation:   c.Resolution,
+		ResourceTypes: c.RequiredLabels,
+		Message:       c.ErrorMessage,
+	}
+	if rule.Description == "" {
+		rule.Description = c.Description
+	}
+	if len(c.RelatedLinks) > 0 {
+		rule.Reference = importReference(c.Description, c.RelatedLinks[0])
+	}
+	for _, t := range c.RequiredTypes {
+		if t != "resource" {
+			return rule, fmt.Errorf("required type %q is not supported", t)
+		}
+	}
+	conds, err := c.MatchSpec.conditions("")
+	rule.Assert = conds
+	return rule, err
+}
+
+// conditions translates a match spec into conditions that must all hold;
+// prefix is the path of the block a sub-match applies within.
+func (m tfsecMatch) conditions(prefix string) ([]Condition, error) {
+	switch {
+	case m.Action == "and":
+		var out []Condition
+		for _, sub := range m.PredicateMatchSpec {
+			conds, err := sub.conditions(prefix)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, conds...)
+		}
+		return out, nil
+	case m.SubMatch != nil:
+		if m.Action != "isPresent" {
+			return nil, fmt.Errorf("subMatch with action %q is not supported", m.Action)
+		}
+		inner, err := m.SubMatch.conditions(prefix + m.Name + ".")
+		if err != nil {
+			return nil, err
+		}
+		return append([]Condition{{Property: prefix + m.Name, Operator: OpPresent}}, inner...), nil
+	}
+	op, ok := tfsecActions[m.Action]
+	if !ok {
+		return nil, fmt.Errorf("action %q is not supported", m.Action)
+	}
+	cond := Condition{Property: prefix + m.Name, Operator: op, Value: importValue(op, m.Value)}
+	if op == OpPresent || op == OpAbsent {
+		cond.Value = nil
+	}
+	return []Condition{cond}, nil
+}
+
+// importPath turns a Checkov attribute path into a catalog path: list
+// indexes and wildcards go, since catalog paths check every element.
+func importPath(attr string) string {
+	var parts []string
+	for _, p := range strings.Split(attr, ".") {
+		if p == "*" || p == "[*]" {
+			continue
+		}
+		if _, err := strconv.Atoi(p); err == nil {
+			continue
+		}
+		parts = append(parts, p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// importValue converts numeric strings, which rule files often quote, for
+// the numeric operators; other values are kept.
+func importValue(op string, v interface{}) interface{} {
+	switch op {
+	case OpAtLeast, OpAtMost, OpGreaterThan, OpLessThan:
+	default:
+		return v
+	}
+	if s, ok := v.(string); ok {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return v
+}
+
+func importSeverity(s string) protocol.Severity {
+	if sev, ok := tfsecSeverities[strings.ToUpper(strings.TrimSpace(s))]; ok {
+		return sev
+	}
+	if sev, ok := protocol.ParseSeverity(s); ok && s != "" {
+		return sev
+	}
+	return SeverityMedium
+}
+
+func importReference(title, link string) *protocol.Reference {
+	if link == "" {
+		return nil
+	}
+	return &protocol.Reference{Title: title, URL: link}
+}
@@ -0,0 +1,195 @@
+package analyzer
+
+import (
+	"crypto/sha256"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Delta is the change in findings caused by one file update.
+type Delta struct {
+	Path string `json:"path"`
+	// Added are findings that were not reported before the update.
+	Added []protocol.Finding `json:"added,omitempty"`
+	// Fixed are findings that no longer apply.
+	Fixed []protocol.Finding `json:"fixed,omitempty"`
+	// Evaluated is the number of resources whose rules were re-run; the
+	// others kept their cached findings.
+	Evaluated int `json:"evaluated"`
+}
+
+// Empty reports whether the update changed no findings.
+func (d Delta) Empty() bool { return len(d.Added) == 0 && len(d.Fixed) == 0 }
+
+// Incremental analyzes a set of files as they change, for editors and watch
+// loops. It caches each file's parse and each resource's findings, so an
+// update only re-runs the rules that apply to resources whose source
+// changed or moved, and reports the difference rather than the full
+// result. Resources with exemptions that expire are re-run on every update.
+// Resources are analyzed as written; variables are not resolved across
+// files.
+type Incremental struct {
+	mu    sync.Mutex
+	rules []Rule
+	files map[string]*fileState
+	now   func() time.Time
+}
+
+type fileState struct {
+	sum       [32]byte
+	resources map[string]resourceState // keyed by type.name
+	// expiring is set when a resource's findings depend on the time.
+	expiring bool
+}
+
+type resourceState struct {
+	sum      [32]byte
+	findings []protocol.Finding
+	expiring bool
+}
+
+// NewIncremental creates an Incremental analyzer running rules.
+func NewIncremental(rules []Rule) *Incremental {
+	return &Incremental{rules: rules, files: make(map[string]*fileState), now: time.Now}
+}
+
+// Update analyzes the new content of a file and returns how its findings
+// changed. An unchanged file costs one hash unless it has exemptions that
+// expire.
+func (inc *Incremental) Update(path, content string) Delta {
+	inc.mu.Lock()
+	defer inc.mu.Unlock()
+	delta := Delta{Path: path}
+	sum := sha256.Sum256([]byte(content))
+	prev := inc.files[path]
+	if prev != nil && prev.sum == sum && !prev.expiring {
+		return delta
+	}
+	if prev == nil {
+		prev = &fileState{}
+	}
+
+	next := &fileState{sum: sum, resources: make(map[string]resourceState)}
+	now := inc.now()
+	for _, res := range parser.ParseResources(content) {
+		key := res.Type + "." + res.Name
+		rsum := resourceSum(res, content)
+		if old, ok := prev.resources[key]; ok && old.sum == rsum && !old.expiring {
+			next.resources[key] = old
+			continue
+		}
+		delta.Evaluated++
+		findings := Run(inc.applicable(res.Type), []protocol.Resource{res})
+		skipped := SkippedRules(res, content, now)
+		kept := findings[:0]
+		for _, f := range findings {
+			if !skipped[skipKey(f.RuleID)] {
+				kept = append(kept, f)
+			}
+		}
+		expiring := expiringSkip(res, now)
+		next.expiring = next.expiring || expiring
+		next.resources[key] = resourceState{sum: rsum, findings: kept, expiring: expiring}
+		delta.Added = append(delta.Added, diffFindings(kept, prev.resources[key].findings)...)
+		delta.Fixed = append(delta.Fixed, diffFindings(prev.resources[key].findings, kept)...)
+	}
+	for key, old := range prev.resources {
+		if _, ok := next.resources[key]; !ok {
+			delta.Fixed = append(delta.Fixed, old.findings...)
+		}
+	}
+	inc.files[path] = next
+	return delta
+}
+
+// Remove forgets a deleted file; its findings are reported as fixed.
+func (inc *Incremental) Remove(path string) Delta {
+	inc.mu.Lock()
+	defer inc.mu.Unlock()
+	delta := Delta{Path: path}
+	if prev, ok := inc.files[path]; ok {
+		for _, key := range sortedResourceKeys(prev) {
+			delta.Fixed = append(delta.Fixed, prev.resources[key].findings...)
+		}
+		delete(inc.files, path)
+	}
+	return delta
+}
+
+// Findings returns the current findings of every file, keyed by path.
+func (inc *Incremental) Findings() map[string][]protocol.Finding {
+	inc.mu.Lock()
+	defer inc.mu.Unlock()
+	out := make(map[string][]protocol.Finding, len(inc.files))
+	for path, f := range inc.files {
+		var findings []protocol.Finding
+		for _, key := range sortedResourceKeys(f) {
+			findings = append(findings, f.resources[key].findings...)
+		}
+		out[path] = findings
+	}
+	return out
+}
+
+// applicable returns the rules that can fire for a resource type.
+func (inc *Incremental) applicable(resType string) []Rule {
+	var rules []Rule
+	for _, r := range inc.rules {
+		if r.Applies(resType) {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// resourceSum identifies a resource's source, including the comment lines
+// above it that can carry annotations and skip comments, and its line,
+// which findings such as secret matches report.
+func resourceSum(res protocol.Resource, code string) [32]byte {
+	return sha256.Sum256([]byte(res.Type + "\x00" + res.Name + "\x00" + strconv.Itoa(res.Line) + "\x00" + res.RawBlock + "\x00" + parser.LeadingComments(code, res.Line)))
+}
+
+// expiringSkip reports whether res has an exemption that is active at now
+// but will end, so its findings must be evaluated again.
+func expiringSkip(res protocol.Resource, now time.Time) bool {
+	if res.Annotations == nil {
+		return false
+	}
+	for _, e := range res.Annotations.Exemptions {
+		if !e.Until.IsZero() && e.Active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// diffFindings returns the findings in a that are not in b.
+func diffFindings(a, b []protocol.Finding) []protocol.Finding {
+	seen := make(map[protocol.Finding]int, len(b))
+	for _, f := range b {
+		seen[f]++
+	}
+	var out []protocol.Finding
+	for _, f := range a {
+		if seen[f] > 0 {
+			seen[f]--
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func sortedResourceKeys(f *fileState) []string {
+	keys := make([]string, 0, len(f.resources))
+	for k := range f.resources {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
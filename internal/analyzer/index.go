@@ -0,0 +1,161 @@
+package analyzer
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// RuleIndex is a rule set indexed by resource type, so each resource is
+// checked only against the rules that apply to it. Agents whose rules are
+// fixed build one at construction; Run and Controls build one per call.
+type RuleIndex struct {
+	rules []Rule
+	// byType holds, for each type a rule names, the positions of the rules
+	// applying to it in rule order; types no rule names get anyType.
+	byType  map[string][]int
+	anyType []int
+}
+
+// NewRuleIndex indexes rules by the resource types they apply to.
+func NewRuleIndex(rules []Rule) *RuleIndex {
+	x := &RuleIndex{rules: rules, byType: make(map[string][]int)}
+	for i, r := range rules {
+		if len(r.ResourceTypes) == 0 || containsType(r.ResourceTypes, "*") {
+			x.anyType = append(x.anyType, i)
+		}
+	}
+	for _, r := range rules {
+		for _, t := range r.ResourceTypes {
+			if t == "*" {
+				continue
+			}
+			if _, ok := x.byType[t]; ok {
+				continue
+			}
+			var pos []int
+			for i, r := range rules {
+				if r.Applies(t) {
+					pos = append(pos, i)
+				}
+			}
+			x.byType[t] = pos
+		}
+	}
+	return x
+}
+
+func containsType(types []string, t string) bool {
+	for _, s := range types {
+		if s == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules returns the indexed rules.
+func (x *RuleIndex) Rules() []Rule { return x.rules }
+
+// For returns the rules that apply to resType, in rule order.
+func (x *RuleIndex) For(resType string) []Rule {
+	pos := x.positions(resType)
+	rules := make([]Rule, len(pos))
+	for i, p := range pos {
+		rules[i] = x.rules[p]
+	}
+	return rules
+}
+
+func (x *RuleIndex) positions(resType string) []int {
+	if pos, ok := x.byType[resType]; ok {
+		return pos
+	}
+	return x.anyType
+}
+
+// Run evaluates the indexed rules against resources, as the package Run.
+func (x *RuleIndex) Run(resources []protocol.Resource) []protocol.Finding {
+	return findingsOf(x.Controls(resources))
+}
+
+// Controls evaluates the indexed rules against resources, as the package
+// Controls.
+func (x *RuleIndex) Controls(resources []protocol.Resource) []ControlResult {
+	var results []ControlResult
+	for _, res := range resources {
+		if res.Deleted() {
+			continue
+		}
+		for _, p := range x.positions(res.Type) {
+			results = append(results, control(x.rules[p], res))
+		}
+	}
+	return results
+}
+
+// warmUpConfig is a small configuration covering the resource types most
+// rules check, scanned by WarmUp.
+const warmUpConfig = `resource "azurerm_storage_account" "warmup" {
+  name                          = "warmup"
+  enable_https_traffic_only     = true
+  min_tls_version               = "TLS1_2"
+  public_network_access_enabled = false
+}
+
+resource "azurerm_network_security_group" "warmup" {
+  name = "warmup"
+  security_rule {
+    name                   = "ssh"
+    access                 = "Allow"
+    direction              = "Inbound"
+    source_address_prefix  = "10.0.0.0/8"
+    destination_port_range = "22"
+  }
+}
+
+resource "azurerm_key_vault" "warmup" {
+  name                     = "warmup"
+  purge_protection_enabled = true
+}
+
+resource "azurerm_kubernetes_cluster" "warmup" {
+  name                              = "warmup"
+  role_based_access_control_enabled = true
+}
+
+output "warmup" {
+  value = azurerm_storage_account.warmup.name
+}
+`
+
+// WarmUp parses a sample configuration and runs the indexed rules over
+// it, so the parser, the rule checks and their pattern caches are ready
+// before the first request. It reports the number of checks run.
+func (x *RuleIndex) WarmUp() int {
+	resources := parser.ParseResources(warmUpConfig)
+	results := x.Controls(resources)
+	for _, c := range results {
+		c.Evidence()
+	}
+	return len(results)
+}
+
+// patterns caches the regular expressions of matches conditions, compiled
+// when a catalog file or rule pack is loaded rather than on every check.
+var patterns sync.Map
+
+// compilePattern compiles expr once and returns the cached result.
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(expr, re)
+	return re, nil
+}
@@ -0,0 +1,331 @@
+package analyzer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// negativeOperators pass when the property is not set.
+var negativeOperators = map[string]bool{OpAbsent: true, OpNotEquals: true, OpNotIn: true}
+
+// validateOperator checks that value suits op, as declared in a rule pack.
+func validateOperator(op string, value interface{}) error {
+	switch op {
+	case OpAbsent, OpPresent:
+		return nil
+	case OpEquals, OpNotEquals:
+		if value == nil {
+			return fmt.Errorf("operator %s needs a value", op)
+		}
+	case OpAtLeast, OpAtMost, OpGreaterThan, OpLessThan:
+		if _, ok := toNumber(value); !ok {
+			return fmt.Errorf("operator %s needs a numeric value", op)
+		}
+	case OpIn, OpNotIn:
+		if list, ok := value.([]interface{}); !ok || len(list) == 0 {
+			return fmt.Errorf("operator %s needs a list of values", op)
+		}
+	case OpMatches:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("operator %s needs a regular expression", op)
+		}
+		if _, err := compilePattern(s); err != nil {
+			return fmt.Errorf("operator %s: %w", op, err)
+		}
+	case OpStartsWith, OpEndsWith:
+		if s, ok := value.(string); !ok || s == "" {
+			return fmt.Errorf("operator %s needs a string value", op)
+		}
+	case OpWithinCIDR:
+		prefixes := cidrList(value)
+		if len(prefixes) == 0 {
+			return fmt.Errorf("operator %s needs a CIDR or a list of CIDRs", op)
+		}
+		for _, p := range prefixes {
+			if _, ok := parsePrefix(p); !ok {
+				return fmt.Errorf("operator %s: invalid CIDR %q", op, p)
+			}
+		}
+	case OpCoversPort:
+		ports := portList(value)
+		if len(ports) == 0 {
+			return fmt.Errorf("operator %s needs a port or a list of ports", op)
+		}
+		for _, p := range ports {
+			if p < 1 || p > 65535 {
+				return fmt.Errorf("operator %s: invalid port %d", op, p)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown operator %q", op)
+	}
+	return nil
+}
+
+// Check evaluates the candidate against resource properties. A path through
+// a list of blocks (e.g. security_rule.priority), or to a list value (e.g.
+// network_rules.ip_rules), checks every element. Paths joined by "|" (e.g.
+// destination_port_range|destination_port_ranges) pool their values.
+func (c RuleCandidate) Check(props map[string]interface{}) string {
+	vals := lookupAlternatives(props, c.Property)
+	switch c.Operator {
+	case OpAbsent:
+		if len(vals) > 0 {
+			return fmt.Sprintf("%s must not be set", c.Property)
+		}
+		return ""
+	case OpPresent:
+		if len(vals) == 0 {
+			return fmt.Sprintf("%s is not set", c.Property)
+		}
+		return ""
+	}
+	if len(vals) == 0 {
+		if negativeOperators[c.Operator] {
+			return ""
+		}
+		return fmt.Sprintf("%s is not set (expected: %s)", c.Property, c.expectation())
+	}
+	for _, v := range vals {
+		if !c.holds(v) {
+			return fmt.Sprintf("%s = %v (expected: %s)", c.Property, v, c.expectation())
+		}
+	}
+	return ""
+}
+
+// expectation renders the operator and value for messages, e.g. ">= 3".
+func (c RuleCandidate) expectation() string {
+	if c.Operator == OpEquals {
+		return fmt.Sprint(c.Value)
+	}
+	return fmt.Sprintf("%s %v", c.operatorSymbol(), c.Value)
+}
+
+// holds reports whether one value satisfies the operator.
+func (c RuleCandidate) holds(v interface{}) bool {
+	switch c.Operator {
+	case OpEquals:
+		return valuesEqual(v, c.Value)
+	case OpNotEquals:
+		return !valuesEqual(v, c.Value)
+	case OpAtLeast, OpAtMost, OpGreaterThan, OpLessThan:
+		n, ok := toNumber(v)
+		want, _ := toNumber(c.Value)
+		if !ok {
+			return false
+		}
+		switch c.Operator {
+		case OpAtLeast:
+			return n >= want
+		case OpAtMost:
+			return n <= want
+		case OpGreaterThan:
+			return n > want
+		default:
+			return n < want
+		}
+	case OpIn, OpNotIn:
+		list, _ := c.Value.([]interface{})
+		found := false
+		for _, item := range list {
+			if valuesEqual(v, item) {
+				found = true
+				break
+			}
+		}
+		return found == (c.Operator == OpIn)
+	case OpMatches:
+		s, ok := v.(string)
+		re, err := compilePattern(fmt.Sprint(c.Value))
+		return ok && err == nil && re.MatchString(s)
+	case OpStartsWith:
+		s, ok := v.(string)
+		return ok && strings.HasPrefix(s, fmt.Sprint(c.Value))
+	case OpEndsWith:
+		s, ok := v.(string)
+		return ok && strings.HasSuffix(s, fmt.Sprint(c.Value))
+	case OpWithinCIDR:
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		return withinCIDR(s, cidrList(c.Value))
+	case OpCoversPort:
+		return coversPort(v, portList(c.Value))
+	}
+	return false
+}
+
+// lookupAlternatives returns the values of every path in a "|"-separated
+// list, as lookupValues does for one.
+func lookupAlternatives(props map[string]interface{}, paths string) []interface{} {
+	var out []interface{}
+	for _, path := range strings.Split(paths, "|") {
+		out = append(out, lookupValues(props, strings.TrimSpace(path))...)
+	}
+	return out
+}
+
+// lookupValues resolves a dotted path like lookupPath, descending into
+// every element of a list of blocks, and returns the leaf values with leaf
+// lists expanded.
+func lookupValues(props map[string]interface{}, path string) []interface{} {
+	cur := []interface{}{props}
+	for _, key := range strings.Split(path, ".") {
+		var next []interface{}
+		for _, node := range cur {
+			for _, m := range blocks(node) {
+				if v, ok := m[key]; ok {
+					next = append(next, v)
+				}
+			}
+		}
+		cur = next
+	}
+	var out []interface{}
+	for _, v := range cur {
+		if list, ok := v.([]interface{}); ok {
+			out = append(out, list...)
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// blocks returns node as property maps: itself, or the maps in a list.
+func blocks(node interface{}) []map[string]interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{n}
+	case []interface{}:
+		var out []map[string]interface{}
+		for _, item := range n {
+			if m, ok := item.(map[string]interface{}); ok {
+				out = append(out, m)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// valuesEqual compares numbers by value (so 3, 3.0 and "3" are equal) and
+// anything else by its printed form.
+func valuesEqual(a, b interface{}) bool {
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			return x == y
+		}
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// toNumber converts numbers and numeric strings to float64.
+func toNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// cidrList returns a within_cidr value as a list of strings.
+func cidrList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			out = append(out, fmt.Sprint(item))
+		}
+		return out
+	}
+	return nil
+}
+
+// parsePrefix parses a CIDR, or a bare address as a single-address prefix.
+func parsePrefix(s string) (netip.Prefix, bool) {
+	s = strings.TrimSpace(s)
+	if p, err := netip.ParsePrefix(s); err == nil {
+		return p.Masked(), true
+	}
+	if a, err := netip.ParseAddr(s); err == nil {
+		return netip.PrefixFrom(a, a.BitLen()), true
+	}
+	return netip.Prefix{}, false
+}
+
+// withinCIDR reports whether the address or range s lies entirely inside
+// one of the allowed CIDRs. Values that are not addresses, such as "*" or
+// a service tag, are not.
+func withinCIDR(s string, allowed []string) bool {
+	p, ok := parsePrefix(s)
+	if !ok {
+		return false
+	}
+	for _, a := range allowed {
+		outer, ok := parsePrefix(a)
+		if ok && outer.Addr().Is4() == p.Addr().Is4() && outer.Bits() <= p.Bits() && outer.Contains(p.Addr()) {
+			return true
+		}
+	}
+	return false
+}
+
+// portList returns a covers_port value as a list of ports.
+func portList(value interface{}) []int {
+	items, ok := value.([]interface{})
+	if !ok {
+		items = []interface{}{value}
+	}
+	var out []int
+	for _, item := range items {
+		n, ok := toNumber(item)
+		if !ok || n != float64(int(n)) {
+			return nil
+		}
+		out = append(out, int(n))
+	}
+	return out
+}
+
+// coversPort reports whether a port specification, as NSG rules write it
+// ("22", "1000-2000" or "*"), includes one of ports.
+func coversPort(spec interface{}, ports []int) bool {
+	s := strings.TrimSpace(fmt.Sprint(spec))
+	if s == "*" || strings.EqualFold(s, "any") {
+		return true
+	}
+	lo, hi, ok := strings.Cut(s, "-")
+	if !ok {
+		hi = lo
+	}
+	from, err1 := strconv.Atoi(strings.TrimSpace(lo))
+	to, err2 := strconv.Atoi(strings.TrimSpace(hi))
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	for _, p := range ports {
+		if p >= from && p <= to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package analyzer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// BuiltinPackVersion is reported by hosts running without a rule pack.
+const BuiltinPackVersion = "builtin"
+
+// RulePack is a versioned set of rule changes loaded at runtime: extra
+// declarative rules, built-in rules to disable, and severity overrides.
+type RulePack struct {
+	Version    string                       `json:"version"`
+	Rules      []PackRule                   `json:"rules,omitempty"`
+	Disabled   []string                     `json:"disabled,omitempty"`
+	Severities map[string]protocol.Severity `json:"severities,omitempty"`
+
+	// Digest identifies the pack document; see PackDigest.
+	Digest string `json:"-"`
+	raw    []byte
+}
+
+// PackRule declares a rule: resources of ResourceType must satisfy Operator
+// on Property (a dotted path for nested blocks), as for synthesized rules.
+// Through repeated blocks and lists, every element must satisfy it.
+type PackRule struct {
+	ID           string            `json:"id"`
+	Category     string            `json:"category,omitempty"`
+	Severity     protocol.Severity `json:"severity"`
+	Title        string            `json:"title,omitempty"`
+	ResourceType string            `json:"resource_type"`
+	Property     string            `json:"property"`
+	Operator     string            `json:"operator"`
+	Value        interface{}       `json:"value,omitempty"`
+}
+
+// RulePackState describes the pack a host has installed.
+type RulePackState struct {
+	Version string `json:"version"`
+	Digest  string `json:"digest,omitempty"`
+	// Rules is the number of active rules.
+	Rules int `json:"rules"`
+	// Pack is the installed document, so a rollout can restore it.
+	Pack json.RawMessage `json:"pack,omitempty"`
+}
+
+// PackDigest returns "sha256:<hex>" of a pack document. Whitespace is
+// ignored, so a pack keeps its digest when re-encoded in transit.
+func PackDigest(data []byte) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err == nil {
+		data = buf.Bytes()
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// LoadRulePack parses and validates a pack document.
+func LoadRulePack(data []byte) (*RulePack, error) {
+	var p RulePack
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("invalid rule pack: %w", err)
+	}
+	if strings.TrimSpace(p.Version) == "" || p.Version == BuiltinPackVersion {
+		return nil, fmt.Errorf("rule pack needs a version other than %q", BuiltinPackVersion)
+	}
+	known := make(map[string]bool)
+	for _, r := range builtinRules() {
+		known[r.ID] = true
+	}
+	for i, r := range p.Rules {
+		switch {
+		case r.ID == "":
+			return nil, fmt.Errorf("rule %d: missing id", i)
+		case known[r.ID]:
+			return nil, fmt.Errorf("rule %s: duplicate id", r.ID)
+		}
+		if err := p.Rules[i].validate(); err != nil {
+			return nil, err
+		}
+		known[r.ID] = true
+	}
+	for _, id := range p.Disabled {
+		if !known[id] {
+			return nil, fmt.Errorf("disabled rule %s does not exist", id)
+		}
+	}
+	for id, level := range p.Severities {
+		if !known[id] {
+			return nil, fmt.Errorf("severity override for unknown rule %s", id)
+		}
+		sev, ok := protocol.ParseSeverity(string(level))
+		if !ok {
+			return nil, fmt.Errorf("rule %s: unknown severity %q", id, level)
+		}
+		p.Severities[id] = sev
+	}
+	p.Digest = PackDigest(data)
+	p.raw = append([]byte(nil), data...)
+	return &p, nil
+}
+
+// ParsePackRule parses and validates a single rule declaration, such as a
+// proposed rule to simulate. Its ID may be a built-in rule's, to try out a
+// replacement.
+func ParsePackRule(data []byte) (PackRule, error) {
+	var r PackRule
+	if err := json.Unmarshal(data, &r); err != nil {
+		return r, fmt.Errorf("invalid rule: %w", err)
+	}
+	if r.ID == "" {
+		return r, fmt.Errorf("rule: missing id")
+	}
+	if err := r.validate(); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// validate checks the declaration and normalizes its severity.
+func (r *PackRule) validate() error {
+	if r.ResourceType == "" || r.Property == "" {
+		return fmt.Errorf("rule %s: resource_type and property are required", r.ID)
+	}
+	sev, ok := protocol.ParseSeverity(string(r.Severity))
+	if !ok {
+		return fmt.Errorf("rule %s: unknown severity %q", r.ID, r.Severity)
+	}
+	r.Severity = sev
+	if err := validateOperator(r.Operator, r.Value); err != nil {
+		return fmt.Errorf("rule %s: %w", r.ID, err)
+	}
+	return nil
+}
+
+// Rule builds the declaration as a runnable Rule.
+func (r PackRule) Rule() Rule {
+	c := RuleCandidate{ResourceType: r.ResourceType, Property: r.Property, Operator: r.Operator, Value: r.Value}
+	rule := c.Rule(r.ID, r.Severity)
+	if r.Category != "" {
+		rule.Category = r.Category
+	}
+	if r.Title != "" {
+		rule.Title, rule.Description = r.Title, r.Title
+	}
+	return rule
+}
+
+// apply returns rules with the pack's changes.
+func (p *RulePack) apply(rules []Rule) []Rule {
+	disabled := make(map[string]bool, len(p.Disabled))
+	for _, id := range p.Disabled {
+		disabled[id] = true
+	}
+	for _, pr := range p.Rules {
+		rules = append(rules, pr.Rule())
+	}
+	out := rules[:0]
+	for _, r := range rules {
+		if disabled[r.ID] {
+			continue
+		}
+		if sev, ok := p.Severities[r.ID]; ok {
+			r.Severity = sev
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+var (
+	packMu     sync.RWMutex
+	activePack *RulePack
+)
+
+// InstallRulePack makes p the pack AllRules applies. A nil pack restores the
+// built-in rules.
+func InstallRulePack(p *RulePack) {
+	packMu.Lock()
+	activePack = p
+	packMu.Unlock()
+}
+
+// CurrentRulePack reports the installed pack.
+func CurrentRulePack() RulePackState {
+	packMu.RLock()
+	p := activePack
+	packMu.RUnlock()
+	if p == nil {
+		return RulePackState{Version: BuiltinPackVersion, Rules: len(AllRules())}
+	}
+	return RulePackState{Version: p.Version, Digest: p.Digest, Rules: len(AllRules()), Pack: p.raw}
+}
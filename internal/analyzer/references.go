@@ -0,0 +1,98 @@
+package analyzer
+
+import "github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+
+// Documentation cited by the built-in rules written in Go; catalog rules
+// carry theirs in the catalog files.
+var (
+	storageSecureTransferDoc = protocol.Reference{
+		Title: "Require secure transfer to ensure secure connections",
+		URL:   "https://learn.microsoft.com/azure/storage/common/storage-require-secure-transfer",
+	}
+	aksRBACDoc = protocol.Reference{
+		Title: "Use Azure RBAC for Kubernetes authorization",
+		URL:   "https://learn.microsoft.com/azure/aks/manage-azure-rbac",
+	}
+	storageTLSDoc = protocol.Reference{
+		Title: "Enforce a minimum required version of TLS for requests to a storage account",
+		URL:   "https://learn.microsoft.com/azure/storage/common/transport-layer-security-configure-minimum-version",
+	}
+	blobAnonymousAccessDoc = protocol.Reference{
+		Title: "Remediate anonymous read access to blob data",
+		URL:   "https://learn.microsoft.com/azure/storage/blobs/anonymous-read-access-prevent",
+	}
+	keyVaultSoftDeleteDoc = protocol.Reference{
+		Title: "Azure Key Vault soft-delete overview",
+		URL:   "https://learn.microsoft.com/azure/key-vault/general/soft-delete-overview",
+	}
+	keyVaultSecretsDoc = protocol.Reference{
+		Title: "About Azure Key Vault secrets",
+		URL:   "https://learn.microsoft.com/azure/key-vault/secrets/about-secrets",
+	}
+	privateLinkDoc = protocol.Reference{
+		Title: "What is Azure Private Link?",
+		URL:   "https://learn.microsoft.com/azure/private-link/private-link-overview",
+	}
+	storageCMKDoc = protocol.Reference{
+		Title: "Customer-managed keys for Azure Storage encryption",
+		URL:   "https://learn.microsoft.com/azure/storage/common/customer-managed-keys-overview",
+	}
+	nsgDoc = protocol.Reference{
+		Title: "Azure network security groups overview",
+		URL:   "https://learn.microsoft.com/azure/virtual-network/network-security-groups-overview",
+	}
+	terraformSensitiveOutputDoc = protocol.Reference{
+		Title: "Terraform output values: sensitive",
+		URL:   "https://developer.hashicorp.com/terraform/language/values/outputs",
+	}
+	keyVaultRBACDoc = protocol.Reference{
+		Title: "Provide access to Key Vault keys, certificates, and secrets with Azure RBAC",
+		URL:   "https://learn.microsoft.com/azure/key-vault/general/rbac-guide",
+	}
+	storageSASDoc = protocol.Reference{
+		Title: "Grant limited access to Azure Storage resources using shared access signatures",
+		URL:   "https://learn.microsoft.com/azure/storage/common/storage-sas-overview",
+	}
+	nist80053Doc = protocol.Reference{
+		Title: "NIST SP 800-53 Rev. 5: Security and Privacy Controls",
+		URL:   "https://csrc.nist.gov/pubs/sp/800/53/r5/upd1/final",
+	}
+)
+
+// LookupRule returns the active rule with an ID, resolving external IDs
+// such as CKV_AZURE_3 to the built-in rule they map to.
+func LookupRule(id string) (Rule, bool) {
+	native, ok := MapExternalID(id)
+	if !ok {
+		return Rule{}, false
+	}
+	for _, r := range AllRules() {
+		if r.ID == native {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// RuleReference returns the documentation cited by a rule, if it has any.
+func RuleReference(id string) (protocol.Reference, bool) {
+	r, ok := LookupRule(id)
+	return r.Reference, ok && r.Reference.URL != ""
+}
+
+// References returns the documentation of the rules behind findings, one
+// entry per URL, in the order the findings cite them.
+func References(findings []protocol.Finding) []protocol.Reference {
+	var cites protocol.Citations
+	seen := make(map[string]bool)
+	for _, f := range findings {
+		if seen[f.RuleID] {
+			continue
+		}
+		seen[f.RuleID] = true
+		if ref, ok := RuleReference(f.RuleID); ok {
+			cites.Cite(ref)
+		}
+	}
+	return cites.References()
+}
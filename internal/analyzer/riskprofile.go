@@ -0,0 +1,290 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// RiskProfile is how risky changing each resource type is: the weight it
+// adds to a blast radius and whether destroying or updating it risks data
+// loss or downtime. Environments scale and override the base profile, so
+// the same change can weigh more in prod than in dev.
+type RiskProfile struct {
+	// DefaultWeight is the weight of types the profile does not list.
+	DefaultWeight int                 `json:"default_weight"`
+	Types         map[string]TypeRisk `json:"types"`
+	// Environments are keyed by the lowercase environment name a request
+	// is run for (protocol.MetaEnvironment).
+	Environments map[string]EnvironmentRisk `json:"environments,omitempty"`
+}
+
+// TypeRisk is the risk of changing one resource type. Unset fields take
+// the default weight and no risk, or in an environment override, the base
+// profile's values.
+type TypeRisk struct {
+	Weight int `json:"weight,omitempty"`
+	// DataLoss marks stateful types, whose data is gone when they are
+	// destroyed or replaced: the new object starts empty.
+	DataLoss *bool `json:"data_loss,omitempty"`
+	// Downtime marks types that restart, and so are briefly unavailable,
+	// on in-place updates.
+	Downtime *bool `json:"downtime,omitempty"`
+}
+
+// EnvironmentRisk overrides the base profile for one environment.
+type EnvironmentRisk struct {
+	// Multiplier scales every weight in the environment, after its type
+	// overrides. Zero leaves weights unscaled.
+	Multiplier float64             `json:"multiplier,omitempty"`
+	Types      map[string]TypeRisk `json:"types,omitempty"`
+}
+
+// builtinWeights, statefulTypes and restartTypes make up the default
+// profile.
+var builtinWeights = map[string]int{
+	"azurerm_kubernetes_cluster":     8,
+	"azurerm_virtual_machine":        5,
+	"azurerm_linux_virtual_machine":  5,
+	"azurerm_mssql_server":           7,
+	"azurerm_mssql_database":         6,
+	"azurerm_cosmosdb_account":       7,
+	"azurerm_key_vault":              6,
+	"azurerm_storage_account":        4,
+	"azurerm_container_registry":     4,
+	"azurerm_service_plan":           3,
+	"azurerm_redis_cache":            5,
+	"azurerm_virtual_network":        3,
+	"azurerm_subnet":                 2,
+	"azurerm_network_security_group": 4,
+}
+
+var statefulTypes = []string{
+	"azurerm_storage_account",
+	"azurerm_storage_container",
+	"azurerm_storage_share",
+	"azurerm_mssql_server",
+	"azurerm_mssql_database",
+	"azurerm_postgresql_flexible_server",
+	"azurerm_mysql_flexible_server",
+	"azurerm_cosmosdb_account",
+	"azurerm_cosmosdb_sql_database",
+	"azurerm_redis_cache",
+	"azurerm_key_vault",
+	"azurerm_key_vault_secret",
+	"azurerm_key_vault_key",
+	"azurerm_managed_disk",
+	"azurerm_log_analytics_workspace",
+	"azurerm_container_registry",
+	"azurerm_recovery_services_vault",
+	"azurerm_servicebus_namespace",
+	"azurerm_eventhub_namespace",
+	"azurerm_data_protection_backup_vault",
+}
+
+var restartTypes = []string{
+	"azurerm_virtual_machine",
+	"azurerm_linux_virtual_machine",
+	"azurerm_windows_virtual_machine",
+	"azurerm_linux_web_app",
+	"azurerm_windows_web_app",
+	"azurerm_linux_function_app",
+	"azurerm_windows_function_app",
+	"azurerm_redis_cache",
+}
+
+// DefaultRiskProfile returns the built-in profile, which has no
+// environment overrides.
+func DefaultRiskProfile() *RiskProfile {
+	yes := true
+	p := &RiskProfile{DefaultWeight: 2, Types: make(map[string]TypeRisk)}
+	for t, w := range builtinWeights {
+		p.Types[t] = TypeRisk{Weight: w}
+	}
+	for _, t := range statefulTypes {
+		r := p.Types[t]
+		r.DataLoss = &yes
+		p.Types[t] = r
+	}
+	for _, t := range restartTypes {
+		r := p.Types[t]
+		r.Downtime = &yes
+		p.Types[t] = r
+	}
+	return p
+}
+
+// ParseRiskProfile parses and validates a profile document. Unknown fields
+// are rejected, so a misspelt key does not silently leave a default.
+func ParseRiskProfile(data []byte) (*RiskProfile, error) {
+	var p RiskProfile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("invalid risk profile: %w", err)
+	}
+	if p.DefaultWeight < 1 {
+		return nil, errors.New("invalid risk profile: default_weight must be at least 1")
+	}
+	if err := validTypeRisks(p.Types, ""); err != nil {
+		return nil, err
+	}
+	envs := make(map[string]EnvironmentRisk, len(p.Environments))
+	for name, e := range p.Environments {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if key == "" {
+			return nil, errors.New("invalid risk profile: environment name is empty")
+		}
+		if _, dup := envs[key]; dup {
+			return nil, fmt.Errorf("invalid risk profile: environment %q is listed twice", key)
+		}
+		if e.Multiplier < 0 {
+			return nil, fmt.Errorf("invalid risk profile: environments.%s.multiplier must not be negative", key)
+		}
+		if err := validTypeRisks(e.Types, "environments."+key+"."); err != nil {
+			return nil, err
+		}
+		envs[key] = e
+	}
+	p.Environments = envs
+	if p.Types == nil {
+		p.Types = make(map[string]TypeRisk)
+	}
+	return &p, nil
+}
+
+func validTypeRisks(types map[string]TypeRisk, prefix string) error {
+	for t, r := range types {
+		if t == "" {
+			return fmt.Errorf("invalid risk profile: %stypes has an empty resource type", prefix)
+		}
+		if r.Weight < 0 {
+			return fmt.Errorf("invalid risk profile: %stypes.%s.weight must not be negative", prefix, t)
+		}
+	}
+	return nil
+}
+
+// ReadRiskProfile loads the profile in path. A missing file is the default
+// profile, so the first PUT /risk-profile can create it.
+func ReadRiskProfile(path string) (*RiskProfile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultRiskProfile(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	p, err := ParseRiskProfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Save writes the profile to path, replacing it atomically.
+func (p *RiskProfile) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Environment returns the overrides for env, if the profile has any.
+func (p *RiskProfile) Environment(env string) (EnvironmentRisk, bool) {
+	e, ok := p.Environments[strings.ToLower(env)]
+	return e, ok
+}
+
+// typeRisk resolves the risk of resType in env: the environment's
+// override, then the base entry, then the default weight.
+func (p *RiskProfile) typeRisk(resType, env string) TypeRisk {
+	r := p.Types[resType]
+	if e, ok := p.Environment(env); ok {
+		o := e.Types[resType]
+		if o.Weight > 0 {
+			r.Weight = o.Weight
+		}
+		if o.DataLoss != nil {
+			r.DataLoss = o.DataLoss
+		}
+		if o.Downtime != nil {
+			r.Downtime = o.Downtime
+		}
+	}
+	if r.Weight == 0 {
+		r.Weight = p.DefaultWeight
+	}
+	return r
+}
+
+// Weight returns the blast radius weight of changing a resource of
+// resType in env ("" for the base profile).
+func (p *RiskProfile) Weight(resType, env string) int {
+	w := p.typeRisk(resType, env).Weight
+	if e, ok := p.Environment(env); ok && e.Multiplier > 0 {
+		w = int(math.Round(float64(w) * e.Multiplier))
+	}
+	return w
+}
+
+// ChangeRisk returns what a planned change to a resource of resType risks
+// in env. Creates risk nothing, and in-place updates only the restart of
+// types that restart on change. A destroy loses the data of stateful types
+// and takes the resource away from its dependents. A replace loses the
+// data too, and causes downtime unless the new object is created before
+// the old one is destroyed.
+func (p *RiskProfile) ChangeRisk(resType, env string, c protocol.Change) ChangeRisk {
+	r := p.typeRisk(resType, env)
+	stateful := r.DataLoss != nil && *r.DataLoss
+	switch c.Action {
+	case protocol.ActionUpdate:
+		return ChangeRisk{Downtime: r.Downtime != nil && *r.Downtime}
+	case protocol.ActionDelete:
+		return ChangeRisk{Downtime: true, DataLoss: stateful}
+	case protocol.ActionReplace:
+		return ChangeRisk{Downtime: !c.CreateBeforeDestroy || stateful, DataLoss: stateful}
+	}
+	return ChangeRisk{}
+}
+
+var (
+	riskMu      sync.RWMutex
+	riskProfile *RiskProfile
+	builtinRisk = DefaultRiskProfile()
+)
+
+// InstallRiskProfile makes p the profile impact analysis weighs changes
+// with. A nil profile restores the built-in one.
+func InstallRiskProfile(p *RiskProfile) {
+	riskMu.Lock()
+	riskProfile = p
+	riskMu.Unlock()
+}
+
+// ActiveRiskProfile returns the installed profile. Callers must not modify
+// it.
+func ActiveRiskProfile() *RiskProfile {
+	riskMu.RLock()
+	defer riskMu.RUnlock()
+	if riskProfile == nil {
+		return builtinRisk
+	}
+	return riskProfile
+}
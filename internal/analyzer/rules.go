@@ -4,16 +4,23 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 )
 
 // Rule represents a deterministic analysis rule.
 type Rule struct {
-	ID          string
-	Category    string
-	Severity    string
+	ID       string
+	Category string
+	// Group is the catalog file a data-driven rule comes from, e.g.
+	// "network"; empty for rules written in Go.
+	Group       string
+	Severity    protocol.Severity
 	Title       string
 	Description string
 	Remediation string
+	// Reference is the documentation behind the rule, cited in reports.
+	Reference protocol.Reference
 
 	// ResourceTypes this rule applies to (empty = all)
 	ResourceTypes []string
@@ -22,9 +29,24 @@ type Rule struct {
 	Property string
 	Expected interface{}
 	CheckFn  func(props map[string]interface{}) string
+	// ResourceCheckFn replaces CheckFn for checks that need the whole
+	// resource, such as its type.
+	ResourceCheckFn func(res protocol.Resource) string
+	// Evidence lists the properties (dotted paths for nested blocks) that
+	// prove a CheckFn rule passed, for audit exports.
+	Evidence []string
 
 	// Pattern-based check (for raw block scanning)
 	Patterns []*regexp.Regexp
+	// ScanFn, for raw block scans that rate each issue they find, such as
+	// secret detection, replaces Patterns.
+	ScanFn func(res protocol.Resource) []Match
+}
+
+// Match is one issue a ScanFn found, with how certain it is.
+type Match struct {
+	Message    string
+	Confidence protocol.Confidence
 }
 
 // Applies returns true if this rule applies to the given resource type.
@@ -40,9 +62,18 @@ func (r Rule) Applies(resType string) bool {
 	return false
 }
 
-// IsPatternRule returns true if this is a regex pattern-based rule.
+// IsPatternRule returns true if this is a regex pattern-based rule or a
+// raw block scan.
 func (r Rule) IsPatternRule() bool {
-	return len(r.Patterns) > 0
+	return len(r.Patterns) > 0 || r.ScanFn != nil
+}
+
+// CheckResource evaluates prop-based rules against a resource.
+func (r Rule) CheckResource(res protocol.Resource) string {
+	if r.ResourceCheckFn != nil {
+		return r.ResourceCheckFn(res)
+	}
+	return r.Check(res.Properties)
 }
 
 // Check evaluates prop-based rules against resource properties.
@@ -59,7 +90,7 @@ func (r Rule) Check(props map[string]interface{}) string {
 		return fmt.Sprintf("%s is not set (expected: %v)", r.Property, r.Expected)
 	}
 
-	if fmt.Sprintf("%v", val) != fmt.Sprintf("%v", r.Expected) {
+	if !valuesEqual(val, r.Expected) {
 		return fmt.Sprintf("%s = %v (expected: %v)", r.Property, val, r.Expected)
 	}
 	return ""
@@ -76,11 +107,24 @@ func (r Rule) CheckPatterns(rawBlock string) []string {
 	return violations
 }
 
-// AllRules returns all deterministic analysis rules.
+// AllRules returns all deterministic analysis rules, with the installed rule
+// pack applied.
 func AllRules() []Rule {
+	rules := builtinRules()
+	packMu.RLock()
+	p := activePack
+	packMu.RUnlock()
+	if p != nil {
+		rules = p.apply(rules)
+	}
+	return rules
+}
+
+func builtinRules() []Rule {
 	var rules []Rule
 	rules = append(rules, policyRules()...)
 	rules = append(rules, securityRules()...)
+	rules = append(rules, catalogRules()...)
 	rules = append(rules, complianceRules()...)
 	return rules
 }
@@ -96,6 +140,37 @@ func RulesByCategory(category string) []Rule {
 	return filtered
 }
 
+// Run evaluates rules against resources. Pattern rules scan each resource's
+// raw block; the rest check parsed properties. A severity override in the
+// resource's annotations replaces the rule's severity.
+func Run(rules []Rule, resources []protocol.Resource) []protocol.Finding {
+	return NewRuleIndex(rules).Run(resources)
+}
+
+// findingsOf reports the failed controls as findings.
+func findingsOf(controls []ControlResult) []protocol.Finding {
+	var findings []protocol.Finding
+	for _, c := range controls {
+		for i, msg := range c.Messages {
+			confidence := c.Confidence()
+			if i < len(c.Matches) {
+				confidence = c.Matches[i].Confidence
+			}
+			findings = append(findings, protocol.Finding{
+				RuleID:       c.Rule.ID,
+				Category:     c.Rule.Category,
+				Severity:     c.Resource.Annotations.SeverityFor(c.Rule.ID, c.Rule.Severity),
+				Resource:     c.Resource.Name,
+				ResourceType: c.Resource.Type,
+				Message:      msg,
+				Remediation:  c.Rule.Remediation,
+				Confidence:   confidence,
+			})
+		}
+	}
+	return findings
+}
+
 func policyRules() []Rule {
 	return []Rule{
 		{
@@ -105,6 +180,7 @@ func policyRules() []Rule {
 			Title:         "Storage HTTPS Required",
 			Description:   "Storage account must enforce HTTPS-only traffic (CIS Azure 4.1)",
 			Remediation:   "Set enable_https_traffic_only = true",
+			Reference:     storageSecureTransferDoc,
 			ResourceTypes: []string{"azurerm_storage_account"},
 			Property:      "enable_https_traffic_only",
 			Expected:      true,
@@ -116,6 +192,7 @@ func policyRules() []Rule {
 			Title:         "AKS RBAC Required",
 			Description:   "AKS clusters must enable RBAC",
 			Remediation:   "Set role_based_access_control_enabled = true",
+			Reference:     aksRBACDoc,
 			ResourceTypes: []string{"azurerm_kubernetes_cluster"},
 			Property:      "role_based_access_control_enabled",
 			Expected:      true,
@@ -127,6 +204,7 @@ func policyRules() []Rule {
 			Title:         "Minimum TLS Version",
 			Description:   "Resources must use TLS 1.2 or higher (SOC2 CC6.6)",
 			Remediation:   "Set min_tls_version = \"TLS1_2\"",
+			Reference:     storageTLSDoc,
 			ResourceTypes: []string{"azurerm_storage_account", "azurerm_redis_cache", "azurerm_mssql_server"},
 			Property:      "min_tls_version",
 			Expected:      "TLS1_2",
@@ -138,6 +216,7 @@ func policyRules() []Rule {
 			Title:         "No Public Blob Access",
 			Description:   "Storage accounts must not allow public blob access (SOC2 CC6.1)",
 			Remediation:   "Set allow_blob_public_access = false",
+			Reference:     blobAnonymousAccessDoc,
 			ResourceTypes: []string{"azurerm_storage_account"},
 			Property:      "allow_blob_public_access",
 			Expected:      false,
@@ -149,6 +228,7 @@ func policyRules() []Rule {
 			Title:         "Key Vault Soft Delete",
 			Description:   "Key Vault must have soft delete enabled (CIS Azure 8.1)",
 			Remediation:   "Set soft_delete_enabled = true",
+			Reference:     keyVaultSoftDeleteDoc,
 			ResourceTypes: []string{"azurerm_key_vault"},
 			Property:      "soft_delete_enabled",
 			Expected:      true,
@@ -160,6 +240,7 @@ func policyRules() []Rule {
 			Title:         "Key Vault Purge Protection",
 			Description:   "Key Vault must have purge protection enabled",
 			Remediation:   "Set purge_protection_enabled = true",
+			Reference:     keyVaultSoftDeleteDoc,
 			ResourceTypes: []string{"azurerm_key_vault"},
 			Property:      "purge_protection_enabled",
 			Expected:      true,
@@ -176,12 +257,9 @@ func securityRules() []Rule {
 			Title:         "Hardcoded Secrets",
 			Description:   "Code contains potential hardcoded credentials",
 			Remediation:   "Use Key Vault references or environment variables",
+			Reference:     keyVaultSecretsDoc,
 			ResourceTypes: []string{"*"},
-			Patterns: []*regexp.Regexp{
-				regexp.MustCompile(`(?i)(password|secret|key)\s*=\s*"[^"]{8,}"`),
-				regexp.MustCompile(`(?i)api[_-]?key\s*=\s*"[^"]{8,}"`),
-				regexp.MustCompile(`(?i)connection[_-]?string\s*=\s*"[^"]+"`),
-			},
+			Patterns:      hardcodedSecretRes,
 		},
 		{
 			ID:            "SEC-002",
@@ -190,7 +268,9 @@ func securityRules() []Rule {
 			Title:         "Public Network Access",
 			Description:   "Resource allows public network access",
 			Remediation:   "Set public_network_access_enabled = false or configure network rules",
+			Reference:     privateLinkDoc,
 			ResourceTypes: []string{"azurerm_storage_account", "azurerm_key_vault", "azurerm_mssql_server", "azurerm_cosmosdb_account"},
+			Evidence:      []string{"public_network_access_enabled"},
 			CheckFn: func(props map[string]interface{}) string {
 				if v, ok := props["public_network_access_enabled"]; ok && v == true {
 					return "Public network access is enabled"
@@ -205,7 +285,9 @@ func securityRules() []Rule {
 			Title:         "Encryption at Rest",
 			Description:   "Customer-managed encryption key not configured",
 			Remediation:   "Configure customer_managed_key block",
+			Reference:     storageCMKDoc,
 			ResourceTypes: []string{"azurerm_storage_account", "azurerm_mssql_database"},
+			Evidence:      []string{"customer_managed_key"},
 			CheckFn: func(props map[string]interface{}) string {
 				if _, ok := props["customer_managed_key"]; !ok {
 					return "No customer-managed encryption key configured"
@@ -220,13 +302,191 @@ func securityRules() []Rule {
 			Title:         "Overly Permissive NSG",
 			Description:   "Network Security Group allows unrestricted access",
 			Remediation:   "Restrict source_address_prefix to specific IPs/ranges",
+			Reference:     nsgDoc,
 			ResourceTypes: []string{"azurerm_network_security_group"},
-			Patterns: []*regexp.Regexp{
-				regexp.MustCompile(`source_address_prefix\s*=\s*"\*"`),
-				regexp.MustCompile(`destination_port_range\s*=\s*"\*"`),
+			Patterns:      nsgWildcardRes,
+		},
+		{
+			ID:            "SEC-006",
+			Category:      "Security",
+			Severity:      SeverityHigh,
+			Title:         "Secret in Non-Sensitive Output",
+			Description:   "Output exposes a secret or connection string without sensitive = true",
+			Remediation:   "Set sensitive = true on the output, or stop exporting the secret",
+			Reference:     terraformSensitiveOutputDoc,
+			ResourceTypes: []string{"output"},
+			Evidence:      []string{"sensitive"},
+			CheckFn: func(props map[string]interface{}) string {
+				if props["sensitive"] == true {
+					return ""
+				}
+				if m := secretOutputRe.FindString(fmt.Sprint(props["value"])); m != "" {
+					return fmt.Sprintf("Output exposes %s without sensitive = true", m)
+				}
+				return ""
+			},
+		},
+		{
+			ID:            "SEC-007",
+			Category:      "Security",
+			Severity:      SeverityHigh,
+			Title:         "Broad Key Vault Access Policy",
+			Description:   "Key Vault access policy grants all permissions to a broad principal",
+			Remediation:   "Grant only the permissions the principal needs, to a specific identity, or use Azure RBAC",
+			Reference:     keyVaultRBACDoc,
+			ResourceTypes: []string{"azurerm_key_vault", "azurerm_key_vault_access_policy"},
+			Evidence:      []string{"access_policy", "key_permissions", "secret_permissions", "certificate_permissions"},
+			CheckFn: func(props map[string]interface{}) string {
+				policies := []map[string]interface{}{props}
+				switch ap := props["access_policy"].(type) {
+				case map[string]interface{}:
+					policies = []map[string]interface{}{ap}
+				case []interface{}:
+					policies = policies[:0]
+					for _, p := range ap {
+						if m, ok := p.(map[string]interface{}); ok {
+							policies = append(policies, m)
+						}
+					}
+				}
+				var issues []string
+				for _, p := range policies {
+					if issue := broadAccessPolicy(p); issue != "" {
+						issues = append(issues, issue)
+					}
+				}
+				return strings.Join(issues, "; ")
 			},
 		},
+		{
+			ID:            "SEC-008",
+			Category:      "Security",
+			Severity:      SeverityHigh,
+			Title:         "Storage SAS Token in Locals or Outputs",
+			Description:   "A storage SAS token is built in a local value or output, where it lands in state and logs",
+			Remediation:   "Issue short-lived SAS tokens at runtime, or use managed identities instead of SAS",
+			Reference:     storageSASDoc,
+			ResourceTypes: []string{"output", "local"},
+			Patterns:      sasTokenRes,
+		},
+		{
+			ID:            "SEC-009",
+			Category:      "Security",
+			Severity:      SeverityCritical,
+			Title:         "Provider Credential",
+			Description:   "Code contains a credential in a known provider format: Azure Storage, Service Bus or Cosmos DB connection strings, SAS tokens, Entra client secrets, GitHub tokens, JWTs, AWS access keys or private keys",
+			Remediation:   "Revoke and rotate the credential, then read it from Key Vault or a pipeline secret",
+			Reference:     keyVaultSecretsDoc,
+			ResourceTypes: []string{"*"},
+			ScanFn:        scanSecrets(true),
+		},
+		{
+			ID:            "SEC-010",
+			Category:      "Security",
+			Severity:      SeverityHigh,
+			Title:         "High-Entropy String",
+			Description:   "A string literal is as random as a generated key or token",
+			Remediation:   "If the value is a credential, rotate it and read it from Key Vault or a pipeline secret",
+			Reference:     keyVaultSecretsDoc,
+			ResourceTypes: []string{"*"},
+			ScanFn:        scanSecrets(false),
+		},
+	}
+}
+
+// hardcodedSecretRes match credentials assigned as string literals. The
+// first group of each is the secret value.
+// Patterns of the pattern rules, compiled once rather than each time the
+// rules are listed.
+var (
+	nsgWildcardRes = []*regexp.Regexp{
+		regexp.MustCompile(`source_address_prefix\s*=\s*"\*"`),
+		regexp.MustCompile(`destination_port_range\s*=\s*"\*"`),
+	}
+	sasTokenRes = []*regexp.Regexp{
+		regexp.MustCompile(`data\.azurerm_storage_account(_blob_container)?_sas\.`),
+		regexp.MustCompile(`[?&]sig=`),
+	}
+)
+
+var hardcodedSecretRes = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(?:password|secret|key)\s*=\s*"([^"]{8,})"`),
+	regexp.MustCompile(`(?i)api[_-]?key\s*=\s*"([^"]{8,})"`),
+	regexp.MustCompile(`(?i)connection[_-]?string\s*=\s*"([^"]+)"`),
+}
+
+// SecretValues returns the hardcoded credential values that rules SEC-001,
+// SEC-009 and SEC-010 detect in code, without duplicates. Interpolated references such as
+// "${azurerm_storage_account.sa.primary_connection_string}" are not values
+// and are skipped.
+func SecretValues(code string) []string {
+	var values []string
+	seen := make(map[string]bool)
+	for _, re := range hardcodedSecretRes {
+		for _, m := range re.FindAllStringSubmatch(code, -1) {
+			v := m[1]
+			if seen[v] || strings.HasPrefix(v, "${") {
+				continue
+			}
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	for _, m := range FindSecrets(code) {
+		if !seen[m.Value] {
+			seen[m.Value] = true
+			values = append(values, m.Value)
+		}
+	}
+	return values
+}
+
+// secretOutputRe matches attributes and names that hold secrets in output
+// values.
+var secretOutputRe = regexp.MustCompile(`(?i)\b[\w.-]*(connection_string|access_key|primary_key|secondary_key|instrumentation_key|client_secret|kube_(admin_)?config(_raw)?|private_key\w*|password)\b|\bazurerm_key_vault_secret\.[\w-]+\.value\b`)
+
+// fullKeyVaultPermissions are the permissions of each kind that together
+// amount to full control; "all" grants them as well.
+var fullKeyVaultPermissions = map[string][]string{
+	"key_permissions": {"backup", "create", "decrypt", "delete", "encrypt", "get", "import", "list",
+		"purge", "recover", "restore", "sign", "unwrapkey", "update", "verify", "wrapkey"},
+	"secret_permissions": {"backup", "delete", "get", "list", "purge", "recover", "restore", "set"},
+	"certificate_permissions": {"backup", "create", "delete", "deleteissuers", "get", "getissuers", "import",
+		"list", "listissuers", "managecontacts", "manageissuers", "purge", "recover", "restore", "setissuers", "update"},
+}
+
+// broadAccessPolicy describes an access policy that grants full control of
+// keys, secrets or certificates to a group, or of all three to anyone.
+func broadAccessPolicy(policy map[string]interface{}) string {
+	var full []string
+	for _, kind := range []string{"key_permissions", "secret_permissions", "certificate_permissions"} {
+		perms, _ := policy[kind].([]interface{})
+		granted := make(map[string]bool, len(perms))
+		for _, p := range perms {
+			granted[strings.ToLower(fmt.Sprint(p))] = true
+		}
+		all := granted["all"] || granted["*"]
+		if !all && len(perms) > 0 {
+			all = true
+			for _, p := range fullKeyVaultPermissions[kind] {
+				all = all && granted[p]
+			}
+		}
+		if all {
+			full = append(full, strings.TrimSuffix(kind, "_permissions"))
+		}
+	}
+	principal := fmt.Sprint(policy["object_id"])
+	group := strings.Contains(strings.ToLower(principal), "group")
+	switch {
+	case len(full) == 0:
+		return ""
+	case group:
+		return fmt.Sprintf("Access policy grants all %s permissions to group %s", strings.Join(full, "/"), principal)
+	case len(full) == 3:
+		return fmt.Sprintf("Access policy grants all key, secret and certificate permissions to %s", principal)
 	}
+	return ""
 }
 
 func complianceRules() []Rule {
@@ -238,7 +498,9 @@ func complianceRules() []Rule {
 			Title:         "NIST SC-7: Boundary Protection",
 			Description:   "Network boundaries must have proper controls",
 			Remediation:   "Configure network_rules with default_action = \"Deny\"",
+			Reference:     nist80053Doc,
 			ResourceTypes: []string{"azurerm_storage_account"},
+			Evidence:      []string{"network_rules.default_action"},
 			CheckFn: func(props map[string]interface{}) string {
 				rules, ok := props["network_rules"].(map[string]interface{})
 				if !ok {
@@ -259,7 +521,9 @@ func complianceRules() []Rule {
 			Title:         "NIST SC-28: Protection at Rest",
 			Description:   "Data at rest must be encrypted",
 			Remediation:   "Enable infrastructure encryption",
+			Reference:     nist80053Doc,
 			ResourceTypes: []string{"azurerm_storage_account"},
+			Evidence:      []string{"infrastructure_encryption_enabled"},
 			CheckFn: func(props map[string]interface{}) string {
 				if v, ok := props["infrastructure_encryption_enabled"]; !ok || v != true {
 					return "Infrastructure encryption not enabled"
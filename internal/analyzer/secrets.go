@@ -0,0 +1,185 @@
+package analyzer
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// SecretMatch is a credential found in code. Value is the secret itself and
+// must never be written to output; use Preview instead.
+type SecretMatch struct {
+	// Kind names the credential, e.g. "GitHub personal access token".
+	Kind  string
+	Value string
+	// Line is the 1-based line of the match within the scanned text.
+	Line int
+	// Entropy is the Shannon entropy of the value in bits per character,
+	// set for high-entropy string matches.
+	Entropy    float64
+	Confidence protocol.Confidence
+}
+
+// Preview identifies the secret without revealing it: its first four
+// characters, which for most provider tokens are the format prefix, and
+// its length.
+func (m SecretMatch) Preview() string {
+	if len(m.Value) < 16 {
+		return fmt.Sprintf("[REDACTED], %d chars", len(m.Value))
+	}
+	return fmt.Sprintf("%s…[REDACTED], %d chars", m.Value[:4], len(m.Value))
+}
+
+// secretPattern is a credential format with a recognizable shape. When the
+// expression has a group, the first group is the secret part of the match,
+// e.g. the key of a connection string.
+type secretPattern struct {
+	kind string
+	re   *regexp.Regexp
+}
+
+// providerSecretPatterns are credential formats specific enough that a
+// match is almost certainly a live credential.
+var providerSecretPatterns = []secretPattern{
+	{"Azure Storage connection string", regexp.MustCompile(`DefaultEndpointsProtocol=https?;AccountName=[^;"'\s]+;AccountKey=([A-Za-z0-9+/]{40,}={0,2})`)},
+	{"Azure Service Bus / Event Hubs connection string", regexp.MustCompile(`Endpoint=sb://[^;"'\s]+;SharedAccessKeyName=[^;"'\s]+;SharedAccessKey=([A-Za-z0-9+/]{20,}={0,2})`)},
+	{"Azure Cosmos DB connection string", regexp.MustCompile(`AccountEndpoint=https://[^;"'\s]+;AccountKey=([A-Za-z0-9+/]{40,}={0,2})`)},
+	{"Azure SAS token", regexp.MustCompile(`\bsv=\d{4}-\d{2}-\d{2}&[^"'\s]*?\bsig=([A-Za-z0-9%+/=]{20,})`)},
+	{"Microsoft Entra client secret", regexp.MustCompile(`\b([A-Za-z0-9_~.-]{3}\dQ~[A-Za-z0-9_~.-]{31,34})\b`)},
+	{"GitHub personal access token", regexp.MustCompile(`\b(github_pat_[A-Za-z0-9_]{82}|ghp_[A-Za-z0-9]{36})\b`)},
+	{"GitHub OAuth or app token", regexp.MustCompile(`\b(gh[ousr]_[A-Za-z0-9]{36})\b`)},
+	{"JSON Web Token", regexp.MustCompile(`\b(eyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,})`)},
+	{"AWS access key ID", regexp.MustCompile(`\b((?:AKIA|ASIA)[0-9A-Z]{16})\b`)},
+	{"Private key", regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED )?PRIVATE KEY-----(?:\\n|\s)*([A-Za-z0-9+/=]{40,})`)},
+}
+
+// entropyKind is the Kind of high-entropy string matches.
+const entropyKind = "High-entropy string"
+
+// EntropyThreshold is the Shannon entropy, in bits per character, above
+// which a base64-like string literal is reported as a likely secret.
+// Random base64 of 24 characters or more clears it; words, resource IDs and
+// hex digests do not.
+const EntropyThreshold = 4.5
+
+var (
+	// stringLiteralRe captures quoted literals of secret-like characters
+	// with the text before them on the line, so the key they are assigned
+	// to can be read.
+	stringLiteralRe = regexp.MustCompile(`(?m)^([^\n]*?)["']([A-Za-z0-9+/=_.~-]{20,})["']`)
+	secretNameRe    = regexp.MustCompile(`(?i)(password|passwd|pwd|secret|token|credential|api[_-]?key|access[_-]?key|account[_-]?key|private[_-]?key|auth|signature|\bsas\b|\bkey\s*[=:])`)
+	// publicNameRe marks keys whose values are checksums or identifiers,
+	// not secrets.
+	publicNameRe = regexp.MustCompile(`(?i)(thumbprint|hash|digest|checksum|sha\d*|fingerprint|etag|version|source|image|_id\b|\bid\b)`)
+	hasLetterRe  = regexp.MustCompile(`[A-Za-z]`)
+	hasDigitRe   = regexp.MustCompile(`[0-9]`)
+)
+
+// FindSecrets returns the provider credentials and high-entropy string
+// literals in text, in order of appearance. Provider formats are high
+// confidence. A high-entropy literal is high confidence when assigned to a
+// secret-like key such as "token", medium when its entropy is very high,
+// and low otherwise. Values the generic hardcoded-secret check (SEC-001)
+// already catches are not reported as high-entropy strings.
+func FindSecrets(text string) []SecretMatch {
+	var matches []SecretMatch
+	seen := make(map[string]bool)
+	for _, p := range providerSecretPatterns {
+		for _, loc := range p.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) >= 4 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			v := text[start:end]
+			if seen[v] {
+				continue
+			}
+			seen[v] = true
+			matches = append(matches, SecretMatch{Kind: p.kind, Value: v, Line: lineAt(text, start), Confidence: protocol.ConfidenceHigh})
+		}
+	}
+	for _, re := range hardcodedSecretRes {
+		for _, m := range re.FindAllStringSubmatch(text, -1) {
+			seen[m[1]] = true
+		}
+	}
+	for _, loc := range stringLiteralRe.FindAllStringSubmatchIndex(text, -1) {
+		prefix, v := text[loc[2]:loc[3]], text[loc[4]:loc[5]]
+		if seen[v] || containsSeen(v, seen) || publicNameRe.MatchString(prefix) || !hasLetterRe.MatchString(v) || !hasDigitRe.MatchString(v) {
+			continue
+		}
+		e := ShannonEntropy(v)
+		if e < EntropyThreshold {
+			continue
+		}
+		seen[v] = true
+		conf := protocol.ConfidenceLow
+		switch {
+		case secretNameRe.MatchString(prefix):
+			conf = protocol.ConfidenceHigh
+		case e >= 5:
+			conf = protocol.ConfidenceMedium
+		}
+		matches = append(matches, SecretMatch{Kind: entropyKind, Value: v, Line: lineAt(text, loc[4]), Entropy: e, Confidence: conf})
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Line < matches[j].Line })
+	return matches
+}
+
+// containsSeen reports whether v contains a value already reported, such
+// as the key inside a connection string literal.
+func containsSeen(v string, seen map[string]bool) bool {
+	for s := range seen {
+		if len(s) >= 16 && strings.Contains(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func lineAt(text string, offset int) int {
+	return strings.Count(text[:offset], "\n") + 1
+}
+
+// ShannonEntropy returns the entropy of s in bits per character.
+func ShannonEntropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	var e float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+// scanSecrets reports the secrets in a resource's raw block, of provider
+// formats when provider is set and high-entropy strings otherwise.
+func scanSecrets(provider bool) func(res protocol.Resource) []Match {
+	return func(res protocol.Resource) []Match {
+		var out []Match
+		for _, m := range FindSecrets(res.RawBlock) {
+			if (m.Kind == entropyKind) == provider {
+				continue
+			}
+			line := res.Line + m.Line - 1
+			msg := fmt.Sprintf("%s (%s) on line %d", m.Kind, m.Preview(), line)
+			if !provider {
+				msg = fmt.Sprintf("%s (%s, %.1f bits/char) on line %d", m.Kind, m.Preview(), m.Entropy, line)
+			}
+			out = append(out, Match{Message: msg, Confidence: m.Confidence})
+		}
+		return out
+	}
+}
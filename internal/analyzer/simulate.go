@@ -0,0 +1,169 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// MassFailureRate is the failure rate above which a rule is better rolled
+// out as a warning than as a gate: most resources would fail it on day one.
+const MassFailureRate = 0.8
+
+// Scan is a stored analysis a proposed rule can be replayed against.
+type Scan struct {
+	ID string
+	// Source names what was scanned, such as a repository; scans without
+	// one each count as their own.
+	Source    string
+	Created   time.Time
+	Resources []protocol.Resource
+	// Findings are what the scan reported, so failures it already had are
+	// not counted as new.
+	Findings []protocol.Finding
+}
+
+// Simulation is the result of replaying a proposed rule against stored
+// scans.
+type Simulation struct {
+	RuleID   string            `json:"rule_id"`
+	Severity protocol.Severity `json:"severity"`
+	// Scans is the number of stored scans considered. Only the latest scan
+	// of each source is replayed; Skipped counts scans stored without the
+	// resources to replay.
+	Scans   int `json:"scans"`
+	Skipped int `json:"skipped,omitempty"`
+	// Repos is the number of sources replayed, FailingRepos those with a
+	// new failure.
+	Repos        int `json:"repos"`
+	FailingRepos int `json:"failing_repos"`
+	// Resources counts the resources the rule applies to, Failing those
+	// that fail it and NewFailures those whose scan did not already report
+	// the rule.
+	Resources   int     `json:"resources"`
+	Failing     int     `json:"failing"`
+	NewFailures int     `json:"new_failures"`
+	FailureRate float64 `json:"failure_rate"`
+	// SuggestedSeverity is the severity to roll the rule out at, and
+	// Recommendation says why.
+	SuggestedSeverity protocol.Severity `json:"suggested_severity"`
+	Recommendation    string            `json:"recommendation"`
+	Results           []ScanResult      `json:"results"`
+}
+
+// ScanResult is the replay of one source's latest scan.
+type ScanResult struct {
+	ScanID    string    `json:"scan_id"`
+	Source    string    `json:"source,omitempty"`
+	Created   time.Time `json:"created"`
+	Resources int       `json:"resources"`
+	// NewFailures are the "type.name" addresses of resources that would
+	// newly fail.
+	NewFailures []string `json:"new_failures,omitempty"`
+}
+
+// Simulate replays rule against the latest scan of each source in scans,
+// reporting progress after each one. It stops early when ctx is done.
+func Simulate(ctx context.Context, rule Rule, scans []Scan, progress func(protocol.Progress)) (Simulation, error) {
+	sim := Simulation{RuleID: rule.ID, Severity: rule.Severity, Scans: len(scans), Results: []ScanResult{}}
+	latest := make(map[string]Scan)
+	var order []string
+	for _, sc := range scans {
+		if len(sc.Resources) == 0 {
+			sim.Skipped++
+			continue
+		}
+		key := sc.Source
+		if key == "" {
+			key = "scan:" + sc.ID
+		}
+		prev, seen := latest[key]
+		if !seen {
+			order = append(order, key)
+		}
+		if !seen || sc.Created.After(prev.Created) {
+			latest[key] = sc
+		}
+	}
+
+	for i, key := range order {
+		if err := ctx.Err(); err != nil {
+			return sim, err
+		}
+		sc := latest[key]
+		res := replay(rule, sc)
+		sim.Repos++
+		sim.Resources += res.Resources
+		sim.Failing += res.failing
+		sim.NewFailures += len(res.NewFailures)
+		if len(res.NewFailures) > 0 {
+			sim.FailingRepos++
+		}
+		sim.Results = append(sim.Results, res.ScanResult)
+		if progress != nil {
+			progress(protocol.Progress{Stage: "simulate", Current: i + 1, Total: len(order), Percent: float64(i+1) * 100 / float64(len(order))})
+		}
+	}
+	sort.SliceStable(sim.Results, func(i, j int) bool {
+		return len(sim.Results[i].NewFailures) > len(sim.Results[j].NewFailures)
+	})
+	if sim.Resources > 0 {
+		sim.FailureRate = float64(sim.Failing) / float64(sim.Resources)
+	}
+	sim.SuggestedSeverity, sim.Recommendation = suggestSeverity(sim)
+	return sim, nil
+}
+
+type replayResult struct {
+	ScanResult
+	failing int
+}
+
+func replay(rule Rule, sc Scan) replayResult {
+	res := replayResult{ScanResult: ScanResult{ScanID: sc.ID, Source: sc.Source, Created: sc.Created}}
+	for _, r := range sc.Resources {
+		if rule.Applies(r.Type) {
+			res.Resources++
+		}
+	}
+	reported := make(map[string]bool)
+	for _, f := range sc.Findings {
+		if skipKey(f.RuleID) == rule.ID {
+			reported[f.ResourceType+"."+f.Resource] = true
+		}
+	}
+	failing := make(map[string]bool)
+	for _, f := range Run([]Rule{rule}, sc.Resources) {
+		addr := f.ResourceType + "." + f.Resource
+		if failing[addr] {
+			continue
+		}
+		failing[addr] = true
+		res.failing++
+		if !reported[addr] {
+			res.NewFailures = append(res.NewFailures, addr)
+		}
+	}
+	return res
+}
+
+// suggestSeverity proposes a rollout severity from how widely the rule
+// fails: a rule most resources fail starts as a low warning, and one that
+// would block a fifth of them or more starts at medium.
+func suggestSeverity(sim Simulation) (protocol.Severity, string) {
+	pct := sim.FailureRate * 100
+	switch {
+	case sim.Resources == 0:
+		return sim.Severity, "No stored scan has resources the rule applies to; there is no data to tune its severity."
+	case sim.NewFailures == 0:
+		return sim.Severity, fmt.Sprintf("No resource would newly fail across %d repo(s); roll out at %s.", sim.Repos, sim.Severity)
+	case sim.FailureRate >= MassFailureRate && sim.Severity.Rank() > SeverityLow.Rank():
+		return SeverityLow, fmt.Sprintf("%.0f%% of applicable resources fail; start at low and raise the severity as teams remediate.", pct)
+	case sim.FailureRate >= 0.2 && sim.Severity.Rank() > SeverityMedium.Rank():
+		return SeverityMedium, fmt.Sprintf("%.0f%% of applicable resources fail in %d of %d repo(s); start at medium so they need approval rather than being blocked.", pct, sim.FailingRepos, sim.Repos)
+	}
+	return sim.Severity, fmt.Sprintf("%.0f%% of applicable resources fail in %d of %d repo(s); roll out at %s.", pct, sim.FailingRepos, sim.Repos, sim.Severity)
+}
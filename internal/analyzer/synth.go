@@ -0,0 +1,329 @@
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Operators a synthesized or declared rule can apply to its property.
+// Synthesis produces the first four; rule packs may use any.
+const (
+	OpEquals      = "equals"
+	OpAtLeast     = "at_least"
+	OpAtMost      = "at_most"
+	OpAbsent      = "absent"
+	OpNotEquals   = "not_equals"
+	OpIn          = "in"
+	OpNotIn       = "not_in"
+	OpMatches     = "matches"
+	OpGreaterThan = "greater_than"
+	OpLessThan    = "less_than"
+	OpStartsWith  = "starts_with"
+	OpEndsWith    = "ends_with"
+	OpWithinCIDR  = "within_cidr"
+	OpPresent     = "present"
+	OpCoversPort  = "covers_port"
+)
+
+// incidentalProperties differ between any two examples and never make a
+// useful rule.
+var incidentalProperties = map[string]bool{
+	"name":                true,
+	"resource_group_name": true,
+	"location":            true,
+}
+
+// Difference is one property that differs between a compliant and a
+// non-compliant example.
+type Difference struct {
+	Property     string      `json:"property"`
+	Compliant    interface{} `json:"compliant,omitempty"`
+	NonCompliant interface{} `json:"non_compliant,omitempty"`
+}
+
+// RuleCandidate is a rule synthesized from a compliant and a non-compliant
+// example: resources of ResourceType must satisfy Operator on Property.
+type RuleCandidate struct {
+	ResourceType string      `json:"resource_type"`
+	Property     string      `json:"property"`
+	Operator     string      `json:"operator"`
+	Value        interface{} `json:"value,omitempty"`
+	// Differences lists every differing property; the candidate is built
+	// from the first.
+	Differences []Difference `json:"differences"`
+}
+
+// ErrNoDifference is returned when the examples differ only in incidental
+// properties such as name or location.
+var ErrNoDifference = errors.New("the examples do not differ in any checkable property")
+
+// SynthesizeRule derives a candidate rule from two examples of the same
+// resource type. A property set on both sides with different values becomes
+// an equality (or, for numbers, a lower/upper bound); one set only on the
+// compliant side must equal its value; one set only on the non-compliant
+// side must be absent.
+func SynthesizeRule(compliant, nonCompliant protocol.Resource) (RuleCandidate, error) {
+	if compliant.Type != nonCompliant.Type {
+		return RuleCandidate{}, fmt.Errorf("examples have different resource types (%s vs %s)", compliant.Type, nonCompliant.Type)
+	}
+	good := flattenProperties(compliant.Properties, "")
+	bad := flattenProperties(nonCompliant.Properties, "")
+
+	var diffs []Difference
+	for path, g := range good {
+		if b, ok := bad[path]; !ok || fmt.Sprint(b) != fmt.Sprint(g) {
+			diffs = append(diffs, Difference{Property: path, Compliant: g, NonCompliant: b})
+		}
+	}
+	for path, b := range bad {
+		if _, ok := good[path]; !ok {
+			diffs = append(diffs, Difference{Property: path, NonCompliant: b})
+		}
+	}
+	if len(diffs) == 0 {
+		return RuleCandidate{}, ErrNoDifference
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		if ri, rj := differenceRank(diffs[i]), differenceRank(diffs[j]); ri != rj {
+			return ri < rj
+		}
+		return diffs[i].Property < diffs[j].Property
+	})
+
+	c := RuleCandidate{ResourceType: compliant.Type, Property: diffs[0].Property, Differences: diffs}
+	d := diffs[0]
+	switch {
+	case d.Compliant == nil:
+		c.Operator = OpAbsent
+	case d.NonCompliant != nil && isNumber(d.Compliant) && isNumber(d.NonCompliant):
+		c.Value = d.Compliant
+		c.Operator = OpAtLeast
+		if toFloat(d.Compliant) < toFloat(d.NonCompliant) {
+			c.Operator = OpAtMost
+		}
+	default:
+		c.Operator, c.Value = OpEquals, d.Compliant
+	}
+	return c, nil
+}
+
+// differenceRank prefers properties set on both sides (the clearest
+// signal), then booleans, then properties only the compliant example sets.
+func differenceRank(d Difference) int {
+	rank := 0
+	if d.Compliant == nil || d.NonCompliant == nil {
+		rank += 2
+	}
+	if _, ok := d.Compliant.(bool); !ok {
+		rank++
+	}
+	if d.Compliant == nil {
+		rank += 2
+	}
+	return rank
+}
+
+// Rule builds the candidate as a runnable Rule.
+func (c RuleCandidate) Rule(id string, severity protocol.Severity) Rule {
+	r := Rule{
+		ID:            id,
+		Category:      "Policy",
+		Severity:      severity,
+		Title:         c.Title(),
+		Description:   c.Title(),
+		Remediation:   c.Remediation(),
+		ResourceTypes: []string{c.ResourceType},
+	}
+	if c.Operator == OpEquals && !strings.Contains(c.Property, ".") {
+		r.Property, r.Expected = c.Property, c.Value
+		return r
+	}
+	r.Evidence = []string{c.Property}
+	r.CheckFn = c.Check
+	return r
+}
+
+// Title is a short description, e.g. "storage_account: min_tls_version = TLS1_2".
+func (c RuleCandidate) Title() string {
+	short := strings.TrimPrefix(c.ResourceType, "azurerm_")
+	switch c.Operator {
+	case OpAbsent:
+		return fmt.Sprintf("%s: %s must not be set", short, c.Property)
+	case OpPresent:
+		return fmt.Sprintf("%s: %s must be set", short, c.Property)
+	}
+	return fmt.Sprintf("%s: %s %s %v", short, c.Property, c.operatorSymbol(), c.Value)
+}
+
+// Remediation tells the author how to satisfy the rule.
+func (c RuleCandidate) Remediation() string {
+	switch c.Operator {
+	case OpAbsent:
+		return fmt.Sprintf("Remove %s", c.Property)
+	case OpPresent:
+		return fmt.Sprintf("Set %s", c.Property)
+	case OpEquals:
+		return fmt.Sprintf("Set %s = %s", c.Property, goLiteral(c.Value))
+	default:
+		return fmt.Sprintf("Set %s %s %v", c.Property, c.operatorSymbol(), c.Value)
+	}
+}
+
+func (c RuleCandidate) operatorSymbol() string {
+	switch c.Operator {
+	case OpAtLeast:
+		return ">="
+	case OpAtMost:
+		return "<="
+	case OpGreaterThan:
+		return ">"
+	case OpLessThan:
+		return "<"
+	case OpNotEquals:
+		return "!="
+	case OpNotIn:
+		return "not in"
+	case OpIn, OpMatches:
+		return c.Operator
+	case OpStartsWith, OpEndsWith:
+		return strings.ReplaceAll(c.Operator, "_", " ")
+	case OpWithinCIDR:
+		return "within"
+	case OpCoversPort:
+		return "covers port"
+	default:
+		return "="
+	}
+}
+
+// GoSource renders the candidate as a Rule literal for rules.go.
+func (c RuleCandidate) GoSource(id string, severity protocol.Severity) string {
+	var sb strings.Builder
+	sb.WriteString("{\n")
+	fmt.Fprintf(&sb, "\tID:            %q,\n", id)
+	sb.WriteString("\tCategory:      \"Policy\",\n")
+	fmt.Fprintf(&sb, "\tSeverity:      Severity%s,\n", severity.Label())
+	fmt.Fprintf(&sb, "\tTitle:         %q,\n", c.Title())
+	fmt.Fprintf(&sb, "\tDescription:   %q,\n", c.Title())
+	fmt.Fprintf(&sb, "\tRemediation:   %q,\n", c.Remediation())
+	fmt.Fprintf(&sb, "\tResourceTypes: []string{%q},\n", c.ResourceType)
+	if c.Operator == OpEquals && !strings.Contains(c.Property, ".") {
+		fmt.Fprintf(&sb, "\tProperty:      %q,\n", c.Property)
+		fmt.Fprintf(&sb, "\tExpected:      %s,\n", goLiteral(c.Value))
+		sb.WriteString("},")
+		return sb.String()
+	}
+	fmt.Fprintf(&sb, "\tEvidence:      []string{%q},\n", c.Property)
+	switch c.Operator {
+	case OpEquals, OpAtLeast, OpAtMost, OpAbsent:
+	case OpPresent:
+		fmt.Fprintf(&sb, "\tCheckFn:       RuleCandidate{Property: %q, Operator: %q}.Check,\n", c.Property, c.Operator)
+		sb.WriteString("},")
+		return sb.String()
+	default:
+		fmt.Fprintf(&sb, "\tCheckFn:       RuleCandidate{Property: %q, Operator: %q, Value: %s}.Check,\n", c.Property, c.Operator, goLiteral(c.Value))
+		sb.WriteString("},")
+		return sb.String()
+	}
+	sb.WriteString("\tCheckFn: func(props map[string]interface{}) string {\n")
+	if c.Operator == OpAbsent {
+		fmt.Fprintf(&sb, "\t\tif _, ok := lookupPath(props, %q); ok {\n", c.Property)
+		fmt.Fprintf(&sb, "\t\t\treturn %q\n", c.Property+" must not be set")
+	} else {
+		fmt.Fprintf(&sb, "\t\tval, ok := lookupPath(props, %q)\n", c.Property)
+	}
+	switch c.Operator {
+	case OpAbsent:
+	case OpAtLeast, OpAtMost:
+		cmp := "<"
+		if c.Operator == OpAtMost {
+			cmp = ">"
+		}
+		fmt.Fprintf(&sb, "\t\tif !ok || !isNumber(val) || toFloat(val) %s %s {\n", cmp, goLiteral(c.Value))
+		fmt.Fprintf(&sb, "\t\t\treturn fmt.Sprintf(\"%s = %%v (expected: %s %v)\", val)\n", c.Property, c.operatorSymbol(), c.Value)
+	default:
+		fmt.Fprintf(&sb, "\t\tif !ok || fmt.Sprint(val) != fmt.Sprint(%s) {\n", goLiteral(c.Value))
+		fmt.Fprintf(&sb, "\t\t\treturn fmt.Sprintf(\"%s = %%v (expected: %v)\", val)\n", c.Property, c.Value)
+	}
+	sb.WriteString("\t\t}\n\t\treturn \"\"\n\t},\n},")
+	return sb.String()
+}
+
+// GoTest renders a test for the candidate in the style of analyzer_test.go,
+// using the differing property of each example as fixtures.
+func (c RuleCandidate) GoTest(id string) string {
+	d := c.Differences[0]
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "func TestPolicyRules_%s(t *testing.T) {\n", strings.NewReplacer("-", "", ".", "").Replace(id))
+	sb.WriteString("\tvar rule Rule\n\tfor _, r := range policyRules() {\n")
+	fmt.Fprintf(&sb, "\t\tif r.ID == %q {\n\t\t\trule = r\n\t\t\tbreak\n\t\t}\n\t}\n", id)
+	fmt.Fprintf(&sb, "\tif msg := rule.Check(%s); msg != \"\" {\n", propsLiteral(c.Property, d.Compliant))
+	sb.WriteString("\t\tt.Errorf(\"compliant example should pass, got: %q\", msg)\n\t}\n")
+	fmt.Fprintf(&sb, "\tif msg := rule.Check(%s); msg == \"\" {\n", propsLiteral(c.Property, d.NonCompliant))
+	sb.WriteString("\t\tt.Error(\"non-compliant example should fail\")\n\t}\n}")
+	return sb.String()
+}
+
+// propsLiteral renders a property map holding val at a dotted path, or an
+// empty map when val is nil.
+func propsLiteral(path string, val interface{}) string {
+	if val == nil {
+		return "map[string]interface{}{}"
+	}
+	keys := strings.Split(path, ".")
+	lit := goLiteral(val)
+	for i := len(keys) - 1; i >= 0; i-- {
+		lit = fmt.Sprintf("map[string]interface{}{%q: %s}", keys[i], lit)
+	}
+	return lit
+}
+
+func goLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = goLiteral(item)
+		}
+		return "[]interface{}{" + strings.Join(items, ", ") + "}"
+	}
+	return fmt.Sprint(v)
+}
+
+// flattenProperties maps dotted paths to leaf values, skipping incidental
+// top-level properties.
+func flattenProperties(props map[string]interface{}, prefix string) map[string]interface{} {
+	out := make(map[string]interface{})
+	for k, v := range props {
+		if prefix == "" && incidentalProperties[k] {
+			continue
+		}
+		if m, ok := v.(map[string]interface{}); ok && len(m) > 0 {
+			for p, leaf := range flattenProperties(m, prefix+k+".") {
+				out[p] = leaf
+			}
+			continue
+		}
+		out[prefix+k] = v
+	}
+	return out
+}
+
+func isNumber(v interface{}) bool {
+	switch v.(type) {
+	case int, int64, float64:
+		return true
+	}
+	return false
+}
+
+func toFloat(v interface{}) float64 {
+	n, _ := toNumber(v)
+	return n
+}
@@ -0,0 +1,118 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Waiver is an accepted risk recorded in a waivers file: Rule is waived for
+// the resources Resource matches until the end of Expires.
+type Waiver struct {
+	Rule string `json:"rule"`
+	// Resource is "type.name", a name, or a path.Match pattern of either,
+	// e.g. "azurerm_storage_account.legacy*".
+	Resource   string `json:"resource"`
+	Reason     string `json:"reason"`
+	Expires    string `json:"expires,omitempty"`
+	ApprovedBy string `json:"approved_by,omitempty"`
+
+	until time.Time
+}
+
+// Waivers is a loaded waivers file.
+type Waivers struct {
+	name    string
+	waivers []Waiver
+}
+
+// LoadWaivers reads a waivers file: a JSON array of waivers or an object
+// with a "waivers" array. Every waiver needs a rule, a resource and a
+// reason; expires is a YYYY-MM-DD date.
+func LoadWaivers(file string) (*Waivers, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	var list []Waiver
+	if bytes.HasPrefix(data, []byte("[")) {
+		err = json.Unmarshal(data, &list)
+	} else {
+		var doc struct {
+			Waivers []Waiver `json:"waivers"`
+		}
+		err = json.Unmarshal(data, &doc)
+		list = doc.Waivers
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	for i, w := range list {
+		if strings.TrimSpace(w.Rule) == "" || strings.TrimSpace(w.Resource) == "" || strings.TrimSpace(w.Reason) == "" {
+			return nil, fmt.Errorf("%s: waiver %d: rule, resource and reason are required", file, i+1)
+		}
+		if _, err := path.Match(w.Resource, ""); err != nil {
+			return nil, fmt.Errorf("%s: waiver %d: invalid resource pattern %q", file, i+1, w.Resource)
+		}
+		if w.Expires != "" {
+			t, err := time.Parse("2006-01-02", w.Expires)
+			if err != nil {
+				return nil, fmt.Errorf("%s: waiver %d: expires must be a date like 2025-06-01, got %q", file, i+1, w.Expires)
+			}
+			list[i].until = t
+		}
+	}
+	return &Waivers{name: filepath.Base(file), waivers: list}, nil
+}
+
+// Len returns the number of waivers.
+func (w *Waivers) Len() int { return len(w.waivers) }
+
+// Apply returns resources with the waivers that match each one added to its
+// exemptions, so they suppress findings and are flagged once expired like
+// inline ones. The input is not modified.
+func (w *Waivers) Apply(resources []protocol.Resource) []protocol.Resource {
+	out := make([]protocol.Resource, len(resources))
+	copy(out, resources)
+	for i, res := range out {
+		var exemptions []protocol.Exemption
+		for _, wv := range w.waivers {
+			if !wv.matches(res) {
+				continue
+			}
+			reason := wv.Reason
+			if wv.ApprovedBy != "" {
+				reason += ", approved by " + wv.ApprovedBy
+			}
+			exemptions = append(exemptions, protocol.Exemption{RuleID: skipKey(wv.Rule), Until: wv.until, Reason: reason, Source: w.name})
+		}
+		if len(exemptions) == 0 {
+			continue
+		}
+		a := protocol.Annotations{}
+		if res.Annotations != nil {
+			a = *res.Annotations
+		}
+		a.Exemptions = append(a.Exemptions[:len(a.Exemptions):len(a.Exemptions)], exemptions...)
+		out[i].Annotations = &a
+	}
+	return out
+}
+
+func (wv Waiver) matches(res protocol.Resource) bool {
+	pattern := wv.Resource
+	name := res.Name
+	if strings.Contains(pattern, ".") {
+		name = res.Type + "." + res.Name
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
@@ -1,26 +1,69 @@
 package analyzer
 
-// ResourceRiskWeight returns the risk score for a resource type.
-// Higher scores indicate resources with greater blast radius when modified.
+import (
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// ResourceRiskWeight returns the risk score for a resource type in the
+// installed risk profile. Higher scores indicate resources with greater
+// blast radius when modified.
 func ResourceRiskWeight(resType string) int {
-	weights := map[string]int{
-		"azurerm_kubernetes_cluster":     8,
-		"azurerm_virtual_machine":        5,
-		"azurerm_linux_virtual_machine":  5,
-		"azurerm_mssql_server":           7,
-		"azurerm_mssql_database":         6,
-		"azurerm_cosmosdb_account":       7,
-		"azurerm_key_vault":              6,
-		"azurerm_storage_account":        4,
-		"azurerm_container_registry":     4,
-		"azurerm_service_plan":           3,
-		"azurerm_redis_cache":            5,
-		"azurerm_virtual_network":        3,
-		"azurerm_subnet":                 2,
-		"azurerm_network_security_group": 4,
+	return ActiveRiskProfile().Weight(resType, "")
+}
+
+// ApplyDuration returns a typical time for Azure to carry out a planned
+// action on a resource type. Creates take the longest; updates and deletes
+// about half as long, and a replacement is a delete plus a create.
+func ApplyDuration(resType, action string) time.Duration {
+	creates := map[string]time.Duration{
+		"azurerm_api_management":               45 * time.Minute,
+		"azurerm_virtual_network_gateway":      35 * time.Minute,
+		"azurerm_application_gateway":          15 * time.Minute,
+		"azurerm_redis_cache":                  20 * time.Minute,
+		"azurerm_kubernetes_cluster":           10 * time.Minute,
+		"azurerm_firewall":                     10 * time.Minute,
+		"azurerm_cosmosdb_account":             8 * time.Minute,
+		"azurerm_mssql_database":               5 * time.Minute,
+		"azurerm_mssql_server":                 3 * time.Minute,
+		"azurerm_linux_virtual_machine":        3 * time.Minute,
+		"azurerm_windows_virtual_machine":      4 * time.Minute,
+		"azurerm_virtual_machine":              4 * time.Minute,
+		"azurerm_kubernetes_cluster_node_pool": 6 * time.Minute,
+		"azurerm_linux_web_app":                2 * time.Minute,
+		"azurerm_service_plan":                 time.Minute,
+		"azurerm_key_vault":                    time.Minute,
+		"azurerm_storage_account":              time.Minute,
+		"azurerm_container_registry":           time.Minute,
+	}
+	d, ok := creates[resType]
+	if !ok {
+		d = 30 * time.Second
 	}
-	if w, ok := weights[resType]; ok {
-		return w
+	switch action {
+	case protocol.ActionUpdate, protocol.ActionDelete:
+		return d / 2
+	case protocol.ActionReplace:
+		return d + d/2
+	case protocol.ActionNoOp:
+		return 0
+	default:
+		return d
 	}
-	return 2
+}
+
+// ChangeRisk is what applying a planned change puts at risk.
+type ChangeRisk struct {
+	// Downtime is set when the resource, or what depends on it, is
+	// unavailable during the apply.
+	Downtime bool
+	// DataLoss is set when data the resource holds is destroyed.
+	DataLoss bool
+}
+
+// PlannedChangeRisk returns what a planned change to a resource of resType
+// risks under the installed risk profile; see RiskProfile.ChangeRisk.
+func PlannedChangeRisk(resType string, c protocol.Change) ChangeRisk {
+	return ActiveRiskProfile().ChangeRisk(resType, "", c)
 }
@@ -0,0 +1,252 @@
+// Package approval keeps promotion approval requests: a promotion held at a
+// gate, the approvers its environment requires and their decisions. The
+// promotion proceeds once every required approver has approved it.
+package approval
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/filestore"
+)
+
+// Request statuses. A request stays pending until every required approver
+// approves it, or any of them rejects it.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+// Errors returned by Decide.
+var (
+	ErrNotFound     = errors.New("approval request not found")
+	ErrNotPending   = errors.New("approval request is no longer pending")
+	ErrNotApprover  = errors.New("not an approver for this environment")
+	ErrSelfApproval = errors.New("the requester of a promotion cannot approve it")
+	ErrDecided      = errors.New("approver has already decided")
+)
+
+// Decision is one approver's sign-off or rejection.
+type Decision struct {
+	Approver string    `json:"approver"`
+	Approved bool      `json:"approved"`
+	Comment  string    `json:"comment,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// GateResult is the outcome of one pre-promotion gate run on a release,
+// e.g. "security=critical".
+type GateResult struct {
+	Gate   string `json:"gate"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// Request is a promotion waiting for approval.
+type Request struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	// Source and Target are the environments promoted from and into, and
+	// Version the release promoted, as it was when the request was made.
+	Source  string `json:"source"`
+	Target  string `json:"target"`
+	Version string `json:"version"`
+	// Reasons are the gates that require approval, e.g. "environment" for an
+	// environment that always needs it.
+	Reasons    []string `json:"reasons"`
+	Repository string   `json:"repository,omitempty"`
+	// Requester is the GitHub login that asked for the promotion, when
+	// known; they cannot approve it.
+	Requester string `json:"requester,omitempty"`
+	// Approvers must all approve; when empty, any one approver will do.
+	Approvers []string   `json:"approvers,omitempty"`
+	Decisions []Decision `json:"decisions,omitempty"`
+	// Gates are the pre-promotion gates the release passed, and
+	// MonthlyCost its estimate in Currency when a cost gate ran; they are
+	// recorded with the environment once it is promoted.
+	Gates       []GateResult `json:"gates,omitempty"`
+	MonthlyCost float64      `json:"monthly_cost,omitempty"`
+	Currency    string       `json:"currency,omitempty"`
+	Created     time.Time    `json:"created"`
+}
+
+// Waiting returns the required approvers who have not approved yet.
+func (r Request) Waiting() []string {
+	var out []string
+	for _, a := range r.Approvers {
+		if !r.approvedBy(a) {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func (r Request) approvedBy(login string) bool {
+	for _, d := range r.Decisions {
+		if d.Approved && strings.EqualFold(d.Approver, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns r with d recorded and its status updated, or an error when
+// d cannot be accepted.
+func Apply(r Request, d Decision) (Request, error) {
+	login := strings.TrimPrefix(strings.TrimSpace(d.Approver), "@")
+	switch {
+	case r.Status != StatusPending:
+		return r, fmt.Errorf("%s is %s: %w", r.ID, r.Status, ErrNotPending)
+	case login == "":
+		return r, errors.New("approver is required")
+	case len(r.Approvers) > 0 && !contains(r.Approvers, login):
+		return r, fmt.Errorf("%s: %w (%s)", login, ErrNotApprover, strings.Join(r.Approvers, ", "))
+	case strings.EqualFold(login, r.Requester):
+		return r, ErrSelfApproval
+	}
+	for _, prev := range r.Decisions {
+		if strings.EqualFold(prev.Approver, login) {
+			return r, fmt.Errorf("%s: %w", login, ErrDecided)
+		}
+	}
+	d.Approver = login
+	r.Decisions = append(append([]Decision(nil), r.Decisions...), d)
+	switch {
+	case !d.Approved:
+		r.Status = StatusRejected
+	case len(r.Waiting()) == 0:
+		r.Status = StatusApproved
+	}
+	return r, nil
+}
+
+func contains(list []string, login string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// envNameRe matches environment names: lowercase letters, digits and
+// dashes, starting with a letter.
+var envNameRe = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// Approvers are the GitHub logins that must approve promotions into each
+// environment.
+type Approvers map[string][]string
+
+// ParseApprovers parses comma-separated "env:login" entries, e.g.
+// "prod:alice,prod:bob,staging:carol".
+func ParseApprovers(s string) (Approvers, error) {
+	out := make(Approvers)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		env, login, ok := strings.Cut(entry, ":")
+		env = strings.ToLower(strings.TrimSpace(env))
+		login = strings.TrimPrefix(strings.TrimSpace(login), "@")
+		if !ok || login == "" {
+			return nil, fmt.Errorf("approver %q: expected env:login", entry)
+		}
+		if !envNameRe.MatchString(env) {
+			return nil, fmt.Errorf("approver %q: invalid environment %q", entry, env)
+		}
+		if !contains(out[env], login) {
+			out[env] = append(out[env], login)
+		}
+	}
+	return out, nil
+}
+
+// Store holds approval requests, persisted to a JSON file when it has a
+// path. It is safe for concurrent use.
+type Store struct {
+	now      func() time.Time
+	requests *filestore.Records[Request]
+}
+
+// NewStore creates a store, loading path when it exists. An empty path
+// keeps requests in memory only.
+func NewStore(path string) (*Store, error) {
+	requests, err := filestore.Open[Request](path)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{now: time.Now, requests: requests}, nil
+}
+
+// Submit assigns r an ID, marks it pending and persists it.
+func (s *Store) Submit(r Request) (Request, error) {
+	err := s.requests.Update(func(requests []Request) ([]Request, error) {
+		n := 0
+		for _, prev := range requests {
+			if i, err := strconv.Atoi(strings.TrimPrefix(prev.ID, "APR-")); err == nil && i > n {
+				n = i
+			}
+		}
+		r.ID = fmt.Sprintf("APR-%03d", n+1)
+		r.Status = StatusPending
+		r.Created = s.now().UTC()
+		return append(requests, r), nil
+	})
+	if err != nil {
+		return Request{}, err
+	}
+	return r, nil
+}
+
+// Decide records an approver's decision on request id and persists it. The
+// decision's time is set to now. When it cannot be saved the request is
+// left as it was.
+func (s *Store) Decide(id string, d Decision) (Request, error) {
+	var prev, next Request
+	err := s.requests.Update(func(requests []Request) ([]Request, error) {
+		i := index(requests, id)
+		if i < 0 {
+			return nil, fmt.Errorf("%s: %w", id, ErrNotFound)
+		}
+		prev = requests[i]
+		d.Time = s.now().UTC()
+		var err error
+		if next, err = Apply(prev, d); err != nil {
+			return nil, err
+		}
+		requests[i] = next
+		return requests, nil
+	})
+	if err != nil {
+		return prev, err
+	}
+	return next, nil
+}
+
+func index(requests []Request, id string) int {
+	for i, r := range requests {
+		if strings.EqualFold(r.ID, id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns a request by ID.
+func (s *Store) Get(id string) (Request, bool) {
+	return s.requests.Find(func(r Request) bool { return strings.EqualFold(r.ID, id) })
+}
+
+// List returns the requests with status, or all when it is empty, newest
+// first.
+func (s *Store) List(status string) []Request {
+	return s.requests.List(
+		func(r Request) bool { return status == "" || r.Status == status },
+		func(a, b Request) bool { return a.Created.After(b.Created) })
+}
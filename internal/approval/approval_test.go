@@ -0,0 +1,115 @@
+package approval
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	r := Request{ID: "APR-001", Status: StatusPending, Requester: "dave", Approvers: []string{"alice", "bob"}}
+
+	if _, err := Apply(r, Decision{Approver: "carol", Approved: true}); !errors.Is(err, ErrNotApprover) {
+		t.Errorf("non-approver: %v", err)
+	}
+	r, err := Apply(r, Decision{Approver: "@Alice", Approved: true})
+	if err != nil || r.Status != StatusPending || len(r.Waiting()) != 1 || r.Waiting()[0] != "bob" {
+		t.Fatalf("first approval = %+v, %v", r, err)
+	}
+	if _, err := Apply(r, Decision{Approver: "alice", Approved: true}); !errors.Is(err, ErrDecided) {
+		t.Errorf("second decision: %v", err)
+	}
+	approved, err := Apply(r, Decision{Approver: "bob", Approved: true})
+	if err != nil || approved.Status != StatusApproved {
+		t.Errorf("final approval = %+v, %v", approved, err)
+	}
+	if _, err := Apply(approved, Decision{Approver: "bob", Approved: false}); !errors.Is(err, ErrNotPending) {
+		t.Errorf("decision on approved request: %v", err)
+	}
+	if rejected, err := Apply(r, Decision{Approver: "bob"}); err != nil || rejected.Status != StatusRejected {
+		t.Errorf("rejection = %+v, %v", rejected, err)
+	}
+
+	// Without listed approvers anyone but the requester can approve.
+	open := Request{ID: "APR-002", Status: StatusPending, Requester: "dave"}
+	if _, err := Apply(open, Decision{Approver: "Dave", Approved: true}); !errors.Is(err, ErrSelfApproval) {
+		t.Errorf("self-approval: %v", err)
+	}
+	if r, err := Apply(open, Decision{Approver: "erin", Approved: true}); err != nil || r.Status != StatusApproved {
+		t.Errorf("open approval = %+v, %v", r, err)
+	}
+}
+
+func TestParseApprovers(t *testing.T) {
+	a, err := ParseApprovers("prod:alice, PROD:@bob, staging:carol, prod:alice")
+	if err != nil || len(a["prod"]) != 2 || a["prod"][1] != "bob" || a["staging"][0] != "carol" {
+		t.Errorf("approvers = %v, %v", a, err)
+	}
+	for _, bad := range []string{"alice", "prod:", "q_a:alice"} {
+		if _, err := ParseApprovers(bad); err == nil {
+			t.Errorf("ParseApprovers(%q) should fail", bad)
+		}
+	}
+}
+
+func TestStore_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "approvals.json")
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := s.Submit(Request{Source: "staging", Target: "prod", Version: "v1.0.0", Approvers: []string{"alice"}})
+	second, err := s.Submit(Request{Source: "dev", Target: "staging", Version: "v1.1.0"})
+	if err != nil || first.ID != "APR-001" || second.ID != "APR-002" || second.Status != StatusPending {
+		t.Fatalf("submitted %+v, %+v, %v", first, second, err)
+	}
+	if r, err := s.Decide("apr-001", Decision{Approver: "alice", Approved: true, Comment: "ship it"}); err != nil || r.Status != StatusApproved || r.Decisions[0].Time.IsZero() {
+		t.Fatalf("decide = %+v, %v", r, err)
+	}
+	if _, err := s.Decide("APR-009", Decision{Approver: "alice", Approved: true}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("decide missing: %v", err)
+	}
+
+	reloaded, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := reloaded.Get("APR-001"); !ok || r.Status != StatusApproved || r.Decisions[0].Comment != "ship it" {
+		t.Errorf("reloaded = %+v, %v", r, ok)
+	}
+	if pending := reloaded.List(StatusPending); len(pending) != 1 || pending[0].ID != "APR-002" {
+		t.Errorf("pending = %+v", pending)
+	}
+	if next, _ := reloaded.Submit(Request{Target: "prod"}); next.ID != "APR-003" {
+		t.Errorf("next ID = %s", next.ID)
+	}
+}
+
+func TestStore_FailedSaveKeepsState(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewStore(filepath.Join(dir, "approvals.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ := s.Submit(Request{Target: "prod", Approvers: []string{"alice"}})
+
+	os.RemoveAll(dir)
+	if _, err := s.Decide(r.ID, Decision{Approver: "alice", Approved: true}); err == nil {
+		t.Fatal("decide saved to a missing directory")
+	}
+	if got, _ := s.Get(r.ID); got.Status != StatusPending || len(got.Decisions) != 0 {
+		t.Errorf("after a failed save = %+v, want it unchanged", got)
+	}
+	if _, err := s.Submit(Request{Target: "staging"}); err == nil || len(s.List("")) != 1 {
+		t.Errorf("submit after a failed save: %v, %d request(s)", err, len(s.List("")))
+	}
+
+	os.Mkdir(dir, 0o755)
+	if got, err := s.Decide(r.ID, Decision{Approver: "alice", Approved: true}); err != nil || got.Status != StatusApproved {
+		t.Errorf("retried decide = %+v, %v", got, err)
+	}
+}
@@ -38,7 +38,7 @@ func VerifySignature(body []byte, signature, secret string) bool {
 	return hmac.Equal(sigBytes, expected)
 }
 
-// SignPayload generates a signature for testing purposes.
+// SignPayload returns the X-Hub-Signature-256 header value for body.
 func SignPayload(body []byte, secret string) string {
 	mac := hmac.New(sha256.New, []byte(secret))
 	mac.Write(body)
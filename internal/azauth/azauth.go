@@ -0,0 +1,192 @@
+// Package azauth acquires Microsoft Entra ID tokens for Azure APIs with the
+// credential chain of the Azure SDK's DefaultAzureCredential: a client
+// secret, then workload identity, then managed identity.
+package azauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultAuthorityHost is the public cloud's Entra ID endpoint.
+const DefaultAuthorityHost = "https://login.microsoftonline.com"
+
+// imdsTokenURL is the Azure Instance Metadata Service token endpoint used
+// for managed identity outside App Service and Container Apps.
+var imdsTokenURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// refreshMargin renews tokens this long before they expire.
+const refreshMargin = 5 * time.Minute
+
+// Credential kinds, in the order they are tried.
+const (
+	KindClientSecret     = "client secret"
+	KindWorkloadIdentity = "workload identity"
+	KindManagedIdentity  = "managed identity"
+)
+
+// Config selects the credential. The fields mirror the SDK's environment
+// variables: AZURE_TENANT_ID, AZURE_CLIENT_ID, AZURE_CLIENT_SECRET,
+// AZURE_FEDERATED_TOKEN_FILE and AZURE_AUTHORITY_HOST.
+type Config struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	// FederatedTokenFile is the service account token projected by AKS
+	// workload identity; it is re-read for every token.
+	FederatedTokenFile string
+	AuthorityHost      string
+}
+
+// TokenSource supplies bearer tokens for a resource; *Credential
+// implements it.
+type TokenSource interface {
+	Token(ctx context.Context, resource string) (string, error)
+}
+
+// Credential acquires tokens, cached per resource until shortly before
+// they expire. It is safe for concurrent use.
+type Credential struct {
+	cfg    Config
+	kind   string
+	client *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]token
+}
+
+type token struct {
+	value   string
+	expires time.Time
+}
+
+// New picks the first credential cfg configures: a client secret, a
+// federated token file, or else managed identity (user-assigned when a
+// client ID is set).
+func New(cfg Config) (*Credential, error) {
+	kind := KindManagedIdentity
+	switch {
+	case cfg.ClientSecret != "":
+		kind = KindClientSecret
+	case cfg.FederatedTokenFile != "":
+		kind = KindWorkloadIdentity
+	}
+	if kind != KindManagedIdentity && (cfg.TenantID == "" || cfg.ClientID == "") {
+		return nil, fmt.Errorf("azure auth: %s needs a tenant and client ID", kind)
+	}
+	if cfg.AuthorityHost == "" {
+		cfg.AuthorityHost = DefaultAuthorityHost
+	}
+	cfg.AuthorityHost = strings.TrimRight(cfg.AuthorityHost, "/")
+	return &Credential{cfg: cfg, kind: kind, client: &http.Client{Timeout: 10 * time.Second}, tokens: make(map[string]token)}, nil
+}
+
+// Kind names the credential in use.
+func (c *Credential) Kind() string { return c.kind }
+
+// Token returns a token for resource, e.g. "https://management.azure.com".
+func (c *Credential) Token(ctx context.Context, resource string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if t, ok := c.tokens[resource]; ok && time.Until(t.expires) > refreshMargin {
+		return t.value, nil
+	}
+	req, err := c.request(ctx, resource)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("acquire token (%s): %w", c.kind, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("acquire token (%s): status %d: %s", c.kind, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var tr struct {
+		AccessToken string   `json:"access_token"`
+		ExpiresIn   flexUnix `json:"expires_in"`
+		ExpiresOn   flexUnix `json:"expires_on"`
+	}
+	if err := json.Unmarshal(body, &tr); err != nil || tr.AccessToken == "" {
+		return "", fmt.Errorf("acquire token (%s): invalid response", c.kind)
+	}
+	t := token{value: tr.AccessToken, expires: time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)}
+	if tr.ExpiresOn > 0 {
+		t.expires = time.Unix(int64(tr.ExpiresOn), 0)
+	}
+	c.tokens[resource] = t
+	return t.value, nil
+}
+
+// flexUnix is a number that managed identity endpoints send as a string.
+type flexUnix int64
+
+func (f *flexUnix) UnmarshalJSON(b []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(b), `"`), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid token expiry %s", b)
+	}
+	*f = flexUnix(n)
+	return nil
+}
+
+// request builds the token request for the credential kind.
+func (c *Credential) request(ctx context.Context, resource string) (*http.Request, error) {
+	if c.kind != KindManagedIdentity {
+		form := url.Values{
+			"grant_type": {"client_credentials"},
+			"client_id":  {c.cfg.ClientID},
+			"scope":      {strings.TrimRight(resource, "/") + "/.default"},
+		}
+		if c.kind == KindClientSecret {
+			form.Set("client_secret", c.cfg.ClientSecret)
+		} else {
+			assertion, err := os.ReadFile(c.cfg.FederatedTokenFile)
+			if err != nil {
+				return nil, fmt.Errorf("read federated token: %w", err)
+			}
+			form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+			form.Set("client_assertion", strings.TrimSpace(string(assertion)))
+		}
+		u := c.cfg.AuthorityHost + "/" + url.PathEscape(c.cfg.TenantID) + "/oauth2/v2.0/token"
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}
+
+	q := url.Values{"resource": {resource}}
+	if c.cfg.ClientID != "" {
+		q.Set("client_id", c.cfg.ClientID)
+	}
+	endpoint, header := os.Getenv("IDENTITY_ENDPOINT"), os.Getenv("IDENTITY_HEADER")
+	if endpoint != "" && header != "" {
+		q.Set("api-version", "2019-08-01")
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?"+q.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-IDENTITY-HEADER", header)
+		return req, nil
+	}
+	q.Set("api-version", "2018-02-01")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imdsTokenURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	return req, nil
+}
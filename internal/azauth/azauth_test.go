@@ -0,0 +1,84 @@
+package azauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCredential_Kinds(t *testing.T) {
+	for _, tc := range []struct {
+		cfg  Config
+		want string
+	}{
+		{Config{TenantID: "t", ClientID: "c", ClientSecret: "s", FederatedTokenFile: "f"}, KindClientSecret},
+		{Config{TenantID: "t", ClientID: "c", FederatedTokenFile: "f"}, KindWorkloadIdentity},
+		{Config{ClientID: "c"}, KindManagedIdentity},
+	} {
+		c, err := New(tc.cfg)
+		if err != nil || c.Kind() != tc.want {
+			t.Errorf("New(%+v) = %v, %v; want %s", tc.cfg, c, err, tc.want)
+		}
+	}
+	if _, err := New(Config{ClientSecret: "s"}); err == nil {
+		t.Error("expected error for a secret without tenant and client ID")
+	}
+}
+
+func TestCredential_WorkloadIdentity(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("sa-jwt\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/tenant/oauth2/v2.0/token" || r.FormValue("client_assertion") != "sa-jwt" ||
+			r.FormValue("scope") != "https://management.azure.com/.default" || r.FormValue("client_secret") != "" {
+			http.Error(w, "bad request "+r.URL.Path, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "arm-token", "expires_in": 3600}`)
+	}))
+	defer srv.Close()
+
+	c, err := New(Config{TenantID: "tenant", ClientID: "app", FederatedTokenFile: tokenFile, AuthorityHost: srv.URL + "/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		tok, err := c.Token(context.Background(), "https://management.azure.com/")
+		if err != nil || tok != "arm-token" {
+			t.Fatalf("Token = %q, %v", tok, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("token requests = %d, want 1 (cached)", calls)
+	}
+}
+
+func TestCredential_ManagedIdentity(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-IDENTITY-HEADER") != "secret" || r.URL.Query().Get("resource") != "https://management.azure.com" || r.URL.Query().Get("client_id") != "uami" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "mi-token", "expires_on": "4102444800"}`)
+	}))
+	defer srv.Close()
+	t.Setenv("IDENTITY_ENDPOINT", srv.URL)
+	t.Setenv("IDENTITY_HEADER", "secret")
+
+	c, _ := New(Config{ClientID: "uami"})
+	tok, err := c.Token(context.Background(), "https://management.azure.com")
+	if err != nil || tok != "mi-token" {
+		t.Fatalf("Token = %q, %v", tok, err)
+	}
+	if exp := c.tokens["https://management.azure.com"].expires; exp.Unix() != 4102444800 {
+		t.Errorf("expires = %v, want expires_on honoured", exp)
+	}
+}
@@ -0,0 +1,334 @@
+// Package azpolicy translates Azure Policy definitions into analyzer rules,
+// so IaC is checked against the policies assigned in Azure before it is
+// deployed rather than after.
+package azpolicy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+)
+
+// ARM types of the objects a bundle holds.
+const (
+	typeDefinition    = "Microsoft.Authorization/policyDefinitions"
+	typeSetDefinition = "Microsoft.Authorization/policySetDefinitions"
+	typeAssignment    = "Microsoft.Authorization/policyAssignments"
+)
+
+// Definition is a policy definition as exported by the portal, az CLI or
+// the ARM API.
+type Definition struct {
+	ID         string               `json:"id,omitempty"`
+	Name       string               `json:"name"`
+	Properties DefinitionProperties `json:"properties"`
+}
+
+// DefinitionProperties holds a definition's rule and parameters.
+type DefinitionProperties struct {
+	DisplayName string               `json:"displayName"`
+	Description string               `json:"description,omitempty"`
+	Mode        string               `json:"mode,omitempty"`
+	Parameters  map[string]Parameter `json:"parameters,omitempty"`
+	PolicyRule  *PolicyRule          `json:"policyRule,omitempty"`
+}
+
+// Parameter declares a definition or initiative parameter.
+type Parameter struct {
+	Type          string        `json:"type"`
+	DefaultValue  interface{}   `json:"defaultValue,omitempty"`
+	AllowedValues []interface{} `json:"allowedValues,omitempty"`
+}
+
+// PolicyRule is the if/then body of a definition.
+type PolicyRule struct {
+	If   map[string]interface{} `json:"if"`
+	Then struct {
+		Effect string `json:"effect"`
+	} `json:"then"`
+}
+
+// SetDefinition is an initiative grouping definitions.
+type SetDefinition struct {
+	ID         string        `json:"id,omitempty"`
+	Name       string        `json:"name"`
+	Properties SetProperties `json:"properties"`
+}
+
+// SetProperties lists an initiative's member definitions.
+type SetProperties struct {
+	DisplayName       string                `json:"displayName"`
+	Description       string                `json:"description,omitempty"`
+	Parameters        map[string]Parameter  `json:"parameters,omitempty"`
+	PolicyDefinitions []DefinitionReference `json:"policyDefinitions"`
+}
+
+// DefinitionReference is an initiative member and the parameter values the
+// initiative passes it.
+type DefinitionReference struct {
+	PolicyDefinitionID          string                    `json:"policyDefinitionId"`
+	PolicyDefinitionReferenceID string                    `json:"policyDefinitionReferenceId,omitempty"`
+	Parameters                  map[string]ParameterValue `json:"parameters,omitempty"`
+}
+
+// ParameterValue is a value passed to a parameter.
+type ParameterValue struct {
+	Value interface{} `json:"value"`
+}
+
+// Assignment applies a definition or initiative at a scope.
+type Assignment struct {
+	ID         string               `json:"id,omitempty"`
+	Name       string               `json:"name"`
+	Properties AssignmentProperties `json:"properties"`
+}
+
+// AssignmentProperties names what is assigned and with which parameters.
+type AssignmentProperties struct {
+	DisplayName        string                    `json:"displayName,omitempty"`
+	PolicyDefinitionID string                    `json:"policyDefinitionId"`
+	Parameters         map[string]ParameterValue `json:"parameters,omitempty"`
+	// EnforcementMode "DoNotEnforce" assignments are still evaluated.
+	EnforcementMode string `json:"enforcementMode,omitempty"`
+}
+
+// Bundle is a set of definitions, initiatives and assignments.
+type Bundle struct {
+	Definitions []Definition
+	Sets        []SetDefinition
+	Assignments []Assignment
+}
+
+// Add appends the contents of o.
+func (b *Bundle) Add(o Bundle) {
+	b.Definitions = append(b.Definitions, o.Definitions...)
+	b.Sets = append(b.Sets, o.Sets...)
+	b.Assignments = append(b.Assignments, o.Assignments...)
+}
+
+// Parse reads definitions, initiatives and assignments from JSON: a single
+// object, an array, or an ARM list response ({"value": [...]}). Objects
+// without a "type" are told apart by their properties.
+func Parse(data []byte) (Bundle, error) {
+	var b Bundle
+	data = bytes.TrimSpace(data)
+	var raw []json.RawMessage
+	switch {
+	case bytes.HasPrefix(data, []byte("[")):
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return b, err
+		}
+	default:
+		var list struct {
+			Value []json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return b, err
+		}
+		raw = list.Value
+		if list.Value == nil {
+			raw = []json.RawMessage{data}
+		}
+	}
+	for i, r := range raw {
+		var probe struct {
+			Type       string `json:"type"`
+			Properties struct {
+				PolicyRule         json.RawMessage `json:"policyRule"`
+				PolicyDefinitions  json.RawMessage `json:"policyDefinitions"`
+				PolicyDefinitionID string          `json:"policyDefinitionId"`
+			} `json:"properties"`
+		}
+		if err := json.Unmarshal(r, &probe); err != nil {
+			return b, fmt.Errorf("object %d: %w", i, err)
+		}
+		var err error
+		switch {
+		case strings.EqualFold(probe.Type, typeSetDefinition) || probe.Properties.PolicyDefinitions != nil:
+			var s SetDefinition
+			err = json.Unmarshal(r, &s)
+			b.Sets = append(b.Sets, s)
+		case strings.EqualFold(probe.Type, typeAssignment) || probe.Properties.PolicyDefinitionID != "":
+			var a Assignment
+			err = json.Unmarshal(r, &a)
+			b.Assignments = append(b.Assignments, a)
+		case strings.EqualFold(probe.Type, typeDefinition) || probe.Properties.PolicyRule != nil:
+			var d Definition
+			err = json.Unmarshal(r, &d)
+			b.Definitions = append(b.Definitions, d)
+		default:
+			return b, fmt.Errorf("object %d is not a policy definition, initiative or assignment", i)
+		}
+		if err != nil {
+			return b, fmt.Errorf("object %d: %w", i, err)
+		}
+	}
+	return b, nil
+}
+
+// LoadPath parses a JSON file, or every *.json file in a directory.
+func LoadPath(path string) (Bundle, error) {
+	var b Bundle
+	info, err := os.Stat(path)
+	if err != nil {
+		return b, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.json")); err != nil {
+			return b, err
+		}
+		sort.Strings(files)
+	}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return b, err
+		}
+		fb, err := Parse(data)
+		if err != nil {
+			return b, fmt.Errorf("%s: %w", f, err)
+		}
+		b.Add(fb)
+	}
+	return b, nil
+}
+
+// Skipped is a definition the bundle could not turn into rules.
+type Skipped struct {
+	Definition string `json:"definition"`
+	Reason     string `json:"reason"`
+}
+
+// Rules translates the bundle into analyzer rules. With assignments, only
+// what they assign is evaluated, with their parameter values; otherwise
+// every initiative and every definition outside one is, with defaults.
+// A definition reached more than once is evaluated once, with the values of
+// the first.
+func (b Bundle) Rules() ([]analyzer.Rule, []Skipped) {
+	t := translator{bundle: b, seen: make(map[string]bool)}
+	if len(b.Assignments) > 0 {
+		for _, a := range b.Assignments {
+			t.assign(a.Properties.PolicyDefinitionID, values(a.Properties.Parameters))
+		}
+		return t.rules, t.skipped
+	}
+	members := make(map[string]bool)
+	for _, s := range b.Sets {
+		for _, ref := range s.Properties.PolicyDefinitions {
+			members[resourceName(ref.PolicyDefinitionID)] = true
+		}
+		t.set(s, nil)
+	}
+	for _, d := range b.Definitions {
+		if !members[strings.ToLower(d.Name)] {
+			t.definition(d, nil)
+		}
+	}
+	return t.rules, t.skipped
+}
+
+// translator accumulates rules and skipped definitions for Bundle.Rules.
+type translator struct {
+	bundle  Bundle
+	seen    map[string]bool
+	rules   []analyzer.Rule
+	skipped []Skipped
+}
+
+// assign evaluates the definition or initiative id names.
+func (t *translator) assign(id string, params map[string]interface{}) {
+	name := resourceName(id)
+	if strings.Contains(strings.ToLower(id), "/policysetdefinitions/") {
+		for _, s := range t.bundle.Sets {
+			if strings.EqualFold(s.Name, name) {
+				t.set(s, params)
+				return
+			}
+		}
+	} else if d, ok := t.find(name); ok {
+		t.definition(d, params)
+		return
+	}
+	t.skipped = append(t.skipped, Skipped{Definition: id, Reason: "not found in the loaded definitions"})
+}
+
+// set evaluates an initiative's members, resolving the values it passes
+// them against its own parameters.
+func (t *translator) set(s SetDefinition, params map[string]interface{}) {
+	setParams, err := resolveParams(s.Properties.Parameters, params)
+	if err != nil {
+		t.skipped = append(t.skipped, Skipped{Definition: s.Name, Reason: err.Error()})
+		return
+	}
+	for _, ref := range s.Properties.PolicyDefinitions {
+		d, ok := t.find(resourceName(ref.PolicyDefinitionID))
+		if !ok {
+			t.skipped = append(t.skipped, Skipped{Definition: ref.PolicyDefinitionID, Reason: "not found in the loaded definitions"})
+			continue
+		}
+		member := make(map[string]interface{}, len(ref.Parameters))
+		for k, v := range ref.Parameters {
+			resolved, err := resolve(v.Value, setParams)
+			if err != nil {
+				t.skipped = append(t.skipped, Skipped{Definition: d.Name, Reason: err.Error()})
+				member = nil
+				break
+			}
+			member[k] = resolved
+		}
+		if member != nil {
+			t.definition(d, member)
+		}
+	}
+}
+
+// definition translates one definition unless it was already.
+func (t *translator) definition(d Definition, params map[string]interface{}) {
+	key := strings.ToLower(d.Name)
+	if t.seen[key] {
+		return
+	}
+	t.seen[key] = true
+	rule, err := Translate(d, params)
+	if err != nil {
+		t.skipped = append(t.skipped, Skipped{Definition: displayName(d), Reason: err.Error()})
+		return
+	}
+	t.rules = append(t.rules, rule)
+}
+
+func (t *translator) find(name string) (Definition, bool) {
+	for _, d := range t.bundle.Definitions {
+		if strings.EqualFold(d.Name, name) {
+			return d, true
+		}
+	}
+	return Definition{}, false
+}
+
+// resourceName returns the last segment of a resource ID, lowercased.
+func resourceName(id string) string {
+	return strings.ToLower(id[strings.LastIndex(id, "/")+1:])
+}
+
+func values(pv map[string]ParameterValue) map[string]interface{} {
+	out := make(map[string]interface{}, len(pv))
+	for k, v := range pv {
+		out[k] = v.Value
+	}
+	return out
+}
+
+func displayName(d Definition) string {
+	if d.Properties.DisplayName != "" {
+		return d.Properties.DisplayName
+	}
+	return d.Name
+}
@@ -0,0 +1,258 @@
+package azpolicy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+)
+
+// minTLS is shaped like the built-in "Storage accounts should have the
+// specified minimum TLS version".
+const minTLS = `{
+  "id": "/providers/Microsoft.Authorization/policyDefinitions/fe83a0eb-a853-422d-aac2-1bffd182c5d0",
+  "type": "Microsoft.Authorization/policyDefinitions",
+  "name": "fe83a0eb-a853-422d-aac2-1bffd182c5d0",
+  "properties": {
+    "displayName": "Storage accounts should have the specified minimum TLS version",
+    "mode": "Indexed",
+    "parameters": {
+      "effect": {"type": "String", "defaultValue": "Audit", "allowedValues": ["Audit", "Deny", "Disabled"]},
+      "minimumTlsVersion": {"type": "String", "defaultValue": "TLS1_2"}
+    },
+    "policyRule": {
+      "if": {
+        "allOf": [
+          {"field": "type", "equals": "Microsoft.Storage/storageAccounts"},
+          {"anyOf": [
+            {"field": "Microsoft.Storage/storageAccounts/minimumTlsVersion", "exists": "false"},
+            {"field": "Microsoft.Storage/storageAccounts/minimumTlsVersion", "notEquals": "[parameters('minimumTlsVersion')]"}
+          ]}
+        ]
+      },
+      "then": {"effect": "[parameters('effect')]"}
+    }
+  }
+}`
+
+const requireTag = `{
+  "name": "require-env-tag",
+  "properties": {
+    "displayName": "Require an env tag",
+    "parameters": {"tagName": {"type": "String", "defaultValue": "env"}},
+    "policyRule": {
+      "if": {"field": "[concat('tags[', parameters('tagName'), ']')]", "exists": "false"},
+      "then": {"effect": "deny"}
+    }
+  }
+}`
+
+const vaultNames = `{
+  "name": "kv-naming",
+  "properties": {
+    "displayName": "Key vault names start with kv-",
+    "policyRule": {
+      "if": {"allOf": [
+        {"field": "type", "in": ["Microsoft.KeyVault/vaults"]},
+        {"not": {"field": "name", "like": "kv-*"}},
+        {"field": "tags['env']", "notEquals": "sandbox"}
+      ]},
+      "then": {"effect": "Deny"}
+    }
+  }
+}`
+
+const code = `resource "azurerm_storage_account" "old" {
+  name            = "stold"
+  min_tls_version = "TLS1_0"
+}
+
+resource "azurerm_storage_account" "current" {
+  name            = "stcurrent"
+  min_tls_version = "TLS1_2"
+}
+
+resource "azurerm_key_vault" "bad" {
+  name = "vault1"
+}
+
+resource "azurerm_key_vault" "sandbox" {
+  name = "vault2"
+  tags = {
+    env = "Sandbox"
+  }
+}
+
+resource "azurerm_key_vault" "good" {
+  name = "kv-orders"
+}
+
+resource "azurerm_resource_group" "rg" {
+  name = "rg"
+}`
+
+func ruleFindings(t *testing.T, rules []analyzer.Rule, iac string) map[string][]string {
+	t.Helper()
+	out := make(map[string][]string)
+	for _, f := range analyzer.Run(rules, parser.ParseResources(iac)) {
+		out[f.RuleID] = append(out[f.RuleID], f.Resource)
+	}
+	return out
+}
+
+func TestBundle_Rules(t *testing.T) {
+	var b Bundle
+	for _, src := range []string{minTLS, requireTag, vaultNames} {
+		pb, err := Parse([]byte(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Add(pb)
+	}
+	rules, skipped := b.Rules()
+	if len(rules) != 2 || len(skipped) != 1 || !strings.Contains(skipped[0].Reason, "not supported") {
+		t.Fatalf("rules = %d, skipped = %+v; want the tag policy's field expression skipped", len(rules), skipped)
+	}
+	if rules[0].ID != "AZP-FE83A0EB-A853-422D-AAC2-1BFFD182C5D0" || rules[0].Severity != "medium" || rules[1].Severity != "high" {
+		t.Errorf("rules = %s/%s, %s/%s", rules[0].ID, rules[0].Severity, rules[1].ID, rules[1].Severity)
+	}
+
+	got := ruleFindings(t, rules, code)
+	if tls := got["AZP-FE83A0EB-A853-422D-AAC2-1BFFD182C5D0"]; len(tls) != 1 || tls[0] != "old" {
+		t.Errorf("TLS findings = %v, want old", tls)
+	}
+	// Tag values compare case-insensitively, as in Azure.
+	if kv := got["AZP-KV-NAMING"]; len(kv) != 1 || kv[0] != "bad" {
+		t.Errorf("naming findings = %v, want bad", kv)
+	}
+
+	// Bicep leaves minimumTlsVersion unset.
+	bicep := parser.ParseResources(`resource st 'Microsoft.Storage/storageAccounts@2023-01-01' = {
+  name: 'stbicep'
+  location: 'eastus'
+}`)
+	fs := analyzer.Run(rules, bicep)
+	if len(fs) != 1 || !strings.Contains(fs[0].Message, "min_tls_version is not set") || fs[0].Confidence != "low" {
+		t.Errorf("bicep findings = %+v", fs)
+	}
+}
+
+func TestBundle_Assignments(t *testing.T) {
+	initiative := `{
+  "type": "Microsoft.Authorization/policySetDefinitions",
+  "name": "baseline",
+  "properties": {
+    "displayName": "Baseline",
+    "parameters": {"tlsEffect": {"type": "String", "defaultValue": "Audit"}},
+    "policyDefinitions": [
+      {
+        "policyDefinitionId": "/providers/Microsoft.Authorization/policyDefinitions/fe83a0eb-a853-422d-aac2-1bffd182c5d0",
+        "parameters": {"effect": {"value": "[parameters('tlsEffect')]"}, "minimumTlsVersion": {"value": "TLS1_1"}}
+      },
+      {"policyDefinitionId": "/providers/Microsoft.Authorization/policyDefinitions/missing"}
+    ]
+  }
+}`
+	assignment := `{"value": [{
+  "type": "Microsoft.Authorization/policyAssignments",
+  "name": "baseline-prod",
+  "properties": {
+    "policyDefinitionId": "/subscriptions/0000/providers/Microsoft.Authorization/policySetDefinitions/baseline",
+    "parameters": {"tlsEffect": {"value": "Deny"}}
+  }
+}]}`
+	dir := t.TempDir()
+	for name, src := range map[string]string{"tls.json": minTLS, "naming.json": vaultNames, "baseline.json": initiative, "assign.json": assignment} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := LoadPath(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, skipped := b.Rules()
+	// Only the assigned initiative is evaluated: the naming policy is not.
+	if len(rules) != 1 || len(skipped) != 1 || !strings.HasSuffix(skipped[0].Definition, "/missing") {
+		t.Fatalf("rules = %d, skipped = %+v", len(rules), skipped)
+	}
+	if rules[0].Severity != "high" {
+		t.Errorf("severity = %s, want the assigned Deny", rules[0].Severity)
+	}
+	got := ruleFindings(t, rules, `resource "azurerm_storage_account" "a" {
+  min_tls_version = "TLS1_1"
+}`)
+	if len(got) != 0 {
+		t.Errorf("findings = %v, want TLS1_1 allowed by the initiative", got)
+	}
+}
+
+func TestTranslate_Unsupported(t *testing.T) {
+	for name, rule := range map[string]string{
+		"count":       `{"if": {"count": {"field": "Microsoft.Network/networkSecurityGroups/securityRules[*]"}, "greater": 0}, "then": {"effect": "audit"}}`,
+		"effect":      `{"if": {"field": "type", "equals": "Microsoft.Sql/servers"}, "then": {"effect": "deployIfNotExists"}}`,
+		"operator":    `{"if": {"field": "type", "sameAs": "x"}, "then": {"effect": "audit"}}`,
+		"expression":  `{"if": {"field": "location", "equals": "[resourceGroup().location]"}, "then": {"effect": "audit"}}`,
+		"no operator": `{"if": {"field": "location"}, "then": {"effect": "audit"}}`,
+	} {
+		b, err := Parse([]byte(`{"name": "x", "properties": {"policyRule": ` + rule + `}}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Translate(b.Definitions[0], nil); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestOperators(t *testing.T) {
+	b, err := Parse([]byte(`[{"name": "ops", "properties": {"policyRule": {"if": {"allOf": [
+  {"field": "Microsoft.Compute/virtualMachines/location", "in": ["eastus", "westus"]},
+  {"field": "Microsoft.Network/networkSecurityGroups/securityRules[*].priority", "greaterOrEquals": 100},
+  {"field": "Microsoft.Network/networkSecurityGroups/securityRules[*].name", "match": "rule-##"},
+  {"field": "tags", "containsKey": "Owner"},
+  {"value": "audit", "equals": "AUDIT"}
+]}, "then": {"effect": "audit"}}}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, err := Translate(b.Definitions[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ruleFindings(t, []analyzer.Rule{rule}, `resource "azurerm_network_security_group" "match" {
+  location = "EastUS"
+  tags = {
+    owner = "team"
+  }
+  security_rule {
+    name     = "rule-01"
+    priority = 100
+  }
+  security_rule {
+    name     = "rule-02"
+    priority = 200
+  }
+}
+
+resource "azurerm_network_security_group" "low" {
+  location = "eastus"
+  tags = {
+    owner = "team"
+  }
+  security_rule {
+    name     = "rule-01"
+    priority = 50
+  }
+}
+
+resource "azurerm_network_security_group" "untagged" {
+  location = "westus"
+}`)
+	if r := got["AZP-OPS"]; len(r) != 1 || r[0] != "match" {
+		t.Errorf("findings = %v, want match", got)
+	}
+}
@@ -0,0 +1,229 @@
+package azpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/azauth"
+)
+
+// DefaultManagementURL is the public cloud's Resource Manager endpoint.
+const DefaultManagementURL = "https://management.azure.com"
+
+// apiVersion is the Microsoft.Authorization policy API version used.
+const apiVersion = "2023-04-01"
+
+// Client fetches the policies assigned to subscriptions from Resource
+// Manager and serves them as rules. Each subscription's assignments and
+// definitions are cached for a TTL; when a refresh fails the previous rules
+// are kept. It is safe for concurrent use.
+type Client struct {
+	creds         azauth.TokenSource
+	subscriptions []string
+	baseURL       string
+	ttl           time.Duration
+	http          *http.Client
+	now           func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+// cached is one subscription's translated policies.
+type cached struct {
+	rules   []analyzer.Rule
+	fetched time.Time
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithManagementURL points the client at a sovereign cloud or a test server.
+func WithManagementURL(u string) ClientOption {
+	return func(c *Client) {
+		c.baseURL = strings.TrimRight(u, "/")
+	}
+}
+
+// WithCacheTTL sets how long a subscription's policies are reused before
+// they are fetched again (default 1h).
+func WithCacheTTL(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.ttl = d
+	}
+}
+
+// NewClient returns a client for the policies assigned to subscriptions.
+func NewClient(creds azauth.TokenSource, subscriptions []string, opts ...ClientOption) *Client {
+	c := &Client{
+		creds:         creds,
+		subscriptions: subscriptions,
+		baseURL:       DefaultManagementURL,
+		ttl:           time.Hour,
+		http:          &http.Client{Timeout: 30 * time.Second},
+		now:           time.Now,
+		cache:         make(map[string]cached),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// Rules returns the rules for every subscription's assigned policies,
+// fetching those not cached or expired. A policy assigned above several
+// subscriptions (at a management group) is evaluated once. Subscriptions
+// that cannot be fetched and have nothing cached are reported in the error
+// alongside the rules of the others.
+func (c *Client) Rules(ctx context.Context) ([]analyzer.Rule, error) {
+	var rules []analyzer.Rule
+	var errs []error
+	seen := make(map[string]bool)
+	for _, sub := range c.subscriptions {
+		subRules, err := c.subscriptionRules(ctx, sub)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("subscription %s: %w", sub, err))
+		}
+		for _, r := range subRules {
+			if !seen[r.ID] {
+				seen[r.ID] = true
+				rules = append(rules, r)
+			}
+		}
+	}
+	return rules, errors.Join(errs...)
+}
+
+func (c *Client) subscriptionRules(ctx context.Context, sub string) ([]analyzer.Rule, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache[strings.ToLower(sub)]
+	if ok && c.now().Sub(entry.fetched) < c.ttl {
+		return entry.rules, nil
+	}
+	bundle, err := c.Fetch(ctx, sub)
+	if err != nil {
+		if ok {
+			log.Printf("Azure Policy: refresh of subscription %s failed, keeping cached policies: %v", sub, err)
+			return entry.rules, nil
+		}
+		return nil, err
+	}
+	rules, skipped := bundle.Rules()
+	for _, s := range skipped {
+		log.Printf("Azure Policy %s not evaluated: %s", s.Definition, s.Reason)
+	}
+	c.cache[strings.ToLower(sub)] = cached{rules: rules, fetched: c.now()}
+	return rules, nil
+}
+
+// Fetch reads the policy assignments that apply to a whole subscription,
+// including those inherited from management groups (resource group
+// assignments are not), and the definitions and initiatives they assign.
+func (c *Client) Fetch(ctx context.Context, sub string) (Bundle, error) {
+	var b Bundle
+	path := "/subscriptions/" + url.PathEscape(sub) + "/providers/Microsoft.Authorization/policyAssignments"
+	if err := c.list(ctx, path, &b.Assignments); err != nil {
+		return b, err
+	}
+	seen := make(map[string]bool)
+	for _, a := range b.Assignments {
+		if err := c.fetchDefinition(ctx, a.Properties.PolicyDefinitionID, &b, seen); err != nil {
+			return b, err
+		}
+	}
+	return b, nil
+}
+
+// fetchDefinition adds the definition or initiative id names to b, with an
+// initiative's members. Definitions that no longer exist are left for
+// Rules to report.
+func (c *Client) fetchDefinition(ctx context.Context, id string, b *Bundle, seen map[string]bool) error {
+	key := strings.ToLower(id)
+	if id == "" || seen[key] {
+		return nil
+	}
+	seen[key] = true
+	if strings.Contains(key, "/policysetdefinitions/") {
+		var s SetDefinition
+		if found, err := c.get(ctx, id, &s); err != nil || !found {
+			return err
+		}
+		b.Sets = append(b.Sets, s)
+		for _, ref := range s.Properties.PolicyDefinitions {
+			if err := c.fetchDefinition(ctx, ref.PolicyDefinitionID, b, seen); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var d Definition
+	if found, err := c.get(ctx, id, &d); err != nil || !found {
+		return err
+	}
+	b.Definitions = append(b.Definitions, d)
+	return nil
+}
+
+// list reads every page of the assignments at path into out.
+func (c *Client) list(ctx context.Context, path string, out *[]Assignment) error {
+	next := c.baseURL + path + "?" + url.Values{"$filter": {"atScope()"}, "api-version": {apiVersion}}.Encode()
+	for next != "" {
+		if !strings.HasPrefix(next, c.baseURL+"/") {
+			return fmt.Errorf("unexpected next page link %s", next)
+		}
+		var page struct {
+			Value    []Assignment `json:"value"`
+			NextLink string       `json:"nextLink"`
+		}
+		if _, err := c.do(ctx, next, &page); err != nil {
+			return err
+		}
+		*out = append(*out, page.Value...)
+		next = page.NextLink
+	}
+	return nil
+}
+
+// get reads one resource by ID into out, reporting whether it exists.
+func (c *Client) get(ctx context.Context, id string, out interface{}) (bool, error) {
+	return c.do(ctx, c.baseURL+id+"?api-version="+apiVersion, out)
+}
+
+func (c *Client) do(ctx context.Context, u string, out interface{}) (bool, error) {
+	token, err := c.creds.Token(ctx, c.baseURL)
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return false, fmt.Errorf("GET %s: status %d: %s", strings.SplitN(u, "?", 2)[0], resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 32<<20)).Decode(out); err != nil {
+		return false, fmt.Errorf("GET %s: %w", strings.SplitN(u, "?", 2)[0], err)
+	}
+	return true, nil
+}
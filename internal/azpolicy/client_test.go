@@ -0,0 +1,98 @@
+package azpolicy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type staticToken string
+
+func (s staticToken) Token(context.Context, string) (string, error) { return string(s), nil }
+
+func TestClient_Rules(t *testing.T) {
+	var srv *httptest.Server
+	var calls int
+	failing := false
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Authorization") != "Bearer tok" || r.URL.Query().Get("api-version") != apiVersion {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if failing {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		switch r.URL.Path {
+		case "/subscriptions/sub-a/providers/Microsoft.Authorization/policyAssignments":
+			if r.URL.Query().Get("page") == "" {
+				if r.URL.Query().Get("$filter") != "atScope()" {
+					http.Error(w, "missing filter", http.StatusBadRequest)
+					return
+				}
+				fmt.Fprintf(w, `{"value": [{"name": "a1", "properties": {"policyDefinitionId": "/providers/Microsoft.Authorization/policySetDefinitions/baseline", "parameters": {"tlsEffect": {"value": "Deny"}}}}],
+					"nextLink": "%s%s?page=2&api-version=%s"}`, srv.URL, r.URL.Path, apiVersion)
+				return
+			}
+			fmt.Fprint(w, `{"value": [{"name": "a2", "properties": {"policyDefinitionId": "/providers/Microsoft.Authorization/policyDefinitions/gone"}}]}`)
+		case "/subscriptions/sub-b/providers/Microsoft.Authorization/policyAssignments":
+			fmt.Fprint(w, `{"value": [{"name": "a3", "properties": {"policyDefinitionId": "/providers/Microsoft.Authorization/policyDefinitions/fe83a0eb-a853-422d-aac2-1bffd182c5d0"}}]}`)
+		case "/providers/Microsoft.Authorization/policySetDefinitions/baseline":
+			fmt.Fprint(w, `{"name": "baseline", "properties": {
+				"parameters": {"tlsEffect": {"type": "String", "defaultValue": "Audit"}},
+				"policyDefinitions": [{"policyDefinitionId": "/providers/Microsoft.Authorization/policyDefinitions/fe83a0eb-a853-422d-aac2-1bffd182c5d0", "parameters": {"effect": {"value": "[parameters('tlsEffect')]"}}}]}}`)
+		case "/providers/Microsoft.Authorization/policyDefinitions/fe83a0eb-a853-422d-aac2-1bffd182c5d0":
+			fmt.Fprint(w, minTLS)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	c := NewClient(staticToken("tok"), []string{"sub-a", "sub-b"}, WithManagementURL(srv.URL), WithCacheTTL(time.Hour))
+	now := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	rules, err := c.Rules(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The TLS policy is assigned to both subscriptions; sub-a's Deny wins.
+	if len(rules) != 1 || rules[0].Severity != "high" {
+		t.Fatalf("rules = %+v", rules)
+	}
+	fetched := calls
+
+	if _, err := c.Rules(context.Background()); err != nil || calls != fetched {
+		t.Errorf("cached Rules made %d more request(s), err %v", calls-fetched, err)
+	}
+
+	// Expired: the refresh fails, so the cached rules are kept.
+	now = now.Add(2 * time.Hour)
+	failing = true
+	rules, err = c.Rules(context.Background())
+	if err != nil || len(rules) != 1 || calls == fetched {
+		t.Errorf("stale Rules = %d rule(s), %v after %d request(s)", len(rules), err, calls-fetched)
+	}
+
+	// A subscription never fetched reports its error.
+	cold := NewClient(staticToken("tok"), []string{"sub-a"}, WithManagementURL(srv.URL))
+	if _, err := cold.Rules(context.Background()); err == nil || !strings.Contains(err.Error(), "sub-a") {
+		t.Errorf("err = %v, want the subscription's failure", err)
+	}
+}
+
+func TestClient_RejectsForeignNextLink(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"value": [], "nextLink": "https://attacker.example.com/page"}`)
+	}))
+	defer srv.Close()
+	if _, err := NewClient(staticToken("tok"), nil, WithManagementURL(srv.URL)).Fetch(context.Background(), "sub"); err == nil {
+		t.Error("expected error for a next link to another host")
+	}
+}
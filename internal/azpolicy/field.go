@@ -0,0 +1,144 @@
+package azpolicy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+)
+
+type fieldKind int
+
+const (
+	fieldPath fieldKind = iota
+	fieldType
+	fieldTag
+)
+
+var tagFieldRe = regexp.MustCompile(`^tags(?:\['([^']+)'\]|\[([^\]]+)\]|\.(.+))$`)
+
+// fieldRef is a condition's field: the resource type, a tag, or a property
+// path. Path segments ending in [*] iterate a list.
+type fieldRef struct {
+	kind fieldKind
+	tag  string
+	segs []segment
+}
+
+type segment struct {
+	key  string
+	each bool
+}
+
+// parseField reads a field: "type", "name", "location", "kind", "tags",
+// "tags['key']", or a property alias such as
+// "Microsoft.Storage/storageAccounts/networkAcls.ipRules[*].value", which
+// is matched by the path after the resource type.
+func parseField(f string) (fieldRef, error) {
+	lower := strings.ToLower(f)
+	switch lower {
+	case "type":
+		return fieldRef{kind: fieldType}, nil
+	case "name", "fullname":
+		return fieldRef{segs: []segment{{key: "name"}}}, nil
+	case "id":
+		return fieldRef{}, fmt.Errorf("field %s is not supported", f)
+	}
+	if m := tagFieldRe.FindStringSubmatch(f); m != nil {
+		return fieldRef{kind: fieldTag, tag: m[1] + m[2] + m[3]}, nil
+	}
+	if strings.HasPrefix(f, "[") {
+		return fieldRef{}, fmt.Errorf("field expression %s is not supported", f)
+	}
+	path := f
+	if i := strings.LastIndex(f, "/"); i >= 0 {
+		path = f[i+1:]
+	}
+	var ref fieldRef
+	for _, part := range strings.Split(path, ".") {
+		seg := segment{key: strings.TrimSuffix(part, "[*]")}
+		seg.each = seg.key != part
+		if seg.key == "" || strings.ContainsAny(seg.key, "[]") {
+			return fieldRef{}, fmt.Errorf("field %s is not supported", f)
+		}
+		ref.segs = append(ref.segs, seg)
+	}
+	return ref, nil
+}
+
+// path is the Terraform property path the field reads.
+func (f fieldRef) path() string {
+	if f.kind == fieldTag {
+		return "tags." + f.tag
+	}
+	parts := make([]string, len(f.segs))
+	for i, s := range f.segs {
+		parts[i] = parser.TerraformProperty(s.key)
+	}
+	return strings.Join(parts, ".")
+}
+
+// values returns the field's values in t: one value (nil when unset), or
+// with each set, the elements of the lists it iterates.
+func (f fieldRef) values(t target) (vals []interface{}, each bool) {
+	switch f.kind {
+	case fieldType:
+		return []interface{}{t.armType}, false
+	case fieldTag:
+		tags, _ := t.props["tags"].(map[string]interface{})
+		v, _ := lookupFold(tags, f.tag)
+		return []interface{}{v}, false
+	}
+	cur := []interface{}{t.props}
+	for _, seg := range f.segs {
+		each = each || seg.each
+		var next []interface{}
+		for _, v := range cur {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			child := property(m, seg.key)
+			if list, ok := child.([]interface{}); ok && seg.each {
+				next = append(next, list...)
+			} else if child != nil {
+				next = append(next, child)
+			}
+		}
+		cur = next
+	}
+	if !each {
+		if len(cur) == 0 {
+			return []interface{}{nil}, false
+		}
+		return cur[:1], false
+	}
+	return cur, true
+}
+
+// property looks up an ARM property name in parsed properties: as written
+// (Bicep keeps unmapped names), then by its Terraform name, ignoring case.
+// Terraform names repeated blocks in the singular (securityRules is
+// security_rule).
+func property(m map[string]interface{}, key string) interface{} {
+	tf := parser.TerraformProperty(key)
+	for _, k := range []string{key, tf, strings.TrimSuffix(tf, "s")} {
+		if v, ok := lookupFold(m, k); ok {
+			return v
+		}
+	}
+	return nil
+}
+
+// describe renders the field's current value for a finding message.
+func (f fieldRef) describe(t target) string {
+	vals, each := f.values(t)
+	if !each {
+		if vals[0] == nil {
+			return f.path() + " is not set"
+		}
+		return fmt.Sprintf("%s = %v", f.path(), vals[0])
+	}
+	return fmt.Sprintf("%s = %v", f.path(), vals)
+}
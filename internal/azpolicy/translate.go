@@ -0,0 +1,494 @@
+package azpolicy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// effectSeverity maps the effects that report non-compliance to a finding
+// severity. Other effects change or deploy resources and are not evaluated.
+var effectSeverity = map[string]protocol.Severity{
+	"deny":  protocol.SeverityHigh,
+	"audit": protocol.SeverityMedium,
+}
+
+var (
+	paramExprRe = regexp.MustCompile(`^\[parameters\('([^']+)'\)\]$`)
+	ruleIDRe    = regexp.MustCompile(`[^A-Z0-9]+`)
+)
+
+// Translate turns a definition into an analyzer rule, with params as the
+// assigned parameter values; unset parameters take their defaults. Fields
+// are matched against parsed resources by alias: the property path after
+// the resource type ("Microsoft.Storage/storageAccounts/minimumTlsVersion"
+// is min_tls_version). Definitions using count, field functions or effects
+// other than deny and audit are not supported.
+func Translate(d Definition, params map[string]interface{}) (analyzer.Rule, error) {
+	rule := d.Properties.PolicyRule
+	if rule == nil || rule.If == nil {
+		return analyzer.Rule{}, fmt.Errorf("no policy rule")
+	}
+	p, err := resolveParams(d.Properties.Parameters, params)
+	if err != nil {
+		return analyzer.Rule{}, err
+	}
+	effect, err := resolve(rule.Then.Effect, p)
+	if err != nil {
+		return analyzer.Rule{}, err
+	}
+	effectName, _ := effect.(string)
+	severity, ok := effectSeverity[strings.ToLower(effectName)]
+	if !ok {
+		return analyzer.Rule{}, fmt.Errorf("effect %v is not evaluated", effect)
+	}
+	c := &compiler{params: p}
+	cond, err := c.compile(rule.If)
+	if err != nil {
+		return analyzer.Rule{}, err
+	}
+
+	name := displayName(d)
+	var evidence []string
+	for _, f := range c.fields {
+		evidence = append(evidence, f.path())
+	}
+	check := func(res protocol.Resource) string {
+		t := target{armType: parser.ARMType(res.Type), props: res.Properties}
+		// Without a known ARM type, a type condition cannot be decided.
+		if c.usesType && t.armType == "" {
+			return ""
+		}
+		if !cond.eval(t) {
+			return ""
+		}
+		var facts []string
+		for _, f := range c.fields {
+			facts = append(facts, f.describe(t))
+		}
+		msg := fmt.Sprintf("Matches Azure Policy %q (effect: %s)", name, effectName)
+		if len(facts) > 0 {
+			msg += ": " + strings.Join(facts, ", ")
+		}
+		return msg
+	}
+	return analyzer.Rule{
+		ID:              ruleID(d.Name),
+		Category:        "Policy",
+		Severity:        severity,
+		Title:           name,
+		Description:     d.Properties.Description,
+		Remediation:     fmt.Sprintf("Change the resource to comply with Azure Policy %q", name),
+		ResourceCheckFn: check,
+		Evidence:        evidence,
+	}, nil
+}
+
+// ruleID derives a rule ID from a definition name, e.g.
+// "AZP-404C3081-A854-4457-AE30-26A93EF643F9" for a built-in.
+func ruleID(name string) string {
+	return "AZP-" + strings.Trim(ruleIDRe.ReplaceAllString(strings.ToUpper(name), "-"), "-")
+}
+
+// resolveParams fills declared parameters from given values, falling back
+// to defaults. Names are matched case-insensitively, as in Azure.
+func resolveParams(declared map[string]Parameter, given map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(declared))
+	for name, decl := range declared {
+		v, ok := lookupFold(given, name)
+		if !ok {
+			if decl.DefaultValue == nil {
+				return nil, fmt.Errorf("parameter %q has no value", name)
+			}
+			v = decl.DefaultValue
+		}
+		out[name] = v
+	}
+	return out, nil
+}
+
+// resolve evaluates the parameter references in a value. Other template
+// expressions are not supported; "[[" escapes a literal "[".
+func resolve(v interface{}, params map[string]interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		if strings.HasPrefix(v, "[[") {
+			return v[1:], nil
+		}
+		if !strings.HasPrefix(v, "[") || !strings.HasSuffix(v, "]") {
+			return v, nil
+		}
+		m := paramExprRe.FindStringSubmatch(v)
+		if m == nil {
+			return nil, fmt.Errorf("unsupported expression %s", v)
+		}
+		val, ok := lookupFold(params, m[1])
+		if !ok {
+			return nil, fmt.Errorf("undefined parameter %q", m[1])
+		}
+		return val, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			r, err := resolve(e, params)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+func lookupFold(m map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := m[key]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// target is what a condition is evaluated against.
+type target struct {
+	armType string
+	props   map[string]interface{}
+}
+
+type condition interface {
+	eval(t target) bool
+}
+
+type allOf []condition
+
+func (c allOf) eval(t target) bool {
+	for _, s := range c {
+		if !s.eval(t) {
+			return false
+		}
+	}
+	return true
+}
+
+type anyOf []condition
+
+func (c anyOf) eval(t target) bool {
+	for _, s := range c {
+		if s.eval(t) {
+			return true
+		}
+	}
+	return false
+}
+
+type not struct{ c condition }
+
+func (c not) eval(t target) bool { return !c.c.eval(t) }
+
+// constant is a value condition, decided once parameters are resolved.
+type constant bool
+
+func (c constant) eval(target) bool { return bool(c) }
+
+// fieldCondition tests a field against a value. A field with [*] holds when
+// every element passes, including when there are none.
+type fieldCondition struct {
+	field fieldRef
+	op    operator
+	want  interface{}
+}
+
+func (c fieldCondition) eval(t target) bool {
+	vals, each := c.field.values(t)
+	if !each {
+		return c.op.test(vals[0], c.want)
+	}
+	for _, v := range vals {
+		if !c.op.test(v, c.want) {
+			return false
+		}
+	}
+	return true
+}
+
+// compiler builds conditions, recording the fields they read.
+type compiler struct {
+	params   map[string]interface{}
+	fields   []fieldRef
+	usesType bool
+}
+
+func (c *compiler) compile(m map[string]interface{}) (condition, error) {
+	for _, key := range []string{"allOf", "anyOf"} {
+		raw, ok := m[key]
+		if !ok {
+			continue
+		}
+		list, ok := raw.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s must be a list", key)
+		}
+		var subs []condition
+		for _, e := range list {
+			sub, ok := e.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s must list conditions", key)
+			}
+			cond, err := c.compile(sub)
+			if err != nil {
+				return nil, err
+			}
+			subs = append(subs, cond)
+		}
+		if key == "allOf" {
+			return allOf(subs), nil
+		}
+		return anyOf(subs), nil
+	}
+	if raw, ok := m["not"]; ok {
+		sub, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("not must hold a condition")
+		}
+		cond, err := c.compile(sub)
+		if err != nil {
+			return nil, err
+		}
+		return not{cond}, nil
+	}
+	if _, ok := m["count"]; ok {
+		return nil, fmt.Errorf("count conditions are not supported")
+	}
+
+	op, want, err := c.operator(m)
+	if err != nil {
+		return nil, err
+	}
+	if raw, ok := m["value"]; ok {
+		v, err := resolve(raw, c.params)
+		if err != nil {
+			return nil, err
+		}
+		return constant(op.test(v, want)), nil
+	}
+	raw, ok := m["field"].(string)
+	if !ok {
+		return nil, fmt.Errorf("condition has no field or value")
+	}
+	f, err := parseField(raw)
+	if err != nil {
+		return nil, err
+	}
+	if f.kind == fieldType {
+		c.usesType = true
+	} else if !c.reads(f) {
+		c.fields = append(c.fields, f)
+	}
+	return fieldCondition{field: f, op: op, want: want}, nil
+}
+
+func (c *compiler) reads(f fieldRef) bool {
+	for _, g := range c.fields {
+		if g.path() == f.path() {
+			return true
+		}
+	}
+	return false
+}
+
+// operator finds a condition's single operator and resolves its operand.
+func (c *compiler) operator(m map[string]interface{}) (operator, interface{}, error) {
+	var found []string
+	for k := range m {
+		if k != "field" && k != "value" {
+			found = append(found, k)
+		}
+	}
+	if len(found) != 1 {
+		sort.Strings(found)
+		return operator{}, nil, fmt.Errorf("condition needs one operator, has %v", found)
+	}
+	op, ok := operators[strings.ToLower(found[0])]
+	if !ok {
+		return operator{}, nil, fmt.Errorf("unsupported operator %s", found[0])
+	}
+	want, err := resolve(m[found[0]], c.params)
+	if err != nil {
+		return operator{}, nil, err
+	}
+	switch op.name {
+	case "in":
+		if _, ok := want.([]interface{}); !ok {
+			return operator{}, nil, fmt.Errorf("%s needs a list", found[0])
+		}
+	case "exists":
+		b, err := strconv.ParseBool(fmt.Sprint(want))
+		if err != nil {
+			return operator{}, nil, fmt.Errorf("exists needs true or false")
+		}
+		want = b
+	case "match", "matchInsensitively":
+		want = matchPattern(fmt.Sprint(want), op.name == "matchInsensitively")
+	case "like":
+		want = likePattern(fmt.Sprint(want))
+	}
+	return op, want, nil
+}
+
+// operator is a condition operator; negated operators invert their base.
+type operator struct {
+	name   string
+	negate bool
+	fn     func(v, want interface{}) bool
+}
+
+// test applies the operator. A missing value (nil) fails every base
+// operator but exists, so its negations hold.
+func (o operator) test(v, want interface{}) bool {
+	return o.fn(v, want) != o.negate
+}
+
+var operators = map[string]operator{}
+
+func init() {
+	base := map[string]func(v, want interface{}) bool{
+		"equals": func(v, want interface{}) bool { return v != nil && equal(v, want) },
+		"in": func(v, want interface{}) bool {
+			for _, w := range want.([]interface{}) {
+				if v != nil && equal(v, w) {
+					return true
+				}
+			}
+			return false
+		},
+		"contains": func(v, want interface{}) bool {
+			switch v := v.(type) {
+			case nil:
+				return false
+			case []interface{}:
+				for _, e := range v {
+					if equal(e, want) {
+						return true
+					}
+				}
+				return false
+			}
+			return strings.Contains(strings.ToLower(fmt.Sprint(v)), strings.ToLower(fmt.Sprint(want)))
+		},
+		"containsKey": func(v, want interface{}) bool {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			_, found := lookupFold(m, fmt.Sprint(want))
+			return found
+		},
+		"like": func(v, want interface{}) bool {
+			return v != nil && want.(*regexp.Regexp).MatchString(fmt.Sprint(v))
+		},
+		"match": func(v, want interface{}) bool {
+			return v != nil && want.(*regexp.Regexp).MatchString(fmt.Sprint(v))
+		},
+		"exists":          func(v, want interface{}) bool { return (v != nil) == want.(bool) },
+		"less":            compareWith(func(c int) bool { return c < 0 }),
+		"lessOrEquals":    compareWith(func(c int) bool { return c <= 0 }),
+		"greater":         compareWith(func(c int) bool { return c > 0 }),
+		"greaterOrEquals": compareWith(func(c int) bool { return c >= 0 }),
+	}
+	base["matchInsensitively"] = base["match"]
+	negations := map[string]string{
+		"notEquals": "equals", "notIn": "in", "notContains": "contains", "notContainsKey": "containsKey",
+		"notLike": "like", "notMatch": "match", "notMatchInsensitively": "matchInsensitively",
+	}
+	for name, fn := range base {
+		operators[strings.ToLower(name)] = operator{name: name, fn: fn}
+	}
+	for name, of := range negations {
+		operators[strings.ToLower(name)] = operator{name: of, negate: true, fn: base[of]}
+	}
+}
+
+// equal compares as Azure Policy does: numbers by value, everything else
+// as case-insensitive strings, so true equals "true".
+func equal(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		if y, ok := number(b); ok {
+			return x == y
+		}
+	}
+	return strings.EqualFold(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func compareWith(ok func(int) bool) func(v, want interface{}) bool {
+	return func(v, want interface{}) bool {
+		if v == nil {
+			return false
+		}
+		if x, isNum := number(v); isNum {
+			if y, isNum := number(want); isNum {
+				switch {
+				case x < y:
+					return ok(-1)
+				case x > y:
+					return ok(1)
+				}
+				return ok(0)
+			}
+		}
+		return ok(strings.Compare(strings.ToLower(fmt.Sprint(v)), strings.ToLower(fmt.Sprint(want))))
+	}
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// likePattern compiles a like operand, where * matches anything.
+func likePattern(s string) *regexp.Regexp {
+	return regexp.MustCompile("(?is)^" + strings.ReplaceAll(regexp.QuoteMeta(s), `\*`, ".*") + "$")
+}
+
+// matchPattern compiles a match operand: # is a digit, ? a letter and . any
+// character.
+func matchPattern(s string, fold bool) *regexp.Regexp {
+	var sb strings.Builder
+	if fold {
+		sb.WriteString("(?i)")
+	}
+	sb.WriteString("^")
+	for _, r := range s {
+		switch r {
+		case '#':
+			sb.WriteString(`[0-9]`)
+		case '?':
+			sb.WriteString(`[a-zA-Z]`)
+		case '.':
+			sb.WriteString(`.`)
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
@@ -0,0 +1,123 @@
+// Package badge renders shields.io-style SVG status badges, so teams can
+// embed live governance status in READMEs and portals.
+package badge
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+)
+
+// Badge colors, from the shields.io palette.
+const (
+	ColorBrightGreen = "#4c1"
+	ColorGreen       = "#97ca00"
+	ColorYellow      = "#dfb317"
+	ColorOrange      = "#fe7d37"
+	ColorRed         = "#e05d44"
+	ColorBlue        = "#007ec6"
+	ColorGrey        = "#9f9f9f"
+)
+
+// Badge is a label and a message on a colored background.
+type Badge struct {
+	Label   string
+	Message string
+	Color   string
+}
+
+// Unknown is the badge for label when there is nothing to report yet.
+func Unknown(label string) Badge {
+	return Badge{Label: label, Message: "unknown", Color: ColorGrey}
+}
+
+// ScoreColor is the color of a 0–100 score: green from 90, red below 50.
+func ScoreColor(score int) string {
+	switch {
+	case score >= 90:
+		return ColorBrightGreen
+	case score >= 80:
+		return ColorGreen
+	case score >= 65:
+		return ColorYellow
+	case score >= 50:
+		return ColorOrange
+	}
+	return ColorRed
+}
+
+// CountColor is the color of a count of problems: green at zero, red
+// otherwise.
+func CountColor(n int) string {
+	if n == 0 {
+		return ColorBrightGreen
+	}
+	return ColorRed
+}
+
+// padding is the horizontal space around each half's text.
+const padding = 10
+
+// textWidth approximates the width of s in 11px Verdana, the shields.io
+// font, closely enough to size the badge.
+func textWidth(s string) int {
+	var w float64
+	for _, r := range s {
+		switch {
+		case r == ' ' || r == 'i' || r == 'l' || r == 'j' || r == '.' || r == ',' || r == ':' || r == '|' || r == '!' || r == '\'':
+			w += 3.5
+		case r == 'f' || r == 'r' || r == 't' || r == 'I' || r == '(' || r == ')' || r == '/' || r == '-':
+			w += 4.5
+		case r == 'm' || r == 'w' || r == 'M' || r == 'W' || r == '%':
+			w += 10.5
+		case r >= 'A' && r <= 'Z':
+			w += 7.5
+		default:
+			w += 6.8
+		}
+	}
+	return int(math.Ceil(w))
+}
+
+// svgTemplate is the flat shields.io layout: the label on grey and the
+// message on the badge color, with a text shadow. Coordinates in the text
+// are scaled by 10, as shields.io does, for sub-pixel placement.
+var svgTemplate = template.Must(template.New("badge").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{.Label}}: {{.Message}}">
+<title>{{.Label}}: {{.Message}}</title>
+<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="{{.Width}}" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="{{.LabelWidth}}" height="20" fill="#555"/><rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="20" fill="{{.Color}}"/><rect width="{{.Width}}" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" text-rendering="geometricPrecision" font-size="110">
+<text aria-hidden="true" x="{{.LabelX}}" y="150" fill="#010101" fill-opacity=".3" transform="scale(.1)" textLength="{{.LabelLength}}">{{.Label}}</text>
+<text x="{{.LabelX}}" y="140" transform="scale(.1)" textLength="{{.LabelLength}}">{{.Label}}</text>
+<text aria-hidden="true" x="{{.MessageX}}" y="150" fill="#010101" fill-opacity=".3" transform="scale(.1)" textLength="{{.MessageLength}}">{{.Message}}</text>
+<text x="{{.MessageX}}" y="140" transform="scale(.1)" textLength="{{.MessageLength}}">{{.Message}}</text>
+</g>
+</svg>
+`))
+
+// WriteSVG writes the badge as an SVG image.
+func (b Badge) WriteSVG(w io.Writer) error {
+	color := b.Color
+	if color == "" {
+		color = ColorGrey
+	}
+	lw, mw := textWidth(b.Label), textWidth(b.Message)
+	data := struct {
+		Label, Message, Color           string
+		Width, LabelWidth, MessageWidth int
+		LabelX, MessageX                int
+		LabelLength, MessageLength      int
+	}{
+		Label: b.Label, Message: b.Message, Color: color,
+		LabelWidth: lw + padding, MessageWidth: mw + padding,
+		LabelX: (lw + padding) * 5, MessageX: (lw+padding)*10 + (mw+padding)*5,
+		LabelLength: lw * 10, MessageLength: mw * 10,
+	}
+	data.Width = data.LabelWidth + data.MessageWidth
+	if err := svgTemplate.Execute(w, data); err != nil {
+		return fmt.Errorf("render badge: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package badge
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+func TestBadge_WriteSVG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (Badge{Label: "compliance", Message: "92% <ok>", Color: ColorGreen}).WriteSVG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	svg := buf.String()
+	if err := xml.Unmarshal(buf.Bytes(), new(struct{})); err != nil {
+		t.Fatalf("invalid SVG: %v\n%s", err, svg)
+	}
+	for _, want := range []string{`fill="#97ca00"`, "<title>compliance: 92% &lt;ok&gt;</title>", `aria-label="compliance: 92% &lt;ok&gt;"`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG missing %s:\n%s", want, svg)
+		}
+	}
+
+	short, long := textWidth("cost"), textWidth("critical findings")
+	if short <= 0 || long <= short {
+		t.Errorf("widths = %d, %d", short, long)
+	}
+}
+
+func TestColors(t *testing.T) {
+	tests := map[int]string{100: ColorBrightGreen, 85: ColorGreen, 70: ColorYellow, 55: ColorOrange, 10: ColorRed}
+	for score, want := range tests {
+		if got := ScoreColor(score); got != want {
+			t.Errorf("ScoreColor(%d) = %s, want %s", score, got, want)
+		}
+	}
+	if CountColor(0) != ColorBrightGreen || CountColor(3) != ColorRed {
+		t.Error("CountColor")
+	}
+	if b := Unknown("cost"); b.Message != "unknown" || b.Color != ColorGrey {
+		t.Errorf("Unknown = %+v", b)
+	}
+}
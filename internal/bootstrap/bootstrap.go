@@ -0,0 +1,306 @@
+// Package bootstrap proposes an initial module catalog and rule tuning for
+// an existing estate, from live resources exported with Azure Resource Graph
+// and the IaC already in the organization's repositories.
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// DefaultWarnThreshold is the failure rate above which a rule is proposed
+// to start as a warning rather than gating from day one.
+const DefaultWarnThreshold = analyzer.MassFailureRate
+
+// Repo is one repository's IaC files.
+type Repo struct {
+	Name  string
+	Files []protocol.SourceFile
+}
+
+// LoadResourceGraph reads an Azure Resource Graph export, either the
+// `az graph query` envelope ({"data": [...]}) or a bare array.
+func LoadResourceGraph(r io.Reader) ([]protocol.Resource, error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var rows []map[string]interface{}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		var envelope struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			return nil, fmt.Errorf("parse resource graph export: %w", err)
+		}
+		rows = envelope.Data
+	}
+	resources := make([]protocol.Resource, 0, len(rows))
+	for _, row := range rows {
+		resources = append(resources, parser.ParseARM(row))
+	}
+	return resources, nil
+}
+
+// Proposal is a suggested starting catalog and rule configuration.
+type Proposal struct {
+	Modules       []ModuleEntry  `json:"modules"`
+	ResourceTypes []TypeEntry    `json:"resource_types"`
+	Rules         []RuleTuning   `json:"rules"`
+	Sources       ProposalSource `json:"sources"`
+}
+
+// ProposalSource records what the proposal was built from.
+type ProposalSource struct {
+	LiveResources     int `json:"live_resources"`
+	Repos             int `json:"repos"`
+	DeclaredResources int `json:"declared_resources"`
+}
+
+// ModuleEntry is a module source already in use, proposed for the registry.
+type ModuleEntry struct {
+	Source   string   `json:"source"`
+	Versions []string `json:"versions,omitempty"`
+	Uses     int      `json:"uses"`
+	Repos    []string `json:"repos"`
+	// Unpinned counts uses without a version constraint.
+	Unpinned int `json:"unpinned"`
+}
+
+// TypeEntry counts a resource type across the estate. Unmanaged is the
+// number of live instances beyond those declared in IaC; types with many
+// unmanaged instances are candidates for a new catalog module.
+type TypeEntry struct {
+	Type      string `json:"type"`
+	Live      int    `json:"live"`
+	Declared  int    `json:"declared"`
+	Unmanaged int    `json:"unmanaged"`
+}
+
+// RuleTuning is the proposed starting configuration for one rule.
+type RuleTuning struct {
+	RuleID    string            `json:"rule_id"`
+	Title     string            `json:"title"`
+	Severity  protocol.Severity `json:"severity"`
+	Evaluated int               `json:"evaluated"`
+	Failed    int               `json:"failed"`
+	FailRate  float64           `json:"fail_rate"`
+	// Suggested is the proposed starting severity; it equals Severity when
+	// no change is proposed.
+	Suggested protocol.Severity `json:"suggested"`
+	Reason    string            `json:"reason"`
+}
+
+// Propose evaluates rules against the live and declared resources and
+// summarizes module and resource type usage. Rules failing on at least
+// warnThreshold of the resources they apply to are proposed as low-severity
+// warnings, so onboarding doesn't start with every deploy blocked.
+func Propose(live []protocol.Resource, repos []Repo, rules []analyzer.Rule, warnThreshold float64) Proposal {
+	p := Proposal{Sources: ProposalSource{LiveResources: len(live), Repos: len(repos)}}
+
+	types := make(map[string]*TypeEntry)
+	typeEntry := func(t string) *TypeEntry {
+		if types[t] == nil {
+			types[t] = &TypeEntry{Type: t}
+		}
+		return types[t]
+	}
+	for _, res := range live {
+		typeEntry(res.Type).Live++
+	}
+
+	modules := make(map[string]*ModuleEntry)
+	resources := append([]protocol.Resource(nil), live...)
+	for _, r := range repos {
+		for _, f := range r.Files {
+			declared := parser.ParseResources(f.Content)
+			for _, res := range declared {
+				typeEntry(res.Type).Declared++
+			}
+			resources = append(resources, declared...)
+			p.Sources.DeclaredResources += len(declared)
+
+			for _, use := range moduleUses(f.Content) {
+				m := modules[use.source]
+				if m == nil {
+					m = &ModuleEntry{Source: use.source}
+					modules[use.source] = m
+				}
+				m.Uses++
+				if use.version == "" {
+					m.Unpinned++
+				} else {
+					m.Versions = appendUnique(m.Versions, use.version)
+				}
+				m.Repos = appendUnique(m.Repos, r.Name)
+			}
+		}
+	}
+
+	for _, m := range modules {
+		sort.Strings(m.Versions)
+		sort.Strings(m.Repos)
+		p.Modules = append(p.Modules, *m)
+	}
+	sort.Slice(p.Modules, func(i, j int) bool {
+		if p.Modules[i].Uses != p.Modules[j].Uses {
+			return p.Modules[i].Uses > p.Modules[j].Uses
+		}
+		return p.Modules[i].Source < p.Modules[j].Source
+	})
+
+	for _, t := range types {
+		if t.Live > t.Declared {
+			t.Unmanaged = t.Live - t.Declared
+		}
+		p.ResourceTypes = append(p.ResourceTypes, *t)
+	}
+	sort.Slice(p.ResourceTypes, func(i, j int) bool {
+		a, b := p.ResourceTypes[i], p.ResourceTypes[j]
+		if a.Live+a.Declared != b.Live+b.Declared {
+			return a.Live+a.Declared > b.Live+b.Declared
+		}
+		return a.Type < b.Type
+	})
+
+	p.Rules = tuneRules(rules, resources, warnThreshold)
+	return p
+}
+
+func tuneRules(rules []analyzer.Rule, resources []protocol.Resource, warnThreshold float64) []RuleTuning {
+	byID := make(map[string]*RuleTuning, len(rules))
+	out := make([]RuleTuning, len(rules))
+	for i, r := range rules {
+		out[i] = RuleTuning{RuleID: r.ID, Title: r.Title, Severity: r.Severity, Suggested: r.Severity}
+		byID[r.ID] = &out[i]
+	}
+	for _, c := range analyzer.Controls(rules, resources) {
+		t := byID[c.Rule.ID]
+		t.Evaluated++
+		if !c.Passed {
+			t.Failed++
+		}
+	}
+	for i := range out {
+		t := &out[i]
+		if t.Evaluated == 0 {
+			t.Reason = "No matching resources yet"
+			continue
+		}
+		t.FailRate = float64(t.Failed) / float64(t.Evaluated)
+		if t.FailRate >= warnThreshold && t.Severity.AtLeast(protocol.SeverityMedium) {
+			t.Suggested = protocol.SeverityLow
+			t.Reason = fmt.Sprintf("Fails on %d of %d resources; start as a warning and tighten once remediated", t.Failed, t.Evaluated)
+		} else {
+			t.Reason = fmt.Sprintf("Fails on %d of %d resources", t.Failed, t.Evaluated)
+		}
+	}
+	return out
+}
+
+// Markdown renders the proposal for review in an onboarding PR or issue.
+func (p Proposal) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString("## Catalog Bootstrap Proposal\n\n")
+	sb.WriteString(fmt.Sprintf("Built from %d live resource(s) and %d declared resource(s) across %d repo(s).\n\n",
+		p.Sources.LiveResources, p.Sources.DeclaredResources, p.Sources.Repos))
+
+	sb.WriteString("### Module Catalog\n\n")
+	if len(p.Modules) == 0 {
+		sb.WriteString("No module references found.\n\n")
+	} else {
+		sb.WriteString("| Source | Versions | Uses | Repos | Unpinned |\n")
+		sb.WriteString("|--------|----------|------|-------|----------|\n")
+		for _, m := range p.Modules {
+			versions := strings.Join(m.Versions, ", ")
+			if versions == "" {
+				versions = "—"
+			}
+			sb.WriteString(fmt.Sprintf("| `%s` | %s | %d | %s | %d |\n",
+				m.Source, versions, m.Uses, strings.Join(m.Repos, ", "), m.Unpinned))
+		}
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("### Resource Types\n\n")
+	sb.WriteString("| Type | Live | Declared | Unmanaged |\n")
+	sb.WriteString("|------|------|----------|-----------|\n")
+	for _, t := range p.ResourceTypes {
+		sb.WriteString(fmt.Sprintf("| %s | %d | %d | %d |\n", parser.ShortType(t.Type), t.Live, t.Declared, t.Unmanaged))
+	}
+
+	sb.WriteString("\n### Rule Tuning\n\n")
+	sb.WriteString("| Rule | Severity | Failing | Start As | Reason |\n")
+	sb.WriteString("|------|----------|---------|----------|--------|\n")
+	for _, r := range p.Rules {
+		failing := "—"
+		if r.Evaluated > 0 {
+			failing = fmt.Sprintf("%.0f%%", r.FailRate*100)
+		}
+		start := string(r.Suggested)
+		if r.Suggested != r.Severity {
+			start = fmt.Sprintf("**%s**", r.Suggested)
+		}
+		sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s |\n", r.RuleID, r.Severity, failing, start, r.Reason))
+	}
+	return sb.String()
+}
+
+var (
+	tfModuleRe      = regexp.MustCompile(`(?s)module\s+"[\w-]+"\s*\{(.*?)\n\}`)
+	tfSourceRe      = regexp.MustCompile(`(?m)^\s*source\s*=\s*"([^"]+)"`)
+	tfVersionRe     = regexp.MustCompile(`(?m)^\s*version\s*=\s*"([^"]+)"`)
+	tfRefQueryRe    = regexp.MustCompile(`\?ref=([^&"]+)`)
+	bicepModuleRe   = regexp.MustCompile(`module\s+\w+\s+'([^']+)'`)
+	bicepRegistryRe = regexp.MustCompile(`^(br[:/].+):([^:/]+)$`)
+)
+
+type moduleUse struct {
+	source  string
+	version string
+}
+
+// moduleUses extracts Terraform module blocks and Bicep module declarations.
+// Git sources pinned with ?ref= and Bicep registry tags count as versions.
+func moduleUses(code string) []moduleUse {
+	var uses []moduleUse
+	for _, m := range tfModuleRe.FindAllStringSubmatch(code, -1) {
+		src := tfSourceRe.FindStringSubmatch(m[1])
+		if src == nil {
+			continue
+		}
+		use := moduleUse{source: src[1]}
+		if v := tfVersionRe.FindStringSubmatch(m[1]); v != nil {
+			use.version = v[1]
+		} else if ref := tfRefQueryRe.FindStringSubmatch(use.source); ref != nil {
+			use.version = ref[1]
+			use.source = strings.TrimSuffix(use.source[:strings.Index(use.source, "?")], "/")
+		}
+		uses = append(uses, use)
+	}
+	for _, m := range bicepModuleRe.FindAllStringSubmatch(code, -1) {
+		use := moduleUse{source: m[1]}
+		if reg := bicepRegistryRe.FindStringSubmatch(m[1]); reg != nil {
+			use.source, use.version = reg[1], reg[2]
+		}
+		uses = append(uses, use)
+	}
+	return uses
+}
+
+func appendUnique(list []string, v string) []string {
+	for _, s := range list {
+		if s == v {
+			return list
+		}
+	}
+	return append(list, v)
+}
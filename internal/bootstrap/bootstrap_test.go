@@ -0,0 +1,83 @@
+package bootstrap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+const graphExport = `{"count": 2, "data": [
+  {"id": "/subscriptions/0000/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/logs",
+   "name": "logs", "type": "microsoft.storage/storageaccounts",
+   "properties": {"supportsHttpsTrafficOnly": true, "minimumTlsVersion": "TLS1_0"}},
+  {"id": "/subscriptions/0000/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/data",
+   "name": "data", "type": "microsoft.storage/storageaccounts",
+   "properties": {"supportsHttpsTrafficOnly": true, "minimumTlsVersion": "TLS1_0"}}
+]}`
+
+const infraTF = `module "network" {
+  source  = "app.terraform.io/org/network/azurerm"
+  version = "2.1.0"
+}
+
+module "legacy" {
+  source = "git::https://github.com/org/modules.git//storage?ref=v1.4.0"
+}
+
+resource "azurerm_storage_account" "app" {
+  name                      = "appsa"
+  enable_https_traffic_only = true
+  min_tls_version           = "TLS1_0"
+}
+`
+
+func TestPropose(t *testing.T) {
+	live, err := LoadResourceGraph(strings.NewReader(graphExport))
+	if err != nil {
+		t.Fatalf("LoadResourceGraph: %v", err)
+	}
+	repos := []Repo{
+		{Name: "org/infra@main", Files: []protocol.SourceFile{{Path: "main.tf", Content: infraTF}}},
+		{Name: "org/app@main", Files: []protocol.SourceFile{{Path: "main.bicep", Content: "module net 'br/public:avm/res/network/virtual-network:0.5.1' = {\n}\n"}}},
+	}
+	p := Propose(live, repos, analyzer.RulesByCategory("Policy"), DefaultWarnThreshold)
+
+	if p.Sources.LiveResources != 2 || p.Sources.DeclaredResources != 1 {
+		t.Errorf("sources = %+v", p.Sources)
+	}
+	modules := make(map[string]ModuleEntry)
+	for _, m := range p.Modules {
+		modules[m.Source] = m
+	}
+	if m := modules["git::https://github.com/org/modules.git//storage"]; len(m.Versions) != 1 || m.Versions[0] != "v1.4.0" {
+		t.Errorf("git module = %+v, want ?ref= pin as version", m)
+	}
+	if m := modules["br/public:avm/res/network/virtual-network"]; m.Versions[0] != "0.5.1" {
+		t.Errorf("bicep module = %+v, want registry tag as version", m)
+	}
+
+	if len(p.ResourceTypes) != 1 || p.ResourceTypes[0].Unmanaged != 1 {
+		t.Errorf("resource types = %+v, want one storage type with 1 unmanaged", p.ResourceTypes)
+	}
+
+	tuning := make(map[string]RuleTuning)
+	for _, r := range p.Rules {
+		tuning[r.RuleID] = r
+	}
+	// POL-003 (min TLS) fails on all three storage accounts.
+	if r := tuning["POL-003"]; r.Failed != 3 || r.Suggested != protocol.SeverityLow {
+		t.Errorf("POL-003 = %+v, want 3 failures and a warning start", r)
+	}
+	// POL-001 (HTTPS) passes everywhere and keeps its severity.
+	if r := tuning["POL-001"]; r.Failed != 0 || r.Suggested != r.Severity {
+		t.Errorf("POL-001 = %+v, want unchanged", r)
+	}
+	if r := tuning["POL-002"]; r.Evaluated != 0 {
+		t.Errorf("POL-002 = %+v, want no AKS clusters evaluated", r)
+	}
+	if md := p.Markdown(); !strings.Contains(md, "| POL-003 | medium | 100% | **low** |") {
+		t.Errorf("markdown missing POL-003 tuning row:\n%s", md)
+	}
+}
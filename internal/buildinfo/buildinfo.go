@@ -0,0 +1,96 @@
+// Package buildinfo holds the version stamped into the binaries at build
+// time, so every host in the fleet can report exactly what it is running.
+//
+// The release targets set the variables with -ldflags, e.g.
+//
+//	-X github.com/ghcp-iac/ghcp-iac-workflow/internal/buildinfo.Version=v1.4.0
+//
+// Builds without them fall back to the VCS revision the Go toolchain
+// records when building from a git checkout.
+package buildinfo
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time.
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildTime = "unknown"
+)
+
+// Info describes a running binary.
+type Info struct {
+	Service   string `json:"service"`
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	// Platform is the binary's GOOS/GOARCH, e.g. "linux/arm64".
+	Platform string `json:"platform"`
+	// Modified is set when the binary was built from a checkout with
+	// uncommitted changes and the commit came from VCS metadata.
+	Modified bool `json:"modified,omitempty"`
+}
+
+// Get returns the build info of the running binary for service.
+func Get(service string) Info {
+	info := Info{
+		Service:   service,
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		fromVCS(&info, bi.Settings)
+	}
+	return info
+}
+
+// fromVCS fills the commit and build time the linker flags left unset from
+// the toolchain's VCS settings.
+func fromVCS(info *Info, settings []debug.BuildSetting) {
+	if info.Commit != "unknown" {
+		return
+	}
+	for _, s := range settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Commit = s.Value
+			if len(info.Commit) > 12 {
+				info.Commit = info.Commit[:12]
+			}
+		case "vcs.time":
+			if info.BuildTime == "unknown" {
+				info.BuildTime = s.Value
+			}
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+}
+
+// String renders the info on one line, for logs and --version output.
+func (i Info) String() string {
+	s := fmt.Sprintf("%s %s (commit %s, built %s, %s, %s)", i.Service, i.Version, i.Commit, i.BuildTime, i.GoVersion, i.Platform)
+	if i.Modified {
+		s += " modified"
+	}
+	return s
+}
+
+// Handler serves the build info of service as JSON.
+func Handler(service string) http.HandlerFunc {
+	info := Get(service)
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(info)
+	}
+}
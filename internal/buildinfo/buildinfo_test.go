@@ -0,0 +1,43 @@
+package buildinfo
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestFromVCS(t *testing.T) {
+	settings := []debug.BuildSetting{
+		{Key: "vcs.revision", Value: "0123456789abcdef0123"},
+		{Key: "vcs.time", Value: "2026-10-01T12:00:00Z"},
+		{Key: "vcs.modified", Value: "true"},
+	}
+	info := Info{Commit: "unknown", BuildTime: "unknown"}
+	fromVCS(&info, settings)
+	if info.Commit != "0123456789ab" || info.BuildTime != "2026-10-01T12:00:00Z" || !info.Modified {
+		t.Errorf("info = %+v", info)
+	}
+
+	stamped := Info{Commit: "feedbee", BuildTime: "2026-10-02T08:00:00Z"}
+	fromVCS(&stamped, settings)
+	if stamped.Commit != "feedbee" || stamped.Modified {
+		t.Errorf("linker-stamped info overridden: %+v", stamped)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	rr := httptest.NewRecorder()
+	Handler("ghcp-iac-agent-host")(rr, httptest.NewRequest("GET", "/version", nil))
+	var info Info
+	if err := json.NewDecoder(rr.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Service != "ghcp-iac-agent-host" || info.Version != Version || info.GoVersion == "" || !strings.Contains(info.Platform, "/") {
+		t.Errorf("info = %+v", info)
+	}
+	if !strings.HasPrefix(info.String(), "ghcp-iac-agent-host "+Version+" (commit ") {
+		t.Errorf("String() = %q", info.String())
+	}
+}
@@ -4,10 +4,13 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 )
 
 // Environment represents the deployment environment.
@@ -26,6 +29,16 @@ type Config struct {
 	Environment Environment `json:"environment"`
 	LogLevel    string      `json:"log_level"`
 
+	// Network restrictions: ListenAddr overrides Port, e.g. a
+	// "unix:/run/ghcp/agent.sock" socket for sidecar deployments
+	ListenAddr     string   `json:"listen_addr"`
+	IPAllowlist    []string `json:"ip_allowlist"`
+	TrustedProxies []string `json:"trusted_proxies"`
+	// AdminAddr, when set, serves the mutating routes (rule packs,
+	// promotions, replays) on a separate listener; the main listener then
+	// serves read-only analysis only
+	AdminAddr string `json:"admin_addr"`
+
 	// Auth
 	WebhookSecret string `json:"-"` // never serialize
 
@@ -40,6 +53,10 @@ type Config struct {
 	// Request body size limit (DoS protection)
 	MaxBodySize int64 `json:"max_body_size"`
 
+	// How long responses to requests carrying an Idempotency-Key are kept
+	// for retries; 0 disables idempotency keys
+	IdempotencyTTL time.Duration `json:"idempotency_ttl"`
+
 	// LLM / GitHub Models
 	ModelName      string        `json:"model_name"`
 	ModelEndpoint  string        `json:"model_endpoint"`
@@ -51,14 +68,202 @@ type Config struct {
 	AzureTenantID       string `json:"azure_tenant_id"`
 	AzureClientID       string `json:"-"`
 	AzureClientSecret   string `json:"-"`
+	// Service account token file for AKS workload identity
+	AzureFederatedTokenFile string `json:"azure_federated_token_file"`
 
 	// Notifications
 	TeamsWebhookURL string `json:"-"`
 	SlackWebhookURL string `json:"-"`
+	NotifyChannels  string `json:"-"` // name=kind:url entries embed webhook credentials
+	// JSON file with per-channel signing secrets, headers and retry policy
+	NotifyWebhookConfig string `json:"notify_webhook_config"`
+	// Messages per second sent to each channel, and how many a burst may
+	// coalesce into one
+	NotifyRateLimit float64 `json:"notify_rate_limit"`
+	NotifyBatchMax  int     `json:"notify_batch_max"`
+
+	// Per-channel locale/timezone (name=locale@zone) with platform defaults
+	NotifyLocales         string `json:"notify_locales"`
+	NotifyDefaultLocale   string `json:"notify_default_locale"`
+	NotifyDefaultTimeZone string `json:"notify_default_time_zone"`
+
+	// Email channels via Microsoft Graph sendMail, authenticated with the
+	// AZURE_* client credentials or a managed identity
+	NotifyEmailSender   string `json:"notify_email_sender"`
+	NotifyEmailTemplate string `json:"notify_email_template"`
+	GraphAPIURL         string `json:"graph_api_url"`
+	AzureAuthorityHost  string `json:"azure_authority_host"`
+
+	// Scheduled cost forecast
+	CostReportRepos   []string `json:"cost_report_repos"`
+	CostReportChannel string   `json:"cost_report_channel"`
+	ReportBaseURL     string   `json:"report_base_url"`
+	GitHubAPIURL      string   `json:"github_api_url"`
+	GitHubToken       string   `json:"-"`
+
+	// Live VM prices for sizes missing from the cost agent's tables
+	PriceAPIURL          string        `json:"price_api_url"`
+	PriceCacheFile       string        `json:"price_cache_file"`
+	PriceCacheTTL        time.Duration `json:"price_cache_ttl"`
+	PriceRefreshInterval time.Duration `json:"price_refresh_interval"`
+	// ISO 4217 currency cost estimates are reported in by default
+	Currency string `json:"currency"`
+	// Locale cost amounts are written in by default, e.g. "de-DE"
+	Locale string `json:"locale"`
+	// Monthly budget in USD cost estimates are checked against; 0 disables
+	CostBudgetMonthly float64 `json:"cost_budget_monthly"`
+	// Reserved capacity estimates are netted against, e.g. "sql_vcore:GP=8"
+	CostReservations string `json:"cost_reservations"`
+
+	// Azure Policy definitions, initiatives and assignments (a JSON file or
+	// directory) the policy agent evaluates alongside its own rules
+	AzurePolicyDefinitions string `json:"azure_policy_definitions"`
+	// Subscriptions whose assigned policies are fetched from Azure, and how
+	// long they are cached
+	AzurePolicySubscriptions []string      `json:"azure_policy_subscriptions"`
+	AzurePolicyCacheTTL      time.Duration `json:"azure_policy_cache_ttl"`
+	// Accepted-risk waivers the policy agent applies
+	PolicyWaiversFile string `json:"policy_waivers_file"`
+	// Findings the security agent no longer reports, recorded when a
+	// codebase adopted scanning
+	SecurityBaselineFile string `json:"security_baseline_file"`
+	// Extra security rule catalog files, e.g. written by cmd/import-rules
+	SecurityRuleFiles []string `json:"security_rule_files"`
+	// Compliance frameworks audited when a request selects none; all when
+	// empty
+	ComplianceFrameworks []string `json:"compliance_frameworks"`
+	// Where chat triage of findings (snoozes, assignments, false
+	// positives) is persisted; empty keeps it in memory
+	TriageStateFile string `json:"triage_state_file"`
+	// Where the score of every compliance audit is appended as JSON Lines
+	// for GET /trends; empty keeps history in memory
+	TrendsFile string `json:"trends_file"`
+	// Where governance exception requests made in chat are persisted;
+	// empty keeps them in memory
+	ExceptionsFile string `json:"exceptions_file"`
+	// Repository ("owner/name") exception request issues are opened in;
+	// the request's own repository when empty
+	ExceptionsIssueRepo string `json:"exceptions_issue_repo"`
+	// Risk profile the impact agent weighs changes with, saved by
+	// PUT /risk-profile; empty uses the built-in weights, kept in memory
+	RiskProfileFile string `json:"risk_profile_file"`
+
+	// Gateway
+	GatewayUpstream    string   `json:"gateway_upstream"`
+	GatewayRoutes      string   `json:"gateway_routes"`
+	RateLimitRPS       float64  `json:"rate_limit_rps"`
+	RateLimitBurst     int      `json:"rate_limit_burst"`
+	CORSAllowedOrigins []string `json:"cors_allowed_origins"`
+
+	// External scanners (tfsec, checkov, trivy) run when installed
+	ExternalScanners []string `json:"external_scanners"`
+
+	// Vulnerability advisories for provider and module versions: "osv"
+	// and/or paths to OSV-format feed files
+	AdvisoryFeeds           []string      `json:"advisory_feeds"`
+	OSVAPIURL               string        `json:"osv_api_url"`
+	AdvisoryCacheTTL        time.Duration `json:"advisory_cache_ttl"`
+	AdvisoryRefreshInterval time.Duration `json:"advisory_refresh_interval"`
+
+	// Severity-to-action overrides, e.g. "high=require_approval,medium=notify"
+	SeverityActions string `json:"severity_actions"`
+	// Minimum finding counts before a severity's action applies, e.g.
+	// "medium=5"
+	SeverityThresholds string `json:"severity_thresholds"`
+	// Further conditions for a workflow's go decision: the minimum overall
+	// compliance score and the largest monthly cost increase; 0 disables
+	VerdictMinCompliance int     `json:"verdict_min_compliance"`
+	VerdictMaxCostDelta  float64 `json:"verdict_max_cost_delta"`
+	// Shared-severity overrides for external systems, e.g. "medium=error"
+	SARIFLevels         string `json:"sarif_levels"`
+	PagerDutySeverities string `json:"pagerduty_severities"`
+
+	// Live DNS / certificate checks for declared custom domains
+	CertExpiryWindow time.Duration `json:"cert_expiry_window"`
+
+	// Compute quota gate for promotions; resources without a literal
+	// location are checked in QuotaDefaultLocation
+	QuotaDefaultLocation string `json:"quota_default_location"`
+
+	// Drift re-scans after production promotions
+	DriftLockChecks   []time.Duration `json:"drift_lock_checks"`
+	DriftAlertChannel string          `json:"drift_alert_channel"`
+	// Properties drift detection never compares, on top of computed ones
+	// like etag, and "pattern=severity" overrides of drift severities
+	DriftIgnore     []string `json:"drift_ignore"`
+	DriftSeverities string   `json:"drift_severities"`
+	// Drift scans alert DriftAlertChannel when they find drift at or
+	// above this severity; "off" disables
+	DriftNotifySeverity string `json:"drift_notify_severity"`
+
+	// JSON file of the promotion pipeline's environments, their order,
+	// promotion paths and approval rules; changes made through
+	// /environments are saved to it. Empty keeps dev -> staging -> prod
+	DeployEnvironmentsFile string `json:"deploy_environments_file"`
+	// Change freezes that block promotions, e.g. "prod:2026-12-20..2027-01-02"
+	DeployFreezeWindows string `json:"deploy_freeze_windows"`
+	// Weekly windows changes must fit, e.g. "prod:sat 22:00-04:00"
+	DeployChangeWindows string `json:"deploy_change_windows"`
+	// Agent checks every promotion must pass, e.g.
+	// "security=critical,prod:compliance=90,cost_delta=10%"
+	DeployGates string `json:"deploy_gates"`
+	// Logins that must approve promotions into an environment, e.g.
+	// "prod:alice,prod:bob"; any one approval will do for the others
+	DeployApprovers string `json:"deploy_approvers"`
+	// Where promotion approval requests are persisted; empty keeps them
+	// in memory
+	ApprovalsFile string `json:"approvals_file"`
+	// Channel approvers are notified on of new and resolved requests
+	ApprovalNotifyChannel string `json:"approval_notify_channel"`
+
+	// Approved modules golden stacks are composed from (JSON file)
+	ModuleCatalog string `json:"module_catalog"`
+	// Where the module calls of every scanned request are appended as JSON
+	// Lines for GET /modules/usage; empty keeps them in memory
+	ModuleUsageFile string `json:"module_usage_file"`
+
+	// Directory of plugin manifests (*.json) for custom agents
+	PluginDir string `json:"plugin_dir"`
+
+	// Agent fleet service level objectives
+	SLOObjectives    string        `json:"slo_objectives"`
+	SLOWindow        time.Duration `json:"slo_window"`
+	SLOProbeInterval time.Duration `json:"slo_probe_interval"`
+	SLOProbeAgents   []string      `json:"slo_probe_agents"`
+	SLOAlertChannel  string        `json:"slo_alert_channel"`
+
+	// Channel notified when an orchestrated workflow completes
+	WorkflowNotifyChannel string `json:"workflow_notify_channel"`
+
+	// Remote agent hosts that rule pack rollouts push to besides this one
+	RulePackTargets []string `json:"rule_pack_targets"`
+
+	// Read-only report share links
+	ShareLinkTTL time.Duration `json:"share_link_ttl"`
+	ShareBaseURL string        `json:"share_base_url"`
+
+	// Report retention: full reports, then their summaries, optionally
+	// archived to an Azure Blob container first
+	ReportRetention         time.Duration `json:"report_retention"`
+	ReportSummaryRetention  time.Duration `json:"report_summary_retention"`
+	ReportArchiveURL        string        `json:"-"`
+	ReportRetentionInterval time.Duration `json:"report_retention_interval"`
 
 	// Feature flags
 	EnableLLM           bool `json:"enable_llm"`
 	EnableNotifications bool `json:"enable_notifications"`
+	EnableTelemetry     bool `json:"enable_telemetry"`
+	EnableEndpointCheck bool `json:"enable_endpoint_checks"`
+	EnableQuotaCheck    bool `json:"enable_quota_checks"`
+	// EnableLiveDependents adds deployed Azure resources that refer to
+	// changed ones, found with Resource Graph, to impact analysis.
+	EnableLiveDependents bool `json:"enable_live_dependents"`
+	// EnableLiveInventory reports deployed Azure resources in the scope
+	// the IaC targets, but not declared in it, in drift detection.
+	EnableLiveInventory bool `json:"enable_live_inventory"`
+	EnableCostAPI       bool `json:"enable_cost_api"`
+	// WarmUp runs the agents over a sample configuration before serving.
+	WarmUp bool `json:"warm_up"`
 }
 
 // Load reads configuration from environment variables with defaults.
@@ -73,6 +278,11 @@ func Load() *Config {
 		Environment: env,
 		LogLevel:    getEnv("LOG_LEVEL", logLevelForEnv(env)),
 
+		ListenAddr:     os.Getenv("LISTEN_ADDR"),
+		IPAllowlist:    getListEnv("IP_ALLOWLIST"),
+		TrustedProxies: getListEnv("TRUSTED_PROXIES"),
+		AdminAddr:      os.Getenv("ADMIN_ADDR"),
+
 		WebhookSecret: os.Getenv("GITHUB_WEBHOOK_SECRET"),
 
 		// HTTP Server timeouts
@@ -82,21 +292,133 @@ func Load() *Config {
 		AgentTimeout: getDurationEnv("AGENT_TIMEOUT", 90*time.Second),
 		MaxBodySize:  getInt64Env("MAX_BODY_SIZE", 1<<20), // 1MB default
 
+		IdempotencyTTL: getDurationEnv("IDEMPOTENCY_TTL", 24*time.Hour),
+
 		ModelName:      getEnv("MODEL_NAME", modelForEnv(env)),
 		ModelEndpoint:  getEnv("MODEL_ENDPOINT", "https://models.inference.ai.azure.com"),
 		ModelTimeout:   getDurationEnv("MODEL_TIMEOUT", 30*time.Second),
 		ModelMaxTokens: getIntEnv("MODEL_MAX_TOKENS", 4096),
 
-		AzureSubscriptionID: os.Getenv("AZURE_SUBSCRIPTION_ID"),
-		AzureTenantID:       os.Getenv("AZURE_TENANT_ID"),
-		AzureClientID:       os.Getenv("AZURE_CLIENT_ID"),
-		AzureClientSecret:   os.Getenv("AZURE_CLIENT_SECRET"),
+		AzureSubscriptionID:     os.Getenv("AZURE_SUBSCRIPTION_ID"),
+		AzureTenantID:           os.Getenv("AZURE_TENANT_ID"),
+		AzureClientID:           os.Getenv("AZURE_CLIENT_ID"),
+		AzureClientSecret:       os.Getenv("AZURE_CLIENT_SECRET"),
+		AzureFederatedTokenFile: os.Getenv("AZURE_FEDERATED_TOKEN_FILE"),
+
+		TeamsWebhookURL:     os.Getenv("TEAMS_WEBHOOK_URL"),
+		SlackWebhookURL:     os.Getenv("SLACK_WEBHOOK_URL"),
+		NotifyChannels:      os.Getenv("NOTIFY_CHANNELS"),
+		NotifyWebhookConfig: os.Getenv("NOTIFY_WEBHOOK_CONFIG"),
+		NotifyRateLimit:     getFloatEnv("NOTIFY_RATE_LIMIT", 1),
+		NotifyBatchMax:      getIntEnv("NOTIFY_BATCH_MAX", 20),
+
+		NotifyLocales:         os.Getenv("NOTIFY_LOCALES"),
+		NotifyDefaultLocale:   getEnv("NOTIFY_DEFAULT_LOCALE", "en-US"),
+		NotifyDefaultTimeZone: getEnv("NOTIFY_DEFAULT_TIMEZONE", "UTC"),
+
+		NotifyEmailSender:   os.Getenv("NOTIFY_EMAIL_SENDER"),
+		NotifyEmailTemplate: os.Getenv("NOTIFY_EMAIL_TEMPLATE"),
+		GraphAPIURL:         getEnv("GRAPH_API_URL", "https://graph.microsoft.com"),
+		AzureAuthorityHost:  getEnv("AZURE_AUTHORITY_HOST", "https://login.microsoftonline.com"),
+
+		CostReportRepos:   getListEnv("COST_REPORT_REPOS"),
+		CostReportChannel: getEnv("COST_REPORT_CHANNEL", "finance"),
+		ReportBaseURL:     os.Getenv("REPORT_BASE_URL"),
+		GitHubAPIURL:      getEnv("GITHUB_API_URL", "https://api.github.com"),
+		GitHubToken:       os.Getenv("GITHUB_TOKEN"),
+
+		PriceAPIURL:          getEnv("PRICE_API_URL", "https://prices.azure.com/api/retail/prices"),
+		PriceCacheFile:       os.Getenv("PRICE_CACHE_FILE"),
+		PriceCacheTTL:        getDurationEnv("PRICE_CACHE_TTL", 24*time.Hour),
+		PriceRefreshInterval: getDurationEnv("PRICE_REFRESH_INTERVAL", 6*time.Hour),
+		Currency:             getEnv("CURRENCY", "USD"),
+		Locale:               getEnv("LOCALE", "en-US"),
+		CostBudgetMonthly:    getFloatEnv("COST_BUDGET_MONTHLY", 0),
+		CostReservations:     os.Getenv("COST_RESERVATIONS"),
+
+		AzurePolicyDefinitions:   os.Getenv("AZURE_POLICY_DEFINITIONS"),
+		AzurePolicySubscriptions: getListEnv("AZURE_POLICY_SUBSCRIPTIONS"),
+		AzurePolicyCacheTTL:      getDurationEnv("AZURE_POLICY_CACHE_TTL", time.Hour),
+		PolicyWaiversFile:        os.Getenv("POLICY_WAIVERS_FILE"),
+		SecurityBaselineFile:     os.Getenv("SECURITY_BASELINE_FILE"),
+		SecurityRuleFiles:        getListEnv("SECURITY_RULE_FILES"),
+		ComplianceFrameworks:     getListEnv("COMPLIANCE_FRAMEWORKS"),
+		TriageStateFile:          os.Getenv("TRIAGE_STATE_FILE"),
+		TrendsFile:               os.Getenv("TRENDS_FILE"),
+		ExceptionsFile:           os.Getenv("EXCEPTIONS_FILE"),
+		ExceptionsIssueRepo:      os.Getenv("EXCEPTIONS_ISSUE_REPO"),
+		RiskProfileFile:          os.Getenv("RISK_PROFILE_FILE"),
+
+		GatewayUpstream:    getEnv("GATEWAY_UPSTREAM", "http://localhost:8080"),
+		GatewayRoutes:      os.Getenv("GATEWAY_ROUTES"),
+		RateLimitRPS:       getFloatEnv("RATE_LIMIT_RPS", 5),
+		RateLimitBurst:     getIntEnv("RATE_LIMIT_BURST", 20),
+		CORSAllowedOrigins: getListEnv("CORS_ALLOWED_ORIGINS"),
+
+		ExternalScanners:   getListEnv("EXTERNAL_SCANNERS"),
+		SeverityActions:    os.Getenv("SEVERITY_ACTIONS"),
+		SeverityThresholds: os.Getenv("SEVERITY_THRESHOLDS"),
+
+		VerdictMinCompliance: getIntEnv("VERDICT_MIN_COMPLIANCE", 0),
+		VerdictMaxCostDelta:  getFloatEnv("VERDICT_MAX_COST_DELTA", 0),
+
+		AdvisoryFeeds:           getListEnv("ADVISORY_FEEDS"),
+		OSVAPIURL:               getEnv("OSV_API_URL", "https://api.osv.dev"),
+		AdvisoryCacheTTL:        getDurationEnv("ADVISORY_CACHE_TTL", 24*time.Hour),
+		AdvisoryRefreshInterval: getDurationEnv("ADVISORY_REFRESH_INTERVAL", 6*time.Hour),
+
+		SARIFLevels:         os.Getenv("SARIF_LEVELS"),
+		PagerDutySeverities: os.Getenv("PAGERDUTY_SEVERITIES"),
+
+		CertExpiryWindow: getDurationEnv("CERT_EXPIRY_WINDOW", 30*24*time.Hour),
+
+		QuotaDefaultLocation: os.Getenv("QUOTA_DEFAULT_LOCATION"),
+
+		DriftLockChecks:     getDurationListEnv("DRIFT_LOCK_CHECKS", []time.Duration{time.Hour, 24 * time.Hour}),
+		DriftAlertChannel:   getEnv("DRIFT_ALERT_CHANNEL", "teams"),
+		DriftIgnore:         getListEnv("DRIFT_IGNORE"),
+		DriftSeverities:     os.Getenv("DRIFT_SEVERITIES"),
+		DriftNotifySeverity: getEnv("DRIFT_NOTIFY_SEVERITY", "high"),
 
-		TeamsWebhookURL: os.Getenv("TEAMS_WEBHOOK_URL"),
-		SlackWebhookURL: os.Getenv("SLACK_WEBHOOK_URL"),
+		DeployEnvironmentsFile: os.Getenv("DEPLOY_ENVIRONMENTS_FILE"),
+		DeployFreezeWindows:    os.Getenv("DEPLOY_FREEZE_WINDOWS"),
+		DeployChangeWindows:    os.Getenv("DEPLOY_CHANGE_WINDOWS"),
+		DeployGates:            os.Getenv("DEPLOY_GATES"),
+		DeployApprovers:        os.Getenv("DEPLOY_APPROVERS"),
+		ApprovalsFile:          os.Getenv("APPROVALS_FILE"),
+		ApprovalNotifyChannel:  os.Getenv("APPROVAL_NOTIFY_CHANNEL"),
 
-		EnableLLM:           getBoolEnv("ENABLE_LLM", true),
-		EnableNotifications: getBoolEnv("ENABLE_NOTIFICATIONS", env == EnvProd),
+		ModuleCatalog:   os.Getenv("MODULE_CATALOG"),
+		ModuleUsageFile: os.Getenv("MODULE_USAGE_FILE"),
+		PluginDir:       os.Getenv("PLUGIN_DIR"),
+
+		SLOObjectives:    getEnv("SLO_OBJECTIVES", "scans=*:30s@99"),
+		SLOWindow:        getDurationEnv("SLO_WINDOW", 24*time.Hour),
+		SLOProbeInterval: getDurationEnv("SLO_PROBE_INTERVAL", 5*time.Minute),
+		SLOProbeAgents:   getListEnv("SLO_PROBE_AGENTS"),
+		SLOAlertChannel:  getEnv("SLO_ALERT_CHANNEL", "teams"),
+
+		WorkflowNotifyChannel: os.Getenv("WORKFLOW_NOTIFY_CHANNEL"),
+
+		RulePackTargets: getListEnv("RULE_PACK_TARGETS"),
+
+		ShareLinkTTL: getDurationEnv("SHARE_LINK_TTL", 7*24*time.Hour),
+		ShareBaseURL: os.Getenv("SHARE_BASE_URL"),
+
+		ReportRetention:         getDurationEnv("REPORT_RETENTION", 0),
+		ReportSummaryRetention:  getDurationEnv("REPORT_SUMMARY_RETENTION", 0),
+		ReportArchiveURL:        os.Getenv("REPORT_ARCHIVE_URL"),
+		ReportRetentionInterval: getDurationEnv("REPORT_RETENTION_INTERVAL", 24*time.Hour),
+
+		EnableLLM:            getBoolEnv("ENABLE_LLM", true),
+		EnableNotifications:  getBoolEnv("ENABLE_NOTIFICATIONS", env == EnvProd),
+		EnableTelemetry:      getBoolEnv("ENABLE_TELEMETRY", false),
+		EnableEndpointCheck:  getBoolEnv("ENABLE_ENDPOINT_CHECKS", false),
+		EnableQuotaCheck:     getBoolEnv("ENABLE_QUOTA_CHECKS", false),
+		EnableLiveDependents: getBoolEnv("ENABLE_LIVE_DEPENDENTS", false),
+		EnableLiveInventory:  getBoolEnv("ENABLE_LIVE_INVENTORY", false),
+		EnableCostAPI:        getBoolEnv("ENABLE_COST_API", true),
+		WarmUp:               getBoolEnv("WARM_UP", true),
 	}
 }
 
@@ -108,9 +430,49 @@ func (c *Config) Validate() error {
 	if c.Environment == EnvProd && c.WebhookSecret == "" {
 		return fmt.Errorf("GITHUB_WEBHOOK_SECRET is required in production")
 	}
+	if c.AdminAddr != "" && c.AdminAddr == c.Addr() {
+		return fmt.Errorf("ADMIN_ADDR must differ from the main listen address %s", c.Addr())
+	}
+	if c.VerdictMinCompliance < 0 || c.VerdictMinCompliance > 100 {
+		return fmt.Errorf("VERDICT_MIN_COMPLIANCE must be between 0 and 100")
+	}
+	if c.VerdictMaxCostDelta < 0 {
+		return fmt.Errorf("VERDICT_MAX_COST_DELTA must not be negative")
+	}
+	if _, err := c.SARIFMapping(); err != nil {
+		return fmt.Errorf("SARIF_LEVELS: %w", err)
+	}
+	if _, err := c.PagerDutyMapping(); err != nil {
+		return fmt.Errorf("PAGERDUTY_SEVERITIES: %w", err)
+	}
 	return nil
 }
 
+// SARIFMapping returns the severity-to-SARIF-level mapping with
+// SARIF_LEVELS overrides applied.
+func (c *Config) SARIFMapping() (protocol.SeverityMapping, error) {
+	return protocol.DefaultSARIFLevels().Override(c.SARIFLevels, protocol.SARIFLevels...)
+}
+
+// PagerDutyMapping returns the severity-to-PagerDuty mapping with
+// PAGERDUTY_SEVERITIES overrides applied.
+func (c *Config) PagerDutyMapping() (protocol.SeverityMapping, error) {
+	return protocol.DefaultPagerDutySeverities().Override(c.PagerDutySeverities, protocol.PagerDutySeverities...)
+}
+
+// Addr returns the address to listen on: LISTEN_ADDR when set, otherwise
+// all interfaces on Port.
+func (c *Config) Addr() string {
+	if c.ListenAddr != "" {
+		return c.ListenAddr
+	}
+	port := c.Port
+	if port == "" {
+		port = "8080"
+	}
+	return ":" + port
+}
+
 // IsProd returns true if running in production.
 func (c *Config) IsProd() bool { return c.Environment == EnvProd }
 
@@ -167,6 +529,47 @@ func getInt64Env(key string, defaultVal int64) int64 {
 	return defaultVal
 }
 
+func getFloatEnv(key string, defaultVal float64) float64 {
+	if val := os.Getenv(key); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+	}
+	return defaultVal
+}
+
+// getListEnv splits a comma-separated variable, dropping empty entries.
+func getListEnv(key string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// getDurationListEnv parses a comma-separated list of durations, returning
+// defaultVal when unset or when any entry is invalid. "off" disables.
+func getDurationListEnv(key string, defaultVal []time.Duration) []time.Duration {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return defaultVal
+	}
+	if strings.EqualFold(val, "off") {
+		return nil
+	}
+	var out []time.Duration
+	for _, v := range getListEnv(key) {
+		d, err := parseDuration(v)
+		if err != nil || d <= 0 {
+			return defaultVal
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
 func getBoolEnv(key string, defaultVal bool) bool {
 	if val := os.Getenv(key); val != "" {
 		switch strings.ToLower(val) {
@@ -181,9 +584,22 @@ func getBoolEnv(key string, defaultVal bool) bool {
 
 func getDurationEnv(key string, defaultVal time.Duration) time.Duration {
 	if val := os.Getenv(key); val != "" {
-		if d, err := time.ParseDuration(val); err == nil {
+		if d, err := parseDuration(val); err == nil {
 			return d
 		}
 	}
 	return defaultVal
 }
+
+// parseDuration is time.ParseDuration that also accepts whole days, e.g.
+// "90d".
+func parseDuration(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 || n > math.MaxInt64/int(24*time.Hour) {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -1,9 +1,14 @@
 package config
 
 import (
+	"encoding/json"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 )
 
 func clearEnv() {
@@ -11,11 +16,26 @@ func clearEnv() {
 		"PORT", "ENVIRONMENT", "LOG_LEVEL",
 		"GITHUB_WEBHOOK_SECRET",
 		"HTTP_READ_TIMEOUT", "HTTP_WRITE_TIMEOUT", "HTTP_IDLE_TIMEOUT",
-		"AGENT_TIMEOUT", "MAX_BODY_SIZE",
+		"AGENT_TIMEOUT", "MAX_BODY_SIZE", "IDEMPOTENCY_TTL",
 		"MODEL_NAME", "MODEL_ENDPOINT", "MODEL_TIMEOUT", "MODEL_MAX_TOKENS",
-		"AZURE_SUBSCRIPTION_ID", "AZURE_TENANT_ID", "AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET",
-		"TEAMS_WEBHOOK_URL", "SLACK_WEBHOOK_URL",
+		"AZURE_SUBSCRIPTION_ID", "AZURE_TENANT_ID", "AZURE_CLIENT_ID", "AZURE_CLIENT_SECRET", "AZURE_FEDERATED_TOKEN_FILE",
+		"TEAMS_WEBHOOK_URL", "SLACK_WEBHOOK_URL", "NOTIFY_CHANNELS",
+		"NOTIFY_LOCALES", "NOTIFY_DEFAULT_LOCALE", "NOTIFY_DEFAULT_TIMEZONE",
+		"COST_REPORT_REPOS", "COST_REPORT_CHANNEL", "REPORT_BASE_URL", "GITHUB_API_URL", "GITHUB_TOKEN",
 		"ENABLE_LLM", "ENABLE_NOTIFICATIONS",
+		"ENABLE_TELEMETRY", "WARM_UP",
+		"GATEWAY_UPSTREAM", "GATEWAY_ROUTES", "RATE_LIMIT_RPS", "RATE_LIMIT_BURST", "CORS_ALLOWED_ORIGINS",
+		"EXTERNAL_SCANNERS", "ADVISORY_FEEDS", "OSV_API_URL", "ADVISORY_CACHE_TTL", "ADVISORY_REFRESH_INTERVAL", "SEVERITY_ACTIONS", "SEVERITY_THRESHOLDS", "VERDICT_MIN_COMPLIANCE", "VERDICT_MAX_COST_DELTA", "ENABLE_ENDPOINT_CHECKS", "CERT_EXPIRY_WINDOW", "ENABLE_QUOTA_CHECKS", "QUOTA_DEFAULT_LOCATION", "ENABLE_LIVE_DEPENDENTS", "ENABLE_LIVE_INVENTORY",
+		"DRIFT_LOCK_CHECKS", "DRIFT_ALERT_CHANNEL", "DRIFT_IGNORE", "DRIFT_SEVERITIES", "DRIFT_NOTIFY_SEVERITY", "DEPLOY_ENVIRONMENTS_FILE", "DEPLOY_FREEZE_WINDOWS", "DEPLOY_CHANGE_WINDOWS", "DEPLOY_GATES", "DEPLOY_APPROVERS", "APPROVALS_FILE", "APPROVAL_NOTIFY_CHANNEL", "MODULE_CATALOG", "MODULE_USAGE_FILE", "PLUGIN_DIR",
+		"SARIF_LEVELS", "PAGERDUTY_SEVERITIES",
+		"LISTEN_ADDR", "IP_ALLOWLIST", "TRUSTED_PROXIES", "ADMIN_ADDR",
+		"NOTIFY_WEBHOOK_CONFIG", "NOTIFY_RATE_LIMIT", "NOTIFY_BATCH_MAX",
+		"SLO_OBJECTIVES", "SLO_WINDOW", "SLO_PROBE_INTERVAL", "SLO_PROBE_AGENTS", "SLO_ALERT_CHANNEL", "WORKFLOW_NOTIFY_CHANNEL",
+		"RULE_PACK_TARGETS", "SHARE_LINK_TTL", "SHARE_BASE_URL",
+		"REPORT_RETENTION", "REPORT_SUMMARY_RETENTION", "REPORT_ARCHIVE_URL", "REPORT_RETENTION_INTERVAL",
+		"ENABLE_COST_API", "PRICE_API_URL", "PRICE_CACHE_FILE", "PRICE_CACHE_TTL", "PRICE_REFRESH_INTERVAL", "CURRENCY", "LOCALE", "COST_BUDGET_MONTHLY", "COST_RESERVATIONS", "AZURE_POLICY_DEFINITIONS", "AZURE_POLICY_SUBSCRIPTIONS", "AZURE_POLICY_CACHE_TTL", "POLICY_WAIVERS_FILE", "SECURITY_BASELINE_FILE", "SECURITY_RULE_FILES", "COMPLIANCE_FRAMEWORKS", "TRIAGE_STATE_FILE", "TRENDS_FILE", "EXCEPTIONS_FILE", "EXCEPTIONS_ISSUE_REPO", "RISK_PROFILE_FILE",
+		"ENV_FILE",
+		"NOTIFY_EMAIL_SENDER", "NOTIFY_EMAIL_TEMPLATE", "GRAPH_API_URL", "AZURE_AUTHORITY_HOST",
 	}
 	for _, v := range vars {
 		os.Unsetenv(v)
@@ -54,6 +74,9 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.EnableNotifications {
 		t.Error("EnableNotifications should default to false in dev")
 	}
+	if cfg.EnableTelemetry {
+		t.Error("EnableTelemetry should default to false (opt-in)")
+	}
 }
 
 func TestLoad_ProdEnvironment(t *testing.T) {
@@ -159,6 +182,50 @@ func TestValidate_ProdWithSecret(t *testing.T) {
 	}
 }
 
+func TestValidate_DecisionLimits(t *testing.T) {
+	clearEnv()
+	os.Setenv("VERDICT_MIN_COMPLIANCE", "80")
+	os.Setenv("VERDICT_MAX_COST_DELTA", "250.5")
+	defer clearEnv()
+
+	cfg := Load()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error: %v", err)
+	}
+	if cfg.VerdictMinCompliance != 80 || cfg.VerdictMaxCostDelta != 250.5 {
+		t.Errorf("limits = %d, %v", cfg.VerdictMinCompliance, cfg.VerdictMaxCostDelta)
+	}
+	os.Setenv("VERDICT_MIN_COMPLIANCE", "120")
+	if err := Load().Validate(); err == nil {
+		t.Error("Validate() should reject a minimum compliance over 100")
+	}
+}
+
+func TestValidate_SeverityMappings(t *testing.T) {
+	clearEnv()
+	os.Setenv("SARIF_LEVELS", "medium=error")
+	os.Setenv("PAGERDUTY_SEVERITIES", "high=critical")
+	defer clearEnv()
+
+	cfg := Load()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate() error: %v", err)
+	}
+	sarif, _ := cfg.SARIFMapping()
+	if sarif[protocol.SeverityMedium] != "error" || sarif[protocol.SeverityLow] != "note" {
+		t.Errorf("SARIF mapping = %v, want medium=error over defaults", sarif)
+	}
+	pd, _ := cfg.PagerDutyMapping()
+	if pd[protocol.SeverityHigh] != "critical" {
+		t.Errorf("PagerDuty high = %q, want critical", pd[protocol.SeverityHigh])
+	}
+
+	os.Setenv("SARIF_LEVELS", "medium=fatal")
+	if err := Load().Validate(); err == nil {
+		t.Error("Validate() should reject unknown SARIF level")
+	}
+}
+
 func TestEnvironmentHelpers(t *testing.T) {
 	tests := []struct {
 		env    Environment
@@ -226,6 +293,15 @@ func TestGetDurationEnv(t *testing.T) {
 	if got != 10*time.Second {
 		t.Errorf("getDurationEnv('invalid') = %v, want 10s", got)
 	}
+
+	os.Setenv("TEST_DUR", "90d")
+	if got := getDurationEnv("TEST_DUR", 0); got != 90*24*time.Hour {
+		t.Errorf("getDurationEnv('90d') = %v, want 2160h", got)
+	}
+	os.Setenv("TEST_DUR", "1.5d")
+	if got := getDurationEnv("TEST_DUR", time.Hour); got != time.Hour {
+		t.Errorf("getDurationEnv('1.5d') = %v, want the default", got)
+	}
 }
 
 func TestLoad_Timeouts(t *testing.T) {
@@ -278,3 +354,187 @@ func TestLoad_MaxBodySize(t *testing.T) {
 		t.Errorf("MaxBodySize = %d, want 2097152", cfg.MaxBodySize)
 	}
 }
+
+func TestLoad_Gateway(t *testing.T) {
+	clearEnv()
+	cfg := Load()
+
+	if cfg.GatewayUpstream != "http://localhost:8080" {
+		t.Errorf("GatewayUpstream = %q, want default", cfg.GatewayUpstream)
+	}
+	if cfg.RateLimitRPS != 5 || cfg.RateLimitBurst != 20 {
+		t.Errorf("rate limit = %v/%d, want 5/20", cfg.RateLimitRPS, cfg.RateLimitBurst)
+	}
+	if len(cfg.CORSAllowedOrigins) != 0 {
+		t.Errorf("CORSAllowedOrigins = %v, want empty", cfg.CORSAllowedOrigins)
+	}
+
+	os.Setenv("RATE_LIMIT_RPS", "0.5")
+	os.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, ,https://b.example.com")
+	defer clearEnv()
+
+	cfg = Load()
+	if cfg.RateLimitRPS != 0.5 {
+		t.Errorf("RateLimitRPS = %v, want 0.5", cfg.RateLimitRPS)
+	}
+	if len(cfg.CORSAllowedOrigins) != 2 || cfg.CORSAllowedOrigins[1] != "https://b.example.com" {
+		t.Errorf("CORSAllowedOrigins = %v", cfg.CORSAllowedOrigins)
+	}
+}
+
+func TestLoad_CostReport(t *testing.T) {
+	clearEnv()
+	cfg := Load()
+
+	if cfg.NotifyDefaultLocale != "en-US" || cfg.NotifyDefaultTimeZone != "UTC" {
+		t.Errorf("notify defaults = %q/%q, want en-US/UTC", cfg.NotifyDefaultLocale, cfg.NotifyDefaultTimeZone)
+	}
+	if cfg.CostReportChannel != "finance" {
+		t.Errorf("CostReportChannel = %q, want finance", cfg.CostReportChannel)
+	}
+	if cfg.EnableEndpointCheck || cfg.CertExpiryWindow != 30*24*time.Hour {
+		t.Errorf("endpoint checks = %v/%v, want disabled with 30 day window", cfg.EnableEndpointCheck, cfg.CertExpiryWindow)
+	}
+	if cfg.EnableQuotaCheck || cfg.QuotaDefaultLocation != "" {
+		t.Errorf("quota checks = %v/%q, want disabled", cfg.EnableQuotaCheck, cfg.QuotaDefaultLocation)
+	}
+	if cfg.SeverityActions != "" {
+		t.Errorf("SeverityActions = %q, want empty", cfg.SeverityActions)
+	}
+	if len(cfg.ExternalScanners) != 0 {
+		t.Errorf("ExternalScanners = %v, want empty", cfg.ExternalScanners)
+	}
+	if len(cfg.CostReportRepos) != 0 {
+		t.Errorf("CostReportRepos = %v, want empty", cfg.CostReportRepos)
+	}
+
+	os.Setenv("COST_REPORT_REPOS", "org/infra@main,org/platform@release")
+	os.Setenv("GITHUB_TOKEN", "secret")
+	defer clearEnv()
+
+	cfg = Load()
+	if len(cfg.CostReportRepos) != 2 || cfg.CostReportRepos[1] != "org/platform@release" {
+		t.Errorf("CostReportRepos = %v", cfg.CostReportRepos)
+	}
+
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Error("GitHubToken must not be serialized")
+	}
+}
+
+func TestLoad_DriftLock(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	cfg := Load()
+	if len(cfg.DriftLockChecks) != 2 || cfg.DriftLockChecks[1] != 24*time.Hour || cfg.DriftAlertChannel != "teams" {
+		t.Errorf("defaults = %v / %q", cfg.DriftLockChecks, cfg.DriftAlertChannel)
+	}
+
+	os.Setenv("DRIFT_LOCK_CHECKS", "30m, 6h")
+	if got := Load().DriftLockChecks; len(got) != 2 || got[0] != 30*time.Minute {
+		t.Errorf("DriftLockChecks = %v", got)
+	}
+	os.Setenv("DRIFT_LOCK_CHECKS", "off")
+	if got := Load().DriftLockChecks; len(got) != 0 {
+		t.Errorf("DriftLockChecks = %v, want disabled", got)
+	}
+	os.Setenv("DRIFT_LOCK_CHECKS", "1h,soon")
+	if got := Load().DriftLockChecks; len(got) != 2 || got[0] != time.Hour {
+		t.Errorf("invalid entry should fall back to defaults, got %v", got)
+	}
+}
+
+func TestLoad_NetworkRestrictions(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+
+	cfg := Load()
+	if cfg.Addr() != ":8080" || len(cfg.IPAllowlist) != 0 {
+		t.Errorf("defaults: addr=%q allowlist=%v", cfg.Addr(), cfg.IPAllowlist)
+	}
+
+	os.Setenv("LISTEN_ADDR", "unix:/run/ghcp/agent.sock")
+	os.Setenv("IP_ALLOWLIST", "10.0.0.0/8, 192.168.1.5")
+	os.Setenv("TRUSTED_PROXIES", "172.16.0.0/12")
+	cfg = Load()
+	if cfg.Addr() != "unix:/run/ghcp/agent.sock" {
+		t.Errorf("Addr() = %q, want unix socket", cfg.Addr())
+	}
+	if len(cfg.IPAllowlist) != 2 || cfg.IPAllowlist[1] != "192.168.1.5" {
+		t.Errorf("IPAllowlist = %v", cfg.IPAllowlist)
+	}
+	if len(cfg.TrustedProxies) != 1 {
+		t.Errorf("TrustedProxies = %v", cfg.TrustedProxies)
+	}
+
+	os.Setenv("ADMIN_ADDR", "127.0.0.1:9090")
+	if cfg = Load(); cfg.AdminAddr != "127.0.0.1:9090" || cfg.Validate() != nil {
+		t.Errorf("AdminAddr = %q, Validate() = %v", cfg.AdminAddr, cfg.Validate())
+	}
+	os.Setenv("ADMIN_ADDR", "unix:/run/ghcp/agent.sock")
+	if err := Load().Validate(); err == nil {
+		t.Error("ADMIN_ADDR equal to the listen address should fail validation")
+	}
+}
+
+func TestLoadDotEnv(t *testing.T) {
+	clearEnv()
+	defer clearEnv()
+	defer os.Unsetenv("DOTENV_HOME")
+
+	path := filepath.Join(t.TempDir(), "app.env")
+	os.WriteFile(path, []byte(`# local development
+export ENVIRONMENT=test
+PORT=9090
+DOTENV_HOME=/srv/ghcp
+PRICE_CACHE_FILE=${DOTENV_HOME}/prices.json # cached between runs
+MODEL_NAME="gpt-4.1 ${UNSET_VAR:-mini}"
+GITHUB_TOKEN='${not_expanded}'
+`), 0o600)
+	os.Setenv("ENV_FILE", path)
+	os.Setenv("PORT", "7070")
+
+	if err := LoadDotEnv(); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Load()
+	if cfg.Environment != EnvTest {
+		t.Errorf("Environment = %q, want test", cfg.Environment)
+	}
+	if cfg.Port != "7070" {
+		t.Errorf("Port = %q, the environment should win over the file", cfg.Port)
+	}
+	if cfg.PriceCacheFile != "/srv/ghcp/prices.json" {
+		t.Errorf("PriceCacheFile = %q", cfg.PriceCacheFile)
+	}
+	if cfg.ModelName != "gpt-4.1 mini" {
+		t.Errorf("ModelName = %q", cfg.ModelName)
+	}
+	if cfg.GitHubToken != "${not_expanded}" {
+		t.Errorf("GitHubToken = %q, single quotes are literal", cfg.GitHubToken)
+	}
+
+	os.WriteFile(path, []byte("not an assignment\n"), 0o600)
+	if err := LoadDotEnv(); err == nil {
+		t.Error("malformed line should fail")
+	}
+	os.Setenv("ENV_FILE", filepath.Join(t.TempDir(), "missing.env"))
+	if err := LoadDotEnv(); err == nil {
+		t.Error("missing ENV_FILE should fail")
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("EXPAND_SECRET", "s3cret")
+	t.Setenv("EXPAND_EMPTY", "")
+	in := `{"secret": "${EXPAND_SECRET}", "tenant": "${EXPAND_EMPTY:-acme}", "url": "https://x/?$filter=a", "gone": "${EXPAND_UNSET}"}`
+	want := `{"secret": "s3cret", "tenant": "acme", "url": "https://x/?$filter=a", "gone": ""}`
+	if got := string(ExpandEnv([]byte(in))); got != want {
+		t.Errorf("ExpandEnv =\n%s\nwant\n%s", got, want)
+	}
+}
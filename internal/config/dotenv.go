@@ -0,0 +1,117 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DefaultEnvFile is the dotenv file LoadDotEnv reads when ENV_FILE is unset.
+const DefaultEnvFile = ".env"
+
+var (
+	envKeyRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	envRefRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+)
+
+// LoadDotEnv sets environment variables from the dotenv file named by
+// ENV_FILE, or DefaultEnvFile. Variables already set in the environment win,
+// so a container's -e flags override the file checked into a deployment.
+// A missing DefaultEnvFile is not an error; a missing ENV_FILE is.
+//
+// Each line is KEY=VALUE, optionally prefixed with "export". Blank lines and
+// lines starting with # are skipped. Values may be single- or double-quoted;
+// ${VAR} references in unquoted and double-quoted values are expanded.
+func LoadDotEnv() error {
+	path := os.Getenv("ENV_FILE")
+	explicit := path != ""
+	if !explicit {
+		path = DefaultEnvFile
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read env file: %w", err)
+	}
+	vars, err := parseDotEnv(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, kv := range vars {
+		if _, set := os.LookupEnv(kv[0]); set {
+			continue
+		}
+		if err := os.Setenv(kv[0], kv[1]); err != nil {
+			return fmt.Errorf("%s: set %s: %w", path, kv[0], err)
+		}
+	}
+	return nil
+}
+
+// parseDotEnv returns the file's assignments in order. References are
+// expanded as each line is read, so a value can use keys set above it.
+func parseDotEnv(data []byte) ([][2]string, error) {
+	var vars [][2]string
+	local := make(map[string]string)
+	lookup := func(name string) (string, bool) {
+		if v, ok := os.LookupEnv(name); ok {
+			return v, true
+		}
+		v, ok := local[name]
+		return v, ok
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, val, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !envKeyRe.MatchString(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", n)
+		}
+		val = strings.TrimSpace(val)
+		switch {
+		case len(val) >= 2 && val[0] == '\'' && val[len(val)-1] == '\'':
+			val = val[1 : len(val)-1]
+		case len(val) >= 2 && val[0] == '"' && val[len(val)-1] == '"':
+			val = expand(strings.NewReplacer(`\n`, "\n", `\"`, `"`, `\\`, `\`).Replace(val[1:len(val)-1]), lookup)
+		default:
+			if i := strings.Index(val, " #"); i >= 0 {
+				val = strings.TrimSpace(val[:i])
+			}
+			val = expand(val, lookup)
+		}
+		local[key] = val
+		vars = append(vars, [2]string{key, val})
+	}
+	return vars, sc.Err()
+}
+
+// ExpandEnv replaces ${VAR} references in a config file's contents with
+// the variable's value, or the default in ${VAR:-default} when it is unset
+// or empty. Bare $VAR is left alone so that JSON and URLs containing a
+// dollar sign ("$filter") survive. Unset variables without a default
+// expand to "".
+func ExpandEnv(data []byte) []byte {
+	return []byte(expand(string(data), os.LookupEnv))
+}
+
+func expand(s string, lookup func(string) (string, bool)) string {
+	return envRefRe.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envRefRe.FindStringSubmatch(ref)
+		if v, ok := lookup(m[1]); ok && v != "" {
+			return v
+		}
+		return m[2]
+	})
+}
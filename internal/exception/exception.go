@@ -0,0 +1,315 @@
+// Package exception keeps governance exception requests: a finding a team
+// asks to accept for a while, with the rule it breaks, the conversation
+// that led there and the proposed expiry, for approvers to review. An
+// approved request becomes a waiver in the policy agent's waivers file.
+package exception
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/filestore"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// StatusPending is the status of a request awaiting review.
+const StatusPending = "pending"
+
+// DefaultExpiry is how long an exception is requested for when the command
+// gives no expiry, and MaxExpiry the longest that can be requested.
+const (
+	DefaultExpiry = 90 * 24 * time.Hour
+	MaxExpiry     = 365 * 24 * time.Hour
+)
+
+// maxTurns and maxTurnLength bound the conversation kept with a request.
+const (
+	maxTurns      = 10
+	maxTurnLength = 1000
+)
+
+// Turn is one message of the conversation behind a request.
+type Turn struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Request is a governance exception request for one finding.
+type Request struct {
+	ID           string            `json:"id"`
+	Status       string            `json:"status"`
+	RuleID       string            `json:"rule_id"`
+	RuleTitle    string            `json:"rule_title,omitempty"`
+	Severity     protocol.Severity `json:"severity"`
+	ResourceType string            `json:"resource_type"`
+	Resource     string            `json:"resource"`
+	// Message and Remediation are the finding's.
+	Message     string `json:"message"`
+	Remediation string `json:"remediation,omitempty"`
+	// Reference is the documentation behind the rule.
+	Reference     string `json:"reference,omitempty"`
+	Justification string `json:"justification"`
+	// Expires is the proposed last day of the exception, YYYY-MM-DD.
+	Expires    string `json:"expires"`
+	Repository string `json:"repository,omitempty"`
+	// Conversation is the end of the chat that concluded an exception is
+	// needed, with code blocks left out.
+	Conversation []Turn    `json:"conversation,omitempty"`
+	Issue        string    `json:"issue,omitempty"`
+	Created      time.Time `json:"created"`
+}
+
+// Waiver is the waivers file entry that grants the request once approved.
+func (r Request) Waiver() analyzer.Waiver {
+	return analyzer.Waiver{
+		Rule:     r.RuleID,
+		Resource: r.ResourceType + "." + r.Resource,
+		Reason:   r.Justification + " (" + r.ID + ")",
+		Expires:  r.Expires,
+	}
+}
+
+// Title is a one-line summary of the request, e.g. for an issue.
+func (r Request) Title() string {
+	return fmt.Sprintf("Exception request %s: %s on %s.%s", r.ID, r.RuleID, r.ResourceType, r.Resource)
+}
+
+// Table renders the request's fields as a Markdown table.
+func (r Request) Table() string {
+	var sb strings.Builder
+	sb.WriteString("| Field | Value |\n|-------|-------|\n")
+	row := func(k, v string) {
+		if v != "" {
+			fmt.Fprintf(&sb, "| %s | %s |\n", k, strings.ReplaceAll(v, "|", "\\|"))
+		}
+	}
+	row("Request", r.ID)
+	row("Rule", strings.TrimSpace(r.RuleID+" "+r.RuleTitle))
+	row("Severity", string(r.Severity))
+	row("Resource", "`"+r.ResourceType+"."+r.Resource+"`")
+	row("Repository", r.Repository)
+	row("Finding", r.Message)
+	row("Remediation", r.Remediation)
+	row("Reference", r.Reference)
+	row("Justification", r.Justification)
+	row("Expires", r.Expires)
+	return sb.String()
+}
+
+// Markdown renders the request for reviewers, e.g. as an issue body: its
+// fields, the conversation and the waiver that grants it.
+func (r Request) Markdown() string {
+	var sb strings.Builder
+	sb.WriteString(r.Table())
+	if len(r.Conversation) > 0 {
+		sb.WriteString("\n### Conversation\n\n")
+		for _, t := range r.Conversation {
+			fmt.Fprintf(&sb, "**%s:** %s\n\n", t.Role, strings.ReplaceAll(t.Content, "\n", " "))
+		}
+	}
+	waiver, _ := json.MarshalIndent(r.Waiver(), "", "  ")
+	sb.WriteString("\n### Waiver\n\nOnce approved, add to the policy waivers file:\n\n```json\n")
+	sb.Write(waiver)
+	sb.WriteString("\n```\n")
+	return sb.String()
+}
+
+// codeBlockRe matches fenced code blocks, left out of the conversation.
+var codeBlockRe = regexp.MustCompile("(?s)```.*?```")
+
+// Conversation returns the last turns of messages, with code blocks
+// replaced by a placeholder and long messages cut short.
+func Conversation(messages []protocol.Message) []Turn {
+	if len(messages) > maxTurns {
+		messages = messages[len(messages)-maxTurns:]
+	}
+	turns := make([]Turn, 0, len(messages))
+	for _, m := range messages {
+		content := strings.TrimSpace(codeBlockRe.ReplaceAllString(m.Content, "_(code omitted)_"))
+		if content == "" {
+			continue
+		}
+		if r := []rune(content); len(r) > maxTurnLength {
+			content = string(r[:maxTurnLength]) + "…"
+		}
+		turns = append(turns, Turn{Role: m.Role, Content: content})
+	}
+	return turns
+}
+
+// Store holds exception requests, persisted to a JSON file when it has a
+// path. It is safe for concurrent use.
+type Store struct {
+	now      func() time.Time
+	requests *filestore.Records[Request]
+}
+
+// NewStore creates a store, loading path when it exists. An empty path
+// keeps requests in memory only.
+func NewStore(path string) (*Store, error) {
+	requests, err := filestore.Open[Request](path)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{now: time.Now, requests: requests}, nil
+}
+
+// Submit assigns r an ID, marks it pending and persists it.
+func (s *Store) Submit(r Request) (Request, error) {
+	err := s.requests.Update(func(requests []Request) ([]Request, error) {
+		r.ID = fmt.Sprintf("EXC-%03d", next(requests))
+		r.Status = StatusPending
+		r.Created = s.now().UTC()
+		return append(requests, r), nil
+	})
+	if err != nil {
+		return Request{}, err
+	}
+	return r, nil
+}
+
+// next returns the number of the request following requests.
+func next(requests []Request) int {
+	n := 0
+	for _, r := range requests {
+		if i, err := strconv.Atoi(strings.TrimPrefix(r.ID, "EXC-")); err == nil && i > n {
+			n = i
+		}
+	}
+	return n + 1
+}
+
+// SetIssue records the issue opened for a request.
+func (s *Store) SetIssue(id, issue string) error {
+	return s.requests.Update(func(requests []Request) ([]Request, error) {
+		found := false
+		for i := range requests {
+			if requests[i].ID == id {
+				requests[i].Issue, found = issue, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("exception request %s not found", id)
+		}
+		return requests, nil
+	})
+}
+
+// Get returns a request by ID.
+func (s *Store) Get(id string) (Request, bool) {
+	return s.requests.Find(func(r Request) bool { return strings.EqualFold(r.ID, id) })
+}
+
+// List returns the requests with status, or all when it is empty, newest
+// first.
+func (s *Store) List(status string) []Request {
+	return s.requests.List(
+		func(r Request) bool { return status == "" || r.Status == status },
+		func(a, b Request) bool { return a.Created.After(b.Created) })
+}
+
+// Command is an exception request given in chat. Finding is the 1-based
+// number of the finding in the last report of the conversation.
+type Command struct {
+	Finding int
+	// Until is the proposed last day; For is used when it is zero.
+	Until         time.Time
+	For           time.Duration
+	Justification string
+	// Issue asks for an issue to be opened for reviewers too.
+	Issue bool
+}
+
+var (
+	exceptionRe = regexp.MustCompile(`(?i)\b(?:request|raise|file|submit)\s+(?:an?\s+)?(?:exception|waiver)\s+for\s+finding\s+#?(\d+)\b`)
+	untilRe     = regexp.MustCompile(`(?i)\b(?:until|expir(?:es|ing)(?:\s+on)?)\s+(\d{4}-\d{2}-\d{2})\b`)
+	forRe       = regexp.MustCompile(`(?i)\bfor\s+(\d+)\s*(days?|d|weeks?|w|months?)\b`)
+	becauseRe   = regexp.MustCompile(`(?is)\b(?:because|reason:?|justification:?)\s+(.+)`)
+	issueRe     = regexp.MustCompile(`(?i)\b(?:open|create|file|raise)\s+(?:an?\s+|the\s+)?(?:github\s+)?(?:issue|ticket)\b`)
+	// trailerRe strips an issue request trailing the justification.
+	trailerRe = regexp.MustCompile(`(?i)[\s,;.]*(?:and\s+)?(?:open|create|file|raise)\s+(?:an?\s+|the\s+)?(?:github\s+)?(?:issue|ticket)\b.*$`)
+)
+
+// ParseCommand recognizes an exception request in a prompt:
+//
+//	request exception for finding 2 [until 2026-12-31 | for 90 days]
+//	  [because <justification>] [and open an issue]
+//
+// Exceptions last DefaultExpiry unless given, at most MaxExpiry.
+func ParseCommand(prompt string) (Command, bool) {
+	m := exceptionRe.FindStringSubmatch(prompt)
+	if m == nil {
+		return Command{}, false
+	}
+	n, _ := strconv.Atoi(m[1])
+	cmd := Command{Finding: n, For: DefaultExpiry, Issue: issueRe.MatchString(prompt)}
+	if u := untilRe.FindStringSubmatch(prompt); u != nil {
+		if t, err := time.Parse("2006-01-02", u[1]); err == nil {
+			cmd.Until = t
+		}
+	} else if f := forRe.FindStringSubmatch(prompt); f != nil {
+		n, err := strconv.Atoi(f[1])
+		unit := 24 * time.Hour
+		switch strings.ToLower(f[2])[0] {
+		case 'w':
+			unit = 7 * 24 * time.Hour
+		case 'm':
+			unit = 30 * 24 * time.Hour
+		}
+		cmd.For = time.Duration(n) * unit
+		if err != nil || n > int(MaxExpiry/time.Hour) || cmd.For > MaxExpiry {
+			cmd.For = MaxExpiry
+		}
+	}
+	if b := becauseRe.FindStringSubmatch(prompt); b != nil {
+		cmd.Justification = strings.TrimSpace(trailerRe.ReplaceAllString(b[1], ""))
+	}
+	return cmd, true
+}
+
+// Expiry returns the proposed last day of the exception at now, as
+// YYYY-MM-DD, or an error when Until is past or beyond MaxExpiry.
+func (c Command) Expiry(now time.Time) (string, error) {
+	end := c.Until
+	if end.IsZero() {
+		end = now.Add(c.For)
+	}
+	switch {
+	case end.Before(now.Truncate(24 * time.Hour)):
+		return "", fmt.Errorf("%s is in the past", end.Format("2006-01-02"))
+	case end.After(now.Add(MaxExpiry)):
+		return "", fmt.Errorf("exceptions last at most %d days", int(MaxExpiry/(24*time.Hour)))
+	}
+	return end.UTC().Format("2006-01-02"), nil
+}
+
+// NewRequest compiles the request cmd asks for from a finding and the
+// conversation that concluded it needs an exception.
+func NewRequest(f protocol.Finding, cmd Command, expires string, messages []protocol.Message) Request {
+	r := Request{
+		RuleID:        f.RuleID,
+		Severity:      f.Severity,
+		ResourceType:  f.ResourceType,
+		Resource:      f.Resource,
+		Message:       f.Message,
+		Remediation:   f.Remediation,
+		Justification: cmd.Justification,
+		Expires:       expires,
+		Conversation:  Conversation(messages),
+	}
+	for _, rule := range analyzer.AllRules() {
+		if strings.EqualFold(rule.ID, f.RuleID) {
+			r.RuleTitle, r.Reference = rule.Title, rule.Reference.URL
+			if r.Remediation == "" {
+				r.Remediation = rule.Remediation
+			}
+			break
+		}
+	}
+	return r
+}
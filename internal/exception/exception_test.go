@@ -0,0 +1,83 @@
+package exception
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+func TestParseCommand(t *testing.T) {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		prompt        string
+		finding       int
+		expires       string
+		justification string
+		issue         bool
+	}{
+		{"request exception for finding 2 because vendor appliance", 2, "2026-12-30", "vendor appliance", false},
+		{"Please raise a waiver for finding #3 until 2027-03-31, reason: migration in Q1 and open an issue", 3, "2027-03-31", "migration in Q1", true},
+		{"file an exception for finding 1 for 2 weeks because pilot; create a GitHub issue", 1, "2026-10-15", "pilot", true},
+		{"request exception for finding 1 for 5000 days because forever", 1, "2027-10-01", "forever", false},
+	}
+	for _, tt := range tests {
+		cmd, ok := ParseCommand(tt.prompt)
+		if !ok {
+			t.Errorf("ParseCommand(%q) not recognized", tt.prompt)
+			continue
+		}
+		expires, err := cmd.Expiry(now)
+		if cmd.Finding != tt.finding || err != nil || expires != tt.expires || cmd.Justification != tt.justification || cmd.Issue != tt.issue {
+			t.Errorf("ParseCommand(%q) = %+v, expires %s %v", tt.prompt, cmd, expires, err)
+		}
+	}
+	if _, ok := ParseCommand("snooze finding 2"); ok {
+		t.Error("snooze recognized as an exception request")
+	}
+	cmd, _ := ParseCommand("request exception for finding 1 until 2027-12-31 because x")
+	if _, err := cmd.Expiry(now); err == nil {
+		t.Error("expiry beyond MaxExpiry accepted")
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "exceptions.json")
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := protocol.Finding{RuleID: "SEC-001", Severity: protocol.SeverityCritical, ResourceType: "azurerm_key_vault", Resource: "kv", Message: "hardcoded secret"}
+	messages := []protocol.Message{{Role: "user", Content: "scan this\n```hcl\npassword = \"hunter2\"\n```"}, {Role: "assistant", Content: strings.Repeat("x", 2000)}}
+	r := NewRequest(f, Command{Justification: "rotated weekly"}, "2026-12-31", messages)
+	if r.RuleTitle == "" || r.Remediation == "" || len(r.Conversation) != 2 || strings.Contains(r.Conversation[0].Content, "hunter2") || len([]rune(r.Conversation[1].Content)) != maxTurnLength+1 {
+		t.Errorf("request = %+v", r)
+	}
+	first, _ := s.Submit(r)
+	second, _ := s.Submit(r)
+	if first.ID != "EXC-001" || second.ID != "EXC-002" || first.Status != StatusPending {
+		t.Errorf("ids = %s, %s", first.ID, second.ID)
+	}
+	if err := s.SetIssue("EXC-002", "https://github.com/org/app/issues/1"); err != nil {
+		t.Fatal(err)
+	}
+	if w := first.Waiver(); w.Resource != "azurerm_key_vault.kv" || w.Reason != "rotated weekly (EXC-001)" || w.Expires != "2026-12-31" {
+		t.Errorf("waiver = %+v", w)
+	}
+
+	reopened, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := reopened.Get("exc-002"); !ok || r.Issue == "" {
+		t.Errorf("reopened = %+v", r)
+	}
+	if next, _ := reopened.Submit(r); next.ID != "EXC-003" {
+		t.Errorf("next id = %s", next.ID)
+	}
+	if got := reopened.List(StatusPending); len(got) != 3 {
+		t.Errorf("List = %d requests", len(got))
+	}
+}
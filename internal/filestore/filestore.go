@@ -0,0 +1,116 @@
+// Package filestore keeps the records of a store as a JSON array in a state
+// file. Every update is written to a temporary file that is renamed over
+// the state file, and committed in memory only once it is saved.
+package filestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Records is a list of records of type T, persisted to a JSON file when it
+// has a path. It is safe for concurrent use.
+type Records[T any] struct {
+	path string
+
+	mu      sync.Mutex
+	records []T
+	// saveMu serializes updates, so each is written to the state file
+	// before it is committed to records.
+	saveMu sync.Mutex
+}
+
+// Open creates a list, loading path when it exists. An empty path keeps
+// records in memory only.
+func Open[T any](path string) (*Records[T], error) {
+	s := &Records[T]{path: path}
+	if path == "" {
+		return s, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.records); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// All returns a copy of the records.
+func (s *Records[T]) All() []T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]T(nil), s.records...)
+}
+
+// Find returns the first record match accepts.
+func (s *Records[T]) Find(match func(T) bool) (T, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.records {
+		if match(r) {
+			return r, true
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// List returns the records keep accepts, or all when it is nil, in the
+// order less gives them; records that compare equal keep their order.
+func (s *Records[T]) List(keep func(T) bool, less func(a, b T) bool) []T {
+	s.mu.Lock()
+	out := make([]T, 0, len(s.records))
+	for _, r := range s.records {
+		if keep == nil || keep(r) {
+			out = append(out, r)
+		}
+	}
+	s.mu.Unlock()
+	sort.SliceStable(out, func(i, j int) bool { return less(out[i], out[j]) })
+	return out
+}
+
+// Update passes a copy of the records to fn and saves the records it
+// returns, then makes them the list's. When fn or the save fails, the
+// records are left as they were.
+func (s *Records[T]) Update(fn func([]T) ([]T, error)) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	records, err := fn(s.All())
+	if err != nil {
+		return err
+	}
+	if err := s.save(records); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.records = records
+	s.mu.Unlock()
+	return nil
+}
+
+// save writes records to the state file, replacing it atomically.
+func (s *Records[T]) save(records []T) error {
+	if s.path == "" {
+		return nil
+	}
+	data, _ := json.MarshalIndent(records, "", "  ")
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package filestore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type record struct {
+	ID   string `json:"id"`
+	Rank int    `json:"rank"`
+}
+
+func add(r record) func([]record) ([]record, error) {
+	return func(records []record) ([]record, error) { return append(records, r), nil }
+}
+
+func TestRecords_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.json")
+	s, err := Open[record](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []record{{"a", 2}, {"b", 1}, {"c", 2}} {
+		if err := s.Update(add(r)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reloaded, err := Open[record](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byRank := func(a, b record) bool { return a.Rank > b.Rank }
+	if got := reloaded.List(nil, byRank); !reflect.DeepEqual(got, []record{{"a", 2}, {"c", 2}, {"b", 1}}) {
+		t.Errorf("List = %v", got)
+	}
+	if got := reloaded.List(func(r record) bool { return r.Rank == 1 }, byRank); len(got) != 1 || got[0].ID != "b" {
+		t.Errorf("filtered List = %v", got)
+	}
+	if r, ok := reloaded.Find(func(r record) bool { return r.ID == "c" }); !ok || r.Rank != 2 {
+		t.Errorf("Find = %v, %v", r, ok)
+	}
+	if _, ok := reloaded.Find(func(r record) bool { return r.ID == "z" }); ok {
+		t.Error("Find matched a missing record")
+	}
+}
+
+func TestRecords_FailedUpdate(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	os.Mkdir(dir, 0o755)
+	s, err := Open[record](filepath.Join(dir, "records.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Update(add(record{"a", 1}))
+
+	refused := errors.New("refused")
+	if err := s.Update(func([]record) ([]record, error) { return nil, refused }); !errors.Is(err, refused) || len(s.All()) != 1 {
+		t.Errorf("refused update = %v, %d record(s)", err, len(s.All()))
+	}
+	os.RemoveAll(dir)
+	if err := s.Update(add(record{"b", 1})); err == nil || len(s.All()) != 1 {
+		t.Errorf("unsaved update = %v, %d record(s)", err, len(s.All()))
+	}
+	os.Mkdir(dir, 0o755)
+	if err := s.Update(add(record{"b", 1})); err != nil || len(s.All()) != 2 {
+		t.Errorf("retried update = %v, %d record(s)", err, len(s.All()))
+	}
+}
+
+func TestOpen_InMemoryAndInvalid(t *testing.T) {
+	s, err := Open[record]("")
+	if err != nil || s.Update(add(record{"a", 1})) != nil || len(s.All()) != 1 {
+		t.Errorf("in-memory list: %v, %v", err, s.All())
+	}
+	path := filepath.Join(t.TempDir(), "records.json")
+	os.WriteFile(path, []byte("{"), 0o644)
+	if _, err := Open[record](path); err == nil {
+		t.Error("expected an error for an invalid state file")
+	}
+}
@@ -0,0 +1,192 @@
+// Package gateway fronts the agent fleet under a single host, routing
+// /{agent}/* paths to the upstream that serves that agent.
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/buildinfo"
+)
+
+// DefaultAgents lists the agent IDs routed by the gateway when no explicit
+// route table is configured.
+var DefaultAgents = []string{
+	"orchestrator", "policy", "security", "compliance", "cost",
+	"drift", "deploy", "notification", "impact", "module",
+}
+
+// Gateway routes prefixed requests to per-agent upstreams.
+type Gateway struct {
+	routes  map[string]*url.URL
+	proxies map[string]*httputil.ReverseProxy
+}
+
+// New creates a Gateway from a map of agent ID to upstream base URL.
+func New(routes map[string]*url.URL) *Gateway {
+	g := &Gateway{
+		routes:  routes,
+		proxies: make(map[string]*httputil.ReverseProxy, len(routes)),
+	}
+	for id, target := range routes {
+		g.proxies[id] = newProxy(id, target)
+	}
+	return g
+}
+
+// ParseRoutes builds a route table. Every agent in DefaultAgents points at the
+// default upstream; overrides is a comma-separated list of id=url pairs that
+// replace or add entries (e.g. "cost=http://cost:8080,policy=http://policy:8080").
+func ParseRoutes(defaultUpstream, overrides string) (map[string]*url.URL, error) {
+	routes := make(map[string]*url.URL)
+	if defaultUpstream != "" {
+		u, err := parseUpstream(defaultUpstream)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range DefaultAgents {
+			routes[id] = u
+		}
+	}
+	for _, pair := range strings.Split(overrides, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		id, raw, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(id) == "" {
+			return nil, fmt.Errorf("invalid route %q (want id=url)", pair)
+		}
+		u, err := parseUpstream(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, err
+		}
+		routes[strings.TrimSpace(id)] = u
+	}
+	if len(routes) == 0 {
+		return nil, fmt.Errorf("no gateway routes configured")
+	}
+	return routes, nil
+}
+
+func parseUpstream(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream URL %q", raw)
+	}
+	return u, nil
+}
+
+// Agents returns the routed agent IDs in sorted order.
+func (g *Gateway) Agents() []string {
+	ids := make([]string, 0, len(g.routes))
+	for id := range g.routes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// UpstreamVersion is what one upstream reported from GET /version.
+type UpstreamVersion struct {
+	URL string `json:"url"`
+	// Agents lists the agent IDs routed to the upstream.
+	Agents []string        `json:"agents"`
+	Build  *buildinfo.Info `json:"build,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Versions asks every distinct upstream for its build info, so the fleet
+// can be checked from one place. Unreachable upstreams carry the error.
+func (g *Gateway) Versions(ctx context.Context, client *http.Client) []UpstreamVersion {
+	byURL := make(map[string]*UpstreamVersion)
+	for _, id := range g.Agents() {
+		u := g.routes[id].String()
+		if byURL[u] == nil {
+			byURL[u] = &UpstreamVersion{URL: u}
+		}
+		byURL[u].Agents = append(byURL[u].Agents, id)
+	}
+	var wg sync.WaitGroup
+	for _, uv := range byURL {
+		wg.Add(1)
+		go func(uv *UpstreamVersion) {
+			defer wg.Done()
+			info, err := fetchVersion(ctx, client, uv.URL)
+			if err != nil {
+				uv.Error = err.Error()
+				return
+			}
+			uv.Build = info
+		}(uv)
+	}
+	wg.Wait()
+	out := make([]UpstreamVersion, 0, len(byURL))
+	for _, uv := range byURL {
+		out = append(out, *uv)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].URL < out[j].URL })
+	return out
+}
+
+func fetchVersion(ctx context.Context, client *http.Client, upstream string) (*buildinfo.Info, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(upstream, "/")+"/version", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	var info buildinfo.Info
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// ServeHTTP dispatches /{agent} and /{agent}/* to the agent's upstream.
+// A bare /{agent} maps to the upstream's /agent/{agent} chat endpoint; any
+// remaining path is forwarded as-is so agent-specific endpoints stay reachable.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	proxy, ok := g.proxies[id]
+	if !ok {
+		http.Error(w, fmt.Sprintf("Unknown agent route %q", id), http.StatusNotFound)
+		return
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+func newProxy(id string, target *url.URL) *httputil.ReverseProxy {
+	prefix := "/" + id
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			rest := strings.TrimPrefix(pr.In.URL.Path, prefix)
+			if rest == "" || rest == "/" {
+				rest = "/agent/" + id
+			}
+			pr.SetURL(target)
+			pr.Out.URL.Path = strings.TrimSuffix(target.Path, "/") + rest
+			pr.Out.URL.RawPath = ""
+			pr.SetXForwarded()
+		},
+		// Flush immediately so SSE events stream through the gateway.
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			http.Error(w, fmt.Sprintf("Upstream for %s unavailable: %v", id, err), http.StatusBadGateway)
+		},
+	}
+}
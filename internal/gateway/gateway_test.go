@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestParseRoutes_DefaultUpstream(t *testing.T) {
+	routes, err := ParseRoutes("http://localhost:8080", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(routes) != len(DefaultAgents) {
+		t.Errorf("routes = %d, want %d", len(routes), len(DefaultAgents))
+	}
+	if routes["policy"].Host != "localhost:8080" {
+		t.Errorf("policy upstream = %v", routes["policy"])
+	}
+}
+
+func TestParseRoutes_Overrides(t *testing.T) {
+	routes, err := ParseRoutes("http://localhost:8080", "cost=http://cost:9000, custom=http://custom:7000")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if routes["cost"].Host != "cost:9000" {
+		t.Errorf("cost upstream = %v, want cost:9000", routes["cost"])
+	}
+	if routes["custom"] == nil {
+		t.Error("expected custom route to be added")
+	}
+}
+
+func TestParseRoutes_Invalid(t *testing.T) {
+	for _, tc := range []struct{ def, over string }{
+		{"", ""},
+		{"not a url", ""},
+		{"http://localhost", "cost"},
+		{"http://localhost", "cost=nope"},
+	} {
+		if _, err := ParseRoutes(tc.def, tc.over); err == nil {
+			t.Errorf("ParseRoutes(%q, %q) should fail", tc.def, tc.over)
+		}
+	}
+}
+
+func TestGateway_RoutesToUpstream(t *testing.T) {
+	var gotPath string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	u, _ := url.Parse(upstream.URL)
+	g := New(map[string]*url.URL{"policy": u})
+
+	tests := []struct {
+		path, want string
+	}{
+		{"/policy", "/agent/policy"},
+		{"/policy/", "/agent/policy"},
+		{"/policy/check", "/check"},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		g.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tt.path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: status = %d, want 200", tt.path, rr.Code)
+		}
+		if gotPath != tt.want {
+			t.Errorf("%s: upstream path = %q, want %q", tt.path, gotPath, tt.want)
+		}
+	}
+}
+
+func TestGateway_UnknownRoute(t *testing.T) {
+	g := New(map[string]*url.URL{})
+	rr := httptest.NewRecorder()
+	g.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/unknown", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rr.Code)
+	}
+}
+
+func TestGateway_UpstreamDown(t *testing.T) {
+	u, _ := url.Parse("http://127.0.0.1:1")
+	g := New(map[string]*url.URL{"cost": u})
+	rr := httptest.NewRecorder()
+	g.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/cost", nil))
+	if rr.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want 502", rr.Code)
+	}
+}
+
+func TestGateway_Agents(t *testing.T) {
+	u, _ := url.Parse("http://localhost")
+	g := New(map[string]*url.URL{"security": u, "cost": u})
+	ids := g.Agents()
+	if len(ids) != 2 || ids[0] != "cost" || ids[1] != "security" {
+		t.Errorf("Agents() = %v, want [cost security]", ids)
+	}
+}
+
+func TestGateway_Versions(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/version" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, `{"service":"ghcp-iac-agent-host","version":"v1.4.0","commit":"abc1234","platform":"linux/arm64"}`)
+	}))
+	defer upstream.Close()
+
+	up, _ := url.Parse(upstream.URL)
+	down, _ := url.Parse("http://127.0.0.1:1")
+	g := New(map[string]*url.URL{"policy": up, "security": up, "cost": down})
+	versions := g.Versions(context.Background(), http.DefaultClient)
+	if len(versions) != 2 {
+		t.Fatalf("versions = %+v, want one per upstream", versions)
+	}
+	for _, v := range versions {
+		switch v.URL {
+		case upstream.URL:
+			if v.Build == nil || v.Build.Version != "v1.4.0" || v.Build.Platform != "linux/arm64" || len(v.Agents) != 2 {
+				t.Errorf("upstream version = %+v", v)
+			}
+		default:
+			if v.Error == "" || v.Build != nil || len(v.Agents) != 1 || v.Agents[0] != "cost" {
+				t.Errorf("down upstream = %+v", v)
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package graph
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Diff is the change between two graphs.
+type Diff struct {
+	AddedNodes   []Node `json:"added_nodes"`
+	RemovedNodes []Node `json:"removed_nodes"`
+	AddedEdges   []Edge `json:"added_edges"`
+	RemovedEdges []Edge `json:"removed_edges"`
+	// Before and After are the blast radius of each graph.
+	Before int `json:"blast_radius_before"`
+	After  int `json:"blast_radius_after"`
+	Delta  int `json:"blast_radius_delta"`
+	// ChangedWeight sums the weights of every node added, removed, or at
+	// either end of an added/removed edge — the part of the graph a review
+	// needs to look at.
+	ChangedWeight int `json:"changed_weight"`
+	// Moved and Imported echo the Refactor the diff was computed with.
+	Moved    map[string]string `json:"moved,omitempty"`
+	Imported []string          `json:"imported,omitempty"`
+
+	before, after Graph
+}
+
+// Refactor describes address changes that leave infrastructure untouched:
+// Terraform moved blocks (old node ID → new node ID) and import blocks
+// (node IDs adopting existing infrastructure).
+type Refactor struct {
+	Moved    map[string]string
+	Imported map[string]bool
+}
+
+// Compare diffs before against after.
+func Compare(before, after Graph) Diff {
+	return CompareRefactored(before, after, Refactor{})
+}
+
+// CompareRefactored is Compare with before's nodes renamed per r.Moved, so
+// a pure rename isn't reported as a removal plus an addition. Imported
+// nodes still show as added but don't count towards ChangedWeight, since
+// nothing is created.
+func CompareRefactored(before, after Graph, r Refactor) Diff {
+	before = before.Rename(r.Moved)
+	d := Diff{Before: before.BlastRadius(), After: after.BlastRadius(), before: before, after: after}
+	if len(r.Moved) > 0 {
+		d.Moved = r.Moved
+	}
+	for id := range r.Imported {
+		d.Imported = append(d.Imported, id)
+	}
+	sort.Strings(d.Imported)
+	d.Delta = d.After - d.Before
+
+	beforeNodes := nodeSet(before)
+	afterNodes := nodeSet(after)
+	for _, n := range after.Nodes {
+		if _, ok := beforeNodes[n.ID]; !ok {
+			d.AddedNodes = append(d.AddedNodes, n)
+		}
+	}
+	for _, n := range before.Nodes {
+		if _, ok := afterNodes[n.ID]; !ok {
+			d.RemovedNodes = append(d.RemovedNodes, n)
+		}
+	}
+
+	beforeEdges := edgeSet(before)
+	afterEdges := edgeSet(after)
+	for _, e := range after.Edges {
+		if !beforeEdges[e] {
+			d.AddedEdges = append(d.AddedEdges, e)
+		}
+	}
+	for _, e := range before.Edges {
+		if !afterEdges[e] {
+			d.RemovedEdges = append(d.RemovedEdges, e)
+		}
+	}
+
+	touched := make(map[string]int)
+	for _, n := range d.AddedNodes {
+		if !r.Imported[n.ID] {
+			touched[n.ID] = n.Weight
+		}
+	}
+	for _, n := range d.RemovedNodes {
+		touched[n.ID] = n.Weight
+	}
+	for _, e := range append(append([]Edge(nil), d.AddedEdges...), d.RemovedEdges...) {
+		for _, id := range []string{e.From, e.To} {
+			if n, ok := afterNodes[id]; ok {
+				touched[id] = n.Weight
+			} else if n, ok := beforeNodes[id]; ok {
+				touched[id] = n.Weight
+			}
+		}
+	}
+	for id := range r.Imported {
+		delete(touched, id)
+	}
+	for _, w := range touched {
+		d.ChangedWeight += w
+	}
+	return d
+}
+
+// Empty reports whether nothing changed.
+func (d Diff) Empty() bool {
+	return len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 && len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0
+}
+
+// Summary is a one-line description, e.g. "+2 / -1 resources, +3 / -0
+// dependencies, blast radius 12 → 18 (+6)", noting moved and imported
+// resources when there are any.
+func (d Diff) Summary() string {
+	s := fmt.Sprintf("+%d / -%d resources, +%d / -%d dependencies, blast radius %d → %d (%+d)",
+		len(d.AddedNodes), len(d.RemovedNodes), len(d.AddedEdges), len(d.RemovedEdges), d.Before, d.After, d.Delta)
+	if len(d.Moved) > 0 || len(d.Imported) > 0 {
+		s += fmt.Sprintf("; %d moved, %d imported", len(d.Moved), len(d.Imported))
+	}
+	return s
+}
+
+var mermaidIDRe = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// Mermaid renders the union of both graphs as a Mermaid flowchart for PR
+// comments: added resources and dependencies in green (thick arrows),
+// removed ones in red (dotted arrows), unchanged ones plain.
+func (d Diff) Mermaid() string {
+	var sb strings.Builder
+	sb.WriteString("graph LR\n")
+	sb.WriteString("  classDef added fill:#d4edda,stroke:#28a745\n")
+	sb.WriteString("  classDef removed fill:#f8d7da,stroke:#dc3545,stroke-dasharray:5 5\n")
+
+	added := nodeSet(Graph{Nodes: d.AddedNodes})
+	removed := nodeSet(Graph{Nodes: d.RemovedNodes})
+	for _, n := range append(append([]Node(nil), d.after.Nodes...), d.RemovedNodes...) {
+		line := fmt.Sprintf("  %s[\"%s\"]", mermaidID(n.ID), n.Label())
+		if _, ok := added[n.ID]; ok {
+			line += ":::added"
+		} else if _, ok := removed[n.ID]; ok {
+			line += ":::removed"
+		}
+		sb.WriteString(line + "\n")
+	}
+
+	addedEdges := edgeSet(Graph{Edges: d.AddedEdges})
+	for _, e := range d.after.Edges {
+		arrow := "-->"
+		if addedEdges[e] {
+			arrow = "==>|added|"
+		}
+		sb.WriteString(fmt.Sprintf("  %s %s %s\n", mermaidID(e.From), arrow, mermaidID(e.To)))
+	}
+	for _, e := range d.RemovedEdges {
+		sb.WriteString(fmt.Sprintf("  %s -.->|removed| %s\n", mermaidID(e.From), mermaidID(e.To)))
+	}
+	return sb.String()
+}
+
+func mermaidID(id string) string {
+	return "n_" + mermaidIDRe.ReplaceAllString(id, "_")
+}
+
+func nodeSet(g Graph) map[string]Node {
+	m := make(map[string]Node, len(g.Nodes))
+	for _, n := range g.Nodes {
+		m[n.ID] = n
+	}
+	return m
+}
+
+func edgeSet(g Graph) map[Edge]bool {
+	m := make(map[Edge]bool, len(g.Edges))
+	for _, e := range g.Edges {
+		m[e] = true
+	}
+	return m
+}
@@ -0,0 +1,139 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+const (
+	// minTimingSamples is how many recorded applies of a resource type and
+	// action it takes before their median replaces the heuristic.
+	minTimingSamples = 3
+	// windowBuffer is added to a maintenance window for validation and, if
+	// needed, rolling back.
+	windowBuffer = 15 * time.Minute
+	// windowStep is what maintenance windows are rounded up to.
+	windowStep = 15 * time.Minute
+)
+
+// TimingFunc returns the median of recorded apply durations for a
+// resource type and planned action, and how many were recorded.
+type TimingFunc func(resourceType, action string) (median time.Duration, samples int)
+
+// ApplyItem is the estimated apply time of one resource.
+type ApplyItem struct {
+	ID       string        `json:"id"`
+	Action   string        `json:"action"`
+	Duration time.Duration `json:"duration"`
+	// Samples is the number of recorded applies the estimate is the median
+	// of; zero when it is the per-type heuristic.
+	Samples int `json:"samples,omitempty"`
+}
+
+// ApplyEstimate is how long applying a change is expected to take.
+type ApplyEstimate struct {
+	Items []ApplyItem `json:"items"`
+	// Total is the longest chain of dependent resources: independent
+	// resources are applied in parallel.
+	Total time.Duration `json:"total"`
+	// Window is the suggested maintenance window for the change.
+	Window time.Duration `json:"window"`
+}
+
+// EstimateApply estimates the apply time of each resource that changes,
+// from recorded history when history has enough samples and from
+// analyzer.ApplyDuration otherwise. Resources without a planned change
+// are treated as created; no-ops are left out. history may be nil.
+func EstimateApply(resources []protocol.Resource, history TimingFunc) ApplyEstimate {
+	var est ApplyEstimate
+	durations := make(map[string]time.Duration)
+	for _, res := range resources {
+		action := protocol.ActionCreate
+		if res.Change != nil {
+			action = res.Change.Action
+		}
+		if action == protocol.ActionNoOp {
+			continue
+		}
+		item := ApplyItem{ID: res.Type + "." + res.Name, Action: action, Duration: analyzer.ApplyDuration(res.Type, action)}
+		if history != nil {
+			if median, n := history(res.Type, action); n >= minTimingSamples {
+				item.Duration, item.Samples = median, n
+			}
+		}
+		if _, dup := durations[item.ID]; dup {
+			continue
+		}
+		durations[item.ID] = item.Duration
+		est.Items = append(est.Items, item)
+	}
+	est.Total = Build(resources).criticalPath(durations)
+	est.Window = MaintenanceWindow(est.Total)
+	return est
+}
+
+// MaintenanceWindow suggests a window for an apply expected to take d:
+// half as long again, plus a buffer for validation and rollback, rounded
+// up to a quarter hour.
+func MaintenanceWindow(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	w := d + d/2 + windowBuffer
+	return (w + windowStep - 1) / windowStep * windowStep
+}
+
+// criticalPath returns the longest sum of durations along a dependency
+// chain. Nodes missing from durations take no time; cycles are broken.
+func (g Graph) criticalPath(durations map[string]time.Duration) time.Duration {
+	deps := make(map[string][]string)
+	for _, e := range g.Edges {
+		deps[e.From] = append(deps[e.From], e.To)
+	}
+	finish := make(map[string]time.Duration)
+	visiting := make(map[string]bool)
+	var visit func(id string) time.Duration
+	visit = func(id string) time.Duration {
+		if d, ok := finish[id]; ok {
+			return d
+		}
+		if visiting[id] {
+			return 0
+		}
+		visiting[id] = true
+		var start time.Duration
+		for _, dep := range deps[id] {
+			start = max(start, visit(dep))
+		}
+		visiting[id] = false
+		finish[id] = start + durations[id]
+		return finish[id]
+	}
+	var total time.Duration
+	for _, n := range g.Nodes {
+		total = max(total, visit(n.ID))
+	}
+	return total
+}
+
+// Summary describes the estimate in one line.
+func (e ApplyEstimate) Summary() string {
+	return fmt.Sprintf("~%s to apply; suggested maintenance window %s", FormatDuration(e.Total), FormatDuration(e.Window))
+}
+
+// FormatDuration writes d to the minute, e.g. "45m" or "1h30m"; anything
+// shorter than a minute is "<1m".
+func FormatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return "<1m"
+	}
+	s := strings.TrimSuffix(d.Round(time.Minute).String(), "0s")
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,181 @@
+// Package graph builds resource dependency graphs from parsed IaC and diffs
+// them between two analyses (e.g. before and after a pull request).
+package graph
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Node is one resource. ID is "type.name".
+type Node struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// Label is the short display name, e.g. "storage_account.logs".
+func (n Node) Label() string {
+	return parser.ShortType(n.Type) + "." + n.Name
+}
+
+// Edge means From references (depends on) To.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Graph is a resource dependency graph.
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+var (
+	tfHeadRe    = regexp.MustCompile(`^resource\s+"([^"]+)"\s+"([^"]+)"`)
+	bicepHeadRe = regexp.MustCompile(`^resource\s+\w+\s+'`)
+)
+
+// Build derives the graph from resources. References in the expressions
+// of a resource body become edges: Terraform resource addresses
+// ("azurerm_subnet.app.id", "${azurerm_subnet.app.name}", depends_on) and
+// Bicep symbols ("vnet.id", "parent: vnet", dependsOn). Addresses in
+// comments and string literals, and data source or module outputs of the
+// same name, are not references.
+func Build(resources []protocol.Resource) Graph {
+	var g Graph
+	ids := make(map[string]bool, len(resources))
+	// addresses maps the Terraform address of each resource to its node,
+	// which differs for azapi_resource blocks reported under their ARM type.
+	addresses := make(map[string]string, len(resources))
+	bicepSymbols := make(map[string]string)
+	for _, res := range resources {
+		n := Node{ID: res.Type + "." + res.Name, Type: res.Type, Name: res.Name, Weight: analyzer.ResourceRiskWeight(res.Type)}
+		if ids[n.ID] {
+			continue
+		}
+		ids[n.ID] = true
+		g.Nodes = append(g.Nodes, n)
+		addresses[n.ID] = n.ID
+		if m := tfHeadRe.FindStringSubmatch(res.RawBlock); m != nil {
+			addresses[m[1]+"."+m[2]] = n.ID
+		}
+		if bicepHeadRe.MatchString(res.RawBlock) {
+			bicepSymbols[res.Name] = n.ID
+		}
+	}
+
+	seen := make(map[Edge]bool)
+	for _, res := range resources {
+		from := res.Type + "." + res.Name
+		body := res.RawBlock
+		if i := strings.IndexByte(body, '\n'); i >= 0 {
+			body = body[i+1:]
+		} else {
+			body = ""
+		}
+		var targets []string
+		if bicepHeadRe.MatchString(res.RawBlock) {
+			for _, sym := range bicepRefs(body) {
+				if id, ok := bicepSymbols[sym]; ok {
+					targets = append(targets, id)
+				}
+			}
+		} else {
+			for _, addr := range terraformRefs(body) {
+				if id, ok := addresses[addr]; ok {
+					targets = append(targets, id)
+				}
+			}
+		}
+		for _, to := range targets {
+			e := Edge{From: from, To: to}
+			if to == from || seen[e] {
+				continue
+			}
+			seen[e] = true
+			g.Edges = append(g.Edges, e)
+		}
+	}
+	g.sort()
+	return g
+}
+
+// Rename returns a copy of g with node IDs (and the edges between them)
+// replaced per renames, e.g. from Terraform moved blocks.
+func (g Graph) Rename(renames map[string]string) Graph {
+	if len(renames) == 0 {
+		return g
+	}
+	rename := func(id string) string {
+		if to, ok := renames[id]; ok {
+			return to
+		}
+		return id
+	}
+	out := Graph{Nodes: make([]Node, 0, len(g.Nodes)), Edges: make([]Edge, 0, len(g.Edges))}
+	for _, n := range g.Nodes {
+		if to, ok := renames[n.ID]; ok {
+			n.ID = to
+			if typ, name, ok := strings.Cut(to, "."); ok {
+				n.Type, n.Name = typ, name
+			}
+		}
+		out.Nodes = append(out.Nodes, n)
+	}
+	for _, e := range g.Edges {
+		out.Edges = append(out.Edges, Edge{From: rename(e.From), To: rename(e.To)})
+	}
+	out.sort()
+	return out
+}
+
+func (g *Graph) sort() {
+	sort.Slice(g.Nodes, func(i, j int) bool { return g.Nodes[i].ID < g.Nodes[j].ID })
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+}
+
+// BlastRadius is the summed risk weight of every node, matching the impact
+// agent's total.
+func (g Graph) BlastRadius() int {
+	total := 0
+	for _, n := range g.Nodes {
+		total += n.Weight
+	}
+	return total
+}
+
+// Dependents returns the IDs of the nodes that depend on id, directly or
+// through other nodes, sorted.
+func (g Graph) Dependents(id string) []string {
+	referrers := make(map[string][]string)
+	for _, e := range g.Edges {
+		referrers[e.To] = append(referrers[e.To], e.From)
+	}
+	seen := map[string]bool{id: true}
+	queue := []string{id}
+	var out []string
+	for len(queue) > 0 {
+		for _, from := range referrers[queue[0]] {
+			if !seen[from] {
+				seen[from] = true
+				out = append(out, from)
+				queue = append(queue, from)
+			}
+		}
+		queue = queue[1:]
+	}
+	sort.Strings(out)
+	return out
+}
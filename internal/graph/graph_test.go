@@ -0,0 +1,264 @@
+package graph
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+const beforeTF = `resource "azurerm_virtual_network" "main" {
+  name = "vnet"
+}
+
+resource "azurerm_subnet" "app" {
+  name                 = "app"
+  virtual_network_name = azurerm_virtual_network.main.name
+}
+
+resource "azurerm_storage_account" "logs" {
+  name = "logs"
+}
+`
+
+const afterTF = `resource "azurerm_virtual_network" "main" {
+  name = "vnet"
+}
+
+resource "azurerm_subnet" "app" {
+  name                 = "app"
+  virtual_network_name = azurerm_virtual_network.main.name
+}
+
+resource "azurerm_kubernetes_cluster" "aks" {
+  name           = "aks"
+  vnet_subnet_id = azurerm_subnet.app.id
+}
+`
+
+func TestBuild_TerraformReferences(t *testing.T) {
+	g := Build(parser.ParseResources(afterTF))
+	if len(g.Nodes) != 3 {
+		t.Fatalf("nodes = %+v, want 3", g.Nodes)
+	}
+	want := []Edge{
+		{From: "azurerm_kubernetes_cluster.aks", To: "azurerm_subnet.app"},
+		{From: "azurerm_subnet.app", To: "azurerm_virtual_network.main"},
+	}
+	if len(g.Edges) != len(want) || g.Edges[0] != want[0] || g.Edges[1] != want[1] {
+		t.Errorf("edges = %+v, want %+v", g.Edges, want)
+	}
+}
+
+func TestBuild_NoFalseEdges(t *testing.T) {
+	code := `resource "azurerm_virtual_network" "main" {
+  name = "vnet"
+}
+
+resource "azurerm_subnet" "app" {
+  # Was azurerm_virtual_network.main before the split.
+  name                 = "azurerm_virtual_network.main"
+  virtual_network_name = data.azurerm_virtual_network.main.name
+  address_prefixes     = module.azurerm_virtual_network.main
+}
+
+resource "azurerm_network_security_group" "app" {
+  name        = "nsg-${azurerm_subnet.app.name}"
+  description = <<-EOT
+    Guards azurerm_virtual_network.main, escaped $${azurerm_subnet.app.id}.
+  EOT
+  depends_on  = [azurerm_virtual_network.main]
+}
+
+resource "azapi_resource" "pe" {
+  type      = "Microsoft.Network/privateEndpoints@2023-04-01"
+  name      = "pe"
+  parent_id = azurerm_network_security_group.app.id
+}
+
+resource "azurerm_private_dns_zone_group" "pe" {
+  private_endpoint_id = azapi_resource.pe.id
+}
+`
+	g := Build(parser.ParseResources(code))
+	got := make(map[string]bool)
+	for _, e := range g.Edges {
+		got[e.From+" -> "+e.To] = true
+	}
+	for _, want := range []string{
+		"azurerm_network_security_group.app -> azurerm_subnet.app",
+		"azurerm_network_security_group.app -> azurerm_virtual_network.main",
+	} {
+		if !got[want] {
+			t.Errorf("missing edge %s in %+v", want, g.Edges)
+		}
+	}
+	for e := range got {
+		if strings.HasPrefix(e, "azurerm_subnet.app ->") {
+			t.Errorf("comments, strings, data sources and module outputs are not references: %s", e)
+		}
+	}
+	if len(g.Edges) != 4 {
+		t.Errorf("edges = %+v, want 4 (including the azapi_resource address)", g.Edges)
+	}
+}
+
+func TestGraph_Dependents(t *testing.T) {
+	g := Build(parser.ParseResources(afterTF))
+	got := g.Dependents("azurerm_virtual_network.main")
+	if len(got) != 2 || got[0] != "azurerm_kubernetes_cluster.aks" || got[1] != "azurerm_subnet.app" {
+		t.Errorf("dependents = %v, want the subnet and, through it, the cluster", got)
+	}
+	if got := g.Dependents("azurerm_kubernetes_cluster.aks"); len(got) != 0 {
+		t.Errorf("nothing depends on the cluster: %v", got)
+	}
+}
+
+func TestBuild_BicepSymbols(t *testing.T) {
+	code := `resource vnet 'Microsoft.Network/virtualNetworks@2023-04-01' = {
+  name: 'vnet'
+}
+
+resource aks 'Microsoft.ContainerService/managedClusters@2023-01-01' = {
+  name: 'aks'
+  dependsOn: [
+    vnet
+  ]
+}
+`
+	g := Build(parser.ParseResources(code))
+	if len(g.Edges) != 1 || g.Edges[0].From != "azurerm_kubernetes_cluster.aks" || g.Edges[0].To != "azurerm_virtual_network.vnet" {
+		t.Errorf("edges = %+v, want aks -> vnet", g.Edges)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	before := Build(parser.ParseResources(beforeTF))
+	after := Build(parser.ParseResources(afterTF))
+	d := Compare(before, after)
+
+	if len(d.AddedNodes) != 1 || d.AddedNodes[0].ID != "azurerm_kubernetes_cluster.aks" {
+		t.Errorf("added nodes = %+v", d.AddedNodes)
+	}
+	if len(d.RemovedNodes) != 1 || d.RemovedNodes[0].ID != "azurerm_storage_account.logs" {
+		t.Errorf("removed nodes = %+v", d.RemovedNodes)
+	}
+	if len(d.AddedEdges) != 1 || len(d.RemovedEdges) != 0 {
+		t.Errorf("edges added=%+v removed=%+v", d.AddedEdges, d.RemovedEdges)
+	}
+	// vnet(3)+subnet(2)+storage(4)=9 -> vnet+subnet+aks(8)=13
+	if d.Before != 9 || d.After != 13 || d.Delta != 4 {
+		t.Errorf("blast radius %d -> %d (%+d), want 9 -> 13 (+4)", d.Before, d.After, d.Delta)
+	}
+	// aks(8) + storage(4) + subnet(2) at the end of the new edge
+	if d.ChangedWeight != 14 {
+		t.Errorf("ChangedWeight = %d, want 14", d.ChangedWeight)
+	}
+
+	m := d.Mermaid()
+	for _, want := range []string{
+		`n_azurerm_kubernetes_cluster_aks["kubernetes_cluster.aks"]:::added`,
+		`n_azurerm_storage_account_logs["storage_account.logs"]:::removed`,
+		`n_azurerm_kubernetes_cluster_aks ==>|added| n_azurerm_subnet_app`,
+		`n_azurerm_subnet_app --> n_azurerm_virtual_network_main`,
+	} {
+		if !strings.Contains(m, want) {
+			t.Errorf("mermaid missing %q:\n%s", want, m)
+		}
+	}
+}
+
+func TestStore_EvictsOldest(t *testing.T) {
+	s := NewStore(2)
+	res := parser.ParseResources(beforeTF)
+	for _, id := range []string{"a", "b", "c"} {
+		s.Observe("impact", protocol.AgentRequest{
+			IaC:      &protocol.IaCInput{Resources: res},
+			Metadata: map[string]string{protocol.MetaJobID: id},
+		}, nil)
+	}
+	if _, ok := s.Get("a"); ok {
+		t.Error("oldest analysis should be evicted")
+	}
+	if a, ok := s.Get("c"); !ok || len(a.Graph.Nodes) != 3 {
+		t.Errorf("Get(c) = %+v, %v", a, ok)
+	}
+}
+
+func TestCompareRefactored(t *testing.T) {
+	before := Build(parser.ParseTerraform(`resource "azurerm_subnet" "old" {
+  name = "snet"
+}`))
+	after := Build(parser.ParseTerraform(`resource "azurerm_subnet" "app" {
+  name = "snet"
+}
+
+resource "azurerm_key_vault" "kv" {
+  name = "kv"
+}`))
+
+	plain := Compare(before, after)
+	if len(plain.AddedNodes) != 2 || len(plain.RemovedNodes) != 1 {
+		t.Fatalf("plain diff = %s", plain.Summary())
+	}
+
+	d := CompareRefactored(before, after, Refactor{
+		Moved:    map[string]string{"azurerm_subnet.old": "azurerm_subnet.app"},
+		Imported: map[string]bool{"azurerm_key_vault.kv": true},
+	})
+	if len(d.RemovedNodes) != 0 || len(d.AddedNodes) != 1 || d.AddedNodes[0].ID != "azurerm_key_vault.kv" {
+		t.Errorf("refactored diff = %+v", d)
+	}
+	if d.ChangedWeight != 0 {
+		t.Errorf("ChangedWeight = %d, want 0 for a rename plus an import", d.ChangedWeight)
+	}
+	if !strings.Contains(d.Summary(), "1 moved, 1 imported") {
+		t.Errorf("summary = %q", d.Summary())
+	}
+}
+
+func TestEstimateApply(t *testing.T) {
+	resources := parser.ParseResources(afterTF)
+	est := EstimateApply(resources, nil)
+	if len(est.Items) != 3 {
+		t.Fatalf("items = %+v", est.Items)
+	}
+	// aks (10m) waits for subnet and vnet (30s each).
+	if est.Total != 11*time.Minute || est.Window != 45*time.Minute {
+		t.Errorf("total = %v, window = %v; want 11m on the dependency chain and a 45m window", est.Total, est.Window)
+	}
+
+	history := func(resourceType, action string) (time.Duration, int) {
+		if resourceType == "azurerm_kubernetes_cluster" && action == protocol.ActionCreate {
+			return 20 * time.Minute, 3
+		}
+		return time.Hour, 2 // too few samples to trust
+	}
+	est = EstimateApply(resources, history)
+	if est.Total != 21*time.Minute || est.Summary() != "~21m to apply; suggested maintenance window 1h" {
+		t.Errorf("with history: %v, %q", est.Total, est.Summary())
+	}
+	if est.Items[2].Samples != 3 || est.Items[0].Samples != 0 {
+		t.Errorf("samples = %+v", est.Items)
+	}
+
+	resources[2].Change = &protocol.Change{Action: protocol.ActionNoOp}
+	if est := EstimateApply(resources, nil); len(est.Items) != 2 || est.Total != time.Minute {
+		t.Errorf("no-op resources should take no time: %+v", est)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	for d, want := range map[time.Duration]string{
+		20 * time.Second:             "<1m",
+		45 * time.Minute:             "45m",
+		time.Hour:                    "1h",
+		90*time.Minute + time.Second: "1h30m",
+	} {
+		if got := FormatDuration(d); got != want {
+			t.Errorf("FormatDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package graph
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// tfTraversalRe matches the first two steps of a root traversal
+	// ("azurerm_subnet.app" in "azurerm_subnet.app[0].id"), not steps
+	// further along one ("data.azurerm_subnet.app", "module.net.subnet").
+	tfTraversalRe = regexp.MustCompile(`(?:^|[^\w.\])])([a-z][a-z0-9_]*)\.([A-Za-z_][\w-]*)`)
+	identRe       = regexp.MustCompile(`[A-Za-z_]\w*`)
+	heredocRe     = regexp.MustCompile(`^<<-?([A-Za-z_]\w*)[ \t]*\r?\n`)
+)
+
+// terraformRefs returns the resource addresses ("type.name") that the
+// expressions of a Terraform block body refer to, including depends_on
+// entries and "${...}" interpolations. Comments and literal string text
+// are not expressions, so addresses mentioned there are not references.
+func terraformRefs(body string) []string {
+	var refs []string
+	for _, m := range tfTraversalRe.FindAllStringSubmatch(expressions(body, '"'), -1) {
+		refs = append(refs, m[1]+"."+m[2])
+	}
+	return refs
+}
+
+// bicepRefs returns the identifiers that the expressions of a Bicep
+// resource body use as values: "vnet" in "vnet.id", "parent: vnet" or
+// dependsOn, but not property names ("name:") or accesses ("x.vnet").
+func bicepRefs(body string) []string {
+	code := expressions(body, '\'')
+	var refs []string
+	for _, loc := range identRe.FindAllStringIndex(code, -1) {
+		if loc[0] > 0 && (code[loc[0]-1] == '.' || isWordByte(code[loc[0]-1])) {
+			continue
+		}
+		if loc[1] < len(code) && code[loc[1]] == ':' {
+			continue
+		}
+		refs = append(refs, code[loc[0]:loc[1]])
+	}
+	return refs
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// expressions returns code with comments removed and the literal text of
+// strings blanked, keeping the expressions of template interpolations
+// ("${...}"). quote is '"' for Terraform, which also has "#" comments and
+// heredocs, and a single quote for Bicep.
+func expressions(code string, quote byte) string {
+	l := lexer{src: code, quote: quote}
+	l.code(0, false)
+	return l.out.String()
+}
+
+type lexer struct {
+	src   string
+	quote byte
+	out   strings.Builder
+}
+
+// code copies expressions from i. Nested in an interpolation, it stops
+// after the "}" closing it. It returns the index it stopped at.
+func (l *lexer) code(i int, nested bool) int {
+	depth := 0
+	for i < len(l.src) {
+		rest := l.src[i:]
+		c := l.src[i]
+		switch {
+		case l.quote == '\'' && strings.HasPrefix(rest, "'''"):
+			// Bicep multi-line strings have no interpolation.
+			end := strings.Index(rest[3:], "'''")
+			if end < 0 {
+				return len(l.src)
+			}
+			l.out.WriteByte(' ')
+			i += end + 6
+			continue
+		case c == l.quote:
+			l.out.WriteByte(' ')
+			i = l.str(i + 1)
+			continue
+		case strings.HasPrefix(rest, "//") || (c == '#' && l.quote == '"'):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				return len(l.src)
+			}
+			i += end
+			continue
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return len(l.src)
+			}
+			l.out.WriteByte(' ')
+			i += end + 4
+			continue
+		case l.quote == '"' && strings.HasPrefix(rest, "<<"):
+			if m := heredocRe.FindStringSubmatch(rest); m != nil {
+				l.out.WriteString(" \n")
+				i = l.heredoc(i+len(m[0]), m[1])
+				continue
+			}
+		case c == '{':
+			depth++
+		case c == '}':
+			if nested && depth == 0 {
+				l.out.WriteByte(' ')
+				return i + 1
+			}
+			depth--
+		}
+		l.out.WriteByte(c)
+		i++
+	}
+	return i
+}
+
+// str skips the literal text of a string starting at i, copying its
+// interpolations, and returns the index after the closing quote.
+func (l *lexer) str(i int) int {
+	for i < len(l.src) {
+		rest := l.src[i:]
+		switch {
+		case rest[0] == '\\':
+			i += 2
+		case rest[0] == l.quote:
+			l.out.WriteByte(' ')
+			return i + 1
+		case strings.HasPrefix(rest, "$${"):
+			// An escaped, literal "${".
+			i += 3
+		case strings.HasPrefix(rest, "${"):
+			l.out.WriteByte(' ')
+			i = l.code(i+2, true)
+		case rest[0] == '\n':
+			// Unterminated; don't swallow the rest of the block.
+			return i
+		default:
+			i++
+		}
+	}
+	return i
+}
+
+// heredoc skips the literal text of a heredoc body starting at i, copying
+// its interpolations, and returns the index after the line closing it.
+func (l *lexer) heredoc(i int, marker string) int {
+	lineStart := true
+	for i < len(l.src) {
+		rest := l.src[i:]
+		if lineStart {
+			line, _, _ := strings.Cut(rest, "\n")
+			if strings.TrimSpace(line) == marker {
+				return i + len(line)
+			}
+			lineStart = false
+		}
+		switch {
+		case strings.HasPrefix(rest, "$${"):
+			i += 3
+		case strings.HasPrefix(rest, "${"):
+			l.out.WriteByte(' ')
+			i = l.code(i+2, true)
+		case rest[0] == '\n':
+			l.out.WriteByte('\n')
+			lineStart = true
+			i++
+		default:
+			i++
+		}
+	}
+	return i
+}
@@ -0,0 +1,68 @@
+package graph
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// DefaultStoreSize is how many analyses a Store keeps.
+const DefaultStoreSize = 200
+
+// Analysis is a stored graph for one analysis run.
+type Analysis struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Graph   Graph     `json:"graph"`
+}
+
+// Store keeps the graphs of recent analyses in memory, evicting the oldest
+// beyond its size.
+type Store struct {
+	mu      sync.Mutex
+	entries map[string]Analysis
+	order   []string
+	size    int
+	now     func() time.Time
+}
+
+// NewStore creates a Store holding up to size analyses.
+func NewStore(size int) *Store {
+	if size < 1 {
+		size = DefaultStoreSize
+	}
+	return &Store{entries: make(map[string]Analysis), size: size, now: time.Now}
+}
+
+// Put stores the graph of resources under id.
+func (s *Store) Put(id string, resources []protocol.Resource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[id]; !ok {
+		s.order = append(s.order, id)
+	}
+	s.entries[id] = Analysis{ID: id, Created: s.now(), Graph: Build(resources)}
+	for len(s.order) > s.size {
+		delete(s.entries, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// Get returns a stored analysis.
+func (s *Store) Get(id string) (Analysis, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.entries[id]
+	return a, ok
+}
+
+// Observe is a host.Observer that stores the graph of every request with
+// parsed IaC under its protocol.MetaJobID, so later requests can diff
+// against it.
+func (s *Store) Observe(_ string, req protocol.AgentRequest, _ protocol.Emitter) (protocol.Emitter, func(error)) {
+	if id := req.Metadata[protocol.MetaJobID]; id != "" && req.IaC != nil && len(req.IaC.Resources) > 0 {
+		s.Put(id, req.IaC.Resources)
+	}
+	return nil, nil
+}
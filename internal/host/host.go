@@ -3,7 +3,10 @@ package host
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
@@ -47,10 +50,47 @@ func (r *Registry) List() []protocol.AgentMetadata {
 	return metas
 }
 
+// WarmUp warms every agent implementing protocol.Warmer, in turn, and
+// returns how many it warmed. Failures are joined; an agent that fails to
+// warm up still serves, only without the head start.
+func (r *Registry) WarmUp(ctx context.Context) (int, error) {
+	r.mu.RLock()
+	agents := make([]protocol.Agent, 0, len(r.agents))
+	for _, a := range r.agents {
+		agents = append(agents, a)
+	}
+	r.mu.RUnlock()
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID() < agents[j].ID() })
+
+	warmed := 0
+	var errs []error
+	for _, a := range agents {
+		w, ok := a.(protocol.Warmer)
+		if !ok {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return warmed, err
+		}
+		if err := w.WarmUp(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", a.ID(), err))
+			continue
+		}
+		warmed++
+	}
+	return warmed, errors.Join(errs...)
+}
+
+// Observer is notified when a request is dispatched. It may return a wrapped
+// emitter for the agent to write to, and a finish callback invoked with the
+// agent's result once Handle returns.
+type Observer func(agentID string, req protocol.AgentRequest, emit protocol.Emitter) (protocol.Emitter, func(err error))
+
 // Dispatcher routes requests to agents via the registry.
 type Dispatcher struct {
 	registry  *Registry
 	defaultID string
+	observers []Observer
 }
 
 // NewDispatcher creates a new Dispatcher.
@@ -63,6 +103,55 @@ func (d *Dispatcher) SetDefault(id string) {
 	d.defaultID = id
 }
 
+// DefaultID returns the agent used when a request names none.
+func (d *Dispatcher) DefaultID() string {
+	return d.defaultID
+}
+
+// Observe registers an Observer that wraps every subsequent dispatch.
+func (d *Dispatcher) Observe(o Observer) {
+	d.observers = append(d.observers, o)
+}
+
+// ErrReadOnly is returned for a request that would change state when it
+// is dispatched on a read-only surface.
+var ErrReadOnly = errors.New("request changes state and is only served on the admin listener")
+
+type readOnlyKey struct{}
+
+// WithReadOnly marks ctx as serving the read-only surface: requests that
+// their agent reports as mutating (see protocol.Mutator) are refused.
+func WithReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readOnlyKey{}, true)
+}
+
+// ReadOnly reports whether ctx serves the read-only surface.
+func ReadOnly(ctx context.Context) bool {
+	ro, _ := ctx.Value(readOnlyKey{}).(bool)
+	return ro
+}
+
+// Permit returns ErrReadOnly, wrapped, when ctx serves the read-only
+// surface and agentID (the default agent when empty) would change state
+// handling req. Dispatch checks this itself; handlers call it to refuse
+// such requests before they start streaming.
+func (d *Dispatcher) Permit(ctx context.Context, agentID string, req protocol.AgentRequest) error {
+	if !ReadOnly(ctx) {
+		return nil
+	}
+	if agentID == "" {
+		agentID = d.defaultID
+	}
+	agent, ok := d.registry.Get(agentID)
+	if !ok {
+		return nil
+	}
+	if m, ok := agent.(protocol.Mutator); ok && m.Mutates(req) {
+		return fmt.Errorf("%s: %w", agentID, ErrReadOnly)
+	}
+	return nil
+}
+
 // Dispatch looks up the agent by ID and calls its Handle method.
 // If agentID is empty, the default agent is used.
 func (d *Dispatcher) Dispatch(ctx context.Context, agentID string, req protocol.AgentRequest, emit protocol.Emitter) error {
@@ -76,11 +165,35 @@ func (d *Dispatcher) Dispatch(ctx context.Context, agentID string, req protocol.
 	if !ok {
 		return fmt.Errorf("agent %q not found", agentID)
 	}
-	return agent.Handle(ctx, req, emit)
+	if err := d.Permit(ctx, agentID, req); err != nil {
+		return err
+	}
+
+	var finishers []func(error)
+	for _, o := range d.observers {
+		wrapped, finish := o(agentID, req, emit)
+		if wrapped != nil {
+			emit = wrapped
+		}
+		if finish != nil {
+			finishers = append(finishers, finish)
+		}
+	}
+
+	err := agent.Handle(ctx, req, emit)
+	for i := len(finishers) - 1; i >= 0; i-- {
+		finishers[i](err)
+	}
+	return err
 }
 
 // ParseAndEnrich extracts IaC code from the request, detects the format,
-// parses resources, and populates req.IaC.
+// parses resources, and populates req.IaC. Terraform variables referenced
+// by resources take the values of .tfvars files attached to the messages
+// (copilot_references), else the defaults declared in the same code, and
+// local modules whose files are attached are expanded into their resources.
+// Terraform plan JSON is read from its resource_changes, and ARM templates
+// from their resources.
 func ParseAndEnrich(req *protocol.AgentRequest) {
 	raw := req.Prompt
 	if raw == "" {
@@ -97,6 +210,20 @@ func ParseAndEnrich(req *protocol.AgentRequest) {
 		return
 	}
 
+	if parser.IsTerraformPlan(code) {
+		if resources, err := parser.ParseTerraformPlan(code); err == nil {
+			req.IaC = &protocol.IaCInput{Format: protocol.FormatTerraformPlan, RawCode: code, Resources: resources}
+			return
+		}
+	}
+
+	if parser.IsARMTemplate(code) {
+		if resources, err := parser.ParseARMTemplate(code); err == nil {
+			req.IaC = &protocol.IaCInput{Format: protocol.FormatARM, RawCode: code, Resources: resources}
+			return
+		}
+	}
+
 	iacType := parser.DetectIaCType(code)
 	resources := parser.ParseResourcesOfType(code, iacType)
 
@@ -104,8 +231,23 @@ func ParseAndEnrich(req *protocol.AgentRequest) {
 	switch iacType {
 	case parser.Terraform:
 		format = protocol.FormatTerraform
+		files := referencedFiles(req.Messages)
+		values := parser.TerraformVariableDefaults(code)
+		for _, f := range files {
+			if strings.HasSuffix(f.Path, ".tfvars") {
+				for k, v := range parser.ParseTFVars(f.Content) {
+					values[k] = v
+				}
+			}
+		}
+		resources = parser.ApplyParams(resources, values, format)
+		resources = append(resources, parser.ExpandModules(code, ".", files, values)...)
 	case parser.Bicep:
 		format = protocol.FormatBicep
+	case parser.Pulumi:
+		format = protocol.FormatPulumi
+	case parser.CloudFormation:
+		format = protocol.FormatCloudFormation
 	}
 
 	req.IaC = &protocol.IaCInput{
@@ -114,3 +256,32 @@ func ParseAndEnrich(req *protocol.AgentRequest) {
 		Resources: resources,
 	}
 }
+
+// referencedFiles returns the files attached to user messages, later
+// attachments of a path replacing earlier ones.
+func referencedFiles(messages []protocol.Message) []protocol.SourceFile {
+	var files []protocol.SourceFile
+	index := make(map[string]int)
+	for _, m := range messages {
+		if m.Role != "user" {
+			continue
+		}
+		for _, ref := range m.References {
+			p := ref.ID
+			if p == "" {
+				p = ref.Metadata.DisplayName
+			}
+			if ref.Type != "client.file" || p == "" || ref.Data.Content == "" {
+				continue
+			}
+			f := protocol.SourceFile{Path: strings.ReplaceAll(p, `\`, "/"), Content: ref.Data.Content}
+			if i, ok := index[f.Path]; ok {
+				files[i] = f
+				continue
+			}
+			index[f.Path] = len(files)
+			files = append(files, f)
+		}
+	}
+	return files
+}
@@ -2,6 +2,7 @@ package host
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"testing"
 
@@ -62,6 +63,34 @@ func TestRegistry_RegisterGetList(t *testing.T) {
 	}
 }
 
+type warmAgent struct {
+	stubAgent
+	err    error
+	warmed int
+}
+
+func (w *warmAgent) WarmUp(context.Context) error {
+	w.warmed++
+	return w.err
+}
+
+func TestRegistry_WarmUp(t *testing.T) {
+	reg := NewRegistry()
+	ok := &warmAgent{stubAgent: stubAgent{id: "security"}}
+	bad := &warmAgent{stubAgent: stubAgent{id: "policy"}, err: errors.New("no rules")}
+	reg.Register(ok)
+	reg.Register(bad)
+	reg.Register(&stubAgent{id: "cost"})
+
+	n, err := reg.WarmUp(context.Background())
+	if n != 1 || ok.warmed != 1 || bad.warmed != 1 {
+		t.Errorf("warmed %d (security %d, policy %d), want 1", n, ok.warmed, bad.warmed)
+	}
+	if err == nil || !strings.Contains(err.Error(), "policy: no rules") {
+		t.Errorf("err = %v", err)
+	}
+}
+
 func TestDispatcher_Dispatch(t *testing.T) {
 	reg := NewRegistry()
 	reg.Register(&stubAgent{id: "test", out: "hello from test"})
@@ -85,6 +114,65 @@ func TestDispatcher_NotFound(t *testing.T) {
 	}
 }
 
+// mutatingAgent changes state when asked to "promote".
+type mutatingAgent struct{ stubAgent }
+
+func (m *mutatingAgent) Mutates(req protocol.AgentRequest) bool {
+	return strings.Contains(req.Prompt, "promote")
+}
+
+func TestDispatcher_ReadOnly(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register(&mutatingAgent{stubAgent{id: "deploy", out: "promoted"}})
+	reg.Register(&stubAgent{id: "policy", out: "ok"})
+	d := NewDispatcher(reg)
+	d.SetDefault("deploy")
+	ro := WithReadOnly(context.Background())
+	promote := protocol.AgentRequest{Prompt: "promote to prod"}
+
+	if !ReadOnly(ro) || ReadOnly(context.Background()) {
+		t.Fatal("ReadOnly does not reflect WithReadOnly")
+	}
+	rec := &recorder{}
+	if err := d.Dispatch(ro, "", promote, rec); !errors.Is(err, ErrReadOnly) || len(rec.messages) != 0 {
+		t.Errorf("read-only promote: err = %v, messages = %v", err, rec.messages)
+	}
+	if err := d.Dispatch(ro, "deploy", protocol.AgentRequest{Prompt: "status"}, &recorder{}); err != nil {
+		t.Errorf("read-only status: %v", err)
+	}
+	if err := d.Dispatch(ro, "policy", promote, &recorder{}); err != nil {
+		t.Errorf("agent without Mutator: %v", err)
+	}
+	if err := d.Dispatch(context.Background(), "deploy", promote, &recorder{}); err != nil {
+		t.Errorf("admin surface promote: %v", err)
+	}
+}
+
+func TestDispatcher_Observe(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register(&stubAgent{id: "test", out: "hello"})
+	d := NewDispatcher(reg)
+
+	var seenID string
+	var finished bool
+	wrapper := &recorder{}
+	d.Observe(func(agentID string, _ protocol.AgentRequest, _ protocol.Emitter) (protocol.Emitter, func(error)) {
+		seenID = agentID
+		return wrapper, func(err error) { finished = err == nil }
+	})
+
+	rec := &recorder{}
+	if err := d.Dispatch(context.Background(), "test", protocol.AgentRequest{}, rec); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if seenID != "test" || !finished {
+		t.Errorf("observer not invoked correctly: id=%q finished=%v", seenID, finished)
+	}
+	if len(wrapper.messages) != 1 || len(rec.messages) != 0 {
+		t.Error("agent should write to the emitter returned by the observer")
+	}
+}
+
 func TestParseAndEnrich_Terraform(t *testing.T) {
 	tfCode := "resource \"azurerm_storage_account\" \"test\" {\n" +
 		"  name                      = \"teststorage\"\n" +
@@ -113,6 +201,50 @@ func TestParseAndEnrich_Terraform(t *testing.T) {
 	}
 }
 
+func TestParseAndEnrich_VariableDefaults(t *testing.T) {
+	tfCode := "variable \"https_only\" {\n  default = false\n}\n" +
+		"resource \"azurerm_storage_account\" \"test\" {\n" +
+		"  enable_https_traffic_only = var.https_only\n" +
+		"  location                  = var.location\n" +
+		"}"
+	req := protocol.AgentRequest{Prompt: "```hcl\n" + tfCode + "\n```"}
+	ParseAndEnrich(&req)
+	props := req.IaC.Resources[0].Properties
+	if props["enable_https_traffic_only"] != false || props["location"] != "var.location" {
+		t.Errorf("props = %v", props)
+	}
+}
+
+func TestParseAndEnrich_References(t *testing.T) {
+	tfCode := "variable \"size\" {\n  default = \"Standard_B2s\"\n}\n" +
+		"module \"app\" {\n  source  = \"./modules/vm\"\n  vm_size = var.size\n}\n" +
+		"resource \"azurerm_linux_virtual_machine\" \"jump\" {\n  size = var.size\n}"
+	file := func(id, content string) protocol.MessageReference {
+		ref := protocol.MessageReference{Type: "client.file", ID: id}
+		ref.Data.Content = content
+		return ref
+	}
+	req := protocol.AgentRequest{Messages: []protocol.Message{{
+		Role:    "user",
+		Content: "estimate:\n```hcl\n" + tfCode + "\n```",
+		References: []protocol.MessageReference{
+			file(`C:\\src\\infra\\prod.tfvars`, `size = "Standard_D4s_v3"`),
+			file("/src/infra/modules/vm/main.tf", "variable \"vm_size\" {}\nresource \"azurerm_linux_virtual_machine\" \"this\" {\n  size = var.vm_size\n}"),
+		},
+	}}}
+	ParseAndEnrich(&req)
+	if len(req.IaC.Resources) != 2 {
+		t.Fatalf("resources = %+v", req.IaC.Resources)
+	}
+	jump, mod := req.IaC.Resources[0], req.IaC.Resources[1]
+	if jump.Properties["size"] != "Standard_D4s_v3" {
+		t.Errorf("tfvars not applied: %v", jump.Properties)
+	}
+	if mod.Name != "app.this" || mod.Properties["size"] != "Standard_D4s_v3" || mod.Line != 4 {
+		t.Errorf("module resource = %s line %d %v", mod.Name, mod.Line, mod.Properties)
+	}
+}
+
 func TestParseAndEnrich_NoCode(t *testing.T) {
 	req := protocol.AgentRequest{
 		Messages: []protocol.Message{
@@ -141,3 +273,28 @@ func TestParseAndEnrich_UsesPromptFirst(t *testing.T) {
 		t.Error("expected code from prompt field, not messages")
 	}
 }
+
+func TestJobs_Cancel(t *testing.T) {
+	jobs := NewJobs()
+	ctx, job, done := jobs.Start(context.Background(), "orchestrator")
+	defer done()
+
+	if list := jobs.List(); len(list) != 1 || list[0].ID != job.ID || list[0].AgentID != "orchestrator" {
+		t.Fatalf("List() = %+v, want the started job", list)
+	}
+	if _, ok := jobs.Cancel("missing"); ok {
+		t.Error("Cancel of unknown job should report false")
+	}
+	if _, ok := jobs.Cancel(job.ID); !ok {
+		t.Fatal("Cancel of running job should report true")
+	}
+	<-ctx.Done()
+	if !Cancelled(ctx) {
+		t.Errorf("cause = %v, want ErrJobCancelled", context.Cause(ctx))
+	}
+
+	done()
+	if len(jobs.List()) != 0 {
+		t.Error("finished job should be removed")
+	}
+}
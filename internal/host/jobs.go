@@ -0,0 +1,91 @@
+package host
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrJobCancelled is the context cause for jobs cancelled through Jobs.Cancel.
+var ErrJobCancelled = errors.New("cancelled by operator")
+
+// Job is an in-flight dispatch — a repo scan, an orchestrated workflow, or a
+// single agent call — that an operator can cancel.
+type Job struct {
+	ID      string    `json:"id"`
+	AgentID string    `json:"agent_id"`
+	Started time.Time `json:"started"`
+
+	cancel context.CancelCauseFunc
+}
+
+// Jobs tracks in-flight jobs so they can be listed and cancelled.
+type Jobs struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+	now  func() time.Time
+}
+
+// NewJobs creates an empty job tracker.
+func NewJobs() *Jobs {
+	return &Jobs{jobs: make(map[string]*Job), now: time.Now}
+}
+
+// Start registers a job for agentID and returns a context that is cancelled
+// with ErrJobCancelled if the job is cancelled. The caller must call done
+// when the job finishes.
+func (j *Jobs) Start(ctx context.Context, agentID string) (context.Context, Job, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	job := &Job{ID: newJobID(), AgentID: agentID, Started: j.now(), cancel: cancel}
+
+	j.mu.Lock()
+	j.jobs[job.ID] = job
+	j.mu.Unlock()
+
+	done := func() {
+		j.mu.Lock()
+		delete(j.jobs, job.ID)
+		j.mu.Unlock()
+		cancel(nil)
+	}
+	return ctx, *job, done
+}
+
+// Cancel cancels a running job. It returns false if no such job is running.
+func (j *Jobs) Cancel(id string) (Job, bool) {
+	j.mu.Lock()
+	job, ok := j.jobs[id]
+	j.mu.Unlock()
+	if !ok {
+		return Job{}, false
+	}
+	job.cancel(ErrJobCancelled)
+	return *job, true
+}
+
+// List returns the running jobs, oldest first.
+func (j *Jobs) List() []Job {
+	j.mu.Lock()
+	list := make([]Job, 0, len(j.jobs))
+	for _, job := range j.jobs {
+		list = append(list, *job)
+	}
+	j.mu.Unlock()
+	sort.Slice(list, func(a, b int) bool { return list[a].Started.Before(list[b].Started) })
+	return list
+}
+
+// Cancelled reports whether ctx ended because its job was cancelled.
+func Cancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrJobCancelled)
+}
+
+func newJobID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,24 @@
+// Package kql quotes values for the Kusto queries sent to Azure Resource
+// Graph, so names taken from IaC cannot change a query's meaning.
+package kql
+
+import "strings"
+
+// quoter escapes the characters a single-quoted KQL string literal
+// treats specially.
+var quoter = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+
+// Quote renders s as a single-quoted KQL string literal.
+func Quote(s string) string {
+	return "'" + quoter.Replace(s) + "'"
+}
+
+// QuoteList renders items as a comma-separated list of KQL string
+// literals, e.g. for an in~ operator.
+func QuoteList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, it := range items {
+		quoted[i] = Quote(it)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,19 @@
+package kql
+
+import "testing"
+
+func TestQuote(t *testing.T) {
+	for in, want := range map[string]string{
+		"rg-app":      `'rg-app'`,
+		`o'brien`:     `'o\'brien'`,
+		`a\b`:         `'a\\b'`,
+		`x\' or 1==1`: `'x\\\' or 1==1'`,
+	} {
+		if got := Quote(in); got != want {
+			t.Errorf("Quote(%q) = %s, want %s", in, got, want)
+		}
+	}
+	if got := QuoteList([]string{"a", "b'c"}); got != `'a', 'b\'c'` {
+		t.Errorf("QuoteList = %s", got)
+	}
+}
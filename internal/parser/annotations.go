@@ -0,0 +1,278 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// AnnotationPrefix starts a governance annotation comment. Annotations work
+// in any comment style the supported languages use: "#", "//" and "/* */".
+const AnnotationPrefix = "iac-gov:"
+
+// WaiverPrefix starts a waiver comment, shorthand for an exemption:
+//
+//	# policy-ignore: storage-https-required reason=legacy client expires=2025-06-01
+//
+// The same text in a "policy-ignore" tag waives the tagged resource.
+const WaiverPrefix = "policy-ignore:"
+
+// WaiverTag is the resource tag that holds a waiver.
+const WaiverTag = "policy-ignore"
+
+var (
+	annotationRe = regexp.MustCompile(`(?m)(?:#|//|/\*)\s*iac-gov:(.*)$`)
+	waiverRe     = regexp.MustCompile(`(?m)(?:#|//|/\*)\s*policy-ignore:(.*)$`)
+	// waiverKeyRe matches a key of a waiver; other words continue the
+	// previous value, so reasons need no quotes.
+	waiverKeyRe = regexp.MustCompile(`^(reason|expires|until)=`)
+	// annotationPairRe matches key=value, where value may be double-quoted.
+	annotationPairRe = regexp.MustCompile(`^([a-z_]+)=("[^"]*"|\S+)\s*`)
+	ownerRe          = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	propertyPathRe   = regexp.MustCompile(`^(?:\*|[A-Za-z_][A-Za-z0-9_]*(?:\[\d+\])?(?:\.[A-Za-z_][A-Za-z0-9_]*(?:\[\d+\])?)*)$`)
+	ruleIDRe         = regexp.MustCompile(`^[A-Z][A-Z0-9_]*(?:-[A-Z0-9_]+)*$`)
+	compactRuleIDRe  = regexp.MustCompile(`^([A-Z]+)(\d+)$`)
+)
+
+// ParseAnnotations reads every "iac-gov:" and "policy-ignore:" comment in
+// text. Each comment is a list of key=value pairs:
+//
+//	owner=<team>                  team owning the resource
+//	exempt=<rule>[,<rule>...]     rules waived for the resource; needs reason
+//	until=<YYYY-MM-DD>            last day the exemptions apply
+//	reason=<text>                 justification; quote values with spaces
+//	severity=<rule>:<level>[,...] per-rule severity overrides
+//	managed_by=<team>             managed outside this IaC; no drift checks
+//	drift_ignore=<path>[,...]     properties drift detection skips, or *
+//
+// until and reason apply to the exemptions in the same comment. A
+// "policy-ignore:" comment is <rule>[,<rule>...] followed by reason= and an
+// optional expires= date; see AddWaiver. Malformed comments are recorded in
+// Errors and otherwise ignored. It returns nil when text has no annotations.
+func ParseAnnotations(text string) *protocol.Annotations {
+	matches := annotationRe.FindAllStringSubmatch(text, -1)
+	waivers := waiverRe.FindAllStringSubmatch(text, -1)
+	if len(matches) == 0 && len(waivers) == 0 {
+		return nil
+	}
+	a := &protocol.Annotations{}
+	for _, m := range matches {
+		body := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(m[1]), "*/"))
+		if err := parseAnnotation(a, body); err != nil {
+			a.Errors = append(a.Errors, fmt.Sprintf("%q: %v", AnnotationPrefix+" "+body, err))
+		}
+	}
+	for _, m := range waivers {
+		AddWaiver(a, strings.TrimSuffix(strings.TrimSpace(m[1]), "*/"), "")
+	}
+	return a
+}
+
+// AddWaiver adds the exemptions of a waiver, "<rule>[,<rule>...]
+// reason=<text> [expires=<YYYY-MM-DD>]", to a. Rules are IDs or the
+// hyphenated rule title ("storage-https-required"), and the reason runs to
+// the next key. source records where the waiver came from. A malformed
+// waiver is recorded in Errors.
+func AddWaiver(a *protocol.Annotations, waiver, source string) {
+	waiver = strings.TrimSpace(waiver)
+	fields := strings.Fields(waiver)
+	if len(fields) == 0 {
+		a.Errors = append(a.Errors, fmt.Sprintf("%q: empty waiver", WaiverPrefix))
+		return
+	}
+	pairs := []string{"exempt=" + fields[0]}
+	for _, f := range fields[1:] {
+		if m := waiverKeyRe.FindStringSubmatch(f); m != nil {
+			f = strings.Replace(f, "expires=", "until=", 1)
+			pairs = append(pairs, f)
+			continue
+		}
+		if len(pairs) == 1 {
+			a.Errors = append(a.Errors, fmt.Sprintf("%q: expected reason= or expires= at %q", WaiverPrefix+" "+waiver, f))
+			return
+		}
+		pairs[len(pairs)-1] += " " + f
+	}
+	var body []string
+	for _, p := range pairs {
+		key, val, _ := strings.Cut(p, "=")
+		body = append(body, key+`="`+strings.Trim(val, `"`)+`"`)
+	}
+	n := len(a.Exemptions)
+	if err := parseAnnotation(a, strings.Join(body, " ")); err != nil {
+		a.Errors = append(a.Errors, fmt.Sprintf("%q: %v", WaiverPrefix+" "+waiver, strings.Replace(err.Error(), "until", "expires", 1)))
+		return
+	}
+	for i := n; i < len(a.Exemptions); i++ {
+		a.Exemptions[i].Source = source
+	}
+}
+
+// parseAnnotation applies one comment to a. The comment is validated as a
+// whole, so a malformed one changes nothing.
+func parseAnnotation(a *protocol.Annotations, body string) error {
+	if body == "" {
+		return fmt.Errorf("empty annotation")
+	}
+	pairs := make(map[string]string)
+	for rest := body; rest != ""; {
+		m := annotationPairRe.FindStringSubmatch(rest)
+		if m == nil {
+			return fmt.Errorf("expected key=value at %q", rest)
+		}
+		if _, dup := pairs[m[1]]; dup {
+			return fmt.Errorf("duplicate key %q", m[1])
+		}
+		pairs[m[1]] = strings.Trim(m[2], `"`)
+		rest = rest[len(m[0]):]
+	}
+
+	var (
+		owner      string
+		managedBy  string
+		ignore     []string
+		exempt     []string
+		until      time.Time
+		severities = make(map[string]protocol.Severity)
+	)
+	keys := make([]string, 0, len(pairs))
+	for key := range pairs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		val := pairs[key]
+		switch key {
+		case "owner":
+			if !ownerRe.MatchString(val) {
+				return fmt.Errorf("invalid owner %q", val)
+			}
+			if a.Owner != "" && a.Owner != val {
+				return fmt.Errorf("owner %q conflicts with %q", val, a.Owner)
+			}
+			owner = val
+		case "exempt":
+			for _, id := range strings.Split(val, ",") {
+				rule, err := annotationRuleID(id)
+				if err != nil {
+					return err
+				}
+				exempt = append(exempt, rule)
+			}
+		case "until":
+			t, err := time.Parse("2006-01-02", val)
+			if err != nil {
+				return fmt.Errorf("until must be a date like 2025-07-01, got %q", val)
+			}
+			until = t
+		case "managed_by":
+			if !ownerRe.MatchString(val) {
+				return fmt.Errorf("invalid managed_by %q", val)
+			}
+			managedBy = val
+		case "drift_ignore":
+			for _, path := range strings.Split(val, ",") {
+				path = strings.TrimSpace(path)
+				if !propertyPathRe.MatchString(path) {
+					return fmt.Errorf("invalid property path %q", path)
+				}
+				ignore = append(ignore, path)
+			}
+		case "reason":
+		case "severity":
+			for _, entry := range strings.Split(val, ",") {
+				id, level, ok := strings.Cut(entry, ":")
+				rule, err := annotationRuleID(id)
+				if err != nil {
+					return err
+				}
+				sev, known := protocol.ParseSeverity(level)
+				if !ok || !known {
+					return fmt.Errorf("severity must be <rule>:<level>, got %q", entry)
+				}
+				severities[rule] = sev
+			}
+		default:
+			return fmt.Errorf("unknown key %q", key)
+		}
+	}
+	if len(exempt) > 0 && strings.TrimSpace(pairs["reason"]) == "" {
+		return fmt.Errorf("exempt requires a reason")
+	}
+	if len(exempt) == 0 && !until.IsZero() {
+		return fmt.Errorf("until applies only to exemptions")
+	}
+
+	if owner != "" {
+		a.Owner = owner
+	}
+	if managedBy != "" {
+		a.ManagedBy = managedBy
+	}
+	a.DriftIgnore = append(a.DriftIgnore, ignore...)
+	for _, rule := range exempt {
+		a.Exemptions = append(a.Exemptions, protocol.Exemption{RuleID: rule, Until: until, Reason: pairs["reason"]})
+	}
+	for rule, sev := range severities {
+		if a.Severities == nil {
+			a.Severities = make(map[string]protocol.Severity)
+		}
+		a.Severities[rule] = sev
+	}
+	return nil
+}
+
+// annotationRuleID validates a rule ID and normalizes the compact form
+// (SEC004) to the native one (SEC-004).
+func annotationRuleID(id string) (string, error) {
+	id = strings.ToUpper(strings.TrimSpace(id))
+	if !ruleIDRe.MatchString(id) {
+		return "", fmt.Errorf("invalid rule ID %q", id)
+	}
+	if m := compactRuleIDRe.FindStringSubmatch(id); m != nil {
+		id = m[1] + "-" + m[2]
+	}
+	return id, nil
+}
+
+// annotate attaches annotations found inside each resource block or in the
+// comments directly above it, and the waiver in its "policy-ignore" tag.
+func annotate(resources []protocol.Resource, code string) {
+	for i := range resources {
+		text := resources[i].RawBlock + "\n" + LeadingComments(code, resources[i].Line)
+		a := ParseAnnotations(text)
+		tags, _ := resources[i].Properties["tags"].(map[string]interface{})
+		if waiver, ok := tags[WaiverTag].(string); ok {
+			if a == nil {
+				a = &protocol.Annotations{}
+			}
+			AddWaiver(a, waiver, "tag")
+		}
+		resources[i].Annotations = a
+	}
+}
+
+// LeadingComments returns the contiguous comment lines immediately before
+// the 1-based line number.
+func LeadingComments(code string, line int) string {
+	if line <= 1 || code == "" {
+		return ""
+	}
+	lines := strings.Split(code, "\n")
+	if line-1 > len(lines) {
+		return ""
+	}
+	var comments []string
+	for i := line - 2; i >= 0; i-- {
+		l := strings.TrimSpace(lines[i])
+		if !strings.HasPrefix(l, "#") && !strings.HasPrefix(l, "//") && !strings.HasPrefix(l, "/*") {
+			break
+		}
+		comments = append(comments, l)
+	}
+	return strings.Join(comments, "\n")
+}
@@ -0,0 +1,288 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// maxARMDepth bounds nested deployments and variable chains.
+const maxARMDepth = 8
+
+// IsARMTemplate reports whether code is an ARM deployment template, such
+// as the JSON Bicep compiles to.
+func IsARMTemplate(code string) bool {
+	code = strings.TrimSpace(code)
+	return strings.HasPrefix(code, "{") && strings.Contains(code, "deploymentTemplate.json") && strings.Contains(code, `"resources"`)
+}
+
+// ParseARMTemplate extracts the resources of an ARM template, mapping types
+// and property names as ParseARM does. Child resources declared inside
+// their parent get the parent's type and name as prefix, and inline nested
+// deployments (Microsoft.Resources/deployments with a template) contribute
+// their own resources. Both the resources array and the symbolic-name
+// object of languageVersion 2.0 templates are read.
+//
+// Template expressions using parameters(), variables() and concat() are
+// evaluated with parameter default values (or the values a nested
+// deployment passes); properties taken from a parameter are recorded in
+// Resource.Resolved. Other expressions are kept as written.
+func ParseARMTemplate(code string) ([]protocol.Resource, error) {
+	var tmpl map[string]interface{}
+	if err := json.Unmarshal([]byte(code), &tmpl); err != nil {
+		return nil, fmt.Errorf("invalid ARM template: %w", err)
+	}
+	if _, ok := tmpl["resources"]; !ok {
+		return nil, fmt.Errorf("invalid ARM template: no resources")
+	}
+	p := &armParser{code: code}
+	p.template(tmpl, nil, 0)
+	return p.resources, nil
+}
+
+type armParser struct {
+	code      string
+	cursor    int
+	resources []protocol.Resource
+}
+
+// armScope holds the parameters and variables of one template.
+type armScope struct {
+	params, vars map[string]interface{}
+	depth        int
+}
+
+// template collects the resources of tmpl. values are parameter values
+// passed in by a parent deployment.
+func (p *armParser) template(tmpl map[string]interface{}, values map[string]interface{}, depth int) {
+	if depth > maxARMDepth {
+		return
+	}
+	scope := &armScope{params: make(map[string]interface{}), vars: make(map[string]interface{})}
+	params, _ := tmpl["parameters"].(map[string]interface{})
+	for name, def := range params {
+		if v, ok := values[name]; ok {
+			scope.params[name] = v
+		} else if d, ok := def.(map[string]interface{}); ok && d["defaultValue"] != nil {
+			scope.params[name] = d["defaultValue"]
+		}
+	}
+	if vars, ok := tmpl["variables"].(map[string]interface{}); ok {
+		scope.vars = vars
+	}
+	for _, res := range armResourceList(tmpl["resources"]) {
+		p.resource(res, scope, "", "", depth)
+	}
+}
+
+// armResourceList returns resources declared as an array or, in
+// languageVersion 2.0 templates, as an object keyed by symbolic name.
+func armResourceList(v interface{}) []map[string]interface{} {
+	var out []map[string]interface{}
+	switch list := v.(type) {
+	case []interface{}:
+		for _, item := range list {
+			if m, ok := item.(map[string]interface{}); ok {
+				out = append(out, m)
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(list))
+		for k := range list {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if m, ok := list[k].(map[string]interface{}); ok {
+				out = append(out, m)
+			}
+		}
+	}
+	return out
+}
+
+func (p *armParser) resource(res map[string]interface{}, scope *armScope, parentType, parentName string, depth int) {
+	armType, _ := res["type"].(string)
+	if armType == "" {
+		return
+	}
+	line := p.line(armType)
+	if parentType != "" && !strings.Contains(armType, ".") {
+		armType = parentType + "/" + armType
+	}
+	name := fmt.Sprint(scope.eval(res["name"], nil, ""))
+	if parentName != "" && !strings.HasPrefix(name, parentName+"/") {
+		name = parentName + "/" + name
+	}
+
+	if strings.EqualFold(armType, "Microsoft.Resources/deployments") {
+		props, _ := res["properties"].(map[string]interface{})
+		if nested, ok := props["template"].(map[string]interface{}); ok {
+			values := make(map[string]interface{})
+			passed, _ := props["parameters"].(map[string]interface{})
+			for k, v := range passed {
+				if m, ok := v.(map[string]interface{}); ok {
+					values[k] = scope.eval(m["value"], nil, "")
+				}
+			}
+			p.template(nested, values, depth+1)
+			return
+		}
+	}
+
+	var resolved []string
+	obj := make(map[string]interface{}, len(res))
+	for k, v := range res {
+		switch k {
+		case "resources", "apiVersion", "dependsOn", "condition", "copy", "comments":
+			continue
+		}
+		obj[k] = scope.eval(v, &resolved, k)
+	}
+	obj["name"] = name
+	obj["type"] = armType
+	r := ParseARM(obj)
+	r.Line = line
+	if raw, err := json.MarshalIndent(res, "", "  "); err == nil {
+		r.RawBlock = string(raw)
+	}
+	for i, path := range resolved {
+		resolved[i] = armPropertyPath(path)
+	}
+	sort.Strings(resolved)
+	r.Resolved = resolved
+	p.resources = append(p.resources, r)
+
+	for _, child := range armResourceList(res["resources"]) {
+		p.resource(child, scope, armType, name, depth)
+	}
+}
+
+// line returns the source line declaring the next resource of armType.
+func (p *armParser) line(armType string) int {
+	needle := strconv.Quote(armType)
+	idx := strings.Index(p.code[p.cursor:], needle)
+	if idx < 0 {
+		return 0
+	}
+	p.cursor += idx + len(needle)
+	return strings.Count(p.code[:p.cursor], "\n") + 1
+}
+
+// armPropertyPath converts a template path ("properties.minimumTlsVersion")
+// to the flattened Terraform-style path ParseARM produces.
+func armPropertyPath(path string) string {
+	path = strings.TrimPrefix(path, "properties.")
+	parts := strings.Split(path, ".")
+	if mapped, ok := bicepToTFProperty[parts[0]]; ok {
+		parts[0] = mapped
+	}
+	return strings.Join(parts, ".")
+}
+
+// eval evaluates template expressions in v. Paths of values taken from a
+// parameter are appended to resolved.
+func (s *armScope) eval(v interface{}, resolved *[]string, path string) interface{} {
+	switch val := v.(type) {
+	case string:
+		if strings.HasPrefix(val, "[[") {
+			return val[1:] // escaped literal
+		}
+		if !strings.HasPrefix(val, "[") || !strings.HasSuffix(val, "]") {
+			return val
+		}
+		out, fromParam, ok := s.expr(strings.TrimSpace(val[1 : len(val)-1]))
+		if !ok {
+			return val
+		}
+		if fromParam && resolved != nil {
+			*resolved = append(*resolved, path)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = s.eval(item, resolved, path+"."+k)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = s.eval(item, resolved, fmt.Sprintf("%s[%d]", path, i))
+		}
+		return out
+	case float64:
+		if val == float64(int(val)) {
+			return int(val)
+		}
+	}
+	return v
+}
+
+// expr evaluates one expression: a quoted literal, a number, or a call to
+// parameters, variables or concat. fromParam reports whether a parameter
+// contributed to the value.
+func (s *armScope) expr(e string) (value interface{}, fromParam, ok bool) {
+	if strings.HasPrefix(e, "'") && strings.HasSuffix(e, "'") && len(e) >= 2 {
+		return strings.ReplaceAll(e[1:len(e)-1], "''", "'"), false, true
+	}
+	if n, err := strconv.Atoi(e); err == nil {
+		return n, false, true
+	}
+	open := strings.IndexByte(e, '(')
+	if open < 0 || !strings.HasSuffix(e, ")") {
+		return nil, false, false
+	}
+	if s.depth >= maxARMDepth {
+		return nil, false, false
+	}
+	s.depth++
+	defer func() { s.depth-- }()
+	fn := strings.ToLower(strings.TrimSpace(e[:open]))
+	var args []string
+	if inner := strings.TrimSpace(e[open+1 : len(e)-1]); inner != "" {
+		args = splitTopLevel(inner, ",")
+	}
+
+	switch fn {
+	case "parameters", "variables":
+		if len(args) != 1 {
+			return nil, false, false
+		}
+		name, _, ok := s.expr(strings.TrimSpace(args[0]))
+		key, isString := name.(string)
+		if !ok || !isString {
+			return nil, false, false
+		}
+		if fn == "parameters" {
+			v, ok := s.params[key]
+			return s.eval(v, nil, ""), true, ok
+		}
+		v, ok := s.vars[key]
+		if !ok {
+			return nil, false, false
+		}
+		var fromParamPaths []string
+		out := s.eval(v, &fromParamPaths, "")
+		if str, isStr := out.(string); isStr && str == v && strings.HasPrefix(str, "[") {
+			return nil, false, false
+		}
+		return out, len(fromParamPaths) > 0, true
+	case "concat":
+		var sb strings.Builder
+		for _, arg := range args {
+			v, p, ok := s.expr(strings.TrimSpace(arg))
+			if !ok {
+				return nil, false, false
+			}
+			fromParam = fromParam || p
+			sb.WriteString(fmt.Sprint(v))
+		}
+		return sb.String(), fromParam, true
+	}
+	return nil, false, false
+}
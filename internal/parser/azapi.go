@@ -0,0 +1,68 @@
+package parser
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+var azapiBodyRe = regexp.MustCompile(`(?m)^\s*body\s*=\s*jsonencode\(\s*\{`)
+
+// azapiResource maps an azapi_resource block to the canonical model: the
+// ARM type in its type argument ("Microsoft.Storage/storageAccounts@2023-01-01")
+// gives the resource type, as for Bicep, and its body gives the properties.
+// The body may be an HCL object (azapi 2.x), jsonencode({...}) or a JSON
+// string. The name, location and parent_id arguments are kept.
+func azapiResource(props map[string]interface{}, rawBlock string) (string, map[string]interface{}) {
+	armType, _ := props["type"].(string)
+	if at := strings.Index(armType, "@"); at > 0 {
+		armType = armType[:at]
+	}
+	if armType == "" {
+		return "azapi_resource", props
+	}
+
+	var body map[string]interface{}
+	switch b := props["body"].(type) {
+	case map[string]interface{}:
+		body = b
+	case string:
+		if err := json.Unmarshal([]byte(b), &body); err != nil {
+			body = azapiJSONEncodedBody(rawBlock)
+		}
+	}
+
+	out := make(map[string]interface{}, len(body)+3)
+	for k, v := range body {
+		out[k] = v
+	}
+	for _, k := range []string{"name", "location", "parent_id"} {
+		if v, ok := props[k]; ok {
+			out[k] = v
+		}
+	}
+	tfType := armType
+	for bicepType, t := range bicepToTFType {
+		if strings.EqualFold(bicepType, armType) {
+			tfType = t
+			break
+		}
+	}
+	return tfType, flattenBicepProperties(out)
+}
+
+// azapiJSONEncodedBody parses the object passed to jsonencode in a body
+// argument. The attribute parser joins multi-line expressions into one
+// string, so the object is read again from the raw block.
+func azapiJSONEncodedBody(rawBlock string) map[string]interface{} {
+	loc := azapiBodyRe.FindStringIndex(rawBlock)
+	if loc == nil {
+		return nil
+	}
+	end := findTerraformBlockEnd(rawBlock, loc[1]-1)
+	if end < 0 {
+		return nil
+	}
+	inner := rawBlock[loc[1]:end]
+	return parseTerraformBlock(strings.Join(splitTopLevel(inner, ","), "\n"))
+}
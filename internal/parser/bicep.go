@@ -19,7 +19,10 @@ var bicepToTFType = map[string]string{
 	"Microsoft.ContainerRegistry/registries":     "azurerm_container_registry",
 	"Microsoft.Web/serverfarms":                  "azurerm_service_plan",
 	"Microsoft.Web/sites":                        "azurerm_app_service",
+	"Microsoft.Web/sites/hostNameBindings":       "azurerm_app_service_custom_hostname_binding",
+	"Microsoft.Cdn/profiles/customDomains":       "azurerm_cdn_frontdoor_custom_domain",
 	"Microsoft.Compute/virtualMachines":          "azurerm_virtual_machine",
+	"Microsoft.Compute/disks":                    "azurerm_managed_disk",
 	"Microsoft.Sql/servers":                      "azurerm_mssql_server",
 	"Microsoft.Sql/servers/databases":            "azurerm_mssql_database",
 	"Microsoft.Cache/redis":                      "azurerm_redis_cache",
@@ -42,6 +45,46 @@ var bicepToTFProperty = map[string]string{
 	"enabledForTemplateDeployment": "enabled_for_template_deployment",
 	"keySource":                    "key_source",
 	"skuName":                      "sku_name",
+	"hostName":                     "host_name",
+}
+
+// tfTypeVariants are Terraform types without a Bicep mapping of their own
+// that model the same ARM resource as a mapped type.
+var tfTypeVariants = map[string][]string{
+	"azurerm_virtual_machine": {"azurerm_linux_virtual_machine", "azurerm_windows_virtual_machine"},
+	"azurerm_app_service":     {"azurerm_linux_web_app", "azurerm_windows_web_app"},
+	"azurerm_service_plan":    {"azurerm_app_service_plan"},
+	"azurerm_mssql_server":    {"azurerm_sql_server"},
+	"azurerm_mssql_database":  {"azurerm_sql_database"},
+}
+
+// ARMType returns the ARM type of a parsed resource type: the type an
+// azurerm type maps from, or the type itself when it is already an ARM
+// type. It returns "" for Terraform types with no mapping.
+func ARMType(resType string) string {
+	if strings.Contains(resType, "/") {
+		return resType
+	}
+	for bicepType, t := range bicepToTFType {
+		if t == resType {
+			return bicepType
+		}
+		for _, v := range tfTypeVariants[t] {
+			if v == resType {
+				return bicepType
+			}
+		}
+	}
+	return ""
+}
+
+// TerraformProperty returns the Terraform name of an ARM property: the
+// Bicep mapping where there is one, otherwise the name in snake_case.
+func TerraformProperty(name string) string {
+	if mapped, ok := bicepToTFProperty[name]; ok {
+		return mapped
+	}
+	return snakeCase(name)
 }
 
 // ParseBicep extracts resources from Bicep code.
@@ -95,8 +138,13 @@ func ParseBicep(code string) []protocol.Resource {
 // parseBicepBlock parses Bicep block content into a properties map.
 // It flattens the nested "properties:" block to match Terraform structure.
 func parseBicepBlock(block string) map[string]interface{} {
-	raw := parseBicepBlockRaw(block)
+	return flattenBicepProperties(parseBicepBlockRaw(block))
+}
 
+// flattenBicepProperties lifts the nested "properties" object to the top
+// level and renames keys to their Terraform equivalents. Live ARM objects
+// share the Bicep shape, so ParseARM reuses it.
+func flattenBicepProperties(raw map[string]interface{}) map[string]interface{} {
 	// Flatten properties block
 	if propsBlock, ok := raw["properties"].(map[string]interface{}); ok {
 		for k, v := range propsBlock {
@@ -122,6 +170,29 @@ func parseBicepBlock(block string) map[string]interface{} {
 	return result
 }
 
+// ParseARM converts a live Azure resource as returned by ARM or Azure
+// Resource Graph ({"id", "name", "type", "properties", ...}) into a Resource,
+// mapping types and property names the same way as Bicep. Resource Graph
+// lowercases types, so the type lookup ignores case.
+func ParseARM(obj map[string]interface{}) protocol.Resource {
+	armType, _ := obj["type"].(string)
+	name, _ := obj["name"].(string)
+	tfType := armType
+	for bicepType, t := range bicepToTFType {
+		if strings.EqualFold(bicepType, armType) {
+			tfType = t
+			break
+		}
+	}
+	raw := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		if k != "type" {
+			raw[k] = v
+		}
+	}
+	return protocol.Resource{Type: tfType, Name: name, Properties: flattenBicepProperties(raw)}
+}
+
 func parseBicepBlockRaw(block string) map[string]interface{} {
 	props := make(map[string]interface{})
 	lines := strings.Split(block, "\n")
@@ -137,6 +208,22 @@ func parseBicepBlockRaw(block string) map[string]interface{} {
 			key := strings.TrimSpace(line[:colonIdx])
 			val := strings.TrimSpace(line[colonIdx+1:])
 
+			// Multi-line array: key: [
+			if depth := bracketDepth(val); strings.HasPrefix(val, "[") && depth > 0 {
+				items := []string{val}
+				for i++; i < len(lines) && depth > 0; i++ {
+					l := strings.TrimSpace(lines[i])
+					if strings.HasPrefix(l, "//") {
+						continue
+					}
+					depth += bracketDepth(l)
+					items = append(items, l)
+				}
+				i--
+				props[key] = parseBicepValue(strings.Join(items, "\n"))
+				continue
+			}
+
 			// Nested block: key: {
 			if val == "{" || strings.HasSuffix(val, "{") {
 				depth := 1
@@ -170,6 +257,22 @@ func parseBicepValue(val string) interface{} {
 		return strings.Trim(val, "'")
 	}
 
+	// Array: items separated by newlines or commas
+	if strings.HasPrefix(val, "[") && strings.HasSuffix(val, "]") {
+		items := []interface{}{}
+		for _, item := range splitTopLevel(val[1:len(val)-1], ",\n") {
+			item = strings.TrimSpace(item)
+			switch {
+			case item == "":
+			case strings.HasPrefix(item, "{") && strings.HasSuffix(item, "}"):
+				items = append(items, parseBicepBlockRaw(strings.Join(splitTopLevel(item[1:len(item)-1], ","), "\n")))
+			default:
+				items = append(items, parseBicepValue(item))
+			}
+		}
+		return items
+	}
+
 	switch strings.ToLower(val) {
 	case "true":
 		return true
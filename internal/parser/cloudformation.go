@@ -0,0 +1,175 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+var (
+	cfnResourcesRe = regexp.MustCompile(`(?m)^\s*"?Resources"?\s*:`)
+	cfnTypeRe      = regexp.MustCompile(`"?Type"?\s*:\s*["']?AWS::\w+::\w+`)
+)
+
+// IsCloudFormation reports whether code is an AWS CloudFormation template,
+// in JSON or YAML. Terraform that embeds a template, as the body of an
+// aws_cloudformation_stack, is not.
+func IsCloudFormation(code string) bool {
+	if tfDetectPatterns[0].MatchString(code) {
+		return false
+	}
+	if strings.Contains(code, "AWSTemplateFormatVersion") {
+		return true
+	}
+	return cfnResourcesRe.MatchString(code) && cfnTypeRe.MatchString(code)
+}
+
+// ParseCloudFormation extracts the resources of a CloudFormation template.
+// Each resource keeps its CloudFormation type ("AWS::S3::Bucket") and
+// logical ID, with its Properties as properties. A Ref to a template
+// parameter with a Default is replaced by the default and recorded in
+// Resource.Resolved; other intrinsic functions are kept as their one-key
+// maps. RawBlock is the properties rendered as HCL so pattern rules apply.
+func ParseCloudFormation(code string) ([]protocol.Resource, error) {
+	var doc interface{}
+	if strings.HasPrefix(strings.TrimSpace(code), "{") {
+		if err := json.Unmarshal([]byte(code), &doc); err != nil {
+			return nil, fmt.Errorf("invalid CloudFormation template: %w", err)
+		}
+		doc = jsonInts(doc)
+	} else {
+		var err error
+		if doc, err = parseYAML(code); err != nil {
+			return nil, fmt.Errorf("invalid CloudFormation template: %w", err)
+		}
+	}
+	tmpl, _ := doc.(map[string]interface{})
+	resources, ok := tmpl["Resources"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid CloudFormation template: no Resources")
+	}
+
+	defaults := make(map[string]interface{})
+	params, _ := tmpl["Parameters"].(map[string]interface{})
+	for name, p := range params {
+		if m, ok := p.(map[string]interface{}); ok && m["Default"] != nil {
+			defaults[name] = m["Default"]
+		}
+	}
+
+	section := sectionEnd(cfnResourcesRe, code)
+	out := make([]protocol.Resource, 0, len(resources))
+	for id, v := range resources {
+		res, _ := v.(map[string]interface{})
+		resType, _ := res["Type"].(string)
+		if resType == "" {
+			continue
+		}
+		var resolved []string
+		props, _ := cfnResolveRefs(res["Properties"], defaults, "", &resolved).(map[string]interface{})
+		if props == nil {
+			props = make(map[string]interface{})
+		}
+		sort.Strings(resolved)
+		var raw strings.Builder
+		fmt.Fprintf(&raw, "resource %q %q {\n", resType, id)
+		writeHCL(&raw, props, "  ")
+		raw.WriteString("}")
+		out = append(out, protocol.Resource{
+			Type:       resType,
+			Name:       id,
+			Properties: props,
+			RawBlock:   raw.String(),
+			Line:       keyLine(code, section, id),
+			Resolved:   resolved,
+		})
+	}
+	sortByLine(out)
+	return out, nil
+}
+
+// cfnResolveRefs replaces {"Ref": param} with the parameter's default,
+// appending the path of each replaced value to resolved.
+func cfnResolveRefs(v interface{}, defaults map[string]interface{}, path string, resolved *[]string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if ref, ok := val["Ref"].(string); ok && len(val) == 1 {
+			if def, ok := defaults[ref]; ok {
+				*resolved = append(*resolved, path)
+				return def
+			}
+			return val
+		}
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = cfnResolveRefs(item, defaults, joinPath(path, k), resolved)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = cfnResolveRefs(item, defaults, fmt.Sprintf("%s[%d]", path, i), resolved)
+		}
+		return out
+	}
+	return v
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// jsonInts converts whole JSON numbers to ints, as parsed HCL has them.
+func jsonInts(v interface{}) interface{} {
+	switch val := v.(type) {
+	case float64:
+		if val == float64(int(val)) {
+			return int(val)
+		}
+	case map[string]interface{}:
+		for k, item := range val {
+			val[k] = jsonInts(item)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = jsonInts(item)
+		}
+	}
+	return v
+}
+
+// sectionEnd returns the offset just past the first match of header, or 0.
+func sectionEnd(header *regexp.Regexp, code string) int {
+	if loc := header.FindStringIndex(code); loc != nil {
+		return loc[1]
+	}
+	return 0
+}
+
+// keyLine returns the 1-based line of the first mapping key named key at or
+// after offset from, or 0.
+func keyLine(code string, from int, key string) int {
+	off := findLine(code[from:], func(line string) bool { return setsKey(line, key, `"'`, ':') })
+	if off < 0 {
+		return 0
+	}
+	return strings.Count(code[:from+off], "\n") + 1
+}
+
+// sortByLine orders resources as they appear in the source; maps lose the
+// declaration order.
+func sortByLine(resources []protocol.Resource) {
+	sort.SliceStable(resources, func(i, j int) bool {
+		if resources[i].Line != resources[j].Line {
+			return resources[i].Line < resources[j].Line
+		}
+		return resources[i].Name < resources[j].Name
+	})
+}
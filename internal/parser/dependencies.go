@@ -0,0 +1,97 @@
+package parser
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Dependency kinds.
+const (
+	DependencyProvider = "provider"
+	DependencyModule   = "module"
+)
+
+// Dependency is a provider or module a Terraform configuration requires,
+// with the version constraint it declares.
+type Dependency struct {
+	Kind string `json:"kind"`
+	// Name is the local name: the required_providers key or module label.
+	Name string `json:"name"`
+	// Source is the provider source ("hashicorp/azurerm", namespaces
+	// defaulting to hashicorp) or the module source without its ?ref=.
+	Source string `json:"source"`
+	// Version is the version constraint, or a git module's ref.
+	Version string `json:"version,omitempty"`
+	Line    int    `json:"line"`
+}
+
+var tfTerraformRe = regexp.MustCompile(`(?m)^[ \t]*terraform\s*\{`)
+
+// ParseTerraformDependencies returns the providers in required_providers
+// blocks and the modules a configuration calls. Local modules (./ and ../
+// sources) have no version and are left out.
+func ParseTerraformDependencies(code string) []Dependency {
+	var deps []Dependency
+	for _, b := range terraformBlocks(code, tfTerraformRe) {
+		required, _ := b.props["required_providers"].(map[string]interface{})
+		for name, v := range required {
+			source, version := "hashicorp/"+name, ""
+			switch p := v.(type) {
+			case map[string]interface{}:
+				if s, ok := p["source"].(string); ok && s != "" {
+					source = s
+				}
+				version, _ = p["version"].(string)
+			case string:
+				// Terraform 0.12 shorthand: azurerm = "~> 3.0"
+				version = p
+			}
+			source = strings.TrimPrefix(strings.ToLower(source), "registry.terraform.io/")
+			if !strings.Contains(source, "/") {
+				source = "hashicorp/" + source
+			}
+			deps = append(deps, Dependency{Kind: DependencyProvider, Name: name, Source: source, Version: version, Line: b.line + blockLine(code, b.line, name)})
+		}
+	}
+	for _, loc := range tfModuleRe.FindAllStringSubmatchIndex(code, -1) {
+		braceStart := loc[1] - 1
+		braceEnd := findTerraformBlockEnd(code, braceStart)
+		if braceEnd < 0 {
+			continue
+		}
+		props := parseTerraformBlock(code[braceStart+1 : braceEnd])
+		source, _ := props["source"].(string)
+		if source == "" || strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") {
+			continue
+		}
+		version, _ := props["version"].(string)
+		if base, query, ok := strings.Cut(source, "?"); ok {
+			if q, err := url.ParseQuery(query); err == nil && q.Get("ref") != "" {
+				source, version = base, q.Get("ref")
+			}
+		}
+		deps = append(deps, Dependency{
+			Kind:    DependencyModule,
+			Name:    code[loc[2]:loc[3]],
+			Source:  strings.TrimPrefix(source, "registry.terraform.io/"),
+			Version: version,
+			Line:    strings.Count(code[:loc[0]], "\n") + 1,
+		})
+	}
+	sort.SliceStable(deps, func(i, j int) bool { return deps[i].Line < deps[j].Line })
+	return deps
+}
+
+// blockLine returns how many lines after the block header at line the
+// first "name =" appears, or 0.
+func blockLine(code string, line int, name string) int {
+	lines := strings.Split(code, "\n")
+	for i := line; i < len(lines); i++ {
+		if setsKey(lines[i], name, `"`, '=') {
+			return i + 1 - line
+		}
+	}
+	return 0
+}
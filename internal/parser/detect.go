@@ -23,12 +23,21 @@ var (
 		regexp.MustCompile(`targetScope\s*=`),
 		regexp.MustCompile(`module\s+\w+\s+'[^']+'`),
 	}
-	fencedCodeRe = regexp.MustCompile("```(?:terraform|bicep|hcl|json)?\\s*\\n([\\s\\S]*?)```")
+	fencedCodeRe = regexp.MustCompile("```(?:terraform|bicep|hcl|json|yaml|yml)?\\s*\\n([\\s\\S]*?)```")
 	inlineCodeRe = regexp.MustCompile("`([^`]+)`")
 )
 
-// DetectIaCType determines whether code is Terraform or Bicep.
+// DetectIaCType determines whether code is Terraform, Bicep, a Pulumi
+// YAML program or a CloudFormation template. The template formats are
+// checked first: their markers are unambiguous, while a YAML description
+// could happen to look like a Bicep param.
 func DetectIaCType(code string) IaCType {
+	if IsCloudFormation(code) {
+		return CloudFormation
+	}
+	if IsPulumiYAML(code) {
+		return Pulumi
+	}
 	for _, re := range tfDetectPatterns {
 		if re.MatchString(code) {
 			return Terraform
@@ -66,34 +75,62 @@ func ExtractCode(message string) string {
 	}
 
 	// If the message itself looks like code, return it directly
-	if DetectIaCType(message) != Unknown {
+	if DetectIaCType(message) != Unknown || IsTerraformPlan(message) || IsARMTemplate(message) {
 		return message
 	}
 
 	return ""
 }
 
+// CodeBlock is a fenced code block and the prose preceding it (since the
+// previous block), which usually says what the block is.
+type CodeBlock struct {
+	Context string
+	Code    string
+}
+
+// CodeBlocks returns the fenced code blocks in a message in order.
+func CodeBlocks(message string) []CodeBlock {
+	var blocks []CodeBlock
+	prev := 0
+	for _, loc := range fencedCodeRe.FindAllStringSubmatchIndex(message, -1) {
+		blocks = append(blocks, CodeBlock{
+			Context: strings.TrimSpace(message[prev:loc[0]]),
+			Code:    strings.TrimSpace(message[loc[2]:loc[3]]),
+		})
+		prev = loc[1]
+	}
+	return blocks
+}
+
 // ParseResources detects the IaC type and parses resources accordingly.
 func ParseResources(code string) []protocol.Resource {
 	iacType := DetectIaCType(code)
 	return ParseResourcesOfType(code, iacType)
 }
 
-// ParseResourcesOfType parses resources for a specific IaC type.
+// ParseResourcesOfType parses resources for a specific IaC type, with
+// their "iac-gov:" annotations.
 func ParseResourcesOfType(code string, iacType IaCType) []protocol.Resource {
+	var resources []protocol.Resource
 	switch iacType {
 	case Terraform:
-		return ParseTerraform(code)
+		resources = ParseTerraform(code)
 	case Bicep:
-		return ParseBicep(code)
+		resources = ParseBicep(code)
+	case Pulumi:
+		resources, _ = ParsePulumiYAML(code)
+	case CloudFormation:
+		resources, _ = ParseCloudFormation(code)
 	default:
 		// Try both
-		resources := ParseTerraform(code)
+		resources = ParseTerraform(code)
 		if len(resources) == 0 {
 			resources = ParseBicep(code)
 		}
-		return resources
 	}
+	annotate(resources, code)
+	return resources
 }
 
 // findMatchingBrace finds the matching closing brace for an opening brace.
@@ -113,6 +150,54 @@ func findMatchingBrace(code string, start int) int {
 	return -1
 }
 
+// bracketDepth returns the net count of opening minus closing square
+// brackets in s, ignoring quoted strings.
+func bracketDepth(s string) int {
+	depth := 0
+	var quote rune
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '[':
+			depth++
+		case r == ']':
+			depth--
+		}
+	}
+	return depth
+}
+
+// splitTopLevel splits s at any of the separator characters that are outside
+// quotes and brackets, braces or parentheses.
+func splitTopLevel(s, seps string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote rune
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case strings.ContainsRune("[{(", r):
+			depth++
+		case strings.ContainsRune("]})", r):
+			depth--
+		case depth == 0 && strings.ContainsRune(seps, r):
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
 // String returns a human-readable representation of an IaC type.
 func (t IaCType) String() string {
 	return string(t)
@@ -0,0 +1,193 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+)
+
+// This file holds the lexical rules of HCL that the line-oriented Terraform
+// parser needs to stay in step with the code: quoted strings (including
+// ${...} templates that contain quotes of their own), comments and
+// heredocs. Braces and brackets inside any of them do not nest.
+
+var heredocRe = regexp.MustCompile(`<<(-?)([A-Za-z_][\w-]*)\s*$`)
+
+// heredocStart reports the delimiter of a heredoc opened at the end of line
+// and whether it is the indented <<- form.
+func heredocStart(line string) (delim string, indented, ok bool) {
+	m := heredocRe.FindStringSubmatch(stripTerraformComment(strings.TrimSpace(line)))
+	if m == nil {
+		return "", false, false
+	}
+	return m[2], m[1] == "-", true
+}
+
+// readHeredoc returns the body of a heredoc whose opening line is
+// lines[start] and the index of its closing delimiter line. The indented
+// form drops the indentation common to all body lines.
+func readHeredoc(lines []string, start int, delim string, indented bool) (string, int) {
+	var body []string
+	i := start + 1
+	for ; i < len(lines) && strings.TrimSpace(lines[i]) != delim; i++ {
+		body = append(body, lines[i])
+	}
+	if indented {
+		indent := -1
+		for _, l := range body {
+			if strings.TrimSpace(l) == "" {
+				continue
+			}
+			if n := len(l) - len(strings.TrimLeft(l, " \t")); indent < 0 || n < indent {
+				indent = n
+			}
+		}
+		for j, l := range body {
+			if len(l) >= indent && indent > 0 {
+				body[j] = l[indent:]
+			}
+		}
+	}
+	return strings.Join(body, "\n"), i
+}
+
+// skipTerraformString returns the index of the quote closing the string
+// opened at code[start], skipping escapes and template interpolations. An
+// unterminated string ends at the end of its line.
+func skipTerraformString(code string, start int) int {
+	for i := start + 1; i < len(code); i++ {
+		switch c := code[i]; {
+		case c == '\\':
+			i++
+		case c == '"':
+			return i
+		case c == '\n':
+			return i - 1
+		case (c == '$' || c == '%') && i+1 < len(code) && code[i+1] == '{':
+			depth := 0
+			for i++; i < len(code); i++ {
+				switch code[i] {
+				case '"':
+					i = skipTerraformString(code, i)
+				case '{':
+					depth++
+				case '}':
+					depth--
+				}
+				if depth == 0 {
+					break
+				}
+			}
+		}
+	}
+	return len(code) - 1
+}
+
+// findTerraformBlockEnd finds the brace closing the one at code[start],
+// ignoring braces in strings, comments and heredocs.
+func findTerraformBlockEnd(code string, start int) int {
+	depth := 0
+	for i := start; i < len(code); i++ {
+		c := code[i]
+		next := byte(0)
+		if i+1 < len(code) {
+			next = code[i+1]
+		}
+		switch {
+		case c == '"':
+			i = skipTerraformString(code, i)
+		case c == '#' || c == '/' && next == '/':
+			if end := strings.IndexByte(code[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				return -1
+			}
+		case c == '/' && next == '*':
+			end := strings.Index(code[i+2:], "*/")
+			if end < 0 {
+				return -1
+			}
+			i += end + 3
+		case c == '<' && next == '<':
+			lineEnd := strings.IndexByte(code[i:], '\n')
+			if lineEnd < 0 {
+				return -1
+			}
+			delim, _, ok := heredocStart(code[i : i+lineEnd])
+			if !ok {
+				i++
+				continue
+			}
+			i += lineEnd
+			for {
+				end := strings.IndexByte(code[i+1:], '\n')
+				line := code[i+1:]
+				if end >= 0 {
+					line = code[i+1 : i+1+end]
+				}
+				if strings.TrimSpace(line) == delim {
+					i += len(line)
+					break
+				}
+				if end < 0 {
+					return -1
+				}
+				i += end + 1
+			}
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// terraformNesting returns the net number of opening minus closing
+// characters (open[k] pairs with closing[k]) in one line of HCL, ignoring
+// strings and a trailing comment.
+func terraformNesting(line, open, closing string) int {
+	depth := 0
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '"':
+			i = skipTerraformString(line, i)
+		case c == '#' || c == '/' && i+1 < len(line) && line[i+1] == '/':
+			return depth
+		case strings.IndexByte(open, c) >= 0:
+			depth++
+		case strings.IndexByte(closing, c) >= 0:
+			depth--
+		}
+	}
+	return depth
+}
+
+// collectTerraformBlock returns the lines of the block opened on lines[start]
+// and the index of the line closing it. Heredoc bodies are copied without
+// being counted.
+func collectTerraformBlock(lines []string, start int) ([]string, int) {
+	depth := 1
+	var nested []string
+	i := start + 1
+	for ; i < len(lines); i++ {
+		if delim, indented, ok := heredocStart(lines[i]); ok {
+			_, end := readHeredoc(lines, i, delim, indented)
+			if end >= len(lines) {
+				end = len(lines) - 1
+			}
+			nested = append(nested, lines[i:end+1]...)
+			i = end
+			continue
+		}
+		depth += terraformNesting(lines[i], "{", "}")
+		if depth <= 0 {
+			break
+		}
+		nested = append(nested, lines[i])
+	}
+	return nested, i
+}
@@ -0,0 +1,103 @@
+package parser
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// maxModuleDepth bounds nested module calls.
+const maxModuleDepth = 4
+
+var tfModuleRe = regexp.MustCompile(`(?m)^[ \t]*module\s+"([^"]+)"\s*\{`)
+
+// moduleMetaArgs are module block arguments that are not module inputs.
+var moduleMetaArgs = map[string]bool{
+	"source": true, "version": true, "count": true, "for_each": true,
+	"providers": true, "depends_on": true,
+}
+
+// ExpandModules returns the resources of the local modules that code calls
+// (source = "./modules/vm"), as far as their .tf files are among files.
+// dir is the directory of code, against which sources are resolved; file
+// paths may carry a longer prefix, as editors send absolute paths.
+//
+// Each module is parsed with its variables set from its defaults and the
+// call's arguments, whose var.NAME references take values (the caller's
+// resolved variables). A module resource is named after the call
+// ("vm.this" for resource "this" in module "vm") and takes the call's line,
+// so skip comments above the module block apply. Registry and remote
+// modules, and count and for_each on calls, are not expanded.
+func ExpandModules(code, dir string, files []protocol.SourceFile, values map[string]interface{}) []protocol.Resource {
+	return expandModules(code, dir, files, values, 0)
+}
+
+func expandModules(code, dir string, files []protocol.SourceFile, values map[string]interface{}, depth int) []protocol.Resource {
+	if depth >= maxModuleDepth {
+		return nil
+	}
+	var out []protocol.Resource
+	for _, loc := range tfModuleRe.FindAllStringSubmatchIndex(code, -1) {
+		braceStart := loc[1] - 1
+		braceEnd := findTerraformBlockEnd(code, braceStart)
+		if braceEnd < 0 {
+			continue
+		}
+		name := code[loc[2]:loc[3]]
+		args := parseTerraformBlock(code[braceStart+1 : braceEnd])
+		source, _ := args["source"].(string)
+		if !strings.HasPrefix(source, "./") && !strings.HasPrefix(source, "../") {
+			continue
+		}
+		modDir := path.Clean(path.Join(dir, source))
+		modCode := moduleCode(files, modDir)
+		if modCode == "" {
+			continue
+		}
+
+		inputs := TerraformVariableDefaults(modCode)
+		var discard []string
+		for k, v := range args {
+			if !moduleMetaArgs[k] {
+				inputs[k] = applyParamsValue(v, values, tfVarRef, k, &discard)
+			}
+		}
+		line := strings.Count(code[:loc[0]], "\n") + 1
+		resources := ApplyParams(ParseResourcesOfType(modCode, Terraform), inputs, protocol.FormatTerraform)
+		resources = append(resources, expandModules(modCode, modDir, files, inputs, depth+1)...)
+		for _, res := range resources {
+			res.Name = name + "." + res.Name
+			res.Line = line
+			out = append(out, res)
+		}
+	}
+	return out
+}
+
+// moduleCode joins the .tf files directly in dir. A file matches when its
+// directory is dir or ends with dir's path below any leading "..".
+func moduleCode(files []protocol.SourceFile, dir string) string {
+	suffix := dir
+	for strings.HasPrefix(suffix, "../") {
+		suffix = suffix[3:]
+	}
+	var matched []protocol.SourceFile
+	for _, f := range files {
+		if !strings.HasSuffix(f.Path, ".tf") {
+			continue
+		}
+		d := path.Dir(path.Clean(f.Path))
+		if d == dir || strings.HasSuffix(d, "/"+suffix) {
+			matched = append(matched, f)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Path < matched[j].Path })
+	parts := make([]string, len(matched))
+	for i, f := range matched {
+		parts[i] = f.Content
+	}
+	return strings.Join(parts, "\n\n")
+}
@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+var (
+	tfVariableRe    = regexp.MustCompile(`variable\s+"([^"]+)"\s*\{`)
+	bicepParamDefRe = regexp.MustCompile(`(?m)^\s*param\s+(\w+)\s+\w+\s*=\s*(.+)$`)
+	bicepParamSetRe = regexp.MustCompile(`(?m)^\s*param\s+(\w+)\s*=\s*(.+)$`)
+	bicepUsingRe    = regexp.MustCompile(`(?m)^\s*using\s+'([^']+)'`)
+	tfVarRefRe      = regexp.MustCompile(`\$\{var\.(\w+)\}`)
+	tfLocalRefRe    = regexp.MustCompile(`\$\{local\.(\w+)\}`)
+	tfLocalsRe      = regexp.MustCompile(`(?m)^[ \t]*locals\s*\{`)
+)
+
+// paramRef is how a template refers to a named value: Terraform uses a
+// prefix such as var.NAME, also interpolated in strings; Bicep bare names.
+type paramRef struct {
+	prefix string
+	interp *regexp.Regexp
+}
+
+var (
+	bicepParamRef = paramRef{}
+	tfVarRef      = paramRef{prefix: "var.", interp: tfVarRefRe}
+	tfLocalRef    = paramRef{prefix: "local.", interp: tfLocalRefRe}
+)
+
+// ParseTFVars parses a .tfvars file into variable values.
+func ParseTFVars(code string) map[string]interface{} {
+	return parseTerraformBlock(code)
+}
+
+// TerraformVariableDefaults returns the default values of variable blocks.
+func TerraformVariableDefaults(code string) map[string]interface{} {
+	defaults := make(map[string]interface{})
+	for _, loc := range tfVariableRe.FindAllStringSubmatchIndex(code, -1) {
+		braceStart := loc[1] - 1
+		braceEnd := findTerraformBlockEnd(code, braceStart)
+		if braceEnd < 0 {
+			continue
+		}
+		props := parseTerraformBlock(code[braceStart+1 : braceEnd])
+		if v, ok := props["default"]; ok {
+			defaults[code[loc[2]:loc[3]]] = v
+		}
+	}
+	return defaults
+}
+
+// TerraformLocals returns the values of all locals blocks.
+func TerraformLocals(code string) map[string]interface{} {
+	locals := make(map[string]interface{})
+	for _, b := range terraformBlocks(code, tfLocalsRe) {
+		for k, v := range b.props {
+			locals[k] = v
+		}
+	}
+	return locals
+}
+
+// ParseBicepParam parses a .bicepparam file, returning the template named by
+// its using declaration and the parameter values it assigns.
+func ParseBicepParam(code string) (string, map[string]interface{}) {
+	var template string
+	if m := bicepUsingRe.FindStringSubmatch(code); m != nil {
+		template = m[1]
+	}
+	values := make(map[string]interface{})
+	for _, m := range bicepParamSetRe.FindAllStringSubmatch(code, -1) {
+		values[m[1]] = parseBicepValue(m[2])
+	}
+	return template, values
+}
+
+// BicepParamDefaults returns the default values of param declarations.
+func BicepParamDefaults(code string) map[string]interface{} {
+	defaults := make(map[string]interface{})
+	for _, m := range bicepParamDefRe.FindAllStringSubmatch(code, -1) {
+		defaults[m[1]] = parseBicepValue(m[2])
+	}
+	return defaults
+}
+
+// ApplyParams returns copies of resources with variable references replaced
+// by values: var.NAME and "${var.NAME}" for Terraform, bare parameter names
+// for Bicep. Unresolved references are left as-is. The paths of substituted
+// properties are recorded in Resource.Resolved.
+func ApplyParams(resources []protocol.Resource, values map[string]interface{}, format protocol.SourceFormat) []protocol.Resource {
+	if len(values) == 0 {
+		return resources
+	}
+	ref := tfVarRef
+	if format == protocol.FormatBicep {
+		ref = bicepParamRef
+	}
+	out := make([]protocol.Resource, len(resources))
+	for i, res := range resources {
+		resolved := append([]string(nil), res.Resolved...)
+		res.Properties = applyParamsMap(res.Properties, values, ref, "", &resolved)
+		sort.Strings(resolved)
+		res.Resolved = resolved
+		out[i] = res
+	}
+	return out
+}
+
+// applyLocals replaces local.NAME references in place. Locals are part of
+// the template, so the substitutions are not recorded in Resolved; a local
+// that refers to a variable is resolved later by ApplyParams.
+func applyLocals(resources []protocol.Resource, locals map[string]interface{}) {
+	var discard []string
+	for i := range resources {
+		resources[i].Properties = applyParamsMap(resources[i].Properties, locals, tfLocalRef, "", &discard)
+	}
+}
+
+func applyParamsMap(props map[string]interface{}, values map[string]interface{}, ref paramRef, prefix string, resolved *[]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(props))
+	for k, v := range props {
+		out[k] = applyParamsValue(v, values, ref, prefix+k, resolved)
+	}
+	return out
+}
+
+func applyParamsValue(v interface{}, values map[string]interface{}, ref paramRef, path string, resolved *[]string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return applyParamsMap(val, values, ref, path+".", resolved)
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = applyParamsValue(item, values, ref, fmt.Sprintf("%s[%d]", path, i), resolved)
+		}
+		return out
+	case string:
+		out := substituteParams(val, values, ref)
+		if s, ok := out.(string); !ok || s != val {
+			*resolved = append(*resolved, path)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+func substituteParams(val string, values map[string]interface{}, ref paramRef) interface{} {
+	if ref.prefix == "" {
+		if resolved, ok := values[val]; ok {
+			return resolved
+		}
+		return val
+	}
+	if name, ok := strings.CutPrefix(val, ref.prefix); ok {
+		if resolved, ok := values[name]; ok {
+			return resolved
+		}
+		return val
+	}
+	return ref.interp.ReplaceAllStringFunc(val, func(match string) string {
+		name := ref.interp.FindStringSubmatch(match)[1]
+		if s, ok := values[name].(string); ok {
+			return s
+		}
+		return match
+	})
+}
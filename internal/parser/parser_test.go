@@ -1,8 +1,13 @@
 package parser
 
 import (
+	"fmt"
+	"os"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 )
 
 func TestDetectIaCType_Terraform(t *testing.T) {
@@ -201,6 +206,162 @@ func TestParseTerraform_BooleanAndNumbers(t *testing.T) {
 	}
 }
 
+func TestParseTerraform_ListsAndMaps(t *testing.T) {
+	code := `resource "azurerm_storage_account" "ex" {
+  ip_rules = ["10.0.0.1", "10.0.0.2"] # office
+  tags     = { env = "prod", "cost-center" = "42" }
+  subnet_ids = [
+    azurerm_subnet.a.id, // primary
+    azurerm_subnet.b.id,
+  ]
+  rules = [{
+    name = "a"
+  }]
+}`
+	r := ParseTerraform(code)[0]
+	if got := fmt.Sprint(r.Properties["ip_rules"]); got != "[10.0.0.1 10.0.0.2]" {
+		t.Errorf("ip_rules = %s", got)
+	}
+	tags, ok := r.Properties["tags"].(map[string]interface{})
+	if !ok || tags["env"] != "prod" || tags["cost-center"] != "42" {
+		t.Errorf("tags = %#v", r.Properties["tags"])
+	}
+	if got := fmt.Sprint(r.Properties["subnet_ids"]); got != "[azurerm_subnet.a.id azurerm_subnet.b.id]" {
+		t.Errorf("subnet_ids = %s", got)
+	}
+	if rules, ok := r.Properties["rules"].([]interface{}); !ok || len(rules) != 1 || rules[0].(map[string]interface{})["name"] != "a" {
+		t.Errorf("rules = %#v", r.Properties["rules"])
+	}
+	if _, leaked := r.Properties["name"]; leaked {
+		t.Error("list contents leaked into resource properties")
+	}
+}
+
+func TestParseTerraform_RepeatedBlocks(t *testing.T) {
+	code := `resource "azurerm_network_security_group" "nsg" {
+  security_rule {
+    name = "ssh"
+  }
+  security_rule {
+    name = "rdp"
+  }
+}`
+	rules, ok := ParseTerraform(code)[0].Properties["security_rule"].([]interface{})
+	if !ok || len(rules) != 2 || rules[1].(map[string]interface{})["name"] != "rdp" {
+		t.Fatalf("security_rule = %#v", rules)
+	}
+}
+
+func TestParseTerraform_HCLConstructs(t *testing.T) {
+	code := `locals {
+  tier = "Premium"
+  tls  = var.min_tls
+}
+
+# resource "azurerm_storage_account" "old" {}
+
+resource "azurerm_key_vault" "kv" {
+  for_each = toset([
+    "dev",
+    "prod",
+  ])
+  name     = "kv-${each.key}"
+  sku_name = local.tier
+  tags = merge(var.tags, {
+    "owner" = "platform" # team
+  })
+  policy = <<-EOT
+    {
+      "effect": "deny"
+    }
+  EOT
+  lifecycle {
+    ignore_changes = [tags]
+  }
+}
+
+resource "azurerm_network_security_group" "nsg" {
+  count = 2
+  dynamic "security_rule" {
+    for_each = var.rules
+    content {
+      name   = security_rule.value.name
+      access = "Deny"
+    }
+  }
+  min_tls_version = local.tls
+  label           = "{ not a block }"
+}`
+	resources := ParseTerraform(code)
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(resources))
+	}
+	kv, nsg := resources[0].Properties, resources[1].Properties
+	if got := kv["for_each"]; got != `toset([ "dev", "prod", ])` {
+		t.Errorf("for_each = %q", got)
+	}
+	if kv["sku_name"] != "Premium" || kv["name"] != "kv-${each.key}" {
+		t.Errorf("kv = %v", kv)
+	}
+	if got := kv["tags"]; got != `merge(var.tags, { "owner" = "platform" })` {
+		t.Errorf("tags = %q", got)
+	}
+	if got := kv["policy"]; got != "{\n  \"effect\": \"deny\"\n}" {
+		t.Errorf("policy = %q", got)
+	}
+	if _, ok := kv["lifecycle"].(map[string]interface{}); !ok {
+		t.Errorf("lifecycle = %#v", kv["lifecycle"])
+	}
+	if _, leaked := kv["effect"]; leaked {
+		t.Error("heredoc contents leaked into resource properties")
+	}
+
+	rule, ok := nsg["security_rule"].(map[string]interface{})
+	if !ok || rule["access"] != "Deny" {
+		t.Errorf("security_rule = %#v", nsg["security_rule"])
+	}
+	if nsg["count"] != 2 || nsg["min_tls_version"] != "var.min_tls" || nsg["label"] != "{ not a block }" {
+		t.Errorf("nsg = %v", nsg)
+	}
+	if len(resources[1].Resolved) != 0 {
+		t.Errorf("locals should not be recorded as resolved: %v", resources[1].Resolved)
+	}
+}
+
+func TestParseBicep_Arrays(t *testing.T) {
+	code := `resource sa 'Microsoft.Storage/storageAccounts@2023-01-01' = {
+  name: 'sa'
+  properties: {
+    networkAcls: {
+      defaultAction: 'Deny'
+      ipRules: [
+        {
+          value: '10.0.0.1'
+          action: 'Allow'
+        }
+        { value: '10.0.0.2', action: 'Allow' }
+      ]
+    }
+  }
+  zones: ['1', '2']
+}`
+	r := ParseBicep(code)[0]
+	acls, ok := r.Properties["network_rules"].(map[string]interface{})
+	if !ok || acls["defaultAction"] != "Deny" {
+		t.Fatalf("network_rules = %#v", r.Properties["network_rules"])
+	}
+	ipRules, ok := acls["ipRules"].([]interface{})
+	if !ok || len(ipRules) != 2 || ipRules[1].(map[string]interface{})["value"] != "10.0.0.2" {
+		t.Errorf("ipRules = %#v", acls["ipRules"])
+	}
+	if _, leaked := acls["value"]; leaked {
+		t.Error("array contents leaked into network_rules")
+	}
+	if got := fmt.Sprint(r.Properties["zones"]); got != "[1 2]" {
+		t.Errorf("zones = %s", got)
+	}
+}
+
 func TestParseBicep_SingleResource(t *testing.T) {
 	code := `resource storageAccount 'Microsoft.Storage/storageAccounts@2023-01-01' = {
   name: 'mystorageaccount'
@@ -246,6 +407,27 @@ func TestParseBicep_UnknownResourceType(t *testing.T) {
 	}
 }
 
+func TestParseARM(t *testing.T) {
+	r := ParseARM(map[string]interface{}{
+		"id":   "/subscriptions/x/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/prodsa",
+		"name": "prodsa",
+		"type": "microsoft.storage/storageaccounts",
+		"properties": map[string]interface{}{
+			"supportsHttpsTrafficOnly": false,
+			"minimumTlsVersion":        "TLS1_0",
+		},
+	})
+	if r.Type != "azurerm_storage_account" || r.Name != "prodsa" {
+		t.Errorf("resource = %s.%s, want azurerm_storage_account.prodsa", r.Type, r.Name)
+	}
+	if v := r.Properties["enable_https_traffic_only"]; v != false {
+		t.Errorf("enable_https_traffic_only = %v, want false", v)
+	}
+	if v := r.Properties["min_tls_version"]; v != "TLS1_0" {
+		t.Errorf("min_tls_version = %v, want TLS1_0", v)
+	}
+}
+
 func TestFindMatchingBrace(t *testing.T) {
 	tests := []struct {
 		code  string
@@ -301,3 +483,646 @@ func TestShortType(t *testing.T) {
 		}
 	}
 }
+
+func TestParseTFVars(t *testing.T) {
+	values := ParseTFVars("environment = \"prod\"\nhttps_only  = true\nnode_count  = 5\n")
+	if values["environment"] != "prod" || values["https_only"] != true || values["node_count"] != 5 {
+		t.Errorf("values = %v", values)
+	}
+}
+
+func TestTerraformVariableDefaults(t *testing.T) {
+	code := `variable "https_only" {
+  type    = bool
+  default = false
+}
+variable "name" {
+  type = string
+}`
+	defaults := TerraformVariableDefaults(code)
+	if len(defaults) != 1 || defaults["https_only"] != false {
+		t.Errorf("defaults = %v", defaults)
+	}
+}
+
+func TestTerraformLocals(t *testing.T) {
+	locals := TerraformLocals("locals {\n  env = \"prod\"\n}\nlocals {\n  replicas = 3\n}\n")
+	if len(locals) != 2 || locals["env"] != "prod" || locals["replicas"] != 3 {
+		t.Errorf("locals = %v", locals)
+	}
+}
+
+func TestParseBicepParam(t *testing.T) {
+	code := "using './main.bicep'\n\nparam env = 'prod'\nparam allowPublic = false\n"
+	tmpl, values := ParseBicepParam(code)
+	if tmpl != "./main.bicep" {
+		t.Errorf("template = %q", tmpl)
+	}
+	if values["env"] != "prod" || values["allowPublic"] != false {
+		t.Errorf("values = %v", values)
+	}
+	defaults := BicepParamDefaults("param allowPublic bool = true\nparam location string\n")
+	if len(defaults) != 1 || defaults["allowPublic"] != true {
+		t.Errorf("defaults = %v", defaults)
+	}
+}
+
+func TestApplyParams(t *testing.T) {
+	tf := ParseTerraform(`resource "azurerm_storage_account" "sa" {
+  name                      = "st${var.env}"
+  enable_https_traffic_only = var.https_only
+  network_rules {
+    default_action = var.default_action
+  }
+}`)
+	resolved := ApplyParams(tf, map[string]interface{}{"https_only": true, "env": "prod", "default_action": "Deny"}, protocol.FormatTerraform)
+	props := resolved[0].Properties
+	if props["enable_https_traffic_only"] != true || props["name"] != "stprod" {
+		t.Errorf("props = %v", props)
+	}
+	if rules := props["network_rules"].(map[string]interface{}); rules["default_action"] != "Deny" {
+		t.Errorf("nested = %v", rules)
+	}
+	if tf[0].Properties["enable_https_traffic_only"] != "var.https_only" {
+		t.Error("ApplyParams must not modify its input")
+	}
+	if got := strings.Join(resolved[0].Resolved, ","); got != "enable_https_traffic_only,name,network_rules.default_action" {
+		t.Errorf("Resolved = %q", got)
+	}
+
+	bicep := ParseBicep(`resource sa 'Microsoft.Storage/storageAccounts@2023-01-01' = {
+  name: 'sa'
+  properties: {
+    allowBlobPublicAccess: allowPublic
+  }
+}`)
+	resolved = ApplyParams(bicep, map[string]interface{}{"allowPublic": false}, protocol.FormatBicep)
+	if resolved[0].Properties["allow_blob_public_access"] != false {
+		t.Errorf("bicep props = %v", resolved[0].Properties)
+	}
+}
+
+func TestParseTerraformMovesAndImports(t *testing.T) {
+	code := `moved {
+  from = azurerm_storage_account.old
+  to   = module.storage.azurerm_storage_account.logs[0]
+}
+
+import {
+  to = azurerm_resource_group.main
+  id = "/subscriptions/000/resourceGroups/rg-main"
+}
+
+resource "azurerm_resource_group" "main" {
+  name = "rg-main"
+}`
+	moves := ParseTerraformMoves(code)
+	if len(moves) != 1 || moves[0].From != "azurerm_storage_account.old" || moves[0].To != "azurerm_storage_account.logs" || moves[0].Line != 1 {
+		t.Errorf("moves = %+v", moves)
+	}
+	imports := ParseTerraformImports(code)
+	if len(imports) != 1 || imports[0].To != "azurerm_resource_group.main" || imports[0].ID != "/subscriptions/000/resourceGroups/rg-main" || imports[0].Line != 6 {
+		t.Errorf("imports = %+v", imports)
+	}
+	if len(ParseTerraform(code)) != 1 {
+		t.Error("moved/import blocks must not parse as resources")
+	}
+}
+
+func TestParseAnnotations(t *testing.T) {
+	code := `# iac-gov: owner=payments exempt=SEC004,POL-003 until=2025-07-01 reason="legacy clients"
+resource "azurerm_storage_account" "sa" {
+  /* iac-gov: severity=POL-001:low */
+  // iac-gov: exempt=SEC-002
+  name = "sa"
+}
+
+resource "azurerm_key_vault" "kv" {
+  # iac-gov: owner=security severity=POL-005:urgent
+  name = "kv"
+}
+`
+	resources := ParseResources(code)
+	if len(resources) != 2 {
+		t.Fatalf("got %d resources, want 2", len(resources))
+	}
+
+	sa := resources[0].Annotations
+	if sa == nil || sa.Owner != "payments" {
+		t.Fatalf("storage annotations = %+v", sa)
+	}
+	if len(sa.Exemptions) != 2 || sa.Exemptions[0].RuleID != "SEC-004" || sa.Exemptions[0].Reason != "legacy clients" ||
+		sa.Exemptions[0].Until.Format("2006-01-02") != "2025-07-01" {
+		t.Errorf("exemptions = %+v", sa.Exemptions)
+	}
+	if sa.Severities["POL-001"] != protocol.SeverityLow {
+		t.Errorf("severities = %v", sa.Severities)
+	}
+	if len(sa.Errors) != 1 || !strings.Contains(sa.Errors[0], "exempt requires a reason") {
+		t.Errorf("errors = %v", sa.Errors)
+	}
+
+	kv := resources[1].Annotations
+	if kv == nil || kv.Owner != "" || len(kv.Errors) != 1 || !strings.Contains(kv.Errors[0], "severity must be") {
+		t.Errorf("malformed annotation should be ignored and reported, got %+v", kv)
+	}
+
+	drift := ParseAnnotations("# iac-gov: managed_by=network-team\n// iac-gov: drift_ignore=tags,site_config.app_settings,network_rules[0].ip_rules")
+	if drift == nil || drift.ManagedBy != "network-team" || len(drift.DriftIgnore) != 3 || drift.DriftIgnore[2] != "network_rules[0].ip_rules" {
+		t.Errorf("drift annotations = %+v", drift)
+	}
+
+	for _, bad := range []string{"", "owner", "team=x", "owner=a owner=b", "exempt=SEC-001 until=tomorrow reason=x", "until=2025-01-01", "managed_by=\"two words\"", "drift_ignore=tags,,sku", "drift_ignore=a..b"} {
+		if a := ParseAnnotations("# iac-gov: " + bad); a == nil || len(a.Errors) != 1 {
+			t.Errorf("ParseAnnotations(%q) = %+v, want one error", bad, a)
+		}
+	}
+	if ParseAnnotations("# plain comment") != nil {
+		t.Error("text without annotations should return nil")
+	}
+}
+
+func TestParseAnnotations_Waivers(t *testing.T) {
+	code := `# policy-ignore: storage-https-required reason=legacy client expires=2025-06-01
+resource "azurerm_storage_account" "sa" {
+  name = "sa"
+  tags = {
+    "policy-ignore" = "POL-003,POL004 reason=TLS 1.0 client"
+  }
+}
+
+resource "azurerm_key_vault" "kv" {
+  // policy-ignore: POL-005 expires=2025-06-01
+  name = "kv"
+}
+`
+	resources := ParseResources(code)
+	if len(resources) != 2 {
+		t.Fatalf("got %d resources, want 2", len(resources))
+	}
+	sa := resources[0].Annotations
+	if sa == nil || len(sa.Exemptions) != 3 || len(sa.Errors) != 0 {
+		t.Fatalf("storage annotations = %+v", sa)
+	}
+	if e := sa.Exemptions[0]; e.RuleID != "STORAGE-HTTPS-REQUIRED" || e.Reason != "legacy client" || e.Until.Format("2006-01-02") != "2025-06-01" || e.Source != "" {
+		t.Errorf("comment waiver = %+v", e)
+	}
+	if e := sa.Exemptions[2]; e.RuleID != "POL-004" || e.Reason != "TLS 1.0 client" || !e.Until.IsZero() || e.Source != "tag" {
+		t.Errorf("tag waiver = %+v", e)
+	}
+	kv := resources[1].Annotations
+	if kv == nil || len(kv.Exemptions) != 0 || len(kv.Errors) != 1 || !strings.Contains(kv.Errors[0], "policy-ignore: POL-005 expires=2025-06-01") || !strings.Contains(kv.Errors[0], "requires a reason") {
+		t.Errorf("waiver without reason = %+v", kv)
+	}
+
+	for _, bad := range []string{"", "POL-001 legacy", "POL-001 reason=x expires=soon"} {
+		if a := ParseAnnotations("# policy-ignore: " + bad); a == nil || len(a.Errors) != 1 || len(a.Exemptions) != 0 {
+			t.Errorf("waiver %q = %+v, want one error", bad, a)
+		}
+	}
+}
+
+func TestParseTerraformPlan(t *testing.T) {
+	data, err := os.ReadFile("../testkit/scenarios/storage-plan.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsTerraformPlan(string(data)) || IsTerraformPlan(`resource "a" "b" {}`) {
+		t.Fatal("IsTerraformPlan misdetects input")
+	}
+	resources, err := ParseTerraformPlan(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 4 {
+		t.Fatalf("expected 4 managed resources, got %d", len(resources))
+	}
+	byName := make(map[string]protocol.Resource)
+	for _, r := range resources {
+		byName[r.Name] = r
+	}
+
+	rg := byName["rg"]
+	if rg.Change.Action != protocol.ActionNoOp || rg.Change.PreviousAddress != "azurerm_resource_group.main" {
+		t.Errorf("rg change = %+v", rg.Change)
+	}
+	sa := byName["sa"]
+	rules, ok := sa.Properties["network_rules"].(map[string]interface{})
+	if !ok || rules["default_action"] != "Deny" || sa.Change.Action != protocol.ActionUpdate {
+		t.Errorf("sa = %+v", sa)
+	}
+	if !strings.Contains(sa.RawBlock, `min_tls_version = "TLS1_2"`) {
+		t.Errorf("RawBlock = %s", sa.RawBlock)
+	}
+	kv := byName[`kv["prod"]`]
+	if kv.Change == nil || kv.Change.Action != protocol.ActionCreate || kv.Properties["soft_delete_retention_days"] != 90 {
+		t.Errorf("kv = %+v", kv)
+	}
+	if _, ok := kv.Properties["id"]; ok {
+		t.Error("values known only after apply should be dropped")
+	}
+	old := byName["old"]
+	if !old.Deleted() || old.Properties["name"] != "aks-old" {
+		t.Errorf("old = %+v", old)
+	}
+
+	if _, err := ParseTerraformPlan(`{"resource_changes": []}`); err == nil {
+		t.Error("plan without format_version should fail")
+	}
+}
+
+func TestParseTerraformPlan_Replace(t *testing.T) {
+	resources, err := ParseTerraformPlan(`{"format_version": "1.2", "resource_changes": [
+  {"address": "azurerm_subnet.a", "mode": "managed", "type": "azurerm_subnet", "name": "a",
+   "change": {"actions": ["delete", "create"], "replace_paths": [["address_prefixes"], ["delegation", 0, "name"]]}},
+  {"address": "azurerm_subnet.b", "mode": "managed", "type": "azurerm_subnet", "name": "b",
+   "change": {"actions": ["create", "delete"]}}
+]}`)
+	if err != nil || len(resources) != 2 {
+		t.Fatalf("resources = %+v, %v", resources, err)
+	}
+	a, b := resources[0].Change, resources[1].Change
+	if a.Action != protocol.ActionReplace || a.CreateBeforeDestroy || strings.Join(a.ReplacePaths, ",") != "address_prefixes,delegation[0].name" {
+		t.Errorf("a = %+v", a)
+	}
+	if b.Action != protocol.ActionReplace || !b.CreateBeforeDestroy {
+		t.Errorf("b = %+v", b)
+	}
+}
+
+func TestParseARMTemplate(t *testing.T) {
+	data, err := os.ReadFile("../testkit/scenarios/insecure-storage.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsARMTemplate(string(data)) {
+		t.Fatal("IsARMTemplate = false")
+	}
+	resources, err := ParseARMTemplate(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 3 {
+		t.Fatalf("expected 3 resources, got %d: %+v", len(resources), resources)
+	}
+
+	sa := resources[0]
+	if sa.Type != "azurerm_storage_account" || sa.Name != "appstore" || sa.Line != 14 {
+		t.Errorf("storage account = %s %s line %d", sa.Type, sa.Name, sa.Line)
+	}
+	if sa.Properties["min_tls_version"] != "TLS1_0" || sa.Properties["enable_https_traffic_only"] != false {
+		t.Errorf("props = %v", sa.Properties)
+	}
+	if sa.Properties["location"] != "[resourceGroup().location]" {
+		t.Errorf("unsupported expressions should be kept, location = %v", sa.Properties["location"])
+	}
+	if got := strings.Join(sa.Resolved, ","); got != "location,min_tls_version,name" {
+		t.Errorf("Resolved = %q", got)
+	}
+
+	blob := resources[1]
+	if blob.Type != "Microsoft.Storage/storageAccounts/blobServices" || blob.Name != "appstore/default" {
+		t.Errorf("child = %s %s", blob.Type, blob.Name)
+	}
+	kv := resources[2]
+	if kv.Type != "azurerm_key_vault" || kv.Name != "app-kv" || kv.Properties["soft_delete_enabled"] != false {
+		t.Errorf("nested deployment resource = %+v", kv)
+	}
+
+	if _, err := ParseARMTemplate(`{"$schema": "deploymentTemplate.json"}`); err == nil {
+		t.Error("template without resources should fail")
+	}
+}
+
+func TestParseTerraform_Azapi(t *testing.T) {
+	code := `resource "azapi_resource" "sa" {
+  type      = "Microsoft.Storage/storageAccounts@2023-05-01"
+  name      = "stpreview"
+  parent_id = azurerm_resource_group.rg.id
+  location  = "eastus"
+  body = jsonencode({
+    kind = "StorageV2"
+    properties = {
+      minimumTlsVersion        = "TLS1_0"
+      supportsHttpsTrafficOnly = false
+      networkAcls = { defaultAction = "Allow" }
+    }
+  })
+}
+
+resource "azapi_resource" "kv" {
+  type = "Microsoft.KeyVault/vaults@2023-07-01"
+  name = "kv-preview"
+  body = {
+    properties = {
+      enablePurgeProtection = true
+    }
+  }
+}
+
+resource "azapi_resource" "app" {
+  type = "Microsoft.App/containerApps@2024-03-01"
+  name = "app"
+  body = <<BODY
+{"properties": {"configuration": {"ingress": {"external": true}}}}
+BODY
+}`
+	resources := ParseTerraform(code)
+	if len(resources) != 3 {
+		t.Fatalf("expected 3 resources, got %d", len(resources))
+	}
+	sa, kv, app := resources[0], resources[1], resources[2]
+	if sa.Type != "azurerm_storage_account" || sa.Name != "sa" {
+		t.Errorf("sa = %s.%s", sa.Type, sa.Name)
+	}
+	if sa.Properties["min_tls_version"] != "TLS1_0" || sa.Properties["enable_https_traffic_only"] != false || sa.Properties["kind"] != "StorageV2" {
+		t.Errorf("sa props = %v", sa.Properties)
+	}
+	if acls, ok := sa.Properties["network_rules"].(map[string]interface{}); !ok || acls["defaultAction"] != "Allow" {
+		t.Errorf("network_rules = %#v", sa.Properties["network_rules"])
+	}
+	if sa.Properties["name"] != "stpreview" || sa.Properties["parent_id"] != "azurerm_resource_group.rg.id" {
+		t.Errorf("arguments not kept: %v", sa.Properties)
+	}
+	if kv.Type != "azurerm_key_vault" || kv.Properties["purge_protection_enabled"] != true {
+		t.Errorf("kv = %+v", kv)
+	}
+	if app.Type != "Microsoft.App/containerApps" || app.Properties["configuration"] == nil {
+		t.Errorf("app = %+v", app)
+	}
+}
+
+func TestParseYAML(t *testing.T) {
+	code := `# comment
+name: app   # trailing
+count: 3
+ratio: 0.5
+enabled: true
+empty:
+quoted: "a: \"b\""
+single: 'it''s'
+flow: [1, two, !Ref Three]
+map: {a: 1, b: x}
+list:
+- plain
+- key: v
+  other: w
+- - nested
+script: |
+  line one
+    indented
+folded: >-
+  one
+  two
+tagged: !GetAtt Res.Arn
+block: !Join
+  - ""
+  - [a, b]
+`
+	v, err := parseYAML(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := v.(map[string]interface{})
+	want := map[string]interface{}{
+		"name": "app", "count": 3, "ratio": 0.5, "enabled": true, "empty": nil,
+		"quoted": `a: "b"`, "single": "it's",
+		"flow":   []interface{}{1, "two", map[string]interface{}{"Ref": "Three"}},
+		"map":    map[string]interface{}{"a": 1, "b": "x"},
+		"list":   []interface{}{"plain", map[string]interface{}{"key": "v", "other": "w"}, []interface{}{"nested"}},
+		"script": "line one\n  indented\n",
+		"folded": "one two",
+		"tagged": map[string]interface{}{"Fn::GetAtt": []interface{}{"Res", "Arn"}},
+		"block":  map[string]interface{}{"Fn::Join": []interface{}{"", []interface{}{"a", "b"}}},
+	}
+	for k, w := range want {
+		if got := m[k]; fmt.Sprintf("%#v", got) != fmt.Sprintf("%#v", w) {
+			t.Errorf("%s = %#v, want %#v", k, got, w)
+		}
+	}
+	if _, err := parseYAML("a:\n\tb: 1"); err == nil {
+		t.Error("tab indentation should fail")
+	}
+}
+
+func TestParseCloudFormation(t *testing.T) {
+	code, err := os.ReadFile("../testkit/scenarios/insecure-stack.cfn.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if DetectIaCType(string(code)) != CloudFormation {
+		t.Fatalf("DetectIaCType = %s", DetectIaCType(string(code)))
+	}
+	resources, err := ParseCloudFormation(string(code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %+v", resources)
+	}
+	bucket, db := resources[0], resources[1]
+	if bucket.Type != "AWS::S3::Bucket" || bucket.Name != "OrdersBucket" || bucket.Line != 11 {
+		t.Errorf("bucket = %s.%s line %d", bucket.Type, bucket.Name, bucket.Line)
+	}
+	if db.Properties["DBInstanceClass"] != "db.t3.micro" || len(db.Resolved) != 1 || db.Resolved[0] != "DBInstanceClass" {
+		t.Errorf("Ref not resolved from parameter default: %v %v", db.Properties["DBInstanceClass"], db.Resolved)
+	}
+	if db.Properties["AllocatedStorage"] != 20 || !strings.Contains(db.RawBlock, `MasterUserPassword = "Sup3rSecretPassw0rd"`) {
+		t.Errorf("db = %+v", db)
+	}
+
+	jsonTmpl := `{"Resources": {"Queue": {"Type": "AWS::SQS::Queue", "Properties": {"DelaySeconds": 5}}}}`
+	resources, err = ParseCloudFormation(jsonTmpl)
+	if err != nil || len(resources) != 1 || resources[0].Properties["DelaySeconds"] != 5 {
+		t.Errorf("JSON template = %+v, %v", resources, err)
+	}
+	if IsCloudFormation(`resource "aws_cloudformation_stack" "s" {
+  template_body = "AWSTemplateFormatVersion: 2010-09-09"
+}`) {
+		t.Error("Terraform embedding a template detected as CloudFormation")
+	}
+}
+
+func TestParsePulumiYAML(t *testing.T) {
+	code, err := os.ReadFile("../testkit/scenarios/insecure-storage.pulumi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if DetectIaCType(string(code)) != Pulumi {
+		t.Fatalf("DetectIaCType = %s", DetectIaCType(string(code)))
+	}
+	resources, err := ParsePulumiYAML(string(code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %+v", resources)
+	}
+	sa, kv := resources[0], resources[1]
+	if sa.Type != "azurerm_storage_account" || sa.Name != "appstore" || sa.Line != 12 {
+		t.Errorf("storage = %s.%s line %d", sa.Type, sa.Name, sa.Line)
+	}
+	if sa.Properties["min_tls_version"] != "TLS1_0" || sa.Properties["allow_blob_public_access"] != true {
+		t.Errorf("storage props = %v", sa.Properties)
+	}
+	if sku, _ := sa.Properties["sku"].(map[string]interface{}); sku["name"] != "Standard_GRS" || len(sa.Resolved) != 1 || sa.Resolved[0] != "sku.name" {
+		t.Errorf("config default not applied: %v %v", sa.Properties["sku"], sa.Resolved)
+	}
+	if kv.Type != "azurerm_key_vault" || kv.Properties["purge_protection_enabled"] != false || kv.Properties["sku_name"] != "standard" {
+		t.Errorf("classic key vault = %s %v", kv.Type, kv.Properties)
+	}
+	if got := snakeCase("enableHTTPSTrafficOnly"); got != "enable_https_traffic_only" {
+		t.Errorf("snakeCase = %q", got)
+	}
+}
+
+func TestARMType(t *testing.T) {
+	for tf, want := range map[string]string{
+		"azurerm_storage_account":         "Microsoft.Storage/storageAccounts",
+		"azurerm_linux_virtual_machine":   "Microsoft.Compute/virtualMachines",
+		"Microsoft.Capacity/reservations": "Microsoft.Capacity/reservations",
+		"azurerm_resource_group":          "",
+	} {
+		if got := ARMType(tf); got != want {
+			t.Errorf("ARMType(%q) = %q, want %q", tf, got, want)
+		}
+	}
+	if got := TerraformProperty("minimumTlsVersion"); got != "min_tls_version" {
+		t.Errorf("TerraformProperty(minimumTlsVersion) = %q", got)
+	}
+	if got := TerraformProperty("httpsOnly"); got != "https_only" {
+		t.Errorf("TerraformProperty(httpsOnly) = %q", got)
+	}
+}
+
+func TestExpandModules(t *testing.T) {
+	root := `module "web" {
+  source = "../modules/app"
+  tier   = var.tier
+}
+
+module "registry" {
+  source  = "Azure/aks/azurerm"
+  version = "7.0.0"
+}`
+	files := []protocol.SourceFile{
+		{Path: "modules/app/variables.tf", Content: "variable \"tier\" {}\nvariable \"replication\" {\n  default = \"GRS\"\n}"},
+		{Path: "modules/app/main.tf", Content: `resource "azurerm_app_service_plan" "plan" {
+  sku_name = var.tier
+}
+
+module "data" {
+  source      = "./data"
+  replication = var.replication
+}`},
+		{Path: "modules/app/data/main.tf", Content: `resource "azurerm_storage_account" "sa" {
+  account_replication_type = var.replication
+}`},
+		{Path: "modules/other/main.tf", Content: `resource "azurerm_key_vault" "kv" {}`},
+	}
+	resources := ExpandModules(root, "envs", files, map[string]interface{}{"tier": "P1v3"})
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 module resources, got %+v", resources)
+	}
+	plan, sa := resources[0], resources[1]
+	if plan.Name != "web.plan" || plan.Properties["sku_name"] != "P1v3" || plan.Line != 1 {
+		t.Errorf("plan = %s line %d %v", plan.Name, plan.Line, plan.Properties)
+	}
+	if sa.Name != "web.data.sa" || sa.Properties["account_replication_type"] != "GRS" {
+		t.Errorf("nested module resource = %s %v", sa.Name, sa.Properties)
+	}
+}
+
+func TestParseTerraformValues(t *testing.T) {
+	code := `locals {
+  env  = "prod"
+  tags = {
+    env = local.env
+  }
+}
+
+output "conn" {
+  value     = azurerm_storage_account.sa.primary_connection_string
+  sensitive = true
+}
+
+resource "azurerm_resource_group" "rg" {
+  name = "rg"
+}`
+	values := ParseTerraformValues(code)
+	if len(values) != 3 {
+		t.Fatalf("got %d values, want 3: %+v", len(values), values)
+	}
+	env, tags, conn := values[0], values[1], values[2]
+	if env.Type != "local" || env.Name != "env" || env.Line != 2 || env.RawBlock != `env  = "prod"` {
+		t.Errorf("env = %+v", env)
+	}
+	if tags.Name != "tags" || tags.Line != 3 || !strings.Contains(tags.RawBlock, "env = local.env") {
+		t.Errorf("tags = %+v", tags)
+	}
+	if conn.Type != "output" || conn.Name != "conn" || conn.Line != 8 || conn.Properties["sensitive"] != true {
+		t.Errorf("conn = %+v", conn)
+	}
+	if conn.Properties["value"] != "azurerm_storage_account.sa.primary_connection_string" {
+		t.Errorf("conn value = %v", conn.Properties["value"])
+	}
+}
+
+func TestParseTerraformDependencies(t *testing.T) {
+	deps := ParseTerraformDependencies(`terraform {
+  required_providers {
+    azurerm = {
+      source  = "hashicorp/azurerm"
+      version = "~> 3.1"
+    }
+    random = "3.5.1"
+  }
+}
+
+module "aks" {
+  source  = "registry.terraform.io/Azure/aks/azurerm"
+  version = ">= 7.0, < 8.0"
+}
+
+module "net" {
+  source = "git::https://github.com/contoso/tf-network.git?ref=v1.4.0"
+}
+
+module "local" {
+  source = "./modules/local"
+}`)
+	want := []Dependency{
+		{Kind: DependencyProvider, Name: "azurerm", Source: "hashicorp/azurerm", Version: "~> 3.1", Line: 3},
+		{Kind: DependencyProvider, Name: "random", Source: "hashicorp/random", Version: "3.5.1", Line: 7},
+		{Kind: DependencyModule, Name: "aks", Source: "Azure/aks/azurerm", Version: ">= 7.0, < 8.0", Line: 11},
+		{Kind: DependencyModule, Name: "net", Source: "git::https://github.com/contoso/tf-network.git", Version: "v1.4.0", Line: 16},
+	}
+	if !reflect.DeepEqual(deps, want) {
+		t.Errorf("deps = %+v\nwant %+v", deps, want)
+	}
+}
+
+func TestSetsKey(t *testing.T) {
+	for _, tc := range []struct {
+		line string
+		want bool
+	}{
+		{`  name = "x"`, true},
+		{"\t\"name\"\t= 1", true},
+		{`name= 1`, true},
+		{`names = 1`, false},
+		{`# name = 1`, false},
+		{`  name {`, false},
+	} {
+		if got := setsKey(tc.line, "name", `"`, '='); got != tc.want {
+			t.Errorf("setsKey(%q) = %v, want %v", tc.line, got, tc.want)
+		}
+	}
+	if !setsKey(`  'Bucket':`, "Bucket", `"'`, ':') {
+		t.Error("setsKey missed a quoted mapping key")
+	}
+	code := "a = 1\nb = 2\n  c = 3"
+	if off := findLine(code, func(l string) bool { return setsKey(l, "c", `"`, '=') }); off != 12 {
+		t.Errorf("findLine = %d, want 12", off)
+	}
+}
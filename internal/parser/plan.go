@@ -0,0 +1,209 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// terraformPlan is the part of `terraform show -json` output agents use.
+type terraformPlan struct {
+	FormatVersion   string `json:"format_version"`
+	ResourceChanges []struct {
+		Address         string      `json:"address"`
+		Mode            string      `json:"mode"`
+		Type            string      `json:"type"`
+		Name            string      `json:"name"`
+		Index           interface{} `json:"index"`
+		PreviousAddress string      `json:"previous_address"`
+		Change          struct {
+			Actions   []string               `json:"actions"`
+			Before    map[string]interface{} `json:"before"`
+			After     map[string]interface{} `json:"after"`
+			Importing interface{}            `json:"importing"`
+			// ReplacePaths are attribute paths, each a list of
+			// attribute names and indexes.
+			ReplacePaths [][]interface{} `json:"replace_paths"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// IsTerraformPlan reports whether code is Terraform plan JSON.
+func IsTerraformPlan(code string) bool {
+	code = strings.TrimSpace(code)
+	return strings.HasPrefix(code, "{") && strings.Contains(code, `"resource_changes"`)
+}
+
+// ParseTerraformPlan extracts the managed resources of a plan from its
+// resource_changes. Each resource carries its planned values, with nested
+// blocks shaped as ParseTerraform shapes them, and a Change describing the
+// action. RawBlock is the planned values rendered as HCL so pattern rules
+// apply unchanged. Data sources are skipped.
+func ParseTerraformPlan(code string) ([]protocol.Resource, error) {
+	var plan terraformPlan
+	if err := json.Unmarshal([]byte(code), &plan); err != nil {
+		return nil, fmt.Errorf("invalid Terraform plan JSON: %w", err)
+	}
+	if plan.FormatVersion == "" {
+		return nil, fmt.Errorf("invalid Terraform plan JSON: missing format_version")
+	}
+	var resources []protocol.Resource
+	for _, rc := range plan.ResourceChanges {
+		if rc.Mode != "managed" {
+			continue
+		}
+		name := rc.Name + planIndex(rc.Index)
+		change := &protocol.Change{
+			Action:    planAction(rc.Change.Actions),
+			Before:    normalizePlanMap(rc.Change.Before),
+			Importing: rc.Change.Importing != nil,
+			// A replace lists its actions in the order Terraform takes them.
+			CreateBeforeDestroy: len(rc.Change.Actions) == 2 && rc.Change.Actions[0] == "create",
+		}
+		for _, path := range rc.Change.ReplacePaths {
+			change.ReplacePaths = append(change.ReplacePaths, planPath(path))
+		}
+		if rc.PreviousAddress != "" {
+			change.PreviousAddress = ResourceAddress(rc.PreviousAddress)
+		}
+		props := normalizePlanMap(rc.Change.After)
+		if change.Action == protocol.ActionDelete {
+			props = change.Before
+		}
+		if props == nil {
+			props = make(map[string]interface{})
+		}
+		var raw strings.Builder
+		fmt.Fprintf(&raw, "resource %q %q {\n", rc.Type, name)
+		writeHCL(&raw, props, "  ")
+		raw.WriteString("}")
+		resources = append(resources, protocol.Resource{
+			Type:       rc.Type,
+			Name:       name,
+			Properties: props,
+			RawBlock:   raw.String(),
+			Change:     change,
+		})
+	}
+	return resources, nil
+}
+
+// planAction reduces a plan's action list to one protocol action.
+func planAction(actions []string) string {
+	switch {
+	case len(actions) == 2:
+		return protocol.ActionReplace
+	case len(actions) == 1:
+		return actions[0]
+	}
+	return protocol.ActionNoOp
+}
+
+// planPath renders an attribute path as it is written in HCL:
+// ["network_rules", 0, "subnet_id"] is "network_rules[0].subnet_id".
+func planPath(path []interface{}) string {
+	var sb strings.Builder
+	for _, step := range path {
+		switch s := step.(type) {
+		case string:
+			if sb.Len() > 0 {
+				sb.WriteByte('.')
+			}
+			sb.WriteString(s)
+		default:
+			sb.WriteString(planIndex(s))
+		}
+	}
+	return sb.String()
+}
+
+// planIndex renders a count or for_each index as it appears in addresses.
+func planIndex(index interface{}) string {
+	switch i := index.(type) {
+	case float64:
+		return fmt.Sprintf("[%d]", int(i))
+	case string:
+		return "[" + strconv.Quote(i) + "]"
+	}
+	return ""
+}
+
+// normalizePlanMap shapes plan values like parsed HCL: whole numbers become
+// ints, and single-item lists of objects, which is how plans encode nested
+// blocks, become the object. Null values are dropped.
+func normalizePlanMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if v != nil {
+			out[k] = normalizePlanValue(v)
+		}
+	}
+	return out
+}
+
+func normalizePlanValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case float64:
+		if val == math.Trunc(val) && math.Abs(val) < 1<<53 {
+			return int(val)
+		}
+	case map[string]interface{}:
+		return normalizePlanMap(val)
+	case []interface{}:
+		if len(val) == 1 {
+			if obj, ok := val[0].(map[string]interface{}); ok {
+				return normalizePlanMap(obj)
+			}
+		}
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = normalizePlanValue(item)
+		}
+		return out
+	}
+	return v
+}
+
+// writeHCL renders props as HCL attributes, with maps as nested blocks.
+func writeHCL(sb *strings.Builder, props map[string]interface{}, indent string) {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch v := props[k].(type) {
+		case map[string]interface{}:
+			fmt.Fprintf(sb, "%s%s {\n", indent, k)
+			writeHCL(sb, v, indent+"  ")
+			fmt.Fprintf(sb, "%s}\n", indent)
+		default:
+			fmt.Fprintf(sb, "%s%s = %s\n", indent, k, hclLiteral(v))
+		}
+	}
+}
+
+func hclLiteral(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		return strconv.Quote(val)
+	case []interface{}:
+		items := make([]string, len(val))
+		for i, item := range val {
+			items[i] = hclLiteral(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		data, _ := json.Marshal(val)
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,219 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+var (
+	pulumiResourcesRe = regexp.MustCompile(`(?m)^resources:[ \t]*(#.*)?$`)
+	pulumiTypeRe      = regexp.MustCompile(`(?m)^\s+type:\s*["']?[\w-]+:[\w/.-]*:\w+`)
+	pulumiInterpRe    = regexp.MustCompile(`^\$\{([\w.-]+)\}$`)
+)
+
+// pulumiTFTypes are the azurerm types classic azure provider tokens are
+// matched against, besides the Bicep mapping's.
+var pulumiTFTypes = []string{
+	"azurerm_linux_virtual_machine", "azurerm_windows_virtual_machine",
+	"azurerm_kubernetes_cluster_node_pool", "azurerm_storage_container",
+	"azurerm_subnet", "azurerm_app_service_plan",
+}
+
+// IsPulumiYAML reports whether code is a Pulumi YAML program.
+func IsPulumiYAML(code string) bool {
+	return pulumiResourcesRe.MatchString(code) && pulumiTypeRe.MatchString(code)
+}
+
+// ParsePulumiYAML extracts the resources of a Pulumi YAML program. Azure
+// resources are mapped onto the Terraform model: azure-native tokens
+// ("azure-native:storage:StorageAccount") through their ARM type as for
+// Bicep, and classic azure tokens ("azure:storage:Account") to the azurerm
+// type they wrap, with property names in snake_case. Other providers keep
+// their token as type. A property that is exactly "${name}" for a config
+// value with a default takes the default and is recorded in
+// Resource.Resolved.
+func ParsePulumiYAML(code string) ([]protocol.Resource, error) {
+	doc, err := parseYAML(code)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Pulumi YAML: %w", err)
+	}
+	prog, _ := doc.(map[string]interface{})
+	resources, ok := prog["resources"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid Pulumi YAML: no resources")
+	}
+
+	defaults := make(map[string]interface{})
+	config, _ := prog["config"].(map[string]interface{})
+	for name, c := range config {
+		if m, ok := c.(map[string]interface{}); ok && m["default"] != nil {
+			defaults[name] = m["default"]
+		}
+	}
+
+	section := sectionEnd(pulumiResourcesRe, code)
+	out := make([]protocol.Resource, 0, len(resources))
+	for name, v := range resources {
+		res, _ := v.(map[string]interface{})
+		token, _ := res["type"].(string)
+		if token == "" {
+			continue
+		}
+		var resolved []string
+		props, _ := pulumiResolveConfig(res["properties"], defaults, "", &resolved).(map[string]interface{})
+		if props == nil {
+			props = make(map[string]interface{})
+		}
+		resType, props := pulumiResource(token, props)
+		for i, path := range resolved {
+			resolved[i] = pulumiPropertyPath(token, path)
+		}
+		sort.Strings(resolved)
+		var raw strings.Builder
+		fmt.Fprintf(&raw, "resource %q %q {\n", resType, name)
+		writeHCL(&raw, props, "  ")
+		raw.WriteString("}")
+		out = append(out, protocol.Resource{
+			Type:       resType,
+			Name:       name,
+			Properties: props,
+			RawBlock:   raw.String(),
+			Line:       keyLine(code, section, name),
+			Resolved:   resolved,
+		})
+	}
+	sortByLine(out)
+	return out, nil
+}
+
+// pulumiResource maps a type token and its properties onto the model.
+func pulumiResource(token string, props map[string]interface{}) (string, map[string]interface{}) {
+	parts := strings.Split(token, ":")
+	if len(parts) != 3 {
+		return token, props
+	}
+	pkg, module, name := parts[0], strings.ToLower(parts[1]), parts[2]
+	if i := strings.IndexByte(module, '/'); i >= 0 {
+		module = module[:i] // "storage/v20230101" or "storage/account"
+	}
+	switch pkg {
+	case "azure-native":
+		for armType, tfType := range bicepToTFType {
+			ns, rest, _ := strings.Cut(strings.TrimPrefix(armType, "Microsoft."), "/")
+			last := strings.ToLower(rest[strings.LastIndexByte(rest, '/')+1:])
+			lower := strings.ToLower(name)
+			if strings.ToLower(ns) == module && (last == lower || last == lower+"s" || last == lower+"es") {
+				return tfType, flattenBicepProperties(props)
+			}
+		}
+	case "azure":
+		snake := snakeCase(name)
+		tfType := "azurerm_" + module + "_" + snake
+		for _, candidate := range []string{tfType, "azurerm_" + snake} {
+			if knownTFType(candidate) {
+				tfType = candidate
+				break
+			}
+		}
+		return tfType, snakeKeys(props).(map[string]interface{})
+	}
+	return token, props
+}
+
+// pulumiPropertyPath maps a resolved property path the way pulumiResource
+// maps its property.
+func pulumiPropertyPath(token, path string) string {
+	switch {
+	case strings.HasPrefix(token, "azure:"):
+		parts := strings.Split(path, ".")
+		for i, p := range parts {
+			parts[i] = snakeCase(p)
+		}
+		return strings.Join(parts, ".")
+	case strings.HasPrefix(token, "azure-native:"):
+		return armPropertyPath(path)
+	}
+	return path
+}
+
+func knownTFType(t string) bool {
+	for _, known := range bicepToTFType {
+		if known == t {
+			return true
+		}
+	}
+	for _, known := range pulumiTFTypes {
+		if known == t {
+			return true
+		}
+	}
+	return false
+}
+
+// pulumiResolveConfig replaces "${name}" with the default of config value
+// name, appending the path of each replaced value to resolved.
+func pulumiResolveConfig(v interface{}, defaults map[string]interface{}, path string, resolved *[]string) interface{} {
+	switch val := v.(type) {
+	case string:
+		if m := pulumiInterpRe.FindStringSubmatch(val); m != nil {
+			if def, ok := defaults[m[1]]; ok {
+				*resolved = append(*resolved, path)
+				return def
+			}
+		}
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = pulumiResolveConfig(item, defaults, joinPath(path, k), resolved)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = pulumiResolveConfig(item, defaults, fmt.Sprintf("%s[%d]", path, i), resolved)
+		}
+		return out
+	}
+	return v
+}
+
+// snakeKeys converts map keys from camelCase to snake_case recursively.
+func snakeKeys(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[snakeCase(k)] = snakeKeys(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = snakeKeys(item)
+		}
+		return out
+	}
+	return v
+}
+
+// snakeCase converts "minTlsVersion" or "KeyVault" to "min_tls_version" or
+// "key_vault".
+func snakeCase(s string) string {
+	var sb strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				sb.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
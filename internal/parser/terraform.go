@@ -2,6 +2,7 @@ package parser
 
 import (
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -10,12 +11,18 @@ import (
 
 var tfResourceRe = regexp.MustCompile(`resource\s+"([^"]+)"\s+"([^"]+)"\s*\{`)
 
-// ParseTerraform extracts resources from Terraform HCL code.
+// ParseTerraform extracts resources from Terraform HCL code. azapi_resource
+// blocks are reported under the type of the ARM resource they manage.
 func ParseTerraform(code string) []protocol.Resource {
 	var resources []protocol.Resource
 	matches := tfResourceRe.FindAllStringSubmatchIndex(code, -1)
 
 	for _, loc := range matches {
+		// Skip headers that are commented out or inside another value.
+		lineStart := strings.LastIndex(code[:loc[0]], "\n") + 1
+		if strings.TrimSpace(code[lineStart:loc[0]]) != "" {
+			continue
+		}
 		resType := code[loc[2]:loc[3]]
 		resName := code[loc[4]:loc[5]]
 		braceStart := strings.Index(code[loc[0]:], "{")
@@ -23,7 +30,7 @@ func ParseTerraform(code string) []protocol.Resource {
 			continue
 		}
 		braceStart += loc[0]
-		braceEnd := findMatchingBrace(code, braceStart)
+		braceEnd := findTerraformBlockEnd(code, braceStart)
 		if braceEnd < 0 {
 			continue
 		}
@@ -32,6 +39,9 @@ func ParseTerraform(code string) []protocol.Resource {
 		lineNum := strings.Count(code[:loc[0]], "\n") + 1
 
 		props := parseTerraformBlock(block)
+		if resType == "azapi_resource" {
+			resType, props = azapiResource(props, code[loc[0]:braceEnd+1])
+		}
 		resources = append(resources, protocol.Resource{
 			Type:       resType,
 			Name:       resName,
@@ -41,10 +51,16 @@ func ParseTerraform(code string) []protocol.Resource {
 		})
 	}
 
+	if locals := TerraformLocals(code); len(locals) > 0 {
+		applyLocals(resources, locals)
+	}
 	return resources
 }
 
 // parseTerraformBlock parses key = value pairs and nested blocks from HCL.
+// Heredocs become strings, expressions spanning several lines (function
+// calls, conditionals in parentheses) are joined into one, and dynamic
+// blocks are stored like the blocks their content generates.
 func parseTerraformBlock(block string) map[string]interface{} {
 	props := make(map[string]interface{})
 	lines := strings.Split(block, "\n")
@@ -57,22 +73,49 @@ func parseTerraformBlock(block string) map[string]interface{} {
 
 		// Key = value
 		if eqIdx := strings.Index(line, "="); eqIdx > 0 {
-			key := strings.TrimSpace(line[:eqIdx])
+			key := strings.Trim(strings.TrimSpace(line[:eqIdx]), `"`)
 			val := strings.TrimSpace(line[eqIdx+1:])
 
+			// Heredoc: key = <<EOT
+			if delim, indented, ok := heredocStart(val); ok && strings.HasPrefix(val, "<<") {
+				props[key], i = readHeredoc(lines, i, delim, indented)
+				continue
+			}
+
+			// Multi-line list: key = [
+			if depth := bracketDepth(val); strings.HasPrefix(val, "[") && depth > 0 {
+				items := []string{stripTerraformComment(val)}
+				for i++; i < len(lines) && depth > 0; i++ {
+					l := stripTerraformComment(strings.TrimSpace(lines[i]))
+					depth += bracketDepth(l)
+					items = append(items, l)
+				}
+				i--
+				props[key] = parseTerraformValue(strings.Join(items, "\n"))
+				continue
+			}
+
+			// Multi-line expression: key = merge(var.tags, {
+			if depth := terraformNesting(val, "([{", ")]}"); depth > 0 && !strings.HasPrefix(val, "{") {
+				parts := []string{stripTerraformComment(val)}
+				for i++; i < len(lines) && depth > 0; i++ {
+					l := stripTerraformComment(strings.TrimSpace(lines[i]))
+					depth += terraformNesting(l, "([{", ")]}")
+					parts = append(parts, l)
+				}
+				i--
+				props[key] = strings.Join(parts, " ")
+				continue
+			}
+
 			// Nested block: key = {
 			if val == "{" || strings.HasSuffix(val, "{") {
-				// Collect until matching brace
-				depth := 1
 				var nested []string
-				for i++; i < len(lines) && depth > 0; i++ {
-					l := strings.TrimSpace(lines[i])
-					depth += strings.Count(l, "{") - strings.Count(l, "}")
-					if depth > 0 {
-						nested = append(nested, lines[i])
-					}
+				nested, i = collectTerraformBlock(lines, i)
+				if body := strings.TrimSpace(strings.Join(nested, "\n")); isForExpression(body) {
+					props[key] = "{ " + strings.Join(strings.Fields(body), " ") + " }"
+					continue
 				}
-				i-- // back up since the for loop will increment
 				props[key] = parseTerraformBlock(strings.Join(nested, "\n"))
 				continue
 			}
@@ -87,32 +130,84 @@ func parseTerraformBlock(block string) map[string]interface{} {
 			if key == "" {
 				continue
 			}
-			depth := 1
 			var nested []string
-			for i++; i < len(lines) && depth > 0; i++ {
-				l := strings.TrimSpace(lines[i])
-				depth += strings.Count(l, "{") - strings.Count(l, "}")
-				if depth > 0 {
-					nested = append(nested, lines[i])
+			nested, i = collectTerraformBlock(lines, i)
+			body := parseTerraformBlock(strings.Join(nested, "\n"))
+
+			// dynamic "security_rule" { content { ... } }
+			if name, ok := strings.CutPrefix(key, "dynamic "); ok {
+				content, _ := body["content"].(map[string]interface{})
+				if content == nil {
+					content = make(map[string]interface{})
 				}
+				key = strings.Trim(strings.TrimSpace(name), `"`)
+				props[key] = addBlock(props[key], content)
+				continue
 			}
-			i-- // back up
-			props[key] = parseTerraformBlock(strings.Join(nested, "\n"))
+			props[key] = addBlock(props[key], body)
 		}
 	}
 
 	return props
 }
 
-// parseTerraformValue converts a string value to a typed Go value.
-func parseTerraformValue(val string) interface{} {
-	// Remove trailing comments
+// addBlock stores a nested block under its name. A block repeated under the
+// same name (e.g. several security_rule blocks) becomes a list of maps; a
+// single block stays a map.
+func addBlock(existing interface{}, block map[string]interface{}) interface{} {
+	switch prev := existing.(type) {
+	case map[string]interface{}:
+		return []interface{}{prev, block}
+	case []interface{}:
+		return append(prev, block)
+	default:
+		return block
+	}
+}
+
+// isForExpression reports whether the contents of a list or object
+// constructor are a for expression rather than literal items.
+func isForExpression(body string) bool {
+	body = strings.TrimSpace(body)
+	return strings.HasPrefix(body, "for ") && strings.Contains(body, ":")
+}
+
+// stripTerraformComment removes a trailing # or // comment.
+func stripTerraformComment(val string) string {
 	if idx := strings.Index(val, " #"); idx > 0 {
 		val = strings.TrimSpace(val[:idx])
 	}
 	if idx := strings.Index(val, " //"); idx > 0 {
 		val = strings.TrimSpace(val[:idx])
 	}
+	return val
+}
+
+// parseTerraformValue converts a string value to a typed Go value. Lists
+// become []interface{} and inline objects map[string]interface{}.
+func parseTerraformValue(val string) interface{} {
+	val = stripTerraformComment(val)
+
+	// for expressions are kept as written: [for s in var.list : upper(s)]
+	if (strings.HasPrefix(val, "[") || strings.HasPrefix(val, "{")) && isForExpression(val[1:]) {
+		return val
+	}
+
+	// List: [a, b]
+	if strings.HasPrefix(val, "[") && strings.HasSuffix(val, "]") {
+		items := []interface{}{}
+		for _, item := range splitTopLevel(val[1:len(val)-1], ",\n") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, parseTerraformValue(item))
+			}
+		}
+		return items
+	}
+
+	// Inline object: { a = 1, b = "x" }
+	if strings.HasPrefix(val, "{") && strings.HasSuffix(val, "}") {
+		return parseTerraformBlock(strings.Join(splitTopLevel(val[1:len(val)-1], ","), "\n"))
+	}
 
 	// Quoted string
 	if strings.HasPrefix(val, "\"") && strings.HasSuffix(val, "\"") {
@@ -142,3 +237,189 @@ func parseTerraformValue(val string) interface{} {
 
 	return val
 }
+
+var (
+	tfMovedRe   = regexp.MustCompile(`(?m)^\s*moved\s*\{`)
+	tfImportRe  = regexp.MustCompile(`(?m)^\s*import\s*\{`)
+	tfIndexRe   = regexp.MustCompile(`\[[^\]]*\]`)
+	tfModulesRe = regexp.MustCompile(`^(module\.[\w-]+(\[[^\]]*\])?\.)+`)
+)
+
+// Move is a Terraform moved block: the resource at From is now addressed as
+// To, with no change to the infrastructure.
+type Move struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Line int    `json:"line"`
+}
+
+// Import is a Terraform import block: the resource at To adopts existing
+// infrastructure with the given ID rather than creating it.
+type Import struct {
+	To   string `json:"to"`
+	ID   string `json:"id"`
+	Line int    `json:"line"`
+}
+
+// ParseTerraformMoves extracts moved blocks. Addresses are normalized to
+// "type.name" (see ResourceAddress).
+func ParseTerraformMoves(code string) []Move {
+	var moves []Move
+	for _, b := range terraformBlocks(code, tfMovedRe) {
+		from, _ := b.props["from"].(string)
+		to, _ := b.props["to"].(string)
+		if from == "" || to == "" {
+			continue
+		}
+		moves = append(moves, Move{From: ResourceAddress(from), To: ResourceAddress(to), Line: b.line})
+	}
+	return moves
+}
+
+// ParseTerraformImports extracts import blocks.
+func ParseTerraformImports(code string) []Import {
+	var imports []Import
+	for _, b := range terraformBlocks(code, tfImportRe) {
+		to, _ := b.props["to"].(string)
+		if to == "" {
+			continue
+		}
+		id, _ := b.props["id"].(string)
+		imports = append(imports, Import{To: ResourceAddress(to), ID: id, Line: b.line})
+	}
+	return imports
+}
+
+// ResourceAddress reduces a Terraform address to "type.name", dropping
+// module paths and count/for_each indexes, so it matches the IDs of parsed
+// resources.
+func ResourceAddress(addr string) string {
+	addr = tfModulesRe.ReplaceAllString(strings.TrimSpace(addr), "")
+	return tfIndexRe.ReplaceAllString(addr, "")
+}
+
+type tfBlock struct {
+	props map[string]interface{}
+	line  int
+}
+
+// terraformBlocks parses every top-level block whose header matches re.
+func terraformBlocks(code string, re *regexp.Regexp) []tfBlock {
+	var blocks []tfBlock
+	for _, loc := range re.FindAllStringIndex(code, -1) {
+		braceStart := loc[1] - 1
+		braceEnd := findTerraformBlockEnd(code, braceStart)
+		if braceEnd < 0 {
+			continue
+		}
+		blocks = append(blocks, tfBlock{
+			props: parseTerraformBlock(code[braceStart+1 : braceEnd]),
+			line:  strings.Count(code[:loc[1]], "\n") + 1,
+		})
+	}
+	return blocks
+}
+
+var tfOutputRe = regexp.MustCompile(`(?m)^[ \t]*output\s+"([^"]+)"\s*\{`)
+
+// ParseTerraformValues returns a configuration's outputs and locals as
+// resources of type "output" and "local", so rules can scan what it
+// exposes and derives. An output's properties are its block (value,
+// sensitive, ...); a local's are {"value": v}, with its assignment as
+// RawBlock.
+func ParseTerraformValues(code string) []protocol.Resource {
+	var values []protocol.Resource
+	for _, loc := range tfOutputRe.FindAllStringSubmatchIndex(code, -1) {
+		braceStart := loc[1] - 1
+		braceEnd := findTerraformBlockEnd(code, braceStart)
+		if braceEnd < 0 {
+			continue
+		}
+		values = append(values, protocol.Resource{
+			Type:       "output",
+			Name:       code[loc[2]:loc[3]],
+			Properties: parseTerraformBlock(code[braceStart+1 : braceEnd]),
+			Line:       strings.Count(code[:loc[0]], "\n") + 1,
+			RawBlock:   strings.TrimSpace(code[loc[0] : braceEnd+1]),
+		})
+	}
+	for _, loc := range tfLocalsRe.FindAllStringIndex(code, -1) {
+		braceStart := loc[1] - 1
+		braceEnd := findTerraformBlockEnd(code, braceStart)
+		if braceEnd < 0 {
+			continue
+		}
+		body := code[braceStart+1 : braceEnd]
+		lines := strings.Split(body, "\n")
+		first := strings.Count(code[:braceStart], "\n") + 1
+		props := parseTerraformBlock(body)
+		starts := make(map[string]int, len(props))
+		var order []int
+		for name := range props {
+			if l := localLine(body, name); l > 0 {
+				starts[name] = l
+				order = append(order, l)
+			}
+		}
+		sort.Ints(order)
+		for name, l := range starts {
+			// A local's source runs to the next assignment.
+			end := len(lines)
+			if i := sort.SearchInts(order, l+1); i < len(order) {
+				end = order[i] - 1
+			}
+			values = append(values, protocol.Resource{
+				Type:       "local",
+				Name:       name,
+				Properties: map[string]interface{}{"value": props[name]},
+				Line:       first + l - 1,
+				RawBlock:   strings.TrimSpace(strings.Join(lines[l-1:end], "\n")),
+			})
+		}
+	}
+	sortByLine(values)
+	return values
+}
+
+// localLine returns the 1-based line within body that assigns name, or 0.
+func localLine(body, name string) int {
+	off := findLine(body, func(line string) bool { return setsKey(line, name, `"`, '=') })
+	if off < 0 {
+		return 0
+	}
+	return strings.Count(body[:off], "\n") + 1
+}
+
+// findLine returns the offset of the first line of text that match
+// accepts, or -1. Names are matched by hand rather than with an expression
+// compiled per name, which would dominate parsing large files.
+func findLine(text string, match func(line string) bool) int {
+	for off := 0; ; {
+		line, _, more := strings.Cut(text[off:], "\n")
+		if match(line) {
+			return off
+		}
+		if !more {
+			return -1
+		}
+		off += len(line) + 1
+	}
+}
+
+// setsKey reports whether line sets key: leading blanks, the key, which
+// may be wrapped in one of quotes, blanks and sep.
+func setsKey(line, key, quotes string, sep byte) bool {
+	s := strings.TrimLeft(line, " \t")
+	if s != "" && strings.IndexByte(quotes, s[0]) >= 0 {
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, key) {
+		return false
+	}
+	s = s[len(key):]
+	if s != "" && strings.IndexByte(quotes, s[0]) >= 0 {
+		s = s[1:]
+	}
+	s = strings.TrimLeft(s, " \t\r")
+	return s != "" && s[0] == sep
+}
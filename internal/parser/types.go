@@ -1,4 +1,5 @@
-// Package parser provides shared Terraform and Bicep parsing for IaC analysis.
+// Package parser provides shared Terraform, Bicep, Pulumi YAML and
+// CloudFormation parsing for IaC analysis.
 // It extracts resource definitions, properties, and structure from IaC code.
 package parser
 
@@ -8,9 +9,11 @@ import "strings"
 type IaCType string
 
 const (
-	Terraform IaCType = "Terraform"
-	Bicep     IaCType = "Bicep"
-	Unknown   IaCType = "Unknown"
+	Terraform      IaCType = "Terraform"
+	Bicep          IaCType = "Bicep"
+	Pulumi         IaCType = "Pulumi"
+	CloudFormation IaCType = "CloudFormation"
+	Unknown        IaCType = "Unknown"
 )
 
 // ShortType strips the provider prefix from a resource type.
@@ -0,0 +1,339 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is one non-blank source line with its indentation.
+type yamlLine struct {
+	num    int // 1-based
+	indent int
+	text   string // without indentation
+}
+
+// ParseYAML decodes the first document of a YAML file, as parseYAML does,
+// for callers that read YAML configuration such as external rule files.
+func ParseYAML(data string) (interface{}, error) {
+	return parseYAML(data)
+}
+
+// parseYAML reads the first document of a YAML file into maps, slices and
+// scalars shaped like parsed HCL: whole numbers are ints. It covers the
+// subset infrastructure templates use: block mappings and sequences, flow
+// collections on one line, quoted and plain scalars, literal and folded
+// block scalars, comments, and local tags, which become a one-key map as in
+// CloudFormation JSON (!Ref x is {"Ref": "x"}, !Sub s is {"Fn::Sub": s}).
+// Anchors, aliases and multi-line plain scalars are not supported.
+func parseYAML(code string) (interface{}, error) {
+	var lines []yamlLine
+	raw := strings.Split(strings.ReplaceAll(code, "\r\n", "\n"), "\n")
+	for i, l := range raw {
+		trimmed := strings.TrimLeft(l, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tab indentation", i+1)
+		}
+		if trimmed == "---" && len(lines) == 0 {
+			continue
+		}
+		if trimmed == "---" || trimmed == "..." {
+			break
+		}
+		lines = append(lines, yamlLine{num: i + 1, indent: len(l) - len(trimmed), text: trimmed})
+	}
+	p := &yamlParser{lines: lines}
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	v := p.node(p.lines[p.pos].indent)
+	p.skipBlank()
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("yaml: line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return v, p.err
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+	err   error
+}
+
+// skipBlank advances past blank and comment-only lines.
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) {
+		t := p.lines[p.pos].text
+		if t != "" && !strings.HasPrefix(t, "#") {
+			return
+		}
+		p.pos++
+	}
+}
+
+// node parses the mapping or sequence starting at the current line.
+func (p *yamlParser) node(indent int) interface{} {
+	if isYAMLSeqItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) []interface{} {
+	out := []interface{}{}
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		l := &p.lines[p.pos]
+		if l.indent != indent || !isYAMLSeqItem(l.text) {
+			break
+		}
+		rest := strings.TrimLeft(l.text[1:], " ")
+		if rest == "" || strings.HasPrefix(rest, "#") {
+			p.pos++
+			out = append(out, p.child(indent, true))
+			continue
+		}
+		if _, _, ok := splitYAMLKey(rest); ok || isYAMLSeqItem(rest) {
+			// "- key: value" starts a mapping (or "- - x" a sequence) whose
+			// further entries are indented to the same column.
+			l.indent += len(l.text) - len(rest)
+			l.text = rest
+			out = append(out, p.node(l.indent))
+			continue
+		}
+		p.pos++
+		out = append(out, p.value(rest, indent))
+	}
+	return out
+}
+
+func (p *yamlParser) mapping(indent int) map[string]interface{} {
+	out := make(map[string]interface{})
+	for p.skipBlank(); p.pos < len(p.lines); p.skipBlank() {
+		l := p.lines[p.pos]
+		if l.indent != indent || isYAMLSeqItem(l.text) {
+			break
+		}
+		key, rest, ok := splitYAMLKey(l.text)
+		if !ok {
+			p.fail(l.num, "expected key: value")
+			p.pos++
+			continue
+		}
+		p.pos++
+		if rest == "" || strings.HasPrefix(rest, "#") {
+			out[key] = p.child(indent, false)
+			continue
+		}
+		out[key] = p.value(rest, indent)
+	}
+	return out
+}
+
+// child parses the block nested under a key or sequence dash at indent. A
+// sequence may sit at the key's own indentation.
+func (p *yamlParser) child(indent int, inSeq bool) interface{} {
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return nil
+	}
+	l := p.lines[p.pos]
+	if l.indent > indent || (!inSeq && l.indent == indent && isYAMLSeqItem(l.text)) {
+		return p.node(l.indent)
+	}
+	return nil
+}
+
+// value parses the text after "key:" or "- ", which may continue on the
+// following lines as a block scalar or, after a tag, a nested block.
+func (p *yamlParser) value(text string, indent int) interface{} {
+	text = stripYAMLComment(text)
+	if strings.HasPrefix(text, "!") {
+		tag, rest, _ := strings.Cut(text, " ")
+		rest = strings.TrimSpace(rest)
+		var v interface{}
+		if rest == "" {
+			v = p.child(indent, false)
+		} else {
+			v = p.value(rest, indent)
+		}
+		return yamlTag(tag[1:], v)
+	}
+	if strings.HasPrefix(text, "|") || strings.HasPrefix(text, ">") {
+		return p.blockScalar(text, indent)
+	}
+	return parseYAMLScalar(text)
+}
+
+// blockScalar reads a literal (|) or folded (>) scalar's indented lines.
+func (p *yamlParser) blockScalar(header string, indent int) string {
+	var body []string
+	start := p.pos
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.text != "" && l.indent <= indent {
+			break
+		}
+		body = append(body, l.text)
+		p.pos++
+	}
+	// Keep indentation beyond the block's own.
+	blockIndent := -1
+	for i := range body {
+		if l := p.lines[start+i]; l.text != "" && (blockIndent < 0 || l.indent < blockIndent) {
+			blockIndent = l.indent
+		}
+	}
+	for i := range body {
+		if l := p.lines[start+i]; l.text != "" {
+			body[i] = strings.Repeat(" ", l.indent-blockIndent) + l.text
+		}
+	}
+	for len(body) > 0 && body[len(body)-1] == "" {
+		body = body[:len(body)-1]
+	}
+	sep := "\n"
+	if header[0] == '>' {
+		sep = " "
+	}
+	s := strings.Join(body, sep)
+	if !strings.Contains(header, "-") && s != "" {
+		s += "\n"
+	}
+	return s
+}
+
+func (p *yamlParser) fail(line int, msg string) {
+	if p.err == nil {
+		p.err = fmt.Errorf("yaml: line %d: %s", line, msg)
+	}
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits "key: value" at the first colon followed by a space
+// or the end of the line, outside quotes and flow collections.
+func splitYAMLKey(text string) (key, rest string, ok bool) {
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return "", "", false
+	}
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == '#' && i > 0 && text[i-1] == ' ':
+			return "", "", false
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			key = strings.TrimSpace(text[:i])
+			if s, ok := parseYAMLScalar(key).(string); ok {
+				key = s
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// stripYAMLComment removes a trailing " # comment" outside quotes.
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' '):
+			return strings.TrimSpace(text[:i])
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// yamlTag applies a local tag the CloudFormation way.
+func yamlTag(tag string, v interface{}) interface{} {
+	switch tag {
+	case "Ref", "Condition":
+		return map[string]interface{}{tag: v}
+	case "GetAtt":
+		if s, ok := v.(string); ok {
+			if res, attr, ok := strings.Cut(s, "."); ok {
+				v = []interface{}{res, attr}
+			}
+		}
+	}
+	return map[string]interface{}{"Fn::" + tag: v}
+}
+
+// parseYAMLScalar parses a quoted, plain or single-line flow value.
+func parseYAMLScalar(text string) interface{} {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return nil
+	case strings.HasPrefix(text, `"`) && strings.HasSuffix(text, `"`) && len(text) >= 2:
+		if s, err := strconv.Unquote(text); err == nil {
+			return s
+		}
+		return text[1 : len(text)-1]
+	case strings.HasPrefix(text, "'") && strings.HasSuffix(text, "'") && len(text) >= 2:
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'")
+	case strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]"):
+		out := []interface{}{}
+		if inner := strings.TrimSpace(text[1 : len(text)-1]); inner != "" {
+			for _, item := range splitTopLevel(inner, ",") {
+				out = append(out, parseYAMLFlowItem(item))
+			}
+		}
+		return out
+	case strings.HasPrefix(text, "{") && strings.HasSuffix(text, "}"):
+		out := make(map[string]interface{})
+		if inner := strings.TrimSpace(text[1 : len(text)-1]); inner != "" {
+			for _, item := range splitTopLevel(inner, ",") {
+				if k, v, ok := splitYAMLKey(strings.TrimSpace(item)); ok {
+					out[k] = parseYAMLFlowItem(v)
+				}
+			}
+		}
+		return out
+	}
+	switch text {
+	case "null", "Null", "NULL", "~":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if n, err := strconv.Atoi(text); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil && strings.ContainsAny(text, ".eE") && !strings.ContainsAny(text, "xX_") {
+		return f
+	}
+	return text
+}
+
+// parseYAMLFlowItem parses one item of a flow collection, which may carry
+// a tag.
+func parseYAMLFlowItem(item string) interface{} {
+	item = strings.TrimSpace(item)
+	if strings.HasPrefix(item, "!") {
+		tag, rest, _ := strings.Cut(item, " ")
+		return yamlTag(tag[1:], parseYAMLScalar(rest))
+	}
+	return parseYAMLScalar(item)
+}
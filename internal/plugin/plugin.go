@@ -0,0 +1,307 @@
+// Package plugin runs custom agents as external processes, so that
+// enterprises can add proprietary checks (such as CMDB validation) without
+// forking the codebase.
+//
+// A plugin is described by a JSON manifest in the plugin directory:
+//
+//	{
+//	  "id": "cmdb",
+//	  "name": "CMDB Validation",
+//	  "description": "Checks that every resource is registered in the CMDB",
+//	  "command": "./cmdb-check",
+//	  "args": ["--strict"],
+//	  "workflows": ["analyze"],
+//	  "formats": ["terraform", "bicep"],
+//	  "timeout": "30s"
+//	}
+//
+// For each request the host starts command (relative paths are resolved
+// against the manifest's directory), writes one JSON Request to its stdin
+// and reads one JSON Response from its stdout. A non-zero exit or a
+// Response with an error fails the run; stderr is included in the error.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/config"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+const (
+	// ProtocolVersion is sent with every Request.
+	ProtocolVersion = 1
+	// DefaultTimeout bounds a plugin run when its manifest sets none.
+	DefaultTimeout = 30 * time.Second
+	// maxOutput caps what a plugin may write to stdout.
+	maxOutput = 4 << 20
+	// maxStderr caps the stderr quoted in errors.
+	maxStderr = 512
+)
+
+// Manifest describes a plugin.
+type Manifest struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Version     string   `json:"version"`
+	Command     string   `json:"command"`
+	Args        []string `json:"args,omitempty"`
+	// Workflows are the orchestrator intents ("analyze", "cost", "ops",
+	// "generate") the plugin runs in, after the built-in agents.
+	Workflows []string `json:"workflows,omitempty"`
+	// Formats restricts the plugin to IaC formats; empty accepts any input,
+	// including none.
+	Formats []protocol.SourceFormat `json:"formats,omitempty"`
+	Timeout string                  `json:"timeout,omitempty"`
+
+	timeout time.Duration
+}
+
+var idRe = regexp.MustCompile(`^[a-z][a-z0-9-]{0,31}$`)
+
+// workflows are the orchestrator intents a plugin can join.
+var workflows = map[string]bool{"analyze": true, "cost": true, "ops": true, "generate": true}
+
+// Load reads every *.json manifest in dir, in name order. ${VAR}
+// references are expanded from the environment. An empty dir loads
+// nothing.
+func Load(dir string) ([]Manifest, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("list plugins: %w", err)
+	}
+	sort.Strings(paths)
+	manifests := make([]Manifest, 0, len(paths))
+	seen := make(map[string]string)
+	for _, p := range paths {
+		m, err := readManifest(p)
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := seen[m.ID]; ok {
+			return nil, fmt.Errorf("plugin %s: id %q is already used by %s", filepath.Base(p), m.ID, filepath.Base(prev))
+		}
+		seen[m.ID] = p
+		manifests = append(manifests, m)
+	}
+	return manifests, nil
+}
+
+func readManifest(path string) (Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("read plugin: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(config.ExpandEnv(data), &m); err != nil {
+		return Manifest{}, fmt.Errorf("parse plugin %s: %w", filepath.Base(path), err)
+	}
+	if m.Command != "" && !filepath.IsAbs(m.Command) && strings.ContainsRune(m.Command, filepath.Separator) {
+		m.Command = filepath.Join(filepath.Dir(path), m.Command)
+	}
+	if err := m.validate(); err != nil {
+		return Manifest{}, fmt.Errorf("plugin %s: %w", filepath.Base(path), err)
+	}
+	return m, nil
+}
+
+func (m *Manifest) validate() error {
+	switch {
+	case !idRe.MatchString(m.ID):
+		return fmt.Errorf("id %q must be lower-case letters, digits and dashes", m.ID)
+	case m.Command == "":
+		return errors.New("command is required")
+	}
+	for _, w := range m.Workflows {
+		if !workflows[w] {
+			return fmt.Errorf("unknown workflow %q (want analyze, cost, ops or generate)", w)
+		}
+	}
+	if m.Name == "" {
+		m.Name = m.ID
+	}
+	if m.Version == "" {
+		m.Version = "0.0.0"
+	}
+	m.timeout = DefaultTimeout
+	if m.Timeout != "" {
+		d, err := time.ParseDuration(m.Timeout)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid timeout %q", m.Timeout)
+		}
+		m.timeout = d
+	}
+	return nil
+}
+
+// Request is what a plugin reads from stdin.
+type Request struct {
+	Version   int                   `json:"version"`
+	Plugin    string                `json:"plugin"`
+	Prompt    string                `json:"prompt"`
+	Format    protocol.SourceFormat `json:"format,omitempty"`
+	Code      string                `json:"code,omitempty"`
+	Resources []protocol.Resource   `json:"resources,omitempty"`
+	Metadata  map[string]string     `json:"metadata,omitempty"`
+}
+
+// Response is what a plugin writes to stdout. Markdown is shown as is;
+// without it the findings are rendered as a table.
+type Response struct {
+	Markdown string    `json:"markdown,omitempty"`
+	Findings []Finding `json:"findings,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Finding is a plugin's rule violation. Severity may use any name
+// protocol.ParseSeverity understands.
+type Finding struct {
+	RuleID       string `json:"rule_id"`
+	Severity     string `json:"severity"`
+	Resource     string `json:"resource"`
+	ResourceType string `json:"resource_type"`
+	Message      string `json:"message"`
+	Remediation  string `json:"remediation,omitempty"`
+}
+
+// Runner starts a plugin process, feeds it stdin and returns its stdout.
+// Errors should carry the process's stderr.
+type Runner func(ctx context.Context, command string, args []string, stdin []byte) ([]byte, error)
+
+// execRunner runs plugins on the local host.
+func execRunner(ctx context.Context, command string, args []string, stdin []byte) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			if len(msg) > maxStderr {
+				msg = msg[:maxStderr] + "…"
+			}
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// Agent runs a plugin as a protocol.Agent.
+type Agent struct {
+	m   Manifest
+	run Runner
+}
+
+// New returns the agent for a loaded manifest.
+func New(m Manifest) *Agent {
+	return &Agent{m: m, run: execRunner}
+}
+
+// Manifest returns the plugin's manifest.
+func (a *Agent) Manifest() Manifest { return a.m }
+
+func (a *Agent) ID() string { return a.m.ID }
+
+func (a *Agent) Metadata() protocol.AgentMetadata {
+	return protocol.AgentMetadata{ID: a.m.ID, Name: a.m.Name, Description: a.m.Description, Version: a.m.Version}
+}
+
+func (a *Agent) Capabilities() protocol.AgentCapabilities {
+	return protocol.AgentCapabilities{Formats: a.m.Formats, NeedsIaCInput: len(a.m.Formats) > 0}
+}
+
+// Handle runs the plugin process on the request and relays its output and
+// findings.
+func (a *Agent) Handle(ctx context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
+	if len(a.m.Formats) > 0 {
+		if !protocol.RequireIaC(req, emit, a.m.Name) {
+			return nil
+		}
+		if !a.supports(req.IaC.Format) {
+			emit.SendMessage(fmt.Sprintf("_%s skipped: %s input is not supported._\n\n", a.m.Name, req.IaC.Format))
+			return nil
+		}
+	}
+
+	in := Request{Version: ProtocolVersion, Plugin: a.m.ID, Prompt: protocol.PromptText(req), Metadata: req.Metadata}
+	if req.IaC != nil {
+		in.Format, in.Code, in.Resources = req.IaC.Format, req.IaC.RawCode, req.IaC.Resources
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("plugin %s: encode request: %w", a.m.ID, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, a.m.timeout)
+	defer cancel()
+	out, err := a.run(ctx, a.m.Command, a.m.Args, body)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("plugin %s timed out after %s", a.m.ID, a.m.timeout)
+		}
+		return fmt.Errorf("plugin %s: %w", a.m.ID, err)
+	}
+	if len(out) > maxOutput {
+		return fmt.Errorf("plugin %s: output exceeds %d bytes", a.m.ID, maxOutput)
+	}
+	var resp Response
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return fmt.Errorf("plugin %s: invalid response: %w", a.m.ID, err)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("plugin %s: %s", a.m.ID, resp.Error)
+	}
+
+	findings := make([]protocol.Finding, 0, len(resp.Findings))
+	for _, f := range resp.Findings {
+		findings = append(findings, protocol.Finding{
+			RuleID: f.RuleID, Category: "Plugin", Severity: protocol.NormalizeSeverity(f.Severity),
+			Resource: f.Resource, ResourceType: f.ResourceType, Message: f.Message, Remediation: f.Remediation,
+			Source: a.m.ID,
+		})
+	}
+	protocol.ReportFindings(emit, a.m.ID, findings)
+
+	emit.SendMessage(fmt.Sprintf("### %s\n\n", a.m.Name))
+	switch {
+	case resp.Markdown != "":
+		emit.SendMessage(strings.TrimRight(resp.Markdown, "\n") + "\n\n")
+	case len(findings) == 0:
+		emit.SendMessage("All checks passed.\n\n")
+	default:
+		emit.SendMessage("| Rule | Severity | Resource | Issue | Fix |\n")
+		emit.SendMessage("|------|----------|----------|-------|-----|\n")
+		for _, f := range findings {
+			emit.SendMessage(fmt.Sprintf("| %s | %s | %s.%s | %s | %s |\n",
+				f.RuleID, f.Severity, parser.ShortType(f.ResourceType), f.Resource, f.Message, f.Remediation))
+		}
+		emit.SendMessage("\n")
+	}
+	return nil
+}
+
+func (a *Agent) supports(format protocol.SourceFormat) bool {
+	for _, f := range a.m.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+)
+
+func writeManifest(t *testing.T, dir, name, body string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CMDB_URL", "https://cmdb.example.com")
+	writeManifest(t, dir, "cmdb.json", `{
+  "id": "cmdb", "name": "CMDB Validation", "command": "./bin/cmdb-check",
+  "args": ["--url", "${CMDB_URL}"], "workflows": ["analyze"], "formats": ["terraform"], "timeout": "5s"
+}`)
+	writeManifest(t, dir, "tags.json", `{"id": "tags", "command": "tag-check"}`)
+	writeManifest(t, dir, "README.md", `not a manifest`)
+
+	got, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d manifests, want 2", len(got))
+	}
+	cmdb, tags := got[0], got[1]
+	if cmdb.Command != filepath.Join(dir, "bin", "cmdb-check") {
+		t.Errorf("relative command not resolved: %s", cmdb.Command)
+	}
+	if cmdb.Args[1] != "https://cmdb.example.com" {
+		t.Errorf("env not expanded: %v", cmdb.Args)
+	}
+	if cmdb.timeout != 5*time.Second || tags.timeout != DefaultTimeout {
+		t.Errorf("timeouts = %s, %s", cmdb.timeout, tags.timeout)
+	}
+	// Bare commands are looked up on PATH.
+	if tags.Command != "tag-check" || tags.Name != "tags" || tags.Version != "0.0.0" {
+		t.Errorf("defaults not applied: %+v", tags)
+	}
+
+	if got, err := Load(""); err != nil || got != nil {
+		t.Errorf("Load(\"\") = %v, %v", got, err)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := map[string][]string{
+		"bad id":           {`{"id": "CMDB", "command": "x"}`},
+		"no command":       {`{"id": "cmdb"}`},
+		"unknown workflow": {`{"id": "cmdb", "command": "x", "workflows": ["deploy"]}`},
+		"bad timeout":      {`{"id": "cmdb", "command": "x", "timeout": "soon"}`},
+		"duplicate id":     {`{"id": "cmdb", "command": "x"}`, `{"id": "cmdb", "command": "y"}`},
+		"bad json":         {`{"id": `},
+	}
+	for name, manifests := range tests {
+		dir := t.TempDir()
+		for i, m := range manifests {
+			writeManifest(t, dir, string(rune('a'+i))+".json", m)
+		}
+		if _, err := Load(dir); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func testAgent(m Manifest, run Runner) *Agent {
+	if err := m.validate(); err != nil {
+		panic(err)
+	}
+	return &Agent{m: m, run: run}
+}
+
+func iacRequest(code string) protocol.AgentRequest {
+	req := protocol.AgentRequest{
+		Messages: []protocol.Message{{Role: "user", Content: "analyze:\n```hcl\n" + code + "\n```"}},
+		Metadata: map[string]string{"team": "payments"},
+	}
+	host.ParseAndEnrich(&req)
+	return req
+}
+
+// findingRecorder also records reported findings.
+type findingRecorder struct {
+	prototest.Recorder
+	Findings []protocol.Finding
+}
+
+func (r *findingRecorder) ReportFindings(_ string, findings []protocol.Finding) {
+	r.Findings = append(r.Findings, findings...)
+}
+
+func TestAgent_Handle(t *testing.T) {
+	var got Request
+	a := testAgent(Manifest{ID: "cmdb", Name: "CMDB Validation", Command: "cmdb-check", Formats: []protocol.SourceFormat{protocol.FormatTerraform}},
+		func(_ context.Context, command string, _ []string, stdin []byte) ([]byte, error) {
+			if command != "cmdb-check" {
+				t.Errorf("command = %s", command)
+			}
+			if err := json.Unmarshal(stdin, &got); err != nil {
+				t.Fatal(err)
+			}
+			return []byte(`{"findings": [{"rule_id": "CMDB-001", "severity": "HIGH", "resource": "app",
+				"resource_type": "azurerm_storage_account", "message": "Not registered in CMDB", "remediation": "Register the asset"}]}`), nil
+		})
+
+	rec := &findingRecorder{}
+	req := iacRequest(`resource "azurerm_storage_account" "app" {}`)
+	if err := a.Handle(context.Background(), req, rec); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Version != ProtocolVersion || got.Plugin != "cmdb" || got.Format != protocol.FormatTerraform ||
+		len(got.Resources) != 1 || !strings.Contains(got.Code, "azurerm_storage_account") || got.Metadata["team"] != "payments" {
+		t.Errorf("unexpected request: %+v", got)
+	}
+	out := strings.Join(rec.Messages, "")
+	if !strings.Contains(out, "### CMDB Validation") || !strings.Contains(out, "| CMDB-001 | high | storage_account.app | Not registered in CMDB | Register the asset |") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if len(rec.Findings) != 1 || rec.Findings[0].Source != "cmdb" || rec.Findings[0].Severity != protocol.SeverityHigh {
+		t.Errorf("findings not reported: %+v", rec.Findings)
+	}
+}
+
+func TestAgent_HandleFormats(t *testing.T) {
+	ran := false
+	a := testAgent(Manifest{ID: "cmdb", Command: "x", Formats: []protocol.SourceFormat{protocol.FormatBicep}},
+		func(context.Context, string, []string, []byte) ([]byte, error) {
+			ran = true
+			return []byte(`{}`), nil
+		})
+	rec := &prototest.Recorder{}
+	if err := a.Handle(context.Background(), iacRequest(`resource "azurerm_storage_account" "app" {}`), rec); err != nil {
+		t.Fatal(err)
+	}
+	if ran || !strings.Contains(strings.Join(rec.Messages, ""), "terraform input is not supported") {
+		t.Errorf("plugin ran on unsupported input: %v", rec.Messages)
+	}
+}
+
+func TestAgent_HandleErrors(t *testing.T) {
+	tests := map[string]struct {
+		out  string
+		err  error
+		want string
+	}{
+		"exit":     {err: errors.New("exit status 2: connection refused"), want: "plugin cmdb: exit status 2: connection refused"},
+		"reported": {out: `{"error": "CMDB unavailable"}`, want: "plugin cmdb: CMDB unavailable"},
+		"invalid":  {out: `not json`, want: "plugin cmdb: invalid response"},
+	}
+	for name, tt := range tests {
+		a := testAgent(Manifest{ID: "cmdb", Command: "x"}, func(context.Context, string, []string, []byte) ([]byte, error) {
+			return []byte(tt.out), tt.err
+		})
+		err := a.Handle(context.Background(), protocol.AgentRequest{Prompt: "check"}, &prototest.Recorder{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", name, err, tt.want)
+		}
+	}
+
+	slow := testAgent(Manifest{ID: "cmdb", Command: "x", Timeout: "10ms"}, func(ctx context.Context, _ string, _ []string, _ []byte) ([]byte, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err := slow.Handle(context.Background(), protocol.AgentRequest{}, &prototest.Recorder{}); err == nil || !strings.Contains(err.Error(), "timed out after 10ms") {
+		t.Errorf("timeout: err = %v", err)
+	}
+}
+
+func TestExecRunner(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+	out, err := execRunner(context.Background(), sh, []string{"-c", `cat; echo`}, []byte(`{"markdown":"ok"}`))
+	if err != nil || strings.TrimSpace(string(out)) != `{"markdown":"ok"}` {
+		t.Errorf("execRunner = %q, %v", out, err)
+	}
+	_, err = execRunner(context.Background(), sh, []string{"-c", `echo "CMDB down" >&2; exit 3`}, nil)
+	if err == nil || !strings.Contains(err.Error(), "CMDB down") {
+		t.Errorf("stderr not in error: %v", err)
+	}
+}
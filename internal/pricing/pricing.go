@@ -0,0 +1,294 @@
+// Package pricing is a client for the Azure Retail Prices API. It follows
+// NextPageLink across result pages, retries throttled and failed requests
+// with exponential backoff and jitter, and spaces requests out so that
+// bursts of lookups stay under the API's rate limits.
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultURL is the public Azure Retail Prices API.
+const DefaultURL = "https://prices.azure.com/api/retail/prices"
+
+const (
+	defaultRetries     = 4
+	defaultBaseBackoff = 500 * time.Millisecond
+	defaultMaxBackoff  = 10 * time.Second
+	// defaultRate is requests per second; the API throttles unauthenticated
+	// callers that burst much above it.
+	defaultRate = 5
+	// maxPages bounds a query, in case of a NextPageLink loop.
+	maxPages = 50
+	// maxPageSize caps one page's body.
+	maxPageSize = 4 << 20
+)
+
+// Item is one meter of the price list.
+type Item struct {
+	CurrencyCode    string  `json:"currencyCode"`
+	RetailPrice     float64 `json:"retailPrice"`
+	UnitPrice       float64 `json:"unitPrice"`
+	ARMRegionName   string  `json:"armRegionName"`
+	Location        string  `json:"location"`
+	MeterName       string  `json:"meterName"`
+	ProductName     string  `json:"productName"`
+	SkuName         string  `json:"skuName"`
+	ServiceName     string  `json:"serviceName"`
+	ARMSkuName      string  `json:"armSkuName"`
+	UnitOfMeasure   string  `json:"unitOfMeasure"`
+	Type            string  `json:"type"`
+	ReservationTerm string  `json:"reservationTerm,omitempty"`
+}
+
+type page struct {
+	Items        []Item `json:"Items"`
+	NextPageLink string `json:"NextPageLink"`
+}
+
+// StatusError is a response the API rejected.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("retail prices API error %d: %s", e.StatusCode, e.Body)
+}
+
+// retryable reports whether a request that failed with status may succeed
+// when repeated.
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status == http.StatusRequestTimeout || status >= 500
+}
+
+// Client queries the Retail Prices API. It is safe for concurrent use.
+type Client struct {
+	apiURL      string
+	http        *http.Client
+	retries     int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	interval    time.Duration
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+
+	mu   sync.Mutex
+	next time.Time // earliest start of the next request
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client requests are sent with.
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) {
+		c.http = h
+	}
+}
+
+// WithRetries sets how many times a failed request is repeated; 0
+// disables retries.
+func WithRetries(n int) Option {
+	return func(c *Client) {
+		if n >= 0 {
+			c.retries = n
+		}
+	}
+}
+
+// WithBackoff sets the delay before the first retry and the cap it doubles
+// up to. Each delay is drawn at random up to the current step.
+func WithBackoff(base, max time.Duration) Option {
+	return func(c *Client) {
+		if base > 0 && max >= base {
+			c.baseBackoff, c.maxBackoff = base, max
+		}
+	}
+}
+
+// WithRateLimit sets the most requests per second the client sends; 0
+// removes the limit.
+func WithRateLimit(perSecond float64) Option {
+	return func(c *Client) {
+		c.interval = 0
+		if perSecond > 0 {
+			c.interval = time.Duration(float64(time.Second) / perSecond)
+		}
+	}
+}
+
+// New creates a Client. An empty apiURL uses DefaultURL.
+func New(apiURL string, opts ...Option) *Client {
+	if apiURL == "" {
+		apiURL = DefaultURL
+	}
+	c := &Client{
+		apiURL:      apiURL,
+		http:        &http.Client{Timeout: 10 * time.Second},
+		retries:     defaultRetries,
+		baseBackoff: defaultBaseBackoff,
+		maxBackoff:  defaultMaxBackoff,
+		interval:    time.Second / defaultRate,
+		now:         time.Now,
+		sleep:       sleepContext,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Query returns every item matching an OData filter, in currency (USD when
+// empty), reading all result pages.
+func (c *Client) Query(ctx context.Context, filter, currency string) ([]Item, error) {
+	q := url.Values{"$filter": {filter}}
+	if currency != "" && currency != "USD" {
+		q.Set("currencyCode", "'"+currency+"'")
+	}
+	next := c.apiURL + "?" + q.Encode()
+
+	var items []Item
+	for pages := 0; next != ""; pages++ {
+		if pages == maxPages {
+			return nil, fmt.Errorf("retail prices: more than %d pages", maxPages)
+		}
+		if err := c.sameOrigin(next); err != nil {
+			return nil, err
+		}
+		p, err := c.page(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, p.Items...)
+		next = p.NextPageLink
+	}
+	return items, nil
+}
+
+// sameOrigin keeps NextPageLink on the API's host, so that a response
+// cannot point the client elsewhere.
+func (c *Client) sameOrigin(link string) error {
+	base, err := url.Parse(c.apiURL)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return fmt.Errorf("retail prices: invalid page link: %w", err)
+	}
+	if u.Scheme != base.Scheme || u.Host != base.Host {
+		return fmt.Errorf("retail prices: page link %s leaves %s", u.Host, base.Host)
+	}
+	return nil
+}
+
+// page fetches one page, retrying network errors and retryable statuses.
+func (c *Client) page(ctx context.Context, link string) (page, error) {
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		if err := c.wait(ctx); err != nil {
+			return page{}, err
+		}
+		p, retryAfter, err := c.get(ctx, link)
+		if err == nil {
+			return p, nil
+		}
+		lastErr = err
+		var se *StatusError
+		if ctx.Err() != nil || (errors.As(err, &se) && !retryable(se.StatusCode)) || attempt == c.retries {
+			break
+		}
+		delay := c.backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		if err := c.sleep(ctx, delay); err != nil {
+			return page{}, err
+		}
+	}
+	if ctx.Err() != nil {
+		return page{}, ctx.Err()
+	}
+	return page{}, lastErr
+}
+
+// get sends one request. retryAfter is the delay a throttling response
+// asked for.
+func (c *Client) get(ctx context.Context, link string) (p page, retryAfter time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return page{}, 0, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return page{}, 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return page{}, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			retryAfter = min(time.Duration(secs)*time.Second, c.maxBackoff)
+		}
+		return page{}, retryAfter, &StatusError{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(body))}
+	}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return page{}, 0, fmt.Errorf("decode retail prices: %w", err)
+	}
+	return p, 0, nil
+}
+
+// backoff returns the delay before retry attempt+1: a random duration up
+// to base·2^attempt, capped at the maximum ("full jitter").
+func (c *Client) backoff(attempt int) time.Duration {
+	step := c.baseBackoff << attempt
+	if step <= 0 || step > c.maxBackoff {
+		step = c.maxBackoff
+	}
+	return time.Duration(rand.Int64N(int64(step))) + 1
+}
+
+// wait blocks until the rate limit allows another request.
+func (c *Client) wait(ctx context.Context) error {
+	if c.interval <= 0 {
+		return ctx.Err()
+	}
+	c.mu.Lock()
+	now := c.now()
+	at := c.next
+	if at.Before(now) {
+		at = now
+	}
+	c.next = at.Add(c.interval)
+	c.mu.Unlock()
+	return c.sleep(ctx, at.Sub(now))
+}
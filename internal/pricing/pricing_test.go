@@ -0,0 +1,160 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordSleeps makes c sleep instantly, recording the delays asked for.
+func recordSleeps(c *Client) *[]time.Duration {
+	var mu sync.Mutex
+	var delays []time.Duration
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if d > 0 {
+			delays = append(delays, d)
+		}
+		return ctx.Err()
+	}
+	return &delays
+}
+
+func TestQuery_FollowsPages(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("$skip") {
+		case "":
+			if r.URL.Query().Get("$filter") != "armSkuName eq 'Standard_L8s_v3'" || r.URL.Query().Get("currencyCode") != "'EUR'" {
+				http.Error(w, "bad query", http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `{"Items": [{"retailPrice": 1.1, "armRegionName": "eastus"}], "NextPageLink": "%s?$skip=100"}`, srv.URL)
+		case "100":
+			fmt.Fprint(w, `{"Items": [{"retailPrice": 0.9, "armRegionName": "southindia"}], "NextPageLink": null}`)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithRateLimit(0))
+	items, err := c.Query(context.Background(), "armSkuName eq 'Standard_L8s_v3'", "EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[1].ARMRegionName != "southindia" {
+		t.Errorf("items = %+v, want both pages", items)
+	}
+}
+
+func TestQuery_RejectsForeignPageLink(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"Items": [], "NextPageLink": "https://attacker.example.com/prices"}`)
+	}))
+	defer srv.Close()
+	if _, err := New(srv.URL, WithRateLimit(0)).Query(context.Background(), "x", ""); err == nil {
+		t.Error("expected error for a page link to another host")
+	}
+}
+
+func TestQuery_Retries(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "3")
+			http.Error(w, "throttled", http.StatusTooManyRequests)
+		case 2:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, `{"Items": [{"retailPrice": 0.5}]}`)
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithRateLimit(0), WithBackoff(100*time.Millisecond, 5*time.Second))
+	delays := recordSleeps(c)
+	items, err := c.Query(context.Background(), "x", "")
+	if err != nil || len(items) != 1 || calls != 3 {
+		t.Fatalf("Query = %+v, %v after %d calls", items, err, calls)
+	}
+	if len(*delays) != 2 {
+		t.Fatalf("delays = %v, want 2", *delays)
+	}
+	if (*delays)[0] != 3*time.Second {
+		t.Errorf("first delay = %s, want Retry-After 3s", (*delays)[0])
+	}
+	if d := (*delays)[1]; d <= 0 || d > 200*time.Millisecond {
+		t.Errorf("second delay = %s, want jittered up to 200ms", d)
+	}
+}
+
+func TestQuery_GivesUp(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Query().Get("$filter") == "bad" {
+			http.Error(w, "invalid filter", http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "down", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithRateLimit(0), WithRetries(2))
+	recordSleeps(c)
+	_, err := c.Query(context.Background(), "x", "")
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode != http.StatusBadGateway || calls != 3 {
+		t.Errorf("err = %v after %d calls, want 502 after 3", err, calls)
+	}
+
+	calls = 0
+	if _, err := c.Query(context.Background(), "bad", ""); !errors.As(err, &se) || se.StatusCode != http.StatusBadRequest || calls != 1 {
+		t.Errorf("err = %v after %d calls, want 400 without retries", err, calls)
+	}
+}
+
+func TestQuery_Cancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := New(srv.URL, WithRateLimit(0), WithBackoff(time.Hour, time.Hour))
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := c.Query(ctx, "x", ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestClient_RateLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"Items": []}`)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, WithRateLimit(4))
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	delays := recordSleeps(c)
+	for i := 0; i < 3; i++ {
+		if _, err := c.Query(context.Background(), "x", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Three requests at the same instant start 250ms apart.
+	if len(*delays) != 2 || (*delays)[0] != 250*time.Millisecond || (*delays)[1] != 500*time.Millisecond {
+		t.Errorf("delays = %v, want [250ms 500ms]", *delays)
+	}
+}
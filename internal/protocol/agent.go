@@ -9,3 +9,17 @@ type Agent interface {
 	Capabilities() AgentCapabilities
 	Handle(ctx context.Context, req AgentRequest, emit Emitter) error
 }
+
+// Warmer is implemented by agents that prepare caches before serving, so
+// the first request does not pay for them.
+type Warmer interface {
+	WarmUp(ctx context.Context) error
+}
+
+// Mutator is implemented by agents some of whose requests change state
+// beyond their own output, such as promoting an environment, sending an
+// alert or publishing a repository, so hosts can refuse those requests on
+// a read-only surface.
+type Mutator interface {
+	Mutates(req AgentRequest) bool
+}
@@ -0,0 +1,51 @@
+package protocol
+
+import "time"
+
+// Annotations is governance metadata declared on a resource in
+// "iac-gov:" comments, e.g.
+//
+//	# iac-gov: owner=payments exempt=SEC-004 until=2025-07-01 reason=migration
+type Annotations struct {
+	// Owner is the team responsible for the resource; notifications about
+	// it go to the channel of the same name when one is configured.
+	Owner      string      `json:"owner,omitempty"`
+	Exemptions []Exemption `json:"exemptions,omitempty"`
+	// Severities overrides the severity of findings by rule ID.
+	Severities map[string]Severity `json:"severities,omitempty"`
+	// ManagedBy names the team managing the resource outside this IaC;
+	// drift detection skips it.
+	ManagedBy string `json:"managed_by,omitempty"`
+	// DriftIgnore lists property paths drift detection skips, or "*".
+	DriftIgnore []string `json:"drift_ignore,omitempty"`
+	// Errors describes malformed annotations, which are otherwise ignored.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Exemption waives one rule for a resource, optionally until a date.
+type Exemption struct {
+	RuleID string    `json:"rule_id"`
+	Until  time.Time `json:"until,omitempty"`
+	Reason string    `json:"reason"`
+	// Source is where a waiver was declared other than a comment: "tag"
+	// or the waivers file.
+	Source string `json:"source,omitempty"`
+}
+
+// Active reports whether the exemption still applies at now. An exemption
+// lasts through its Until date.
+func (e Exemption) Active(now time.Time) bool {
+	return e.Until.IsZero() || now.Before(e.Until.AddDate(0, 0, 1))
+}
+
+// SeverityFor returns the overridden severity for ruleID, or def when the
+// resource has none.
+func (a *Annotations) SeverityFor(ruleID string, def Severity) Severity {
+	if a == nil {
+		return def
+	}
+	if sev, ok := a.Severities[ruleID]; ok {
+		return sev
+	}
+	return def
+}
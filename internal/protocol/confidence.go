@@ -0,0 +1,88 @@
+package protocol
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Confidence says how much a finding or estimate can be trusted given that
+// parsing is heuristic: high when it rests on literal values, medium when
+// values were resolved from variables or parameters, low when they were
+// assumed defaults or unresolved expressions.
+type Confidence string
+
+// Confidence levels from most to least certain.
+const (
+	ConfidenceHigh   Confidence = "high"
+	ConfidenceMedium Confidence = "medium"
+	ConfidenceLow    Confidence = "low"
+)
+
+var confidenceRanks = map[Confidence]int{
+	ConfidenceHigh:   3,
+	ConfidenceMedium: 2,
+	ConfidenceLow:    1,
+}
+
+// Rank orders confidence levels; an unset level counts as high.
+func (c Confidence) Rank() int {
+	if r, ok := confidenceRanks[c]; ok {
+		return r
+	}
+	return confidenceRanks[ConfidenceHigh]
+}
+
+// Note is a short markdown suffix for report tables, empty for high
+// confidence.
+func (c Confidence) Note() string {
+	if c.Rank() >= confidenceRanks[ConfidenceHigh] {
+		return ""
+	}
+	return " _(" + string(c) + " confidence)_"
+}
+
+// LeastConfident returns the lowest of levels, high when none are given.
+func LeastConfident(levels ...Confidence) Confidence {
+	least := ConfidenceHigh
+	for _, c := range levels {
+		if c.Rank() < least.Rank() {
+			least = c
+		}
+	}
+	return least
+}
+
+var unresolvedExprRe = regexp.MustCompile(`^(var|local|module|data)\.|\$\{|\w\(`)
+
+// ValueConfidence rates the value at a dotted property path of res: low if
+// it is missing (so a default is assumed) or still an unresolved expression,
+// medium if ApplyParams resolved it from a variable, high if it is literal.
+func ValueConfidence(res Resource, path string) Confidence {
+	val, ok := lookupProperty(res.Properties, path)
+	if !ok {
+		return ConfidenceLow
+	}
+	if s, isStr := val.(string); isStr && unresolvedExprRe.MatchString(s) {
+		return ConfidenceLow
+	}
+	for _, r := range res.Resolved {
+		if r == path || strings.HasPrefix(path, r+".") || strings.HasPrefix(r, path+".") {
+			return ConfidenceMedium
+		}
+	}
+	return ConfidenceHigh
+}
+
+func lookupProperty(props map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = props
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
@@ -9,3 +9,163 @@ type Emitter interface {
 	SendError(msg string)
 	SendDone()
 }
+
+// FindingReporter is an optional Emitter extension for transports and wrappers
+// that consume structured findings alongside the streamed chat text.
+type FindingReporter interface {
+	ReportFindings(agentID string, findings []Finding)
+}
+
+// ReportFindings forwards findings to emit when it implements FindingReporter.
+func ReportFindings(emit Emitter, agentID string, findings []Finding) {
+	if r, ok := emit.(FindingReporter); ok {
+		r.ReportFindings(agentID, findings)
+	}
+}
+
+// CostItem is one line item of a cost estimate, tagged with the
+// environment and version it was estimated for when the request named them.
+type CostItem struct {
+	Name       string     `json:"name"`
+	SKU        string     `json:"sku"`
+	Monthly    float64    `json:"monthly"`
+	Currency   string     `json:"currency,omitempty"`
+	Confidence Confidence `json:"confidence"`
+	// Source is where the price came from: table, cache, api or heuristic.
+	Source      string `json:"source,omitempty"`
+	Environment string `json:"environment,omitempty"`
+	Version     string `json:"version,omitempty"`
+}
+
+// CostReporter is an optional Emitter extension for wrappers that keep
+// structured cost line items, such as the report store.
+type CostReporter interface {
+	ReportCosts(agentID string, items []CostItem)
+}
+
+// ReportCosts forwards cost line items to emit when it implements
+// CostReporter.
+func ReportCosts(emit Emitter, agentID string, items []CostItem) {
+	if r, ok := emit.(CostReporter); ok {
+		r.ReportCosts(agentID, items)
+	}
+}
+
+// CostBaselineReporter is an optional Emitter extension for callers that
+// compare an estimate with what the resources cost before a change, such
+// as the orchestrator's cost delta.
+type CostBaselineReporter interface {
+	// ReportCostBaseline receives the monthly cost of the resources before
+	// a plan applies.
+	ReportCostBaseline(agentID string, monthly float64, currency string)
+}
+
+// ReportCostBaseline forwards a baseline estimate to emit when it
+// implements CostBaselineReporter.
+func ReportCostBaseline(emit Emitter, agentID string, monthly float64, currency string) {
+	if r, ok := emit.(CostBaselineReporter); ok {
+		r.ReportCostBaseline(agentID, monthly, currency)
+	}
+}
+
+// ScoreReporter is an optional Emitter extension for callers that act on
+// the scores an agent computes, such as the compliance score gating a
+// promotion.
+type ScoreReporter interface {
+	// ReportScores receives percentages keyed by what they score, e.g. a
+	// framework ID.
+	ReportScores(agentID string, scores map[string]int)
+}
+
+// ReportScores forwards scores to emit when it implements ScoreReporter.
+func ReportScores(emit Emitter, agentID string, scores map[string]int) {
+	if r, ok := emit.(ScoreReporter); ok {
+		r.ReportScores(agentID, scores)
+	}
+}
+
+// Progress is a structured progress update for long-running work.
+type Progress struct {
+	Stage   string  `json:"stage"`
+	Current int     `json:"current"`
+	Total   int     `json:"total"`
+	Percent float64 `json:"percent"`
+}
+
+// ProgressReporter is an optional Emitter extension for clients that render
+// progress (e.g. a progress bar) separately from the chat text.
+type ProgressReporter interface {
+	ReportProgress(p Progress)
+}
+
+// ReportProgress sends a progress update to emit when it implements
+// ProgressReporter. Percent is derived from current/total.
+func ReportProgress(emit Emitter, stage string, current, total int) {
+	r, ok := emit.(ProgressReporter)
+	if !ok {
+		return
+	}
+	p := Progress{Stage: stage, Current: current, Total: total}
+	if total > 0 {
+		p.Percent = float64(current) * 100 / float64(total)
+	}
+	r.ReportProgress(p)
+}
+
+// Run summary decisions.
+const (
+	DecisionGo   = "go"
+	DecisionNoGo = "no-go"
+)
+
+// RunSummary is the aggregated result of a multi-agent workflow, built from
+// what its agents reported rather than from their chat text.
+type RunSummary struct {
+	// Decision is DecisionGo when the change may proceed without approval.
+	Decision string `json:"decision"`
+	// Reasons explain a no-go decision.
+	Reasons []string `json:"reasons,omitempty"`
+	// Action is the verdict action of the findings, e.g. "block"; empty
+	// when no agent reported findings.
+	Action string           `json:"action,omitempty"`
+	Counts map[Severity]int `json:"counts"`
+	Total  int              `json:"total"`
+	// Compliance is the overall compliance score, a percentage, when
+	// applicable controls were scored.
+	Compliance *int         `json:"compliance_score,omitempty"`
+	Cost       *CostSummary `json:"cost,omitempty"`
+	Agents     []AgentRun   `json:"agents"`
+}
+
+// CostSummary is the monthly estimate of a run. Current and Delta are set
+// when the cost before the change is known, as for Terraform plans, in the
+// same currency. Estimates in more than one currency are not summed:
+// ByCurrency holds the total of each, and Monthly and Currency are empty.
+type CostSummary struct {
+	Monthly    float64            `json:"monthly"`
+	Currency   string             `json:"currency"`
+	ByCurrency map[string]float64 `json:"by_currency,omitempty"`
+	Current    *float64           `json:"current,omitempty"`
+	Delta      *float64           `json:"delta,omitempty"`
+}
+
+// AgentRun is what one agent of a workflow reported.
+type AgentRun struct {
+	ID       string `json:"id"`
+	Findings int    `json:"findings"`
+	// Failed is set when the agent failed or is not registered.
+	Failed bool `json:"failed,omitempty"`
+}
+
+// SummaryReporter is an optional Emitter extension for clients that gate on
+// a workflow's aggregated result without parsing its markdown.
+type SummaryReporter interface {
+	ReportSummary(s RunSummary)
+}
+
+// ReportSummary forwards s to emit when it implements SummaryReporter.
+func ReportSummary(emit Emitter, s RunSummary) {
+	if r, ok := emit.(SummaryReporter); ok {
+		r.ReportSummary(s)
+	}
+}
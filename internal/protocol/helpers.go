@@ -43,9 +43,14 @@ func RequireIaC(req AgentRequest, emit Emitter, domain string) bool {
 type Finding struct {
 	RuleID       string
 	Category     string
-	Severity     string
+	Severity     Severity
 	Resource     string
 	ResourceType string
 	Message      string
 	Remediation  string
+	// Source names the external scanner that produced the finding
+	// (e.g. "tfsec"); empty for native rules.
+	Source string
+	// Confidence rates the values the finding rests on; empty means high.
+	Confidence Confidence
 }
@@ -6,10 +6,14 @@ import "github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 // Recorder is a test double for protocol.Emitter that records all messages.
 type Recorder struct {
 	Messages []string
+	// References holds each copilot_references event.
+	References [][]protocol.Reference
 }
 
-func (r *Recorder) SendMessage(content string)               { r.Messages = append(r.Messages, content) }
-func (r *Recorder) SendReferences(_ []protocol.Reference)    {}
+func (r *Recorder) SendMessage(content string) { r.Messages = append(r.Messages, content) }
+func (r *Recorder) SendReferences(refs []protocol.Reference) {
+	r.References = append(r.References, refs)
+}
 func (r *Recorder) SendConfirmation(_ protocol.Confirmation) {}
 func (r *Recorder) SendError(msg string)                     { r.Messages = append(r.Messages, msg) }
 func (r *Recorder) SendDone()                                {}
@@ -0,0 +1,84 @@
+package protocol
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Citations numbers references for inline citation, keeping one entry per
+// URL. The zero value is ready to use.
+type Citations struct {
+	refs  []Reference
+	index map[string]int
+}
+
+// Cite returns the citation number of ref, starting at 1, adding it when
+// its URL is new. A reference without a URL is not cited and returns 0.
+func (c *Citations) Cite(ref Reference) int {
+	key := referenceKey(ref.URL)
+	if key == "" {
+		return 0
+	}
+	if n, ok := c.index[key]; ok {
+		if c.refs[n-1].Title == "" {
+			c.refs[n-1].Title = ref.Title
+		}
+		return n
+	}
+	if c.index == nil {
+		c.index = make(map[string]int)
+	}
+	c.refs = append(c.refs, ref)
+	c.index[key] = len(c.refs)
+	return len(c.refs)
+}
+
+// Add cites each reference in order.
+func (c *Citations) Add(refs ...Reference) {
+	for _, r := range refs {
+		c.Cite(r)
+	}
+}
+
+// References returns the cited references in citation order.
+func (c *Citations) References() []Reference {
+	return append([]Reference(nil), c.refs...)
+}
+
+// Len returns the number of cited references.
+func (c *Citations) Len() int { return len(c.refs) }
+
+// Markdown renders the references as a numbered list matching their
+// citation numbers.
+func (c *Citations) Markdown() string {
+	var sb strings.Builder
+	for i, r := range c.refs {
+		title := r.Title
+		if title == "" {
+			title = r.URL
+		}
+		fmt.Fprintf(&sb, "%d. [%s](%s)\n", i+1, title, r.URL)
+	}
+	return sb.String()
+}
+
+// Marker returns the inline marker for citation n, e.g. " [2]", or "" for 0.
+func Marker(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" [%d]", n)
+}
+
+// referenceKey normalizes a URL for deduplication: scheme and host are
+// case-insensitive, and a trailing slash, the query and a fragment do not
+// name a different page.
+func referenceKey(raw string) string {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host) + strings.TrimSuffix(u.EscapedPath(), "/")
+}
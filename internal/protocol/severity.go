@@ -0,0 +1,142 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity is the shared severity scale used by every agent.
+type Severity string
+
+// Severities from most to least severe.
+const (
+	SeverityCritical Severity = "critical"
+	SeverityHigh     Severity = "high"
+	SeverityMedium   Severity = "medium"
+	SeverityLow      Severity = "low"
+	SeverityInfo     Severity = "info"
+)
+
+// Severities lists every severity from most to least severe.
+var Severities = []Severity{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityInfo}
+
+var severityRanks = map[Severity]int{
+	SeverityCritical: 5,
+	SeverityHigh:     4,
+	SeverityMedium:   3,
+	SeverityLow:      2,
+	SeverityInfo:     1,
+}
+
+// severityAliases normalizes levels used by external tools and older
+// agents (SARIF "error"/"warning"/"note", Checkov "moderate", etc.).
+var severityAliases = map[string]Severity{
+	"blocker":       SeverityCritical,
+	"error":         SeverityHigh,
+	"major":         SeverityHigh,
+	"warning":       SeverityMedium,
+	"warn":          SeverityMedium,
+	"moderate":      SeverityMedium,
+	"minor":         SeverityLow,
+	"note":          SeverityLow,
+	"informational": SeverityInfo,
+	"none":          SeverityInfo,
+	"unknown":       SeverityInfo,
+}
+
+// ParseSeverity converts a level name from any source to the shared scale.
+// The second result is false for unrecognized names.
+func ParseSeverity(s string) (Severity, bool) {
+	key := strings.ToLower(strings.TrimSpace(s))
+	if _, ok := severityRanks[Severity(key)]; ok {
+		return Severity(key), true
+	}
+	sev, ok := severityAliases[key]
+	return sev, ok
+}
+
+// NormalizeSeverity is ParseSeverity with unrecognized names mapped to info.
+func NormalizeSeverity(s string) Severity {
+	if sev, ok := ParseSeverity(s); ok {
+		return sev
+	}
+	return SeverityInfo
+}
+
+// Rank returns the numeric rank (critical 5 … info 1, unknown 0).
+func (s Severity) Rank() int { return severityRanks[s] }
+
+// AtLeast reports whether s is as severe as other or more.
+func (s Severity) AtLeast(other Severity) bool { return s.Rank() >= other.Rank() }
+
+// Label returns the capitalized name, e.g. "High".
+func (s Severity) Label() string {
+	if s == "" {
+		return ""
+	}
+	return strings.ToUpper(string(s[:1])) + string(s[1:])
+}
+
+// SeverityMapping maps shared severities onto an external system's levels.
+type SeverityMapping map[Severity]string
+
+// DefaultSARIFLevels maps severities onto SARIF result levels.
+func DefaultSARIFLevels() SeverityMapping {
+	return SeverityMapping{
+		SeverityCritical: "error",
+		SeverityHigh:     "error",
+		SeverityMedium:   "warning",
+		SeverityLow:      "note",
+		SeverityInfo:     "note",
+	}
+}
+
+// DefaultPagerDutySeverities maps severities onto PagerDuty event severities.
+func DefaultPagerDutySeverities() SeverityMapping {
+	return SeverityMapping{
+		SeverityCritical: "critical",
+		SeverityHigh:     "error",
+		SeverityMedium:   "warning",
+		SeverityLow:      "info",
+		SeverityInfo:     "info",
+	}
+}
+
+// Map returns the external level for s.
+func (m SeverityMapping) Map(s Severity) string { return m[s] }
+
+// Override applies "severity=level,..." entries to a copy of m. Levels must
+// be one of allowed, the target system's vocabulary.
+func (m SeverityMapping) Override(spec string, allowed ...string) (SeverityMapping, error) {
+	out := make(SeverityMapping, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, level, ok := strings.Cut(entry, "=")
+		sev, known := ParseSeverity(name)
+		if !ok || !known {
+			return nil, fmt.Errorf("invalid severity mapping %q (want severity=level)", entry)
+		}
+		level = strings.ToLower(strings.TrimSpace(level))
+		valid := false
+		for _, a := range allowed {
+			valid = valid || a == level
+		}
+		if !valid {
+			return nil, fmt.Errorf("%s: level %q must be one of %s", name, level, strings.Join(allowed, ", "))
+		}
+		out[sev] = level
+	}
+	return out, nil
+}
+
+// SARIF and PagerDuty level vocabularies accepted by Override.
+var (
+	SARIFLevels         = []string{"error", "warning", "note", "none"}
+	PagerDutySeverities = []string{"critical", "error", "warning", "info"}
+)
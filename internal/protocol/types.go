@@ -9,6 +9,14 @@ const (
 	FormatTerraform SourceFormat = "terraform"
 	FormatBicep     SourceFormat = "bicep"
 	FormatUnknown   SourceFormat = "unknown"
+	// FormatARM is an ARM deployment template (JSON), e.g. compiled Bicep.
+	FormatARM SourceFormat = "arm"
+	// FormatTerraformPlan is the JSON of `terraform show -json plan.out`.
+	FormatTerraformPlan SourceFormat = "terraform-plan"
+	// FormatPulumi is a Pulumi YAML program (Pulumi.yaml).
+	FormatPulumi SourceFormat = "pulumi"
+	// FormatCloudFormation is an AWS CloudFormation template (JSON or YAML).
+	FormatCloudFormation SourceFormat = "cloudformation"
 )
 
 // Resource represents a parsed IaC resource.
@@ -18,6 +26,46 @@ type Resource struct {
 	Properties map[string]interface{} `json:"properties"`
 	Line       int                    `json:"line"`
 	RawBlock   string                 `json:"raw_block"`
+	// Resolved lists the property paths whose values ApplyParams took from
+	// variables or parameters rather than the resource block.
+	Resolved []string `json:"resolved,omitempty"`
+	// Annotations holds metadata from "iac-gov:" comments, if any.
+	Annotations *Annotations `json:"annotations,omitempty"`
+	// Change is set for resources read from a Terraform plan.
+	Change *Change `json:"change,omitempty"`
+}
+
+// Planned change actions.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionReplace = "replace"
+	ActionDelete  = "delete"
+	ActionNoOp    = "no-op"
+)
+
+// Change is what a Terraform plan does to a resource. The resource's
+// Properties hold the planned values (the prior ones for a delete), without
+// those only known after apply.
+type Change struct {
+	Action string `json:"action"`
+	// Before holds the values in state before the change.
+	Before map[string]interface{} `json:"before,omitempty"`
+	// PreviousAddress is the "type.name" the resource moved from, if any.
+	PreviousAddress string `json:"previous_address,omitempty"`
+	// Importing is set when the plan adopts existing infrastructure.
+	Importing bool `json:"importing,omitempty"`
+	// CreateBeforeDestroy is set on a replace that creates the new object
+	// before destroying the old one, so the resource is never absent.
+	CreateBeforeDestroy bool `json:"create_before_destroy,omitempty"`
+	// ReplacePaths are the attributes whose change forces a replace, e.g.
+	// "location" or "network_rules[0].subnet_id".
+	ReplacePaths []string `json:"replace_paths,omitempty"`
+}
+
+// Deleted reports whether a plan destroys the resource without replacing it.
+func (r Resource) Deleted() bool {
+	return r.Change != nil && r.Change.Action == ActionDelete
 }
 
 // SourceFile represents a single file in multi-file IaC input.
@@ -39,6 +87,23 @@ type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
 	Name    string `json:"name,omitempty"`
+	// References are what the client attached to the message, such as
+	// files open in the editor.
+	References []MessageReference `json:"copilot_references,omitempty"`
+}
+
+// MessageReference is a Copilot reference attached to a message. For a
+// file (type "client.file") ID is its path and Data its content.
+type MessageReference struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Data struct {
+		Content  string `json:"content,omitempty"`
+		Language string `json:"language,omitempty"`
+	} `json:"data"`
+	Metadata struct {
+		DisplayName string `json:"display_name,omitempty"`
+	} `json:"metadata"`
 }
 
 // Reference is a link sent to the user.
@@ -63,6 +128,65 @@ type AgentRequest struct {
 	Token      string            `json:"-"` // GitHub token for LLM calls; never serialized
 }
 
+// MetaSessionID is the AgentRequest.Metadata key holding the conversation
+// identifier used to carry context between turns.
+const MetaSessionID = "session_id"
+
+// MetaCategories and MetaSkipCategories are AgentRequest.Metadata keys
+// holding comma-separated check categories to restrict a scan to or to
+// leave out (e.g. "secrets", "logging").
+const (
+	MetaCategories     = "categories"
+	MetaSkipCategories = "skip_categories"
+)
+
+// MetaJobID is the AgentRequest.Metadata key holding the ID of the job
+// running the request; analyses are stored under it.
+const MetaJobID = "job_id"
+
+// MetaBaseline is the AgentRequest.Metadata key holding the job ID of an
+// earlier analysis to diff against (e.g. the base branch of a PR).
+const MetaBaseline = "baseline"
+
+// MetaProbe is the AgentRequest.Metadata key marking a synthetic health
+// probe or a promotion gate's run, so usage analytics and trends can leave
+// it out.
+const MetaProbe = "probe"
+
+// MetaEnvironment and MetaVersion are AgentRequest.Metadata keys naming the
+// environment and release a request is run for (e.g. "prod", "v1.3.0"), so
+// cost estimates can be tracked per deployment stage.
+const (
+	MetaEnvironment = "environment"
+	MetaVersion     = "version"
+)
+
+// MetaRepository is the AgentRequest.Metadata key naming the repository
+// the code comes from (e.g. "org/app"), so stored scans can be grouped by
+// repository.
+const MetaRepository = "repository"
+
+// MetaCommit is the AgentRequest.Metadata key holding the commit SHA the
+// code was taken from, so audit scores can be traced to it.
+const MetaCommit = "commit"
+
+// MetaCurrency is the AgentRequest.Metadata key holding the ISO 4217 code
+// cost estimates are reported in (e.g. "EUR").
+const MetaCurrency = "currency"
+
+// MetaLocale is the AgentRequest.Metadata key holding the locale amounts
+// are written in (e.g. "de-DE").
+const MetaLocale = "locale"
+
+// MetaFrameworks is the AgentRequest.Metadata key holding the
+// comma-separated compliance frameworks to audit against (e.g.
+// "pci-dss,hipaa").
+const MetaFrameworks = "frameworks"
+
+// MetaBudget is the AgentRequest.Metadata key holding the monthly budget a
+// cost estimate is checked against, in the estimate's currency.
+const MetaBudget = "budget"
+
 // AgentMetadata describes an agent for discovery/listing.
 type AgentMetadata struct {
 	ID          string `json:"id"`
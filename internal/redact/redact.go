@@ -0,0 +1,239 @@
+// Package redact masks secret values found by the security scanner before
+// they reach a sink: the process log, the report store or the response
+// streamed back to the client.
+package redact
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+const (
+	// Mask replaces every redacted value.
+	Mask = "[REDACTED]"
+	// maxValues caps how many secrets a Redactor remembers; the oldest are
+	// forgotten first.
+	maxValues = 1024
+	// minLength is the shortest value redacted, so that short literals
+	// such as "true" do not mask unrelated text.
+	minLength = 6
+)
+
+// Redactor masks known secret values, and any hardcoded credential the
+// security scanner detects in the text itself.
+type Redactor struct {
+	mu     sync.RWMutex
+	order  []string // insertion order, for eviction
+	known  map[string]bool
+	sorted []string // longest first, so no value is masked only in part
+}
+
+// New creates a Redactor that masks values.
+func New(values ...string) *Redactor {
+	r := &Redactor{known: make(map[string]bool)}
+	r.Add(values...)
+	return r
+}
+
+// Add remembers secret values to mask.
+func (r *Redactor) Add(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	changed := false
+	for _, v := range values {
+		if len(v) < minLength || r.known[v] {
+			continue
+		}
+		r.known[v] = true
+		r.order = append(r.order, v)
+		changed = true
+	}
+	if !changed {
+		return
+	}
+	for len(r.order) > maxValues {
+		delete(r.known, r.order[0])
+		r.order = r.order[1:]
+	}
+	// String reads sorted without the lock held, so it is replaced rather
+	// than modified.
+	sorted := append([]string(nil), r.order...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	r.sorted = sorted
+}
+
+// AddFromCode remembers the hardcoded credentials the security scanner
+// detects in code.
+func (r *Redactor) AddFromCode(code string) {
+	if code != "" {
+		r.Add(analyzer.SecretValues(code)...)
+	}
+}
+
+// String masks secrets in s.
+func (r *Redactor) String(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+	r.mu.RLock()
+	values := r.sorted
+	r.mu.RUnlock()
+	for _, v := range values {
+		if strings.Contains(s, v) {
+			s = strings.ReplaceAll(s, v, Mask)
+		}
+	}
+	for _, v := range analyzer.SecretValues(s) {
+		if len(v) >= minLength && v != Mask {
+			s = strings.ReplaceAll(s, v, Mask)
+		}
+	}
+	return s
+}
+
+// Finding masks secrets in the text of a finding.
+func (r *Redactor) Finding(f protocol.Finding) protocol.Finding {
+	f.Message = r.String(f.Message)
+	f.Remediation = r.String(f.Remediation)
+	return f
+}
+
+// Writer returns a writer that masks secrets before writing to w. It is
+// meant for log.SetOutput, which writes one whole line per call.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	return &writer{r: r, w: w}
+}
+
+type writer struct {
+	r *Redactor
+	w io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.r.String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Observe is a host.Observer that masks the secrets of each request in
+// everything the agent emits. It must be registered after every observer
+// that stores or forwards output, so that it wraps them. The secrets are
+// also remembered by r, so that they stay masked in logs written through
+// r.Writer.
+//
+// Values are matched within one message, so a secret split across two
+// streamed chunks is not caught.
+func (r *Redactor) Observe(_ string, req protocol.AgentRequest, emit protocol.Emitter) (protocol.Emitter, func(error)) {
+	secrets := requestSecrets(req)
+	secrets.mu.RLock()
+	r.Add(secrets.order...)
+	secrets.mu.RUnlock()
+	return &emitter{Emitter: emit, r: secrets}, nil
+}
+
+// Resources returns a copy of the request's parsed resources with the
+// request's secrets masked in their properties and without their source
+// text, for sinks that keep resources.
+func Resources(req protocol.AgentRequest) []protocol.Resource {
+	if req.IaC == nil || len(req.IaC.Resources) == 0 {
+		return nil
+	}
+	secrets := requestSecrets(req)
+	out := make([]protocol.Resource, len(req.IaC.Resources))
+	for i, res := range req.IaC.Resources {
+		res.RawBlock = ""
+		if res.Properties != nil {
+			res.Properties = secrets.value(res.Properties).(map[string]interface{})
+		}
+		out[i] = res
+	}
+	return out
+}
+
+// value returns a copy of a decoded property value with secrets masked in
+// every string.
+func (r *Redactor) value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return r.String(v)
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = r.value(e)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, e := range v {
+			s[i] = r.value(e)
+		}
+		return s
+	}
+	return v
+}
+
+// requestSecrets collects the hardcoded credentials in a request's code.
+func requestSecrets(req protocol.AgentRequest) *Redactor {
+	secrets := New()
+	if req.IaC != nil {
+		secrets.AddFromCode(req.IaC.RawCode)
+		for _, f := range req.IaC.Files {
+			secrets.AddFromCode(f.Content)
+		}
+	}
+	for _, m := range req.Messages {
+		secrets.AddFromCode(m.Content)
+		for _, ref := range m.References {
+			secrets.AddFromCode(ref.Data.Content)
+		}
+	}
+	secrets.AddFromCode(req.Prompt)
+	return secrets
+}
+
+// emitter masks secrets in chat text, errors and findings before passing
+// them on.
+type emitter struct {
+	protocol.Emitter
+	r *Redactor
+}
+
+func (e *emitter) SendMessage(content string) {
+	e.Emitter.SendMessage(e.r.String(content))
+}
+
+func (e *emitter) SendError(msg string) {
+	e.Emitter.SendError(e.r.String(msg))
+}
+
+func (e *emitter) ReportFindings(agentID string, findings []protocol.Finding) {
+	masked := make([]protocol.Finding, len(findings))
+	for i, f := range findings {
+		masked[i] = e.r.Finding(f)
+	}
+	protocol.ReportFindings(e.Emitter, agentID, masked)
+}
+
+func (e *emitter) ReportCosts(agentID string, items []protocol.CostItem) {
+	protocol.ReportCosts(e.Emitter, agentID, items)
+}
+
+func (e *emitter) ReportScores(agentID string, scores map[string]int) {
+	protocol.ReportScores(e.Emitter, agentID, scores)
+}
+
+func (e *emitter) ReportSummary(sum protocol.RunSummary) {
+	protocol.ReportSummary(e.Emitter, sum)
+}
+
+func (e *emitter) ReportProgress(p protocol.Progress) {
+	if r, ok := e.Emitter.(protocol.ProgressReporter); ok {
+		r.ReportProgress(p)
+	}
+}
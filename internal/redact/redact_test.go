@@ -0,0 +1,129 @@
+package redact_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/agents/security"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/redact"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/report"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/server"
+)
+
+const (
+	password = "SuperSecretPassword123!"
+	apiKey   = "sk-live-0123456789abcdef"
+)
+
+var code = "```hcl\n" + `resource "azurerm_mssql_server" "db" {
+  name                         = "sql-prod"
+  administrator_login_password = "` + password + `"
+}
+
+resource "azurerm_linux_function_app" "fn" {
+  name = "fn-prod"
+  app_settings = {
+    api_key = "` + apiKey + `"
+  }
+}` + "\n```"
+
+// echoAgent repeats the secrets it was given in every way an agent can.
+type echoAgent struct{}
+
+func (echoAgent) ID() string                               { return "echo" }
+func (echoAgent) Metadata() protocol.AgentMetadata         { return protocol.AgentMetadata{ID: "echo"} }
+func (echoAgent) Capabilities() protocol.AgentCapabilities { return protocol.AgentCapabilities{} }
+func (echoAgent) Handle(_ context.Context, req protocol.AgentRequest, emit protocol.Emitter) error {
+	emit.SendMessage("Found password " + password + " in:\n" + req.IaC.RawCode)
+	emit.SendError("cannot connect with " + apiKey)
+	protocol.ReportFindings(emit, "echo", []protocol.Finding{{
+		RuleID: "SEC-001", Resource: "db", ResourceType: "azurerm_mssql_server",
+		Message: "password is " + password, Remediation: "rotate " + apiKey,
+	}})
+	log.Printf("echo: handled request with key %s", apiKey)
+	return nil
+}
+
+func assertClean(t *testing.T, sink, out string) {
+	t.Helper()
+	for _, secret := range []string{password, apiKey} {
+		if strings.Contains(out, secret) {
+			t.Errorf("%s contains secret %q:\n%s", sink, secret, out)
+		}
+	}
+}
+
+func TestSinksNeverSeeSecrets(t *testing.T) {
+	secrets := redact.New()
+	var logs bytes.Buffer
+	log.SetOutput(secrets.Writer(&logs))
+	defer log.SetOutput(os.Stderr)
+
+	reports := report.NewStore(10)
+	reg := host.NewRegistry()
+	reg.Register(echoAgent{})
+	reg.Register(security.New())
+	d := host.NewDispatcher(reg)
+	d.Observe(reports.Observe)
+	d.Observe(secrets.Observe)
+
+	for _, id := range []string{"echo", "security"} {
+		req := protocol.AgentRequest{
+			Messages: []protocol.Message{{Role: "user", Content: code}},
+			Metadata: map[string]string{protocol.MetaJobID: "job-" + id},
+		}
+		host.ParseAndEnrich(&req)
+
+		rec := httptest.NewRecorder()
+		sse := server.NewSSEWriter(rec)
+		sse.EnableProgress()
+		if err := d.Dispatch(context.Background(), id, req, sse); err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+		sse.SendDone()
+		assertClean(t, id+" SSE stream", rec.Body.String())
+
+		stored, ok := reports.Get("job-" + id)
+		if !ok {
+			t.Fatalf("%s: report not stored", id)
+		}
+		data, _ := json.Marshal(stored)
+		assertClean(t, id+" stored report", string(data))
+		if id == "echo" && !strings.Contains(stored.Markdown, redact.Mask) {
+			t.Errorf("echo report not masked: %s", stored.Markdown)
+		}
+	}
+
+	log.Printf("request body was %s", code)
+	assertClean(t, "log", logs.String())
+	if !strings.Contains(logs.String(), redact.Mask) {
+		t.Errorf("log not masked: %s", logs.String())
+	}
+}
+
+func TestRedactor_String(t *testing.T) {
+	r := redact.New("hunter2-long", "hunter2")
+	if got := r.String("pw hunter2-long or hunter2"); got != "pw [REDACTED] or [REDACTED]" {
+		t.Errorf("known values: %q", got)
+	}
+	// Credentials assigned in the text are masked without being known.
+	if got := redact.New().String(`password = "not-yet-known-1"`); got != `password = "[REDACTED]"` {
+		t.Errorf("detected value: %q", got)
+	}
+	// Short values would mask unrelated text.
+	if got := redact.New("true").String("enabled = true"); got != "enabled = true" {
+		t.Errorf("short value masked: %q", got)
+	}
+	var nilRedactor *redact.Redactor
+	if got := nilRedactor.String(password); got != password {
+		t.Errorf("nil redactor: %q", got)
+	}
+}
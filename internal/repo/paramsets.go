@@ -0,0 +1,178 @@
+package repo
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/parser"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// ParamSet is one template (a Terraform module directory or a Bicep file)
+// evaluated with one set of parameter values, e.g. infra/terraform with
+// envs/prod.tfvars.
+type ParamSet struct {
+	// Name is the parameter file path, or "defaults" when none applies.
+	Name      string
+	Template  string
+	Format    protocol.SourceFormat
+	Templates []protocol.SourceFile
+	Values    map[string]interface{}
+	// Modules are the repository's .tf files, for expanding local modules
+	// the templates call.
+	Modules []protocol.SourceFile
+}
+
+// Input parses the templates, resolves variable references with the set's
+// values, and expands the local modules they call.
+func (p ParamSet) Input() *protocol.IaCInput {
+	var parts []string
+	for _, f := range p.Templates {
+		parts = append(parts, f.Content)
+	}
+	code := strings.Join(parts, "\n\n")
+
+	iacType := parser.Terraform
+	if p.Format == protocol.FormatBicep {
+		iacType = parser.Bicep
+	}
+	resources := parser.ApplyParams(parser.ParseResourcesOfType(code, iacType), p.Values, p.Format)
+	if p.Format == protocol.FormatTerraform {
+		resources = append(resources, parser.ExpandModules(code, p.Template, p.Modules, p.Values)...)
+	}
+	return &protocol.IaCInput{
+		Format:    p.Format,
+		RawCode:   code,
+		Files:     p.Templates,
+		Resources: resources,
+	}
+}
+
+// ParamSets groups repository files into per-parameter-set evaluations.
+// Named *.tfvars files attach to the nearest enclosing directory with .tf
+// files; terraform.tfvars and *.auto.tfvars are applied to every set of that
+// module, as Terraform loads them automatically. *.bicepparam files attach to
+// the template named by their using declaration. Templates without a
+// parameter file yield a single "defaults" set.
+func ParamSets(files []protocol.SourceFile) []ParamSet {
+	tfModules := make(map[string][]protocol.SourceFile)
+	bicepTemplates := make(map[string]protocol.SourceFile)
+	var tfvars, bicepparams, tfFiles []protocol.SourceFile
+
+	for _, f := range files {
+		switch {
+		case strings.HasSuffix(f.Path, ".tfvars"):
+			tfvars = append(tfvars, f)
+		case strings.HasSuffix(f.Path, ".bicepparam"):
+			bicepparams = append(bicepparams, f)
+		case strings.HasSuffix(f.Path, ".tf"):
+			dir := path.Dir(f.Path)
+			tfModules[dir] = append(tfModules[dir], f)
+			tfFiles = append(tfFiles, f)
+		case strings.HasSuffix(f.Path, ".bicep"):
+			bicepTemplates[f.Path] = f
+		}
+	}
+
+	var sets []ParamSet
+
+	// Terraform: auto-loaded values first, then one set per named tfvars.
+	autoValues := make(map[string]map[string]interface{})
+	named := make(map[string][]protocol.SourceFile)
+	for _, f := range tfvars {
+		dir := enclosingModule(path.Dir(f.Path), tfModules)
+		if dir == "" {
+			continue
+		}
+		base := path.Base(f.Path)
+		if base == "terraform.tfvars" || strings.HasSuffix(base, ".auto.tfvars") {
+			if autoValues[dir] == nil {
+				autoValues[dir] = make(map[string]interface{})
+			}
+			merge(autoValues[dir], parser.ParseTFVars(f.Content))
+			continue
+		}
+		named[dir] = append(named[dir], f)
+	}
+	for _, dir := range sortedKeys(tfModules) {
+		templates := tfModules[dir]
+		defaults := make(map[string]interface{})
+		for _, t := range templates {
+			merge(defaults, parser.TerraformVariableDefaults(t.Content))
+		}
+		merge(defaults, autoValues[dir])
+
+		if len(named[dir]) == 0 {
+			sets = append(sets, ParamSet{Name: "defaults", Template: dir, Format: protocol.FormatTerraform, Templates: templates, Values: defaults, Modules: tfFiles})
+			continue
+		}
+		for _, f := range named[dir] {
+			values := copyValues(defaults)
+			merge(values, parser.ParseTFVars(f.Content))
+			sets = append(sets, ParamSet{Name: f.Path, Template: dir, Format: protocol.FormatTerraform, Templates: templates, Values: values, Modules: tfFiles})
+		}
+	}
+
+	// Bicep: each bicepparam names its template explicitly.
+	bicepParamsFor := make(map[string][]protocol.SourceFile)
+	for _, f := range bicepparams {
+		using, _ := parser.ParseBicepParam(f.Content)
+		if using == "" {
+			continue
+		}
+		tmpl := path.Clean(path.Join(path.Dir(f.Path), using))
+		if _, ok := bicepTemplates[tmpl]; ok {
+			bicepParamsFor[tmpl] = append(bicepParamsFor[tmpl], f)
+		}
+	}
+	for _, p := range sortedKeys(bicepTemplates) {
+		tmpl := bicepTemplates[p]
+		defaults := parser.BicepParamDefaults(tmpl.Content)
+		if len(bicepParamsFor[p]) == 0 {
+			sets = append(sets, ParamSet{Name: "defaults", Template: p, Format: protocol.FormatBicep, Templates: []protocol.SourceFile{tmpl}, Values: defaults})
+			continue
+		}
+		for _, f := range bicepParamsFor[p] {
+			_, assigned := parser.ParseBicepParam(f.Content)
+			values := copyValues(defaults)
+			merge(values, assigned)
+			sets = append(sets, ParamSet{Name: f.Path, Template: p, Format: protocol.FormatBicep, Templates: []protocol.SourceFile{tmpl}, Values: values})
+		}
+	}
+	return sets
+}
+
+// enclosingModule walks up from dir to the nearest directory holding .tf files.
+func enclosingModule(dir string, modules map[string][]protocol.SourceFile) string {
+	for {
+		if _, ok := modules[dir]; ok {
+			return dir
+		}
+		if dir == "." || dir == "/" || dir == "" {
+			return ""
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+func merge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		dst[k] = v
+	}
+}
+
+func copyValues(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	merge(out, m)
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
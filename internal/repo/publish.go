@@ -0,0 +1,142 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Publisher creates repositories and issues via the GitHub REST API.
+type Publisher struct {
+	apiURL string
+	token  string
+	client *http.Client
+}
+
+// NewPublisher creates a Publisher. An empty apiURL uses DefaultAPIURL.
+func NewPublisher(apiURL, token string) *Publisher {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Publisher{
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Create creates owner/name as a new private repository, in the owner's
+// organization unless owner is the token's user, and commits files to its
+// default branch. It returns the repository's web URL. An existing
+// repository is an error; nothing is overwritten.
+func (p *Publisher) Create(ctx context.Context, owner, name, description string, files []protocol.SourceFile) (string, error) {
+	if p.token == "" {
+		return "", fmt.Errorf("creating a repository needs a GitHub token")
+	}
+	login, err := p.User(ctx)
+	if err != nil {
+		return "", err
+	}
+	createPath := "/orgs/" + url.PathEscape(owner) + "/repos"
+	if strings.EqualFold(login, owner) {
+		createPath = "/user/repos"
+	}
+	var created struct {
+		HTMLURL string `json:"html_url"`
+	}
+	body := map[string]interface{}{"name": name, "description": description, "private": true}
+	if err := p.send(ctx, http.MethodPost, createPath, body, &created); err != nil {
+		return "", fmt.Errorf("create %s/%s: %w", owner, name, err)
+	}
+
+	// The contents API commits one file at a time; the first commit
+	// creates the default branch of the empty repository.
+	for _, f := range files {
+		put := map[string]string{
+			"message": "Add " + f.Path,
+			"content": base64.StdEncoding.EncodeToString([]byte(f.Content)),
+		}
+		u := fmt.Sprintf("/repos/%s/%s/contents/%s", url.PathEscape(owner), url.PathEscape(name), escapePath(f.Path))
+		if err := p.send(ctx, http.MethodPut, u, put, nil); err != nil {
+			return "", fmt.Errorf("commit %s to %s/%s: %w", f.Path, owner, name, err)
+		}
+	}
+	return created.HTMLURL, nil
+}
+
+// User returns the login of the token's GitHub user.
+func (p *Publisher) User(ctx context.Context) (string, error) {
+	if p.token == "" {
+		return "", fmt.Errorf("identifying the GitHub user needs a token")
+	}
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := p.send(ctx, http.MethodGet, "/user", nil, &user); err != nil {
+		return "", fmt.Errorf("look up GitHub user: %w", err)
+	}
+	return user.Login, nil
+}
+
+// OpenIssue opens an issue in owner/name and returns its web URL.
+func (p *Publisher) OpenIssue(ctx context.Context, owner, name, title, body string, labels ...string) (string, error) {
+	if p.token == "" {
+		return "", fmt.Errorf("opening an issue needs a GitHub token")
+	}
+	in := map[string]interface{}{"title": title, "body": body}
+	if len(labels) > 0 {
+		in["labels"] = labels
+	}
+	var issue struct {
+		HTMLURL string `json:"html_url"`
+	}
+	if err := p.send(ctx, http.MethodPost, fmt.Sprintf("/repos/%s/%s/issues", url.PathEscape(owner), url.PathEscape(name)), in, &issue); err != nil {
+		return "", fmt.Errorf("open issue in %s/%s: %w", owner, name, err)
+	}
+	return issue.HTMLURL, nil
+}
+
+func (p *Publisher) send(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.apiURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFileSize+1))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("GitHub API error %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if out != nil {
+		return json.Unmarshal(data, out)
+	}
+	return nil
+}
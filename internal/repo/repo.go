@@ -0,0 +1,191 @@
+// Package repo fetches IaC source files from GitHub repositories so agents
+// can analyze a whole repository/branch rather than a pasted snippet.
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// DefaultAPIURL is the public GitHub REST API endpoint.
+const DefaultAPIURL = "https://api.github.com"
+
+// maxFileSize skips blobs larger than this (generated or vendored files).
+const maxFileSize = 512 << 10
+
+// Ref identifies a repository and branch, e.g. "org/infra@main".
+type Ref struct {
+	Owner  string `json:"owner"`
+	Name   string `json:"name"`
+	Branch string `json:"branch"`
+}
+
+// String renders the ref as owner/name@branch.
+func (r Ref) String() string {
+	return r.Owner + "/" + r.Name + "@" + r.Branch
+}
+
+// ParseRef parses "owner/name[@branch]". The branch defaults to "main".
+func ParseRef(s string) (Ref, error) {
+	s = strings.TrimSpace(s)
+	repoPart, branch, _ := strings.Cut(s, "@")
+	owner, name, ok := strings.Cut(repoPart, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return Ref{}, fmt.Errorf("invalid repository reference %q (want owner/name@branch)", s)
+	}
+	if branch == "" {
+		branch = "main"
+	}
+	return Ref{Owner: owner, Name: name, Branch: branch}, nil
+}
+
+// ParseRefs parses a comma-separated list of repository references.
+func ParseRefs(s string) ([]Ref, error) {
+	var refs []Ref
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		ref, err := ParseRef(part)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// IsIaCFile reports whether a path is a Terraform or Bicep source or
+// parameter file (.tf, .tfvars, .bicep, .bicepparam).
+func IsIaCFile(p string) bool {
+	switch path.Ext(p) {
+	case ".tf", ".tfvars", ".bicep", ".bicepparam":
+		return true
+	}
+	return false
+}
+
+// Fetcher downloads IaC files via the GitHub REST API.
+type Fetcher struct {
+	apiURL string
+	token  string
+	client *http.Client
+	// Match selects which paths are downloaded. Defaults to IsIaCFile.
+	Match func(path string) bool
+}
+
+// NewFetcher creates a Fetcher. An empty apiURL uses DefaultAPIURL.
+func NewFetcher(apiURL, token string) *Fetcher {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Fetcher{
+		apiURL: strings.TrimSuffix(apiURL, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+		Match:  IsIaCFile,
+	}
+}
+
+type treeResponse struct {
+	Tree []struct {
+		Path string `json:"path"`
+		Type string `json:"type"`
+		Size int    `json:"size"`
+	} `json:"tree"`
+	Truncated bool `json:"truncated"`
+}
+
+// Fetch lists the branch tree and downloads every matching file.
+func (f *Fetcher) Fetch(ctx context.Context, ref Ref) ([]protocol.SourceFile, error) {
+	treeURL := fmt.Sprintf("%s/repos/%s/%s/git/trees/%s?recursive=1",
+		f.apiURL, url.PathEscape(ref.Owner), url.PathEscape(ref.Name), url.PathEscape(ref.Branch))
+	var tree treeResponse
+	if err := f.getJSON(ctx, treeURL, &tree); err != nil {
+		return nil, fmt.Errorf("list tree for %s: %w", ref, err)
+	}
+
+	var files []protocol.SourceFile
+	for _, entry := range tree.Tree {
+		if entry.Type != "blob" || entry.Size > maxFileSize || !f.Match(entry.Path) {
+			continue
+		}
+		content, err := f.getRaw(ctx, ref, entry.Path)
+		if err != nil {
+			return nil, fmt.Errorf("fetch %s from %s: %w", entry.Path, ref, err)
+		}
+		files = append(files, protocol.SourceFile{Path: entry.Path, Content: content})
+	}
+	return files, nil
+}
+
+// Commit resolves ref's branch, tag or commit to the full SHA of the
+// commit it points to.
+func (f *Fetcher) Commit(ctx context.Context, ref Ref) (string, error) {
+	u := fmt.Sprintf("%s/repos/%s/%s/commits/%s",
+		f.apiURL, url.PathEscape(ref.Owner), url.PathEscape(ref.Name), url.PathEscape(ref.Branch))
+	body, err := f.do(ctx, u, "application/vnd.github.sha")
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", ref, err)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+func (f *Fetcher) getRaw(ctx context.Context, ref Ref, p string) (string, error) {
+	u := fmt.Sprintf("%s/repos/%s/%s/contents/%s?ref=%s",
+		f.apiURL, url.PathEscape(ref.Owner), url.PathEscape(ref.Name), escapePath(p), url.QueryEscape(ref.Branch))
+	body, err := f.do(ctx, u, "application/vnd.github.raw")
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+func (f *Fetcher) getJSON(ctx context.Context, u string, v interface{}) error {
+	body, err := f.do(ctx, u, "application/vnd.github+json")
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, v)
+}
+
+func (f *Fetcher) do(ctx context.Context, u, accept string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if f.token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.token)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub API error %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,252 @@
+package repo
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+func TestParseRef(t *testing.T) {
+	ref, err := ParseRef("org/infra@release")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ref.Owner != "org" || ref.Name != "infra" || ref.Branch != "release" {
+		t.Errorf("ref = %+v", ref)
+	}
+	ref, _ = ParseRef("org/infra")
+	if ref.Branch != "main" {
+		t.Errorf("default branch = %q, want main", ref.Branch)
+	}
+	for _, bad := range []string{"", "org", "org/", "/infra", "org/a/b"} {
+		if _, err := ParseRef(bad); err == nil {
+			t.Errorf("ParseRef(%q) should fail", bad)
+		}
+	}
+}
+
+func TestParseRefs(t *testing.T) {
+	refs, err := ParseRefs("org/a@main, org/b@dev,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(refs) != 2 || refs[1].String() != "org/b@dev" {
+		t.Errorf("refs = %v", refs)
+	}
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			t.Errorf("missing auth header")
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/repos/org/infra/git/trees/main"):
+			w.Write([]byte(`{"tree":[
+				{"path":"main.tf","type":"blob","size":40},
+				{"path":"modules/net/main.bicep","type":"blob","size":30},
+				{"path":"README.md","type":"blob","size":10},
+				{"path":"modules","type":"tree"}
+			]}`))
+		case r.URL.Path == "/repos/org/infra/contents/main.tf":
+			if r.URL.Query().Get("ref") != "main" {
+				t.Errorf("ref query = %q", r.URL.Query().Get("ref"))
+			}
+			w.Write([]byte(`resource "azurerm_storage_account" "sa" {}`))
+		case r.URL.Path == "/repos/org/infra/contents/modules/net/main.bicep":
+			w.Write([]byte(`param location string`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f := NewFetcher(srv.URL, "tok")
+	files, err := f.Fetch(context.Background(), Ref{Owner: "org", Name: "infra", Branch: "main"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("files = %d, want 2", len(files))
+	}
+	if files[0].Path != "main.tf" || !strings.Contains(files[0].Content, "azurerm_storage_account") {
+		t.Errorf("unexpected first file: %+v", files[0])
+	}
+}
+
+func TestFetcher_APIError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	_, err := NewFetcher(srv.URL, "").Fetch(context.Background(), Ref{Owner: "o", Name: "r", Branch: "main"})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected 404 error, got %v", err)
+	}
+}
+
+func TestFetcher_Commit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/org/mod/commits/v1.2.0" || r.Header.Get("Accept") != "application/vnd.github.sha" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("3f2a9c1d4e5b6a7f8091a2b3c4d5e6f708192a3b\n"))
+	}))
+	defer srv.Close()
+
+	sha, err := NewFetcher(srv.URL, "").Commit(context.Background(), Ref{Owner: "org", Name: "mod", Branch: "v1.2.0"})
+	if err != nil || sha != "3f2a9c1d4e5b6a7f8091a2b3c4d5e6f708192a3b" {
+		t.Errorf("Commit = %q, %v", sha, err)
+	}
+}
+
+func TestParamSets(t *testing.T) {
+	files := []protocol.SourceFile{
+		{Path: "infra/terraform/main.tf", Content: `resource "azurerm_storage_account" "sa" {
+  enable_https_traffic_only = var.https_only
+  allow_blob_public_access  = var.public
+}`},
+		{Path: "infra/terraform/variables.tf", Content: `variable "https_only" {
+  default = true
+}
+variable "public" {
+  default = false
+}`},
+		{Path: "infra/terraform/common.auto.tfvars", Content: `https_only = true`},
+		{Path: "infra/terraform/envs/dev.tfvars", Content: `public = true`},
+		{Path: "infra/terraform/envs/prod.tfvars", Content: `public = false`},
+		{Path: "infra/bicep/main.bicep", Content: `param allowPublic bool = true
+resource sa 'Microsoft.Storage/storageAccounts@2023-01-01' = {
+  properties: {
+    allowBlobPublicAccess: allowPublic
+  }
+}`},
+		{Path: "infra/bicep/envs/prod.bicepparam", Content: "using '../main.bicep'\nparam allowPublic = false\n"},
+		{Path: "modules/net/main.tf", Content: `resource "azurerm_virtual_network" "vnet" {}`},
+	}
+
+	sets := ParamSets(files)
+	if len(sets) != 4 {
+		for _, s := range sets {
+			t.Logf("%s %s", s.Template, s.Name)
+		}
+		t.Fatalf("sets = %d, want 4", len(sets))
+	}
+
+	byName := make(map[string]ParamSet)
+	for _, s := range sets {
+		byName[s.Name] = s
+	}
+	dev := byName["infra/terraform/envs/dev.tfvars"].Input().Resources[0].Properties
+	if dev["allow_blob_public_access"] != true || dev["enable_https_traffic_only"] != true {
+		t.Errorf("dev props = %v", dev)
+	}
+	prod := byName["infra/terraform/envs/prod.tfvars"].Input().Resources[0].Properties
+	if prod["allow_blob_public_access"] != false {
+		t.Errorf("prod props = %v", prod)
+	}
+	bicep := byName["infra/bicep/envs/prod.bicepparam"]
+	if bicep.Template != "infra/bicep/main.bicep" {
+		t.Errorf("bicepparam template = %q", bicep.Template)
+	}
+	if v := bicep.Input().Resources[0].Properties["allow_blob_public_access"]; v != false {
+		t.Errorf("bicep allow_blob_public_access = %v, want false", v)
+	}
+	if byName["defaults"].Template != "modules/net" {
+		t.Errorf("defaults set = %+v", byName["defaults"])
+	}
+}
+
+func TestIsIaCFile(t *testing.T) {
+	for _, p := range []string{"main.tf", "prod.tfvars", "x.auto.tfvars", "main.bicep", "prod.bicepparam"} {
+		if !IsIaCFile(p) {
+			t.Errorf("IsIaCFile(%q) = false", p)
+		}
+	}
+	if IsIaCFile("README.md") {
+		t.Error("IsIaCFile(README.md) = true")
+	}
+}
+
+func TestPublisher_Create(t *testing.T) {
+	var created string
+	var committed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			t.Errorf("missing auth header")
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/user":
+			w.Write([]byte(`{"login":"octocat"}`))
+		case r.Method == http.MethodPost && (r.URL.Path == "/orgs/contoso/repos" || r.URL.Path == "/user/repos"):
+			var body struct {
+				Name    string `json:"name"`
+				Private bool   `json:"private"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if !body.Private {
+				t.Error("generated repositories should be private")
+			}
+			created = r.URL.Path + ":" + body.Name
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"html_url":"https://github.com/contoso/shop"}`))
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/repos/contoso/shop/contents/"):
+			var body struct {
+				Content string `json:"content"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			content, _ := base64.StdEncoding.DecodeString(body.Content)
+			committed = append(committed, strings.TrimPrefix(r.URL.Path, "/repos/contoso/shop/contents/")+"="+string(content))
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	files := []protocol.SourceFile{{Path: "main.tf", Content: "locals {}"}, {Path: "environments/dev.tfvars", Content: `name = "shop"`}}
+	u, err := NewPublisher(srv.URL, "tok").Create(context.Background(), "contoso", "shop", "", files)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u != "https://github.com/contoso/shop" || created != "/orgs/contoso/repos:shop" {
+		t.Errorf("url = %q, created = %q", u, created)
+	}
+	if len(committed) != 2 || committed[1] != `environments/dev.tfvars=name = "shop"` {
+		t.Errorf("committed = %v", committed)
+	}
+
+	if _, err := NewPublisher(srv.URL, "").Create(context.Background(), "contoso", "shop", "", files); err == nil {
+		t.Error("expected an error without a token")
+	}
+}
+
+func TestPublisher_OpenIssue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Title  string   `json:"title"`
+			Labels []string `json:"labels"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.Method != http.MethodPost || r.URL.Path != "/repos/contoso/shop/issues" || body.Title != "Exception" || len(body.Labels) != 1 {
+			t.Errorf("unexpected %s %s %+v", r.Method, r.URL.Path, body)
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"html_url":"https://github.com/contoso/shop/issues/7"}`))
+	}))
+	defer srv.Close()
+
+	u, err := NewPublisher(srv.URL, "tok").OpenIssue(context.Background(), "contoso", "shop", "Exception", "body", "governance-exception")
+	if err != nil || u != "https://github.com/contoso/shop/issues/7" {
+		t.Errorf("OpenIssue = %q, %v", u, err)
+	}
+}
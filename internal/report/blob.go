@@ -0,0 +1,151 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/azauth"
+)
+
+// storageResource is the Entra ID resource for Azure Storage tokens.
+const storageResource = "https://storage.azure.com/"
+
+// blobAPIVersion is the Blob service REST API version used.
+const blobAPIVersion = "2023-11-03"
+
+// BlobArchiver archives reports as JSON block blobs in an Azure Storage
+// container, named <agent>/<yyyy>/<mm>/<dd>/<id>.json by creation date.
+// It authenticates with a SAS token in the container URL, or else with
+// Entra ID tokens, which need the Storage Blob Data Contributor role.
+type BlobArchiver struct {
+	container string
+	sas       string
+	creds     azauth.TokenSource
+	http      *http.Client
+}
+
+// NewBlobArchiver returns an archiver for containerURL, e.g.
+// https://<account>.blob.core.windows.net/reports. creds may be nil when the
+// URL carries a SAS token.
+func NewBlobArchiver(containerURL string, creds azauth.TokenSource) (*BlobArchiver, error) {
+	u, err := url.Parse(containerURL)
+	if err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("archive URL %q must be a blob container URL", containerURL)
+	}
+	sas := u.RawQuery
+	if sas == "" && creds == nil {
+		return nil, fmt.Errorf("archive URL has no SAS token and no credential is configured")
+	}
+	u.RawQuery = ""
+	return &BlobArchiver{
+		container: strings.TrimRight(u.String(), "/"),
+		sas:       sas,
+		creds:     creds,
+		http:      &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+// Archive uploads r as JSON.
+func (b *BlobArchiver) Archive(ctx context.Context, r Report) (Archived, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return Archived{}, err
+	}
+	sum := md5.Sum(data)
+	a := Archived{
+		ReportID: r.ID,
+		Location: b.container + "/" + blobName(r),
+		Size:     int64(len(data)),
+		MD5:      base64.StdEncoding.EncodeToString(sum[:]),
+	}
+	resp, err := b.do(ctx, http.MethodPut, a.Location, data, map[string]string{
+		"x-ms-blob-type": "BlockBlob",
+		"Content-Type":   "application/json",
+		"Content-MD5":    a.MD5,
+	})
+	if err != nil {
+		return Archived{}, err
+	}
+	resp.Body.Close()
+	return a, nil
+}
+
+// Verify checks that the blob exists with the size and MD5 it was uploaded
+// with.
+func (b *BlobArchiver) Verify(ctx context.Context, a Archived) error {
+	if !strings.HasPrefix(a.Location, b.container+"/") {
+		return fmt.Errorf("%s is not in %s", a.Location, b.container)
+	}
+	resp, err := b.do(ctx, http.MethodHead, a.Location, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.ContentLength != a.Size {
+		return fmt.Errorf("size is %d bytes, archived %d", resp.ContentLength, a.Size)
+	}
+	if got := resp.Header.Get("Content-MD5"); got != a.MD5 {
+		return fmt.Errorf("MD5 is %q, archived %q", got, a.MD5)
+	}
+	return nil
+}
+
+func (b *BlobArchiver) do(ctx context.Context, method, location string, body []byte, headers map[string]string) (*http.Response, error) {
+	target := location
+	if b.sas != "" {
+		target += "?" + b.sas
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", blobAPIVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if b.sas == "" {
+		tok, err := b.creds.Token(ctx, storageResource)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+tok)
+	}
+	resp, err := b.http.Do(req)
+	if err != nil {
+		// The URL may carry the SAS token; leave it out of the error.
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return nil, fmt.Errorf("%s %s: %w", method, path.Base(location), err)
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		if len(msg) == 0 {
+			msg = []byte(resp.Header.Get("x-ms-error-code"))
+		}
+		return nil, fmt.Errorf("%s %s: status %d: %s", method, path.Base(location), resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+func blobName(r Report) string {
+	agent := r.AgentID
+	if agent == "" {
+		agent = "unknown"
+	}
+	return path.Join(url.PathEscape(agent), r.Created.UTC().Format("2006/01/02"), url.PathEscape(r.ID)+".json")
+}
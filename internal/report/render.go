@@ -0,0 +1,49 @@
+package report
+
+import (
+	"html/template"
+	"io"
+)
+
+// pageTemplate renders a report read-only. The agent output is shown as
+// preformatted markdown; html/template escapes everything.
+var pageTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex, nofollow">
+<title>IaC governance report {{.Report.ID}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", sans-serif; max-width: 60rem; margin: 2rem auto; padding: 0 1rem; color: #1f2328; }
+.meta { color: #656d76; }
+table { border-collapse: collapse; width: 100%; margin: 1rem 0; }
+th, td { border: 1px solid #d0d7de; padding: .4rem .6rem; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+pre { background: #f6f8fa; padding: 1rem; overflow-x: auto; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>IaC governance report</h1>
+<p class="meta">Run {{.Report.ID}} by <code>{{.Report.AgentID}}</code>, {{.Report.Created.UTC.Format "2006-01-02 15:04 MST"}}. This read-only link expires {{.Share.Expires.UTC.Format "2006-01-02 15:04 MST"}}.</p>
+{{- if .Report.Findings}}
+<h2>Findings ({{len .Report.Findings}})</h2>
+<table>
+<tr><th>Rule</th><th>Severity</th><th>Resource</th><th>Issue</th><th>Remediation</th></tr>
+{{- range .Report.Findings}}
+<tr><td>{{.RuleID}}</td><td>{{.Severity}}</td><td>{{.ResourceType}}.{{.Resource}}</td><td>{{.Message}}</td><td>{{.Remediation}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+<h2>Output</h2>
+<pre>{{.Report.Markdown}}</pre>
+</body>
+</html>
+`))
+
+// Render writes the read-only HTML page for a shared report.
+func Render(w io.Writer, r Report, s Share) error {
+	return pageTemplate.Execute(w, struct {
+		Report Report
+		Share  Share
+	}{r, s})
+}
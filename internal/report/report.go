@@ -0,0 +1,489 @@
+// Package report keeps the output of recent agent runs and shares them
+// read-only through expiring, revocable links, for reviewers such as
+// contractors or auditors who have no access to the platform.
+package report
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/redact"
+)
+
+const (
+	// DefaultStoreSize is how many reports a Store keeps.
+	DefaultStoreSize = 200
+	// DefaultShareTTL is how long a share link works when no TTL is given.
+	DefaultShareTTL = 7 * 24 * time.Hour
+	// MaxShareTTL caps the lifetime of a share link.
+	MaxShareTTL = 90 * 24 * time.Hour
+	// maxMarkdown caps the stored output of one run.
+	maxMarkdown = 1 << 20
+)
+
+// Share link errors.
+var (
+	ErrNotFound      = errors.New("report not found")
+	ErrShareNotFound = errors.New("share link not found")
+	ErrShareExpired  = errors.New("share link expired")
+	ErrShareRevoked  = errors.New("share link revoked")
+)
+
+// Report is the output of one agent run.
+type Report struct {
+	ID       string             `json:"id"`
+	AgentID  string             `json:"agent_id"`
+	Created  time.Time          `json:"created"`
+	Markdown string             `json:"markdown"`
+	Findings []protocol.Finding `json:"findings,omitempty"`
+	// Costs are the line items of cost estimates made during the run.
+	Costs []protocol.CostItem `json:"costs,omitempty"`
+	// Timings are how long resources actually took to apply, recorded by
+	// the pipeline after applying the change the run analyzed.
+	Timings []ApplyTiming `json:"timings,omitempty"`
+	// Source is the repository the run scanned, when the caller named it.
+	Source string `json:"source,omitempty"`
+	// Resources are the parsed resources the run analyzed, with secrets
+	// masked, so proposed rules can be replayed against them.
+	Resources []protocol.Resource `json:"resources,omitempty"`
+}
+
+// ApplyTiming is the measured duration of one resource action.
+type ApplyTiming struct {
+	ResourceType string  `json:"resource_type"`
+	Action       string  `json:"action"`
+	Seconds      float64 `json:"seconds"`
+}
+
+// Share is a link granting read-only access to one report.
+type Share struct {
+	ID       string    `json:"id"`
+	ReportID string    `json:"report_id"`
+	Created  time.Time `json:"created"`
+	Expires  time.Time `json:"expires"`
+	Revoked  bool      `json:"revoked,omitempty"`
+	// Token is the secret part of the link. It is only returned when the
+	// share is created; the store keeps its hash.
+	Token string `json:"token,omitempty"`
+}
+
+// Store keeps recent reports in memory, evicting the oldest beyond its size,
+// along with their share links. A share stops working when its report is
+// evicted. With a Retention, retired reports leave a Summary behind.
+type Store struct {
+	mu      sync.Mutex
+	reports map[string]Report
+	order   []string
+	size    int
+	shares  map[string]*Share
+	tokens  map[string]string // token hash -> share ID
+	now     func() time.Time
+
+	retention Retention
+	archiver  Archiver
+	summaries map[string]Summary
+	// pending holds reports evicted for space that wait to be archived.
+	pending []Report
+	runs    []RetentionRun
+	// runMu serializes retention runs.
+	runMu sync.Mutex
+}
+
+// NewStore creates a Store holding up to size reports.
+func NewStore(size int, opts ...Option) *Store {
+	if size < 1 {
+		size = DefaultStoreSize
+	}
+	s := &Store{
+		reports:   make(map[string]Report),
+		size:      size,
+		shares:    make(map[string]*Share),
+		tokens:    make(map[string]string),
+		now:       time.Now,
+		summaries: make(map[string]Summary),
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Put stores r under r.ID, replacing any earlier report with that ID.
+func (s *Store) Put(r Report) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.reports[r.ID]; !ok {
+		s.order = append(s.order, r.ID)
+	}
+	s.reports[r.ID] = r
+	for len(s.order) > s.size {
+		old := s.reports[s.order[0]]
+		delete(s.reports, s.order[0])
+		s.order = s.order[1:]
+		s.retireLocked(old)
+	}
+}
+
+// Get returns a stored report.
+func (s *Store) Get(id string) (Report, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.reports[id]
+	return r, ok
+}
+
+// Share creates a link to a report valid for ttl (DefaultShareTTL when zero,
+// at most MaxShareTTL). The returned Share carries the token.
+func (s *Store) Share(reportID string, ttl time.Duration) (Share, error) {
+	switch {
+	case ttl == 0:
+		ttl = DefaultShareTTL
+	case ttl < 0 || ttl > MaxShareTTL:
+		return Share{}, fmt.Errorf("ttl must be between 0 and %s", MaxShareTTL)
+	}
+	token, err := randomString(32)
+	if err != nil {
+		return Share{}, err
+	}
+	id, err := randomString(9)
+	if err != nil {
+		return Share{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.reports[reportID]; !ok {
+		return Share{}, ErrNotFound
+	}
+	s.pruneLocked()
+	now := s.now()
+	sh := &Share{ID: id, ReportID: reportID, Created: now, Expires: now.Add(ttl)}
+	s.shares[id] = sh
+	s.tokens[hashToken(token)] = id
+	out := *sh
+	out.Token = token
+	return out, nil
+}
+
+// Shares lists a report's links, newest first, without their tokens.
+func (s *Store) Shares(reportID string) []Share {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []Share{}
+	for _, sh := range s.shares {
+		if sh.ReportID == reportID {
+			out = append(out, *sh)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out
+}
+
+// Revoke disables a share link immediately.
+func (s *Store) Revoke(shareID string) (Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh, ok := s.shares[shareID]
+	if !ok {
+		return Share{}, ErrShareNotFound
+	}
+	sh.Revoked = true
+	return *sh, nil
+}
+
+// Open resolves a share token to its report.
+func (s *Store) Open(token string) (Report, Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh, ok := s.shares[s.tokens[hashToken(token)]]
+	switch {
+	case !ok:
+		return Report{}, Share{}, ErrShareNotFound
+	case sh.Revoked:
+		return Report{}, *sh, ErrShareRevoked
+	case !s.now().Before(sh.Expires):
+		return Report{}, *sh, ErrShareExpired
+	}
+	r, ok := s.reports[sh.ReportID]
+	if !ok {
+		return Report{}, *sh, ErrNotFound
+	}
+	return r, *sh, nil
+}
+
+// pruneLocked forgets shares that expired more than a day ago, so the
+// store does not grow without bound. Recently expired ones are kept to
+// report "expired" rather than "not found".
+func (s *Store) pruneLocked() {
+	cutoff := s.now().Add(-24 * time.Hour)
+	for token, id := range s.tokens {
+		if sh := s.shares[id]; sh.Expires.Before(cutoff) {
+			delete(s.tokens, token)
+			delete(s.shares, id)
+		}
+	}
+}
+
+// RecordTimings adds measured apply durations to a stored report.
+func (s *Store) RecordTimings(id string, timings []ApplyTiming) error {
+	for _, t := range timings {
+		if t.ResourceType == "" || t.Action == "" || t.Seconds <= 0 {
+			return fmt.Errorf("timing needs a resource_type, an action and positive seconds")
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.reports[id]
+	if !ok {
+		return ErrNotFound
+	}
+	r.Timings = append(r.Timings, timings...)
+	s.reports[id] = r
+	return nil
+}
+
+// ApplyDuration returns the median recorded duration of action on
+// resourceType across stored reports, and the number of samples. It is a
+// graph.TimingFunc.
+func (s *Store) ApplyDuration(resourceType, action string) (time.Duration, int) {
+	s.mu.Lock()
+	var samples []float64
+	for _, id := range s.order {
+		for _, t := range s.reports[id].Timings {
+			if t.ResourceType == resourceType && t.Action == action {
+				samples = append(samples, t.Seconds)
+			}
+		}
+	}
+	s.mu.Unlock()
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	sort.Float64s(samples)
+	median := samples[len(samples)/2]
+	if len(samples)%2 == 0 {
+		median = (samples[len(samples)/2-1] + median) / 2
+	}
+	return time.Duration(median * float64(time.Second)), len(samples)
+}
+
+// CostChange compares the estimate for one release of an environment with
+// the estimate for the release before it.
+type CostChange struct {
+	Environment string  `json:"environment"`
+	Version     string  `json:"version"`
+	ReportID    string  `json:"report_id"`
+	Monthly     float64 `json:"monthly"`
+	// Currency of the amounts; the previous release is the latest one
+	// estimated in the same currency.
+	Currency string `json:"currency"`
+	// PreviousVersion is empty when no earlier release of the environment
+	// was estimated; the whole estimate then counts as added.
+	PreviousVersion  string           `json:"previous_version,omitempty"`
+	PreviousReportID string           `json:"previous_report_id,omitempty"`
+	PreviousMonthly  float64          `json:"previous_monthly"`
+	Delta            float64          `json:"delta"`
+	Items            []CostItemChange `json:"items"`
+}
+
+// CostItemChange is a line item whose monthly cost differs between two
+// releases. Previous is zero for added items and Monthly for removed ones.
+type CostItemChange struct {
+	Name     string  `json:"name"`
+	SKU      string  `json:"sku"`
+	Monthly  float64 `json:"monthly"`
+	Previous float64 `json:"previous"`
+	Delta    float64 `json:"delta"`
+}
+
+// CostChange answers "what did version add to env's monthly cost?" from the
+// latest estimate tagged with env and version and the latest earlier
+// estimate of env for another version. Only reports still in the store are
+// considered.
+func (s *Store) CostChange(env, version string) (CostChange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var cur, prev *Report
+	var curItems, prevItems []protocol.CostItem
+	var prevVersion string
+	for i := len(s.order) - 1; i >= 0; i-- {
+		r := s.reports[s.order[i]]
+		if cur == nil {
+			if items := costsFor(r.Costs, env, version); len(items) > 0 {
+				cur, curItems = &r, items
+			}
+			continue
+		}
+		for _, it := range r.Costs {
+			if it.Environment == env && it.Version != "" && it.Version != version && itemCurrency(it) == itemCurrency(curItems[0]) {
+				prev, prevVersion = &r, it.Version
+				prevItems = costsFor(r.Costs, env, it.Version)
+				break
+			}
+		}
+		if prev != nil {
+			break
+		}
+	}
+	if cur == nil {
+		return CostChange{}, ErrNotFound
+	}
+	out := CostChange{Environment: env, Version: version, ReportID: cur.ID, Currency: itemCurrency(curItems[0]), Items: []CostItemChange{}}
+	if prev != nil {
+		out.PreviousVersion, out.PreviousReportID = prevVersion, prev.ID
+	}
+
+	before := make(map[string]protocol.CostItem, len(prevItems))
+	for _, it := range prevItems {
+		before[it.Name] = it
+		out.PreviousMonthly += it.Monthly
+	}
+	for _, it := range curItems {
+		out.Monthly += it.Monthly
+		old, ok := before[it.Name]
+		delete(before, it.Name)
+		if ok && old.Monthly == it.Monthly {
+			continue
+		}
+		out.Items = append(out.Items, CostItemChange{Name: it.Name, SKU: it.SKU, Monthly: it.Monthly, Previous: old.Monthly, Delta: it.Monthly - old.Monthly})
+	}
+	for _, old := range before {
+		if old.Monthly != 0 {
+			out.Items = append(out.Items, CostItemChange{Name: old.Name, SKU: old.SKU, Previous: old.Monthly, Delta: -old.Monthly})
+		}
+	}
+	out.Delta = out.Monthly - out.PreviousMonthly
+	sort.SliceStable(out.Items, func(i, j int) bool { return out.Items[i].Delta > out.Items[j].Delta })
+	return out, nil
+}
+
+// itemCurrency returns the currency of a line item; items reported before
+// currencies were recorded are USD.
+func itemCurrency(it protocol.CostItem) string {
+	if it.Currency == "" {
+		return "USD"
+	}
+	return it.Currency
+}
+
+// costsFor returns the line items estimated for env at version.
+func costsFor(items []protocol.CostItem, env, version string) []protocol.CostItem {
+	var out []protocol.CostItem
+	for _, it := range items {
+		if it.Environment == env && it.Version == version {
+			out = append(out, it)
+		}
+	}
+	return out
+}
+
+// Observe is a host.Observer that stores the output and findings of every
+// request under its protocol.MetaJobID. Synthetic probes are skipped.
+func (s *Store) Observe(agentID string, req protocol.AgentRequest, emit protocol.Emitter) (protocol.Emitter, func(error)) {
+	id := req.Metadata[protocol.MetaJobID]
+	if id == "" || req.Metadata[protocol.MetaProbe] != "" {
+		return nil, nil
+	}
+	capture := &captureEmitter{Emitter: emit}
+	created := s.now()
+	resources := redact.Resources(req)
+	return capture, func(error) {
+		capture.mu.Lock()
+		defer capture.mu.Unlock()
+		s.Put(Report{ID: id, AgentID: agentID, Created: created, Markdown: capture.text.String(), Findings: capture.findings, Costs: capture.costs,
+			Source: req.Metadata[protocol.MetaRepository], Resources: resources})
+	}
+}
+
+// Recent returns up to n stored reports, newest first.
+func (s *Store) Recent(n int) []Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Report
+	for i := len(s.order) - 1; i >= 0 && len(out) < n; i-- {
+		out = append(out, s.reports[s.order[i]])
+	}
+	return out
+}
+
+// Latest returns the newest stored report of the repository source that
+// match accepts; a nil match accepts any.
+func (s *Store) Latest(source string, match func(Report) bool) (Report, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.order) - 1; i >= 0; i-- {
+		r := s.reports[s.order[i]]
+		if r.Source == source && (match == nil || match(r)) {
+			return r, true
+		}
+	}
+	return Report{}, false
+}
+
+// captureEmitter passes output through while recording it.
+type captureEmitter struct {
+	protocol.Emitter
+	mu       sync.Mutex
+	text     strings.Builder
+	findings []protocol.Finding
+	costs    []protocol.CostItem
+}
+
+func (c *captureEmitter) SendMessage(content string) {
+	c.mu.Lock()
+	if c.text.Len()+len(content) <= maxMarkdown {
+		c.text.WriteString(content)
+	}
+	c.mu.Unlock()
+	c.Emitter.SendMessage(content)
+}
+
+func (c *captureEmitter) ReportFindings(agentID string, findings []protocol.Finding) {
+	c.mu.Lock()
+	c.findings = append(c.findings, findings...)
+	c.mu.Unlock()
+	protocol.ReportFindings(c.Emitter, agentID, findings)
+}
+
+func (c *captureEmitter) ReportCosts(agentID string, items []protocol.CostItem) {
+	c.mu.Lock()
+	c.costs = append(c.costs, items...)
+	c.mu.Unlock()
+	protocol.ReportCosts(c.Emitter, agentID, items)
+}
+
+func (c *captureEmitter) ReportScores(agentID string, scores map[string]int) {
+	protocol.ReportScores(c.Emitter, agentID, scores)
+}
+
+func (c *captureEmitter) ReportSummary(sum protocol.RunSummary) {
+	protocol.ReportSummary(c.Emitter, sum)
+}
+
+func (c *captureEmitter) ReportProgress(p protocol.Progress) {
+	if r, ok := c.Emitter.(protocol.ProgressReporter); ok {
+		r.ReportProgress(p)
+	}
+}
+
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate share token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
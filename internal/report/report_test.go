@@ -0,0 +1,369 @@
+package report
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+)
+
+func TestStore_ShareLifecycle(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := NewStore(2)
+	s.now = func() time.Time { return now }
+	s.Put(Report{ID: "job-1", AgentID: "policy", Markdown: "## Policy"})
+
+	if _, err := s.Share("missing", 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Share(missing) err = %v", err)
+	}
+	if _, err := s.Share("job-1", MaxShareTTL+time.Hour); err == nil {
+		t.Error("ttl above MaxShareTTL should fail")
+	}
+
+	share, err := s.Share("job-1", time.Hour)
+	if err != nil || share.Token == "" || !share.Expires.Equal(now.Add(time.Hour)) {
+		t.Fatalf("Share = %+v, %v", share, err)
+	}
+	if r, _, err := s.Open(share.Token); err != nil || r.Markdown != "## Policy" {
+		t.Errorf("Open = %+v, %v", r, err)
+	}
+	if _, _, err := s.Open("guess"); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("Open(guess) err = %v", err)
+	}
+	if listed := s.Shares("job-1"); len(listed) != 1 || listed[0].Token != "" {
+		t.Errorf("Shares = %+v, want one entry without token", listed)
+	}
+
+	now = now.Add(time.Hour)
+	if _, _, err := s.Open(share.Token); !errors.Is(err, ErrShareExpired) {
+		t.Errorf("expired Open err = %v", err)
+	}
+
+	second, _ := s.Share("job-1", 0)
+	if !second.Expires.Equal(now.Add(DefaultShareTTL)) {
+		t.Errorf("default expiry = %v", second.Expires)
+	}
+	if _, err := s.Revoke(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Open(second.Token); !errors.Is(err, ErrShareRevoked) {
+		t.Errorf("revoked Open err = %v", err)
+	}
+
+	third, _ := s.Share("job-1", 0)
+	s.Put(Report{ID: "job-2"})
+	s.Put(Report{ID: "job-3"})
+	if _, _, err := s.Open(third.Token); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after eviction err = %v", err)
+	}
+}
+
+func TestStore_ObserveAndRender(t *testing.T) {
+	s := NewStore(0)
+	req := protocol.AgentRequest{Metadata: map[string]string{protocol.MetaJobID: "job-1"}}
+	rec := &prototest.Recorder{}
+	emit, finish := s.Observe("security", req, rec)
+	emit.SendMessage("### Security <b>scan</b>\n")
+	protocol.ReportFindings(emit, "security", []protocol.Finding{{RuleID: "SEC-001", Severity: "critical", Resource: "sa", ResourceType: "azurerm_storage_account", Message: `password = "<script>"`}})
+	finish(nil)
+
+	if len(rec.Messages) != 1 {
+		t.Errorf("output not passed through: %v", rec.Messages)
+	}
+	r, ok := s.Get("job-1")
+	if !ok || r.AgentID != "security" || len(r.Findings) != 1 {
+		t.Fatalf("stored report = %+v", r)
+	}
+
+	scan := protocol.AgentRequest{
+		Metadata: map[string]string{protocol.MetaJobID: "job-3", protocol.MetaRepository: "org/app"},
+		IaC:      &protocol.IaCInput{Resources: []protocol.Resource{{Type: "azurerm_storage_account", Name: "sa"}}},
+	}
+	_, finish = s.Observe("security", scan, rec)
+	finish(nil)
+	if recent := s.Recent(5); len(recent) != 2 || recent[0].ID != "job-3" || recent[0].Source != "org/app" || len(recent[0].Resources) != 1 {
+		t.Errorf("Recent = %+v", recent)
+	}
+
+	probe := protocol.AgentRequest{Metadata: map[string]string{protocol.MetaJobID: "job-2", protocol.MetaProbe: "1"}}
+	if emit, _ := s.Observe("policy", probe, rec); emit != nil {
+		t.Error("probes should not be stored")
+	}
+
+	var page strings.Builder
+	if err := Render(&page, r, Share{Expires: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	html := page.String()
+	for _, want := range []string{"SEC-001", "&lt;b&gt;scan&lt;/b&gt;", "&lt;script&gt;"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("page missing %q:\n%s", want, html)
+		}
+	}
+	if strings.Contains(html, "<script>") {
+		t.Error("page contains unescaped agent output")
+	}
+}
+
+func TestStore_CostChange(t *testing.T) {
+	s := NewStore(0)
+	put := func(id, env, version string, items ...protocol.CostItem) {
+		for i := range items {
+			items[i].Environment, items[i].Version = env, version
+		}
+		s.Put(Report{ID: id, AgentID: "cost", Costs: items})
+	}
+	put("job-1", "prod", "v1.2.0", protocol.CostItem{Name: "vm.a", Monthly: 70}, protocol.CostItem{Name: "vm.b", Monthly: 30})
+	put("job-2", "staging", "v1.3.0", protocol.CostItem{Name: "vm.a", Monthly: 10})
+	put("job-3", "prod", "v1.3.0", protocol.CostItem{Name: "vm.a", Monthly: 70}, protocol.CostItem{Name: "aks.c", Monthly: 200})
+
+	if _, err := s.CostChange("prod", "v2.0.0"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown version err = %v", err)
+	}
+
+	c, err := s.CostChange("prod", "v1.3.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ReportID != "job-3" || c.PreviousVersion != "v1.2.0" || c.Monthly != 270 || c.PreviousMonthly != 100 || c.Delta != 170 {
+		t.Errorf("CostChange = %+v", c)
+	}
+	if len(c.Items) != 2 || c.Items[0].Name != "aks.c" || c.Items[1].Name != "vm.b" || c.Items[1].Delta != -30 {
+		t.Errorf("items = %+v, want aks.c added and vm.b removed", c.Items)
+	}
+
+	first, err := s.CostChange("prod", "v1.2.0")
+	if err != nil || first.PreviousVersion != "" || first.Delta != 100 || len(first.Items) != 2 {
+		t.Errorf("first release = %+v, %v", first, err)
+	}
+}
+
+func TestStore_Latest(t *testing.T) {
+	s := NewStore(0)
+	s.Put(Report{ID: "job-1", AgentID: "cost", Source: "org/app", Costs: []protocol.CostItem{{Name: "vm.a", Monthly: 70}}})
+	s.Put(Report{ID: "job-2", AgentID: "security", Source: "org/app"})
+	s.Put(Report{ID: "job-3", AgentID: "cost", Source: "org/other", Costs: []protocol.CostItem{{Name: "vm.b", Monthly: 10}}})
+
+	if r, ok := s.Latest("org/app", nil); !ok || r.ID != "job-2" {
+		t.Errorf("Latest = %s, %v; want job-2", r.ID, ok)
+	}
+	if r, ok := s.Latest("org/app", func(r Report) bool { return len(r.Costs) > 0 }); !ok || r.ID != "job-1" {
+		t.Errorf("Latest with costs = %s, %v; want job-1", r.ID, ok)
+	}
+	if _, ok := s.Latest("org/missing", nil); ok {
+		t.Error("unknown repository should have no report")
+	}
+}
+
+func TestStore_ApplyDuration(t *testing.T) {
+	s := NewStore(0)
+	if err := s.RecordTimings("missing", []ApplyTiming{{ResourceType: "azurerm_redis_cache", Action: "create", Seconds: 60}}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown report err = %v", err)
+	}
+	s.Put(Report{ID: "job-1"})
+	s.Put(Report{ID: "job-2"})
+	if err := s.RecordTimings("job-1", []ApplyTiming{{ResourceType: "azurerm_redis_cache", Action: "create"}}); err == nil {
+		t.Error("a timing without seconds should be rejected")
+	}
+	s.RecordTimings("job-1", []ApplyTiming{
+		{ResourceType: "azurerm_redis_cache", Action: "create", Seconds: 1500},
+		{ResourceType: "azurerm_redis_cache", Action: "update", Seconds: 60},
+	})
+	s.RecordTimings("job-2", []ApplyTiming{
+		{ResourceType: "azurerm_redis_cache", Action: "create", Seconds: 900},
+		{ResourceType: "azurerm_redis_cache", Action: "create", Seconds: 1200},
+	})
+	if d, n := s.ApplyDuration("azurerm_redis_cache", "create"); d != 20*time.Minute || n != 3 {
+		t.Errorf("ApplyDuration = %v, %d; want the 20m median of 3", d, n)
+	}
+	s.RecordTimings("job-2", []ApplyTiming{{ResourceType: "azurerm_redis_cache", Action: "create", Seconds: 1320}})
+	if d, n := s.ApplyDuration("azurerm_redis_cache", "create"); d != 21*time.Minute || n != 4 {
+		t.Errorf("even samples: ApplyDuration = %v, %d", d, n)
+	}
+	if _, n := s.ApplyDuration("azurerm_key_vault", "create"); n != 0 {
+		t.Errorf("unrecorded type has %d samples", n)
+	}
+}
+
+func TestStore_CostChangeCurrency(t *testing.T) {
+	s := NewStore(0)
+	s.Put(Report{ID: "job-1", Costs: []protocol.CostItem{{Name: "vm.a", Monthly: 100, Currency: "EUR", Environment: "prod", Version: "v1"}}})
+	s.Put(Report{ID: "job-2", Costs: []protocol.CostItem{{Name: "vm.a", Monthly: 110, Environment: "prod", Version: "v2"}}})
+	s.Put(Report{ID: "job-3", Costs: []protocol.CostItem{{Name: "vm.a", Monthly: 90, Currency: "EUR", Environment: "prod", Version: "v3"}}})
+
+	c, err := s.CostChange("prod", "v3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Currency != "EUR" || c.PreviousVersion != "v1" || c.Delta != -10 {
+		t.Errorf("CostChange = %+v, want v1 (the last EUR estimate) as previous", c)
+	}
+	if c, _ := s.CostChange("prod", "v2"); c.Currency != "USD" || c.PreviousVersion != "" {
+		t.Errorf("USD release = %+v", c)
+	}
+}
+
+// memArchive is an Archiver keeping blobs in memory.
+type memArchive struct {
+	blobs map[string]Archived
+	fail  map[string]bool
+}
+
+func (m *memArchive) Archive(_ context.Context, r Report) (Archived, error) {
+	if m.fail[r.ID] {
+		return Archived{}, errors.New("unavailable")
+	}
+	a := Archived{ReportID: r.ID, Location: "mem://" + r.ID, Size: int64(len(r.Markdown)), MD5: r.Markdown}
+	m.blobs[a.Location] = a
+	return a, nil
+}
+
+func (m *memArchive) Verify(_ context.Context, a Archived) error {
+	if got, ok := m.blobs[a.Location]; !ok || got != a {
+		return errors.New("missing")
+	}
+	return nil
+}
+
+func TestStore_ApplyRetention(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	archive := &memArchive{blobs: make(map[string]Archived), fail: map[string]bool{"old-2": true}}
+	s := NewStore(3, WithRetention(Retention{Detailed: 90 * 24 * time.Hour, Summary: 2 * 365 * 24 * time.Hour}), WithArchiver(archive))
+	s.now = func() time.Time { return now }
+	findings := []protocol.Finding{{RuleID: "SEC-001", Severity: protocol.SeverityHigh}, {RuleID: "POL-001", Severity: "MEDIUM"}}
+	s.Put(Report{ID: "old-1", AgentID: "security", Created: now.Add(-100 * 24 * time.Hour), Markdown: "a", Findings: findings})
+	s.Put(Report{ID: "old-2", AgentID: "policy", Created: now.Add(-95 * 24 * time.Hour), Markdown: "b"})
+	s.Put(Report{ID: "new-1", AgentID: "policy", Created: now.Add(-24 * time.Hour), Markdown: "c"})
+	s.Put(Report{ID: "new-2", AgentID: "policy", Created: now, Markdown: "d"}) // evicts old-1
+
+	if st := s.RetentionStatus(); st.Reports != 3 || st.Pending != 1 || !st.Archive || st.Detailed != "2160h0m0s" {
+		t.Errorf("status before run = %+v", st)
+	}
+	run := s.ApplyRetention(context.Background(), TriggerManual)
+	if len(run.Archived) != 1 || run.Archived[0].ReportID != "old-1" || run.Summarized != 1 || len(run.Failed) != 1 || !strings.HasPrefix(run.Failed[0], "old-2:") {
+		t.Fatalf("run = %+v", run)
+	}
+	if _, ok := s.Get("old-2"); !ok {
+		t.Error("report that failed to archive was dropped")
+	}
+	sums := s.Summaries("security")
+	if len(sums) != 1 || sums[0].Archive != "mem://old-1" || sums[0].Findings != 2 || sums[0].Severities[protocol.SeverityMedium] != 1 {
+		t.Errorf("summaries = %+v", sums)
+	}
+
+	verified, err := s.VerifyRun(context.Background(), run.ID)
+	if err != nil || verified.Verification == nil || !verified.Verification.OK || verified.Verification.Verified != 1 {
+		t.Errorf("VerifyRun = %+v, %v", verified, err)
+	}
+	delete(archive.blobs, "mem://old-1")
+	if v, _ := s.VerifyRun(context.Background(), run.ID); v.Verification.OK || v.Verification.Failed["old-1"] == "" {
+		t.Errorf("verification of a deleted blob = %+v", v.Verification)
+	}
+	if _, err := s.VerifyRun(context.Background(), "missing"); !errors.Is(err, ErrRunNotFound) {
+		t.Errorf("unknown run err = %v", err)
+	}
+
+	archive.fail = nil
+	now = now.Add(2 * 365 * 24 * time.Hour)
+	run = s.ApplyRetention(context.Background(), TriggerSchedule)
+	if run.Summarized != 3 || run.Expired != 3 {
+		t.Errorf("second run = %+v", run)
+	}
+	st := s.RetentionStatus()
+	if st.Reports != 0 || st.Summaries != 1 || len(st.Runs) != 2 || st.Runs[0].ID != run.ID || st.Runs[1].Verification == nil {
+		t.Errorf("status = %+v", st)
+	}
+}
+
+func TestStore_RetentionWithoutArchive(t *testing.T) {
+	s := NewStore(1, WithRetention(Retention{Summary: time.Hour}))
+	s.Put(Report{ID: "job-1", AgentID: "cost", Created: time.Now()})
+	s.Put(Report{ID: "job-2", AgentID: "cost", Created: time.Now()})
+	if sums := s.Summaries(""); len(sums) != 1 || sums[0].ID != "job-1" || sums[0].Archive != "" {
+		t.Errorf("summaries = %+v", sums)
+	}
+	if _, err := s.VerifyRun(context.Background(), s.ApplyRetention(context.Background(), TriggerManual).ID); err == nil {
+		t.Error("verifying without an archive should fail")
+	}
+	if sums := NewStore(1).Summaries(""); len(sums) != 0 {
+		t.Errorf("store without retention keeps summaries: %+v", sums)
+	}
+}
+
+func TestBlobArchiver(t *testing.T) {
+	blobs := make(map[string][]byte)
+	md5s := make(map[string]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-ms-version") == "" || r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "AuthenticationFailed", http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			if r.Header.Get("x-ms-blob-type") != "BlockBlob" {
+				http.Error(w, "bad blob type", http.StatusBadRequest)
+				return
+			}
+			blobs[r.URL.Path], _ = io.ReadAll(r.Body)
+			md5s[r.URL.Path] = r.Header.Get("Content-MD5")
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodHead:
+			data, ok := blobs[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			w.Header().Set("Content-MD5", md5s[r.URL.Path])
+		}
+	}))
+	defer srv.Close()
+
+	if _, err := NewBlobArchiver(srv.URL, tokenFunc("tok")); err == nil {
+		t.Error("URL without a container accepted")
+	}
+	if _, err := NewBlobArchiver(srv.URL+"/reports", nil); err == nil {
+		t.Error("URL without SAS or credential accepted")
+	}
+	b, err := NewBlobArchiver(srv.URL+"/reports/", tokenFunc("tok"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := Report{ID: "job-1", AgentID: "policy", Created: time.Date(2026, 7, 4, 10, 0, 0, 0, time.UTC), Markdown: "## Policy"}
+	a, err := b.Archive(context.Background(), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Location != srv.URL+"/reports/policy/2026/07/04/job-1.json" || a.Size == 0 || a.MD5 == "" {
+		t.Errorf("archived = %+v", a)
+	}
+	var got Report
+	if err := json.Unmarshal(blobs["/reports/policy/2026/07/04/job-1.json"], &got); err != nil || got.Markdown != r.Markdown {
+		t.Errorf("blob = %+v, %v", got, err)
+	}
+	if err := b.Verify(context.Background(), a); err != nil {
+		t.Errorf("Verify = %v", err)
+	}
+	blobs["/reports/policy/2026/07/04/job-1.json"] = []byte("{}")
+	if err := b.Verify(context.Background(), a); err == nil || !strings.Contains(err.Error(), "size") {
+		t.Errorf("Verify of a changed blob = %v", err)
+	}
+
+	sas, _ := NewBlobArchiver(srv.URL+"/reports?sv=2022-11-02&sig=secret", nil)
+	if _, err := sas.Archive(context.Background(), r); err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("rejected SAS upload err = %v", err)
+	}
+}
+
+type tokenFunc string
+
+func (t tokenFunc) Token(context.Context, string) (string, error) { return string(t), nil }
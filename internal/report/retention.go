@@ -0,0 +1,315 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// maxRetentionRuns is how many retention runs a Store remembers.
+const maxRetentionRuns = 20
+
+// ErrRunNotFound is returned for an unknown retention run.
+var ErrRunNotFound = errors.New("retention run not found")
+
+// Retention bounds how long reports are kept. Reports older than Detailed
+// are archived, when the store has an Archiver, and replaced by a Summary;
+// summaries older than Summary are deleted. A zero Detailed keeps reports
+// until the store's size evicts them, and a zero Summary keeps no
+// summaries.
+type Retention struct {
+	Detailed time.Duration
+	Summary  time.Duration
+}
+
+// Summary is what is kept of a report after its retention: who ran it,
+// when, and how many findings of each severity it had.
+type Summary struct {
+	ID         string                    `json:"id"`
+	AgentID    string                    `json:"agent_id"`
+	Created    time.Time                 `json:"created"`
+	Findings   int                       `json:"findings"`
+	Severities map[protocol.Severity]int `json:"severities,omitempty"`
+	// Archive is where the full report was archived; empty when it was
+	// not.
+	Archive string `json:"archive,omitempty"`
+}
+
+// Summarize returns the summary of r.
+func Summarize(r Report) Summary {
+	s := Summary{ID: r.ID, AgentID: r.AgentID, Created: r.Created, Findings: len(r.Findings)}
+	for _, f := range r.Findings {
+		if s.Severities == nil {
+			s.Severities = make(map[protocol.Severity]int)
+		}
+		s.Severities[protocol.NormalizeSeverity(string(f.Severity))]++
+	}
+	return s
+}
+
+// Archiver copies reports to long-term storage before the store drops
+// them.
+type Archiver interface {
+	// Archive stores r and returns where.
+	Archive(ctx context.Context, r Report) (Archived, error)
+	// Verify checks that an archived report is still there, unchanged.
+	Verify(ctx context.Context, a Archived) error
+}
+
+// Archived is a report copied by an Archiver.
+type Archived struct {
+	ReportID string `json:"report_id"`
+	Location string `json:"location"`
+	Size     int64  `json:"size"`
+	// MD5 is the base64 MD5 digest of the archived JSON.
+	MD5 string `json:"md5"`
+}
+
+// Retention run triggers.
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// RetentionRun is the outcome of one pass of ApplyRetention.
+type RetentionRun struct {
+	ID       string    `json:"id"`
+	Trigger  string    `json:"trigger"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// Archived lists the reports copied to the archive.
+	Archived []Archived `json:"archived"`
+	// Summarized counts reports replaced by their summary.
+	Summarized int `json:"summarized"`
+	// Expired counts summaries deleted.
+	Expired int `json:"expired"`
+	// Failed lists reports that could not be archived; they are kept and
+	// retried on the next run.
+	Failed       []string      `json:"failed,omitempty"`
+	Verification *Verification `json:"verification,omitempty"`
+}
+
+// Verification is the result of checking a run's archived reports.
+type Verification struct {
+	Checked time.Time `json:"checked"`
+	// OK is set when every archived report checked out.
+	OK       bool `json:"ok"`
+	Verified int  `json:"verified"`
+	// Failed maps report IDs to what is wrong with their archived copy.
+	Failed map[string]string `json:"failed,omitempty"`
+}
+
+// RetentionStatus describes a store's retention policy and state.
+type RetentionStatus struct {
+	Detailed  string `json:"detailed,omitempty"`
+	Summary   string `json:"summary,omitempty"`
+	Archive   bool   `json:"archive"`
+	Reports   int    `json:"reports"`
+	Summaries int    `json:"summaries"`
+	// Pending counts reports evicted for space that wait to be archived.
+	Pending int            `json:"pending"`
+	Runs    []RetentionRun `json:"runs"`
+}
+
+// Option configures a Store.
+type Option func(*Store)
+
+// WithRetention sets how long reports and their summaries are kept.
+func WithRetention(r Retention) Option {
+	return func(s *Store) { s.retention = r }
+}
+
+// WithArchiver archives reports before they are dropped. Reports evicted
+// for space are archived on the next retention run.
+func WithArchiver(a Archiver) Option {
+	return func(s *Store) { s.archiver = a }
+}
+
+// retireLocked handles a report evicted for space: it waits for the next
+// retention run when there is an archiver, and is summarized now
+// otherwise. At most size reports wait; older ones are summarized without
+// being archived.
+func (s *Store) retireLocked(r Report) {
+	if s.archiver == nil {
+		s.summarizeLocked(Summarize(r))
+		return
+	}
+	s.pending = append(s.pending, r)
+	for len(s.pending) > s.size {
+		s.summarizeLocked(Summarize(s.pending[0]))
+		s.pending = s.pending[1:]
+	}
+}
+
+func (s *Store) summarizeLocked(sum Summary) {
+	if s.retention.Summary > 0 {
+		s.summaries[sum.ID] = sum
+	}
+}
+
+func (s *Store) removeLocked(id string) {
+	if _, ok := s.reports[id]; !ok {
+		return
+	}
+	delete(s.reports, id)
+	for i, o := range s.order {
+		if o == id {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// ApplyRetention archives and summarizes reports past the detailed
+// retention, and those evicted for space since the last run, then deletes
+// expired summaries. A report that fails to archive is kept for the next
+// run.
+func (s *Store) ApplyRetention(ctx context.Context, trigger string) RetentionRun {
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	id, _ := randomString(9)
+	now := s.now()
+	run := RetentionRun{ID: id, Trigger: trigger, Started: now, Archived: []Archived{}}
+
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = nil
+	var due []Report
+	if s.retention.Detailed > 0 {
+		cutoff := now.Add(-s.retention.Detailed)
+		for _, rid := range s.order {
+			if r := s.reports[rid]; r.Created.Before(cutoff) {
+				due = append(due, r)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	var retry []Report
+	for i, r := range append(pending, due...) {
+		sum := Summarize(r)
+		if s.archiver != nil {
+			a, err := s.archiver.Archive(ctx, r)
+			if err != nil {
+				run.Failed = append(run.Failed, fmt.Sprintf("%s: %v", r.ID, err))
+				if i < len(pending) {
+					retry = append(retry, r)
+				}
+				continue
+			}
+			sum.Archive = a.Location
+			run.Archived = append(run.Archived, a)
+		}
+		s.mu.Lock()
+		s.removeLocked(r.ID)
+		s.summarizeLocked(sum)
+		s.mu.Unlock()
+		run.Summarized++
+	}
+
+	s.mu.Lock()
+	s.pending = append(retry, s.pending...)
+	if s.retention.Summary > 0 {
+		cutoff := now.Add(-s.retention.Summary)
+		for rid, sum := range s.summaries {
+			if sum.Created.Before(cutoff) {
+				delete(s.summaries, rid)
+				run.Expired++
+			}
+		}
+	}
+	run.Finished = s.now()
+	s.runs = append(s.runs, run)
+	if len(s.runs) > maxRetentionRuns {
+		s.runs = s.runs[len(s.runs)-maxRetentionRuns:]
+	}
+	s.mu.Unlock()
+	return run
+}
+
+// VerifyRun checks that the reports a retention run archived are still in
+// the archive, unchanged, and records the result on the run.
+func (s *Store) VerifyRun(ctx context.Context, runID string) (RetentionRun, error) {
+	s.mu.Lock()
+	run, ok := s.runLocked(runID)
+	s.mu.Unlock()
+	if !ok {
+		return RetentionRun{}, ErrRunNotFound
+	}
+	if s.archiver == nil {
+		return run, errors.New("no archive configured")
+	}
+	v := Verification{Checked: s.now()}
+	for _, a := range run.Archived {
+		if err := s.archiver.Verify(ctx, a); err != nil {
+			if v.Failed == nil {
+				v.Failed = make(map[string]string)
+			}
+			v.Failed[a.ReportID] = err.Error()
+			continue
+		}
+		v.Verified++
+	}
+	v.OK = len(v.Failed) == 0
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.runs {
+		if s.runs[i].ID == runID {
+			s.runs[i].Verification = &v
+		}
+	}
+	run.Verification = &v
+	return run, nil
+}
+
+func (s *Store) runLocked(id string) (RetentionRun, bool) {
+	for _, r := range s.runs {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return RetentionRun{}, false
+}
+
+// RetentionStatus returns the retention policy, what the store holds and
+// the recent runs, newest first.
+func (s *Store) RetentionStatus() RetentionStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := RetentionStatus{
+		Archive:   s.archiver != nil,
+		Reports:   len(s.reports),
+		Summaries: len(s.summaries),
+		Pending:   len(s.pending),
+		Runs:      make([]RetentionRun, 0, len(s.runs)),
+	}
+	if s.retention.Detailed > 0 {
+		st.Detailed = s.retention.Detailed.String()
+	}
+	if s.retention.Summary > 0 {
+		st.Summary = s.retention.Summary.String()
+	}
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		st.Runs = append(st.Runs, s.runs[i])
+	}
+	return st
+}
+
+// Summaries returns the summaries of retired reports, of agentID when it
+// is set, newest first.
+func (s *Store) Summaries(agentID string) []Summary {
+	s.mu.Lock()
+	out := []Summary{}
+	for _, sum := range s.summaries {
+		if agentID == "" || sum.AgentID == agentID {
+			out = append(out, sum)
+		}
+	}
+	s.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Created.After(out[j].Created) })
+	return out
+}
@@ -0,0 +1,268 @@
+// Package sarif renders findings as a SARIF 2.1.0 log, the format GitHub
+// code scanning accepts, so scan results can be uploaded and show up as
+// alerts on pull requests.
+package sarif
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Version and Schema identify the SARIF version of the logs Build writes.
+const (
+	Version = "2.1.0"
+	Schema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// ToolName is the driver name results are reported under.
+const ToolName = "ghcp-iac"
+
+// Log is a SARIF log with a single run.
+type Log struct {
+	Schema  string `json:"$schema"`
+	Version string `json:"version"`
+	Runs    []Run  `json:"runs"`
+}
+
+// Run is the results of one analysis tool.
+type Run struct {
+	Tool    Tool     `json:"tool"`
+	Results []Result `json:"results"`
+}
+
+// Tool describes the analysis tool.
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+// Driver is the tool component that produced the results, with metadata
+// for every rule they reference.
+type Driver struct {
+	Name           string `json:"name"`
+	Version        string `json:"version,omitempty"`
+	InformationURI string `json:"informationUri,omitempty"`
+	Rules          []Rule `json:"rules"`
+}
+
+// Rule is a reporting descriptor.
+type Rule struct {
+	ID                   string         `json:"id"`
+	Name                 string         `json:"name,omitempty"`
+	ShortDescription     *Message       `json:"shortDescription,omitempty"`
+	FullDescription      *Message       `json:"fullDescription,omitempty"`
+	Help                 *Message       `json:"help,omitempty"`
+	DefaultConfiguration *Configuration `json:"defaultConfiguration,omitempty"`
+	Properties           RuleProperties `json:"properties"`
+}
+
+// Configuration holds a rule's default level.
+type Configuration struct {
+	Level string `json:"level"`
+}
+
+// RuleProperties are the rule properties GitHub reads: tags, shown as
+// filters, and security-severity, which sets the alert's severity.
+type RuleProperties struct {
+	Tags             []string `json:"tags,omitempty"`
+	SecuritySeverity string   `json:"security-severity,omitempty"`
+}
+
+// Message is a SARIF message.
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Result is one finding.
+type Result struct {
+	RuleID    string     `json:"ruleId"`
+	RuleIndex int        `json:"ruleIndex"`
+	Level     string     `json:"level"`
+	Message   Message    `json:"message"`
+	Locations []Location `json:"locations"`
+	// PartialFingerprints identify the finding across runs, so an alert
+	// is updated rather than reopened when lines move.
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+	Properties          map[string]string `json:"properties,omitempty"`
+}
+
+// Location is where a result was found.
+type Location struct {
+	PhysicalLocation PhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []LogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+// PhysicalLocation is a file and, when known, a line in it.
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+	Region           *Region          `json:"region,omitempty"`
+}
+
+// ArtifactLocation is a file path relative to the repository root.
+type ArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// Region is a 1-based line range.
+type Region struct {
+	StartLine int `json:"startLine"`
+}
+
+// LogicalLocation names the resource a result is about.
+type LogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+// securitySeverities are the CVSS-like scores GitHub maps to alert
+// severities: 9.0 and over is critical, 7.0 high, 4.0 medium, else low.
+var securitySeverities = map[protocol.Severity]string{
+	protocol.SeverityCritical: "9.5",
+	protocol.SeverityHigh:     "8.0",
+	protocol.SeverityMedium:   "5.5",
+	protocol.SeverityLow:      "2.0",
+	protocol.SeverityInfo:     "0.0",
+}
+
+// fingerprintKey names the partial fingerprint results carry.
+const fingerprintKey = "ghcpIacFinding/v1"
+
+// Options configure Build.
+type Options struct {
+	// Path is the file, relative to the repository root, that results are
+	// located in. Empty uses DefaultPath for the IaC format.
+	Path string
+	// Levels maps severities to SARIF levels; nil uses
+	// protocol.DefaultSARIFLevels.
+	Levels protocol.SeverityMapping
+	// ToolVersion is reported as the driver version.
+	ToolVersion string
+}
+
+// DefaultPath is the file name results are located in when the request
+// gives none.
+func DefaultPath(format protocol.SourceFormat) string {
+	switch format {
+	case protocol.FormatBicep:
+		return "main.bicep"
+	case protocol.FormatARM:
+		return "azuredeploy.json"
+	case protocol.FormatTerraformPlan:
+		return "tfplan.json"
+	}
+	return "main.tf"
+}
+
+// Build converts findings on iac into a SARIF log. Native rules carry their
+// title, description and remediation; rules from other sources, such as
+// Azure Policy definitions or advisories, are described by their first
+// finding. Each result is located at the line of the resource it is about,
+// found by type and name among iac's resources.
+func Build(findings []protocol.Finding, iac *protocol.IaCInput, opts Options) Log {
+	levels := opts.Levels
+	if levels == nil {
+		levels = protocol.DefaultSARIFLevels()
+	}
+	path := opts.Path
+	lines := make(map[string]int)
+	if iac != nil {
+		if path == "" {
+			path = DefaultPath(iac.Format)
+		}
+		for _, r := range iac.Resources {
+			if _, ok := lines[r.Type+"."+r.Name]; !ok && r.Line > 0 {
+				lines[r.Type+"."+r.Name] = r.Line
+			}
+		}
+	}
+	if path == "" {
+		path = DefaultPath(protocol.FormatUnknown)
+	}
+
+	native := make(map[string]analyzer.Rule)
+	for _, r := range analyzer.AllRules() {
+		native[r.ID] = r
+	}
+	driver := Driver{Name: ToolName, Version: opts.ToolVersion, Rules: []Rule{}}
+	index := make(map[string]int)
+	results := make([]Result, 0, len(findings))
+	for _, f := range findings {
+		sev := protocol.NormalizeSeverity(string(f.Severity))
+		i, ok := index[f.RuleID]
+		if !ok {
+			i = len(driver.Rules)
+			index[f.RuleID] = i
+			driver.Rules = append(driver.Rules, describe(f, native, levels))
+		}
+		address := f.Resource
+		if f.ResourceType != "" {
+			address = f.ResourceType + "." + f.Resource
+		}
+		loc := Location{
+			PhysicalLocation: PhysicalLocation{ArtifactLocation: ArtifactLocation{URI: path}},
+			LogicalLocations: []LogicalLocation{{FullyQualifiedName: address, Kind: "resource"}},
+		}
+		if line, ok := lines[address]; ok {
+			loc.PhysicalLocation.Region = &Region{StartLine: line}
+		}
+		res := Result{
+			RuleID:              f.RuleID,
+			RuleIndex:           i,
+			Level:               levels.Map(sev),
+			Message:             Message{Text: f.Message},
+			Locations:           []Location{loc},
+			PartialFingerprints: map[string]string{fingerprintKey: fingerprint(path, f)},
+		}
+		if f.Source != "" || f.Confidence != "" {
+			res.Properties = make(map[string]string)
+			if f.Source != "" {
+				res.Properties["source"] = f.Source
+			}
+			if f.Confidence != "" {
+				res.Properties["confidence"] = string(f.Confidence)
+			}
+		}
+		results = append(results, res)
+	}
+	return Log{Schema: Schema, Version: Version, Runs: []Run{{Tool: Tool{Driver: driver}, Results: results}}}
+}
+
+// describe returns the reporting descriptor of f's rule. A rule's severity
+// can be overridden per resource, so the descriptor uses the rule's own
+// severity when it is native and the finding's otherwise.
+func describe(f protocol.Finding, native map[string]analyzer.Rule, levels protocol.SeverityMapping) Rule {
+	sev := protocol.NormalizeSeverity(string(f.Severity))
+	tags := []string{"security"}
+	for _, t := range []string{strings.ToLower(f.Category), f.Source} {
+		if t != "" && t != "security" {
+			tags = append(tags, t)
+		}
+	}
+	rule := Rule{ID: f.RuleID, Name: f.RuleID}
+	if r, ok := native[f.RuleID]; ok {
+		sev = protocol.NormalizeSeverity(string(r.Severity))
+		rule.Name = r.Title
+		rule.ShortDescription = &Message{Text: r.Title}
+		rule.FullDescription = &Message{Text: r.Description}
+		if r.Remediation != "" {
+			rule.Help = &Message{Text: r.Remediation}
+		}
+	} else if f.Remediation != "" {
+		rule.Help = &Message{Text: f.Remediation}
+	}
+	sort.Strings(tags[1:])
+	rule.DefaultConfiguration = &Configuration{Level: levels.Map(sev)}
+	rule.Properties = RuleProperties{Tags: tags, SecuritySeverity: securitySeverities[sev]}
+	return rule
+}
+
+// fingerprint hashes what identifies a finding regardless of line: the
+// file, rule and resource.
+func fingerprint(path string, f protocol.Finding) string {
+	sum := sha256.Sum256([]byte(path + "|" + f.RuleID + "|" + f.ResourceType + "|" + f.Resource))
+	return hex.EncodeToString(sum[:16])
+}
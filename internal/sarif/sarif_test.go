@@ -0,0 +1,91 @@
+package sarif
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+func TestBuild(t *testing.T) {
+	iac := &protocol.IaCInput{
+		Format: protocol.FormatTerraform,
+		Resources: []protocol.Resource{
+			{Type: "azurerm_storage_account", Name: "sa", Line: 4},
+			{Type: "azurerm_key_vault", Name: "kv", Line: 12},
+		},
+	}
+	findings := []protocol.Finding{
+		{RuleID: "POL-001", Category: "Policy", Severity: protocol.SeverityHigh, Resource: "sa", ResourceType: "azurerm_storage_account", Message: "HTTPS not enforced"},
+		{RuleID: "POL-001", Category: "Policy", Severity: protocol.SeverityCritical, Resource: "kv", ResourceType: "azurerm_key_vault", Message: "HTTPS not enforced"},
+		{RuleID: "AVD-AZU-0011", Category: "Security", Severity: "MEDIUM", Resource: "kv", ResourceType: "azurerm_key_vault", Message: "Purge protection off", Remediation: "Enable it", Source: "tfsec", Confidence: protocol.ConfidenceLow},
+		{RuleID: "SEC-006", Category: "Security", Severity: protocol.SeverityHigh, Resource: "conn", ResourceType: "output", Message: "Output exposes a key"},
+	}
+	levels := protocol.SeverityMapping{
+		protocol.SeverityCritical: "error", protocol.SeverityHigh: "warning", protocol.SeverityMedium: "note",
+		protocol.SeverityLow: "note", protocol.SeverityInfo: "none",
+	}
+	log := Build(findings, iac, Options{Path: "infra/main.tf", Levels: levels, ToolVersion: "v1.2.0"})
+
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("log = %+v", log)
+	}
+	run := log.Runs[0]
+	if d := run.Tool.Driver; d.Name != ToolName || d.Version != "v1.2.0" || len(d.Rules) != 3 {
+		t.Fatalf("driver = %+v", d)
+	}
+	pol := run.Tool.Driver.Rules[0]
+	if pol.ID != "POL-001" || pol.ShortDescription == nil || pol.Help == nil || pol.Properties.SecuritySeverity != "8.0" ||
+		pol.DefaultConfiguration.Level != "warning" {
+		t.Errorf("native rule = %+v", pol)
+	}
+	ext := run.Tool.Driver.Rules[1]
+	if ext.ID != "AVD-AZU-0011" || ext.Help.Text != "Enable it" || ext.Properties.SecuritySeverity != "5.5" ||
+		strings.Join(ext.Properties.Tags, ",") != "security,tfsec" {
+		t.Errorf("external rule = %+v", ext)
+	}
+
+	if len(run.Results) != 4 {
+		t.Fatalf("results = %+v", run.Results)
+	}
+	sa, kv := run.Results[0], run.Results[1]
+	if sa.RuleIndex != 0 || sa.Level != "warning" || sa.Locations[0].PhysicalLocation.ArtifactLocation.URI != "infra/main.tf" ||
+		sa.Locations[0].PhysicalLocation.Region.StartLine != 4 || sa.Locations[0].LogicalLocations[0].FullyQualifiedName != "azurerm_storage_account.sa" {
+		t.Errorf("sa result = %+v", sa)
+	}
+	// A per-resource severity override sets the result level, not the rule's.
+	if kv.RuleIndex != 0 || kv.Level != "error" || kv.Locations[0].PhysicalLocation.Region.StartLine != 12 {
+		t.Errorf("kv result = %+v", kv)
+	}
+	if sa.PartialFingerprints[fingerprintKey] == kv.PartialFingerprints[fingerprintKey] {
+		t.Error("distinct findings share a fingerprint")
+	}
+	if r := run.Results[2]; r.Properties["source"] != "tfsec" || r.Properties["confidence"] != "low" || r.Level != "note" {
+		t.Errorf("external result = %+v", r)
+	}
+	if r := run.Results[3]; r.Locations[0].PhysicalLocation.Region != nil {
+		t.Errorf("unlocated result has a region: %+v", r.Locations[0])
+	}
+
+	data, err := json.Marshal(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"$schema":"https://json.schemastore.org/sarif-2.1.0.json"`, `"security-severity":"8.0"`, `"ruleId":"POL-001"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("JSON missing %s", want)
+		}
+	}
+}
+
+func TestBuild_Empty(t *testing.T) {
+	log := Build(nil, &protocol.IaCInput{Format: protocol.FormatBicep}, Options{})
+	data, _ := json.Marshal(log)
+	if !strings.Contains(string(data), `"rules":[]`) || !strings.Contains(string(data), `"results":[]`) {
+		t.Errorf("empty log = %s", data)
+	}
+	if got := DefaultPath(protocol.FormatBicep); got != "main.bicep" {
+		t.Errorf("DefaultPath = %q", got)
+	}
+}
@@ -0,0 +1,161 @@
+package scanner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// tfsec runs `tfsec --format json`.
+type tfsec struct{ tool }
+
+type tfsecOutput struct {
+	Results []struct {
+		RuleID      string `json:"rule_id"`
+		LongID      string `json:"long_id"`
+		Description string `json:"description"`
+		Severity    string `json:"severity"`
+		Resolution  string `json:"resolution"`
+		Resource    string `json:"resource"`
+	} `json:"results"`
+}
+
+func (s *tfsec) Scan(ctx context.Context, dir string) ([]protocol.Finding, error) {
+	out, err := s.output(ctx, "--format", "json", "--no-color", "--soft-fail", dir)
+	if err != nil {
+		return nil, err
+	}
+	var parsed tfsecOutput
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return nil, fmt.Errorf("tfsec: parse output: %w", err)
+	}
+	findings := make([]protocol.Finding, 0, len(parsed.Results))
+	for _, r := range parsed.Results {
+		id := r.LongID
+		if id == "" {
+			id = r.RuleID
+		}
+		resType, name := splitAddress(r.Resource)
+		findings = append(findings, protocol.Finding{
+			RuleID:       id,
+			Category:     "Security",
+			Severity:     protocol.NormalizeSeverity(r.Severity),
+			Resource:     name,
+			ResourceType: resType,
+			Message:      r.Description,
+			Remediation:  r.Resolution,
+		})
+	}
+	return findings, nil
+}
+
+// checkov runs `checkov -d <dir> -o json`.
+type checkov struct{ tool }
+
+type checkovReport struct {
+	Results struct {
+		FailedChecks []struct {
+			CheckID   string  `json:"check_id"`
+			CheckName string  `json:"check_name"`
+			Severity  *string `json:"severity"`
+			Resource  string  `json:"resource"`
+			Guideline string  `json:"guideline"`
+		} `json:"failed_checks"`
+	} `json:"results"`
+}
+
+func (s *checkov) Scan(ctx context.Context, dir string) ([]protocol.Finding, error) {
+	out, err := s.output(ctx, "-d", dir, "-o", "json", "--quiet", "--compact", "--soft-fail")
+	if err != nil {
+		return nil, err
+	}
+	// Checkov emits a single report for one framework and a list otherwise.
+	var reports []checkovReport
+	if err := json.Unmarshal(out, &reports); err != nil {
+		var single checkovReport
+		if err := json.Unmarshal(out, &single); err != nil {
+			return nil, fmt.Errorf("checkov: parse output: %w", err)
+		}
+		reports = []checkovReport{single}
+	}
+	var findings []protocol.Finding
+	for _, rep := range reports {
+		for _, c := range rep.Results.FailedChecks {
+			sev := "medium"
+			if c.Severity != nil {
+				sev = *c.Severity
+			}
+			resType, name := splitAddress(c.Resource)
+			findings = append(findings, protocol.Finding{
+				RuleID:       c.CheckID,
+				Category:     "Security",
+				Severity:     protocol.NormalizeSeverity(sev),
+				Resource:     name,
+				ResourceType: resType,
+				Message:      c.CheckName,
+				Remediation:  c.Guideline,
+			})
+		}
+	}
+	return findings, nil
+}
+
+// trivy runs `trivy config --format json`.
+type trivy struct{ tool }
+
+type trivyOutput struct {
+	Results []struct {
+		Misconfigurations []struct {
+			ID            string `json:"ID"`
+			AVDID         string `json:"AVDID"`
+			Title         string `json:"Title"`
+			Message       string `json:"Message"`
+			Resolution    string `json:"Resolution"`
+			Severity      string `json:"Severity"`
+			Status        string `json:"Status"`
+			CauseMetadata struct {
+				Resource string `json:"Resource"`
+			} `json:"CauseMetadata"`
+		} `json:"Misconfigurations"`
+	} `json:"Results"`
+}
+
+func (s *trivy) Scan(ctx context.Context, dir string) ([]protocol.Finding, error) {
+	out, err := s.output(ctx, "config", "--format", "json", "--quiet", dir)
+	if err != nil {
+		return nil, err
+	}
+	var parsed trivyOutput
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return nil, fmt.Errorf("trivy: parse output: %w", err)
+	}
+	var findings []protocol.Finding
+	for _, r := range parsed.Results {
+		for _, m := range r.Misconfigurations {
+			if m.Status != "" && m.Status != "FAIL" {
+				continue
+			}
+			id := m.AVDID
+			if id == "" {
+				id = m.ID
+			}
+			msg := m.Message
+			if msg == "" {
+				msg = m.Title
+			}
+			resType, name := splitAddress(m.CauseMetadata.Resource)
+			findings = append(findings, protocol.Finding{
+				RuleID:       id,
+				Category:     "Security",
+				Severity:     protocol.NormalizeSeverity(m.Severity),
+				Resource:     name,
+				ResourceType: resType,
+				Message:      msg,
+				Remediation:  m.Resolution,
+			})
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,188 @@
+// Package scanner runs external IaC scanners (tfsec, Checkov, Trivy) when
+// they are installed and converts their output into protocol.Finding values
+// attributed to the originating tool.
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/analyzer"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Scanner is an external IaC scanner.
+type Scanner interface {
+	// Name identifies the tool, e.g. "tfsec".
+	Name() string
+	// Available reports whether the tool can be run on this host.
+	Available() bool
+	// Scan analyzes the IaC files under dir.
+	Scan(ctx context.Context, dir string) ([]protocol.Finding, error)
+}
+
+// Runner executes a command and returns its standard output. Scanners exit
+// non-zero when they find issues, so implementations should return output
+// alongside any *exec.ExitError.
+type Runner func(ctx context.Context, name string, args ...string) ([]byte, error)
+
+// execRunner runs commands on the local host.
+func execRunner(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+// New returns the adapter for a tool name ("tfsec", "checkov" or "trivy").
+func New(name string) (Scanner, error) {
+	return newWithRunner(name, execRunner, lookPath)
+}
+
+func newWithRunner(name string, run Runner, look func(string) bool) (Scanner, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "tfsec":
+		return &tfsec{tool{name: "tfsec", run: run, look: look}}, nil
+	case "checkov":
+		return &checkov{tool{name: "checkov", run: run, look: look}}, nil
+	case "trivy":
+		return &trivy{tool{name: "trivy", run: run, look: look}}, nil
+	default:
+		return nil, fmt.Errorf("unknown scanner %q (want tfsec, checkov or trivy)", name)
+	}
+}
+
+// FromNames builds scanners from a list of tool names.
+func FromNames(names []string) ([]Scanner, error) {
+	var scanners []Scanner
+	for _, n := range names {
+		s, err := New(n)
+		if err != nil {
+			return nil, err
+		}
+		scanners = append(scanners, s)
+	}
+	return scanners, nil
+}
+
+func lookPath(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+type tool struct {
+	name string
+	run  Runner
+	look func(string) bool
+}
+
+func (t tool) Name() string    { return t.name }
+func (t tool) Available() bool { return t.look(t.name) }
+
+// output runs the tool, tolerating the non-zero exit used to signal findings.
+func (t tool) output(ctx context.Context, args ...string) ([]byte, error) {
+	out, err := t.run(ctx, t.name, args...)
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok && len(out) > 0 {
+			return out, nil
+		}
+		return nil, fmt.Errorf("%s: %w", t.name, err)
+	}
+	return out, nil
+}
+
+// Result is the outcome of running one external scanner.
+type Result struct {
+	Scanner  string
+	Findings []protocol.Finding
+	Err      error
+}
+
+// Run writes the IaC input to a temporary directory and runs every available
+// scanner against it. Unavailable scanners are skipped silently.
+func Run(ctx context.Context, scanners []Scanner, iac *protocol.IaCInput) []Result {
+	var available []Scanner
+	for _, s := range scanners {
+		if s.Available() {
+			available = append(available, s)
+		}
+	}
+	if len(available) == 0 || iac == nil {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "iac-scan-*")
+	if err != nil {
+		return []Result{{Scanner: "all", Err: fmt.Errorf("create scan dir: %w", err)}}
+	}
+	defer os.RemoveAll(dir)
+	if err := writeInput(dir, iac); err != nil {
+		return []Result{{Scanner: "all", Err: err}}
+	}
+
+	results := make([]Result, 0, len(available))
+	for _, s := range available {
+		findings, err := s.Scan(ctx, dir)
+		for i := range findings {
+			findings[i].Source = s.Name()
+		}
+		results = append(results, Result{Scanner: s.Name(), Findings: findings, Err: err})
+	}
+	return results
+}
+
+func writeInput(dir string, iac *protocol.IaCInput) error {
+	files := iac.Files
+	if len(files) == 0 {
+		name := "main.tf"
+		if iac.Format == protocol.FormatBicep {
+			name = "main.bicep"
+		}
+		files = []protocol.SourceFile{{Path: name, Content: iac.RawCode}}
+	}
+	for _, f := range files {
+		p := filepath.Join(dir, filepath.FromSlash(filepath.Clean("/"+f.Path)))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return fmt.Errorf("write %s: %w", f.Path, err)
+		}
+		if err := os.WriteFile(p, []byte(f.Content), 0o600); err != nil {
+			return fmt.Errorf("write %s: %w", f.Path, err)
+		}
+	}
+	return nil
+}
+
+// Merge appends external findings to native ones, dropping any external
+// finding whose rule maps to a native rule already reported for the same
+// resource, and duplicates reported by more than one scanner.
+func Merge(native, external []protocol.Finding) []protocol.Finding {
+	seen := make(map[string]bool, len(native))
+	for _, f := range native {
+		seen[f.ResourceType+"."+f.Resource+"|"+f.RuleID] = true
+	}
+	merged := append([]protocol.Finding(nil), native...)
+	for _, f := range external {
+		ruleKey := strings.ToUpper(f.RuleID)
+		if nativeID, ok := analyzer.MapExternalID(f.RuleID); ok {
+			ruleKey = nativeID
+		}
+		key := f.ResourceType + "." + f.Resource + "|" + ruleKey
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		merged = append(merged, f)
+	}
+	return merged
+}
+
+// splitAddress splits a Terraform address such as
+// "module.app.azurerm_storage_account.sa" into type and name.
+func splitAddress(addr string) (string, string) {
+	parts := strings.Split(addr, ".")
+	if len(parts) < 2 {
+		return "", addr
+	}
+	return parts[len(parts)-2], parts[len(parts)-1]
+}
@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+func fakeRunner(output string, seenDir *string) Runner {
+	return func(_ context.Context, _ string, args ...string) ([]byte, error) {
+		for _, a := range args {
+			if _, err := os.Stat(filepath.Join(a, "main.tf")); err == nil && seenDir != nil {
+				*seenDir = a
+			}
+		}
+		return []byte(output), nil
+	}
+}
+
+func always(string) bool { return true }
+
+func TestTfsec_Scan(t *testing.T) {
+	out := `{"results":[{"rule_id":"AVD-AZU-0008","long_id":"azure-storage-enforce-https",
+		"description":"Storage account uses an insecure protocol","severity":"HIGH",
+		"resolution":"Only allow secure connection","resource":"azurerm_storage_account.sa"}]}`
+	s, _ := newWithRunner("tfsec", fakeRunner(out, nil), always)
+	findings, err := s.Scan(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("findings = %d, want 1", len(findings))
+	}
+	f := findings[0]
+	if f.RuleID != "azure-storage-enforce-https" || f.Severity != "high" || f.ResourceType != "azurerm_storage_account" || f.Resource != "sa" {
+		t.Errorf("finding = %+v", f)
+	}
+}
+
+func TestCheckov_ScanListOutput(t *testing.T) {
+	out := `[{"check_type":"terraform","results":{"failed_checks":[
+		{"check_id":"CKV_AZURE_33","check_name":"Ensure Storage logging is enabled for Queue service","severity":null,
+		 "resource":"azurerm_storage_account.sa","guideline":"https://docs.example.com/ckv-azure-33"}]}}]`
+	s, _ := newWithRunner("checkov", fakeRunner(out, nil), always)
+	findings, err := s.Scan(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(findings) != 1 || findings[0].RuleID != "CKV_AZURE_33" || findings[0].Severity != "medium" {
+		t.Errorf("findings = %+v", findings)
+	}
+}
+
+func TestTrivy_Scan(t *testing.T) {
+	out := `{"Results":[{"Misconfigurations":[
+		{"AVDID":"AVD-AZU-0012","Title":"Default network access","Severity":"CRITICAL","Status":"FAIL",
+		 "CauseMetadata":{"Resource":"module.data.azurerm_storage_account.logs"}},
+		{"AVDID":"AVD-AZU-0008","Severity":"HIGH","Status":"PASS"}]}]}`
+	s, _ := newWithRunner("trivy", fakeRunner(out, nil), always)
+	findings, err := s.Scan(context.Background(), t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(findings) != 1 {
+		t.Fatalf("findings = %d, want 1 (PASS results skipped)", len(findings))
+	}
+	if findings[0].Resource != "logs" || findings[0].Severity != "critical" {
+		t.Errorf("finding = %+v", findings[0])
+	}
+}
+
+func TestRun_WritesInputAndAttributesSource(t *testing.T) {
+	var dir string
+	out := `{"results":[{"long_id":"azure-storage-queue-services-logging-enabled","severity":"MEDIUM","resource":"azurerm_storage_account.sa"}]}`
+	s, _ := newWithRunner("tfsec", fakeRunner(out, &dir), always)
+	missing, _ := newWithRunner("checkov", fakeRunner("", nil), func(string) bool { return false })
+
+	iac := &protocol.IaCInput{Format: protocol.FormatTerraform, RawCode: `resource "azurerm_storage_account" "sa" {}`}
+	results := Run(context.Background(), []Scanner{s, missing}, iac)
+	if len(results) != 1 {
+		t.Fatalf("results = %d, want 1 (unavailable scanner skipped)", len(results))
+	}
+	if dir == "" {
+		t.Error("scanner should receive a directory containing main.tf")
+	}
+	if results[0].Findings[0].Source != "tfsec" {
+		t.Errorf("Source = %q, want tfsec", results[0].Findings[0].Source)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("scan directory should be removed after Run")
+	}
+}
+
+func TestMerge_DedupesAgainstNative(t *testing.T) {
+	native := []protocol.Finding{
+		{RuleID: "POL-001", Resource: "sa", ResourceType: "azurerm_storage_account"},
+	}
+	external := []protocol.Finding{
+		{RuleID: "azure-storage-enforce-https", Resource: "sa", ResourceType: "azurerm_storage_account", Source: "tfsec"},
+		{RuleID: "CKV_AZURE_3", Resource: "sa", ResourceType: "azurerm_storage_account", Source: "checkov"},
+		{RuleID: "CKV_AZURE_33", Resource: "sa", ResourceType: "azurerm_storage_account", Source: "checkov"},
+		{RuleID: "CKV_AZURE_33", Resource: "sa", ResourceType: "azurerm_storage_account", Source: "checkov"},
+	}
+	merged := Merge(native, external)
+	if len(merged) != 2 {
+		t.Fatalf("merged = %d, want 2: %+v", len(merged), merged)
+	}
+	if merged[1].RuleID != "CKV_AZURE_33" {
+		t.Errorf("unexpected extra finding %+v", merged[1])
+	}
+}
+
+func TestNew_Unknown(t *testing.T) {
+	if _, err := New("snyk"); err == nil {
+		t.Error("expected error for unknown scanner")
+	}
+}
@@ -0,0 +1,127 @@
+// Package scheduler runs recurring background jobs (e.g. weekly cost digests).
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// NextFunc computes the next run time after the given time.
+type NextFunc func(after time.Time) time.Time
+
+// Every returns a NextFunc that fires at a fixed interval.
+func Every(d time.Duration) NextFunc {
+	return func(after time.Time) time.Time { return after.Add(d) }
+}
+
+// WeeklyAt returns a NextFunc that fires once a week on the given weekday
+// at hour:minute in the location of the input time.
+func WeeklyAt(day time.Weekday, hour, minute int) NextFunc {
+	return func(after time.Time) time.Time {
+		next := time.Date(after.Year(), after.Month(), after.Day(), hour, minute, 0, 0, after.Location())
+		offset := (int(day) - int(next.Weekday()) + 7) % 7
+		next = next.AddDate(0, 0, offset)
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next
+	}
+}
+
+// Job is a named recurring task.
+type Job struct {
+	Name string
+	Next NextFunc
+	Run  func(ctx context.Context)
+}
+
+// Scheduler runs registered jobs until its context is cancelled.
+type Scheduler struct {
+	mu   sync.Mutex
+	jobs []Job
+	ctx  context.Context
+	now  func() time.Time
+	wg   sync.WaitGroup
+}
+
+// New creates an empty Scheduler.
+func New() *Scheduler {
+	return &Scheduler{ctx: context.Background(), now: time.Now}
+}
+
+// Add registers a job. Jobs added after Start are not scheduled.
+func (s *Scheduler) Add(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, job)
+}
+
+// Start launches one goroutine per job. It returns immediately; jobs stop
+// when ctx is cancelled. Use Wait to block until they have exited.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	jobs := append([]Job(nil), s.jobs...)
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	for _, job := range jobs {
+		s.wg.Add(1)
+		go func(job Job) {
+			defer s.wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+}
+
+// After runs a one-off task once d has elapsed. It is cancelled together
+// with the context passed to Start.
+func (s *Scheduler) After(name string, d time.Duration, run func(ctx context.Context)) {
+	s.mu.Lock()
+	ctx := s.ctx
+	s.mu.Unlock()
+
+	job := Job{Name: name, Run: run}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.runOnce(ctx, job)
+	}()
+}
+
+// Wait blocks until all job goroutines have exited.
+func (s *Scheduler) Wait() { s.wg.Wait() }
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	for {
+		next := job.Next(s.now())
+		log.Printf("scheduler: job %q next run at %s", job.Name, next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.runOnce(ctx, job)
+	}
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, job Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("scheduler: job %q panicked: %v", job.Name, r)
+		}
+	}()
+	start := s.now()
+	job.Run(ctx)
+	log.Printf("scheduler: job %q finished in %s", job.Name, time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,104 @@
+package scheduler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWeeklyAt(t *testing.T) {
+	// Wednesday 2025-01-08 10:00 UTC
+	base := time.Date(2025, 1, 8, 10, 0, 0, 0, time.UTC)
+	next := WeeklyAt(time.Monday, 9, 0)(base)
+	want := time.Date(2025, 1, 13, 9, 0, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Errorf("next = %v, want %v", next, want)
+	}
+
+	// Same day but already past the hour → following week.
+	monday := time.Date(2025, 1, 13, 9, 30, 0, 0, time.UTC)
+	next = WeeklyAt(time.Monday, 9, 0)(monday)
+	want = time.Date(2025, 1, 20, 9, 0, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Errorf("next = %v, want %v", next, want)
+	}
+
+	// Same day, before the hour → today.
+	early := time.Date(2025, 1, 13, 8, 0, 0, 0, time.UTC)
+	next = WeeklyAt(time.Monday, 9, 0)(early)
+	want = time.Date(2025, 1, 13, 9, 0, 0, 0, time.UTC)
+	if !next.Equal(want) {
+		t.Errorf("next = %v, want %v", next, want)
+	}
+}
+
+func TestScheduler_RunsAndStops(t *testing.T) {
+	var runs int32
+	s := New()
+	s.Add(Job{
+		Name: "tick",
+		Next: Every(5 * time.Millisecond),
+		Run:  func(context.Context) { atomic.AddInt32(&runs, 1) },
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	deadline := time.After(2 * time.Second)
+	for atomic.LoadInt32(&runs) < 2 {
+		select {
+		case <-deadline:
+			t.Fatal("job did not run twice in time")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	cancel()
+	s.Wait()
+}
+
+func TestScheduler_RecoversPanic(t *testing.T) {
+	var runs int32
+	s := New()
+	s.Add(Job{
+		Name: "panicky",
+		Next: Every(time.Millisecond),
+		Run: func(context.Context) {
+			atomic.AddInt32(&runs, 1)
+			panic("boom")
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	deadline := time.After(2 * time.Second)
+	for atomic.LoadInt32(&runs) < 2 {
+		select {
+		case <-deadline:
+			t.Fatal("job should keep running after a panic")
+		case <-time.After(time.Millisecond):
+		}
+	}
+	cancel()
+	s.Wait()
+}
+
+func TestScheduler_After(t *testing.T) {
+	s := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+
+	done := make(chan struct{})
+	s.After("once", time.Millisecond, func(context.Context) { close(done) })
+	var cancelled int32
+	s.After("later", time.Hour, func(context.Context) { atomic.AddInt32(&cancelled, 1) })
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("one-off task did not run")
+	}
+	cancel()
+	s.Wait()
+	if atomic.LoadInt32(&cancelled) != 0 {
+		t.Error("pending task should not run after cancellation")
+	}
+}
@@ -0,0 +1,363 @@
+// Package semver compares semantic versions and evaluates Terraform version
+// constraints such as "~> 3.1" or ">= 2.1, < 3.0".
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version. Build metadata is dropped.
+type Version struct {
+	Major, Minor, Patch int
+	Prerelease          string
+	// specified is how many numeric components the text gave, which sets
+	// the precision of a "~>" constraint.
+	specified int
+}
+
+var versionRe = regexp.MustCompile(`^v?([0-9]+)(?:\.([0-9]+))?(?:\.([0-9]+))?(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// Parse parses a version of one to three numeric components, with an
+// optional "v" prefix, pre-release and build metadata: "3", "v1.2",
+// "2.0.0-beta.1+exp". Missing components are 0.
+func Parse(s string) (Version, error) {
+	m := versionRe.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+	v := Version{Prerelease: m[4]}
+	for i, p := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		if m[i+1] == "" {
+			break
+		}
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q", s)
+		}
+		*p = n
+		v.specified++
+	}
+	return v, nil
+}
+
+// String formats v as MAJOR.MINOR.PATCH[-PRERELEASE].
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v sorts before, with or after o.
+func (v Version) Compare(o Version) int {
+	for _, d := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return comparePrerelease(v.Prerelease, o.Prerelease)
+}
+
+// Compare orders version strings leniently, for versions that are not
+// strictly semantic: it ignores a "v" prefix and build metadata, compares
+// any number of components, numerically where both are numbers, counts
+// missing components as 0 and sorts a pre-release before its release.
+// "0", which OSV uses for "every version", sorts first.
+func Compare(a, b string) int {
+	a, b = strings.TrimPrefix(a, "v"), strings.TrimPrefix(b, "v")
+	a, _, _ = strings.Cut(a, "+")
+	b, _, _ = strings.Cut(b, "+")
+	coreA, preA, _ := strings.Cut(a, "-")
+	coreB, preB, _ := strings.Cut(b, "-")
+	if c := compareParts(strings.Split(coreA, "."), strings.Split(coreB, ".")); c != 0 {
+		return c
+	}
+	return comparePrerelease(preA, preB)
+}
+
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	return compareParts(strings.Split(a, "."), strings.Split(b, "."))
+}
+
+// compareParts compares dot-separated identifiers, numerically when both
+// are numbers.
+func compareParts(a, b []string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		x, y := "0", "0"
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		nx, errX := strconv.Atoi(x)
+		ny, errY := strconv.Atoi(y)
+		switch {
+		case errX == nil && errY == nil:
+			if nx != ny {
+				if nx < ny {
+					return -1
+				}
+				return 1
+			}
+		case x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Condition is one comparison in a constraint.
+type Condition struct {
+	// Op is one of =, !=, >, >=, <, <= and ~>.
+	Op      string
+	Version Version
+}
+
+// Constraint is a Terraform version constraint: conditions that must all
+// hold.
+type Constraint []Condition
+
+var conditionRe = regexp.MustCompile(`^(=|!=|>=|<=|>|<|~>)?\s*(\S+)$`)
+
+// ParseConstraint parses a Terraform version constraint, conditions
+// separated by commas: "~> 3.0", ">= 2.1, < 3.0", "!= 2.4.1", or a bare
+// version, which means "=".
+func ParseConstraint(s string) (Constraint, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("empty version constraint")
+	}
+	var c Constraint
+	for _, part := range strings.Split(s, ",") {
+		m := conditionRe.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, fmt.Errorf("invalid version constraint %q", strings.TrimSpace(part))
+		}
+		v, err := Parse(m[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %w", strings.TrimSpace(part), err)
+		}
+		op := m[1]
+		if op == "" {
+			op = "="
+		}
+		c = append(c, Condition{Op: op, Version: v})
+	}
+	return c, nil
+}
+
+// String formats c in Terraform syntax.
+func (c Constraint) String() string {
+	parts := make([]string, len(c))
+	for i, cond := range c {
+		parts[i] = cond.Op + " " + cond.Version.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Allows reports whether v satisfies every condition. As in Terraform, a
+// pre-release is only allowed by a condition naming it exactly.
+func (c Constraint) Allows(v Version) bool {
+	if v.Prerelease != "" && !c.names(v) {
+		return false
+	}
+	for _, cond := range c {
+		if cond.Op == "!=" {
+			if v.Compare(cond.Version) == 0 {
+				return false
+			}
+			continue
+		}
+		lo, hi := cond.bounds()
+		if !lo.below(v) || !hi.above(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c Constraint) names(v Version) bool {
+	for _, cond := range c {
+		if cond.Op == "=" && cond.Version.Compare(v) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Bound is one end of a Range. A bound without a version is unbounded.
+type Bound struct {
+	Version   *Version
+	Inclusive bool
+}
+
+// below reports whether v is at or above the lower bound b.
+func (b Bound) below(v Version) bool {
+	if b.Version == nil {
+		return true
+	}
+	c := v.Compare(*b.Version)
+	return c > 0 || (c == 0 && b.Inclusive)
+}
+
+// above reports whether v is at or below the upper bound b.
+func (b Bound) above(v Version) bool {
+	if b.Version == nil {
+		return true
+	}
+	c := v.Compare(*b.Version)
+	return c < 0 || (c == 0 && b.Inclusive)
+}
+
+// bounds returns the range a single condition allows. "~>" allows the
+// last component given to increase: "~> 3.1" is ">= 3.1.0, < 4.0.0" and
+// "~> 3.1.2" is ">= 3.1.2, < 3.2.0"; "~> 3" has no upper bound.
+func (cond Condition) bounds() (lo, hi Bound) {
+	v := cond.Version
+	switch cond.Op {
+	case "=":
+		return Bound{&v, true}, Bound{&v, true}
+	case ">":
+		return Bound{&v, false}, Bound{}
+	case ">=":
+		return Bound{&v, true}, Bound{}
+	case "<":
+		return Bound{}, Bound{&v, false}
+	case "<=":
+		return Bound{}, Bound{&v, true}
+	case "~>":
+		var up *Version
+		switch v.specified {
+		case 2:
+			up = &Version{Major: v.Major + 1}
+		case 3:
+			up = &Version{Major: v.Major, Minor: v.Minor + 1}
+		}
+		return Bound{&v, true}, Bound{Version: up}
+	}
+	return Bound{}, Bound{}
+}
+
+// Range is the interval of versions between a constraint's tightest lower
+// and upper bounds.
+type Range struct {
+	Min, Max Bound
+}
+
+// Range returns the interval c allows, ignoring "!=" exclusions.
+func (c Constraint) Range() Range {
+	var r Range
+	for _, cond := range c {
+		lo, hi := cond.bounds()
+		if lo.Version != nil && (r.Min.Version == nil || tighterMin(lo, r.Min)) {
+			r.Min = lo
+		}
+		if hi.Version != nil && (r.Max.Version == nil || tighterMax(hi, r.Max)) {
+			r.Max = hi
+		}
+	}
+	return r
+}
+
+// tighterMin reports whether the lower bound a excludes versions b allows.
+func tighterMin(a, b Bound) bool {
+	c := a.Version.Compare(*b.Version)
+	return c > 0 || (c == 0 && !a.Inclusive && b.Inclusive)
+}
+
+// tighterMax reports whether the upper bound a excludes versions b allows.
+func tighterMax(a, b Bound) bool {
+	c := a.Version.Compare(*b.Version)
+	return c < 0 || (c == 0 && !a.Inclusive && b.Inclusive)
+}
+
+// Empty reports whether no version lies in r, e.g. ">= 3.0, < 2.0".
+func (r Range) Empty() bool {
+	if r.Min.Version == nil || r.Max.Version == nil {
+		return false
+	}
+	c := r.Min.Version.Compare(*r.Max.Version)
+	return c > 0 || (c == 0 && !(r.Min.Inclusive && r.Max.Inclusive))
+}
+
+// Within reports whether every version in r is also in o.
+func (r Range) Within(o Range) bool {
+	if o.Min.Version != nil && (r.Min.Version == nil || tighterMin(o.Min, r.Min)) {
+		return false
+	}
+	if o.Max.Version != nil && (r.Max.Version == nil || tighterMax(o.Max, r.Max)) {
+		return false
+	}
+	return true
+}
+
+// Overlaps reports whether some version is in both r and o.
+func (r Range) Overlaps(o Range) bool {
+	both := r
+	if o.Min.Version != nil && (both.Min.Version == nil || tighterMin(o.Min, both.Min)) {
+		both.Min = o.Min
+	}
+	if o.Max.Version != nil && (both.Max.Version == nil || tighterMax(o.Max, both.Max)) {
+		both.Max = o.Max
+	}
+	return !both.Empty()
+}
+
+// String formats r as a constraint, or "any" when it is unbounded.
+func (r Range) String() string {
+	var parts []string
+	if b := r.Min; b.Version != nil {
+		op := ">"
+		if b.Inclusive {
+			op = ">="
+		}
+		parts = append(parts, op+" "+b.Version.String())
+	}
+	if b := r.Max; b.Version != nil {
+		op := "<"
+		if b.Inclusive {
+			op = "<="
+		}
+		parts = append(parts, op+" "+b.Version.String())
+	}
+	if r.Min.Version != nil && r.Max.Version != nil && r.Min.Inclusive && r.Max.Inclusive && r.Min.Version.Compare(*r.Max.Version) == 0 {
+		return "= " + r.Min.Version.String()
+	}
+	if len(parts) == 0 {
+		return "any"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Lowest returns the lowest version c allows: its lower bound, or the
+// next patch release after it for ">". ok is false when c has no lower
+// bound.
+func (c Constraint) Lowest() (Version, bool) {
+	lo := c.Range().Min
+	if lo.Version == nil {
+		return Version{}, false
+	}
+	v := *lo.Version
+	if !lo.Inclusive {
+		v = Version{Major: v.Major, Minor: v.Minor, Patch: v.Patch + 1, specified: 3}
+	}
+	return v, true
+}
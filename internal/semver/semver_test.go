@@ -0,0 +1,138 @@
+package semver
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"3.1.0", "3.1", 0},
+		{"v1.10.0", "1.9.9", 1},
+		{"10.0.0", "9.0.0", 1},
+		{"2.0.0-beta.2", "2.0.0-beta.10", -1},
+		{"2.0.0-rc1", "2.0.0", -1},
+		{"0", "0.0.1", -1},
+		{"1.2.3+build", "1.2.3", 0},
+	} {
+		if got := Compare(tc.a, tc.b); got != tc.want {
+			t.Errorf("Compare(%s, %s) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	v, err := Parse("v2.10-rc.1+build.5")
+	if err != nil || v.String() != "2.10.0-rc.1" {
+		t.Errorf("Parse = %v, %v", v, err)
+	}
+	for _, bad := range []string{"", "main", "1.2.3.4", "1.x"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) should fail", bad)
+		}
+	}
+}
+
+func TestConstraint_Allows(t *testing.T) {
+	for _, tc := range []struct {
+		constraint string
+		allowed    []string
+		denied     []string
+	}{
+		{"~> 3.0", []string{"3.0.0", "3.9.12"}, []string{"2.9.9", "4.0.0", "10.0.0"}},
+		{"~> 3.1.2", []string{"3.1.2", "3.1.9"}, []string{"3.1.1", "3.2.0"}},
+		{"~> 3", []string{"3.0.0", "12.0.0"}, []string{"2.0.0"}},
+		{">= 2.1, < 3.0", []string{"2.1.0", "2.99.0"}, []string{"2.0.9", "3.0.0"}},
+		{">= 9.0.0", []string{"10.0.0"}, []string{"8.10.0"}},
+		{"> 1.2, != 1.4.0, <= 2", []string{"1.2.1", "2.0.0"}, []string{"1.2.0", "1.4.0", "2.0.1"}},
+		{"2.0.0", []string{"2.0.0"}, []string{"2.0.1", "2.0.0-rc.1"}},
+		{"2.0.0-rc.1", []string{"2.0.0-rc.1"}, []string{"2.0.0"}},
+		{">= 1.0", nil, []string{"1.5.0-beta"}},
+	} {
+		c, err := ParseConstraint(tc.constraint)
+		if err != nil {
+			t.Fatalf("ParseConstraint(%q): %v", tc.constraint, err)
+		}
+		for _, v := range tc.allowed {
+			if !c.Allows(mustParse(t, v)) {
+				t.Errorf("%q should allow %s", tc.constraint, v)
+			}
+		}
+		for _, v := range tc.denied {
+			if c.Allows(mustParse(t, v)) {
+				t.Errorf("%q should not allow %s", tc.constraint, v)
+			}
+		}
+	}
+	for _, bad := range []string{"", "main", "~>", ">= 1.0,", "=> 1.0"} {
+		if _, err := ParseConstraint(bad); err == nil {
+			t.Errorf("ParseConstraint(%q) should fail", bad)
+		}
+	}
+}
+
+func TestConstraint_Range(t *testing.T) {
+	for constraint, want := range map[string]string{
+		"~> 3.1":               ">= 3.1.0, < 4.0.0",
+		">= 2.1, < 3.0, > 2.5": "> 2.5.0, < 3.0.0",
+		"= 1.2.3":              "= 1.2.3",
+		"!= 1.0":               "any",
+	} {
+		if got := mustConstraint(t, constraint).Range().String(); got != want {
+			t.Errorf("%q: range = %q, want %q", constraint, got, want)
+		}
+	}
+	if !mustConstraint(t, ">= 3.0, < 2.0").Range().Empty() || !mustConstraint(t, "> 2.0, <= 2.0").Range().Empty() {
+		t.Error("contradictory constraints should be empty")
+	}
+
+	approved := mustConstraint(t, "~> 3.0").Range()
+	for constraint, want := range map[string][2]bool{
+		"~> 3.2":         {true, true},
+		">= 3.1, < 3.5":  {true, true},
+		">= 3.0":         {false, true},
+		"~> 2.0":         {false, false},
+		">= 2.5, < 3.1":  {false, true},
+		"= 4.0.0":        {false, false},
+		"> 2.9, <= 3.99": {false, true},
+	} {
+		r := mustConstraint(t, constraint).Range()
+		if r.Within(approved) != want[0] || r.Overlaps(approved) != want[1] {
+			t.Errorf("%q: within = %v, overlaps = %v; want %v", constraint, r.Within(approved), r.Overlaps(approved), want)
+		}
+	}
+}
+
+func TestConstraint_Lowest(t *testing.T) {
+	for constraint, want := range map[string]string{
+		"~> 3.1":        "3.1.0",
+		">= 3.0, < 4.0": "3.0.0",
+		"3.2.1":         "3.2.1",
+		"> 3.2":         "3.2.1",
+		"v1.4.0":        "1.4.0",
+		"< 4.0":         "",
+	} {
+		v, ok := mustConstraint(t, constraint).Lowest()
+		if got := v.String(); ok != (want != "") || (ok && got != want) {
+			t.Errorf("Lowest(%q) = %q, %v; want %q", constraint, got, ok, want)
+		}
+	}
+}
+
+func mustParse(t *testing.T, s string) Version {
+	t.Helper()
+	v, err := Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func mustConstraint(t *testing.T, s string) Constraint {
+	t.Helper()
+	c, err := ParseConstraint(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
@@ -0,0 +1,262 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Idempotency headers. A request carrying IdempotencyKeyHeader, or a
+// GitHub webhook redelivery carrying the same DeliveryHeader, gets the
+// response of the first request with that key rather than running again.
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	DeliveryHeader       = "X-GitHub-Delivery"
+	// ReplayedHeader is set on responses replayed from the store.
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+// maxIdempotencyKey bounds the length of keys the store accepts.
+const maxIdempotencyKey = 255
+
+// Store limits: responses with bodies over maxIdempotentResponse bytes are
+// not kept, and at most maxIdempotencyEntries keys are, evicting the
+// oldest completed ones first.
+const (
+	maxIdempotentResponse = 1 << 20
+	maxIdempotencyEntries = 10000
+)
+
+// credentialHeaders identify the caller. Keys are scoped to a hash of
+// their values, so one caller cannot replay another's response.
+var credentialHeaders = []string{"Authorization", "X-GitHub-Token", "X-Hub-Signature-256"}
+
+// IdempotencyStore remembers the responses of side-effecting requests by
+// idempotency key for a window, so that retried requests are answered
+// from it instead of sending an alert, approving or promoting twice.
+type IdempotencyStore struct {
+	mu          sync.Mutex
+	ttl         time.Duration
+	entries     map[string]*idempotentResponse
+	order       *list.List // of keys, oldest first
+	maxEntries  int
+	maxResponse int
+	now         func() time.Time
+}
+
+// idempotentResponse is a stored response. done is closed once the first
+// request has finished writing it.
+type idempotentResponse struct {
+	elem        *list.Element
+	fingerprint [sha256.Size]byte
+	done        chan struct{}
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+// NewIdempotencyStore creates a store keeping responses for ttl.
+func NewIdempotencyStore(ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		ttl:         ttl,
+		entries:     make(map[string]*idempotentResponse),
+		order:       list.New(),
+		maxEntries:  maxIdempotencyEntries,
+		maxResponse: maxIdempotentResponse,
+		now:         time.Now,
+	}
+}
+
+// Len returns the number of keys stored.
+func (s *IdempotencyStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// errIdempotencyFull is returned by begin when every stored key is still
+// in progress and none can be evicted.
+var errIdempotencyFull = errors.New("idempotency store is full")
+
+// begin looks key up. It returns the stored response when there is one,
+// or else records a pending one for the caller to complete and returns
+// it with started set. Expired entries are dropped when looked up and
+// from the oldest end as new ones are added; the oldest completed entry
+// is evicted when the store is full.
+func (s *IdempotencyStore) begin(key string, fingerprint [sha256.Size]byte) (resp *idempotentResponse, started bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if e, ok := s.entries[key]; ok {
+		if !e.expired(now) {
+			return e, false, nil
+		}
+		s.remove(key, e)
+	}
+	for el := s.order.Front(); el != nil; {
+		k := el.Value.(string)
+		e := s.entries[k]
+		if !e.expired(now) && (len(s.entries) < s.maxEntries || e.expires.IsZero()) {
+			break
+		}
+		el = el.Next()
+		s.remove(k, e)
+	}
+	if len(s.entries) >= s.maxEntries {
+		return nil, false, errIdempotencyFull
+	}
+	e := &idempotentResponse{fingerprint: fingerprint, done: make(chan struct{})}
+	e.elem = s.order.PushBack(key)
+	s.entries[key] = e
+	return e, true, nil
+}
+
+// expired reports whether a completed response has outlived its window.
+func (e *idempotentResponse) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+// remove forgets key. The caller holds s.mu.
+func (s *IdempotencyStore) remove(key string, e *idempotentResponse) {
+	s.order.Remove(e.elem)
+	delete(s.entries, key)
+}
+
+// finish stores a completed response, or forgets the key when the request
+// failed on the server side, so a retry runs it again, or when its body
+// was too large to keep.
+func (s *IdempotencyStore) finish(key string, e *idempotentResponse, status int, header http.Header, body []byte, truncated bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests || truncated {
+		if s.entries[key] == e {
+			s.remove(key, e)
+		}
+	} else {
+		e.status, e.header, e.body = status, header, body
+		e.expires = s.now().Add(s.ttl)
+	}
+	close(e.done)
+}
+
+// Idempotency answers repeated POST, PUT and DELETE requests that carry
+// the same idempotency key with the stored response of the first one.
+// Keys are scoped to the method, the path and a hash of the caller's
+// credential headers. Reusing a key for a different body is rejected with
+// 422, and a retry arriving while the first request still runs gets 409.
+// Responses with a 5xx or 429 status, or a body too large to keep, are
+// not stored, and a store full of requests in progress answers 503.
+// Bodies are read to fingerprint them only up to maxBody bytes; larger
+// ones are rejected with 413. A nil store disables the middleware.
+func Idempotency(store *IdempotencyStore, maxBody int64) Middleware {
+	return func(next http.Handler) http.Handler {
+		if store == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				key = r.Header.Get(DeliveryHeader)
+			}
+			if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKey {
+				http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+				return
+			}
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			fingerprint := sha256.Sum256(append([]byte(r.URL.RawQuery+"\n"), body...))
+
+			scoped := r.Method + " " + r.URL.Path + " " + credential(r) + " " + key
+			e, started, err := store.begin(scoped, fingerprint)
+			if err != nil {
+				http.Error(w, "Too many requests in progress", http.StatusServiceUnavailable)
+				return
+			}
+			if !started {
+				select {
+				case <-e.done:
+				default:
+					http.Error(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+					return
+				}
+				if e.fingerprint != fingerprint {
+					http.Error(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+					return
+				}
+				for k, v := range e.header {
+					w.Header()[k] = v
+				}
+				w.Header().Set(ReplayedHeader, "true")
+				w.WriteHeader(e.status)
+				w.Write(e.body)
+				return
+			}
+
+			rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK, limit: store.maxResponse}
+			defer func() {
+				store.finish(scoped, e, rec.status, w.Header().Clone(), rec.body.Bytes(), rec.truncated)
+			}()
+			next.ServeHTTP(rec, r)
+		})
+	}
+}
+
+// credential hashes the caller's credential headers.
+func credential(r *http.Request) string {
+	h := sha256.New()
+	for _, name := range credentialHeaders {
+		io.WriteString(h, r.Header.Get(name)+"\n")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder passes a response through while keeping a copy of its
+// status and of up to limit bytes of its body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.body.Len()+len(p) > r.limit {
+		r.truncated = true
+	} else if !r.truncated {
+		r.body.Write(p)
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+// Flush forwards to the underlying writer so SSE streaming keeps working.
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"strings"
+)
+
+// Listen opens the server listener. addr is either a TCP address such as
+// ":8080" or a unix socket written as "unix:/run/ghcp/agent.sock", for
+// sidecar deployments that must not bind a routable port. A stale socket
+// file from a previous run is removed, and the new one is made
+// group-accessible (0660) so a sidecar in the same group can connect.
+func Listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
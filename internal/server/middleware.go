@@ -0,0 +1,283 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Middleware wraps an http.Handler with additional behavior.
+type Middleware func(http.Handler) http.Handler
+
+// Chain applies middlewares so that the first one listed is the outermost.
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// statusRecorder captures the response status code for logging.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Flush forwards to the underlying writer so SSE streaming keeps working.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// RequestLogger logs method, path, status, and duration for every request,
+// with the client address ClientAddress resolved when it runs first.
+func RequestLogger() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			log.Printf("%s %s %d %s client=%s", r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond), ClientIP(r))
+		})
+	}
+}
+
+// CORS adds cross-origin headers for the allowed origins and answers preflight requests.
+// An origin of "*" allows any origin.
+func CORS(allowedOrigins []string) Middleware {
+	allowAll := false
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, o := range allowedOrigins {
+		if o == "*" {
+			allowAll = true
+		}
+		allowed[o] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin != "" && (allowAll || allowed[origin]) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-GitHub-Token, X-Hub-Signature-256, Idempotency-Key")
+				w.Header().Add("Vary", "Origin")
+			}
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RateLimit applies a per-client token bucket allowing rps requests per second
+// with the given burst. Clients are told apart as IPAllowlist does, honoring
+// X-Forwarded-For only for hops added by trustedProxies, so a spoofed header
+// doesn't get a fresh bucket. A non-positive rps disables limiting.
+func RateLimit(rps float64, burst int, trustedProxies []*net.IPNet) Middleware {
+	if rps <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	limiter := newRateLimiter(rps, burst)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := peerIP(r)
+			if ip := trustedClientIP(r, trustedProxies); ip != nil {
+				key = ip.String()
+			}
+			if !limiter.allow(key, time.Now()) {
+				w.Header().Set("Retry-After", strconv.Itoa(int(1/rps)+1))
+				http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	rps     float64
+	burst   float64
+	buckets map[string]*bucket
+}
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	return &rateLimiter{rps: rps, burst: float64(burst), buckets: make(map[string]*bucket)}
+}
+
+func (l *rateLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		// Evict idle buckets opportunistically to bound memory.
+		if len(l.buckets) > 10000 {
+			for k, v := range l.buckets {
+				if now.Sub(v.last) > time.Minute {
+					delete(l.buckets, k)
+				}
+			}
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rps
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// ParseCIDRs parses CIDR ranges; bare addresses are treated as single-host
+// ranges (/32 or /128).
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP or CIDR %q", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", v)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// IPAllowlist rejects requests whose client address is outside allowed with
+// 403. X-Forwarded-For is only honored for hops added by trustedProxies,
+// so clients can't spoof their way in. Requests over a unix
+// socket are local and always allowed, as is GET /health for container
+// probes. An empty allowlist disables the check.
+func IPAllowlist(allowed, trustedProxies []*net.IPNet) Middleware {
+	if len(allowed) == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/health" || isUnixSocket(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ip := trustedClientIP(r, trustedProxies)
+			if ip == nil || !containsIP(allowed, ip) {
+				log.Printf("Rejected %s %s from %s: not in IP allowlist", r.Method, r.URL.Path, ClientIP(r))
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// trustedClientIP walks X-Forwarded-For from the right while the hop is a
+// trusted proxy and returns the first untrusted address. Entries further
+// left were supplied by the client and can't be trusted.
+func trustedClientIP(r *http.Request, trustedProxies []*net.IPNet) net.IP {
+	ip := net.ParseIP(peerIP(r))
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0 && ip != nil && containsIP(trustedProxies, ip); i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop
+	}
+	return ip
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func isUnixSocket(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
+
+// peerIP returns the address of the direct TCP peer, ignoring forwarding
+// headers.
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientIPKey is the context key ClientAddress stores the resolved client
+// address under.
+type clientIPKey struct{}
+
+// ClientAddress resolves the originating client address once, honoring
+// X-Forwarded-For only for hops added by trustedProxies as IPAllowlist
+// does, for ClientIP to report in logs and audit lines.
+func ClientAddress(trustedProxies []*net.IPNet) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip := trustedClientIP(r, trustedProxies); ip != nil {
+				r = r.WithContext(context.WithValue(r.Context(), clientIPKey{}, ip.String()))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the client address ClientAddress resolved, or else the
+// direct peer. X-Forwarded-For is never read here, so callers cannot put
+// another address in the log.
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return peerIP(r)
+}
@@ -0,0 +1,399 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func TestChain_Order(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := Chain(okHandler, mw("a"), mw("b"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if len(order) != 2 || order[0] != "a" || order[1] != "b" {
+		t.Errorf("order = %v, want [a b]", order)
+	}
+}
+
+func TestCORS_AllowedOrigin(t *testing.T) {
+	h := CORS([]string{"https://app.example.com"})(okHandler)
+
+	req := httptest.NewRequest(http.MethodPost, "/agent", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Allow-Origin = %q, want origin echoed", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/agent", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Allow-Origin = %q, want empty for disallowed origin", got)
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	h := CORS([]string{"*"})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		t.Error("preflight should not reach the next handler")
+	}))
+	req := httptest.NewRequest(http.MethodOptions, "/agent", nil)
+	req.Header.Set("Origin", "https://any.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("status = %d, want 204", rr.Code)
+	}
+}
+
+func TestRateLimit_RejectsBurst(t *testing.T) {
+	h := RateLimit(1, 2, nil)(okHandler)
+	codes := make([]int, 3)
+	for i := range codes {
+		req := httptest.NewRequest(http.MethodPost, "/agent", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		codes[i] = rr.Code
+	}
+	if codes[0] != 200 || codes[1] != 200 || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("codes = %v, want [200 200 429]", codes)
+	}
+}
+
+func TestRateLimit_IgnoresSpoofedForwardedFor(t *testing.T) {
+	proxies, _ := ParseCIDRs([]string{"10.0.0.0/8"})
+	h := RateLimit(1, 1, proxies)(okHandler)
+	send := func(peer, xff string) int {
+		req := httptest.NewRequest(http.MethodPost, "/agent", nil)
+		req.RemoteAddr = peer
+		if xff != "" {
+			req.Header.Set("X-Forwarded-For", xff)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	// A direct client making up a new forwarded address per request.
+	if send("203.0.113.5:1234", "198.51.100.1") != http.StatusOK || send("203.0.113.5:1234", "198.51.100.2") != http.StatusTooManyRequests {
+		t.Error("a spoofed X-Forwarded-For from an untrusted peer should not reset the bucket")
+	}
+	// Behind a trusted proxy, only its own hop counts; earlier entries are
+	// the client's.
+	if send("10.0.0.1:1234", "1.1.1.1, 192.0.2.7") != http.StatusOK || send("10.0.0.1:1234", "2.2.2.2, 192.0.2.7") != http.StatusTooManyRequests {
+		t.Error("client-supplied X-Forwarded-For entries should not reset the bucket")
+	}
+	if send("10.0.0.1:1234", "192.0.2.8") != http.StatusOK {
+		t.Error("a different client behind the trusted proxy should get its own bucket")
+	}
+}
+
+func TestRateLimit_Disabled(t *testing.T) {
+	h := RateLimit(0, 0, nil)(okHandler)
+	for i := 0; i < 50; i++ {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/agent", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("request %d: status = %d, want 200", i, rr.Code)
+		}
+	}
+}
+
+func TestRateLimiter_Refill(t *testing.T) {
+	l := newRateLimiter(10, 1)
+	now := time.Now()
+	if !l.allow("k", now) {
+		t.Fatal("first request should be allowed")
+	}
+	if l.allow("k", now) {
+		t.Fatal("second immediate request should be denied")
+	}
+	if !l.allow("k", now.Add(150*time.Millisecond)) {
+		t.Error("request after refill should be allowed")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, _ := ParseCIDRs([]string{"10.0.0.0/8"})
+	var got string
+	h := ClientAddress(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { got = ClientIP(r) }))
+	resolve := func(peer, fwd string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = peer + ":5555"
+		if fwd != "" {
+			req.Header.Set("X-Forwarded-For", fwd)
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		return got
+	}
+
+	if ip := resolve("192.168.1.5", ""); ip != "192.168.1.5" {
+		t.Errorf("ClientIP = %q, want the peer 192.168.1.5", ip)
+	}
+	if ip := resolve("10.0.0.1", "198.51.100.9, 203.0.113.7"); ip != "203.0.113.7" {
+		t.Errorf("ClientIP = %q, want 203.0.113.7 as added by the trusted proxy", ip)
+	}
+	if ip := resolve("192.168.1.5", "203.0.113.7"); ip != "192.168.1.5" {
+		t.Errorf("ClientIP = %q, want a spoofed X-Forwarded-For ignored", ip)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.168.1.5:5555"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	if ip := ClientIP(req); ip != "192.168.1.5" {
+		t.Errorf("ClientIP without ClientAddress = %q, want the peer", ip)
+	}
+}
+
+func TestIPAllowlist(t *testing.T) {
+	allowed, err := ParseCIDRs([]string{"10.0.0.0/8", "192.168.1.5"})
+	if err != nil {
+		t.Fatalf("ParseCIDRs: %v", err)
+	}
+	proxies, _ := ParseCIDRs([]string{"172.16.0.1"})
+	h := IPAllowlist(allowed, proxies)(okHandler)
+
+	cases := []struct {
+		name, remote, xff, path string
+		want                    int
+	}{
+		{"allowed range", "10.1.2.3:5000", "", "/agent", http.StatusOK},
+		{"allowed host", "192.168.1.5:5000", "", "/agent", http.StatusOK},
+		{"outside", "203.0.113.9:5000", "", "/agent", http.StatusForbidden},
+		{"spoofed header from untrusted peer", "203.0.113.9:5000", "10.0.0.1", "/agent", http.StatusForbidden},
+		{"forwarded by trusted proxy", "172.16.0.1:5000", "10.0.0.7", "/agent", http.StatusOK},
+		{"client-prefixed header via proxy", "172.16.0.1:5000", "10.0.0.7, 203.0.113.9", "/agent", http.StatusForbidden},
+		{"health probe", "203.0.113.9:5000", "", "/health", http.StatusOK},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, tc.path, nil)
+		req.RemoteAddr = tc.remote
+		if tc.xff != "" {
+			req.Header.Set("X-Forwarded-For", tc.xff)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d", tc.name, rr.Code, tc.want)
+		}
+	}
+
+	if _, err := ParseCIDRs([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("ParseCIDRs should reject an invalid prefix")
+	}
+}
+
+func TestListen_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	srv := &http.Server{Handler: IPAllowlist([]*net.IPNet{{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)}}, nil)(okHandler)}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://agent/agent")
+	if err != nil {
+		t.Fatalf("GET over unix socket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want unix socket peers allowed", resp.StatusCode)
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	store := NewIdempotencyStore(time.Hour)
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	runs := 0
+	h := Idempotency(store, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		runs++
+		w.Header().Set("X-Job-ID", "job-1")
+		if r.URL.Path == "/fail" {
+			http.Error(w, "upstream down", http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("sent"))
+	}))
+	send := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := send("/agent/notification", "k1", `{"a":1}`)
+	again := send("/agent/notification", "k1", `{"a":1}`)
+	if runs != 1 || again.Code != http.StatusCreated || again.Body.String() != "sent" || again.Header().Get("X-Job-ID") != "job-1" || again.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("replay = %d %q %v after %d run(s)", again.Code, again.Body, again.Header(), runs)
+	}
+	if first.Header().Get(ReplayedHeader) != "" {
+		t.Error("first response marked as replayed")
+	}
+	if rr := send("/agent/notification", "k1", `{"a":2}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key with another body = %d", rr.Code)
+	}
+	if send("/agent/deploy", "k1", `{"a":1}`); runs != 2 {
+		t.Errorf("key should be scoped to the path; runs = %d", runs)
+	}
+	if send("/agent/notification", "", `{"a":1}`); runs != 3 {
+		t.Errorf("request without a key should run; runs = %d", runs)
+	}
+
+	send("/fail", "k2", "")
+	send("/fail", "k2", "")
+	if runs != 5 {
+		t.Errorf("server errors should not be stored; runs = %d", runs)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if send("/agent/notification", "k1", `{"a":1}`); runs != 6 || store.Len() != 1 {
+		t.Errorf("expired key should run again; runs = %d, stored = %d", runs, store.Len())
+	}
+}
+
+func TestIdempotency_LimitsBody(t *testing.T) {
+	store := NewIdempotencyStore(time.Hour)
+	runs := 0
+	h := Idempotency(store, 16)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { runs++ }))
+	req := httptest.NewRequest(http.MethodPost, "/agent/deploy", strings.NewReader(strings.Repeat("x", 17)))
+	req.Header.Set(IdempotencyKeyHeader, "k1")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge || runs != 0 || store.Len() != 0 {
+		t.Errorf("oversized body = %d after %d run(s), %d stored", rr.Code, runs, store.Len())
+	}
+}
+
+func TestIdempotency_ScopedToCaller(t *testing.T) {
+	store := NewIdempotencyStore(time.Hour)
+	runs := 0
+	h := Idempotency(store, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		runs++
+		w.Write([]byte(r.Header.Get("X-GitHub-Token")))
+	}))
+	send := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/agent/deploy", strings.NewReader(`{"a":1}`))
+		req.Header.Set(IdempotencyKeyHeader, "k1")
+		req.Header.Set("X-GitHub-Token", token)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+	send("alice")
+	if rr := send("mallory"); runs != 2 || rr.Body.String() != "mallory" || rr.Header().Get(ReplayedHeader) != "" {
+		t.Errorf("another caller's key = %q replayed=%q after %d run(s)", rr.Body, rr.Header().Get(ReplayedHeader), runs)
+	}
+	if rr := send("alice"); runs != 2 || rr.Body.String() != "alice" {
+		t.Errorf("same caller's retry = %q after %d run(s)", rr.Body, runs)
+	}
+}
+
+func TestIdempotency_Limits(t *testing.T) {
+	store := NewIdempotencyStore(time.Hour)
+	store.maxEntries, store.maxResponse = 2, 8
+	runs := 0
+	h := Idempotency(store, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		runs++
+		w.Write([]byte(r.URL.Query().Get("body")))
+	}))
+	send := func(target, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		req.Header.Set(IdempotencyKeyHeader, key)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	send("/big?body=0123456789", "big")
+	if rr := send("/big?body=0123456789", "big"); runs != 2 || rr.Body.String() != "0123456789" || store.Len() != 0 {
+		t.Errorf("oversized response should not be stored; runs = %d, stored = %d", runs, store.Len())
+	}
+
+	for _, key := range []string{"k1", "k2", "k3"} {
+		send("/small", key)
+	}
+	if store.Len() != 2 {
+		t.Errorf("stored = %d, want the cap of 2", store.Len())
+	}
+	if send("/small", "k1"); runs != 6 {
+		t.Errorf("oldest key should have been evicted; runs = %d", runs)
+	}
+
+	store = NewIdempotencyStore(time.Hour)
+	store.maxEntries = 1
+	release := make(chan struct{})
+	h = Idempotency(store, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { <-release }))
+	done := make(chan struct{})
+	go func() {
+		send("/slow", "s1")
+		close(done)
+	}()
+	for store.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if rr := send("/slow", "s2"); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("store full of requests in progress = %d, want 503", rr.Code)
+	}
+	close(release)
+	<-done
+}
+
+func TestIdempotency_InProgress(t *testing.T) {
+	store := NewIdempotencyStore(time.Hour)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	h := Idempotency(store, 1<<20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	req := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/agent/deploy", nil)
+		r.Header.Set(DeliveryHeader, "delivery-1")
+		return r
+	}
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(httptest.NewRecorder(), req())
+		close(done)
+	}()
+	<-started
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req())
+	if rr.Code != http.StatusConflict {
+		t.Errorf("concurrent retry = %d, want 409", rr.Code)
+	}
+	close(release)
+	<-done
+}
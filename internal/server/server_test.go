@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/verdict"
 )
 
 func TestNewSSEWriter(t *testing.T) {
@@ -103,5 +104,77 @@ func TestSSEWriter_SendConfirmation(t *testing.T) {
 	}
 }
 
+func TestSSEWriter_ReportProgress(t *testing.T) {
+	rr := httptest.NewRecorder()
+	sse := NewSSEWriter(rr)
+	protocol.ReportProgress(sse, "policy", 1, 4)
+	if strings.Contains(rr.Body.String(), "event: progress") {
+		t.Error("progress events should be off unless enabled")
+	}
+
+	sse.EnableProgress()
+	protocol.ReportProgress(sse, "policy", 1, 4)
+	body := rr.Body.String()
+	if !strings.Contains(body, "event: progress") {
+		t.Error("ReportProgress should write progress event when enabled")
+	}
+	if !strings.Contains(body, `"stage":"policy","current":1,"total":4,"percent":25`) {
+		t.Errorf("unexpected progress payload: %s", body)
+	}
+}
+
+func TestSSEWriter_SendCancelled(t *testing.T) {
+	rr := httptest.NewRecorder()
+	sse := NewSSEWriter(rr)
+	sse.EnableProgress()
+	sse.SendCancelled("abc123")
+	body := rr.Body.String()
+	if !strings.Contains(body, "cancelled by an operator") {
+		t.Error("SendCancelled should tell the chat the job was cancelled")
+	}
+	if !strings.Contains(body, "event: job_cancelled\ndata: {\"id\":\"abc123\"}") {
+		t.Errorf("missing job_cancelled event: %s", body)
+	}
+}
+
+func TestSSEWriter_SendVerdict(t *testing.T) {
+	rr := httptest.NewRecorder()
+	sse := NewSSEWriter(rr)
+	sse.EnableProgress()
+	sse.SendVerdict(verdict.DefaultPolicy())
+	if strings.Contains(rr.Body.String(), "event: verdict") {
+		t.Error("verdict event sent without reported findings")
+	}
+
+	protocol.ReportFindings(sse, "policy", []protocol.Finding{{RuleID: "POL-001", Severity: protocol.SeverityHigh}})
+	protocol.ReportFindings(sse, "security", nil)
+	sse.SendVerdict(verdict.DefaultPolicy())
+	body := rr.Body.String()
+	for _, want := range []string{"event: verdict", `"action":"block"`, `"high":1`, `"medium":0`, `"passed":false`, `"exit_code":1`, `"total":1`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("verdict event missing %s: %s", want, body)
+		}
+	}
+}
+
+func TestSSEWriter_ReportSummary(t *testing.T) {
+	sum := protocol.RunSummary{Decision: protocol.DecisionNoGo, Reasons: []string{"Blocked"}, Total: 1}
+	rr := httptest.NewRecorder()
+	sse := NewSSEWriter(rr)
+	protocol.ReportSummary(sse, sum)
+	if strings.Contains(rr.Body.String(), "event: summary") {
+		t.Error("summary event sent without X-Progress-Events")
+	}
+
+	sse.EnableProgress()
+	protocol.ReportSummary(sse, sum)
+	body := rr.Body.String()
+	for _, want := range []string{"event: summary", `"decision":"no-go"`, `"reasons":["Blocked"]`, `"total":1`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("summary event missing %s: %s", want, body)
+		}
+	}
+}
+
 // Compile-time check that SSEWriter implements protocol.Emitter.
 var _ protocol.Emitter = (*SSEWriter)(nil)
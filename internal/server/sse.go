@@ -7,12 +7,17 @@ import (
 	"net/http"
 
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/verdict"
 )
 
 // SSEWriter writes Server-Sent Events in the Copilot Extension protocol format.
 type SSEWriter struct {
-	w       http.ResponseWriter
-	flusher http.Flusher
+	w        http.ResponseWriter
+	flusher  http.Flusher
+	progress bool
+	// findings holds what agents reported, for the closing verdict event.
+	findings []protocol.Finding
+	reported bool
 }
 
 // NewSSEWriter creates a new SSE writer from an HTTP response writer.
@@ -56,17 +61,72 @@ func (s *SSEWriter) SendConfirmation(conf protocol.Confirmation) {
 	s.sendEvent("copilot_confirmation", conf)
 }
 
+// EnableProgress turns on structured progress events. Copilot Chat does not
+// understand them, so they are only sent to clients that opt in.
+func (s *SSEWriter) EnableProgress() {
+	s.progress = true
+}
+
+// ReportProgress sends a progress event when progress events are enabled.
+func (s *SSEWriter) ReportProgress(p protocol.Progress) {
+	if !s.progress {
+		return
+	}
+	s.sendEvent("progress", p)
+}
+
 // SendError sends an error message.
 func (s *SSEWriter) SendError(msg string) {
 	s.SendMessage(fmt.Sprintf("❌ **Error:** %s\n", msg))
 }
 
+// SendCancelled tells the client the job was cancelled. Clients that opted
+// in to progress events also receive a structured job_cancelled event.
+func (s *SSEWriter) SendCancelled(jobID string) {
+	s.SendMessage("\n⏹️ **Cancelled:** this job was cancelled by an operator.\n")
+	if s.progress {
+		s.sendEvent("job_cancelled", map[string]string{"id": jobID})
+	}
+}
+
+// ReportFindings keeps reported findings for SendVerdict.
+func (s *SSEWriter) ReportFindings(_ string, findings []protocol.Finding) {
+	s.reported = true
+	s.findings = append(s.findings, findings...)
+}
+
+// SendVerdict sends a verdict event with the machine-readable verdict of
+// the reported findings under p, so clients can gate on the run without
+// parsing markdown. Like progress events it is only sent to clients that
+// opt in, and only when an agent reported findings.
+func (s *SSEWriter) SendVerdict(p verdict.Policy) {
+	if !s.progress || !s.reported {
+		return
+	}
+	s.sendEvent("verdict", p.Evaluate(s.findings).Report())
+}
+
+// ReportSummary sends a summary event with a workflow's aggregated result.
+// Like progress events it is only sent to clients that opt in.
+func (s *SSEWriter) ReportSummary(sum protocol.RunSummary) {
+	if !s.progress {
+		return
+	}
+	s.sendEvent("summary", sum)
+}
+
 // SendDone sends the copilot_done event marking end of stream.
 func (s *SSEWriter) SendDone() {
 	fmt.Fprintf(s.w, "event: copilot_done\ndata: {}\n\n")
 	s.flusher.Flush()
 }
 
+// SendEvent sends a named event with a JSON payload, for endpoints that
+// stream a result other than a chat reply.
+func (s *SSEWriter) SendEvent(event string, data interface{}) {
+	s.sendEvent(event, data)
+}
+
 func (s *SSEWriter) sendEvent(event string, data interface{}) {
 	jsonData, err := json.Marshal(data)
 	if err != nil {
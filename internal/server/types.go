@@ -6,4 +6,54 @@ import "github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 // Used for JSON decoding at the HTTP boundary.
 type AgentRequest struct {
 	Messages []protocol.Message `json:"messages"`
+	// ThreadID identifies the Copilot conversation across turns.
+	ThreadID string `json:"copilot_thread_id,omitempty"`
+	// Categories and SkipCategories scope security scans, e.g. ["secrets"].
+	Categories     []string `json:"categories,omitempty"`
+	SkipCategories []string `json:"skip_categories,omitempty"`
+	// Baseline is the X-Job-ID of an earlier analysis to diff against.
+	Baseline string `json:"baseline,omitempty"`
+	// Environment and Version tag cost estimates with the deployment stage
+	// they were made for, e.g. "prod" and "v1.3.0".
+	Environment string `json:"environment,omitempty"`
+	Version     string `json:"version,omitempty"`
+	// Currency is the ISO 4217 code cost estimates are reported in.
+	Currency string `json:"currency,omitempty"`
+	// Locale is the locale amounts are written in, e.g. "de-DE".
+	Locale string `json:"locale,omitempty"`
+	// Budget is the monthly budget cost estimates are checked against, in
+	// Currency.
+	Budget float64 `json:"budget,omitempty"`
+	// Frameworks are the compliance frameworks to audit against, e.g.
+	// ["pci-dss"].
+	Frameworks []string `json:"frameworks,omitempty"`
+	// Repository names the repository the code comes from, e.g. "org/app".
+	Repository string `json:"repository,omitempty"`
+	// Commit is the commit SHA the code was taken from; compliance audits
+	// record it with their scores.
+	Commit string `json:"commit,omitempty"`
+}
+
+// ReportRequest is the body of POST /report: the code to audit, as an
+// AgentRequest, and what the auditor adds to the report.
+type ReportRequest struct {
+	AgentRequest
+	Title   string `json:"title,omitempty"`
+	Auditor string `json:"auditor,omitempty"`
+	// Notes are auditor notes by control ID, e.g. {"4.2.1": "..."}.
+	Notes map[string]string `json:"notes,omitempty"`
+	// Findings are findings already reported for the code, in the form
+	// POST /check returns them.
+	Findings []ReportFinding `json:"findings,omitempty"`
+}
+
+// ReportFinding is a finding as POST /check returns it.
+type ReportFinding struct {
+	RuleID       string            `json:"rule_id"`
+	Severity     protocol.Severity `json:"severity"`
+	Resource     string            `json:"resource"`
+	ResourceType string            `json:"resource_type"`
+	Message      string            `json:"message"`
+	Remediation  string            `json:"remediation,omitempty"`
+	Source       string            `json:"source,omitempty"`
 }
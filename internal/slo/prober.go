@@ -0,0 +1,81 @@
+package slo
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// DefaultProbeAgents are probed when none are configured. Only read-only
+// analysis agents are safe to probe; deploy and notification have side
+// effects.
+var DefaultProbeAgents = []string{"policy", "security", "compliance", "cost", "impact"}
+
+// DefaultProbeTimeout bounds a single probe.
+const DefaultProbeTimeout = 2 * time.Minute
+
+// probeSample is a small configuration exercising the parser and the
+// common rule paths without touching any external service.
+const probeSample = "```hcl\n" + `resource "azurerm_storage_account" "probe" {
+  name                     = "sloprobe"
+  resource_group_name      = "rg-probe"
+  location                 = "eastus"
+  account_tier             = "Standard"
+  account_replication_type = "LRS"
+  min_tls_version          = "TLS1_2"
+}
+` + "```"
+
+// DispatchFunc routes a request to an agent, e.g. host.Dispatcher.Dispatch.
+type DispatchFunc func(ctx context.Context, agentID string, req protocol.AgentRequest, emit protocol.Emitter) error
+
+// Prober periodically sends a synthetic request to each agent so latency
+// and availability are tracked even without user traffic. Probes pass
+// through the dispatcher, so the Tracker observes them like any request.
+type Prober struct {
+	dispatch DispatchFunc
+	agents   []string
+	timeout  time.Duration
+}
+
+// NewProber creates a Prober for agents.
+func NewProber(dispatch DispatchFunc, agents []string) *Prober {
+	if len(agents) == 0 {
+		agents = DefaultProbeAgents
+	}
+	return &Prober{dispatch: dispatch, agents: agents, timeout: DefaultProbeTimeout}
+}
+
+// Run probes every agent once, in sequence, logging failures. It suits a
+// scheduler.Job.
+func (p *Prober) Run(ctx context.Context) {
+	for _, id := range p.agents {
+		if err := p.Probe(ctx, id); err != nil && ctx.Err() == nil {
+			log.Printf("SLO probe of %s failed: %v", id, err)
+		}
+	}
+}
+
+// Probe sends the sample configuration to one agent.
+func (p *Prober) Probe(ctx context.Context, agentID string) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	req := protocol.AgentRequest{
+		Prompt:   "Analyze this configuration\n" + probeSample,
+		Metadata: map[string]string{protocol.MetaProbe: "true"},
+	}
+	host.ParseAndEnrich(&req)
+	return p.dispatch(ctx, agentID, req, discardEmitter{})
+}
+
+// discardEmitter drops probe output.
+type discardEmitter struct{}
+
+func (discardEmitter) SendMessage(string)                     {}
+func (discardEmitter) SendReferences([]protocol.Reference)    {}
+func (discardEmitter) SendConfirmation(protocol.Confirmation) {}
+func (discardEmitter) SendError(string)                       {}
+func (discardEmitter) SendDone()                              {}
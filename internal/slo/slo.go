@@ -0,0 +1,283 @@
+// Package slo tracks per-agent availability and latency and evaluates them
+// against service level objectives, e.g. "99% of scans finish within 30s".
+// Samples come from real dispatches and from a synthetic health prober.
+package slo
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// DefaultObjectives applies when none are configured.
+const DefaultObjectives = "scans=*:30s@99"
+
+// DefaultWindow is the rolling window objectives are evaluated over.
+const DefaultWindow = 24 * time.Hour
+
+// MinSamples is how many samples an objective needs before it is judged.
+const MinSamples = 10
+
+// maxSamples bounds memory regardless of traffic.
+const maxSamples = 100000
+
+// AtRiskBudget is the fraction of the error budget left below which an
+// objective is at risk.
+const AtRiskBudget = 0.25
+
+// Statuses of an objective.
+const (
+	StatusNoData   = "no_data"
+	StatusOK       = "ok"
+	StatusAtRisk   = "at_risk"
+	StatusBreached = "breached"
+)
+
+// Objective is a latency-and-availability target: Target of requests to
+// Agent ("*" for every agent) must succeed within Latency.
+type Objective struct {
+	Name    string        `json:"name"`
+	Agent   string        `json:"agent"`
+	Latency time.Duration `json:"latency"`
+	Target  float64       `json:"target"`
+}
+
+// ParseObjectives parses comma-separated name=agent:latency@percent entries,
+// e.g. "scans=*:30s@99,policy=policy:5s@99.5".
+func ParseObjectives(s string) ([]Objective, error) {
+	var objectives []Objective
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(entry, "=")
+		agent, rest, ok2 := strings.Cut(spec, ":")
+		latency, percent, ok3 := strings.Cut(rest, "@")
+		name, agent = strings.TrimSpace(name), strings.TrimSpace(agent)
+		if !ok || !ok2 || !ok3 || name == "" || agent == "" {
+			return nil, fmt.Errorf("invalid objective %q (want name=agent:latency@percent)", entry)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(latency))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("objective %q: invalid latency %q", name, latency)
+		}
+		p, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(percent), "%"), 64)
+		if err != nil || p <= 0 || p >= 100 {
+			return nil, fmt.Errorf("objective %q: target must be a percentage between 0 and 100, got %q", name, percent)
+		}
+		objectives = append(objectives, Objective{Name: name, Agent: agent, Latency: d, Target: p / 100})
+	}
+	return objectives, nil
+}
+
+// Sample is one observed request.
+type Sample struct {
+	Agent    string
+	At       time.Time
+	Duration time.Duration
+	OK       bool
+	Probe    bool
+}
+
+// AgentStats is availability and latency for one agent over the window.
+type AgentStats struct {
+	Requests     int     `json:"requests"`
+	Probes       int     `json:"probes"`
+	Errors       int     `json:"errors"`
+	Availability float64 `json:"availability"`
+	P50Millis    int64   `json:"p50_ms"`
+	P95Millis    int64   `json:"p95_ms"`
+	P99Millis    int64   `json:"p99_ms"`
+}
+
+// Report is an objective's compliance over the window.
+type Report struct {
+	Objective
+	Status string `json:"status"`
+	Total  int    `json:"total"`
+	Good   int    `json:"good"`
+	// Compliance is Good/Total.
+	Compliance float64 `json:"compliance"`
+	// BudgetRemaining is the fraction of the error budget (1-Target of
+	// Total) not yet spent; negative once breached.
+	BudgetRemaining float64 `json:"budget_remaining"`
+}
+
+// Summary is a one-line description for alerts.
+func (r Report) Summary() string {
+	return fmt.Sprintf("SLO %s (%s within %s, target %.2f%%): %.2f%% of %d request(s), %.0f%% of error budget left",
+		r.Name, r.Agent, r.Latency, r.Target*100, r.Compliance*100, r.Total, math.Max(r.BudgetRemaining, 0)*100)
+}
+
+// Snapshot is the JSON document served by /slo.
+type Snapshot struct {
+	Window     string                 `json:"window"`
+	Objectives []Report               `json:"objectives"`
+	Agents     map[string]*AgentStats `json:"agents"`
+}
+
+// Tracker keeps samples for a rolling window and evaluates objectives.
+type Tracker struct {
+	objectives []Objective
+	window     time.Duration
+	now        func() time.Time
+
+	mu      sync.Mutex
+	samples []Sample
+	alerted map[string]string
+}
+
+// NewTracker creates a Tracker for objectives over window.
+func NewTracker(objectives []Objective, window time.Duration) *Tracker {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &Tracker{objectives: objectives, window: window, now: time.Now, alerted: make(map[string]string)}
+}
+
+// Record adds a sample, dropping those older than the window.
+func (t *Tracker) Record(s Sample) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples = append(t.samples, s)
+	t.pruneLocked(t.now())
+}
+
+func (t *Tracker) pruneLocked(now time.Time) {
+	cutoff := now.Add(-t.window)
+	i := sort.Search(len(t.samples), func(i int) bool { return !t.samples[i].At.Before(cutoff) })
+	if over := len(t.samples) - maxSamples; over > i {
+		i = over
+	}
+	if i > 0 {
+		t.samples = append(t.samples[:0:0], t.samples[i:]...)
+	}
+}
+
+// Observe is a host.Observer recording the latency and outcome of every
+// dispatch. Requests marked with protocol.MetaProbe count as probes.
+func (t *Tracker) Observe(agentID string, req protocol.AgentRequest, _ protocol.Emitter) (protocol.Emitter, func(error)) {
+	start := t.now()
+	probe := req.Metadata[protocol.MetaProbe] != ""
+	return nil, func(err error) {
+		t.Record(Sample{Agent: agentID, At: start, Duration: t.now().Sub(start), OK: err == nil, Probe: probe})
+	}
+}
+
+// Snapshot evaluates every objective and per-agent stats over the window.
+func (t *Tracker) Snapshot() Snapshot {
+	t.mu.Lock()
+	t.pruneLocked(t.now())
+	samples := append([]Sample(nil), t.samples...)
+	t.mu.Unlock()
+
+	snap := Snapshot{Window: t.window.String(), Agents: make(map[string]*AgentStats)}
+	for _, o := range t.objectives {
+		snap.Objectives = append(snap.Objectives, evaluate(o, samples))
+	}
+	durations := make(map[string][]time.Duration)
+	for _, s := range samples {
+		st, ok := snap.Agents[s.Agent]
+		if !ok {
+			st = &AgentStats{}
+			snap.Agents[s.Agent] = st
+		}
+		st.Requests++
+		if s.Probe {
+			st.Probes++
+		}
+		if !s.OK {
+			st.Errors++
+		}
+		durations[s.Agent] = append(durations[s.Agent], s.Duration)
+	}
+	for agent, st := range snap.Agents {
+		st.Availability = float64(st.Requests-st.Errors) / float64(st.Requests)
+		d := durations[agent]
+		sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+		st.P50Millis = percentile(d, 0.50).Milliseconds()
+		st.P95Millis = percentile(d, 0.95).Milliseconds()
+		st.P99Millis = percentile(d, 0.99).Milliseconds()
+	}
+	return snap
+}
+
+// Report returns the current report for the named objective.
+func (t *Tracker) Report(name string) (Report, bool) {
+	for _, r := range t.Snapshot().Objectives {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Report{}, false
+}
+
+// Alerts returns objectives that became at risk or breached since the last
+// call. Each objective alerts once per degradation; it alerts again only
+// after recovering or getting worse.
+func (t *Tracker) Alerts() []Report {
+	snap := t.Snapshot()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var alerts []Report
+	for _, r := range snap.Objectives {
+		prev := t.alerted[r.Name]
+		switch r.Status {
+		case StatusAtRisk, StatusBreached:
+			if prev != r.Status && prev != StatusBreached {
+				alerts = append(alerts, r)
+			}
+			t.alerted[r.Name] = r.Status
+		case StatusOK:
+			delete(t.alerted, r.Name)
+		}
+	}
+	return alerts
+}
+
+func evaluate(o Objective, samples []Sample) Report {
+	r := Report{Objective: o, Status: StatusNoData}
+	for _, s := range samples {
+		if o.Agent != "*" && s.Agent != o.Agent {
+			continue
+		}
+		r.Total++
+		if s.OK && s.Duration <= o.Latency {
+			r.Good++
+		}
+	}
+	if r.Total == 0 {
+		return r
+	}
+	r.Compliance = float64(r.Good) / float64(r.Total)
+	allowed := (1 - o.Target) * float64(r.Total)
+	r.BudgetRemaining = 1 - float64(r.Total-r.Good)/allowed
+	switch {
+	case r.Total < MinSamples:
+	case r.Compliance < o.Target:
+		r.Status = StatusBreached
+	case r.BudgetRemaining < AtRiskBudget:
+		r.Status = StatusAtRisk
+	default:
+		r.Status = StatusOK
+	}
+	return r
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
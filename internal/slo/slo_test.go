@@ -0,0 +1,150 @@
+package slo
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+func TestParseObjectives(t *testing.T) {
+	objectives, err := ParseObjectives(DefaultObjectives + ", policy=policy:5s@99.5%")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objectives) != 2 {
+		t.Fatalf("got %d objectives, want 2", len(objectives))
+	}
+	want := Objective{Name: "scans", Agent: "*", Latency: 30 * time.Second, Target: 0.99}
+	if objectives[0] != want {
+		t.Errorf("objectives[0] = %+v, want %+v", objectives[0], want)
+	}
+	if objectives[1].Agent != "policy" || objectives[1].Target != 0.995 {
+		t.Errorf("objectives[1] = %+v", objectives[1])
+	}
+
+	for _, bad := range []string{"scans", "scans=*:30s", "scans=*:fast@99", "scans=*:30s@100", "=*:30s@99"} {
+		if _, err := ParseObjectives(bad); err == nil {
+			t.Errorf("ParseObjectives(%q) should fail", bad)
+		}
+	}
+}
+
+func newTestTracker(now *time.Time) *Tracker {
+	tr := NewTracker([]Objective{
+		{Name: "scans", Agent: "*", Latency: 30 * time.Second, Target: 0.9},
+		{Name: "cost", Agent: "cost", Latency: time.Second, Target: 0.5},
+	}, time.Hour)
+	tr.now = func() time.Time { return *now }
+	return tr
+}
+
+func TestTracker_Status(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tr := newTestTracker(&now)
+
+	if r, _ := tr.Report("scans"); r.Status != StatusNoData {
+		t.Errorf("empty tracker status = %s, want %s", r.Status, StatusNoData)
+	}
+
+	for i := 0; i < 20; i++ {
+		tr.Record(Sample{Agent: "policy", At: now, Duration: time.Second, OK: true})
+	}
+	r, _ := tr.Report("scans")
+	if r.Status != StatusOK || r.Total != 20 || r.Good != 20 || r.BudgetRemaining != 1 {
+		t.Errorf("healthy report = %+v", r)
+	}
+
+	// 20 good + 1 slow + 1 error: 2 of 2.2 allowed failures spent.
+	tr.Record(Sample{Agent: "policy", At: now, Duration: time.Minute, OK: true})
+	tr.Record(Sample{Agent: "security", At: now, Duration: time.Second, OK: false})
+	if r, _ = tr.Report("scans"); r.Status != StatusAtRisk {
+		t.Errorf("status = %s (budget %.2f), want %s", r.Status, r.BudgetRemaining, StatusAtRisk)
+	}
+
+	tr.Record(Sample{Agent: "security", At: now, Duration: time.Second, OK: false})
+	if r, _ = tr.Report("scans"); r.Status != StatusBreached {
+		t.Errorf("status = %s, want %s", r.Status, StatusBreached)
+	}
+	if !strings.Contains(r.Summary(), "SLO scans") {
+		t.Errorf("summary = %q", r.Summary())
+	}
+
+	// Per-agent objectives ignore other agents.
+	if r, _ = tr.Report("cost"); r.Total != 0 {
+		t.Errorf("cost objective counted %d samples", r.Total)
+	}
+
+	snap := tr.Snapshot()
+	if st := snap.Agents["security"]; st == nil || st.Errors != 2 || st.Availability != 0 {
+		t.Errorf("security stats = %+v", st)
+	}
+	if st := snap.Agents["policy"]; st.P50Millis != 1000 || st.P99Millis != 60000 {
+		t.Errorf("policy latency = %+v", st)
+	}
+
+	// Samples age out of the window.
+	now = now.Add(2 * time.Hour)
+	if r, _ = tr.Report("scans"); r.Total != 0 {
+		t.Errorf("expired samples still counted: %+v", r)
+	}
+}
+
+func TestTracker_AlertsOncePerDegradation(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tr := newTestTracker(&now)
+	for i := 0; i < 10; i++ {
+		tr.Record(Sample{Agent: "cost", At: now, Duration: 5 * time.Second, OK: true})
+	}
+
+	alerts := tr.Alerts()
+	if len(alerts) != 1 || alerts[0].Name != "cost" || alerts[0].Status != StatusBreached {
+		t.Fatalf("alerts = %+v, want cost breached", alerts)
+	}
+	if len(tr.Alerts()) != 0 {
+		t.Error("unchanged breach should not alert again")
+	}
+
+	now = now.Add(2 * time.Hour)
+	for i := 0; i < 10; i++ {
+		tr.Record(Sample{Agent: "cost", At: now, Duration: time.Millisecond, OK: true})
+	}
+	if len(tr.Alerts()) != 0 {
+		t.Error("recovery should not alert")
+	}
+	for i := 0; i < 20; i++ {
+		tr.Record(Sample{Agent: "cost", At: now, Duration: time.Minute, OK: true})
+	}
+	if alerts = tr.Alerts(); len(alerts) != 2 {
+		t.Errorf("renewed breach after recovery should alert again, got %+v", alerts)
+	}
+}
+
+func TestProber_ObservedAsProbe(t *testing.T) {
+	tr := NewTracker([]Objective{{Name: "scans", Agent: "*", Latency: time.Minute, Target: 0.99}}, time.Hour)
+	dispatch := func(_ context.Context, agentID string, req protocol.AgentRequest, emit protocol.Emitter) error {
+		_, finish := tr.Observe(agentID, req, emit)
+		if req.IaC == nil || len(req.IaC.Resources) == 0 {
+			t.Error("probe request should carry parsed resources")
+		}
+		var err error
+		if agentID == "cost" {
+			err = errors.New("pricing API down")
+		}
+		finish(err)
+		return err
+	}
+
+	NewProber(dispatch, []string{"policy", "cost"}).Run(context.Background())
+
+	snap := tr.Snapshot()
+	if st := snap.Agents["policy"]; st == nil || st.Probes != 1 || st.Errors != 0 {
+		t.Errorf("policy stats = %+v", st)
+	}
+	if st := snap.Agents["cost"]; st == nil || st.Probes != 1 || st.Errors != 1 {
+		t.Errorf("cost stats = %+v", st)
+	}
+}
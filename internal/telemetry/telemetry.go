@@ -0,0 +1,268 @@
+// Package telemetry records opt-in, privacy-preserving usage analytics:
+// which agents and commands are used, how long feedback takes, and how many
+// findings are opened and resolved over time. No prompt text, code, or
+// resource names are stored — findings are tracked by one-way fingerprints.
+package telemetry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// commandVocabulary is the closed set of command words recorded. Anything
+// else is recorded as "other" so free-form prompt text never leaves the request.
+var commandVocabulary = []string{
+	"analyze", "scan", "audit", "review", "check",
+	"cost", "estimate", "price",
+	"deploy", "promote", "drift", "notify",
+	"help", "status",
+}
+
+var codeBlockRe = regexp.MustCompile("(?s)```.*?```")
+
+// AgentStats aggregates invocations and latency for one agent.
+type AgentStats struct {
+	Invocations int     `json:"invocations"`
+	Errors      int     `json:"errors"`
+	AvgMillis   float64 `json:"avg_ms"`
+	MaxMillis   int64   `json:"max_ms"`
+	totalMillis int64
+}
+
+// DailyStats aggregates activity for a single UTC day.
+type DailyStats struct {
+	Date             string `json:"date"`
+	Requests         int    `json:"requests"`
+	FindingsReported int    `json:"findings_reported"`
+	FindingsResolved int    `json:"findings_resolved"`
+}
+
+// FindingStats summarizes the finding lifecycle.
+type FindingStats struct {
+	Reported int `json:"reported"`
+	Open     int `json:"open"`
+	Resolved int `json:"resolved"`
+}
+
+// Snapshot is the JSON document served by /analytics.
+type Snapshot struct {
+	Enabled  bool                   `json:"enabled"`
+	Since    time.Time              `json:"since,omitempty"`
+	Agents   map[string]*AgentStats `json:"agents,omitempty"`
+	Commands map[string]int         `json:"commands,omitempty"`
+	Findings FindingStats           `json:"findings"`
+	Daily    []DailyStats           `json:"daily,omitempty"`
+}
+
+type openFinding struct {
+	agent    string
+	resource string
+}
+
+// Recorder aggregates usage events in memory. A nil or disabled Recorder is
+// a no-op, so callers never need to branch on the off switch.
+type Recorder struct {
+	enabled bool
+	now     func() time.Time
+
+	mu       sync.Mutex
+	since    time.Time
+	agents   map[string]*AgentStats
+	commands map[string]int
+	open     map[string]openFinding
+	findings FindingStats
+	daily    map[string]*DailyStats
+}
+
+// New creates a Recorder. When enabled is false nothing is recorded.
+func New(enabled bool) *Recorder {
+	r := &Recorder{
+		enabled:  enabled,
+		now:      time.Now,
+		agents:   make(map[string]*AgentStats),
+		commands: make(map[string]int),
+		open:     make(map[string]openFinding),
+		daily:    make(map[string]*DailyStats),
+	}
+	r.since = r.now().UTC()
+	return r
+}
+
+// Enabled reports whether telemetry is being recorded.
+func (r *Recorder) Enabled() bool { return r != nil && r.enabled }
+
+// Observe is a host.Observer that records each dispatched request. It wraps
+// the emitter to capture structured findings reported by agents. Health
+// probes are not usage and are skipped.
+func (r *Recorder) Observe(agentID string, req protocol.AgentRequest, emit protocol.Emitter) (protocol.Emitter, func(error)) {
+	if !r.Enabled() || req.Metadata[protocol.MetaProbe] != "" {
+		return nil, nil
+	}
+	start := r.now()
+	capture := &captureEmitter{Emitter: emit, findings: make(map[string][]protocol.Finding)}
+	command := Command(protocol.PromptText(req))
+	var scanned []protocol.Resource
+	if req.IaC != nil {
+		scanned = req.IaC.Resources
+	}
+	return capture, func(err error) {
+		r.record(agentID, command, r.now().Sub(start), err, scanned, capture.snapshot())
+	}
+}
+
+func (r *Recorder) record(agentID, command string, elapsed time.Duration, err error, scanned []protocol.Resource, byAgent map[string][]protocol.Finding) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := r.agents[agentID]
+	if stats == nil {
+		stats = &AgentStats{}
+		r.agents[agentID] = stats
+	}
+	ms := elapsed.Milliseconds()
+	stats.Invocations++
+	stats.totalMillis += ms
+	stats.AvgMillis = float64(stats.totalMillis) / float64(stats.Invocations)
+	if ms > stats.MaxMillis {
+		stats.MaxMillis = ms
+	}
+	if err != nil {
+		stats.Errors++
+	}
+	r.commands[command]++
+
+	day := r.day()
+	day.Requests++
+
+	scannedKeys := make(map[string]bool, len(scanned))
+	for _, res := range scanned {
+		scannedKeys[fingerprint(res.Type, res.Name)] = true
+	}
+
+	for reporter, findings := range byAgent {
+		seen := make(map[string]bool, len(findings))
+		for _, f := range findings {
+			resKey := fingerprint(f.ResourceType, f.Resource)
+			fp := fingerprint(reporter, f.RuleID, resKey)
+			seen[fp] = true
+			r.findings.Reported++
+			day.FindingsReported++
+			r.open[fp] = openFinding{agent: reporter, resource: resKey}
+		}
+		// A previously open finding is resolved when the same agent re-scans
+		// the same resource and no longer reports it.
+		for fp, of := range r.open {
+			if of.agent == reporter && scannedKeys[of.resource] && !seen[fp] {
+				delete(r.open, fp)
+				r.findings.Resolved++
+				day.FindingsResolved++
+			}
+		}
+	}
+	r.findings.Open = len(r.open)
+}
+
+func (r *Recorder) day() *DailyStats {
+	key := r.now().UTC().Format("2006-01-02")
+	d := r.daily[key]
+	if d == nil {
+		d = &DailyStats{Date: key}
+		r.daily[key] = d
+	}
+	return d
+}
+
+// Snapshot returns a copy of the aggregated analytics.
+func (r *Recorder) Snapshot() Snapshot {
+	if !r.Enabled() {
+		return Snapshot{Enabled: false}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	snap := Snapshot{
+		Enabled:  true,
+		Since:    r.since,
+		Agents:   make(map[string]*AgentStats, len(r.agents)),
+		Commands: make(map[string]int, len(r.commands)),
+		Findings: r.findings,
+	}
+	for id, s := range r.agents {
+		cp := *s
+		snap.Agents[id] = &cp
+	}
+	for c, n := range r.commands {
+		snap.Commands[c] = n
+	}
+	for _, d := range r.daily {
+		snap.Daily = append(snap.Daily, *d)
+	}
+	sort.Slice(snap.Daily, func(i, j int) bool { return snap.Daily[i].Date < snap.Daily[j].Date })
+	return snap
+}
+
+// Command maps a prompt to a word from the fixed command vocabulary,
+// ignoring fenced code. Unrecognized prompts map to "other".
+func Command(prompt string) string {
+	msg := strings.ToLower(codeBlockRe.ReplaceAllString(prompt, ""))
+	for _, w := range commandVocabulary {
+		if strings.Contains(msg, w) {
+			return w
+		}
+	}
+	return "other"
+}
+
+func fingerprint(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// captureEmitter passes output through while collecting reported findings.
+type captureEmitter struct {
+	protocol.Emitter
+	mu       sync.Mutex
+	findings map[string][]protocol.Finding
+}
+
+func (c *captureEmitter) ReportFindings(agentID string, findings []protocol.Finding) {
+	c.mu.Lock()
+	c.findings[agentID] = append(c.findings[agentID], findings...)
+	c.mu.Unlock()
+	protocol.ReportFindings(c.Emitter, agentID, findings)
+}
+
+func (c *captureEmitter) ReportCosts(agentID string, items []protocol.CostItem) {
+	protocol.ReportCosts(c.Emitter, agentID, items)
+}
+
+func (c *captureEmitter) ReportScores(agentID string, scores map[string]int) {
+	protocol.ReportScores(c.Emitter, agentID, scores)
+}
+
+func (c *captureEmitter) ReportSummary(sum protocol.RunSummary) {
+	protocol.ReportSummary(c.Emitter, sum)
+}
+
+func (c *captureEmitter) ReportProgress(p protocol.Progress) {
+	if r, ok := c.Emitter.(protocol.ProgressReporter); ok {
+		r.ReportProgress(p)
+	}
+}
+
+func (c *captureEmitter) snapshot() map[string][]protocol.Finding {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string][]protocol.Finding, len(c.findings))
+	for k, v := range c.findings {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,126 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol/prototest"
+)
+
+func storageReq(prompt string) protocol.AgentRequest {
+	return protocol.AgentRequest{
+		Prompt: prompt,
+		IaC: &protocol.IaCInput{Resources: []protocol.Resource{
+			{Type: "azurerm_storage_account", Name: "secretname"},
+		}},
+	}
+}
+
+func run(r *Recorder, agentID string, req protocol.AgentRequest, findings []protocol.Finding, err error) {
+	emit, finish := r.Observe(agentID, req, &prototest.Recorder{})
+	if emit != nil {
+		protocol.ReportFindings(emit, "policy", findings)
+	}
+	if finish != nil {
+		finish(err)
+	}
+}
+
+func TestRecorder_Disabled(t *testing.T) {
+	r := New(false)
+	emit, finish := r.Observe("policy", storageReq("analyze"), &prototest.Recorder{})
+	if emit != nil || finish != nil {
+		t.Error("disabled recorder should not wrap dispatch")
+	}
+	if snap := r.Snapshot(); snap.Enabled || len(snap.Agents) != 0 {
+		t.Errorf("disabled snapshot = %+v", snap)
+	}
+	var nilRec *Recorder
+	if nilRec.Enabled() {
+		t.Error("nil recorder should report disabled")
+	}
+}
+
+func TestRecorder_AgentsAndCommands(t *testing.T) {
+	r := New(true)
+	run(r, "orchestrator", storageReq("please analyze this"), nil, nil)
+	run(r, "orchestrator", storageReq("estimate my bill"), nil, errors.New("boom"))
+
+	snap := r.Snapshot()
+	stats := snap.Agents["orchestrator"]
+	if stats == nil || stats.Invocations != 2 || stats.Errors != 1 {
+		t.Fatalf("orchestrator stats = %+v", stats)
+	}
+	if snap.Commands["analyze"] != 1 || snap.Commands["estimate"] != 1 {
+		t.Errorf("commands = %v", snap.Commands)
+	}
+	if len(snap.Daily) != 1 || snap.Daily[0].Requests != 2 {
+		t.Errorf("daily = %+v", snap.Daily)
+	}
+}
+
+func TestRecorder_FindingsResolved(t *testing.T) {
+	r := New(true)
+	finding := protocol.Finding{RuleID: "POL-001", Resource: "secretname", ResourceType: "azurerm_storage_account"}
+
+	run(r, "orchestrator", storageReq("analyze"), []protocol.Finding{finding}, nil)
+	if snap := r.Snapshot(); snap.Findings.Open != 1 || snap.Findings.Reported != 1 {
+		t.Fatalf("after first scan: %+v", snap.Findings)
+	}
+
+	// Same resource re-scanned without the finding → resolved.
+	run(r, "orchestrator", storageReq("analyze"), []protocol.Finding{}, nil)
+	snap := r.Snapshot()
+	if snap.Findings.Open != 0 || snap.Findings.Resolved != 1 {
+		t.Errorf("after fix: %+v", snap.Findings)
+	}
+}
+
+func TestRecorder_NoContentCaptured(t *testing.T) {
+	r := New(true)
+	finding := protocol.Finding{RuleID: "SEC-001", Resource: "secretname", ResourceType: "azurerm_storage_account", Message: "password=hunter2"}
+	run(r, "orchestrator", storageReq("analyze ```hcl\npassword = \"hunter2\"\n```"), []protocol.Finding{finding}, nil)
+
+	data, err := json.Marshal(r.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter2", "secretname", "password"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("snapshot leaked %q: %s", secret, data)
+		}
+	}
+}
+
+func TestRecorder_Latency(t *testing.T) {
+	r := New(true)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	emit, finish := r.Observe("cost", storageReq("cost"), &prototest.Recorder{})
+	_ = emit
+	now = now.Add(1500 * time.Millisecond)
+	finish(nil)
+
+	stats := r.Snapshot().Agents["cost"]
+	if stats.MaxMillis != 1500 || stats.AvgMillis != 1500 {
+		t.Errorf("latency stats = %+v, want 1500ms", stats)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	tests := map[string]string{
+		"Scan my terraform":                     "scan",
+		"deploy to staging":                     "deploy",
+		"hello there":                           "other",
+		"```hcl\n# cost comment\n```\nhi there": "other",
+	}
+	for prompt, want := range tests {
+		if got := Command(prompt); got != want {
+			t.Errorf("Command(%q) = %q, want %q", prompt, got, want)
+		}
+	}
+}
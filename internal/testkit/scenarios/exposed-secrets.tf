@@ -0,0 +1,53 @@
+resource "azurerm_storage_account" "data" {
+  name                     = "stdataexposed"
+  resource_group_name      = "rg-app"
+  location                 = "eastus"
+  account_tier             = "Standard"
+  account_replication_type = "LRS"
+  min_tls_version          = "TLS1_2"
+}
+
+data "azurerm_storage_account_sas" "data" {
+  connection_string = azurerm_storage_account.data.primary_connection_string
+  https_only        = true
+  start             = "2026-01-01T00:00:00Z"
+  expiry            = "2027-01-01T00:00:00Z"
+}
+
+resource "azurerm_key_vault" "app" {
+  name                = "kv-app-exposed"
+  location            = "eastus"
+  resource_group_name = "rg-app"
+  tenant_id           = var.tenant_id
+  sku_name            = "standard"
+
+  access_policy {
+    tenant_id          = var.tenant_id
+    object_id          = azuread_group.developers.object_id
+    secret_permissions = ["Get", "List", "Set", "Delete", "Recover", "Backup", "Restore", "Purge"]
+  }
+
+  access_policy {
+    tenant_id          = var.tenant_id
+    object_id          = azurerm_user_assigned_identity.app.principal_id
+    secret_permissions = ["Get"]
+  }
+}
+
+locals {
+  container_url = "${azurerm_storage_account.data.primary_blob_endpoint}uploads"
+  upload_url    = "${local.container_url}${data.azurerm_storage_account_sas.data.sas}"
+}
+
+output "storage_connection_string" {
+  value = azurerm_storage_account.data.primary_connection_string
+}
+
+output "storage_key" {
+  value     = azurerm_storage_account.data.primary_access_key
+  sensitive = true
+}
+
+output "storage_id" {
+  value = azurerm_storage_account.data.id
+}
@@ -11,6 +11,7 @@ import (
 	"log"
 	"strings"
 
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/buildinfo"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/host"
 	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
 )
@@ -116,7 +117,7 @@ func (a *Adapter) handleInitialize(req *JSONRPCRequest) {
 		},
 		"serverInfo": map[string]interface{}{
 			"name":    "ghcp-iac-workflow",
-			"version": "1.0.0",
+			"version": buildinfo.Version,
 		},
 	})
 }
@@ -135,6 +136,30 @@ func (a *Adapter) handleToolsList(req *JSONRPCRequest) {
 						"type":        "string",
 						"description": "The user prompt or IaC code to analyze",
 					},
+					protocol.MetaCategories: map[string]interface{}{
+						"type":        "string",
+						"description": "Comma-separated check categories to limit the scan to (secrets, network, encryption, logging, identity, recovery, dependencies)",
+					},
+					protocol.MetaSkipCategories: map[string]interface{}{
+						"type":        "string",
+						"description": "Comma-separated check categories to leave out",
+					},
+					protocol.MetaCurrency: map[string]interface{}{
+						"type":        "string",
+						"description": "ISO 4217 currency for cost estimates, e.g. EUR",
+					},
+					protocol.MetaLocale: map[string]interface{}{
+						"type":        "string",
+						"description": "Locale cost amounts are written in, e.g. de-DE",
+					},
+					protocol.MetaFrameworks: map[string]interface{}{
+						"type":        "string",
+						"description": "Comma-separated compliance frameworks to audit against (nist-800-53, hipaa, pci-dss, iso-27001)",
+					},
+					protocol.MetaBudget: map[string]interface{}{
+						"type":        "string",
+						"description": "Monthly budget the cost estimate must stay within, e.g. 500",
+					},
 				},
 				"required": []string{"prompt"},
 			},
@@ -158,6 +183,14 @@ func (a *Adapter) handleToolsCall(ctx context.Context, req *JSONRPCRequest) {
 			{Role: "user", Content: prompt},
 		},
 	}
+	for _, key := range []string{protocol.MetaCategories, protocol.MetaSkipCategories, protocol.MetaCurrency, protocol.MetaLocale, protocol.MetaBudget, protocol.MetaFrameworks} {
+		if v := params.Arguments[key]; v != "" {
+			if agentReq.Metadata == nil {
+				agentReq.Metadata = make(map[string]string)
+			}
+			agentReq.Metadata[key] = v
+		}
+	}
 	host.ParseAndEnrich(&agentReq)
 
 	emit := &StdioEmitter{}
@@ -0,0 +1,212 @@
+// Package trend keeps the compliance scores of every audit, so teams can
+// follow them over time and by repository.
+package trend
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Overall is the framework ID of an audit's score across all the
+// frameworks it assessed.
+const Overall = "overall"
+
+// Intervals a trend can be bucketed by.
+const (
+	IntervalDay  = "day"
+	IntervalWeek = "week"
+)
+
+// Audit is the result of one compliance audit of a repository.
+type Audit struct {
+	Repository string    `json:"repository"`
+	Commit     string    `json:"commit,omitempty"`
+	Time       time.Time `json:"time"`
+	// Scores are the percentages of applicable controls that passed, by
+	// framework ID, with the overall score under Overall.
+	Scores map[string]int `json:"scores"`
+}
+
+// Query selects audits. Empty fields select everything.
+type Query struct {
+	Repository string
+	Since      time.Time
+}
+
+func (q Query) matches(a Audit) bool {
+	return (q.Repository == "" || a.Repository == q.Repository) && !a.Time.Before(q.Since)
+}
+
+// Store persists audits. FileStore is built in; other backends, such as a
+// database shared by several hosts, implement the same methods.
+type Store interface {
+	Add(a Audit) error
+	// Audits returns the audits q selects, oldest first.
+	Audits(q Query) ([]Audit, error)
+}
+
+// FileStore keeps audits in memory and, with a path, appends each one to
+// a JSON Lines file that is read back on start, so history survives
+// restarts.
+type FileStore struct {
+	path string
+
+	mu     sync.Mutex
+	audits []Audit
+}
+
+// NewFileStore creates a store, loading the audits in path when it exists.
+// An empty path keeps audits in memory only.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path}
+	if path == "" {
+		return s, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var a Audit
+		if err := json.Unmarshal(sc.Bytes(), &a); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		s.audits = append(s.audits, a)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	sort.SliceStable(s.audits, func(i, j int) bool { return s.audits[i].Time.Before(s.audits[j].Time) })
+	return s, nil
+}
+
+// Add records an audit, appending it to the file first.
+func (s *FileStore) Add(a Audit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.path != "" {
+		data, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(append(data, '\n'))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	i := sort.Search(len(s.audits), func(i int) bool { return s.audits[i].Time.After(a.Time) })
+	s.audits = append(s.audits, Audit{})
+	copy(s.audits[i+1:], s.audits[i:])
+	s.audits[i] = a
+	return nil
+}
+
+// Audits returns the audits q selects, oldest first.
+func (s *FileStore) Audits(q Query) ([]Audit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Audit
+	for _, a := range s.audits {
+		if q.matches(a) {
+			out = append(out, a)
+		}
+	}
+	return out, nil
+}
+
+// Point is a repository's score for a framework at one time.
+type Point struct {
+	Time   time.Time `json:"time"`
+	Score  int       `json:"score"`
+	Commit string    `json:"commit,omitempty"`
+}
+
+// Series is the score history of one repository for one framework.
+type Series struct {
+	Repository string  `json:"repository"`
+	Framework  string  `json:"framework"`
+	Points     []Point `json:"points"`
+	// Latest is the last score, and Change how far it moved since the
+	// first point.
+	Latest int `json:"latest"`
+	Change int `json:"change"`
+}
+
+// Trends groups audits, oldest first, into one series per repository and
+// framework, or only for framework when it is not empty. With an interval
+// (IntervalDay or IntervalWeek, in UTC) a series keeps the last audit of
+// each interval. Series are sorted by repository, with the Overall series
+// first.
+func Trends(audits []Audit, framework, interval string) []Series {
+	index := make(map[[2]string]int)
+	var out []Series
+	for _, a := range audits {
+		for fw, score := range a.Scores {
+			if framework != "" && fw != framework {
+				continue
+			}
+			key := [2]string{a.Repository, fw}
+			i, ok := index[key]
+			if !ok {
+				i = len(out)
+				index[key] = i
+				out = append(out, Series{Repository: a.Repository, Framework: fw})
+			}
+			p := Point{Time: a.Time, Score: score, Commit: a.Commit}
+			s := &out[i]
+			if n := len(s.Points); n > 0 && interval != "" && bucket(s.Points[n-1].Time, interval).Equal(bucket(a.Time, interval)) {
+				s.Points[n-1] = p
+			} else {
+				s.Points = append(s.Points, p)
+			}
+		}
+	}
+	for i := range out {
+		s := &out[i]
+		s.Latest = s.Points[len(s.Points)-1].Score
+		s.Change = s.Latest - s.Points[0].Score
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Repository != out[j].Repository {
+			return out[i].Repository < out[j].Repository
+		}
+		if (out[i].Framework == Overall) != (out[j].Framework == Overall) {
+			return out[i].Framework == Overall
+		}
+		return out[i].Framework < out[j].Framework
+	})
+	return out
+}
+
+// bucket returns the start of the interval t falls in; weeks start on
+// Monday.
+func bucket(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if interval == IntervalWeek {
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
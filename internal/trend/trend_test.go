@@ -0,0 +1,58 @@
+package trend
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func day(d, hour int) time.Time { return time.Date(2026, 9, d, hour, 0, 0, 0, time.UTC) }
+
+func TestFileStore_Persists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trends.jsonl")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Add(Audit{Repository: "org/app", Commit: "bbb", Time: day(2, 9), Scores: map[string]int{Overall: 80}})
+	s.Add(Audit{Repository: "org/app", Commit: "aaa", Time: day(1, 9), Scores: map[string]int{Overall: 60}})
+	s.Add(Audit{Repository: "org/web", Time: day(3, 9), Scores: map[string]int{Overall: 90}})
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	audits, _ := reopened.Audits(Query{Repository: "org/app"})
+	if len(audits) != 2 || audits[0].Commit != "aaa" || audits[1].Scores[Overall] != 80 {
+		t.Errorf("audits = %+v", audits)
+	}
+	if since, _ := reopened.Audits(Query{Since: day(2, 0)}); len(since) != 2 {
+		t.Errorf("since = %+v", since)
+	}
+}
+
+func TestTrends(t *testing.T) {
+	audits := []Audit{
+		{Repository: "org/app", Commit: "a1", Time: day(7, 9), Scores: map[string]int{Overall: 50, "pci-dss": 40}},
+		{Repository: "org/app", Commit: "a2", Time: day(7, 17), Scores: map[string]int{Overall: 60, "pci-dss": 55}},
+		{Repository: "org/app", Commit: "a3", Time: day(15, 9), Scores: map[string]int{Overall: 75, "pci-dss": 70}},
+		{Repository: "org/api", Time: day(8, 9), Scores: map[string]int{Overall: 90}},
+	}
+
+	all := Trends(audits, "", "")
+	if len(all) != 3 || all[0].Repository != "org/api" || all[1].Framework != Overall || all[2].Framework != "pci-dss" {
+		t.Fatalf("series = %+v", all)
+	}
+	if s := all[1]; len(s.Points) != 3 || s.Latest != 75 || s.Change != 25 {
+		t.Errorf("overall = %+v", s)
+	}
+
+	daily := Trends(audits, "pci-dss", IntervalDay)
+	if len(daily) != 1 || len(daily[0].Points) != 2 || daily[0].Points[0].Commit != "a2" || daily[0].Change != 15 {
+		t.Errorf("daily = %+v", daily)
+	}
+	// Monday 7 and Monday 14 September 2026 start two weeks.
+	if weekly := Trends(audits, Overall, IntervalWeek); len(weekly[1].Points) != 2 {
+		t.Errorf("weekly = %+v", weekly)
+	}
+}
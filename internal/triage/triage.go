@@ -0,0 +1,241 @@
+// Package triage keeps the lifecycle state teams give findings in chat —
+// snoozed, assigned, or marked false positive — so later reports and
+// notifications reflect it. State is keyed by rule and resource, so it
+// carries over to every run that reports the same finding.
+package triage
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/filestore"
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Finding statuses. A finding without an entry, or with only an assignee,
+// is open.
+const (
+	StatusSnoozed       = "snoozed"
+	StatusFalsePositive = "false_positive"
+)
+
+// MaxSnooze bounds how far ahead a finding can be snoozed.
+const MaxSnooze = 365 * 24 * time.Hour
+
+// DefaultSnooze is the snooze length when a command gives none.
+const DefaultSnooze = 7 * 24 * time.Hour
+
+// Entry is the triage state of one finding.
+type Entry struct {
+	RuleID       string    `json:"rule_id"`
+	ResourceType string    `json:"resource_type"`
+	Resource     string    `json:"resource"`
+	Status       string    `json:"status,omitempty"`
+	Until        time.Time `json:"until,omitempty"`
+	Assignee     string    `json:"assignee,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Key identifies the finding an entry applies to.
+func (e Entry) Key() string { return key(e.RuleID, e.ResourceType, e.Resource) }
+
+// Hidden reports whether the finding is left out of reports at now: it is a
+// false positive or its snooze has not ended.
+func (e Entry) Hidden(now time.Time) bool {
+	switch e.Status {
+	case StatusFalsePositive:
+		return true
+	case StatusSnoozed:
+		return now.Before(e.Until)
+	}
+	return false
+}
+
+func key(ruleID, resourceType, resource string) string {
+	return strings.ToUpper(ruleID) + "|" + resourceType + "|" + resource
+}
+
+// Key returns the triage key of a finding.
+func Key(f protocol.Finding) string { return key(f.RuleID, f.ResourceType, f.Resource) }
+
+// Store holds triage entries, persisted to a JSON file when it has a path.
+// It is safe for concurrent use.
+type Store struct {
+	now     func() time.Time
+	entries *filestore.Records[Entry]
+}
+
+// NewStore creates a store, loading path when it exists. An empty path
+// keeps state in memory only.
+func NewStore(path string) (*Store, error) {
+	entries, err := filestore.Open[Entry](path)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{now: time.Now, entries: entries}, nil
+}
+
+// Get returns the entry of a finding.
+func (s *Store) Get(f protocol.Finding) (Entry, bool) {
+	k := Key(f)
+	return s.entries.Find(func(e Entry) bool { return e.Key() == k })
+}
+
+// Entries returns every entry, by rule and resource.
+func (s *Store) Entries() []Entry {
+	return s.entries.List(nil, func(a, b Entry) bool { return a.Key() < b.Key() })
+}
+
+// Apply returns the findings that are not hidden at now, with the assignee
+// appended to the message of assigned ones, and the number hidden.
+func (s *Store) Apply(findings []protocol.Finding, now time.Time) ([]protocol.Finding, int) {
+	all := s.entries.All()
+	if len(all) == 0 {
+		return findings, 0
+	}
+	entries := make(map[string]Entry, len(all))
+	for _, e := range all {
+		entries[e.Key()] = e
+	}
+	kept := make([]protocol.Finding, 0, len(findings))
+	for _, f := range findings {
+		e, ok := entries[Key(f)]
+		if ok && e.Hidden(now) {
+			continue
+		}
+		if ok && e.Assignee != "" {
+			f.Message += " (assigned to " + e.Assignee + ")"
+		}
+		kept = append(kept, f)
+	}
+	return kept, len(findings) - len(kept)
+}
+
+// Update applies cmd to the finding and persists the result.
+func (s *Store) Update(f protocol.Finding, cmd Command) (Entry, error) {
+	k := Key(f)
+	e := Entry{RuleID: f.RuleID, ResourceType: f.ResourceType, Resource: f.Resource}
+	err := s.entries.Update(func(entries []Entry) ([]Entry, error) {
+		for i := range entries {
+			if entries[i].Key() == k {
+				e = entries[i]
+				entries = append(entries[:i], entries[i+1:]...)
+				break
+			}
+		}
+		now := s.now()
+		e.UpdatedAt = now
+		switch cmd.Action {
+		case ActionSnooze:
+			e.Status, e.Until = StatusSnoozed, now.Add(cmd.For)
+		case ActionAssign:
+			e.Assignee = cmd.Assignee
+		case ActionFalsePositive:
+			e.Status, e.Until = StatusFalsePositive, time.Time{}
+		case ActionReopen:
+			e.Status, e.Until, e.Assignee = "", time.Time{}, ""
+		}
+		if e.Status != "" || e.Assignee != "" {
+			entries = append(entries, e)
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Key() < entries[j].Key() })
+		return entries, nil
+	})
+	return e, err
+}
+
+// Command actions.
+const (
+	ActionSnooze        = "snooze"
+	ActionAssign        = "assign"
+	ActionFalsePositive = "false_positive"
+	ActionReopen        = "reopen"
+)
+
+// Command is a triage command given in chat. Finding is the 1-based number
+// of the finding in the last report of the conversation.
+type Command struct {
+	Action   string
+	Finding  int
+	For      time.Duration
+	Assignee string
+}
+
+var (
+	snoozeRe   = regexp.MustCompile(`(?i)\bsnooze\s+finding\s+#?(\d+)(?:\s+for\s+(\d+)\s*(hours?|h|days?|d|weeks?|w))?\b`)
+	assignRe   = regexp.MustCompile(`(?i)\bassign\s+finding\s+#?(\d+)\s+to\s+(@?[A-Za-z0-9][\w./-]*)`)
+	falsePosRe = regexp.MustCompile(`(?i)\bmark\s+finding\s+#?(\d+)\s+(?:as\s+)?(?:an?\s+)?false[\s-]positive\b`)
+	reopenRe   = regexp.MustCompile(`(?i)\b(?:reopen|unsnooze)\s+finding\s+#?(\d+)\b`)
+)
+
+// ParseCommand recognizes a triage command in a prompt:
+//
+//	snooze finding 3 [for 14 days]
+//	assign finding 2 to @team-x
+//	mark finding 5 [as] false positive
+//	reopen finding 5
+//
+// Snoozes last DefaultSnooze unless given, at most MaxSnooze.
+func ParseCommand(prompt string) (Command, bool) {
+	if m := snoozeRe.FindStringSubmatch(prompt); m != nil {
+		d := DefaultSnooze
+		if m[2] != "" {
+			n, err := strconv.Atoi(m[2])
+			unit := 24 * time.Hour
+			switch strings.ToLower(m[3])[0] {
+			case 'h':
+				unit = time.Hour
+			case 'w':
+				unit = 7 * 24 * time.Hour
+			}
+			d = time.Duration(n) * unit
+			if err != nil || n > int(MaxSnooze/time.Hour) || d > MaxSnooze {
+				d = MaxSnooze
+			}
+		}
+		return Command{Action: ActionSnooze, Finding: atoi(m[1]), For: d}, true
+	}
+	if m := assignRe.FindStringSubmatch(prompt); m != nil {
+		assignee := strings.TrimRight(m[2], ".,;:")
+		if !strings.HasPrefix(assignee, "@") {
+			assignee = "@" + assignee
+		}
+		return Command{Action: ActionAssign, Finding: atoi(m[1]), Assignee: assignee}, true
+	}
+	if m := falsePosRe.FindStringSubmatch(prompt); m != nil {
+		return Command{Action: ActionFalsePositive, Finding: atoi(m[1])}, true
+	}
+	if m := reopenRe.FindStringSubmatch(prompt); m != nil {
+		return Command{Action: ActionReopen, Finding: atoi(m[1])}, true
+	}
+	return Command{}, false
+}
+
+func atoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Describe renders what an entry now says about its finding.
+func (e Entry) Describe() string {
+	var parts []string
+	switch e.Status {
+	case StatusSnoozed:
+		parts = append(parts, "snoozed until "+e.Until.UTC().Format("2006-01-02 15:04 UTC"))
+	case StatusFalsePositive:
+		parts = append(parts, "marked false positive")
+	}
+	if e.Assignee != "" {
+		parts = append(parts, "assigned to "+e.Assignee)
+	}
+	if len(parts) == 0 {
+		return "open"
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,79 @@
+package triage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+func TestParseCommand(t *testing.T) {
+	for prompt, want := range map[string]Command{
+		"snooze finding 3 for 14 days":         {Action: ActionSnooze, Finding: 3, For: 14 * 24 * time.Hour},
+		"please snooze finding #2 for 2 weeks": {Action: ActionSnooze, Finding: 2, For: 14 * 24 * time.Hour},
+		"Snooze finding 1":                     {Action: ActionSnooze, Finding: 1, For: DefaultSnooze},
+		"snooze finding 1 for 9999 days":       {Action: ActionSnooze, Finding: 1, For: MaxSnooze},
+		"assign finding 2 to @teamX":           {Action: ActionAssign, Finding: 2, Assignee: "@teamX"},
+		"assign finding 2 to platform-team.":   {Action: ActionAssign, Finding: 2, Assignee: "@platform-team"},
+		"mark finding 5 false positive":        {Action: ActionFalsePositive, Finding: 5},
+		"mark finding 5 as a false-positive":   {Action: ActionFalsePositive, Finding: 5},
+		"reopen finding 4":                     {Action: ActionReopen, Finding: 4},
+	} {
+		got, ok := ParseCommand(prompt)
+		if !ok || got != want {
+			t.Errorf("ParseCommand(%q) = %+v, %v; want %+v", prompt, got, ok, want)
+		}
+	}
+	for _, prompt := range []string{"analyze this", "how do I snooze a finding?", "mark finding five false positive"} {
+		if cmd, ok := ParseCommand(prompt); ok {
+			t.Errorf("ParseCommand(%q) = %+v, want no command", prompt, cmd)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "triage.json")
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	https := protocol.Finding{RuleID: "POL-001", ResourceType: "azurerm_storage_account", Resource: "sa", Message: "HTTPS not enforced"}
+	tls := protocol.Finding{RuleID: "POL-003", ResourceType: "azurerm_storage_account", Resource: "sa", Message: "TLS 1.0"}
+	kv := protocol.Finding{RuleID: "POL-005", ResourceType: "azurerm_key_vault", Resource: "kv", Message: "Soft delete off"}
+	if _, err := s.Update(https, Command{Action: ActionSnooze, For: 14 * 24 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Update(tls, Command{Action: ActionFalsePositive}); err != nil {
+		t.Fatal(err)
+	}
+	e, err := s.Update(kv, Command{Action: ActionAssign, Assignee: "@security"})
+	if err != nil || e.Describe() != "assigned to @security" {
+		t.Fatalf("assign = %+v, %v", e, err)
+	}
+
+	// State survives a restart.
+	s, err = NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.now = func() time.Time { return now }
+	kept, hidden := s.Apply([]protocol.Finding{https, tls, kv}, now.Add(24*time.Hour))
+	if hidden != 2 || len(kept) != 1 || kept[0].Message != "Soft delete off (assigned to @security)" {
+		t.Errorf("Apply = %+v, %d hidden", kept, hidden)
+	}
+	// The snooze ends; the false positive stays hidden.
+	if kept, hidden := s.Apply([]protocol.Finding{https, tls}, now.Add(15*24*time.Hour)); hidden != 1 || kept[0].RuleID != "POL-001" {
+		t.Errorf("after snooze Apply = %+v, %d hidden", kept, hidden)
+	}
+
+	if _, err := s.Update(tls, Command{Action: ActionReopen}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Get(tls); ok || len(s.Entries()) != 2 {
+		t.Errorf("reopened finding still has state: %+v", s.Entries())
+	}
+}
@@ -0,0 +1,259 @@
+// Package verdict maps finding severities to organization-defined actions
+// (block, require approval, notify) so every consumer — the orchestrator
+// verdict, deploy gates, CI reporters — interprets severity the same way.
+package verdict
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+// Action is what a finding of a given severity means operationally.
+type Action string
+
+// Actions in increasing order of strictness.
+const (
+	ActionNone            Action = "none"
+	ActionNotify          Action = "notify"
+	ActionRequireApproval Action = "require_approval"
+	ActionBlock           Action = "block"
+)
+
+var actionRank = map[Action]int{
+	ActionNone:            0,
+	ActionNotify:          1,
+	ActionRequireApproval: 2,
+	ActionBlock:           3,
+}
+
+// Stricter reports whether a is stricter than b.
+func (a Action) Stricter(b Action) bool {
+	return actionRank[a] > actionRank[b]
+}
+
+// Label returns a short human-readable description of the action.
+func (a Action) Label() string {
+	switch a {
+	case ActionBlock:
+		return "Blocked"
+	case ActionRequireApproval:
+		return "Approval required"
+	case ActionNotify:
+		return "Passed with notifications"
+	default:
+		return "Passed"
+	}
+}
+
+// ExitCode is the process exit status a CI step should use for the
+// action: 0 when it passes, 1 when blocked and 2 when approval is required.
+func (a Action) ExitCode() int {
+	switch a {
+	case ActionBlock:
+		return 1
+	case ActionRequireApproval:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Policy maps each severity to an action.
+type Policy struct {
+	Actions map[protocol.Severity]Action
+	// Thresholds is the number of findings of a severity needed before its
+	// action applies; below it the findings only notify. Severities without
+	// a threshold act on the first finding.
+	Thresholds map[protocol.Severity]int
+	// LowConfidence, when set, caps the action for low-confidence findings
+	// (those resting on assumed defaults or unresolved expressions), e.g.
+	// require approval instead of blocking on a guess.
+	LowConfidence Action
+}
+
+// DefaultPolicy blocks critical and high findings, requires approval for
+// medium, and only notifies for low. Low-confidence findings are not
+// capped.
+func DefaultPolicy() Policy {
+	return Policy{Actions: map[protocol.Severity]Action{
+		protocol.SeverityCritical: ActionBlock,
+		protocol.SeverityHigh:     ActionBlock,
+		protocol.SeverityMedium:   ActionRequireApproval,
+		protocol.SeverityLow:      ActionNotify,
+		protocol.SeverityInfo:     ActionNone,
+	}}
+}
+
+// lowConfidenceKey is the ParsePolicy entry that sets Policy.LowConfidence.
+const lowConfidenceKey = "low_confidence"
+
+// ParsePolicy parses "severity=action,..." entries over DefaultPolicy, e.g.
+// "high=require_approval,medium=notify". A "low_confidence=action" entry
+// caps the action for low-confidence findings.
+func ParsePolicy(s string) (Policy, error) {
+	p := DefaultPolicy()
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, act, ok := strings.Cut(entry, "=")
+		action := Action(strings.ToLower(strings.TrimSpace(act)))
+		if !ok {
+			return Policy{}, fmt.Errorf("invalid severity action %q (want severity=action)", entry)
+		}
+		if _, known := actionRank[action]; !known {
+			return Policy{}, fmt.Errorf("unknown action %q for %s (want block, require_approval, notify or none)", act, strings.TrimSpace(name))
+		}
+		if strings.EqualFold(strings.TrimSpace(name), lowConfidenceKey) {
+			p.LowConfidence = action
+			continue
+		}
+		sev, known := protocol.ParseSeverity(name)
+		if !known {
+			return Policy{}, fmt.Errorf("unknown severity %q", strings.TrimSpace(name))
+		}
+		p.Actions[sev] = action
+	}
+	return p, nil
+}
+
+// ParseThresholds parses "severity=count,..." entries into the minimum
+// number of findings of each severity before its action applies, e.g.
+// "medium=5,low=20".
+func ParseThresholds(s string) (map[protocol.Severity]int, error) {
+	thresholds := make(map[protocol.Severity]int)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, count, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid severity threshold %q (want severity=count)", entry)
+		}
+		sev, known := protocol.ParseSeverity(name)
+		if !known {
+			return nil, fmt.Errorf("unknown severity %q", strings.TrimSpace(name))
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(count))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid threshold %q for %s (want a count of at least 1)", count, sev)
+		}
+		thresholds[sev] = n
+	}
+	return thresholds, nil
+}
+
+// ActionFor returns the action for a severity. Unknown severities notify.
+func (p Policy) ActionFor(severity protocol.Severity) Action {
+	if a, ok := p.Actions[severity]; ok {
+		return a
+	}
+	return ActionNotify
+}
+
+// actionForFinding applies the severity threshold, given the number of
+// findings of sev, and the low-confidence cap to ActionFor. The second
+// result reports whether the cap lowered the action.
+func (p Policy) actionForFinding(f protocol.Finding, sev protocol.Severity, count int) (Action, bool) {
+	a := p.ActionFor(sev)
+	if count < p.Thresholds[sev] && a.Stricter(ActionNotify) {
+		a = ActionNotify
+	}
+	if p.LowConfidence != "" && f.Confidence == protocol.ConfidenceLow && a.Stricter(p.LowConfidence) {
+		return p.LowConfidence, true
+	}
+	return a, false
+}
+
+// Verdict is the combined outcome for a set of findings.
+type Verdict struct {
+	Action Action                    `json:"action"`
+	Counts map[protocol.Severity]int `json:"counts"`
+	// Triggers lists the severities that produced the verdict action.
+	Triggers []protocol.Severity `json:"triggers,omitempty"`
+	// Capped counts low-confidence findings whose action the policy lowered.
+	Capped int `json:"low_confidence_capped,omitempty"`
+	// CappedAt is the policy's low-confidence action when Capped > 0.
+	CappedAt Action `json:"low_confidence_action,omitempty"`
+}
+
+// Evaluate returns the strictest action across findings.
+func (p Policy) Evaluate(findings []protocol.Finding) Verdict {
+	v := Verdict{Action: ActionNone, Counts: make(map[protocol.Severity]int)}
+	triggers := make(map[protocol.Severity]bool)
+	for _, f := range findings {
+		v.Counts[protocol.NormalizeSeverity(string(f.Severity))]++
+	}
+	for _, f := range findings {
+		sev := protocol.NormalizeSeverity(string(f.Severity))
+		a, capped := p.actionForFinding(f, sev, v.Counts[sev])
+		if capped {
+			v.Capped++
+			v.CappedAt = p.LowConfidence
+		}
+		switch {
+		case a.Stricter(v.Action):
+			v.Action = a
+			triggers = map[protocol.Severity]bool{sev: true}
+		case a == v.Action && a != ActionNone:
+			triggers[sev] = true
+		}
+	}
+	for _, sev := range protocol.Severities {
+		if triggers[sev] {
+			v.Triggers = append(v.Triggers, sev)
+		}
+	}
+	return v
+}
+
+// Passed reports whether the verdict lets a change through without
+// approval.
+func (v Verdict) Passed() bool {
+	return !v.Action.Stricter(ActionNotify)
+}
+
+// Report is the machine-readable form of a verdict that CI steps and other
+// gates read instead of the markdown summary. Counts lists every severity,
+// including those without findings.
+type Report struct {
+	Verdict
+	Passed   bool `json:"passed"`
+	ExitCode int  `json:"exit_code"`
+	Total    int  `json:"total"`
+}
+
+// Report returns the machine-readable form of v.
+func (v Verdict) Report() Report {
+	r := Report{Verdict: v, Passed: v.Passed(), ExitCode: v.Action.ExitCode()}
+	r.Counts = make(map[protocol.Severity]int, len(protocol.Severities))
+	for _, sev := range protocol.Severities {
+		r.Counts[sev] = 0
+	}
+	for sev, n := range v.Counts {
+		r.Counts[sev] = n
+		r.Total += n
+	}
+	return r
+}
+
+// Summary renders the verdict as a one-line markdown sentence.
+func (v Verdict) Summary() string {
+	if len(v.Triggers) == 0 {
+		return fmt.Sprintf("**%s** — no findings require action.", v.Action.Label())
+	}
+	parts := make([]string, 0, len(v.Triggers))
+	for _, sev := range v.Triggers {
+		parts = append(parts, fmt.Sprintf("%d %s", v.Counts[sev], sev))
+	}
+	summary := fmt.Sprintf("**%s** — %s finding(s).", v.Action.Label(), strings.Join(parts, ", "))
+	if v.Capped > 0 {
+		summary += fmt.Sprintf(" %d low-confidence finding(s) capped at %s.", v.Capped, v.CappedAt)
+	}
+	return summary
+}
@@ -0,0 +1,126 @@
+package verdict
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ghcp-iac/ghcp-iac-workflow/internal/protocol"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("high=require_approval, Medium=notify")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.ActionFor("high") != ActionRequireApproval || p.ActionFor("medium") != ActionNotify {
+		t.Errorf("overrides not applied: %v", p)
+	}
+	if p.ActionFor("critical") != ActionBlock {
+		t.Errorf("critical = %s, want default block", p.ActionFor("critical"))
+	}
+}
+
+func TestParsePolicy_Invalid(t *testing.T) {
+	for _, in := range []string{"high", "urgent=block", "high=page"} {
+		if _, err := ParsePolicy(in); err == nil {
+			t.Errorf("ParsePolicy(%q) expected error", in)
+		}
+	}
+}
+
+func TestEvaluate_StrictestAction(t *testing.T) {
+	findings := []protocol.Finding{
+		{Severity: "low"}, {Severity: "medium"}, {Severity: "medium"},
+	}
+	v := DefaultPolicy().Evaluate(findings)
+	if v.Action != ActionRequireApproval {
+		t.Errorf("action = %s, want require_approval", v.Action)
+	}
+	if !strings.Contains(v.Summary(), "2 medium") {
+		t.Errorf("summary = %q", v.Summary())
+	}
+
+	v = DefaultPolicy().Evaluate(nil)
+	if v.Action != ActionNone || !strings.Contains(v.Summary(), "no findings require action") {
+		t.Errorf("empty verdict = %+v", v)
+	}
+}
+
+func TestEvaluate_NormalizesExternalLevels(t *testing.T) {
+	findings := []protocol.Finding{{Severity: "error"}, {Severity: "WARNING"}}
+	v := DefaultPolicy().Evaluate(findings)
+	if v.Action != ActionBlock || v.Counts[protocol.SeverityHigh] != 1 || v.Counts[protocol.SeverityMedium] != 1 {
+		t.Errorf("verdict = %+v, want error→high blocking and warning→medium", v)
+	}
+	if !protocol.SeverityCritical.AtLeast(protocol.SeverityHigh) || protocol.SeverityLow.AtLeast(protocol.SeverityMedium) {
+		t.Error("severity ranks out of order")
+	}
+}
+
+func TestEvaluate_LowConfidenceCap(t *testing.T) {
+	p, err := ParsePolicy("low_confidence=require_approval")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.LowConfidence != ActionRequireApproval {
+		t.Fatalf("LowConfidence = %q", p.LowConfidence)
+	}
+
+	guess := []protocol.Finding{{Severity: "high", Confidence: protocol.ConfidenceLow}, {Severity: "low"}}
+	v := p.Evaluate(guess)
+	if v.Action != ActionRequireApproval || v.Capped != 1 {
+		t.Errorf("verdict = %+v, want low-confidence high capped at require_approval", v)
+	}
+	if !strings.Contains(v.Summary(), "1 low-confidence finding(s) capped at require_approval") {
+		t.Errorf("summary = %q", v.Summary())
+	}
+
+	v = p.Evaluate(append(guess, protocol.Finding{Severity: "high", Confidence: protocol.ConfidenceMedium}))
+	if v.Action != ActionBlock {
+		t.Errorf("action = %s, want medium-confidence high to still block", v.Action)
+	}
+	if v = DefaultPolicy().Evaluate(guess); v.Action != ActionBlock || v.Capped != 0 {
+		t.Errorf("default policy verdict = %+v, want uncapped block", v)
+	}
+}
+
+func TestEvaluate_Thresholds(t *testing.T) {
+	thresholds, err := ParseThresholds("medium=3, high=2")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p := DefaultPolicy()
+	p.Thresholds = thresholds
+
+	v := p.Evaluate([]protocol.Finding{{Severity: "medium"}, {Severity: "medium"}, {Severity: "high"}})
+	if v.Action != ActionNotify || !v.Passed() || v.Action.ExitCode() != 0 {
+		t.Errorf("below thresholds verdict = %+v, want notify", v)
+	}
+	v = p.Evaluate([]protocol.Finding{{Severity: "medium"}, {Severity: "medium"}, {Severity: "medium"}, {Severity: "high"}})
+	if v.Action != ActionRequireApproval || v.Passed() || v.Action.ExitCode() != 2 {
+		t.Errorf("medium threshold verdict = %+v, want require_approval", v)
+	}
+	v = p.Evaluate([]protocol.Finding{{Severity: "high"}, {Severity: "high"}, {Severity: "critical"}})
+	if v.Action != ActionBlock || v.Action.ExitCode() != 1 || len(v.Triggers) != 2 {
+		t.Errorf("high threshold verdict = %+v, want block on critical and high", v)
+	}
+
+	for _, in := range []string{"medium", "medium=0", "medium=many", "urgent=1"} {
+		if _, err := ParseThresholds(in); err == nil {
+			t.Errorf("ParseThresholds(%q) expected error", in)
+		}
+	}
+}
+
+func TestVerdict_Report(t *testing.T) {
+	r := DefaultPolicy().Evaluate([]protocol.Finding{{Severity: "high"}, {Severity: "low"}}).Report()
+	if r.Passed || r.ExitCode != 1 || r.Total != 2 || r.Counts[protocol.SeverityHigh] != 1 {
+		t.Errorf("report = %+v", r)
+	}
+	if n, ok := r.Counts[protocol.SeverityMedium]; !ok || n != 0 {
+		t.Errorf("counts = %v, want every severity listed", r.Counts)
+	}
+	if r = DefaultPolicy().Evaluate(nil).Report(); !r.Passed || r.ExitCode != 0 || r.Action != ActionNone {
+		t.Errorf("empty report = %+v", r)
+	}
+}